@@ -0,0 +1,101 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	"agola.io/agola/internal/backup"
+	scommon "agola.io/agola/internal/common"
+	"agola.io/agola/internal/datamanager"
+	"agola.io/agola/internal/objectstorage"
+	"agola.io/agola/internal/services/config"
+	"agola.io/agola/internal/services/configstore"
+	rsscheduler "agola.io/agola/internal/services/runservice"
+	rscommon "agola.io/agola/internal/services/runservice/common"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdAdmin = &cobra.Command{
+	Use:   "admin",
+	Short: "admin",
+}
+
+func init() {
+	cmdAgola.AddCommand(cmdAdmin)
+}
+
+// adminStores returns the backup stores of the services that store their data
+// using the datamanager (configstore and runservice) directly accessing their
+// etcd and objectstorages defined in the config file
+func adminStores(ctx context.Context, c *config.Config) ([]*backup.Store, error) {
+	csost, err := scommon.NewObjectStorage(&c.Configstore.ObjectStorage)
+	if err != nil {
+		return nil, err
+	}
+	cse, err := scommon.NewEtcd(&c.Configstore.Etcd, logger, "configstore")
+	if err != nil {
+		return nil, err
+	}
+	csdmConfig := configstore.DataManagerConfig(cse, csost)
+	csdm, err := datamanager.NewDataManager(ctx, logger, csdmConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	rsost, err := scommon.NewObjectStorage(&c.Runservice.ObjectStorage)
+	if err != nil {
+		return nil, err
+	}
+	rsosts := map[string]*objectstorage.ObjStorage{"default": rsost}
+	for name, p := range c.Runservice.ObjectStoragePartitions {
+		pc := p
+		post, err := scommon.NewObjectStorage(&pc.ObjectStorage)
+		if err != nil {
+			return nil, errors.Errorf("failed to create object storage for storage partition %q: %w", name, err)
+		}
+		rsosts["partition-"+name] = post
+	}
+	rse, err := scommon.NewEtcd(&c.Runservice.Etcd, logger, "runservice")
+	if err != nil {
+		return nil, err
+	}
+	rsdmConfig := rsscheduler.DataManagerConfig(rse, rsost)
+	rsdm, err := datamanager.NewDataManager(ctx, logger, rsdmConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*backup.Store{
+		{
+			Name:       "configstore",
+			DM:         csdm,
+			DMBasePath: csdmConfig.BasePath,
+			E:          cse,
+			OSTs:       map[string]*objectstorage.ObjStorage{"default": csost},
+		},
+		{
+			Name:       "runservice",
+			DM:         rsdm,
+			DMBasePath: rsdmConfig.BasePath,
+			E:          rse,
+			// the active runs, executor tasks and changegroups
+			EtcdDirs: []string{rscommon.EtcdSchedulerBaseDir},
+			OSTs:     rsosts,
+		},
+	}, nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"os"
+
+	"agola.io/agola/internal/backup"
+	"agola.io/agola/internal/services/config"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdAdminBackup = &cobra.Command{
+	Use:   "backup",
+	Short: "backup the configstore and runservice data",
+	Long: `backup the configstore and runservice data
+
+The data is read directly from the etcd clusters and objectstorages defined in the config file. The backup can be executed with the services running.
+It saves the configstore and runservice data managed by the datamanager, the runservice state kept in etcd (active runs, executor tasks, changegroups) and all the other objects in the objectstorages (runs logs, archives and caches, also of the storage partitions).
+To export the data before an upgrade or an etcd/objectstorage migration, enable the maintenance mode first so no new runs will be scheduled and the saved data will be consistent.
+The etcd keys bound to a lease (locks, executor task leases) aren't saved.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := adminBackup(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type adminBackupOptions struct {
+	config string
+	dir    string
+}
+
+var adminBackupOpts adminBackupOptions
+
+func init() {
+	flags := cmdAdminBackup.Flags()
+
+	flags.StringVar(&adminBackupOpts.config, "config", "./config.yml", "config file path")
+	flags.StringVar(&adminBackupOpts.dir, "dir", "", "directory where the backup files will be written")
+
+	if err := cmdAdminBackup.MarkFlagRequired("dir"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdAdmin.AddCommand(cmdAdminBackup)
+}
+
+func adminBackup(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	c, err := config.Parse(adminBackupOpts.config)
+	if err != nil {
+		return errors.Errorf("config error: %w", err)
+	}
+
+	if err := os.MkdirAll(adminBackupOpts.dir, 0770); err != nil {
+		return errors.Errorf("failed to create backup dir: %w", err)
+	}
+
+	stores, err := adminStores(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range stores {
+		log.Infof("backing up %s data", s.Name)
+		if err := backup.Backup(ctx, s, adminBackupOpts.dir); err != nil {
+			return errors.Errorf("failed to backup %s: %w", s.Name, err)
+		}
+		log.Infof("%s data saved to %q", s.Name, adminBackupOpts.dir)
+	}
+
+	return nil
+}
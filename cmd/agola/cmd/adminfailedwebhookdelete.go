@@ -0,0 +1,63 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	"agola.io/agola/internal/services/gateway/api"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdAdminFailedWebhookDelete = &cobra.Command{
+	Use:   "delete",
+	Short: "delete a failed webhook",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := adminFailedWebhookDelete(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type adminFailedWebhookDeleteOptions struct {
+	id string
+}
+
+var adminFailedWebhookDeleteOpts adminFailedWebhookDeleteOptions
+
+func init() {
+	flags := cmdAdminFailedWebhookDelete.Flags()
+
+	flags.StringVar(&adminFailedWebhookDeleteOpts.id, "id", "", "failed webhook id")
+
+	if err := cmdAdminFailedWebhookDelete.MarkFlagRequired("id"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdAdminFailedWebhook.AddCommand(cmdAdminFailedWebhookDelete)
+}
+
+func adminFailedWebhookDelete(cmd *cobra.Command, args []string) error {
+	gwclient := api.NewClient(gatewayURL, token)
+
+	log.Infof("deleting failed webhook %q", adminFailedWebhookDeleteOpts.id)
+	if _, err := gwclient.DeleteFailedWebhook(context.TODO(), adminFailedWebhookDeleteOpts.id); err != nil {
+		return errors.Errorf("failed to delete failed webhook: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"agola.io/agola/internal/services/gateway/api"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdAdminFailedWebhookList = &cobra.Command{
+	Use: "list",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := adminFailedWebhookList(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+	Short: "list failed webhooks",
+}
+
+func init() {
+	cmdAdminFailedWebhook.AddCommand(cmdAdminFailedWebhookList)
+}
+
+func printFailedWebhooks(fws []*api.FailedWebhookResponse) {
+	for _, fw := range fws {
+		fmt.Printf("%s: Project: %s, Failure time: %s\n", fw.ID, fw.ProjectID, fw.FailureTime)
+		fmt.Printf("\tError: %s\n", fw.Error)
+	}
+}
+
+func adminFailedWebhookList(cmd *cobra.Command, args []string) error {
+	gwclient := api.NewClient(gatewayURL, token)
+
+	fws, _, err := gwclient.GetFailedWebhooks(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	printFailedWebhooks(fws)
+
+	return nil
+}
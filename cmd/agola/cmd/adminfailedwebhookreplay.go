@@ -0,0 +1,63 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	"agola.io/agola/internal/services/gateway/api"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdAdminFailedWebhookReplay = &cobra.Command{
+	Use:   "replay",
+	Short: "replay a failed webhook",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := adminFailedWebhookReplay(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type adminFailedWebhookReplayOptions struct {
+	id string
+}
+
+var adminFailedWebhookReplayOpts adminFailedWebhookReplayOptions
+
+func init() {
+	flags := cmdAdminFailedWebhookReplay.Flags()
+
+	flags.StringVar(&adminFailedWebhookReplayOpts.id, "id", "", "failed webhook id")
+
+	if err := cmdAdminFailedWebhookReplay.MarkFlagRequired("id"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdAdminFailedWebhook.AddCommand(cmdAdminFailedWebhookReplay)
+}
+
+func adminFailedWebhookReplay(cmd *cobra.Command, args []string) error {
+	gwclient := api.NewClient(gatewayURL, token)
+
+	log.Infof("replaying failed webhook %q", adminFailedWebhookReplayOpts.id)
+	if _, err := gwclient.ReplayFailedWebhook(context.TODO(), adminFailedWebhookReplayOpts.id); err != nil {
+		return errors.Errorf("failed to replay failed webhook: %w", err)
+	}
+
+	return nil
+}
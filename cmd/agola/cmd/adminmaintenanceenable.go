@@ -0,0 +1,49 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	"agola.io/agola/internal/services/gateway/api"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdAdminMaintenanceEnable = &cobra.Command{
+	Use:   "enable",
+	Short: "enable the maintenance mode",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := adminMaintenanceEnable(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+func init() {
+	cmdAdminMaintenance.AddCommand(cmdAdminMaintenanceEnable)
+}
+
+func adminMaintenanceEnable(cmd *cobra.Command, args []string) error {
+	gwclient := api.NewClient(gatewayURL, token)
+
+	log.Infof("enabling maintenance mode")
+	if _, _, err := gwclient.EnableMaintenance(context.TODO()); err != nil {
+		return errors.Errorf("failed to enable maintenance mode: %w", err)
+	}
+
+	return nil
+}
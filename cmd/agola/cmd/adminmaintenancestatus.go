@@ -0,0 +1,56 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"agola.io/agola/internal/services/gateway/api"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdAdminMaintenanceStatus = &cobra.Command{
+	Use:   "status",
+	Short: "show the maintenance mode status",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := adminMaintenanceStatus(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+func init() {
+	cmdAdminMaintenance.AddCommand(cmdAdminMaintenanceStatus)
+}
+
+func adminMaintenanceStatus(cmd *cobra.Command, args []string) error {
+	gwclient := api.NewClient(gatewayURL, token)
+
+	maintenance, _, err := gwclient.GetMaintenance(context.TODO())
+	if err != nil {
+		return errors.Errorf("failed to get maintenance mode status: %w", err)
+	}
+
+	if !maintenance.Enabled {
+		fmt.Printf("Maintenance mode: disabled, Queued webhooks: %d\n", maintenance.QueuedWebhooks)
+		return nil
+	}
+	fmt.Printf("Maintenance mode: enabled since %s, Queued webhooks: %d\n", maintenance.EnableTime, maintenance.QueuedWebhooks)
+
+	return nil
+}
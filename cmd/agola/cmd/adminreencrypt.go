@@ -0,0 +1,119 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"sort"
+
+	scommon "agola.io/agola/internal/common"
+	"agola.io/agola/internal/objectstorage/crypt"
+	"agola.io/agola/internal/services/config"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdAdminReencrypt = &cobra.Command{
+	Use:   "reencrypt",
+	Short: "reencrypt the objectstorages objects with the current encryption key",
+	Long: `reencrypt the objectstorages objects with the current encryption key
+
+All the objects of the encrypted objectstorages defined in the config file that aren't encrypted with the current (first) encryption key are rewritten encrypted with it.
+Execute it after adding a new encryption key, when it completes the old keys can be removed from the config file.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := adminReencrypt(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type adminReencryptOptions struct {
+	config string
+}
+
+var adminReencryptOpts adminReencryptOptions
+
+func init() {
+	flags := cmdAdminReencrypt.Flags()
+
+	flags.StringVar(&adminReencryptOpts.config, "config", "./config.yml", "config file path")
+
+	cmdAdmin.AddCommand(cmdAdminReencrypt)
+}
+
+func adminReencrypt(cmd *cobra.Command, args []string) error {
+	c, err := config.Parse(adminReencryptOpts.config)
+	if err != nil {
+		return errors.Errorf("config error: %w", err)
+	}
+
+	type namedOST struct {
+		name string
+		c    *config.ObjectStorage
+	}
+	osts := []namedOST{
+		{name: "gateway", c: &c.Gateway.ObjectStorage},
+		{name: "configstore", c: &c.Configstore.ObjectStorage},
+		{name: "runservice", c: &c.Runservice.ObjectStorage},
+		{name: "gitserver", c: &c.Gitserver.ObjectStorage},
+	}
+	partitions := []string{}
+	for name := range c.Runservice.ObjectStoragePartitions {
+		partitions = append(partitions, name)
+	}
+	sort.Strings(partitions)
+	for _, name := range partitions {
+		p := c.Runservice.ObjectStoragePartitions[name]
+		osts = append(osts, namedOST{name: "runservice partition " + name, c: &p.ObjectStorage})
+	}
+
+	for _, nost := range osts {
+		if nost.c.Encryption == nil {
+			continue
+		}
+		ost, err := scommon.NewObjectStorage(nost.c)
+		if err != nil {
+			return err
+		}
+		cs, ok := ost.Storage.(*crypt.CryptStorage)
+		if !ok {
+			return errors.Errorf("%s objectstorage isn't encrypted", nost.name)
+		}
+
+		log.Infof("reencrypting %s objectstorage", nost.name)
+
+		doneCh := make(chan struct{})
+		count := 0
+		for object := range ost.List("", "", true, doneCh) {
+			if object.Err != nil {
+				close(doneCh)
+				return errors.Errorf("failed to list %s objectstorage objects: %w", nost.name, object.Err)
+			}
+			reencrypted, err := cs.Reencrypt(object.Path)
+			if err != nil {
+				close(doneCh)
+				return errors.Errorf("failed to reencrypt object %q: %w", object.Path, err)
+			}
+			if reencrypted {
+				count++
+			}
+		}
+		close(doneCh)
+
+		log.Infof("%s objectstorage: %d objects reencrypted", nost.name, count)
+	}
+
+	return nil
+}
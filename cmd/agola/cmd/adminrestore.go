@@ -0,0 +1,82 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	"agola.io/agola/internal/backup"
+	"agola.io/agola/internal/services/config"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdAdminRestore = &cobra.Command{
+	Use:   "restore",
+	Short: "restore the configstore and runservice data",
+	Long: `restore the configstore and runservice data
+
+The data is restored directly to the etcd clusters and objectstorages defined in the config file. They must be empty (a fresh install) and the agola services must not be running.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := adminRestore(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type adminRestoreOptions struct {
+	config string
+	dir    string
+}
+
+var adminRestoreOpts adminRestoreOptions
+
+func init() {
+	flags := cmdAdminRestore.Flags()
+
+	flags.StringVar(&adminRestoreOpts.config, "config", "./config.yml", "config file path")
+	flags.StringVar(&adminRestoreOpts.dir, "dir", "", "directory containing the backup files")
+
+	if err := cmdAdminRestore.MarkFlagRequired("dir"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdAdmin.AddCommand(cmdAdminRestore)
+}
+
+func adminRestore(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	c, err := config.Parse(adminRestoreOpts.config)
+	if err != nil {
+		return errors.Errorf("config error: %w", err)
+	}
+
+	stores, err := adminStores(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range stores {
+		log.Infof("restoring %s data", s.Name)
+		if err := backup.Restore(ctx, s, adminRestoreOpts.dir); err != nil {
+			return errors.Errorf("failed to restore %s: %w", s.Name, err)
+		}
+		log.Infof("%s data restored from %q", s.Name, adminRestoreOpts.dir)
+	}
+
+	return nil
+}
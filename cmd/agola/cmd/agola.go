@@ -33,6 +33,10 @@ var log = logger.Sugar()
 
 var token string
 
+// otp is the two factor authentication code sent with the sensitive
+// operations requests
+var otp string
+
 var cmdAgola = &cobra.Command{
 	Use:     "agola",
 	Short:   "agola",
@@ -76,6 +80,7 @@ func init() {
 
 	flags.StringVarP(&agolaOpts.gatewayURL, "gateway-url", "u", gatewayURL, "agola gateway exposed url")
 	flags.StringVar(&token, "token", token, "api token")
+	flags.StringVar(&otp, "otp", "", "two factor authentication code, required by the sensitive operations when enabled")
 	flags.BoolVarP(&agolaOpts.debug, "debug", "d", false, "debug")
 }
 
@@ -0,0 +1,109 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"agola.io/agola/internal/config"
+	"agola.io/agola/internal/services/gateway/api"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdConfigValidate = &cobra.Command{
+	Use: "validate",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := configValidate(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+	Short: "validate a run config file and report its lint issues",
+	Long: `validate a run config file and report its lint issues
+
+The command fails when the config is invalid or when there're lint issues with error severity.`,
+}
+
+type configValidateOptions struct {
+	file   string
+	format string
+}
+
+var configValidateOpts configValidateOptions
+
+func init() {
+	flags := cmdConfigValidate.Flags()
+
+	flags.StringVarP(&configValidateOpts.file, "file", "f", ".agola/config.yml", "config file path")
+	flags.StringVar(&configValidateOpts.format, "format", "", "config format (yaml, json or jsonnet). If empty it's detected from the file extension")
+
+	cmdConfig.AddCommand(cmdConfigValidate)
+}
+
+func configValidate(cmd *cobra.Command, args []string) error {
+	gwclient := api.NewClient(gatewayURL, token)
+
+	data, err := ioutil.ReadFile(configValidateOpts.file)
+	if err != nil {
+		return errors.Errorf("failed to read config file: %w", err)
+	}
+
+	format := configValidateOpts.format
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(configValidateOpts.file), ".")
+		if format == "yml" {
+			format = "yaml"
+		}
+	}
+
+	req := &api.ValidateConfigRequest{
+		Config: string(data),
+		Format: format,
+	}
+	res, _, err := gwclient.ValidateConfig(context.TODO(), req)
+	if err != nil {
+		return errors.Errorf("failed to validate config: %w", err)
+	}
+
+	if res.Error != nil {
+		fmt.Printf("%s: error: %s\n", configLocation(configValidateOpts.file, res.Error.Line, res.Error.Column), res.Error.Message)
+		return errors.Errorf("invalid config")
+	}
+
+	lintErrors := 0
+	for _, issue := range res.LintIssues {
+		fmt.Printf("%s: %s: %s (%s)\n", configLocation(configValidateOpts.file, issue.Line, issue.Column), issue.Severity, issue.Message, issue.Rule)
+		if config.LintSeverity(issue.Severity) == config.LintSeverityError {
+			lintErrors++
+		}
+	}
+	if lintErrors > 0 {
+		return errors.Errorf("%d lint issues with error severity", lintErrors)
+	}
+
+	return nil
+}
+
+func configLocation(file string, line, column int) string {
+	if line == 0 {
+		return file
+	}
+	return fmt.Sprintf("%s:%d:%d", file, line, column)
+}
@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"path"
+	"strings"
 
 	gitsave "agola.io/agola/internal/git-save"
 	"agola.io/agola/internal/services/gateway/api"
@@ -44,6 +45,7 @@ type directRunStartOptions struct {
 	start        string
 	untracked    bool
 	ignored      bool
+	localDiff    bool
 }
 
 var directRunStartOpts directRunStartOptions
@@ -57,6 +59,7 @@ func init() {
 	flags.StringVar(&directRunStartOpts.start, "start", "", "starting run id (excluded) to fetch")
 	flags.BoolVar(&directRunStartOpts.untracked, "untracked", true, "push untracked files")
 	flags.BoolVar(&directRunStartOpts.ignored, "ignored", false, "push ignored files")
+	flags.BoolVar(&directRunStartOpts.localDiff, "local-diff", false, "push only the current HEAD commit and upload the local changes as a patch that will be applied by the clone step (the run config is read from the HEAD commit)")
 
 	cmdDirectRun.AddCommand(cmdDirectRunStart)
 }
@@ -92,12 +95,38 @@ func directRunStart(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	// the ref to push to the remote branch
+	pushRef := path.Join(gs.RefsPrefix(), branch)
+
+	var patch []byte
+	if directRunStartOpts.localDiff {
+		// push the HEAD commit and generate a patch with the differences between
+		// it and the saved worktree commit
+		out, err := git.Output(context.Background(), nil, "rev-parse", "HEAD")
+		if err != nil {
+			return err
+		}
+		headSHA := strings.TrimSpace(string(out))
+
+		patch, err = git.Output(context.Background(), nil, "diff", "--binary", headSHA, commitSHA)
+		if err != nil {
+			return err
+		}
+		if len(patch) == 0 {
+			log.Infof("no local changes")
+		}
+
+		pushRef = headSHA
+		commitSHA = headSHA
+		message = "agola direct run with local changes"
+	}
+
 	log.Infof("pushing branch")
 	repoPath := fmt.Sprintf("%s/%s", user.ID, repoUUID)
 	repoURL := fmt.Sprintf("%s/repos/%s/%s.git", gatewayURL, user.ID, repoUUID)
 
 	// push to a branch with default branch refs "refs/heads/branch"
-	if err := gitsave.GitPush("", repoURL, fmt.Sprintf("%s:refs/heads/%s", path.Join(gs.RefsPrefix(), branch), branch)); err != nil {
+	if err := gitsave.GitPush("", repoURL, fmt.Sprintf("%s:refs/heads/%s", pushRef, branch)); err != nil {
 		return err
 	}
 
@@ -108,6 +137,7 @@ func directRunStart(cmd *cobra.Command, args []string) error {
 		Branch:    branch,
 		CommitSHA: commitSHA,
 		Message:   message,
+		Patch:     patch,
 	}
 	if _, err := gwclient.UserCreateRun(context.TODO(), req); err != nil {
 		return err
@@ -0,0 +1,63 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	"agola.io/agola/internal/services/gateway/api"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdExecutorApprove = &cobra.Command{
+	Use:   "approve",
+	Short: "approve an executor waiting approval",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := executorApprove(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type executorApproveOptions struct {
+	id string
+}
+
+var executorApproveOpts executorApproveOptions
+
+func init() {
+	flags := cmdExecutorApprove.Flags()
+
+	flags.StringVar(&executorApproveOpts.id, "id", "", "executor id")
+
+	if err := cmdExecutorApprove.MarkFlagRequired("id"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdExecutor.AddCommand(cmdExecutorApprove)
+}
+
+func executorApprove(cmd *cobra.Command, args []string) error {
+	gwclient := api.NewClient(gatewayURL, token)
+
+	log.Infof("approving executor %q", executorApproveOpts.id)
+	if _, err := gwclient.ApproveExecutor(context.TODO(), executorApproveOpts.id); err != nil {
+		return errors.Errorf("failed to approve executor: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"agola.io/agola/internal/services/gateway/api"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdExecutorList = &cobra.Command{
+	Use: "list",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := executorList(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+	Short: "list executors",
+}
+
+type executorListOptions struct {
+	waitingApproval bool
+}
+
+var executorListOpts executorListOptions
+
+func init() {
+	flags := cmdExecutorList.Flags()
+
+	flags.BoolVar(&executorListOpts.waitingApproval, "waiting-approval", false, "only show executors waiting approval")
+
+	cmdExecutor.AddCommand(cmdExecutorList)
+}
+
+func printExecutors(executors []*api.ExecutorResponse) {
+	for _, e := range executors {
+		if executorListOpts.waitingApproval && !e.WaitingApproval {
+			continue
+		}
+		status := "approved"
+		if e.WaitingApproval {
+			status = "waiting approval"
+		}
+		fmt.Printf("%s: Status: %s, Archs: %s, Active tasks: %d, Last update: %s, Remote address: %s\n", e.ID, status, strings.Join(e.Archs, ","), e.ActiveTasks, e.LastStatusUpdateTime, e.RemoteAddress)
+		if e.HostFacts != nil {
+			fmt.Printf("\tHostname: %s, OS: %s, CPUs: %d, IP addresses: %s\n", e.HostFacts.Hostname, e.HostFacts.OS, e.HostFacts.NumCPU, strings.Join(e.HostFacts.IPAddresses, ","))
+		}
+	}
+}
+
+func executorList(cmd *cobra.Command, args []string) error {
+	gwclient := api.NewClient(gatewayURL, token)
+
+	executors, _, err := gwclient.GetExecutors(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	printExecutors(executors)
+
+	return nil
+}
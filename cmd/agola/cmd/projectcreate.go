@@ -16,6 +16,7 @@ package cmd
 
 import (
 	"context"
+	"time"
 
 	"agola.io/agola/internal/services/gateway/api"
 	"agola.io/agola/internal/services/types"
@@ -41,6 +42,16 @@ type projectCreateOptions struct {
 	remoteSourceName    string
 	skipSSHHostKeyCheck bool
 	visibility          string
+	pollingInterval     time.Duration
+	configDirs          []string
+	configPath          string
+	configRepoPath      string
+	configRepoRef       string
+	remoteTasksRepos    []string
+	taskCommitStatuses  bool
+	emailRecipients     []string
+	emailMode           string
+	emailDigest         bool
 }
 
 var projectCreateOpts projectCreateOptions
@@ -54,6 +65,16 @@ func init() {
 	flags.BoolVarP(&projectCreateOpts.skipSSHHostKeyCheck, "skip-ssh-host-key-check", "s", false, "skip ssh host key check")
 	flags.StringVar(&projectCreateOpts.parentPath, "parent", "", `parent project group path (i.e "org/org01" for root project group in org01, "user/user01/group01/subgroub01") or project group id where the project should be created`)
 	flags.StringVar(&projectCreateOpts.visibility, "visibility", "public", `project visibility (public or private)`)
+	flags.DurationVar(&projectCreateOpts.pollingInterval, "polling-interval", 0, "poll the remote repository for new commits, tags and pull requests at this interval instead of relying on webhooks (0 disables polling)")
+	flags.StringArrayVar(&projectCreateOpts.configDirs, "config-dir", nil, `monorepo directory containing its own config dir, path elements can be glob patterns (i.e "services/*"). Use "." for the repository root. This option can be repeated multiple times`)
+	flags.StringVar(&projectCreateOpts.configPath, "config-path", "", `config file path used instead of the default .agola config dir (i.e "ci/agola.yml")`)
+	flags.StringVar(&projectCreateOpts.configRepoPath, "config-repo-path", "", "path of the repository, on the same remote source, providing the run config instead of the project repository")
+	flags.StringVar(&projectCreateOpts.configRepoRef, "config-repo-ref", "master", "config repository branch or ref")
+	flags.StringArrayVar(&projectCreateOpts.remoteTasksRepos, "remote-tasks-repo", nil, "path of an additional repository, on the same remote source, whose remote tasks can be used by the project runs. This option can be repeated multiple times")
+	flags.BoolVar(&projectCreateOpts.taskCommitStatuses, "task-commit-statuses", false, "report a commit status per run task instead of a single status for the whole run")
+	flags.StringArrayVar(&projectCreateOpts.emailRecipients, "email-recipient", nil, "runs email notifications recipient. Can be repeated")
+	flags.StringVar(&projectCreateOpts.emailMode, "email-mode", string(types.NotificationModeFailures), "runs email notifications mode (failures, first_failure, all)")
+	flags.BoolVar(&projectCreateOpts.emailDigest, "email-digest", false, "send the runs email notifications as a periodic digest")
 
 	if err := cmdProjectCreate.MarkFlagRequired("name"); err != nil {
 		log.Fatal(err)
@@ -86,6 +107,27 @@ func projectCreate(cmd *cobra.Command, args []string) error {
 		RepoPath:            projectCreateOpts.repoPath,
 		RemoteSourceName:    projectCreateOpts.remoteSourceName,
 		SkipSSHHostKeyCheck: projectCreateOpts.skipSSHHostKeyCheck,
+		PollingInterval:     projectCreateOpts.pollingInterval,
+		ConfigDirs:          projectCreateOpts.configDirs,
+		ConfigPath:          projectCreateOpts.configPath,
+		RemoteTasksRepos:    projectCreateOpts.remoteTasksRepos,
+		TaskCommitStatuses:  projectCreateOpts.taskCommitStatuses,
+	}
+	if projectCreateOpts.configRepoPath != "" {
+		req.ConfigRepo = &types.ProjectConfigRepo{
+			RepositoryPath: projectCreateOpts.configRepoPath,
+			Ref:            projectCreateOpts.configRepoRef,
+		}
+	}
+	if len(projectCreateOpts.emailRecipients) > 0 {
+		if !types.IsValidNotificationMode(types.NotificationMode(projectCreateOpts.emailMode)) {
+			return errors.Errorf("invalid email notification mode %q", projectCreateOpts.emailMode)
+		}
+		req.EmailNotifications = &types.ProjectEmailNotifications{
+			Recipients: projectCreateOpts.emailRecipients,
+			Mode:       types.NotificationMode(projectCreateOpts.emailMode),
+			Digest:     projectCreateOpts.emailDigest,
+		}
 	}
 
 	log.Infof("creating project")
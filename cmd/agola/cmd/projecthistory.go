@@ -0,0 +1,75 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"agola.io/agola/internal/services/gateway/api"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectHistory = &cobra.Command{
+	Use:   "history",
+	Short: "list the changes of the project settings, variables and secrets",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := projectHistory(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type projectHistoryOptions struct {
+	projectRef string
+	limit      int
+}
+
+var projectHistoryOpts projectHistoryOptions
+
+func init() {
+	flags := cmdProjectHistory.Flags()
+
+	flags.StringVar(&projectHistoryOpts.projectRef, "project", "", "project id or full path")
+	flags.IntVar(&projectHistoryOpts.limit, "limit", 0, "max number of changes to return")
+
+	if err := cmdProjectHistory.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProject.AddCommand(cmdProjectHistory)
+}
+
+func projectHistory(cmd *cobra.Command, args []string) error {
+	gwclient := api.NewClient(gatewayURL, token)
+
+	pcs, _, err := gwclient.GetProjectChanges(context.TODO(), projectHistoryOpts.projectRef, projectHistoryOpts.limit)
+	if err != nil {
+		return errors.Errorf("failed to get project changes: %w", err)
+	}
+
+	for _, pc := range pcs {
+		changedBy := pc.ChangedByName
+		if changedBy == "" {
+			changedBy = pc.ChangedBy
+		}
+		fmt.Printf("%s: Time: %s, Action: %s, Type: %s, Name: %s, Changed by: %s\n", pc.ID, pc.ChangeTime.Format(time.RFC3339), pc.Action, pc.ObjectType, pc.ObjectName, changedBy)
+	}
+
+	return nil
+}
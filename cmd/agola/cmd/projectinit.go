@@ -0,0 +1,241 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"agola.io/agola/internal/services/gateway/api"
+	"agola.io/agola/internal/services/types"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	projectInitConfigPath = ".agola/config.yml"
+
+	projectInitStarterConfig = `version: v0
+
+runs:
+  - name: build
+    tasks:
+      - name: build
+        runtime:
+          type: pod
+          containers:
+            - image: alpine/git
+        steps:
+          - clone:
+          - run: echo "Hello from agola"
+`
+)
+
+var cmdProjectInit = &cobra.Command{
+	Use:   "init",
+	Short: "initialize a project: link a remote repository, create the project, push a starter run config and verify the first run",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := projectInit(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type projectInitOptions struct {
+	name                string
+	parentPath          string
+	repoPath            string
+	remoteSourceName    string
+	skipSSHHostKeyCheck bool
+	visibility          string
+	branch              string
+	configFile          string
+	configPath          string
+	skipConfigPush      bool
+	skipVerify          bool
+	verifyTimeout       time.Duration
+	nonInteractive      bool
+}
+
+var projectInitOpts projectInitOptions
+
+func init() {
+	flags := cmdProjectInit.Flags()
+
+	flags.StringVarP(&projectInitOpts.name, "name", "n", "", "project name")
+	flags.StringVar(&projectInitOpts.repoPath, "repo-path", "", "repository path (i.e agola-io/agola)")
+	flags.StringVar(&projectInitOpts.remoteSourceName, "remote-source", "", "remote source name")
+	flags.BoolVarP(&projectInitOpts.skipSSHHostKeyCheck, "skip-ssh-host-key-check", "s", false, "skip ssh host key check")
+	flags.StringVar(&projectInitOpts.parentPath, "parent", "", `parent project group path (i.e "org/org01" for root project group in org01, "user/user01/group01/subgroub01") or project group id where the project should be created`)
+	flags.StringVar(&projectInitOpts.visibility, "visibility", "public", `project visibility (public or private)`)
+	flags.StringVar(&projectInitOpts.branch, "branch", "master", "repository branch where the run config will be pushed")
+	flags.StringVar(&projectInitOpts.configFile, "config-file", "", "local run config file to push instead of the starter one")
+	flags.StringVar(&projectInitOpts.configPath, "config-path", "", `repository config file path used instead of the default .agola config dir (i.e "ci/agola.yml")`)
+	flags.BoolVar(&projectInitOpts.skipConfigPush, "skip-config-push", false, "don't push the run config to the repository")
+	flags.BoolVar(&projectInitOpts.skipVerify, "skip-verify", false, "don't wait for the first run triggered by the webhook")
+	flags.DurationVar(&projectInitOpts.verifyTimeout, "verify-timeout", 2*time.Minute, "max time to wait for the first run")
+	flags.BoolVar(&projectInitOpts.nonInteractive, "non-interactive", false, "don't ask for missing values")
+
+	cmdProject.AddCommand(cmdProjectInit)
+}
+
+// prompt asks for a value if it's empty. It uses the provided default value if
+// the user doesn't provide one.
+func prompt(r *bufio.Reader, value *string, question, defaultValue string) error {
+	if *value != "" {
+		return nil
+	}
+	if projectInitOpts.nonInteractive {
+		if defaultValue == "" {
+			return errors.Errorf("missing required value: %s", question)
+		}
+		*value = defaultValue
+		return nil
+	}
+
+	if defaultValue != "" {
+		fmt.Printf("%s [%s]: ", question, defaultValue)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	*value = strings.TrimSpace(line)
+	if *value == "" {
+		*value = defaultValue
+	}
+	if *value == "" {
+		return errors.Errorf("missing required value: %s", question)
+	}
+	return nil
+}
+
+func projectInit(cmd *cobra.Command, args []string) error {
+	gwclient := api.NewClient(gatewayURL, token)
+	ctx := context.TODO()
+
+	r := bufio.NewReader(os.Stdin)
+
+	if projectInitOpts.remoteSourceName == "" && !projectInitOpts.nonInteractive {
+		remoteSources, _, err := gwclient.GetRemoteSources(ctx, "", 0, true)
+		if err != nil {
+			return errors.Errorf("failed to get remote sources: %w", err)
+		}
+		names := []string{}
+		for _, rs := range remoteSources {
+			names = append(names, rs.Name)
+		}
+		fmt.Printf("available remote sources: %s\n", strings.Join(names, ", "))
+	}
+	if err := prompt(r, &projectInitOpts.remoteSourceName, "remote source name", ""); err != nil {
+		return err
+	}
+	if err := prompt(r, &projectInitOpts.repoPath, "repository path (i.e agola-io/agola)", ""); err != nil {
+		return err
+	}
+	if err := prompt(r, &projectInitOpts.name, "project name", path.Base(projectInitOpts.repoPath)); err != nil {
+		return err
+	}
+	if err := prompt(r, &projectInitOpts.parentPath, "parent project group path (i.e org/org01)", ""); err != nil {
+		return err
+	}
+
+	// TODO: make this a custom pflag Value?
+	if !types.IsValidVisibility(types.Visibility(projectInitOpts.visibility)) {
+		return errors.Errorf("invalid visibility %q", projectInitOpts.visibility)
+	}
+
+	config := []byte(projectInitStarterConfig)
+	if projectInitOpts.configFile != "" {
+		var err error
+		config, err = ioutil.ReadFile(projectInitOpts.configFile)
+		if err != nil {
+			return errors.Errorf("failed to read config file %q: %w", projectInitOpts.configFile, err)
+		}
+	}
+
+	req := &api.CreateProjectRequest{
+		Name:                projectInitOpts.name,
+		ParentRef:           projectInitOpts.parentPath,
+		Visibility:          types.Visibility(projectInitOpts.visibility),
+		RepoPath:            projectInitOpts.repoPath,
+		RemoteSourceName:    projectInitOpts.remoteSourceName,
+		SkipSSHHostKeyCheck: projectInitOpts.skipSSHHostKeyCheck,
+		ConfigPath:          projectInitOpts.configPath,
+	}
+
+	log.Infof("creating project")
+
+	project, _, err := gwclient.CreateProject(ctx, req)
+	if err != nil {
+		return errors.Errorf("failed to create project: %w", err)
+	}
+	log.Infof("project %s created, ID: %s", project.Name, project.ID)
+
+	if projectInitOpts.skipConfigPush {
+		return nil
+	}
+
+	// save the existing runs to detect the new one
+	groups := []string{path.Join("/project", project.ID)}
+	prevRuns, _, err := gwclient.GetRuns(ctx, &api.GetRunsOptions{Groups: groups, Limit: 1})
+	if err != nil {
+		return errors.Errorf("failed to get project runs: %w", err)
+	}
+
+	configPath := projectInitConfigPath
+	if projectInitOpts.configPath != "" {
+		configPath = projectInitOpts.configPath
+	}
+	log.Infof("pushing run config %q to branch %q", configPath, projectInitOpts.branch)
+	freq := &api.ProjectCreateFileRequest{
+		Branch:  projectInitOpts.branch,
+		Path:    configPath,
+		Message: "Add agola run config",
+		Content: config,
+	}
+	if _, err := gwclient.ProjectCreateFile(ctx, project.ID, freq); err != nil {
+		return errors.Errorf("failed to push run config: %w", err)
+	}
+
+	if projectInitOpts.skipVerify {
+		return nil
+	}
+
+	log.Infof("waiting for the first run triggered by the repository webhook")
+	deadline := time.Now().Add(projectInitOpts.verifyTimeout)
+	for time.Now().Before(deadline) {
+		runs, _, err := gwclient.GetRuns(ctx, &api.GetRunsOptions{Groups: groups, Limit: 1})
+		if err != nil {
+			return errors.Errorf("failed to get project runs: %w", err)
+		}
+		if len(runs) > 0 && (len(prevRuns) == 0 || runs[0].ID != prevRuns[0].ID) {
+			log.Infof("webhook delivered, run %s created (phase: %s)", runs[0].ID, runs[0].Phase)
+			return nil
+		}
+		time.Sleep(2 * time.Second)
+	}
+
+	return errors.Errorf("no run created after %s. Check that the remote repository can deliver webhooks to the agola gateway", projectInitOpts.verifyTimeout)
+}
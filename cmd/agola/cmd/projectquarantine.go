@@ -0,0 +1,70 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	"agola.io/agola/internal/services/gateway/api"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectQuarantine = &cobra.Command{
+	Use:   "quarantine",
+	Short: "set the project quarantined tasks. The failures of quarantined tasks won't make the runs fail",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := projectQuarantine(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type projectQuarantineOptions struct {
+	projectRef string
+	tasks      []string
+}
+
+var projectQuarantineOpts projectQuarantineOptions
+
+func init() {
+	flags := cmdProjectQuarantine.Flags()
+
+	flags.StringVar(&projectQuarantineOpts.projectRef, "project", "", "project id or full path")
+	flags.StringSliceVar(&projectQuarantineOpts.tasks, "task", []string{}, "name of the task to quarantine (can be repeated). When not provided all the tasks will be removed from the quarantine")
+
+	if err := cmdProjectQuarantine.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProject.AddCommand(cmdProjectQuarantine)
+}
+
+func projectQuarantine(cmd *cobra.Command, args []string) error {
+	gwclient := api.NewClient(gatewayURL, token)
+
+	req := &api.UpdateProjectQuarantinedTasksRequest{
+		Tasks: projectQuarantineOpts.tasks,
+	}
+
+	log.Infof("updating project quarantined tasks")
+	if _, _, err := gwclient.UpdateProjectQuarantinedTasks(context.TODO(), projectQuarantineOpts.projectRef, req); err != nil {
+		return errors.Errorf("failed to update project quarantined tasks: %w", err)
+	}
+	log.Infof("project quarantined tasks updated")
+
+	return nil
+}
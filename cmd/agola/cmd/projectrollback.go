@@ -0,0 +1,69 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	"agola.io/agola/internal/services/gateway/api"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectRollback = &cobra.Command{
+	Use:   "rollback",
+	Short: "rollback the project settings to the ones recorded in a project change",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := projectRollback(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type projectRollbackOptions struct {
+	projectRef string
+	changeID   string
+}
+
+var projectRollbackOpts projectRollbackOptions
+
+func init() {
+	flags := cmdProjectRollback.Flags()
+
+	flags.StringVar(&projectRollbackOpts.projectRef, "project", "", "project id or full path")
+	flags.StringVar(&projectRollbackOpts.changeID, "change", "", "id of the project change to rollback to (see the project history command)")
+
+	if err := cmdProjectRollback.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmdProjectRollback.MarkFlagRequired("change"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProject.AddCommand(cmdProjectRollback)
+}
+
+func projectRollback(cmd *cobra.Command, args []string) error {
+	gwclient := api.NewClient(gatewayURL, token)
+
+	log.Infof("rolling back project settings")
+	if _, _, err := gwclient.RollbackProject(context.TODO(), projectRollbackOpts.projectRef, projectRollbackOpts.changeID); err != nil {
+		return errors.Errorf("failed to rollback project settings: %w", err)
+	}
+	log.Infof("project settings rolled back")
+
+	return nil
+}
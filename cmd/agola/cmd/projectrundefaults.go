@@ -0,0 +1,83 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"agola.io/agola/internal/services/gateway/api"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectRunDefaults = &cobra.Command{
+	Use:   "rundefaults",
+	Short: "set the project run defaults enforced when creating the project runs. When no limit is provided the run defaults will be removed",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := projectRunDefaults(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type projectRunDefaultsOptions struct {
+	projectRef         string
+	taskTimeout        time.Duration
+	allowedImages      []string
+	allowedArchs       []string
+	maxTasks           int
+	artifactsRetention time.Duration
+}
+
+var projectRunDefaultsOpts projectRunDefaultsOptions
+
+func init() {
+	flags := cmdProjectRunDefaults.Flags()
+
+	flags.StringVar(&projectRunDefaultsOpts.projectRef, "project", "", "project id or full path")
+	flags.DurationVar(&projectRunDefaultsOpts.taskTimeout, "task-timeout", 0, "max task execution duration (0 means no timeout)")
+	flags.StringSliceVar(&projectRunDefaultsOpts.allowedImages, "allowed-image", []string{}, "regular expression matching the allowed tasks images (can be repeated). When not provided all the images are allowed")
+	flags.StringSliceVar(&projectRunDefaultsOpts.allowedArchs, "allowed-arch", []string{}, "allowed tasks runtime arch (can be repeated). When not provided all the archs are allowed")
+	flags.IntVar(&projectRunDefaultsOpts.maxTasks, "max-tasks", 0, "max number of tasks of a run (0 means no limit)")
+	flags.DurationVar(&projectRunDefaultsOpts.artifactsRetention, "artifacts-retention", 0, "how long the tasks workspace archives are kept (0 means forever)")
+
+	if err := cmdProjectRunDefaults.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProject.AddCommand(cmdProjectRunDefaults)
+}
+
+func projectRunDefaults(cmd *cobra.Command, args []string) error {
+	gwclient := api.NewClient(gatewayURL, token)
+
+	req := &api.UpdateProjectRunDefaultsRequest{
+		TaskTimeout:        projectRunDefaultsOpts.taskTimeout,
+		AllowedImages:      projectRunDefaultsOpts.allowedImages,
+		AllowedArchs:       projectRunDefaultsOpts.allowedArchs,
+		MaxTasks:           projectRunDefaultsOpts.maxTasks,
+		ArtifactsRetention: projectRunDefaultsOpts.artifactsRetention,
+	}
+
+	log.Infof("updating project run defaults")
+	if _, _, err := gwclient.UpdateProjectRunDefaults(context.TODO(), projectRunDefaultsOpts.projectRef, req); err != nil {
+		return errors.Errorf("failed to update project run defaults: %w", err)
+	}
+	log.Infof("project run defaults updated")
+
+	return nil
+}
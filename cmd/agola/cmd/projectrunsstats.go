@@ -0,0 +1,77 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"agola.io/agola/internal/services/gateway/api"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectRunsStats = &cobra.Command{
+	Use:   "runsstats",
+	Short: "report the build health statistics of a project",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := projectRunsStats(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type projectRunsStatsOptions struct {
+	projectRef    string
+	branch        string
+	window        string
+	hotspotsLimit int
+}
+
+var projectRunsStatsOpts projectRunsStatsOptions
+
+func init() {
+	flags := cmdProjectRunsStats.Flags()
+
+	flags.StringVar(&projectRunsStatsOpts.projectRef, "project", "", "project id or full path")
+	flags.StringVar(&projectRunsStatsOpts.branch, "branch", "", "report only the runs of this branch")
+	flags.StringVar(&projectRunsStatsOpts.window, "window", "", "time window (1d, 7d, 30d or 90d, defaults to 7d)")
+	flags.IntVar(&projectRunsStatsOpts.hotspotsLimit, "hotspots", 0, "max number of failure hotspots to report")
+
+	if err := cmdProjectRunsStats.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProject.AddCommand(cmdProjectRunsStats)
+}
+
+func projectRunsStats(cmd *cobra.Command, args []string) error {
+	gwclient := api.NewClient(gatewayURL, token)
+
+	stats, _, err := gwclient.GetProjectRunsStats(context.TODO(), projectRunsStatsOpts.projectRef, projectRunsStatsOpts.branch, projectRunsStatsOpts.window, projectRunsStatsOpts.hotspotsLimit)
+	if err != nil {
+		return errors.Errorf("failed to get project runs stats: %w", err)
+	}
+
+	fmt.Printf("Since: %s\n", stats.Since)
+	fmt.Printf("Runs: %d, Successes: %d, Failures: %d, Success rate: %.1f%%\n", stats.Runs, stats.Successes, stats.Failures, stats.SuccessRate*100)
+	fmt.Printf("Median duration: %s, Median queue wait: %s\n", stats.MedianDuration, stats.MedianQueueWait)
+	for _, h := range stats.FailureHotspots {
+		fmt.Printf("%s: Runs: %d, Failures: %d\n", h.TaskName, h.Runs, h.Failures)
+	}
+
+	return nil
+}
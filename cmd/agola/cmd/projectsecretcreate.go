@@ -74,6 +74,7 @@ func init() {
 
 func secretCreate(cmd *cobra.Command, ownertype string, args []string) error {
 	gwclient := api.NewClient(gatewayURL, token)
+	gwclient.SetOTP(otp)
 
 	// "github.com/ghodss/yaml" doesn't provide a streaming decoder
 	var data []byte
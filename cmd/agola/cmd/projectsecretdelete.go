@@ -58,6 +58,7 @@ func init() {
 
 func secretDelete(cmd *cobra.Command, ownertype string, args []string) error {
 	gwclient := api.NewClient(gatewayURL, token)
+	gwclient.SetOTP(otp)
 
 	switch ownertype {
 	case "project":
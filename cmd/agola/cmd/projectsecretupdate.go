@@ -76,6 +76,7 @@ func init() {
 
 func secretUpdate(cmd *cobra.Command, ownertype string, args []string) error {
 	gwclient := api.NewClient(gatewayURL, token)
+	gwclient.SetOTP(otp)
 
 	// "github.com/ghodss/yaml" doesn't provide a streaming decoder
 	var data []byte
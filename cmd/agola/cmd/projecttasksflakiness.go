@@ -0,0 +1,72 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"agola.io/agola/internal/services/gateway/api"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectTasksFlakiness = &cobra.Command{
+	Use:   "tasksflakiness",
+	Short: "report the flaky tasks of a project",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := projectTasksFlakiness(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type projectTasksFlakinessOptions struct {
+	projectRef string
+	limit      int
+	onlyFlaky  bool
+}
+
+var projectTasksFlakinessOpts projectTasksFlakinessOptions
+
+func init() {
+	flags := cmdProjectTasksFlakiness.Flags()
+
+	flags.StringVar(&projectTasksFlakinessOpts.projectRef, "project", "", "project id or full path")
+	flags.IntVar(&projectTasksFlakinessOpts.limit, "limit", 0, "number of last finished runs to analyze")
+	flags.BoolVar(&projectTasksFlakinessOpts.onlyFlaky, "flaky", false, "report only the flaky tasks")
+
+	if err := cmdProjectTasksFlakiness.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProject.AddCommand(cmdProjectTasksFlakiness)
+}
+
+func projectTasksFlakiness(cmd *cobra.Command, args []string) error {
+	gwclient := api.NewClient(gatewayURL, token)
+
+	tfs, _, err := gwclient.GetProjectTasksFlakiness(context.TODO(), projectTasksFlakinessOpts.projectRef, projectTasksFlakinessOpts.limit, projectTasksFlakinessOpts.onlyFlaky)
+	if err != nil {
+		return errors.Errorf("failed to get project tasks flakiness: %w", err)
+	}
+
+	for _, tf := range tfs {
+		fmt.Printf("%s: Runs: %d, Failures: %d, Flaky runs: %d, Flips: %d, Flaky: %t, Quarantined: %t\n", tf.TaskName, tf.Runs, tf.Failures, tf.FlakyRuns, tf.Flips, tf.Flaky, tf.Quarantined)
+	}
+
+	return nil
+}
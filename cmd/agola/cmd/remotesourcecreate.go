@@ -48,6 +48,8 @@ type remoteSourceCreateOptions struct {
 	skipSSHHostKeyCheck bool
 	registrationEnabled bool
 	loginEnabled        bool
+	userNameStripDomain bool
+	userNamePrefix      string
 }
 
 var remoteSourceCreateOpts remoteSourceCreateOptions
@@ -66,6 +68,8 @@ func init() {
 	flags.BoolVarP(&remoteSourceCreateOpts.skipSSHHostKeyCheck, "skip-ssh-host-key-check", "s", false, "skip ssh host key check")
 	flags.BoolVar(&remoteSourceCreateOpts.registrationEnabled, "registration-enabled", true, "enabled/disable user registration with this remote source")
 	flags.BoolVar(&remoteSourceCreateOpts.loginEnabled, "login-enabled", true, "enabled/disable user login with this remote source")
+	flags.BoolVar(&remoteSourceCreateOpts.userNameStripDomain, "username-strip-domain", false, "strip the domain part from the remote login name when deriving the user name of registered users")
+	flags.StringVar(&remoteSourceCreateOpts.userNamePrefix, "username-prefix", "", "prefix to add to the user name of registered users")
 
 	if err := cmdRemoteSourceCreate.MarkFlagRequired("name"); err != nil {
 		log.Fatal(err)
@@ -105,6 +109,8 @@ func remoteSourceCreate(cmd *cobra.Command, args []string) error {
 		SkipSSHHostKeyCheck: remoteSourceCreateOpts.skipSSHHostKeyCheck,
 		RegistrationEnabled: util.BoolP(remoteSourceCreateOpts.registrationEnabled),
 		LoginEnabled:        util.BoolP(remoteSourceCreateOpts.loginEnabled),
+		UserNameStripDomain: remoteSourceCreateOpts.userNameStripDomain,
+		UserNamePrefix:      remoteSourceCreateOpts.userNamePrefix,
 	}
 
 	log.Infof("creating remotesource")
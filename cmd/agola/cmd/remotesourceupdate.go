@@ -45,6 +45,8 @@ type remoteSourceUpdateOptions struct {
 	skipSSHHostKeyCheck bool
 	registrationEnabled bool
 	loginEnabled        bool
+	userNameStripDomain bool
+	userNamePrefix      string
 }
 
 var remoteSourceUpdateOpts remoteSourceUpdateOptions
@@ -62,6 +64,8 @@ func init() {
 	flags.BoolVarP(&remoteSourceUpdateOpts.skipSSHHostKeyCheck, "skip-ssh-host-key-check", "s", false, "skip ssh host key check")
 	flags.BoolVar(&remoteSourceUpdateOpts.registrationEnabled, "registration-enabled", false, "enabled/disable user registration with this remote source")
 	flags.BoolVar(&remoteSourceUpdateOpts.loginEnabled, "login-enabled", false, "enabled/disable user login with this remote source")
+	flags.BoolVar(&remoteSourceUpdateOpts.userNameStripDomain, "username-strip-domain", false, "strip the domain part from the remote login name when deriving the user name of registered users")
+	flags.StringVar(&remoteSourceUpdateOpts.userNamePrefix, "username-prefix", "", "prefix to add to the user name of registered users")
 
 	if err := cmdRemoteSourceUpdate.MarkFlagRequired("ref"); err != nil {
 		log.Fatal(err)
@@ -103,6 +107,12 @@ func remoteSourceUpdate(cmd *cobra.Command, args []string) error {
 	if flags.Changed("login-enabled") {
 		req.LoginEnabled = &remoteSourceUpdateOpts.loginEnabled
 	}
+	if flags.Changed("username-strip-domain") {
+		req.UserNameStripDomain = &remoteSourceUpdateOpts.userNameStripDomain
+	}
+	if flags.Changed("username-prefix") {
+		req.UserNamePrefix = &remoteSourceUpdateOpts.userNamePrefix
+	}
 
 	log.Infof("updating remotesource")
 	remoteSource, _, err := gwclient.UpdateRemoteSource(context.TODO(), remoteSourceUpdateOpts.ref, req)
@@ -0,0 +1,89 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+
+	"agola.io/agola/internal/services/gateway/api"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdRunDebug = &cobra.Command{
+	Use:   "debug",
+	Short: "recreate a project run overriding some variables or the run config",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runDebug(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type runDebugOptions struct {
+	runID      string
+	variables  []string
+	configFile string
+}
+
+var runDebugOpts runDebugOptions
+
+func init() {
+	flags := cmdRunDebug.Flags()
+
+	flags.StringVar(&runDebugOpts.runID, "run-id", "", "id of the run to recreate")
+	flags.StringSliceVar(&runDebugOpts.variables, "var", []string{}, "project variable override in the format NAME=VALUE (can be repeated)")
+	flags.StringVarP(&runDebugOpts.configFile, "file", "f", "", "run config file to use instead of the repository config")
+
+	if err := cmdRunDebug.MarkFlagRequired("run-id"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdRun.AddCommand(cmdRunDebug)
+}
+
+func runDebug(cmd *cobra.Command, args []string) error {
+	gwclient := api.NewClient(gatewayURL, token)
+
+	req := &api.DebugRunRequest{
+		Variables: map[string]string{},
+	}
+	for _, v := range runDebugOpts.variables {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return errors.Errorf("wrong variable %q, must be in the format NAME=VALUE", v)
+		}
+		req.Variables[parts[0]] = parts[1]
+	}
+	if runDebugOpts.configFile != "" {
+		data, err := ioutil.ReadFile(runDebugOpts.configFile)
+		if err != nil {
+			return errors.Errorf("failed to read config file: %w", err)
+		}
+		req.Config = data
+		req.ConfigPath = runDebugOpts.configFile
+	}
+
+	log.Infof("creating debug run")
+	if _, err := gwclient.DebugRun(context.TODO(), runDebugOpts.runID, req); err != nil {
+		return errors.Errorf("failed to create debug run: %w", err)
+	}
+	log.Infof("debug run created")
+
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"agola.io/agola/internal/services/gateway/api"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/websocket"
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdRunExec = &cobra.Command{
+	Use:   "exec [flags] -- [command]",
+	Short: "execute a command inside a running task container (the task shell if no command is provided)",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runExec(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type runExecOptions struct {
+	runID  string
+	taskID string
+	tty    bool
+}
+
+var runExecOpts runExecOptions
+
+func init() {
+	flags := cmdRunExec.Flags()
+
+	flags.StringVar(&runExecOpts.runID, "run-id", "", "run id")
+	flags.StringVar(&runExecOpts.taskID, "task-id", "", "running task id")
+	flags.BoolVarP(&runExecOpts.tty, "tty", "t", false, "allocate a tty")
+
+	if err := cmdRunExec.MarkFlagRequired("run-id"); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmdRunExec.MarkFlagRequired("task-id"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdRun.AddCommand(cmdRunExec)
+}
+
+func runExec(cmd *cobra.Command, args []string) error {
+	gwclient := api.NewClient(gatewayURL, token)
+
+	conn, _, err := gwclient.ExecRunTask(context.TODO(), runExecOpts.runID, runExecOpts.taskID, args, runExecOpts.tty)
+	if err != nil {
+		return errors.Errorf("failed to exec in run task: %w", err)
+	}
+	defer conn.Close()
+
+	go func() {
+		// stdin is sent to the remote command, the session ends when the
+		// remote command exits
+		_, _ = io.Copy(util.NewWebsocketWriter(conn), os.Stdin)
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if cerr, ok := err.(*websocket.CloseError); ok {
+				if cerr.Text != "" {
+					fmt.Fprintln(os.Stderr, cerr.Text)
+				}
+				return nil
+			}
+			return errors.Errorf("exec connection error: %w", err)
+		}
+		if _, err := os.Stdout.Write(data); err != nil {
+			return err
+		}
+	}
+}
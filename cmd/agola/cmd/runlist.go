@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"path"
+	"strings"
 
 	"agola.io/agola/internal/services/gateway/api"
 	errors "golang.org/x/xerrors"
@@ -38,6 +39,9 @@ var cmdRunList = &cobra.Command{
 type runListOptions struct {
 	projectRef  string
 	phaseFilter []string
+	runNames    []string
+	labels      []string
+	pinned      bool
 	limit       int
 	start       string
 }
@@ -49,6 +53,9 @@ func init() {
 
 	flags.StringVar(&runListOpts.projectRef, "project", "", "project id or full path")
 	flags.StringSliceVarP(&runListOpts.phaseFilter, "phase", "s", nil, "filter runs matching the provided phase. This option can be repeated multiple times")
+	flags.StringSliceVar(&runListOpts.runNames, "run-name", nil, "filter runs matching the provided config run name. This option can be repeated multiple times")
+	flags.StringSliceVar(&runListOpts.labels, "label", nil, "filter runs having the provided label in the format KEY=VALUE. This option can be repeated multiple times")
+	flags.BoolVar(&runListOpts.pinned, "pinned", false, "only list pinned runs")
 	flags.IntVar(&runListOpts.limit, "limit", 10, "max number of runs to show")
 	flags.StringVar(&runListOpts.start, "start", "", "starting run id (excluded) to fetch")
 
@@ -61,7 +68,13 @@ func init() {
 
 func printRuns(runs []*api.RunResponse) {
 	for _, run := range runs {
-		fmt.Printf("%s: Phase: %s, Result: %s\n", run.ID, run.Phase, run.Result)
+		fmt.Printf("%s: Number: %d, Name: %s, Phase: %s, Result: %s\n", run.ID, run.Counter, run.Name, run.Phase, run.Result)
+		if run.Pinned {
+			fmt.Printf("\tPinned\n")
+		}
+		for _, setupError := range run.SetupErrors {
+			fmt.Printf("\tSetup error: %s\n", setupError)
+		}
 		for _, task := range run.Tasks {
 			fmt.Printf("\tTaskName: %s, Status: %s\n", task.Name, task.Status)
 		}
@@ -76,7 +89,23 @@ func runList(cmd *cobra.Command, args []string) error {
 		return errors.Errorf("failed to get project %s: %v", runListOpts.projectRef, err)
 	}
 	groups := []string{path.Join("/project", project.ID)}
-	runsResp, _, err := gwclient.GetRuns(context.TODO(), runListOpts.phaseFilter, nil, groups, nil, runListOpts.start, runListOpts.limit, false)
+	labels := map[string]string{}
+	for _, l := range runListOpts.labels {
+		parts := strings.SplitN(l, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return errors.Errorf("wrong label %q, must be in the format KEY=VALUE", l)
+		}
+		labels[parts[0]] = parts[1]
+	}
+	runsResp, _, err := gwclient.GetRuns(context.TODO(), &api.GetRunsOptions{
+		PhaseFilter: runListOpts.phaseFilter,
+		Groups:      groups,
+		Names:       runListOpts.runNames,
+		Labels:      labels,
+		Pinned:      runListOpts.pinned,
+		Start:       runListOpts.start,
+		Limit:       runListOpts.limit,
+	})
 	if err != nil {
 		return err
 	}
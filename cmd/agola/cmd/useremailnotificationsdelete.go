@@ -0,0 +1,63 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	"agola.io/agola/internal/services/gateway/api"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdUserEmailNotificationsDelete = &cobra.Command{
+	Use:   "delete",
+	Short: "disable the user runs email notifications",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := userEmailNotificationsDelete(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type userEmailNotificationsDeleteOptions struct {
+	username string
+}
+
+var userEmailNotificationsDeleteOpts userEmailNotificationsDeleteOptions
+
+func init() {
+	flags := cmdUserEmailNotificationsDelete.Flags()
+
+	flags.StringVarP(&userEmailNotificationsDeleteOpts.username, "username", "n", "", "user name")
+
+	if err := cmdUserEmailNotificationsDelete.MarkFlagRequired("username"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdUserEmailNotifications.AddCommand(cmdUserEmailNotificationsDelete)
+}
+
+func userEmailNotificationsDelete(cmd *cobra.Command, args []string) error {
+	gwclient := api.NewClient(gatewayURL, token)
+
+	log.Infof("deleting email notifications for user %q", userEmailNotificationsDeleteOpts.username)
+	if _, err := gwclient.DeleteUserEmailNotifications(context.TODO(), userEmailNotificationsDeleteOpts.username); err != nil {
+		return errors.Errorf("failed to delete user email notifications: %w", err)
+	}
+
+	return nil
+}
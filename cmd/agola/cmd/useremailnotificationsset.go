@@ -0,0 +1,96 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"strings"
+
+	"agola.io/agola/internal/services/gateway/api"
+	"agola.io/agola/internal/services/types"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdUserEmailNotificationsSet = &cobra.Command{
+	Use:   "set",
+	Short: "set the user runs email notifications",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := userEmailNotificationsSet(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type userEmailNotificationsSetOptions struct {
+	username string
+	email    string
+	mode     string
+	projects []string
+	digest   bool
+}
+
+var userEmailNotificationsSetOpts userEmailNotificationsSetOptions
+
+func init() {
+	flags := cmdUserEmailNotificationsSet.Flags()
+
+	flags.StringVarP(&userEmailNotificationsSetOpts.username, "username", "n", "", "user name")
+	flags.StringVar(&userEmailNotificationsSetOpts.email, "email", "", "notifications email address")
+	flags.StringVar(&userEmailNotificationsSetOpts.mode, "mode", string(types.NotificationModeFailures), "default notifications mode (failures, first_failure, all)")
+	flags.StringArrayVar(&userEmailNotificationsSetOpts.projects, "project", nil, "subscribed project ref, optionally followed by its notifications mode (i.e. org/myproject=all). Can be repeated")
+	flags.BoolVar(&userEmailNotificationsSetOpts.digest, "digest", false, "receive a periodic digest instead of an email for every run")
+
+	if err := cmdUserEmailNotificationsSet.MarkFlagRequired("username"); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmdUserEmailNotificationsSet.MarkFlagRequired("email"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdUserEmailNotifications.AddCommand(cmdUserEmailNotificationsSet)
+}
+
+func userEmailNotificationsSet(cmd *cobra.Command, args []string) error {
+	gwclient := api.NewClient(gatewayURL, token)
+
+	req := &api.UserEmailNotificationsRequest{
+		Email:    userEmailNotificationsSetOpts.email,
+		Mode:     types.NotificationMode(userEmailNotificationsSetOpts.mode),
+		Projects: map[string]types.NotificationMode{},
+		Digest:   userEmailNotificationsSetOpts.digest,
+	}
+	if !types.IsValidNotificationMode(req.Mode) {
+		return errors.Errorf("invalid email notification mode %q", req.Mode)
+	}
+	for _, p := range userEmailNotificationsSetOpts.projects {
+		projectRef, mode := p, ""
+		if i := strings.LastIndex(p, "="); i >= 0 {
+			projectRef, mode = p[:i], p[i+1:]
+			if !types.IsValidNotificationMode(types.NotificationMode(mode)) {
+				return errors.Errorf("invalid email notification mode %q for project %q", mode, projectRef)
+			}
+		}
+		req.Projects[projectRef] = types.NotificationMode(mode)
+	}
+
+	log.Infof("setting email notifications for user %q", userEmailNotificationsSetOpts.username)
+	if _, _, err := gwclient.UpdateUserEmailNotifications(context.TODO(), userEmailNotificationsSetOpts.username, req); err != nil {
+		return errors.Errorf("failed to set user email notifications: %w", err)
+	}
+
+	return nil
+}
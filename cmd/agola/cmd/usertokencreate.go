@@ -17,8 +17,10 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"agola.io/agola/internal/services/gateway/api"
+	"agola.io/agola/internal/services/types"
 
 	"github.com/spf13/cobra"
 	errors "golang.org/x/xerrors"
@@ -37,6 +39,8 @@ var cmdUserTokenCreate = &cobra.Command{
 type userTokenCreateOptions struct {
 	username  string
 	tokenName string
+	scopes    []string
+	expiresIn time.Duration
 }
 
 var userTokenCreateOpts userTokenCreateOptions
@@ -46,6 +50,8 @@ func init() {
 
 	flags.StringVarP(&userTokenCreateOpts.username, "username", "n", "", "user name")
 	flags.StringVarP(&userTokenCreateOpts.tokenName, "tokenname", "t", "", "token name")
+	flags.StringSliceVar(&userTokenCreateOpts.scopes, "scope", nil, "token scope (read-only, trigger-runs, manage-secrets, admin). Can be repeated. If not provided the token will have all the scopes")
+	flags.DurationVar(&userTokenCreateOpts.expiresIn, "expires-in", 0, "token validity duration (i.e. 720h). If not provided the token will never expire")
 
 	if err := cmdUserTokenCreate.MarkFlagRequired("username"); err != nil {
 		log.Fatal(err)
@@ -59,10 +65,23 @@ func init() {
 
 func userTokenCreate(cmd *cobra.Command, args []string) error {
 	gwclient := api.NewClient(gatewayURL, token)
+	gwclient.SetOTP(otp)
 
 	req := &api.CreateUserTokenRequest{
 		TokenName: userTokenCreateOpts.tokenName,
 	}
+	for _, scope := range userTokenCreateOpts.scopes {
+		if !types.IsValidTokenScope(types.TokenScope(scope)) {
+			return errors.Errorf("invalid token scope %q", scope)
+		}
+		req.Scopes = append(req.Scopes, types.TokenScope(scope))
+	}
+	if userTokenCreateOpts.expiresIn < 0 {
+		return errors.Errorf("token expiration duration must be positive")
+	}
+	if userTokenCreateOpts.expiresIn > 0 {
+		req.ExpiresAt = time.Now().Add(userTokenCreateOpts.expiresIn)
+	}
 
 	log.Infof("creating token for user %q", userTokenCreateOpts.username)
 	resp, _, err := gwclient.CreateUserToken(context.TODO(), userTokenCreateOpts.username, req)
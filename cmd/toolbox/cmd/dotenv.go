@@ -0,0 +1,115 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// maxDotenvSize is the max size of a dotenv file
+const maxDotenvSize = 64 * 1024
+
+var dotenvKeyRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+var cmdDotenv = &cobra.Command{
+	Use:   "dotenv FILE",
+	Run:   dotenvRun,
+	Short: "parse the provided dotenv file and write its variables as json to stdout",
+}
+
+func init() {
+	CmdToolbox.AddCommand(cmdDotenv)
+}
+
+// parseDotenv parses a dotenv file. Every non empty line not starting with #
+// must be in the format [export ]KEY=VALUE. Values can be enclosed in single
+// or double quotes, in double quoted values \n, \" and \\ are unescaped.
+func parseDotenv(f *os.File) (map[string]string, error) {
+	env := map[string]string{}
+
+	scanner := bufio.NewScanner(f)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: missing =", n)
+		}
+		key := strings.TrimSpace(parts[0])
+		if !dotenvKeyRegexp.MatchString(key) {
+			return nil, fmt.Errorf("line %d: invalid variable name %q", n, key)
+		}
+
+		value := strings.TrimSpace(parts[1])
+		if len(value) >= 2 {
+			switch {
+			case value[0] == '\'' && value[len(value)-1] == '\'':
+				value = value[1 : len(value)-1]
+			case value[0] == '"' && value[len(value)-1] == '"':
+				value = strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`).Replace(value[1 : len(value)-1])
+			}
+		}
+
+		env[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+func dotenvRun(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		log.Fatalf("one file must be provided")
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		log.Fatalf("failed to open dotenv file: %v", err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		log.Fatalf("failed to stat dotenv file: %v", err)
+	}
+	if fi.Size() > maxDotenvSize {
+		log.Fatalf("dotenv file %q is too big", args[0])
+	}
+
+	env, err := parseDotenv(f)
+	if err != nil {
+		log.Fatalf("failed to parse dotenv file %q: %v", args[0], err)
+	}
+
+	if err := json.NewEncoder(os.Stdout).Encode(env); err != nil {
+		log.Fatalf("failed to write env: %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+// outputsFile is the file where the task outputs are saved. It'll be read by
+// the executor at the end of the task
+var outputsFile = filepath.Join(os.TempDir(), "agola-outputs.json")
+
+var cmdOutput = &cobra.Command{
+	Use:   "output",
+	Short: "manage the outputs of the current task",
+}
+
+var cmdOutputSet = &cobra.Command{
+	Use:   "set KEY VALUE",
+	Run:   outputSetRun,
+	Short: "set a task output value",
+}
+
+var cmdOutputGet = &cobra.Command{
+	Use:   "get",
+	Run:   outputGetRun,
+	Short: "write the task outputs to stdout",
+}
+
+func init() {
+	cmdOutput.AddCommand(cmdOutputSet)
+	cmdOutput.AddCommand(cmdOutputGet)
+
+	CmdToolbox.AddCommand(cmdOutput)
+}
+
+func outputSetRun(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		log.Fatalf("a key and a value must be provided")
+	}
+
+	outputs := map[string]string{}
+	data, err := ioutil.ReadFile(outputsFile)
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatalf("failed to read outputs: %v", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &outputs); err != nil {
+			log.Fatalf("failed to unmarshal outputs: %v", err)
+		}
+	}
+
+	outputs[args[0]] = args[1]
+
+	outputsj, err := json.Marshal(outputs)
+	if err != nil {
+		log.Fatalf("failed to marshal outputs: %v", err)
+	}
+	// make it world readable since the executor could read it using a different user
+	if err := ioutil.WriteFile(outputsFile, outputsj, 0644); err != nil {
+		log.Fatalf("failed to save outputs: %v", err)
+	}
+}
+
+func outputGetRun(cmd *cobra.Command, args []string) {
+	data, err := ioutil.ReadFile(outputsFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return
+		}
+		log.Fatalf("failed to read outputs: %v", err)
+	}
+	if _, err := os.Stdout.Write(data); err != nil {
+		log.Fatalf("failed to write outputs: %v", err)
+	}
+}
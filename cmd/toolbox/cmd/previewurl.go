@@ -0,0 +1,111 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+// previewURLFile is the file where the preview url is saved. It'll be read by
+// the executor at the end of the task
+var previewURLFile = filepath.Join(os.TempDir(), "agola-previewurl.json")
+
+var cmdPreviewURL = &cobra.Command{
+	Use:   "previewurl",
+	Short: "register the preview environment url of the current task",
+}
+
+var cmdPreviewURLSet = &cobra.Command{
+	Use:   "set URL",
+	Run:   previewURLSetRun,
+	Short: "set the preview environment url",
+}
+
+var cmdPreviewURLRemove = &cobra.Command{
+	Use:   "remove",
+	Run:   previewURLRemoveRun,
+	Short: "mark the preview environment as removed",
+}
+
+var cmdPreviewURLGet = &cobra.Command{
+	Use:   "get",
+	Run:   previewURLGetRun,
+	Short: "write the registered preview url to stdout",
+}
+
+type previewURL struct {
+	Action string `json:"action,omitempty"`
+	URL    string `json:"url,omitempty"`
+}
+
+func init() {
+	cmdPreviewURL.AddCommand(cmdPreviewURLSet)
+	cmdPreviewURL.AddCommand(cmdPreviewURLRemove)
+	cmdPreviewURL.AddCommand(cmdPreviewURLGet)
+
+	CmdToolbox.AddCommand(cmdPreviewURL)
+}
+
+func savePreviewURL(p *previewURL) error {
+	pj, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	// make it world readable since the executor could read it using a different user
+	return ioutil.WriteFile(previewURLFile, pj, 0644)
+}
+
+func previewURLSetRun(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		log.Fatalf("one url must be provided")
+	}
+	u, err := url.Parse(args[0])
+	if err != nil {
+		log.Fatalf("failed to parse url %q: %v", args[0], err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		log.Fatalf("url %q must have an http or https scheme", args[0])
+	}
+
+	if err := savePreviewURL(&previewURL{Action: "set", URL: u.String()}); err != nil {
+		log.Fatalf("failed to save preview url: %v", err)
+	}
+}
+
+func previewURLRemoveRun(cmd *cobra.Command, args []string) {
+	if err := savePreviewURL(&previewURL{Action: "remove"}); err != nil {
+		log.Fatalf("failed to save preview url: %v", err)
+	}
+}
+
+func previewURLGetRun(cmd *cobra.Command, args []string) {
+	data, err := ioutil.ReadFile(previewURLFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return
+		}
+		log.Fatalf("failed to read preview url: %v", err)
+	}
+	if _, err := os.Stdout.Write(data); err != nil {
+		log.Fatalf("failed to write preview url: %v", err)
+	}
+}
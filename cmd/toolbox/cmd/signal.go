@@ -0,0 +1,40 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"log"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdSignal = &cobra.Command{
+	Use:   "signal",
+	Run:   signalRun,
+	Short: "send a SIGTERM to all the container processes (excluding the init process)",
+}
+
+func init() {
+	CmdToolbox.AddCommand(cmdSignal)
+}
+
+func signalRun(cmd *cobra.Command, args []string) {
+	// pid -1 sends the signal to all the processes that we can signal excluding
+	// the init process and ourself
+	if err := syscall.Kill(-1, syscall.SIGTERM); err != nil && err != syscall.ESRCH {
+		log.Fatalf("failed to send signal: %v", err)
+	}
+}
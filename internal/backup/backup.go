@@ -0,0 +1,291 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"agola.io/agola/internal/datamanager"
+	"agola.io/agola/internal/etcd"
+	"agola.io/agola/internal/objectstorage"
+
+	errors "golang.org/x/xerrors"
+)
+
+// Store defines the data of a service saved by a backup: the datamanager data,
+// the service state kept in etcd outside the datamanager and the objects saved
+// in its objectstorages.
+type Store struct {
+	// Name is the store name, used as the base name of its backup files
+	Name string
+
+	DM *datamanager.DataManager
+	// DMBasePath is the objectstorage path where the datamanager saves its
+	// data. The objects under this path aren't copied since they are saved by
+	// the datamanager export.
+	DMBasePath string
+
+	E *etcd.Store
+	// EtcdDirs are the etcd directories containing the service state not
+	// managed by the datamanager
+	EtcdDirs []string
+
+	// OSTs are the objectstorages of the service by name
+	OSTs map[string]*objectstorage.ObjStorage
+}
+
+// EtcdEntry is an etcd key saved in the etcd backup file
+type EtcdEntry struct {
+	Key   string
+	Value []byte
+}
+
+func dataFile(dir string, s *Store) string   { return filepath.Join(dir, s.Name+".json") }
+func etcdFile(dir string, s *Store) string   { return filepath.Join(dir, s.Name+"-etcd.json") }
+func objectsDir(dir string, s *Store) string { return filepath.Join(dir, s.Name+"-objects") }
+
+// Backup saves to dir the datamanager data, the etcd state and the objects of
+// the store.
+func Backup(ctx context.Context, s *Store, dir string) error {
+	if err := writeFile(dataFile(dir, s), func(w io.Writer) error {
+		return s.DM.Export(ctx, w)
+	}); err != nil {
+		return errors.Errorf("failed to backup data: %w", err)
+	}
+
+	if len(s.EtcdDirs) > 0 {
+		if err := writeFile(etcdFile(dir, s), func(w io.Writer) error {
+			return exportEtcd(ctx, s.E, s.EtcdDirs, w)
+		}); err != nil {
+			return errors.Errorf("failed to backup etcd state: %w", err)
+		}
+	}
+
+	for _, name := range ostNames(s.OSTs) {
+		if err := exportObjects(s.OSTs[name], s.DMBasePath, filepath.Join(objectsDir(dir, s), name)); err != nil {
+			return errors.Errorf("failed to backup objectstorage %q objects: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// Restore restores the store from a backup saved in dir. The store etcd and
+// objectstorages must be empty and the service must not be running.
+func Restore(ctx context.Context, s *Store, dir string) error {
+	f, err := os.Open(dataFile(dir, s))
+	if err != nil {
+		return errors.Errorf("failed to open backup file: %w", err)
+	}
+	err = s.DM.Import(ctx, f)
+	f.Close()
+	if err != nil {
+		return errors.Errorf("failed to restore data: %w", err)
+	}
+
+	if len(s.EtcdDirs) > 0 {
+		f, err := os.Open(etcdFile(dir, s))
+		if err != nil {
+			return errors.Errorf("failed to open etcd backup file: %w", err)
+		}
+		err = importEtcd(ctx, s.E, s.EtcdDirs, f)
+		f.Close()
+		if err != nil {
+			return errors.Errorf("failed to restore etcd state: %w", err)
+		}
+	}
+
+	odir := objectsDir(dir, s)
+	fis, err := ioutil.ReadDir(odir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, fi := range fis {
+		ost, ok := s.OSTs[fi.Name()]
+		if !ok {
+			return errors.Errorf("backup contains objects of objectstorage %q that isn't defined", fi.Name())
+		}
+		if err := importObjects(ost, filepath.Join(odir, fi.Name())); err != nil {
+			return errors.Errorf("failed to restore objectstorage %q objects: %w", fi.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// writeFile writes the file using a temporary file so it's available only
+// when complete
+func writeFile(p string, fn func(w io.Writer) error) error {
+	tmpPath := p + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if err := fn(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, p)
+}
+
+func ostNames(osts map[string]*objectstorage.ObjStorage) []string {
+	names := []string{}
+	for name := range osts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// exportEtcd writes all the keys inside dirs read at the same revision. The
+// keys attached to a lease (locks, executors keepalives) are skipped since
+// they are meaningful only while their owner is alive.
+func exportEtcd(ctx context.Context, e *etcd.Store, dirs []string, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	var revision int64
+	for _, dir := range dirs {
+		resp, err := e.List(ctx, dir, "", revision)
+		if err != nil {
+			return err
+		}
+		revision = resp.Header.Revision
+
+		for _, kv := range resp.Kvs {
+			if kv.Lease != 0 {
+				continue
+			}
+			if err := enc.Encode(&EtcdEntry{Key: string(kv.Key), Value: kv.Value}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func importEtcd(ctx context.Context, e *etcd.Store, dirs []string, r io.Reader) error {
+	for _, dir := range dirs {
+		resp, err := e.List(ctx, dir, "", 0)
+		if err != nil {
+			return err
+		}
+		if len(resp.Kvs) > 0 {
+			return errors.Errorf("etcd directory %q isn't empty, restore must be done on an empty etcd", dir)
+		}
+	}
+
+	dec := json.NewDecoder(r)
+	for {
+		var entry *EtcdEntry
+
+		err := dec.Decode(&entry)
+		if err == io.EOF {
+			// all done
+			break
+		}
+		if err != nil {
+			return errors.Errorf("failed to decode etcd entry: %w", err)
+		}
+		if !inDirs(entry.Key, dirs) {
+			return errors.Errorf("etcd key %q is outside the store directories", entry.Key)
+		}
+		if _, err := e.Put(ctx, entry.Key, entry.Value, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func inDirs(key string, dirs []string) bool {
+	for _, dir := range dirs {
+		if strings.HasPrefix(key, strings.TrimSuffix(dir, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// exportObjects copies to dir all the objects of the objectstorage excluding
+// the ones under excludePath
+func exportObjects(ost *objectstorage.ObjStorage, excludePath, dir string) error {
+	excludePath = strings.TrimSuffix(excludePath, "/") + "/"
+
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+	for object := range ost.List("", "", true, doneCh) {
+		if object.Err != nil {
+			return object.Err
+		}
+		if strings.HasPrefix(object.Path, excludePath) {
+			continue
+		}
+		if err := exportObject(ost, object.Path, dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exportObject(ost *objectstorage.ObjStorage, p, dir string) error {
+	fp := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+p)))
+	if err := os.MkdirAll(filepath.Dir(fp), 0770); err != nil {
+		return err
+	}
+
+	r, err := ost.ReadObject(p)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return writeFile(fp, func(w io.Writer) error {
+		_, err := io.Copy(w, r)
+		return err
+	})
+}
+
+// importObjects writes to the objectstorage all the objects saved in dir
+func importObjects(ost *objectstorage.ObjStorage, dir string) error {
+	return filepath.Walk(dir, func(fp string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, fp)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(fp)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		return ost.WriteObject(filepath.ToSlash(rel), f, fi.Size(), true)
+	})
+}
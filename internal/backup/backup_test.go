@@ -0,0 +1,234 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"agola.io/agola/internal/datamanager"
+	"agola.io/agola/internal/etcd"
+	slog "agola.io/agola/internal/log"
+	"agola.io/agola/internal/objectstorage"
+	"agola.io/agola/internal/objectstorage/posix"
+	"agola.io/agola/internal/testutil"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
+var logger = slog.New(level)
+
+func setupEtcd(t *testing.T, dir string) *testutil.TestEmbeddedEtcd {
+	tetcd, err := testutil.NewTestEmbeddedEtcd(t, logger, dir)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := tetcd.Start(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := tetcd.WaitUp(30 * time.Second); err != nil {
+		t.Fatalf("error waiting on store up: %v", err)
+	}
+	return tetcd
+}
+
+func shutdownEtcd(tetcd *testutil.TestEmbeddedEtcd) {
+	if tetcd.Etcd != nil {
+		_ = tetcd.Kill()
+	}
+}
+
+func setupStore(t *testing.T, dir string) (*Store, *testutil.TestEmbeddedEtcd) {
+	etcdDir, err := ioutil.TempDir(dir, "etcd")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	tetcd := setupEtcd(t, etcdDir)
+
+	osts := map[string]*objectstorage.ObjStorage{}
+	for _, name := range []string{"default", "partition01"} {
+		ostDir, err := ioutil.TempDir(dir, "ost")
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		ost, err := posix.New(ostDir)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		osts[name] = objectstorage.NewObjStorage(ost, "/")
+	}
+
+	dm, err := datamanager.NewDataManager(context.Background(), logger, &datamanager.DataManagerConfig{
+		BasePath:  "base",
+		E:         tetcd.TestEtcd.Store,
+		OST:       osts["default"],
+		DataTypes: []string{"datatype01"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	return &Store{
+		Name:       "store01",
+		DM:         dm,
+		DMBasePath: "base",
+		E:          tetcd.TestEtcd.Store,
+		EtcdDirs:   []string{"state"},
+		OSTs:       osts,
+	}, tetcd
+}
+
+func runDataManager(ctx context.Context, dm *datamanager.DataManager) {
+	dmReadyCh := make(chan struct{})
+	go func() { _ = dm.Run(ctx, dmReadyCh) }()
+	<-dmReadyCh
+}
+
+func TestBackupRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s, tetcd := setupStore(t, dir)
+	defer shutdownEtcd(tetcd)
+
+	runDataManager(ctx, s.DM)
+
+	actions := []*datamanager.Action{
+		{ActionType: datamanager.ActionTypePut, ID: "object01", DataType: "datatype01", Data: []byte(`{ "ID": "object01" }`)},
+		{ActionType: datamanager.ActionTypePut, ID: "object02", DataType: "datatype01", Data: []byte(`{ "ID": "object02" }`)},
+	}
+	if _, err := s.DM.WriteWal(ctx, actions, nil); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// wait for the wal to be committed to the objectstorage so it'll be exported
+	var expectedData bytes.Buffer
+	for i := 0; i < 20; i++ {
+		expectedData.Reset()
+		if err := s.DM.Export(ctx, &expectedData); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if bytes.Contains(expectedData.Bytes(), []byte("object02")) {
+			break
+		}
+		time.Sleep(1 * time.Second)
+	}
+	if !bytes.Contains(expectedData.Bytes(), []byte("object02")) {
+		t.Fatalf("wal not committed to the objectstorage")
+	}
+
+	if _, err := s.E.Put(ctx, "state/runs/run01", []byte("run01"), nil); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// a key bound to a lease must not be saved
+	if _, err := s.E.Put(ctx, "state/locks/lock01", []byte("lock01"), &etcd.WriteOptions{TTL: 60 * time.Second}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// a key outside the store directories must not be saved
+	if _, err := s.E.Put(ctx, "other/key01", []byte("key01"), nil); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	objects := map[string]map[string]string{
+		"default":     {"logs/run01/step01": "log01", "caches/cache01.tar": "cache01"},
+		"partition01": {"archives/run01/archive01": "archive01"},
+	}
+	for name, objs := range objects {
+		for p, data := range objs {
+			if err := s.OSTs[name].WriteObject(p, bytes.NewReader([]byte(data)), int64(len(data)), true); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+		}
+	}
+
+	backupDir := filepath.Join(dir, "backup")
+	if err := os.MkdirAll(backupDir, 0770); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := Backup(ctx, s, backupDir); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// the datamanager objects are saved by the datamanager export
+	if _, err := os.Stat(filepath.Join(backupDir, "store01-objects", "default", "base")); !os.IsNotExist(err) {
+		t.Fatalf("expected datamanager objects to not be copied, got err: %v", err)
+	}
+
+	// restore in a fresh store
+	ns, ntetcd := setupStore(t, dir)
+	defer shutdownEtcd(ntetcd)
+
+	if err := Restore(ctx, ns, backupDir); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	runDataManager(ctx, ns.DM)
+
+	var data bytes.Buffer
+	if err := ns.DM.Export(ctx, &data); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if data.String() != expectedData.String() {
+		t.Fatalf("expected restored data %q, got %q", expectedData.String(), data.String())
+	}
+
+	resp, err := ns.E.Get(ctx, "state/runs/run01", 0)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(resp.Kvs) != 1 || string(resp.Kvs[0].Value) != "run01" {
+		t.Fatalf("expected restored etcd key %q", "state/runs/run01")
+	}
+	for _, key := range []string{"state/locks/lock01", "other/key01"} {
+		if _, err := ns.E.Get(ctx, key, 0); err != etcd.ErrKeyNotFound {
+			t.Fatalf("expected etcd key %q to not be restored, got err: %v", key, err)
+		}
+	}
+
+	for name, objs := range objects {
+		for p, expected := range objs {
+			r, err := ns.OSTs[name].ReadObject(p)
+			if err != nil {
+				t.Fatalf("unexpected err reading object %q of objectstorage %q: %v", p, name, err)
+			}
+			data, err := ioutil.ReadAll(r)
+			r.Close()
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if string(data) != expected {
+				t.Fatalf("expected object %q data %q, got %q", p, expected, data)
+			}
+		}
+	}
+
+	// restore on a store with existing data must fail
+	if err := Restore(ctx, ns, backupDir); err == nil {
+		t.Fatalf("expected error restoring on existing data")
+	}
+}
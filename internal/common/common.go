@@ -23,6 +23,9 @@ import (
 
 	"agola.io/agola/internal/etcd"
 	"agola.io/agola/internal/objectstorage"
+	"agola.io/agola/internal/objectstorage/azure"
+	"agola.io/agola/internal/objectstorage/crypt"
+	"agola.io/agola/internal/objectstorage/gcs"
 	"agola.io/agola/internal/objectstorage/posix"
 	"agola.io/agola/internal/objectstorage/s3"
 	"agola.io/agola/internal/services/config"
@@ -106,6 +109,31 @@ func NewObjectStorage(c *config.ObjectStorage) (*objectstorage.ObjStorage, error
 		if err != nil {
 			return nil, errors.Errorf("failed to create s3 object storage: %w", err)
 		}
+	case config.ObjectStorageTypeGCS:
+		ost, err = gcs.New(c.Bucket, c.Endpoint, c.CredentialsFile)
+		if err != nil {
+			return nil, errors.Errorf("failed to create gcs object storage: %w", err)
+		}
+	case config.ObjectStorageTypeAzure:
+		ost, err = azure.New(c.AccountName, c.AccountKey, c.Container, c.Endpoint)
+		if err != nil {
+			return nil, errors.Errorf("failed to create azure object storage: %w", err)
+		}
+	}
+
+	if c.Encryption != nil {
+		keys := []*crypt.Key{}
+		for _, k := range c.Encryption.Keys {
+			key, err := crypt.ReadKeyFile(k.KeyFile)
+			if err != nil {
+				return nil, errors.Errorf("failed to read object storage encryption key %q: %w", k.ID, err)
+			}
+			keys = append(keys, &crypt.Key{ID: k.ID, Key: key})
+		}
+		ost, err = crypt.New(ost, keys, c.Encryption.AllowUnencrypted)
+		if err != nil {
+			return nil, errors.Errorf("failed to create encrypted object storage: %w", err)
+		}
 	}
 
 	return objectstorage.NewObjStorage(ost, "/"), nil
@@ -0,0 +1,68 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"path"
+	"strings"
+
+	errors "golang.org/x/xerrors"
+)
+
+// ShellOptionsScript returns the script lines setting the errexit and
+// pipefail options for the provided shell command line. The options not
+// defined keep the shell default.
+func ShellOptionsScript(shell string, errexit, pipefail *bool) (string, error) {
+	if errexit == nil && pipefail == nil {
+		return "", nil
+	}
+	fields := strings.Fields(shell)
+	if len(fields) == 0 {
+		return "", errors.Errorf("empty shell")
+	}
+	name := path.Base(fields[0])
+
+	var b strings.Builder
+	switch {
+	case name == "pwsh" || name == "powershell":
+		if pipefail != nil {
+			return "", errors.Errorf("shell %q doesn't support the pipefail option", name)
+		}
+		if *errexit {
+			b.WriteString("$ErrorActionPreference = 'Stop'\n")
+		} else {
+			b.WriteString("$ErrorActionPreference = 'Continue'\n")
+		}
+	case strings.HasPrefix(name, "python"):
+		return "", errors.Errorf("shell %q doesn't support shell options", name)
+	default:
+		// posix shells
+		if errexit != nil {
+			if *errexit {
+				b.WriteString("set -e\n")
+			} else {
+				b.WriteString("set +e\n")
+			}
+		}
+		if pipefail != nil {
+			if *pipefail {
+				b.WriteString("set -o pipefail\n")
+			} else {
+				b.WriteString("set +o pipefail\n")
+			}
+		}
+	}
+	return b.String(), nil
+}
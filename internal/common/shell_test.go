@@ -0,0 +1,81 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"testing"
+)
+
+func TestShellOptionsScript(t *testing.T) {
+	yes, no := true, false
+
+	tests := []struct {
+		name     string
+		shell    string
+		errexit  *bool
+		pipefail *bool
+		out      string
+		err      bool
+	}{
+		{
+			name:  "test no options",
+			shell: "/bin/bash",
+			out:   "",
+		},
+		{
+			name:     "test posix shell",
+			shell:    "/bin/bash -e",
+			errexit:  &no,
+			pipefail: &yes,
+			out:      "set +e\nset -o pipefail\n",
+		},
+		{
+			name:    "test pwsh",
+			shell:   "pwsh -c",
+			errexit: &yes,
+			out:     "$ErrorActionPreference = 'Stop'\n",
+		},
+		{
+			name:     "test pwsh pipefail",
+			shell:    "pwsh -c",
+			pipefail: &yes,
+			err:      true,
+		},
+		{
+			name:    "test python",
+			shell:   "python3 -c",
+			errexit: &yes,
+			err:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := ShellOptionsScript(tt.shell, tt.errexit, tt.pipefail)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("got nil error, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out != tt.out {
+				t.Errorf("got %q, want %q", out, tt.out)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"context"
+	"crypto/tls"
+
+	"agola.io/agola/internal/services/config"
+	"agola.io/agola/internal/util"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// NewWebTLSConfig returns the tls config of a service web listener. The server
+// certificate is obtained using ACME when enabled, otherwise it's loaded from
+// the configured cert and key files and reloaded when they change or on SIGHUP
+// until ctx is done.
+func NewWebTLSConfig(ctx context.Context, logger *zap.Logger, w *config.Web) (*tls.Config, error) {
+	log := logger.Sugar()
+
+	if w.ACME.Enabled {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(w.ACME.Domains...),
+			Cache:      autocert.DirCache(w.ACME.CacheDir),
+			Email:      w.ACME.Email,
+		}
+		if w.ACME.DirectoryURL != "" {
+			m.Client = &acme.Client{DirectoryURL: w.ACME.DirectoryURL}
+		}
+		// the returned tls config also handles the tls-alpn-01 challenges
+		return m.TLSConfig(), nil
+	}
+
+	tlsConfig, err := util.NewTLSConfig("", "", "", false)
+	if err != nil {
+		return nil, err
+	}
+	cr, err := util.NewCertReloader(w.TLSCertFile, w.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.GetCertificate = cr.GetCertificate
+
+	go cr.Run(ctx, w.TLSReloadInterval, func(err error) {
+		log.Errorf("failed to reload tls certificate: %+v", err)
+	})
+
+	return tlsConfig, nil
+}
@@ -15,10 +15,16 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net"
+	"path"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"agola.io/agola/internal/common"
 	"agola.io/agola/internal/services/types"
@@ -27,12 +33,19 @@ import (
 	"github.com/ghodss/yaml"
 	"github.com/google/go-jsonnet"
 	errors "golang.org/x/xerrors"
+	yamlv2 "gopkg.in/yaml.v2"
 )
 
 const (
-	maxRunNameLength  = 100
-	maxTaskNameLength = 100
-	maxStepNameLength = 100
+	maxRunNameLength   = 100
+	maxTaskNameLength  = 100
+	maxStepNameLength  = 100
+	maxStageNameLength = 100
+
+	maxLabelKeyLength   = 63
+	maxLabelValueLength = 256
+
+	maxRetries = 10
 
 	defaultWorkingDir = "~/project"
 )
@@ -85,6 +98,14 @@ type Runtime struct {
 	Type       RuntimeType  `json:"type,omitempty"`
 	Arch       common.Arch  `json:"arch,omitempty"`
 	Containers []*Container `json:"containers,omitempty"`
+
+	// ExtraHosts are additional hosts file entries in the "hostname:ip" format
+	ExtraHosts []string `json:"extra_hosts,omitempty"`
+	// DNS are the dns servers used by the pod containers
+	DNS []string `json:"dns,omitempty"`
+	// HostNetwork makes the pod use the host network. It must be allowed by
+	// the instance run config policy.
+	HostNetwork bool `json:"host_network,omitempty"`
 }
 
 type Container struct {
@@ -92,28 +113,80 @@ type Container struct {
 	Environment map[string]Value `json:"environment,omitempty"`
 	User        string           `json:"user"`
 	Privileged  bool             `json:"privileged"`
-	Entrypoint  string           `json:"entrypoint"`
+	// Entrypoint overrides the image entrypoint. It's split on spaces.
+	Entrypoint string `json:"entrypoint"`
+	// Args overrides the image cmd, they're the arguments passed to the
+	// entrypoint
+	Args []string `json:"args"`
 }
 
 type Run struct {
 	Name                 string                         `json:"name"`
 	Tasks                []*Task                        `json:"tasks"`
 	DockerRegistriesAuth map[string]*DockerRegistryAuth `json:"docker_registries_auth"`
+	// When defines when the run will be created. Every run matching the
+	// event will be created as a separate run.
+	When *When `json:"when"`
+	// Labels are added to the created runs and can be used to filter them
+	Labels map[string]string `json:"labels"`
 }
 
 type Task struct {
-	Name                 string                         `json:"name"`
+	Name string `json:"name"`
+	// Uses is a remote task definition, in the OWNER/REPO/PATH@REF format,
+	// used to define the task and With are its params
+	Uses                 string                         `json:"uses"`
+	With                 map[string]string              `json:"with"`
 	Runtime              *Runtime                       `json:"runtime"`
 	Environment          map[string]Value               `json:"environment,omitempty"`
 	WorkingDir           string                         `json:"working_dir"`
 	Shell                string                         `json:"shell"`
 	User                 string                         `json:"user"`
 	Steps                Steps                          `json:"steps"`
+	Retries              *Retries                       `json:"retries"`
 	Depends              Depends                        `json:"depends"`
 	IgnoreFailure        bool                           `json:"ignore_failure"`
 	Approval             bool                           `json:"approval"`
+	ApprovalTimeout      *ApprovalTimeout               `json:"approval_timeout"`
+	Stage                string                         `json:"stage"`
+	Idempotent           bool                           `json:"idempotent"`
+	Outputs              []string                       `json:"outputs"`
 	When                 *When                          `json:"when"`
 	DockerRegistriesAuth map[string]*DockerRegistryAuth `json:"docker_registries_auth"`
+	// SecretFiles are created in the task main container, they're used for
+	// the secrets that must be provided as files instead of environment
+	// variables
+	SecretFiles []*SecretFile `json:"secret_files"`
+}
+
+// SecretFile is a file created in the task main container with a secret
+// content. It's owned by the root user.
+type SecretFile struct {
+	// Path is the absolute file path
+	Path string `json:"path"`
+	// Mode is the file mode in octal format. Defaults to 0400.
+	Mode  string `json:"mode"`
+	Value Value  `json:"value"`
+}
+
+type ApprovalTimeoutAction string
+
+const (
+	ApprovalTimeoutActionReject  ApprovalTimeoutAction = "reject"
+	ApprovalTimeoutActionApprove ApprovalTimeoutAction = "approve"
+)
+
+// ApprovalTimeout defines what happens when an approval task isn't approved
+// in time
+type ApprovalTimeout struct {
+	// Timeout is the max time to wait for the approval in go duration format
+	// (i.e. 24h)
+	Timeout string `json:"timeout"`
+	// Action is executed when the timeout expires. Defaults to reject.
+	Action ApprovalTimeoutAction `json:"action"`
+	// NotifyBefore is the time before the timeout expiry when the approvers
+	// are notified in go duration format
+	NotifyBefore string `json:"notify_before"`
 }
 
 type DependCondition string
@@ -138,9 +211,15 @@ type Steps []Step
 type BaseStep struct {
 	Type string `json:"type"`
 	Name string `json:"name"`
-	When *When  `json:"when"`
+	// When is evaluated by the executor before executing the step. Only the
+	// expression form is supported.
+	When *When `json:"when"`
 }
 
+// Base returns the base step. It's used to access the common fields of the
+// steps.
+func (s *BaseStep) Base() *BaseStep { return s }
+
 type CloneStep struct {
 	BaseStep `json:",inline"`
 }
@@ -149,9 +228,55 @@ type RunStep struct {
 	BaseStep    `json:",inline"`
 	Command     string           `json:"command"`
 	Environment map[string]Value `json:"environment,omitempty"`
-	WorkingDir  string           `json:"working_dir"`
-	Shell       string           `json:"shell"`
-	User        string           `json:"user"`
+	// WorkingDir overrides the task working dir. A relative path is relative
+	// to the task working dir. It's created if it doesn't exist.
+	WorkingDir string `json:"working_dir"`
+	Shell      string `json:"shell"`
+	// ShellOptions toggles the shell options before executing the command
+	ShellOptions *ShellOptions `json:"shell_options"`
+	User         string        `json:"user"`
+	Retries      *Retries      `json:"retries"`
+}
+
+// ShellOptions are the shell options of a run step. The options not defined
+// keep the shell default (the default shell exits on the first error).
+type ShellOptions struct {
+	// Errexit makes the shell exit on the first failed command
+	Errexit *bool `json:"errexit"`
+	// Pipefail makes a pipeline fail when any of its commands fails
+	Pipefail *bool `json:"pipefail"`
+}
+
+type RetryCondition string
+
+const (
+	RetryConditionFailure RetryCondition = "failure"
+	RetryConditionError   RetryCondition = "error"
+)
+
+// Retries defines how many times a failed task or step will be retried
+type Retries struct {
+	Count int `json:"count"`
+	// Delay is the time to wait before a retry in go duration format (i.e. 10s)
+	Delay string           `json:"delay"`
+	On    []RetryCondition `json:"on"`
+}
+
+func (r *Retries) UnmarshalJSON(b []byte) error {
+	type retries Retries
+	var rr struct {
+		retries
+		// with yaml 1.1 an unquoted "on" key is converted to a true boolean
+		OnBool []RetryCondition `json:"true"`
+	}
+	if err := json.Unmarshal(b, &rr); err != nil {
+		return err
+	}
+	*r = Retries(rr.retries)
+	if len(r.On) == 0 {
+		r.On = rr.OnBool
+	}
+	return nil
 }
 
 type SaveToWorkspaceStep struct {
@@ -176,6 +301,51 @@ type RestoreCacheStep struct {
 	DestDir  string   `json:"dest_dir"`
 }
 
+// ParallelStep is a group of run steps executed concurrently inside the same
+// task pod
+type ParallelStep struct {
+	BaseStep `json:",inline"`
+	Steps    Steps `json:"steps"`
+}
+
+// SaveTestReportStep uploads the test report files matching paths (relative to
+// the task working dir) so they can be parsed and saved
+type SaveTestReportStep struct {
+	BaseStep `json:",inline"`
+	Format   TestReportFormat `json:"format"`
+	Paths    []string         `json:"paths"`
+}
+
+// ExportEnvStep reads the dotenv file at path (relative to the task working
+// dir) and exports its variables to all the downstream tasks of the run
+type ExportEnvStep struct {
+	BaseStep `json:",inline"`
+	Path     string `json:"path"`
+}
+
+type TestReportFormat string
+
+const (
+	TestReportFormatJUnit  TestReportFormat = "junit"
+	TestReportFormatGoTest TestReportFormat = "gotest"
+)
+
+// SaveCoverageReportStep uploads the coverage report files matching paths
+// (relative to the task working dir) so they can be parsed and saved
+type SaveCoverageReportStep struct {
+	BaseStep `json:",inline"`
+	Format   CoverageReportFormat `json:"format"`
+	Paths    []string             `json:"paths"`
+}
+
+type CoverageReportFormat string
+
+const (
+	CoverageReportFormatLcov      CoverageReportFormat = "lcov"
+	CoverageReportFormatCobertura CoverageReportFormat = "cobertura"
+	CoverageReportFormatGoCover   CoverageReportFormat = "gocover"
+)
+
 type SaveContent struct {
 	SourceDir string   `json:"source_dir"`
 	DestDir   string   `json:"dest_dir"`
@@ -255,6 +425,38 @@ func (s *Steps) UnmarshalJSON(b []byte) error {
 				}
 				s.Type = stepType
 				step = &s
+
+			case "parallel":
+				var s ParallelStep
+				if err := json.Unmarshal(stepRaw, &s); err != nil {
+					return err
+				}
+				s.Type = stepType
+				step = &s
+
+			case "save_test_report":
+				var s SaveTestReportStep
+				if err := json.Unmarshal(stepRaw, &s); err != nil {
+					return err
+				}
+				s.Type = stepType
+				step = &s
+
+			case "save_coverage_report":
+				var s SaveCoverageReportStep
+				if err := json.Unmarshal(stepRaw, &s); err != nil {
+					return err
+				}
+				s.Type = stepType
+				step = &s
+
+			case "export_env":
+				var s ExportEnvStep
+				if err := json.Unmarshal(stepRaw, &s); err != nil {
+					return err
+				}
+				s.Type = stepType
+				step = &s
 			default:
 				return errors.Errorf("unknown step type: %s", stepType)
 			}
@@ -322,6 +524,43 @@ func (s *Steps) UnmarshalJSON(b []byte) error {
 					}
 					s.Type = stepType
 					step = &s
+
+				case "parallel":
+					var s ParallelStep
+					if err := json.Unmarshal(stepSpecRaw, &s); err != nil {
+						return err
+					}
+					s.Type = stepType
+					step = &s
+
+				case "save_test_report":
+					var s SaveTestReportStep
+					if err := json.Unmarshal(stepSpecRaw, &s); err != nil {
+						return err
+					}
+					s.Type = stepType
+					step = &s
+
+				case "save_coverage_report":
+					var s SaveCoverageReportStep
+					if err := json.Unmarshal(stepSpecRaw, &s); err != nil {
+						return err
+					}
+					s.Type = stepType
+					step = &s
+
+				case "export_env":
+					var s ExportEnvStep
+					switch stepSpec := stepSpec.(type) {
+					case string:
+						s.Path = stepSpec
+					default:
+						if err := json.Unmarshal(stepSpecRaw, &s); err != nil {
+							return err
+						}
+					}
+					s.Type = stepType
+					step = &s
 				default:
 					return errors.Errorf("unknown step type: %s", stepType)
 				}
@@ -448,12 +687,27 @@ func (val *Value) UnmarshalJSON(b []byte) error {
 type When types.When
 
 type when struct {
-	Branch interface{} `json:"branch"`
-	Tag    interface{} `json:"tag"`
-	Ref    interface{} `json:"ref"`
+	Expr        string           `json:"expr"`
+	Branch      interface{}      `json:"branch"`
+	Tag         interface{}      `json:"tag"`
+	Ref         interface{}      `json:"ref"`
+	PullRequest *whenPullRequest `json:"pull_request"`
+}
+
+type whenPullRequest struct {
+	Draft        *bool       `json:"draft"`
+	Labels       interface{} `json:"labels"`
+	TargetBranch interface{} `json:"target_branch"`
 }
 
 func (w *When) UnmarshalJSON(b []byte) error {
+	// a string is a template expression
+	var expr string
+	if err := json.Unmarshal(b, &expr); err == nil {
+		w.Expr = expr
+		return nil
+	}
+
 	var wi *when
 	if err := json.Unmarshal(b, &wi); err != nil {
 		return err
@@ -461,6 +715,8 @@ func (w *When) UnmarshalJSON(b []byte) error {
 
 	var err error
 
+	w.Expr = wi.Expr
+
 	if wi.Branch != nil {
 		w.Branch, err = parseWhenConditions(wi.Branch)
 		if err != nil {
@@ -482,6 +738,24 @@ func (w *When) UnmarshalJSON(b []byte) error {
 		}
 	}
 
+	if wi.PullRequest != nil {
+		w.PullRequest = &types.WhenPullRequest{
+			Draft: wi.PullRequest.Draft,
+		}
+		if wi.PullRequest.Labels != nil {
+			w.PullRequest.Labels, err = parseWhenConditions(wi.PullRequest.Labels)
+			if err != nil {
+				return err
+			}
+		}
+		if wi.PullRequest.TargetBranch != nil {
+			w.PullRequest.TargetBranch, err = parseWhenConditions(wi.PullRequest.TargetBranch)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -637,11 +911,68 @@ func ParseConfig(configData []byte, format ConfigFormat) (*Config, error) {
 	}
 
 	config := DefaultConfig
-	if err := yaml.Unmarshal(configData, &config); err != nil {
-		return nil, errors.Errorf("failed to unmarshal config: %w", err)
+	if err := unmarshalConfig(configData, format, &config); err != nil {
+		cerr := &ConfigError{Err: errors.Errorf("failed to unmarshal config: %w", err)}
+		if format != ConfigFormatJsonnet {
+			cerr.Position = yamlErrorPosition(err)
+		}
+		return nil, cerr
 	}
 
-	return &config, checkConfig(&config)
+	if err := checkConfig(&config); err != nil {
+		// positions are reported only for yaml (and json) configs since the
+		// jsonnet output has no relation with the source file lines
+		var cerr *ConfigError
+		if format != ConfigFormatJsonnet && errors.As(err, &cerr) {
+			cerr.Position = findPosition(configData, cerr.path)
+		}
+		return &config, err
+	}
+
+	return &config, nil
+}
+
+// unmarshalConfig unmarshals the config data. Yaml configs can contain
+// multiple documents that are merged in order: their runs are appended and
+// their docker registries auth are merged (the last definition wins).
+func unmarshalConfig(configData []byte, format ConfigFormat, c *Config) error {
+	if format == ConfigFormatJsonnet {
+		return yaml.Unmarshal(configData, c)
+	}
+
+	d := yamlv2.NewDecoder(bytes.NewReader(configData))
+	for {
+		// decode to a generic value and marshal it back to a single document
+		// since the json conversion only handles the first document
+		var doc interface{}
+		if err := d.Decode(&doc); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		if doc == nil {
+			continue
+		}
+		docData, err := yamlv2.Marshal(doc)
+		if err != nil {
+			return err
+		}
+
+		var dc Config
+		if err := yaml.Unmarshal(docData, &dc); err != nil {
+			return err
+		}
+		c.Runs = append(c.Runs, dc.Runs...)
+		for name, auth := range dc.DockerRegistriesAuth {
+			if c.DockerRegistriesAuth == nil {
+				c.DockerRegistriesAuth = map[string]*DockerRegistryAuth{}
+			}
+			c.DockerRegistriesAuth[name] = auth
+		}
+	}
+
+	return nil
 }
 
 func checkConfig(config *Config) error {
@@ -652,75 +983,130 @@ func checkConfig(config *Config) error {
 	seenRuns := map[string]struct{}{}
 	for ri, run := range config.Runs {
 		if run == nil {
-			return errors.Errorf("run at index %d is empty", ri)
+			return pathError(errors.Errorf("run at index %d is empty", ri), "runs", ri)
 		}
 
 		if run.Name == "" {
-			return errors.Errorf("run at index %d has empty name", ri)
+			return pathError(errors.Errorf("run at index %d has empty name", ri), "runs", ri)
 		}
 
 		if len(run.Name) > maxRunNameLength {
-			return errors.Errorf("run name %q too long", run.Name)
+			return pathError(errors.Errorf("run name %q too long", run.Name), "runs", ri, "name")
 		}
 
 		if _, ok := seenRuns[run.Name]; ok {
-			return errors.Errorf("duplicate run name: %s", run.Name)
+			return pathError(errors.Errorf("duplicate run name: %s", run.Name), "runs", ri, "name")
 		}
 		seenRuns[run.Name] = struct{}{}
 
+		for k, v := range run.Labels {
+			if err := checkRunLabel(k, v); err != nil {
+				return pathError(errors.Errorf("run %q: %w", run.Name, err), "runs", ri, "labels", k)
+			}
+		}
+
 		seenTasks := map[string]struct{}{}
 		for ti, task := range run.Tasks {
 			if task == nil {
-				return errors.Errorf("run %q: task at index %d is empty", run.Name, ti)
+				return pathError(errors.Errorf("run %q: task at index %d is empty", run.Name, ti), "runs", ri, "tasks", ti)
 			}
 
 			if task.Name == "" {
-				return errors.Errorf("run %q: task at index %d has empty name", run.Name, ti)
+				return pathError(errors.Errorf("run %q: task at index %d has empty name", run.Name, ti), "runs", ri, "tasks", ti)
 			}
 
 			if len(task.Name) > maxTaskNameLength {
-				return errors.Errorf("task name %q too long", task.Name)
+				return pathError(errors.Errorf("task name %q too long", task.Name), "runs", ri, "tasks", ti, "name")
 			}
 
 			if _, ok := seenTasks[task.Name]; ok {
-				return errors.Errorf("duplicate task name: %s", task.Name)
+				return pathError(errors.Errorf("duplicate task name: %s", task.Name), "runs", ri, "tasks", ti, "name")
 			}
 			seenTasks[task.Name] = struct{}{}
 
+			if len(task.Stage) > maxStageNameLength {
+				return pathError(errors.Errorf("task %q: stage name %q too long", task.Name, task.Stage), "runs", ri, "tasks", ti, "stage")
+			}
+
+			if task.Uses != "" {
+				if _, err := ParseTaskUses(task.Uses); err != nil {
+					return pathError(errors.Errorf("task %q: %w", task.Name, err), "runs", ri, "tasks", ti, "uses")
+				}
+				if len(task.Steps) > 0 {
+					return pathError(errors.Errorf("task %q: steps cannot be defined when using a remote task", task.Name), "runs", ri, "tasks", ti, "steps")
+				}
+				// the runtime could be provided by the remote task
+				if task.Runtime == nil {
+					continue
+				}
+			} else if len(task.With) > 0 {
+				return pathError(errors.Errorf("task %q: params defined without a remote task", task.Name), "runs", ri, "tasks", ti, "with")
+			}
+
 			// check tasks runtime
 			if task.Runtime == nil {
-				return errors.Errorf("task %q: runtime is not defined", task.Name)
+				return pathError(errors.Errorf("task %q: runtime is not defined", task.Name), "runs", ri, "tasks", ti)
 			}
 
 			r := task.Runtime
 			if r.Type != "" {
 				if r.Type != RuntimeTypePod {
-					return errors.Errorf("task %q runtime: wrong type %q", task.Name, r.Type)
+					return pathError(errors.Errorf("task %q runtime: wrong type %q", task.Name, r.Type), "runs", ri, "tasks", ti, "runtime", "type")
 				}
 			}
 			if len(r.Containers) == 0 {
-				return errors.Errorf("task %q runtime: at least one container must be defined", task.Name)
+				return pathError(errors.Errorf("task %q runtime: at least one container must be defined", task.Name), "runs", ri, "tasks", ti, "runtime")
 			}
 			if r.Arch != "" {
 				if !common.IsValidArch(r.Arch) {
-					return errors.Errorf("task %q runtime: invalid arch %q", task.Name, r.Arch)
+					return pathError(errors.Errorf("task %q runtime: invalid arch %q", task.Name, r.Arch), "runs", ri, "tasks", ti, "runtime", "arch")
+				}
+			}
+			// the main container entrypoint is replaced by the toolbox sleeper
+			// so the args cannot be passed to the image entrypoint
+			if mc := r.Containers[0]; mc != nil && len(mc.Args) > 0 && mc.Entrypoint == "" {
+				return pathError(errors.Errorf("task %q runtime: main container args require an entrypoint", task.Name), "runs", ri, "tasks", ti, "runtime", "containers", 0, "args")
+			}
+			for hi, extraHost := range r.ExtraHosts {
+				if err := checkExtraHost(extraHost); err != nil {
+					return pathError(errors.Errorf("task %q runtime: %w", task.Name, err), "runs", ri, "tasks", ti, "runtime", "extra_hosts", hi)
+				}
+			}
+			seenSecretFiles := map[string]struct{}{}
+			for fi, sf := range task.SecretFiles {
+				if sf == nil || !path.IsAbs(sf.Path) {
+					return pathError(errors.Errorf("task %q secret file %d: path must be absolute", task.Name, fi), "runs", ri, "tasks", ti, "secret_files", fi)
+				}
+				if _, ok := seenSecretFiles[path.Clean(sf.Path)]; ok {
+					return pathError(errors.Errorf("task %q: duplicate secret file %q", task.Name, sf.Path), "runs", ri, "tasks", ti, "secret_files", fi, "path")
+				}
+				seenSecretFiles[path.Clean(sf.Path)] = struct{}{}
+				if sf.Mode != "" {
+					if mode, err := strconv.ParseUint(sf.Mode, 8, 32); err != nil || mode > 0777 {
+						return pathError(errors.Errorf("task %q secret file %q: wrong mode %q", task.Name, sf.Path, sf.Mode), "runs", ri, "tasks", ti, "secret_files", fi, "mode")
+					}
+				}
+			}
+			for di, dns := range r.DNS {
+				if net.ParseIP(dns) == nil {
+					return pathError(errors.Errorf("task %q runtime: invalid dns server ip %q", task.Name, dns), "runs", ri, "tasks", ti, "runtime", "dns", di)
 				}
 			}
 		}
 	}
 
 	// check broken dependencies
-	for _, run := range config.Runs {
+	for ri, run := range config.Runs {
 		// collect all task names
 		allTasks := map[string]struct{}{}
 		for _, task := range run.Tasks {
 			allTasks[task.Name] = struct{}{}
 		}
 
-		for _, task := range run.Tasks {
-			for _, dep := range task.Depends {
+		for ti, task := range run.Tasks {
+			for di, dep := range task.Depends {
 				if _, ok := allTasks[dep.TaskName]; !ok {
-					return errors.Errorf("run task %q needed by task %q doesn't exist", dep.TaskName, task.Name)
+					return pathError(errors.Errorf("run task %q needed by task %q doesn't exist", dep.TaskName, task.Name), "runs", ri, "tasks", ti, "depends", di)
 				}
 			}
 		}
@@ -753,8 +1139,8 @@ func checkConfig(config *Config) error {
 	}
 
 	// check that the task and its parent don't have a common dependency
-	for _, run := range config.Runs {
-		for _, task := range run.Tasks {
+	for ri, run := range config.Runs {
+		for ti, task := range run.Tasks {
 			parents := getTaskParents(run, task)
 			for _, parent := range parents {
 				allParents := getAllTaskParents(run, task)
@@ -762,7 +1148,7 @@ func checkConfig(config *Config) error {
 				for _, p := range allParents {
 					for _, pp := range allParentParents {
 						if p.Name == pp.Name {
-							return errors.Errorf("task %s and its dependency %s have both a dependency on task %s", task.Name, parent.Name, p.Name)
+							return pathError(errors.Errorf("task %s and its dependency %s have both a dependency on task %s", task.Name, parent.Name, p.Name), "runs", ri, "tasks", ti, "depends")
 						}
 					}
 				}
@@ -771,21 +1157,66 @@ func checkConfig(config *Config) error {
 	}
 
 	// check duplicate task dependencies
-	for _, run := range config.Runs {
-		for _, task := range run.Tasks {
+	for ri, run := range config.Runs {
+		for ti, task := range run.Tasks {
 			// check duplicate dependencies in task
 			seenDependencies := map[string]struct{}{}
-			for _, dep := range task.Depends {
+			for di, dep := range task.Depends {
 				if _, ok := seenDependencies[dep.TaskName]; ok {
-					return errors.Errorf("duplicate task dependency: %s", task.Name)
+					return pathError(errors.Errorf("duplicate task dependency: %s", task.Name), "runs", ri, "tasks", ti, "depends", di)
 				}
 				seenDependencies[dep.TaskName] = struct{}{}
 			}
 		}
 	}
 
-	for _, run := range config.Runs {
-		for _, task := range run.Tasks {
+	// check task outputs and their references
+	for ri, run := range config.Runs {
+		for ti, task := range run.Tasks {
+			seenOutputs := map[string]struct{}{}
+			for oi, output := range task.Outputs {
+				if !outputKeyRegexp.MatchString(output) {
+					return pathError(errors.Errorf("task %q: invalid output key %q", task.Name, output), "runs", ri, "tasks", ti, "outputs", oi)
+				}
+				if _, ok := seenOutputs[output]; ok {
+					return pathError(errors.Errorf("task %q: duplicate output key %q", task.Name, output), "runs", ri, "tasks", ti, "outputs", oi)
+				}
+				seenOutputs[output] = struct{}{}
+			}
+		}
+
+		for ti, task := range run.Tasks {
+			allParents := getAllTaskParents(run, task)
+			for envName, envValue := range task.Environment {
+				if envValue.Type != ValueTypeString {
+					continue
+				}
+				for _, ref := range TaskOutputRefs(envValue.Value) {
+					var parent *Task
+					for _, p := range allParents {
+						if p.Name == ref.TaskName {
+							parent = p
+						}
+					}
+					if parent == nil {
+						return pathError(errors.Errorf("task %q: environment variable %q references outputs of task %q that isn't a dependency", task.Name, envName, ref.TaskName), "runs", ri, "tasks", ti, "environment", envName)
+					}
+					if !util.StringInSlice(parent.Outputs, ref.Key) {
+						return pathError(errors.Errorf("task %q: environment variable %q references undeclared output %q of task %q", task.Name, envName, ref.Key, ref.TaskName), "runs", ri, "tasks", ti, "environment", envName)
+					}
+				}
+			}
+		}
+	}
+
+	for ri, run := range config.Runs {
+		for ti, task := range run.Tasks {
+			if err := checkRetries(task.Retries); err != nil {
+				return pathError(errors.Errorf("task %q: %w", task.Name, err), "runs", ri, "tasks", ti, "retries")
+			}
+			if err := checkApprovalTimeout(task); err != nil {
+				return pathError(errors.Errorf("task %q: %w", task.Name, err), "runs", ri, "tasks", ti, "approval_timeout")
+			}
 			for i, s := range task.Steps {
 				switch step := s.(type) {
 				// TODO(sgotti) we could use the run step command as step name but when the
@@ -793,17 +1224,71 @@ func checkConfig(config *Config) error {
 				// probably be quite unuseful/confusing from an UI point of view
 				case *RunStep:
 					if step.Command == "" {
-						return errors.Errorf("no command defined for step %d (run) in task %q", i, task.Name)
+						return pathError(errors.Errorf("no command defined for step %d (run) in task %q", i, task.Name), "runs", ri, "tasks", ti, "steps", i)
+					}
+					if err := checkRetries(step.Retries); err != nil {
+						return pathError(errors.Errorf("step %d (run) in task %q: %w", i, task.Name, err), "runs", ri, "tasks", ti, "steps", i)
+					}
+					if err := checkShellOptions(step, task.Shell); err != nil {
+						return pathError(errors.Errorf("step %d (run) in task %q: %w", i, task.Name, err), "runs", ri, "tasks", ti, "steps", i, "shell_options")
 					}
 
 				case *SaveCacheStep:
 					if step.Key == "" {
-						return errors.Errorf("no key defined for step %d (save_cache) in task %q", i, task.Name)
+						return pathError(errors.Errorf("no key defined for step %d (save_cache) in task %q", i, task.Name), "runs", ri, "tasks", ti, "steps", i)
 					}
 
 				case *RestoreCacheStep:
 					if len(step.Keys) == 0 {
-						return errors.Errorf("no keys defined for step %d (restore_cache) in task %q", i, task.Name)
+						return pathError(errors.Errorf("no keys defined for step %d (restore_cache) in task %q", i, task.Name), "runs", ri, "tasks", ti, "steps", i)
+					}
+
+				case *ParallelStep:
+					if len(step.Steps) == 0 {
+						return pathError(errors.Errorf("no steps defined for step %d (parallel) in task %q", i, task.Name), "runs", ri, "tasks", ti, "steps", i)
+					}
+					for j, ss := range step.Steps {
+						rs, ok := ss.(*RunStep)
+						if !ok {
+							return pathError(errors.Errorf("sub step %d of step %d (parallel) in task %q must be a run step", j, i, task.Name), "runs", ri, "tasks", ti, "steps", i, "steps", j)
+						}
+						if rs.Command == "" {
+							return pathError(errors.Errorf("no command defined for sub step %d of step %d (parallel) in task %q", j, i, task.Name), "runs", ri, "tasks", ti, "steps", i, "steps", j)
+						}
+						if rs.Retries != nil {
+							return pathError(errors.Errorf("retries aren't supported for sub step %d of step %d (parallel) in task %q", j, i, task.Name), "runs", ri, "tasks", ti, "steps", i, "steps", j)
+						}
+						if rs.When != nil {
+							return pathError(errors.Errorf("when isn't supported for sub step %d of step %d (parallel) in task %q", j, i, task.Name), "runs", ri, "tasks", ti, "steps", i, "steps", j, "when")
+						}
+						if err := checkShellOptions(rs, task.Shell); err != nil {
+							return pathError(errors.Errorf("sub step %d of step %d (parallel) in task %q: %w", j, i, task.Name, err), "runs", ri, "tasks", ti, "steps", i, "steps", j, "shell_options")
+						}
+					}
+
+				case *SaveTestReportStep:
+					switch step.Format {
+					case TestReportFormatJUnit, TestReportFormatGoTest:
+					default:
+						return pathError(errors.Errorf("invalid test report format %q for step %d (save_test_report) in task %q", step.Format, i, task.Name), "runs", ri, "tasks", ti, "steps", i)
+					}
+					if len(step.Paths) == 0 {
+						return pathError(errors.Errorf("no paths defined for step %d (save_test_report) in task %q", i, task.Name), "runs", ri, "tasks", ti, "steps", i)
+					}
+
+				case *SaveCoverageReportStep:
+					switch step.Format {
+					case CoverageReportFormatLcov, CoverageReportFormatCobertura, CoverageReportFormatGoCover:
+					default:
+						return pathError(errors.Errorf("invalid coverage report format %q for step %d (save_coverage_report) in task %q", step.Format, i, task.Name), "runs", ri, "tasks", ti, "steps", i)
+					}
+					if len(step.Paths) == 0 {
+						return pathError(errors.Errorf("no paths defined for step %d (save_coverage_report) in task %q", i, task.Name), "runs", ri, "tasks", ti, "steps", i)
+					}
+
+				case *ExportEnvStep:
+					if step.Path == "" {
+						return pathError(errors.Errorf("no path defined for step %d (export_env) in task %q", i, task.Name), "runs", ri, "tasks", ti, "steps", i)
 					}
 				}
 			}
@@ -817,14 +1302,14 @@ func checkConfig(config *Config) error {
 		}
 	}
 
-	for _, run := range config.Runs {
+	for ri, run := range config.Runs {
 		// set auth type to basic if not specified
 		for _, registryAuth := range run.DockerRegistriesAuth {
 			if registryAuth.Type == "" {
 				registryAuth.Type = DockerRegistryAuthTypeBasic
 			}
 		}
-		for _, task := range run.Tasks {
+		for ti, task := range run.Tasks {
 			// set auth type to basic if not specified
 			for _, registryAuth := range task.DockerRegistriesAuth {
 				if registryAuth.Type == "" {
@@ -838,8 +1323,7 @@ func checkConfig(config *Config) error {
 			}
 
 			// set task runtime type to pod if empty
-			r := task.Runtime
-			if r.Type == "" {
+			if r := task.Runtime; r != nil && r.Type == "" {
 				r.Type = RuntimeTypePod
 			}
 
@@ -850,17 +1334,18 @@ func checkConfig(config *Config) error {
 				// command is very long or multi line it doesn't makes sense and will
 				// probably be quite unuseful/confusing from an UI point of view
 				case *RunStep:
+					if err := setRunStepDefaultName(step); err != nil {
+						return pathError(errors.Errorf("missing step name for step %d (run) in task %q, required since command is more than one line", i, task.Name), "runs", ri, "tasks", ti, "steps", i)
+					}
+
+				case *ParallelStep:
 					if step.Name == "" {
-						lines, err := util.CountLines(step.Command)
-						// if we failed to count the lines (shouldn't happen) or the number of lines is > 1 then a name is requred
-						if err != nil || lines > 1 {
-							return errors.Errorf("missing step name for step %d (run) in task %q, required since command is more than one line", i, task.Name)
-						}
-						len := len(step.Command)
-						if len > maxStepNameLength {
-							len = maxStepNameLength
+						step.Name = "parallel"
+					}
+					for j, ss := range step.Steps {
+						if err := setRunStepDefaultName(ss.(*RunStep)); err != nil {
+							return pathError(errors.Errorf("missing step name for sub step %d of step %d (parallel) in task %q, required since command is more than one line", j, i, task.Name), "runs", ri, "tasks", ti, "steps", i, "steps", j)
 						}
-						step.Name = step.Command[:len]
 					}
 
 				case *SaveCacheStep:
@@ -875,6 +1360,69 @@ func checkConfig(config *Config) error {
 		}
 	}
 
+	return checkTemplates(config)
+}
+
+// checkShellOptions checks that the run step shell supports its shell
+// options. When the step and the task don't define a shell the executor
+// default posix shell is used.
+func checkShellOptions(s *RunStep, taskShell string) error {
+	if s.ShellOptions == nil {
+		return nil
+	}
+	shell := s.Shell
+	if shell == "" {
+		shell = taskShell
+	}
+	if shell == "" {
+		return nil
+	}
+	_, err := common.ShellOptionsScript(shell, s.ShellOptions.Errexit, s.ShellOptions.Pipefail)
+	return err
+}
+
+func checkRetries(r *Retries) error {
+	if r == nil {
+		return nil
+	}
+	if r.Count < 0 || r.Count > maxRetries {
+		return errors.Errorf("retries count must be between 0 and %d", maxRetries)
+	}
+	if r.Delay != "" {
+		d, err := time.ParseDuration(r.Delay)
+		if err != nil {
+			return errors.Errorf("invalid retries delay %q: %w", r.Delay, err)
+		}
+		if d < 0 {
+			return errors.Errorf("negative retries delay %q", r.Delay)
+		}
+	}
+	for _, c := range r.On {
+		switch c {
+		case RetryConditionFailure, RetryConditionError:
+		default:
+			return errors.Errorf("invalid retries condition %q", c)
+		}
+	}
+	return nil
+}
+
+// setRunStepDefaultName sets the run step name to its command when not
+// defined. It returns an error when the command is more than one line.
+func setRunStepDefaultName(step *RunStep) error {
+	if step.Name != "" {
+		return nil
+	}
+	lines, err := util.CountLines(step.Command)
+	// if we failed to count the lines (shouldn't happen) or the number of lines is > 1 then a name is requred
+	if err != nil || lines > 1 {
+		return errors.Errorf("multiline command without a name")
+	}
+	len := len(step.Command)
+	if len > maxStepNameLength {
+		len = maxStepNameLength
+	}
+	step.Name = step.Command[:len]
 	return nil
 }
 
@@ -898,6 +1446,93 @@ func getTaskParents(run *Run, task *Task) []*Task {
 // getAllTaskParents returns all the parents (both direct and ancestors) of a task.
 // In case of circular dependency it won't loop forever but will also return
 // the task as parent of itself
+func checkApprovalTimeout(task *Task) error {
+	at := task.ApprovalTimeout
+	if at == nil {
+		return nil
+	}
+	if !task.Approval {
+		return errors.Errorf("approval timeout defined but the task doesn't require approval")
+	}
+	timeout, err := time.ParseDuration(at.Timeout)
+	if err != nil {
+		return errors.Errorf("invalid approval timeout %q: %w", at.Timeout, err)
+	}
+	if timeout <= 0 {
+		return errors.Errorf("approval timeout %q must be positive", at.Timeout)
+	}
+	switch at.Action {
+	case "", ApprovalTimeoutActionReject, ApprovalTimeoutActionApprove:
+	default:
+		return errors.Errorf("invalid approval timeout action %q", at.Action)
+	}
+	if at.NotifyBefore != "" {
+		notifyBefore, err := time.ParseDuration(at.NotifyBefore)
+		if err != nil {
+			return errors.Errorf("invalid approval timeout notify before %q: %w", at.NotifyBefore, err)
+		}
+		if notifyBefore <= 0 || notifyBefore >= timeout {
+			return errors.Errorf("approval timeout notify before %q must be positive and lower than the timeout", at.NotifyBefore)
+		}
+	}
+	return nil
+}
+
+var outputKeyRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// RunLabelReservedPrefix is the prefix of the automatic run labels. It cannot
+// be used by the labels defined in the config.
+const RunLabelReservedPrefix = "agola."
+
+// checkExtraHost checks that an extra host is in the "hostname:ip" format
+func checkExtraHost(extraHost string) error {
+	parts := strings.SplitN(extraHost, ":", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return errors.Errorf("wrong extra host %q, it must be in the format hostname:ip", extraHost)
+	}
+	if net.ParseIP(parts[1]) == nil {
+		return errors.Errorf("extra host %q: invalid ip %q", extraHost, parts[1])
+	}
+	return nil
+}
+
+var labelKeyRegexp = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9_.-]*[A-Za-z0-9])?$`)
+
+func checkRunLabel(key, value string) error {
+	if len(key) > maxLabelKeyLength {
+		return errors.Errorf("label key %q too long", key)
+	}
+	if !labelKeyRegexp.MatchString(key) {
+		return errors.Errorf("invalid label key %q", key)
+	}
+	if strings.HasPrefix(key, RunLabelReservedPrefix) {
+		return errors.Errorf("label key %q uses the reserved prefix %q", key, RunLabelReservedPrefix)
+	}
+	if len(value) > maxLabelValueLength {
+		return errors.Errorf("label %q value too long", key)
+	}
+	return nil
+}
+
+// TaskOutputRefRegexp matches the references to a task output in the
+// ${tasks.TASKNAME.outputs.KEY} format
+var TaskOutputRefRegexp = regexp.MustCompile(`\$\{tasks\.([^.}]+)\.outputs\.([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// TaskOutputRef is a reference to the output Key of task TaskName
+type TaskOutputRef struct {
+	TaskName string
+	Key      string
+}
+
+// TaskOutputRefs returns the task outputs references in s
+func TaskOutputRefs(s string) []TaskOutputRef {
+	refs := []TaskOutputRef{}
+	for _, m := range TaskOutputRefRegexp.FindAllStringSubmatch(s, -1) {
+		refs = append(refs, TaskOutputRef{TaskName: m[1], Key: m[2]})
+	}
+	return refs
+}
+
 func getAllTaskParents(run *Run, task *Task) []*Task {
 	pMap := map[string]*Task{}
 	nextParents := getTaskParents(run, task)
@@ -89,6 +89,264 @@ func TestParseConfig(t *testing.T) {
                 `,
 			err: fmt.Errorf(`task "task01" runtime: invalid arch "invalidarch"`),
 		},
+		{
+			name: "test invalid run label key",
+			in: `
+                runs:
+                  - name: run01
+                    labels:
+                      "-release": "true"
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                `,
+			err: fmt.Errorf(`run "run01": invalid label key "-release"`),
+		},
+		{
+			name: "test main container args without entrypoint",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                              args: ["-c", "echo"]
+                `,
+			err: fmt.Errorf(`task "task01" runtime: main container args require an entrypoint`),
+		},
+		{
+			name: "test service container args",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                            - image: postgres
+                              entrypoint: docker-entrypoint.sh
+                              args: ["postgres", "-c", "fsync=off"]
+                `,
+		},
+		{
+			name: "test run step shell options not supported by the shell",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: mcr.microsoft.com/powershell
+                        steps:
+                          - run:
+                              command: Get-ChildItem
+                              shell: pwsh -c
+                              shell_options:
+                                pipefail: true
+                `,
+			err: fmt.Errorf(`step 0 (run) in task "task01": shell "pwsh" doesn't support the pipefail option`),
+		},
+		{
+			name: "test step when expression",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                        steps:
+                          - run: make
+                          - run:
+                              name: notify
+                              command: notify
+                              when: "{{ task_status == 'failed' && branch == 'main' }}"
+                `,
+		},
+		{
+			name: "test step when conditions",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                        steps:
+                          - run:
+                              name: notify
+                              command: notify
+                              when:
+                                branch: main
+                `,
+			err: fmt.Errorf(`task "task01" step 0 when: only the when expression is supported`),
+		},
+		{
+			name: "test runtime network options",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                          extra_hosts:
+                            - registry.internal:10.0.0.10
+                          dns:
+                            - 10.0.0.2
+                `,
+		},
+		{
+			name: "test secret file relative path",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                        secret_files:
+                          - path: .kube/config
+                            value:
+                              from_variable: kubeconfig
+                `,
+			err: fmt.Errorf(`task "task01" secret file 0: path must be absolute`),
+		},
+		{
+			name: "test secret file wrong mode",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                        secret_files:
+                          - path: /root/.kube/config
+                            mode: "0800"
+                            value:
+                              from_variable: kubeconfig
+                `,
+			err: fmt.Errorf(`task "task01" secret file "/root/.kube/config": wrong mode "0800"`),
+		},
+		{
+			name: "test runtime wrong extra host",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                          extra_hosts:
+                            - registry.internal
+                `,
+			err: fmt.Errorf(`task "task01" runtime: wrong extra host "registry.internal", it must be in the format hostname:ip`),
+		},
+		{
+			name: "test runtime invalid dns server",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                          dns:
+                            - dns.internal
+                `,
+			err: fmt.Errorf(`task "task01" runtime: invalid dns server ip "dns.internal"`),
+		},
+		{
+			name: "test when template with undefined variable",
+			in: `
+                runs:
+                  - name: run01
+                    when: "{{ branch == 'main' && os }}"
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                `,
+			err: fmt.Errorf(`run "run01" when: template "{{ branch == 'main' && os }}": undefined variable "os"`),
+		},
+		{
+			name: "test when expression without template",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        when:
+                          expr: branch == 'main'
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                `,
+			err: fmt.Errorf(`task "task01" when: when expression "branch == 'main'" must be in the {{ EXPRESSION }} format`),
+		},
+		{
+			name: "test environment template syntax error",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: "busybox:{{ tag || 'latest' }}"
+                        steps:
+                          - run:
+                              command: make
+                              environment:
+                                TARGET: "{{ branch = 'main' }}"
+                `,
+			err: fmt.Errorf(`task "task01" step: environment variable "TARGET": template "{{ branch = 'main' }}": position 11: unexpected character '='`),
+		},
+		{
+			name: "test run label with reserved prefix",
+			in: `
+                runs:
+                  - name: run01
+                    labels:
+                      agola.branch: master
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                `,
+			err: fmt.Errorf(`run "run01": label key "agola.branch" uses the reserved prefix "agola."`),
+		},
 		{
 			name: "test missing task dependency",
 			in: `
@@ -105,6 +363,54 @@ func TestParseConfig(t *testing.T) {
                 `,
 			err: fmt.Errorf(`run task "task02" needed by task "task01" doesn't exist`),
 		},
+		{
+			name: "test reference to undeclared task output",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                        outputs:
+                          - image_tag
+                      - name: task02
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                        environment:
+                          TAG: ${tasks.task01.outputs.version}
+                        depends:
+                          - task01
+                `,
+			err: fmt.Errorf(`task "task02": environment variable "TAG" references undeclared output "version" of task "task01"`),
+		},
+		{
+			name: "test reference to output of a task that isn't a dependency",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                        outputs:
+                          - image_tag
+                      - name: task02
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                        environment:
+                          TAG: ${tasks.task01.outputs.image_tag}
+                `,
+			err: fmt.Errorf(`task "task02": environment variable "TAG" references outputs of task "task01" that isn't a dependency`),
+		},
 		{
 			name: "test circular dependency between 2 tasks a -> b -> a",
 			in: `
@@ -133,6 +439,91 @@ func TestParseConfig(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "test parallel step",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                        steps:
+                          - parallel:
+                              name: tests
+                              steps:
+                                - run: make test
+                                - run:
+                                    name: lint
+                                    command: make lint
+                `,
+		},
+		{
+			name: "test parallel step with a non run sub step",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                        steps:
+                          - parallel:
+                              steps:
+                                - run: make test
+                                - restore_workspace:
+                                    dest_dir: /src
+                `,
+			err: fmt.Errorf(`sub step 1 of step 0 (parallel) in task "task01" must be a run step`),
+		},
+		{
+			name: "test step retries",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                        retries:
+                          count: 1
+                        steps:
+                          - run:
+                              command: make test
+                              retries:
+                                count: 3
+                                delay: 10s
+                                on:
+                                  - failure
+                `,
+		},
+		{
+			name: "test invalid step retries condition",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                        steps:
+                          - run:
+                              command: make test
+                              retries:
+                                count: 3
+                                on:
+                                  - timeout
+                `,
+			err: fmt.Errorf(`step 0 (run) in task "task01": invalid retries condition "timeout"`),
+		},
 	}
 
 	for _, tt := range tests {
@@ -465,3 +856,194 @@ func TestParseOutput(t *testing.T) {
 		})
 	}
 }
+
+func TestParseConfigErrorPosition(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		pos  *Position
+	}{
+		{
+			name: "test yaml syntax error",
+			in: `runs:
+  - name: run01
+    tasks: [
+`,
+			pos: &Position{Line: 3, Column: 1},
+		},
+		{
+			name: "test missing task runtime",
+			in: `runs:
+  - name: run01
+    tasks:
+      - name: task01
+        runtime:
+          containers:
+            - image: image01
+      - name: task02
+`,
+			pos: &Position{Line: 8, Column: 9},
+		},
+		{
+			name: "test step without command",
+			in: `runs:
+  - name: run01
+    tasks:
+      - name: task01
+        runtime:
+          containers:
+            - image: image01
+        steps:
+          - type: clone
+          - type: run
+            name: step01
+`,
+			pos: &Position{Line: 10, Column: 13},
+		},
+		{
+			name: "test invalid arch",
+			in: `runs:
+  - name: run01
+    tasks:
+      - name: task01
+        runtime:
+          arch: arm128
+          containers:
+            - image: image01
+`,
+			pos: &Position{Line: 6, Column: 11},
+		},
+		{
+			name: "test image template error",
+			in: `runs:
+  - name: run01
+    tasks:
+      - name: task01
+        runtime:
+          containers:
+            - image: "image01:{{ version }}"
+`,
+			pos: &Position{Line: 7, Column: 15},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseConfig([]byte(tt.in), ConfigFormatJSON)
+			if err == nil {
+				t.Fatalf("got nil error, want error")
+			}
+			var cerr *ConfigError
+			if !errors.As(err, &cerr) {
+				t.Fatalf("got error %v of type %T, want a ConfigError", err, err)
+			}
+			if diff := cmp.Diff(tt.pos, cerr.Position); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestParseConfigDocuments(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		runs     []string
+		registry string
+		pos      *Position
+	}{
+		{
+			name: "test anchors and merge keys",
+			in: `defaults: &defaults
+  runtime:
+    containers:
+      - image: busybox:1.31
+  steps:
+    - run: ls
+runs:
+  - name: run01
+    tasks:
+      - <<: *defaults
+        name: task01
+      - <<: *defaults
+        name: task02
+        depends:
+          - task03
+`,
+			runs: []string{"run01"},
+			pos:  &Position{Line: 15, Column: 13},
+		},
+		{
+			name: "test error in merged anchor",
+			in: `defaults: &defaults
+  runtime:
+    arch: arm128
+    containers:
+      - image: busybox:1.31
+runs:
+  - name: run01
+    tasks:
+      - <<: *defaults
+        name: task01
+`,
+			runs: []string{"run01"},
+			pos:  &Position{Line: 3, Column: 5},
+		},
+		{
+			name: "test multiple documents",
+			in: `runs:
+  - name: run01
+    tasks:
+      - name: task01
+        runtime:
+          containers:
+            - image: busybox:1.31
+docker_registries_auth:
+  index.docker.io:
+    username: user01
+---
+---
+runs:
+  - name: run02
+    tasks:
+      - name: task01
+        runtime:
+          arch: arm128
+          containers:
+            - image: busybox:1.31
+docker_registries_auth:
+  index.docker.io:
+    username: user02
+`,
+			runs:     []string{"run01", "run02"},
+			registry: "user02",
+			pos:      &Position{Line: 18, Column: 11},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseConfig([]byte(tt.in), ConfigFormatJSON)
+			if err == nil {
+				t.Fatalf("got nil error, want error")
+			}
+			runs := []string{}
+			for _, r := range c.Runs {
+				runs = append(runs, r.Name)
+			}
+			if diff := cmp.Diff(tt.runs, runs); diff != "" {
+				t.Error(diff)
+			}
+			if tt.registry != "" && c.DockerRegistriesAuth["index.docker.io"].Username.Value != tt.registry {
+				t.Errorf("got registry username %q, want %q", c.DockerRegistriesAuth["index.docker.io"].Username.Value, tt.registry)
+			}
+			var cerr *ConfigError
+			if !errors.As(err, &cerr) {
+				t.Fatalf("got error %v of type %T, want a ConfigError", err, err)
+			}
+			if diff := cmp.Diff(tt.pos, cerr.Position); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,393 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	errors "golang.org/x/xerrors"
+	yaml "gopkg.in/yaml.v3"
+)
+
+type LintSeverity string
+
+const (
+	LintSeverityError   LintSeverity = "error"
+	LintSeverityWarning LintSeverity = "warning"
+	LintSeverityInfo    LintSeverity = "info"
+)
+
+func IsValidLintSeverity(s LintSeverity) bool {
+	switch s {
+	case LintSeverityError, LintSeverityWarning, LintSeverityInfo:
+		return true
+	}
+	return false
+}
+
+const (
+	LintRuleUnusedTasks    = "unused-tasks"
+	LintRuleUnpinnedImages = "unpinned-images"
+	LintRuleMissingWhen    = "missing-when"
+	LintRuleBroadSecrets   = "broad-secrets"
+)
+
+// LintIssue is an issue reported by a lint rule. Position is the position of
+// the offending entry in the config file and is nil when unknown.
+type LintIssue struct {
+	Rule     string
+	Severity LintSeverity
+	Message  string
+	Position *Position
+
+	path []interface{}
+}
+
+// LintRule is a config lint rule. Lint returns the rule issues, their
+// severity will be set by the linter.
+type LintRule interface {
+	Name() string
+	DefaultSeverity() LintSeverity
+	Lint(c *Config) []*LintIssue
+}
+
+// LintRuleOverride overrides a rule default severity or disables it
+type LintRuleOverride struct {
+	Disabled bool
+	Severity LintSeverity
+}
+
+// Linter reports the issues of a valid config that aren't errors but usually
+// are unwanted
+type Linter struct {
+	rules     []LintRule
+	overrides map[string]LintRuleOverride
+}
+
+// NewLinter creates a linter with the builtin rules plus the provided custom
+// rules. The overrides are keyed by rule name.
+func NewLinter(customRules []LintRule, overrides map[string]LintRuleOverride) (*Linter, error) {
+	rules := append(DefaultLintRules(), customRules...)
+
+	names := map[string]struct{}{}
+	for _, r := range rules {
+		if _, ok := names[r.Name()]; ok {
+			return nil, errors.Errorf("duplicate lint rule %q", r.Name())
+		}
+		names[r.Name()] = struct{}{}
+	}
+	for name, o := range overrides {
+		if _, ok := names[name]; !ok {
+			return nil, errors.Errorf("unknown lint rule %q", name)
+		}
+		if o.Severity != "" && !IsValidLintSeverity(o.Severity) {
+			return nil, errors.Errorf("lint rule %q: invalid severity %q", name, o.Severity)
+		}
+	}
+
+	return &Linter{rules: rules, overrides: overrides}, nil
+}
+
+// DefaultLintRules returns the builtin lint rules
+func DefaultLintRules() []LintRule {
+	return []LintRule{
+		&unusedTasksRule{},
+		&unpinnedImagesRule{},
+		&missingWhenRule{},
+		&broadSecretsRule{},
+	}
+}
+
+// Lint runs the lint rules on the parsed config c. configData and format are
+// used to report the issues positions.
+func (l *Linter) Lint(c *Config, configData []byte, format ConfigFormat) []*LintIssue {
+	var root *yaml.Node
+	if format != ConfigFormatJsonnet {
+		root = parseNode(configData)
+	}
+
+	issues := []*LintIssue{}
+	for _, r := range l.rules {
+		o := l.overrides[r.Name()]
+		if o.Disabled {
+			continue
+		}
+		severity := r.DefaultSeverity()
+		if o.Severity != "" {
+			severity = o.Severity
+		}
+		for _, issue := range r.Lint(c) {
+			issue.Rule = r.Name()
+			issue.Severity = severity
+			issue.Position = nodePosition(root, issue.path)
+			issues = append(issues, issue)
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		pi, pj := issues[i].Position, issues[j].Position
+		if pi == nil || pj == nil {
+			return pi != nil
+		}
+		if pi.Line != pj.Line {
+			return pi.Line < pj.Line
+		}
+		return pi.Column < pj.Column
+	})
+
+	return issues
+}
+
+func lintIssue(message string, path ...interface{}) *LintIssue {
+	return &LintIssue{Message: message, path: path}
+}
+
+// unusedTasksRule reports the tasks without steps and the task outputs never
+// referenced by other tasks
+type unusedTasksRule struct{}
+
+func (r *unusedTasksRule) Name() string                  { return LintRuleUnusedTasks }
+func (r *unusedTasksRule) DefaultSeverity() LintSeverity { return LintSeverityWarning }
+
+func (r *unusedTasksRule) Lint(c *Config) []*LintIssue {
+	issues := []*LintIssue{}
+	for ri, run := range c.Runs {
+		refs := map[TaskOutputRef]struct{}{}
+		for _, task := range run.Tasks {
+			for _, v := range task.Environment {
+				if v.Type != ValueTypeString {
+					continue
+				}
+				for _, ref := range TaskOutputRefs(v.Value) {
+					refs[ref] = struct{}{}
+				}
+			}
+		}
+
+		for ti, task := range run.Tasks {
+			if len(task.Steps) == 0 && task.Uses == "" {
+				issues = append(issues, lintIssue(fmt.Sprintf("task %q doesn't define any step", task.Name), "runs", ri, "tasks", ti))
+			}
+			for oi, output := range task.Outputs {
+				if _, ok := refs[TaskOutputRef{TaskName: task.Name, Key: output}]; !ok {
+					issues = append(issues, lintIssue(fmt.Sprintf("task %q output %q is never referenced", task.Name, output), "runs", ri, "tasks", ti, "outputs", oi))
+				}
+			}
+		}
+	}
+	return issues
+}
+
+// unpinnedImagesRule reports the container images without a tag or using the
+// latest tag
+type unpinnedImagesRule struct{}
+
+func (r *unpinnedImagesRule) Name() string                  { return LintRuleUnpinnedImages }
+func (r *unpinnedImagesRule) DefaultSeverity() LintSeverity { return LintSeverityWarning }
+
+func (r *unpinnedImagesRule) Lint(c *Config) []*LintIssue {
+	issues := []*LintIssue{}
+	for ri, run := range c.Runs {
+		for ti, task := range run.Tasks {
+			if task.Runtime == nil {
+				continue
+			}
+			for ci, container := range task.Runtime.Containers {
+				if isPinnedImage(container.Image) {
+					continue
+				}
+				issues = append(issues, lintIssue(fmt.Sprintf("task %q: image %q isn't pinned to a tag or digest", task.Name, container.Image), "runs", ri, "tasks", ti, "runtime", "containers", ci, "image"))
+			}
+		}
+	}
+	return issues
+}
+
+func isPinnedImage(image string) bool {
+	if strings.Contains(image, "@") {
+		return true
+	}
+	// the tag is after the last colon not followed by a slash (the registry
+	// port)
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return false
+	}
+	return image[i+1:] != "latest"
+}
+
+// missingWhenRule reports the runs without when conditions that will be
+// created for every branch, tag and pull request
+type missingWhenRule struct{}
+
+func (r *missingWhenRule) Name() string                  { return LintRuleMissingWhen }
+func (r *missingWhenRule) DefaultSeverity() LintSeverity { return LintSeverityInfo }
+
+func (r *missingWhenRule) Lint(c *Config) []*LintIssue {
+	issues := []*LintIssue{}
+	for ri, run := range c.Runs {
+		if run.When == nil {
+			issues = append(issues, lintIssue(fmt.Sprintf("run %q doesn't define when conditions and will be executed for every branch, tag and pull request", run.Name), "runs", ri))
+		}
+	}
+	return issues
+}
+
+// broadSecretsRule reports the variables exposed to a wider scope than
+// needed: task environment variables available to all the task run steps and
+// global docker registries auth used by all the runs
+type broadSecretsRule struct{}
+
+func (r *broadSecretsRule) Name() string                  { return LintRuleBroadSecrets }
+func (r *broadSecretsRule) DefaultSeverity() LintSeverity { return LintSeverityWarning }
+
+func (r *broadSecretsRule) Lint(c *Config) []*LintIssue {
+	issues := []*LintIssue{}
+
+	if len(c.Runs) > 1 {
+		for _, registry := range sortedRegistries(c.DockerRegistriesAuth) {
+			auth := c.DockerRegistriesAuth[registry]
+			if auth.Username.Type == ValueTypeFromVariable || auth.Password.Type == ValueTypeFromVariable {
+				issues = append(issues, lintIssue(fmt.Sprintf("docker registry %q auth variables are available to all the runs, consider defining them in the runs using them", registry), "docker_registries_auth", registry))
+			}
+		}
+	}
+
+	for ri, run := range c.Runs {
+		for ti, task := range run.Tasks {
+			runSteps := 0
+			for _, s := range task.Steps {
+				if _, ok := s.(*RunStep); ok {
+					runSteps++
+				}
+			}
+			if runSteps < 2 {
+				continue
+			}
+			for _, name := range sortedValues(task.Environment) {
+				if task.Environment[name].Type != ValueTypeFromVariable {
+					continue
+				}
+				issues = append(issues, lintIssue(fmt.Sprintf("task %q: environment variable %q from variable %q is available to all the task steps, consider defining it in the steps using it", task.Name, name, task.Environment[name].Value), "runs", ri, "tasks", ti, "environment", name))
+			}
+		}
+	}
+	return issues
+}
+
+func sortedRegistries(m map[string]*DockerRegistryAuth) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedValues(m map[string]Value) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type LintField string
+
+const (
+	LintFieldImage   LintField = "image"
+	LintFieldCommand LintField = "command"
+)
+
+// RegexpLintRule is a custom lint rule reporting the config fields (container
+// images or run step commands) matching a regular expression
+type RegexpLintRule struct {
+	name     string
+	message  string
+	severity LintSeverity
+	field    LintField
+	re       *regexp.Regexp
+}
+
+func NewRegexpLintRule(name, message string, severity LintSeverity, field LintField, expr string) (*RegexpLintRule, error) {
+	if name == "" {
+		return nil, errors.Errorf("empty lint rule name")
+	}
+	if severity == "" {
+		severity = LintSeverityWarning
+	}
+	if !IsValidLintSeverity(severity) {
+		return nil, errors.Errorf("lint rule %q: invalid severity %q", name, severity)
+	}
+	switch field {
+	case LintFieldImage, LintFieldCommand:
+	default:
+		return nil, errors.Errorf("lint rule %q: invalid field %q", name, field)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, errors.Errorf("lint rule %q: wrong regular expression: %w", name, err)
+	}
+	return &RegexpLintRule{name: name, message: message, severity: severity, field: field, re: re}, nil
+}
+
+func (r *RegexpLintRule) Name() string                  { return r.name }
+func (r *RegexpLintRule) DefaultSeverity() LintSeverity { return r.severity }
+
+func (r *RegexpLintRule) Lint(c *Config) []*LintIssue {
+	issues := []*LintIssue{}
+	for ri, run := range c.Runs {
+		for ti, task := range run.Tasks {
+			switch r.field {
+			case LintFieldImage:
+				if task.Runtime == nil {
+					continue
+				}
+				for ci, container := range task.Runtime.Containers {
+					if r.re.MatchString(container.Image) {
+						issues = append(issues, lintIssue(r.issueMessage(task, container.Image), "runs", ri, "tasks", ti, "runtime", "containers", ci, "image"))
+					}
+				}
+			case LintFieldCommand:
+				for si, s := range task.Steps {
+					switch step := s.(type) {
+					case *RunStep:
+						if r.re.MatchString(step.Command) {
+							issues = append(issues, lintIssue(r.issueMessage(task, step.Command), "runs", ri, "tasks", ti, "steps", si))
+						}
+					case *ParallelStep:
+						for ssi, ss := range step.Steps {
+							if rs, ok := ss.(*RunStep); ok && r.re.MatchString(rs.Command) {
+								issues = append(issues, lintIssue(r.issueMessage(task, rs.Command), "runs", ri, "tasks", ti, "steps", si, "steps", ssi))
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return issues
+}
+
+func (r *RegexpLintRule) issueMessage(task *Task, value string) string {
+	if r.message != "" {
+		return fmt.Sprintf("task %q: %s", task.Name, r.message)
+	}
+	return fmt.Sprintf("task %q: %s %q matches %q", task.Name, r.field, value, r.re.String())
+}
@@ -0,0 +1,120 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestLint(t *testing.T) {
+	imageRule, err := NewRegexpLintRule("no-dockerhub-library", "use the internal registry mirror", LintSeverityError, LintFieldImage, `^(docker\.io/)?library/`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		in          string
+		customRules []LintRule
+		overrides   map[string]LintRuleOverride
+		issues      []*LintIssue
+	}{
+		{
+			name: "test no issues",
+			in: `runs:
+  - name: run01
+    when:
+      branch: master
+    tasks:
+      - name: task01
+        runtime:
+          containers:
+            - image: busybox:1.31
+        steps:
+          - run: ls
+`,
+			issues: []*LintIssue{},
+		},
+		{
+			name: "test builtin rules",
+			in: `runs:
+  - name: run01
+    tasks:
+      - name: task01
+        runtime:
+          containers:
+            - image: busybox
+            - image: registry:5000/postgres:latest
+        environment:
+          TOKEN:
+            from_variable: token
+        steps:
+          - run: ls
+          - run: make
+        outputs:
+          - OUT01
+`,
+			issues: []*LintIssue{
+				{Rule: LintRuleMissingWhen, Severity: LintSeverityInfo, Position: &Position{Line: 2, Column: 5}},
+				{Rule: LintRuleUnpinnedImages, Severity: LintSeverityWarning, Position: &Position{Line: 7, Column: 15}},
+				{Rule: LintRuleUnpinnedImages, Severity: LintSeverityWarning, Position: &Position{Line: 8, Column: 15}},
+				{Rule: LintRuleBroadSecrets, Severity: LintSeverityWarning, Position: &Position{Line: 10, Column: 11}},
+				{Rule: LintRuleUnusedTasks, Severity: LintSeverityWarning, Position: &Position{Line: 16, Column: 13}},
+			},
+		},
+		{
+			name: "test overrides and custom rules",
+			in: `runs:
+  - name: run01
+    tasks:
+      - name: task01
+        runtime:
+          containers:
+            - image: library/busybox
+        steps:
+          - run: ls
+`,
+			customRules: []LintRule{imageRule},
+			overrides: map[string]LintRuleOverride{
+				LintRuleMissingWhen:    {Disabled: true},
+				LintRuleUnpinnedImages: {Severity: LintSeverityError},
+			},
+			issues: []*LintIssue{
+				{Rule: LintRuleUnpinnedImages, Severity: LintSeverityError, Position: &Position{Line: 7, Column: 15}},
+				{Rule: "no-dockerhub-library", Severity: LintSeverityError, Position: &Position{Line: 7, Column: 15}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseConfig([]byte(tt.in), ConfigFormatJSON)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			l, err := NewLinter(tt.customRules, tt.overrides)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			issues := l.Lint(c, []byte(tt.in), ConfigFormatJSON)
+			if diff := cmp.Diff(tt.issues, issues, cmpopts.IgnoreUnexported(LintIssue{}), cmpopts.IgnoreFields(LintIssue{}, "Message")); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"regexp"
+
+	"github.com/ghodss/yaml"
+	"github.com/mitchellh/copystructure"
+	errors "golang.org/x/xerrors"
+)
+
+// policyRunName is the name of the fake run used to check the policy tasks
+const policyRunName = "policy"
+
+// Policy is an instance wide run config policy applied to all the runs. The
+// defaults are used when not defined by the run config while the tasks and
+// the forbidden values are enforced.
+type Policy struct {
+	Defaults PolicyDefaults `json:"defaults"`
+
+	// Tasks are added to every run. A run defining a task with the same name
+	// is rejected.
+	Tasks []*Task `json:"tasks"`
+
+	ForbidPrivilegedContainers bool `json:"forbid_privileged_containers"`
+	// ForbiddenImages are regular expressions matching the forbidden
+	// container images
+	ForbiddenImages []string `json:"forbidden_images"`
+
+	// AllowHostNetwork allows the tasks to use the host network
+	AllowHostNetwork bool `json:"allow_host_network"`
+
+	forbiddenImages []*regexp.Regexp
+}
+
+type PolicyDefaults struct {
+	DockerRegistriesAuth map[string]*DockerRegistryAuth `json:"docker_registries_auth"`
+	Environment          map[string]Value               `json:"environment"`
+	Shell                string                         `json:"shell"`
+	User                 string                         `json:"user"`
+}
+
+func ParsePolicy(data []byte) (*Policy, error) {
+	var p Policy
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, errors.Errorf("failed to unmarshal policy: %w", err)
+	}
+
+	for _, expr := range p.ForbiddenImages {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, errors.Errorf("wrong forbidden image regular expression %q: %w", expr, err)
+		}
+		p.forbiddenImages = append(p.forbiddenImages, re)
+	}
+
+	for _, registryAuth := range p.Defaults.DockerRegistriesAuth {
+		if registryAuth.Type == "" {
+			registryAuth.Type = DockerRegistryAuthTypeBasic
+		}
+	}
+
+	if len(p.Tasks) > 0 {
+		// check the tasks (and set their defaults) like the tasks of a run
+		for _, task := range p.Tasks {
+			if task != nil && task.Uses != "" {
+				return nil, errors.Errorf("policy task %q cannot use a remote task", task.Name)
+			}
+		}
+		c := &Config{Runs: []*Run{{Name: policyRunName, Tasks: p.Tasks}}}
+		if err := checkConfig(c); err != nil {
+			return nil, errors.Errorf("policy tasks error: %w", err)
+		}
+		if err := p.checkTasks(policyRunName, p.Tasks); err != nil {
+			return nil, err
+		}
+	}
+
+	return &p, nil
+}
+
+// Apply applies the policy to a checked config with expanded remote tasks.
+// The config is checked again after applying the policy.
+func (p *Policy) Apply(c *Config) error {
+	for name, auth := range p.Defaults.DockerRegistriesAuth {
+		if _, ok := c.DockerRegistriesAuth[name]; ok {
+			continue
+		}
+		if c.DockerRegistriesAuth == nil {
+			c.DockerRegistriesAuth = map[string]*DockerRegistryAuth{}
+		}
+		c.DockerRegistriesAuth[name] = auth
+	}
+
+	for _, run := range c.Runs {
+		for _, task := range run.Tasks {
+			for k, v := range p.Defaults.Environment {
+				if _, ok := task.Environment[k]; ok {
+					continue
+				}
+				if task.Environment == nil {
+					task.Environment = map[string]Value{}
+				}
+				task.Environment[k] = v
+			}
+			if task.Shell == "" {
+				task.Shell = p.Defaults.Shell
+			}
+			if task.User == "" {
+				task.User = p.Defaults.User
+			}
+		}
+
+		policyTasks := make([]*Task, 0, len(p.Tasks))
+		for _, pt := range p.Tasks {
+			for _, task := range run.Tasks {
+				if task.Name == pt.Name {
+					return errors.Errorf("run %q: task %q conflicts with the instance policy task with the same name", run.Name, task.Name)
+				}
+			}
+			t, err := copystructure.Copy(pt)
+			if err != nil {
+				return err
+			}
+			policyTasks = append(policyTasks, t.(*Task))
+		}
+		run.Tasks = append(policyTasks, run.Tasks...)
+
+		if err := p.checkTasks(run.Name, run.Tasks); err != nil {
+			return err
+		}
+	}
+
+	return checkConfig(c)
+}
+
+// checkTasks checks that the tasks don't use values forbidden by the policy
+func (p *Policy) checkTasks(runName string, tasks []*Task) error {
+	for _, task := range tasks {
+		if task.Runtime == nil {
+			continue
+		}
+		if task.Runtime.HostNetwork && !p.AllowHostNetwork {
+			return errors.Errorf("run %q: task %q: host network is forbidden by the instance policy", runName, task.Name)
+		}
+		for _, container := range task.Runtime.Containers {
+			if p.ForbidPrivilegedContainers && container.Privileged {
+				return errors.Errorf("run %q: task %q: privileged containers are forbidden by the instance policy", runName, task.Name)
+			}
+			for _, re := range p.forbiddenImages {
+				if re.MatchString(container.Image) {
+					return errors.Errorf("run %q: task %q: image %q is forbidden by the instance policy", runName, task.Name, container.Image)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestApplyPolicy(t *testing.T) {
+	policy := `
+defaults:
+  environment:
+    ENV01: default
+    ENV02: default
+  shell: /bin/bash
+forbid_privileged_containers: true
+forbidden_images:
+  - ^docker:.*-dind$
+tasks:
+  - name: security-scan
+    runtime:
+      containers:
+        - image: scanner:1.0
+    steps:
+      - run: scan
+`
+
+	tests := []struct {
+		name  string
+		in    string
+		tasks []string
+		env   map[string]Value
+		shell string
+		err   error
+	}{
+		{
+			name: "test policy applied",
+			in: `
+runs:
+  - name: run01
+    tasks:
+      - name: build
+        runtime:
+          containers:
+            - image: golang:1.12
+        environment:
+          ENV01: value01
+        steps:
+          - run: go build
+`,
+			tasks: []string{"security-scan", "build"},
+			env: map[string]Value{
+				"ENV01": {Type: ValueTypeString, Value: "value01"},
+				"ENV02": {Type: ValueTypeString, Value: "default"},
+			},
+			shell: "/bin/bash",
+		},
+		{
+			name: "test task conflicting with policy task",
+			in: `
+runs:
+  - name: run01
+    tasks:
+      - name: security-scan
+        runtime:
+          containers:
+            - image: golang:1.12
+        steps:
+          - run: echo skipped
+`,
+			err: fmt.Errorf(`run "run01": task "security-scan" conflicts with the instance policy task with the same name`),
+		},
+		{
+			name: "test privileged container",
+			in: `
+runs:
+  - name: run01
+    tasks:
+      - name: build
+        runtime:
+          containers:
+            - image: golang:1.12
+              privileged: true
+        steps:
+          - run: go build
+`,
+			err: fmt.Errorf(`run "run01": task "build": privileged containers are forbidden by the instance policy`),
+		},
+		{
+			name: "test forbidden image",
+			in: `
+runs:
+  - name: run01
+    tasks:
+      - name: build
+        runtime:
+          containers:
+            - image: docker:18-dind
+        steps:
+          - run: docker build .
+`,
+			err: fmt.Errorf(`run "run01": task "build": image "docker:18-dind" is forbidden by the instance policy`),
+		},
+		{
+			name: "test host network",
+			in: `
+runs:
+  - name: run01
+    tasks:
+      - name: build
+        runtime:
+          containers:
+            - image: golang:1.12
+          host_network: true
+        steps:
+          - run: go build
+`,
+			err: fmt.Errorf(`run "run01": task "build": host network is forbidden by the instance policy`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParsePolicy([]byte(policy))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			c, err := ParseConfig([]byte(tt.in), ConfigFormatJSON)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			err = p.Apply(c)
+			if tt.err != nil {
+				if err == nil {
+					t.Fatalf("got nil error, want error: %v", tt.err)
+				}
+				if err.Error() != tt.err.Error() {
+					t.Fatalf("got error: %v, want error: %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			tasks := []string{}
+			for _, task := range c.Runs[0].Tasks {
+				tasks = append(tasks, task.Name)
+			}
+			if diff := cmp.Diff(tt.tasks, tasks); diff != "" {
+				t.Error(diff)
+			}
+			build := c.Run("run01").Task("build")
+			if diff := cmp.Diff(tt.env, build.Environment); diff != "" {
+				t.Error(diff)
+			}
+			if build.Shell != tt.shell {
+				t.Errorf("got shell %q, want %q", build.Shell, tt.shell)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+var yamlErrorLineRegexp = regexp.MustCompile(`yaml: line (\d+):`)
+
+// Position is a position (1-based line and column) in the config file
+type Position struct {
+	Line   int
+	Column int
+}
+
+// ConfigError is a config parsing or validation error. Position is the
+// position of the offending entry in the config file and is nil when unknown.
+type ConfigError struct {
+	Err      error
+	Position *Position
+
+	// path is the path of the offending entry as a list of map keys and
+	// sequence indexes
+	path []interface{}
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+func pathError(err error, path ...interface{}) error {
+	return &ConfigError{Err: err, path: path}
+}
+
+// yamlErrorPosition returns the position reported by a yaml syntax error
+func yamlErrorPosition(err error) *Position {
+	m := yamlErrorLineRegexp.FindStringSubmatch(err.Error())
+	if m == nil {
+		return nil
+	}
+	line, err := strconv.Atoi(m[1])
+	if err != nil {
+		return nil
+	}
+	return &Position{Line: line, Column: 1}
+}
+
+// findPosition returns the position of the entry at path in the yaml (or json)
+// config data. If the path cannot be fully resolved the position of the
+// nearest parent entry is returned.
+func findPosition(configData []byte, path []interface{}) *Position {
+	return nodePosition(parseNode(configData), path)
+}
+
+// parseNode returns the root node of the yaml (or json) config data, nil if
+// it cannot be parsed. Like in unmarshalConfig, multiple documents are merged
+// in a single root node whose entries keep their positions.
+func parseNode(configData []byte) *yaml.Node {
+	runs := &yaml.Node{Kind: yaml.SequenceNode}
+	registriesAuth := &yaml.Node{Kind: yaml.MappingNode}
+
+	d := yaml.NewDecoder(bytes.NewReader(configData))
+	for {
+		var doc yaml.Node
+		if err := d.Decode(&doc); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		root := resolveAlias(doc.Content[0])
+		if _, n := childNode(root, "runs"); n != nil && n.Kind == yaml.SequenceNode {
+			runs.Content = append(runs.Content, n.Content...)
+		}
+		if _, n := childNode(root, "docker_registries_auth"); n != nil && n.Kind == yaml.MappingNode {
+			registriesAuth.Content = append(registriesAuth.Content, n.Content...)
+		}
+	}
+
+	return &yaml.Node{
+		Kind: yaml.MappingNode,
+		Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: "runs"}, runs,
+			{Kind: yaml.ScalarNode, Value: "docker_registries_auth"}, registriesAuth,
+		},
+	}
+}
+
+func nodePosition(n *yaml.Node, path []interface{}) *Position {
+	if n == nil {
+		return nil
+	}
+	// for map entries the key position is reported since the value could be
+	// on a following line
+	pn := n
+	for _, p := range path {
+		key, value := childNode(n, p)
+		if value == nil {
+			break
+		}
+		n = value
+		pn = value
+		if key != nil && key.Line > 0 {
+			pn = key
+		}
+	}
+	// the merged root entries don't have a position
+	if pn.Line == 0 {
+		return nil
+	}
+
+	return &Position{Line: pn.Line, Column: pn.Column}
+}
+
+// childNode returns the map entry key and value nodes for a string path
+// element or the sequence entry node for an int path element. Aliases and
+// merge keys are resolved.
+func childNode(n *yaml.Node, p interface{}) (*yaml.Node, *yaml.Node) {
+	n = resolveAlias(n)
+	switch p := p.(type) {
+	case string:
+		if n.Kind != yaml.MappingNode {
+			return nil, nil
+		}
+		// the last entry wins like when unmarshaling
+		for i := len(n.Content) - 2; i >= 0; i -= 2 {
+			if n.Content[i].Value == p && n.Content[i].Tag != mergeTag {
+				return n.Content[i], resolveAlias(n.Content[i+1])
+			}
+		}
+		// look in the merged maps
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Tag != mergeTag {
+				continue
+			}
+			merged := resolveAlias(n.Content[i+1])
+			sources := []*yaml.Node{merged}
+			if merged.Kind == yaml.SequenceNode {
+				sources = merged.Content
+			}
+			for _, source := range sources {
+				if key, value := childNode(source, p); value != nil {
+					return key, value
+				}
+			}
+		}
+	case int:
+		if n.Kind != yaml.SequenceNode || p < 0 || p >= len(n.Content) {
+			return nil, nil
+		}
+		return nil, resolveAlias(n.Content[p])
+	}
+	return nil, nil
+}
+
+const mergeTag = "!!merge"
+
+func resolveAlias(n *yaml.Node) *yaml.Node {
+	for n.Kind == yaml.AliasNode && n.Alias != nil {
+		n = n.Alias
+	}
+	return n
+}
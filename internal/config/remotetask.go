@@ -0,0 +1,294 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/mitchellh/copystructure"
+	errors "golang.org/x/xerrors"
+)
+
+// TaskDefinitionFile is the remote task definition file name inside the
+// remote task path
+const TaskDefinitionFile = "task.yml"
+
+var taskParamNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// taskParamRefRegexp matches the ${params.NAME} references and the "$$"
+// escapes that must be kept as is
+var taskParamRefRegexp = regexp.MustCompile(`\$\$|\$\{params\.([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// TaskUses is a reference to a remote task definition in the
+// OWNER/REPO/PATH@REF format. PATH is the directory, inside the repository,
+// containing the task definition file.
+type TaskUses struct {
+	RepoPath string
+	Path     string
+	Ref      string
+}
+
+func ParseTaskUses(s string) (*TaskUses, error) {
+	i := strings.LastIndex(s, "@")
+	if i < 0 || i == len(s)-1 {
+		return nil, errors.Errorf("remote task %q must be pinned to a ref using the @REF suffix", s)
+	}
+	ref := s[i+1:]
+	parts := strings.Split(s[:i], "/")
+	if len(parts) < 3 {
+		return nil, errors.Errorf("remote task %q must be in the OWNER/REPO/PATH@REF format", s)
+	}
+	for _, p := range parts {
+		if p == "" || p == "." || p == ".." {
+			return nil, errors.Errorf("remote task %q must be in the OWNER/REPO/PATH@REF format", s)
+		}
+	}
+
+	return &TaskUses{
+		RepoPath: path.Join(parts[0], parts[1]),
+		Path:     path.Join(parts[2:]...),
+		Ref:      ref,
+	}, nil
+}
+
+// CheckRemoteTasksRepos checks that all the remote tasks used by the config
+// are defined in one of the allowed repositories
+func CheckRemoteTasksRepos(c *Config, allowedRepos []string) error {
+	allowed := map[string]struct{}{}
+	for _, repoPath := range allowedRepos {
+		allowed[repoPath] = struct{}{}
+	}
+	for _, uses := range c.RemoteTasks() {
+		u, err := ParseTaskUses(uses)
+		if err != nil {
+			return err
+		}
+		if _, ok := allowed[u.RepoPath]; !ok {
+			return errors.Errorf("remote task %q repository %q isn't allowed, only the project repository and the project remote tasks repositories can be used", uses, u.RepoPath)
+		}
+	}
+	return nil
+}
+
+// DefinitionPath returns the path of the task definition file in the
+// repository
+func (u *TaskUses) DefinitionPath() string {
+	return path.Join(u.Path, TaskDefinitionFile)
+}
+
+// TaskDefinition is a remote task definition. Its task values can reference
+// the params using the ${params.NAME} syntax.
+type TaskDefinition struct {
+	Params map[string]*TaskDefinitionParam `json:"params"`
+	Task   *Task                           `json:"task"`
+}
+
+type TaskDefinitionParam struct {
+	Description string `json:"description"`
+	// Default is the param default value. A param without a default is
+	// required.
+	Default *string `json:"default"`
+}
+
+func ParseTaskDefinition(data []byte) (*TaskDefinition, error) {
+	var def TaskDefinition
+	if err := yaml.Unmarshal(data, &def); err != nil {
+		return nil, errors.Errorf("failed to unmarshal task definition: %w", err)
+	}
+	if def.Task == nil {
+		return nil, errors.Errorf("task definition doesn't define a task")
+	}
+	if def.Task.Uses != "" {
+		return nil, errors.Errorf("task definition cannot use another remote task")
+	}
+	if len(def.Task.Steps) == 0 {
+		return nil, errors.Errorf("task definition doesn't define any step")
+	}
+	for name := range def.Params {
+		if !taskParamNameRegexp.MatchString(name) {
+			return nil, errors.Errorf("invalid param name %q", name)
+		}
+	}
+
+	return &def, nil
+}
+
+// RemoteTasks returns the remote tasks used by the config tasks
+func (c *Config) RemoteTasks() []string {
+	seen := map[string]struct{}{}
+	uses := []string{}
+	for _, run := range c.Runs {
+		for _, task := range run.Tasks {
+			if task.Uses == "" {
+				continue
+			}
+			if _, ok := seen[task.Uses]; ok {
+				continue
+			}
+			seen[task.Uses] = struct{}{}
+			uses = append(uses, task.Uses)
+		}
+	}
+	sort.Strings(uses)
+	return uses
+}
+
+// ExpandRemoteTasks replaces the tasks using a remote task with the
+// parameterized remote task definition. defs are keyed by the task uses value.
+// The task values defined in the config take precedence over the remote task
+// ones and the environments are merged. The expanded config is then checked.
+func ExpandRemoteTasks(c *Config, defs map[string]*TaskDefinition) error {
+	for _, run := range c.Runs {
+		for _, task := range run.Tasks {
+			if task.Uses == "" {
+				continue
+			}
+			def, ok := defs[task.Uses]
+			if !ok {
+				return errors.Errorf("task %q: missing remote task %q definition", task.Name, task.Uses)
+			}
+			if err := expandRemoteTask(task, def); err != nil {
+				return errors.Errorf("task %q: remote task %q: %w", task.Name, task.Uses, err)
+			}
+		}
+	}
+
+	return checkConfig(c)
+}
+
+func expandRemoteTask(task *Task, def *TaskDefinition) error {
+	params := map[string]string{}
+	for name, p := range def.Params {
+		if p != nil && p.Default != nil {
+			params[name] = *p.Default
+		}
+	}
+	for name, value := range task.With {
+		if _, ok := def.Params[name]; !ok {
+			return errors.Errorf("unknown param %q", name)
+		}
+		params[name] = value
+	}
+	for name := range def.Params {
+		if _, ok := params[name]; !ok {
+			return errors.Errorf("missing required param %q", name)
+		}
+	}
+
+	// work on a copy of the definition task since it could be used by
+	// multiple tasks
+	dti, err := copystructure.Copy(def.Task)
+	if err != nil {
+		return err
+	}
+	dt := dti.(*Task)
+	if err := replaceParams(reflect.ValueOf(dt), params); err != nil {
+		return err
+	}
+
+	if task.Runtime == nil {
+		task.Runtime = dt.Runtime
+	}
+	env := map[string]Value{}
+	for k, v := range dt.Environment {
+		env[k] = v
+	}
+	for k, v := range task.Environment {
+		env[k] = v
+	}
+	task.Environment = env
+	if task.WorkingDir == "" {
+		task.WorkingDir = dt.WorkingDir
+	}
+	if task.Shell == "" {
+		task.Shell = dt.Shell
+	}
+	if task.User == "" {
+		task.User = dt.User
+	}
+	if task.Retries == nil {
+		task.Retries = dt.Retries
+	}
+	if len(task.Outputs) == 0 {
+		task.Outputs = dt.Outputs
+	}
+	task.Steps = dt.Steps
+
+	task.Uses = ""
+	task.With = nil
+
+	return nil
+}
+
+// replaceParams replaces the ${params.NAME} references in all the strings
+// contained in v
+func replaceParams(v reflect.Value, params map[string]string) error {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			return replaceParams(v.Elem(), params)
+		}
+	case reflect.String:
+		var err error
+		s := taskParamRefRegexp.ReplaceAllStringFunc(v.String(), func(m string) string {
+			if m == "$$" {
+				return m
+			}
+			name := taskParamRefRegexp.FindStringSubmatch(m)[1]
+			value, ok := params[name]
+			if !ok {
+				err = errors.Errorf("undefined param %q", name)
+			}
+			return value
+		})
+		if err != nil {
+			return err
+		}
+		if v.CanSet() {
+			v.SetString(s)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath != "" {
+				continue
+			}
+			if err := replaceParams(v.Field(i), params); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		// map values aren't addressable so replace them with an updated copy
+		for _, k := range v.MapKeys() {
+			mv := reflect.New(v.Type().Elem()).Elem()
+			mv.Set(v.MapIndex(k))
+			if err := replaceParams(mv, params); err != nil {
+				return err
+			}
+			v.SetMapIndex(k, mv)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := replaceParams(v.Index(i), params); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseTaskUses(t *testing.T) {
+	tests := []struct {
+		in  string
+		out *TaskUses
+		err bool
+	}{
+		{
+			in:  "org01/agola-tasks/golang-build@v1",
+			out: &TaskUses{RepoPath: "org01/agola-tasks", Path: "golang-build", Ref: "v1"},
+		},
+		{
+			in:  "org01/agola-tasks/go/build@refs/heads/master",
+			out: &TaskUses{RepoPath: "org01/agola-tasks", Path: "go/build", Ref: "refs/heads/master"},
+		},
+		{
+			in:  "org01/agola-tasks/golang-build",
+			err: true,
+		},
+		{
+			in:  "org01/agola-tasks@v1",
+			err: true,
+		},
+		{
+			in:  "org01/agola-tasks/../build@v1",
+			err: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			out, err := ParseTaskUses(tt.in)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("got nil error, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestExpandRemoteTasks(t *testing.T) {
+	def := `
+params:
+  go_version:
+    default: "1.12"
+  target:
+task:
+  runtime:
+    containers:
+      - image: golang:${params.go_version}
+  environment:
+    GOFLAGS: -mod=vendor
+    TARGET: ${params.target}
+  steps:
+    - clone:
+    - run: go build -o $${OUT} ./${params.target}
+`
+
+	tests := []struct {
+		name string
+		in   string
+		out  *Task
+		err  error
+	}{
+		{
+			name: "test expand remote task",
+			in: `
+runs:
+  - name: run01
+    tasks:
+      - name: build
+        uses: org01/agola-tasks/golang-build@v1
+        with:
+          target: cmd/agola
+        environment:
+          GOFLAGS: -mod=mod
+`,
+			out: &Task{
+				Name: "build",
+				Runtime: &Runtime{
+					Type:       RuntimeTypePod,
+					Containers: []*Container{{Image: "golang:1.12"}},
+				},
+				Environment: map[string]Value{
+					"GOFLAGS": {Type: ValueTypeString, Value: "-mod=mod"},
+					"TARGET":  {Type: ValueTypeString, Value: "cmd/agola"},
+				},
+				WorkingDir: defaultWorkingDir,
+				Steps: Steps{
+					&CloneStep{BaseStep: BaseStep{Type: "clone"}},
+					&RunStep{BaseStep: BaseStep{Type: "run", Name: "go build -o $${OUT} ./cmd/agola"}, Command: "go build -o $${OUT} ./cmd/agola"},
+				},
+			},
+		},
+		{
+			name: "test missing required param",
+			in: `
+runs:
+  - name: run01
+    tasks:
+      - name: build
+        uses: org01/agola-tasks/golang-build@v1
+`,
+			err: fmt.Errorf(`task "build": remote task "org01/agola-tasks/golang-build@v1": missing required param "target"`),
+		},
+		{
+			name: "test unknown param",
+			in: `
+runs:
+  - name: run01
+    tasks:
+      - name: build
+        uses: org01/agola-tasks/golang-build@v1
+        with:
+          target: cmd/agola
+          arch: arm64
+`,
+			err: fmt.Errorf(`task "build": remote task "org01/agola-tasks/golang-build@v1": unknown param "arch"`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseConfig([]byte(tt.in), ConfigFormatJSON)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			d, err := ParseTaskDefinition([]byte(def))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			err = ExpandRemoteTasks(c, map[string]*TaskDefinition{"org01/agola-tasks/golang-build@v1": d})
+			if tt.err != nil {
+				if err == nil {
+					t.Fatalf("got nil error, want error: %v", tt.err)
+				}
+				if err.Error() != tt.err.Error() {
+					t.Fatalf("got error: %v, want error: %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tt.out, c.Runs[0].Tasks[0]); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestCheckRemoteTasksRepos(t *testing.T) {
+	in := `
+runs:
+  - name: run01
+    tasks:
+      - name: build
+        uses: org01/agola-tasks/golang-build@v1
+        with:
+          target: cmd/agola
+`
+
+	tests := []struct {
+		name         string
+		allowedRepos []string
+		err          error
+	}{
+		{
+			name:         "test allowed repository",
+			allowedRepos: []string{"org01/project01", "org01/agola-tasks"},
+		},
+		{
+			name:         "test another repository",
+			allowedRepos: []string{"org01/project01"},
+			err:          fmt.Errorf(`remote task "org01/agola-tasks/golang-build@v1" repository "org01/agola-tasks" isn't allowed, only the project repository and the project remote tasks repositories can be used`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseConfig([]byte(in), ConfigFormatJSON)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			err = CheckRemoteTasksRepos(c, tt.allowedRepos)
+			if tt.err != nil {
+				if err == nil {
+					t.Fatalf("got nil error, want error: %v", tt.err)
+				}
+				if err.Error() != tt.err.Error() {
+					t.Fatalf("got error: %v, want error: %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
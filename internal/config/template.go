@@ -0,0 +1,188 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"sort"
+
+	"agola.io/agola/internal/expr"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+// Variables available in the config template expressions ({{ EXPRESSION }})
+// used in the when conditions, the environment values and the containers
+// images. They're evaluated when generating the run config.
+const (
+	ExprVariableRunName       = "run_name"
+	ExprVariableRefType       = "ref_type"
+	ExprVariableBranch        = "branch"
+	ExprVariableTag           = "tag"
+	ExprVariableRef           = "ref"
+	ExprVariableCommitSHA     = "commit_sha"
+	ExprVariablePullRequestID = "pull_request_id"
+	// ExprVariableArch is the task runtime arch. It's empty in the run when
+	// conditions.
+	ExprVariableArch = "arch"
+	// ExprVariableTaskStatus is the status of the previous steps of the task
+	// (TaskStatusSuccess or TaskStatusFailed). It's available only in the steps
+	// when expressions that are evaluated by the executor.
+	ExprVariableTaskStatus = "task_status"
+)
+
+const (
+	TaskStatusSuccess = "success"
+	TaskStatusFailed  = "failed"
+)
+
+var exprVariables = map[string]struct{}{
+	ExprVariableRunName:       {},
+	ExprVariableRefType:       {},
+	ExprVariableBranch:        {},
+	ExprVariableTag:           {},
+	ExprVariableRef:           {},
+	ExprVariableCommitSHA:     {},
+	ExprVariablePullRequestID: {},
+	ExprVariableArch:          {},
+}
+
+// checkTemplate parses the template s and checks that it references only the
+// available variables and the provided extra variables
+func checkTemplate(s string, extraVariables ...string) error {
+	if !expr.HasTemplate(s) {
+		return nil
+	}
+	t, err := expr.Parse(s)
+	if err != nil {
+		return err
+	}
+	for _, name := range t.Variables() {
+		if _, ok := exprVariables[name]; ok {
+			continue
+		}
+		if !util.StringInSlice(extraVariables, name) {
+			return errors.Errorf("template %q: undefined variable %q", s, name)
+		}
+	}
+	return nil
+}
+
+func checkWhenTemplate(w *When, extraVariables ...string) error {
+	if w == nil || w.Expr == "" {
+		return nil
+	}
+	if !expr.HasTemplate(w.Expr) {
+		return errors.Errorf("when expression %q must be in the {{ EXPRESSION }} format", w.Expr)
+	}
+	return checkTemplate(w.Expr, extraVariables...)
+}
+
+// checkStepWhen checks a step when. The steps are evaluated by the executor
+// so only the expression form is supported.
+func checkStepWhen(w *When) error {
+	if w == nil {
+		return nil
+	}
+	if w.Branch != nil || w.Tag != nil || w.Ref != nil || w.PullRequest != nil {
+		return errors.Errorf("only the when expression is supported")
+	}
+	return checkWhenTemplate(w, ExprVariableTaskStatus)
+}
+
+func checkEnvironmentTemplates(env map[string]Value, path ...interface{}) error {
+	// sort the names to always report the same error
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		v := env[name]
+		if v.Type != ValueTypeString {
+			continue
+		}
+		if err := checkTemplate(v.Value); err != nil {
+			return pathError(errors.Errorf("environment variable %q: %w", name, err), append(path, name)...)
+		}
+	}
+	return nil
+}
+
+func checkStepsTemplates(steps Steps, path ...interface{}) error {
+	for si, step := range steps {
+		switch s := step.(type) {
+		case *RunStep:
+			if err := checkEnvironmentTemplates(s.Environment, append(path, si, "environment")...); err != nil {
+				return err
+			}
+		case *ParallelStep:
+			if err := checkStepsTemplates(s.Steps, append(path, si, "steps")...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkTemplates checks the templates in the when conditions, the environment
+// values and the containers images
+func checkTemplates(config *Config) error {
+	for ri, run := range config.Runs {
+		if err := checkWhenTemplate(run.When); err != nil {
+			return pathError(errors.Errorf("run %q when: %w", run.Name, err), "runs", ri, "when")
+		}
+
+		for ti, task := range run.Tasks {
+			if err := checkWhenTemplate(task.When); err != nil {
+				return pathError(errors.Errorf("task %q when: %w", task.Name, err), "runs", ri, "tasks", ti, "when")
+			}
+			if err := checkEnvironmentTemplates(task.Environment, "runs", ri, "tasks", ti, "environment"); err != nil {
+				return wrapPathError(err, "task %q", task.Name)
+			}
+			if task.Runtime != nil {
+				for ci, c := range task.Runtime.Containers {
+					if err := checkTemplate(c.Image); err != nil {
+						return pathError(errors.Errorf("task %q container image: %w", task.Name, err), "runs", ri, "tasks", ti, "runtime", "containers", ci, "image")
+					}
+					if err := checkEnvironmentTemplates(c.Environment, "runs", ri, "tasks", ti, "runtime", "containers", ci, "environment"); err != nil {
+						return wrapPathError(err, "task %q container", task.Name)
+					}
+				}
+			}
+			for si, step := range task.Steps {
+				b, ok := step.(interface{ Base() *BaseStep })
+				if !ok {
+					continue
+				}
+				if err := checkStepWhen(b.Base().When); err != nil {
+					return pathError(errors.Errorf("task %q step %d when: %w", task.Name, si, err), "runs", ri, "tasks", ti, "steps", si, "when")
+				}
+			}
+			if err := checkStepsTemplates(task.Steps, "runs", ri, "tasks", ti, "steps"); err != nil {
+				return wrapPathError(err, "task %q step", task.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// wrapPathError prefixes the path error message keeping its path
+func wrapPathError(err error, format string, a ...interface{}) error {
+	cerr := err.(*ConfigError)
+	return pathError(errors.Errorf(format+": %w", append(a, cerr.Err)...), cerr.path...)
+}
@@ -137,22 +137,11 @@ func (d *DataManager) walIndex(ctx context.Context, wals []*WalData) (walIndex,
 // TODO(sgotti) add a function to merge small data files (i.e after deletions) to avoid fragmentation
 // TODO(sgotti) add a function to delete old data files keeping only N snapshots
 func (d *DataManager) writeDataSnapshot(ctx context.Context, wals []*WalData) error {
-	dataSequence, err := sequence.IncSequence(ctx, d.e, etcdCheckpointSeqKey)
-	if err != nil {
-		return err
-	}
-
 	var lastWalSequence string
 	for _, walData := range wals {
 		lastWalSequence = walData.WalSequence
 	}
 
-	dataStatus := &DataStatus{
-		DataSequence: dataSequence.String(),
-		WalSequence:  lastWalSequence,
-		Files:        make(map[string][]*DataStatusFile),
-	}
-
 	wi, err := d.walIndex(ctx, wals)
 	if err != nil {
 		return err
@@ -163,6 +152,23 @@ func (d *DataManager) writeDataSnapshot(ctx context.Context, wals []*WalData) er
 		return err
 	}
 
+	return d.writeData(ctx, wi, lastWalSequence, curDataStatus)
+}
+
+// writeData writes a new data status applying the walIndex actions to the
+// current data status files
+func (d *DataManager) writeData(ctx context.Context, wi walIndex, lastWalSequence string, curDataStatus *DataStatus) error {
+	dataSequence, err := sequence.IncSequence(ctx, d.e, etcdCheckpointSeqKey)
+	if err != nil {
+		return err
+	}
+
+	dataStatus := &DataStatus{
+		DataSequence: dataSequence.String(),
+		WalSequence:  lastWalSequence,
+		Files:        make(map[string][]*DataStatusFile),
+	}
+
 	for _, dataType := range d.dataTypes {
 		var curDataStatusFiles []*DataStatusFile
 		if curDataStatus != nil {
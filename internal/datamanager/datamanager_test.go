@@ -15,6 +15,7 @@
 package datamanager
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -152,12 +153,27 @@ func TestEtcdReset(t *testing.T) {
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
+	initialized, err := dm.EtcdInitialized(ctx)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if initialized {
+		t.Fatalf("expected etcd not initialized")
+	}
 	dmReadyCh = make(chan struct{})
 
 	t.Logf("starting datamanager")
 	go func() { _ = dm.Run(ctx, dmReadyCh) }()
 	<-dmReadyCh
 
+	initialized, err = dm.EtcdInitialized(ctx)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if !initialized {
+		t.Fatalf("expected etcd initialized")
+	}
+
 	time.Sleep(5 * time.Second)
 
 	for i := 0; i < 20; i++ {
@@ -735,6 +751,120 @@ func testCheckpoint(t *testing.T, basePath string) {
 	}
 }
 
+func TestExportImport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	etcdDir, err := ioutil.TempDir(dir, "etcd")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	tetcd := setupEtcd(t, etcdDir)
+	defer shutdownEtcd(tetcd)
+
+	ctx := context.Background()
+
+	ostDir, err := ioutil.TempDir(dir, "ost")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	ost, err := posix.New(ostDir)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	dmConfig := &DataManagerConfig{
+		BasePath: "base",
+		E:        tetcd.TestEtcd.Store,
+		OST:      objectstorage.NewObjStorage(ost, "/"),
+		// remove almost all wals to see that they are removed also from changes
+		EtcdWalsKeepNum: 1,
+		DataTypes:       []string{"datatype01"},
+		// checkpoint also with only one wal
+		MinCheckpointWalsNum: 1,
+		// use a small maxDataFileSize
+		MaxDataFileSize: 10 * 1024,
+	}
+	dm, err := NewDataManager(ctx, logger, dmConfig)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	dmReadyCh := make(chan struct{})
+	go func() { _ = dm.Run(ctx, dmReadyCh) }()
+	<-dmReadyCh
+
+	time.Sleep(5 * time.Second)
+
+	actions := []*Action{}
+	for i := 0; i < 200; i++ {
+		actions = append(actions, &Action{
+			ActionType: ActionTypePut,
+			ID:         fmt.Sprintf("object%04d", i),
+			DataType:   "datatype01",
+			Data:       []byte(fmt.Sprintf(`{ "ID": "%d" }`, i)),
+		})
+	}
+
+	expectedEntries, err := doAndCheckCheckpoint(t, ctx, dm, [][]*Action{actions}, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// write some wals without checkpointing them: they must be exported
+	actions = []*Action{}
+	for i := 0; i < 20; i++ {
+		actions = append(actions, &Action{
+			ActionType: ActionTypeDelete,
+			ID:         fmt.Sprintf("object%04d", i),
+			DataType:   "datatype01",
+		})
+		delete(expectedEntries, fmt.Sprintf("object%04d", i))
+	}
+	for i := 150; i < 250; i++ {
+		action := &Action{
+			ActionType: ActionTypePut,
+			ID:         fmt.Sprintf("object%04d", i),
+			DataType:   "datatype01",
+			Data:       []byte(fmt.Sprintf(`{ "ID": "%d", "Updated": true }`, i)),
+		}
+		actions = append(actions, action)
+		expectedEntries[action.ID] = &DataEntry{ID: action.ID, DataType: action.DataType, Data: action.Data}
+	}
+	if _, err := dm.WriteWal(ctx, actions, nil); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// commit the wal to the objectstorage
+	if err := dm.sync(ctx); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := dm.Export(ctx, &buf); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// import in a new datamanager
+	dmConfig.BasePath = "restored"
+	ndm, err := NewDataManager(ctx, logger, dmConfig)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := ndm.Import(ctx, bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := checkDataFiles(ctx, t, ndm, expectedEntries); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// import on a datamanager with existing data must fail
+	if err := ndm.Import(ctx, bytes.NewReader(buf.Bytes())); err == nil {
+		t.Fatalf("expected error importing on existing data")
+	}
+}
+
 func checkDataFiles(ctx context.Context, t *testing.T, dm *DataManager, expectedEntriesMap map[string]*DataEntry) error {
 	// read the data file
 	curDataStatus, err := dm.GetLastDataStatus()
@@ -0,0 +1,227 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datamanager
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+
+	ostypes "agola.io/agola/internal/objectstorage/types"
+
+	"go.etcd.io/etcd/clientv3/concurrency"
+	errors "golang.org/x/xerrors"
+)
+
+// Export writes to w all the data entries (as a stream of json encoded
+// DataEntry) of the last data status merged with the wals committed to the
+// objectstorage and not yet checkpointed.
+// The checkpoint lock is held during the export so the data status and the
+// wals can't change under us giving a consistent snapshot of the data.
+func (d *DataManager) Export(ctx context.Context, w io.Writer) error {
+	session, err := concurrency.NewSession(d.e.Client(), concurrency.WithTTL(5), concurrency.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	m := concurrency.NewMutex(session, etcdCheckpointLockKey)
+
+	if err := m.Lock(ctx); err != nil {
+		return err
+	}
+	defer func() { _ = m.Unlock(ctx) }()
+
+	curDataStatus, err := d.GetLastDataStatus()
+	if err != nil && err != ostypes.ErrNotExist {
+		return err
+	}
+
+	resp, err := d.e.List(ctx, etcdWalsDir+"/", "", 0)
+	if err != nil {
+		return err
+	}
+	walsData := []*WalData{}
+	for _, kv := range resp.Kvs {
+		var walData *WalData
+		if err := json.Unmarshal(kv.Value, &walData); err != nil {
+			return err
+		}
+		// stop at the first wal not yet committed to the objectstorage, it
+		// (and the next ones) will be in the next export
+		if walData.WalStatus == WalStatusCommitted {
+			break
+		}
+		if curDataStatus != nil && walData.WalSequence <= curDataStatus.WalSequence {
+			continue
+		}
+		walsData = append(walsData, walData)
+	}
+
+	wi, err := d.walIndex(ctx, walsData)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	for _, dataType := range d.dataTypes {
+		var curDataStatusFiles []*DataStatusFile
+		if curDataStatus != nil {
+			curDataStatusFiles = curDataStatus.Files[dataType]
+		}
+		if err := d.exportDataType(enc, dataType, curDataStatusFiles, wi[dataType]); err != nil {
+			return errors.Errorf("failed to export data type %q: %w", dataType, err)
+		}
+	}
+
+	return nil
+}
+
+// exportDataType iterates over data entries and actions in order writing the
+// resulting data entries
+func (d *DataManager) exportDataType(enc *json.Encoder, dataType string, dataStatusFiles []*DataStatusFile, actions walActions) error {
+	actionIndex := 0
+
+	writeAction := func(action *Action) error {
+		if action.ActionType != ActionTypePut {
+			return nil
+		}
+		return enc.Encode(&DataEntry{
+			ID:       action.ID,
+			DataType: action.DataType,
+			Data:     action.Data,
+		})
+	}
+
+	exportFile := func(dataFileID string) error {
+		dataf, err := d.ost.ReadObject(d.DataFilePath(dataType, dataFileID))
+		if err != nil {
+			return err
+		}
+		defer dataf.Close()
+
+		dec := json.NewDecoder(dataf)
+		for {
+			var de *DataEntry
+
+			err := dec.Decode(&de)
+			if err == io.EOF {
+				// all done
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			for actionIndex < len(actions) && actions[actionIndex].ID < de.ID {
+				if err := writeAction(actions[actionIndex]); err != nil {
+					return err
+				}
+				actionIndex++
+			}
+			if actionIndex < len(actions) && actions[actionIndex].ID == de.ID {
+				// the action replaces or deletes the current data entry
+				if err := writeAction(actions[actionIndex]); err != nil {
+					return err
+				}
+				actionIndex++
+				continue
+			}
+			if err := enc.Encode(de); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, dataStatusFile := range dataStatusFiles {
+		if err := exportFile(dataStatusFile.ID); err != nil {
+			return err
+		}
+	}
+
+	for ; actionIndex < len(actions); actionIndex++ {
+		if err := writeAction(actions[actionIndex]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Import reads a stream of json encoded DataEntry (like the one generated by
+// Export) and writes them as a new data status.
+// It must be executed on an empty objectstorage (no data status and no wals)
+// and before starting the services using this datamanager. The etcd wals will
+// be initialized from the objectstorage at the next start.
+//
+// TODO: all the entries are kept in memory, this could be optimized
+// writing the data files while reading the entries since they are already
+// ordered
+func (d *DataManager) Import(ctx context.Context, r io.Reader) error {
+	_, err := d.GetLastDataStatusPath()
+	if err != nil && err != ostypes.ErrNotExist {
+		return err
+	}
+	if err == nil {
+		return errors.Errorf("data already exists, import must be done on an empty objectstorage")
+	}
+
+	hasWals := false
+	for wal := range d.ListOSTWals("") {
+		if wal.Err != nil {
+			return wal.Err
+		}
+		hasWals = true
+	}
+	if hasWals {
+		return errors.Errorf("wals already exist, import must be done on an empty objectstorage")
+	}
+
+	dataTypes := map[string]struct{}{}
+	for _, dataType := range d.dataTypes {
+		dataTypes[dataType] = struct{}{}
+	}
+
+	wi := walIndex{}
+	dec := json.NewDecoder(r)
+	for {
+		var de *DataEntry
+
+		err := dec.Decode(&de)
+		if err == io.EOF {
+			// all done
+			break
+		}
+		if err != nil {
+			return errors.Errorf("failed to decode data entry: %w", err)
+		}
+		if _, ok := dataTypes[de.DataType]; !ok {
+			return errors.Errorf("unknown data type %q for entry %q", de.DataType, de.ID)
+		}
+
+		wi[de.DataType] = append(wi[de.DataType], &Action{
+			ActionType: ActionTypePut,
+			DataType:   de.DataType,
+			ID:         de.ID,
+			Data:       de.Data,
+		})
+	}
+	for _, actions := range wi {
+		sort.Sort(actions)
+	}
+
+	return d.writeData(ctx, wi, "", nil)
+}
@@ -150,6 +150,46 @@ func (d *DataManager) ReadWalData(walFileID string) (io.ReadCloser, error) {
 	return d.ost.ReadObject(d.storageWalDataFile(walFileID))
 }
 
+// ReadWalActions returns the actions of the wal, committed to the
+// objectstorage, with the provided sequence
+func (d *DataManager) ReadWalActions(walseq string) ([]*Action, error) {
+	walFilef, err := d.ReadWal(walseq)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(walFilef)
+	var header *WalHeader
+	if err = dec.Decode(&header); err != nil && err != io.EOF {
+		walFilef.Close()
+		return nil, err
+	}
+	walFilef.Close()
+
+	walFile, err := d.ReadWalData(header.WalDataFileID)
+	if err != nil {
+		return nil, errors.Errorf("cannot read wal data file %q: %w", header.WalDataFileID, err)
+	}
+	defer walFile.Close()
+
+	actions := []*Action{}
+	dec = json.NewDecoder(walFile)
+	for {
+		var action *Action
+
+		err := dec.Decode(&action)
+		if err == io.EOF {
+			// all done
+			break
+		}
+		if err != nil {
+			return nil, errors.Errorf("failed to decode wal file: %w", err)
+		}
+		actions = append(actions, action)
+	}
+
+	return actions, nil
+}
+
 type WalFile struct {
 	WalSequence  string
 	Err          error
@@ -903,6 +943,15 @@ func (d *DataManager) etcdPinger(ctx context.Context) error {
 	return nil
 }
 
+// EtcdInitialized reports if the etcd data has been initialized by InitEtcd
+func (d *DataManager) EtcdInitialized(ctx context.Context) (bool, error) {
+	_, err := d.e.Get(ctx, etcdWalsDataKey, 0)
+	if err != nil && err != etcd.ErrKeyNotFound {
+		return false, err
+	}
+	return err == nil, nil
+}
+
 func (d *DataManager) InitEtcd(ctx context.Context) error {
 	writeWal := func(wal *WalFile) error {
 		walFile, err := d.ost.ReadObject(d.storageWalStatusFile(wal.WalSequence) + ".committed")
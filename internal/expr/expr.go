@@ -0,0 +1,586 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package expr implements the config templates: strings containing
+// expressions in the {{ EXPRESSION }} format that are evaluated with the run
+// context variables.
+//
+// An expression is made of string literals (single or double quoted), the
+// true and false literals, variables, the ==, !=, !, && and || operators,
+// parentheses and the startsWith, endsWith, contains and matches functions.
+// Like in javascript, the && and || operators return one of their operands,
+// so {{ tag || "latest" }} evaluates to "latest" when the tag is empty. An
+// empty string and false are falsy, every other value is truthy.
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	templateStart = "{{"
+	templateEnd   = "}}"
+)
+
+// HasTemplate reports whether s contains a template expression
+func HasTemplate(s string) bool {
+	return strings.Contains(s, templateStart)
+}
+
+// Template is a parsed template
+type Template struct {
+	// parts are the template parts: a literal text (when node is nil) or an
+	// expression
+	parts []*part
+}
+
+type part struct {
+	text string
+	node node
+}
+
+// Parse parses the template s. The returned errors report the position (the
+// 1-based byte offset in s) of the wrong token.
+func Parse(s string) (*Template, error) {
+	t := &Template{}
+	offset := 0
+	for {
+		start := strings.Index(s[offset:], templateStart)
+		if start < 0 {
+			if offset < len(s) {
+				t.parts = append(t.parts, &part{text: s[offset:]})
+			}
+			return t, nil
+		}
+		start += offset
+		if start > offset {
+			t.parts = append(t.parts, &part{text: s[offset:start]})
+		}
+
+		exprStart := start + len(templateStart)
+		n, end, err := parseExpr(s, exprStart)
+		if err != nil {
+			return nil, err
+		}
+		t.parts = append(t.parts, &part{node: n})
+		offset = end
+	}
+}
+
+// Variables returns the names of the variables referenced by the template
+func (t *Template) Variables() []string {
+	seen := map[string]struct{}{}
+	names := []string{}
+	for _, p := range t.parts {
+		if p.node == nil {
+			continue
+		}
+		p.node.walk(func(n node) {
+			if v, ok := n.(*variableNode); ok {
+				if _, ok := seen[v.name]; !ok {
+					seen[v.name] = struct{}{}
+					names = append(names, v.name)
+				}
+			}
+		})
+	}
+	return names
+}
+
+// Eval evaluates the template with the provided variables. The undefined
+// variables are empty strings.
+func (t *Template) Eval(variables map[string]string) string {
+	var b strings.Builder
+	for _, p := range t.parts {
+		if p.node == nil {
+			b.WriteString(p.text)
+			continue
+		}
+		b.WriteString(p.node.eval(variables).String())
+	}
+	return b.String()
+}
+
+// EvalBool evaluates the template as a condition. A template made of a single
+// expression (surrounding spaces are ignored) is true when the expression
+// value is truthy, otherwise it's true when the evaluated text isn't empty or
+// "false".
+func (t *Template) EvalBool(variables map[string]string) bool {
+	var exprPart *part
+	for _, p := range t.parts {
+		if p.node == nil {
+			if strings.TrimSpace(p.text) != "" {
+				exprPart = nil
+				break
+			}
+			continue
+		}
+		if exprPart != nil {
+			exprPart = nil
+			break
+		}
+		exprPart = p
+	}
+	if exprPart != nil {
+		return exprPart.node.eval(variables).Truthy()
+	}
+
+	s := strings.TrimSpace(t.Eval(variables))
+	return s != "" && s != "false"
+}
+
+// Value is the value of an expression: a string or a boolean
+type Value struct {
+	s      string
+	b      bool
+	isBool bool
+}
+
+func stringValue(s string) Value { return Value{s: s} }
+func boolValue(b bool) Value     { return Value{b: b, isBool: true} }
+
+func (v Value) String() string {
+	if v.isBool {
+		if v.b {
+			return "true"
+		}
+		return "false"
+	}
+	return v.s
+}
+
+// Truthy reports whether the value is true when used as a condition
+func (v Value) Truthy() bool {
+	if v.isBool {
+		return v.b
+	}
+	return v.s != ""
+}
+
+type node interface {
+	eval(variables map[string]string) Value
+	walk(f func(node))
+}
+
+type literalNode struct {
+	value Value
+}
+
+func (n *literalNode) eval(map[string]string) Value { return n.value }
+func (n *literalNode) walk(f func(node))            { f(n) }
+
+type variableNode struct {
+	name string
+}
+
+func (n *variableNode) eval(variables map[string]string) Value {
+	return stringValue(variables[n.name])
+}
+func (n *variableNode) walk(f func(node)) { f(n) }
+
+type notNode struct {
+	x node
+}
+
+func (n *notNode) eval(variables map[string]string) Value {
+	return boolValue(!n.x.eval(variables).Truthy())
+}
+func (n *notNode) walk(f func(node)) { f(n); n.x.walk(f) }
+
+type binaryNode struct {
+	op   string
+	x, y node
+}
+
+func (n *binaryNode) eval(variables map[string]string) Value {
+	x := n.x.eval(variables)
+	switch n.op {
+	case "&&":
+		if !x.Truthy() {
+			return x
+		}
+		return n.y.eval(variables)
+	case "||":
+		if x.Truthy() {
+			return x
+		}
+		return n.y.eval(variables)
+	case "==":
+		return boolValue(x.String() == n.y.eval(variables).String())
+	case "!=":
+		return boolValue(x.String() != n.y.eval(variables).String())
+	}
+	panic(fmt.Errorf("unknown operator %q", n.op))
+}
+func (n *binaryNode) walk(f func(node)) { f(n); n.x.walk(f); n.y.walk(f) }
+
+type callNode struct {
+	name string
+	args []node
+	// re is the compiled regular expression of the matches function
+	re *regexp.Regexp
+}
+
+func (n *callNode) eval(variables map[string]string) Value {
+	s := n.args[0].eval(variables).String()
+	switch n.name {
+	case "startsWith":
+		return boolValue(strings.HasPrefix(s, n.args[1].eval(variables).String()))
+	case "endsWith":
+		return boolValue(strings.HasSuffix(s, n.args[1].eval(variables).String()))
+	case "contains":
+		return boolValue(strings.Contains(s, n.args[1].eval(variables).String()))
+	case "matches":
+		return boolValue(n.re.MatchString(s))
+	}
+	panic(fmt.Errorf("unknown function %q", n.name))
+}
+func (n *callNode) walk(f func(node)) {
+	f(n)
+	for _, a := range n.args {
+		a.walk(f)
+	}
+}
+
+// functions are the available functions with their number of arguments
+var functions = map[string]int{
+	"startsWith": 2,
+	"endsWith":   2,
+	"contains":   2,
+	"matches":    2,
+}
+
+type tokenType int
+
+const (
+	tokenEOF tokenType = iota
+	tokenString
+	tokenIdent
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenComma
+	tokenEnd
+)
+
+type token struct {
+	typ   tokenType
+	value string
+	pos   int
+}
+
+func (t token) String() string {
+	switch t.typ {
+	case tokenEOF:
+		return "end of template"
+	case tokenEnd:
+		return templateEnd
+	case tokenString:
+		return fmt.Sprintf("string %q", t.value)
+	}
+	return fmt.Sprintf("%q", t.value)
+}
+
+// parser is a recursive descent parser of a single expression
+type parser struct {
+	s   string
+	pos int
+	tok token
+}
+
+// parseExpr parses the expression starting at offset in s and ending with
+// "}}". It returns the expression and the offset after its end.
+func parseExpr(s string, offset int) (node, int, error) {
+	p := &parser{s: s, pos: offset}
+	if err := p.next(); err != nil {
+		return nil, 0, err
+	}
+	if p.tok.typ == tokenEnd {
+		return nil, 0, p.errorf(p.tok.pos, "empty expression")
+	}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, 0, err
+	}
+	if p.tok.typ != tokenEnd {
+		if p.tok.typ == tokenEOF {
+			return nil, 0, p.errorf(offset-len(templateStart), "unterminated expression, missing %q", templateEnd)
+		}
+		return nil, 0, p.unexpected()
+	}
+	return n, p.pos, nil
+}
+
+func (p *parser) errorf(pos int, format string, a ...interface{}) error {
+	return errors.Errorf("template %q: position %d: %s", p.s, pos+1, fmt.Sprintf(format, a...))
+}
+
+func (p *parser) unexpected() error {
+	return p.errorf(p.tok.pos, "unexpected %s", p.tok)
+}
+
+func (p *parser) next() error {
+	s := p.s
+	for p.pos < len(s) && (s[p.pos] == ' ' || s[p.pos] == '\t' || s[p.pos] == '\n' || s[p.pos] == '\r') {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(s) {
+		p.tok = token{typ: tokenEOF, pos: start}
+		return nil
+	}
+
+	c := s[p.pos]
+	switch {
+	case strings.HasPrefix(s[p.pos:], templateEnd):
+		p.pos += len(templateEnd)
+		p.tok = token{typ: tokenEnd, value: templateEnd, pos: start}
+	case c == '(':
+		p.pos++
+		p.tok = token{typ: tokenLParen, value: "(", pos: start}
+	case c == ')':
+		p.pos++
+		p.tok = token{typ: tokenRParen, value: ")", pos: start}
+	case c == ',':
+		p.pos++
+		p.tok = token{typ: tokenComma, value: ",", pos: start}
+	case c == '"' || c == '\'':
+		value, err := p.scanString(c)
+		if err != nil {
+			return err
+		}
+		p.tok = token{typ: tokenString, value: value, pos: start}
+	case c == '_' || isLetter(c):
+		for p.pos < len(s) && (s[p.pos] == '_' || isLetter(s[p.pos]) || isDigit(s[p.pos])) {
+			p.pos++
+		}
+		p.tok = token{typ: tokenIdent, value: s[start:p.pos], pos: start}
+	default:
+		for _, op := range []string{"==", "!=", "&&", "||", "!"} {
+			if strings.HasPrefix(s[p.pos:], op) {
+				p.pos += len(op)
+				p.tok = token{typ: tokenOperator, value: op, pos: start}
+				return nil
+			}
+		}
+		return p.errorf(start, "unexpected character %q", c)
+	}
+	return nil
+}
+
+func (p *parser) scanString(quote byte) (string, error) {
+	start := p.pos
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch {
+		case c == quote:
+			p.pos++
+			return b.String(), nil
+		case c == '\\' && p.pos+1 < len(p.s):
+			p.pos++
+			switch e := p.s[p.pos]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case '\\', '"', '\'':
+				b.WriteByte(e)
+			default:
+				return "", p.errorf(p.pos-1, "invalid escape sequence \"\\%c\"", e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+		p.pos++
+	}
+	return "", p.errorf(start, "unterminated string")
+}
+
+func (p *parser) parseOr() (node, error) {
+	x, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.typ == tokenOperator && p.tok.value == "||" {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		y, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		x = &binaryNode{op: "||", x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	x, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.typ == tokenOperator && p.tok.value == "&&" {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		y, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		x = &binaryNode{op: "&&", x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseComparison() (node, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.typ == tokenOperator && (p.tok.value == "==" || p.tok.value == "!=") {
+		op := p.tok.value
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		y, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		x = &binaryNode{op: op, x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.tok.typ == tokenOperator && p.tok.value == "!" {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.tok
+	switch tok.typ {
+	case tokenString:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		return &literalNode{value: stringValue(tok.value)}, nil
+
+	case tokenLParen:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.typ != tokenRParen {
+			return nil, p.unexpected()
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		return x, nil
+
+	case tokenIdent:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		switch tok.value {
+		case "true":
+			return &literalNode{value: boolValue(true)}, nil
+		case "false":
+			return &literalNode{value: boolValue(false)}, nil
+		}
+		if p.tok.typ == tokenLParen {
+			return p.parseCall(tok)
+		}
+		return &variableNode{name: tok.value}, nil
+	}
+
+	return nil, p.unexpected()
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	nargs, ok := functions[name.value]
+	if !ok {
+		return nil, p.errorf(name.pos, "unknown function %q", name.value)
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	n := &callNode{name: name.value}
+	var argsPos []int
+	for p.tok.typ != tokenRParen {
+		if len(n.args) > 0 {
+			if p.tok.typ != tokenComma {
+				return nil, p.unexpected()
+			}
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		}
+		argsPos = append(argsPos, p.tok.pos)
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		n.args = append(n.args, arg)
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	if len(n.args) != nargs {
+		return nil, p.errorf(name.pos, "function %q requires %d arguments, got %d", name.value, nargs, len(n.args))
+	}
+	if n.name == "matches" {
+		// the regular expression must be a literal to report its errors when
+		// parsing the template
+		lit, ok := n.args[1].(*literalNode)
+		if !ok || lit.value.isBool {
+			return nil, p.errorf(argsPos[1], "function %q regular expression must be a string literal", n.name)
+		}
+		re, err := regexp.Compile(lit.value.s)
+		if err != nil {
+			return nil, p.errorf(argsPos[1], "invalid regular expression %q: %v", lit.value.s, err)
+		}
+		n.re = re
+	}
+
+	return n, nil
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,108 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expr
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEval(t *testing.T) {
+	variables := map[string]string{
+		"branch": "main",
+		"tag":    "",
+		"arch":   "amd64",
+	}
+
+	tests := []struct {
+		in   string
+		out  string
+		cond bool
+	}{
+		{in: "image:1.0", out: "image:1.0", cond: true},
+		{in: "", out: "", cond: false},
+		{in: "golang:{{ branch }}", out: "golang:main", cond: true},
+		{in: "{{ tag || 'latest' }}", out: "latest", cond: true},
+		{in: "{{ tag }}", out: "", cond: false},
+		{in: `{{ branch == "main" && arch }}`, out: "amd64", cond: true},
+		{in: `{{ branch != "main" && arch }}`, out: "false", cond: false},
+		{in: `{{ !(branch == "main") }}`, out: "false", cond: false},
+		{in: `{{ !tag }}`, out: "true", cond: true},
+		{in: `{{ startsWith(branch, "ma") && endsWith(branch, "in") }}`, out: "true", cond: true},
+		{in: `{{ contains(arch, "64") || false }}`, out: "true", cond: true},
+		{in: `{{ matches(branch, "^(main|master)$") }}`, out: "true", cond: true},
+		{in: `{{ undefined == "" }}`, out: "true", cond: true},
+		{in: `{{ "a\"b" }}-{{ 'c' }}`, out: `a"b-c`, cond: true},
+		{in: `  {{ false }} `, out: "  false ", cond: false},
+		{in: `{{ true }}{{ false }}`, out: "truefalse", cond: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			tmpl, err := Parse(tt.in)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if out := tmpl.Eval(variables); out != tt.out {
+				t.Fatalf("expected %q, got %q", tt.out, out)
+			}
+			if cond := tmpl.EvalBool(variables); cond != tt.cond {
+				t.Fatalf("expected condition %t, got %t", tt.cond, cond)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		in  string
+		err error
+	}{
+		{in: "{{ }}", err: fmt.Errorf(`template "{{ }}": position 4: empty expression`)},
+		{in: "a{{ branch", err: fmt.Errorf(`template "a{{ branch": position 2: unterminated expression, missing "}}"`)},
+		{in: "{{ branch = 'main' }}", err: fmt.Errorf(`template "{{ branch = 'main' }}": position 11: unexpected character '='`)},
+		{in: "{{ branch == }}", err: fmt.Errorf(`template "{{ branch == }}": position 14: unexpected }}`)},
+		{in: "{{ 'main }}", err: fmt.Errorf(`template "{{ 'main }}": position 4: unterminated string`)},
+		{in: "{{ upper(branch) }}", err: fmt.Errorf(`template "{{ upper(branch) }}": position 4: unknown function "upper"`)},
+		{in: "{{ contains(branch) }}", err: fmt.Errorf(`template "{{ contains(branch) }}": position 4: function "contains" requires 2 arguments, got 1`)},
+		{in: "{{ matches(branch, tag) }}", err: fmt.Errorf(`template "{{ matches(branch, tag) }}": position 20: function "matches" regular expression must be a string literal`)},
+		{in: "{{ matches(branch, '(') }}", err: fmt.Errorf("template \"{{ matches(branch, '(') }}\": position 20: invalid regular expression \"(\": error parsing regexp: missing closing ): `(`")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			_, err := Parse(tt.in)
+			if err == nil {
+				t.Fatalf("expected error %v, got nil", tt.err)
+			}
+			if err.Error() != tt.err.Error() {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestVariables(t *testing.T) {
+	tmpl, err := Parse(`{{ branch == "main" && arch }}-{{ branch }}{{ startsWith(tag, ref) }}`)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	expected := []string{"branch", "arch", "tag", "ref"}
+	if diff := cmp.Diff(expected, tmpl.Variables()); diff != "" {
+		t.Fatalf("variables mismatch (-want +got):\n%s", diff)
+	}
+}
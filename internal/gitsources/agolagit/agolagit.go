@@ -132,6 +132,43 @@ func (c *Client) GetFile(repopath, commit, file string) ([]byte, error) {
 	return data, err
 }
 
+func (c *Client) ListFiles(repopath, commit, dir string) ([]string, error) {
+	return c.listEntries(repopath, commit, dir, false)
+}
+
+func (c *Client) ListDirs(repopath, commit, dir string) ([]string, error) {
+	return c.listEntries(repopath, commit, dir, true)
+}
+
+// listEntries returns the names of the dir files or, when dirs is true, of
+// its subdirectories
+func (c *Client) listEntries(repopath, commit, dir string, dirs bool) ([]string, error) {
+	// the raw endpoint returns the "git show" output that, for a directory,
+	// is a "tree ref:dir" header followed by an empty line and the directory
+	// entries (with a trailing slash for subdirectories)
+	data, err := c.GetFile(repopath, commit, dir)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) == 0 || !strings.HasPrefix(lines[0], "tree ") {
+		return nil, errors.Errorf("%q isn't a directory", dir)
+	}
+
+	names := []string{}
+	for _, l := range lines[1:] {
+		if l == "" || strings.HasSuffix(l, "/") != dirs {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(l, "/"))
+	}
+	return names, nil
+}
+
+func (c *Client) CreateFile(repopath, branch, file, message string, content []byte) error {
+	return errors.Errorf("not implemented")
+}
+
 func (c *Client) CreateDeployKey(repopath, title, pubKey string, readonly bool) error {
 	return nil
 }
@@ -160,6 +197,10 @@ func (c *Client) CreateCommitStatus(repopath, commitSHA string, status gitsource
 	return nil
 }
 
+func (c *Client) CreatePullRequestComment(repopath, prID, commitSHA string, comment *gitsource.PullRequestComment) error {
+	return nil
+}
+
 func (c *Client) ListUserRepos() ([]*gitsource.RepoInfo, error) {
 	return nil, nil
 }
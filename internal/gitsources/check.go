@@ -0,0 +1,106 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitsource
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/oauth2"
+	errors "golang.org/x/xerrors"
+)
+
+// ConfigChecker is implemented by the git sources that can check their
+// configuration
+type ConfigChecker interface {
+	// CheckAPI checks that the api is reachable
+	CheckAPI() error
+	// CheckOauth2Client checks that the oauth2 client credentials are
+	// accepted by the authorization server
+	CheckOauth2Client(callbackURL string) error
+}
+
+// CheckHTTPEndpoint checks that the endpoint at u is reachable. Client errors
+// (like authentication required) are accepted since they are returned by a
+// working server.
+func CheckHTTPEndpoint(client *http.Client, u string) error {
+	resp, err := client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return errors.Errorf("%s returned status %s", u, resp.Status)
+	}
+	return nil
+}
+
+// checkOauth2Code is the invalid authorization code used to check the oauth2
+// client credentials
+const checkOauth2Code = "agola-check-invalid-code"
+
+// CheckOauth2Client checks the oauth2 client credentials doing an access token
+// request with an invalid authorization code: the authorization server
+// rejects the request with a client error when the client credentials are
+// wrong and with a grant error when they are valid.
+func CheckOauth2Client(client *http.Client, config *oauth2.Config) error {
+	v := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {checkOauth2Code},
+		"redirect_uri":  {config.RedirectURL},
+		"client_id":     {config.ClientID},
+		"client_secret": {config.ClientSecret},
+	}
+	req, err := http.NewRequest("POST", config.Endpoint.TokenURL, strings.NewReader(v.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return errors.Errorf("%s returned status %s", config.Endpoint.TokenURL, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var tresp struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &tresp); err != nil {
+		return errors.Errorf("failed to parse token endpoint response: %w", err)
+	}
+
+	switch tresp.Error {
+	// incorrect_client_credentials is returned by github
+	case "invalid_client", "unauthorized_client", "incorrect_client_credentials":
+		return errors.Errorf("oauth2 client credentials rejected: %s %s", tresp.Error, tresp.ErrorDescription)
+	case "":
+		return errors.Errorf("unexpected token endpoint response without error")
+	}
+	return nil
+}
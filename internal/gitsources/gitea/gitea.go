@@ -15,6 +15,7 @@
 package gitea
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/base64"
@@ -65,6 +66,7 @@ type Client struct {
 	client         *gitea.Client
 	httpClient     *http.Client
 	APIURL         string
+	token          string
 	oauth2ClientID string
 	oauth2Secret   string
 }
@@ -117,6 +119,7 @@ func New(opts Opts) (*Client, error) {
 		client:         client,
 		httpClient:     httpClient,
 		APIURL:         opts.APIURL,
+		token:          opts.Token,
 		oauth2ClientID: opts.Oauth2ClientID,
 		oauth2Secret:   opts.Oauth2Secret,
 	}, nil
@@ -156,6 +159,14 @@ func (c *Client) RefreshOauth2Token(refreshToken string) (*oauth2.Token, error)
 	return ts.Token()
 }
 
+func (c *Client) CheckAPI() error {
+	return gitsource.CheckHTTPEndpoint(c.httpClient, c.APIURL+"/api/v1/version")
+}
+
+func (c *Client) CheckOauth2Client(callbackURL string) error {
+	return gitsource.CheckOauth2Client(c.httpClient, c.oauth2Config(callbackURL))
+}
+
 func (c *Client) LoginPassword(username, password, tokenName string) (string, error) {
 	// try to get agola access token if it already exists
 	// use custom http call since gitea api client doesn't provide an easy way to
@@ -241,6 +252,103 @@ func (c *Client) GetFile(repopath, commit, file string) ([]byte, error) {
 	return data, err
 }
 
+func (c *Client) ListFiles(repopath, commit, dir string) ([]string, error) {
+	return c.listTreeEntries(repopath, commit, dir, "blob")
+}
+
+func (c *Client) ListDirs(repopath, commit, dir string) ([]string, error) {
+	return c.listTreeEntries(repopath, commit, dir, "tree")
+}
+
+// listTreeEntries returns the names of the dir tree entries of the provided
+// type
+func (c *Client) listTreeEntries(repopath, commit, dir, entryType string) ([]string, error) {
+	owner, reponame, err := parseRepoPath(repopath)
+	if err != nil {
+		return nil, err
+	}
+	// walk the trees from the commit root tree to the dir tree
+	tree, err := c.client.GetTrees(owner, reponame, commit, false)
+	if err != nil {
+		return nil, err
+	}
+	dir = path.Clean(dir)
+	if dir == "." {
+		dir = ""
+	}
+	for _, name := range strings.Split(dir, "/") {
+		if name == "" {
+			continue
+		}
+		var treeSHA string
+		for _, e := range tree.Entries {
+			if e.Path == name && e.Type == "tree" {
+				treeSHA = e.SHA
+			}
+		}
+		if treeSHA == "" {
+			return nil, errors.Errorf("directory %q doesn't exist", dir)
+		}
+		tree, err = c.client.GetTrees(owner, reponame, treeSHA, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	names := []string{}
+	for _, e := range tree.Entries {
+		if e.Type != entryType {
+			continue
+		}
+		names = append(names, e.Path)
+	}
+	return names, nil
+}
+
+func (c *Client) CreateFile(repopath, branch, file, message string, content []byte) error {
+	owner, reponame, err := parseRepoPath(repopath)
+	if err != nil {
+		return err
+	}
+
+	// use custom http call since gitea api client doesn't provide a create file
+	// method
+	opts := gtypes.CreateFileOptions{
+		FileOptions: gtypes.FileOptions{
+			Message:    message,
+			BranchName: branch,
+		},
+		Content: base64.StdEncoding.EncodeToString(content),
+	}
+	optsj, err := json.Marshal(opts)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", c.APIURL+"/api/v1"+fmt.Sprintf("/repos/%s/%s/contents/%s", owner, reponame, file), bytes.NewReader(optsj))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "token "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		return gitsource.ErrUnauthorized
+	}
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("gitea api status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
 func (c *Client) CreateDeployKey(repopath, title, pubKey string, readonly bool) error {
 	owner, reponame, err := parseRepoPath(repopath)
 	if err != nil {
@@ -375,6 +483,58 @@ func (c *Client) CreateCommitStatus(repopath, commitSHA string, status gitsource
 	return err
 }
 
+func (c *Client) CreatePullRequestComment(repopath, prID, commitSHA string, comment *gitsource.PullRequestComment) error {
+	owner, reponame, err := parseRepoPath(repopath)
+	if err != nil {
+		return err
+	}
+	index, err := strconv.ParseInt(prID, 10, 64)
+	if err != nil {
+		return errors.Errorf("invalid pull request id %q: %w", prID, err)
+	}
+	// the gitea api doesn't provide a way to comment a file line so create a
+	// generic pull request comment
+	_, err = c.client.CreateIssueComment(owner, reponame, index, gtypes.CreateIssueCommentOption{
+		Body: comment.LocationBody(),
+	})
+	return err
+}
+
+func (c *Client) ListUserOrgs() ([]*gitsource.UserOrg, error) {
+	remoteOrgs, err := c.client.ListMyOrgs()
+	if err != nil {
+		return nil, err
+	}
+	remoteTeams, err := c.client.ListMyTeams()
+	if err != nil {
+		return nil, err
+	}
+
+	orgs := []*gitsource.UserOrg{}
+	orgsMap := map[string]*gitsource.UserOrg{}
+	for _, ro := range remoteOrgs {
+		org := &gitsource.UserOrg{Name: ro.UserName}
+		orgs = append(orgs, org)
+		orgsMap[org.Name] = org
+	}
+	for _, rt := range remoteTeams {
+		if rt.Organization == nil {
+			continue
+		}
+		org, ok := orgsMap[rt.Organization.UserName]
+		if !ok {
+			continue
+		}
+		org.Teams = append(org.Teams, rt.Name)
+		// members of a team with owner permission are organization owners
+		if rt.Permission == "owner" {
+			org.Owner = true
+		}
+	}
+
+	return orgs, nil
+}
+
 func (c *Client) ListUserRepos() ([]*gitsource.RepoInfo, error) {
 	remoteRepos, err := c.client.ListMyRepos()
 	if err != nil {
@@ -394,6 +554,77 @@ func (c *Client) ListUserRepos() ([]*gitsource.RepoInfo, error) {
 	return repos, nil
 }
 
+func (c *Client) ListRefs(repopath string) ([]*gitsource.RepoRef, error) {
+	owner, reponame, err := parseRepoPath(repopath)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := []*gitsource.RepoRef{}
+
+	branches, err := c.client.ListRepoBranches(owner, reponame)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range branches {
+		refs = append(refs, &gitsource.RepoRef{
+			Type:      gitsource.RefTypeBranch,
+			Name:      b.Name,
+			Ref:       c.BranchRef(b.Name),
+			CommitSHA: b.Commit.ID,
+		})
+	}
+
+	tags, err := c.client.ListRepoTags(owner, reponame)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tags {
+		refs = append(refs, &gitsource.RepoRef{
+			Type:      gitsource.RefTypeTag,
+			Name:      t.Name,
+			Ref:       c.TagRef(t.Name),
+			CommitSHA: t.Commit.SHA,
+		})
+	}
+
+	for page := 1; ; page++ {
+		prs, err := c.client.ListRepoPullRequests(owner, reponame, gtypes.ListPullRequestsOptions{Page: page, State: "open"})
+		if err != nil {
+			return nil, err
+		}
+		if len(prs) == 0 {
+			break
+		}
+		for _, pr := range prs {
+			prID := strconv.FormatInt(pr.Index, 10)
+			labels := []string{}
+			for _, l := range pr.Labels {
+				labels = append(labels, l.Name)
+			}
+			draft := false
+			for _, prefix := range wipPrefixes {
+				if strings.HasPrefix(strings.ToUpper(pr.Title), prefix) {
+					draft = true
+					break
+				}
+			}
+			refs = append(refs, &gitsource.RepoRef{
+				Type:                    gitsource.RefTypePullRequest,
+				Name:                    prID,
+				Ref:                     c.PullRequestRef(prID),
+				CommitSHA:               pr.Head.Sha,
+				PullRequestTitle:        pr.Title,
+				PullRequestTargetBranch: pr.Base.Ref,
+				PullRequestLabels:       labels,
+				PullRequestDraft:        draft,
+			})
+		}
+	}
+
+	return refs, nil
+}
+
 func fromGiteaRepo(rr *gitea.Repository) *gitsource.RepoInfo {
 	return &gitsource.RepoInfo{
 		ID:           strconv.FormatInt(rr.ID, 10),
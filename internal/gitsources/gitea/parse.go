@@ -27,6 +27,7 @@ import (
 	"strconv"
 	"strings"
 
+	gitsource "agola.io/agola/internal/gitsources"
 	"agola.io/agola/internal/services/types"
 
 	errors "golang.org/x/xerrors"
@@ -41,10 +42,18 @@ const (
 
 	prStateOpen = "open"
 
-	prActionOpen = "opened"
-	prActionSync = "synchronized"
+	prActionOpen         = "opened"
+	prActionSync         = "synchronized"
+	prActionLabelUpdated = "label_updated"
+
+	// emptyCommitSHA is the push before commit sha of a new branch
+	emptyCommitSHA = "0000000000000000000000000000000000000000"
 )
 
+// wipPrefixes are the default gitea title prefixes marking a pull request as
+// work in progress
+var wipPrefixes = []string{"WIP:", "[WIP]"}
+
 func (c *Client) ParseWebhook(r *http.Request, secret string) (*types.WebhookData, error) {
 	data, err := ioutil.ReadAll(io.LimitReader(r.Body, 10*1024*1024))
 	if err != nil {
@@ -100,8 +109,9 @@ func parsePullRequestHook(data []byte) (*types.WebhookData, error) {
 	if prhook.PullRequest.State != prStateOpen {
 		return nil, nil
 	}
-	// only accept actions that have new commits
-	if prhook.Action != prActionOpen && prhook.Action != prActionSync {
+	// only accept actions that have new commits or change the pull request
+	// labels used by the when conditions
+	if prhook.Action != prActionOpen && prhook.Action != prActionSync && prhook.Action != prActionLabelUpdated {
 		return nil, nil
 	}
 
@@ -137,6 +147,15 @@ func webhookDataFromPush(hook *pushHook) (*types.WebhookData, error) {
 		if len(hook.Commits) > 0 {
 			whd.Message = hook.Commits[0].Message
 		}
+
+		// the changed files aren't known for a new branch
+		if hook.Before != emptyCommitSHA && len(hook.Commits) > 0 {
+			files := [][]string{}
+			for _, c := range hook.Commits {
+				files = append(files, c.Added, c.Removed, c.Modified)
+			}
+			whd.ChangedFiles = gitsource.ChangedFiles(files...)
+		}
 	case strings.HasPrefix(hook.Ref, "refs/tags/"):
 		whd.Event = types.WebhookEventTag
 		whd.Tag = strings.TrimPrefix(hook.Ref, "refs/tags/")
@@ -156,6 +175,21 @@ func webhookDataFromPullRequest(hook *pullRequestHook) *types.WebhookData {
 	if sender == "" {
 		sender = hook.Sender.Login
 	}
+
+	// gitea doesn't have draft pull requests but marks them as work in
+	// progress using a title prefix
+	draft := false
+	for _, prefix := range wipPrefixes {
+		if strings.HasPrefix(strings.ToUpper(hook.PullRequest.Title), prefix) {
+			draft = true
+			break
+		}
+	}
+	labels := []string{}
+	for _, label := range hook.PullRequest.Labels {
+		labels = append(labels, label.Name)
+	}
+
 	whd := &types.WebhookData{
 		Event:           types.WebhookEventPullRequest,
 		CommitSHA:       hook.PullRequest.Head.Sha,
@@ -168,6 +202,12 @@ func webhookDataFromPullRequest(hook *pullRequestHook) *types.WebhookData {
 		PullRequestID:   strconv.FormatInt(hook.PullRequest.ID, 10),
 		PullRequestLink: hook.PullRequest.URL,
 
+		PullRequestAttributes: &types.PullRequestAttributes{
+			Draft:        draft,
+			Labels:       labels,
+			TargetBranch: hook.PullRequest.Base.Ref,
+		},
+
 		Repo: types.WebhookDataRepo{
 			Path:   path.Join(hook.Repo.Owner.Username, hook.Repo.Name),
 			WebURL: hook.Repo.URL,
@@ -44,9 +44,12 @@ type pushHook struct {
 	} `json:"repository"`
 
 	Commits []struct {
-		ID      string `json:"id"`
-		Message string `json:"message"`
-		URL     string `json:"url"`
+		ID       string   `json:"id"`
+		Message  string   `json:"message"`
+		URL      string   `json:"url"`
+		Added    []string `json:"added"`
+		Removed  []string `json:"removed"`
+		Modified []string `json:"modified"`
 	} `json:"commits"`
 
 	Sender struct {
@@ -117,6 +120,9 @@ type pullRequestHook struct {
 				} `json:"owner"`
 			} `json:"repo"`
 		} `json:"head"`
+		Labels []struct {
+			Name string `json:"name"`
+		} `json:"labels"`
 	} `json:"pull_request"`
 	Repo struct {
 		ID       int64  `json:"id"`
@@ -36,7 +36,7 @@ import (
 )
 
 var (
-	GitHubOauth2Scopes = []string{"repo"}
+	GitHubOauth2Scopes = []string{"repo", "read:org"}
 
 	branchRefPrefix     = "refs/heads/"
 	tagRefPrefix        = "refs/tags/"
@@ -177,6 +177,14 @@ func (c *Client) RefreshOauth2Token(refreshToken string) (*oauth2.Token, error)
 	return ts.Token()
 }
 
+func (c *Client) CheckAPI() error {
+	return gitsource.CheckHTTPEndpoint(c.httpClient, c.APIURL)
+}
+
+func (c *Client) CheckOauth2Client(callbackURL string) error {
+	return gitsource.CheckOauth2Client(c.httpClient, c.oauth2Config(callbackURL))
+}
+
 func (c *Client) GetUserInfo() (*gitsource.UserInfo, error) {
 	user, _, err := c.client.Users.Get(context.TODO(), "")
 	if err != nil {
@@ -215,6 +223,50 @@ func (c *Client) GetFile(repopath, commit, file string) ([]byte, error) {
 	return ioutil.ReadAll(r)
 }
 
+func (c *Client) ListFiles(repopath, commit, dir string) ([]string, error) {
+	return c.listContents(repopath, commit, dir, "file")
+}
+
+func (c *Client) ListDirs(repopath, commit, dir string) ([]string, error) {
+	return c.listContents(repopath, commit, dir, "dir")
+}
+
+// listContents returns the names of the dir entries of the provided type
+func (c *Client) listContents(repopath, commit, dir, entryType string) ([]string, error) {
+	owner, reponame, err := parseRepoPath(repopath)
+	if err != nil {
+		return nil, err
+	}
+	_, entries, _, err := c.client.Repositories.GetContents(context.TODO(), owner, reponame, dir, &github.RepositoryContentGetOptions{Ref: commit})
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, e := range entries {
+		if e.GetType() != entryType {
+			continue
+		}
+		names = append(names, e.GetName())
+	}
+	return names, nil
+}
+
+func (c *Client) CreateFile(repopath, branch, file, message string, content []byte) error {
+	owner, reponame, err := parseRepoPath(repopath)
+	if err != nil {
+		return err
+	}
+	if _, _, err := c.client.Repositories.CreateFile(context.TODO(), owner, reponame, file, &github.RepositoryContentFileOptions{
+		Message: github.String(message),
+		Content: content,
+		Branch:  github.String(branch),
+	}); err != nil {
+		return errors.Errorf("error creating file: %w", err)
+	}
+	return nil
+}
+
 func (c *Client) CreateDeployKey(repopath, title, pubKey string, readonly bool) error {
 	owner, reponame, err := parseRepoPath(repopath)
 	if err != nil {
@@ -358,6 +410,124 @@ func (c *Client) CreateCommitStatus(repopath, commitSHA string, status gitsource
 	return err
 }
 
+// pullRequestLineComment is a pull request review comment on a file line. It
+// isn't provided by the go-github library that only supports diff positions.
+type pullRequestLineComment struct {
+	Body     string `json:"body"`
+	CommitID string `json:"commit_id"`
+	Path     string `json:"path"`
+	Line     int    `json:"line"`
+	Side     string `json:"side"`
+}
+
+func (c *Client) CreatePullRequestComment(repopath, prID, commitSHA string, comment *gitsource.PullRequestComment) error {
+	owner, reponame, err := parseRepoPath(repopath)
+	if err != nil {
+		return err
+	}
+	number, err := strconv.Atoi(prID)
+	if err != nil {
+		return errors.Errorf("invalid pull request id %q: %w", prID, err)
+	}
+
+	req, err := c.client.NewRequest("POST", fmt.Sprintf("repos/%s/%s/pulls/%d/comments", owner, reponame, number), &pullRequestLineComment{
+		Body:     comment.Body,
+		CommitID: commitSHA,
+		Path:     comment.Path,
+		Line:     comment.Line,
+		Side:     "RIGHT",
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := c.client.Do(context.TODO(), req, nil); err == nil {
+		return nil
+	}
+
+	// the line comment fails when the line isn't part of the pull request
+	// diff, fallback to a generic pull request comment
+	_, _, err = c.client.Issues.CreateComment(context.TODO(), owner, reponame, number, &github.IssueComment{
+		Body: github.String(comment.LocationBody()),
+	})
+	return err
+}
+
+func (c *Client) ListUserOrgs() ([]*gitsource.UserOrg, error) {
+	orgs := []*gitsource.UserOrg{}
+	orgsMap := map[string]*gitsource.UserOrg{}
+
+	opt := &github.ListOrgMembershipsOptions{State: "active"}
+	for {
+		memberships, resp, err := c.client.Organizations.ListOrgMemberships(context.TODO(), opt)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range memberships {
+			org := &gitsource.UserOrg{
+				Name:  m.GetOrganization().GetLogin(),
+				Owner: m.GetRole() == "admin",
+			}
+			orgs = append(orgs, org)
+			orgsMap[org.Name] = org
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	topt := &github.ListOptions{}
+	for {
+		teams, resp, err := c.client.Teams.ListUserTeams(context.TODO(), topt)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range teams {
+			if org, ok := orgsMap[t.GetOrganization().GetLogin()]; ok {
+				org.Teams = append(org.Teams, t.GetSlug())
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		topt.Page = resp.NextPage
+	}
+
+	return orgs, nil
+}
+
+func (c *Client) ListPullRequestFiles(repopath, prID string) ([]string, error) {
+	owner, reponame, err := parseRepoPath(repopath)
+	if err != nil {
+		return nil, err
+	}
+	number, err := strconv.Atoi(prID)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	opt := &github.ListOptions{}
+	for {
+		prFiles, resp, err := c.client.PullRequests.ListFiles(context.TODO(), owner, reponame, number, opt)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range prFiles {
+			files = append(files, f.GetFilename())
+			if f.PreviousFilename != nil {
+				files = append(files, f.GetPreviousFilename())
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	return gitsource.ChangedFiles(files), nil
+}
+
 func (c *Client) ListUserRepos() ([]*gitsource.RepoInfo, error) {
 	remoteRepos := []*github.Repository{}
 
@@ -389,6 +559,86 @@ func (c *Client) ListUserRepos() ([]*gitsource.RepoInfo, error) {
 	return repos, nil
 }
 
+func (c *Client) ListRefs(repopath string) ([]*gitsource.RepoRef, error) {
+	owner, reponame, err := parseRepoPath(repopath)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := []*gitsource.RepoRef{}
+
+	opt := &github.ListOptions{}
+	for {
+		branches, resp, err := c.client.Repositories.ListBranches(context.TODO(), owner, reponame, opt)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range branches {
+			refs = append(refs, &gitsource.RepoRef{
+				Type:      gitsource.RefTypeBranch,
+				Name:      b.GetName(),
+				Ref:       c.BranchRef(b.GetName()),
+				CommitSHA: b.GetCommit().GetSHA(),
+			})
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	opt = &github.ListOptions{}
+	for {
+		tags, resp, err := c.client.Repositories.ListTags(context.TODO(), owner, reponame, opt)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tags {
+			refs = append(refs, &gitsource.RepoRef{
+				Type:      gitsource.RefTypeTag,
+				Name:      t.GetName(),
+				Ref:       c.TagRef(t.GetName()),
+				CommitSHA: t.GetCommit().GetSHA(),
+			})
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	popt := &github.PullRequestListOptions{State: "open"}
+	for {
+		prs, resp, err := c.client.PullRequests.List(context.TODO(), owner, reponame, popt)
+		if err != nil {
+			return nil, err
+		}
+		for _, pr := range prs {
+			prID := strconv.Itoa(pr.GetNumber())
+			labels := []string{}
+			for _, l := range pr.Labels {
+				labels = append(labels, l.GetName())
+			}
+			refs = append(refs, &gitsource.RepoRef{
+				Type:                    gitsource.RefTypePullRequest,
+				Name:                    prID,
+				Ref:                     c.PullRequestRef(prID),
+				CommitSHA:               pr.GetHead().GetSHA(),
+				PullRequestTitle:        pr.GetTitle(),
+				PullRequestTargetBranch: pr.GetBase().GetRef(),
+				PullRequestLabels:       labels,
+				PullRequestDraft:        pr.GetDraft(),
+			})
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		popt.Page = resp.NextPage
+	}
+
+	return refs, nil
+}
+
 func fromGithubRepo(rr *github.Repository) *gitsource.RepoInfo {
 	return &gitsource.RepoInfo{
 		ID:           strconv.FormatInt(*rr.ID, 10),
@@ -21,6 +21,7 @@ import (
 	"strconv"
 	"strings"
 
+	gitsource "agola.io/agola/internal/gitsources"
 	"agola.io/agola/internal/services/types"
 
 	"github.com/google/go-github/v25/github"
@@ -30,8 +31,10 @@ import (
 const (
 	prStateOpen = "open"
 
-	prActionOpen = "opened"
-	prActionSync = "synchronize"
+	prActionOpen          = "opened"
+	prActionSync          = "synchronize"
+	prActionLabeled       = "labeled"
+	prActionReadyToReview = "ready_for_review"
 )
 
 func (c *Client) ParseWebhook(r *http.Request, secret string) (*types.WebhookData, error) {
@@ -82,6 +85,16 @@ func webhookDataFromPush(hook *github.PushEvent) (*types.WebhookData, error) {
 		whd.BranchLink = fmt.Sprintf("%s/tree/%s", *hook.Repo.HTMLURL, whd.Branch)
 		whd.Message = *hook.HeadCommit.Message
 
+		// the changed files aren't known for a new branch or when the push
+		// payload doesn't report all the commits
+		if !hook.GetCreated() && len(hook.Commits) > 0 && hook.GetSize() == len(hook.Commits) {
+			files := [][]string{}
+			for _, c := range hook.Commits {
+				files = append(files, c.Added, c.Removed, c.Modified)
+			}
+			whd.ChangedFiles = gitsource.ChangedFiles(files...)
+		}
+
 	case strings.HasPrefix(*hook.Ref, "refs/tags/"):
 		whd.Event = types.WebhookEventTag
 		whd.Tag = strings.TrimPrefix(*hook.Ref, "refs/tags/")
@@ -107,8 +120,11 @@ func webhookDataFromPullRequest(hook *github.PullRequestEvent) (*types.WebhookDa
 	if *hook.PullRequest.State != prStateOpen {
 		return nil, nil
 	}
-	// only accept actions that have new commits
-	if *hook.Action != prActionOpen && *hook.Action != prActionSync {
+	// only accept actions that have new commits or change the pull request
+	// attributes used by the when conditions
+	switch *hook.Action {
+	case prActionOpen, prActionSync, prActionLabeled, prActionReadyToReview:
+	default:
 		return nil, nil
 	}
 
@@ -117,6 +133,11 @@ func webhookDataFromPullRequest(hook *github.PullRequestEvent) (*types.WebhookDa
 		sender = hook.Sender.Login
 	}
 
+	labels := []string{}
+	for _, label := range hook.PullRequest.Labels {
+		labels = append(labels, label.GetName())
+	}
+
 	whd := &types.WebhookData{
 		Event:           types.WebhookEventPullRequest,
 		CommitSHA:       *hook.PullRequest.Head.SHA,
@@ -129,6 +150,12 @@ func webhookDataFromPullRequest(hook *github.PullRequestEvent) (*types.WebhookDa
 		PullRequestID:   strconv.Itoa(*hook.PullRequest.Number),
 		PullRequestLink: *hook.PullRequest.HTMLURL,
 
+		PullRequestAttributes: &types.PullRequestAttributes{
+			Draft:        hook.PullRequest.GetDraft(),
+			Labels:       labels,
+			TargetBranch: *hook.PullRequest.Base.Ref,
+		},
+
 		Repo: types.WebhookDataRepo{
 			Path:   path.Join(*hook.Repo.Owner.Login, *hook.Repo.Name),
 			WebURL: *hook.Repo.HTMLURL,
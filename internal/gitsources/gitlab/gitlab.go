@@ -52,6 +52,7 @@ type Opts struct {
 
 type Client struct {
 	client         *gitlab.Client
+	httpClient     *http.Client
 	APIURL         string
 	oauth2ClientID string
 	oauth2Secret   string
@@ -96,6 +97,7 @@ func New(opts Opts) (*Client, error) {
 
 	return &Client{
 		client:         client,
+		httpClient:     httpClient,
 		APIURL:         opts.APIURL,
 		oauth2ClientID: opts.Oauth2ClientID,
 		oauth2Secret:   opts.Oauth2Secret,
@@ -136,6 +138,14 @@ func (c *Client) RefreshOauth2Token(refreshToken string) (*oauth2.Token, error)
 	return ts.Token()
 }
 
+func (c *Client) CheckAPI() error {
+	return gitsource.CheckHTTPEndpoint(c.httpClient, c.APIURL+"/api/v4/version")
+}
+
+func (c *Client) CheckOauth2Client(callbackURL string) error {
+	return gitsource.CheckOauth2Client(c.httpClient, c.oauth2Config(callbackURL))
+}
+
 func (c *Client) GetRepoInfo(repopath string) (*gitsource.RepoInfo, error) {
 	rr, _, err := c.client.Projects.GetProject(repopath)
 	if err != nil {
@@ -168,6 +178,48 @@ func (c *Client) GetFile(repopath, commit, file string) ([]byte, error) {
 	return data, err
 }
 
+func (c *Client) ListFiles(repopath, commit, dir string) ([]string, error) {
+	return c.listTree(repopath, commit, dir, "blob")
+}
+
+func (c *Client) ListDirs(repopath, commit, dir string) ([]string, error) {
+	return c.listTree(repopath, commit, dir, "tree")
+}
+
+// listTree returns the names of the dir tree nodes of the provided type
+func (c *Client) listTree(repopath, commit, dir, nodeType string) ([]string, error) {
+	opts := &gitlab.ListTreeOptions{Ref: gitlab.String(commit)}
+	if dir != "" {
+		opts.Path = gitlab.String(dir)
+	}
+	nodes, _, err := c.client.Repositories.ListTree(repopath, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, n := range nodes {
+		if n.Type != nodeType {
+			continue
+		}
+		names = append(names, n.Name)
+	}
+	return names, nil
+}
+
+func (c *Client) CreateFile(repopath, branch, file, message string, content []byte) error {
+	if _, _, err := c.client.RepositoryFiles.CreateFile(repopath, file, &gitlab.CreateFileOptions{
+		Branch:        gitlab.String(branch),
+		Encoding:      gitlab.String("base64"),
+		Content:       gitlab.String(base64.StdEncoding.EncodeToString(content)),
+		CommitMessage: gitlab.String(message),
+	}); err != nil {
+		return errors.Errorf("error creating file: %w", err)
+	}
+
+	return nil
+}
+
 func (c *Client) CreateDeployKey(repopath, title, pubKey string, readonly bool) error {
 	if _, _, err := c.client.DeployKeys.AddDeployKey(repopath, &gitlab.AddDeployKeyOptions{
 		Title: gitlab.String(title),
@@ -267,6 +319,37 @@ func (c *Client) CreateCommitStatus(repopath, commitSHA string, status gitsource
 	return err
 }
 
+func (c *Client) CreatePullRequestComment(repopath, prID, commitSHA string, comment *gitsource.PullRequestComment) error {
+	mrIID, err := strconv.Atoi(prID)
+	if err != nil {
+		return errors.Errorf("invalid merge request id %q: %w", prID, err)
+	}
+	// line comments require the merge request diff refs so just create a
+	// generic merge request comment
+	_, _, err = c.client.Notes.CreateMergeRequestNote(repopath, mrIID, &gitlab.CreateMergeRequestNoteOptions{
+		Body: gitlab.String(comment.LocationBody()),
+	})
+	return err
+}
+
+func (c *Client) ListPullRequestFiles(repopath, prID string) ([]string, error) {
+	mrIID, err := strconv.Atoi(prID)
+	if err != nil {
+		return nil, err
+	}
+	mr, _, err := c.client.MergeRequests.GetMergeRequestChanges(repopath, mrIID)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	for _, c := range mr.Changes {
+		files = append(files, c.OldPath, c.NewPath)
+	}
+
+	return gitsource.ChangedFiles(files), nil
+}
+
 func (c *Client) ListUserRepos() ([]*gitsource.RepoInfo, error) {
 	// get only repos with permission greater or equal to maintainer
 	opts := &gitlab.ListProjectsOptions{MinAccessLevel: gitlab.AccessLevel(gitlab.MaintainerPermissions)}
@@ -284,6 +367,77 @@ func (c *Client) ListUserRepos() ([]*gitsource.RepoInfo, error) {
 	return repos, nil
 }
 
+func (c *Client) ListRefs(repopath string) ([]*gitsource.RepoRef, error) {
+	refs := []*gitsource.RepoRef{}
+
+	bopts := &gitlab.ListBranchesOptions{}
+	for {
+		branches, resp, err := c.client.Branches.ListBranches(repopath, bopts)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range branches {
+			refs = append(refs, &gitsource.RepoRef{
+				Type:      gitsource.RefTypeBranch,
+				Name:      b.Name,
+				Ref:       c.BranchRef(b.Name),
+				CommitSHA: b.Commit.ID,
+			})
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		bopts.Page = resp.NextPage
+	}
+
+	topts := &gitlab.ListTagsOptions{}
+	for {
+		tags, resp, err := c.client.Tags.ListTags(repopath, topts)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tags {
+			refs = append(refs, &gitsource.RepoRef{
+				Type:      gitsource.RefTypeTag,
+				Name:      t.Name,
+				Ref:       c.TagRef(t.Name),
+				CommitSHA: t.Commit.ID,
+			})
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		topts.Page = resp.NextPage
+	}
+
+	mopts := &gitlab.ListProjectMergeRequestsOptions{State: gitlab.String("opened")}
+	for {
+		mrs, resp, err := c.client.MergeRequests.ListProjectMergeRequests(repopath, mopts)
+		if err != nil {
+			return nil, err
+		}
+		for _, mr := range mrs {
+			prID := strconv.Itoa(mr.IID)
+			refs = append(refs, &gitsource.RepoRef{
+				Type:                    gitsource.RefTypePullRequest,
+				Name:                    prID,
+				Ref:                     c.PullRequestRef(prID),
+				CommitSHA:               mr.SHA,
+				PullRequestTitle:        mr.Title,
+				PullRequestTargetBranch: mr.TargetBranch,
+				PullRequestLabels:       mr.Labels,
+				PullRequestDraft:        mr.WorkInProgress,
+			})
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		mopts.Page = resp.NextPage
+	}
+
+	return refs, nil
+}
+
 func fromGitlabRepo(rr *gitlab.Project) *gitsource.RepoInfo {
 	return &gitsource.RepoInfo{
 		ID:           strconv.Itoa(rr.ID),
@@ -23,6 +23,7 @@ import (
 	"strconv"
 	"strings"
 
+	gitsource "agola.io/agola/internal/gitsources"
 	"agola.io/agola/internal/services/types"
 
 	errors "golang.org/x/xerrors"
@@ -35,6 +36,9 @@ const (
 	hookPush        = "Push Hook"
 	hookTagPush     = "Tag Push Hook"
 	hookPullRequest = "Merge Request Hook"
+
+	// emptyCommitSHA is the push before commit sha of a new branch
+	emptyCommitSHA = "0000000000000000000000000000000000000000"
 )
 
 func (c *Client) ParseWebhook(r *http.Request, secret string) (*types.WebhookData, error) {
@@ -122,6 +126,16 @@ func webhookDataFromPush(hook *pushHook) (*types.WebhookData, error) {
 		if len(hook.Commits) > 0 {
 			whd.Message = hook.Commits[0].Message
 		}
+
+		// the changed files aren't known for a new branch or when the push
+		// payload doesn't report all the commits
+		if hook.Before != emptyCommitSHA && len(hook.Commits) > 0 && hook.TotalCommitsCount == len(hook.Commits) {
+			files := [][]string{}
+			for _, c := range hook.Commits {
+				files = append(files, c.Added, c.Removed, c.Modified)
+			}
+			whd.ChangedFiles = gitsource.ChangedFiles(files...)
+		}
 	case strings.HasPrefix(hook.Ref, "refs/tags/"):
 		whd.Event = types.WebhookEventTag
 		whd.Tag = strings.TrimPrefix(hook.Ref, "refs/tags/")
@@ -146,6 +160,10 @@ func webhookDataFromPullRequest(hook *pullRequestHook) *types.WebhookData {
 	//if sender == "" {
 	//	sender := hook.ObjectAttributes.LastCommit.Author.UserName
 	//}
+	labels := []string{}
+	for _, label := range hook.Labels {
+		labels = append(labels, label.Title)
+	}
 	build := &types.WebhookData{
 		Event:     types.WebhookEventPullRequest,
 		CommitSHA: hook.ObjectAttributes.LastCommit.ID,
@@ -159,6 +177,12 @@ func webhookDataFromPullRequest(hook *pullRequestHook) *types.WebhookData {
 		PullRequestID:   strconv.Itoa(hook.ObjectAttributes.Iid),
 		PullRequestLink: hook.ObjectAttributes.URL,
 
+		PullRequestAttributes: &types.PullRequestAttributes{
+			Draft:        hook.ObjectAttributes.WorkInProgress,
+			Labels:       labels,
+			TargetBranch: hook.ObjectAttributes.TargetBranch,
+		},
+
 		Repo: types.WebhookDataRepo{
 			Path:   hook.Project.PathWithNamespace,
 			WebURL: hook.Project.WebURL,
@@ -53,6 +53,8 @@ type pushHook struct {
 			Name  string `json:"name"`
 			Email string `json:"email"`
 		} `json:"author"`
+		Added    []string `json:"added"`
+		Removed  []string `json:"removed"`
 		Modified []string `json:"modified"`
 	} `json:"commits"`
 	TotalCommitsCount int `json:"total_commits_count"`
@@ -150,6 +152,9 @@ type pullRequestHook struct {
 		WorkInProgress bool `json:"work_in_progress"`
 		TotalTimeSpent int  `json:"total_time_spent"`
 	} `json:"object_attributes"`
+	Labels []struct {
+		Title string `json:"title"`
+	} `json:"labels"`
 	Changes struct {
 		TotalTimeSpent struct {
 			Current int `json:"current"`
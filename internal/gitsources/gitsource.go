@@ -16,7 +16,9 @@ package gitsource
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"sort"
 
 	"agola.io/agola/internal/services/types"
 	"golang.org/x/oauth2"
@@ -36,6 +38,14 @@ var ErrUnauthorized = errors.New("unauthorized")
 type GitSource interface {
 	GetRepoInfo(repopath string) (*RepoInfo, error)
 	GetFile(repopath, commit, file string) ([]byte, error)
+	// ListFiles returns the names of the files inside dir. Subdirectories
+	// aren't reported.
+	ListFiles(repopath, commit, dir string) ([]string, error)
+	// ListDirs returns the names of the subdirectories of dir. An empty dir
+	// is the repository root directory
+	ListDirs(repopath, commit, dir string) ([]string, error)
+	// CreateFile creates a new file in the provided branch
+	CreateFile(repopath, branch, file, message string, content []byte) error
 	DeleteDeployKey(repopath, title string) error
 	CreateDeployKey(repopath, title, pubKey string, readonly bool) error
 	UpdateDeployKey(repopath, title, pubKey string, readonly bool) error
@@ -43,6 +53,10 @@ type GitSource interface {
 	CreateRepoWebhook(repopath, url, secret string) error
 	ParseWebhook(r *http.Request, secret string) (*types.WebhookData, error)
 	CreateCommitStatus(repopath, commitSHA string, status CommitStatus, targetURL, description, context string) error
+	// CreatePullRequestComment creates a comment on a file line of the pull
+	// request. Git sources that cannot comment a file line create a generic
+	// pull request comment
+	CreatePullRequestComment(repopath, prID, commitSHA string, comment *PullRequestComment) error
 	// ListUserRepos report repos where the user has the permission to create deploy keys and webhooks
 	ListUserRepos() ([]*RepoInfo, error)
 	GetRef(repopath, ref string) (*Ref, error)
@@ -80,6 +94,25 @@ type Oauth2Source interface {
 	RefreshOauth2Token(refreshToken string) (*oauth2.Token, error)
 }
 
+// OrgSource is implemented by the git sources that can report the
+// organizations and teams the user is a member of
+type OrgSource interface {
+	ListUserOrgs() ([]*UserOrg, error)
+}
+
+// RefsSource is implemented by the git sources that can list the repository
+// branches, tags and open pull requests. It's used to poll the repositories
+// whose git source cannot deliver the webhooks
+type RefsSource interface {
+	ListRefs(repopath string) ([]*RepoRef, error)
+}
+
+// PullRequestFilesSource is implemented by the git sources that can report
+// the files changed by a pull request
+type PullRequestFilesSource interface {
+	ListPullRequestFiles(repopath, prID string) ([]string, error)
+}
+
 type RepoInfo struct {
 	ID           string
 	Path         string
@@ -94,6 +127,15 @@ type UserInfo struct {
 	Email     string
 }
 
+type UserOrg struct {
+	// Name is the remote organization name
+	Name string
+	// Owner reports if the user is an owner of the organization
+	Owner bool
+	// Teams are the names of the organization teams the user is a member of
+	Teams []string
+}
+
 type RefType int
 
 const (
@@ -107,7 +149,50 @@ type Ref struct {
 	CommitSHA string
 }
 
+type RepoRef struct {
+	Type RefType
+	// Name is the branch name, the tag name or the pull request id
+	Name      string
+	Ref       string
+	CommitSHA string
+
+	// pull request fields, set only when Type is RefTypePullRequest
+	PullRequestTitle        string
+	PullRequestTargetBranch string
+	PullRequestLabels       []string
+	PullRequestDraft        bool
+}
+
 type Commit struct {
 	SHA     string
 	Message string
 }
+
+type PullRequestComment struct {
+	Path string
+	Line int
+	Body string
+}
+
+// LocationBody returns the comment body prefixed by the commented file line.
+// It's used when the comment cannot be attached to the file line.
+func (c *PullRequestComment) LocationBody() string {
+	return fmt.Sprintf("`%s` line %d: %s", c.Path, c.Line, c.Body)
+}
+
+// ChangedFiles merges the provided lists of changed file paths removing the
+// duplicates. The returned paths are sorted.
+func ChangedFiles(lists ...[]string) []string {
+	filesMap := map[string]struct{}{}
+	for _, l := range lists {
+		for _, f := range l {
+			filesMap[f] = struct{}{}
+		}
+	}
+	files := make([]string, 0, len(filesMap))
+	for f := range filesMap {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	return files
+}
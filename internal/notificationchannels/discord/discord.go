@@ -0,0 +1,99 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discord
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	notificationchannel "agola.io/agola/internal/notificationchannels"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	SecretWebhookURL = "webhook_url"
+
+	colorSuccess = 0x28a745
+	colorFailed  = 0xd73a49
+)
+
+type Opts struct {
+	WebhookURL string
+}
+
+// Client sends the messages to a discord channel using a channel webhook
+type Client struct {
+	client     *http.Client
+	webhookURL string
+}
+
+func New(opts Opts) (*Client, error) {
+	if opts.WebhookURL == "" {
+		return nil, errors.Errorf("empty discord webhook url")
+	}
+
+	return &Client{
+		client:     &http.Client{Timeout: 30 * time.Second},
+		webhookURL: opts.WebhookURL,
+	}, nil
+}
+
+type embed struct {
+	Title       string `json:"title"`
+	URL         string `json:"url,omitempty"`
+	Description string `json:"description,omitempty"`
+	Color       int    `json:"color"`
+}
+
+type webhookMessage struct {
+	Embeds []*embed `json:"embeds"`
+}
+
+func (c *Client) Send(ctx context.Context, m *notificationchannel.Message) error {
+	e := &embed{
+		Title:       m.Title,
+		URL:         m.URL,
+		Description: strings.Join(m.Lines, "\n"),
+		Color:       colorSuccess,
+	}
+	if m.Failed {
+		e.Color = colorFailed
+	}
+	msgj, err := json.Marshal(&webhookMessage{Embeds: []*embed{e}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", c.webhookURL, bytes.NewReader(msgj))
+	if err != nil {
+		// don't leak the webhook url, it contains the webhook token
+		return errors.Errorf("invalid discord webhook url")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return errors.Errorf("failed to send discord message")
+	}
+	defer resp.Body.Close()
+
+	return notificationchannel.CheckResponse(resp)
+}
@@ -0,0 +1,125 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	notificationchannel "agola.io/agola/internal/notificationchannels"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	OptionHomeserverURL = "homeserver_url"
+	OptionRoomID        = "room_id"
+
+	SecretAccessToken = "access_token"
+)
+
+type Opts struct {
+	HomeserverURL string
+	RoomID        string
+	AccessToken   string
+}
+
+// Client sends the messages to a matrix room using the client-server API
+type Client struct {
+	client        *http.Client
+	homeserverURL string
+	roomID        string
+	accessToken   string
+}
+
+func New(opts Opts) (*Client, error) {
+	if opts.HomeserverURL == "" {
+		return nil, errors.Errorf("empty matrix homeserver url")
+	}
+	if opts.RoomID == "" {
+		return nil, errors.Errorf("empty matrix room id")
+	}
+	if opts.AccessToken == "" {
+		return nil, errors.Errorf("empty matrix access token")
+	}
+
+	return &Client{
+		client:        &http.Client{Timeout: 30 * time.Second},
+		homeserverURL: strings.TrimSuffix(opts.HomeserverURL, "/"),
+		roomID:        opts.RoomID,
+		accessToken:   opts.AccessToken,
+	}, nil
+}
+
+type roomMessage struct {
+	MsgType       string `json:"msgtype"`
+	Body          string `json:"body"`
+	Format        string `json:"format,omitempty"`
+	FormattedBody string `json:"formatted_body,omitempty"`
+}
+
+func formattedBody(m *notificationchannel.Message) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<b>%s</b>", html.EscapeString(m.Title))
+	for _, line := range m.Lines {
+		fmt.Fprintf(&b, "<br>%s", html.EscapeString(line))
+	}
+	if m.URL != "" {
+		fmt.Fprintf(&b, "<br><a href=\"%s\">%s</a>", html.EscapeString(m.URL), html.EscapeString(m.URL))
+	}
+	return b.String()
+}
+
+func (c *Client) Send(ctx context.Context, m *notificationchannel.Message) error {
+	msg := &roomMessage{
+		MsgType:       "m.text",
+		Body:          m.Text(),
+		Format:        "org.matrix.custom.html",
+		FormattedBody: formattedBody(m),
+	}
+	msgj, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	// the transaction id makes the request idempotent, it must be unique for
+	// every message sent with the same access token
+	txnID := "agola-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	u := fmt.Sprintf("%s/_matrix/client/r0/rooms/%s/send/m.room.message/%s", c.homeserverURL, url.PathEscape(c.roomID), txnID)
+
+	req, err := http.NewRequest("PUT", u, bytes.NewReader(msgj))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.accessToken)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return notificationchannel.CheckResponse(resp)
+}
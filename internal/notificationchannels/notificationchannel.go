@@ -0,0 +1,62 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notificationchannel
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	errors "golang.org/x/xerrors"
+)
+
+// Message is a run notification message
+type Message struct {
+	// Title is a short summary of the run result
+	Title string
+	// Lines are the message details
+	Lines []string
+	// URL is the run web page url
+	URL string
+	// Failed reports if the run failed, it's used by the channels supporting
+	// colored messages
+	Failed bool
+}
+
+// Text returns the message as plain text
+func (m *Message) Text() string {
+	lines := append([]string{m.Title}, m.Lines...)
+	if m.URL != "" {
+		lines = append(lines, m.URL)
+	}
+	return strings.Join(lines, "\n")
+}
+
+type Channel interface {
+	Send(ctx context.Context, m *Message) error
+}
+
+// CheckResponse returns an error containing the response body when the
+// response status code isn't a 2xx one
+func CheckResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	// limit the error body, some services return entire html pages
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return errors.Errorf("unexpected http status code: %d, body: %q", resp.StatusCode, string(body))
+}
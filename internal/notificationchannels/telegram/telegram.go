@@ -0,0 +1,107 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	notificationchannel "agola.io/agola/internal/notificationchannels"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	OptionChatID = "chat_id"
+	// OptionAPIURL is the optional bot API url, it defaults to the telegram
+	// one and can be changed to use a local bot API server
+	OptionAPIURL = "api_url"
+
+	SecretBotToken = "bot_token"
+
+	DefaultAPIURL = "https://api.telegram.org"
+)
+
+type Opts struct {
+	APIURL   string
+	ChatID   string
+	BotToken string
+}
+
+// Client sends the messages to a telegram chat using the bot API
+type Client struct {
+	client   *http.Client
+	apiURL   string
+	chatID   string
+	botToken string
+}
+
+func New(opts Opts) (*Client, error) {
+	if opts.ChatID == "" {
+		return nil, errors.Errorf("empty telegram chat id")
+	}
+	if opts.BotToken == "" {
+		return nil, errors.Errorf("empty telegram bot token")
+	}
+	apiURL := opts.APIURL
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+
+	return &Client{
+		client:   &http.Client{Timeout: 30 * time.Second},
+		apiURL:   strings.TrimSuffix(apiURL, "/"),
+		chatID:   opts.ChatID,
+		botToken: opts.BotToken,
+	}, nil
+}
+
+type sendMessageRequest struct {
+	ChatID                string `json:"chat_id"`
+	Text                  string `json:"text"`
+	DisableWebPagePreview bool   `json:"disable_web_page_preview"`
+}
+
+func (c *Client) Send(ctx context.Context, m *notificationchannel.Message) error {
+	msg := &sendMessageRequest{
+		ChatID:                c.chatID,
+		Text:                  m.Text(),
+		DisableWebPagePreview: true,
+	}
+	msgj, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", c.apiURL+"/bot"+c.botToken+"/sendMessage", bytes.NewReader(msgj))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		// don't leak the bot token contained in the request url
+		return errors.Errorf("failed to send telegram message")
+	}
+	defer resp.Body.Close()
+
+	return notificationchannel.CheckResponse(resp)
+}
@@ -0,0 +1,453 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"agola.io/agola/internal/objectstorage/common"
+	"agola.io/agola/internal/objectstorage/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	apiVersion = "2019-02-02"
+
+	// blockSize is the size of the blocks of a block blob. Objects smaller
+	// than it are uploaded with a single request.
+	blockSize = 16 * 1024 * 1024
+)
+
+type blobList struct {
+	Blobs struct {
+		Blob []struct {
+			Name       string `xml:"Name"`
+			Properties struct {
+				LastModified string `xml:"Last-Modified"`
+			} `xml:"Properties"`
+		} `xml:"Blob"`
+	} `xml:"Blobs"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+type blockList struct {
+	XMLName xml.Name `xml:"BlockList"`
+	Latest  []string `xml:"Latest"`
+}
+
+type AzureStorage struct {
+	accountName string
+	accountKey  []byte
+	container   string
+	endpoint    string
+	client      *http.Client
+}
+
+// New creates a new azure blob storage objectstorage using the storage account
+// shared key authentication. If endpoint is empty the default account endpoint
+// (https://$accountname.blob.core.windows.net) is used. The container is
+// created if it doesn't exist.
+func New(accountName, accountKey, container, endpoint string) (*AzureStorage, error) {
+	if accountName == "" {
+		return nil, errors.Errorf("empty account name")
+	}
+	if container == "" {
+		return nil, errors.Errorf("empty container")
+	}
+	key, err := base64.StdEncoding.DecodeString(accountKey)
+	if err != nil {
+		return nil, errors.Errorf("failed to decode account key: %w", err)
+	}
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", accountName)
+	}
+
+	s := &AzureStorage{
+		accountName: accountName,
+		accountKey:  key,
+		container:   container,
+		endpoint:    strings.TrimSuffix(endpoint, "/"),
+		client:      &http.Client{},
+	}
+
+	resp, err := s.do("PUT", s.containerURL(url.Values{"restype": {"container"}}), nil, nil)
+	if err != nil {
+		return nil, errors.Errorf("cannot create container %q: %w", container, err)
+	}
+	defer resp.Body.Close()
+	// StatusConflict is returned when the container already exists
+	if resp.StatusCode != http.StatusConflict {
+		if err := checkResponse(resp); err != nil {
+			return nil, errors.Errorf("cannot create container %q: %w", container, err)
+		}
+	}
+
+	return s, nil
+}
+
+func (s *AzureStorage) containerURL(q url.Values) string {
+	u := fmt.Sprintf("%s/%s", s.endpoint, url.PathEscape(s.container))
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	return u
+}
+
+func (s *AzureStorage) blobURL(p string, q url.Values) string {
+	// keep the slashes in the blob name unescaped
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	u := fmt.Sprintf("%s/%s/%s", s.endpoint, url.PathEscape(s.container), strings.Join(parts, "/"))
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	return u
+}
+
+// do executes a signed request with retries. body must be replayable so it's
+// provided as a byte slice.
+func (s *AzureStorage) do(method, u string, header http.Header, body []byte) (*http.Response, error) {
+	return common.DoRequest(s.client, common.DefaultRequestRetries, func() (*http.Request, error) {
+		var r io.Reader
+		if body != nil {
+			r = bytes.NewReader(body)
+		}
+		req, err := http.NewRequest(method, u, r)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if err := s.sign(req); err != nil {
+			return nil, err
+		}
+		return req, nil
+	})
+}
+
+// sign adds the shared key authorization header to the request
+func (s *AzureStorage) sign(req *http.Request) error {
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", apiVersion)
+
+	contentLength := ""
+	if req.ContentLength > 0 {
+		contentLength = strconv.FormatInt(req.ContentLength, 10)
+	}
+
+	// canonicalized headers
+	msHeaders := []string{}
+	for k := range req.Header {
+		k = strings.ToLower(k)
+		if strings.HasPrefix(k, "x-ms-") {
+			msHeaders = append(msHeaders, k)
+		}
+	}
+	sort.Strings(msHeaders)
+	canonicalizedHeaders := ""
+	for _, k := range msHeaders {
+		canonicalizedHeaders += k + ":" + strings.TrimSpace(req.Header.Get(k)) + "\n"
+	}
+
+	// canonicalized resource
+	canonicalizedResource := "/" + s.accountName + req.URL.EscapedPath()
+	q := req.URL.Query()
+	qKeys := []string{}
+	for k := range q {
+		qKeys = append(qKeys, k)
+	}
+	sort.Strings(qKeys)
+	for _, k := range qKeys {
+		values := q[k]
+		sort.Strings(values)
+		canonicalizedResource += "\n" + strings.ToLower(k) + ":" + strings.Join(values, ",")
+	}
+
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		contentLength,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date, x-ms-date is used
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		canonicalizedHeaders + canonicalizedResource,
+	}, "\n")
+
+	h := hmac.New(sha256.New, s.accountKey)
+	if _, err := h.Write([]byte(stringToSign)); err != nil {
+		return err
+	}
+	signature := base64.StdEncoding.EncodeToString(h.Sum(nil))
+	req.Header.Set("Authorization", fmt.Sprintf("SharedKey %s:%s", s.accountName, signature))
+
+	return nil
+}
+
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	return errors.Errorf("unexpected response status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+}
+
+func (s *AzureStorage) stat(p string) (int64, time.Time, error) {
+	resp, err := s.do("HEAD", s.blobURL(p, nil), nil, nil)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return 0, time.Time{}, types.ErrNotExist
+	}
+	if err := checkResponse(resp); err != nil {
+		return 0, time.Time{}, err
+	}
+
+	lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	if err != nil {
+		return 0, time.Time{}, errors.Errorf("failed to parse last modified time: %w", err)
+	}
+	return resp.ContentLength, lastModified, nil
+}
+
+func (s *AzureStorage) Stat(p string) (*types.ObjectInfo, error) {
+	_, lastModified, err := s.stat(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.ObjectInfo{Path: p, LastModified: lastModified}, nil
+}
+
+func (s *AzureStorage) ReadObject(p string) (types.ReadSeekCloser, error) {
+	size, _, err := s.stat(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return common.NewRangeReader(size, func(offset int64) (io.ReadCloser, error) {
+		header := http.Header{}
+		if offset > 0 {
+			header.Set("x-ms-range", fmt.Sprintf("bytes=%d-", offset))
+		}
+		resp, err := s.do("GET", s.blobURL(p, nil), header, nil)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			return nil, types.ErrNotExist
+		}
+		if err := checkResponse(resp); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		return resp.Body, nil
+	}), nil
+}
+
+// WriteObject uploads the object with a single put blob request if it's
+// smaller than blockSize, otherwise it uploads blockSize blocks and then
+// commits the block list so objects of unknown size can be streamed without
+// keeping them in memory.
+func (s *AzureStorage) WriteObject(p string, data io.Reader, size int64, persist bool) error {
+	blockIDs := []string{}
+	for {
+		buf := make([]byte, blockSize)
+		n, err := io.ReadFull(data, buf)
+		eof := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !eof {
+			return err
+		}
+		buf = buf[:n]
+
+		if eof && len(blockIDs) == 0 {
+			return s.putBlob(p, buf)
+		}
+		if n > 0 {
+			// all the block ids of a blob must have the same length
+			blockID := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%010d", len(blockIDs))))
+			if err := s.putBlock(p, blockID, buf); err != nil {
+				return err
+			}
+			blockIDs = append(blockIDs, blockID)
+		}
+		if eof {
+			return s.putBlockList(p, blockIDs)
+		}
+	}
+}
+
+func (s *AzureStorage) putBlob(p string, data []byte) error {
+	header := http.Header{}
+	header.Set("x-ms-blob-type", "BlockBlob")
+	header.Set("Content-Type", "application/octet-stream")
+	resp, err := s.do("PUT", s.blobURL(p, nil), header, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp)
+}
+
+func (s *AzureStorage) putBlock(p, blockID string, data []byte) error {
+	resp, err := s.do("PUT", s.blobURL(p, url.Values{"comp": {"block"}, "blockid": {blockID}}), nil, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp)
+}
+
+func (s *AzureStorage) putBlockList(p string, blockIDs []string) error {
+	data, err := xml.Marshal(&blockList{Latest: blockIDs})
+	if err != nil {
+		return err
+	}
+	data = append([]byte(xml.Header), data...)
+
+	header := http.Header{}
+	header.Set("x-ms-blob-content-type", "application/octet-stream")
+	header.Set("Content-Type", "application/xml")
+	resp, err := s.do("PUT", s.blobURL(p, url.Values{"comp": {"blocklist"}}), header, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp)
+}
+
+func (s *AzureStorage) DeleteObject(p string) error {
+	resp, err := s.do("DELETE", s.blobURL(p, nil), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return types.ErrNotExist
+	}
+	return checkResponse(resp)
+}
+
+func (s *AzureStorage) List(prefix, startWith, delimiter string, doneCh <-chan struct{}) <-chan types.ObjectInfo {
+	objectCh := make(chan types.ObjectInfo, 1)
+
+	if len(delimiter) > 1 {
+		objectCh <- types.ObjectInfo{Err: errors.Errorf("wrong delimiter %q", delimiter)}
+		return objectCh
+	}
+
+	// remove leading slash
+	if strings.HasPrefix(prefix, "/") {
+		prefix = strings.TrimPrefix(prefix, "/")
+	}
+	if strings.HasPrefix(startWith, "/") {
+		startWith = strings.TrimPrefix(startWith, "/")
+	}
+
+	go func(objectCh chan<- types.ObjectInfo) {
+		defer close(objectCh)
+		var marker string
+		for {
+			q := url.Values{}
+			q.Set("restype", "container")
+			q.Set("comp", "list")
+			q.Set("maxresults", "1000")
+			if prefix != "" {
+				q.Set("prefix", prefix)
+			}
+			if delimiter != "" {
+				q.Set("delimiter", delimiter)
+			}
+			if marker != "" {
+				q.Set("marker", marker)
+			}
+
+			result, err := s.listPage(q)
+			if err != nil {
+				objectCh <- types.ObjectInfo{Err: err}
+				return
+			}
+
+			for _, b := range result.Blobs.Blob {
+				// azure doesn't support listing starting at a specific name so
+				// skip the previous ones
+				if b.Name <= startWith {
+					continue
+				}
+				lastModified, err := http.ParseTime(b.Properties.LastModified)
+				if err != nil {
+					objectCh <- types.ObjectInfo{Err: errors.Errorf("failed to parse last modified time: %w", err)}
+					return
+				}
+				select {
+				// Send object content.
+				case objectCh <- types.ObjectInfo{Path: b.Name, LastModified: lastModified}:
+				// If receives done from the caller, return here.
+				case <-doneCh:
+					return
+				}
+			}
+
+			if result.NextMarker == "" {
+				return
+			}
+			marker = result.NextMarker
+		}
+	}(objectCh)
+
+	return objectCh
+}
+
+func (s *AzureStorage) listPage(q url.Values) (*blobList, error) {
+	resp, err := s.do("GET", s.containerURL(q), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+
+	var result *blobList
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
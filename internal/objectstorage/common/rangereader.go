@@ -0,0 +1,83 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"io"
+
+	errors "golang.org/x/xerrors"
+)
+
+// RangeReader implements types.ReadSeekCloser for remote objects that can be
+// read starting at a specified offset (like using http range requests).
+// The object is opened lazily at the first read after a seek.
+type RangeReader struct {
+	size   int64
+	offset int64
+	r      io.ReadCloser
+	open   func(offset int64) (io.ReadCloser, error)
+}
+
+func NewRangeReader(size int64, open func(offset int64) (io.ReadCloser, error)) *RangeReader {
+	return &RangeReader{size: size, open: open}
+}
+
+func (r *RangeReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.r == nil {
+		rc, err := r.open(r.offset)
+		if err != nil {
+			return 0, err
+		}
+		r.r = rc
+	}
+	n, err := r.r.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *RangeReader) Seek(offset int64, whence int) (int64, error) {
+	var newOffset int64
+	switch whence {
+	case io.SeekStart:
+		newOffset = offset
+	case io.SeekCurrent:
+		newOffset = r.offset + offset
+	case io.SeekEnd:
+		newOffset = r.size + offset
+	default:
+		return 0, errors.Errorf("invalid whence %d", whence)
+	}
+	if newOffset < 0 {
+		return 0, errors.Errorf("negative offset %d", newOffset)
+	}
+	if newOffset != r.offset && r.r != nil {
+		r.r.Close()
+		r.r = nil
+	}
+	r.offset = newOffset
+	return newOffset, nil
+}
+
+func (r *RangeReader) Close() error {
+	if r.r == nil {
+		return nil
+	}
+	err := r.r.Close()
+	r.r = nil
+	return err
+}
@@ -0,0 +1,60 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const (
+	DefaultRequestRetries = 5
+
+	requestRetryInitialInterval = 500 * time.Millisecond
+)
+
+// DoRequest executes the request returned by newRequest retrying it with an
+// exponential backoff on network errors and on server side errors (5xx and
+// 429). newRequest is called at every try so the request body must be
+// replayable.
+func DoRequest(client *http.Client, retries int, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	interval := requestRetryInitialInterval
+	for i := 0; ; i++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err == nil && !isRetryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		if i >= retries {
+			return resp, err
+		}
+		if err == nil {
+			// drain and close the body to reuse the connection
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		time.Sleep(interval)
+		interval *= 2
+	}
+}
+
+func isRetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
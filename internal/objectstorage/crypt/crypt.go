@@ -0,0 +1,477 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+
+	"agola.io/agola/internal/objectstorage"
+	"agola.io/agola/internal/objectstorage/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+// Encrypted objects format:
+//
+//	header: magic | version (1 byte) | key id length (1 byte) | key id | nonce prefix (8 bytes)
+//	chunks: AES-GCM sealed chunks of chunkSize bytes of plaintext (the last one
+//	can be shorter or empty)
+//
+// Every chunk nonce is the object random nonce prefix followed by the chunk
+// index (4 bytes big endian). The chunk additional data reports if the chunk
+// is the last one to detect truncated objects.
+// Splitting the object in chunks permits streaming objects of unknown size
+// and seeking without decrypting all the previous data.
+const (
+	magic   = "AGOLAENC"
+	version = 1
+
+	chunkSize       = 64 * 1024
+	noncePrefixSize = 8
+)
+
+type Key struct {
+	ID string
+	// Key is an AES key of 16, 24 or 32 bytes
+	Key []byte
+}
+
+// CryptStorage wraps an objectstorage.Storage encrypting all the written objects and
+// decrypting them when read.
+// The first key is used to encrypt new objects while all the keys are used to
+// decrypt. A key can be rotated adding a new key as the first one and then
+// reencrypting the existing objects (see Reencrypt) before removing the old key.
+type CryptStorage struct {
+	s objectstorage.Storage
+
+	writeKeyID string
+	aeads      map[string]cipher.AEAD
+
+	allowUnencrypted bool
+}
+
+// New returns a new CryptStorage. If allowUnencrypted is true the objects that
+// aren't encrypted (like the ones written before enabling the encryption) are
+// returned as is instead of returning an error.
+func New(s objectstorage.Storage, keys []*Key, allowUnencrypted bool) (*CryptStorage, error) {
+	if len(keys) == 0 {
+		return nil, errors.Errorf("no encryption keys provided")
+	}
+
+	aeads := map[string]cipher.AEAD{}
+	for _, k := range keys {
+		if k.ID == "" {
+			return nil, errors.Errorf("empty encryption key id")
+		}
+		if len(k.ID) > 255 {
+			return nil, errors.Errorf("encryption key id %q too long", k.ID)
+		}
+		if _, ok := aeads[k.ID]; ok {
+			return nil, errors.Errorf("duplicate encryption key id %q", k.ID)
+		}
+		block, err := aes.NewCipher(k.Key)
+		if err != nil {
+			return nil, errors.Errorf("wrong encryption key %q: %w", k.ID, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		aeads[k.ID] = aead
+	}
+
+	return &CryptStorage{
+		s:                s,
+		writeKeyID:       keys[0].ID,
+		aeads:            aeads,
+		allowUnencrypted: allowUnencrypted,
+	}, nil
+}
+
+func (s *CryptStorage) Stat(p string) (*types.ObjectInfo, error) {
+	return s.s.Stat(p)
+}
+
+func (s *CryptStorage) DeleteObject(p string) error {
+	return s.s.DeleteObject(p)
+}
+
+func (s *CryptStorage) List(prefix, startWith, delimiter string, doneCh <-chan struct{}) <-chan types.ObjectInfo {
+	return s.s.List(prefix, startWith, delimiter, doneCh)
+}
+
+func genHeader(keyID string, noncePrefix []byte) []byte {
+	header := []byte(magic)
+	header = append(header, version, byte(len(keyID)))
+	header = append(header, keyID...)
+	header = append(header, noncePrefix...)
+	return header
+}
+
+func chunkNonce(noncePrefix []byte, index uint32) []byte {
+	nonce := make([]byte, noncePrefixSize+4)
+	copy(nonce, noncePrefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], index)
+	return nonce
+}
+
+func chunkAdditionalData(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// encryptedSize returns the size of the encrypted data (without the header)
+// for a plaintext of the provided size
+func encryptedSize(size int64, overhead int) int64 {
+	chunks := (size + chunkSize - 1) / chunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	return size + chunks*int64(overhead)
+}
+
+func (s *CryptStorage) WriteObject(p string, data io.Reader, size int64, persist bool) error {
+	aead := s.aeads[s.writeKeyID]
+
+	noncePrefix := make([]byte, noncePrefixSize)
+	if _, err := rand.Read(noncePrefix); err != nil {
+		return err
+	}
+	header := genHeader(s.writeKeyID, noncePrefix)
+
+	encSize := int64(-1)
+	if size >= 0 {
+		encSize = int64(len(header)) + encryptedSize(size, aead.Overhead())
+	}
+
+	er := &encryptReader{
+		r:           bufio.NewReader(data),
+		aead:        aead,
+		noncePrefix: noncePrefix,
+		chunk:       make([]byte, chunkSize),
+	}
+	return s.s.WriteObject(p, io.MultiReader(bytes.NewReader(header), er), encSize, persist)
+}
+
+type encryptReader struct {
+	r           *bufio.Reader
+	aead        cipher.AEAD
+	noncePrefix []byte
+	chunk       []byte
+	index       uint32
+	buf         []byte
+	done        bool
+}
+
+func (r *encryptReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.sealChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *encryptReader) sealChunk() error {
+	n, err := io.ReadFull(r.r, r.chunk)
+	last := false
+	switch err {
+	case nil:
+		// check if there's more data to know if this is the last chunk
+		if _, err := r.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	case io.EOF, io.ErrUnexpectedEOF:
+		last = true
+	default:
+		return err
+	}
+
+	r.buf = r.aead.Seal(r.buf[:0], chunkNonce(r.noncePrefix, r.index), r.chunk[:n], chunkAdditionalData(last))
+	r.index++
+	r.done = last
+	return nil
+}
+
+// ObjectKeyID returns the id of the key used to encrypt the object or an empty
+// string if the object isn't encrypted
+func (s *CryptStorage) ObjectKeyID(p string) (string, error) {
+	f, err := s.s.ReadObject(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	keyID, _, _, err := readHeader(f)
+	return keyID, err
+}
+
+// Reencrypt rewrites the object if it's not encrypted with the current key.
+// It reports if the object has been rewritten.
+func (s *CryptStorage) Reencrypt(p string) (bool, error) {
+	keyID, err := s.ObjectKeyID(p)
+	if err != nil {
+		return false, err
+	}
+	if keyID == s.writeKeyID {
+		return false, nil
+	}
+
+	f, err := s.ReadObject(p)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	// get the plaintext size
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return false, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+
+	if err := s.WriteObject(p, f, size, true); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// readHeader reads the encrypted object header. It returns an empty key id if
+// the object isn't encrypted.
+func readHeader(r io.Reader) (string, []byte, int64, error) {
+	m := make([]byte, len(magic)+2)
+	if _, err := io.ReadFull(r, m); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return "", nil, 0, nil
+		}
+		return "", nil, 0, err
+	}
+	if string(m[:len(magic)]) != magic {
+		return "", nil, 0, nil
+	}
+	if m[len(magic)] != version {
+		return "", nil, 0, errors.Errorf("unsupported encrypted object version %d", m[len(magic)])
+	}
+
+	keyID := make([]byte, int(m[len(magic)+1]))
+	if _, err := io.ReadFull(r, keyID); err != nil {
+		return "", nil, 0, errors.Errorf("failed to read encrypted object header: %w", err)
+	}
+	noncePrefix := make([]byte, noncePrefixSize)
+	if _, err := io.ReadFull(r, noncePrefix); err != nil {
+		return "", nil, 0, errors.Errorf("failed to read encrypted object header: %w", err)
+	}
+
+	headerSize := int64(len(m) + len(keyID) + len(noncePrefix))
+	return string(keyID), noncePrefix, headerSize, nil
+}
+
+func (s *CryptStorage) ReadObject(p string) (types.ReadSeekCloser, error) {
+	f, err := s.s.ReadObject(p)
+	if err != nil {
+		return nil, err
+	}
+
+	dr, err := s.newDecryptReader(p, f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return dr, nil
+}
+
+func (s *CryptStorage) newDecryptReader(p string, f types.ReadSeekCloser) (types.ReadSeekCloser, error) {
+	keyID, noncePrefix, headerSize, err := readHeader(f)
+	if err != nil {
+		return nil, err
+	}
+	if keyID == "" {
+		if !s.allowUnencrypted {
+			return nil, errors.Errorf("object %q isn't encrypted", p)
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+
+	aead, ok := s.aeads[keyID]
+	if !ok {
+		return nil, errors.Errorf("object %q is encrypted with unknown key %q", p, keyID)
+	}
+
+	encSize, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	encSize -= headerSize
+
+	// calculate the plaintext size and the number of chunks
+	encChunkSize := int64(chunkSize + aead.Overhead())
+	fullChunks := encSize / encChunkSize
+	rem := encSize % encChunkSize
+	var size, chunks int64
+	switch {
+	case rem == 0 && fullChunks > 0:
+		size = fullChunks * chunkSize
+		chunks = fullChunks
+	case rem >= int64(aead.Overhead()):
+		size = fullChunks*chunkSize + rem - int64(aead.Overhead())
+		chunks = fullChunks + 1
+	default:
+		return nil, errors.Errorf("object %q is corrupted: wrong encrypted size", p)
+	}
+
+	return &decryptReader{
+		f:           f,
+		aead:        aead,
+		noncePrefix: noncePrefix,
+		headerSize:  headerSize,
+		size:        size,
+		chunks:      chunks,
+		chunkIndex:  -1,
+		// force a seek at the first read
+		fOffset: -1,
+	}, nil
+}
+
+type decryptReader struct {
+	f           types.ReadSeekCloser
+	aead        cipher.AEAD
+	noncePrefix []byte
+	headerSize  int64
+	size        int64
+	chunks      int64
+
+	offset int64
+
+	// current decrypted chunk
+	chunkIndex int64
+	chunk      []byte
+
+	// current offset of the underlying reader
+	fOffset int64
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		// an empty object has only an empty last chunk that must be
+		// authenticated anyway or a truncated object will be read as empty
+		if r.size == 0 && r.chunkIndex != 0 {
+			if err := r.openChunk(0); err != nil {
+				return 0, err
+			}
+		}
+		return 0, io.EOF
+	}
+
+	index := r.offset / chunkSize
+	if index != r.chunkIndex {
+		if err := r.openChunk(index); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.chunk[r.offset-index*chunkSize:])
+	r.offset += int64(n)
+	return n, nil
+}
+
+func (r *decryptReader) openChunk(index int64) error {
+	encChunkSize := int64(chunkSize + r.aead.Overhead())
+	chunkOffset := r.headerSize + index*encChunkSize
+	if r.fOffset != chunkOffset {
+		if _, err := r.f.Seek(chunkOffset, io.SeekStart); err != nil {
+			return err
+		}
+		r.fOffset = chunkOffset
+	}
+
+	last := index == r.chunks-1
+	size := encChunkSize
+	if last {
+		size = r.size - index*chunkSize + int64(r.aead.Overhead())
+	}
+	data := make([]byte, size)
+	n, err := io.ReadFull(r.f, data)
+	r.fOffset += int64(n)
+	if err != nil {
+		return errors.Errorf("failed to read encrypted chunk: %w", err)
+	}
+
+	chunk, err := r.aead.Open(r.chunk[:0], chunkNonce(r.noncePrefix, uint32(index)), data, chunkAdditionalData(last))
+	if err != nil {
+		return errors.Errorf("failed to decrypt chunk: %w", err)
+	}
+	r.chunk = chunk
+	r.chunkIndex = index
+	return nil
+}
+
+func (r *decryptReader) Seek(offset int64, whence int) (int64, error) {
+	var newOffset int64
+	switch whence {
+	case io.SeekStart:
+		newOffset = offset
+	case io.SeekCurrent:
+		newOffset = r.offset + offset
+	case io.SeekEnd:
+		newOffset = r.size + offset
+	default:
+		return 0, errors.Errorf("invalid whence %d", whence)
+	}
+	if newOffset < 0 {
+		return 0, errors.Errorf("negative offset %d", newOffset)
+	}
+	r.offset = newOffset
+	return newOffset, nil
+}
+
+func (r *decryptReader) Close() error {
+	return r.f.Close()
+}
+
+// ReadKeyFile reads a base64 encoded key from a file
+func ReadKeyFile(p string) ([]byte, error) {
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, base64.StdEncoding.DecodedLen(len(data)))
+	n, err := base64.StdEncoding.Decode(key, bytes.TrimSpace(data))
+	if err != nil {
+		return nil, errors.Errorf("failed to decode key: %w", err)
+	}
+	return key[:n], nil
+}
@@ -0,0 +1,241 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"agola.io/agola/internal/objectstorage/posix"
+)
+
+func TestCryptStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "objectstorage")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ps, err := posix.New(dir)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	key01 := &Key{ID: "key01", Key: make([]byte, 32)}
+	key02 := &Key{ID: "key02", Key: make([]byte, 32)}
+	if _, err := rand.Read(key01.Key); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, err := rand.Read(key02.Key); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	cs, err := New(ps, []*Key{key01}, false)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	sizes := []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 100}
+	objects := map[string][]byte{}
+	for i, size := range sizes {
+		data := make([]byte, size)
+		if _, err := rand.Read(data); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		p := "obj" + string('a'+rune(i))
+		objects[p] = data
+
+		if err := cs.WriteObject(p, bytes.NewReader(data), int64(size), true); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	checkObjects := func(t *testing.T, cs *CryptStorage) {
+		for p, data := range objects {
+			f, err := cs.ReadObject(p)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			out, err := ioutil.ReadAll(f)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if !bytes.Equal(out, data) {
+				t.Fatalf("object %q: wrong data", p)
+			}
+
+			if len(data) > 10 {
+				offset := int64(len(data) / 2)
+				if _, err := f.Seek(offset, io.SeekStart); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				out, err := ioutil.ReadAll(f)
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				if !bytes.Equal(out, data[offset:]) {
+					t.Fatalf("object %q: wrong data after seek", p)
+				}
+			}
+			f.Close()
+		}
+	}
+
+	t.Run("read", func(t *testing.T) {
+		checkObjects(t, cs)
+	})
+
+	t.Run("data is encrypted", func(t *testing.T) {
+		p := "objf"
+		f, err := ps.ReadObject(p)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		defer f.Close()
+		out, err := ioutil.ReadAll(f)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if bytes.Contains(out, objects[p][:100]) {
+			t.Fatalf("object %q isn't encrypted", p)
+		}
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		cs2, err := New(ps, []*Key{key02}, false)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if _, err := cs2.ReadObject("obja"); err == nil {
+			t.Fatalf("expected error reading object with unknown key")
+		}
+	})
+
+	t.Run("unencrypted objects", func(t *testing.T) {
+		data := []byte("unencrypted data")
+		if err := ps.WriteObject("plain", bytes.NewReader(data), int64(len(data)), true); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if _, err := cs.ReadObject("plain"); err == nil {
+			t.Fatalf("expected error reading unencrypted object")
+		}
+
+		cs2, err := New(ps, []*Key{key01}, true)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		f, err := cs2.ReadObject("plain")
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		defer f.Close()
+		out, err := ioutil.ReadAll(f)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if !bytes.Equal(out, data) {
+			t.Fatalf("wrong data")
+		}
+		if err := ps.DeleteObject("plain"); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	})
+
+	t.Run("truncated objects", func(t *testing.T) {
+		p := "objf"
+		f, err := ps.ReadObject(p)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		enc, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		headerSize := len(magic) + 2 + len(key01.ID) + noncePrefixSize
+		overhead := cs.aeads[key01.ID].Overhead()
+		encChunkSize := chunkSize + overhead
+
+		tests := []struct {
+			name string
+			size int
+		}{
+			// read as an empty object without the last chunk authentication
+			{name: "to an empty object", size: headerSize + overhead},
+			{name: "at a chunk boundary", size: headerSize + encChunkSize},
+			{name: "at two chunks boundary", size: headerSize + 2*encChunkSize},
+			{name: "inside the last chunk", size: len(enc) - 10},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				tp := "truncated"
+				if err := ps.WriteObject(tp, bytes.NewReader(enc[:tt.size]), int64(tt.size), true); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				defer func() {
+					if err := ps.DeleteObject(tp); err != nil {
+						t.Fatalf("unexpected err: %v", err)
+					}
+				}()
+
+				f, err := cs.ReadObject(tp)
+				if err != nil {
+					// detected from the encrypted size
+					return
+				}
+				defer f.Close()
+				if _, err := ioutil.ReadAll(f); err == nil {
+					t.Fatalf("expected error reading truncated object")
+				}
+			})
+		}
+	})
+
+	t.Run("key rotation", func(t *testing.T) {
+		cs2, err := New(ps, []*Key{key02, key01}, false)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		for p := range objects {
+			ok, err := cs2.Reencrypt(p)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if !ok {
+				t.Fatalf("expected object %q to be reencrypted", p)
+			}
+			keyID, err := cs2.ObjectKeyID(p)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if keyID != key02.ID {
+				t.Fatalf("expected key id %q, got %q", key02.ID, keyID)
+			}
+		}
+
+		// only the new key is needed now
+		cs3, err := New(ps, []*Key{key02}, false)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		checkObjects(t, cs3)
+	})
+}
@@ -0,0 +1,436 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"agola.io/agola/internal/objectstorage/common"
+	"agola.io/agola/internal/objectstorage/types"
+
+	"golang.org/x/oauth2/jwt"
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	DefaultEndpoint = "https://storage.googleapis.com"
+
+	defaultTokenURL = "https://oauth2.googleapis.com/token"
+	readWriteScope  = "https://www.googleapis.com/auth/devstorage.read_write"
+
+	// uploadChunkSize is the size of the chunks of a resumable upload. It must
+	// be a multiple of 256KiB. Objects smaller than it are uploaded with a single
+	// request.
+	uploadChunkSize = 16 * 1024 * 1024
+)
+
+type serviceAccountKey struct {
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+}
+
+type object struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size,string"`
+	Updated time.Time `json:"updated"`
+}
+
+type objectList struct {
+	Items         []*object `json:"items"`
+	NextPageToken string    `json:"nextPageToken"`
+}
+
+type GCSStorage struct {
+	bucket   string
+	endpoint string
+	client   *http.Client
+}
+
+// New creates a new google cloud storage objectstorage using the json api.
+// credentialsFile is the path of a service account json key. If empty the
+// requests won't be authenticated (useful only for testing with an emulator).
+func New(bucket, endpoint, credentialsFile string) (*GCSStorage, error) {
+	if bucket == "" {
+		return nil, errors.Errorf("empty bucket")
+	}
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+
+	client := &http.Client{}
+	if credentialsFile != "" {
+		data, err := ioutil.ReadFile(credentialsFile)
+		if err != nil {
+			return nil, errors.Errorf("failed to read credentials file %q: %w", credentialsFile, err)
+		}
+		var key *serviceAccountKey
+		if err := json.Unmarshal(data, &key); err != nil {
+			return nil, errors.Errorf("failed to unmarshal credentials file %q: %w", credentialsFile, err)
+		}
+		tokenURL := key.TokenURI
+		if tokenURL == "" {
+			tokenURL = defaultTokenURL
+		}
+		conf := &jwt.Config{
+			Email:        key.ClientEmail,
+			PrivateKey:   []byte(key.PrivateKey),
+			PrivateKeyID: key.PrivateKeyID,
+			Scopes:       []string{readWriteScope},
+			TokenURL:     tokenURL,
+		}
+		client = conf.Client(context.Background())
+	}
+
+	s := &GCSStorage{
+		bucket:   bucket,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client:   client,
+	}
+
+	resp, err := s.do(func() (*http.Request, error) {
+		return http.NewRequest("GET", s.bucketURL(), nil)
+	})
+	if err != nil {
+		return nil, errors.Errorf("cannot check if bucket %q exists: %w", bucket, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errors.Errorf("bucket %q doesn't exist", bucket)
+	}
+	if err := checkResponse(resp); err != nil {
+		return nil, errors.Errorf("cannot check if bucket %q exists: %w", bucket, err)
+	}
+
+	return s, nil
+}
+
+func (s *GCSStorage) bucketURL() string {
+	return fmt.Sprintf("%s/storage/v1/b/%s", s.endpoint, url.PathEscape(s.bucket))
+}
+
+func (s *GCSStorage) objectURL(p string) string {
+	return fmt.Sprintf("%s/o/%s", s.bucketURL(), url.PathEscape(p))
+}
+
+func (s *GCSStorage) uploadURL(uploadType, p string) string {
+	q := url.Values{}
+	q.Set("uploadType", uploadType)
+	q.Set("name", p)
+	return fmt.Sprintf("%s/upload/storage/v1/b/%s/o?%s", s.endpoint, url.PathEscape(s.bucket), q.Encode())
+}
+
+func (s *GCSStorage) do(newRequest func() (*http.Request, error)) (*http.Response, error) {
+	return common.DoRequest(s.client, common.DefaultRequestRetries, newRequest)
+}
+
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	return errors.Errorf("unexpected response status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+}
+
+func (s *GCSStorage) stat(p string) (*object, error) {
+	resp, err := s.do(func() (*http.Request, error) {
+		return http.NewRequest("GET", s.objectURL(p), nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, types.ErrNotExist
+	}
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+
+	var o *object
+	if err := json.NewDecoder(resp.Body).Decode(&o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (s *GCSStorage) Stat(p string) (*types.ObjectInfo, error) {
+	o, err := s.stat(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.ObjectInfo{Path: p, LastModified: o.Updated}, nil
+}
+
+func (s *GCSStorage) ReadObject(p string) (types.ReadSeekCloser, error) {
+	o, err := s.stat(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return common.NewRangeReader(o.Size, func(offset int64) (io.ReadCloser, error) {
+		resp, err := s.do(func() (*http.Request, error) {
+			req, err := http.NewRequest("GET", s.objectURL(p)+"?alt=media", nil)
+			if err != nil {
+				return nil, err
+			}
+			if offset > 0 {
+				req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+			}
+			return req, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			return nil, types.ErrNotExist
+		}
+		if err := checkResponse(resp); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		return resp.Body, nil
+	}), nil
+}
+
+// WriteObject uploads the object with a single request if it's smaller than
+// uploadChunkSize, otherwise it uses a resumable upload sending uploadChunkSize
+// chunks so objects of unknown size can be streamed without keeping them in
+// memory.
+func (s *GCSStorage) WriteObject(p string, data io.Reader, size int64, persist bool) error {
+	chunk, eof, err := readChunk(data)
+	if err != nil {
+		return err
+	}
+	if eof {
+		return s.simpleUpload(p, chunk)
+	}
+
+	sessionURL, err := s.startResumableUpload(p)
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	for {
+		next, eof, err := readChunk(data)
+		if err != nil {
+			return err
+		}
+		if eof && len(next) == 0 {
+			return s.uploadChunk(sessionURL, chunk, offset, true)
+		}
+		if err := s.uploadChunk(sessionURL, chunk, offset, false); err != nil {
+			return err
+		}
+		offset += int64(len(chunk))
+		chunk = next
+		if eof {
+			return s.uploadChunk(sessionURL, chunk, offset, true)
+		}
+	}
+}
+
+// readChunk reads up to uploadChunkSize bytes from r and reports if the end of
+// r was reached
+func readChunk(r io.Reader) ([]byte, bool, error) {
+	buf := make([]byte, uploadChunkSize)
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return buf[:n], true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return buf, false, nil
+}
+
+func (s *GCSStorage) simpleUpload(p string, data []byte) error {
+	resp, err := s.do(func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", s.uploadURL("media", p), bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/octet-stream")
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp)
+}
+
+func (s *GCSStorage) startResumableUpload(p string) (string, error) {
+	resp, err := s.do(func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", s.uploadURL("resumable", p), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-Upload-Content-Type", "application/octet-stream")
+		return req, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return "", err
+	}
+
+	sessionURL := resp.Header.Get("Location")
+	if sessionURL == "" {
+		return "", errors.Errorf("missing resumable upload session url")
+	}
+	return sessionURL, nil
+}
+
+func (s *GCSStorage) uploadChunk(sessionURL string, chunk []byte, offset int64, last bool) error {
+	var contentRange string
+	switch {
+	case last && len(chunk) == 0:
+		contentRange = fmt.Sprintf("bytes */%d", offset)
+	case last:
+		contentRange = fmt.Sprintf("bytes %d-%d/%d", offset, offset+int64(len(chunk))-1, offset+int64(len(chunk)))
+	default:
+		contentRange = fmt.Sprintf("bytes %d-%d/*", offset, offset+int64(len(chunk))-1)
+	}
+
+	resp, err := s.do(func() (*http.Request, error) {
+		req, err := http.NewRequest("PUT", sessionURL, bytes.NewReader(chunk))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Range", contentRange)
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// intermediate chunks are acknowledged with a 308 status
+	if !last && resp.StatusCode == http.StatusPermanentRedirect {
+		return nil
+	}
+	return checkResponse(resp)
+}
+
+func (s *GCSStorage) DeleteObject(p string) error {
+	resp, err := s.do(func() (*http.Request, error) {
+		return http.NewRequest("DELETE", s.objectURL(p), nil)
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return types.ErrNotExist
+	}
+	return checkResponse(resp)
+}
+
+func (s *GCSStorage) List(prefix, startWith, delimiter string, doneCh <-chan struct{}) <-chan types.ObjectInfo {
+	objectCh := make(chan types.ObjectInfo, 1)
+
+	if len(delimiter) > 1 {
+		objectCh <- types.ObjectInfo{Err: errors.Errorf("wrong delimiter %q", delimiter)}
+		return objectCh
+	}
+
+	// remove leading slash
+	if strings.HasPrefix(prefix, "/") {
+		prefix = strings.TrimPrefix(prefix, "/")
+	}
+	if strings.HasPrefix(startWith, "/") {
+		startWith = strings.TrimPrefix(startWith, "/")
+	}
+
+	go func(objectCh chan<- types.ObjectInfo) {
+		defer close(objectCh)
+		var pageToken string
+		for {
+			q := url.Values{}
+			q.Set("prefix", prefix)
+			if delimiter != "" {
+				q.Set("delimiter", delimiter)
+			}
+			if startWith != "" {
+				q.Set("startOffset", startWith)
+			}
+			if pageToken != "" {
+				q.Set("pageToken", pageToken)
+			}
+
+			result, err := s.listPage(q)
+			if err != nil {
+				objectCh <- types.ObjectInfo{Err: err}
+				return
+			}
+
+			for _, o := range result.Items {
+				// startOffset is inclusive
+				if o.Name <= startWith {
+					continue
+				}
+				select {
+				// Send object content.
+				case objectCh <- types.ObjectInfo{Path: o.Name, LastModified: o.Updated}:
+				// If receives done from the caller, return here.
+				case <-doneCh:
+					return
+				}
+			}
+
+			if result.NextPageToken == "" {
+				return
+			}
+			pageToken = result.NextPageToken
+		}
+	}(objectCh)
+
+	return objectCh
+}
+
+func (s *GCSStorage) listPage(q url.Values) (*objectList, error) {
+	resp, err := s.do(func() (*http.Request, error) {
+		return http.NewRequest("GET", s.bucketURL()+"/o?"+q.Encode(), nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+
+	var result *objectList
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -24,6 +24,8 @@ import (
 	"strings"
 	"testing"
 
+	"agola.io/agola/internal/objectstorage/azure"
+	"agola.io/agola/internal/objectstorage/gcs"
 	"agola.io/agola/internal/objectstorage/posix"
 	"agola.io/agola/internal/objectstorage/posixflat"
 	"agola.io/agola/internal/objectstorage/s3"
@@ -59,6 +61,34 @@ func TestList(t *testing.T) {
 		}
 	}
 
+	var gcss *gcs.GCSStorage
+	gcsEndpoint := os.Getenv("GCS_ENDPOINT")
+	gcsBucket := os.Getenv("GCS_BUCKET")
+	gcsCredentialsFile := os.Getenv("GCS_CREDENTIALSFILE")
+	if gcsBucket == "" {
+		t.Logf("missing GCS_BUCKET env, skipping tests with gcs storage")
+	} else {
+		var err error
+		gcss, err = gcs.New(gcsBucket, gcsEndpoint, gcsCredentialsFile)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	var azs *azure.AzureStorage
+	azureEndpoint := os.Getenv("AZURE_ENDPOINT")
+	azureAccountName := os.Getenv("AZURE_ACCOUNTNAME")
+	azureAccountKey := os.Getenv("AZURE_ACCOUNTKEY")
+	if azureAccountName == "" {
+		t.Logf("missing AZURE_ACCOUNTNAME env, skipping tests with azure storage")
+	} else {
+		var err error
+		azs, err = azure.New(azureAccountName, azureAccountKey, filepath.Base(dir), azureEndpoint)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
 	type listop struct {
 		prefix    string
 		start     string
@@ -181,7 +211,7 @@ func TestList(t *testing.T) {
 			},
 		},
 		{
-			map[string]Storage{"posix": ps, "posixflat": pfs, "minio": s3s},
+			map[string]Storage{"posix": ps, "posixflat": pfs, "minio": s3s, "gcs": gcss, "azure": azs},
 			[]string{
 				// These are multiple of 8 chars on purpose to test the filemarker behavior to
 				// distinguish between a file or a directory when the files ends at the path
@@ -265,6 +295,14 @@ func TestList(t *testing.T) {
 					if s == nil {
 						t.SkipNow()
 					}
+				case *gcs.GCSStorage:
+					if s == nil {
+						t.SkipNow()
+					}
+				case *azure.AzureStorage:
+					if s == nil {
+						t.SkipNow()
+					}
 				}
 				os := NewObjStorage(s, "/")
 				// populate
@@ -0,0 +1,62 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runconfig
+
+import (
+	"agola.io/agola/internal/config"
+)
+
+// Standard environment variables available in every task step
+const (
+	// EnvRepo is the repository path (i.e. owner/repo)
+	EnvRepo = "AGOLA_REPO"
+	// EnvBranch is the branch name, empty if the run isn't for a branch
+	EnvBranch = "AGOLA_BRANCH"
+	// EnvTag is the tag name, empty if the run isn't for a tag
+	EnvTag = "AGOLA_TAG"
+	// EnvPullRequestID is the pull request id, empty if the run isn't for a
+	// pull request
+	EnvPullRequestID = "AGOLA_PULL_REQUEST_ID"
+	// EnvCommitSHA is the commit sha of the run
+	EnvCommitSHA = "AGOLA_COMMIT_SHA"
+	// EnvRunID is the run id. It's known only at run creation so it's set by
+	// the runservice
+	EnvRunID = "AGOLA_RUN_ID"
+	// EnvTaskName is the task name
+	EnvTaskName = "AGOLA_TASK_NAME"
+)
+
+// GenStandardEnvironment returns the standard environment variables of a run
+// that don't depend on the task
+func GenStandardEnvironment(repo, branch, tag, pullRequestID, commitSHA string) map[string]string {
+	return map[string]string{
+		EnvRepo:          repo,
+		EnvBranch:        branch,
+		EnvTag:           tag,
+		EnvPullRequestID: pullRequestID,
+		EnvCommitSHA:     commitSHA,
+	}
+}
+
+// ResolveTaskOutputs replaces the ${tasks.TASKNAME.outputs.KEY} references in
+// the environment values with the task outputs values returned by output
+func ResolveTaskOutputs(env map[string]string, output func(taskName, key string) string) {
+	for k, v := range env {
+		env[k] = config.TaskOutputRefRegexp.ReplaceAllStringFunc(v, func(ref string) string {
+			m := config.TaskOutputRefRegexp.FindStringSubmatch(ref)
+			return output(m[1], m[2])
+		})
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runconfig
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	rstypes "agola.io/agola/internal/services/runservice/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+// Run context variables that can be referenced in the config values using the
+// ${NAME} syntax. A literal "$" must be escaped as "$$".
+const (
+	VariableRunName          = "AGOLA_RUN_NAME"
+	VariableGitRefType       = "AGOLA_GIT_REF_TYPE"
+	VariableGitBranch        = "AGOLA_GIT_BRANCH"
+	VariableGitTag           = "AGOLA_GIT_TAG"
+	VariableGitRef           = "AGOLA_GIT_REF"
+	VariableGitCommitSHA     = "AGOLA_GIT_COMMITSHA"
+	VariableGitPullRequestID = "AGOLA_GIT_PULL_REQUEST_ID"
+	// VariableRunNumber is the run number (the per project run counter). It's
+	// assigned by the runservice when the run is created so it's interpolated
+	// there.
+	VariableRunNumber = "AGOLA_RUN_NUMBER"
+)
+
+var variableNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// resolveFunc returns the value of a variable. When keep is true the variable
+// reference is kept as is.
+type resolveFunc func(name string) (value string, keep bool, err error)
+
+// interpolate replaces the ${NAME} variables references in s. The "$$" escapes
+// are replaced with "$" only if unescape is true.
+func interpolate(s string, resolve resolveFunc, unescape bool) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		switch s[i+1] {
+		case '$':
+			if unescape {
+				b.WriteByte('$')
+			} else {
+				b.WriteString("$$")
+			}
+			i++
+		case '{':
+			end := strings.IndexByte(s[i+2:], '}')
+			if end < 0 {
+				return "", errors.Errorf("unterminated variable reference in %q", s)
+			}
+			name := s[i+2 : i+2+end]
+			if !variableNameRegexp.MatchString(name) {
+				return "", errors.Errorf("invalid variable name %q in %q", name, s)
+			}
+			value, keep, err := resolve(name)
+			if err != nil {
+				return "", err
+			}
+			if keep {
+				b.WriteString(s[i : i+3+end])
+			} else {
+				b.WriteString(value)
+			}
+			i += 2 + end
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return b.String(), nil
+}
+
+// InterpolateRunConfigTasks replaces the references to the run context
+// variables in the run config tasks values that aren't evaluated at run time:
+// the containers images, the steps names, the workspace and cache paths and
+// keys, the test and coverage reports paths.
+// The commands, the environment and the working dirs are evaluated by the
+// task shell so they're kept untouched.
+// It returns an error if a referenced variable isn't defined. The references
+// to the run counter are kept since it's known only at run creation.
+func InterpolateRunConfigTasks(rcts map[string]*rstypes.RunConfigTask, variables map[string]string) error {
+	resolve := func(name string) (string, bool, error) {
+		if name == VariableRunNumber {
+			return "", true, nil
+		}
+		value, ok := variables[name]
+		if !ok {
+			return "", false, errors.Errorf("undefined variable %q", name)
+		}
+		return value, false, nil
+	}
+
+	for _, rct := range rcts {
+		if err := walkRunConfigTaskValues(rct, func(s string) (string, error) { return interpolate(s, resolve, false) }); err != nil {
+			return errors.Errorf("task %q: %w", rct.Name, err)
+		}
+	}
+	return nil
+}
+
+// InterpolateRunCounter replaces the references to the run counter in the run
+// config tasks values and unescapes the "$$" escapes. It must be called only
+// after InterpolateRunConfigTasks.
+func InterpolateRunCounter(rcts map[string]*rstypes.RunConfigTask, counter uint64) {
+	resolve := func(name string) (string, bool, error) {
+		if name == VariableRunNumber {
+			return strconv.FormatUint(counter, 10), false, nil
+		}
+		return "", true, nil
+	}
+
+	for _, rct := range rcts {
+		// errors are already reported by InterpolateRunConfigTasks, ignore them
+		// and keep the values as is
+		_ = walkRunConfigTaskValues(rct, func(s string) (string, error) {
+			ns, err := interpolate(s, resolve, true)
+			if err != nil {
+				return s, nil
+			}
+			return ns, nil
+		})
+	}
+}
+
+// walkRunConfigTaskValues replaces the interpolable run config task values
+// with the values returned by f
+func walkRunConfigTaskValues(rct *rstypes.RunConfigTask, f func(string) (string, error)) error {
+	var err error
+	replace := func(s *string) {
+		if err != nil {
+			return
+		}
+		*s, err = f(*s)
+	}
+	// the slices could be shared with the config, so new slices are created
+	replaceSlice := func(ss []string) []string {
+		if ss == nil {
+			return nil
+		}
+		nss := make([]string, len(ss))
+		copy(nss, ss)
+		for i := range nss {
+			replace(&nss[i])
+		}
+		return nss
+	}
+	replaceContents := func(contents []rstypes.SaveContent) []rstypes.SaveContent {
+		if contents == nil {
+			return nil
+		}
+		ncontents := make([]rstypes.SaveContent, len(contents))
+		for i, c := range contents {
+			replace(&c.SourceDir)
+			replace(&c.DestDir)
+			c.Paths = replaceSlice(c.Paths)
+			ncontents[i] = c
+		}
+		return ncontents
+	}
+
+	if rct.Runtime != nil {
+		for _, c := range rct.Runtime.Containers {
+			replace(&c.Image)
+		}
+	}
+
+	for _, step := range rct.Steps {
+		switch s := step.(type) {
+		case *rstypes.RunStep:
+			replace(&s.Name)
+		case *rstypes.ParallelStep:
+			replace(&s.Name)
+			for _, ps := range s.Steps {
+				replace(&ps.Name)
+			}
+		case *rstypes.SaveToWorkspaceStep:
+			s.Contents = replaceContents(s.Contents)
+		case *rstypes.RestoreWorkspaceStep:
+			replace(&s.DestDir)
+		case *rstypes.SaveCacheStep:
+			replace(&s.Key)
+			s.Contents = replaceContents(s.Contents)
+		case *rstypes.RestoreCacheStep:
+			s.Keys = replaceSlice(s.Keys)
+			replace(&s.DestDir)
+		case *rstypes.SaveTestReportStep:
+			s.Paths = replaceSlice(s.Paths)
+		case *rstypes.SaveCoverageReportStep:
+			s.Paths = replaceSlice(s.Paths)
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runconfig
+
+import (
+	"testing"
+
+	rstypes "agola.io/agola/internal/services/runservice/types"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestInterpolateRunConfigTasks(t *testing.T) {
+	variables := map[string]string{
+		VariableGitBranch:    "master",
+		VariableGitCommitSHA: "abcdef",
+	}
+
+	genRcts := func(image, stepName, command string, paths []string) map[string]*rstypes.RunConfigTask {
+		return map[string]*rstypes.RunConfigTask{
+			"task01": {
+				ID:   "task01",
+				Name: "task01",
+				Runtime: &rstypes.Runtime{
+					Containers: []*rstypes.Container{{Image: image}},
+				},
+				Steps: rstypes.Steps{
+					&rstypes.RunStep{BaseStep: rstypes.BaseStep{Name: stepName}, Command: command},
+					&rstypes.SaveToWorkspaceStep{Contents: []rstypes.SaveContent{{SourceDir: ".", DestDir: "/", Paths: paths}}},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		in      map[string]*rstypes.RunConfigTask
+		counter uint64
+		out     map[string]*rstypes.RunConfigTask
+		err     string
+	}{
+		{
+			name:    "interpolate values",
+			in:      genRcts("app:${AGOLA_GIT_BRANCH}-${AGOLA_GIT_COMMITSHA}", "build ${AGOLA_RUN_NUMBER}", "echo ${HOME} ${AGOLA_GIT_BRANCH}", []string{"bin/app-${AGOLA_RUN_NUMBER}", "cost-$$5"}),
+			counter: 10,
+			out:     genRcts("app:master-abcdef", "build 10", "echo ${HOME} ${AGOLA_GIT_BRANCH}", []string{"bin/app-10", "cost-$5"}),
+		},
+		{
+			name:    "escaped reference",
+			in:      genRcts("app:$${AGOLA_GIT_BRANCH}", "build", "", nil),
+			counter: 1,
+			out:     genRcts("app:${AGOLA_GIT_BRANCH}", "build", "", nil),
+		},
+		{
+			name: "undefined variable",
+			in:   genRcts("app:${AGOLA_GIT_BRANC}", "build", "", nil),
+			err:  `task "task01": undefined variable "AGOLA_GIT_BRANC"`,
+		},
+		{
+			name: "unterminated reference",
+			in:   genRcts("app:${AGOLA_GIT_BRANCH", "build", "", nil),
+			err:  `task "task01": unterminated variable reference in "app:${AGOLA_GIT_BRANCH"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := InterpolateRunConfigTasks(tt.in, variables)
+			if tt.err != "" {
+				if err == nil {
+					t.Fatalf("expected error %q, got nil", tt.err)
+				}
+				if err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %q", tt.err, err.Error())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			InterpolateRunCounter(tt.in, tt.counter)
+			if diff := cmp.Diff(tt.out, tt.in); diff != "" {
+				t.Fatalf("run config tasks mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -16,7 +16,11 @@ package runconfig
 
 import (
 	"fmt"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"agola.io/agola/internal/config"
 	rstypes "agola.io/agola/internal/services/runservice/types"
@@ -26,25 +30,29 @@ import (
 	errors "golang.org/x/xerrors"
 )
 
-func genRuntime(c *config.Config, ce *config.Runtime, variables map[string]string) *rstypes.Runtime {
+func genRuntime(c *config.Config, ce *config.Runtime, variables, exprVariables map[string]string) *rstypes.Runtime {
 	containers := []*rstypes.Container{}
 	for _, cc := range ce.Containers {
-		env := genEnv(cc.Environment, variables)
+		env := genEnv(cc.Environment, variables, exprVariables)
 		container := &rstypes.Container{
-			Image:       cc.Image,
+			Image:       evalTemplate(cc.Image, exprVariables),
 			Environment: env,
 			User:        cc.User,
 			Privileged:  cc.Privileged,
 			Entrypoint:  cc.Entrypoint,
+			Args:        cc.Args,
 		}
 
 		containers = append(containers, container)
 	}
 
 	return &rstypes.Runtime{
-		Type:       rstypes.RuntimeType(ce.Type),
-		Arch:       ce.Arch,
-		Containers: containers,
+		Type:        rstypes.RuntimeType(ce.Type),
+		Arch:        ce.Arch,
+		Containers:  containers,
+		ExtraHosts:  ce.ExtraHosts,
+		DNS:         ce.DNS,
+		HostNetwork: ce.HostNetwork,
 	}
 }
 
@@ -53,13 +61,50 @@ func whenFromConfigWhen(cw *config.When) *types.When {
 		return nil
 	}
 	return &types.When{
-		Branch: cw.Branch,
-		Tag:    cw.Tag,
-		Ref:    cw.Ref,
+		Branch:      cw.Branch,
+		Tag:         cw.Tag,
+		Ref:         cw.Ref,
+		PullRequest: cw.PullRequest,
+		Expr:        cw.Expr,
 	}
 }
 
-func stepFromConfigStep(csi interface{}, variables map[string]string) interface{} {
+// retriesFromConfigRetries converts the config retries. The config must be
+// already checked so the delay is valid
+func retriesFromConfigRetries(cr *config.Retries) *rstypes.Retries {
+	if cr == nil {
+		return nil
+	}
+	r := &rstypes.Retries{
+		Count: cr.Count,
+	}
+	if cr.Delay != "" {
+		r.Delay, _ = time.ParseDuration(cr.Delay)
+	}
+	for _, c := range cr.On {
+		r.On = append(r.On, rstypes.RetryCondition(c))
+	}
+	return r
+}
+
+func approvalTimeoutFromConfigApprovalTimeout(cat *config.ApprovalTimeout) *rstypes.ApprovalTimeout {
+	if cat == nil {
+		return nil
+	}
+	at := &rstypes.ApprovalTimeout{
+		Action: rstypes.ApprovalTimeoutAction(cat.Action),
+	}
+	if at.Action == "" {
+		at.Action = rstypes.ApprovalTimeoutActionReject
+	}
+	at.Timeout, _ = time.ParseDuration(cat.Timeout)
+	if cat.NotifyBefore != "" {
+		at.NotifyBefore, _ = time.ParseDuration(cat.NotifyBefore)
+	}
+	return at
+}
+
+func stepFromConfigStep(csi interface{}, variables, exprVariables map[string]string) interface{} {
 	switch cs := csi.(type) {
 	case *config.CloneStep:
 		// transform a "clone" step in a "run" step command
@@ -111,14 +156,34 @@ if [ -n "$AGOLA_GIT_COMMITSHA" ]; then
 else
 	git checkout FETCH_HEAD
 fi
+
+# Apply the run patch (local changes)
+if [ -n "$AGOLA_GIT_PATCH" ]; then
+	(cat <<EOF | base64 -d > ~/.agola_git.patch
+$AGOLA_GIT_PATCH
+EOF
+)
+	git apply ~/.agola_git.patch
+fi
 `
 
 		return rs
 
+	case *config.ParallelStep:
+		ps := &rstypes.ParallelStep{}
+
+		ps.Type = cs.Type
+		ps.Name = cs.Name
+		ps.Steps = make([]*rstypes.RunStep, len(cs.Steps))
+		for i, css := range cs.Steps {
+			ps.Steps[i] = stepFromConfigStep(css, variables, exprVariables).(*rstypes.RunStep)
+		}
+		return ps
+
 	case *config.RunStep:
 		rs := &rstypes.RunStep{}
 
-		env := genEnv(cs.Environment, variables)
+		env := genEnv(cs.Environment, variables, exprVariables)
 
 		rs.Type = cs.Type
 		rs.Name = cs.Name
@@ -126,7 +191,14 @@ fi
 		rs.Environment = env
 		rs.WorkingDir = cs.WorkingDir
 		rs.Shell = cs.Shell
+		if cs.ShellOptions != nil {
+			rs.ShellOptions = &rstypes.ShellOptions{
+				Errexit:  cs.ShellOptions.Errexit,
+				Pipefail: cs.ShellOptions.Pipefail,
+			}
+		}
 		rs.User = cs.User
+		rs.Retries = retriesFromConfigRetries(cs.Retries)
 		return rs
 
 	case *config.SaveToWorkspaceStep:
@@ -181,6 +253,32 @@ fi
 
 		return rws
 
+	case *config.SaveTestReportStep:
+		strs := &rstypes.SaveTestReportStep{}
+		strs.Name = cs.Name
+		strs.Type = cs.Type
+		strs.Format = rstypes.TestReportFormat(cs.Format)
+		strs.Paths = cs.Paths
+
+		return strs
+
+	case *config.SaveCoverageReportStep:
+		scrs := &rstypes.SaveCoverageReportStep{}
+		scrs.Name = cs.Name
+		scrs.Type = cs.Type
+		scrs.Format = rstypes.CoverageReportFormat(cs.Format)
+		scrs.Paths = cs.Paths
+
+		return scrs
+
+	case *config.ExportEnvStep:
+		ees := &rstypes.ExportEnvStep{}
+		ees.Name = cs.Name
+		ees.Type = cs.Type
+		ees.Path = cs.Path
+
+		return ees
+
 	default:
 		panic(fmt.Errorf("unknown config step type: %s", util.Dump(cs)))
 	}
@@ -188,35 +286,54 @@ fi
 
 // GenRunConfigTasks generates a run config tasks from a run in the config, expanding all the references to tasks
 // this functions assumes that the config is already checked for possible errors (i.e referenced task must exits)
-func GenRunConfigTasks(uuid util.UUIDGenerator, c *config.Config, runName string, variables map[string]string, branch, tag, ref string) map[string]*rstypes.RunConfigTask {
+// pr are the pull request attributes, nil if the run isn't for a pull request
+func GenRunConfigTasks(uuid util.UUIDGenerator, c *config.Config, runName string, variables, exprVariables map[string]string, branch, tag, ref string, pr *types.PullRequestAttributes) map[string]*rstypes.RunConfigTask {
 	cr := c.Run(runName)
 
 	rcts := map[string]*rstypes.RunConfigTask{}
 
 	for _, ct := range cr.Tasks {
-		include := types.MatchWhen(whenFromConfigWhen(ct.When), branch, tag, ref)
+		tExprVariables := taskExprVariables(exprVariables, ct)
+		include := MatchWhen(ct.When, tExprVariables, branch, tag, ref, pr)
 
 		steps := make(rstypes.Steps, len(ct.Steps))
+		hasStepsWhen := false
 		for i, cpts := range ct.Steps {
-			steps[i] = stepFromConfigStep(cpts, variables)
+			steps[i] = stepFromConfigStep(cpts, variables, tExprVariables)
+			if when := configStepWhen(cpts); when != "" {
+				if b, ok := steps[i].(interface{ Base() *rstypes.BaseStep }); ok {
+					b.Base().When = when
+					hasStepsWhen = true
+				}
+			}
 		}
 
-		tEnv := genEnv(ct.Environment, variables)
+		tEnv := genEnv(ct.Environment, variables, tExprVariables)
+		tEnv[EnvTaskName] = ct.Name
 
 		t := &rstypes.RunConfigTask{
 			ID:                   uuid.New(ct.Name).String(),
 			Name:                 ct.Name,
-			Runtime:              genRuntime(c, ct.Runtime, variables),
+			Runtime:              genRuntime(c, ct.Runtime, variables, tExprVariables),
 			Environment:          tEnv,
 			WorkingDir:           ct.WorkingDir,
 			Shell:                ct.Shell,
 			User:                 ct.User,
 			Steps:                steps,
+			Retries:              retriesFromConfigRetries(ct.Retries),
 			IgnoreFailure:        ct.IgnoreFailure,
 			Skip:                 !include,
 			NeedsApproval:        ct.Approval,
+			ApprovalTimeout:      approvalTimeoutFromConfigApprovalTimeout(ct.ApprovalTimeout),
+			Stage:                ct.Stage,
+			Idempotent:           ct.Idempotent,
+			Outputs:              ct.Outputs,
 			DockerRegistriesAuth: make(map[string]rstypes.DockerRegistryAuth),
 		}
+		if hasStepsWhen {
+			t.ExprVariables = tExprVariables
+		}
+		t.SecretFiles = genSecretFiles(ct.SecretFiles, variables)
 
 		if c.DockerRegistriesAuth != nil {
 			for regname, auth := range c.DockerRegistriesAuth {
@@ -424,6 +541,82 @@ func GetAllParents(rcts map[string]*rstypes.RunConfigTask, task *rstypes.RunConf
 	return parents
 }
 
+// GetChildren returns direct children of task.
+func GetChildren(rcts map[string]*rstypes.RunConfigTask, task *rstypes.RunConfigTask) []*rstypes.RunConfigTask {
+	children := []*rstypes.RunConfigTask{}
+	for _, t := range rcts {
+		if _, ok := t.Depends[task.ID]; ok {
+			children = append(children, t)
+		}
+	}
+	return children
+}
+
+// GetAllChildren returns all the children (both direct and descendants) of
+// task.
+func GetAllChildren(rcts map[string]*rstypes.RunConfigTask, task *rstypes.RunConfigTask) []*rstypes.RunConfigTask {
+	cMap := map[string]*rstypes.RunConfigTask{}
+	nextChildren := GetChildren(rcts, task)
+
+	for len(nextChildren) > 0 {
+		children := nextChildren
+		nextChildren = []*rstypes.RunConfigTask{}
+		for _, child := range children {
+			if _, ok := cMap[child.ID]; ok {
+				continue
+			}
+			cMap[child.ID] = child
+			nextChildren = append(nextChildren, GetChildren(rcts, child)...)
+		}
+	}
+
+	children := make([]*rstypes.RunConfigTask, 0, len(cMap))
+	for _, v := range cMap {
+		children = append(children, v)
+	}
+	return children
+}
+
+// Stage is a group of run config tasks with the same stage. Tasks without a
+// stage are grouped in a stage with an empty name.
+type Stage struct {
+	Name string
+	// Tasks are the stage tasks ordered by level and name
+	Tasks []*rstypes.RunConfigTask
+}
+
+// GenStages groups the run config tasks by stage. The tasks levels must be
+// already generated (see GenTasksLevels). The stages are ordered by the minimum
+// level of their tasks (then by name) so a stage comes after the stages it
+// depends on.
+func GenStages(rcts map[string]*rstypes.RunConfigTask) []*Stage {
+	stagesTasks := map[string][]*rstypes.RunConfigTask{}
+	for _, rct := range rcts {
+		stagesTasks[rct.Stage] = append(stagesTasks[rct.Stage], rct)
+	}
+
+	stages := make([]*Stage, 0, len(stagesTasks))
+	for name, tasks := range stagesTasks {
+		sort.Slice(tasks, func(i, j int) bool {
+			if tasks[i].Level != tasks[j].Level {
+				return tasks[i].Level < tasks[j].Level
+			}
+			return tasks[i].Name < tasks[j].Name
+		})
+		stages = append(stages, &Stage{Name: name, Tasks: tasks})
+	}
+	// the stage tasks are ordered by level so the first one has the stage min
+	// level
+	sort.Slice(stages, func(i, j int) bool {
+		if stages[i].Tasks[0].Level != stages[j].Tasks[0].Level {
+			return stages[i].Tasks[0].Level < stages[j].Tasks[0].Level
+		}
+		return stages[i].Name < stages[j].Name
+	})
+
+	return stages
+}
+
 func GetParentDependConditions(t, pt *rstypes.RunConfigTask) []rstypes.RunConfigTaskDependCondition {
 	if dt, ok := t.Depends[pt.ID]; ok {
 		return dt.Conditions
@@ -431,14 +624,41 @@ func GetParentDependConditions(t, pt *rstypes.RunConfigTask) []rstypes.RunConfig
 	return nil
 }
 
-func genEnv(cenv map[string]config.Value, variables map[string]string) map[string]string {
+// genEnv generates the environment evaluating the template expressions of
+// the string values
+func genEnv(cenv map[string]config.Value, variables, exprVariables map[string]string) map[string]string {
 	env := map[string]string{}
 	for envName, envVar := range cenv {
+		if envVar.Type == config.ValueTypeString {
+			env[envName] = evalTemplate(envVar.Value, exprVariables)
+			continue
+		}
 		env[envName] = genValue(envVar, variables)
 	}
 	return env
 }
 
+// genSecretFiles generates the task secret files. The config must be already
+// checked so the modes are valid
+func genSecretFiles(csfs []*config.SecretFile, variables map[string]string) []*rstypes.SecretFile {
+	if len(csfs) == 0 {
+		return nil
+	}
+	sfs := make([]*rstypes.SecretFile, len(csfs))
+	for i, csf := range csfs {
+		mode := uint64(0400)
+		if csf.Mode != "" {
+			mode, _ = strconv.ParseUint(csf.Mode, 8, 32)
+		}
+		sfs[i] = &rstypes.SecretFile{
+			Path:    csf.Path,
+			Mode:    os.FileMode(mode),
+			Content: genValue(csf.Value, variables),
+		}
+	}
+	return sfs
+}
+
 func genValue(val config.Value, variables map[string]string) string {
 	switch val.Type {
 	case config.ValueTypeString:
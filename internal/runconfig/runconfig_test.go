@@ -15,8 +15,15 @@
 package runconfig
 
 import (
+	"bytes"
+	"encoding/base64"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"agola.io/agola/internal/config"
@@ -625,10 +632,11 @@ func TestCheckRunConfig(t *testing.T) {
 
 func TestGenRunConfig(t *testing.T) {
 	tests := []struct {
-		name      string
-		in        *config.Config
-		variables map[string]string
-		out       map[string]*rstypes.RunConfigTask
+		name          string
+		in            *config.Config
+		variables     map[string]string
+		exprVariables map[string]string
+		out           map[string]*rstypes.RunConfigTask
 	}{
 		{
 			name: "test runconfig generation",
@@ -745,6 +753,7 @@ func TestGenRunConfig(t *testing.T) {
 						},
 					},
 					Environment: map[string]string{
+						"AGOLA_TASK_NAME":   "task01",
 						"ENV01":             "ENV01",
 						"ENVFROMVARIABLE01": "VARVALUE01",
 					},
@@ -819,7 +828,7 @@ func TestGenRunConfig(t *testing.T) {
 							},
 						},
 					},
-					Environment: map[string]string{},
+					Environment: map[string]string{"AGOLA_TASK_NAME": "task01"},
 					Steps: rstypes.Steps{
 						&rstypes.RunStep{BaseStep: rstypes.BaseStep{Type: "run", Name: "command01"}, Command: "command01", Environment: map[string]string{}},
 					},
@@ -916,18 +925,189 @@ func TestGenRunConfig(t *testing.T) {
 							},
 						},
 					},
-					Environment: map[string]string{},
+					Environment: map[string]string{"AGOLA_TASK_NAME": "task01"},
 					Steps: rstypes.Steps{
 						&rstypes.RunStep{BaseStep: rstypes.BaseStep{Type: "run", Name: "command01"}, Command: "command01", Environment: map[string]string{}},
 					},
 				},
 			},
 		},
+		{
+			name: "test secret files",
+			in: &config.Config{
+				Runs: []*config.Run{
+					&config.Run{
+						Name: "run01",
+						Tasks: []*config.Task{
+							&config.Task{
+								Name: "task01",
+								Runtime: &config.Runtime{
+									Type: "pod",
+									Containers: []*config.Container{
+										&config.Container{
+											Image: "image01",
+										},
+									},
+								},
+								SecretFiles: []*config.SecretFile{
+									{
+										Path:  "/root/.kube/config",
+										Value: config.Value{Type: config.ValueTypeFromVariable, Value: "kubeconfig"},
+									},
+									{
+										Path:  "/etc/keystore.jks",
+										Mode:  "0440",
+										Value: config.Value{Type: config.ValueTypeFromVariable, Value: "keystore"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			variables: map[string]string{
+				"kubeconfig": "KUBECONFIG",
+				"keystore":   "KEYSTORE",
+			},
+			out: map[string]*rstypes.RunConfigTask{
+				uuid.New("task01").String(): &rstypes.RunConfigTask{
+					ID:                   uuid.New("task01").String(),
+					Name:                 "task01",
+					Depends:              map[string]*rstypes.RunConfigTaskDepend{},
+					DockerRegistriesAuth: map[string]rstypes.DockerRegistryAuth{},
+					Runtime: &rstypes.Runtime{Type: rstypes.RuntimeType("pod"),
+						Containers: []*rstypes.Container{
+							{
+								Image:       "image01",
+								Environment: map[string]string{},
+							},
+						},
+					},
+					Environment: map[string]string{"AGOLA_TASK_NAME": "task01"},
+					Steps:       rstypes.Steps{},
+					SecretFiles: []*rstypes.SecretFile{
+						{Path: "/root/.kube/config", Mode: 0400, Content: "KUBECONFIG"},
+						{Path: "/etc/keystore.jks", Mode: 0440, Content: "KEYSTORE"},
+					},
+				},
+			},
+		},
+		{
+			name: "test templates",
+			in: &config.Config{
+				Runs: []*config.Run{
+					&config.Run{
+						Name: "run01",
+						Tasks: []*config.Task{
+							&config.Task{
+								Name: "task01",
+								When: &config.When{Expr: `{{ branch == "main" && arch }}`},
+								Runtime: &config.Runtime{
+									Type: "pod",
+									Arch: "amd64",
+									Containers: []*config.Container{
+										&config.Container{
+											Image: "image01:{{ tag || 'latest' }}",
+										},
+									},
+								},
+								Environment: map[string]config.Value{
+									"TARGET": config.Value{Type: config.ValueTypeString, Value: "{{ branch }}-{{ arch }}"},
+								},
+								Steps: config.Steps{
+									&config.RunStep{
+										BaseStep: config.BaseStep{
+											Type: "run",
+											Name: "command01",
+										},
+										Command: "command01",
+										Environment: map[string]config.Value{
+											"REF": config.Value{Type: config.ValueTypeString, Value: "{{ ref }}"},
+										},
+									},
+								},
+							},
+							&config.Task{
+								Name: "task02",
+								When: &config.When{Expr: `{{ branch != "main" }}`},
+								Runtime: &config.Runtime{
+									Type: "pod",
+									Containers: []*config.Container{
+										&config.Container{
+											Image: "image01",
+										},
+									},
+								},
+								Steps: config.Steps{
+									&config.RunStep{
+										BaseStep: config.BaseStep{
+											Type: "run",
+											Name: "notify",
+											When: &config.When{Expr: `{{ task_status == "failed" }}`},
+										},
+										Command: "notify",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			exprVariables: map[string]string{
+				config.ExprVariableBranch: "main",
+				config.ExprVariableRef:    "refs/heads/main",
+			},
+			out: map[string]*rstypes.RunConfigTask{
+				uuid.New("task01").String(): &rstypes.RunConfigTask{
+					ID:                   uuid.New("task01").String(),
+					Name:                 "task01",
+					Depends:              map[string]*rstypes.RunConfigTaskDepend{},
+					DockerRegistriesAuth: map[string]rstypes.DockerRegistryAuth{},
+					Runtime: &rstypes.Runtime{Type: rstypes.RuntimeType("pod"),
+						Arch: "amd64",
+						Containers: []*rstypes.Container{
+							{
+								Image:       "image01:latest",
+								Environment: map[string]string{},
+							},
+						},
+					},
+					Environment: map[string]string{"AGOLA_TASK_NAME": "task01", "TARGET": "main-amd64"},
+					Steps: rstypes.Steps{
+						&rstypes.RunStep{BaseStep: rstypes.BaseStep{Type: "run", Name: "command01"}, Command: "command01", Environment: map[string]string{"REF": "refs/heads/main"}},
+					},
+				},
+				uuid.New("task02").String(): &rstypes.RunConfigTask{
+					ID:                   uuid.New("task02").String(),
+					Name:                 "task02",
+					Depends:              map[string]*rstypes.RunConfigTaskDepend{},
+					DockerRegistriesAuth: map[string]rstypes.DockerRegistryAuth{},
+					Runtime: &rstypes.Runtime{Type: rstypes.RuntimeType("pod"),
+						Containers: []*rstypes.Container{
+							{
+								Image:       "image01",
+								Environment: map[string]string{},
+							},
+						},
+					},
+					Environment: map[string]string{"AGOLA_TASK_NAME": "task02"},
+					Steps: rstypes.Steps{
+						&rstypes.RunStep{BaseStep: rstypes.BaseStep{Type: "run", Name: "notify", When: `{{ task_status == "failed" }}`}, Command: "notify", Environment: map[string]string{}},
+					},
+					Skip: true,
+					ExprVariables: map[string]string{
+						config.ExprVariableBranch: "main",
+						config.ExprVariableRef:    "refs/heads/main",
+						config.ExprVariableArch:   "",
+					},
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			out := GenRunConfigTasks(uuid, tt.in, "run01", tt.variables, "", "", "")
+			out := GenRunConfigTasks(uuid, tt.in, "run01", tt.variables, tt.exprVariables, "", "", "", nil)
 
 			//if err != nil {
 			//	t.Fatalf("unexpected error: %v", err)
@@ -938,3 +1118,259 @@ func TestGenRunConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestCloneStepPatch(t *testing.T) {
+	for _, cmd := range []string{"sh", "git", "base64"} {
+		if _, err := exec.LookPath(cmd); err != nil {
+			t.Skipf("missing %q command", cmd)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	gitEnv := append(os.Environ(),
+		"GIT_AUTHOR_NAME=user01", "GIT_AUTHOR_EMAIL=user01@example.com",
+		"GIT_COMMITTER_NAME=user01", "GIT_COMMITTER_EMAIL=user01@example.com",
+	)
+	git := func(dir string, args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = gitEnv
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %v: %s", args, err, out)
+		}
+		return string(out)
+	}
+
+	// create the repository and generate the patch from its local changes
+	repoDir := filepath.Join(dir, "repo")
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	git(repoDir, "init", "-q")
+	if err := ioutil.WriteFile(filepath.Join(repoDir, "file01"), []byte("line01\n"), 0644); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	git(repoDir, "add", "file01")
+	git(repoDir, "commit", "-q", "-m", "commit01")
+	commitSHA := strings.TrimSpace(git(repoDir, "rev-parse", "HEAD"))
+	ref := strings.TrimSpace(git(repoDir, "symbolic-ref", "HEAD"))
+
+	if err := ioutil.WriteFile(filepath.Join(repoDir, "file01"), []byte("line01\nline02\n"), 0644); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// binary files are also supported
+	if err := ioutil.WriteFile(filepath.Join(repoDir, "file02"), []byte{0, 1, 2, 3}, 0644); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	git(repoDir, "add", "-N", "file02")
+	patch := git(repoDir, "diff", "--binary")
+	git(repoDir, "reset", "-q", "--hard")
+	if err := os.RemoveAll(filepath.Join(repoDir, "file02")); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	rs := stepFromConfigStep(&config.CloneStep{}, nil, nil).(*config.RunStep)
+
+	tests := []struct {
+		name  string
+		patch string
+		files map[string][]byte
+		err   bool
+	}{
+		{
+			name:  "no patch",
+			files: map[string][]byte{"file01": []byte("line01\n")},
+		},
+		{
+			name:  "patch",
+			patch: patch,
+			files: map[string][]byte{"file01": []byte("line01\nline02\n"), "file02": {0, 1, 2, 3}},
+		},
+		{
+			name:  "patch not applying",
+			patch: strings.Replace(patch, "line01", "line03", -1),
+			err:   true,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			homeDir := filepath.Join(dir, fmt.Sprintf("home%02d", i))
+			workDir := filepath.Join(dir, fmt.Sprintf("work%02d", i))
+			for _, d := range []string{homeDir, workDir} {
+				if err := os.MkdirAll(d, 0755); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+			}
+
+			cmd := exec.Command("sh", "-e", "-c", rs.Command)
+			cmd.Dir = workDir
+			cmd.Env = append(gitEnv,
+				"HOME="+homeDir,
+				"AGOLA_REPOSITORY_URL="+repoDir,
+				"AGOLA_GIT_HOST=localhost",
+				"AGOLA_GIT_PORT=22",
+				"AGOLA_GIT_REF="+ref,
+				"AGOLA_GIT_COMMITSHA="+commitSHA,
+			)
+			if tt.patch != "" {
+				cmd.Env = append(cmd.Env, "AGOLA_GIT_PATCH="+base64.StdEncoding.EncodeToString([]byte(tt.patch)))
+			}
+			out, err := cmd.CombinedOutput()
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected clone step error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("clone step failed: %v: %s", err, out)
+			}
+
+			for name, data := range tt.files {
+				fdata, err := ioutil.ReadFile(filepath.Join(workDir, name))
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				if !bytes.Equal(fdata, data) {
+					t.Fatalf("file %q: expected content %q, got %q", name, data, fdata)
+				}
+			}
+		})
+	}
+}
+
+func TestGenStages(t *testing.T) {
+	tests := []struct {
+		name       string
+		configData string
+		// taskStages are the stages assigned to the tasks
+		taskStages map[string]string
+		// stages are the stages tasks names
+		stages map[string][]string
+		// stagesOrder are the ordered stages names
+		stagesOrder []string
+	}{
+		{
+			name: "no stages",
+			configData: `
+runs:
+  - name: run01
+    tasks:
+      - name: task02
+        runtime: { containers: [{ image: image01 }] }
+        steps: [{ run: { command: command01 } }]
+        depends: [task01]
+      - name: task01
+        runtime: { containers: [{ image: image01 }] }
+        steps: [{ run: { command: command01 } }]
+`,
+			taskStages:  map[string]string{"task01": "", "task02": ""},
+			stages:      map[string][]string{"": {"task01", "task02"}},
+			stagesOrder: []string{""},
+		},
+		{
+			name: "stages",
+			configData: `
+runs:
+  - name: run01
+    tasks:
+      - name: notify
+        runtime: { containers: [{ image: image01 }] }
+        steps: [{ run: { command: command01 } }]
+        stage: build
+        depends: [lint]
+      - name: test-web
+        runtime: { containers: [{ image: image01 }] }
+        steps: [{ run: { command: command01 } }]
+        stage: test
+        depends: [build-web]
+      - name: test-api
+        runtime: { containers: [{ image: image01 }] }
+        steps: [{ run: { command: command01 } }]
+        stage: test
+        depends: [build-api]
+      - name: e2e
+        runtime: { containers: [{ image: image01 }] }
+        steps: [{ run: { command: command01 } }]
+        stage: acceptance
+        depends: [build-web]
+      - name: build-web
+        runtime: { containers: [{ image: image01 }] }
+        steps: [{ run: { command: command01 } }]
+        stage: build
+      - name: build-api
+        runtime: { containers: [{ image: image01 }] }
+        steps: [{ run: { command: command01 } }]
+        stage: build
+      - name: lint
+        runtime: { containers: [{ image: image01 }] }
+        steps: [{ run: { command: command01 } }]
+`,
+			taskStages: map[string]string{
+				"build-api": "build",
+				"build-web": "build",
+				"notify":    "build",
+				"test-api":  "test",
+				"test-web":  "test",
+				"e2e":       "acceptance",
+				"lint":      "",
+			},
+			stages: map[string][]string{
+				// the stage tasks are ordered by level and name
+				"build":      {"build-api", "build-web", "notify"},
+				"test":       {"test-api", "test-web"},
+				"acceptance": {"e2e"},
+				"":           {"lint"},
+			},
+			// the stages are ordered by their tasks min level and name, a
+			// stage with a task depending on a later stage keeps its position
+			stagesOrder: []string{"", "build", "acceptance", "test"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := config.ParseConfig([]byte(tt.configData), config.ConfigFormatJSON)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			rcts := GenRunConfigTasks(uuid, c, "run01", nil, nil, "master", "", "", nil)
+			if err := GenTasksLevels(rcts); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			taskStages := map[string]string{}
+			for _, rct := range rcts {
+				taskStages[rct.Name] = rct.Stage
+			}
+			if diff := cmp.Diff(tt.taskStages, taskStages); diff != "" {
+				t.Fatalf("tasks stages mismatch (-want +got):\n%s", diff)
+			}
+
+			stages := map[string][]string{}
+			stagesOrder := []string{}
+			for _, stage := range GenStages(rcts) {
+				tasks := []string{}
+				for _, rct := range stage.Tasks {
+					tasks = append(tasks, rct.Name)
+				}
+				stages[stage.Name] = tasks
+				stagesOrder = append(stagesOrder, stage.Name)
+			}
+			if diff := cmp.Diff(tt.stages, stages); diff != "" {
+				t.Fatalf("stages tasks mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.stagesOrder, stagesOrder); diff != "" {
+				t.Fatalf("stages order mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runconfig
+
+import (
+	"agola.io/agola/internal/config"
+	"agola.io/agola/internal/expr"
+	"agola.io/agola/internal/services/types"
+)
+
+// exprContextVariables maps the config template expressions variables to the
+// run context variables
+var exprContextVariables = map[string]string{
+	config.ExprVariableRunName:       VariableRunName,
+	config.ExprVariableRefType:       VariableGitRefType,
+	config.ExprVariableBranch:        VariableGitBranch,
+	config.ExprVariableTag:           VariableGitTag,
+	config.ExprVariableRef:           VariableGitRef,
+	config.ExprVariableCommitSHA:     VariableGitCommitSHA,
+	config.ExprVariablePullRequestID: VariableGitPullRequestID,
+}
+
+// ExprVariables returns the variables of the config template expressions from
+// the run context variables
+func ExprVariables(contextVariables map[string]string) map[string]string {
+	variables := make(map[string]string, len(exprContextVariables))
+	for name, contextName := range exprContextVariables {
+		variables[name] = contextVariables[contextName]
+	}
+	return variables
+}
+
+// taskExprVariables returns the expressions variables of a task adding the
+// task runtime arch
+func taskExprVariables(exprVariables map[string]string, ct *config.Task) map[string]string {
+	variables := make(map[string]string, len(exprVariables)+1)
+	for k, v := range exprVariables {
+		variables[k] = v
+	}
+	if ct.Runtime != nil {
+		variables[config.ExprVariableArch] = string(ct.Runtime.Arch)
+	}
+	return variables
+}
+
+// evalTemplate evaluates the template expressions in s. The templates are
+// checked when parsing the config, the ones that cannot be parsed (i.e. in
+// the remote tasks) are kept as is.
+func evalTemplate(s string, exprVariables map[string]string) string {
+	if !expr.HasTemplate(s) {
+		return s
+	}
+	t, err := expr.Parse(s)
+	if err != nil {
+		return s
+	}
+	return t.Eval(exprVariables)
+}
+
+// MatchWhen reports whether the config when conditions, including the when
+// expression, are satisfied
+func MatchWhen(cw *config.When, exprVariables map[string]string, branch, tag, ref string, pr *types.PullRequestAttributes) bool {
+	if cw != nil && cw.Expr != "" {
+		t, err := expr.Parse(cw.Expr)
+		if err != nil || !t.EvalBool(exprVariables) {
+			return false
+		}
+	}
+	return types.MatchWhen(whenFromConfigWhen(cw), branch, tag, ref, pr)
+}
+
+// configStepWhen returns the when expression of a config step
+func configStepWhen(step interface{}) string {
+	b, ok := step.(interface{ Base() *config.BaseStep })
+	if !ok || b.Base().When == nil {
+		return ""
+	}
+	return b.Base().When.Expr
+}
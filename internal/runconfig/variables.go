@@ -0,0 +1,97 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runconfig
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"agola.io/agola/internal/config"
+	"agola.io/agola/internal/services/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+var configValueType = reflect.TypeOf(config.Value{})
+
+// CheckRunVariables checks that all the variables referenced with
+// from_variable by the run are defined. The tasks that will be skipped since
+// their when conditions don't match aren't checked.
+func CheckRunVariables(c *config.Config, runName string, variables, exprVariables map[string]string, branch, tag, ref string, pr *types.PullRequestAttributes) error {
+	cr := c.Run(runName)
+
+	missing := map[string]struct{}{}
+	collect := func(v interface{}) {
+		walkConfigValues(reflect.ValueOf(v), func(val config.Value) {
+			if val.Type != config.ValueTypeFromVariable {
+				return
+			}
+			if _, ok := variables[val.Value]; !ok {
+				missing[val.Value] = struct{}{}
+			}
+		})
+	}
+
+	collect(c.DockerRegistriesAuth)
+	collect(cr.DockerRegistriesAuth)
+	for _, ct := range cr.Tasks {
+		if !MatchWhen(ct.When, taskExprVariables(exprVariables, ct), branch, tag, ref, pr) {
+			continue
+		}
+		collect(ct)
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(missing))
+	for name := range missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return errors.Errorf("undefined variables referenced by the run: %s", strings.Join(names, ", "))
+}
+
+// walkConfigValues calls fn for every config.Value contained in v
+func walkConfigValues(v reflect.Value, fn func(config.Value)) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			walkConfigValues(v.Elem(), fn)
+		}
+	case reflect.Struct:
+		if v.Type() == configValueType {
+			fn(v.Interface().(config.Value))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath != "" {
+				// skip unexported fields
+				continue
+			}
+			walkConfigValues(v.Field(i), fn)
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			walkConfigValues(v.MapIndex(k), fn)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			walkConfigValues(v.Index(i), fn)
+		}
+	}
+}
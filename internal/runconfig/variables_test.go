@@ -0,0 +1,120 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runconfig
+
+import (
+	"testing"
+
+	"agola.io/agola/internal/config"
+)
+
+func TestCheckRunVariables(t *testing.T) {
+	configData := `
+docker_registries_auth:
+  index.docker.io:
+    username: { from_variable: registryuser }
+    password: { from_variable: registrypassword }
+runs:
+  - name: run01
+    tasks:
+      - name: build
+        runtime:
+          type: pod
+          containers:
+            - image: image01
+              environment:
+                CONTAINER_VAR: { from_variable: containervar }
+        environment:
+          TASK_VAR: { from_variable: taskvar }
+        steps:
+          - run:
+              command: make
+              environment:
+                STEP_VAR: { from_variable: stepvar }
+      - name: deploy
+        runtime:
+          type: pod
+          containers:
+            - image: image01
+        steps:
+          - run:
+              command: deploy
+              environment:
+                TOKEN: { from_variable: deploytoken }
+        when:
+          branch: master
+`
+
+	c, err := config.ParseConfig([]byte(configData), config.ConfigFormatJSON)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	allVariables := map[string]string{
+		"containervar":     "",
+		"registryuser":     "",
+		"registrypassword": "",
+		"taskvar":          "",
+		"stepvar":          "",
+		"deploytoken":      "",
+	}
+
+	tests := []struct {
+		name      string
+		variables map[string]string
+		branch    string
+		err       string
+	}{
+		{
+			name:      "all variables defined",
+			variables: allVariables,
+			branch:    "master",
+		},
+		{
+			name:   "missing variables",
+			branch: "master",
+			err:    "undefined variables referenced by the run: containervar, deploytoken, registrypassword, registryuser, stepvar, taskvar",
+		},
+		{
+			name: "variables of skipped tasks aren't checked",
+			variables: map[string]string{
+				"containervar":     "",
+				"registryuser":     "",
+				"registrypassword": "",
+				"taskvar":          "",
+				"stepvar":          "",
+			},
+			branch: "feature",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckRunVariables(c, "run01", tt.variables, nil, tt.branch, "", "refs/heads/"+tt.branch, nil)
+			if tt.err != "" {
+				if err == nil {
+					t.Fatalf("expected error %q, got nil", tt.err)
+				}
+				if err.Error() != tt.err {
+					t.Fatalf("expected error %q, got: %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"sort"
+	"strings"
+
+	errors "golang.org/x/xerrors"
+)
+
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// element is a minimal xml element tree node keeping the namespace prefixes
+// as written in the document, needed to canonicalize the signed elements
+type element struct {
+	parent *element
+
+	prefix string
+	local  string
+	// attrs are the element attributes, namespace declarations excluded. The
+	// attribute Name.Space is the prefix.
+	attrs []xml.Attr
+	// ns are the namespace declarations, the default namespace has an empty
+	// prefix
+	ns map[string]string
+	// children are *element or string (character data)
+	children []interface{}
+}
+
+// parseXML parses an xml document. Comments and processing instructions are
+// ignored and documents with a DTD are rejected.
+func parseXML(data []byte) (*element, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+
+	var root, cur *element
+	for {
+		t, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Errorf("failed to parse xml: %w", err)
+		}
+
+		switch t := t.(type) {
+		case xml.StartElement:
+			if root != nil && cur == nil {
+				return nil, errors.Errorf("multiple root elements")
+			}
+			e := &element{
+				parent: cur,
+				prefix: t.Name.Space,
+				local:  t.Name.Local,
+				ns:     map[string]string{},
+			}
+			for _, a := range t.Attr {
+				switch {
+				case a.Name.Space == "xmlns":
+					e.ns[a.Name.Local] = a.Value
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					e.ns[""] = a.Value
+				default:
+					e.attrs = append(e.attrs, a)
+				}
+			}
+			if cur == nil {
+				root = e
+			} else {
+				cur.children = append(cur.children, e)
+			}
+			cur = e
+		case xml.EndElement:
+			if cur == nil || cur.prefix != t.Name.Space || cur.local != t.Name.Local {
+				return nil, errors.Errorf("unexpected end element %q", t.Name.Local)
+			}
+			cur = cur.parent
+		case xml.CharData:
+			if cur != nil {
+				cur.children = append(cur.children, string(t))
+			}
+		case xml.Directive:
+			return nil, errors.Errorf("xml directives aren't supported")
+		}
+	}
+	if root == nil {
+		return nil, errors.Errorf("empty xml document")
+	}
+	if cur != nil {
+		return nil, errors.Errorf("unexpected end of xml document")
+	}
+
+	return root, nil
+}
+
+// lookupNS returns the namespace bound to prefix in the element scope
+func (e *element) lookupNS(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return xmlNamespace, true
+	}
+	for n := e; n != nil; n = n.parent {
+		if uri, ok := n.ns[prefix]; ok {
+			return uri, true
+		}
+	}
+	return "", false
+}
+
+// namespace returns the element namespace
+func (e *element) namespace() string {
+	uri, _ := e.lookupNS(e.prefix)
+	return uri
+}
+
+func (e *element) is(namespace, local string) bool {
+	return e.local == local && e.namespace() == namespace
+}
+
+// attr returns the value of the unqualified attribute with the provided name
+func (e *element) attr(name string) string {
+	for _, a := range e.attrs {
+		if a.Name.Space == "" && a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// childElements returns the child elements with the provided namespace and
+// local name
+func (e *element) childElements(namespace, local string) []*element {
+	var elements []*element
+	for _, c := range e.children {
+		if c, ok := c.(*element); ok && c.is(namespace, local) {
+			elements = append(elements, c)
+		}
+	}
+	return elements
+}
+
+// childElement returns the first child element with the provided namespace
+// and local name
+func (e *element) childElement(namespace, local string) *element {
+	elements := e.childElements(namespace, local)
+	if len(elements) == 0 {
+		return nil
+	}
+	return elements[0]
+}
+
+// text returns the element character data
+func (e *element) text() string {
+	var b strings.Builder
+	for _, c := range e.children {
+		if s, ok := c.(string); ok {
+			b.WriteString(s)
+		}
+	}
+	return b.String()
+}
+
+func qname(prefix, local string) string {
+	if prefix == "" {
+		return local
+	}
+	return prefix + ":" + local
+}
+
+// canonicalize returns the exclusive xml canonicalization (without comments)
+// of the element subtree. The exclude element, if not nil, and its subtree are
+// omitted (used for the enveloped signature transform). The inclusive
+// prefixes are the prefixes handled as in the inclusive canonicalization.
+func canonicalize(e, exclude *element, inclusivePrefixes []string) []byte {
+	c := &canonicalizer{exclude: exclude, inclusivePrefixes: inclusivePrefixes}
+	c.writeElement(e, map[string]string{})
+	return c.buf.Bytes()
+}
+
+type canonicalizer struct {
+	buf               bytes.Buffer
+	exclude           *element
+	inclusivePrefixes []string
+}
+
+type nsDecl struct {
+	prefix string
+	uri    string
+}
+
+func (c *canonicalizer) writeElement(e *element, rendered map[string]string) {
+	// namespaces visibly utilized by the element and its attributes
+	used := map[string]struct{}{e.prefix: {}}
+	for _, a := range e.attrs {
+		if a.Name.Space != "" {
+			used[a.Name.Space] = struct{}{}
+		}
+	}
+	for _, p := range c.inclusivePrefixes {
+		if p == "#default" {
+			p = ""
+		}
+		used[p] = struct{}{}
+	}
+
+	nrendered := make(map[string]string, len(rendered))
+	for p, uri := range rendered {
+		nrendered[p] = uri
+	}
+	decls := []nsDecl{}
+	for p := range used {
+		if p == "xml" {
+			continue
+		}
+		uri, ok := e.lookupNS(p)
+		if !ok && p != "" {
+			continue
+		}
+		prev, wasRendered := rendered[p]
+		if wasRendered && prev == uri {
+			continue
+		}
+		if !wasRendered && p == "" && uri == "" {
+			continue
+		}
+		decls = append(decls, nsDecl{prefix: p, uri: uri})
+		nrendered[p] = uri
+	}
+	sort.Slice(decls, func(i, j int) bool { return decls[i].prefix < decls[j].prefix })
+
+	attrs := make([]xml.Attr, len(e.attrs))
+	copy(attrs, e.attrs)
+	attrNS := func(a xml.Attr) string {
+		if a.Name.Space == "" {
+			return ""
+		}
+		uri, _ := e.lookupNS(a.Name.Space)
+		return uri
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		nsi, nsj := attrNS(attrs[i]), attrNS(attrs[j])
+		if nsi != nsj {
+			return nsi < nsj
+		}
+		return attrs[i].Name.Local < attrs[j].Name.Local
+	})
+
+	name := qname(e.prefix, e.local)
+	c.buf.WriteString("<" + name)
+	for _, d := range decls {
+		if d.prefix == "" {
+			c.buf.WriteString(" xmlns")
+		} else {
+			c.buf.WriteString(" xmlns:" + d.prefix)
+		}
+		c.buf.WriteString(`="` + escapeAttr(d.uri) + `"`)
+	}
+	for _, a := range attrs {
+		c.buf.WriteString(" " + qname(a.Name.Space, a.Name.Local) + `="` + escapeAttr(a.Value) + `"`)
+	}
+	c.buf.WriteString(">")
+
+	for _, child := range e.children {
+		switch child := child.(type) {
+		case string:
+			c.buf.WriteString(escapeText(child))
+		case *element:
+			if child == c.exclude {
+				continue
+			}
+			c.writeElement(child, nrendered)
+		}
+	}
+
+	c.buf.WriteString("</" + name + ">")
+}
+
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+
+var attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", "\"", "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+func escapeAttr(s string) string {
+	return attrEscaper.Replace(s)
+}
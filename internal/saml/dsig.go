@@ -0,0 +1,180 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saml
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"strings"
+
+	// register the hashes used by the signatures
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	dsigNamespace = "http://www.w3.org/2000/09/xmldsig#"
+
+	algExcC14N            = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	algEnvelopedSignature = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	algRSASHA1            = "http://www.w3.org/2000/09/xmldsig#rsa-sha1"
+	algRSASHA256          = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algRSASHA512          = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	algSHA1               = "http://www.w3.org/2000/09/xmldsig#sha1"
+	algSHA256             = "http://www.w3.org/2001/04/xmlenc#sha256"
+	algSHA512             = "http://www.w3.org/2001/04/xmlenc#sha512"
+)
+
+var signatureHashes = map[string]crypto.Hash{
+	algRSASHA1:   crypto.SHA1,
+	algRSASHA256: crypto.SHA256,
+	algRSASHA512: crypto.SHA512,
+}
+
+var digestHashes = map[string]crypto.Hash{
+	algSHA1:   crypto.SHA1,
+	algSHA256: crypto.SHA256,
+	algSHA512: crypto.SHA512,
+}
+
+// signature returns the enveloped signature of the element, nil if the
+// element isn't signed
+func signature(e *element) *element {
+	return e.childElement(dsigNamespace, "Signature")
+}
+
+// verifySignature verifies the enveloped signature of the element with one
+// of the provided certificates. Only the exclusive canonicalization and rsa
+// signatures are supported and the signature must reference the element
+// itself, so the signed content is always the verified element.
+func verifySignature(e *element, certs []*x509.Certificate) error {
+	sig := signature(e)
+	if sig == nil {
+		return errors.Errorf("missing signature")
+	}
+
+	id := e.attr("ID")
+	if id == "" {
+		return errors.Errorf("signed element without ID")
+	}
+
+	signedInfo := sig.childElement(dsigNamespace, "SignedInfo")
+	if signedInfo == nil {
+		return errors.Errorf("missing signature SignedInfo")
+	}
+	c14nMethod := signedInfo.childElement(dsigNamespace, "CanonicalizationMethod")
+	if c14nMethod == nil || c14nMethod.attr("Algorithm") != algExcC14N {
+		return errors.Errorf("unsupported signature canonicalization method")
+	}
+	signedInfoPrefixes := inclusiveNamespaces(c14nMethod)
+	sigMethod := signedInfo.childElement(dsigNamespace, "SignatureMethod")
+	if sigMethod == nil {
+		return errors.Errorf("missing signature method")
+	}
+	sigHash, ok := signatureHashes[sigMethod.attr("Algorithm")]
+	if !ok {
+		return errors.Errorf("unsupported signature method %q", sigMethod.attr("Algorithm"))
+	}
+
+	refs := signedInfo.childElements(dsigNamespace, "Reference")
+	if len(refs) != 1 {
+		return errors.Errorf("the signature must have exactly one reference")
+	}
+	ref := refs[0]
+	if ref.attr("URI") != "#"+id {
+		return errors.Errorf("the signature reference doesn't match the signed element")
+	}
+
+	var inclusivePrefixes []string
+	if transforms := ref.childElement(dsigNamespace, "Transforms"); transforms != nil {
+		for _, t := range transforms.childElements(dsigNamespace, "Transform") {
+			switch t.attr("Algorithm") {
+			case algEnvelopedSignature:
+			case algExcC14N:
+				inclusivePrefixes = inclusiveNamespaces(t)
+			default:
+				return errors.Errorf("unsupported signature transform %q", t.attr("Algorithm"))
+			}
+		}
+	}
+
+	digestMethod := ref.childElement(dsigNamespace, "DigestMethod")
+	if digestMethod == nil {
+		return errors.Errorf("missing signature digest method")
+	}
+	digestHash, ok := digestHashes[digestMethod.attr("Algorithm")]
+	if !ok {
+		return errors.Errorf("unsupported digest method %q", digestMethod.attr("Algorithm"))
+	}
+	digestValue := ref.childElement(dsigNamespace, "DigestValue")
+	if digestValue == nil {
+		return errors.Errorf("missing signature digest value")
+	}
+	expectedDigest, err := decodeBase64(digestValue.text())
+	if err != nil {
+		return errors.Errorf("failed to decode digest value: %w", err)
+	}
+
+	h := digestHash.New()
+	h.Write(canonicalize(e, sig, inclusivePrefixes))
+	if subtle.ConstantTimeCompare(h.Sum(nil), expectedDigest) != 1 {
+		return errors.Errorf("signed element digest mismatch")
+	}
+
+	sigValue := sig.childElement(dsigNamespace, "SignatureValue")
+	if sigValue == nil {
+		return errors.Errorf("missing signature value")
+	}
+	sigBytes, err := decodeBase64(sigValue.text())
+	if err != nil {
+		return errors.Errorf("failed to decode signature value: %w", err)
+	}
+
+	h = sigHash.New()
+	h.Write(canonicalize(signedInfo, nil, signedInfoPrefixes))
+	hashed := h.Sum(nil)
+	for _, cert := range certs {
+		pub, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			continue
+		}
+		if err := rsa.VerifyPKCS1v15(pub, sigHash, hashed, sigBytes); err == nil {
+			return nil
+		}
+	}
+
+	return errors.Errorf("invalid signature")
+}
+
+// inclusiveNamespaces returns the InclusiveNamespaces prefix list of an
+// exclusive canonicalization method or transform
+func inclusiveNamespaces(e *element) []string {
+	in := e.childElement(algExcC14N, "InclusiveNamespaces")
+	if in == nil {
+		return nil
+	}
+	return strings.Fields(in.attr("PrefixList"))
+}
+
+// decodeBase64 decodes a base64 xml value ignoring the whitespaces
+func decodeBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+}
@@ -0,0 +1,466 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package saml implements a minimal SAML 2.0 service provider: the identity
+// provider metadata import, the service provider metadata, the authentication
+// requests using the HTTP-Redirect binding and the validation of the signed
+// responses received using the HTTP-POST binding.
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	protocolNamespace  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	assertionNamespace = "urn:oasis:names:tc:SAML:2.0:assertion"
+	metadataNamespace  = "urn:oasis:names:tc:SAML:2.0:metadata"
+
+	bindingHTTPRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	bindingHTTPPost     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+
+	statusSuccess            = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	confirmationMethodBearer = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	nameIDFormatUnspecified  = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+)
+
+// MaxClockSkew is the max accepted clock difference with the identity
+// provider when checking the assertions validity
+const MaxClockSkew = 90 * time.Second
+
+// IDPMetadata is the identity provider metadata used by the service provider
+type IDPMetadata struct {
+	EntityID string
+	// SSOURL is the single sign on service url using the HTTP-Redirect
+	// binding
+	SSOURL string
+	// Certificates are the certificates used to verify the responses
+	// signatures
+	Certificates []*x509.Certificate
+}
+
+type entityDescriptor struct {
+	EntityID         string            `xml:"entityID,attr"`
+	IDPSSODescriptor *idpSSODescriptor `xml:"IDPSSODescriptor"`
+}
+
+type idpSSODescriptor struct {
+	KeyDescriptors []struct {
+		Use          string   `xml:"use,attr"`
+		Certificates []string `xml:"KeyInfo>X509Data>X509Certificate"`
+	} `xml:"KeyDescriptor"`
+	SingleSignOnServices []struct {
+		Binding  string `xml:"Binding,attr"`
+		Location string `xml:"Location,attr"`
+	} `xml:"SingleSignOnService"`
+}
+
+// ParseIDPMetadata parses the identity provider metadata. When the metadata
+// is an EntitiesDescriptor the first identity provider entity is used.
+func ParseIDPMetadata(data []byte) (*IDPMetadata, error) {
+	var root struct {
+		XMLName           xml.Name
+		EntityDescriptors []*entityDescriptor `xml:"EntityDescriptor"`
+	}
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, errors.Errorf("failed to parse idp metadata: %w", err)
+	}
+
+	var ed *entityDescriptor
+	switch {
+	case root.XMLName.Space == metadataNamespace && root.XMLName.Local == "EntityDescriptor":
+		ed = &entityDescriptor{}
+		if err := xml.Unmarshal(data, ed); err != nil {
+			return nil, errors.Errorf("failed to parse idp metadata: %w", err)
+		}
+	case root.XMLName.Space == metadataNamespace && root.XMLName.Local == "EntitiesDescriptor":
+		for _, e := range root.EntityDescriptors {
+			if e.IDPSSODescriptor != nil {
+				ed = e
+				break
+			}
+		}
+	default:
+		return nil, errors.Errorf("idp metadata root isn't an entity descriptor")
+	}
+	if ed == nil || ed.IDPSSODescriptor == nil {
+		return nil, errors.Errorf("idp metadata doesn't contain an idp sso descriptor")
+	}
+	if ed.EntityID == "" {
+		return nil, errors.Errorf("idp metadata without entity id")
+	}
+
+	m := &IDPMetadata{EntityID: ed.EntityID}
+	for _, s := range ed.IDPSSODescriptor.SingleSignOnServices {
+		if s.Binding == bindingHTTPRedirect {
+			m.SSOURL = s.Location
+			break
+		}
+	}
+	if m.SSOURL == "" {
+		return nil, errors.Errorf("idp metadata doesn't contain a single sign on service with the HTTP-Redirect binding")
+	}
+
+	for _, kd := range ed.IDPSSODescriptor.KeyDescriptors {
+		if kd.Use != "" && kd.Use != "signing" {
+			continue
+		}
+		for _, c := range kd.Certificates {
+			der, err := decodeBase64(c)
+			if err != nil {
+				return nil, errors.Errorf("failed to decode idp certificate: %w", err)
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, errors.Errorf("failed to parse idp certificate: %w", err)
+			}
+			m.Certificates = append(m.Certificates, cert)
+		}
+	}
+	if len(m.Certificates) == 0 {
+		return nil, errors.Errorf("idp metadata doesn't contain signing certificates")
+	}
+
+	return m, nil
+}
+
+// ServiceProvider is a SAML service provider
+type ServiceProvider struct {
+	EntityID string
+	// ACSURL is the assertion consumer service url where the identity
+	// provider posts the responses
+	ACSURL string
+
+	IDP *IDPMetadata
+}
+
+// Metadata returns the service provider metadata to be imported in the
+// identity provider
+func (sp *ServiceProvider) Metadata() []byte {
+	return []byte(fmt.Sprintf(`<md:EntityDescriptor xmlns:md="%s" entityID="%s">`+
+		`<md:SPSSODescriptor AuthnRequestsSigned="false" WantAssertionsSigned="true" protocolSupportEnumeration="%s">`+
+		`<md:NameIDFormat>%s</md:NameIDFormat>`+
+		`<md:AssertionConsumerService Binding="%s" Location="%s" index="0"></md:AssertionConsumerService>`+
+		`</md:SPSSODescriptor>`+
+		`</md:EntityDescriptor>`,
+		metadataNamespace, escapeAttr(sp.EntityID), protocolNamespace, nameIDFormatUnspecified, bindingHTTPPost, escapeAttr(sp.ACSURL)))
+}
+
+// NewRequestID returns a new authentication request id
+func NewRequestID() string {
+	return "_" + uuid.NewV4().String()
+}
+
+// AuthnRequestURL returns the identity provider url, using the HTTP-Redirect
+// binding, to send the authentication request with the provided id. The
+// response must then refer to the same request id.
+func (sp *ServiceProvider) AuthnRequestURL(id, relayState string, now time.Time) (string, error) {
+	req := fmt.Sprintf(`<samlp:AuthnRequest xmlns:samlp="%s" xmlns:saml="%s" ID="%s" Version="2.0" IssueInstant="%s" Destination="%s" AssertionConsumerServiceURL="%s" ProtocolBinding="%s">`+
+		`<saml:Issuer>%s</saml:Issuer>`+
+		`<samlp:NameIDPolicy AllowCreate="true"></samlp:NameIDPolicy>`+
+		`</samlp:AuthnRequest>`,
+		protocolNamespace, assertionNamespace, id, now.UTC().Format(time.RFC3339), escapeAttr(sp.IDP.SSOURL), escapeAttr(sp.ACSURL), bindingHTTPPost, escapeText(sp.EntityID))
+
+	var buf bytes.Buffer
+	fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := fw.Write([]byte(req)); err != nil {
+		return "", err
+	}
+	if err := fw.Close(); err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(sp.IDP.SSOURL)
+	if err != nil {
+		return "", errors.Errorf("failed to parse idp sso url: %w", err)
+	}
+	q := u.Query()
+	q.Set("SAMLRequest", base64.StdEncoding.EncodeToString(buf.Bytes()))
+	if relayState != "" {
+		q.Set("RelayState", relayState)
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// Assertion is the validated identity provider assertion
+type Assertion struct {
+	ID string
+	// NotOnOrAfter is the time, including the max clock skew, until the
+	// assertion could be accepted
+	NotOnOrAfter time.Time
+
+	NameID string
+	// Attributes maps the attributes names (and friendly names) to their
+	// values
+	Attributes map[string][]string
+}
+
+// Attribute returns the first value of the attribute with the provided name
+// or friendly name
+func (a *Assertion) Attribute(name string) string {
+	if values := a.Attributes[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+type assertion struct {
+	ID      string `xml:"ID,attr"`
+	Issuer  string `xml:"Issuer"`
+	Subject struct {
+		NameID               string `xml:"NameID"`
+		SubjectConfirmations []struct {
+			Method string `xml:"Method,attr"`
+			Data   struct {
+				NotOnOrAfter string `xml:"NotOnOrAfter,attr"`
+				Recipient    string `xml:"Recipient,attr"`
+				InResponseTo string `xml:"InResponseTo,attr"`
+			} `xml:"SubjectConfirmationData"`
+		} `xml:"SubjectConfirmation"`
+	} `xml:"Subject"`
+	Conditions *struct {
+		NotBefore            string `xml:"NotBefore,attr"`
+		NotOnOrAfter         string `xml:"NotOnOrAfter,attr"`
+		AudienceRestrictions []struct {
+			Audiences []string `xml:"Audience"`
+		} `xml:"AudienceRestriction"`
+	} `xml:"Conditions"`
+	AttributeStatements []struct {
+		Attributes []struct {
+			Name         string   `xml:"Name,attr"`
+			FriendlyName string   `xml:"FriendlyName,attr"`
+			Values       []string `xml:"AttributeValue"`
+		} `xml:"Attribute"`
+	} `xml:"AttributeStatement"`
+}
+
+// ParseResponse parses and validates a base64 encoded response received by
+// the assertion consumer service. The response or its assertion must be
+// signed by the identity provider and refer to the authentication request
+// with the provided id. Encrypted assertions aren't supported.
+func (sp *ServiceProvider) ParseResponse(samlResponse, requestID string, now time.Time) (*Assertion, error) {
+	data, err := decodeBase64(samlResponse)
+	if err != nil {
+		return nil, errors.Errorf("failed to decode response: %w", err)
+	}
+	root, err := parseXML(data)
+	if err != nil {
+		return nil, err
+	}
+	if !root.is(protocolNamespace, "Response") {
+		return nil, errors.Errorf("not a saml response")
+	}
+	if dest := root.attr("Destination"); dest != "" && dest != sp.ACSURL {
+		return nil, errors.Errorf("wrong response destination %q", dest)
+	}
+	if irt := root.attr("InResponseTo"); irt != "" && irt != requestID {
+		return nil, errors.Errorf("response doesn't refer to the authentication request")
+	}
+
+	var statusCode string
+	if status := root.childElement(protocolNamespace, "Status"); status != nil {
+		if sc := status.childElement(protocolNamespace, "StatusCode"); sc != nil {
+			statusCode = sc.attr("Value")
+		}
+	}
+	if statusCode != statusSuccess {
+		return nil, errors.Errorf("authentication failed with status %q", statusCode)
+	}
+
+	if len(root.childElements(assertionNamespace, "EncryptedAssertion")) > 0 {
+		return nil, errors.Errorf("encrypted assertions aren't supported")
+	}
+	assertions := root.childElements(assertionNamespace, "Assertion")
+	if len(assertions) != 1 {
+		return nil, errors.Errorf("the response must contain exactly one assertion")
+	}
+	ae := assertions[0]
+
+	if signature(root) == nil && signature(ae) == nil {
+		return nil, errors.Errorf("neither the response nor the assertion are signed")
+	}
+	if signature(root) != nil {
+		if err := verifySignature(root, sp.IDP.Certificates); err != nil {
+			return nil, errors.Errorf("response signature verification failed: %w", err)
+		}
+	}
+	if signature(ae) != nil {
+		if err := verifySignature(ae, sp.IDP.Certificates); err != nil {
+			return nil, errors.Errorf("assertion signature verification failed: %w", err)
+		}
+	}
+
+	// only use the verified assertion content, the assertion signature isn't
+	// covered by its digest
+	var a assertion
+	if err := xml.Unmarshal(canonicalize(ae, signature(ae), nil), &a); err != nil {
+		return nil, errors.Errorf("failed to parse assertion: %w", err)
+	}
+
+	notOnOrAfter, err := sp.validateAssertion(&a, requestID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Assertion{
+		ID:           a.ID,
+		NotOnOrAfter: notOnOrAfter.Add(MaxClockSkew),
+		NameID:       a.Subject.NameID,
+		Attributes:   map[string][]string{},
+	}
+	for _, as := range a.AttributeStatements {
+		for _, attr := range as.Attributes {
+			res.Attributes[attr.Name] = append(res.Attributes[attr.Name], attr.Values...)
+			if attr.FriendlyName != "" && attr.FriendlyName != attr.Name {
+				res.Attributes[attr.FriendlyName] = append(res.Attributes[attr.FriendlyName], attr.Values...)
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// validateAssertion validates the assertion and returns the time until it
+// could be accepted (ignoring the clock skew)
+func (sp *ServiceProvider) validateAssertion(a *assertion, requestID string, now time.Time) (time.Time, error) {
+	if a.ID == "" {
+		return time.Time{}, errors.Errorf("assertion without id")
+	}
+	if a.Issuer != sp.IDP.EntityID {
+		return time.Time{}, errors.Errorf("wrong assertion issuer %q", a.Issuer)
+	}
+
+	var notOnOrAfter time.Time
+	if c := a.Conditions; c != nil {
+		if c.NotBefore != "" {
+			t, err := parseTime(c.NotBefore)
+			if err != nil {
+				return time.Time{}, err
+			}
+			if now.Add(MaxClockSkew).Before(t) {
+				return time.Time{}, errors.Errorf("assertion not yet valid")
+			}
+		}
+		if c.NotOnOrAfter != "" {
+			t, err := parseTime(c.NotOnOrAfter)
+			if err != nil {
+				return time.Time{}, err
+			}
+			if !now.Add(-MaxClockSkew).Before(t) {
+				return time.Time{}, errors.Errorf("assertion expired")
+			}
+			notOnOrAfter = t
+		}
+		for _, ar := range c.AudienceRestrictions {
+			found := false
+			for _, audience := range ar.Audiences {
+				if audience == sp.EntityID {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return time.Time{}, errors.Errorf("assertion audience doesn't match the service provider")
+			}
+		}
+	}
+
+	// at least one bearer subject confirmation must be valid
+	var confirmationNotOnOrAfter time.Time
+	for _, sc := range a.Subject.SubjectConfirmations {
+		if sc.Method != confirmationMethodBearer {
+			continue
+		}
+		if sc.Data.Recipient != sp.ACSURL {
+			continue
+		}
+		if sc.Data.InResponseTo != requestID {
+			continue
+		}
+		t, err := parseTime(sc.Data.NotOnOrAfter)
+		if err != nil {
+			continue
+		}
+		if !now.Add(-MaxClockSkew).Before(t) {
+			continue
+		}
+		if t.After(confirmationNotOnOrAfter) {
+			confirmationNotOnOrAfter = t
+		}
+	}
+	if confirmationNotOnOrAfter.IsZero() {
+		return time.Time{}, errors.Errorf("assertion without a valid bearer subject confirmation")
+	}
+
+	// the assertion is accepted while both the conditions and a subject
+	// confirmation are valid
+	if notOnOrAfter.IsZero() || confirmationNotOnOrAfter.Before(notOnOrAfter) {
+		notOnOrAfter = confirmationNotOnOrAfter
+	}
+	return notOnOrAfter, nil
+}
+
+// ReplayCache records the ids of the accepted assertions until they expire to
+// reject their replay
+type ReplayCache struct {
+	mu  sync.Mutex
+	ids map[string]time.Time
+}
+
+func NewReplayCache() *ReplayCache {
+	return &ReplayCache{ids: make(map[string]time.Time)}
+}
+
+// Use records the assertion id. It returns an error if the assertion has
+// already been used.
+func (c *ReplayCache) Use(a *Assertion, now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id, notOnOrAfter := range c.ids {
+		if !now.Before(notOnOrAfter) {
+			delete(c.ids, id)
+		}
+	}
+
+	if _, ok := c.ids[a.ID]; ok {
+		return errors.Errorf("assertion %q already used", a.ID)
+	}
+	c.ids[a.ID] = a.NotOnOrAfter
+	return nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, errors.Errorf("failed to parse time %q: %w", s, err)
+	}
+	return t, nil
+}
@@ -0,0 +1,597 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saml
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testIDPEntityID = "https://idp.example.com/metadata"
+	testSPEntityID  = "https://agola.example.com/api/saml/metadata"
+	testACSURL      = "https://agola.example.com/api/saml/acs"
+	testRequestID   = "_request01"
+)
+
+func TestCanonicalize(t *testing.T) {
+	doc := `<a:root xmlns:a="urn:a" xmlns:b="urn:b" xmlns="urn:d"><a:child b:attr="1" z="2" c="3"/><x>t&amp;&lt;"</x></a:root>`
+	root, err := parseXML([]byte(doc))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		e    *element
+		out  string
+	}{
+		{
+			name: "root",
+			e:    root,
+			out:  `<a:root xmlns:a="urn:a"><a:child xmlns:b="urn:b" c="3" z="2" b:attr="1"></a:child><x xmlns="urn:d">t&amp;&lt;"</x></a:root>`,
+		},
+		{
+			name: "subtree",
+			e:    root.children[0].(*element),
+			out:  `<a:child xmlns:a="urn:a" xmlns:b="urn:b" c="3" z="2" b:attr="1"></a:child>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := string(canonicalize(tt.e, nil, nil))
+			if out != tt.out {
+				t.Errorf("got:\n%s\nwant:\n%s", out, tt.out)
+			}
+		})
+	}
+}
+
+type testIDP struct {
+	key  *rsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newTestIDP(t *testing.T) *testIDP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return &testIDP{key: key, cert: cert}
+}
+
+func (idp *testIDP) metadata() string {
+	return fmt.Sprintf(`<?xml version="1.0"?>
+<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="%s">
+  <md:IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <md:KeyDescriptor use="signing">
+      <ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">
+        <ds:X509Data><ds:X509Certificate>%s</ds:X509Certificate></ds:X509Data>
+      </ds:KeyInfo>
+    </md:KeyDescriptor>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST" Location="https://idp.example.com/sso/post"/>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="https://idp.example.com/sso?app=agola"/>
+  </md:IDPSSODescriptor>
+</md:EntityDescriptor>`, testIDPEntityID, base64.StdEncoding.EncodeToString(idp.cert.Raw))
+}
+
+func findElementByID(e *element, id string) *element {
+	if e.attr("ID") == id {
+		return e
+	}
+	for _, c := range e.children {
+		if c, ok := c.(*element); ok {
+			if f := findElementByID(c, id); f != nil {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// sign replaces the {{signature}} placeholder in doc with the enveloped
+// signature of the element with the provided id
+func (idp *testIDP) sign(t *testing.T, doc, id string) string {
+	root, err := parseXML([]byte(strings.Replace(doc, "{{signature}}", "", 1)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	digest := sha256.Sum256(canonicalize(findElementByID(root, id), nil, nil))
+
+	sig := fmt.Sprintf(`<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#">`+
+		`<ds:SignedInfo>`+
+		`<ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/>`+
+		`<ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"/>`+
+		`<ds:Reference URI="#%s">`+
+		`<ds:Transforms>`+
+		`<ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"/>`+
+		`<ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/>`+
+		`</ds:Transforms>`+
+		`<ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"/>`+
+		`<ds:DigestValue>%s</ds:DigestValue>`+
+		`</ds:Reference>`+
+		`</ds:SignedInfo>`+
+		`<ds:SignatureValue>{{signaturevalue}}</ds:SignatureValue>`+
+		`</ds:Signature>`, id, base64.StdEncoding.EncodeToString(digest[:]))
+	doc = strings.Replace(doc, "{{signature}}", sig, 1)
+
+	root, err = parseXML([]byte(doc))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	signedInfo := signature(findElementByID(root, id)).childElement(dsigNamespace, "SignedInfo")
+	hashed := sha256.Sum256(canonicalize(signedInfo, nil, nil))
+	sigValue, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return strings.Replace(doc, "{{signaturevalue}}", base64.StdEncoding.EncodeToString(sigValue), 1)
+}
+
+type testResponse struct {
+	audience     string
+	recipient    string
+	inResponseTo string
+	notOnOrAfter time.Time
+	status       string
+	// nameID defaults to user01@example.com
+	nameID string
+	// confirmationNotOnOrAfter defaults to notOnOrAfter
+	confirmationNotOnOrAfter time.Time
+}
+
+func (r testResponse) doc() string {
+	nameID := r.nameID
+	if nameID == "" {
+		nameID = "user01@example.com"
+	}
+	confirmationNotOnOrAfter := r.confirmationNotOnOrAfter
+	if confirmationNotOnOrAfter.IsZero() {
+		confirmationNotOnOrAfter = r.notOnOrAfter
+	}
+	return fmt.Sprintf(`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" ID="_response01" Version="2.0" Destination="%[1]s" InResponseTo="%[2]s">
+  <saml:Issuer xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion">%[3]s</saml:Issuer>
+  <samlp:Status><samlp:StatusCode Value="%[4]s"/></samlp:Status>
+  <saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" xmlns:xs="http://www.w3.org/2001/XMLSchema" ID="_assertion01" Version="2.0">
+    <saml:Issuer>%[3]s</saml:Issuer>{{signature}}
+    <saml:Subject>
+      <saml:NameID Format="urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress">%[8]s</saml:NameID>
+      <saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">
+        <saml:SubjectConfirmationData NotOnOrAfter="%[9]s" Recipient="%[6]s" InResponseTo="%[2]s"/>
+      </saml:SubjectConfirmation>
+    </saml:Subject>
+    <saml:Conditions NotOnOrAfter="%[5]s">
+      <saml:AudienceRestriction><saml:Audience>%[7]s</saml:Audience></saml:AudienceRestriction>
+    </saml:Conditions>
+    <saml:AttributeStatement>
+      <saml:Attribute Name="urn:oid:0.9.2342.19200300.100.1.1" FriendlyName="uid">
+        <saml:AttributeValue xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="xs:string">user01</saml:AttributeValue>
+      </saml:Attribute>
+    </saml:AttributeStatement>
+  </saml:Assertion>
+</samlp:Response>`, testACSURL, r.inResponseTo, testIDPEntityID, r.status, r.notOnOrAfter.UTC().Format(time.RFC3339), r.recipient, r.audience, nameID, confirmationNotOnOrAfter.UTC().Format(time.RFC3339))
+}
+
+func TestParseResponse(t *testing.T) {
+	idp := newTestIDP(t)
+	otherIDP := newTestIDP(t)
+
+	m, err := ParseIDPMetadata([]byte(idp.metadata()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sp := &ServiceProvider{EntityID: testSPEntityID, ACSURL: testACSURL, IDP: m}
+
+	now := time.Now()
+	valid := testResponse{
+		audience:     testSPEntityID,
+		recipient:    testACSURL,
+		inResponseTo: testRequestID,
+		notOnOrAfter: now.Add(5 * time.Minute),
+		status:       statusSuccess,
+	}
+
+	tests := []struct {
+		name string
+		doc  func() string
+		err  string
+	}{
+		{
+			name: "valid response",
+			doc:  func() string { return idp.sign(t, valid.doc(), "_assertion01") },
+		},
+		{
+			name: "unsigned response",
+			doc:  func() string { return strings.Replace(valid.doc(), "{{signature}}", "", 1) },
+			err:  "neither the response nor the assertion are signed",
+		},
+		{
+			name: "response signed by another key",
+			doc:  func() string { return otherIDP.sign(t, valid.doc(), "_assertion01") },
+			err:  "assertion signature verification failed: invalid signature",
+		},
+		{
+			name: "tampered assertion",
+			doc: func() string {
+				return strings.Replace(idp.sign(t, valid.doc(), "_assertion01"), ">user01<", ">admin<", 1)
+			},
+			err: "assertion signature verification failed: signed element digest mismatch",
+		},
+		{
+			name: "wrong audience",
+			doc: func() string {
+				r := valid
+				r.audience = "https://other.example.com"
+				return idp.sign(t, r.doc(), "_assertion01")
+			},
+			err: "assertion audience doesn't match the service provider",
+		},
+		{
+			name: "expired assertion",
+			doc: func() string {
+				r := valid
+				r.notOnOrAfter = now.Add(-5 * time.Minute)
+				return idp.sign(t, r.doc(), "_assertion01")
+			},
+			err: "assertion expired",
+		},
+		{
+			name: "wrong request id",
+			doc: func() string {
+				r := valid
+				r.inResponseTo = "_request02"
+				return idp.sign(t, r.doc(), "_assertion01")
+			},
+			err: "response doesn't refer to the authentication request",
+		},
+		{
+			name: "failed status",
+			doc: func() string {
+				r := valid
+				r.status = "urn:oasis:names:tc:SAML:2.0:status:Requester"
+				return idp.sign(t, r.doc(), "_assertion01")
+			},
+			err: `authentication failed with status "urn:oasis:names:tc:SAML:2.0:status:Requester"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samlResponse := base64.StdEncoding.EncodeToString([]byte(tt.doc()))
+			a, err := sp.ParseResponse(samlResponse, testRequestID, now)
+			if tt.err != "" {
+				if err == nil {
+					t.Fatalf("expected error %q, got nil", tt.err)
+				}
+				if err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %q", tt.err, err.Error())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if a.NameID != "user01@example.com" {
+				t.Errorf("got name id %q, want %q", a.NameID, "user01@example.com")
+			}
+			if a.Attribute("uid") != "user01" {
+				t.Errorf("got uid attribute %q, want %q", a.Attribute("uid"), "user01")
+			}
+			if a.ID != "_assertion01" {
+				t.Errorf("got id %q, want %q", a.ID, "_assertion01")
+			}
+			// the test response times are truncated to seconds
+			notOnOrAfter := valid.notOnOrAfter.Truncate(time.Second).Add(MaxClockSkew)
+			if !a.NotOnOrAfter.Equal(notOnOrAfter) {
+				t.Errorf("got not on or after %s, want %s", a.NotOnOrAfter, notOnOrAfter)
+			}
+		})
+	}
+}
+
+// testAssertion returns the assertion element of the response document
+func testAssertion(t *testing.T, doc string) string {
+	start := strings.Index(doc, "<saml:Assertion ")
+	end := strings.Index(doc, "</saml:Assertion>")
+	if start < 0 || end < 0 {
+		t.Fatalf("missing assertion in response")
+	}
+	return doc[start : end+len("</saml:Assertion>")]
+}
+
+// testSignedResponse returns the response document signed at the response
+// level, with an unsigned assertion
+func (idp *testIDP) testSignedResponse(t *testing.T, r testResponse) string {
+	doc := strings.Replace(r.doc(), "{{signature}}", "", 1)
+	doc = strings.Replace(doc, "</saml:Issuer>", "</saml:Issuer>{{signature}}", 1)
+	return idp.sign(t, doc, "_response01")
+}
+
+func TestParseResponseAttacks(t *testing.T) {
+	idp := newTestIDP(t)
+	otherIDP := newTestIDP(t)
+
+	m, err := ParseIDPMetadata([]byte(idp.metadata()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sp := &ServiceProvider{EntityID: testSPEntityID, ACSURL: testACSURL, IDP: m}
+
+	now := time.Now()
+	valid := testResponse{
+		audience:     testSPEntityID,
+		recipient:    testACSURL,
+		inResponseTo: testRequestID,
+		notOnOrAfter: now.Add(5 * time.Minute),
+		status:       statusSuccess,
+	}
+
+	// forge returns the assertion with the admin name id
+	forge := func(assertion string) string {
+		return strings.Replace(assertion, ">user01@example.com<", ">admin@example.com<", 1)
+	}
+
+	tests := []struct {
+		name   string
+		doc    func() string
+		err    string
+		nameID string
+	}{
+		{
+			name: "signed assertion wrapped in the response extensions and forged assertion",
+			doc: func() string {
+				doc := idp.sign(t, valid.doc(), "_assertion01")
+				a := testAssertion(t, doc)
+				forged := forge(strings.Replace(a, a[strings.Index(a, "<ds:Signature"):strings.Index(a, "</ds:Signature>")+len("</ds:Signature>")], "", 1))
+				return strings.Replace(doc, a, "<samlp:Extensions>"+a+"</samlp:Extensions>"+forged, 1)
+			},
+			err: "neither the response nor the assertion are signed",
+		},
+		{
+			name: "forged assertion with the signature of the original assertion",
+			doc: func() string {
+				doc := idp.sign(t, valid.doc(), "_assertion01")
+				return strings.Replace(doc, ">user01@example.com<", ">admin@example.com<", 1)
+			},
+			err: "assertion signature verification failed: signed element digest mismatch",
+		},
+		{
+			name: "forged assertion with another id and the signature of the original assertion",
+			doc: func() string {
+				doc := idp.sign(t, valid.doc(), "_assertion01")
+				return forge(strings.Replace(doc, `ID="_assertion01"`, `ID="_assertion02"`, 1))
+			},
+			err: "assertion signature verification failed: the signature reference doesn't match the signed element",
+		},
+		{
+			name: "forged assertion wrapping the original assertion",
+			doc: func() string {
+				doc := idp.sign(t, valid.doc(), "_assertion01")
+				a := testAssertion(t, doc)
+				forged := forge(a)
+				forged = strings.Replace(forged, "</saml:Assertion>", a+"</saml:Assertion>", 1)
+				return strings.Replace(doc, a, forged, 1)
+			},
+			err: "assertion signature verification failed: signed element digest mismatch",
+		},
+		{
+			name: "original assertion inside the signature of a forged assertion",
+			doc: func() string {
+				doc := idp.sign(t, valid.doc(), "_assertion01")
+				a := testAssertion(t, doc)
+				forged := strings.Replace(forge(a), "</ds:Signature>", "<ds:Object>"+a+"</ds:Object></ds:Signature>", 1)
+				return strings.Replace(doc, a, forged, 1)
+			},
+			err: "assertion signature verification failed: signed element digest mismatch",
+		},
+		{
+			name: "forged subject inside the assertion signature",
+			doc: func() string {
+				doc := idp.sign(t, valid.doc(), "_assertion01")
+				return strings.Replace(doc, "</ds:Signature>", `<ds:Object><saml:Subject><saml:NameID>admin@example.com</saml:NameID></saml:Subject></ds:Object></ds:Signature>`, 1)
+			},
+			nameID: "user01@example.com",
+		},
+		{
+			name: "forged assertion in a signed response",
+			doc: func() string {
+				return forge(idp.testSignedResponse(t, valid))
+			},
+			err: "response signature verification failed: signed element digest mismatch",
+		},
+		{
+			name: "signed response with an unsigned assertion",
+			doc: func() string {
+				return idp.testSignedResponse(t, valid)
+			},
+			nameID: "user01@example.com",
+		},
+		{
+			name: "signed response with an assertion signed by another key",
+			doc: func() string {
+				doc := otherIDP.sign(t, valid.doc(), "_assertion01")
+				doc = strings.Replace(doc, "</saml:Issuer>", "</saml:Issuer>{{signature}}", 1)
+				return idp.sign(t, doc, "_response01")
+			},
+			err: "assertion signature verification failed: invalid signature",
+		},
+		{
+			name: "multiple assertions",
+			doc: func() string {
+				doc := idp.sign(t, valid.doc(), "_assertion01")
+				a := testAssertion(t, doc)
+				return strings.Replace(doc, a, a+forge(strings.Replace(a, `ID="_assertion01"`, `ID="_assertion02"`, 1)), 1)
+			},
+			err: "the response must contain exactly one assertion",
+		},
+		{
+			name: "multiple signed assertions",
+			doc: func() string {
+				doc := idp.sign(t, valid.doc(), "_assertion01")
+				a := testAssertion(t, doc)
+				return strings.Replace(doc, a, a+a, 1)
+			},
+			err: "the response must contain exactly one assertion",
+		},
+		{
+			name: "comment inside the name id",
+			doc: func() string {
+				r := valid
+				r.nameID = "user01@example.com.evil.com"
+				doc := idp.sign(t, r.doc(), "_assertion01")
+				return strings.Replace(doc, ">user01@example.com.evil.com<", ">user01@example.com<!---->.evil.com<", 1)
+			},
+			nameID: "user01@example.com.evil.com",
+		},
+		{
+			name: "expired subject confirmation",
+			doc: func() string {
+				r := valid
+				r.confirmationNotOnOrAfter = now.Add(-5 * time.Minute)
+				return idp.sign(t, r.doc(), "_assertion01")
+			},
+			err: "assertion without a valid bearer subject confirmation",
+		},
+		{
+			name: "expired conditions",
+			doc: func() string {
+				r := valid
+				r.notOnOrAfter = now.Add(-5 * time.Minute)
+				r.confirmationNotOnOrAfter = now.Add(5 * time.Minute)
+				return idp.sign(t, r.doc(), "_assertion01")
+			},
+			err: "assertion expired",
+		},
+		{
+			name: "expired within the clock skew",
+			doc: func() string {
+				r := valid
+				r.notOnOrAfter = now.Add(-MaxClockSkew / 2)
+				return idp.sign(t, r.doc(), "_assertion01")
+			},
+			nameID: "user01@example.com",
+		},
+		{
+			name: "expired over the clock skew",
+			doc: func() string {
+				r := valid
+				r.notOnOrAfter = now.Add(-MaxClockSkew - time.Second)
+				return idp.sign(t, r.doc(), "_assertion01")
+			},
+			err: "assertion expired",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samlResponse := base64.StdEncoding.EncodeToString([]byte(tt.doc()))
+			a, err := sp.ParseResponse(samlResponse, testRequestID, now)
+			if tt.err != "" {
+				if err == nil {
+					t.Fatalf("expected error %q, got nil", tt.err)
+				}
+				if err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %q", tt.err, err.Error())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if a.NameID != tt.nameID {
+				t.Errorf("got name id %q, want %q", a.NameID, tt.nameID)
+			}
+		})
+	}
+}
+
+func TestReplayCache(t *testing.T) {
+	now := time.Now()
+	c := NewReplayCache()
+
+	a := &Assertion{ID: "_assertion01", NotOnOrAfter: now.Add(5 * time.Minute)}
+	if err := c.Use(a, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.Use(a, now.Add(time.Minute)); err == nil {
+		t.Fatalf("expected error reusing the assertion")
+	}
+	if err := c.Use(&Assertion{ID: "_assertion02", NotOnOrAfter: now.Add(5 * time.Minute)}, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// expired assertions are removed from the cache
+	if err := c.Use(&Assertion{ID: "_assertion03", NotOnOrAfter: now.Add(15 * time.Minute)}, now.Add(10*time.Minute)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(c.ids) != 1 {
+		t.Fatalf("got %d cached ids, want 1", len(c.ids))
+	}
+}
+
+func TestAuthnRequestURL(t *testing.T) {
+	idp := newTestIDP(t)
+	m, err := ParseIDPMetadata([]byte(idp.metadata()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sp := &ServiceProvider{EntityID: testSPEntityID, ACSURL: testACSURL, IDP: m}
+
+	u, err := sp.AuthnRequestURL(NewRequestID(), "state01", time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pu, err := url.Parse(u)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	q := pu.Query()
+	if pu.Host != "idp.example.com" || q.Get("app") != "agola" {
+		t.Errorf("wrong idp sso url %q", u)
+	}
+	if q.Get("RelayState") != "state01" {
+		t.Errorf("got relay state %q, want %q", q.Get("RelayState"), "state01")
+	}
+	if q.Get("SAMLRequest") == "" {
+		t.Errorf("missing SAMLRequest")
+	}
+}
@@ -61,9 +61,23 @@ func GenerateOauth2JWTToken(sd *TokenSigningData, remoteSourceName, requestType
 	})
 }
 
-func GenerateLoginJWTToken(sd *TokenSigningData, userID string) (string, error) {
+// GenerateSAMLJWTToken generates the token, used as saml relay state, saving
+// the saml authentication request id and the hash of the nonce saved in the
+// user browser
+func GenerateSAMLJWTToken(sd *TokenSigningData, requestID, nonceHash string) (string, error) {
+	return GenerateGenericJWTToken(sd, jwt.MapClaims{
+		"exp":             time.Now().Add(sd.Duration).Unix(),
+		"saml_request_id": requestID,
+		"saml_nonce_hash": nonceHash,
+	})
+}
+
+// GenerateLoginJWTToken generates the user login token. The token is valid
+// only while the user session it references exists
+func GenerateLoginJWTToken(sd *TokenSigningData, userID, sessionID string) (string, error) {
 	return GenerateGenericJWTToken(sd, jwt.MapClaims{
 		"sub": userID,
+		"sid": sessionID,
 		"exp": time.Now().Add(sd.Duration).Unix(),
 	})
 }
@@ -0,0 +1,329 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogTimestampLayout is the layout of the UTC timestamp prefixed, followed by
+// a space, to every stored log line
+const LogTimestampLayout = "2006-01-02T15:04:05.000Z"
+
+const logTimestampPrefixLen = len(LogTimestampLayout) + 1
+
+type LogFormat string
+
+const (
+	// LogFormatPlain is the log as produced by the task, without timestamps
+	LogFormatPlain LogFormat = "plain"
+	// LogFormatTimestamped is the log with every line prefixed by its
+	// timestamp
+	LogFormatTimestamped LogFormat = "timestamped"
+	// LogFormatHTML is the log rendered as html, one div per line with the
+	// timestamp in a separate span and the ANSI sequences converted to spans
+	// with css classes
+	LogFormatHTML LogFormat = "html"
+)
+
+func (f LogFormat) Valid() bool {
+	switch f {
+	case LogFormatPlain, LogFormatTimestamped, LogFormatHTML:
+		return true
+	}
+	return false
+}
+
+// LogTimestampWriter prefixes every written line with the time when its first
+// byte has been written
+type LogTimestampWriter struct {
+	w         io.Writer
+	lineStart bool
+	now       func() time.Time
+}
+
+func NewLogTimestampWriter(w io.Writer) *LogTimestampWriter {
+	return &LogTimestampWriter{w: w, lineStart: true, now: time.Now}
+}
+
+func (t *LogTimestampWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if t.lineStart {
+			if _, err := io.WriteString(t.w, t.now().UTC().Format(LogTimestampLayout)+" "); err != nil {
+				return written, err
+			}
+			t.lineStart = false
+		}
+
+		chunk := p
+		if i := bytes.IndexByte(p, '\n'); i >= 0 {
+			chunk = p[:i+1]
+			t.lineStart = true
+		}
+		n, err := t.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+// splitLogTimestamp splits the line timestamp from its content. Lines without
+// a timestamp (i.e. logs saved before timestamps were added) are returned
+// unchanged.
+func splitLogTimestamp(line []byte) (string, []byte) {
+	if len(line) < logTimestampPrefixLen || line[logTimestampPrefixLen-1] != ' ' {
+		return "", line
+	}
+	ts := string(line[:logTimestampPrefixLen-1])
+	if _, err := time.Parse(LogTimestampLayout, ts); err != nil {
+		return "", line
+	}
+	return ts, line[logTimestampPrefixLen:]
+}
+
+// LogFormatWriter converts the timestamped logs written to it to the requested
+// format. Lines are converted when complete, Close must be called to convert
+// the last line when it doesn't end with a newline.
+type LogFormatWriter struct {
+	w      io.Writer
+	format LogFormat
+	buf    []byte
+	style  ansiStyle
+}
+
+func NewLogFormatWriter(w io.Writer, format LogFormat) *LogFormatWriter {
+	return &LogFormatWriter{w: w, format: format}
+}
+
+func (l *LogFormatWriter) Write(p []byte) (int, error) {
+	if l.format == LogFormatTimestamped {
+		return l.w.Write(p)
+	}
+
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := l.writeLine(l.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		l.buf = l.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush flushes the underlying writer if it's an http.Flusher
+func (l *LogFormatWriter) Flush() {
+	if f, ok := l.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close converts the remaining partial line
+func (l *LogFormatWriter) Close() error {
+	if len(l.buf) == 0 {
+		return nil
+	}
+	err := l.writeLine(l.buf)
+	l.buf = nil
+	return err
+}
+
+func (l *LogFormatWriter) writeLine(line []byte) error {
+	ts, content := splitLogTimestamp(line)
+
+	if l.format != LogFormatHTML {
+		_, err := l.w.Write(content)
+		return err
+	}
+
+	var b strings.Builder
+	b.WriteString(`<div class="log-line">`)
+	if ts != "" {
+		fmt.Fprintf(&b, `<span class="log-timestamp">%s</span>`, ts)
+	}
+	b.WriteString(ansiToHTML(bytes.TrimRight(content, "\r\n"), &l.style))
+	b.WriteString("</div>\n")
+
+	_, err := io.WriteString(l.w, b.String())
+	return err
+}
+
+var ansiColors = []string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+
+// ansiStyle is the text style set by the ANSI SGR sequences
+type ansiStyle struct {
+	bold      bool
+	italic    bool
+	underline bool
+	fg        string
+	bg        string
+}
+
+func (s *ansiStyle) classes() string {
+	classes := []string{}
+	if s.bold {
+		classes = append(classes, "ansi-bold")
+	}
+	if s.italic {
+		classes = append(classes, "ansi-italic")
+	}
+	if s.underline {
+		classes = append(classes, "ansi-underline")
+	}
+	if s.fg != "" {
+		classes = append(classes, "ansi-fg-"+s.fg)
+	}
+	if s.bg != "" {
+		classes = append(classes, "ansi-bg-"+s.bg)
+	}
+	return strings.Join(classes, " ")
+}
+
+// applySGR updates the style with the provided SGR parameters
+func (s *ansiStyle) applySGR(params []int) {
+	if len(params) == 0 {
+		params = []int{0}
+	}
+	for i := 0; i < len(params); i++ {
+		p := params[i]
+		switch {
+		case p == 0:
+			*s = ansiStyle{}
+		case p == 1:
+			s.bold = true
+		case p == 3:
+			s.italic = true
+		case p == 4:
+			s.underline = true
+		case p == 22:
+			s.bold = false
+		case p == 23:
+			s.italic = false
+		case p == 24:
+			s.underline = false
+		case p >= 30 && p <= 37:
+			s.fg = ansiColors[p-30]
+		case p >= 90 && p <= 97:
+			s.fg = "bright-" + ansiColors[p-90]
+		case p == 39:
+			s.fg = ""
+		case p >= 40 && p <= 47:
+			s.bg = ansiColors[p-40]
+		case p >= 100 && p <= 107:
+			s.bg = "bright-" + ansiColors[p-100]
+		case p == 49:
+			s.bg = ""
+		case p == 38 || p == 48:
+			// 256 colors are reported with their number, true colors are
+			// ignored
+			color := ""
+			if i+2 < len(params) && params[i+1] == 5 {
+				color = strconv.Itoa(params[i+2])
+				i += 2
+			} else if i+4 < len(params) && params[i+1] == 2 {
+				i += 4
+			}
+			if p == 38 {
+				s.fg = color
+			} else {
+				s.bg = color
+			}
+		}
+	}
+}
+
+// ansiToHTML escapes the text and converts the ANSI SGR sequences to spans with
+// css classes. The other escape sequences are removed. The style is kept
+// between lines.
+func ansiToHTML(text []byte, style *ansiStyle) string {
+	var b strings.Builder
+	var run []byte
+	open := false
+
+	flushRun := func() {
+		if len(run) == 0 {
+			return
+		}
+		if !open {
+			if classes := style.classes(); classes != "" {
+				fmt.Fprintf(&b, `<span class="%s">`, classes)
+				open = true
+			}
+		}
+		b.WriteString(html.EscapeString(string(run)))
+		run = run[:0]
+	}
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c != 0x1b {
+			run = append(run, c)
+			continue
+		}
+
+		// find the end of the CSI sequence
+		if i+1 >= len(text) || text[i+1] != '[' {
+			continue
+		}
+		j := i + 2
+		for j < len(text) && (text[j] < 0x40 || text[j] > 0x7e) {
+			j++
+		}
+		if j >= len(text) {
+			break
+		}
+		if text[j] == 'm' {
+			flushRun()
+			if open {
+				b.WriteString("</span>")
+				open = false
+			}
+			params := []int{}
+			for _, ps := range strings.Split(string(text[i+2:j]), ";") {
+				if ps == "" {
+					params = append(params, 0)
+					continue
+				}
+				p, err := strconv.Atoi(ps)
+				if err != nil {
+					continue
+				}
+				params = append(params, p)
+			}
+			style.applySGR(params)
+		}
+		i = j
+	}
+	flushRun()
+	if open {
+		b.WriteString("</span>")
+	}
+
+	return b.String()
+}
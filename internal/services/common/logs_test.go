@@ -0,0 +1,96 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestLogTimestampWriter(t *testing.T) {
+	var b bytes.Buffer
+	w := NewLogTimestampWriter(&b)
+	w.now = func() time.Time { return time.Date(2019, 1, 2, 3, 4, 5, 6000000, time.FixedZone("", 3600)) }
+
+	for _, s := range []string{"line", "1\nline2\n", "\nline4"} {
+		n, err := w.Write([]byte(s))
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if n != len(s) {
+			t.Fatalf("got %d written bytes, want %d", n, len(s))
+		}
+	}
+
+	ts := "2019-01-02T02:04:05.006Z "
+	want := ts + "line1\n" + ts + "line2\n" + ts + "\n" + ts + "line4"
+	if b.String() != want {
+		t.Fatalf("got %q, want %q", b.String(), want)
+	}
+}
+
+func TestLogFormatWriter(t *testing.T) {
+	ts := "2019-01-02T02:04:05.006Z"
+	log := ts + " \x1b[1;31mred <b>\n" + ts + " still red\x1b[0m reset\x1b[2K\n" + "no timestamp\n" + ts + " \x1b[38;5;208morange"
+
+	tests := []struct {
+		name   string
+		format LogFormat
+		out    string
+	}{
+		{
+			name:   "test plain",
+			format: LogFormatPlain,
+			out:    "\x1b[1;31mred <b>\n" + "still red\x1b[0m reset\x1b[2K\n" + "no timestamp\n" + "\x1b[38;5;208morange",
+		},
+		{
+			name:   "test timestamped",
+			format: LogFormatTimestamped,
+			out:    log,
+		},
+		{
+			name:   "test html",
+			format: LogFormatHTML,
+			out: `<div class="log-line"><span class="log-timestamp">` + ts + `</span><span class="ansi-bold ansi-fg-red">red &lt;b&gt;</span></div>` + "\n" +
+				`<div class="log-line"><span class="log-timestamp">` + ts + `</span><span class="ansi-bold ansi-fg-red">still red</span> reset</div>` + "\n" +
+				`<div class="log-line">no timestamp</div>` + "\n" +
+				`<div class="log-line"><span class="log-timestamp">` + ts + `</span><span class="ansi-fg-208">orange</span></div>` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			w := NewLogFormatWriter(&b, tt.format)
+			// write in small chunks to split lines and escape sequences
+			for i := 0; i < len(log); i += 7 {
+				end := i + 7
+				if end > len(log) {
+					end = len(log)
+				}
+				if _, err := w.Write([]byte(log[i:end])); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if b.String() != tt.out {
+				t.Fatalf("got %q, want %q", b.String(), tt.out)
+			}
+		})
+	}
+}
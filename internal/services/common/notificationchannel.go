@@ -0,0 +1,182 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"regexp"
+	"sort"
+
+	notificationchannel "agola.io/agola/internal/notificationchannels"
+	"agola.io/agola/internal/notificationchannels/discord"
+	"agola.io/agola/internal/notificationchannels/matrix"
+	"agola.io/agola/internal/notificationchannels/telegram"
+	"agola.io/agola/internal/services/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+type notificationChannelOptions struct {
+	required []string
+	optional []string
+}
+
+var channelOptions = map[types.NotificationChannelType]notificationChannelOptions{
+	types.NotificationChannelTypeMatrix: {
+		required: []string{matrix.OptionHomeserverURL, matrix.OptionRoomID},
+	},
+	types.NotificationChannelTypeTelegram: {
+		required: []string{telegram.OptionChatID},
+		optional: []string{telegram.OptionAPIURL},
+	},
+	types.NotificationChannelTypeDiscord: {},
+}
+
+// ValidateNotificationChannel checks the notification channel type, mode and
+// options. The channel credentials are stored in a secret and checked only
+// when sending the notifications.
+func ValidateNotificationChannel(c *types.ProjectNotificationChannel) error {
+	if c.Name == "" {
+		return errors.Errorf("empty notification channel name")
+	}
+	if !types.IsValidNotificationChannelType(c.Type) {
+		return errors.Errorf("notification channel %q: invalid type %q", c.Name, c.Type)
+	}
+	// channels without a mode are notified only by the notification rules
+	if c.Mode != "" && !types.IsValidNotificationMode(c.Mode) {
+		return errors.Errorf("notification channel %q: invalid mode %q", c.Name, c.Mode)
+	}
+	if c.SecretName == "" {
+		return errors.Errorf("notification channel %q: empty secret name", c.Name)
+	}
+
+	opts := channelOptions[c.Type]
+	known := map[string]struct{}{}
+	for _, o := range opts.required {
+		if c.Options[o] == "" {
+			return errors.Errorf("notification channel %q: missing required option %q", c.Name, o)
+		}
+		known[o] = struct{}{}
+	}
+	for _, o := range opts.optional {
+		known[o] = struct{}{}
+	}
+	names := make([]string, 0, len(c.Options))
+	for o := range c.Options {
+		names = append(names, o)
+	}
+	sort.Strings(names)
+	for _, o := range names {
+		if _, ok := known[o]; !ok {
+			return errors.Errorf("notification channel %q: unknown option %q", c.Name, o)
+		}
+	}
+
+	return nil
+}
+
+// ValidateNotificationRules checks the notification rules. The rules must
+// target existing project notification channels.
+func ValidateNotificationRules(rules []*types.NotificationRule, channels []*types.ProjectNotificationChannel) error {
+	channelNames := map[string]struct{}{}
+	for _, c := range channels {
+		channelNames[c.Name] = struct{}{}
+	}
+
+	names := map[string]struct{}{}
+	for _, r := range rules {
+		if r.Name == "" {
+			return errors.Errorf("empty notification rule name")
+		}
+		if _, ok := names[r.Name]; ok {
+			return errors.Errorf("duplicate notification rule name %q", r.Name)
+		}
+		names[r.Name] = struct{}{}
+
+		for _, t := range r.RefTypes {
+			switch t {
+			case types.RunRefTypeBranch, types.RunRefTypeTag, types.RunRefTypePullRequest:
+			default:
+				return errors.Errorf("notification rule %q: invalid ref type %q", r.Name, t)
+			}
+		}
+		for _, result := range r.Results {
+			if !types.IsValidNotificationRuleResult(result) {
+				return errors.Errorf("notification rule %q: invalid result %q", r.Name, result)
+			}
+		}
+		if err := validateWhenConditions(r.Branches); err != nil {
+			return errors.Errorf("notification rule %q: invalid branches conditions: %w", r.Name, err)
+		}
+		if err := validateWhenConditions(r.Tags); err != nil {
+			return errors.Errorf("notification rule %q: invalid tags conditions: %w", r.Name, err)
+		}
+
+		if len(r.Channels) == 0 {
+			return errors.Errorf("notification rule %q: empty channels", r.Name)
+		}
+		for _, c := range r.Channels {
+			if _, ok := channelNames[c]; !ok {
+				return errors.Errorf("notification rule %q: notification channel %q doesn't exist", r.Name, c)
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateWhenConditions(wc *types.WhenConditions) error {
+	if wc == nil {
+		return nil
+	}
+	for _, conds := range [][]types.WhenCondition{wc.Include, wc.Exclude} {
+		for _, cond := range conds {
+			switch cond.Type {
+			case types.WhenConditionTypeSimple:
+			case types.WhenConditionTypeRegExp:
+				if _, err := regexp.Compile(cond.Match); err != nil {
+					return errors.Errorf("invalid regular expression %q: %w", cond.Match, err)
+				}
+			default:
+				return errors.Errorf("invalid condition type %q", cond.Type)
+			}
+		}
+	}
+	return nil
+}
+
+// GetNotificationChannel returns the notification channel implementation
+// using the credentials contained in the channel secret data
+func GetNotificationChannel(c *types.ProjectNotificationChannel, secretData map[string]string) (notificationchannel.Channel, error) {
+	switch c.Type {
+	case types.NotificationChannelTypeMatrix:
+		return matrix.New(matrix.Opts{
+			HomeserverURL: c.Options[matrix.OptionHomeserverURL],
+			RoomID:        c.Options[matrix.OptionRoomID],
+			AccessToken:   secretData[matrix.SecretAccessToken],
+		})
+	case types.NotificationChannelTypeTelegram:
+		return telegram.New(telegram.Opts{
+			APIURL:   c.Options[telegram.OptionAPIURL],
+			ChatID:   c.Options[telegram.OptionChatID],
+			BotToken: secretData[telegram.SecretBotToken],
+		})
+	case types.NotificationChannelTypeDiscord:
+		return discord.New(discord.Opts{
+			WebhookURL: secretData[discord.SecretWebhookURL],
+		})
+	default:
+		return nil, errors.Errorf("notification channel %q has an invalid type %q", c.Name, c.Type)
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"testing"
+
+	"agola.io/agola/internal/services/types"
+)
+
+func TestValidateNotificationChannel(t *testing.T) {
+	tests := []struct {
+		name    string
+		channel *types.ProjectNotificationChannel
+		err     bool
+	}{
+		{
+			name: "test valid matrix channel",
+			channel: &types.ProjectNotificationChannel{
+				Name:       "ci",
+				Type:       types.NotificationChannelTypeMatrix,
+				Mode:       types.NotificationModeFailures,
+				Options:    map[string]string{"homeserver_url": "https://matrix.example.com", "room_id": "!room:example.com"},
+				SecretName: "matrix",
+			},
+		},
+		{
+			name: "test valid telegram channel with optional api url",
+			channel: &types.ProjectNotificationChannel{
+				Name:       "ci",
+				Type:       types.NotificationChannelTypeTelegram,
+				Mode:       types.NotificationModeAll,
+				Options:    map[string]string{"chat_id": "-1001234", "api_url": "http://localhost:8081"},
+				SecretName: "telegram",
+			},
+		},
+		{
+			name: "test valid discord channel",
+			channel: &types.ProjectNotificationChannel{
+				Name:       "ci",
+				Type:       types.NotificationChannelTypeDiscord,
+				Mode:       types.NotificationModeFirstFailure,
+				SecretName: "discord",
+			},
+		},
+		{
+			name: "test channel without mode",
+			channel: &types.ProjectNotificationChannel{
+				Name:       "release",
+				Type:       types.NotificationChannelTypeDiscord,
+				SecretName: "discord",
+			},
+		},
+		{
+			name: "test invalid type",
+			channel: &types.ProjectNotificationChannel{
+				Name:       "ci",
+				Type:       "slack",
+				Mode:       types.NotificationModeFailures,
+				SecretName: "slack",
+			},
+			err: true,
+		},
+		{
+			name: "test missing required option",
+			channel: &types.ProjectNotificationChannel{
+				Name:       "ci",
+				Type:       types.NotificationChannelTypeMatrix,
+				Mode:       types.NotificationModeFailures,
+				Options:    map[string]string{"homeserver_url": "https://matrix.example.com"},
+				SecretName: "matrix",
+			},
+			err: true,
+		},
+		{
+			name: "test unknown option",
+			channel: &types.ProjectNotificationChannel{
+				Name:       "ci",
+				Type:       types.NotificationChannelTypeDiscord,
+				Mode:       types.NotificationModeFailures,
+				Options:    map[string]string{"webhook_url": "https://discord.com/api/webhooks/1/token"},
+				SecretName: "discord",
+			},
+			err: true,
+		},
+		{
+			name: "test missing secret name",
+			channel: &types.ProjectNotificationChannel{
+				Name: "ci",
+				Type: types.NotificationChannelTypeDiscord,
+				Mode: types.NotificationModeFailures,
+			},
+			err: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateNotificationChannel(tt.channel)
+			if tt.err && err == nil {
+				t.Errorf("expected error, got nil")
+			}
+			if !tt.err && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateNotificationRules(t *testing.T) {
+	channels := []*types.ProjectNotificationChannel{
+		{Name: "release", Type: types.NotificationChannelTypeDiscord, SecretName: "discord"},
+	}
+
+	tests := []struct {
+		name  string
+		rules []*types.NotificationRule
+		err   bool
+	}{
+		{
+			name: "test valid rule",
+			rules: []*types.NotificationRule{
+				{
+					Name:     "tag failures",
+					RefTypes: []types.RunRefType{types.RunRefTypeTag},
+					Tags: &types.WhenConditions{
+						Include: []types.WhenCondition{{Type: types.WhenConditionTypeRegExp, Match: "v.*"}},
+					},
+					Results:  []types.NotificationRuleResult{types.NotificationRuleResultFailed},
+					Channels: []string{"release"},
+				},
+			},
+		},
+		{
+			name: "test duplicate rule name",
+			rules: []*types.NotificationRule{
+				{Name: "rule01", Channels: []string{"release"}},
+				{Name: "rule01", Channels: []string{"release"}},
+			},
+			err: true,
+		},
+		{
+			name: "test not existing channel",
+			rules: []*types.NotificationRule{
+				{Name: "rule01", Channels: []string{"dev"}},
+			},
+			err: true,
+		},
+		{
+			name: "test invalid result",
+			rules: []*types.NotificationRule{
+				{Name: "rule01", Results: []types.NotificationRuleResult{"flaky"}, Channels: []string{"release"}},
+			},
+			err: true,
+		},
+		{
+			name: "test invalid regular expression",
+			rules: []*types.NotificationRule{
+				{
+					Name: "rule01",
+					Branches: &types.WhenConditions{
+						Include: []types.WhenCondition{{Type: types.WhenConditionTypeRegExp, Match: "release/("}},
+					},
+					Channels: []string{"release"},
+				},
+			},
+			err: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateNotificationRules(tt.rules, channels)
+			if tt.err && err == nil {
+				t.Errorf("expected error, got nil")
+			}
+			if !tt.err && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
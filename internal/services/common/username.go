@@ -0,0 +1,52 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"regexp"
+	"strings"
+
+	"agola.io/agola/internal/services/types"
+)
+
+var userNameInvalidCharsRegexp = regexp.MustCompile(`[^a-z0-9]+`)
+
+// MapUserName converts a remote source login name to an agola user name using
+// the remote source user name mapping. The returned name is normalized
+// (lowercased, every sequence of invalid chars replaced by a single dash) but
+// could still be invalid (i.e. empty or starting with a digit) so it must be
+// validated by the caller.
+func MapUserName(rs *types.RemoteSource, loginName string) string {
+	name := loginName
+	mapping := rs.UserNameMapping
+	if mapping == nil {
+		mapping = &types.UserNameMapping{}
+	}
+
+	if mapping.StripDomain {
+		if i := strings.Index(name, "@"); i >= 0 {
+			name = name[:i]
+		}
+	}
+	if mapping.Prefix != "" {
+		name = mapping.Prefix + "-" + name
+	}
+
+	name = strings.ToLower(name)
+	name = userNameInvalidCharsRegexp.ReplaceAllString(name, "-")
+	name = strings.Trim(name, "-")
+
+	return name
+}
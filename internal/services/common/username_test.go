@@ -0,0 +1,63 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"testing"
+
+	"agola.io/agola/internal/services/types"
+)
+
+func TestMapUserName(t *testing.T) {
+	tests := []struct {
+		name      string
+		mapping   *types.UserNameMapping
+		loginName string
+		out       string
+	}{
+		{
+			name:      "test no mapping",
+			loginName: "User01",
+			out:       "user01",
+		},
+		{
+			name:      "test invalid chars",
+			loginName: "user.name_01@example.com",
+			out:       "user-name-01-example-com",
+		},
+		{
+			name:      "test strip domain",
+			mapping:   &types.UserNameMapping{StripDomain: true},
+			loginName: "user.name@example.com",
+			out:       "user-name",
+		},
+		{
+			name:      "test prefix",
+			mapping:   &types.UserNameMapping{StripDomain: true, Prefix: "gitea"},
+			loginName: "user01@example.com",
+			out:       "gitea-user01",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := &types.RemoteSource{UserNameMapping: tt.mapping}
+			out := MapUserName(rs, tt.loginName)
+			if out != tt.out {
+				t.Errorf("expected user name %q, got %q", tt.out, out)
+			}
+		})
+	}
+}
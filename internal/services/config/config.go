@@ -16,6 +16,8 @@ package config
 
 import (
 	"io/ioutil"
+	"net/url"
+	"strings"
 	"time"
 
 	"agola.io/agola/internal/util"
@@ -52,10 +54,38 @@ type Gateway struct {
 	// This is used for generating the redirect_url in oauth2 redirects
 	WebExposedURL string `yaml:"webExposedURL"`
 
+	// PathPrefix is the url path prefix under which the gateway api and web
+	// interface are served i.e. /agola when exposed at
+	// https://host.example.com/agola by a reverse proxy not removing it. The
+	// apiExposedURL (and webExposedURL when served by the gateway) must
+	// contain it.
+	PathPrefix string `yaml:"pathPrefix"`
+
+	// WebDir is the directory containing the web interface assets served by
+	// the gateway. When empty the assets embedded in the binary are used.
+	WebDir string `yaml:"webDir"`
+
+	NetworkPolicy GatewayNetworkPolicy `yaml:"networkPolicy"`
+
 	RunserviceURL  string `yaml:"runserviceURL"`
 	ConfigstoreURL string `yaml:"configstoreURL"`
 	GitserverURL   string `yaml:"gitserverURL"`
 
+	// ConfigstoreReadURL is the url of the configstore read replicas (usually
+	// a load balancer in front of them). When set the configstore read
+	// requests are sent to it while the write requests are always sent to
+	// ConfigstoreURL.
+	// The read replicas are eventually consistent. The read requests done
+	// shortly after a write by the same gateway instance are sent to
+	// ConfigstoreURL so they read the written data, while the writes done by
+	// other gateway instances could be visible only after some time.
+	ConfigstoreReadURL string `yaml:"configstoreReadURL"`
+
+	// RunserviceAPIToken and ConfigstoreAPIToken are the tokens used to
+	// authenticate to the runservice and configstore internal APIs
+	RunserviceAPIToken  string `yaml:"runserviceAPIToken"`
+	ConfigstoreAPIToken string `yaml:"configstoreAPIToken"`
+
 	Web           Web           `yaml:"web"`
 	Etcd          Etcd          `yaml:"etcd"`
 	ObjectStorage ObjectStorage `yaml:"objectStorage"`
@@ -63,12 +93,196 @@ type Gateway struct {
 	TokenSigning TokenSigning `yaml:"tokenSigning"`
 
 	AdminToken string `yaml:"adminToken"`
+
+	// OrgsStoragePartitions maps an organization name to the runservice
+	// storage partition where its runs data will be saved
+	OrgsStoragePartitions map[string]string `yaml:"orgsStoragePartitions"`
+
+	ConfigLint ConfigLint `yaml:"configLint"`
+
+	// RunConfigPolicyFile is the path of a yaml file defining the instance
+	// wide run config policy: defaults, enforced tasks, forbidden values and
+	// allowed options (like the host network) applied to all the runs
+	RunConfigPolicyFile string `yaml:"runConfigPolicyFile"`
+
+	// AnonymousAccess defines the runs data of the public projects hidden to
+	// the anonymous users. Projects can hide more data with their own
+	// settings.
+	AnonymousAccess AnonymousAccess `yaml:"anonymousAccess"`
+
+	// SAML configures the SAML 2.0 single sign on. It's enabled when the
+	// identity provider metadata file is provided.
+	SAML SAML `yaml:"saml"`
+
+	TwoFactorAuth TwoFactorAuth `yaml:"twoFactorAuth"`
+
+	// OrgSync mirrors the remote sources organizations membership into the
+	// agola organizations. It's enabled when at least one organization is
+	// defined.
+	OrgSync OrgSync `yaml:"orgSync"`
+
+	// RefCacheTTL is how long the resolution of the projects and project
+	// groups paths and of the users names is cached. The cache is purged on every change done by the
+	// gateway and on the changes reported by the configstore watch API, the
+	// ttl limits the staleness when the watch isn't available. 0 disables the
+	// cache.
+	RefCacheTTL time.Duration `yaml:"refCacheTTL"`
+}
+
+type OrgSyncConflictPolicy string
+
+const (
+	// OrgSyncConflictPolicyKeep only adds the missing members, the existing
+	// members roles aren't changed and no member is removed
+	OrgSyncConflictPolicyKeep OrgSyncConflictPolicy = "keep"
+	// OrgSyncConflictPolicyRemote makes the agola organization members match
+	// the remote organization members: roles are updated and the members not
+	// in the remote organization are removed
+	OrgSyncConflictPolicyRemote OrgSyncConflictPolicy = "remote"
+)
+
+// OrgSync configures the remote sources organizations membership sync. The
+// memberships of a user are synced using the user linked account, at login
+// and every Interval.
+type OrgSync struct {
+	// OnLogin syncs the user memberships at every login
+	OnLogin bool `yaml:"onLogin"`
+	// Interval is the interval between the sync of all the users. A zero
+	// value disables the periodic sync.
+	Interval time.Duration `yaml:"interval"`
+	// ConflictPolicy defines how the existing agola organization members are
+	// handled. Defaults to keep.
+	ConflictPolicy OrgSyncConflictPolicy `yaml:"conflictPolicy"`
+
+	Orgs []OrgSyncOrg `yaml:"orgs"`
+}
+
+// OrgSyncOrg maps a remote source organization to an agola organization.
+// Since agola doesn't have teams, the remote teams are used to filter the
+// synced members and to choose their role.
+type OrgSyncOrg struct {
+	RemoteSource string `yaml:"remoteSource"`
+	RemoteOrg    string `yaml:"remoteOrg"`
+	// Org is the agola organization name. Defaults to RemoteOrg.
+	Org string `yaml:"org"`
+	// Teams, when defined, limits the synced members to the members of these
+	// remote teams
+	Teams []string `yaml:"teams"`
+	// OwnerTeams are the remote teams whose members will be organization
+	// owners. The remote organization owners are always owners.
+	OwnerTeams []string `yaml:"ownerTeams"`
+}
+
+// TwoFactorAuth configures the users TOTP two factor authentication. When a
+// user has enabled it, the sensitive operations (creating api tokens,
+// managing secrets, approving run tasks) require a valid code in the
+// X-Agola-OTP request header.
+type TwoFactorAuth struct {
+	// Required forbids the sensitive operations to the users without the two
+	// factor authentication enabled
+	Required bool `yaml:"required"`
+	// Issuer is the issuer shown by the authenticator apps. Defaults to
+	// "Agola".
+	Issuer string `yaml:"issuer"`
+}
+
+// SAML configures the gateway as a SAML 2.0 service provider. The service
+// provider metadata is served at <apiExposedURL>/api/saml/metadata and the
+// assertion consumer service at <apiExposedURL>/api/saml/acs.
+type SAML struct {
+	// EntityID is the service provider entity id. Defaults to the service
+	// provider metadata url.
+	EntityID string `yaml:"entityID"`
+	// IDPMetadataFile is the path of the identity provider metadata xml
+	IDPMetadataFile string `yaml:"idpMetadataFile"`
+	// UsernameAttribute is the assertion attribute (name or friendly name)
+	// containing the agola user name. When empty the subject NameID is used.
+	UsernameAttribute string `yaml:"usernameAttribute"`
+	// EmailAttribute is the assertion attribute containing the user email.
+	// When the user name is missing the email local part is used.
+	EmailAttribute string `yaml:"emailAttribute"`
+	// AutoRegister creates the users logging in for the first time. When
+	// disabled only the existing users can log in.
+	AutoRegister bool `yaml:"autoRegister"`
+}
+
+// AnonymousAccess defines the runs data of the public projects hidden to the
+// anonymous users. Everything is visible by default.
+type AnonymousAccess struct {
+	// HideRuns hides all the runs data (lists, details, stats, logs,
+	// artifacts and config)
+	HideRuns      bool `yaml:"hideRuns"`
+	HideLogs      bool `yaml:"hideLogs"`
+	HideArtifacts bool `yaml:"hideArtifacts"`
+	HideConfig    bool `yaml:"hideConfig"`
+}
+
+// ConfigLint configures the run config linter. The builtin rules
+// (unused-tasks, unpinned-images, missing-when, broad-secrets) can be disabled
+// or have their severity changed and custom rules can be added.
+type ConfigLint struct {
+	// Rules maps a rule name to its configuration
+	Rules map[string]ConfigLintRule `yaml:"rules"`
+	// CustomRules are additional rules reporting the config values matching
+	// a regular expression
+	CustomRules []ConfigLintCustomRule `yaml:"customRules"`
+}
+
+type ConfigLintRule struct {
+	Disabled bool `yaml:"disabled"`
+	// Severity is one of error, warning or info
+	Severity string `yaml:"severity"`
+}
+
+type ConfigLintCustomRule struct {
+	Name string `yaml:"name"`
+	// Message is the reported issue message, when empty a generic message
+	// with the matched value is reported
+	Message string `yaml:"message"`
+	// Severity is one of error, warning (default) or info
+	Severity string `yaml:"severity"`
+	// Field is the checked config field: image (the task containers images)
+	// or command (the run steps commands)
+	Field  string `yaml:"field"`
+	Regexp string `yaml:"regexp"`
+}
+
+// GatewayNetworkPolicy defines the source addresses allowed to call the
+// gateway endpoints. The allowed lists accept CIDRs or ip addresses; an empty
+// list allows all the addresses.
+type GatewayNetworkPolicy struct {
+	// WebhooksAllowedCIDRs are the addresses allowed to send webhooks (i.e.
+	// the git sources hosts)
+	WebhooksAllowedCIDRs []string `yaml:"webhooksAllowedCIDRs"`
+	// APIAllowedCIDRs are the addresses allowed to call the api and the git
+	// repositories endpoints
+	APIAllowedCIDRs []string `yaml:"apiAllowedCIDRs"`
+	// AdminAllowedCIDRs are the addresses allowed to do admin requests. The
+	// requests with the admin token from other addresses are rejected while
+	// admin users are handled as normal users.
+	AdminAllowedCIDRs []string `yaml:"adminAllowedCIDRs"`
+
+	// TrustedProxies are the addresses of the reverse proxies in front of the
+	// gateway. Only for requests coming from them the client address is taken
+	// from the X-Forwarded-For header.
+	TrustedProxies []string `yaml:"trustedProxies"`
+	// ProxyProtocol enables the PROXY protocol (version 1) on the gateway
+	// listener for connections coming from the trusted proxies
+	ProxyProtocol bool `yaml:"proxyProtocol"`
 }
 
 type Scheduler struct {
 	Debug bool `yaml:"debug"`
 
 	RunserviceURL string `yaml:"runserviceURL"`
+	// RunserviceAPIToken is the token used to authenticate to the runservice
+	// internal API
+	RunserviceAPIToken string `yaml:"runserviceAPIToken"`
+
+	// RestartedRunsPriorityDuration is the time, since their enqueue, where
+	// the runs restarted from failed tasks are started before the other queued
+	// runs of the same group. 0 disables it.
+	RestartedRunsPriorityDuration time.Duration `yaml:"restartedRunsPriorityDuration"`
 }
 
 type Notification struct {
@@ -81,9 +295,38 @@ type Notification struct {
 	RunserviceURL  string `yaml:"runserviceURL"`
 	ConfigstoreURL string `yaml:"configstoreURL"`
 
+	// RunserviceAPIToken and ConfigstoreAPIToken are the tokens used to
+	// authenticate to the runservice and configstore internal APIs
+	RunserviceAPIToken  string `yaml:"runserviceAPIToken"`
+	ConfigstoreAPIToken string `yaml:"configstoreAPIToken"`
+
+	// GitserverURL is the url of the gitserver. When set the temporary
+	// branches pushed by the user direct runs are removed when the runs
+	// complete.
+	GitserverURL string `yaml:"gitserverURL"`
+
+	// SMTP, when defined, enables the runs email notifications
+	SMTP *SMTP `yaml:"smtp"`
+	// EmailDigestInterval is the interval between the email notifications
+	// digests sent to the recipients with the digest mode enabled
+	EmailDigestInterval time.Duration `yaml:"emailDigestInterval"`
+
 	Etcd Etcd `yaml:"etcd"`
 }
 
+type SMTP struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+
+	// Username and Password, when defined, are used for the smtp plain
+	// authentication
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+
+	// From is the sender address of the notification emails
+	From string `yaml:"from"`
+}
+
 type Runservice struct {
 	Debug bool `yaml:"debug"`
 
@@ -93,6 +336,76 @@ type Runservice struct {
 	ObjectStorage ObjectStorage `yaml:"objectStorage"`
 
 	RunCacheExpireInterval time.Duration `yaml:"runCacheExpireInterval"`
+
+	// ObjectStoragePartitions are additional object storages where the runs
+	// created with the related storage partition save their archives, caches
+	// and optionally their logs
+	ObjectStoragePartitions map[string]ObjectStoragePartition `yaml:"objectStoragePartitions"`
+
+	// ExecutorBootstrapToken, when set, is the token that new executors must
+	// provide to register. Registered executors won't receive tasks until
+	// approved by an admin. When empty any executor can register.
+	ExecutorBootstrapToken string `yaml:"executorBootstrapToken"`
+	// ExecutorApprovalRequired, when true, registers the new executors waiting
+	// an admin approval also when no executor bootstrap token is set.
+	ExecutorApprovalRequired bool `yaml:"executorApprovalRequired"`
+
+	InternalAPIAuth InternalAPIAuth `yaml:"internalAPIAuth"`
+
+	// ExecutorAPIToken is the token used to authenticate to the executors
+	// API
+	ExecutorAPIToken string `yaml:"executorAPIToken"`
+
+	// TaskLeaseDuration is the duration of the lease an executor must hold to
+	// execute a task. The executors renew it while executing the task and stop
+	// the task when they cannot renew it.
+	TaskLeaseDuration time.Duration `yaml:"taskLeaseDuration"`
+
+	// QueueWaitAlertThreshold, when set, is the max time a schedulable task
+	// should wait to be started by an executor. Tasks waiting more are
+	// reported in the logs, in the metrics and with a commit status.
+	QueueWaitAlertThreshold time.Duration `yaml:"queueWaitAlertThreshold"`
+
+	Janitor RunserviceJanitor `yaml:"janitor"`
+}
+
+// RunserviceJanitor defines how the runs stuck in intermediate phases are
+// handled
+type RunserviceJanitor struct {
+	// Interval is the interval between the stuck runs checks
+	Interval time.Duration `yaml:"interval"`
+	// TaskAckTimeout is the max time an executor has to start a dispatched
+	// task. After it the task is dispatched again.
+	TaskAckTimeout time.Duration `yaml:"taskAckTimeout"`
+	// TaskMaxDispatches is the max number of dispatches of a task not started
+	// by the executors. After it the task is failed.
+	TaskMaxDispatches int `yaml:"taskMaxDispatches"`
+	// TaskHeartbeatTimeout is the max time between two heartbeats of a running
+	// task. After it the task is considered orphaned and it's dispatched again
+	// if idempotent or failed.
+	TaskHeartbeatTimeout time.Duration `yaml:"taskHeartbeatTimeout"`
+	// ApprovalMaxDuration is the max time a task without an approval timeout
+	// can wait approval. After it the task is rejected. 0 means no limit.
+	ApprovalMaxDuration time.Duration `yaml:"approvalMaxDuration"`
+	// RunMaxDuration is the max duration of a running run. After it the run
+	// is stopped. 0 means no limit.
+	RunMaxDuration time.Duration `yaml:"runMaxDuration"`
+}
+
+// InternalAPIAuth defines the authentication of the internal services APIs.
+// When no tokens are defined the APIs don't require authentication.
+type InternalAPIAuth struct {
+	// Tokens are the accepted tokens. More than one token can be defined to
+	// rotate them without downtime: add the new token, update the services
+	// calling the API to use it and then remove the old token.
+	Tokens []string `yaml:"tokens"`
+}
+
+type ObjectStoragePartition struct {
+	ObjectStorage ObjectStorage `yaml:"objectStorage"`
+
+	// Logs defines if also the run logs are saved in this partition
+	Logs bool `yaml:"logs"`
 }
 
 type Executor struct {
@@ -103,6 +416,14 @@ type Executor struct {
 	RunserviceURL string `yaml:"runserviceURL"`
 	ToolboxPath   string `yaml:"toolboxPath"`
 
+	// RunserviceAPIToken is the token used to authenticate to the runservice
+	// internal API
+	RunserviceAPIToken string `yaml:"runserviceAPIToken"`
+
+	// InternalAPIAuth defines the tokens accepted by the executor API. The
+	// runservice must be configured with one of them as executorAPIToken.
+	InternalAPIAuth InternalAPIAuth `yaml:"internalAPIAuth"`
+
 	Web Web `yaml:"web"`
 
 	Driver Driver `yaml:"driver"`
@@ -112,6 +433,59 @@ type Executor struct {
 	ActiveTasksLimit int `yaml:"active_tasks_limit"`
 
 	AllowPrivilegedContainers bool `yaml:"allowPrivilegedContainers"`
+
+	// BootstrapToken is the token used to register to the runservice (must
+	// match the runservice executorBootstrapToken)
+	BootstrapToken string `yaml:"bootstrapToken"`
+
+	// StepLogSizeLimit, when greater than 0, is the max size in bytes of the
+	// setup and steps logs. Bigger logs are truncated with a marker, their full
+	// log is kept by the executor until the task is removed and can be
+	// downloaded only by admins.
+	StepLogSizeLimit int64 `yaml:"stepLogSizeLimit"`
+
+	// StopGracePeriod is the time given to the processes of a stopped task to
+	// terminate after receiving a SIGTERM before being killed
+	StopGracePeriod time.Duration `yaml:"stopGracePeriod"`
+
+	// Proxy defines the proxy environment variables injected in all the task
+	// containers
+	Proxy Proxy `yaml:"proxy"`
+
+	// RegistryMirrors maps an image registry (i.e. docker.io) to the mirror
+	// (host and optional path prefix) used in place of it. When defined, the
+	// task images are rewritten to use the mirrors and a warning is reported
+	// for the images of registries without a mirror.
+	RegistryMirrors map[string]string `yaml:"registryMirrors"`
+}
+
+// Proxy defines the proxy used by the task containers. The images are pulled
+// by the container engine (the docker daemon or the kubelet) that must be
+// configured with the same proxy.
+type Proxy struct {
+	HTTPProxy  string `yaml:"httpProxy"`
+	HTTPSProxy string `yaml:"httpsProxy"`
+	// NoProxy is a comma separated list of hosts, domains and ips that
+	// shouldn't be reached through the proxy
+	NoProxy string `yaml:"noProxy"`
+}
+
+// Env returns the proxy environment variables. Both the upper and lower case
+// variants are defined since tools don't agree on which one to use.
+func (p Proxy) Env() map[string]string {
+	env := map[string]string{}
+	for name, value := range map[string]string{
+		"HTTP_PROXY":  p.HTTPProxy,
+		"HTTPS_PROXY": p.HTTPSProxy,
+		"NO_PROXY":    p.NoProxy,
+	} {
+		if value == "" {
+			continue
+		}
+		env[name] = value
+		env[strings.ToLower(name)] = value
+	}
+	return env
 }
 
 type Configstore struct {
@@ -122,6 +496,25 @@ type Configstore struct {
 	Web           Web           `yaml:"web"`
 	Etcd          Etcd          `yaml:"etcd"`
 	ObjectStorage ObjectStorage `yaml:"objectStorage"`
+
+	InternalAPIAuth InternalAPIAuth `yaml:"internalAPIAuth"`
+
+	// ReservedUserNames is a list of user names that cannot be used when
+	// creating or renaming users (the match is case insensitive)
+	ReservedUserNames []string `yaml:"reservedUserNames"`
+
+	// ReadReplica makes this configstore instance a read only replica. It
+	// keeps its read db updated from the datamanager changes and only serves
+	// read requests. The write requests are rejected and must be sent to the
+	// primary configstore instances.
+	// A read replica waits for a primary instance to initialize the etcd data
+	// before starting and its data is eventually consistent with the primary.
+	ReadReplica bool `yaml:"readReplica"`
+
+	// TrashRetention is how long the deleted projects and project groups are
+	// kept in the trash, where they can be restored, before being purged. 0
+	// disables the trash and the deletions are immediate.
+	TrashRetention time.Duration `yaml:"trashRetention"`
 }
 
 type Gitserver struct {
@@ -132,6 +525,18 @@ type Gitserver struct {
 	Web           Web           `yaml:"web"`
 	Etcd          Etcd          `yaml:"etcd"`
 	ObjectStorage ObjectStorage `yaml:"objectStorage"`
+
+	// RepositoryMaxSize is the max size in bytes of a repository. The pushes
+	// to a repository exceeding it are rejected. 0 means no limit.
+	RepositoryMaxSize int64 `yaml:"repositoryMaxSize"`
+
+	// RefsMaxAge is the max age of the repositories refs (the user direct runs
+	// branches). Older refs and their objects are removed and the
+	// repositories without refs are deleted. 0 disables the pruning.
+	RefsMaxAge time.Duration `yaml:"refsMaxAge"`
+
+	// CleanupInterval is the interval between the repositories cleanups
+	CleanupInterval time.Duration `yaml:"cleanupInterval"`
 }
 
 type Web struct {
@@ -148,16 +553,41 @@ type Web struct {
 	// Server cert private key
 	// TODO(sgotti) support encrypted private keys (add a private key password config entry)
 	TLSKeyFile string `yaml:"tlsKeyFile"`
+	// TLSReloadInterval is the interval between the checks for changes of the
+	// cert and key files. When changed they are reloaded without restarting.
+	// They are also reloaded on SIGHUP. 0 disables the checks.
+	TLSReloadInterval time.Duration `yaml:"tlsReloadInterval"`
+
+	// ACME, when enabled, automatically obtains and renews the server
+	// certificate from an ACME certificate authority (i.e. Let's Encrypt)
+	// instead of using the cert and key files
+	ACME ACME `yaml:"acme"`
 
 	// CORS allowed origins
 	AllowedOrigins []string `yaml:"allowedOrigins"`
 }
 
+type ACME struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Domains are the domains for which certificates will be requested
+	Domains []string `yaml:"domains"`
+	// Email is the contact email sent to the certificate authority
+	Email string `yaml:"email"`
+	// CacheDir is the directory where the obtained certificates are saved
+	CacheDir string `yaml:"cacheDir"`
+	// DirectoryURL is the ACME directory url. Defaults to the Let's Encrypt
+	// production directory
+	DirectoryURL string `yaml:"directoryURL"`
+}
+
 type ObjectStorageType string
 
 const (
 	ObjectStorageTypePosix ObjectStorageType = "posix"
 	ObjectStorageTypeS3    ObjectStorageType = "s3"
+	ObjectStorageTypeGCS   ObjectStorageType = "gcs"
+	ObjectStorageTypeAzure ObjectStorageType = "azure"
 )
 
 type ObjectStorage struct {
@@ -173,6 +603,38 @@ type ObjectStorage struct {
 	AccessKey       string `yaml:"accessKey"`
 	SecretAccessKey string `yaml:"secretAccessKey"`
 	DisableTLS      bool   `yaml:"disableTLS"`
+
+	// GCS (also uses Bucket and optionally Endpoint)
+	// CredentialsFile is the path of a service account json key
+	CredentialsFile string `yaml:"credentialsFile"`
+
+	// Azure (optionally uses Endpoint)
+	AccountName string `yaml:"accountName"`
+	AccountKey  string `yaml:"accountKey"`
+	Container   string `yaml:"container"`
+
+	// Encryption enables the client side encryption of all the objects
+	// written to the object storage
+	Encryption *ObjectStorageEncryption `yaml:"encryption"`
+}
+
+type ObjectStorageEncryption struct {
+	// Keys are the encryption keys. The first key is used to encrypt new
+	// objects, all the keys are used to decrypt existing objects. To rotate a
+	// key add the new one as the first key, reencrypt the objects with the
+	// "agola admin reencrypt" command and then remove the old key.
+	Keys []ObjectStorageEncryptionKey `yaml:"keys"`
+
+	// AllowUnencrypted permits reading objects that aren't encrypted (i.e.
+	// objects written before enabling the encryption)
+	AllowUnencrypted bool `yaml:"allowUnencrypted"`
+}
+
+type ObjectStorageEncryptionKey struct {
+	ID string `yaml:"id"`
+	// KeyFile is the path of a file containing a base64 encoded AES key of
+	// 16, 24 or 32 bytes
+	KeyFile string `yaml:"keyFile"`
 }
 
 type Etcd struct {
@@ -220,12 +682,34 @@ var defaultConfig = Config{
 		TokenSigning: TokenSigning{
 			Duration: 12 * time.Hour,
 		},
+		RefCacheTTL: 10 * time.Second,
+	},
+	Scheduler: Scheduler{
+		RestartedRunsPriorityDuration: 10 * time.Minute,
 	},
 	Runservice: Runservice{
 		RunCacheExpireInterval: 7 * 24 * time.Hour,
+		TaskLeaseDuration:      30 * time.Second,
+		Janitor: RunserviceJanitor{
+			Interval:             1 * time.Minute,
+			TaskAckTimeout:       10 * time.Minute,
+			TaskMaxDispatches:    3,
+			TaskHeartbeatTimeout: 1 * time.Minute,
+		},
+	},
+	Notification: Notification{
+		EmailDigestInterval: 24 * time.Hour,
 	},
 	Executor: Executor{
 		ActiveTasksLimit: 2,
+		StopGracePeriod:  10 * time.Second,
+	},
+	Configstore: Configstore{
+		TrashRetention: 7 * 24 * time.Hour,
+	},
+	Gitserver: Gitserver{
+		RefsMaxAge:      7 * 24 * time.Hour,
+		CleanupInterval: 1 * time.Hour,
 	},
 }
 
@@ -249,11 +733,33 @@ func validateWeb(w *Web) error {
 	}
 
 	if w.TLS {
-		if w.TLSKeyFile == "" {
-			return errors.Errorf("no tls key file specified")
+		if w.ACME.Enabled {
+			if len(w.ACME.Domains) == 0 {
+				return errors.Errorf("no acme domains specified")
+			}
+			if w.ACME.CacheDir == "" {
+				return errors.Errorf("no acme cache dir specified")
+			}
+		} else {
+			if w.TLSKeyFile == "" {
+				return errors.Errorf("no tls key file specified")
+			}
+			if w.TLSCertFile == "" {
+				return errors.Errorf("no tls cert file specified")
+			}
 		}
-		if w.TLSCertFile == "" {
-			return errors.Errorf("no tls cert file specified")
+		if w.TLSReloadInterval < 0 {
+			return errors.Errorf("tls reload interval must be greater or equal than 0")
+		}
+	}
+
+	return nil
+}
+
+func validateInternalAPIAuth(a *InternalAPIAuth) error {
+	for _, token := range a.Tokens {
+		if token == "" {
+			return errors.Errorf("empty token")
 		}
 	}
 
@@ -276,6 +782,18 @@ func Validate(c *Config) error {
 	if c.Gateway.WebExposedURL == "" {
 		return errors.Errorf("gateway webExposedURL is empty")
 	}
+	if c.Gateway.PathPrefix != "" {
+		if !strings.HasPrefix(c.Gateway.PathPrefix, "/") || strings.HasSuffix(c.Gateway.PathPrefix, "/") {
+			return errors.Errorf("gateway pathPrefix must start with a slash and not end with a slash")
+		}
+		u, err := url.Parse(c.Gateway.APIExposedURL)
+		if err != nil {
+			return errors.Errorf("cannot parse gateway apiExposedURL: %w", err)
+		}
+		if strings.TrimSuffix(u.Path, "/") != c.Gateway.PathPrefix {
+			return errors.Errorf("gateway apiExposedURL path %q doesn't match pathPrefix %q", u.Path, c.Gateway.PathPrefix)
+		}
+	}
 	if c.Gateway.ConfigstoreURL == "" {
 		return errors.Errorf("gateway configstoreURL is empty")
 	}
@@ -285,6 +803,33 @@ func Validate(c *Config) error {
 	if err := validateWeb(&c.Gateway.Web); err != nil {
 		return errors.Errorf("gateway web configuration error: %w", err)
 	}
+	for _, cidrs := range [][]string{
+		c.Gateway.NetworkPolicy.WebhooksAllowedCIDRs,
+		c.Gateway.NetworkPolicy.APIAllowedCIDRs,
+		c.Gateway.NetworkPolicy.AdminAllowedCIDRs,
+		c.Gateway.NetworkPolicy.TrustedProxies,
+	} {
+		if _, err := util.ParseCIDRs(cidrs); err != nil {
+			return errors.Errorf("gateway networkPolicy configuration error: %w", err)
+		}
+	}
+
+	switch c.Gateway.OrgSync.ConflictPolicy {
+	case "", OrgSyncConflictPolicyKeep, OrgSyncConflictPolicyRemote:
+	default:
+		return errors.Errorf("gateway orgSync unknown conflictPolicy %q", c.Gateway.OrgSync.ConflictPolicy)
+	}
+	if c.Gateway.OrgSync.Interval < 0 {
+		return errors.Errorf("gateway orgSync interval must be greater or equal than 0")
+	}
+	if c.Gateway.RefCacheTTL < 0 {
+		return errors.Errorf("gateway refCacheTTL must be greater or equal than 0")
+	}
+	for i, o := range c.Gateway.OrgSync.Orgs {
+		if o.RemoteSource == "" || o.RemoteOrg == "" {
+			return errors.Errorf("gateway orgSync org %d: remoteSource and remoteOrg are required", i)
+		}
+	}
 
 	// Configstore
 	if c.Configstore.DataDir == "" {
@@ -293,6 +838,12 @@ func Validate(c *Config) error {
 	if err := validateWeb(&c.Configstore.Web); err != nil {
 		return errors.Errorf("configstore web configuration error: %w", err)
 	}
+	if err := validateInternalAPIAuth(&c.Configstore.InternalAPIAuth); err != nil {
+		return errors.Errorf("configstore internalAPIAuth configuration error: %w", err)
+	}
+	if c.Configstore.TrashRetention < 0 {
+		return errors.Errorf("configstore trashRetention must be greater or equal than 0")
+	}
 
 	// Runservice
 	if c.Runservice.DataDir == "" {
@@ -301,17 +852,67 @@ func Validate(c *Config) error {
 	if err := validateWeb(&c.Runservice.Web); err != nil {
 		return errors.Errorf("runservice web configuration error: %w", err)
 	}
+	if err := validateInternalAPIAuth(&c.Runservice.InternalAPIAuth); err != nil {
+		return errors.Errorf("runservice internalAPIAuth configuration error: %w", err)
+	}
+	if c.Runservice.TaskLeaseDuration <= 0 {
+		return errors.Errorf("runservice taskLeaseDuration must be greater than 0")
+	}
+	if c.Runservice.QueueWaitAlertThreshold < 0 {
+		return errors.Errorf("runservice queueWaitAlertThreshold must be greater or equal than 0")
+	}
+	if c.Runservice.Janitor.Interval <= 0 {
+		return errors.Errorf("runservice janitor interval must be greater than 0")
+	}
+	if c.Runservice.Janitor.TaskAckTimeout <= 0 {
+		return errors.Errorf("runservice janitor taskAckTimeout must be greater than 0")
+	}
+	if c.Runservice.Janitor.TaskMaxDispatches < 1 {
+		return errors.Errorf("runservice janitor taskMaxDispatches must be greater than 0")
+	}
+	if c.Runservice.Janitor.TaskHeartbeatTimeout <= 0 {
+		return errors.Errorf("runservice janitor taskHeartbeatTimeout must be greater than 0")
+	}
+	if c.Runservice.Janitor.ApprovalMaxDuration < 0 {
+		return errors.Errorf("runservice janitor approvalMaxDuration must be greater or equal than 0")
+	}
+	if c.Runservice.Janitor.RunMaxDuration < 0 {
+		return errors.Errorf("runservice janitor runMaxDuration must be greater or equal than 0")
+	}
 
 	// Executor
 	if c.Executor.DataDir == "" {
 		return errors.Errorf("executor dataDir is empty")
 	}
+	if c.Executor.StepLogSizeLimit < 0 {
+		return errors.Errorf("executor stepLogSizeLimit must be greater or equal than 0")
+	}
+	if c.Executor.StopGracePeriod < 0 {
+		return errors.Errorf("executor stopGracePeriod must be greater or equal than 0")
+	}
 	if c.Executor.ToolboxPath == "" {
 		return errors.Errorf("git server toolboxPath is empty")
 	}
 	if c.Executor.RunserviceURL == "" {
 		return errors.Errorf("executor runserviceURL is empty")
 	}
+	if err := validateWeb(&c.Executor.Web); err != nil {
+		return errors.Errorf("executor web configuration error: %w", err)
+	}
+	if err := validateInternalAPIAuth(&c.Executor.InternalAPIAuth); err != nil {
+		return errors.Errorf("executor internalAPIAuth configuration error: %w", err)
+	}
+	if _, err := url.Parse(c.Executor.Proxy.HTTPProxy); err != nil {
+		return errors.Errorf("executor proxy httpProxy is not a valid url: %w", err)
+	}
+	if _, err := url.Parse(c.Executor.Proxy.HTTPSProxy); err != nil {
+		return errors.Errorf("executor proxy httpsProxy is not a valid url: %w", err)
+	}
+	for reg, mirror := range c.Executor.RegistryMirrors {
+		if mirror == "" {
+			return errors.Errorf("executor registry %q mirror is empty", reg)
+		}
+	}
 	if c.Executor.Driver.Type == "" {
 		return errors.Errorf("executor driver type is empty")
 	}
@@ -326,6 +927,9 @@ func Validate(c *Config) error {
 	if c.Scheduler.RunserviceURL == "" {
 		return errors.Errorf("scheduler runserviceURL is empty")
 	}
+	if c.Scheduler.RestartedRunsPriorityDuration < 0 {
+		return errors.Errorf("scheduler restartedRunsPriorityDuration must be greater or equal than 0")
+	}
 
 	// Notification
 	if c.Notification.WebExposedURL == "" {
@@ -337,11 +941,34 @@ func Validate(c *Config) error {
 	if c.Notification.RunserviceURL == "" {
 		return errors.Errorf("notification runserviceURL is empty")
 	}
+	if c.Notification.SMTP != nil {
+		if c.Notification.SMTP.Host == "" {
+			return errors.Errorf("notification smtp host is empty")
+		}
+		if c.Notification.SMTP.Port <= 0 || c.Notification.SMTP.Port > 65535 {
+			return errors.Errorf("notification smtp port must be between 1 and 65535")
+		}
+		if c.Notification.SMTP.From == "" {
+			return errors.Errorf("notification smtp from is empty")
+		}
+		if c.Notification.EmailDigestInterval <= 0 {
+			return errors.Errorf("notification emailDigestInterval must be greater than 0")
+		}
+	}
 
 	// Git server
 	if c.Gitserver.DataDir == "" {
 		return errors.Errorf("git server dataDir is empty")
 	}
+	if c.Gitserver.RepositoryMaxSize < 0 {
+		return errors.Errorf("git server repositoryMaxSize must be greater or equal than 0")
+	}
+	if c.Gitserver.RefsMaxAge < 0 {
+		return errors.Errorf("git server refsMaxAge must be greater or equal than 0")
+	}
+	if c.Gitserver.CleanupInterval <= 0 {
+		return errors.Errorf("git server cleanupInterval must be greater than 0")
+	}
 
 	return nil
 }
@@ -15,6 +15,9 @@
 package action
 
 import (
+	"strings"
+	"time"
+
 	"agola.io/agola/internal/datamanager"
 	"agola.io/agola/internal/services/configstore/readdb"
 
@@ -25,12 +28,26 @@ type ActionHandler struct {
 	log    *zap.SugaredLogger
 	readDB *readdb.ReadDB
 	dm     *datamanager.DataManager
+
+	reservedUserNames []string
+	trashRetention    time.Duration
 }
 
-func NewActionHandler(logger *zap.Logger, readDB *readdb.ReadDB, dm *datamanager.DataManager) *ActionHandler {
+func NewActionHandler(logger *zap.Logger, readDB *readdb.ReadDB, dm *datamanager.DataManager, reservedUserNames []string, trashRetention time.Duration) *ActionHandler {
 	return &ActionHandler{
-		log:    logger.Sugar(),
-		readDB: readDB,
-		dm:     dm,
+		log:               logger.Sugar(),
+		readDB:            readDB,
+		dm:                dm,
+		reservedUserNames: reservedUserNames,
+		trashRetention:    trashRetention,
+	}
+}
+
+func (h *ActionHandler) isReservedUserName(userName string) bool {
+	for _, n := range h.reservedUserNames {
+		if strings.EqualFold(n, userName) {
+			return true
+		}
 	}
+	return false
 }
@@ -0,0 +1,223 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"encoding/json"
+
+	"agola.io/agola/internal/datamanager"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+type Wal struct {
+	WalSequence string
+	Actions     []*datamanager.Action
+}
+
+// GetWals returns the wals committed to the objectstorage starting after the
+// provided wal sequence. The actions data isn't returned.
+func (h *ActionHandler) GetWals(ctx context.Context, start string, limit int) ([]*Wal, error) {
+	wals := []*Wal{}
+	var err error
+	// consume all the channel to not leave the listing goroutine blocked
+	// TODO: make ListOSTWals stoppable
+	for walFile := range h.dm.ListOSTWals(start) {
+		if err != nil || (limit > 0 && len(wals) >= limit) {
+			continue
+		}
+		if walFile.Err != nil {
+			err = walFile.Err
+			continue
+		}
+		if walFile.WalSequence <= start {
+			continue
+		}
+
+		var actions []*datamanager.Action
+		actions, err = h.dm.ReadWalActions(walFile.WalSequence)
+		if err != nil {
+			continue
+		}
+		for _, action := range actions {
+			action.Data = nil
+		}
+		wals = append(wals, &Wal{
+			WalSequence: walFile.WalSequence,
+			Actions:     actions,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return wals, nil
+}
+
+type ObjectHistoryEntry struct {
+	WalSequence string
+	ActionType  datamanager.ActionType
+	Data        []byte
+}
+
+type ObjectHistory struct {
+	Entries []*ObjectHistoryEntry
+	// NextStart is the wal sequence to provide as start to continue reading
+	// the next wals. It's empty when all the wals have been read.
+	NextStart string
+}
+
+func validateHistoryDataType(dataType string) error {
+	switch types.ConfigType(dataType) {
+	case types.ConfigTypeUser,
+		types.ConfigTypeOrg,
+		types.ConfigTypeOrgMember,
+		types.ConfigTypeProjectGroup,
+		types.ConfigTypeProject,
+		types.ConfigTypeRemoteSource,
+		types.ConfigTypeSecret,
+		types.ConfigTypeVariable:
+		return nil
+	}
+	return util.NewErrBadRequest(errors.Errorf("unknown data type %q", dataType))
+}
+
+// GetObjectHistory returns the changes of an object found in the wals
+// committed to the objectstorage starting after the provided wal sequence.
+// Since every wal must be read, at most limit wals are read for every call.
+func (h *ActionHandler) GetObjectHistory(ctx context.Context, dataType, id, start string, limit int) (*ObjectHistory, error) {
+	if err := validateHistoryDataType(dataType); err != nil {
+		return nil, err
+	}
+
+	history := &ObjectHistory{Entries: []*ObjectHistoryEntry{}}
+	read := 0
+	var lastWalSequence string
+	var err error
+	// consume all the channel to not leave the listing goroutine blocked
+	for walFile := range h.dm.ListOSTWals(start) {
+		if err != nil || history.NextStart != "" {
+			continue
+		}
+		if walFile.Err != nil {
+			err = walFile.Err
+			continue
+		}
+		if walFile.WalSequence <= start {
+			continue
+		}
+		if limit > 0 && read >= limit {
+			// there're other wals to read
+			history.NextStart = lastWalSequence
+			continue
+		}
+		read++
+		lastWalSequence = walFile.WalSequence
+
+		var actions []*datamanager.Action
+		actions, err = h.dm.ReadWalActions(walFile.WalSequence)
+		if err != nil {
+			continue
+		}
+		for _, action := range actions {
+			if action.DataType != dataType || action.ID != id {
+				continue
+			}
+			history.Entries = append(history.Entries, &ObjectHistoryEntry{
+				WalSequence: walFile.WalSequence,
+				ActionType:  action.ActionType,
+				Data:        action.Data,
+			})
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+type RestoreObjectRequest struct {
+	DataType    string
+	ID          string
+	WalSequence string
+}
+
+// RestoreObject restores an existing object to the state it had in the
+// provided wal. The restored object goes through the same validations of an
+// update so only the object types that can be updated are supported.
+func (h *ActionHandler) RestoreObject(ctx context.Context, req *RestoreObjectRequest) (interface{}, error) {
+	if err := validateHistoryDataType(req.DataType); err != nil {
+		return nil, err
+	}
+
+	ok, err := h.dm.HasOSTWal(req.WalSequence)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, util.NewErrBadRequest(errors.Errorf("wal %q doesn't exist", req.WalSequence))
+	}
+	actions, err := h.dm.ReadWalActions(req.WalSequence)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	for _, action := range actions {
+		if action.DataType != req.DataType || action.ID != req.ID {
+			continue
+		}
+		if action.ActionType != datamanager.ActionTypePut {
+			return nil, util.NewErrBadRequest(errors.Errorf("%s %q was deleted in wal %q", req.DataType, req.ID, req.WalSequence))
+		}
+		data = action.Data
+	}
+	if data == nil {
+		return nil, util.NewErrBadRequest(errors.Errorf("%s %q wasn't changed in wal %q", req.DataType, req.ID, req.WalSequence))
+	}
+
+	switch types.ConfigType(req.DataType) {
+	case types.ConfigTypeProject:
+		var project *types.Project
+		if err := json.Unmarshal(data, &project); err != nil {
+			return nil, errors.Errorf("failed to unmarshal project: %w", err)
+		}
+		return h.UpdateProject(ctx, &UpdateProjectRequest{
+			ProjectRef: project.ID,
+			Project:    project,
+		})
+
+	case types.ConfigTypeSecret:
+		var secret *types.Secret
+		if err := json.Unmarshal(data, &secret); err != nil {
+			return nil, errors.Errorf("failed to unmarshal secret: %w", err)
+		}
+		curSecret, err := h.GetSecret(ctx, secret.ID)
+		if err != nil {
+			return nil, err
+		}
+		return h.UpdateSecret(ctx, &UpdateSecretRequest{
+			SecretName: curSecret.Name,
+			Secret:     secret,
+		})
+
+	default:
+		return nil, util.NewErrBadRequest(errors.Errorf("restore of data type %q isn't supported", req.DataType))
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"strings"
+	"time"
+
+	"agola.io/agola/internal/datamanager"
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	uuid "github.com/satori/go.uuid"
+	errors "golang.org/x/xerrors"
+)
+
+// PathAliasResolution is the ID and current path of an object referenced by a
+// path and the alias used to resolve it. Alias is nil when the path is the
+// object current path.
+type PathAliasResolution struct {
+	ID    string
+	Path  string
+	Alias *types.PathAlias
+}
+
+// pathAliasActions returns the actions saving the old path of a renamed object
+// as a path alias. An existing alias of the new path is removed since it would
+// be shadowed by the object.
+func (h *ActionHandler) pathAliasActions(tx *db.Tx, objectType types.ConfigType, objectID, oldPath, newPath string) ([]*datamanager.Action, error) {
+	pa, err := h.readDB.GetPathAliasByPath(tx, oldPath)
+	if err != nil {
+		return nil, err
+	}
+	if pa == nil {
+		pa = &types.PathAlias{ID: uuid.NewV4().String(), Path: oldPath}
+	}
+	pa.ObjectType = objectType
+	pa.ObjectID = objectID
+	pa.CreationTime = time.Now()
+
+	paj, err := json.Marshal(pa)
+	if err != nil {
+		return nil, errors.Errorf("failed to marshal path alias: %w", err)
+	}
+	actions := []*datamanager.Action{
+		{
+			ActionType: datamanager.ActionTypePut,
+			DataType:   string(types.ConfigTypePathAlias),
+			ID:         pa.ID,
+			Data:       paj,
+		},
+	}
+
+	shadowed, err := h.readDB.GetPathAliasByPath(tx, newPath)
+	if err != nil {
+		return nil, err
+	}
+	if shadowed != nil {
+		actions = append(actions, &datamanager.Action{
+			ActionType: datamanager.ActionTypeDelete,
+			DataType:   string(types.ConfigTypePathAlias),
+			ID:         shadowed.ID,
+		})
+	}
+
+	return actions, nil
+}
+
+// maxPathAliasHops is the max number of aliases followed to resolve a path
+const maxPathAliasHops = 10
+
+// ResolvePathAlias returns the ID and current path of the project or project
+// group referenced by a path. An old path is resolved using the alias of the
+// object or of one of its parent project groups, following the aliases of the
+// subsequent renames. An existing object with the provided path always takes
+// precedence over the aliases.
+func (h *ActionHandler) ResolvePathAlias(ctx context.Context, objectType types.ConfigType, objectPath string) (*PathAliasResolution, error) {
+	if objectType != types.ConfigTypeProject && objectType != types.ConfigTypeProjectGroup {
+		return nil, util.NewErrBadRequest(errors.Errorf("invalid object type %q", objectType))
+	}
+
+	var res *PathAliasResolution
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		curPath := objectPath
+		var firstAlias *types.PathAlias
+		for i := 0; i < maxPathAliasHops; i++ {
+			id, err := h.objectIDByPath(tx, objectType, curPath)
+			if err != nil {
+				return err
+			}
+			if id != "" {
+				res = &PathAliasResolution{ID: id, Path: curPath, Alias: firstAlias}
+				return nil
+			}
+
+			newPath, pa, err := h.resolvePathAliasHop(tx, objectType, curPath)
+			if err != nil {
+				return err
+			}
+			if pa == nil {
+				return nil
+			}
+			if firstAlias == nil {
+				firstAlias = pa
+			}
+			curPath = newPath
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, util.NewErrNotFound(errors.Errorf("no alias for %s path %q", objectType, objectPath))
+	}
+
+	return res, nil
+}
+
+// resolvePathAliasHop replaces the longest prefix of the provided path having
+// an alias with the current path of the aliased object. It returns a nil alias
+// when no prefix can be resolved.
+func (h *ActionHandler) resolvePathAliasHop(tx *db.Tx, objectType types.ConfigType, objectPath string) (string, *types.PathAlias, error) {
+	// the aliases are at least three elements long (org/org01/project01)
+	for prefix := objectPath; strings.Count(prefix, "/") >= 2; prefix = path.Dir(prefix) {
+		pa, err := h.readDB.GetPathAliasByPath(tx, prefix)
+		if err != nil {
+			return "", nil, err
+		}
+		if pa == nil {
+			continue
+		}
+		// a parent alias must be a project group alias
+		if prefix != objectPath && pa.ObjectType != types.ConfigTypeProjectGroup {
+			continue
+		}
+		if prefix == objectPath && pa.ObjectType != objectType {
+			continue
+		}
+
+		curPath, err := h.objectPath(tx, pa.ObjectType, pa.ObjectID)
+		if err != nil {
+			return "", nil, err
+		}
+		if curPath == "" {
+			// the object doesn't exist anymore
+			continue
+		}
+		return curPath + strings.TrimPrefix(objectPath, prefix), pa, nil
+	}
+	return "", nil, nil
+}
+
+// objectIDByPath returns the ID of the project or project group with the
+// provided path, empty when it doesn't exist
+func (h *ActionHandler) objectIDByPath(tx *db.Tx, objectType types.ConfigType, objectPath string) (string, error) {
+	switch objectType {
+	case types.ConfigTypeProject:
+		p, err := h.readDB.GetProjectByPath(tx, objectPath)
+		if err != nil || p == nil {
+			return "", err
+		}
+		return p.ID, nil
+	case types.ConfigTypeProjectGroup:
+		pg, err := h.readDB.GetProjectGroupByPath(tx, objectPath)
+		if err != nil || pg == nil {
+			return "", err
+		}
+		return pg.ID, nil
+	}
+	return "", nil
+}
+
+// objectPath returns the current path of the project or project group, empty
+// when it doesn't exist
+func (h *ActionHandler) objectPath(tx *db.Tx, objectType types.ConfigType, objectID string) (string, error) {
+	switch objectType {
+	case types.ConfigTypeProject:
+		p, err := h.readDB.GetProjectByID(tx, objectID)
+		if err != nil || p == nil {
+			return "", err
+		}
+		return h.readDB.GetProjectPath(tx, p)
+	case types.ConfigTypeProjectGroup:
+		pg, err := h.readDB.GetProjectGroupByID(tx, objectID)
+		if err != nil || pg == nil {
+			return "", err
+		}
+		return h.readDB.GetProjectGroupPath(tx, pg)
+	}
+	return "", nil
+}
+
+func (h *ActionHandler) GetProjectPathAliases(ctx context.Context, projectRef string) ([]*types.PathAlias, error) {
+	var pas []*types.PathAlias
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		project, err := h.readDB.GetProject(tx, projectRef)
+		if err != nil {
+			return err
+		}
+		if project == nil {
+			return util.NewErrNotFound(errors.Errorf("project %q doesn't exist", projectRef))
+		}
+
+		pas, err = h.readDB.GetObjectPathAliases(tx, project.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pas, nil
+}
+
+func (h *ActionHandler) GetProjectGroupPathAliases(ctx context.Context, projectGroupRef string) ([]*types.PathAlias, error) {
+	var pas []*types.PathAlias
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		projectGroup, err := h.readDB.GetProjectGroup(tx, projectGroupRef)
+		if err != nil {
+			return err
+		}
+		if projectGroup == nil {
+			return util.NewErrNotFound(errors.Errorf("project group %q doesn't exist", projectGroupRef))
+		}
+
+		pas, err = h.readDB.GetObjectPathAliases(tx, projectGroup.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pas, nil
+}
@@ -18,7 +18,9 @@ import (
 	"context"
 	"encoding/json"
 	"path"
+	"regexp"
 
+	"agola.io/agola/internal/common"
 	"agola.io/agola/internal/datamanager"
 	"agola.io/agola/internal/db"
 	"agola.io/agola/internal/services/types"
@@ -61,6 +63,34 @@ func (h *ActionHandler) ValidateProject(ctx context.Context, project *types.Proj
 			return util.NewErrBadRequest(errors.Errorf("empty remote repository path"))
 		}
 	}
+	if project.RunDefaults != nil {
+		if err := validateProjectRunDefaults(project.RunDefaults); err != nil {
+			return util.NewErrBadRequest(err)
+		}
+	}
+	return nil
+}
+
+func validateProjectRunDefaults(rd *types.ProjectRunDefaults) error {
+	if rd.TaskTimeout < 0 {
+		return errors.Errorf("negative task timeout")
+	}
+	if rd.MaxTasks < 0 {
+		return errors.Errorf("negative max tasks")
+	}
+	if rd.ArtifactsRetention < 0 {
+		return errors.Errorf("negative artifacts retention")
+	}
+	for _, expr := range rd.AllowedImages {
+		if _, err := regexp.Compile(expr); err != nil {
+			return errors.Errorf("wrong allowed image regular expression %q: %w", expr, err)
+		}
+	}
+	for _, arch := range rd.AllowedArchs {
+		if !common.IsValidArch(common.Arch(arch)) {
+			return errors.Errorf("invalid allowed arch %q", arch)
+		}
+	}
 	return nil
 }
 
@@ -165,6 +195,7 @@ func (h *ActionHandler) UpdateProject(ctx context.Context, req *UpdateProjectReq
 	}
 
 	var cgt *datamanager.ChangeGroupsUpdateToken
+	var aliasActions []*datamanager.Action
 
 	// must do all the checks in a single transaction to avoid concurrent changes
 	err := h.readDB.Do(func(tx *db.Tx) error {
@@ -212,6 +243,12 @@ func (h *ActionHandler) UpdateProject(ctx context.Context, req *UpdateProjectReq
 			if ap != nil {
 				return util.NewErrBadRequest(errors.Errorf("project with name %q, path %q already exists", req.Project.Name,pp))
 			}
+
+			// keep the old path as an alias
+			aliasActions, err = h.pathAliasActions(tx, types.ConfigTypeProject, p.ID, path.Join(groupPath, p.Name), pp)
+			if err != nil {
+				return err
+			}
 		}
 
 		// changegroup is the project path. Use "projectpath" prefix as it must
@@ -258,51 +295,14 @@ func (h *ActionHandler) UpdateProject(ctx context.Context, req *UpdateProjectReq
 			Data:       pcj,
 		},
 	}
+	actions = append(actions, aliasActions...)
 
 	_, err = h.dm.WriteWal(ctx, actions, cgt)
 	return req.Project, err
 }
 
+// DeleteProject deletes the project with its secrets and variables, moving
+// them to the trash when enabled
 func (h *ActionHandler) DeleteProject(ctx context.Context, projectRef string) error {
-	var project *types.Project
-
-	var cgt *datamanager.ChangeGroupsUpdateToken
-
-	// must do all the checks in a single transaction to avoid concurrent changes
-	err := h.readDB.Do(func(tx *db.Tx) error {
-		var err error
-
-		// check project existance
-		project, err = h.readDB.GetProject(tx, projectRef)
-		if err != nil {
-			return err
-		}
-		if project == nil {
-			return util.NewErrBadRequest(errors.Errorf("project %q doesn't exist", projectRef))
-		}
-
-		// changegroup is the project id.
-		cgNames := []string{util.EncodeSha256Hex(project.ID)}
-		cgt, err = h.readDB.GetChangeGroupsUpdateTokens(tx, cgNames)
-		if err != nil {
-			return err
-		}
-
-		return nil
-	})
-	if err != nil {
-		return err
-	}
-
-	// TODO(sgotti) implement childs garbage collection
-	actions := []*datamanager.Action{
-		{
-			ActionType: datamanager.ActionTypeDelete,
-			DataType:   string(types.ConfigTypeProject),
-			ID:         project.ID,
-		},
-	}
-
-	_, err = h.dm.WriteWal(ctx, actions, cgt)
-	return err
+	return h.deleteObject(ctx, types.ConfigTypeProject, projectRef)
 }
@@ -0,0 +1,151 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"agola.io/agola/internal/datamanager"
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	uuid "github.com/satori/go.uuid"
+	errors "golang.org/x/xerrors"
+)
+
+func (h *ActionHandler) ValidateProjectChange(ctx context.Context, pc *types.ProjectChange) error {
+	switch pc.Action {
+	case types.ProjectChangeActionCreate,
+		types.ProjectChangeActionUpdate,
+		types.ProjectChangeActionDelete,
+		types.ProjectChangeActionRollback:
+	default:
+		return util.NewErrBadRequest(errors.Errorf("invalid project change action %q", pc.Action))
+	}
+	switch pc.ObjectType {
+	case types.ConfigTypeProject,
+		types.ConfigTypeVariable,
+		types.ConfigTypeSecret:
+	default:
+		return util.NewErrBadRequest(errors.Errorf("invalid project change object type %q", pc.ObjectType))
+	}
+	if pc.ObjectID == "" && pc.ObjectName == "" {
+		return util.NewErrBadRequest(errors.Errorf("project change object id or name required"))
+	}
+	if pc.Action != types.ProjectChangeActionDelete && len(pc.Data) == 0 {
+		return util.NewErrBadRequest(errors.Errorf("project change data required"))
+	}
+
+	return nil
+}
+
+func (h *ActionHandler) GetProjectChanges(ctx context.Context, projectRef string, limit int) ([]*types.ProjectChange, error) {
+	var pcs []*types.ProjectChange
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		project, err := h.readDB.GetProject(tx, projectRef)
+		if err != nil {
+			return err
+		}
+		if project == nil {
+			return util.NewErrNotFound(errors.Errorf("project %q doesn't exist", projectRef))
+		}
+
+		pcs, err = h.readDB.GetProjectChanges(tx, project.ID, limit)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pcs, nil
+}
+
+func (h *ActionHandler) GetProjectChange(ctx context.Context, projectRef, projectChangeID string) (*types.ProjectChange, error) {
+	var pc *types.ProjectChange
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		project, err := h.readDB.GetProject(tx, projectRef)
+		if err != nil {
+			return err
+		}
+		if project == nil {
+			return util.NewErrNotFound(errors.Errorf("project %q doesn't exist", projectRef))
+		}
+
+		pc, err = h.readDB.GetProjectChange(tx, project.ID, projectChangeID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if pc == nil {
+		return nil, util.NewErrNotFound(errors.Errorf("project change %q doesn't exist", projectChangeID))
+	}
+
+	return pc, nil
+}
+
+func (h *ActionHandler) CreateProjectChange(ctx context.Context, projectRef string, pc *types.ProjectChange) (*types.ProjectChange, error) {
+	if err := h.ValidateProjectChange(ctx, pc); err != nil {
+		return nil, err
+	}
+
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		project, err := h.readDB.GetProject(tx, projectRef)
+		if err != nil {
+			return err
+		}
+		if project == nil {
+			return util.NewErrBadRequest(errors.Errorf("project %q doesn't exist", projectRef))
+		}
+		pc.ProjectID = project.ID
+
+		if pc.RollbackFrom != "" {
+			rpc, err := h.readDB.GetProjectChange(tx, project.ID, pc.RollbackFrom)
+			if err != nil {
+				return err
+			}
+			if rpc == nil {
+				return util.NewErrBadRequest(errors.Errorf("project change %q doesn't exist", pc.RollbackFrom))
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pc.ID = uuid.NewV4().String()
+	pc.ChangeTime = time.Now()
+
+	pcj, err := json.Marshal(pc)
+	if err != nil {
+		return nil, errors.Errorf("failed to marshal project change: %w", err)
+	}
+	actions := []*datamanager.Action{
+		{
+			ActionType: datamanager.ActionTypePut,
+			DataType:   string(types.ConfigTypeProjectChange),
+			ID:         pc.ID,
+			Data:       pcj,
+		},
+	}
+
+	_, err = h.dm.WriteWal(ctx, actions, nil)
+	return pc, err
+}
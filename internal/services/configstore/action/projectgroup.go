@@ -100,6 +100,16 @@ func (h *ActionHandler) ValidateProjectGroup(ctx context.Context, projectGroup *
 	if !types.IsValidVisibility(projectGroup.Visibility) {
 		return util.NewErrBadRequest(errors.Errorf("invalid project group visibility"))
 	}
+	if s := projectGroup.Settings; s != nil {
+		if s.DefaultVisibility != "" && !types.IsValidVisibility(s.DefaultVisibility) {
+			return util.NewErrBadRequest(errors.Errorf("invalid project group default visibility"))
+		}
+		if s.RunDefaults != nil {
+			if err := validateProjectRunDefaults(s.RunDefaults); err != nil {
+				return util.NewErrBadRequest(errors.Errorf("invalid project group run defaults: %w", err))
+			}
+		}
+	}
 
 	return nil
 }
@@ -182,6 +192,7 @@ func (h *ActionHandler) UpdateProjectGroup(ctx context.Context, req *UpdateProje
 	}
 
 	var cgt *datamanager.ChangeGroupsUpdateToken
+	var aliasActions []*datamanager.Action
 
 	// must do all the checks in a single transaction to avoid concurrent changes
 	err := h.readDB.Do(func(tx *db.Tx) error {
@@ -241,6 +252,12 @@ func (h *ActionHandler) UpdateProjectGroup(ctx context.Context, req *UpdateProje
 			if ap != nil {
 				return util.NewErrBadRequest(errors.Errorf("project group with name %q, path %q already exists", req.ProjectGroup.Name, pgp))
 			}
+
+			// keep the old path as an alias
+			aliasActions, err = h.pathAliasActions(tx, types.ConfigTypeProjectGroup, pg.ID, pgPath, pgp)
+			if err != nil {
+				return err
+			}
 		}
 
 		// changegroup is the project group path. Use "projectpath" prefix as it must
@@ -269,51 +286,14 @@ func (h *ActionHandler) UpdateProjectGroup(ctx context.Context, req *UpdateProje
 			Data:       pgj,
 		},
 	}
+	actions = append(actions, aliasActions...)
 
 	_, err = h.dm.WriteWal(ctx, actions, cgt)
 	return req.ProjectGroup, err
 }
 
+// DeleteProjectGroup deletes the project group with all its subgroups,
+// projects, secrets and variables, moving them to the trash when enabled
 func (h *ActionHandler) DeleteProjectGroup(ctx context.Context, projectGroupRef string) error {
-	var projectGroup *types.ProjectGroup
-
-	var cgt *datamanager.ChangeGroupsUpdateToken
-
-	// must do all the checks in a single transaction to avoid concurrent changes
-	err := h.readDB.Do(func(tx *db.Tx) error {
-		var err error
-
-		// check project group existance
-		projectGroup, err = h.readDB.GetProjectGroup(tx, projectGroupRef)
-		if err != nil {
-			return err
-		}
-		if projectGroup == nil {
-			return util.NewErrBadRequest(errors.Errorf("project group %q doesn't exist", projectGroupRef))
-		}
-
-		// changegroup is the project group id.
-		cgNames := []string{util.EncodeSha256Hex(projectGroup.ID)}
-		cgt, err = h.readDB.GetChangeGroupsUpdateTokens(tx, cgNames)
-		if err != nil {
-			return err
-		}
-
-		return nil
-	})
-	if err != nil {
-		return err
-	}
-
-	// TODO(sgotti) implement childs garbage collection
-	actions := []*datamanager.Action{
-		{
-			ActionType: datamanager.ActionTypeDelete,
-			DataType:   string(types.ConfigTypeProjectGroup),
-			ID:         projectGroup.ID,
-		},
-	}
-
-	_, err = h.dm.WriteWal(ctx, actions, cgt)
-	return err
+	return h.deleteObject(ctx, types.ConfigTypeProjectGroup, projectGroupRef)
 }
@@ -0,0 +1,120 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"time"
+
+	"agola.io/agola/internal/datamanager"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	// MaxTOTPFailedAttempts is the number of consecutive invalid codes after
+	// which the user codes are rejected for TOTPLockoutDuration
+	MaxTOTPFailedAttempts = 5
+	TOTPLockoutDuration   = 5 * time.Minute
+)
+
+// errTOTPLocked is used to not save the user when its codes are locked
+var errTOTPLocked = errors.New("totp locked")
+
+type CheckUserTOTPCodeRequest struct {
+	UserRef string
+	Code    string
+	// Enable enables the enrolled two factor authentication when the code is
+	// valid
+	Enable bool
+}
+
+type CheckUserTOTPCodeResponse struct {
+	Valid bool
+	// LockedUntil is set when the codes are rejected after too many invalid
+	// codes
+	LockedUntil *time.Time
+}
+
+// CheckUserTOTPCode checks the user TOTP code. The time step of an accepted
+// code is saved so the same code cannot be used again. After
+// MaxTOTPFailedAttempts consecutive invalid codes all the codes are rejected
+// for TOTPLockoutDuration.
+func (h *ActionHandler) CheckUserTOTPCode(ctx context.Context, req *CheckUserTOTPCodeRequest) (*CheckUserTOTPCodeResponse, error) {
+	now := time.Now()
+	res := &CheckUserTOTPCodeResponse{}
+
+	err := h.updateUser(ctx, req.UserRef, func(user *types.User) error {
+		totp := user.TOTP
+		if totp == nil {
+			return util.NewErrBadRequest(errors.Errorf("two factor authentication enrollment not started"))
+		}
+		if req.Enable && totp.Enabled {
+			return util.NewErrBadRequest(errors.Errorf("two factor authentication already enabled"))
+		}
+		if !req.Enable && !totp.Enabled {
+			return util.NewErrBadRequest(errors.Errorf("two factor authentication not enabled"))
+		}
+
+		if totp.LockedUntil != nil && now.Before(*totp.LockedUntil) {
+			res.LockedUntil = totp.LockedUntil
+			return errTOTPLocked
+		}
+		totp.LockedUntil = nil
+
+		step, valid, err := util.ValidateTOTPCode(totp.Secret, req.Code, now)
+		if err != nil {
+			return err
+		}
+		// reject an already used code
+		if valid && step <= totp.LastUsedStep {
+			valid = false
+		}
+
+		if !valid {
+			totp.FailedAttempts++
+			if totp.FailedAttempts >= MaxTOTPFailedAttempts {
+				lockedUntil := now.Add(TOTPLockoutDuration)
+				totp.LockedUntil = &lockedUntil
+				totp.FailedAttempts = 0
+				res.LockedUntil = &lockedUntil
+			}
+			return nil
+		}
+
+		res.Valid = true
+		totp.LastUsedStep = step
+		totp.FailedAttempts = 0
+		if req.Enable {
+			totp.Enabled = true
+		}
+		return nil
+	})
+	if errors.Is(err, errTOTPLocked) {
+		return res, nil
+	}
+	// a concurrent check of a code of the same user changed it, reject the
+	// code since it may be the same code used concurrently
+	if errors.Is(err, datamanager.ErrConcurrency) {
+		return &CheckUserTOTPCodeResponse{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
@@ -0,0 +1,412 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"strings"
+	"time"
+
+	"agola.io/agola/internal/datamanager"
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	uuid "github.com/satori/go.uuid"
+	errors "golang.org/x/xerrors"
+)
+
+// deleteObject deletes the project or project group and all its childs. When
+// the trash is enabled they're saved in a trash item and can be restored until
+// it's purged.
+func (h *ActionHandler) deleteObject(ctx context.Context, objectType types.ConfigType, objectRef string) error {
+	var ti *types.TrashItem
+
+	var cgt *datamanager.ChangeGroupsUpdateToken
+
+	// must do all the checks in a single transaction to avoid concurrent changes
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		var err error
+		ti, err = h.collectTrashItem(tx, objectType, objectRef)
+		if err != nil {
+			return err
+		}
+
+		// changegroup is the object id.
+		cgNames := []string{util.EncodeSha256Hex(ti.ObjectID)}
+		cgt, err = h.readDB.GetChangeGroupsUpdateTokens(tx, cgNames)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	actions := []*datamanager.Action{}
+	for _, pg := range ti.ProjectGroups {
+		actions = append(actions, &datamanager.Action{ActionType: datamanager.ActionTypeDelete, DataType: string(types.ConfigTypeProjectGroup), ID: pg.ID})
+	}
+	for _, p := range ti.Projects {
+		actions = append(actions, &datamanager.Action{ActionType: datamanager.ActionTypeDelete, DataType: string(types.ConfigTypeProject), ID: p.ID})
+	}
+	for _, s := range ti.Secrets {
+		actions = append(actions, &datamanager.Action{ActionType: datamanager.ActionTypeDelete, DataType: string(types.ConfigTypeSecret), ID: s.ID})
+	}
+	for _, v := range ti.Variables {
+		actions = append(actions, &datamanager.Action{ActionType: datamanager.ActionTypeDelete, DataType: string(types.ConfigTypeVariable), ID: v.ID})
+	}
+
+	if h.trashRetention > 0 {
+		ti.ID = uuid.NewV4().String()
+		ti.DeletionTime = time.Now()
+
+		tij, err := json.Marshal(ti)
+		if err != nil {
+			return errors.Errorf("failed to marshal trash item: %w", err)
+		}
+		actions = append(actions, &datamanager.Action{
+			ActionType: datamanager.ActionTypePut,
+			DataType:   string(types.ConfigTypeTrashItem),
+			ID:         ti.ID,
+			Data:       tij,
+		})
+	}
+
+	_, err = h.dm.WriteWal(ctx, actions, cgt)
+	return err
+}
+
+// collectTrashItem returns a trash item containing the project or project
+// group and all its childs
+func (h *ActionHandler) collectTrashItem(tx *db.Tx, objectType types.ConfigType, objectRef string) (*types.TrashItem, error) {
+	ti := &types.TrashItem{ObjectType: objectType}
+
+	switch objectType {
+	case types.ConfigTypeProject:
+		project, err := h.readDB.GetProject(tx, objectRef)
+		if err != nil {
+			return nil, err
+		}
+		if project == nil {
+			return nil, util.NewErrBadRequest(errors.Errorf("project %q doesn't exist", objectRef))
+		}
+		ti.ObjectID = project.ID
+		if ti.Path, err = h.readDB.GetProjectPath(tx, project); err != nil {
+			return nil, err
+		}
+		if ti.OwnerType, ti.OwnerID, err = h.readDB.GetProjectOwnerID(tx, project); err != nil {
+			return nil, err
+		}
+		if err := h.collectProject(tx, ti, project); err != nil {
+			return nil, err
+		}
+
+	case types.ConfigTypeProjectGroup:
+		projectGroup, err := h.readDB.GetProjectGroup(tx, objectRef)
+		if err != nil {
+			return nil, err
+		}
+		if projectGroup == nil {
+			return nil, util.NewErrBadRequest(errors.Errorf("project group %q doesn't exist", objectRef))
+		}
+		ti.ObjectID = projectGroup.ID
+		if ti.Path, err = h.readDB.GetProjectGroupPath(tx, projectGroup); err != nil {
+			return nil, err
+		}
+		if ti.OwnerType, ti.OwnerID, err = h.readDB.GetProjectGroupOwnerID(tx, projectGroup); err != nil {
+			return nil, err
+		}
+		if err := h.collectProjectGroup(tx, ti, projectGroup); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, errors.Errorf("unsupported object type %q", objectType)
+	}
+
+	return ti, nil
+}
+
+func (h *ActionHandler) collectProject(tx *db.Tx, ti *types.TrashItem, project *types.Project) error {
+	ti.Projects = append(ti.Projects, project)
+	return h.collectSecretsAndVariables(tx, ti, project.ID)
+}
+
+func (h *ActionHandler) collectProjectGroup(tx *db.Tx, ti *types.TrashItem, projectGroup *types.ProjectGroup) error {
+	ti.ProjectGroups = append(ti.ProjectGroups, projectGroup)
+	if err := h.collectSecretsAndVariables(tx, ti, projectGroup.ID); err != nil {
+		return err
+	}
+
+	projects, err := h.readDB.GetProjectGroupProjects(tx, projectGroup.ID)
+	if err != nil {
+		return err
+	}
+	for _, project := range projects {
+		if err := h.collectProject(tx, ti, project); err != nil {
+			return err
+		}
+	}
+
+	subgroups, err := h.readDB.GetProjectGroupSubgroups(tx, projectGroup.ID)
+	if err != nil {
+		return err
+	}
+	for _, subgroup := range subgroups {
+		if err := h.collectProjectGroup(tx, ti, subgroup); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (h *ActionHandler) collectSecretsAndVariables(tx *db.Tx, ti *types.TrashItem, parentID string) error {
+	secrets, err := h.readDB.GetSecrets(tx, parentID)
+	if err != nil {
+		return err
+	}
+	ti.Secrets = append(ti.Secrets, secrets...)
+
+	variables, err := h.readDB.GetVariables(tx, parentID)
+	if err != nil {
+		return err
+	}
+	ti.Variables = append(ti.Variables, variables...)
+
+	return nil
+}
+
+func (h *ActionHandler) GetTrashItem(ctx context.Context, trashItemID string) (*types.TrashItem, error) {
+	var ti *types.TrashItem
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		var err error
+		ti, err = h.readDB.GetTrashItem(tx, trashItemID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if ti == nil {
+		return nil, util.NewErrNotFound(errors.Errorf("trash item %q doesn't exist", trashItemID))
+	}
+
+	return ti, nil
+}
+
+// GetProjectGroupTrashItems returns the trash items of the objects deleted
+// inside the project group, from the newest to the oldest
+func (h *ActionHandler) GetProjectGroupTrashItems(ctx context.Context, projectGroupRef string) ([]*types.TrashItem, error) {
+	var tis []*types.TrashItem
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		projectGroup, err := h.readDB.GetProjectGroup(tx, projectGroupRef)
+		if err != nil {
+			return err
+		}
+		if projectGroup == nil {
+			return util.NewErrNotFound(errors.Errorf("project group %q doesn't exist", projectGroupRef))
+		}
+		pgPath, err := h.readDB.GetProjectGroupPath(tx, projectGroup)
+		if err != nil {
+			return err
+		}
+		_, ownerID, err := h.readDB.GetProjectGroupOwnerID(tx, projectGroup)
+		if err != nil {
+			return err
+		}
+
+		ownerTis, err := h.readDB.GetTrashItems(tx, ownerID)
+		if err != nil {
+			return err
+		}
+		for _, ti := range ownerTis {
+			if strings.HasPrefix(ti.Path, pgPath+"/") {
+				tis = append(tis, ti)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tis, nil
+}
+
+// RestoreTrashItem restores the objects of the trash item. The parent project
+// group of the deleted object must still exist and mustn't contain another
+// object with the same name.
+func (h *ActionHandler) RestoreTrashItem(ctx context.Context, trashItemID string) (*types.TrashItem, error) {
+	var ti *types.TrashItem
+
+	var cgt *datamanager.ChangeGroupsUpdateToken
+
+	// must do all the checks in a single transaction to avoid concurrent changes
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		var err error
+		ti, err = h.readDB.GetTrashItem(tx, trashItemID)
+		if err != nil {
+			return err
+		}
+		if ti == nil {
+			return util.NewErrNotFound(errors.Errorf("trash item %q doesn't exist", trashItemID))
+		}
+
+		var parentID, name string
+		switch ti.ObjectType {
+		case types.ConfigTypeProject:
+			parentID, name = ti.Projects[0].Parent.ID, ti.Projects[0].Name
+		case types.ConfigTypeProjectGroup:
+			parentID, name = ti.ProjectGroups[0].Parent.ID, ti.ProjectGroups[0].Name
+		}
+
+		group, err := h.readDB.GetProjectGroup(tx, parentID)
+		if err != nil {
+			return err
+		}
+		if group == nil {
+			return util.NewErrBadRequest(errors.Errorf("parent project group of %q doesn't exist", ti.Path))
+		}
+		groupPath, err := h.readDB.GetProjectGroupPath(tx, group)
+		if err != nil {
+			return err
+		}
+		pp := path.Join(groupPath, name)
+
+		// changegroups are the object path, since the parent project group
+		// could have been moved, and the trash item id
+		cgNames := []string{util.EncodeSha256Hex("projectpath-" + pp), util.EncodeSha256Hex(ti.ID)}
+		cgt, err = h.readDB.GetChangeGroupsUpdateTokens(tx, cgNames)
+		if err != nil {
+			return err
+		}
+
+		// check duplicate name
+		switch ti.ObjectType {
+		case types.ConfigTypeProject:
+			p, err := h.readDB.GetProjectByName(tx, parentID, name)
+			if err != nil {
+				return err
+			}
+			if p != nil {
+				return util.NewErrBadRequest(errors.Errorf("project with name %q, path %q already exists", name, pp))
+			}
+		case types.ConfigTypeProjectGroup:
+			pg, err := h.readDB.GetProjectGroupByName(tx, parentID, name)
+			if err != nil {
+				return err
+			}
+			if pg != nil {
+				return util.NewErrBadRequest(errors.Errorf("project group with name %q, path %q already exists", name, pp))
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	actions := []*datamanager.Action{}
+	put := func(dataType types.ConfigType, id string, obj interface{}) error {
+		data, err := json.Marshal(obj)
+		if err != nil {
+			return errors.Errorf("failed to marshal %s: %w", dataType, err)
+		}
+		actions = append(actions, &datamanager.Action{ActionType: datamanager.ActionTypePut, DataType: string(dataType), ID: id, Data: data})
+		return nil
+	}
+	for _, pg := range ti.ProjectGroups {
+		if err := put(types.ConfigTypeProjectGroup, pg.ID, pg); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range ti.Projects {
+		if err := put(types.ConfigTypeProject, p.ID, p); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range ti.Secrets {
+		if err := put(types.ConfigTypeSecret, s.ID, s); err != nil {
+			return nil, err
+		}
+	}
+	for _, v := range ti.Variables {
+		if err := put(types.ConfigTypeVariable, v.ID, v); err != nil {
+			return nil, err
+		}
+	}
+	actions = append(actions, &datamanager.Action{ActionType: datamanager.ActionTypeDelete, DataType: string(types.ConfigTypeTrashItem), ID: ti.ID})
+
+	_, err = h.dm.WriteWal(ctx, actions, cgt)
+	return ti, err
+}
+
+// GetExpiredTrashItems returns the trash items older than the trash
+// retention. They are purged by the gateway after cleaning up the remote
+// repositories of their projects.
+func (h *ActionHandler) GetExpiredTrashItems(ctx context.Context) ([]*types.TrashItem, error) {
+	var tis []*types.TrashItem
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		var err error
+		tis, err = h.readDB.GetExpiredTrashItems(tx, time.Now().Add(-h.trashRetention))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tis, nil
+}
+
+// PurgeTrashItem permanently removes a trash item
+func (h *ActionHandler) PurgeTrashItem(ctx context.Context, trashItemID string) error {
+	var cgt *datamanager.ChangeGroupsUpdateToken
+
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		ti, err := h.readDB.GetTrashItem(tx, trashItemID)
+		if err != nil {
+			return err
+		}
+		if ti == nil {
+			return util.NewErrNotFound(errors.Errorf("trash item %q doesn't exist", trashItemID))
+		}
+
+		// changegroup is the trash item id, a concurrent restore will make the
+		// purge fail
+		cgNames := []string{util.EncodeSha256Hex(trashItemID)}
+		cgt, err = h.readDB.GetChangeGroupsUpdateTokens(tx, cgNames)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	actions := []*datamanager.Action{
+		{
+			ActionType: datamanager.ActionTypeDelete,
+			DataType:   string(types.ConfigTypeTrashItem),
+			ID:         trashItemID,
+		},
+	}
+
+	_, err = h.dm.WriteWal(ctx, actions, cgt)
+	return err
+}
@@ -42,6 +42,9 @@ func (h *ActionHandler) CreateUser(ctx context.Context, req *CreateUserRequest)
 	if !util.ValidateName(req.UserName) {
 		return nil, util.NewErrBadRequest(errors.Errorf("invalid user name %q", req.UserName))
 	}
+	if h.isReservedUserName(req.UserName) {
+		return nil, util.NewErrBadRequest(errors.Errorf("user name %q is reserved", req.UserName))
+	}
 
 	var cgt *datamanager.ChangeGroupsUpdateToken
 	// changegroup is the username (and in future the email) to ensure no
@@ -153,6 +156,7 @@ func (h *ActionHandler) CreateUser(ctx context.Context, req *CreateUserRequest)
 
 func (h *ActionHandler) DeleteUser(ctx context.Context, userRef string) error {
 	var user *types.User
+	var notifications []*types.UserNotification
 
 	var cgt *datamanager.ChangeGroupsUpdateToken
 	// must do all the checks in a single transaction to avoid concurrent changes
@@ -168,6 +172,11 @@ func (h *ActionHandler) DeleteUser(ctx context.Context, userRef string) error {
 			return util.NewErrBadRequest(errors.Errorf("user %q doesn't exist", userRef))
 		}
 
+		notifications, err = h.readDB.GetUserNotifications(tx, user.ID, false, 0)
+		if err != nil {
+			return err
+		}
+
 		// changegroup is the userid
 		cgNames := []string{util.EncodeSha256Hex("userid-" + user.ID)}
 		cgt, err = h.readDB.GetChangeGroupsUpdateTokens(tx, cgNames)
@@ -188,6 +197,14 @@ func (h *ActionHandler) DeleteUser(ctx context.Context, userRef string) error {
 			ID:         user.ID,
 		},
 	}
+	// also remove the user inbox
+	for _, un := range notifications {
+		actions = append(actions, &datamanager.Action{
+			ActionType: datamanager.ActionTypeDelete,
+			DataType:   string(types.ConfigTypeUserNotification),
+			ID:         un.ID,
+		})
+	}
 
 	_, err = h.dm.WriteWal(ctx, actions, cgt)
 	return err
@@ -197,9 +214,20 @@ type UpdateUserRequest struct {
 	UserRef string
 
 	UserName string
+	// TOTP is updated only when not nil, an empty TOTP removes it
+	TOTP *types.UserTOTP
+	// EmailNotifications are updated only when not nil, empty email
+	// notifications remove them
+	EmailNotifications *types.UserEmailNotifications
+	// WatchedProjects are updated only when not nil
+	WatchedProjects *[]string
 }
 
 func (h *ActionHandler) UpdateUser(ctx context.Context, req *UpdateUserRequest) (*types.User, error) {
+	if req.UserName != "" && h.isReservedUserName(req.UserName) {
+		return nil, util.NewErrBadRequest(errors.Errorf("user name %q is reserved", req.UserName))
+	}
+
 	var cgt *datamanager.ChangeGroupsUpdateToken
 
 	cgNames := []string{}
@@ -235,6 +263,18 @@ func (h *ActionHandler) UpdateUser(ctx context.Context, req *UpdateUserRequest)
 			cgNames = append(cgNames, util.EncodeSha256Hex("username-"+req.UserName))
 		}
 
+		if req.WatchedProjects != nil {
+			for _, projectID := range *req.WatchedProjects {
+				project, err := h.readDB.GetProject(tx, projectID)
+				if err != nil {
+					return err
+				}
+				if project == nil {
+					return util.NewErrBadRequest(errors.Errorf("project %q doesn't exist", projectID))
+				}
+			}
+		}
+
 		return nil
 	})
 	if err != nil {
@@ -244,6 +284,21 @@ func (h *ActionHandler) UpdateUser(ctx context.Context, req *UpdateUserRequest)
 	if req.UserName != "" {
 		user.Name = req.UserName
 	}
+	if req.WatchedProjects != nil {
+		user.WatchedProjects = *req.WatchedProjects
+	}
+	if req.TOTP != nil {
+		user.TOTP = req.TOTP
+		if *req.TOTP == (types.UserTOTP{}) {
+			user.TOTP = nil
+		}
+	}
+	if req.EmailNotifications != nil {
+		user.EmailNotifications = req.EmailNotifications
+		if req.EmailNotifications.Email == "" {
+			user.EmailNotifications = nil
+		}
+	}
 
 	userj, err := json.Marshal(user)
 	if err != nil {
@@ -505,13 +560,31 @@ func (h *ActionHandler) UpdateUserLA(ctx context.Context, req *UpdateUserLAReque
 	return la, err
 }
 
-func (h *ActionHandler) CreateUserToken(ctx context.Context, userRef, tokenName string) (string, error) {
+type CreateUserTokenRequest struct {
+	UserRef   string
+	TokenName string
+
+	Scopes    []types.TokenScope
+	ExpiresAt time.Time
+}
+
+func (h *ActionHandler) CreateUserToken(ctx context.Context, req *CreateUserTokenRequest) (string, error) {
+	userRef := req.UserRef
+	tokenName := req.TokenName
 	if userRef == "" {
 		return "", util.NewErrBadRequest(errors.Errorf("user ref required"))
 	}
 	if tokenName == "" {
 		return "", util.NewErrBadRequest(errors.Errorf("token name required"))
 	}
+	for _, scope := range req.Scopes {
+		if !types.IsValidTokenScope(scope) {
+			return "", util.NewErrBadRequest(errors.Errorf("invalid token scope %q", scope))
+		}
+	}
+	if !req.ExpiresAt.IsZero() && !req.ExpiresAt.After(time.Now()) {
+		return "", util.NewErrBadRequest(errors.Errorf("token expiration must be in the future"))
+	}
 
 	var user *types.User
 
@@ -553,6 +626,15 @@ func (h *ActionHandler) CreateUserToken(ctx context.Context, userRef, tokenName
 	token := util.EncodeSha1Hex(uuid.NewV4().String())
 	user.Tokens[tokenName] = token
 
+	if user.TokensInfo == nil {
+		user.TokensInfo = make(map[string]*types.UserTokenInfo)
+	}
+	user.TokensInfo[tokenName] = &types.UserTokenInfo{
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+
 	userj, err := json.Marshal(user)
 	if err != nil {
 		return "", errors.Errorf("failed to marshal user: %w", err)
@@ -612,6 +694,7 @@ func (h *ActionHandler) DeleteUserToken(ctx context.Context, userRef, tokenName
 	}
 
 	delete(user.Tokens, tokenName)
+	delete(user.TokensInfo, tokenName)
 
 	userj, err := json.Marshal(user)
 	if err != nil {
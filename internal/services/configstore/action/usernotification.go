@@ -0,0 +1,184 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"agola.io/agola/internal/datamanager"
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	uuid "github.com/satori/go.uuid"
+	errors "golang.org/x/xerrors"
+)
+
+func (h *ActionHandler) ValidateUserNotification(ctx context.Context, un *types.UserNotification) error {
+	if !types.IsValidUserNotificationType(un.Type) {
+		return util.NewErrBadRequest(errors.Errorf("invalid user notification type %q", un.Type))
+	}
+	if un.Title == "" {
+		return util.NewErrBadRequest(errors.Errorf("user notification title required"))
+	}
+
+	return nil
+}
+
+func (h *ActionHandler) GetUserNotifications(ctx context.Context, userRef string, unreadOnly bool, limit int) ([]*types.UserNotification, error) {
+	var uns []*types.UserNotification
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		user, err := h.readDB.GetUser(tx, userRef)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return util.NewErrNotFound(errors.Errorf("user %q doesn't exist", userRef))
+		}
+
+		uns, err = h.readDB.GetUserNotifications(tx, user.ID, unreadOnly, limit)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return uns, nil
+}
+
+func (h *ActionHandler) GetUserNotificationsUnreadCount(ctx context.Context, userRef string) (int, error) {
+	var count int
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		user, err := h.readDB.GetUser(tx, userRef)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return util.NewErrNotFound(errors.Errorf("user %q doesn't exist", userRef))
+		}
+
+		count, err = h.readDB.GetUserNotificationsUnreadCount(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (h *ActionHandler) CreateUserNotification(ctx context.Context, userRef string, un *types.UserNotification) (*types.UserNotification, error) {
+	if err := h.ValidateUserNotification(ctx, un); err != nil {
+		return nil, err
+	}
+
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		user, err := h.readDB.GetUser(tx, userRef)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return util.NewErrBadRequest(errors.Errorf("user %q doesn't exist", userRef))
+		}
+		un.UserID = user.ID
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	un.ID = uuid.NewV4().String()
+	un.CreationTime = time.Now()
+	un.Read = false
+
+	unj, err := json.Marshal(un)
+	if err != nil {
+		return nil, errors.Errorf("failed to marshal user notification: %w", err)
+	}
+	actions := []*datamanager.Action{
+		{
+			ActionType: datamanager.ActionTypePut,
+			DataType:   string(types.ConfigTypeUserNotification),
+			ID:         un.ID,
+			Data:       unj,
+		},
+	}
+
+	_, err = h.dm.WriteWal(ctx, actions, nil)
+	return un, err
+}
+
+// MarkUserNotificationsRead marks the provided user notifications as read.
+// When no notification ids are provided all the unread notifications are
+// marked as read
+func (h *ActionHandler) MarkUserNotificationsRead(ctx context.Context, userRef string, userNotificationIDs []string) error {
+	var uns []*types.UserNotification
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		user, err := h.readDB.GetUser(tx, userRef)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return util.NewErrNotFound(errors.Errorf("user %q doesn't exist", userRef))
+		}
+
+		if len(userNotificationIDs) == 0 {
+			uns, err = h.readDB.GetUserNotifications(tx, user.ID, true, 0)
+			return err
+		}
+
+		for _, id := range userNotificationIDs {
+			un, err := h.readDB.GetUserNotification(tx, user.ID, id)
+			if err != nil {
+				return err
+			}
+			if un == nil {
+				return util.NewErrNotFound(errors.Errorf("user notification %q doesn't exist", id))
+			}
+			if !un.Read {
+				uns = append(uns, un)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(uns) == 0 {
+		return nil
+	}
+
+	actions := []*datamanager.Action{}
+	for _, un := range uns {
+		un.Read = true
+		unj, err := json.Marshal(un)
+		if err != nil {
+			return errors.Errorf("failed to marshal user notification: %w", err)
+		}
+		actions = append(actions, &datamanager.Action{
+			ActionType: datamanager.ActionTypePut,
+			DataType:   string(types.ConfigTypeUserNotification),
+			ID:         un.ID,
+			Data:       unj,
+		})
+	}
+
+	_, err = h.dm.WriteWal(ctx, actions, nil)
+	return err
+}
@@ -0,0 +1,194 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"agola.io/agola/internal/datamanager"
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	uuid "github.com/satori/go.uuid"
+	errors "golang.org/x/xerrors"
+)
+
+// updateUser fetches the user, calls fn to change it and saves it
+func (h *ActionHandler) updateUser(ctx context.Context, userRef string, fn func(user *types.User) error) error {
+	if userRef == "" {
+		return util.NewErrBadRequest(errors.Errorf("user ref required"))
+	}
+
+	var user *types.User
+
+	var cgt *datamanager.ChangeGroupsUpdateToken
+
+	// must do all the checks in a single transaction to avoid concurrent changes
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		var err error
+		user, err = h.readDB.GetUser(tx, userRef)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return util.NewErrBadRequest(errors.Errorf("user %q doesn't exist", userRef))
+		}
+
+		// changegroup is the userid
+		cgNames := []string{util.EncodeSha256Hex("userid-" + user.ID)}
+		cgt, err = h.readDB.GetChangeGroupsUpdateTokens(tx, cgNames)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := fn(user); err != nil {
+		return err
+	}
+
+	userj, err := json.Marshal(user)
+	if err != nil {
+		return errors.Errorf("failed to marshal user: %w", err)
+	}
+	actions := []*datamanager.Action{
+		{
+			ActionType: datamanager.ActionTypePut,
+			DataType:   string(types.ConfigTypeUser),
+			ID:         user.ID,
+			Data:       userj,
+		},
+	}
+
+	_, err = h.dm.WriteWal(ctx, actions, cgt)
+	return err
+}
+
+// CreateUserSession creates a new user login session valid until expiresAt
+// and returns its id. The expired sessions are removed.
+func (h *ActionHandler) CreateUserSession(ctx context.Context, userRef string, expiresAt time.Time) (string, error) {
+	now := time.Now()
+	if !expiresAt.After(now) {
+		return "", util.NewErrBadRequest(errors.Errorf("session expiration must be in the future"))
+	}
+
+	sessionID := uuid.NewV4().String()
+	err := h.updateUser(ctx, userRef, func(user *types.User) error {
+		for id, s := range user.Sessions {
+			if s.IsExpired(now) {
+				delete(user.Sessions, id)
+			}
+		}
+		if user.Sessions == nil {
+			user.Sessions = make(map[string]*types.UserSession)
+		}
+		user.Sessions[sessionID] = &types.UserSession{
+			CreatedAt: now,
+			ExpiresAt: expiresAt,
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return sessionID, nil
+}
+
+func (h *ActionHandler) DeleteUserSession(ctx context.Context, userRef, sessionID string) error {
+	if sessionID == "" {
+		return util.NewErrBadRequest(errors.Errorf("session id required"))
+	}
+
+	return h.updateUser(ctx, userRef, func(user *types.User) error {
+		if _, ok := user.Sessions[sessionID]; !ok {
+			return util.NewErrNotFound(errors.Errorf("session %q for user %q doesn't exist", sessionID, userRef))
+		}
+		delete(user.Sessions, sessionID)
+		return nil
+	})
+}
+
+// DeleteUserSessions removes all the user sessions and tokens
+func (h *ActionHandler) DeleteUserSessions(ctx context.Context, userRef string) error {
+	return h.updateUser(ctx, userRef, func(user *types.User) error {
+		user.Sessions = nil
+		user.Tokens = nil
+		user.TokensInfo = nil
+		return nil
+	})
+}
+
+type AccessUsage struct {
+	LastUsedAt time.Time
+	LastUsedIP string
+}
+
+type UpdateUserAccessUsageRequest struct {
+	UserRef string
+
+	// Sessions and Tokens are the access usages keyed by session id and token
+	// name
+	Sessions map[string]*AccessUsage
+	Tokens   map[string]*AccessUsage
+}
+
+// UpdateUserAccessUsage saves the last time and source address of the user
+// sessions and tokens. The usages are batched by the caller so the user is
+// updated once for many requests. Sessions and tokens removed in the meantime
+// are ignored and older usages don't overwrite the newer ones.
+func (h *ActionHandler) UpdateUserAccessUsage(ctx context.Context, req *UpdateUserAccessUsageRequest) error {
+	if len(req.Sessions) == 0 && len(req.Tokens) == 0 {
+		return util.NewErrBadRequest(errors.Errorf("at least one session or token usage must be provided"))
+	}
+
+	return h.updateUser(ctx, req.UserRef, func(user *types.User) error {
+		for sessionID, u := range req.Sessions {
+			s, ok := user.Sessions[sessionID]
+			if !ok || !u.LastUsedAt.After(s.LastUsedAt) {
+				continue
+			}
+			s.LastUsedAt = u.LastUsedAt
+			s.LastUsedIP = u.LastUsedIP
+		}
+
+		for tokenName, u := range req.Tokens {
+			if _, ok := user.Tokens[tokenName]; !ok {
+				continue
+			}
+			if user.TokensInfo == nil {
+				user.TokensInfo = make(map[string]*types.UserTokenInfo)
+			}
+			ti, ok := user.TokensInfo[tokenName]
+			if !ok {
+				ti = &types.UserTokenInfo{}
+				user.TokensInfo[tokenName] = ti
+			}
+			if !u.LastUsedAt.After(ti.LastUsedAt) {
+				continue
+			}
+			ti.LastUsedAt = u.LastUsedAt
+			ti.LastUsedIP = u.LastUsedIP
+		}
+		return nil
+	})
+}
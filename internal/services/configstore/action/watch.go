@@ -0,0 +1,47 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"time"
+
+	"agola.io/agola/internal/services/configstore/readdb"
+	"agola.io/agola/internal/services/types"
+)
+
+// WatchChanges returns the change events after the provided wal sequence with
+// one of the provided data types. When there're no events it waits for them
+// until the timeout expires. An empty afterSeq immediately returns the
+// current sequence to use to watch the next changes.
+func (h *ActionHandler) WatchChanges(ctx context.Context, afterSeq string, dataTypes []types.ConfigType, timeout time.Duration) *readdb.ChangeEvents {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		ce, notifyCh := h.readDB.GetChangeEvents(afterSeq, dataTypes)
+		if afterSeq == "" || ce.Reset || len(ce.Events) > 0 {
+			return ce
+		}
+
+		select {
+		case <-notifyCh:
+		case <-timer.C:
+			return ce
+		case <-ctx.Done():
+			return ce
+		}
+	}
+}
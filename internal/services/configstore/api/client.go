@@ -25,26 +25,65 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
 
 	errors "golang.org/x/xerrors"
 )
 
 var jsonContent = http.Header{"Content-Type": []string{"application/json"}}
 
+// defaultReadAfterWriteInterval is how long, after a write request, the GET
+// requests are sent to the primary configstore instead of the read replicas
+const defaultReadAfterWriteInterval = 10 * time.Second
+
 // Client represents a Gogs API client.
 type Client struct {
-	url    string
-	client *http.Client
+	// lastWrite is the unix time in nanoseconds of the last write request. It's
+	// the first field to be 64 bit aligned for atomic operations
+	lastWrite int64
+
+	url     string
+	readURL string
+	client  *http.Client
+
+	readAfterWriteInterval time.Duration
+
+	// headers added to all the requests
+	header http.Header
 }
 
 // NewClient initializes and returns a API client.
 func NewClient(url string) *Client {
 	return &Client{
-		url:    strings.TrimSuffix(url, "/"),
-		client: &http.Client{},
+		url:                    strings.TrimSuffix(url, "/"),
+		client:                 &http.Client{},
+		readAfterWriteInterval: defaultReadAfterWriteInterval,
+	}
+}
+
+// SetReadURL sets the url of the configstore read replicas. When set the GET
+// requests will be sent to it.
+// The read replicas are eventually consistent: they apply the changes
+// committed by the primary with some delay. To let the callers read their
+// writes, the GET requests done in the readAfterWriteInterval after a write
+// request done by this client are sent to the primary. The writes done by
+// other clients could not be immediately visible.
+func (c *Client) SetReadURL(url string) {
+	c.readURL = strings.TrimSuffix(url, "/")
+}
+
+// SetInternalAPIToken sets the token used to authenticate to the configstore
+// internal API. It's sent in all the requests.
+func (c *Client) SetInternalAPIToken(token string) {
+	if token == "" {
+		return
 	}
+	c.header = http.Header{}
+	c.header.Set(util.InternalAPITokenHeader, token)
 }
 
 // SetHTTPClient replaces default http.Client with user given one.
@@ -53,7 +92,14 @@ func (c *Client) SetHTTPClient(client *http.Client) {
 }
 
 func (c *Client) doRequest(ctx context.Context, method, path string, query url.Values, header http.Header, ibody io.Reader) (*http.Response, error) {
-	u, err := url.Parse(c.url + "/api/v1alpha" + path)
+	baseURL := c.url
+	if method == "GET" && c.readURL != "" {
+		lastWrite := time.Unix(0, atomic.LoadInt64(&c.lastWrite))
+		if time.Since(lastWrite) > c.readAfterWriteInterval {
+			baseURL = c.readURL
+		}
+	}
+	u, err := url.Parse(baseURL + "/api/v1alpha" + path)
 	if err != nil {
 		return nil, err
 	}
@@ -64,11 +110,18 @@ func (c *Client) doRequest(ctx context.Context, method, path string, query url.V
 	if err != nil {
 		return nil, err
 	}
+	for k, v := range c.header {
+		req.Header[k] = v
+	}
 	for k, v := range header {
 		req.Header[k] = v
 	}
 
-	return c.client.Do(req)
+	resp, err := c.client.Do(req)
+	if method != "GET" {
+		atomic.StoreInt64(&c.lastWrite, time.Now().UnixNano())
+	}
+	return resp, err
 }
 
 func (c *Client) getResponse(ctx context.Context, method, path string, query url.Values, header http.Header, ibody io.Reader) (*http.Response, error) {
@@ -150,12 +203,81 @@ func (c *Client) DeleteProjectGroup(ctx context.Context, projectGroupRef string)
 	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/projectgroups/%s", url.PathEscape(projectGroupRef)), nil, jsonContent, nil)
 }
 
+func (c *Client) GetProjectGroupTrashItems(ctx context.Context, projectGroupRef string) ([]*types.TrashItem, *http.Response, error) {
+	tis := []*types.TrashItem{}
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projectgroups/%s/trashitems", url.PathEscape(projectGroupRef)), nil, jsonContent, nil, &tis)
+	return tis, resp, err
+}
+
+func (c *Client) GetProjectGroupPathAliases(ctx context.Context, projectGroupRef string) ([]*types.PathAlias, *http.Response, error) {
+	pas := []*types.PathAlias{}
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projectgroups/%s/pathaliases", url.PathEscape(projectGroupRef)), nil, jsonContent, nil, &pas)
+	return pas, resp, err
+}
+
+func (c *Client) GetProjectPathAliases(ctx context.Context, projectRef string) ([]*types.PathAlias, *http.Response, error) {
+	pas := []*types.PathAlias{}
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projects/%s/pathaliases", url.PathEscape(projectRef)), nil, jsonContent, nil, &pas)
+	return pas, resp, err
+}
+
+// ResolvePathAlias returns the ID and current path of the project or project
+// group referenced by a current or old path. A not found error is returned
+// when no object is referenced by the path.
+func (c *Client) ResolvePathAlias(ctx context.Context, objectType types.ConfigType, objectPath string) (*PathAliasResolution, *http.Response, error) {
+	q := url.Values{}
+	q.Add("type", string(objectType))
+	q.Add("path", objectPath)
+
+	res := new(PathAliasResolution)
+	resp, err := c.getParsedResponse(ctx, "GET", "/pathaliases/resolve", q, jsonContent, nil, res)
+	return res, resp, err
+}
+
+func (c *Client) GetTrashItem(ctx context.Context, trashItemID string) (*types.TrashItem, *http.Response, error) {
+	ti := new(types.TrashItem)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/trashitems/%s", trashItemID), nil, jsonContent, nil, ti)
+	return ti, resp, err
+}
+
+func (c *Client) GetExpiredTrashItems(ctx context.Context) ([]*types.TrashItem, *http.Response, error) {
+	tis := []*types.TrashItem{}
+	resp, err := c.getParsedResponse(ctx, "GET", "/expiredtrashitems", nil, jsonContent, nil, &tis)
+	return tis, resp, err
+}
+
+func (c *Client) PurgeTrashItem(ctx context.Context, trashItemID string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/trashitems/%s", trashItemID), nil, jsonContent, nil)
+}
+
+func (c *Client) RestoreTrashItem(ctx context.Context, trashItemID string) (*types.TrashItem, *http.Response, error) {
+	ti := new(types.TrashItem)
+	resp, err := c.getParsedResponse(ctx, "POST", fmt.Sprintf("/trashitems/%s/restore", trashItemID), nil, jsonContent, nil, ti)
+	return ti, resp, err
+}
+
 func (c *Client) GetProject(ctx context.Context, projectRef string) (*Project, *http.Response, error) {
 	project := new(Project)
 	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projects/%s", url.PathEscape(projectRef)), nil, jsonContent, nil, project)
 	return project, resp, err
 }
 
+// GetProjects returns all the projects or, when polling is true, only the
+// projects with the repository polling enabled
+func (c *Client) GetProjects(ctx context.Context, polling, scheduled bool) ([]*Project, *http.Response, error) {
+	q := url.Values{}
+	if polling {
+		q.Add("polling", "")
+	}
+	if scheduled {
+		q.Add("scheduled", "")
+	}
+
+	projects := []*Project{}
+	resp, err := c.getParsedResponse(ctx, "GET", "/projects", q, jsonContent, nil, &projects)
+	return projects, resp, err
+}
+
 func (c *Client) CreateProject(ctx context.Context, project *types.Project) (*Project, *http.Response, error) {
 	pj, err := json.Marshal(project)
 	if err != nil {
@@ -278,6 +400,34 @@ func (c *Client) GetProjectVariables(ctx context.Context, projectRef string, tre
 	return variables, resp, err
 }
 
+func (c *Client) GetProjectChanges(ctx context.Context, projectRef string, limit int) ([]*types.ProjectChange, *http.Response, error) {
+	q := url.Values{}
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+
+	pcs := []*types.ProjectChange{}
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projects/%s/changes", url.PathEscape(projectRef)), q, jsonContent, nil, &pcs)
+	return pcs, resp, err
+}
+
+func (c *Client) GetProjectChange(ctx context.Context, projectRef, projectChangeID string) (*types.ProjectChange, *http.Response, error) {
+	pc := new(types.ProjectChange)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projects/%s/changes/%s", url.PathEscape(projectRef), projectChangeID), nil, jsonContent, nil, pc)
+	return pc, resp, err
+}
+
+func (c *Client) CreateProjectChange(ctx context.Context, projectRef string, pc *types.ProjectChange) (*types.ProjectChange, *http.Response, error) {
+	pcj, err := json.Marshal(pc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resPC := new(types.ProjectChange)
+	resp, err := c.getParsedResponse(ctx, "POST", fmt.Sprintf("/projects/%s/changes", url.PathEscape(projectRef)), nil, jsonContent, bytes.NewReader(pcj), resPC)
+	return resPC, resp, err
+}
+
 func (c *Client) CreateProjectGroupVariable(ctx context.Context, projectGroupRef string, variable *types.Variable) (*Variable, *http.Response, error) {
 	pj, err := json.Marshal(variable)
 	if err != nil {
@@ -376,6 +526,69 @@ func (c *Client) GetUserByLinkedAccount(ctx context.Context, linkedAccountID str
 	return users[0], resp, err
 }
 
+// GetProjectEmailSubscribers returns the users subscribed to the email
+// notifications of the provided project
+func (c *Client) GetProjectEmailSubscribers(ctx context.Context, projectID string) ([]*types.User, *http.Response, error) {
+	q := url.Values{}
+	q.Add("query_type", "byemailsubscription")
+	q.Add("projectid", projectID)
+
+	users := []*types.User{}
+	resp, err := c.getParsedResponse(ctx, "GET", "/users", q, jsonContent, nil, &users)
+	return users, resp, err
+}
+
+// GetProjectWatchers returns the users watching the provided project
+func (c *Client) GetProjectWatchers(ctx context.Context, projectID string) ([]*types.User, *http.Response, error) {
+	q := url.Values{}
+	q.Add("query_type", "byprojectwatch")
+	q.Add("projectid", projectID)
+
+	users := []*types.User{}
+	resp, err := c.getParsedResponse(ctx, "GET", "/users", q, jsonContent, nil, &users)
+	return users, resp, err
+}
+
+func (c *Client) GetUserNotifications(ctx context.Context, userRef string, unreadOnly bool, limit int) ([]*types.UserNotification, *http.Response, error) {
+	q := url.Values{}
+	if unreadOnly {
+		q.Add("unread", "")
+	}
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+
+	uns := []*types.UserNotification{}
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/users/%s/notifications", userRef), q, jsonContent, nil, &uns)
+	return uns, resp, err
+}
+
+func (c *Client) GetUserNotificationsUnreadCount(ctx context.Context, userRef string) (int, *http.Response, error) {
+	res := new(UserNotificationsUnreadCountResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/users/%s/notifications/unreadcount", userRef), nil, jsonContent, nil, res)
+	return res.Count, resp, err
+}
+
+func (c *Client) CreateUserNotification(ctx context.Context, userRef string, un *types.UserNotification) (*types.UserNotification, *http.Response, error) {
+	unj, err := json.Marshal(un)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resUN := new(types.UserNotification)
+	resp, err := c.getParsedResponse(ctx, "POST", fmt.Sprintf("/users/%s/notifications", userRef), nil, jsonContent, bytes.NewReader(unj), resUN)
+	return resUN, resp, err
+}
+
+func (c *Client) MarkUserNotificationsRead(ctx context.Context, userRef string, req *MarkUserNotificationsReadRequest) (*http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.getResponse(ctx, "PUT", fmt.Sprintf("/users/%s/notifications/read", userRef), nil, jsonContent, bytes.NewReader(reqj))
+}
+
 func (c *Client) CreateUser(ctx context.Context, req *CreateUserRequest) (*types.User, *http.Response, error) {
 	reqj, err := json.Marshal(req)
 	if err != nil {
@@ -398,6 +611,17 @@ func (c *Client) UpdateUser(ctx context.Context, userRef string, req *UpdateUser
 	return user, resp, err
 }
 
+func (c *Client) CheckUserTOTPCode(ctx context.Context, userRef string, req *CheckUserTOTPCodeRequest) (*CheckUserTOTPCodeResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res := new(CheckUserTOTPCodeResponse)
+	resp, err := c.getParsedResponse(ctx, "POST", fmt.Sprintf("/users/%s/totp/check", userRef), nil, jsonContent, bytes.NewReader(reqj), res)
+	return res, resp, err
+}
+
 func (c *Client) DeleteUser(ctx context.Context, userRef string) (*http.Response, error) {
 	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/users/%s", userRef), nil, jsonContent, nil)
 }
@@ -460,6 +684,34 @@ func (c *Client) DeleteUserToken(ctx context.Context, userRef, tokenName string)
 	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/users/%s/tokens/%s", userRef, tokenName), nil, jsonContent, nil)
 }
 
+func (c *Client) CreateUserSession(ctx context.Context, userRef string, req *CreateUserSessionRequest) (*CreateUserSessionResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sresp := new(CreateUserSessionResponse)
+	resp, err := c.getParsedResponse(ctx, "POST", fmt.Sprintf("/users/%s/sessions", userRef), nil, jsonContent, bytes.NewReader(reqj), sresp)
+	return sresp, resp, err
+}
+
+func (c *Client) DeleteUserSession(ctx context.Context, userRef, sessionID string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/users/%s/sessions/%s", userRef, sessionID), nil, jsonContent, nil)
+}
+
+func (c *Client) DeleteUserSessions(ctx context.Context, userRef string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/users/%s/sessions", userRef), nil, jsonContent, nil)
+}
+
+func (c *Client) UpdateUserAccessUsage(ctx context.Context, userRef string, req *UpdateUserAccessUsageRequest) (*http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.getResponse(ctx, "PUT", fmt.Sprintf("/users/%s/usage", userRef), nil, jsonContent, bytes.NewReader(reqj))
+}
+
 func (c *Client) GetUserOrgs(ctx context.Context, userRef string) ([]*UserOrgsResponse, *http.Response, error) {
 	userOrgs := []*UserOrgsResponse{}
 	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/users/%s/orgs", userRef), nil, jsonContent, nil, &userOrgs)
@@ -576,3 +828,62 @@ func (c *Client) GetOrgMembers(ctx context.Context, orgRef string) ([]*OrgMember
 	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/orgs/%s/members", orgRef), nil, jsonContent, nil, &orgMembers)
 	return orgMembers, resp, err
 }
+
+func (c *Client) GetWals(ctx context.Context, start string, limit int) ([]*Wal, *http.Response, error) {
+	q := url.Values{}
+	if start != "" {
+		q.Add("start", start)
+	}
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+
+	wals := []*Wal{}
+	resp, err := c.getParsedResponse(ctx, "GET", "/wals", q, jsonContent, nil, &wals)
+	return wals, resp, err
+}
+
+// WatchChanges returns the change events after the provided sequence with one
+// of the provided data types (all when empty), waiting for them up to timeout.
+// An empty afterSeq returns the current sequence.
+func (c *Client) WatchChanges(ctx context.Context, afterSeq string, dataTypes []types.ConfigType, timeout time.Duration) (*ChangeEvents, *http.Response, error) {
+	q := url.Values{}
+	if afterSeq != "" {
+		q.Add("after", afterSeq)
+	}
+	for _, t := range dataTypes {
+		q.Add("type", string(t))
+	}
+	if timeout > 0 {
+		q.Add("timeout", timeout.String())
+	}
+
+	ce := new(ChangeEvents)
+	resp, err := c.getParsedResponse(ctx, "GET", "/watch", q, jsonContent, nil, ce)
+	return ce, resp, err
+}
+
+func (c *Client) GetObjectHistory(ctx context.Context, dataType, id, start string, limit int) (*ObjectHistory, *http.Response, error) {
+	q := url.Values{}
+	if start != "" {
+		q.Add("start", start)
+	}
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+
+	history := new(ObjectHistory)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/history/%s/%s", dataType, id), q, jsonContent, nil, history)
+	return history, resp, err
+}
+
+func (c *Client) RestoreObject(ctx context.Context, dataType, id string, req *RestoreObjectRequest) (json.RawMessage, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var obj json.RawMessage
+	resp, err := c.getParsedResponse(ctx, "POST", fmt.Sprintf("/history/%s/%s/restore", dataType, id), nil, jsonContent, bytes.NewReader(reqj), &obj)
+	return obj, resp, err
+}
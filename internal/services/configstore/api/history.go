@@ -0,0 +1,218 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"agola.io/agola/internal/datamanager"
+	"agola.io/agola/internal/services/configstore/action"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+type WalAction struct {
+	ActionType datamanager.ActionType `json:"action_type"`
+	DataType   string                 `json:"data_type"`
+	ID         string                 `json:"id"`
+}
+
+type Wal struct {
+	WalSequence string       `json:"wal_sequence"`
+	Actions     []*WalAction `json:"actions"`
+}
+
+type ObjectHistoryEntry struct {
+	WalSequence string                 `json:"wal_sequence"`
+	ActionType  datamanager.ActionType `json:"action_type"`
+	Data        json.RawMessage        `json:"data,omitempty"`
+}
+
+type ObjectHistory struct {
+	Entries   []*ObjectHistoryEntry `json:"entries"`
+	NextStart string                `json:"next_start,omitempty"`
+}
+
+type RestoreObjectRequest struct {
+	WalSequence string `json:"wal_sequence"`
+}
+
+const (
+	DefaultWalsLimit = 10
+	MaxWalsLimit     = 100
+
+	DefaultHistoryWalsLimit = 100
+	MaxHistoryWalsLimit     = 1000
+)
+
+type WalsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewWalsHandler(logger *zap.Logger, ah *action.ActionHandler) *WalsHandler {
+	return &WalsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *WalsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	limitS := query.Get("limit")
+	limit := DefaultWalsLimit
+	if limitS != "" {
+		var err error
+		limit, err = strconv.Atoi(limitS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse limit: %w", err)))
+			return
+		}
+	}
+	if limit < 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("limit must be greater or equal than 0")))
+		return
+	}
+	if limit == 0 || limit > MaxWalsLimit {
+		limit = MaxWalsLimit
+	}
+
+	start := query.Get("start")
+
+	wals, err := h.ah.GetWals(ctx, start, limit)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := make([]*Wal, len(wals))
+	for i, wal := range wals {
+		actions := make([]*WalAction, len(wal.Actions))
+		for j, a := range wal.Actions {
+			actions[j] = &WalAction{
+				ActionType: a.ActionType,
+				DataType:   a.DataType,
+				ID:         a.ID,
+			}
+		}
+		res[i] = &Wal{
+			WalSequence: wal.WalSequence,
+			Actions:     actions,
+		}
+	}
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type ObjectHistoryHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewObjectHistoryHandler(logger *zap.Logger, ah *action.ActionHandler) *ObjectHistoryHandler {
+	return &ObjectHistoryHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ObjectHistoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+	dataType := vars["datatype"]
+	id := vars["id"]
+
+	limitS := query.Get("limit")
+	limit := DefaultHistoryWalsLimit
+	if limitS != "" {
+		var err error
+		limit, err = strconv.Atoi(limitS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse limit: %w", err)))
+			return
+		}
+	}
+	if limit < 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("limit must be greater or equal than 0")))
+		return
+	}
+	if limit == 0 || limit > MaxHistoryWalsLimit {
+		limit = MaxHistoryWalsLimit
+	}
+
+	start := query.Get("start")
+
+	history, err := h.ah.GetObjectHistory(ctx, dataType, id, start, limit)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := &ObjectHistory{
+		Entries:   make([]*ObjectHistoryEntry, len(history.Entries)),
+		NextStart: history.NextStart,
+	}
+	for i, e := range history.Entries {
+		res.Entries[i] = &ObjectHistoryEntry{
+			WalSequence: e.WalSequence,
+			ActionType:  e.ActionType,
+			Data:        e.Data,
+		}
+	}
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type RestoreObjectHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewRestoreObjectHandler(logger *zap.Logger, ah *action.ActionHandler) *RestoreObjectHandler {
+	return &RestoreObjectHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *RestoreObjectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	var req *RestoreObjectRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	areq := &action.RestoreObjectRequest{
+		DataType:    vars["datatype"],
+		ID:          vars["id"],
+		WalSequence: req.WalSequence,
+	}
+	obj, err := h.ah.RestoreObject(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, obj); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -284,3 +284,62 @@ const (
 	DefaultProjectsLimit = 10
 	MaxProjectsLimit     = 20
 )
+
+type ProjectsHandler struct {
+	log    *zap.SugaredLogger
+	readDB *readdb.ReadDB
+}
+
+func NewProjectsHandler(logger *zap.Logger, readDB *readdb.ReadDB) *ProjectsHandler {
+	return &ProjectsHandler{log: logger.Sugar(), readDB: readDB}
+}
+
+// ProjectsHandler returns all the projects. When the polling query parameter
+// is provided only the projects with the repository polling enabled are
+// returned, when the scheduled query parameter is provided only the projects
+// with schedules are returned.
+func (h *ProjectsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	_, polling := query["polling"]
+	_, scheduled := query["scheduled"]
+
+	var projects []*types.Project
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		var err error
+		projects, err = h.readDB.GetAllProjects(tx)
+		return err
+	})
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if polling {
+		pollingProjects := []*types.Project{}
+		for _, p := range projects {
+			if p.Polling != nil {
+				pollingProjects = append(pollingProjects, p)
+			}
+		}
+		projects = pollingProjects
+	}
+	if scheduled {
+		scheduledProjects := []*types.Project{}
+		for _, p := range projects {
+			if len(p.Schedules) > 0 {
+				scheduledProjects = append(scheduledProjects, p)
+			}
+		}
+		projects = scheduledProjects
+	}
+
+	resProjects, err := projectsResponse(h.readDB, projects)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, resProjects); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"agola.io/agola/internal/services/configstore/action"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	DefaultProjectChangesLimit = 25
+	MaxProjectChangesLimit     = 100
+)
+
+type ProjectChangesHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectChangesHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectChangesHandler {
+	return &ProjectChangesHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectChangesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	limitS := query.Get("limit")
+	limit := DefaultProjectChangesLimit
+	if limitS != "" {
+		var err error
+		limit, err = strconv.Atoi(limitS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse limit: %w", err)))
+			return
+		}
+	}
+	if limit < 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("limit must be greater or equal than 0")))
+		return
+	}
+	if limit == 0 || limit > MaxProjectChangesLimit {
+		limit = MaxProjectChangesLimit
+	}
+
+	pcs, err := h.ah.GetProjectChanges(ctx, projectRef, limit)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, pcs); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type ProjectChangeHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectChangeHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectChangeHandler {
+	return &ProjectChangeHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectChangeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+	projectChangeID := vars["changeid"]
+
+	pc, err := h.ah.GetProjectChange(ctx, projectRef, projectChangeID)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, pc); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type CreateProjectChangeHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewCreateProjectChangeHandler(logger *zap.Logger, ah *action.ActionHandler) *CreateProjectChangeHandler {
+	return &CreateProjectChangeHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *CreateProjectChangeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	var pc *types.ProjectChange
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&pc); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	pc, err = h.ah.CreateProjectChange(ctx, projectRef, pc)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusCreated, pc); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
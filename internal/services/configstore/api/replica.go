@@ -0,0 +1,46 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+
+	"agola.io/agola/internal/util"
+
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+// ReadReplicaHandler rejects all the write requests sent to a configstore read
+// replica
+type ReadReplicaHandler struct {
+	log *zap.SugaredLogger
+	h   http.Handler
+}
+
+func NewReadReplicaHandler(logger *zap.Logger, h http.Handler) *ReadReplicaHandler {
+	return &ReadReplicaHandler{log: logger.Sugar(), h: h}
+}
+
+func (h *ReadReplicaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		err := util.NewErrForbidden(errors.Errorf("configstore is a read replica, write requests must be sent to a primary configstore"))
+		h.log.Errorf("err: %+v", err)
+		httpError(w, err)
+		return
+	}
+
+	h.h.ServeHTTP(w, r)
+}
@@ -0,0 +1,105 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	slog "agola.io/agola/internal/log"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
+var logger = slog.New(level)
+
+func TestReadReplicaHandler(t *testing.T) {
+	h := NewReadReplicaHandler(logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		method string
+		code   int
+	}{
+		{method: "GET", code: http.StatusOK},
+		{method: "HEAD", code: http.StatusOK},
+		{method: "POST", code: http.StatusForbidden},
+		{method: "PUT", code: http.StatusForbidden},
+		{method: "PATCH", code: http.StatusForbidden},
+		{method: "DELETE", code: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/api/v1alpha/projects/project01", nil)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.code {
+				t.Fatalf("expected status code %d, got %d", tt.code, w.Code)
+			}
+		})
+	}
+}
+
+func TestClientReadURL(t *testing.T) {
+	var primaryReqs, replicaReqs []string
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryReqs = append(primaryReqs, r.Method)
+	}))
+	defer primary.Close()
+	replica := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		replicaReqs = append(replicaReqs, r.Method)
+	}))
+	defer replica.Close()
+
+	ctx := context.Background()
+	c := NewClient(primary.URL)
+	c.SetReadURL(replica.URL)
+	c.readAfterWriteInterval = 100 * time.Millisecond
+
+	do := func(method string) {
+		resp, err := c.doRequest(ctx, method, "/projects/project01", nil, nil, nil)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		resp.Body.Close()
+	}
+	check := func(expPrimaryReqs, expReplicaReqs int) {
+		t.Helper()
+		if len(primaryReqs) != expPrimaryReqs || len(replicaReqs) != expReplicaReqs {
+			t.Fatalf("expected %d primary and %d replica requests, got %v and %v", expPrimaryReqs, expReplicaReqs, primaryReqs, replicaReqs)
+		}
+	}
+
+	do("GET")
+	check(0, 1)
+
+	// the writes go to the primary
+	do("PUT")
+	check(1, 1)
+
+	// the reads just after a write go to the primary
+	do("GET")
+	check(2, 1)
+
+	time.Sleep(200 * time.Millisecond)
+	do("GET")
+	check(2, 2)
+}
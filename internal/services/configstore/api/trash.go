@@ -0,0 +1,153 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"net/url"
+
+	"agola.io/agola/internal/services/configstore/action"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type ProjectGroupTrashItemsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectGroupTrashItemsHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectGroupTrashItemsHandler {
+	return &ProjectGroupTrashItemsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectGroupTrashItemsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectGroupRef, err := url.PathUnescape(vars["projectgroupref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	tis, err := h.ah.GetProjectGroupTrashItems(ctx, projectGroupRef)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, tis); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type TrashItemHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewTrashItemHandler(logger *zap.Logger, ah *action.ActionHandler) *TrashItemHandler {
+	return &TrashItemHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *TrashItemHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	trashItemID := vars["trashitemid"]
+
+	ti, err := h.ah.GetTrashItem(ctx, trashItemID)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, ti); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type ExpiredTrashItemsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewExpiredTrashItemsHandler(logger *zap.Logger, ah *action.ActionHandler) *ExpiredTrashItemsHandler {
+	return &ExpiredTrashItemsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ExpiredTrashItemsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	tis, err := h.ah.GetExpiredTrashItems(ctx)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, tis); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type PurgeTrashItemHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewPurgeTrashItemHandler(logger *zap.Logger, ah *action.ActionHandler) *PurgeTrashItemHandler {
+	return &PurgeTrashItemHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *PurgeTrashItemHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	trashItemID := vars["trashitemid"]
+
+	err := h.ah.PurgeTrashItem(ctx, trashItemID)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type RestoreTrashItemHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewRestoreTrashItemHandler(logger *zap.Logger, ah *action.ActionHandler) *RestoreTrashItemHandler {
+	return &RestoreTrashItemHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *RestoreTrashItemHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	trashItemID := vars["trashitemid"]
+
+	ti, err := h.ah.RestoreTrashItem(ctx, trashItemID)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, ti); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -119,6 +119,13 @@ func (h *CreateUserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 type UpdateUserRequest struct {
 	UserName string `json:"user_name"`
+	// TOTP is updated only when provided, an empty TOTP removes it
+	TOTP *types.UserTOTP `json:"totp,omitempty"`
+	// EmailNotifications are updated only when provided, empty email
+	// notifications remove them
+	EmailNotifications *types.UserEmailNotifications `json:"email_notifications,omitempty"`
+	// WatchedProjects are updated only when provided
+	WatchedProjects *[]string `json:"watched_projects,omitempty"`
 }
 
 type UpdateUserHandler struct {
@@ -146,6 +153,10 @@ func (h *UpdateUserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	creq := &action.UpdateUserRequest{
 		UserRef:  userRef,
 		UserName: req.UserName,
+		TOTP:     req.TOTP,
+
+		EmailNotifications: req.EmailNotifications,
+		WatchedProjects:    req.WatchedProjects,
 	}
 
 	user, err := h.ah.UpdateUser(ctx, creq)
@@ -159,6 +170,59 @@ func (h *UpdateUserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type CheckUserTOTPCodeRequest struct {
+	Code   string `json:"code"`
+	Enable bool   `json:"enable"`
+}
+
+type CheckUserTOTPCodeResponse struct {
+	Valid       bool       `json:"valid"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+}
+
+type CheckUserTOTPCodeHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewCheckUserTOTPCodeHandler(logger *zap.Logger, ah *action.ActionHandler) *CheckUserTOTPCodeHandler {
+	return &CheckUserTOTPCodeHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *CheckUserTOTPCodeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	vars := mux.Vars(r)
+	userRef := vars["userref"]
+
+	var req *CheckUserTOTPCodeRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	creq := &action.CheckUserTOTPCodeRequest{
+		UserRef: userRef,
+		Code:    req.Code,
+		Enable:  req.Enable,
+	}
+
+	cres, err := h.ah.CheckUserTOTPCode(ctx, creq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := &CheckUserTOTPCodeResponse{
+		Valid:       cres.Valid,
+		LockedUntil: cres.LockedUntil,
+	}
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
 type DeleteUserHandler struct {
 	log *zap.SugaredLogger
 	ah  *action.ActionHandler
@@ -284,6 +348,49 @@ func (h *UsersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		users = []*types.User{user}
+	case "byemailsubscription":
+		// users subscribed to the email notifications of the provided project
+		projectID := query.Get("projectid")
+		var allUsers []*types.User
+		err := h.readDB.Do(func(tx *db.Tx) error {
+			var err error
+			allUsers, err = h.readDB.GetUsers(tx, "", 0, true)
+			return err
+		})
+		if err != nil {
+			h.log.Errorf("err: %+v", err)
+			httpError(w, err)
+			return
+		}
+		users = []*types.User{}
+		for _, user := range allUsers {
+			if user.EmailNotifications == nil {
+				continue
+			}
+			if _, ok := user.EmailNotifications.Projects[projectID]; ok {
+				users = append(users, user)
+			}
+		}
+	case "byprojectwatch":
+		// users watching the provided project
+		projectID := query.Get("projectid")
+		var allUsers []*types.User
+		err := h.readDB.Do(func(tx *db.Tx) error {
+			var err error
+			allUsers, err = h.readDB.GetUsers(tx, "", 0, true)
+			return err
+		})
+		if err != nil {
+			h.log.Errorf("err: %+v", err)
+			httpError(w, err)
+			return
+		}
+		users = []*types.User{}
+		for _, user := range allUsers {
+			if user.IsWatchingProject(projectID) {
+				users = append(users, user)
+			}
+		}
 	default:
 		// default query
 		err := h.readDB.Do(func(tx *db.Tx) error {
@@ -432,7 +539,9 @@ func (h *UpdateUserLAHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 }
 
 type CreateUserTokenRequest struct {
-	TokenName string `json:"token_name"`
+	TokenName string             `json:"token_name"`
+	Scopes    []types.TokenScope `json:"scopes"`
+	ExpiresAt time.Time          `json:"expires_at"`
 }
 
 type CreateUserTokenResponse struct {
@@ -460,7 +569,13 @@ func (h *CreateUserTokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	token, err := h.ah.CreateUserToken(ctx, userRef, req.TokenName)
+	creq := &action.CreateUserTokenRequest{
+		UserRef:   userRef,
+		TokenName: req.TokenName,
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+	}
+	token, err := h.ah.CreateUserToken(ctx, creq)
 	if httpError(w, err) {
 		h.log.Errorf("err: %+v", err)
 		return
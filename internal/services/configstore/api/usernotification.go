@@ -0,0 +1,179 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"agola.io/agola/internal/services/configstore/action"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	DefaultUserNotificationsLimit = 25
+	MaxUserNotificationsLimit     = 100
+)
+
+type UserNotificationsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewUserNotificationsHandler(logger *zap.Logger, ah *action.ActionHandler) *UserNotificationsHandler {
+	return &UserNotificationsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *UserNotificationsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+	vars := mux.Vars(r)
+	userRef := vars["userref"]
+
+	_, unreadOnly := query["unread"]
+
+	limitS := query.Get("limit")
+	limit := DefaultUserNotificationsLimit
+	if limitS != "" {
+		var err error
+		limit, err = strconv.Atoi(limitS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse limit: %w", err)))
+			return
+		}
+	}
+	if limit < 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("limit must be greater or equal than 0")))
+		return
+	}
+	if limit == 0 || limit > MaxUserNotificationsLimit {
+		limit = MaxUserNotificationsLimit
+	}
+
+	uns, err := h.ah.GetUserNotifications(ctx, userRef, unreadOnly, limit)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, uns); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type UserNotificationsUnreadCountResponse struct {
+	Count int `json:"count"`
+}
+
+type UserNotificationsUnreadCountHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewUserNotificationsUnreadCountHandler(logger *zap.Logger, ah *action.ActionHandler) *UserNotificationsUnreadCountHandler {
+	return &UserNotificationsUnreadCountHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *UserNotificationsUnreadCountHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	userRef := vars["userref"]
+
+	count, err := h.ah.GetUserNotificationsUnreadCount(ctx, userRef)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, &UserNotificationsUnreadCountResponse{Count: count}); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type CreateUserNotificationHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewCreateUserNotificationHandler(logger *zap.Logger, ah *action.ActionHandler) *CreateUserNotificationHandler {
+	return &CreateUserNotificationHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *CreateUserNotificationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	userRef := vars["userref"]
+
+	var un *types.UserNotification
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&un); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	un, err := h.ah.CreateUserNotification(ctx, userRef, un)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusCreated, un); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type MarkUserNotificationsReadRequest struct {
+	// IDs are the notifications to mark as read. When empty all the user
+	// notifications are marked as read
+	IDs []string `json:"ids,omitempty"`
+}
+
+type MarkUserNotificationsReadHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewMarkUserNotificationsReadHandler(logger *zap.Logger, ah *action.ActionHandler) *MarkUserNotificationsReadHandler {
+	return &MarkUserNotificationsReadHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *MarkUserNotificationsReadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	userRef := vars["userref"]
+
+	var req MarkUserNotificationsReadRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	err := h.ah.MarkUserNotificationsRead(ctx, userRef, req.IDs)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"agola.io/agola/internal/services/configstore/action"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type CreateUserSessionRequest struct {
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type CreateUserSessionResponse struct {
+	SessionID string `json:"session_id"`
+}
+
+type CreateUserSessionHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewCreateUserSessionHandler(logger *zap.Logger, ah *action.ActionHandler) *CreateUserSessionHandler {
+	return &CreateUserSessionHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *CreateUserSessionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	userRef := vars["userref"]
+
+	var req CreateUserSessionRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	sessionID, err := h.ah.CreateUserSession(ctx, userRef, req.ExpiresAt)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	resp := &CreateUserSessionResponse{
+		SessionID: sessionID,
+	}
+	if err := httpResponse(w, http.StatusCreated, resp); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type DeleteUserSessionHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewDeleteUserSessionHandler(logger *zap.Logger, ah *action.ActionHandler) *DeleteUserSessionHandler {
+	return &DeleteUserSessionHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *DeleteUserSessionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	userRef := vars["userref"]
+	sessionID := vars["sessionid"]
+
+	err := h.ah.DeleteUserSession(ctx, userRef, sessionID)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type DeleteUserSessionsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewDeleteUserSessionsHandler(logger *zap.Logger, ah *action.ActionHandler) *DeleteUserSessionsHandler {
+	return &DeleteUserSessionsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *DeleteUserSessionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	userRef := vars["userref"]
+
+	err := h.ah.DeleteUserSessions(ctx, userRef)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type AccessUsage struct {
+	LastUsedAt time.Time `json:"last_used_at"`
+	LastUsedIP string    `json:"last_used_ip"`
+}
+
+type UpdateUserAccessUsageRequest struct {
+	// Sessions and Tokens are the access usages keyed by session id and token
+	// name
+	Sessions map[string]*AccessUsage `json:"sessions,omitempty"`
+	Tokens   map[string]*AccessUsage `json:"tokens,omitempty"`
+}
+
+type UpdateUserAccessUsageHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewUpdateUserAccessUsageHandler(logger *zap.Logger, ah *action.ActionHandler) *UpdateUserAccessUsageHandler {
+	return &UpdateUserAccessUsageHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *UpdateUserAccessUsageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	userRef := vars["userref"]
+
+	var req UpdateUserAccessUsageRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	areq := &action.UpdateUserAccessUsageRequest{
+		UserRef:  userRef,
+		Sessions: make(map[string]*action.AccessUsage, len(req.Sessions)),
+		Tokens:   make(map[string]*action.AccessUsage, len(req.Tokens)),
+	}
+	for sessionID, u := range req.Sessions {
+		areq.Sessions[sessionID] = &action.AccessUsage{LastUsedAt: u.LastUsedAt, LastUsedIP: u.LastUsedIP}
+	}
+	for tokenName, u := range req.Tokens {
+		areq.Tokens[tokenName] = &action.AccessUsage{LastUsedAt: u.LastUsedAt, LastUsedIP: u.LastUsedIP}
+	}
+	err := h.ah.UpdateUserAccessUsage(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
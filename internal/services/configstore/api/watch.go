@@ -0,0 +1,105 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"agola.io/agola/internal/services/configstore/action"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	DefaultWatchTimeout = 30 * time.Second
+	MaxWatchTimeout     = 60 * time.Second
+)
+
+type ChangeEvent struct {
+	Seq      string           `json:"seq"`
+	DataType types.ConfigType `json:"data_type"`
+	ID       string           `json:"id"`
+	Deleted  bool             `json:"deleted"`
+}
+
+type ChangeEvents struct {
+	Events []*ChangeEvent `json:"events"`
+	// Seq is the sequence to use to get the next events
+	Seq string `json:"seq"`
+	// Reset is true when the events after the requested sequence aren't
+	// available anymore. The objects must be fetched again before getting the
+	// events after Seq.
+	Reset bool `json:"reset"`
+}
+
+type WatchHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewWatchHandler(logger *zap.Logger, ah *action.ActionHandler) *WatchHandler {
+	return &WatchHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *WatchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	timeout := DefaultWatchTimeout
+	if timeoutS := query.Get("timeout"); timeoutS != "" {
+		var err error
+		timeout, err = time.ParseDuration(timeoutS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse timeout: %w", err)))
+			return
+		}
+	}
+	if timeout < 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("timeout must be greater or equal than 0")))
+		return
+	}
+	if timeout > MaxWatchTimeout {
+		timeout = MaxWatchTimeout
+	}
+
+	var dataTypes []types.ConfigType
+	for _, t := range query["type"] {
+		dataTypes = append(dataTypes, types.ConfigType(t))
+	}
+
+	ce := h.ah.WatchChanges(ctx, query.Get("after"), dataTypes, timeout)
+
+	res := &ChangeEvents{
+		Events: make([]*ChangeEvent, len(ce.Events)),
+		Seq:    ce.Seq,
+		Reset:  ce.Reset,
+	}
+	for i, ev := range ce.Events {
+		res.Events[i] = &ChangeEvent{
+			Seq:      ev.Seq,
+			DataType: ev.DataType,
+			ID:       ev.ID,
+			Deleted:  ev.Deleted,
+		}
+	}
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"crypto/tls"
 	"net/http"
 	"path/filepath"
+	"time"
 
 	scommon "agola.io/agola/internal/common"
 	"agola.io/agola/internal/datamanager"
@@ -41,6 +42,29 @@ var level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
 var logger = slog.New(level)
 var log = logger.Sugar()
 
+// DataManagerConfig returns the configstore datamanager configuration
+func DataManagerConfig(e *etcd.Store, ost *objectstorage.ObjStorage) *datamanager.DataManagerConfig {
+	return &datamanager.DataManagerConfig{
+		BasePath: "configdata",
+		E:        e,
+		OST:      ost,
+		DataTypes: []string{
+			string(types.ConfigTypeUser),
+			string(types.ConfigTypeOrg),
+			string(types.ConfigTypeOrgMember),
+			string(types.ConfigTypeProjectGroup),
+			string(types.ConfigTypeProject),
+			string(types.ConfigTypeRemoteSource),
+			string(types.ConfigTypeSecret),
+			string(types.ConfigTypeVariable),
+			string(types.ConfigTypeProjectChange),
+			string(types.ConfigTypeUserNotification),
+			string(types.ConfigTypeTrashItem),
+			string(types.ConfigTypePathAlias),
+		},
+	}
+}
+
 type Configstore struct {
 	c      *config.Configstore
 	e      *etcd.Store
@@ -70,22 +94,7 @@ func NewConfigstore(ctx context.Context, c *config.Configstore) (*Configstore, e
 		ost: ost,
 	}
 
-	dmConf := &datamanager.DataManagerConfig{
-		BasePath: "configdata",
-		E:        e,
-		OST:      ost,
-		DataTypes: []string{
-			string(types.ConfigTypeUser),
-			string(types.ConfigTypeOrg),
-			string(types.ConfigTypeOrgMember),
-			string(types.ConfigTypeProjectGroup),
-			string(types.ConfigTypeProject),
-			string(types.ConfigTypeRemoteSource),
-			string(types.ConfigTypeSecret),
-			string(types.ConfigTypeVariable),
-		},
-	}
-	dm, err := datamanager.NewDataManager(ctx, logger, dmConf)
+	dm, err := datamanager.NewDataManager(ctx, logger, DataManagerConfig(e, ost))
 	if err != nil {
 		return nil, err
 	}
@@ -97,7 +106,7 @@ func NewConfigstore(ctx context.Context, c *config.Configstore) (*Configstore, e
 	cs.dm = dm
 	cs.readDB = readDB
 
-	ah := action.NewActionHandler(logger, readDB, dm)
+	ah := action.NewActionHandler(logger, readDB, dm, c.ReservedUserNames, c.TrashRetention)
 	cs.ah = ah
 
 	return cs, nil
@@ -105,12 +114,40 @@ func NewConfigstore(ctx context.Context, c *config.Configstore) (*Configstore, e
 
 func (s *Configstore) Run(ctx context.Context) error {
 	errCh := make(chan error)
-	dmReadyCh := make(chan struct{})
 
-	go func() { errCh <- s.dm.Run(ctx, dmReadyCh) }()
-
-	// wait for dm to be ready
-	<-dmReadyCh
+	// a read replica doesn't run the datamanager since it only reads the
+	// changes committed by the primary instances
+	if !s.c.ReadReplica {
+		dmReadyCh := make(chan struct{})
+
+		go func() { errCh <- s.dm.Run(ctx, dmReadyCh) }()
+
+		// wait for dm to be ready
+		<-dmReadyCh
+	} else {
+		log.Infof("starting as a read replica")
+
+		// wait for etcd to be initialized by a primary instance since the read
+		// db is initialized from the etcd wals
+		for {
+			initialized, err := s.dm.EtcdInitialized(ctx)
+			if err != nil {
+				log.Errorf("failed to check etcd initialization: %+v", err)
+			}
+			if initialized {
+				break
+			}
+			if err == nil {
+				log.Infof("waiting for etcd to be initialized by a primary configstore")
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(1 * time.Second):
+			}
+		}
+	}
 
 	go func() { errCh <- s.readDB.Run(ctx) }()
 
@@ -120,8 +157,17 @@ func (s *Configstore) Run(ctx context.Context) error {
 	createProjectGroupHandler := api.NewCreateProjectGroupHandler(logger, s.ah, s.readDB)
 	updateProjectGroupHandler := api.NewUpdateProjectGroupHandler(logger, s.ah, s.readDB)
 	deleteProjectGroupHandler := api.NewDeleteProjectGroupHandler(logger, s.ah)
+	projectGroupTrashItemsHandler := api.NewProjectGroupTrashItemsHandler(logger, s.ah)
+	trashItemHandler := api.NewTrashItemHandler(logger, s.ah)
+	restoreTrashItemHandler := api.NewRestoreTrashItemHandler(logger, s.ah)
+	expiredTrashItemsHandler := api.NewExpiredTrashItemsHandler(logger, s.ah)
+	purgeTrashItemHandler := api.NewPurgeTrashItemHandler(logger, s.ah)
+	projectGroupPathAliasesHandler := api.NewProjectGroupPathAliasesHandler(logger, s.ah)
+	projectPathAliasesHandler := api.NewProjectPathAliasesHandler(logger, s.ah)
+	resolvePathAliasHandler := api.NewResolvePathAliasHandler(logger, s.ah)
 
 	projectHandler := api.NewProjectHandler(logger, s.readDB)
+	projectsHandler := api.NewProjectsHandler(logger, s.readDB)
 	createProjectHandler := api.NewCreateProjectHandler(logger, s.ah, s.readDB)
 	updateProjectHandler := api.NewUpdateProjectHandler(logger, s.ah, s.readDB)
 	deleteProjectHandler := api.NewDeleteProjectHandler(logger, s.ah)
@@ -131,6 +177,10 @@ func (s *Configstore) Run(ctx context.Context) error {
 	updateSecretHandler := api.NewUpdateSecretHandler(logger, s.ah)
 	deleteSecretHandler := api.NewDeleteSecretHandler(logger, s.ah)
 
+	projectChangesHandler := api.NewProjectChangesHandler(logger, s.ah)
+	projectChangeHandler := api.NewProjectChangeHandler(logger, s.ah)
+	createProjectChangeHandler := api.NewCreateProjectChangeHandler(logger, s.ah)
+
 	variablesHandler := api.NewVariablesHandler(logger, s.ah, s.readDB)
 	createVariableHandler := api.NewCreateVariableHandler(logger, s.ah)
 	updateVariableHandler := api.NewUpdateVariableHandler(logger, s.ah)
@@ -140,6 +190,7 @@ func (s *Configstore) Run(ctx context.Context) error {
 	usersHandler := api.NewUsersHandler(logger, s.readDB)
 	createUserHandler := api.NewCreateUserHandler(logger, s.ah)
 	updateUserHandler := api.NewUpdateUserHandler(logger, s.ah)
+	checkUserTOTPCodeHandler := api.NewCheckUserTOTPCodeHandler(logger, s.ah)
 	deleteUserHandler := api.NewDeleteUserHandler(logger, s.ah)
 
 	createUserLAHandler := api.NewCreateUserLAHandler(logger, s.ah)
@@ -148,9 +199,18 @@ func (s *Configstore) Run(ctx context.Context) error {
 
 	createUserTokenHandler := api.NewCreateUserTokenHandler(logger, s.ah)
 	deleteUserTokenHandler := api.NewDeleteUserTokenHandler(logger, s.ah)
+	createUserSessionHandler := api.NewCreateUserSessionHandler(logger, s.ah)
+	deleteUserSessionHandler := api.NewDeleteUserSessionHandler(logger, s.ah)
+	deleteUserSessionsHandler := api.NewDeleteUserSessionsHandler(logger, s.ah)
+	updateUserAccessUsageHandler := api.NewUpdateUserAccessUsageHandler(logger, s.ah)
 
 	userOrgsHandler := api.NewUserOrgsHandler(logger, s.ah)
 
+	userNotificationsHandler := api.NewUserNotificationsHandler(logger, s.ah)
+	userNotificationsUnreadCountHandler := api.NewUserNotificationsUnreadCountHandler(logger, s.ah)
+	createUserNotificationHandler := api.NewCreateUserNotificationHandler(logger, s.ah)
+	markUserNotificationsReadHandler := api.NewMarkUserNotificationsReadHandler(logger, s.ah)
+
 	orgHandler := api.NewOrgHandler(logger, s.readDB)
 	orgsHandler := api.NewOrgsHandler(logger, s.readDB)
 	createOrgHandler := api.NewCreateOrgHandler(logger, s.ah)
@@ -166,8 +226,16 @@ func (s *Configstore) Run(ctx context.Context) error {
 	updateRemoteSourceHandler := api.NewUpdateRemoteSourceHandler(logger, s.ah)
 	deleteRemoteSourceHandler := api.NewDeleteRemoteSourceHandler(logger, s.ah)
 
+	walsHandler := api.NewWalsHandler(logger, s.ah)
+	watchHandler := api.NewWatchHandler(logger, s.ah)
+	objectHistoryHandler := api.NewObjectHistoryHandler(logger, s.ah)
+	restoreObjectHandler := api.NewRestoreObjectHandler(logger, s.ah)
+
 	router := mux.NewRouter()
 	apirouter := router.PathPrefix("/api/v1alpha").Subrouter().UseEncodedPath()
+	apirouter.Use(func(h http.Handler) http.Handler {
+		return util.NewInternalAPIAuthHandler(s.c.InternalAPIAuth.Tokens, h)
+	})
 
 	apirouter.Handle("/projectgroups/{projectgroupref}", projectGroupHandler).Methods("GET")
 	apirouter.Handle("/projectgroups/{projectgroupref}/subgroups", projectGroupSubgroupsHandler).Methods("GET")
@@ -175,11 +243,23 @@ func (s *Configstore) Run(ctx context.Context) error {
 	apirouter.Handle("/projectgroups", createProjectGroupHandler).Methods("POST")
 	apirouter.Handle("/projectgroups/{projectgroupref}", updateProjectGroupHandler).Methods("PUT")
 	apirouter.Handle("/projectgroups/{projectgroupref}", deleteProjectGroupHandler).Methods("DELETE")
+	apirouter.Handle("/projectgroups/{projectgroupref}/trashitems", projectGroupTrashItemsHandler).Methods("GET")
+	apirouter.Handle("/trashitems/{trashitemid}", trashItemHandler).Methods("GET")
+	apirouter.Handle("/trashitems/{trashitemid}", purgeTrashItemHandler).Methods("DELETE")
+	apirouter.Handle("/trashitems/{trashitemid}/restore", restoreTrashItemHandler).Methods("POST")
+	apirouter.Handle("/expiredtrashitems", expiredTrashItemsHandler).Methods("GET")
+	apirouter.Handle("/projectgroups/{projectgroupref}/pathaliases", projectGroupPathAliasesHandler).Methods("GET")
+	apirouter.Handle("/projects/{projectref}/pathaliases", projectPathAliasesHandler).Methods("GET")
+	apirouter.Handle("/pathaliases/resolve", resolvePathAliasHandler).Methods("GET")
 
 	apirouter.Handle("/projects/{projectref}", projectHandler).Methods("GET")
+	apirouter.Handle("/projects", projectsHandler).Methods("GET")
 	apirouter.Handle("/projects", createProjectHandler).Methods("POST")
 	apirouter.Handle("/projects/{projectref}", updateProjectHandler).Methods("PUT")
 	apirouter.Handle("/projects/{projectref}", deleteProjectHandler).Methods("DELETE")
+	apirouter.Handle("/projects/{projectref}/changes", projectChangesHandler).Methods("GET")
+	apirouter.Handle("/projects/{projectref}/changes", createProjectChangeHandler).Methods("POST")
+	apirouter.Handle("/projects/{projectref}/changes/{changeid}", projectChangeHandler).Methods("GET")
 
 	apirouter.Handle("/projectgroups/{projectgroupref}/secrets", secretsHandler).Methods("GET")
 	apirouter.Handle("/projects/{projectref}/secrets", secretsHandler).Methods("GET")
@@ -203,6 +283,7 @@ func (s *Configstore) Run(ctx context.Context) error {
 	apirouter.Handle("/users", usersHandler).Methods("GET")
 	apirouter.Handle("/users", createUserHandler).Methods("POST")
 	apirouter.Handle("/users/{userref}", updateUserHandler).Methods("PUT")
+	apirouter.Handle("/users/{userref}/totp/check", checkUserTOTPCodeHandler).Methods("POST")
 	apirouter.Handle("/users/{userref}", deleteUserHandler).Methods("DELETE")
 
 	apirouter.Handle("/users/{userref}/linkedaccounts", createUserLAHandler).Methods("POST")
@@ -210,9 +291,18 @@ func (s *Configstore) Run(ctx context.Context) error {
 	apirouter.Handle("/users/{userref}/linkedaccounts/{laid}", updateUserLAHandler).Methods("PUT")
 	apirouter.Handle("/users/{userref}/tokens", createUserTokenHandler).Methods("POST")
 	apirouter.Handle("/users/{userref}/tokens/{tokenname}", deleteUserTokenHandler).Methods("DELETE")
+	apirouter.Handle("/users/{userref}/sessions", createUserSessionHandler).Methods("POST")
+	apirouter.Handle("/users/{userref}/sessions", deleteUserSessionsHandler).Methods("DELETE")
+	apirouter.Handle("/users/{userref}/sessions/{sessionid}", deleteUserSessionHandler).Methods("DELETE")
+	apirouter.Handle("/users/{userref}/usage", updateUserAccessUsageHandler).Methods("PUT")
 
 	apirouter.Handle("/users/{userref}/orgs", userOrgsHandler).Methods("GET")
 
+	apirouter.Handle("/users/{userref}/notifications", userNotificationsHandler).Methods("GET")
+	apirouter.Handle("/users/{userref}/notifications", createUserNotificationHandler).Methods("POST")
+	apirouter.Handle("/users/{userref}/notifications/unreadcount", userNotificationsUnreadCountHandler).Methods("GET")
+	apirouter.Handle("/users/{userref}/notifications/read", markUserNotificationsReadHandler).Methods("PUT")
+
 	apirouter.Handle("/orgs/{orgref}", orgHandler).Methods("GET")
 	apirouter.Handle("/orgs", orgsHandler).Methods("GET")
 	apirouter.Handle("/orgs", createOrgHandler).Methods("POST")
@@ -227,13 +317,22 @@ func (s *Configstore) Run(ctx context.Context) error {
 	apirouter.Handle("/remotesources/{remotesourceref}", updateRemoteSourceHandler).Methods("PUT")
 	apirouter.Handle("/remotesources/{remotesourceref}", deleteRemoteSourceHandler).Methods("DELETE")
 
+	apirouter.Handle("/wals", walsHandler).Methods("GET")
+	apirouter.Handle("/watch", watchHandler).Methods("GET")
+	apirouter.Handle("/history/{datatype}/{id}", objectHistoryHandler).Methods("GET")
+	apirouter.Handle("/history/{datatype}/{id}/restore", restoreObjectHandler).Methods("POST")
+
 	mainrouter := mux.NewRouter()
-	mainrouter.PathPrefix("/").Handler(router)
+	if s.c.ReadReplica {
+		mainrouter.PathPrefix("/").Handler(api.NewReadReplicaHandler(logger, router))
+	} else {
+		mainrouter.PathPrefix("/").Handler(router)
+	}
 
 	var tlsConfig *tls.Config
 	if s.c.Web.TLS {
 		var err error
-		tlsConfig, err = util.NewTLSConfig(s.c.Web.TLSCertFile, s.c.Web.TLSKeyFile, "", false)
+		tlsConfig, err = scommon.NewWebTLSConfig(ctx, logger, &s.c.Web)
 		if err != nil {
 			log.Errorf("err: %+v")
 			return err
@@ -248,7 +347,11 @@ func (s *Configstore) Run(ctx context.Context) error {
 
 	lerrCh := make(chan error)
 	go func() {
-		lerrCh <- httpServer.ListenAndServe()
+		if tlsConfig != nil {
+			lerrCh <- httpServer.ListenAndServeTLS("", "")
+		} else {
+			lerrCh <- httpServer.ListenAndServe()
+		}
 	}()
 
 	select {
@@ -34,6 +34,7 @@ import (
 	"agola.io/agola/internal/util"
 
 	"github.com/google/go-cmp/cmp"
+	errors "golang.org/x/xerrors"
 )
 
 func setupEtcd(t *testing.T, dir string) *testutil.TestEmbeddedEtcd {
@@ -661,6 +662,227 @@ func TestProjectGroupDelete(t *testing.T) {
 	}
 }
 
+func TestTrash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+
+	cs, tetcd := setupConfigstore(t, ctx, dir)
+	defer shutdownEtcd(tetcd)
+
+	// enable the trash
+	cs.ah = action.NewActionHandler(logger, cs.readDB, cs.dm, nil, 24*time.Hour)
+
+	t.Logf("starting cs")
+	go func() { _ = cs.Run(ctx) }()
+
+	time.Sleep(2 * time.Second)
+
+	org, err := cs.ah.CreateOrg(ctx, &types.Organization{Name: "org01", Visibility: types.VisibilityPublic})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	time.Sleep(2 * time.Second)
+
+	rootPath := path.Join("org", org.Name)
+	pg01, err := cs.ah.CreateProjectGroup(ctx, &types.ProjectGroup{Name: "projectgroup01", Parent: types.Parent{Type: types.ConfigTypeProjectGroup, ID: rootPath}, Visibility: types.VisibilityPublic})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	spg01, err := cs.ah.CreateProjectGroup(ctx, &types.ProjectGroup{Name: "subprojectgroup01", Parent: types.Parent{Type: types.ConfigTypeProjectGroup, ID: pg01.ID}, Visibility: types.VisibilityPublic})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	project, err := cs.ah.CreateProject(ctx, &types.Project{Name: "project01", Parent: types.Parent{Type: types.ConfigTypeProjectGroup, ID: spg01.ID}, Visibility: types.VisibilityPublic, RemoteRepositoryConfigType: types.RemoteRepositoryConfigTypeManual})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	secret, err := cs.ah.CreateSecret(ctx, &types.Secret{Name: "secret01", Parent: types.Parent{Type: types.ConfigTypeProject, ID: project.ID}, Type: types.SecretTypeInternal, Data: map[string]string{"secret01": "secretvar01"}})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	variable, err := cs.ah.CreateVariable(ctx, &types.Variable{Name: "variable01", Parent: types.Parent{Type: types.ConfigTypeProject, ID: project.ID}, Values: []types.VariableValue{{SecretName: "secret01", SecretVar: "secretvar01"}}})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := cs.ah.DeleteProjectGroup(ctx, pg01.ID); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	time.Sleep(2 * time.Second)
+
+	getProject := func(projectRef string) *types.Project {
+		var p *types.Project
+		err := cs.readDB.Do(func(tx *db.Tx) error {
+			var err error
+			p, err = cs.readDB.GetProject(tx, projectRef)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		return p
+	}
+
+	if p := getProject(project.ID); p != nil {
+		t.Fatalf("expected project deleted")
+	}
+
+	tis, err := cs.ah.GetProjectGroupTrashItems(ctx, rootPath)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(tis) != 1 {
+		t.Fatalf("expected 1 trash item, got %d", len(tis))
+	}
+	ti := tis[0]
+	if ti.ObjectType != types.ConfigTypeProjectGroup || ti.ObjectID != pg01.ID || ti.Path != path.Join(rootPath, pg01.Name) {
+		t.Fatalf("unexpected trash item: %s", util.Dump(ti))
+	}
+	if len(ti.ProjectGroups) != 2 || len(ti.Projects) != 1 || len(ti.Secrets) != 1 || len(ti.Variables) != 1 {
+		t.Fatalf("unexpected trash item objects: %s", util.Dump(ti))
+	}
+
+	t.Run("test restore", func(t *testing.T) {
+		if _, err := cs.ah.RestoreTrashItem(ctx, ti.ID); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		time.Sleep(2 * time.Second)
+
+		p := getProject(path.Join(rootPath, pg01.Name, spg01.Name, project.Name))
+		if diff := cmp.Diff(p, project); diff != "" {
+			t.Error(diff)
+		}
+		secrets, err := cs.ah.GetSecrets(ctx, types.ConfigTypeProject, project.ID, false)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if diff := cmp.Diff(secrets, []*types.Secret{secret}); diff != "" {
+			t.Error(diff)
+		}
+		variables, err := cs.ah.GetVariables(ctx, types.ConfigTypeProject, project.ID, false)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if diff := cmp.Diff(variables, []*types.Variable{variable}); diff != "" {
+			t.Error(diff)
+		}
+
+		tis, err := cs.ah.GetProjectGroupTrashItems(ctx, rootPath)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if len(tis) != 0 {
+			t.Fatalf("expected 0 trash items, got %d", len(tis))
+		}
+	})
+
+	t.Run("test purge", func(t *testing.T) {
+		if err := cs.ah.DeleteProject(ctx, project.ID); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		time.Sleep(2 * time.Second)
+
+		// the trash item isn't expired
+		tis, err := cs.ah.GetExpiredTrashItems(ctx)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if len(tis) != 0 {
+			t.Fatalf("expected 0 expired trash items, got %d", len(tis))
+		}
+
+		ah := action.NewActionHandler(logger, cs.readDB, cs.dm, nil, time.Nanosecond)
+		tis, err = ah.GetExpiredTrashItems(ctx)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if len(tis) != 1 {
+			t.Fatalf("expected 1 expired trash item, got %d", len(tis))
+		}
+		if len(tis[0].Projects) != 1 || tis[0].Projects[0].ID != project.ID {
+			t.Fatalf("unexpected trash item objects: %s", util.Dump(tis[0]))
+		}
+		if err := ah.PurgeTrashItem(ctx, tis[0].ID); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		time.Sleep(2 * time.Second)
+
+		tis, err = cs.ah.GetProjectGroupTrashItems(ctx, rootPath)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if len(tis) != 0 {
+			t.Fatalf("expected 0 trash items, got %d", len(tis))
+		}
+	})
+}
+
+func TestProjectGroupSettings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+
+	cs, tetcd := setupConfigstore(t, ctx, dir)
+	defer shutdownEtcd(tetcd)
+
+	parent := types.Parent{Type: types.ConfigTypeProjectGroup, ID: "org/org01"}
+
+	tests := []struct {
+		name     string
+		settings *types.ProjectGroupSettings
+		valid    bool
+	}{
+		{
+			name:  "test no settings",
+			valid: true,
+		},
+		{
+			name:     "test valid settings",
+			settings: &types.ProjectGroupSettings{DefaultVisibility: types.VisibilityPrivate, RunDefaults: &types.ProjectRunDefaults{MaxTasks: 10, AllowedArchs: []string{"amd64", "arm64"}}},
+			valid:    true,
+		},
+		{
+			name:     "test invalid default visibility",
+			settings: &types.ProjectGroupSettings{DefaultVisibility: "unknown"},
+		},
+		{
+			name:     "test invalid allowed arch",
+			settings: &types.ProjectGroupSettings{RunDefaults: &types.ProjectRunDefaults{AllowedArchs: []string{"sparc"}}},
+		},
+		{
+			name:     "test negative max tasks",
+			settings: &types.ProjectGroupSettings{RunDefaults: &types.ProjectRunDefaults{MaxTasks: -1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pg := &types.ProjectGroup{Name: "projectgroup01", Parent: parent, Visibility: types.VisibilityPublic, Settings: tt.settings}
+			err := cs.ah.ValidateProjectGroup(ctx, pg)
+			if tt.valid && err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if !tt.valid && !errors.Is(err, &util.ErrBadRequest{}) {
+				t.Fatalf("expected bad request error, got: %v", err)
+			}
+		})
+	}
+}
+
 func TestOrgMembers(t *testing.T) {
 	dir, err := ioutil.TempDir("", "agola")
 	if err != nil {
@@ -751,6 +973,285 @@ func TestOrgMembers(t *testing.T) {
 
 }
 
+func TestUserSessions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+
+	cs, tetcd := setupConfigstore(t, ctx, dir)
+	defer shutdownEtcd(tetcd)
+
+	t.Logf("starting cs")
+	go func() { _ = cs.Run(ctx) }()
+
+	time.Sleep(2 * time.Second)
+
+	user, err := cs.ah.CreateUser(ctx, &action.CreateUserRequest{UserName: "user01"})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	time.Sleep(2 * time.Second)
+
+	sessionID, err := cs.ah.CreateUserSession(ctx, user.ID, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	time.Sleep(2 * time.Second)
+
+	if _, err := cs.ah.CreateUserToken(ctx, &action.CreateUserTokenRequest{UserRef: user.ID, TokenName: "token01"}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	time.Sleep(2 * time.Second)
+
+	lastUsedAt := time.Now().UTC().Truncate(time.Second)
+	areq := &action.UpdateUserAccessUsageRequest{
+		UserRef: user.ID,
+		Sessions: map[string]*action.AccessUsage{
+			sessionID:   {LastUsedAt: lastUsedAt, LastUsedIP: "10.0.0.1"},
+			"deleted01": {LastUsedAt: lastUsedAt, LastUsedIP: "10.0.0.1"},
+		},
+		Tokens: map[string]*action.AccessUsage{
+			"token01": {LastUsedAt: lastUsedAt, LastUsedIP: "10.0.0.2"},
+		},
+	}
+	if err := cs.ah.UpdateUserAccessUsage(ctx, areq); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	time.Sleep(2 * time.Second)
+
+	// an older usage doesn't overwrite the newer one
+	areq = &action.UpdateUserAccessUsageRequest{
+		UserRef: user.ID,
+		Sessions: map[string]*action.AccessUsage{
+			sessionID: {LastUsedAt: lastUsedAt.Add(-time.Minute), LastUsedIP: "10.0.0.3"},
+		},
+	}
+	if err := cs.ah.UpdateUserAccessUsage(ctx, areq); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	time.Sleep(2 * time.Second)
+
+	t.Run("test sessions and tokens usage", func(t *testing.T) {
+		users, err := getUsers(cs)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		u := users[0]
+		s, ok := u.Sessions[sessionID]
+		if !ok {
+			t.Fatalf("expected session %q", sessionID)
+		}
+		if !s.LastUsedAt.Equal(lastUsedAt) || s.LastUsedIP != "10.0.0.1" {
+			t.Fatalf("unexpected session usage: %v, %s", s.LastUsedAt, s.LastUsedIP)
+		}
+		ti, ok := u.TokensInfo["token01"]
+		if !ok {
+			t.Fatalf("expected token %q info", "token01")
+		}
+		if !ti.LastUsedAt.Equal(lastUsedAt) || ti.LastUsedIP != "10.0.0.2" {
+			t.Fatalf("unexpected token usage: %v, %s", ti.LastUsedAt, ti.LastUsedIP)
+		}
+	})
+
+	t.Run("test delete all sessions and tokens", func(t *testing.T) {
+		if err := cs.ah.DeleteUserSessions(ctx, user.ID); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		time.Sleep(2 * time.Second)
+
+		users, err := getUsers(cs)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		u := users[0]
+		if len(u.Sessions) != 0 || len(u.Tokens) != 0 || len(u.TokensInfo) != 0 {
+			t.Fatalf("expected no sessions and tokens, got sessions: %v, tokens: %v", u.Sessions, u.Tokens)
+		}
+	})
+}
+
+func TestUserTOTP(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+
+	cs, tetcd := setupConfigstore(t, ctx, dir)
+	defer shutdownEtcd(tetcd)
+
+	t.Logf("starting cs")
+	go func() { _ = cs.Run(ctx) }()
+
+	time.Sleep(2 * time.Second)
+
+	user, err := cs.ah.CreateUser(ctx, &action.CreateUserRequest{UserName: "user01"})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	time.Sleep(2 * time.Second)
+
+	secret, err := util.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, err := cs.ah.UpdateUser(ctx, &action.UpdateUserRequest{UserRef: user.ID, TOTP: &types.UserTOTP{Secret: secret}}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	time.Sleep(2 * time.Second)
+
+	now := time.Now()
+	code, err := util.TOTPCode(secret, now)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	checkCode := func(t *testing.T, code string, enable, expectedValid, expectedLocked bool) {
+		res, err := cs.ah.CheckUserTOTPCode(ctx, &action.CheckUserTOTPCodeRequest{UserRef: user.ID, Code: code, Enable: enable})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if res.Valid != expectedValid {
+			t.Fatalf("expected valid %t, got %t", expectedValid, res.Valid)
+		}
+		if (res.LockedUntil != nil) != expectedLocked {
+			t.Fatalf("expected locked %t, got locked until %v", expectedLocked, res.LockedUntil)
+		}
+		time.Sleep(2 * time.Second)
+	}
+
+	t.Run("test enable with valid code", func(t *testing.T) {
+		checkCode(t, code, true, true, false)
+
+		users, err := getUsers(cs)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if !users[0].TOTP.Enabled {
+			t.Fatalf("expected two factor authentication enabled")
+		}
+	})
+
+	t.Run("test reused code is rejected", func(t *testing.T) {
+		checkCode(t, code, false, false, false)
+	})
+
+	t.Run("test lockout after too many invalid codes", func(t *testing.T) {
+		// the reused code already counted as a failed attempt
+		for i := 1; i < action.MaxTOTPFailedAttempts-1; i++ {
+			checkCode(t, "000000", false, false, false)
+		}
+		checkCode(t, "000000", false, false, true)
+
+		// a valid unused code is rejected while locked
+		nextCode, err := util.TOTPCode(secret, now.Add(30*time.Second))
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		checkCode(t, nextCode, false, false, true)
+	})
+}
+
+func TestUserNotifications(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+
+	cs, tetcd := setupConfigstore(t, ctx, dir)
+	defer shutdownEtcd(tetcd)
+
+	t.Logf("starting cs")
+	go func() { _ = cs.Run(ctx) }()
+
+	// TODO: change the sleep with a real check that all is ready
+	time.Sleep(2 * time.Second)
+
+	user, err := cs.ah.CreateUser(ctx, &action.CreateUserRequest{UserName: "user01"})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// TODO: change the sleep with a real check that user is in readdb
+	time.Sleep(2 * time.Second)
+
+	if _, err := cs.ah.CreateUserNotification(ctx, user.ID, &types.UserNotification{Type: "unknown", Title: "title"}); !errors.Is(err, &util.ErrBadRequest{}) {
+		t.Fatalf("expected bad request error, got: %v", err)
+	}
+
+	ids := []string{}
+	for i := 0; i < 3; i++ {
+		un, err := cs.ah.CreateUserNotification(ctx, user.ID, &types.UserNotification{Type: types.UserNotificationTypeRunFailed, Title: fmt.Sprintf("run %d failed", i)})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		ids = append(ids, un.ID)
+	}
+	time.Sleep(2 * time.Second)
+
+	t.Run("test list and unread count", func(t *testing.T) {
+		uns, err := cs.ah.GetUserNotifications(ctx, user.ID, false, 0)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if len(uns) != 3 {
+			t.Fatalf("expected 3 notifications, got %d", len(uns))
+		}
+		// newest first
+		if uns[0].ID != ids[2] {
+			t.Fatalf("expected notification %q, got %q", ids[2], uns[0].ID)
+		}
+		count, err := cs.ah.GetUserNotificationsUnreadCount(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if count != 3 {
+			t.Fatalf("expected 3 unread notifications, got %d", count)
+		}
+	})
+
+	t.Run("test mark read", func(t *testing.T) {
+		if err := cs.ah.MarkUserNotificationsRead(ctx, user.ID, []string{ids[0]}); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		time.Sleep(2 * time.Second)
+
+		uns, err := cs.ah.GetUserNotifications(ctx, user.ID, true, 0)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if len(uns) != 2 {
+			t.Fatalf("expected 2 unread notifications, got %d", len(uns))
+		}
+
+		if err := cs.ah.MarkUserNotificationsRead(ctx, user.ID, []string{"unexistent"}); !errors.Is(err, &util.ErrNotFound{}) {
+			t.Fatalf("expected not found error, got: %v", err)
+		}
+
+		if err := cs.ah.MarkUserNotificationsRead(ctx, user.ID, nil); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		time.Sleep(2 * time.Second)
+
+		count, err := cs.ah.GetUserNotificationsUnreadCount(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if count != 0 {
+			t.Fatalf("expected 0 unread notifications, got %d", count)
+		}
+	})
+}
+
 func TestRemoteSource(t *testing.T) {
 	dir, err := ioutil.TempDir("", "agola")
 	if err != nil {
@@ -919,3 +1420,216 @@ func TestRemoteSource(t *testing.T) {
 		})
 	}
 }
+
+func TestPathAliases(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+
+	cs, tetcd := setupConfigstore(t, ctx, dir)
+	defer shutdownEtcd(tetcd)
+
+	t.Logf("starting cs")
+	go func() { _ = cs.Run(ctx) }()
+
+	// TODO: change the sleep with a real check that all is ready
+	time.Sleep(2 * time.Second)
+
+	org, err := cs.ah.CreateOrg(ctx, &types.Organization{Name: "org01", Visibility: types.VisibilityPublic})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// TODO: change the sleep with a real check that org is in readdb
+	time.Sleep(2 * time.Second)
+
+	rootPath := path.Join("org", org.Name)
+	pg, err := cs.ah.CreateProjectGroup(ctx, &types.ProjectGroup{Name: "projectgroup01", Parent: types.Parent{Type: types.ConfigTypeProjectGroup, ID: rootPath}, Visibility: types.VisibilityPublic})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	project, err := cs.ah.CreateProject(ctx, &types.Project{Name: "project01", Parent: types.Parent{Type: types.ConfigTypeProjectGroup, ID: pg.ID}, Visibility: types.VisibilityPublic, RemoteRepositoryConfigType: types.RemoteRepositoryConfigTypeManual})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	pg.Name = "projectgroup02"
+	if _, err := cs.ah.UpdateProjectGroup(ctx, &action.UpdateProjectGroupRequest{ProjectGroupRef: pg.ID, ProjectGroup: pg}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	project.Name = "project02"
+	if _, err := cs.ah.UpdateProject(ctx, &action.UpdateProjectRequest{ProjectRef: project.ID, Project: project}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// TODO: change the sleep with a real check that the updates are in readdb
+	time.Sleep(2 * time.Second)
+
+	tests := []struct {
+		name       string
+		objectType types.ConfigType
+		path       string
+		out        string
+	}{
+		{
+			name:       "test project group old path",
+			objectType: types.ConfigTypeProjectGroup,
+			path:       path.Join(rootPath, "projectgroup01"),
+			out:        path.Join(rootPath, "projectgroup02"),
+		},
+		{
+			name:       "test project old path",
+			objectType: types.ConfigTypeProject,
+			path:       path.Join(rootPath, "projectgroup02", "project01"),
+			out:        path.Join(rootPath, "projectgroup02", "project02"),
+		},
+		{
+			name:       "test project old path in project group old path",
+			objectType: types.ConfigTypeProject,
+			path:       path.Join(rootPath, "projectgroup01", "project01"),
+			out:        path.Join(rootPath, "projectgroup02", "project02"),
+		},
+		{
+			name:       "test project current name in project group old path",
+			objectType: types.ConfigTypeProject,
+			path:       path.Join(rootPath, "projectgroup01", "project02"),
+			out:        path.Join(rootPath, "projectgroup02", "project02"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := cs.ah.ResolvePathAlias(ctx, tt.objectType, tt.path)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if res.Path != tt.out {
+				t.Fatalf("expected path %q, got %q", tt.out, res.Path)
+			}
+			if res.Alias == nil {
+				t.Fatalf("expected path resolved by an alias")
+			}
+		})
+	}
+
+	t.Run("test current path", func(t *testing.T) {
+		res, err := cs.ah.ResolvePathAlias(ctx, types.ConfigTypeProject, path.Join(rootPath, "projectgroup02", "project02"))
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if res.ID != project.ID || res.Alias != nil {
+			t.Fatalf("unexpected resolution: %s", util.Dump(res))
+		}
+	})
+
+	t.Run("test unknown path", func(t *testing.T) {
+		_, err := cs.ah.ResolvePathAlias(ctx, types.ConfigTypeProject, path.Join(rootPath, "projectgroup02", "project03"))
+		if !errors.Is(err, &util.ErrNotFound{}) {
+			t.Fatalf("expected not found error, got: %v", err)
+		}
+	})
+
+	t.Run("test alias history", func(t *testing.T) {
+		pas, err := cs.ah.GetProjectPathAliases(ctx, project.ID)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if len(pas) != 1 || pas[0].Path != path.Join(rootPath, "projectgroup02", "project01") {
+			t.Fatalf("unexpected project path aliases: %s", util.Dump(pas))
+		}
+		pas, err = cs.ah.GetProjectGroupPathAliases(ctx, pg.ID)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if len(pas) != 1 || pas[0].Path != path.Join(rootPath, "projectgroup01") {
+			t.Fatalf("unexpected project group path aliases: %s", util.Dump(pas))
+		}
+	})
+
+	t.Run("test existing object takes precedence over alias", func(t *testing.T) {
+		npg, err := cs.ah.CreateProjectGroup(ctx, &types.ProjectGroup{Name: "projectgroup01", Parent: types.Parent{Type: types.ConfigTypeProjectGroup, ID: rootPath}, Visibility: types.VisibilityPublic})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		// TODO: change the sleep with a real check that the project group is in readdb
+		time.Sleep(2 * time.Second)
+
+		res, err := cs.ah.ResolvePathAlias(ctx, types.ConfigTypeProjectGroup, path.Join(rootPath, "projectgroup01"))
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if res.ID != npg.ID || res.Alias != nil {
+			t.Fatalf("unexpected resolution: %s", util.Dump(res))
+		}
+	})
+}
+
+func TestWatchChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+
+	cs, tetcd := setupConfigstore(t, ctx, dir)
+	defer shutdownEtcd(tetcd)
+
+	t.Logf("starting cs")
+	go func() { _ = cs.Run(ctx) }()
+
+	// TODO: change the sleep with a real check that all is ready
+	time.Sleep(2 * time.Second)
+
+	ce := cs.ah.WatchChanges(ctx, "", nil, 0)
+	if ce.Seq == "" || len(ce.Events) != 0 {
+		t.Fatalf("unexpected change events: %s", util.Dump(ce))
+	}
+	seq := ce.Seq
+
+	org, err := cs.ah.CreateOrg(ctx, &types.Organization{Name: "org01", Visibility: types.VisibilityPublic})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	t.Run("test wait for change events", func(t *testing.T) {
+		ce := cs.ah.WatchChanges(ctx, seq, []types.ConfigType{types.ConfigTypeProjectGroup}, 10*time.Second)
+		if len(ce.Events) != 1 {
+			t.Fatalf("expected 1 change event, got: %s", util.Dump(ce))
+		}
+		ev := ce.Events[0]
+		if ev.DataType != types.ConfigTypeProjectGroup || ev.Deleted {
+			t.Fatalf("unexpected change event: %s", util.Dump(ev))
+		}
+		if ce.Seq <= seq {
+			t.Fatalf("expected seq greater than %q, got %q", seq, ce.Seq)
+		}
+	})
+
+	t.Run("test timeout without change events", func(t *testing.T) {
+		ce := cs.ah.WatchChanges(ctx, seq, []types.ConfigType{types.ConfigTypeSecret}, 1*time.Second)
+		if len(ce.Events) != 0 || ce.Reset {
+			t.Fatalf("unexpected change events: %s", util.Dump(ce))
+		}
+	})
+
+	t.Run("test delete change events", func(t *testing.T) {
+		ce := cs.ah.WatchChanges(ctx, "", nil, 0)
+		seq := ce.Seq
+
+		if err := cs.ah.DeleteOrg(ctx, org.Name); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		ce = cs.ah.WatchChanges(ctx, seq, []types.ConfigType{types.ConfigTypeOrg}, 10*time.Second)
+		if len(ce.Events) != 1 || ce.Events[0].ID != org.ID || !ce.Events[0].Deleted {
+			t.Fatalf("unexpected change events: %s", util.Dump(ce))
+		}
+	})
+}
@@ -0,0 +1,152 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package readdb
+
+import (
+	"sync"
+
+	"agola.io/agola/internal/datamanager"
+	"agola.io/agola/internal/services/types"
+)
+
+// maxChangeEvents is the max number of change events kept in memory
+const maxChangeEvents = 10000
+
+// emptyChangesSeq is the change events sequence when no wal has been applied.
+// It sorts before all the wal sequences.
+const emptyChangesSeq = "0"
+
+// ChangeEvent is the change of an object applied to the readdb. Seq is the
+// sequence of the wal containing the change, the events of the same wal have
+// the same Seq.
+type ChangeEvent struct {
+	Seq      string
+	DataType types.ConfigType
+	ID       string
+	Deleted  bool
+}
+
+// ChangeEvents are the change events after a sequence
+type ChangeEvents struct {
+	Events []*ChangeEvent
+	// Seq is the sequence of the last applied wal
+	Seq string
+	// Reset is true when the events after the requested sequence aren't
+	// available anymore. The watcher must sync again the state of the objects
+	// and then get the change events after Seq.
+	Reset bool
+}
+
+// changes keeps the latest change events applied to the readdb
+type changes struct {
+	mu sync.Mutex
+	// startSeq is the sequence after which all the events are available
+	startSeq string
+	seq      string
+	events   []*ChangeEvent
+	// notifyCh is closed and replaced when new events are added
+	notifyCh chan struct{}
+}
+
+func newChanges() *changes {
+	return &changes{notifyCh: make(chan struct{})}
+}
+
+// reset removes all the events, the events before seq are not available
+// anymore
+func (c *changes) reset(seq string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if seq == "" {
+		seq = emptyChangesSeq
+	}
+
+	c.startSeq = seq
+	c.seq = seq
+	c.events = nil
+	c.notify()
+}
+
+func (c *changes) add(seq string, actions []*datamanager.Action) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, action := range actions {
+		c.events = append(c.events, &ChangeEvent{
+			Seq:      seq,
+			DataType: types.ConfigType(action.DataType),
+			ID:       action.ID,
+			Deleted:  action.ActionType == datamanager.ActionTypeDelete,
+		})
+	}
+	if len(c.events) > maxChangeEvents {
+		// remove the oldest events, keeping the ones of the same wal of the
+		// first kept event
+		i := len(c.events) - maxChangeEvents
+		c.startSeq = c.events[i-1].Seq
+		for i < len(c.events) && c.events[i].Seq == c.startSeq {
+			i++
+		}
+		c.events = append([]*ChangeEvent(nil), c.events[i:]...)
+	}
+	c.seq = seq
+	c.notify()
+}
+
+func (c *changes) notify() {
+	close(c.notifyCh)
+	c.notifyCh = make(chan struct{})
+}
+
+// GetChangeEvents returns the change events after the provided sequence with
+// one of the provided data types (all the data types when empty). The
+// returned channel is closed when new events are available. The returned
+// sequence is empty until the readdb is initialized.
+func (r *ReadDB) GetChangeEvents(afterSeq string, dataTypes []types.ConfigType) (*ChangeEvents, <-chan struct{}) {
+	c := r.changes
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ce := &ChangeEvents{Events: []*ChangeEvent{}, Seq: c.seq}
+	if afterSeq == "" {
+		return ce, c.notifyCh
+	}
+	if afterSeq < c.startSeq {
+		ce.Reset = true
+		return ce, c.notifyCh
+	}
+
+	for _, ev := range c.events {
+		if ev.Seq <= afterSeq {
+			continue
+		}
+		if len(dataTypes) > 0 && !containsConfigType(dataTypes, ev.DataType) {
+			continue
+		}
+		ce.Events = append(ce.Events, ev)
+	}
+
+	return ce, c.notifyCh
+}
+
+func containsConfigType(configTypes []types.ConfigType, configType types.ConfigType) bool {
+	for _, t := range configTypes {
+		if t == configType {
+			return true
+		}
+	}
+	return false
+}
@@ -53,4 +53,17 @@ var Stmts = []string{
 
 	"create table variable (id uuid, name varchar, parentid varchar, parenttype varchar, data bytea, PRIMARY KEY (id))",
 	"create index variable_name on variable(name)",
+
+	"create table projectchange (id uuid, projectid uuid, changetime bigint, data bytea, PRIMARY KEY (id))",
+	"create index projectchange_projectid on projectchange(projectid)",
+
+	"create table usernotification (id uuid, userid uuid, creationtime bigint, read boolean, data bytea, PRIMARY KEY (id))",
+	"create index usernotification_userid on usernotification(userid)",
+
+	"create table trashitem (id uuid, ownerid uuid, deletiontime bigint, data bytea, PRIMARY KEY (id))",
+	"create index trashitem_ownerid on trashitem(ownerid)",
+
+	"create table pathalias (id uuid, path varchar, objectid uuid, creationtime bigint, data bytea, PRIMARY KEY (id))",
+	"create index pathalias_path on pathalias(path)",
+	"create index pathalias_objectid on pathalias(objectid)",
 }
@@ -0,0 +1,136 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package readdb
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	sq "github.com/Masterminds/squirrel"
+	errors "golang.org/x/xerrors"
+)
+
+var (
+	pathaliasSelect = sb.Select("id", "data").From("pathalias")
+	pathaliasInsert = sb.Insert("pathalias").Columns("id", "path", "objectid", "creationtime", "data")
+)
+
+func (r *ReadDB) insertPathAlias(tx *db.Tx, data []byte) error {
+	pa := types.PathAlias{}
+	if err := json.Unmarshal(data, &pa); err != nil {
+		return errors.Errorf("failed to unmarshal path alias: %w", err)
+	}
+	// poor man insert or update...
+	if err := r.deletePathAlias(tx, pa.ID); err != nil {
+		return err
+	}
+	q, args, err := pathaliasInsert.Values(pa.ID, pa.Path, pa.ObjectID, pa.CreationTime.UnixNano(), data).ToSql()
+	if err != nil {
+		return errors.Errorf("failed to build query: %w", err)
+	}
+	if _, err = tx.Exec(q, args...); err != nil {
+		return errors.Errorf("failed to insert path alias: %w", err)
+	}
+
+	return nil
+}
+
+func (r *ReadDB) deletePathAlias(tx *db.Tx, id string) error {
+	// poor man insert or update...
+	if _, err := tx.Exec("delete from pathalias where id = $1", id); err != nil {
+		return errors.Errorf("failed to delete path alias: %w", err)
+	}
+	return nil
+}
+
+func (r *ReadDB) GetPathAliasByPath(tx *db.Tx, aliasPath string) (*types.PathAlias, error) {
+	q, args, err := pathaliasSelect.Where(sq.Eq{"path": aliasPath}).ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+
+	pas, _, err := fetchPathAliases(tx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(pas) > 1 {
+		return nil, errors.Errorf("too many rows returned")
+	}
+	if len(pas) == 0 {
+		return nil, nil
+	}
+	return pas[0], nil
+}
+
+// GetObjectPathAliases returns the object path aliases from the newest to the
+// oldest
+func (r *ReadDB) GetObjectPathAliases(tx *db.Tx, objectID string) ([]*types.PathAlias, error) {
+	q, args, err := pathaliasSelect.Where(sq.Eq{"objectid": objectID}).OrderBy("creationtime desc").ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+
+	pas, _, err := fetchPathAliases(tx, q, args...)
+	return pas, err
+}
+
+func fetchPathAliases(tx *db.Tx, q string, args ...interface{}) ([]*types.PathAlias, []string, error) {
+	rows, err := tx.Query(q, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	return scanPathAliases(rows)
+}
+
+func scanPathAlias(rows *sql.Rows, additionalFields ...interface{}) (*types.PathAlias, string, error) {
+	var id string
+	var data []byte
+	if err := rows.Scan(&id, &data); err != nil {
+		return nil, "", errors.Errorf("failed to scan rows: %w", err)
+	}
+	pa := types.PathAlias{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &pa); err != nil {
+			return nil, "", errors.Errorf("failed to unmarshal path alias: %w", err)
+		}
+	}
+
+	return &pa, id, nil
+}
+
+func scanPathAliases(rows *sql.Rows) ([]*types.PathAlias, []string, error) {
+	pas := []*types.PathAlias{}
+	ids := []string{}
+	for rows.Next() {
+		pa, id, err := scanPathAlias(rows)
+		if err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		pas = append(pas, pa)
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	return pas, ids, nil
+}
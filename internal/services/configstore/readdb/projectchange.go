@@ -0,0 +1,139 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package readdb
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	sq "github.com/Masterminds/squirrel"
+	errors "golang.org/x/xerrors"
+)
+
+var (
+	projectchangeSelect = sb.Select("id", "data").From("projectchange")
+	projectchangeInsert = sb.Insert("projectchange").Columns("id", "projectid", "changetime", "data")
+)
+
+func (r *ReadDB) insertProjectChange(tx *db.Tx, data []byte) error {
+	pc := types.ProjectChange{}
+	if err := json.Unmarshal(data, &pc); err != nil {
+		return errors.Errorf("failed to unmarshal project change: %w", err)
+	}
+	// poor man insert or update...
+	if err := r.deleteProjectChange(tx, pc.ID); err != nil {
+		return err
+	}
+	q, args, err := projectchangeInsert.Values(pc.ID, pc.ProjectID, pc.ChangeTime.UnixNano(), data).ToSql()
+	if err != nil {
+		return errors.Errorf("failed to build query: %w", err)
+	}
+	if _, err = tx.Exec(q, args...); err != nil {
+		return errors.Errorf("failed to insert project change: %w", err)
+	}
+
+	return nil
+}
+
+func (r *ReadDB) deleteProjectChange(tx *db.Tx, id string) error {
+	// poor man insert or update...
+	if _, err := tx.Exec("delete from projectchange where id = $1", id); err != nil {
+		return errors.Errorf("failed to delete project change: %w", err)
+	}
+	return nil
+}
+
+func (r *ReadDB) GetProjectChange(tx *db.Tx, projectID, projectChangeID string) (*types.ProjectChange, error) {
+	q, args, err := projectchangeSelect.Where(sq.Eq{"id": projectChangeID, "projectid": projectID}).ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+
+	pcs, _, err := fetchProjectChanges(tx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(pcs) > 1 {
+		return nil, errors.Errorf("too many rows returned")
+	}
+	if len(pcs) == 0 {
+		return nil, nil
+	}
+	return pcs[0], nil
+}
+
+// GetProjectChanges returns the project changes from the newest to the oldest
+func (r *ReadDB) GetProjectChanges(tx *db.Tx, projectID string, limit int) ([]*types.ProjectChange, error) {
+	s := projectchangeSelect.Where(sq.Eq{"projectid": projectID}).OrderBy("changetime desc")
+	if limit > 0 {
+		s = s.Limit(uint64(limit))
+	}
+	q, args, err := s.ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+
+	pcs, _, err := fetchProjectChanges(tx, q, args...)
+	return pcs, err
+}
+
+func fetchProjectChanges(tx *db.Tx, q string, args ...interface{}) ([]*types.ProjectChange, []string, error) {
+	rows, err := tx.Query(q, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	return scanProjectChanges(rows)
+}
+
+func scanProjectChange(rows *sql.Rows, additionalFields ...interface{}) (*types.ProjectChange, string, error) {
+	var id string
+	var data []byte
+	if err := rows.Scan(&id, &data); err != nil {
+		return nil, "", errors.Errorf("failed to scan rows: %w", err)
+	}
+	pc := types.ProjectChange{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &pc); err != nil {
+			return nil, "", errors.Errorf("failed to unmarshal project change: %w", err)
+		}
+	}
+
+	return &pc, id, nil
+}
+
+func scanProjectChanges(rows *sql.Rows) ([]*types.ProjectChange, []string, error) {
+	pcs := []*types.ProjectChange{}
+	ids := []string{}
+	for rows.Next() {
+		pc, id, err := scanProjectChange(rows)
+		if err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		pcs = append(pcs, pc)
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	return pcs, ids, nil
+}
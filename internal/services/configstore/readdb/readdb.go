@@ -62,6 +62,9 @@ type ReadDB struct {
 
 	Initialized bool
 	initLock    sync.Mutex
+
+	// changes are the latest change events applied from the etcd wals
+	changes *changes
 }
 
 func NewReadDB(ctx context.Context, logger *zap.Logger, dataDir string, e *etcd.Store, ost *objectstorage.ObjStorage, dm *datamanager.DataManager) (*ReadDB, error) {
@@ -85,6 +88,7 @@ func NewReadDB(ctx context.Context, logger *zap.Logger, dataDir string, e *etcd.
 		e:       e,
 		ost:     ost,
 		dm:      dm,
+		changes: newChanges(),
 	}
 
 	return readDB, nil
@@ -109,6 +113,19 @@ func (r *ReadDB) Initialize(ctx context.Context) error {
 	if err := r.SyncRDB(ctx); err != nil {
 		return errors.Errorf("error syncing db: %w", err)
 	}
+
+	// the changes applied by the sync don't have change events
+	var curWalSeq string
+	err := r.rdb.Do(func(tx *db.Tx) error {
+		var err error
+		curWalSeq, err = r.GetCommittedWalSequence(tx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	r.changes.reset(curWalSeq)
+
 	return nil
 }
 
@@ -209,7 +226,7 @@ func (r *ReadDB) SyncFromWals(startWalSeq, endWalSeq string) (string, error) {
 				if err := r.insertCommittedWalSequence(tx, walFile.WalSequence); err != nil {
 					return err
 				}
-				if err := r.applyWal(tx, header.WalDataFileID); err != nil {
+				if _, err := r.applyWal(tx, header.WalDataFileID); err != nil {
 					return err
 				}
 			}
@@ -376,7 +393,7 @@ func (r *ReadDB) SyncRDB(ctx context.Context) error {
 			}
 
 			r.log.Debugf("applying wal to db")
-			if err := r.applyWal(tx, walElement.WalData.WalDataFileID); err != nil {
+			if _, err := r.applyWal(tx, walElement.WalData.WalDataFileID); err != nil {
 				return err
 			}
 		}
@@ -502,7 +519,9 @@ func (r *ReadDB) handleEvents(ctx context.Context) error {
 
 		// a single transaction for every response (every response contains all the
 		// events happened in an etcd revision).
+		var actions []*datamanager.Action
 		err = r.rdb.Do(func(tx *db.Tx) error {
+			actions = nil
 
 			// if theres a wal seq epoch change something happened to etcd, usually (if
 			// the user hasn't messed up with etcd keys) this means etcd has been reset
@@ -533,7 +552,8 @@ func (r *ReadDB) handleEvents(ctx context.Context) error {
 				}
 			}
 
-			if err := r.handleEvent(tx, we); err != nil {
+			actions, err = r.handleEvent(tx, we)
+			if err != nil {
 				return err
 			}
 
@@ -545,52 +565,55 @@ func (r *ReadDB) handleEvents(ctx context.Context) error {
 		if err != nil {
 			return err
 		}
+		if len(actions) > 0 {
+			r.changes.add(we.WalData.WalSequence, actions)
+		}
 	}
 	r.log.Infof("wch closed")
 
 	return nil
 }
 
-func (r *ReadDB) handleEvent(tx *db.Tx, we *datamanager.WatchElement) error {
+// handleEvent applies the watch element and returns the applied wal actions
+func (r *ReadDB) handleEvent(tx *db.Tx, we *datamanager.WatchElement) ([]*datamanager.Action, error) {
 	//r.log.Debugf("event: %s %q : %q\n", ev.Type, ev.Kv.Key, ev.Kv.Value)
 	//key := string(ev.Kv.Key)
 
-	if err := r.handleWalEvent(tx, we); err != nil {
-		return err
-	}
-	return nil
+	return r.handleWalEvent(tx, we)
 }
 
-func (r *ReadDB) handleWalEvent(tx *db.Tx, we *datamanager.WatchElement) error {
+func (r *ReadDB) handleWalEvent(tx *db.Tx, we *datamanager.WatchElement) ([]*datamanager.Action, error) {
 	for cgName, cgRev := range we.ChangeGroupsRevisions {
 		if err := r.insertChangeGroupRevision(tx, cgName, cgRev); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	if we.WalData != nil {
 		// update readdb only when the wal has been committed to etcd
 		if we.WalData.WalStatus != datamanager.WalStatusCommitted {
-			return nil
+			return nil, nil
 		}
 
 		if err := r.insertCommittedWalSequence(tx, we.WalData.WalSequence); err != nil {
-			return err
+			return nil, err
 		}
 
 		r.log.Debugf("applying wal to db")
 		return r.applyWal(tx, we.WalData.WalDataFileID)
 	}
-	return nil
+	return nil, nil
 }
 
-func (r *ReadDB) applyWal(tx *db.Tx, walDataFileID string) error {
+// applyWal applies the wal actions and returns them
+func (r *ReadDB) applyWal(tx *db.Tx, walDataFileID string) ([]*datamanager.Action, error) {
 	walFile, err := r.dm.ReadWalData(walDataFileID)
 	if err != nil {
-		return errors.Errorf("cannot read wal data file %q: %w", walDataFileID, err)
+		return nil, errors.Errorf("cannot read wal data file %q: %w", walDataFileID, err)
 	}
 	defer walFile.Close()
 
+	var actions []*datamanager.Action
 	dec := json.NewDecoder(walFile)
 	for {
 		var action *datamanager.Action
@@ -601,15 +624,16 @@ func (r *ReadDB) applyWal(tx *db.Tx, walDataFileID string) error {
 			break
 		}
 		if err != nil {
-			return errors.Errorf("failed to decode wal file: %w", err)
+			return nil, errors.Errorf("failed to decode wal file: %w", err)
 		}
 
 		if err := r.applyAction(tx, action); err != nil {
-			return err
+			return nil, err
 		}
+		actions = append(actions, action)
 	}
 
-	return nil
+	return actions, nil
 }
 
 func (r *ReadDB) applyAction(tx *db.Tx, action *datamanager.Action) error {
@@ -648,6 +672,22 @@ func (r *ReadDB) applyAction(tx *db.Tx, action *datamanager.Action) error {
 			if err := r.insertVariable(tx, action.Data); err != nil {
 				return err
 			}
+		case types.ConfigTypeProjectChange:
+			if err := r.insertProjectChange(tx, action.Data); err != nil {
+				return err
+			}
+		case types.ConfigTypeUserNotification:
+			if err := r.insertUserNotification(tx, action.Data); err != nil {
+				return err
+			}
+		case types.ConfigTypeTrashItem:
+			if err := r.insertTrashItem(tx, action.Data); err != nil {
+				return err
+			}
+		case types.ConfigTypePathAlias:
+			if err := r.insertPathAlias(tx, action.Data); err != nil {
+				return err
+			}
 		}
 
 	case datamanager.ActionTypeDelete:
@@ -692,6 +732,26 @@ func (r *ReadDB) applyAction(tx *db.Tx, action *datamanager.Action) error {
 			if err := r.deleteVariable(tx, action.ID); err != nil {
 				return err
 			}
+		case types.ConfigTypeProjectChange:
+			r.log.Debugf("deleting project change with id: %s", action.ID)
+			if err := r.deleteProjectChange(tx, action.ID); err != nil {
+				return err
+			}
+		case types.ConfigTypeUserNotification:
+			r.log.Debugf("deleting user notification with id: %s", action.ID)
+			if err := r.deleteUserNotification(tx, action.ID); err != nil {
+				return err
+			}
+		case types.ConfigTypeTrashItem:
+			r.log.Debugf("deleting trash item with id: %s", action.ID)
+			if err := r.deleteTrashItem(tx, action.ID); err != nil {
+				return err
+			}
+		case types.ConfigTypePathAlias:
+			r.log.Debugf("deleting path alias with id: %s", action.ID)
+			if err := r.deletePathAlias(tx, action.ID); err != nil {
+				return err
+			}
 		}
 	}
 
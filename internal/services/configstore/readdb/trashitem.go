@@ -0,0 +1,149 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package readdb
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	sq "github.com/Masterminds/squirrel"
+	errors "golang.org/x/xerrors"
+)
+
+var (
+	trashitemSelect = sb.Select("id", "data").From("trashitem")
+	trashitemInsert = sb.Insert("trashitem").Columns("id", "ownerid", "deletiontime", "data")
+)
+
+func (r *ReadDB) insertTrashItem(tx *db.Tx, data []byte) error {
+	ti := types.TrashItem{}
+	if err := json.Unmarshal(data, &ti); err != nil {
+		return errors.Errorf("failed to unmarshal trash item: %w", err)
+	}
+	// poor man insert or update...
+	if err := r.deleteTrashItem(tx, ti.ID); err != nil {
+		return err
+	}
+	q, args, err := trashitemInsert.Values(ti.ID, ti.OwnerID, ti.DeletionTime.UnixNano(), data).ToSql()
+	if err != nil {
+		return errors.Errorf("failed to build query: %w", err)
+	}
+	if _, err = tx.Exec(q, args...); err != nil {
+		return errors.Errorf("failed to insert trash item: %w", err)
+	}
+
+	return nil
+}
+
+func (r *ReadDB) deleteTrashItem(tx *db.Tx, id string) error {
+	// poor man insert or update...
+	if _, err := tx.Exec("delete from trashitem where id = $1", id); err != nil {
+		return errors.Errorf("failed to delete trash item: %w", err)
+	}
+	return nil
+}
+
+func (r *ReadDB) GetTrashItem(tx *db.Tx, trashItemID string) (*types.TrashItem, error) {
+	q, args, err := trashitemSelect.Where(sq.Eq{"id": trashItemID}).ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+
+	tis, _, err := fetchTrashItems(tx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(tis) > 1 {
+		return nil, errors.Errorf("too many rows returned")
+	}
+	if len(tis) == 0 {
+		return nil, nil
+	}
+	return tis[0], nil
+}
+
+// GetTrashItems returns the owner trash items from the newest to the oldest
+func (r *ReadDB) GetTrashItems(tx *db.Tx, ownerID string) ([]*types.TrashItem, error) {
+	q, args, err := trashitemSelect.Where(sq.Eq{"ownerid": ownerID}).OrderBy("deletiontime desc").ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+
+	tis, _, err := fetchTrashItems(tx, q, args...)
+	return tis, err
+}
+
+// GetExpiredTrashItems returns the trash items deleted before the provided
+// time
+func (r *ReadDB) GetExpiredTrashItems(tx *db.Tx, before time.Time) ([]*types.TrashItem, error) {
+	q, args, err := trashitemSelect.Where(sq.Lt{"deletiontime": before.UnixNano()}).ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+
+	tis, _, err := fetchTrashItems(tx, q, args...)
+	return tis, err
+}
+
+func fetchTrashItems(tx *db.Tx, q string, args ...interface{}) ([]*types.TrashItem, []string, error) {
+	rows, err := tx.Query(q, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	return scanTrashItems(rows)
+}
+
+func scanTrashItem(rows *sql.Rows, additionalFields ...interface{}) (*types.TrashItem, string, error) {
+	var id string
+	var data []byte
+	if err := rows.Scan(&id, &data); err != nil {
+		return nil, "", errors.Errorf("failed to scan rows: %w", err)
+	}
+	ti := types.TrashItem{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &ti); err != nil {
+			return nil, "", errors.Errorf("failed to unmarshal trash item: %w", err)
+		}
+	}
+
+	return &ti, id, nil
+}
+
+func scanTrashItems(rows *sql.Rows) ([]*types.TrashItem, []string, error) {
+	tis := []*types.TrashItem{}
+	ids := []string{}
+	for rows.Next() {
+		ti, id, err := scanTrashItem(rows)
+		if err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		tis = append(tis, ti)
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	return tis, ids, nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package readdb
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	sq "github.com/Masterminds/squirrel"
+	errors "golang.org/x/xerrors"
+)
+
+var (
+	usernotificationSelect = sb.Select("id", "data").From("usernotification")
+	usernotificationInsert = sb.Insert("usernotification").Columns("id", "userid", "creationtime", "read", "data")
+)
+
+func (r *ReadDB) insertUserNotification(tx *db.Tx, data []byte) error {
+	un := types.UserNotification{}
+	if err := json.Unmarshal(data, &un); err != nil {
+		return errors.Errorf("failed to unmarshal user notification: %w", err)
+	}
+	// poor man insert or update...
+	if err := r.deleteUserNotification(tx, un.ID); err != nil {
+		return err
+	}
+	q, args, err := usernotificationInsert.Values(un.ID, un.UserID, un.CreationTime.UnixNano(), un.Read, data).ToSql()
+	if err != nil {
+		return errors.Errorf("failed to build query: %w", err)
+	}
+	if _, err = tx.Exec(q, args...); err != nil {
+		return errors.Errorf("failed to insert user notification: %w", err)
+	}
+
+	return nil
+}
+
+func (r *ReadDB) deleteUserNotification(tx *db.Tx, id string) error {
+	// poor man insert or update...
+	if _, err := tx.Exec("delete from usernotification where id = $1", id); err != nil {
+		return errors.Errorf("failed to delete user notification: %w", err)
+	}
+	return nil
+}
+
+func (r *ReadDB) GetUserNotification(tx *db.Tx, userID, userNotificationID string) (*types.UserNotification, error) {
+	q, args, err := usernotificationSelect.Where(sq.Eq{"id": userNotificationID, "userid": userID}).ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+
+	uns, _, err := fetchUserNotifications(tx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(uns) > 1 {
+		return nil, errors.Errorf("too many rows returned")
+	}
+	if len(uns) == 0 {
+		return nil, nil
+	}
+	return uns[0], nil
+}
+
+// GetUserNotifications returns the user notifications from the newest to the
+// oldest. When unreadOnly is true only the unread notifications are returned
+func (r *ReadDB) GetUserNotifications(tx *db.Tx, userID string, unreadOnly bool, limit int) ([]*types.UserNotification, error) {
+	s := usernotificationSelect.Where(sq.Eq{"userid": userID}).OrderBy("creationtime desc")
+	if unreadOnly {
+		s = s.Where(sq.Eq{"read": false})
+	}
+	if limit > 0 {
+		s = s.Limit(uint64(limit))
+	}
+	q, args, err := s.ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+
+	uns, _, err := fetchUserNotifications(tx, q, args...)
+	return uns, err
+}
+
+func (r *ReadDB) GetUserNotificationsUnreadCount(tx *db.Tx, userID string) (int, error) {
+	q, args, err := sb.Select("count(*)").From("usernotification").Where(sq.Eq{"userid": userID, "read": false}).ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return 0, errors.Errorf("failed to build query: %w", err)
+	}
+
+	var count int
+	if err := tx.QueryRow(q, args...).Scan(&count); err != nil {
+		return 0, errors.Errorf("failed to count user notifications: %w", err)
+	}
+	return count, nil
+}
+
+func fetchUserNotifications(tx *db.Tx, q string, args ...interface{}) ([]*types.UserNotification, []string, error) {
+	rows, err := tx.Query(q, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	return scanUserNotifications(rows)
+}
+
+func scanUserNotification(rows *sql.Rows, additionalFields ...interface{}) (*types.UserNotification, string, error) {
+	var id string
+	var data []byte
+	if err := rows.Scan(&id, &data); err != nil {
+		return nil, "", errors.Errorf("failed to scan rows: %w", err)
+	}
+	un := types.UserNotification{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &un); err != nil {
+			return nil, "", errors.Errorf("failed to unmarshal user notification: %w", err)
+		}
+	}
+
+	return &un, id, nil
+}
+
+func scanUserNotifications(rows *sql.Rows) ([]*types.UserNotification, []string, error) {
+	uns := []*types.UserNotification{}
+	ids := []string{}
+	for rows.Next() {
+		un, id, err := scanUserNotification(rows)
+		if err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		uns = append(uns, un)
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	return uns, ids, nil
+}
@@ -17,13 +17,20 @@ package executor
 import (
 	"bufio"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"agola.io/agola/internal/services/executor/driver"
+	rscommon "agola.io/agola/internal/services/runservice/common"
 	"agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/klauspost/compress/zstd"
 	"go.uber.org/zap"
 	errors "golang.org/x/xerrors"
 )
@@ -90,28 +97,82 @@ func (h *logsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	attempt := -1
+	if attemptStr := q.Get("attempt"); attemptStr != "" {
+		var err error
+		attempt, err = strconv.Atoi(attemptStr)
+		if err != nil || attempt < 0 {
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+	}
+
 	follow := false
 	_, ok := q["follow"]
 	if ok {
 		follow = true
 	}
 
-	if err := h.readTaskLogs(taskID, setup, step, w, follow); err != nil {
+	offset, err := parseOffset(q.Get("offset"))
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+
+	// full returns the full log of a truncated log
+	_, full := q["full"]
+
+	compression := q.Get("compression")
+	switch compression {
+	case "", rscommon.CompressionZstd:
+	default:
+		http.Error(w, "unsupported compression", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.readTaskLogs(taskID, setup, step, attempt, full, offset, compression, w, follow); err != nil {
 		h.log.Errorf("err: %+v", err)
 	}
 }
 
-func (h *logsHandler) readTaskLogs(taskID string, setup bool, step int, w http.ResponseWriter, follow bool) error {
+// parseOffset parses the offset from where a log or archive transfer must be
+// resumed
+func parseOffset(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	offset, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if offset < 0 {
+		return 0, errors.Errorf("negative offset %d", offset)
+	}
+	return offset, nil
+}
+
+func (h *logsHandler) readTaskLogs(taskID string, setup bool, step, attempt int, full bool, offset int64, compression string, w http.ResponseWriter, follow bool) error {
 	var logPath string
 	if setup {
 		logPath = h.e.setupLogPath(taskID)
 	} else {
 		logPath = h.e.stepLogPath(taskID, step)
 	}
-	return h.readLogs(taskID, setup, step, logPath, w, follow)
+	if attempt >= 0 {
+		// previous attempts logs are complete, there's nothing to follow
+		logPath = attemptLogPath(logPath, attempt)
+		follow = false
+	}
+	// the full log exists only when the log has been truncated
+	if full {
+		if _, err := os.Stat(fullLogPath(logPath)); err == nil {
+			logPath = fullLogPath(logPath)
+		}
+	}
+	return h.readLogs(taskID, setup, step, logPath, offset, compression, w, follow)
 }
 
-func (h *logsHandler) readLogs(taskID string, setup bool, step int, logPath string, w http.ResponseWriter, follow bool) error {
+func (h *logsHandler) readLogs(taskID string, setup bool, step int, logPath string, offset int64, compression string, w http.ResponseWriter, follow bool) error {
 	f, err := os.Open(logPath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -128,19 +189,48 @@ func (h *logsHandler) readLogs(taskID string, setup bool, step int, logPath stri
 
 	buf := make([]byte, 4096)
 
-	// if not following return the Content-Length
+	if offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			http.Error(w, "", http.StatusInternalServerError)
+			return errors.Errorf("failed to seek in log file %q: %w", logPath, err)
+		}
+	}
+
+	// if not following return the full log size and, when not compressed,
+	// the Content-Length
 	if !follow {
 		fi, err := f.Stat()
 		if err != nil {
 			return err
 		}
-		w.Header().Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+		w.Header().Set(rscommon.ContentSizeHeader, strconv.FormatInt(fi.Size(), 10))
+		if compression == "" {
+			w.Header().Set("Content-Length", strconv.FormatInt(fi.Size()-offset, 10))
+		}
 	}
 
 	var flusher http.Flusher
 	if fl, ok := w.(http.Flusher); ok {
 		flusher = fl
 	}
+
+	var out io.Writer = w
+	if compression == rscommon.CompressionZstd {
+		w.Header().Set(rscommon.CompressionHeader, compression)
+		enc, err := zstd.NewWriter(w)
+		if err != nil {
+			return err
+		}
+		defer enc.Close()
+		out = enc
+		// flush the compressed data written until now
+		if wflusher := flusher; wflusher != nil {
+			flusher = flusherFunc(func() {
+				_ = enc.Flush()
+				wflusher.Flush()
+			})
+		}
+	}
 	stop := false
 	flushstop := false
 	for {
@@ -174,7 +264,7 @@ func (h *logsHandler) readLogs(taskID string, setup bool, step int, logPath stri
 				stop = true
 			}
 		}
-		if _, err := w.Write(buf[:n]); err != nil {
+		if _, err := out.Write(buf[:n]); err != nil {
 			return err
 		}
 		if flusher != nil {
@@ -183,6 +273,10 @@ func (h *logsHandler) readLogs(taskID string, setup bool, step int, logPath stri
 	}
 }
 
+type flusherFunc func()
+
+func (f flusherFunc) Flush() { f() }
+
 type archivesHandler struct {
 	e *Executor
 }
@@ -209,10 +303,24 @@ func (h *archivesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "", http.StatusBadRequest)
 		return
 	}
+	offset, err := parseOffset(q.Get("offset"))
+	if err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	format := types.ArchiveFormat(q.Get("format"))
+	switch format {
+	case "":
+		format = types.ArchiveFormatTar
+	case types.ArchiveFormatTar, types.ArchiveFormatTarZstd:
+	default:
+		http.Error(w, "unsupported archive format", http.StatusBadRequest)
+		return
+	}
 
 	w.Header().Set("Cache-Control", "no-cache")
 
-	if err := h.readArchive(taskID, step, w); err != nil {
+	if err := h.readArchive(taskID, step, offset, format, w); err != nil {
 		if os.IsNotExist(err) {
 			http.Error(w, "", http.StatusNotFound)
 		} else {
@@ -222,7 +330,9 @@ func (h *archivesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *archivesHandler) readArchive(taskID string, step int, w http.ResponseWriter) error {
+// readArchive sends the archive starting from offset. When compressed, only the
+// data after offset is compressed.
+func (h *archivesHandler) readArchive(taskID string, step int, offset int64, format types.ArchiveFormat, w http.ResponseWriter) error {
 	archivePath := h.e.archivePath(taskID, step)
 
 	f, err := os.Open(archivePath)
@@ -234,11 +344,137 @@ func (h *archivesHandler) readArchive(taskID string, step int, w http.ResponseWr
 	if err != nil {
 		return err
 	}
+	if offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+	}
 
-	w.Header().Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+	w.Header().Set(rscommon.ArchiveFormatHeader, string(format))
+	w.Header().Set(rscommon.ContentSizeHeader, strconv.FormatInt(fi.Size(), 10))
 
 	br := bufio.NewReader(f)
 
+	if format == types.ArchiveFormatTarZstd {
+		enc, err := zstd.NewWriter(w)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(enc, br)
+		if cerr := enc.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(fi.Size()-offset, 10))
+
 	_, err = io.Copy(w, br)
 	return err
 }
+
+type execHandler struct {
+	log *zap.SugaredLogger
+	e   *Executor
+}
+
+func NewExecHandler(logger *zap.Logger, e *Executor) *execHandler {
+	return &execHandler{
+		log: logger.Sugar(),
+		e:   e,
+	}
+}
+
+// ServeHTTP executes a command inside the main container of a running task.
+// The websocket binary messages received are sent to the command stdin and
+// its output is sent back as binary messages. When the command exits the
+// connection is closed with the exit code as close message text.
+func (h *execHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+
+	taskID := q.Get("taskid")
+	if taskID == "" {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	_, tty := q["tty"]
+
+	rt, ok := h.e.runningTasks.get(taskID)
+	if !ok {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+	rt.Lock()
+	pod := rt.pod
+	et := rt.et
+	rt.Unlock()
+	if pod == nil {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+
+	cmd := q["cmd"]
+	if len(cmd) == 0 {
+		shell := "/bin/sh"
+		if et.Shell != "" {
+			shell = et.Shell
+		}
+		cmd = strings.Split(shell, " ")
+	}
+	user := et.Containers[0].User
+	if et.User != "" {
+		user = et.User
+	}
+
+	conn, err := util.WebsocketUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+	defer conn.Close()
+	ww := util.NewWebsocketWriter(conn)
+
+	workingDir, err := h.e.expandDir(ctx, et, pod, ww, et.WorkingDir)
+	if err != nil {
+		_ = ww.WriteClose(fmt.Sprintf("failed to expand working dir: %v", err))
+		return
+	}
+
+	execConfig := &driver.ExecConfig{
+		Cmd:         cmd,
+		Env:         et.Environment,
+		WorkingDir:  workingDir,
+		User:        user,
+		AttachStdin: true,
+		Stdout:      ww,
+		Stderr:      ww,
+		Tty:         tty,
+	}
+	ce, err := pod.Exec(ctx, execConfig)
+	if err != nil {
+		_ = ww.WriteClose(fmt.Sprintf("failed to exec: %v", err))
+		return
+	}
+
+	go func() {
+		stdin := ce.Stdin()
+		defer stdin.Close()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if _, err := stdin.Write(data); err != nil {
+				return
+			}
+		}
+	}()
+
+	exitCode, err := ce.Wait(ctx)
+	if err != nil {
+		_ = ww.WriteClose(fmt.Sprintf("failed to exec: %v", err))
+		return
+	}
+	_ = ww.WriteClose(fmt.Sprintf("exit code: %d", exitCode))
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"agola.io/agola/internal/services/config"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestAPIRouterInternalAuth(t *testing.T) {
+	e := &Executor{
+		c: &config.Executor{
+			InternalAPIAuth: config.InternalAPIAuth{Tokens: []string{"token01"}},
+		},
+		runningTasks: &runningTasks{
+			tasks: make(map[string]*runningTask),
+		},
+	}
+	ts := httptest.NewServer(e.apiRouter(nil))
+	defer ts.Close()
+
+	execURL := util.WebsocketURL(ts.URL) + "/api/v1alpha/executor/exec?taskid=task01"
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{
+			name:   "no token",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "wrong token",
+			token:  "token02",
+			status: http.StatusUnauthorized,
+		},
+		{
+			// the auth passes and the handler doesn't find the task
+			name:   "valid token",
+			token:  "token01",
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.token != "" {
+				header.Set(util.InternalAPITokenHeader, tt.token)
+			}
+			conn, resp, err := websocket.DefaultDialer.Dial(execURL, header)
+			if err == nil {
+				conn.Close()
+				t.Fatalf("expected dial error")
+			}
+			if resp == nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, resp.StatusCode)
+			}
+		})
+	}
+
+	for _, u := range []string{"/api/v1alpha/executor/logs?taskid=task01&step=0", "/api/v1alpha/executor/archives?taskid=task01&step=0"} {
+		resp, err := http.Get(ts.URL + u)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("%s: expected status %d, got %d", u, http.StatusUnauthorized, resp.StatusCode)
+		}
+	}
+}
@@ -15,6 +15,8 @@
 package driver
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
@@ -22,6 +24,7 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"path"
 	"runtime"
 	"sort"
 	"strconv"
@@ -41,6 +44,10 @@ import (
 	"go.uber.org/zap"
 )
 
+// dockerFilesDir is the tmpfs mounted in the main container where the pod
+// files are written. The files paths are symlinks to them.
+const dockerFilesDir = "/mnt/agola-files"
+
 type DockerDriver struct {
 	log               *zap.SugaredLogger
 	client            *client.Client
@@ -219,9 +226,71 @@ func (d *DockerDriver) NewPod(ctx context.Context, podConfig *PodConfig, out io.
 	// put the containers in the right order based on their container index
 	sort.Sort(ContainerSlice(pod.containers))
 
+	if len(podConfig.Files) > 0 {
+		if err := pod.writeFiles(ctx, podConfig); err != nil {
+			return nil, errors.Errorf("failed to write pod files: %w", err)
+		}
+	}
+
 	return pod, nil
 }
 
+// writeFiles writes the pod files in the main container tmpfs and symlinks
+// them to their paths. The toolbox is used to extract them since the docker
+// copy api doesn't support tmpfs mounts.
+func (dp *DockerPod) writeFiles(ctx context.Context, podConfig *PodConfig) error {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for i, f := range podConfig.Files {
+		filePath := path.Join(dockerFilesDir, strconv.Itoa(i))
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     strings.TrimPrefix(filePath, "/"),
+			Mode:     int64(f.Mode.Perm()),
+			Size:     int64(len(f.Data)),
+		}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.Data); err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeSymlink,
+			Name:     strings.TrimPrefix(f.Path, "/"),
+			Linkname: filePath,
+		}); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+	ce, err := dp.Exec(ctx, &ExecConfig{
+		Cmd:         []string{path.Join(podConfig.InitVolumeDir, toolboxPrefix), "unarchive", "--destdir", "/", "--overwrite"},
+		AttachStdin: true,
+		Stdout:      ioutil.Discard,
+		Stderr:      &stderr,
+	})
+	if err != nil {
+		return err
+	}
+	stdin := ce.Stdin()
+	go func() {
+		_, _ = io.Copy(stdin, &buf)
+		stdin.Close()
+	}()
+	exitCode, err := ce.Wait(ctx)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return errors.Errorf("toolbox unarchive exited with code %d: %s", exitCode, stderr.String())
+	}
+	return nil
+}
+
 func (d *DockerDriver) fetchImage(ctx context.Context, image string, registryConfig *registry.DockerConfig, out io.Writer) error {
 	regName, err := registry.GetRegistry(image)
 	if err != nil {
@@ -271,6 +340,7 @@ func (d *DockerDriver) createContainer(ctx context.Context, index int, podConfig
 
 	cliContainerConfig := &container.Config{
 		Entrypoint: containerConfig.Cmd,
+		Cmd:        containerConfig.Args,
 		Env:        makeEnvSlice(containerConfig.Env),
 		WorkingDir: containerConfig.WorkingDir,
 		Image:      containerConfig.Image,
@@ -285,6 +355,17 @@ func (d *DockerDriver) createContainer(ctx context.Context, index int, podConfig
 		// main container requires the initvolume containing the toolbox
 		cliHostConfig.Binds = []string{fmt.Sprintf("%s:%s", d.initVolumeHostDir, podConfig.InitVolumeDir)}
 		cliHostConfig.ReadonlyPaths = []string{fmt.Sprintf("%s:%s", d.initVolumeHostDir, podConfig.InitVolumeDir)}
+		// the other containers share the main container network so the
+		// network options are set only on it
+		cliHostConfig.ExtraHosts = podConfig.ExtraHosts
+		cliHostConfig.DNS = podConfig.DNS
+		if len(podConfig.Files) > 0 {
+			// keep the files in memory
+			cliHostConfig.Tmpfs = map[string]string{dockerFilesDir: "mode=0755"}
+		}
+		if podConfig.HostNetwork {
+			cliHostConfig.NetworkMode = "host"
+		}
 	} else {
 		// attach other containers to maincontainer network
 		cliHostConfig.NetworkMode = container.NetworkMode(fmt.Sprintf("container:%s", maincontainerID))
@@ -449,6 +530,49 @@ func (dp *DockerPod) Remove(ctx context.Context) error {
 	return nil
 }
 
+// Diagnostics returns the main container memory limit, its peak usage (only
+// while the container is running) and if it was killed by the oom killer.
+func (dp *DockerPod) Diagnostics(ctx context.Context) (*PodDiagnostics, error) {
+	containerID := dp.containers[0].ID
+	cj, err := dp.client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats *types.StatsJSON
+	if cj.State != nil && cj.State.Running {
+		resp, err := dp.client.ContainerStats(ctx, containerID, false)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+			return nil, errors.Errorf("failed to decode container stats: %w", err)
+		}
+	}
+
+	return dockerPodDiagnostics(cj, stats), nil
+}
+
+// dockerPodDiagnostics reports the container as oom killed only using the
+// container state OOMKilled. The memory stats failcnt isn't used since it
+// counts the allocations that hit the limit also when no process was killed.
+func dockerPodDiagnostics(cj types.ContainerJSON, stats *types.StatsJSON) *PodDiagnostics {
+	pd := &PodDiagnostics{}
+	if cj.ContainerJSONBase != nil && cj.HostConfig != nil {
+		pd.MemoryLimit = cj.HostConfig.Memory
+	}
+	if cj.ContainerJSONBase != nil && cj.State != nil && cj.State.OOMKilled {
+		pd.FailReason = PodFailReasonOOMKilled
+	}
+	if stats != nil {
+		pd.MemoryPeakUsage = int64(stats.MemoryStats.MaxUsage)
+	}
+
+	return pd
+}
+
 type DockerContainerExec struct {
 	execID string
 	hresp  *types.HijackedResponse
@@ -29,6 +29,7 @@ import (
 
 	slog "agola.io/agola/internal/log"
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
 	uuid "github.com/satori/go.uuid"
 
 	"github.com/google/go-cmp/cmp"
@@ -406,3 +407,44 @@ func TestDockerPod(t *testing.T) {
 		}
 	})
 }
+
+func TestDockerPodDiagnostics(t *testing.T) {
+	tests := []struct {
+		name  string
+		cj    types.ContainerJSON
+		stats *types.StatsJSON
+		out   *PodDiagnostics
+	}{
+		{
+			name: "oom killed",
+			cj: types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{
+				State:      &types.ContainerState{OOMKilled: true},
+				HostConfig: &container.HostConfig{Resources: container.Resources{Memory: 512 * 1024 * 1024}},
+			}},
+			out: &PodDiagnostics{FailReason: PodFailReasonOOMKilled, MemoryLimit: 512 * 1024 * 1024},
+		},
+		{
+			name: "memory limit hit without oom kill",
+			cj: types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{
+				State:      &types.ContainerState{Running: true},
+				HostConfig: &container.HostConfig{Resources: container.Resources{Memory: 512 * 1024 * 1024}},
+			}},
+			stats: &types.StatsJSON{Stats: types.Stats{MemoryStats: types.MemoryStats{MaxUsage: 512 * 1024 * 1024, Failcnt: 10}}},
+			out:   &PodDiagnostics{MemoryLimit: 512 * 1024 * 1024, MemoryPeakUsage: 512 * 1024 * 1024},
+		},
+		{
+			name: "no state",
+			cj:   types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{}},
+			out:  &PodDiagnostics{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := dockerPodDiagnostics(tt.cj, tt.stats)
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Fatalf("unexpected diagnostics (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -16,13 +16,19 @@ package driver
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"agola.io/agola/internal/common"
 	"agola.io/agola/internal/services/executor/registry"
+
+	errors "golang.org/x/xerrors"
 )
 
 const (
@@ -69,6 +75,9 @@ type Pod interface {
 	Remove(ctx context.Context) error
 	// Exec executes a command inside the first container in the Pod
 	Exec(ctx context.Context, execConfig *ExecConfig) (ContainerExec, error)
+	// Diagnostics returns the resources diagnostics of the first container in
+	// the Pod
+	Diagnostics(ctx context.Context) (*PodDiagnostics, error)
 }
 
 type ContainerExec interface {
@@ -76,6 +85,25 @@ type ContainerExec interface {
 	Wait(ctx context.Context) (int, error)
 }
 
+type PodFailReason string
+
+const (
+	PodFailReasonOOMKilled PodFailReason = "oomkilled"
+	PodFailReasonEvicted   PodFailReason = "evicted"
+)
+
+// PodDiagnostics reports the memory status of the pod main container and, when
+// detected, the reason why its processes were killed
+type PodDiagnostics struct {
+	FailReason PodFailReason
+	Message    string
+
+	// MemoryLimit is the memory limit in bytes, 0 if unlimited
+	MemoryLimit int64
+	// MemoryPeakUsage is the max memory usage in bytes, 0 if unknown
+	MemoryPeakUsage int64
+}
+
 type PodConfig struct {
 	ID         string
 	TaskID     string
@@ -84,10 +112,26 @@ type PodConfig struct {
 	// The container dir where the init volume will be mounted
 	InitVolumeDir string
 	DockerConfig  *registry.DockerConfig
+	// ExtraHosts are additional hosts file entries in the "hostname:ip" format
+	ExtraHosts  []string
+	DNS         []string
+	HostNetwork bool
+	// Files are created in the main container without being written to the
+	// container filesystem
+	Files []*File
+}
+
+type File struct {
+	Path string
+	Mode os.FileMode
+	Data []byte
 }
 
 type ContainerConfig struct {
-	Cmd        []string
+	// Cmd overrides the image entrypoint
+	Cmd []string
+	// Args overrides the image cmd
+	Args       []string
 	Env        map[string]string
 	WorkingDir string
 	Image      string
@@ -112,5 +156,38 @@ func toolboxExecPath(toolboxDir string, arch common.Arch) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	if err := verifyToolboxChecksum(toolboxPath); err != nil {
+		return "", err
+	}
 	return toolboxPath, nil
 }
+
+// verifyToolboxChecksum verifies the toolbox binary against its sha256
+// checksum file (in the sha256sum output format) when provided
+func verifyToolboxChecksum(toolboxPath string) error {
+	data, err := ioutil.ReadFile(toolboxPath + ".sha256")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return errors.Errorf("empty toolbox checksum file")
+	}
+
+	f, err := os.Open(toolboxPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if checksum := hex.EncodeToString(h.Sum(nil)); checksum != strings.ToLower(fields[0]) {
+		return errors.Errorf("toolbox %q checksum %s doesn't match the expected checksum %s", toolboxPath, checksum, fields[0])
+	}
+	return nil
+}
@@ -56,6 +56,8 @@ const (
 	configMapName       = "agola-executors-group"
 	executorLeasePrefix = "agola-executor-"
 	podNamePrefix       = "agola-task-"
+	// filesSecretSuffix is the suffix of the secret holding the pod files
+	filesSecretSuffix = "-files"
 
 	executorsGroupIDKey          = labelPrefix + "executorsgroupid"
 	executorsGroupIDConfigMapKey = "executorsgroupid"
@@ -346,6 +348,23 @@ func (d *K8sDriver) NewPod(ctx context.Context, podConfig *PodConfig, out io.Wri
 		return nil, err
 	}
 
+	// secret that holds the pod files
+	if len(podConfig.Files) > 0 {
+		filesSecret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name + filesSecretSuffix,
+				Labels: labels,
+			},
+			Data: map[string][]byte{},
+		}
+		for i, f := range podConfig.Files {
+			filesSecret.Data[fmt.Sprintf("file%d", i)] = f.Data
+		}
+		if _, err := secretClient.Create(filesSecret); err != nil {
+			return nil, err
+		}
+	}
+
 	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: d.namespace,
@@ -384,6 +403,34 @@ func (d *K8sDriver) NewPod(ctx context.Context, podConfig *PodConfig, out io.Wri
 		},
 	}
 
+	if len(podConfig.Files) > 0 {
+		items := make([]corev1.KeyToPath, len(podConfig.Files))
+		for i, f := range podConfig.Files {
+			mode := int32(f.Mode.Perm())
+			items[i] = corev1.KeyToPath{Key: fmt.Sprintf("file%d", i), Path: fmt.Sprintf("file%d", i), Mode: &mode}
+		}
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+			Name: "agolafiles",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: name + filesSecretSuffix,
+					Items:      items,
+				},
+			},
+		})
+	}
+
+	// network options
+	pod.Spec.HostNetwork = podConfig.HostNetwork
+	pod.Spec.HostAliases = genHostAliases(podConfig.ExtraHosts)
+	if len(podConfig.DNS) > 0 {
+		// use only the provided dns servers like docker does
+		pod.Spec.DNSPolicy = corev1.DNSNone
+		pod.Spec.DNSConfig = &corev1.PodDNSConfig{
+			Nameservers: podConfig.DNS,
+		}
+	}
+
 	// define containers
 	for cIndex, containerConfig := range podConfig.Containers {
 		var containerName string
@@ -396,6 +443,7 @@ func (d *K8sDriver) NewPod(ctx context.Context, podConfig *PodConfig, out io.Wri
 			Name:       containerName,
 			Image:      containerConfig.Image,
 			Command:    containerConfig.Cmd,
+			Args:       containerConfig.Args,
 			Env:        genEnvVars(containerConfig.Env),
 			Stdin:      true,
 			WorkingDir: containerConfig.WorkingDir,
@@ -415,6 +463,16 @@ func (d *K8sDriver) NewPod(ctx context.Context, podConfig *PodConfig, out io.Wri
 					ReadOnly:  true,
 				},
 			}
+			// mount every file with a subpath to not hide the other files in
+			// the same directory
+			for i, f := range podConfig.Files {
+				c.VolumeMounts = append(c.VolumeMounts, corev1.VolumeMount{
+					Name:      "agolafiles",
+					MountPath: f.Path,
+					SubPath:   fmt.Sprintf("file%d", i),
+					ReadOnly:  true,
+				})
+			}
 		}
 		pod.Spec.Containers = append(pod.Spec.Containers, c)
 	}
@@ -654,6 +712,10 @@ func (p *K8sPod) Stop(ctx context.Context) error {
 	if err := secretClient.Delete(p.id, &metav1.DeleteOptions{GracePeriodSeconds: &d}); err != nil {
 		return err
 	}
+	// the files secret exists only when the pod has files
+	if err := secretClient.Delete(p.id+filesSecretSuffix, &metav1.DeleteOptions{GracePeriodSeconds: &d}); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
 	podClient := p.client.CoreV1().Pods(p.namespace)
 	if err := podClient.Delete(p.id, &metav1.DeleteOptions{GracePeriodSeconds: &d}); err != nil {
 		return err
@@ -665,6 +727,48 @@ func (p *K8sPod) Remove(ctx context.Context) error {
 	return p.Stop(ctx)
 }
 
+// Diagnostics returns the main container memory limit and if the pod was
+// evicted or the main container was oom killed. The peak memory usage isn't
+// reported since it requires the metrics api.
+func (p *K8sPod) Diagnostics(ctx context.Context) (*PodDiagnostics, error) {
+	podClient := p.client.CoreV1().Pods(p.namespace)
+	pod, err := podClient.Get(p.id, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return k8sPodDiagnostics(pod), nil
+}
+
+func k8sPodDiagnostics(pod *corev1.Pod) *PodDiagnostics {
+	pd := &PodDiagnostics{}
+	for _, c := range pod.Spec.Containers {
+		if c.Name != mainContainerName {
+			continue
+		}
+		if l, ok := c.Resources.Limits[corev1.ResourceMemory]; ok {
+			pd.MemoryLimit = l.Value()
+		}
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name != mainContainerName {
+			continue
+		}
+		for _, t := range []*corev1.ContainerStateTerminated{cs.State.Terminated, cs.LastTerminationState.Terminated} {
+			if t != nil && t.Reason == "OOMKilled" {
+				pd.FailReason = PodFailReasonOOMKilled
+				pd.Message = t.Message
+			}
+		}
+	}
+	if pod.Status.Reason == "Evicted" {
+		pd.FailReason = PodFailReasonEvicted
+		pd.Message = pod.Status.Message
+	}
+
+	return pd
+}
+
 type K8sContainerExec struct {
 	endCh chan error
 
@@ -751,6 +855,27 @@ func (e *K8sContainerExec) Stdin() io.WriteCloser {
 	return e.stdin
 }
 
+// genHostAliases converts the extra hosts in the "hostname:ip" format to pod
+// host aliases grouping the hostnames by ip
+func genHostAliases(extraHosts []string) []corev1.HostAlias {
+	hostAliases := []corev1.HostAlias{}
+	ipIndex := map[string]int{}
+	for _, extraHost := range extraHosts {
+		parts := strings.SplitN(extraHost, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		hostname, ip := parts[0], parts[1]
+		if i, ok := ipIndex[ip]; ok {
+			hostAliases[i].Hostnames = append(hostAliases[i].Hostnames, hostname)
+			continue
+		}
+		ipIndex[ip] = len(hostAliases)
+		hostAliases = append(hostAliases, corev1.HostAlias{IP: ip, Hostnames: []string{hostname}})
+	}
+	return hostAliases
+}
+
 func genEnvVars(env map[string]string) []corev1.EnvVar {
 	envVars := make([]corev1.EnvVar, 0, len(env))
 	for n, v := range env {
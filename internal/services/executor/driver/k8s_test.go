@@ -24,6 +24,8 @@ import (
 	"time"
 
 	uuid "github.com/satori/go.uuid"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 func TestK8sPod(t *testing.T) {
@@ -302,3 +304,61 @@ func TestParseGitVersion(t *testing.T) {
 		})
 	}
 }
+
+func TestK8sPodDiagnostics(t *testing.T) {
+	limits := corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")}
+	spec := corev1.PodSpec{Containers: []corev1.Container{{Name: mainContainerName, Resources: corev1.ResourceRequirements{Limits: limits}}}}
+
+	tests := []struct {
+		name string
+		pod  *corev1.Pod
+		out  *PodDiagnostics
+	}{
+		{
+			name: "oom killed",
+			pod: &corev1.Pod{
+				Spec: spec,
+				Status: corev1.PodStatus{
+					ContainerStatuses: []corev1.ContainerStatus{{
+						Name:  mainContainerName,
+						State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled"}},
+					}},
+				},
+			},
+			out: &PodDiagnostics{FailReason: PodFailReasonOOMKilled, MemoryLimit: 512 * 1024 * 1024},
+		},
+		{
+			name: "evicted",
+			pod: &corev1.Pod{
+				Spec: spec,
+				Status: corev1.PodStatus{
+					Reason:  "Evicted",
+					Message: "The node was low on resource: memory.",
+				},
+			},
+			out: &PodDiagnostics{FailReason: PodFailReasonEvicted, Message: "The node was low on resource: memory.", MemoryLimit: 512 * 1024 * 1024},
+		},
+		{
+			name: "other container oom killed",
+			pod: &corev1.Pod{
+				Spec: spec,
+				Status: corev1.PodStatus{
+					ContainerStatuses: []corev1.ContainerStatus{{
+						Name:  "other",
+						State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled"}},
+					}},
+				},
+			},
+			out: &PodDiagnostics{MemoryLimit: 512 * 1024 * 1024},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := k8sPodDiagnostics(tt.pod)
+			if !reflect.DeepEqual(tt.out, out) {
+				t.Fatalf("expected diagnostics %+v, got %+v", tt.out, out)
+			}
+		})
+	}
+}
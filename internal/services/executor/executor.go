@@ -17,6 +17,9 @@ package executor
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -25,23 +28,31 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"agola.io/agola/internal/common"
+	rcconfig "agola.io/agola/internal/config"
+	"agola.io/agola/internal/expr"
 	slog "agola.io/agola/internal/log"
 	"agola.io/agola/internal/services/config"
 	"agola.io/agola/internal/services/executor/driver"
 	"agola.io/agola/internal/services/executor/registry"
 	rsapi "agola.io/agola/internal/services/runservice/api"
+	rscommon "agola.io/agola/internal/services/runservice/common"
 	"agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/toolbox"
 	"agola.io/agola/internal/util"
 	uuid "github.com/satori/go.uuid"
 
 	"github.com/gorilla/mux"
 	sockaddr "github.com/hashicorp/go-sockaddr"
+	"github.com/klauspost/compress/zstd"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	errors "golang.org/x/xerrors"
@@ -55,6 +66,18 @@ const (
 	defaultShell = "/bin/sh -e"
 
 	toolboxContainerDir = "/mnt/agola"
+
+	// sigkillExitCode is the exit code of a process killed by SIGKILL (like
+	// the ones killed by the oom killer)
+	sigkillExitCode = 128 + 9
+
+	mib = 1024 * 1024
+	// suggested memory limits are rounded up to this size
+	memoryLimitStep = 256 * mib
+
+	// taskLeaseRenewInterval is the interval between the renewals of the
+	// leases of the executing tasks
+	taskLeaseRenewInterval = 5 * time.Second
 )
 
 var (
@@ -103,12 +126,17 @@ func (e *Executor) doRunStep(ctx context.Context, s *types.RunStep, t *types.Exe
 	if err := os.MkdirAll(filepath.Dir(logPath), 0770); err != nil {
 		return -1, err
 	}
-	outf, err := os.Create(logPath)
+	outf, err := e.createLog(logPath)
 	if err != nil {
 		return -1, err
 	}
 	defer outf.Close()
 
+	return e.runStep(ctx, s, t, pod, outf)
+}
+
+// runStep executes the run step command writing its output to outf
+func (e *Executor) runStep(ctx context.Context, s *types.RunStep, t *types.ExecutorTask, pod driver.Pod, outf io.Writer) (int, error) {
 	shell := defaultShell
 	if t.Shell != "" {
 		shell = t.Shell
@@ -126,23 +154,41 @@ func (e *Executor) doRunStep(ctx context.Context, s *types.RunStep, t *types.Exe
 		user = s.User
 	}
 
+	args := strings.Split(shell, " ")
 	var cmd []string
 	if s.Command != "" {
-		filename, err := e.createFile(ctx, pod, s.Command, user, outf)
-		if err != nil {
-			return -1, errors.Errorf("create file err: %v", err)
+		command := s.Command
+		if s.ShellOptions != nil {
+			optionsScript, err := common.ShellOptionsScript(shell, s.ShellOptions.Errexit, s.ShellOptions.Pipefail)
+			if err != nil {
+				_, _ = io.WriteString(outf, fmt.Sprintf("wrong shell options. Error: %s\n", err))
+				return -1, err
+			}
+			command = optionsScript + command
 		}
 
-		args := strings.Split(shell, " ")
-		cmd = append(args, filename)
+		if args[len(args)-1] == "-c" {
+			// shells like "python -c" take the command as argument
+			cmd = append(args, command)
+		} else {
+			filename, err := e.createFile(ctx, pod, command, user, outf)
+			if err != nil {
+				return -1, errors.Errorf("create file err: %v", err)
+			}
+			cmd = append(args, filename)
+		}
 	} else {
-		cmd = strings.Split(shell, " ")
+		cmd = args
 	}
 
-	// override task working dir with runstep working dir if provided
+	// override task working dir with runstep working dir if provided. A
+	// relative runstep working dir is relative to the task working dir
 	workingDir := t.WorkingDir
 	if s.WorkingDir != "" {
 		workingDir = s.WorkingDir
+		if !path.IsAbs(workingDir) && !strings.HasPrefix(workingDir, "~") {
+			workingDir = path.Join(t.WorkingDir, workingDir)
+		}
 	}
 
 	// generate the environment using the task environment and then overriding with the runstep environment
@@ -154,11 +200,20 @@ func (e *Executor) doRunStep(ctx context.Context, s *types.RunStep, t *types.Exe
 		environment[envName] = envValue
 	}
 
-	workingDir, err = e.expandDir(ctx, t, pod, outf, workingDir)
+	workingDir, err := e.expandDir(ctx, t, pod, outf, workingDir)
 	if err != nil {
-		_, _ = outf.WriteString(fmt.Sprintf("failed to expand working dir %q. Error: %s\n", workingDir, err))
+		_, _ = io.WriteString(outf, fmt.Sprintf("failed to expand working dir %q. Error: %s\n", workingDir, err))
 		return -1, err
 	}
+	// create the runstep working dir since it could be a not existing
+	// subdirectory of the task working dir. It's created as the step user so
+	// the step can write inside it.
+	if s.WorkingDir != "" {
+		if err := e.mkdir(ctx, t, pod, outf, workingDir, user); err != nil {
+			_, _ = io.WriteString(outf, fmt.Sprintf("failed to create working dir %q. Error: %s\n", workingDir, err))
+			return -1, err
+		}
+	}
 
 	execConfig := &driver.ExecConfig{
 		Cmd:         cmd,
@@ -190,7 +245,7 @@ func (e *Executor) doSaveToWorkspaceStep(ctx context.Context, s *types.SaveToWor
 	if err := os.MkdirAll(filepath.Dir(logPath), 0770); err != nil {
 		return -1, err
 	}
-	logf, err := os.Create(logPath)
+	logf, err := e.createLog(logPath)
 	if err != nil {
 		return -1, err
 	}
@@ -296,13 +351,16 @@ func (e *Executor) expandDir(ctx context.Context, t *types.ExecutorTask, pod dri
 	return stdout.String(), nil
 }
 
-func (e *Executor) mkdir(ctx context.Context, t *types.ExecutorTask, pod driver.Pod, logf io.Writer, dir string) error {
+// mkdir creates the dir, and its missing parents, as the provided user. An empty
+// user means the container default user.
+func (e *Executor) mkdir(ctx context.Context, t *types.ExecutorTask, pod driver.Pod, logf io.Writer, dir, user string) error {
 	args := []string{dir}
 	cmd := append([]string{toolboxContainerPath, "mkdir"}, args...)
 
 	execConfig := &driver.ExecConfig{
 		Cmd:         cmd,
 		Env:         t.Environment,
+		User:        user,
 		AttachStdin: true,
 		Stdout:      logf,
 		Stderr:      logf,
@@ -367,6 +425,140 @@ func (e *Executor) template(ctx context.Context, t *types.ExecutorTask, pod driv
 	return stdout.String(), nil
 }
 
+// checkToolboxVersion checks that the toolbox injected in the pod uses the
+// same protocol version of the executor. Toolboxes without the version
+// command are older than the first protocol version.
+func (e *Executor) checkToolboxVersion(ctx context.Context, pod driver.Pod, logf io.Writer) error {
+	cmd := []string{toolboxContainerPath, "version"}
+
+	stdout := util.NewLimitedBuffer(4 * 1024)
+
+	execConfig := &driver.ExecConfig{
+		Cmd:         cmd,
+		AttachStdin: true,
+		Stdout:      stdout,
+		Stderr:      logf,
+	}
+
+	ce, err := pod.Exec(ctx, execConfig)
+	if err != nil {
+		return err
+	}
+
+	exitCode, err := ce.Wait(ctx)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return errors.Errorf("toolbox version ended with exit code %d", exitCode)
+	}
+
+	var vi *toolbox.VersionInfo
+	if err := json.Unmarshal(stdout.Bytes(), &vi); err != nil {
+		return errors.Errorf("failed to unmarshal toolbox version: %w", err)
+	}
+	if vi.ProtocolVersion != toolbox.ProtocolVersion {
+		return errors.Errorf("toolbox %s protocol version %d doesn't match the executor protocol version %d", vi.Version, vi.ProtocolVersion, toolbox.ProtocolVersion)
+	}
+
+	return nil
+}
+
+// previewURL reads the preview url registered by the task steps using the
+// toolbox previewurl command. It returns nil if no preview url was registered.
+func (e *Executor) previewURL(ctx context.Context, t *types.ExecutorTask, pod driver.Pod, logf io.Writer) (*types.PreviewURL, error) {
+	cmd := []string{toolboxContainerPath, "previewurl", "get"}
+
+	stdout := util.NewLimitedBuffer(64 * 1024)
+
+	execConfig := &driver.ExecConfig{
+		Cmd:         cmd,
+		Env:         t.Environment,
+		AttachStdin: true,
+		Stdout:      stdout,
+		Stderr:      logf,
+	}
+
+	ce, err := pod.Exec(ctx, execConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	exitCode, err := ce.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if exitCode != 0 {
+		return nil, errors.Errorf("previewurl ended with exit code %d", exitCode)
+	}
+
+	if stdout.Len() == 0 {
+		return nil, nil
+	}
+
+	var previewURL *types.PreviewURL
+	if err := json.Unmarshal(stdout.Bytes(), &previewURL); err != nil {
+		return nil, errors.Errorf("failed to unmarshal preview url: %w", err)
+	}
+	switch previewURL.Action {
+	case types.PreviewURLActionSet:
+	case types.PreviewURLActionRemove:
+	default:
+		return nil, errors.Errorf("unknown preview url action %q", previewURL.Action)
+	}
+
+	return previewURL, nil
+}
+
+// taskOutputs reads the task outputs set by the task steps using the toolbox
+// output command. Only the outputs declared by the task are returned.
+func (e *Executor) taskOutputs(ctx context.Context, t *types.ExecutorTask, pod driver.Pod, logf io.Writer) (map[string]string, error) {
+	if len(t.Outputs) == 0 {
+		return nil, nil
+	}
+
+	cmd := []string{toolboxContainerPath, "output", "get"}
+
+	stdout := util.NewLimitedBuffer(64 * 1024)
+
+	execConfig := &driver.ExecConfig{
+		Cmd:         cmd,
+		Env:         t.Environment,
+		AttachStdin: true,
+		Stdout:      stdout,
+		Stderr:      logf,
+	}
+
+	ce, err := pod.Exec(ctx, execConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	exitCode, err := ce.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if exitCode != 0 {
+		return nil, errors.Errorf("output ended with exit code %d", exitCode)
+	}
+
+	if stdout.Len() == 0 {
+		return nil, nil
+	}
+
+	var outputs map[string]string
+	if err := json.Unmarshal(stdout.Bytes(), &outputs); err != nil {
+		return nil, errors.Errorf("failed to unmarshal outputs: %w", err)
+	}
+	for k := range outputs {
+		if !util.StringInSlice(t.Outputs, k) {
+			delete(outputs, k)
+		}
+	}
+
+	return outputs, nil
+}
+
 func (e *Executor) unarchive(ctx context.Context, t *types.ExecutorTask, source io.Reader, pod driver.Pod, logf io.Writer, destDir string, overwrite, removeDestDir bool) error {
 	args := []string{"--destdir", destDir}
 	if overwrite {
@@ -418,7 +610,7 @@ func (e *Executor) doRestoreWorkspaceStep(ctx context.Context, s *types.RestoreW
 	if err := os.MkdirAll(filepath.Dir(logPath), 0770); err != nil {
 		return -1, err
 	}
-	logf, err := os.Create(logPath)
+	logf, err := e.createLog(logPath)
 	if err != nil {
 		return -1, err
 	}
@@ -426,30 +618,46 @@ func (e *Executor) doRestoreWorkspaceStep(ctx context.Context, s *types.RestoreW
 
 	for _, op := range t.WorkspaceOperations {
 		log.Debugf("unarchiving workspace for taskID: %s, step: %d", level, op.TaskID, op.Step)
-		resp, err := e.runserviceClient.GetArchive(ctx, op.TaskID, op.Step)
+		resp, err := e.runserviceClient.GetArchive(ctx, t.StoragePartition, op.TaskID, op.Step, types.ArchiveFormatTarZstd)
 		if err != nil {
 			// TODO(sgotti) retry before giving up
 			fmt.Fprintf(logf, "error reading workspace archive: %v\n", err)
 			return -1, err
 		}
-		archivef := resp.Body
-		if err := e.unarchive(ctx, t, archivef, pod, logf, s.DestDir, false, false); err != nil {
-			archivef.Close()
+		if err := e.unarchiveResponse(ctx, t, resp, pod, logf, s.DestDir); err != nil {
 			return -1, err
 		}
-		archivef.Close()
 	}
 
 	return 0, nil
 }
 
+// unarchiveResponse unarchives a workspace archive received from the
+// runservice. Runservices not supporting the requested archive format return a
+// plain tar archive.
+func (e *Executor) unarchiveResponse(ctx context.Context, t *types.ExecutorTask, resp *http.Response, pod driver.Pod, logf io.Writer, destDir string) error {
+	defer resp.Body.Close()
+
+	var archivef io.Reader = resp.Body
+	if types.ArchiveFormat(resp.Header.Get(rscommon.ArchiveFormatHeader)) == types.ArchiveFormatTarZstd {
+		dec, err := zstd.NewReader(resp.Body)
+		if err != nil {
+			return err
+		}
+		defer dec.Close()
+		archivef = dec
+	}
+
+	return e.unarchive(ctx, t, archivef, pod, logf, destDir, false, false)
+}
+
 func (e *Executor) doSaveCacheStep(ctx context.Context, s *types.SaveCacheStep, t *types.ExecutorTask, pod driver.Pod, logPath string, archivePath string) (int, error) {
 	cmd := []string{toolboxContainerPath, "archive"}
 
 	if err := os.MkdirAll(filepath.Dir(logPath), 0770); err != nil {
 		return -1, err
 	}
-	logf, err := os.Create(logPath)
+	logf, err := e.createLog(logPath)
 	if err != nil {
 		return -1, err
 	}
@@ -468,7 +676,7 @@ func (e *Executor) doSaveCacheStep(ctx context.Context, s *types.SaveCacheStep,
 	key := t.CachePrefix + "-" + userKey
 
 	// check that the cache key doesn't already exists
-	resp, err := e.runserviceClient.CheckCache(ctx, key, false)
+	resp, err := e.runserviceClient.CheckCache(ctx, t.StoragePartition, key, false)
 	if err != nil {
 		// ignore 404 errors since they means that the cache key doesn't exists
 		if resp != nil && resp.StatusCode == http.StatusNotFound {
@@ -566,7 +774,7 @@ func (e *Executor) doSaveCacheStep(ctx context.Context, s *types.SaveCacheStep,
 	}
 
 	// send cache archive to scheduler
-	if resp, err := e.runserviceClient.PutCache(ctx, key, fi.Size(), f); err != nil {
+	if resp, err := e.runserviceClient.PutCache(ctx, t.StoragePartition, key, fi.Size(), f); err != nil {
 		if resp != nil && resp.StatusCode == http.StatusNotModified {
 			return exitCode, nil
 		}
@@ -576,11 +784,218 @@ func (e *Executor) doSaveCacheStep(ctx context.Context, s *types.SaveCacheStep,
 	return exitCode, nil
 }
 
+func (e *Executor) doSaveTestReportStep(ctx context.Context, s *types.SaveTestReportStep, t *types.ExecutorTask, pod driver.Pod, step int, logPath string, archivePath string) (int, error) {
+	if err := os.MkdirAll(filepath.Dir(logPath), 0770); err != nil {
+		return -1, err
+	}
+	logf, err := e.createLog(logPath)
+	if err != nil {
+		return -1, err
+	}
+	defer logf.Close()
+
+	exitCode, err := e.archiveReportFiles(ctx, t, pod, logf, s.Paths, archivePath)
+	if err != nil {
+		return exitCode, errors.Errorf("save test report archiving command: %w", err)
+	}
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return -1, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return -1, err
+	}
+
+	// send the test report files to the runservice that will parse and save them
+	summary, _, err := e.runserviceClient.PutTestReport(ctx, t.StoragePartition, t.ID, step, s.Format, fi.Size(), f)
+	if err != nil {
+		fmt.Fprintf(logf, "failed to save test report: %v\n", err)
+		return -1, err
+	}
+	fmt.Fprintf(logf, "test report saved. Total: %d, Passed: %d, Failed: %d, Skipped: %d\n", summary.Total, summary.Passed, summary.Failed, summary.Skipped)
+
+	return 0, nil
+}
+
+// doExportEnvStep parses the step dotenv file using the toolbox dotenv command
+// and returns its variables
+func (e *Executor) doExportEnvStep(ctx context.Context, s *types.ExportEnvStep, t *types.ExecutorTask, pod driver.Pod, logPath string) (map[string]string, int, error) {
+	if err := os.MkdirAll(filepath.Dir(logPath), 0770); err != nil {
+		return nil, -1, err
+	}
+	logf, err := e.createLog(logPath)
+	if err != nil {
+		return nil, -1, err
+	}
+	defer logf.Close()
+
+	workingDir, err := e.expandDir(ctx, t, pod, logf, t.WorkingDir)
+	if err != nil {
+		_, _ = io.WriteString(logf, fmt.Sprintf("failed to expand working dir %q. Error: %s\n", t.WorkingDir, err))
+		return nil, -1, err
+	}
+
+	// limit the dotenv file variables to max 64KiB
+	stdout := util.NewLimitedBuffer(64 * 1024)
+
+	execConfig := &driver.ExecConfig{
+		Cmd:        []string{toolboxContainerPath, "dotenv", s.Path},
+		Env:        t.Environment,
+		WorkingDir: workingDir,
+		User:       t.User,
+		Stdout:     stdout,
+		Stderr:     logf,
+	}
+
+	ce, err := pod.Exec(ctx, execConfig)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	exitCode, err := ce.Wait(ctx)
+	if err != nil {
+		return nil, -1, err
+	}
+	if exitCode != 0 {
+		return nil, exitCode, nil
+	}
+
+	var env map[string]string
+	if err := json.Unmarshal(stdout.Bytes(), &env); err != nil {
+		return nil, -1, errors.Errorf("failed to unmarshal exported environment: %w", err)
+	}
+
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(logf, "exported %s\n", k)
+	}
+
+	return env, 0, nil
+}
+
+func (e *Executor) doSaveCoverageReportStep(ctx context.Context, s *types.SaveCoverageReportStep, t *types.ExecutorTask, pod driver.Pod, step int, logPath string, archivePath string) (int, error) {
+	if err := os.MkdirAll(filepath.Dir(logPath), 0770); err != nil {
+		return -1, err
+	}
+	logf, err := e.createLog(logPath)
+	if err != nil {
+		return -1, err
+	}
+	defer logf.Close()
+
+	exitCode, err := e.archiveReportFiles(ctx, t, pod, logf, s.Paths, archivePath)
+	if err != nil {
+		return exitCode, errors.Errorf("save coverage report archiving command: %w", err)
+	}
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return -1, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return -1, err
+	}
+
+	// send the coverage report files to the runservice that will parse and save them
+	report, _, err := e.runserviceClient.PutCoverageReport(ctx, t.StoragePartition, t.ID, step, s.Format, fi.Size(), f)
+	if err != nil {
+		fmt.Fprintf(logf, "failed to save coverage report: %v\n", err)
+		return -1, err
+	}
+	fmt.Fprintf(logf, "coverage report saved. Coverage: %.2f%% (%d/%d lines)\n", report.Percent(), report.LinesCovered, report.LinesTotal)
+
+	return 0, nil
+}
+
+// archiveReportFiles creates a tar archive in archivePath with the files
+// matching paths relative to the task working dir
+func (e *Executor) archiveReportFiles(ctx context.Context, t *types.ExecutorTask, pod driver.Pod, logf io.Writer, paths []string, archivePath string) (int, error) {
+	cmd := []string{toolboxContainerPath, "archive"}
+
+	if err := os.MkdirAll(filepath.Dir(archivePath), 0770); err != nil {
+		return -1, err
+	}
+	archivef, err := os.Create(archivePath)
+	if err != nil {
+		return -1, err
+	}
+	defer archivef.Close()
+
+	workingDir, err := e.expandDir(ctx, t, pod, logf, t.WorkingDir)
+	if err != nil {
+		_, _ = io.WriteString(logf, fmt.Sprintf("failed to expand working dir %q. Error: %s\n", t.WorkingDir, err))
+		return -1, err
+	}
+
+	execConfig := &driver.ExecConfig{
+		Cmd:         cmd,
+		Env:         t.Environment,
+		WorkingDir:  workingDir,
+		AttachStdin: true,
+		Stdout:      archivef,
+		Stderr:      logf,
+	}
+
+	ce, err := pod.Exec(ctx, execConfig)
+	if err != nil {
+		return -1, err
+	}
+
+	type ArchiveInfo struct {
+		SourceDir string
+		DestDir   string
+		Paths     []string
+	}
+	type Archive struct {
+		ArchiveInfos []*ArchiveInfo
+		OutFile      string
+	}
+
+	a := &Archive{
+		OutFile: "", // use stdout
+		ArchiveInfos: []*ArchiveInfo{
+			{
+				SourceDir: ".",
+				DestDir:   "/",
+				Paths:     paths,
+			},
+		},
+	}
+
+	stdin := ce.Stdin()
+	enc := json.NewEncoder(stdin)
+
+	go func() {
+		_ = enc.Encode(a)
+		stdin.Close()
+	}()
+
+	exitCode, err := ce.Wait(ctx)
+	if err != nil {
+		return -1, err
+	}
+
+	if exitCode != 0 {
+		return exitCode, errors.Errorf("ended with exit code %d", exitCode)
+	}
+
+	return 0, nil
+}
+
 func (e *Executor) doRestoreCacheStep(ctx context.Context, s *types.RestoreCacheStep, t *types.ExecutorTask, pod driver.Pod, logPath string) (int, error) {
 	if err := os.MkdirAll(filepath.Dir(logPath), 0770); err != nil {
 		return -1, err
 	}
-	logf, err := os.Create(logPath)
+	logf, err := e.createLog(logPath)
 	if err != nil {
 		return -1, err
 	}
@@ -598,7 +1013,7 @@ func (e *Executor) doRestoreCacheStep(ctx context.Context, s *types.RestoreCache
 		// append cache prefix
 		key := t.CachePrefix + "-" + userKey
 
-		resp, err := e.runserviceClient.GetCache(ctx, key, true)
+		resp, err := e.runserviceClient.GetCache(ctx, t.StoragePartition, key, true)
 		if err != nil {
 			// ignore 404 errors since they means that the cache key doesn't exists
 			if resp != nil && resp.StatusCode == http.StatusNotFound {
@@ -628,6 +1043,10 @@ func (e *Executor) executorIDPath() string {
 	return filepath.Join(e.c.DataDir, "id")
 }
 
+func (e *Executor) executorTokenPath() string {
+	return filepath.Join(e.c.DataDir, "token")
+}
+
 func (e *Executor) tasksDir() string {
 	return filepath.Join(e.c.DataDir, "tasks")
 }
@@ -648,6 +1067,22 @@ func (e *Executor) stepLogPath(taskID string, stepID int) string {
 	return filepath.Join(e.taskLogsPath(taskID), "steps", fmt.Sprintf("%d.log", stepID))
 }
 
+// attemptLogPath returns the path where the log of a previous attempt is saved
+func attemptLogPath(logPath string, attempt int) string {
+	return fmt.Sprintf("%s.%d.log", strings.TrimSuffix(logPath, ".log"), attempt)
+}
+
+// rotateAttemptLog moves the log of the previous attempt to its attempt path
+func rotateAttemptLog(logPath string, attempt int) error {
+	if err := os.Rename(logPath, attemptLogPath(logPath, attempt)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(fullLogPath(logPath), fullLogPath(attemptLogPath(logPath, attempt))); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
 func (e *Executor) archivePath(taskID string, stepID int) string {
 	return filepath.Join(e.taskPath(taskID), "archives", fmt.Sprintf("%d.tar", stepID))
 }
@@ -694,6 +1129,9 @@ func (e *Executor) sendExecutorStatus(ctx context.Context) error {
 	executor := &types.Executor{
 		ID:                        e.id,
 		Archs:                     archs,
+		ArchiveFormats:            []types.ArchiveFormat{types.ArchiveFormatTar, types.ArchiveFormatTarZstd},
+		ResumableFetch:            true,
+		ToolboxProtocolVersion:    toolbox.ProtocolVersion,
 		AllowPrivilegedContainers: e.c.AllowPrivilegedContainers,
 		ListenURL:                 e.listenURL,
 		Labels:                    labels,
@@ -702,6 +1140,7 @@ func (e *Executor) sendExecutorStatus(ctx context.Context) error {
 		Dynamic:                   e.dynamic,
 		ExecutorGroup:             executorGroup,
 		SiblingsExecutors:         siblingsExecutors,
+		HostFacts:                 e.hostFacts,
 	}
 
 	log.Debugf("send executor status: %s", util.Dump(executor))
@@ -716,30 +1155,99 @@ func (e *Executor) sendExecutorTaskStatus(ctx context.Context, et *types.Executo
 }
 
 func (e *Executor) stopTask(ctx context.Context, et *types.ExecutorTask) {
-	if rt, ok := e.runningTasks.get(et.ID); ok {
-		rt.Lock()
-		defer rt.Unlock()
-		if rt.et.Status.Phase.IsFinished() {
-			return
-		}
-		if rt.pod != nil {
-			if err := rt.pod.Stop(ctx); err != nil {
-				log.Errorf("err: %+v", err)
-				return
-			}
-			if rt.et.Status.Phase == types.ExecutorTaskPhaseNotStarted {
-				rt.et.Status.Phase = types.ExecutorTaskPhaseCancelled
-			} else {
-				rt.et.Status.Phase = types.ExecutorTaskPhaseStopped
-			}
+	rt, ok := e.runningTasks.get(et.ID)
+	if !ok {
+		// cancel the task if not yet started
+		if et.Status.Phase == types.ExecutorTaskPhaseNotStarted {
+			et.Status.Phase = types.ExecutorTaskPhaseCancelled
 			if err := e.sendExecutorTaskStatus(ctx, et); err != nil {
 				log.Errorf("err: %+v", err)
-				return
 			}
 		}
+		return
+	}
+
+	rt.Lock()
+	if rt.et.Status.Phase.IsFinished() || rt.et.Stop {
+		rt.Unlock()
+		return
+	}
+	// mark the running task as stopped to not retry it
+	rt.et.Stop = true
+	pod := rt.pod
+	rt.Unlock()
+
+	if pod != nil {
+		go e.terminateTask(ctx, rt, pod)
 	}
 }
 
+// terminateTask sends a SIGTERM to the task processes and waits for the
+// task to finish. If still running after the stop grace period its pod is
+// stopped killing the remaining processes.
+func (e *Executor) terminateTask(ctx context.Context, rt *runningTask, pod driver.Pod) {
+	if err := e.signalTask(ctx, pod); err != nil {
+		log.Warnf("failed to send SIGTERM to task %s processes: %v", rt.et.ID, err)
+	}
+
+	deadline := time.Now().Add(e.c.StopGracePeriod)
+	for time.Now().Before(deadline) {
+		rt.Lock()
+		executing := rt.executing
+		rt.Unlock()
+		if !executing {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+
+	rt.Lock()
+	defer rt.Unlock()
+	if rt.et.Status.Phase.IsFinished() {
+		return
+	}
+	if err := pod.Stop(ctx); err != nil {
+		log.Errorf("err: %+v", err)
+		return
+	}
+	if rt.et.Status.Phase == types.ExecutorTaskPhaseNotStarted {
+		rt.et.Status.Phase = types.ExecutorTaskPhaseCancelled
+	} else {
+		rt.et.Status.Phase = types.ExecutorTaskPhaseStopped
+	}
+	if err := e.sendExecutorTaskStatus(ctx, rt.et); err != nil {
+		log.Errorf("err: %+v", err)
+	}
+}
+
+// signalTask sends a SIGTERM to all the task main container processes
+func (e *Executor) signalTask(ctx context.Context, pod driver.Pod) error {
+	execConfig := &driver.ExecConfig{
+		Cmd:    []string{toolboxContainerPath, "signal"},
+		Stdout: ioutil.Discard,
+		Stderr: ioutil.Discard,
+	}
+
+	ce, err := pod.Exec(ctx, execConfig)
+	if err != nil {
+		return err
+	}
+
+	exitCode, err := ce.Wait(ctx)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return errors.Errorf("signal ended with exit code %d", exitCode)
+	}
+
+	return nil
+}
+
 func (e *Executor) executeTask(ctx context.Context, et *types.ExecutorTask) {
 	// * save in local state that we have a running task
 	// * start the pod
@@ -760,43 +1268,144 @@ func (e *Executor) executeTask(ctx context.Context, et *types.ExecutorTask) {
 		return
 	}
 
-	rt := &runningTask{
-		et:        et,
-		executing: true,
+	rt := &runningTask{
+		et:        et,
+		executing: true,
+	}
+
+	rt.Lock()
+
+	if !e.runningTasks.addIfNotExists(et.ID, rt) {
+		log.Debugf("task %s already running", et.ID)
+		return
+	}
+
+	// acquire the task lease so no other executor can execute the task at the
+	// same time (i.e. a previous executor partitioned from the runservice)
+	leaseStartTime := time.Now()
+	lease, _, lerr := e.runserviceClient.AcquireExecutorTaskLease(ctx, e.id, et.ID)
+	if lerr != nil {
+		log.Warnf("failed to acquire lease for task %s: %v", et.ID, lerr)
+		e.runningTasks.delete(et.ID)
+		rt.Unlock()
+		return
+	}
+	et.Status.LeaseToken = lease.Token
+	// use the local request start time to expire the lease before the
+	// runservice
+	rt.leaseExpireTime = leaseStartTime.Add(lease.Duration)
+
+	defer func() {
+		rt.Lock()
+		rt.executing = false
+		rt.Unlock()
+	}()
+
+	et.Status.Phase = types.ExecutorTaskPhaseRunning
+	et.Status.StartTime = util.TimePtr(time.Now())
+
+	var setupFailed bool
+	var err error
+	for {
+		var cond types.RetryCondition
+		setupFailed, cond, err = e.executeTaskAttempt(ctx, rt)
+		if err == nil {
+			break
+		}
+		log.Errorf("err: %+v", err)
+
+		rt.Lock()
+		retry := shouldRetry(ctx, rt.et.Stop, rt.et.Retries, rt.et.Status.Attempts-1, cond)
+		rt.Unlock()
+		if !retry {
+			break
+		}
+		if !e.prepareTaskRetry(ctx, rt) {
+			// the executor is shutting down
+			return
+		}
+
+		rt.Lock()
+		if rt.et.Stop {
+			rt.et.Status.Phase = types.ExecutorTaskPhaseStopped
+			rt.et.Status.EndTime = util.TimePtr(time.Now())
+			if err := e.sendExecutorTaskStatus(ctx, et); err != nil {
+				log.Errorf("err: %+v", err)
+			}
+			rt.Unlock()
+			return
+		}
+	}
+
+	if setupFailed {
+		rt.Lock()
+		rt.et.Status.Phase = types.ExecutorTaskPhaseFailed
+		if err := e.sendExecutorTaskStatus(ctx, et); err != nil {
+			log.Errorf("err: %+v", err)
+		}
+		rt.Unlock()
+		return
+	}
+
+	previewURL, perr := e.previewURL(ctx, et, rt.pod, ioutil.Discard)
+	if perr != nil {
+		log.Errorf("failed to get task preview url: %+v", perr)
+	}
+
+	outputs, oerr := e.taskOutputs(ctx, et, rt.pod, ioutil.Discard)
+	if oerr != nil {
+		log.Errorf("failed to get task outputs: %+v", oerr)
 	}
 
 	rt.Lock()
+	rt.et.Status.PreviewURL = previewURL
+	rt.et.Status.Outputs = outputs
+	if err != nil {
+		if rt.et.Stop {
+			rt.et.Status.Phase = types.ExecutorTaskPhaseStopped
+		} else {
+			rt.et.Status.Phase = types.ExecutorTaskPhaseFailed
+		}
+	} else {
+		rt.et.Status.Phase = types.ExecutorTaskPhaseSuccess
+	}
 
-	if !e.runningTasks.addIfNotExists(et.ID, rt) {
-		log.Debugf("task %s already running", et.ID)
-		return
+	rt.et.Status.EndTime = util.TimePtr(time.Now())
+
+	if err := e.sendExecutorTaskStatus(ctx, et); err != nil {
+		log.Errorf("err: %+v", err)
 	}
+	rt.Unlock()
+}
 
-	defer func() {
-		rt.Lock()
-		rt.executing = false
-		rt.Unlock()
-	}()
+// executeTaskAttempt sets up the task pod and executes the task steps. It
+// must be called with the running task locked and returns with it unlocked.
+// It reports if the setup failed and the failure retry condition.
+func (e *Executor) executeTaskAttempt(ctx context.Context, rt *runningTask) (bool, types.RetryCondition, error) {
+	et := rt.et
 
-	et.Status.Phase = types.ExecutorTaskPhaseRunning
-	et.Status.StartTime = util.TimePtr(time.Now())
+	et.Status.Attempts++
+	if et.Status.Attempts > 1 {
+		if err := rotateAttemptLog(e.setupLogPath(et.ID), et.Status.Attempts-2); err != nil {
+			log.Errorf("failed to rotate setup log: %+v", err)
+		}
+	}
+	et.Status.FailureReason = nil
 	et.Status.SetupStep.Phase = types.ExecutorTaskPhaseRunning
 	et.Status.SetupStep.StartTime = util.TimePtr(time.Now())
+	et.Status.SetupStep.EndTime = nil
 	if err := e.sendExecutorTaskStatus(ctx, et); err != nil {
 		log.Errorf("err: %+v", err)
 	}
 
 	if err := e.setupTask(ctx, rt); err != nil {
-		log.Errorf("err: %+v", err)
-		rt.et.Status.Phase = types.ExecutorTaskPhaseFailed
-		et.Status.SetupStep.EndTime = util.TimePtr(time.Now())
 		et.Status.SetupStep.Phase = types.ExecutorTaskPhaseFailed
 		et.Status.SetupStep.EndTime = util.TimePtr(time.Now())
 		if err := e.sendExecutorTaskStatus(ctx, et); err != nil {
 			log.Errorf("err: %+v", err)
 		}
 		rt.Unlock()
-		return
+		return true, types.RetryConditionError, err
 	}
 
 	et.Status.SetupStep.Phase = types.ExecutorTaskPhaseSuccess
@@ -807,28 +1416,69 @@ func (e *Executor) executeTask(ctx context.Context, et *types.ExecutorTask) {
 
 	rt.Unlock()
 
-	_, err := e.executeTaskSteps(ctx, rt, rt.pod)
+	cond, err := e.executeTaskSteps(ctx, rt, rt.pod)
+	return false, cond, err
+}
 
+// prepareTaskRetry removes the pod of the failed task attempt, resets the
+// steps status and waits for the retry delay. It returns false if ctx is done
+// before the retry delay.
+func (e *Executor) prepareTaskRetry(ctx context.Context, rt *runningTask) bool {
 	rt.Lock()
-	if err != nil {
+	pod := rt.pod
+	rt.pod = nil
+	for _, s := range rt.et.Status.Steps {
+		s.Phase = types.ExecutorTaskPhaseNotStarted
+		s.StartTime = nil
+		s.EndTime = nil
+		s.ExitCode = 0
+	}
+	rt.et.Status.ExportedEnvironment = nil
+	rt.et.Status.Outputs = nil
+	delay := rt.et.Retries.Delay
+	log.Infof("retrying task %s in %s, attempt %d", rt.et.ID, delay, rt.et.Status.Attempts+1)
+	if err := e.sendExecutorTaskStatus(ctx, rt.et); err != nil {
 		log.Errorf("err: %+v", err)
-		rt.et.Status.Phase = types.ExecutorTaskPhaseFailed
-	} else {
-		rt.et.Status.Phase = types.ExecutorTaskPhaseSuccess
 	}
+	rt.Unlock()
 
-	rt.et.Status.EndTime = util.TimePtr(time.Now())
+	if pod != nil {
+		if err := pod.Remove(ctx); err != nil {
+			log.Errorf("failed to remove pod: %+v", err)
+		}
+	}
 
-	if err := e.sendExecutorTaskStatus(ctx, et); err != nil {
-		log.Errorf("err: %+v", err)
+	return waitRetryDelay(ctx, delay)
+}
+
+// shouldRetry reports if the failed attempt (starting from 0) must be
+// retried. The attempts of a stopped task or after ctx is done (the executor
+// is shutting down) are never retried.
+func shouldRetry(ctx context.Context, stop bool, retries *types.Retries, attempt int, cond types.RetryCondition) bool {
+	if stop || ctx.Err() != nil {
+		return false
+	}
+	return retries.ShouldRetry(attempt, cond)
+}
+
+// waitRetryDelay waits for the retry delay. It returns false if ctx is done
+// before.
+func waitRetryDelay(ctx context.Context, delay time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(delay):
+		return true
 	}
-	rt.Unlock()
 }
 
 func (e *Executor) setupTask(ctx context.Context, rt *runningTask) error {
 	et := rt.et
-	if err := os.RemoveAll(e.taskPath(et.ID)); err != nil {
-		return err
+	// keep the logs of the previous attempts
+	if et.Status.Attempts <= 1 {
+		if err := os.RemoveAll(e.taskPath(et.ID)); err != nil {
+			return err
+		}
 	}
 	if err := os.MkdirAll(e.taskPath(et.ID), 0770); err != nil {
 		return err
@@ -838,7 +1488,7 @@ func (e *Executor) setupTask(ctx context.Context, rt *runningTask) error {
 	if err := os.MkdirAll(filepath.Dir(setupLogPath), 0770); err != nil {
 		return err
 	}
-	outf, err := os.Create(setupLogPath)
+	outf, err := e.createLog(setupLogPath)
 	if err != nil {
 		return err
 	}
@@ -857,9 +1507,28 @@ func (e *Executor) setupTask(ctx context.Context, rt *runningTask) error {
 		return errors.Errorf("executor doesn't allow executing privileged containers")
 	}
 
+	// rewrite the images to use the registry mirrors
+	images := make([]string, len(et.Containers))
+	for i, c := range et.Containers {
+		images[i] = c.Image
+		if len(e.c.RegistryMirrors) == 0 {
+			continue
+		}
+		image, mirrored, err := registry.MirrorImage(c.Image, e.c.RegistryMirrors)
+		if err != nil {
+			_, _ = outf.WriteString(fmt.Sprintf("Wrong image %q: %s\n", c.Image, err))
+			return errors.Errorf("wrong image %q: %w", c.Image, err)
+		}
+		if !mirrored {
+			_, _ = outf.WriteString(fmt.Sprintf("Warning: image %q registry isn't mirrored.\n", c.Image))
+			continue
+		}
+		images[i] = image
+	}
+
 	log.Debugf("starting pod")
 
-	dockerConfig, err := registry.GenDockerConfig(et.DockerRegistriesAuth, []string{et.Containers[0].Image})
+	dockerConfig, err := registry.GenDockerConfig(et.DockerRegistriesAuth, []string{images[0]})
 	if err != nil {
 		return err
 	}
@@ -872,8 +1541,15 @@ func (e *Executor) setupTask(ctx context.Context, rt *runningTask) error {
 		Arch:          et.Arch,
 		InitVolumeDir: toolboxContainerDir,
 		DockerConfig:  dockerConfig,
+		ExtraHosts:    et.ExtraHosts,
+		DNS:           et.DNS,
+		HostNetwork:   et.HostNetwork,
+		Files:         make([]*driver.File, len(et.SecretFiles)),
 		Containers:    make([]*driver.ContainerConfig, len(et.Containers)),
 	}
+	for i, sf := range et.SecretFiles {
+		podConfig.Files[i] = &driver.File{Path: sf.Path, Mode: sf.Mode, Data: []byte(sf.Content)}
+	}
 	for i, c := range et.Containers {
 		var cmd []string
 		if i == 0 {
@@ -883,10 +1559,18 @@ func (e *Executor) setupTask(ctx context.Context, rt *runningTask) error {
 			cmd = strings.Split(c.Entrypoint, " ")
 		}
 
+		// the instance proxy variables can be overridden by the container
+		// environment
+		env := e.c.Proxy.Env()
+		for k, v := range c.Environment {
+			env[k] = v
+		}
+
 		podConfig.Containers[i] = &driver.ContainerConfig{
-			Image:      c.Image,
+			Image:      images[i],
 			Cmd:        cmd,
-			Env:        c.Environment,
+			Args:       c.Args,
+			Env:        env,
 			User:       c.User,
 			Privileged: c.Privileged,
 		}
@@ -900,9 +1584,14 @@ func (e *Executor) setupTask(ctx context.Context, rt *runningTask) error {
 	}
 	_, _ = outf.WriteString("Pod started.\n")
 
+	if err := e.checkToolboxVersion(ctx, pod, outf); err != nil {
+		_, _ = outf.WriteString(fmt.Sprintf("Incompatible toolbox. Error: %s\n", err))
+		return err
+	}
+
 	if et.WorkingDir != "" {
 		_, _ = outf.WriteString(fmt.Sprintf("Creating working dir %q.\n", et.WorkingDir))
-		if err := e.mkdir(ctx, et, pod, outf, et.WorkingDir); err != nil {
+		if err := e.mkdir(ctx, et, pod, outf, et.WorkingDir, ""); err != nil {
 			_, _ = outf.WriteString(fmt.Sprintf("Failed to create working dir %q. Error: %s\n", et.WorkingDir, err))
 			return err
 		}
@@ -912,83 +1601,274 @@ func (e *Executor) setupTask(ctx context.Context, rt *runningTask) error {
 	return nil
 }
 
-func (e *Executor) executeTaskSteps(ctx context.Context, rt *runningTask, pod driver.Pod) (int, error) {
+// executeTaskSteps executes the task steps retrying them when required by the
+// step retry policy. It returns the retry condition of the failed step.
+func (e *Executor) executeTaskSteps(ctx context.Context, rt *runningTask, pod driver.Pod) (types.RetryCondition, error) {
+	// after a step failure only the steps with a when expression are
+	// evaluated, the first failure is reported
+	var failedCond types.RetryCondition
+	var failedErr error
+
 	for i, step := range rt.et.Steps {
-		rt.Lock()
-		rt.et.Status.Steps[i].Phase = types.ExecutorTaskPhaseRunning
-		rt.et.Status.Steps[i].StartTime = util.TimePtr(time.Now())
-		if err := e.sendExecutorTaskStatus(ctx, rt.et); err != nil {
-			log.Errorf("err: %+v", err)
+		var when string
+		if b, ok := step.(interface{ Base() *types.BaseStep }); ok {
+			when = b.Base().When
+		}
+		if when == "" && failedErr != nil {
+			continue
+		}
+		if when != "" && !matchStepWhen(when, rt.et.ExprVariables, failedErr != nil) {
+			rt.Lock()
+			stepStatus := rt.et.Status.Steps[i]
+			stepStatus.Phase = types.ExecutorTaskPhaseSkipped
+			if err := e.sendExecutorTaskStatus(ctx, rt.et); err != nil {
+				log.Errorf("err: %+v", err)
+			}
+			rt.Unlock()
+			continue
 		}
-		rt.Unlock()
-
-		var err error
-		var exitCode int
-		var stepName string
-
-		switch s := step.(type) {
-		case *types.RunStep:
-			log.Debugf("run step: %s", util.Dump(s))
-			stepName = s.Name
-			exitCode, err = e.doRunStep(ctx, s, rt.et, pod, e.stepLogPath(rt.et.ID, i))
-
-		case *types.SaveToWorkspaceStep:
-			log.Debugf("save to workspace step: %s", util.Dump(s))
-			stepName = s.Name
-			archivePath := e.archivePath(rt.et.ID, i)
-			exitCode, err = e.doSaveToWorkspaceStep(ctx, s, rt.et, pod, e.stepLogPath(rt.et.ID, i), archivePath)
-
-		case *types.RestoreWorkspaceStep:
-			log.Debugf("restore workspace step: %s", util.Dump(s))
-			stepName = s.Name
-			exitCode, err = e.doRestoreWorkspaceStep(ctx, s, rt.et, pod, e.stepLogPath(rt.et.ID, i))
-
-		case *types.SaveCacheStep:
-			log.Debugf("save cache step: %s", util.Dump(s))
-			stepName = s.Name
-			archivePath := e.archivePath(rt.et.ID, i)
-			exitCode, err = e.doSaveCacheStep(ctx, s, rt.et, pod, e.stepLogPath(rt.et.ID, i), archivePath)
-
-		case *types.RestoreCacheStep:
-			log.Debugf("restore cache step: %s", util.Dump(s))
-			stepName = s.Name
-			exitCode, err = e.doRestoreCacheStep(ctx, s, rt.et, pod, e.stepLogPath(rt.et.ID, i))
 
-		default:
-			return i, errors.Errorf("unknown step type: %s", util.Dump(s))
+		var retries *types.Retries
+		if s, ok := step.(*types.RunStep); ok {
+			retries = s.Retries
 		}
 
-		var serr error
+		for {
+			rt.Lock()
+			// don't execute the next steps of a stopped task
+			if rt.et.Stop {
+				rt.Unlock()
+				return types.RetryConditionError, errors.Errorf("task stopped")
+			}
+			stepStatus := rt.et.Status.Steps[i]
+			stepStatus.Attempts++
+			if stepStatus.Attempts > 1 {
+				if err := rotateAttemptLog(e.stepLogPath(rt.et.ID, i), stepStatus.Attempts-2); err != nil {
+					log.Errorf("failed to rotate step log: %+v", err)
+				}
+			}
+			stepStatus.Phase = types.ExecutorTaskPhaseRunning
+			stepStatus.StartTime = util.TimePtr(time.Now())
+			stepStatus.EndTime = nil
+			stepStatus.ExitCode = 0
+			if err := e.sendExecutorTaskStatus(ctx, rt.et); err != nil {
+				log.Errorf("err: %+v", err)
+			}
+			rt.Unlock()
+
+			stepName, exitCode, err := e.executeStep(ctx, rt, pod, i, step)
 
-		rt.Lock()
-		rt.et.Status.Steps[i].EndTime = util.TimePtr(time.Now())
+			// a step killed without being stopped could have been oom killed or its
+			// pod evicted
+			var failureReason *types.TaskFailureReason
+			if (err != nil && !rt.et.Stop) || exitCode == sigkillExitCode {
+				failureReason = e.taskFailureReason(ctx, pod, i)
+			}
 
-		rt.et.Status.Steps[i].Phase = types.ExecutorTaskPhaseSuccess
+			var serr error
+			var cond types.RetryCondition
 
-		if err != nil {
-			if rt.et.Stop {
-				rt.et.Status.Steps[i].Phase = types.ExecutorTaskPhaseStopped
-			} else {
-				rt.et.Status.Steps[i].Phase = types.ExecutorTaskPhaseFailed
+			rt.Lock()
+			stepStatus.EndTime = util.TimePtr(time.Now())
+			if failureReason != nil {
+				rt.et.Status.FailureReason = failureReason
 			}
-			serr = errors.Errorf("failed to execute step %s: %w", util.Dump(step), err)
-		} else if exitCode != 0 {
-			rt.et.Status.Steps[i].Phase = types.ExecutorTaskPhaseFailed
-			rt.et.Status.Steps[i].ExitCode = exitCode
-			serr = errors.Errorf("step %q failed with exitcode %d", stepName, exitCode)
-		}
 
-		if err := e.sendExecutorTaskStatus(ctx, rt.et); err != nil {
-			log.Errorf("err: %+v", err)
+			stepStatus.Phase = types.ExecutorTaskPhaseSuccess
+
+			if err != nil {
+				if rt.et.Stop {
+					stepStatus.Phase = types.ExecutorTaskPhaseStopped
+				} else {
+					stepStatus.Phase = types.ExecutorTaskPhaseFailed
+				}
+				cond = types.RetryConditionError
+				serr = errors.Errorf("failed to execute step %s: %w", util.Dump(step), err)
+			} else if exitCode != 0 {
+				if rt.et.Stop {
+					stepStatus.Phase = types.ExecutorTaskPhaseStopped
+				} else {
+					stepStatus.Phase = types.ExecutorTaskPhaseFailed
+				}
+				stepStatus.ExitCode = exitCode
+				cond = types.RetryConditionFailure
+				serr = errors.Errorf("step %q failed with exitcode %d", stepName, exitCode)
+			}
+
+			retry := serr != nil && shouldRetry(ctx, rt.et.Stop, retries, stepStatus.Attempts-1, cond)
+			if retry {
+				// keep the step running until the retry
+				stepStatus.Phase = types.ExecutorTaskPhaseRunning
+			}
+
+			if err := e.sendExecutorTaskStatus(ctx, rt.et); err != nil {
+				log.Errorf("err: %+v", err)
+			}
+			rt.Unlock()
+
+			if retry {
+				log.Infof("retrying step %q of task %s in %s: %v", stepName, rt.et.ID, retries.Delay, serr)
+				if waitRetryDelay(ctx, retries.Delay) {
+					continue
+				}
+				rt.Lock()
+				stepStatus.Phase = types.ExecutorTaskPhaseFailed
+				rt.Unlock()
+				return cond, serr
+			}
+
+			if serr != nil && failedErr == nil {
+				failedCond, failedErr = cond, serr
+			}
+			break
 		}
-		rt.Unlock()
+	}
 
-		if serr != nil {
-			return i, serr
+	return failedCond, failedErr
+}
+
+// matchStepWhen evaluates the step when expression. The expressions are
+// checked when parsing the config so an expression that cannot be parsed
+// doesn't match.
+func matchStepWhen(when string, exprVariables map[string]string, taskFailed bool) bool {
+	variables := make(map[string]string, len(exprVariables)+1)
+	for k, v := range exprVariables {
+		variables[k] = v
+	}
+	variables[rcconfig.ExprVariableTaskStatus] = rcconfig.TaskStatusSuccess
+	if taskFailed {
+		variables[rcconfig.ExprVariableTaskStatus] = rcconfig.TaskStatusFailed
+	}
+
+	t, err := expr.Parse(when)
+	if err != nil {
+		return false
+	}
+	return t.EvalBool(variables)
+}
+
+// executeStep executes a task step returning its name and exit code
+func (e *Executor) executeStep(ctx context.Context, rt *runningTask, pod driver.Pod, i int, step interface{}) (string, int, error) {
+	switch s := step.(type) {
+	case *types.RunStep:
+		log.Debugf("run step: %s", util.Dump(s))
+		exitCode, err := e.doRunStep(ctx, s, rt.et, pod, e.stepLogPath(rt.et.ID, i))
+		return s.Name, exitCode, err
+
+	case *types.SaveToWorkspaceStep:
+		log.Debugf("save to workspace step: %s", util.Dump(s))
+		archivePath := e.archivePath(rt.et.ID, i)
+		exitCode, err := e.doSaveToWorkspaceStep(ctx, s, rt.et, pod, e.stepLogPath(rt.et.ID, i), archivePath)
+		return s.Name, exitCode, err
+
+	case *types.RestoreWorkspaceStep:
+		log.Debugf("restore workspace step: %s", util.Dump(s))
+		exitCode, err := e.doRestoreWorkspaceStep(ctx, s, rt.et, pod, e.stepLogPath(rt.et.ID, i))
+		return s.Name, exitCode, err
+
+	case *types.SaveCacheStep:
+		log.Debugf("save cache step: %s", util.Dump(s))
+		archivePath := e.archivePath(rt.et.ID, i)
+		exitCode, err := e.doSaveCacheStep(ctx, s, rt.et, pod, e.stepLogPath(rt.et.ID, i), archivePath)
+		return s.Name, exitCode, err
+
+	case *types.RestoreCacheStep:
+		log.Debugf("restore cache step: %s", util.Dump(s))
+		exitCode, err := e.doRestoreCacheStep(ctx, s, rt.et, pod, e.stepLogPath(rt.et.ID, i))
+		return s.Name, exitCode, err
+
+	case *types.SaveTestReportStep:
+		log.Debugf("save test report step: %s", util.Dump(s))
+		archivePath := e.archivePath(rt.et.ID, i)
+		exitCode, err := e.doSaveTestReportStep(ctx, s, rt.et, pod, i, e.stepLogPath(rt.et.ID, i), archivePath)
+		return s.Name, exitCode, err
+
+	case *types.SaveCoverageReportStep:
+		log.Debugf("save coverage report step: %s", util.Dump(s))
+		archivePath := e.archivePath(rt.et.ID, i)
+		exitCode, err := e.doSaveCoverageReportStep(ctx, s, rt.et, pod, i, e.stepLogPath(rt.et.ID, i), archivePath)
+		return s.Name, exitCode, err
+
+	case *types.ExportEnvStep:
+		log.Debugf("export env step: %s", util.Dump(s))
+		env, exitCode, err := e.doExportEnvStep(ctx, s, rt.et, pod, e.stepLogPath(rt.et.ID, i))
+		if env != nil {
+			rt.Lock()
+			if rt.et.Status.ExportedEnvironment == nil {
+				rt.et.Status.ExportedEnvironment = map[string]string{}
+			}
+			for k, v := range env {
+				rt.et.Status.ExportedEnvironment[k] = v
+			}
+			rt.Unlock()
 		}
+		return s.Name, exitCode, err
+
+	case *types.ParallelStep:
+		log.Debugf("parallel step: %s", util.Dump(s))
+		exitCode, err := e.doParallelStep(ctx, s, rt.et, pod, e.stepLogPath(rt.et.ID, i))
+		return s.Name, exitCode, err
+
+	default:
+		return "", -1, errors.Errorf("unknown step type: %s", util.Dump(s))
 	}
+}
 
-	return 0, nil
+// taskFailureReason returns the task failure reason if the pod diagnostics
+// report that the step was oom killed or the pod was evicted
+func (e *Executor) taskFailureReason(ctx context.Context, pod driver.Pod, step int) *types.TaskFailureReason {
+	pd, err := pod.Diagnostics(ctx)
+	if err != nil {
+		log.Warnf("failed to get pod diagnostics: %+v", err)
+		return nil
+	}
+
+	return podTaskFailureReason(pd, step)
+}
+
+func podTaskFailureReason(pd *driver.PodDiagnostics, step int) *types.TaskFailureReason {
+	fr := &types.TaskFailureReason{
+		Step:            step,
+		MemoryLimit:     pd.MemoryLimit,
+		MemoryPeakUsage: pd.MemoryPeakUsage,
+	}
+	switch pd.FailReason {
+	case driver.PodFailReasonOOMKilled:
+		fr.Type = types.TaskFailureTypeOOMKilled
+		fr.Message = "step killed by the oom killer"
+		fr.SuggestedMemoryLimit = suggestMemoryLimit(pd.MemoryLimit, pd.MemoryPeakUsage)
+	case driver.PodFailReasonEvicted:
+		fr.Type = types.TaskFailureTypeEvicted
+		fr.Message = "task pod evicted"
+	default:
+		return nil
+	}
+	if pd.Message != "" {
+		fr.Message += ": " + pd.Message
+	}
+	if fr.SuggestedMemoryLimit > 0 {
+		fr.Message += fmt.Sprintf(" (memory limit %dMiB, consider raising it to %dMiB)", fr.MemoryLimit/mib, fr.SuggestedMemoryLimit/mib)
+	}
+
+	return fr
+}
+
+// suggestMemoryLimit suggests a memory limit that's the double of the current
+// limit (or peak usage if greater) rounded up to memoryLimitStep. Returns 0 if
+// the container had no limit.
+func suggestMemoryLimit(limit, peakUsage int64) int64 {
+	if limit <= 0 {
+		return 0
+	}
+	base := limit
+	if peakUsage > base {
+		base = peakUsage
+	}
+	suggested := base * 2
+	if r := suggested % memoryLimitStep; r != 0 {
+		suggested += memoryLimitStep - r
+	}
+	return suggested
 }
 
 func (e *Executor) podsCleanerLoop(ctx context.Context) {
@@ -1077,6 +1957,12 @@ func (e *Executor) executorTasksStatusSenderLoop(ctx context.Context) {
 			}
 
 			rt.Lock()
+			// send a heartbeat for the running tasks so the runservice can
+			// detect the tasks orphaned by a dead executor
+			if rt.executing && rt.et.Status.Phase == types.ExecutorTaskPhaseRunning {
+				now := time.Now()
+				rt.et.Status.HeartbeatTime = &now
+			}
 			if err := e.sendExecutorTaskStatus(ctx, rt.et); err != nil {
 				log.Errorf("err: %+v", err)
 				rt.Unlock()
@@ -1100,6 +1986,61 @@ func (e *Executor) executorTasksStatusSenderLoop(ctx context.Context) {
 	}
 }
 
+func (e *Executor) tasksLeaseRenewerLoop(ctx context.Context) {
+	for {
+		log.Debugf("tasksLeaseRenewerLoop")
+
+		for _, rtID := range e.runningTasks.ids() {
+			rt, ok := e.runningTasks.get(rtID)
+			if !ok {
+				continue
+			}
+			e.renewTaskLease(ctx, rt)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		time.Sleep(taskLeaseRenewInterval)
+	}
+}
+
+// renewTaskLease renews the lease of an executing task. If the lease has been
+// acquired by another executor or it's expired since it couldn't be renewed
+// in time the task is stopped.
+func (e *Executor) renewTaskLease(ctx context.Context, rt *runningTask) {
+	rt.Lock()
+	if !rt.executing || rt.et.Status.LeaseToken == 0 {
+		rt.Unlock()
+		return
+	}
+	et := rt.et
+	token := rt.et.Status.LeaseToken
+	rt.Unlock()
+
+	renewStartTime := time.Now()
+	lease, resp, err := e.runserviceClient.RenewExecutorTaskLease(ctx, e.id, et.ID, token)
+	if err == nil {
+		rt.Lock()
+		rt.leaseExpireTime = renewStartTime.Add(lease.Duration)
+		rt.Unlock()
+		return
+	}
+	log.Warnf("failed to renew lease for task %s: %v", et.ID, err)
+
+	lost := resp != nil && resp.StatusCode == http.StatusConflict
+	rt.Lock()
+	expired := !time.Now().Before(rt.leaseExpireTime)
+	rt.Unlock()
+	if lost || expired {
+		log.Warnf("lease for task %s lost, stopping it", et.ID)
+		e.stopTask(ctx, et)
+	}
+}
+
 func (e *Executor) tasksUpdaterLoop(ctx context.Context) {
 	for {
 		log.Debugf("tasksUpdater")
@@ -1244,6 +2185,9 @@ type runningTask struct {
 	pod driver.Pod
 
 	executing bool
+
+	// leaseExpireTime is the local expire time of the task lease
+	leaseExpireTime time.Time
 }
 
 func (r *runningTasks) get(rtID string) (*runningTask, bool) {
@@ -1306,10 +2250,52 @@ func (e *Executor) saveExecutorID(id string) error {
 	return nil
 }
 
+func (e *Executor) getExecutorToken() (string, error) {
+	token, err := ioutil.ReadFile(e.executorTokenPath())
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	return string(token), nil
+}
+
+func (e *Executor) saveExecutorToken(token string) error {
+	if err := common.WriteFileAtomic(e.executorTokenPath(), []byte(token), 0600); err != nil {
+		return errors.Errorf("failed to write executor token file: %w", err)
+	}
+	return nil
+}
+
+func genExecutorToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func getHostFacts() *types.ExecutorHostFacts {
+	hostFacts := &types.ExecutorHostFacts{
+		OS:     runtime.GOOS,
+		NumCPU: runtime.NumCPU(),
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		hostFacts.Hostname = hostname
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
+				hostFacts.IPAddresses = append(hostFacts.IPAddresses, ipnet.IP.String())
+			}
+		}
+	}
+	return hostFacts
+}
+
 type Executor struct {
 	c                *config.Executor
 	runserviceClient *rsapi.Client
 	id               string
+	hostFacts        *types.ExecutorHostFacts
 	runningTasks     *runningTasks
 	driver           driver.Driver
 	listenURL        string
@@ -1327,9 +2313,12 @@ func NewExecutor(c *config.Executor) (*Executor, error) {
 		return nil, errors.Errorf("cannot determine \"agola-toolbox\" absolute path: %w", err)
 	}
 
+	runserviceClient := rsapi.NewClient(c.RunserviceURL)
+	runserviceClient.SetInternalAPIToken(c.RunserviceAPIToken)
+
 	e := &Executor{
 		c:                c,
-		runserviceClient: rsapi.NewClient(c.RunserviceURL),
+		runserviceClient: runserviceClient,
 		runningTasks: &runningTasks{
 			tasks: make(map[string]*runningTask),
 		},
@@ -1352,6 +2341,25 @@ func NewExecutor(c *config.Executor) (*Executor, error) {
 
 	e.id = id
 
+	// the executor token is generated at the first start and identifies this
+	// executor to the runservice
+	token, err := e.getExecutorToken()
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		token, err = genExecutorToken()
+		if err != nil {
+			return nil, err
+		}
+		if err := e.saveExecutorToken(token); err != nil {
+			return nil, err
+		}
+	}
+	e.runserviceClient.SetExecutorCredentials(e.id, c.BootstrapToken, token)
+
+	e.hostFacts = getHostFacts()
+
 	addr, err := sockaddr.GetPrivateIP()
 	if err != nil {
 		return nil, errors.Errorf("cannot discover executor listen address: %w", err)
@@ -1391,38 +2399,68 @@ func NewExecutor(c *config.Executor) (*Executor, error) {
 	return e, nil
 }
 
-func (e *Executor) Run(ctx context.Context) error {
-	if err := e.driver.Setup(ctx); err != nil {
-		return err
-	}
-
-	ch := make(chan *types.ExecutorTask)
+// apiRouter returns the executor api router. All the api calls, used by the
+// runservice to submit tasks, fetch their logs and archives and exec inside
+// them, require one of the configured internal api tokens.
+func (e *Executor) apiRouter(ch chan *types.ExecutorTask) *mux.Router {
 	schedulerHandler := NewTaskSubmissionHandler(ch)
 	logsHandler := NewLogsHandler(logger, e)
 	archivesHandler := NewArchivesHandler(e)
+	execHandler := NewExecHandler(logger, e)
 
 	router := mux.NewRouter()
 	apirouter := router.PathPrefix("/api/v1alpha").Subrouter()
+	apirouter.Use(func(h http.Handler) http.Handler {
+		return util.NewInternalAPIAuthHandler(e.c.InternalAPIAuth.Tokens, h)
+	})
 
 	apirouter.Handle("/executor", schedulerHandler).Methods("POST")
 	apirouter.Handle("/executor/logs", logsHandler).Methods("GET")
 	apirouter.Handle("/executor/archives", archivesHandler).Methods("GET")
+	apirouter.Handle("/executor/exec", execHandler).Methods("GET")
+
+	return apirouter
+}
+
+func (e *Executor) Run(ctx context.Context) error {
+	if err := e.driver.Setup(ctx); err != nil {
+		return err
+	}
+
+	ch := make(chan *types.ExecutorTask)
+	apirouter := e.apiRouter(ch)
 
 	go e.executorStatusSenderLoop(ctx)
 	go e.executorTasksStatusSenderLoop(ctx)
 	go e.podsCleanerLoop(ctx)
 	go e.tasksUpdaterLoop(ctx)
+	go e.tasksLeaseRenewerLoop(ctx)
 	go e.tasksDataCleanerLoop(ctx)
 
 	go e.handleTasks(ctx, ch)
 
+	var tlsConfig *tls.Config
+	if e.c.Web.TLS {
+		var err error
+		tlsConfig, err = common.NewWebTLSConfig(ctx, logger, &e.c.Web)
+		if err != nil {
+			log.Errorf("err: %+v", err)
+			return err
+		}
+	}
+
 	httpServer := http.Server{
-		Addr:    e.c.Web.ListenAddress,
-		Handler: apirouter,
+		Addr:      e.c.Web.ListenAddress,
+		Handler:   apirouter,
+		TLSConfig: tlsConfig,
 	}
 	lerrCh := make(chan error)
 	go func() {
-		lerrCh <- httpServer.ListenAndServe()
+		if tlsConfig != nil {
+			lerrCh <- httpServer.ListenAndServeTLS("", "")
+		} else {
+			lerrCh <- httpServer.ListenAndServe()
+		}
 	}()
 
 	select {
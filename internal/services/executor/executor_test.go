@@ -0,0 +1,244 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"agola.io/agola/internal/services/executor/driver"
+	"agola.io/agola/internal/services/runservice/types"
+)
+
+func TestPodTaskFailureReason(t *testing.T) {
+	tests := []struct {
+		name string
+		pd   *driver.PodDiagnostics
+		out  *types.TaskFailureReason
+	}{
+		{
+			name: "oom killed",
+			pd:   &driver.PodDiagnostics{FailReason: driver.PodFailReasonOOMKilled, MemoryLimit: 512 * mib, MemoryPeakUsage: 500 * mib},
+			out: &types.TaskFailureReason{
+				Type:                 types.TaskFailureTypeOOMKilled,
+				Step:                 1,
+				Message:              "step killed by the oom killer (memory limit 512MiB, consider raising it to 1024MiB)",
+				MemoryLimit:          512 * mib,
+				MemoryPeakUsage:      500 * mib,
+				SuggestedMemoryLimit: 1024 * mib,
+			},
+		},
+		{
+			name: "oom killed without memory limit",
+			pd:   &driver.PodDiagnostics{FailReason: driver.PodFailReasonOOMKilled},
+			out: &types.TaskFailureReason{
+				Type:    types.TaskFailureTypeOOMKilled,
+				Step:    1,
+				Message: "step killed by the oom killer",
+			},
+		},
+		{
+			name: "evicted",
+			pd:   &driver.PodDiagnostics{FailReason: driver.PodFailReasonEvicted, Message: "The node was low on resource: memory."},
+			out: &types.TaskFailureReason{
+				Type:    types.TaskFailureTypeEvicted,
+				Step:    1,
+				Message: "task pod evicted: The node was low on resource: memory.",
+			},
+		},
+		{
+			name: "no fail reason",
+			pd:   &driver.PodDiagnostics{MemoryLimit: 512 * mib},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := podTaskFailureReason(tt.pd, 1)
+			if !reflect.DeepEqual(tt.out, out) {
+				t.Fatalf("expected failure reason %+v, got %+v", tt.out, out)
+			}
+		})
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	retries := &types.Retries{Count: 2, Delay: time.Hour}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if !shouldRetry(ctx, false, retries, 0, types.RetryConditionFailure) {
+		t.Fatalf("expected retry")
+	}
+	if shouldRetry(ctx, true, retries, 0, types.RetryConditionFailure) {
+		t.Fatalf("expected no retry of a stopped task")
+	}
+	if shouldRetry(ctx, false, retries, 2, types.RetryConditionFailure) {
+		t.Fatalf("expected no retry after all the attempts")
+	}
+
+	cancel()
+	if shouldRetry(ctx, false, retries, 0, types.RetryConditionFailure) {
+		t.Fatalf("expected no retry after the context is cancelled")
+	}
+}
+
+func TestWaitRetryDelayCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	doneCh := make(chan bool)
+	go func() { doneCh <- waitRetryDelay(ctx, time.Hour) }()
+
+	cancel()
+	select {
+	case ok := <-doneCh:
+		if ok {
+			t.Fatalf("expected wait to be interrupted")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("wait not interrupted by the context cancellation")
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+type testContainerExec struct{}
+
+func (e *testContainerExec) Stdin() io.WriteCloser                 { return nopWriteCloser{ioutil.Discard} }
+func (e *testContainerExec) Wait(ctx context.Context) (int, error) { return 0, nil }
+
+// testPod records the exec configs and answers to toolbox expanddir with the
+// provided dir
+type testPod struct {
+	driver.Pod
+	execs []*driver.ExecConfig
+}
+
+func (p *testPod) Exec(ctx context.Context, execConfig *driver.ExecConfig) (driver.ContainerExec, error) {
+	p.execs = append(p.execs, execConfig)
+	if len(execConfig.Cmd) == 3 && execConfig.Cmd[1] == "expanddir" {
+		_, _ = io.WriteString(execConfig.Stdout, execConfig.Cmd[2])
+	}
+	return &testContainerExec{}, nil
+}
+
+func TestRunStepWorkingDir(t *testing.T) {
+	tests := []struct {
+		name       string
+		workingDir string
+		stepUser   string
+		outDir     string
+		outMkdir   bool
+		outUser    string
+	}{
+		{
+			name:   "no step working dir",
+			outDir: "/project",
+		},
+		{
+			name:       "relative step working dir",
+			workingDir: "sub/dir",
+			outDir:     "/project/sub/dir",
+			outMkdir:   true,
+		},
+		{
+			name:       "relative step working dir with step user",
+			workingDir: "sub",
+			stepUser:   "user01",
+			outDir:     "/project/sub",
+			outMkdir:   true,
+			outUser:    "user01",
+		},
+		{
+			name:       "absolute step working dir",
+			workingDir: "/other",
+			outDir:     "/other",
+			outMkdir:   true,
+		},
+		{
+			name:       "home step working dir",
+			workingDir: "~/sub",
+			outDir:     "~/sub",
+			outMkdir:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &testPod{}
+			et := &types.ExecutorTask{
+				WorkingDir: "/project",
+				Containers: []*types.Container{{User: "root"}},
+			}
+			s := &types.RunStep{Command: "true", WorkingDir: tt.workingDir, User: tt.stepUser}
+
+			e := &Executor{}
+			if _, err := e.runStep(context.Background(), s, et, pod, &bytes.Buffer{}); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			outUser := tt.outUser
+			if outUser == "" {
+				outUser = "root"
+			}
+
+			var mkdir, step *driver.ExecConfig
+			for _, ec := range pod.execs {
+				switch ec.Cmd[0] {
+				case toolboxContainerPath:
+					if ec.Cmd[1] == "mkdir" {
+						mkdir = ec
+					}
+				default:
+					step = ec
+				}
+			}
+
+			if tt.outMkdir {
+				if mkdir == nil {
+					t.Fatalf("expected working dir creation")
+				}
+				if mkdir.Cmd[2] != tt.outDir {
+					t.Fatalf("expected created dir %q, got %q", tt.outDir, mkdir.Cmd[2])
+				}
+				if mkdir.User != outUser {
+					t.Fatalf("expected working dir created by user %q, got %q", outUser, mkdir.User)
+				}
+			} else if mkdir != nil {
+				t.Fatalf("unexpected working dir creation: %v", mkdir.Cmd)
+			}
+
+			if step == nil {
+				t.Fatalf("expected step exec")
+			}
+			if step.WorkingDir != tt.outDir {
+				t.Fatalf("expected step working dir %q, got %q", tt.outDir, step.WorkingDir)
+			}
+			if step.User != outUser {
+				t.Fatalf("expected step user %q, got %q", outUser, step.User)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"agola.io/agola/internal/services/executor/driver"
+	"agola.io/agola/internal/services/runservice/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+// maxPendingLineSize is the max size of a line without a newline kept before
+// writing it
+const maxPendingLineSize = 64 * 1024
+
+// doParallelStep concurrently executes the run steps of the group, every one in
+// its own exec session. Their output is written to the step log with every
+// line prefixed by the sub step name followed by every sub step result. The
+// first sub step error or non zero exit code is returned.
+func (e *Executor) doParallelStep(ctx context.Context, s *types.ParallelStep, t *types.ExecutorTask, pod driver.Pod, logPath string) (int, error) {
+	if err := os.MkdirAll(filepath.Dir(logPath), 0770); err != nil {
+		return -1, err
+	}
+	outf, err := e.createLog(logPath)
+	if err != nil {
+		return -1, err
+	}
+	defer outf.Close()
+
+	exitCodes := make([]int, len(s.Steps))
+	errs := make([]error, len(s.Steps))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, rs := range s.Steps {
+		wg.Add(1)
+		go func(i int, rs *types.RunStep) {
+			defer wg.Done()
+			w := newPrefixedLineWriter(&mu, outf, fmt.Sprintf("[%s] ", rs.Name))
+			exitCodes[i], errs[i] = e.runStep(ctx, rs, t, pod, w)
+			_ = w.Flush()
+		}(i, rs)
+	}
+	wg.Wait()
+
+	exitCode := 0
+	err = nil
+	for i, rs := range s.Steps {
+		switch {
+		case errs[i] != nil:
+			fmt.Fprintf(outf, "[%s] failed: %s\n", rs.Name, errs[i])
+			if err == nil {
+				err = errors.Errorf("sub step %q failed: %w", rs.Name, errs[i])
+			}
+		case exitCodes[i] != 0:
+			fmt.Fprintf(outf, "[%s] failed with exit code %d\n", rs.Name, exitCodes[i])
+			if exitCode == 0 {
+				exitCode = exitCodes[i]
+			}
+		default:
+			fmt.Fprintf(outf, "[%s] succeeded\n", rs.Name)
+		}
+	}
+	if err != nil {
+		return -1, err
+	}
+
+	return exitCode, nil
+}
+
+// prefixedLineWriter writes to w every line prefixed with prefix. Multiple
+// writers sharing the same mutex won't mix their lines.
+type prefixedLineWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix []byte
+	buf    []byte
+}
+
+func newPrefixedLineWriter(mu *sync.Mutex, w io.Writer, prefix string) *prefixedLineWriter {
+	return &prefixedLineWriter{
+		mu:     mu,
+		w:      w,
+		prefix: []byte(prefix),
+	}
+}
+
+func (pw *prefixedLineWriter) Write(p []byte) (int, error) {
+	pw.buf = append(pw.buf, p...)
+	for {
+		i := bytes.IndexByte(pw.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := pw.writeLine(pw.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		pw.buf = pw.buf[i+1:]
+	}
+	// don't keep growing the buffer with output without newlines
+	if len(pw.buf) > maxPendingLineSize {
+		if err := pw.Flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush writes the pending data not terminated by a newline
+func (pw *prefixedLineWriter) Flush() error {
+	if len(pw.buf) == 0 {
+		return nil
+	}
+	line := append(pw.buf, '\n')
+	pw.buf = nil
+	return pw.writeLine(line)
+}
+
+func (pw *prefixedLineWriter) writeLine(line []byte) error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if _, err := pw.w.Write(pw.prefix); err != nil {
+		return err
+	}
+	_, err := pw.w.Write(line)
+	return err
+}
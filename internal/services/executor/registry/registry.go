@@ -59,6 +59,9 @@ type DockerConfigAuth struct {
 	Auth     string `json:"auth,omitempty"`
 }
 
+// defaultRegistryAlias is the commonly used name of the default registry
+const defaultRegistryAlias = "docker.io"
+
 // There are a variety of ways a domain may get qualified within the Docker credential file.
 // We enumerate them here as format strings.
 var (
@@ -137,3 +140,38 @@ func GenDockerConfig(auths map[string]types.DockerRegistryAuth, images []string)
 
 	return dockerConfig, nil
 }
+
+// MirrorImage rewrites the image to use the mirror of its registry. The
+// mirrors map a registry (docker.io is an alias of the default registry) to
+// the mirror registry host and optional path prefix. It returns false when
+// the image registry isn't mirrored.
+func MirrorImage(image string, mirrors map[string]string) (string, bool, error) {
+	ref, err := name.ParseReference(image, name.WeakValidation)
+	if err != nil {
+		return "", false, err
+	}
+	regName := ref.Context().RegistryStr()
+
+	var mirror string
+	for reg, m := range mirrors {
+		if reg == defaultRegistryAlias {
+			reg = name.DefaultRegistry
+		}
+		if reg == regName {
+			mirror = strings.TrimSuffix(m, "/")
+			break
+		}
+	}
+	if mirror == "" {
+		return image, false, nil
+	}
+
+	mirrored := fmt.Sprintf("%s/%s", mirror, ref.Context().RepositoryStr())
+	switch r := ref.(type) {
+	case name.Tag:
+		mirrored += ":" + r.TagStr()
+	case name.Digest:
+		mirrored += "@" + r.DigestStr()
+	}
+	return mirrored, true, nil
+}
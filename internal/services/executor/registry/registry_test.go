@@ -0,0 +1,53 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"testing"
+)
+
+func TestMirrorImage(t *testing.T) {
+	mirrors := map[string]string{
+		"docker.io": "mirror.internal:5000/dockerhub",
+		"quay.io":   "mirror.internal:5000/quay/",
+	}
+
+	tests := []struct {
+		image    string
+		out      string
+		mirrored bool
+	}{
+		{image: "busybox", out: "mirror.internal:5000/dockerhub/library/busybox:latest", mirrored: true},
+		{image: "golang:1.12", out: "mirror.internal:5000/dockerhub/library/golang:1.12", mirrored: true},
+		{image: "docker.io/sorintlab/agola:v0.1.0", out: "mirror.internal:5000/dockerhub/sorintlab/agola:v0.1.0", mirrored: true},
+		{image: "quay.io/coreos/etcd@sha256:0000000000000000000000000000000000000000000000000000000000000000", out: "mirror.internal:5000/quay/coreos/etcd@sha256:0000000000000000000000000000000000000000000000000000000000000000", mirrored: true},
+		{image: "gcr.io/distroless/base", out: "gcr.io/distroless/base", mirrored: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			out, mirrored, err := MirrorImage(tt.image, mirrors)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out != tt.out {
+				t.Errorf("got image %q, want %q", out, tt.out)
+			}
+			if mirrored != tt.mirrored {
+				t.Errorf("got mirrored %t, want %t", mirrored, tt.mirrored)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"agola.io/agola/internal/services/common"
+)
+
+// fullLogPath returns the path where the full log of a truncated log is saved
+func fullLogPath(logPath string) string {
+	return strings.TrimSuffix(logPath, ".log") + ".full.log"
+}
+
+type logWriter interface {
+	io.WriteCloser
+	io.StringWriter
+}
+
+// createLog creates the setup or step log file. Every log line is prefixed
+// with its timestamp. When a step log size limit is configured the log is
+// truncated when its content, excluding the timestamps, exceeds it.
+func (e *Executor) createLog(logPath string) (logWriter, error) {
+	f, err := os.Create(logPath)
+	if err != nil {
+		return nil, err
+	}
+	if e.c.StepLogSizeLimit <= 0 {
+		return newTimestampedLogWriter(f), nil
+	}
+	// remove a stale full log of a previous execution
+	if err := os.Remove(fullLogPath(logPath)); err != nil && !os.IsNotExist(err) {
+		f.Close()
+		return nil, err
+	}
+
+	return newLimitedLogWriter(f, logPath, e.c.StepLogSizeLimit), nil
+}
+
+// timestampedLogWriter prefixes every log line with its timestamp
+type timestampedLogWriter struct {
+	*common.LogTimestampWriter
+	c io.Closer
+}
+
+func newTimestampedLogWriter(w io.WriteCloser) *timestampedLogWriter {
+	return &timestampedLogWriter{LogTimestampWriter: common.NewLogTimestampWriter(w), c: w}
+}
+
+func (w *timestampedLogWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *timestampedLogWriter) Close() error {
+	return w.c.Close()
+}
+
+// logSink forwards the writes to the file currently receiving the log
+type logSink struct {
+	w io.Writer
+}
+
+func (s *logSink) Write(p []byte) (int, error) {
+	return s.w.Write(p)
+}
+
+// limitedLogWriter writes the timestamped log until its size limit. Only the
+// log content counts toward the limit, not the line timestamps. When the limit
+// is exceeded a truncation marker is appended to the log and the full log is
+// saved in a separate file.
+type limitedLogWriter struct {
+	f       *os.File
+	logPath string
+	limit   int64
+
+	// tw timestamps the log lines and writes them to sink, that is the log
+	// file until the limit and then the full log file
+	tw   *common.LogTimestampWriter
+	sink *logSink
+
+	written int64
+	full    *os.File
+}
+
+func newLimitedLogWriter(f *os.File, logPath string, limit int64) *limitedLogWriter {
+	sink := &logSink{w: f}
+	return &limitedLogWriter{
+		f:       f,
+		logPath: logPath,
+		limit:   limit,
+		tw:      common.NewLogTimestampWriter(sink),
+		sink:    sink,
+	}
+}
+
+func (w *limitedLogWriter) Write(p []byte) (int, error) {
+	if w.full != nil {
+		return w.tw.Write(p)
+	}
+
+	remaining := w.limit - w.written
+	if int64(len(p)) <= remaining {
+		n, err := w.tw.Write(p)
+		w.written += int64(n)
+		return n, err
+	}
+
+	if _, err := w.tw.Write(p[:remaining]); err != nil {
+		return 0, err
+	}
+	w.written += remaining
+
+	// the full log starts with the log written until now
+	full, err := os.Create(fullLogPath(w.logPath))
+	if err != nil {
+		return 0, err
+	}
+	w.full = full
+	lf, err := os.Open(w.logPath)
+	if err != nil {
+		return 0, err
+	}
+	defer lf.Close()
+	if _, err := io.Copy(w.full, lf); err != nil {
+		return 0, err
+	}
+	w.sink.w = w.full
+	if _, err := w.tw.Write(p[remaining:]); err != nil {
+		return 0, err
+	}
+
+	marker := fmt.Sprintf("\n[agola: log truncated since it exceeded the size limit of %d bytes]\n", w.limit)
+	if _, err := io.WriteString(w.f, marker); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (w *limitedLogWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *limitedLogWriter) Close() error {
+	err := w.f.Close()
+	if w.full != nil {
+		if ferr := w.full.Close(); err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
@@ -0,0 +1,137 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"agola.io/agola/internal/services/common"
+	"agola.io/agola/internal/services/config"
+)
+
+// stripTimestamp checks that the log starts with a timestamp and removes the
+// timestamps of all its lines
+func stripTimestamp(t *testing.T, log string) string {
+	n := len(common.LogTimestampLayout)
+	if len(log) < n+1 {
+		t.Fatalf("log %q too short to contain a timestamp", log)
+	}
+	if _, err := time.Parse(common.LogTimestampLayout, log[:n]); err != nil {
+		t.Fatalf("log %q doesn't start with a timestamp: %v", log, err)
+	}
+	lines := strings.SplitAfter(log, "\n")
+	for i, line := range lines {
+		if len(line) < n+1 {
+			continue
+		}
+		if _, err := time.Parse(common.LogTimestampLayout, line[:n]); err == nil {
+			lines[i] = line[n+1:]
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+func TestCreateLog(t *testing.T) {
+	tests := []struct {
+		name      string
+		limit     int64
+		writes    []string
+		log       string
+		truncated bool
+	}{
+		{
+			name:   "test no limit",
+			writes: []string{"0123456789", "0123456789"},
+			log:    "01234567890123456789",
+		},
+		{
+			name:   "test log under limit",
+			limit:  20,
+			writes: []string{"0123456789", "0123456789"},
+			log:    "01234567890123456789",
+		},
+		{
+			name:      "test log over limit",
+			limit:     15,
+			writes:    []string{"0123456789", "0123456789", "0123456789"},
+			log:       "012345678901234\n[agola: log truncated since it exceeded the size limit of 15 bytes]\n",
+			truncated: true,
+		},
+		{
+			// the timestamps of the lines don't count toward the limit
+			name:      "test multiline log over limit",
+			limit:     15,
+			writes:    []string{"0123\n", "5678\n", "0123\n", "5678\n"},
+			log:       "0123\n5678\n0123\n\n[agola: log truncated since it exceeded the size limit of 15 bytes]\n",
+			truncated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "agola")
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			e := &Executor{c: &config.Executor{StepLogSizeLimit: tt.limit}}
+			logPath := filepath.Join(dir, "0.log")
+			w, err := e.createLog(logPath)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			for _, s := range tt.writes {
+				n, err := w.WriteString(s)
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				if n != len(s) {
+					t.Fatalf("got %d written bytes, want %d", n, len(s))
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			data, err := ioutil.ReadFile(logPath)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if log := stripTimestamp(t, string(data)); log != tt.log {
+				t.Fatalf("got log %q, want %q", log, tt.log)
+			}
+
+			fullData, err := ioutil.ReadFile(fullLogPath(logPath))
+			if !tt.truncated {
+				if !os.IsNotExist(err) {
+					t.Fatalf("expected no full log, got err: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if log := stripTimestamp(t, string(fullData)); log != strings.Join(tt.writes, "") {
+				t.Fatalf("got full log %q, want %q", log, strings.Join(tt.writes, ""))
+			}
+		})
+	}
+}
@@ -16,10 +16,14 @@ package action
 
 import (
 	"net/http"
+	"time"
 
+	"agola.io/agola/internal/config"
+	"agola.io/agola/internal/saml"
 	"agola.io/agola/internal/services/common"
 	csapi "agola.io/agola/internal/services/configstore/api"
 	rsapi "agola.io/agola/internal/services/runservice/api"
+	"agola.io/agola/internal/services/types"
 	"agola.io/agola/internal/util"
 
 	"go.uber.org/zap"
@@ -33,9 +37,28 @@ type ActionHandler struct {
 	agolaID           string
 	apiExposedURL     string
 	webExposedURL     string
+
+	orgsStoragePartitions map[string]string
+	configLinter          *config.Linter
+	runConfigPolicy       *config.Policy
+	// anonymousAccess is the instance anonymous access settings of the public
+	// projects
+	anonymousAccess *types.AnonymousAccess
+	// saml is the saml single sign on configuration, nil when disabled
+	saml *SAMLConfig
+	// samlReplayCache records the accepted saml assertions
+	samlReplayCache *saml.ReplayCache
+	// twoFactorAuth is the users two factor authentication configuration
+	twoFactorAuth *TwoFactorAuthConfig
+	// orgSync is the organizations membership sync configuration, nil when
+	// disabled
+	orgSync *OrgSyncConfig
+	// refCache caches the resolved projects and project groups paths and
+	// users names
+	refCache *refCache
 }
 
-func NewActionHandler(logger *zap.Logger, sd *common.TokenSigningData, configstoreClient *csapi.Client, runserviceClient *rsapi.Client, agolaID, apiExposedURL, webExposedURL string) *ActionHandler {
+func NewActionHandler(logger *zap.Logger, sd *common.TokenSigningData, configstoreClient *csapi.Client, runserviceClient *rsapi.Client, agolaID, apiExposedURL, webExposedURL string, orgsStoragePartitions map[string]string, configLinter *config.Linter, runConfigPolicy *config.Policy, anonymousAccess *types.AnonymousAccess, samlConfig *SAMLConfig, twoFactorAuth *TwoFactorAuthConfig, orgSync *OrgSyncConfig, refCacheTTL time.Duration) *ActionHandler {
 	return &ActionHandler{
 		log:               logger.Sugar(),
 		sd:                sd,
@@ -44,6 +67,16 @@ func NewActionHandler(logger *zap.Logger, sd *common.TokenSigningData, configsto
 		agolaID:           agolaID,
 		apiExposedURL:     apiExposedURL,
 		webExposedURL:     webExposedURL,
+
+		orgsStoragePartitions: orgsStoragePartitions,
+		configLinter:          configLinter,
+		runConfigPolicy:       runConfigPolicy,
+		anonymousAccess:       anonymousAccess,
+		saml:                  samlConfig,
+		samlReplayCache:       saml.NewReplayCache(),
+		twoFactorAuth:         twoFactorAuth,
+		orgSync:               orgSync,
+		refCache:              newRefCache(refCacheTTL),
 	}
 }
 
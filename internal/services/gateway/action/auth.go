@@ -146,6 +146,45 @@ func (h *ActionHandler) IsProjectMember(ctx context.Context, ownerType types.Con
 	return false, nil
 }
 
+// IsProjectLogsReader returns true if the current user can read the logs,
+// the artifacts and the run configs of the private projects of the provided
+// owner and exec inside their runs. Org members with the reporter role can't.
+func (h *ActionHandler) IsProjectLogsReader(ctx context.Context, ownerType types.ConfigType, ownerID string) (bool, error) {
+	isAdmin := h.IsUserAdmin(ctx)
+	if isAdmin {
+		return true, nil
+	}
+
+	userID := h.CurrentUserID(ctx)
+	if userID == "" {
+		return false, nil
+	}
+
+	if ownerType == types.ConfigTypeUser {
+		if userID == ownerID {
+			return true, nil
+		}
+	}
+
+	if ownerType == types.ConfigTypeOrg {
+		userOrgs, resp, err := h.configstoreClient.GetUserOrgs(ctx, userID)
+		if err != nil {
+			return false, errors.Errorf("failed to get user orgs: %w", ErrFromRemote(resp, err))
+		}
+
+		for _, userOrg := range userOrgs {
+			if userOrg.Organization.ID != ownerID {
+				continue
+			}
+			if userOrg.Role != types.MemberRoleReporter {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
 func (h *ActionHandler) IsVariableOwner(ctx context.Context, parentType types.ConfigType, parentRef string) (bool, error) {
 	var ownerType types.ConfigType
 	var ownerID string
@@ -169,39 +208,119 @@ func (h *ActionHandler) IsVariableOwner(ctx context.Context, parentType types.Co
 	return h.IsProjectOwner(ctx, ownerType, ownerID)
 }
 
-func (h *ActionHandler) CanGetRun(ctx context.Context, runGroup string) (bool, error) {
+// RunData is a kind of run data whose access by anonymous users can be
+// restricted on public projects
+type RunData int
+
+const (
+	// RunDataRuns are the runs lists, details and stats
+	RunDataRuns RunData = iota
+	// RunDataLogs are the run steps logs
+	RunDataLogs
+	// RunDataArtifacts are the run tasks test results and coverage reports
+	RunDataArtifacts
+	// RunDataConfig is the run config
+	RunDataConfig
+)
+
+// anonymousAccessHides returns true if the anonymous access settings hide the
+// provided run data. Hiding the runs hides all the run data.
+func anonymousAccessHides(a *types.AnonymousAccess, data RunData) bool {
+	if a == nil {
+		return false
+	}
+	if a.HideRuns {
+		return true
+	}
+
+	switch data {
+	case RunDataLogs:
+		return a.HideLogs
+	case RunDataArtifacts:
+		return a.HideArtifacts
+	case RunDataConfig:
+		return a.HideConfig
+	}
+	return false
+}
+
+type runGroupOwner struct {
+	ownerType  types.ConfigType
+	ownerID    string
+	visibility types.Visibility
+	// anonymousAccess is the project anonymous access settings
+	anonymousAccess *types.AnonymousAccess
+}
+
+func (h *ActionHandler) getRunGroupOwner(ctx context.Context, runGroup string) (*runGroupOwner, error) {
 	groupType, groupID, err := common.GroupTypeIDFromRunGroup(runGroup)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	var visibility types.Visibility
-	var ownerType types.ConfigType
-	var ownerID string
+	o := &runGroupOwner{}
 	switch groupType {
 	case common.GroupTypeProject:
 		p, resp, err := h.configstoreClient.GetProject(ctx, groupID)
 		if err != nil {
-			return false, ErrFromRemote(resp, err)
+			return nil, ErrFromRemote(resp, err)
 		}
-		ownerType = p.OwnerType
-		ownerID = p.OwnerID
-		visibility = p.GlobalVisibility
+		o.ownerType = p.OwnerType
+		o.ownerID = p.OwnerID
+		o.visibility = p.GlobalVisibility
+		o.anonymousAccess = p.AnonymousAccess
 	case common.GroupTypeUser:
 		// user direct runs
-		ownerType = types.ConfigTypeUser
-		ownerID = groupID
-		visibility = types.VisibilityPrivate
+		o.ownerType = types.ConfigTypeUser
+		o.ownerID = groupID
+		o.visibility = types.VisibilityPrivate
 	}
 
-	if visibility == types.VisibilityPublic {
+	return o, nil
+}
+
+func (h *ActionHandler) CanGetRun(ctx context.Context, runGroup string) (bool, error) {
+	return h.CanGetRunData(ctx, runGroup, RunDataRuns)
+}
+
+// CanGetRunLogs returns true if the current user can get the steps logs of the
+// runs of the provided run group. Contrary to CanGetRun, org members with the
+// reporter role can't get the logs of private projects runs since they could
+// contain sensitive output.
+func (h *ActionHandler) CanGetRunLogs(ctx context.Context, runGroup string) (bool, error) {
+	return h.CanGetRunData(ctx, runGroup, RunDataLogs)
+}
+
+// CanGetRunData returns true if the current user can get the provided data of
+// the runs of the provided run group. On public projects the anonymous users
+// can get only the data not hidden by the instance and project anonymous
+// access settings.
+func (h *ActionHandler) CanGetRunData(ctx context.Context, runGroup string, data RunData) (bool, error) {
+	o, err := h.getRunGroupOwner(ctx, runGroup)
+	if err != nil {
+		return false, err
+	}
+
+	if o.visibility == types.VisibilityPublic {
+		if h.IsUserLoggedOrAdmin(ctx) {
+			return true, nil
+		}
+		if anonymousAccessHides(h.anonymousAccess, data) || anonymousAccessHides(o.anonymousAccess, data) {
+			return false, nil
+		}
 		return true, nil
 	}
-	isProjectMember, err := h.IsProjectMember(ctx, ownerType, ownerID)
+
+	// the reporters can only get the runs
+	isReader := h.IsProjectMember
+	if data != RunDataRuns {
+		isReader = h.IsProjectLogsReader
+	}
+	ok, err := isReader(ctx, o.ownerType, o.ownerID)
 	if err != nil {
 		return false, errors.Errorf("failed to determine ownership: %w", err)
 	}
-	if !isProjectMember {
+	if !ok {
 		return false, nil
 	}
 	return true, nil
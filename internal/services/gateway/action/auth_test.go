@@ -0,0 +1,151 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	slog "agola.io/agola/internal/log"
+	csapi "agola.io/agola/internal/services/configstore/api"
+	rsapi "agola.io/agola/internal/services/runservice/api"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+// newTestActionHandler returns an action handler using a fake configstore
+// with the private project01 owned by org01, where user01 is a member and
+// user02 a reporter, and a fake runservice with the project01 run01. The
+// returned func stops the fake services.
+func newTestActionHandler(t *testing.T) (*ActionHandler, func()) {
+	writeJSON := func(w http.ResponseWriter, v interface{}) {
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+	}
+
+	csRouter := mux.NewRouter()
+	csRouter.HandleFunc("/api/v1alpha/projects/{projectref}", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["projectref"] != "project01" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, &csapi.Project{
+			Project:          &types.Project{ID: "project01", Name: "project01", Visibility: types.VisibilityPrivate},
+			OwnerType:        types.ConfigTypeOrg,
+			OwnerID:          "org01",
+			GlobalVisibility: types.VisibilityPrivate,
+		})
+	})
+	csRouter.HandleFunc("/api/v1alpha/users/{userref}/orgs", func(w http.ResponseWriter, r *http.Request) {
+		org := &types.Organization{ID: "org01", Name: "org01"}
+		userOrgs := []*csapi.UserOrgsResponse{}
+		switch mux.Vars(r)["userref"] {
+		case "user01":
+			userOrgs = append(userOrgs, &csapi.UserOrgsResponse{Organization: org, Role: types.MemberRoleMember})
+		case "user02":
+			userOrgs = append(userOrgs, &csapi.UserOrgsResponse{Organization: org, Role: types.MemberRoleReporter})
+		}
+		writeJSON(w, userOrgs)
+	})
+	cs := httptest.NewServer(csRouter)
+
+	rsRouter := mux.NewRouter()
+	rsRouter.HandleFunc("/api/v1alpha/runs/{runid}", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["runid"] != "run01" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, &rsapi.RunResponse{
+			Run: &rstypes.Run{ID: "run01", Group: "/project/project01"},
+			RunConfig: &rstypes.RunConfig{
+				ID: "run01",
+				Annotations: map[string]string{
+					AnnotationRunType:   string(types.RunTypeProject),
+					AnnotationProjectID: "project01",
+				},
+			},
+		})
+	})
+	rs := httptest.NewServer(rsRouter)
+
+	logger := slog.New(zap.NewAtomicLevelAt(zap.ErrorLevel))
+	h := NewActionHandler(logger, nil, csapi.NewClient(cs.URL), rsapi.NewClient(rs.URL), "agola", "", "", nil, nil, nil, nil, nil, nil, nil, 0)
+
+	return h, func() {
+		cs.Close()
+		rs.Close()
+	}
+}
+
+func userContext(userID string) context.Context {
+	return context.WithValue(context.Background(), "userid", userID)
+}
+
+func TestCanGetRunDataReporter(t *testing.T) {
+	h, stop := newTestActionHandler(t)
+	defer stop()
+
+	tests := []struct {
+		name     string
+		data     RunData
+		member   bool
+		reporter bool
+	}{
+		{name: "runs", data: RunDataRuns, member: true, reporter: true},
+		{name: "logs", data: RunDataLogs, member: true, reporter: false},
+		{name: "artifacts", data: RunDataArtifacts, member: true, reporter: false},
+		{name: "config", data: RunDataConfig, member: true, reporter: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := h.CanGetRunData(userContext("user01"), "/project/project01", tt.data)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if ok != tt.member {
+				t.Fatalf("member: got %t, want %t", ok, tt.member)
+			}
+
+			ok, err = h.CanGetRunData(userContext("user02"), "/project/project01", tt.data)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if ok != tt.reporter {
+				t.Fatalf("reporter: got %t, want %t", ok, tt.reporter)
+			}
+		})
+	}
+}
+
+func TestRunTaskExecReporter(t *testing.T) {
+	h, stop := newTestActionHandler(t)
+	defer stop()
+
+	_, err := h.RunTaskExec(userContext("user02"), &RunTaskExecRequest{RunID: "run01", TaskID: "task01"})
+	var uerr *util.ErrForbidden
+	if !errors.As(err, &uerr) {
+		t.Fatalf("expected forbidden error, got: %v", err)
+	}
+}
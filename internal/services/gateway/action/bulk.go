@@ -0,0 +1,141 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+// MaxBulkOperationItems is the max number of objects handled by a single bulk
+// operation
+const MaxBulkOperationItems = 100
+
+// BulkOperationResult is the result of a bulk operation on a single object.
+// Err is nil when the operation on the object succeeded.
+type BulkOperationResult struct {
+	Ref string
+	Err error
+}
+
+func validateBulkOperationItems(refs []string) error {
+	if len(refs) == 0 {
+		return util.NewErrBadRequest(errors.Errorf("no objects provided"))
+	}
+	if len(refs) > MaxBulkOperationItems {
+		return util.NewErrBadRequest(errors.Errorf("too many objects provided, max %d", MaxBulkOperationItems))
+	}
+	return nil
+}
+
+// CancelRuns cancels the provided runs. A failure on a run doesn't stop the
+// cancellation of the other runs and is reported in its result.
+func (h *ActionHandler) CancelRuns(ctx context.Context, runIDs []string) ([]*BulkOperationResult, error) {
+	if err := validateBulkOperationItems(runIDs); err != nil {
+		return nil, err
+	}
+
+	results := make([]*BulkOperationResult, 0, len(runIDs))
+	for _, runID := range runIDs {
+		_, err := h.RunAction(ctx, &RunActionsRequest{RunID: runID, ActionType: RunActionTypeCancel})
+		results = append(results, &BulkOperationResult{Ref: runID, Err: err})
+	}
+
+	return results, nil
+}
+
+// DeleteProjects deletes the provided projects. A failure on a project doesn't
+// stop the deletion of the other projects and is reported in its result.
+func (h *ActionHandler) DeleteProjects(ctx context.Context, projectRefs []string) ([]*BulkOperationResult, error) {
+	if err := validateBulkOperationItems(projectRefs); err != nil {
+		return nil, err
+	}
+
+	results := make([]*BulkOperationResult, 0, len(projectRefs))
+	for _, projectRef := range projectRefs {
+		err := h.DeleteProject(ctx, projectRef)
+		results = append(results, &BulkOperationResult{Ref: projectRef, Err: err})
+	}
+
+	return results, nil
+}
+
+// UpdateProjectGroupVisibility sets the visibility of the project group and of
+// all its subgroups and projects. The results are keyed by the objects paths.
+// A failure on an object doesn't stop the update of the other objects.
+func (h *ActionHandler) UpdateProjectGroupVisibility(ctx context.Context, projectGroupRef string, visibility types.Visibility) ([]*BulkOperationResult, error) {
+	if !types.IsValidVisibility(visibility) {
+		return nil, util.NewErrBadRequest(errors.Errorf("invalid visibility %q", visibility))
+	}
+
+	pg, resp, err := h.configstoreClient.GetProjectGroup(ctx, projectGroupRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project group %q: %w", projectGroupRef, ErrFromRemote(resp, err))
+	}
+
+	isProjectOwner, err := h.IsProjectOwner(ctx, pg.OwnerType, pg.OwnerID)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isProjectOwner {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	results := []*BulkOperationResult{}
+	if pg.Visibility != visibility {
+		_, err := h.UpdateProjectGroup(ctx, pg.ID, &UpdateProjectGroupRequest{Name: pg.Name, Visibility: visibility})
+		results = append(results, &BulkOperationResult{Ref: pg.Path, Err: err})
+	}
+
+	if err := h.updateProjectGroupChildsVisibility(ctx, pg.ID, visibility, &results); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func (h *ActionHandler) updateProjectGroupChildsVisibility(ctx context.Context, projectGroupID string, visibility types.Visibility, results *[]*BulkOperationResult) error {
+	projects, err := h.GetProjectGroupProjects(ctx, projectGroupID)
+	if err != nil {
+		return errors.Errorf("failed to get project group %q projects: %w", projectGroupID, err)
+	}
+	for _, p := range projects {
+		if p.Visibility == visibility {
+			continue
+		}
+		_, err := h.UpdateProject(ctx, p.ID, &UpdateProjectRequest{Name: p.Name, Visibility: visibility})
+		*results = append(*results, &BulkOperationResult{Ref: p.Path, Err: err})
+	}
+
+	subgroups, err := h.GetProjectGroupSubgroups(ctx, projectGroupID)
+	if err != nil {
+		return errors.Errorf("failed to get project group %q subgroups: %w", projectGroupID, err)
+	}
+	for _, sg := range subgroups {
+		if sg.Visibility != visibility {
+			_, err := h.UpdateProjectGroup(ctx, sg.ID, &UpdateProjectGroupRequest{Name: sg.Name, Visibility: visibility})
+			*results = append(*results, &BulkOperationResult{Ref: sg.Path, Err: err})
+		}
+		if err := h.updateProjectGroupChildsVisibility(ctx, sg.ID, visibility, results); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
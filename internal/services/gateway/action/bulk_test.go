@@ -0,0 +1,462 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	slog "agola.io/agola/internal/log"
+	csapi "agola.io/agola/internal/services/configstore/api"
+	rsapi "agola.io/agola/internal/services/runservice/api"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+func testProjectGroup(id, parentID, p string, ownerID string, visibility, globalVisibility types.Visibility) *csapi.ProjectGroup {
+	return &csapi.ProjectGroup{
+		ProjectGroup:     &types.ProjectGroup{ID: id, Name: id, Parent: types.Parent{ID: parentID}, Visibility: visibility},
+		OwnerType:        types.ConfigTypeOrg,
+		OwnerID:          ownerID,
+		Path:             p,
+		GlobalVisibility: globalVisibility,
+	}
+}
+
+func testProject(id, parentID, p string, ownerID string, visibility, globalVisibility types.Visibility) *csapi.Project {
+	return &csapi.Project{
+		Project:          &types.Project{ID: id, Name: id, Parent: types.Parent{ID: parentID}, Visibility: visibility},
+		OwnerType:        types.ConfigTypeOrg,
+		OwnerID:          ownerID,
+		Path:             p,
+		GlobalVisibility: globalVisibility,
+	}
+}
+
+// newTestProjectGroupsActionHandler returns an action handler using a fake
+// configstore and a fake runservice.
+// The configstore has the org01, where user01 is an owner and user02 a
+// member, and the org02, where user01 is a member, with the project groups:
+//
+//	org/org01 (public)
+//	  pg01 (private)
+//	    pg02 (private)
+//	      project04 (public)
+//	    project03 (private, its update and delete fail)
+//	  project01 (private)
+//	  project05 (public)
+//	org/org02 (private)
+//	  project02 (private)
+//
+// The runservice has the run01 of project01, the run02 of project02 and the
+// run03 of project03, whose actions fail. They're also the projects last runs.
+// The returned func returns the recorded updates.
+func newTestProjectGroupsActionHandler(t *testing.T) (*ActionHandler, func() []string, func()) {
+	var mu sync.Mutex
+	var calls []string
+	addCall := func(call string) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, call)
+	}
+	writeJSON := func(w http.ResponseWriter, v interface{}) {
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+	}
+
+	projectGroups := []*csapi.ProjectGroup{
+		testProjectGroup("org01", "", "org/org01", "org01", types.VisibilityPublic, types.VisibilityPublic),
+		testProjectGroup("pg01", "org01", "org/org01/pg01", "org01", types.VisibilityPrivate, types.VisibilityPrivate),
+		testProjectGroup("pg02", "pg01", "org/org01/pg01/pg02", "org01", types.VisibilityPrivate, types.VisibilityPrivate),
+		testProjectGroup("org02", "", "org/org02", "org02", types.VisibilityPrivate, types.VisibilityPrivate),
+	}
+	projects := []*csapi.Project{
+		testProject("project01", "org01", "org/org01/project01", "org01", types.VisibilityPrivate, types.VisibilityPrivate),
+		testProject("project02", "org02", "org/org02/project02", "org02", types.VisibilityPrivate, types.VisibilityPrivate),
+		testProject("project03", "pg01", "org/org01/pg01/project03", "org01", types.VisibilityPrivate, types.VisibilityPrivate),
+		testProject("project04", "pg02", "org/org01/pg01/pg02/project04", "org01", types.VisibilityPublic, types.VisibilityPrivate),
+		testProject("project05", "org01", "org/org01/project05", "org01", types.VisibilityPublic, types.VisibilityPublic),
+	}
+	getProjectGroup := func(ref string) *csapi.ProjectGroup {
+		for _, pg := range projectGroups {
+			if pg.ID == ref {
+				return pg
+			}
+		}
+		return nil
+	}
+	getProject := func(ref string) *csapi.Project {
+		for _, p := range projects {
+			if p.ID == ref {
+				return p
+			}
+		}
+		return nil
+	}
+
+	csRouter := mux.NewRouter()
+	csRouter.HandleFunc("/api/v1alpha/projectgroups/{ref}", func(w http.ResponseWriter, r *http.Request) {
+		pg := getProjectGroup(mux.Vars(r)["ref"])
+		if pg == nil {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, pg)
+	}).Methods("GET")
+	csRouter.HandleFunc("/api/v1alpha/projectgroups/{ref}", func(w http.ResponseWriter, r *http.Request) {
+		var pg *types.ProjectGroup
+		if err := json.NewDecoder(r.Body).Decode(&pg); err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+		addCall(fmt.Sprintf("update projectgroup %s %s", mux.Vars(r)["ref"], pg.Visibility))
+		writeJSON(w, &csapi.ProjectGroup{ProjectGroup: pg})
+	}).Methods("PUT")
+	csRouter.HandleFunc("/api/v1alpha/projectgroups/{ref}/subgroups", func(w http.ResponseWriter, r *http.Request) {
+		subgroups := []*csapi.ProjectGroup{}
+		for _, pg := range projectGroups {
+			if pg.Parent.ID == mux.Vars(r)["ref"] {
+				subgroups = append(subgroups, pg)
+			}
+		}
+		writeJSON(w, subgroups)
+	}).Methods("GET")
+	csRouter.HandleFunc("/api/v1alpha/projectgroups/{ref}/projects", func(w http.ResponseWriter, r *http.Request) {
+		pgProjects := []*csapi.Project{}
+		for _, p := range projects {
+			if p.Parent.ID == mux.Vars(r)["ref"] {
+				pgProjects = append(pgProjects, p)
+			}
+		}
+		writeJSON(w, pgProjects)
+	}).Methods("GET")
+	csRouter.HandleFunc("/api/v1alpha/projects/{ref}", func(w http.ResponseWriter, r *http.Request) {
+		p := getProject(mux.Vars(r)["ref"])
+		if p == nil {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, p)
+	}).Methods("GET")
+	csRouter.HandleFunc("/api/v1alpha/projects/{ref}", func(w http.ResponseWriter, r *http.Request) {
+		var p *types.Project
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+		if p.ID == "project03" {
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		addCall(fmt.Sprintf("update project %s %s", mux.Vars(r)["ref"], p.Visibility))
+		writeJSON(w, &csapi.Project{Project: p})
+	}).Methods("PUT")
+	csRouter.HandleFunc("/api/v1alpha/projects/{ref}", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["ref"] == "project03" {
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		addCall("delete project " + mux.Vars(r)["ref"])
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods("DELETE")
+	csRouter.HandleFunc("/api/v1alpha/users/{userref}/orgs", func(w http.ResponseWriter, r *http.Request) {
+		org01 := &types.Organization{ID: "org01", Name: "org01"}
+		org02 := &types.Organization{ID: "org02", Name: "org02"}
+		userOrgs := []*csapi.UserOrgsResponse{}
+		switch mux.Vars(r)["userref"] {
+		case "user01":
+			userOrgs = append(userOrgs, &csapi.UserOrgsResponse{Organization: org01, Role: types.MemberRoleOwner})
+			userOrgs = append(userOrgs, &csapi.UserOrgsResponse{Organization: org02, Role: types.MemberRoleMember})
+		case "user02":
+			userOrgs = append(userOrgs, &csapi.UserOrgsResponse{Organization: org01, Role: types.MemberRoleMember})
+		}
+		writeJSON(w, userOrgs)
+	}).Methods("GET")
+	// the projects have no linked accounts
+	csRouter.HandleFunc("/api/v1alpha/users", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "", http.StatusNotFound)
+	}).Methods("GET")
+	cs := httptest.NewServer(csRouter)
+
+	runs := map[string]string{
+		"run01": "/project/project01",
+		"run02": "/project/project02",
+		"run03": "/project/project03",
+	}
+	rsRouter := mux.NewRouter()
+	rsRouter.HandleFunc("/api/v1alpha/runs/{runid}", func(w http.ResponseWriter, r *http.Request) {
+		runID := mux.Vars(r)["runid"]
+		group, ok := runs[runID]
+		if !ok {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, &rsapi.RunResponse{
+			Run:       &rstypes.Run{ID: runID, Group: group},
+			RunConfig: &rstypes.RunConfig{ID: runID, Group: group},
+		})
+	}).Methods("GET")
+	rsRouter.HandleFunc("/api/v1alpha/runs", func(w http.ResponseWriter, r *http.Request) {
+		groupRuns := []*rstypes.Run{}
+		for runID, group := range runs {
+			if group == r.URL.Query().Get("group") {
+				groupRuns = append(groupRuns, &rstypes.Run{ID: runID, Group: group})
+			}
+		}
+		writeJSON(w, &rsapi.GetRunsResponse{Runs: groupRuns})
+	}).Methods("GET")
+	rsRouter.HandleFunc("/api/v1alpha/runs/{runid}/actions", func(w http.ResponseWriter, r *http.Request) {
+		runID := mux.Vars(r)["runid"]
+		if runID == "run03" {
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+		var req *rsapi.RunActionsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+		addCall(fmt.Sprintf("run %s %s", runID, req.Phase))
+	}).Methods("PUT")
+	rs := httptest.NewServer(rsRouter)
+
+	logger := slog.New(zap.NewAtomicLevelAt(zap.FatalLevel))
+	h := NewActionHandler(logger, nil, csapi.NewClient(cs.URL), rsapi.NewClient(rs.URL), "agola", "", "", nil, nil, nil, nil, nil, nil, nil, 0)
+
+	getCalls := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls
+	}
+	return h, getCalls, func() {
+		cs.Close()
+		rs.Close()
+	}
+}
+
+// bulkResultsErrors returns the bulk operation results errors by object ref:
+// "" for successful operations, otherwise the error kind
+func bulkResultsErrors(results []*BulkOperationResult) map[string]string {
+	out := map[string]string{}
+	for _, r := range results {
+		switch {
+		case r.Err == nil:
+			out[r.Ref] = ""
+		case errors.Is(r.Err, &util.ErrForbidden{}):
+			out[r.Ref] = "forbidden"
+		case errors.Is(r.Err, &util.ErrNotFound{}):
+			out[r.Ref] = "notfound"
+		case errors.Is(r.Err, &util.ErrBadRequest{}):
+			out[r.Ref] = "badrequest"
+		default:
+			out[r.Ref] = "error"
+		}
+	}
+	return out
+}
+
+func TestBulkOperationsItems(t *testing.T) {
+	h, _, stop := newTestProjectGroupsActionHandler(t)
+	defer stop()
+
+	ctx := userContext("user01")
+	tooMany := make([]string, MaxBulkOperationItems+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("run%03d", i)
+	}
+
+	for _, refs := range [][]string{nil, tooMany} {
+		if _, err := h.CancelRuns(ctx, refs); !errors.Is(err, &util.ErrBadRequest{}) {
+			t.Fatalf("expected bad request error, got: %v", err)
+		}
+		if _, err := h.DeleteProjects(ctx, refs); !errors.Is(err, &util.ErrBadRequest{}) {
+			t.Fatalf("expected bad request error, got: %v", err)
+		}
+	}
+}
+
+func TestCancelRuns(t *testing.T) {
+	h, getCalls, stop := newTestProjectGroupsActionHandler(t)
+	defer stop()
+
+	// user01 is only a member of the run02 project owner
+	results, err := h.CancelRuns(userContext("user01"), []string{"run01", "run02", "run03", "run04"})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// the results are in the request order
+	refs := []string{}
+	for _, r := range results {
+		refs = append(refs, r.Ref)
+	}
+	if diff := cmp.Diff([]string{"run01", "run02", "run03", "run04"}, refs); diff != "" {
+		t.Fatalf("results mismatch (-want +got):\n%s", diff)
+	}
+
+	expectedErrors := map[string]string{
+		"run01": "",
+		"run02": "forbidden",
+		"run03": "badrequest",
+		"run04": "notfound",
+	}
+	if diff := cmp.Diff(expectedErrors, bulkResultsErrors(results)); diff != "" {
+		t.Fatalf("results mismatch (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]string{"run run01 cancelled"}, getCalls()); diff != "" {
+		t.Fatalf("calls mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDeleteProjects(t *testing.T) {
+	tests := []struct {
+		name           string
+		ctx            context.Context
+		expectedErrors map[string]string
+		expectedCalls  []string
+	}{
+		{
+			name: "owner",
+			ctx:  userContext("user01"),
+			expectedErrors: map[string]string{
+				"project01": "",
+				"project02": "forbidden",
+				"project03": "error",
+				"project06": "notfound",
+			},
+			expectedCalls: []string{"delete project project01"},
+		},
+		{
+			name: "member",
+			ctx:  userContext("user02"),
+			expectedErrors: map[string]string{
+				"project01": "forbidden",
+				"project02": "forbidden",
+				"project03": "forbidden",
+				"project06": "notfound",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, getCalls, stop := newTestProjectGroupsActionHandler(t)
+			defer stop()
+
+			results, err := h.DeleteProjects(tt.ctx, []string{"project01", "project02", "project03", "project06"})
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if diff := cmp.Diff(tt.expectedErrors, bulkResultsErrors(results)); diff != "" {
+				t.Fatalf("results mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.expectedCalls, getCalls()); diff != "" {
+				t.Fatalf("calls mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUpdateProjectGroupVisibility(t *testing.T) {
+	t.Run("public", func(t *testing.T) {
+		h, getCalls, stop := newTestProjectGroupsActionHandler(t)
+		defer stop()
+
+		results, err := h.UpdateProjectGroupVisibility(userContext("user01"), "pg01", types.VisibilityPublic)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		// the objects already public aren't updated and the failed updates
+		// don't stop the others
+		expectedErrors := map[string]string{
+			"org/org01/pg01":           "",
+			"org/org01/pg01/project03": "error",
+			"org/org01/pg01/pg02":      "",
+		}
+		if diff := cmp.Diff(expectedErrors, bulkResultsErrors(results)); diff != "" {
+			t.Fatalf("results mismatch (-want +got):\n%s", diff)
+		}
+		expectedCalls := []string{
+			"update projectgroup pg01 public",
+			"update projectgroup pg02 public",
+		}
+		if diff := cmp.Diff(expectedCalls, getCalls()); diff != "" {
+			t.Fatalf("calls mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("private", func(t *testing.T) {
+		h, getCalls, stop := newTestProjectGroupsActionHandler(t)
+		defer stop()
+
+		results, err := h.UpdateProjectGroupVisibility(userContext("user01"), "org01", types.VisibilityPrivate)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		expectedErrors := map[string]string{
+			"org/org01":                     "",
+			"org/org01/project05":           "",
+			"org/org01/pg01/pg02/project04": "",
+		}
+		if diff := cmp.Diff(expectedErrors, bulkResultsErrors(results)); diff != "" {
+			t.Fatalf("results mismatch (-want +got):\n%s", diff)
+		}
+		expectedCalls := []string{
+			"update projectgroup org01 private",
+			"update project project05 private",
+			"update project project04 private",
+		}
+		if diff := cmp.Diff(expectedCalls, getCalls()); diff != "" {
+			t.Fatalf("calls mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("not owner", func(t *testing.T) {
+		h, getCalls, stop := newTestProjectGroupsActionHandler(t)
+		defer stop()
+
+		for _, ctx := range []context.Context{userContext("user02"), context.Background()} {
+			if _, err := h.UpdateProjectGroupVisibility(ctx, "pg01", types.VisibilityPublic); !errors.Is(err, &util.ErrForbidden{}) {
+				t.Fatalf("expected forbidden error, got: %v", err)
+			}
+		}
+		if _, err := h.UpdateProjectGroupVisibility(userContext("user01"), "org02", types.VisibilityPublic); !errors.Is(err, &util.ErrForbidden{}) {
+			t.Fatalf("expected forbidden error, got: %v", err)
+		}
+		if len(getCalls()) != 0 {
+			t.Fatalf("unexpected calls: %v", getCalls())
+		}
+	})
+
+	t.Run("invalid visibility", func(t *testing.T) {
+		h, _, stop := newTestProjectGroupsActionHandler(t)
+		defer stop()
+
+		if _, err := h.UpdateProjectGroupVisibility(userContext("user01"), "pg01", "internal"); !errors.Is(err, &util.ErrBadRequest{}) {
+			t.Fatalf("expected bad request error, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+
+	"agola.io/agola/internal/config"
+
+	errors "golang.org/x/xerrors"
+)
+
+type ValidateConfigRequest struct {
+	Data   []byte
+	Format config.ConfigFormat
+}
+
+type ConfigValidation struct {
+	// Error is the config parsing error, nil if the config is valid
+	Error *config.ConfigError
+	// LintIssues are the config lint issues, reported only for parsable configs
+	LintIssues []*config.LintIssue
+}
+
+func (h *ActionHandler) ValidateConfig(ctx context.Context, req *ValidateConfigRequest) (*ConfigValidation, error) {
+	c, err := config.ParseConfig(req.Data, req.Format)
+	if err != nil {
+		var cerr *config.ConfigError
+		if !errors.As(err, &cerr) {
+			cerr = &config.ConfigError{Err: err}
+		}
+		return &ConfigValidation{Error: cerr}, nil
+	}
+
+	lintIssues := h.configLinter.Lint(c, req.Data, req.Format)
+
+	// report the conflicts with the instance run config policy. Remote tasks
+	// aren't expanded here so only the local tasks are checked
+	if h.runConfigPolicy != nil {
+		if err := h.runConfigPolicy.Apply(c); err != nil {
+			return &ConfigValidation{Error: &config.ConfigError{Err: err}, LintIssues: lintIssues}, nil
+		}
+	}
+
+	return &ConfigValidation{LintIssues: lintIssues}, nil
+}
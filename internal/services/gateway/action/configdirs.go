@@ -0,0 +1,125 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	gitsource "agola.io/agola/internal/gitsources"
+
+	errors "golang.org/x/xerrors"
+)
+
+// validateConfigDirs checks the project config dirs patterns. They must be
+// clean relative paths inside the repository.
+func validateConfigDirs(configDirs []string) error {
+	for _, pattern := range configDirs {
+		if pattern == "" {
+			return errors.Errorf("empty config dir")
+		}
+		if path.IsAbs(pattern) || path.Clean(pattern) != pattern {
+			return errors.Errorf("config dir %q must be a clean relative path", pattern)
+		}
+		for _, elem := range strings.Split(pattern, "/") {
+			if elem == ".." {
+				return errors.Errorf("config dir %q must be inside the repository", pattern)
+			}
+			if _, err := path.Match(elem, ""); err != nil {
+				return errors.Errorf("invalid config dir %q: %w", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// expandConfigDirs returns the sorted repository directories matching the
+// config dirs patterns. The pattern path elements containing meta characters
+// are matched against the directories listed from the git source.
+func expandConfigDirs(gitSource gitsource.GitSource, repopath, commitSHA string, patterns []string) ([]string, error) {
+	dirsMap := map[string]struct{}{}
+	for _, pattern := range patterns {
+		dirs := []string{""}
+		for _, elem := range strings.Split(pattern, "/") {
+			if elem == "." {
+				continue
+			}
+			if !strings.ContainsAny(elem, `*?[\`) {
+				for i, dir := range dirs {
+					dirs[i] = path.Join(dir, elem)
+				}
+				continue
+			}
+
+			matchingDirs := []string{}
+			for _, dir := range dirs {
+				names, err := gitSource.ListDirs(repopath, commitSHA, dir)
+				if err != nil {
+					return nil, errors.Errorf("failed to list dir %q: %w", dir, err)
+				}
+				for _, name := range names {
+					// the pattern has already been validated
+					if ok, _ := path.Match(elem, name); ok {
+						matchingDirs = append(matchingDirs, path.Join(dir, name))
+					}
+				}
+			}
+			dirs = matchingDirs
+		}
+		for _, dir := range dirs {
+			if dir == "" {
+				dir = "."
+			}
+			dirsMap[dir] = struct{}{}
+		}
+	}
+
+	configDirs := make([]string, 0, len(dirsMap))
+	for dir := range dirsMap {
+		configDirs = append(configDirs, dir)
+	}
+	sort.Strings(configDirs)
+	return configDirs, nil
+}
+
+// configDirChanged reports if the changed files contain a file inside the
+// config dir. Unknown (nil) changed files are considered as changing every
+// config dir and the repository root config dir always matches.
+func configDirChanged(configDir string, changedFiles []string) bool {
+	if changedFiles == nil || configDir == "." {
+		return true
+	}
+	for _, f := range changedFiles {
+		if strings.HasPrefix(f, configDir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// configDirAnnotations returns a copy of the run annotations with the config
+// dir annotation. The repository root config runs aren't annotated.
+func configDirAnnotations(annotations map[string]string, configDir string) map[string]string {
+	if configDir == "" || configDir == "." {
+		return annotations
+	}
+	configAnnotations := make(map[string]string, len(annotations)+1)
+	for k, v := range annotations {
+		configAnnotations[k] = v
+	}
+	configAnnotations[AnnotationConfigDir] = configDir
+	return configAnnotations
+}
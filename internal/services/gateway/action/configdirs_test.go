@@ -0,0 +1,261 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	gitsource "agola.io/agola/internal/gitsources"
+	slog "agola.io/agola/internal/log"
+	rsapi "agola.io/agola/internal/services/runservice/api"
+	"agola.io/agola/internal/services/types"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+// testGitSource is a git source serving the files of its repositories
+// commits. The files are keyed by "repopath@commit:filepath".
+type testGitSource struct {
+	// the not implemented methods panic
+	gitsource.GitSource
+
+	files map[string]string
+	// refs are the refs commit sha keyed by "repopath@ref"
+	refs map[string]string
+
+	mu sync.Mutex
+	// fetchedFiles are the keys of the fetched files
+	fetchedFiles []string
+}
+
+func (g *testGitSource) GetFile(repopath, commit, file string) ([]byte, error) {
+	key := repopath + "@" + commit + ":" + file
+	data, ok := g.files[key]
+	if !ok {
+		return nil, errors.Errorf("file %q doesn't exist", key)
+	}
+	g.mu.Lock()
+	g.fetchedFiles = append(g.fetchedFiles, key)
+	g.mu.Unlock()
+	return []byte(data), nil
+}
+
+// listEntries returns the names of the files and of the directories inside dir
+func (g *testGitSource) listEntries(repopath, commit, dir string) ([]string, []string, error) {
+	prefix := repopath + "@" + commit + ":"
+	dir = path.Clean(dir)
+	filesMap := map[string]struct{}{}
+	dirsMap := map[string]struct{}{}
+	for key := range g.files {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		p := strings.TrimPrefix(key, prefix)
+		if dir != "." {
+			if !strings.HasPrefix(p, dir+"/") {
+				continue
+			}
+			p = strings.TrimPrefix(p, dir+"/")
+		}
+		if i := strings.Index(p, "/"); i >= 0 {
+			dirsMap[p[:i]] = struct{}{}
+		} else {
+			filesMap[p] = struct{}{}
+		}
+	}
+	if len(filesMap) == 0 && len(dirsMap) == 0 {
+		return nil, nil, errors.Errorf("directory %q doesn't exist", dir)
+	}
+	files := []string{}
+	for name := range filesMap {
+		files = append(files, name)
+	}
+	dirs := []string{}
+	for name := range dirsMap {
+		dirs = append(dirs, name)
+	}
+	sort.Strings(files)
+	sort.Strings(dirs)
+	return files, dirs, nil
+}
+
+func (g *testGitSource) ListFiles(repopath, commit, dir string) ([]string, error) {
+	files, _, err := g.listEntries(repopath, commit, dir)
+	return files, err
+}
+
+func (g *testGitSource) ListDirs(repopath, commit, dir string) ([]string, error) {
+	_, dirs, err := g.listEntries(repopath, commit, dir)
+	return dirs, err
+}
+
+func (g *testGitSource) GetRepoInfo(repopath string) (*gitsource.RepoInfo, error) {
+	for key := range g.files {
+		if strings.HasPrefix(key, repopath+"@") {
+			return &gitsource.RepoInfo{Path: repopath}, nil
+		}
+	}
+	return nil, errors.Errorf("repository %q doesn't exist", repopath)
+}
+
+func (g *testGitSource) GetRef(repopath, ref string) (*gitsource.Ref, error) {
+	commitSHA, ok := g.refs[repopath+"@"+ref]
+	if !ok {
+		return nil, errors.Errorf("ref %q doesn't exist", ref)
+	}
+	return &gitsource.Ref{Ref: ref, CommitSHA: commitSHA}, nil
+}
+
+func (g *testGitSource) BranchRef(branch string) string {
+	return "refs/heads/" + branch
+}
+
+func (g *testGitSource) getFetchedFiles() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.fetchedFiles
+}
+
+// newTestCreateRunsActionHandler returns an action handler using a fake
+// runservice. The returned func returns the created runs requests.
+func newTestCreateRunsActionHandler(t *testing.T) (*ActionHandler, func() []*rsapi.RunCreateRequest, func()) {
+	var mu sync.Mutex
+	var runs []*rsapi.RunCreateRequest
+
+	rsRouter := mux.NewRouter()
+	rsRouter.HandleFunc("/api/v1alpha/runs", func(w http.ResponseWriter, r *http.Request) {
+		var req *rsapi.RunCreateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+		mu.Lock()
+		runs = append(runs, req)
+		mu.Unlock()
+		if err := json.NewEncoder(w).Encode(&rsapi.RunResponse{}); err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+	}).Methods("POST")
+	rs := httptest.NewServer(rsRouter)
+
+	logger := slog.New(zap.NewAtomicLevelAt(zap.FatalLevel))
+	h := NewActionHandler(logger, nil, nil, rsapi.NewClient(rs.URL), "agola", "", "", nil, nil, nil, nil, nil, nil, nil, 0)
+
+	getRuns := func() []*rsapi.RunCreateRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return runs
+	}
+	return h, getRuns, rs.Close
+}
+
+// testCreateRunRequest returns a project01 master branch run creation request
+// for the owner/repo repository commit sha01
+func testCreateRunRequest(project *types.Project, gitSource gitsource.GitSource) *CreateRunRequest {
+	return &CreateRunRequest{
+		RunType:            types.RunTypeProject,
+		RefType:            types.RunRefTypeBranch,
+		RunCreationTrigger: types.RunCreationTriggerTypeWebhook,
+		Project:            project,
+		RepoPath:           "owner/repo",
+		GitSource:          gitSource,
+		CommitSHA:          "sha01",
+		Branch:             "master",
+		Ref:                "refs/heads/master",
+		Message:            "commit message",
+		CloneURL:           "git@example.com:owner/repo.git",
+	}
+}
+
+func TestCreateRunsConfigDirs(t *testing.T) {
+	// the configs are invalid so every config creates a setup error run
+	gitSource := &testGitSource{
+		files: map[string]string{
+			"owner/repo@sha01:.agola/config.jsonnet":              "{",
+			"owner/repo@sha01:services/api/.agola/config.jsonnet": "{",
+			"owner/repo@sha01:services/web/.agola/config.jsonnet": "{",
+			// services/lib has no config
+			"owner/repo@sha01:services/lib/lib.go":         "",
+			"owner/repo@sha01:tools/.agola/config.jsonnet": "{",
+		},
+	}
+
+	tests := []struct {
+		name         string
+		configDirs   []string
+		changedFiles []string
+		// expectedConfigDirs are the config dir annotations of the created
+		// runs, empty for the repository root config
+		expectedConfigDirs []string
+	}{
+		{
+			name:               "no config dirs",
+			expectedConfigDirs: []string{""},
+		},
+		{
+			name:               "config dirs patterns",
+			configDirs:         []string{".", "services/*", "tools"},
+			expectedConfigDirs: []string{"", "services/api", "services/web", "tools"},
+		},
+		{
+			name:               "changed files",
+			configDirs:         []string{".", "services/*", "tools"},
+			changedFiles:       []string{"services/web/main.go", "README.md"},
+			expectedConfigDirs: []string{"", "services/web"},
+		},
+		{
+			name:               "no matching dirs",
+			configDirs:         []string{"services/*/cmd"},
+			expectedConfigDirs: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, getRuns, stop := newTestCreateRunsActionHandler(t)
+			defer stop()
+
+			req := testCreateRunRequest(&types.Project{ID: "project01", ConfigDirs: tt.configDirs}, gitSource)
+			req.ChangedFiles = tt.changedFiles
+			if err := h.CreateRuns(context.Background(), req); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			configDirs := []string{}
+			for _, run := range getRuns() {
+				if run.Group != "/project/project01/branch/master" {
+					t.Errorf("unexpected run group %q", run.Group)
+				}
+				if run.StaticEnvironment["AGOLA_CONFIG_DIR"] != run.Annotations[AnnotationConfigDir] {
+					t.Errorf("expected AGOLA_CONFIG_DIR env %q, got %q", run.Annotations[AnnotationConfigDir], run.StaticEnvironment["AGOLA_CONFIG_DIR"])
+				}
+				configDirs = append(configDirs, run.Annotations[AnnotationConfigDir])
+			}
+			if diff := cmp.Diff(tt.expectedConfigDirs, configDirs); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
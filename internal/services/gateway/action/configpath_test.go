@@ -0,0 +1,108 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"testing"
+
+	"agola.io/agola/internal/services/types"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCreateRunsConfigPath(t *testing.T) {
+	files := map[string]string{
+		"owner/repo@sha01:.agola/config.jsonnet":              "{",
+		"owner/repo@sha01:ci/agola.yml":                       "{",
+		"owner/repo@sha01:services/api/ci/agola.yml":          "{",
+		"owner/repo@sha01:services/web/.agola/config.jsonnet": "{",
+	}
+
+	tests := []struct {
+		name       string
+		configPath string
+		configDirs []string
+		// expectedFetchedFiles are the config files used to create the runs
+		expectedFetchedFiles []string
+	}{
+		{
+			name:                 "default config dir",
+			expectedFetchedFiles: []string{"owner/repo@sha01:.agola/config.jsonnet"},
+		},
+		{
+			name:                 "config path",
+			configPath:           "ci/agola.yml",
+			expectedFetchedFiles: []string{"owner/repo@sha01:ci/agola.yml"},
+		},
+		{
+			// the config dirs without the config path file are skipped
+			name:                 "config path inside config dirs",
+			configPath:           "ci/agola.yml",
+			configDirs:           []string{"services/*"},
+			expectedFetchedFiles: []string{"owner/repo@sha01:services/api/ci/agola.yml"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, getRuns, stop := newTestCreateRunsActionHandler(t)
+			defer stop()
+
+			gitSource := &testGitSource{files: files}
+			req := testCreateRunRequest(&types.Project{ID: "project01", ConfigPath: tt.configPath, ConfigDirs: tt.configDirs}, gitSource)
+			if err := h.CreateRuns(context.Background(), req); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.expectedFetchedFiles, gitSource.getFetchedFiles()); diff != "" {
+				t.Error(diff)
+			}
+			// the invalid config creates a setup error run
+			if len(getRuns()) != 1 {
+				t.Errorf("expected 1 run, got %d runs", len(getRuns()))
+			}
+		})
+	}
+}
+
+func TestValidateConfigPath(t *testing.T) {
+	tests := []struct {
+		configPath string
+		valid      bool
+	}{
+		{configPath: "", valid: true},
+		{configPath: "agola.jsonnet", valid: true},
+		{configPath: "ci/agola.yml", valid: true},
+		{configPath: "ci/agola.json", valid: true},
+		{configPath: "/ci/agola.yml", valid: false},
+		{configPath: "../agola.yml", valid: false},
+		{configPath: "ci/../agola.yml", valid: false},
+		{configPath: "ci/agola.yaml", valid: false},
+		{configPath: "ci/", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.configPath, func(t *testing.T) {
+			err := validateConfigPath(tt.configPath)
+			if tt.valid && err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatalf("expected error")
+			}
+		})
+	}
+}
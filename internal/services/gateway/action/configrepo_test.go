@@ -0,0 +1,145 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"testing"
+
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/google/go-cmp/cmp"
+	errors "golang.org/x/xerrors"
+)
+
+func testConfigRepoGitSource() *testGitSource {
+	return &testGitSource{
+		files: map[string]string{
+			"owner/repo@sha01:.agola/config.jsonnet": "{",
+			"owner/ci@sha05:.agola/config.jsonnet":   "{",
+			"owner/ci@sha06:.agola/config.jsonnet":   "{",
+		},
+		refs: map[string]string{
+			"owner/ci@refs/heads/main":  "sha05",
+			"owner/ci@refs/tags/v1.0.0": "sha06",
+		},
+	}
+}
+
+func TestCreateRunsConfigRepo(t *testing.T) {
+	tests := []struct {
+		name       string
+		configRepo *types.ProjectConfigRepo
+		// expectedFetchedFiles are the config files used to create the runs
+		expectedFetchedFiles []string
+		// expectedAnnotations are the config repository annotations of the
+		// created run
+		expectedAnnotations map[string]string
+		expectedErr         bool
+	}{
+		{
+			name:                 "project repository config",
+			expectedFetchedFiles: []string{"owner/repo@sha01:.agola/config.jsonnet"},
+			expectedAnnotations:  map[string]string{},
+		},
+		{
+			name:                 "config repository branch",
+			configRepo:           &types.ProjectConfigRepo{RepositoryPath: "owner/ci", Ref: "main"},
+			expectedFetchedFiles: []string{"owner/ci@sha05:.agola/config.jsonnet"},
+			expectedAnnotations:  map[string]string{AnnotationConfigRepo: "owner/ci", AnnotationConfigCommitSHA: "sha05"},
+		},
+		{
+			name:                 "config repository full ref",
+			configRepo:           &types.ProjectConfigRepo{RepositoryPath: "owner/ci", Ref: "refs/tags/v1.0.0"},
+			expectedFetchedFiles: []string{"owner/ci@sha06:.agola/config.jsonnet"},
+			expectedAnnotations:  map[string]string{AnnotationConfigRepo: "owner/ci", AnnotationConfigCommitSHA: "sha06"},
+		},
+		{
+			// a setup error run is created
+			name:                "missing config repository ref",
+			configRepo:          &types.ProjectConfigRepo{RepositoryPath: "owner/ci", Ref: "dev"},
+			expectedAnnotations: map[string]string{},
+			expectedErr:         true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, getRuns, stop := newTestCreateRunsActionHandler(t)
+			defer stop()
+
+			gitSource := testConfigRepoGitSource()
+			req := testCreateRunRequest(&types.Project{ID: "project01", ConfigRepo: tt.configRepo}, gitSource)
+			err := h.CreateRuns(context.Background(), req)
+			if tt.expectedErr {
+				if !errors.Is(err, &util.ErrInternal{}) {
+					t.Fatalf("expected internal error, got: %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.expectedFetchedFiles, gitSource.getFetchedFiles()); diff != "" {
+				t.Error(diff)
+			}
+			runs := getRuns()
+			if len(runs) != 1 {
+				t.Fatalf("expected 1 run, got %d runs", len(runs))
+			}
+			annotations := map[string]string{}
+			for _, k := range []string{AnnotationConfigRepo, AnnotationConfigCommitSHA} {
+				if v, ok := runs[0].Annotations[k]; ok {
+					annotations[k] = v
+				}
+			}
+			if diff := cmp.Diff(tt.expectedAnnotations, annotations); diff != "" {
+				t.Error(diff)
+			}
+			// the run is always created from the project repository commit
+			if runs[0].Annotations[AnnotationCommitSHA] != "sha01" {
+				t.Errorf("expected commit sha %q, got %q", "sha01", runs[0].Annotations[AnnotationCommitSHA])
+			}
+		})
+	}
+}
+
+func TestCheckConfigRepo(t *testing.T) {
+	tests := []struct {
+		name       string
+		configRepo *types.ProjectConfigRepo
+		valid      bool
+	}{
+		{name: "valid", configRepo: &types.ProjectConfigRepo{RepositoryPath: "owner/ci", Ref: "main"}, valid: true},
+		{name: "empty repository path", configRepo: &types.ProjectConfigRepo{Ref: "main"}},
+		{name: "empty ref", configRepo: &types.ProjectConfigRepo{RepositoryPath: "owner/ci"}},
+		{name: "missing repository", configRepo: &types.ProjectConfigRepo{RepositoryPath: "owner/missing", Ref: "main"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkConfigRepo(testConfigRepoGitSource(), tt.configRepo)
+			if tt.valid {
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, &util.ErrBadRequest{}) {
+				t.Fatalf("expected bad request error, got: %v", err)
+			}
+		})
+	}
+}
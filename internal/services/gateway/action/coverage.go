@@ -0,0 +1,129 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"agola.io/agola/internal/services/common"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+// GetRunCoverage returns the run total coverage
+func (h *ActionHandler) GetRunCoverage(ctx context.Context, runID string) (*rstypes.CoverageReport, error) {
+	if _, err := h.getRunCheckData(ctx, runID, RunDataArtifacts); err != nil {
+		return nil, err
+	}
+
+	report, resp, err := h.runserviceClient.GetRunCoverage(ctx, runID)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	return report, nil
+}
+
+type GetProjectCoverageHistoryRequest struct {
+	ProjectRef string
+	// Branch is the branch to get the coverage history for. When empty the
+	// runs of all the project branches, tags and pull requests are used.
+	Branch string
+	// Limit is the number of last finished runs to inspect
+	Limit int
+}
+
+// GetProjectCoverageHistory returns the coverage of the last finished runs of
+// a project branch, from the newest to the oldest
+func (h *ActionHandler) GetProjectCoverageHistory(ctx context.Context, req *GetProjectCoverageHistoryRequest) ([]*rstypes.CoverageHistoryEntry, error) {
+	p, resp, err := h.configstoreClient.GetProject(ctx, req.ProjectRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project %q: %w", req.ProjectRef, ErrFromRemote(resp, err))
+	}
+
+	group := path.Join("/", string(common.GroupTypeProject), p.ID)
+	canGetRunData, err := h.CanGetRunData(ctx, group, RunDataArtifacts)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine permissions: %w", err)
+	}
+	if !canGetRunData {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	if req.Branch != "" {
+		group = common.GenRunGroup(common.GroupTypeProject, p.ID, common.GroupTypeBranch, req.Branch)
+	}
+	entries, resp, err := h.runserviceClient.GetCoverageHistory(ctx, group, req.Limit)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	return entries, nil
+}
+
+// coverageBadgeRuns is the number of last finished runs inspected to find the
+// coverage reported in the badge
+const coverageBadgeRuns = 10
+
+// GetCoverageBadge returns a badge with the coverage of the last finished run
+// with coverage reports of a project branch
+func (h *ActionHandler) GetCoverageBadge(ctx context.Context, projectRef, branch string) (string, error) {
+	project, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
+	if err != nil {
+		return "", ErrFromRemote(resp, err)
+	}
+
+	group := common.GenRunGroup(common.GroupTypeProject, project.ID, common.GroupTypeBranch, branch)
+	entries, resp, err := h.runserviceClient.GetCoverageHistory(ctx, group, coverageBadgeRuns)
+	if err != nil {
+		return "", ErrFromRemote(resp, err)
+	}
+	if len(entries) == 0 {
+		return coverageBadge("unknown", "#9f9f9f"), nil
+	}
+
+	percent := entries[0].Coverage.Percent()
+	return coverageBadge(fmt.Sprintf("%.0f%%", percent), coverageBadgeColor(percent)), nil
+}
+
+func coverageBadgeColor(percent float64) string {
+	switch {
+	case percent >= 90:
+		return "#4c1"
+	case percent >= 75:
+		return "#a3c51c"
+	case percent >= 60:
+		return "#dfb317"
+	default:
+		return "#e05d44"
+	}
+}
+
+// coverageBadge returns a svg badge like the ones generated by shields.io
+func coverageBadge(value, color string) string {
+	const labelWidth = 61
+	// approximate text width using the DejaVu Sans font at 11px
+	valueWidth := len(value)*7 + 10
+	width := labelWidth + valueWidth
+	valueX := (labelWidth*2 + valueWidth) * 5
+	valueTextLength := (valueWidth - 10) * 10
+
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="%[1]d" height="20"><linearGradient id="b" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient><clipPath id="a"><rect width="%[1]d" height="20" rx="3" fill="#fff"/></clipPath><g clip-path="url(#a)"><path fill="#555" d="M0 0h%[2]dv20H0z"/><path fill="%[3]s" d="M%[2]d 0h%[4]dv20H%[2]dz"/><path fill="url(#b)" d="M0 0h%[1]dv20H0z"/></g><g fill="#fff" text-anchor="middle" font-family="DejaVu Sans,Verdana,Geneva,sans-serif" font-size="110"> <text x="315" y="150" fill="#010101" fill-opacity=".3" transform="scale(.1)" textLength="510">coverage</text><text x="315" y="140" transform="scale(.1)" textLength="510">coverage</text><text x="%[5]d" y="150" fill="#010101" fill-opacity=".3" transform="scale(.1)" textLength="%[6]d">%[7]s</text><text x="%[5]d" y="140" transform="scale(.1)" textLength="%[6]d">%[7]s</text></g> </svg>`,
+		width, labelWidth, color, valueWidth, valueX, valueTextLength, value)
+}
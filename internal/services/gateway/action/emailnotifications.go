@@ -0,0 +1,142 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"net/mail"
+
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+type UpdateUserEmailNotificationsRequest struct {
+	Email string
+	// Mode is the default mode of the subscribed projects
+	Mode types.NotificationMode
+	// Projects are the subscribed projects modes keyed by project ref
+	Projects map[string]types.NotificationMode
+	Digest   bool
+}
+
+// emailNotificationsUser returns the user whose email notifications settings
+// are managed. Only the user itself and the admins can manage them.
+func (h *ActionHandler) emailNotificationsUser(ctx context.Context, userRef string) (*types.User, error) {
+	user, resp, err := h.configstoreClient.GetUser(ctx, userRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get user: %w", ErrFromRemote(resp, err))
+	}
+	if !h.IsUserAdmin(ctx) && user.ID != h.CurrentUserID(ctx) {
+		return nil, util.NewErrForbidden(errors.Errorf("logged in user cannot manage the email notifications of another user"))
+	}
+	return user, nil
+}
+
+func (h *ActionHandler) GetUserEmailNotifications(ctx context.Context, userRef string) (*types.UserEmailNotifications, error) {
+	user, err := h.emailNotificationsUser(ctx, userRef)
+	if err != nil {
+		return nil, err
+	}
+	if user.EmailNotifications == nil {
+		return nil, util.NewErrNotFound(errors.Errorf("user %q email notifications aren't configured", user.Name))
+	}
+	return user.EmailNotifications, nil
+}
+
+// UpdateUserEmailNotifications replaces the user email notifications settings.
+// The subscribed projects must be visible to the logged in user.
+func (h *ActionHandler) UpdateUserEmailNotifications(ctx context.Context, userRef string, req *UpdateUserEmailNotificationsRequest) (*types.UserEmailNotifications, error) {
+	user, err := h.emailNotificationsUser(ctx, userRef)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateEmailAddress(req.Email); err != nil {
+		return nil, util.NewErrBadRequest(err)
+	}
+	if !types.IsValidNotificationMode(req.Mode) {
+		return nil, util.NewErrBadRequest(errors.Errorf("invalid email notification mode %q", req.Mode))
+	}
+
+	emailNotifications := &types.UserEmailNotifications{
+		Email:    req.Email,
+		Mode:     req.Mode,
+		Projects: map[string]types.NotificationMode{},
+		Digest:   req.Digest,
+	}
+	for projectRef, mode := range req.Projects {
+		if mode != "" && !types.IsValidNotificationMode(mode) {
+			return nil, util.NewErrBadRequest(errors.Errorf("invalid email notification mode %q for project %q", mode, projectRef))
+		}
+		project, err := h.GetProject(ctx, projectRef)
+		if err != nil {
+			return nil, errors.Errorf("failed to get project %q: %w", projectRef, err)
+		}
+		emailNotifications.Projects[project.ID] = mode
+	}
+
+	creq := &csapi.UpdateUserRequest{
+		EmailNotifications: emailNotifications,
+	}
+	if _, resp, err := h.configstoreClient.UpdateUser(ctx, user.ID, creq); err != nil {
+		return nil, errors.Errorf("failed to update user: %w", ErrFromRemote(resp, err))
+	}
+
+	return emailNotifications, nil
+}
+
+func (h *ActionHandler) DeleteUserEmailNotifications(ctx context.Context, userRef string) error {
+	user, err := h.emailNotificationsUser(ctx, userRef)
+	if err != nil {
+		return err
+	}
+
+	creq := &csapi.UpdateUserRequest{
+		EmailNotifications: &types.UserEmailNotifications{},
+	}
+	if _, resp, err := h.configstoreClient.UpdateUser(ctx, user.ID, creq); err != nil {
+		return errors.Errorf("failed to update user: %w", ErrFromRemote(resp, err))
+	}
+
+	return nil
+}
+
+// validateEmailAddress checks that email is a bare email address (without a
+// display name)
+func validateEmailAddress(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return errors.Errorf("invalid email address %q", email)
+	}
+	return nil
+}
+
+func validateProjectEmailNotifications(n *types.ProjectEmailNotifications) error {
+	if len(n.Recipients) == 0 {
+		return errors.Errorf("email notifications recipients are empty")
+	}
+	for _, recipient := range n.Recipients {
+		if err := validateEmailAddress(recipient); err != nil {
+			return err
+		}
+	}
+	if !types.IsValidNotificationMode(n.Mode) {
+		return errors.Errorf("invalid email notification mode %q", n.Mode)
+	}
+	return nil
+}
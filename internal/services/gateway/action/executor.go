@@ -0,0 +1,62 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+func (h *ActionHandler) GetExecutors(ctx context.Context) ([]*rstypes.Executor, error) {
+	if !h.IsUserAdmin(ctx) {
+		return nil, util.NewErrForbidden(errors.Errorf("user not admin"))
+	}
+
+	executors, resp, err := h.runserviceClient.GetExecutors(ctx)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+	return executors, nil
+}
+
+func (h *ActionHandler) ApproveExecutor(ctx context.Context, executorID string) error {
+	if !h.IsUserAdmin(ctx) {
+		return util.NewErrForbidden(errors.Errorf("user not admin"))
+	}
+
+	resp, err := h.runserviceClient.ApproveExecutor(ctx, executorID)
+	if err != nil {
+		return ErrFromRemote(resp, err)
+	}
+	return nil
+}
+
+// DeleteExecutor removes an executor. It's also used to reject an executor
+// waiting approval.
+func (h *ActionHandler) DeleteExecutor(ctx context.Context, executorID string) error {
+	if !h.IsUserAdmin(ctx) {
+		return util.NewErrForbidden(errors.Errorf("user not admin"))
+	}
+
+	resp, err := h.runserviceClient.DeleteExecutor(ctx, executorID)
+	if err != nil {
+		return ErrFromRemote(resp, err)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"time"
+
+	"agola.io/agola/internal/services/common"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	DefaultRunsFeedLimit = 25
+	MaxRunsFeedLimit     = 100
+)
+
+// RunsFeed contains the finished runs of a project, from the newest to the
+// oldest, used to generate the project runs feeds
+type RunsFeed struct {
+	ID      string
+	Title   string
+	URL     string
+	Updated time.Time
+	Entries []*RunsFeedEntry
+}
+
+type RunsFeedEntry struct {
+	ID      string
+	Title   string
+	Summary string
+	URL     string
+	Updated time.Time
+	Failed  bool
+}
+
+func (h *ActionHandler) GetProjectRunsFeed(ctx context.Context, projectRef string, limit int) (*RunsFeed, error) {
+	if limit <= 0 {
+		limit = DefaultRunsFeedLimit
+	}
+	if limit > MaxRunsFeedLimit {
+		limit = MaxRunsFeedLimit
+	}
+
+	p, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project %q: %w", projectRef, ErrFromRemote(resp, err))
+	}
+
+	group := path.Join("/", string(common.GroupTypeProject), p.ID)
+	canGetRun, err := h.CanGetRun(ctx, group)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine permissions: %w", err)
+	}
+	if !canGetRun {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	phases := []string{string(rstypes.RunPhaseFinished), string(rstypes.RunPhaseSetupError)}
+	runsResp, resp, err := h.runserviceClient.GetRuns(ctx, phases, nil, []string{group}, nil, nil, false, false, nil, "", limit, false)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	feed := &RunsFeed{
+		ID:    "urn:agola:" + h.agolaID + ":project:" + p.ID + ":runs",
+		Title: fmt.Sprintf("%s runs", p.Path),
+		URL:   h.webExposedURL,
+	}
+	for _, r := range runsResp.Runs {
+		runURL, err := h.webRunURL(p.ID, r.ID)
+		if err != nil {
+			return nil, errors.Errorf("failed to generate run url: %w", err)
+		}
+
+		e := &RunsFeedEntry{
+			ID:      "urn:agola:" + h.agolaID + ":run:" + r.ID,
+			URL:     runURL,
+			Summary: runFeedSummary(r),
+		}
+		switch {
+		case r.EndTime != nil:
+			e.Updated = *r.EndTime
+		case r.EnqueueTime != nil:
+			e.Updated = *r.EnqueueTime
+		}
+
+		var result string
+		switch {
+		case r.Phase == rstypes.RunPhaseSetupError:
+			result = "has setup errors"
+			e.Failed = true
+		case r.Result == rstypes.RunResultSuccess:
+			result = "succeeded"
+		case r.Result == rstypes.RunResultStopped:
+			result = "stopped"
+		default:
+			result = "failed"
+			e.Failed = true
+		}
+		e.Title = fmt.Sprintf("%s #%d %s", r.Name, r.Counter, result)
+
+		if e.Updated.After(feed.Updated) {
+			feed.Updated = e.Updated
+		}
+		feed.Entries = append(feed.Entries, e)
+	}
+	if feed.Updated.IsZero() {
+		feed.Updated = time.Now()
+	}
+
+	return feed, nil
+}
+
+func (h *ActionHandler) webRunURL(projectID, runID string) (string, error) {
+	u, err := url.Parse(h.webExposedURL + "/run")
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{}
+	q.Set("projectref", projectID)
+	q.Set("runid", runID)
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// runFeedSummary returns the run ref and commit message
+func runFeedSummary(r *rstypes.Run) string {
+	var ref string
+	switch {
+	case r.Annotations[AnnotationBranch] != "":
+		ref = "branch " + r.Annotations[AnnotationBranch]
+	case r.Annotations[AnnotationTag] != "":
+		ref = "tag " + r.Annotations[AnnotationTag]
+	case r.Annotations[AnnotationPullRequestID] != "":
+		ref = "pull request #" + r.Annotations[AnnotationPullRequestID]
+	default:
+		ref = r.Annotations[AnnotationRef]
+	}
+	if msg := r.Annotations[AnnotationMessage]; msg != "" {
+		return ref + ": " + msg
+	}
+	return ref
+}
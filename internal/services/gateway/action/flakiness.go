@@ -0,0 +1,124 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"path"
+
+	"agola.io/agola/internal/services/common"
+	csapi "agola.io/agola/internal/services/configstore/api"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+type GetProjectTasksFlakinessRequest struct {
+	ProjectRef string
+	// Limit is the number of last finished runs to analyze
+	Limit int
+}
+
+// GetProjectTasksFlakiness reports the flakiness of the tasks executed in the
+// last finished runs of the project
+func (h *ActionHandler) GetProjectTasksFlakiness(ctx context.Context, req *GetProjectTasksFlakinessRequest) ([]*rstypes.TaskFlakiness, error) {
+	p, resp, err := h.configstoreClient.GetProject(ctx, req.ProjectRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project %q: %w", req.ProjectRef, ErrFromRemote(resp, err))
+	}
+
+	group := path.Join("/", string(common.GroupTypeProject), p.ID)
+	canGetRun, err := h.CanGetRun(ctx, group)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine permissions: %w", err)
+	}
+	if !canGetRun {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	tfs, resp, err := h.runserviceClient.GetTasksFlakiness(ctx, group, req.Limit)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	return tfs, nil
+}
+
+// UpdateProjectQuarantinedTasks sets the project quarantined tasks. The
+// failures of quarantined tasks are ignored so they won't make the runs fail.
+func (h *ActionHandler) UpdateProjectQuarantinedTasks(ctx context.Context, projectRef string, tasks []string) (*csapi.Project, error) {
+	p, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project %q: %w", projectRef, ErrFromRemote(resp, err))
+	}
+
+	isProjectOwner, err := h.IsProjectOwner(ctx, p.OwnerType, p.OwnerID)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isProjectOwner {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	seen := map[string]struct{}{}
+	quarantinedTasks := []string{}
+	for _, task := range tasks {
+		if task == "" {
+			return nil, util.NewErrBadRequest(errors.Errorf("empty task name"))
+		}
+		if _, ok := seen[task]; ok {
+			continue
+		}
+		seen[task] = struct{}{}
+		quarantinedTasks = append(quarantinedTasks, task)
+	}
+
+	p.QuarantinedTasks = quarantinedTasks
+
+	h.log.Infof("updating project")
+	rp, resp, err := h.configstoreClient.UpdateProject(ctx, p.ID, p.Project)
+	if err != nil {
+		return nil, errors.Errorf("failed to update project: %w", ErrFromRemote(resp, err))
+	}
+	h.log.Infof("project %s updated, ID: %s", p.Name, p.ID)
+
+	h.recordProjectChange(ctx, rp.ID, &types.ProjectChange{
+		Action:     types.ProjectChangeActionUpdate,
+		ObjectType: types.ConfigTypeProject,
+		ObjectID:   rp.ID,
+		ObjectName: rp.Name,
+	}, rp.Project)
+
+	return rp, nil
+}
+
+// quarantineTasks ignores the failures of the run config tasks quarantined in
+// the project
+func quarantineTasks(rcts map[string]*rstypes.RunConfigTask, project *types.Project) {
+	if project == nil || len(project.QuarantinedTasks) == 0 {
+		return
+	}
+	quarantined := map[string]struct{}{}
+	for _, task := range project.QuarantinedTasks {
+		quarantined[task] = struct{}{}
+	}
+	for _, rct := range rcts {
+		if _, ok := quarantined[rct.Name]; ok {
+			rct.IgnoreFailure = true
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"testing"
+
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/services/types"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestQuarantineTasks(t *testing.T) {
+	tests := []struct {
+		name    string
+		project *types.Project
+		out     map[string]bool
+	}{
+		{
+			name: "no project",
+			out:  map[string]bool{"task01": false, "task02": false, "task03": true},
+		},
+		{
+			name:    "no quarantined tasks",
+			project: &types.Project{},
+			out:     map[string]bool{"task01": false, "task02": false, "task03": true},
+		},
+		{
+			name:    "quarantined tasks",
+			project: &types.Project{QuarantinedTasks: []string{"task02", "task03", "task04"}},
+			out:     map[string]bool{"task01": false, "task02": true, "task03": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the tasks are matched by name, not by id
+			rcts := map[string]*rstypes.RunConfigTask{
+				"id01": {ID: "id01", Name: "task01"},
+				"id02": {ID: "id02", Name: "task02"},
+				// already ignoring its failures in the config
+				"id03": {ID: "id03", Name: "task03", IgnoreFailure: true},
+			}
+
+			quarantineTasks(rcts, tt.project)
+
+			out := map[string]bool{}
+			for _, rct := range rcts {
+				out[rct.Name] = rct.IgnoreFailure
+			}
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Fatalf("ignore failure mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+func (h *ActionHandler) GetConfigWals(ctx context.Context, start string, limit int) ([]*csapi.Wal, error) {
+	if !h.IsUserAdmin(ctx) {
+		return nil, util.NewErrForbidden(errors.Errorf("user not admin"))
+	}
+
+	wals, resp, err := h.configstoreClient.GetWals(ctx, start, limit)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+	return wals, nil
+}
+
+// GetConfigObjectHistory returns the object history with the raw objects
+// data. The caller must remove the sensitive data before exposing it.
+func (h *ActionHandler) GetConfigObjectHistory(ctx context.Context, dataType, id, start string, limit int) (*csapi.ObjectHistory, error) {
+	if !h.IsUserAdmin(ctx) {
+		return nil, util.NewErrForbidden(errors.Errorf("user not admin"))
+	}
+
+	history, resp, err := h.configstoreClient.GetObjectHistory(ctx, dataType, id, start, limit)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	return history, nil
+}
+
+type RestoreConfigObjectRequest struct {
+	DataType    string
+	ID          string
+	WalSequence string
+}
+
+func (h *ActionHandler) RestoreConfigObject(ctx context.Context, req *RestoreConfigObjectRequest) error {
+	if !h.IsUserAdmin(ctx) {
+		return util.NewErrForbidden(errors.Errorf("user not admin"))
+	}
+
+	if req.WalSequence == "" {
+		return util.NewErrBadRequest(errors.Errorf("empty wal sequence"))
+	}
+
+	h.log.Infof("restoring %s %q to wal %q", req.DataType, req.ID, req.WalSequence)
+	creq := &csapi.RestoreObjectRequest{
+		WalSequence: req.WalSequence,
+	}
+	if _, resp, err := h.configstoreClient.RestoreObject(ctx, req.DataType, req.ID, creq); err != nil {
+		return errors.Errorf("failed to restore %s %q: %w", req.DataType, req.ID, ErrFromRemote(resp, err))
+	}
+	h.log.Infof("%s %q restored", req.DataType, req.ID)
+
+	return nil
+}
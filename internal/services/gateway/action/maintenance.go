@@ -0,0 +1,80 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+type MaintenanceStatus struct {
+	Maintenance *rstypes.Maintenance
+
+	// QueuedWebhooks is the number of webhooks received during the
+	// maintenance mode and not yet replayed
+	QueuedWebhooks int
+}
+
+func (h *ActionHandler) GetMaintenance(ctx context.Context) (*MaintenanceStatus, error) {
+	if !h.IsUserAdmin(ctx) {
+		return nil, util.NewErrForbidden(errors.Errorf("user not admin"))
+	}
+
+	maintenance, resp, err := h.runserviceClient.GetMaintenance(ctx)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+	qws, resp, err := h.runserviceClient.GetQueuedWebhooks(ctx)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	return &MaintenanceStatus{
+		Maintenance:    maintenance,
+		QueuedWebhooks: len(qws),
+	}, nil
+}
+
+// EnableMaintenance enables the instance maintenance mode. While enabled the
+// runs aren't scheduled and the received webhooks are queued.
+func (h *ActionHandler) EnableMaintenance(ctx context.Context) (*rstypes.Maintenance, error) {
+	if !h.IsUserAdmin(ctx) {
+		return nil, util.NewErrForbidden(errors.Errorf("user not admin"))
+	}
+
+	maintenance, resp, err := h.runserviceClient.EnableMaintenance(ctx)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+	return maintenance, nil
+}
+
+// DisableMaintenance disables the instance maintenance mode. The queued
+// webhooks will be replayed by the gateways.
+func (h *ActionHandler) DisableMaintenance(ctx context.Context) error {
+	if !h.IsUserAdmin(ctx) {
+		return util.NewErrForbidden(errors.Errorf("user not admin"))
+	}
+
+	resp, err := h.runserviceClient.DisableMaintenance(ctx)
+	if err != nil {
+		return ErrFromRemote(resp, err)
+	}
+	return nil
+}
@@ -134,6 +134,8 @@ func (h *ActionHandler) DeleteOrg(ctx context.Context, orgRef string) error {
 	if err != nil {
 		return errors.Errorf("failed to delete org: %w", ErrFromRemote(resp, err))
 	}
+	h.refCache.purge()
+
 	return nil
 }
 
@@ -161,11 +163,28 @@ func (h *ActionHandler) AddOrgMember(ctx context.Context, orgRef, userRef string
 		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
 	}
 
+	orgMembers, resp, err := h.configstoreClient.GetOrgMembers(ctx, org.ID)
+	if err != nil {
+		return nil, errors.Errorf("failed to get organization members: %w", ErrFromRemote(resp, err))
+	}
+	isMember := false
+	for _, m := range orgMembers {
+		if m.User.ID == user.ID {
+			isMember = true
+			break
+		}
+	}
+
 	orgmember, resp, err := h.configstoreClient.AddOrgMember(ctx, orgRef, userRef, role)
 	if err != nil {
 		return nil, errors.Errorf("failed to add/update organization member: %w", ErrFromRemote(resp, err))
 	}
 
+	// notify only new members, not role updates
+	if !isMember {
+		h.addOrgInvitationNotification(ctx, org, user, role)
+	}
+
 	return &AddOrgMemberResponse{
 		OrganizationMember: orgmember,
 		Org:                org,
@@ -0,0 +1,223 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	gitsource "agola.io/agola/internal/gitsources"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+type OrgSyncConflictPolicy string
+
+const (
+	OrgSyncConflictPolicyKeep   OrgSyncConflictPolicy = "keep"
+	OrgSyncConflictPolicyRemote OrgSyncConflictPolicy = "remote"
+)
+
+// OrgSyncOrg maps a remote source organization to an agola organization
+type OrgSyncOrg struct {
+	RemoteSource string
+	RemoteOrg    string
+	Org          string
+	Teams        []string
+	OwnerTeams   []string
+}
+
+// OrgSyncConfig is the remote sources organizations membership sync
+// configuration
+type OrgSyncConfig struct {
+	OnLogin        bool
+	Interval       time.Duration
+	ConflictPolicy OrgSyncConflictPolicy
+	Orgs           []*OrgSyncOrg
+}
+
+const orgSyncUsersPageSize = 100
+
+// SyncOrgs syncs the organizations membership of all the users
+func (h *ActionHandler) SyncOrgs(ctx context.Context) error {
+	if h.orgSync == nil {
+		return nil
+	}
+
+	start := ""
+	for {
+		users, resp, err := h.configstoreClient.GetUsers(ctx, start, orgSyncUsersPageSize, true)
+		if err != nil {
+			return errors.Errorf("failed to get users: %w", ErrFromRemote(resp, err))
+		}
+		for _, user := range users {
+			if err := h.SyncUserOrgs(ctx, user); err != nil {
+				h.log.Errorf("failed to sync user %q organizations: %+v", user.Name, err)
+			}
+		}
+		if len(users) < orgSyncUsersPageSize {
+			return nil
+		}
+		start = users[len(users)-1].Name
+	}
+}
+
+// SyncUserOrgs syncs the user membership of the configured organizations
+// using the user linked accounts. The remote sources where the user doesn't
+// have a linked account are skipped.
+func (h *ActionHandler) SyncUserOrgs(ctx context.Context, user *types.User) error {
+	if h.orgSync == nil {
+		return nil
+	}
+
+	orgsByRS := map[string][]*OrgSyncOrg{}
+	rsNames := []string{}
+	for _, o := range h.orgSync.Orgs {
+		if _, ok := orgsByRS[o.RemoteSource]; !ok {
+			rsNames = append(rsNames, o.RemoteSource)
+		}
+		orgsByRS[o.RemoteSource] = append(orgsByRS[o.RemoteSource], o)
+	}
+
+	for _, rsName := range rsNames {
+		rs, resp, err := h.configstoreClient.GetRemoteSource(ctx, rsName)
+		if err != nil {
+			return errors.Errorf("failed to get remote source %q: %w", rsName, ErrFromRemote(resp, err))
+		}
+
+		var la *types.LinkedAccount
+		for _, v := range user.LinkedAccounts {
+			if v.RemoteSourceID == rs.ID {
+				la = v
+				break
+			}
+		}
+		if la == nil {
+			continue
+		}
+
+		gitSource, err := h.GetGitSource(ctx, rs, user.Name, la)
+		if err != nil {
+			return errors.Errorf("failed to create git source: %w", err)
+		}
+		orgSource, ok := gitSource.(gitsource.OrgSource)
+		if !ok {
+			h.log.Warnf("remote source %q doesn't support organizations sync", rs.Name)
+			continue
+		}
+		remoteOrgs, err := orgSource.ListUserOrgs()
+		if err != nil {
+			return errors.Errorf("failed to list remote source %q user %q organizations: %w", rs.Name, la.RemoteUserName, err)
+		}
+
+		for _, o := range orgsByRS[rsName] {
+			role, member := orgSyncMemberRole(o, remoteOrgs)
+			if err := h.syncOrgMember(ctx, orgSyncOrgName(o), user, role, member); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func orgSyncOrgName(o *OrgSyncOrg) string {
+	if o.Org != "" {
+		return o.Org
+	}
+	return o.RemoteOrg
+}
+
+// orgSyncMemberRole returns the agola organization role of the user and if the
+// user must be a member given its remote organizations
+func orgSyncMemberRole(o *OrgSyncOrg, remoteOrgs []*gitsource.UserOrg) (types.MemberRole, bool) {
+	var remoteOrg *gitsource.UserOrg
+	for _, ro := range remoteOrgs {
+		if strings.EqualFold(ro.Name, o.RemoteOrg) {
+			remoteOrg = ro
+			break
+		}
+	}
+	if remoteOrg == nil {
+		return "", false
+	}
+
+	inTeams := func(teams []string) bool {
+		for _, t := range teams {
+			for _, rt := range remoteOrg.Teams {
+				if strings.EqualFold(t, rt) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	owner := remoteOrg.Owner || inTeams(o.OwnerTeams)
+	if owner {
+		return types.MemberRoleOwner, true
+	}
+	if len(o.Teams) > 0 && !inTeams(o.Teams) {
+		return "", false
+	}
+	return types.MemberRoleMember, true
+}
+
+func (h *ActionHandler) syncOrgMember(ctx context.Context, orgName string, user *types.User, role types.MemberRole, member bool) error {
+	org, resp, err := h.configstoreClient.GetOrg(ctx, orgName)
+	if err := ErrFromRemote(resp, err); err != nil {
+		if errors.Is(err, &util.ErrNotFound{}) {
+			h.log.Warnf("organization %q to sync doesn't exist", orgName)
+			return nil
+		}
+		return errors.Errorf("failed to get organization %q: %w", orgName, err)
+	}
+
+	members, resp, err := h.configstoreClient.GetOrgMembers(ctx, org.ID)
+	if err != nil {
+		return errors.Errorf("failed to get organization %q members: %w", org.Name, ErrFromRemote(resp, err))
+	}
+	var curRole types.MemberRole
+	for _, m := range members {
+		if m.User.ID == user.ID {
+			curRole = m.Role
+			break
+		}
+	}
+
+	keep := h.orgSync.ConflictPolicy != OrgSyncConflictPolicyRemote
+	switch {
+	case member && curRole == "":
+		h.log.Infof("adding user %q to organization %q with role %q", user.Name, org.Name, role)
+	case member && curRole != role && !keep:
+		h.log.Infof("updating user %q organization %q role from %q to %q", user.Name, org.Name, curRole, role)
+	case !member && curRole != "" && !keep:
+		h.log.Infof("removing user %q from organization %q", user.Name, org.Name)
+		if resp, err := h.configstoreClient.RemoveOrgMember(ctx, org.ID, user.ID); err != nil {
+			return errors.Errorf("failed to remove user %q from organization %q: %w", user.Name, org.Name, ErrFromRemote(resp, err))
+		}
+		return nil
+	default:
+		return nil
+	}
+
+	if _, resp, err := h.configstoreClient.AddOrgMember(ctx, org.ID, user.ID, role); err != nil {
+		return errors.Errorf("failed to add user %q to organization %q: %w", user.Name, org.Name, ErrFromRemote(resp, err))
+	}
+	return nil
+}
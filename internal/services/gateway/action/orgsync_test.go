@@ -0,0 +1,189 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+
+	slog "agola.io/agola/internal/log"
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/types"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// newTestOrgSyncActionHandler returns an action handler using a fake gitea
+// where the user is a member of the remoteorg01 devs team and an owner of
+// remoteorg02, and a fake configstore with the org01, org02 and org03
+// organizations, where the user is already a member of org03. The returned
+// func returns the recorded organizations membership changes.
+func newTestOrgSyncActionHandler(t *testing.T, orgSync *OrgSyncConfig) (*ActionHandler, func() []string, func()) {
+	var mu sync.Mutex
+	var calls []string
+	addCall := func(call string) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, call)
+	}
+	writeJSON := func(w http.ResponseWriter, v interface{}) {
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+	}
+
+	giteaRouter := mux.NewRouter()
+	giteaRouter.HandleFunc("/api/v1/user/orgs", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, []map[string]interface{}{
+			{"id": 1, "username": "remoteorg01"},
+			{"id": 2, "username": "remoteorg02"},
+		})
+	})
+	giteaRouter.HandleFunc("/api/v1/user/teams", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, []map[string]interface{}{
+			{"id": 1, "name": "devs", "permission": "write", "organization": map[string]interface{}{"id": 1, "username": "remoteorg01"}},
+			{"id": 2, "name": "Owners", "permission": "owner", "organization": map[string]interface{}{"id": 2, "username": "remoteorg02"}},
+		})
+	})
+	gitea := httptest.NewServer(giteaRouter)
+
+	csRouter := mux.NewRouter()
+	csRouter.HandleFunc("/api/v1alpha/remotesources/{rsref}", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, &types.RemoteSource{
+			ID:       "remotesource01",
+			Name:     "gitea",
+			Type:     types.RemoteSourceTypeGitea,
+			AuthType: types.RemoteSourceAuthTypePassword,
+			APIURL:   gitea.URL,
+		})
+	}).Methods("GET")
+	csRouter.HandleFunc("/api/v1alpha/orgs/{orgref}", func(w http.ResponseWriter, r *http.Request) {
+		orgRef := mux.Vars(r)["orgref"]
+		switch orgRef {
+		case "org01", "org02", "org03":
+			writeJSON(w, &types.Organization{ID: orgRef, Name: orgRef})
+		default:
+			http.Error(w, "", http.StatusNotFound)
+		}
+	}).Methods("GET")
+	csRouter.HandleFunc("/api/v1alpha/orgs/{orgref}/members", func(w http.ResponseWriter, r *http.Request) {
+		members := []*csapi.OrgMemberResponse{}
+		if mux.Vars(r)["orgref"] == "org03" {
+			members = append(members, &csapi.OrgMemberResponse{User: &types.User{ID: "user01", Name: "user01"}, Role: types.MemberRoleMember})
+		}
+		writeJSON(w, members)
+	}).Methods("GET")
+	csRouter.HandleFunc("/api/v1alpha/orgs/{orgref}/members/{userref}", func(w http.ResponseWriter, r *http.Request) {
+		var req csapi.AddOrgMemberRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+		vars := mux.Vars(r)
+		addCall("add " + vars["orgref"] + " " + vars["userref"] + " " + string(req.Role))
+		writeJSON(w, &types.OrganizationMember{})
+	}).Methods("PUT")
+	csRouter.HandleFunc("/api/v1alpha/orgs/{orgref}/members/{userref}", func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		addCall("remove " + vars["orgref"] + " " + vars["userref"])
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods("DELETE")
+	cs := httptest.NewServer(csRouter)
+
+	logger := slog.New(zap.NewAtomicLevelAt(zap.FatalLevel))
+	h := NewActionHandler(logger, nil, csapi.NewClient(cs.URL), nil, "agola", "", "", nil, nil, nil, nil, nil, nil, orgSync, 0)
+
+	getCalls := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		sort.Strings(calls)
+		return calls
+	}
+	return h, getCalls, func() {
+		cs.Close()
+		gitea.Close()
+	}
+}
+
+func TestSyncUserOrgs(t *testing.T) {
+	orgs := []*OrgSyncOrg{
+		{RemoteSource: "gitea", RemoteOrg: "remoteorg01", Org: "org01", Teams: []string{"devs"}},
+		{RemoteSource: "gitea", RemoteOrg: "RemoteOrg02", Org: "org02"},
+		// the user isn't a member of remoteorg03
+		{RemoteSource: "gitea", RemoteOrg: "remoteorg03", Org: "org03"},
+		// org04 doesn't exist
+		{RemoteSource: "gitea", RemoteOrg: "remoteorg01", Org: "org04"},
+	}
+
+	tests := []struct {
+		name          string
+		orgSync       *OrgSyncConfig
+		user          *types.User
+		expectedCalls []string
+	}{
+		{
+			name:    "keep conflict policy",
+			orgSync: &OrgSyncConfig{ConflictPolicy: OrgSyncConflictPolicyKeep, Orgs: orgs},
+			user: &types.User{ID: "user01", Name: "user01", LinkedAccounts: map[string]*types.LinkedAccount{
+				"linkedaccount01": {ID: "linkedaccount01", RemoteSourceID: "remotesource01", UserAccessToken: "token"},
+			}},
+			expectedCalls: []string{"add org01 user01 member", "add org02 user01 owner"},
+		},
+		{
+			name:    "remote conflict policy",
+			orgSync: &OrgSyncConfig{ConflictPolicy: OrgSyncConflictPolicyRemote, Orgs: orgs},
+			user: &types.User{ID: "user01", Name: "user01", LinkedAccounts: map[string]*types.LinkedAccount{
+				"linkedaccount01": {ID: "linkedaccount01", RemoteSourceID: "remotesource01", UserAccessToken: "token"},
+			}},
+			expectedCalls: []string{"add org01 user01 member", "add org02 user01 owner", "remove org03 user01"},
+		},
+		{
+			name: "not in the required teams",
+			orgSync: &OrgSyncConfig{ConflictPolicy: OrgSyncConflictPolicyRemote, Orgs: []*OrgSyncOrg{
+				{RemoteSource: "gitea", RemoteOrg: "remoteorg01", Org: "org03", Teams: []string{"admins"}},
+			}},
+			user: &types.User{ID: "user01", Name: "user01", LinkedAccounts: map[string]*types.LinkedAccount{
+				"linkedaccount01": {ID: "linkedaccount01", RemoteSourceID: "remotesource01", UserAccessToken: "token"},
+			}},
+			expectedCalls: []string{"remove org03 user01"},
+		},
+		{
+			name:          "no linked account",
+			orgSync:       &OrgSyncConfig{ConflictPolicy: OrgSyncConflictPolicyRemote, Orgs: orgs},
+			user:          &types.User{ID: "user01", Name: "user01"},
+			expectedCalls: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, getCalls, stop := newTestOrgSyncActionHandler(t, tt.orgSync)
+			defer stop()
+
+			if err := h.SyncUserOrgs(context.Background(), tt.user); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if diff := cmp.Diff(tt.expectedCalls, getCalls()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+// GetProjectPathAliases returns the old paths of a renamed project, the newest
+// first
+func (h *ActionHandler) GetProjectPathAliases(ctx context.Context, projectRef string) ([]*types.PathAlias, error) {
+	// check that the user can see the project
+	p, err := h.GetProject(ctx, projectRef)
+	if err != nil {
+		return nil, err
+	}
+
+	pas, resp, err := h.configstoreClient.GetProjectPathAliases(ctx, p.ID)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project %q path aliases: %w", projectRef, ErrFromRemote(resp, err))
+	}
+
+	return pas, nil
+}
+
+// GetProjectGroupPathAliases returns the old paths of a renamed project group,
+// the newest first
+func (h *ActionHandler) GetProjectGroupPathAliases(ctx context.Context, projectGroupRef string) ([]*types.PathAlias, error) {
+	pg, resp, err := h.configstoreClient.GetProjectGroup(ctx, projectGroupRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project group %q: %w", projectGroupRef, ErrFromRemote(resp, err))
+	}
+
+	isProjectMember, err := h.IsProjectMember(ctx, pg.OwnerType, pg.OwnerID)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if pg.GlobalVisibility != types.VisibilityPublic && !isProjectMember {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	pas, resp, err := h.configstoreClient.GetProjectGroupPathAliases(ctx, pg.ID)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project group %q path aliases: %w", projectGroupRef, ErrFromRemote(resp, err))
+	}
+
+	return pas, nil
+}
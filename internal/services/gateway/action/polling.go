@@ -0,0 +1,199 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	gitsource "agola.io/agola/internal/gitsources"
+	"agola.io/agola/internal/services/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+const minPollingInterval = 1 * time.Minute
+
+func validatePollingInterval(interval time.Duration) error {
+	if interval < 0 {
+		return errors.Errorf("negative polling interval")
+	}
+	if interval != 0 && interval < minPollingInterval {
+		return errors.Errorf("polling interval must be at least %s", minPollingInterval)
+	}
+	return nil
+}
+
+// PollProjects polls the remote repositories of the projects with the polling
+// enabled whose polling interval has elapsed since their last poll saved in
+// lastPolls.
+func (h *ActionHandler) PollProjects(ctx context.Context, lastPolls map[string]time.Time) error {
+	projects, resp, err := h.configstoreClient.GetProjects(ctx, true, false)
+	if err != nil {
+		return errors.Errorf("failed to get projects: %w", ErrFromRemote(resp, err))
+	}
+
+	now := time.Now()
+	projectIDs := map[string]struct{}{}
+	for _, p := range projects {
+		projectIDs[p.ID] = struct{}{}
+		if lastPoll, ok := lastPolls[p.ID]; ok && now.Sub(lastPoll) < p.Polling.Interval {
+			continue
+		}
+		lastPolls[p.ID] = now
+
+		if err := h.pollProject(ctx, p.Project); err != nil {
+			h.log.Errorf("failed to poll project %q: %+v", p.ID, err)
+		}
+	}
+
+	// forget the projects that don't exist anymore or have the polling disabled
+	for id := range lastPolls {
+		if _, ok := projectIDs[id]; !ok {
+			delete(lastPolls, id)
+		}
+	}
+
+	return nil
+}
+
+// pollProject lists the remote repository refs and creates the runs for the
+// refs that are new or point to a different commit than the last poll. The
+// first poll only records the current refs.
+func (h *ActionHandler) pollProject(ctx context.Context, project *types.Project) error {
+	user, resp, err := h.configstoreClient.GetUserByLinkedAccount(ctx, project.LinkedAccountID)
+	if err != nil {
+		return errors.Errorf("failed to get user by linked account %q: %w", project.LinkedAccountID, ErrFromRemote(resp, err))
+	}
+	la := user.LinkedAccounts[project.LinkedAccountID]
+	if la == nil {
+		return errors.Errorf("linked account %q in user %q doesn't exist", project.LinkedAccountID, user.Name)
+	}
+	rs, resp, err := h.configstoreClient.GetRemoteSource(ctx, la.RemoteSourceID)
+	if err != nil {
+		return errors.Errorf("failed to get remote source %q: %w", la.RemoteSourceID, ErrFromRemote(resp, err))
+	}
+
+	gitSource, err := h.GetGitSource(ctx, rs, user.Name, la)
+	if err != nil {
+		return errors.Errorf("failed to create gitsource client: %w", err)
+	}
+	refsSource, ok := gitSource.(gitsource.RefsSource)
+	if !ok {
+		return errors.Errorf("remote source %q doesn't support repository polling", rs.Name)
+	}
+
+	remoteRefs, err := refsSource.ListRefs(project.RepositoryPath)
+	if err != nil {
+		return errors.Errorf("failed to list repository refs: %w", err)
+	}
+
+	lastRefs := project.Polling.Refs
+	refs := make(map[string]string, len(remoteRefs))
+	changedRefs := []*gitsource.RepoRef{}
+	for _, ref := range remoteRefs {
+		refs[ref.Ref] = ref.CommitSHA
+		if lastRefs != nil && lastRefs[ref.Ref] != ref.CommitSHA {
+			changedRefs = append(changedRefs, ref)
+		}
+	}
+
+	// save the refs before creating the runs to avoid creating them again
+	// at the next poll
+	p, resp, err := h.configstoreClient.GetProject(ctx, project.ID)
+	if err != nil {
+		return errors.Errorf("failed to get project %q: %w", project.ID, ErrFromRemote(resp, err))
+	}
+	if p.Polling == nil {
+		// polling disabled in the meantime
+		return nil
+	}
+	p.Polling.Refs = refs
+	if _, resp, err := h.configstoreClient.UpdateProject(ctx, p.ID, p.Project); err != nil {
+		return errors.Errorf("failed to update project %q: %w", p.ID, ErrFromRemote(resp, err))
+	}
+
+	if len(changedRefs) == 0 {
+		return nil
+	}
+
+	repoInfo, err := gitSource.GetRepoInfo(p.RepositoryPath)
+	if err != nil {
+		return errors.Errorf("failed to get repository info from gitsource: %w", err)
+	}
+
+	// use remotesource skipSSHHostKeyCheck config and override with project config if set to true there
+	skipSSHHostKeyCheck := rs.SkipSSHHostKeyCheck
+	if p.SkipSSHHostKeyCheck {
+		skipSSHHostKeyCheck = p.SkipSSHHostKeyCheck
+	}
+
+	for _, ref := range changedRefs {
+		req := &CreateRunRequest{
+			RunType:            types.RunTypeProject,
+			RunCreationTrigger: types.RunCreationTriggerTypePolling,
+
+			Project:             p.Project,
+			RepoPath:            p.RepositoryPath,
+			GitSource:           gitSource,
+			CommitSHA:           ref.CommitSHA,
+			Ref:                 ref.Ref,
+			SSHPrivKey:          p.SSHPrivateKey,
+			SSHHostKey:          rs.SSHHostKey,
+			SkipSSHHostKeyCheck: skipSSHHostKeyCheck,
+			CloneURL:            repoInfo.SSHCloneURL,
+
+			CommitLink: gitSource.CommitLink(repoInfo, ref.CommitSHA),
+		}
+
+		switch ref.Type {
+		case gitsource.RefTypeBranch:
+			commit, err := gitSource.GetCommit(p.RepositoryPath, ref.CommitSHA)
+			if err != nil {
+				h.log.Errorf("failed to get commit information from git source for commit sha %q: %+v", ref.CommitSHA, err)
+				continue
+			}
+			req.RefType = types.RunRefTypeBranch
+			req.Branch = ref.Name
+			req.Message = commit.Message
+			req.BranchLink = gitSource.BranchLink(repoInfo, ref.Name)
+		case gitsource.RefTypeTag:
+			req.RefType = types.RunRefTypeTag
+			req.Tag = ref.Name
+			req.Message = fmt.Sprintf("Tag %s", ref.Name)
+			req.TagLink = gitSource.TagLink(repoInfo, ref.Name)
+		case gitsource.RefTypePullRequest:
+			req.RefType = types.RunRefTypePullRequest
+			req.Branch = ref.PullRequestTargetBranch
+			req.PullRequestID = ref.Name
+			req.Message = ref.PullRequestTitle
+			req.PullRequestLink = gitSource.PullRequestLink(repoInfo, ref.Name)
+			req.PullRequestAttributes = &types.PullRequestAttributes{
+				Draft:        ref.PullRequestDraft,
+				Labels:       ref.PullRequestLabels,
+				TargetBranch: ref.PullRequestTargetBranch,
+			}
+		default:
+			continue
+		}
+
+		if err := h.CreateRuns(ctx, req); err != nil {
+			h.log.Errorf("failed to create runs for project %q ref %q: %+v", p.ID, ref.Ref, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,235 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	slog "agola.io/agola/internal/log"
+	csapi "agola.io/agola/internal/services/configstore/api"
+	rsapi "agola.io/agola/internal/services/runservice/api"
+	"agola.io/agola/internal/services/types"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// testPolling records the projects refs saved and the runs created by the
+// projects polling
+type testPolling struct {
+	mu        sync.Mutex
+	savedRefs map[string]map[string]string
+	runs      []string
+}
+
+func (p *testPolling) getRuns() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sort.Strings(p.runs)
+	return p.runs
+}
+
+// newTestPollingActionHandler returns an action handler using a fake gitea
+// whose owner/repo repository has the master (sha01) and dev (sha03) branches
+// and the v1 (sha02) and v2 (sha04) tags, a fake configstore with the provided
+// polled projects of the owner/repo repository and a fake runservice. The
+// repository config is invalid so every run is created as a setup error run.
+func newTestPollingActionHandler(t *testing.T, projects []*types.Project) (*ActionHandler, *testPolling, func()) {
+	tp := &testPolling{savedRefs: map[string]map[string]string{}}
+	writeJSON := func(w http.ResponseWriter, v interface{}) {
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+	}
+
+	giteaRouter := mux.NewRouter()
+	giteaRouter.HandleFunc("/api/v1/repos/owner/repo", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"id":       1,
+			"name":     "repo",
+			"owner":    map[string]interface{}{"id": 1, "login": "owner"},
+			"ssh_url":  "git@gitea.example.com:owner/repo.git",
+			"html_url": "https://gitea.example.com/owner/repo",
+		})
+	})
+	giteaRouter.HandleFunc("/api/v1/repos/owner/repo/branches", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, []map[string]interface{}{
+			{"name": "master", "commit": map[string]interface{}{"id": "sha01"}},
+			{"name": "dev", "commit": map[string]interface{}{"id": "sha03"}},
+		})
+	})
+	giteaRouter.HandleFunc("/api/v1/repos/owner/repo/tags", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, []map[string]interface{}{
+			{"name": "v1", "commit": map[string]interface{}{"sha": "sha02"}},
+			{"name": "v2", "commit": map[string]interface{}{"sha": "sha04"}},
+		})
+	})
+	giteaRouter.HandleFunc("/api/v1/repos/owner/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, []interface{}{})
+	})
+	giteaRouter.HandleFunc("/api/v1/repos/owner/repo/git/commits/{sha}", func(w http.ResponseWriter, r *http.Request) {
+		sha := mux.Vars(r)["sha"]
+		writeJSON(w, map[string]interface{}{"sha": sha, "commit": map[string]interface{}{"message": "commit " + sha}})
+	})
+	giteaRouter.HandleFunc("/api/v1/repos/owner/repo/raw/{sha}/.agola/config.jsonnet", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("{"))
+	})
+	gitea := httptest.NewServer(giteaRouter)
+
+	getProject := func(ref string) *types.Project {
+		for _, p := range projects {
+			if p.ID == ref {
+				// return a copy since the polling refs are updated
+				var np *types.Project
+				pj, _ := json.Marshal(p)
+				if err := json.Unmarshal(pj, &np); err != nil {
+					t.Errorf("unexpected err: %v", err)
+				}
+				return np
+			}
+		}
+		return nil
+	}
+
+	csRouter := mux.NewRouter()
+	csRouter.HandleFunc("/api/v1alpha/projects", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["polling"]; !ok {
+			t.Errorf("expected only the polled projects request")
+		}
+		res := []*csapi.Project{}
+		for _, p := range projects {
+			res = append(res, &csapi.Project{Project: getProject(p.ID)})
+		}
+		writeJSON(w, res)
+	}).Methods("GET")
+	csRouter.HandleFunc("/api/v1alpha/projects/{projectref}", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, &csapi.Project{Project: getProject(mux.Vars(r)["projectref"])})
+	}).Methods("GET")
+	csRouter.HandleFunc("/api/v1alpha/projects/{projectref}", func(w http.ResponseWriter, r *http.Request) {
+		var p *types.Project
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+		tp.mu.Lock()
+		tp.savedRefs[p.ID] = p.Polling.Refs
+		tp.mu.Unlock()
+		writeJSON(w, &csapi.Project{Project: p})
+	}).Methods("PUT")
+	csRouter.HandleFunc("/api/v1alpha/users", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, []*types.User{
+			{ID: "user01", Name: "user01", LinkedAccounts: map[string]*types.LinkedAccount{
+				"linkedaccount01": {ID: "linkedaccount01", RemoteSourceID: "remotesource01", UserAccessToken: "token"},
+			}},
+		})
+	}).Methods("GET")
+	csRouter.HandleFunc("/api/v1alpha/remotesources/{rsref}", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, &types.RemoteSource{
+			ID:       "remotesource01",
+			Name:     "gitea",
+			Type:     types.RemoteSourceTypeGitea,
+			AuthType: types.RemoteSourceAuthTypePassword,
+			APIURL:   gitea.URL,
+		})
+	}).Methods("GET")
+	cs := httptest.NewServer(csRouter)
+
+	rsRouter := mux.NewRouter()
+	rsRouter.HandleFunc("/api/v1alpha/runs", func(w http.ResponseWriter, r *http.Request) {
+		var req *rsapi.RunCreateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+		tp.mu.Lock()
+		tp.runs = append(tp.runs, req.Group+" "+req.Annotations[AnnotationRunCreationTrigger]+" "+req.Annotations[AnnotationCommitSHA])
+		tp.mu.Unlock()
+		writeJSON(w, &rsapi.RunResponse{})
+	}).Methods("POST")
+	rs := httptest.NewServer(rsRouter)
+
+	logger := slog.New(zap.NewAtomicLevelAt(zap.FatalLevel))
+	h := NewActionHandler(logger, nil, csapi.NewClient(cs.URL), rsapi.NewClient(rs.URL), "agola", "", "", nil, nil, nil, nil, nil, nil, nil, 0)
+
+	return h, tp, func() {
+		cs.Close()
+		rs.Close()
+		gitea.Close()
+	}
+}
+
+func TestPollProjects(t *testing.T) {
+	projects := []*types.Project{
+		{
+			ID:                         "project01",
+			RemoteRepositoryConfigType: types.RemoteRepositoryConfigTypeRemoteSource,
+			LinkedAccountID:            "linkedaccount01",
+			RepositoryPath:             "owner/repo",
+			Polling: &types.ProjectPolling{
+				Interval: 1 * time.Hour,
+				Refs:     map[string]string{"refs/heads/master": "sha01", "refs/heads/dev": "sha00", "refs/tags/v1": "sha02"},
+			},
+		},
+		// the first poll only records the current refs
+		{
+			ID:                         "project02",
+			RemoteRepositoryConfigType: types.RemoteRepositoryConfigTypeRemoteSource,
+			LinkedAccountID:            "linkedaccount01",
+			RepositoryPath:             "owner/repo",
+			Polling:                    &types.ProjectPolling{Interval: 1 * time.Hour},
+		},
+	}
+
+	h, tp, stop := newTestPollingActionHandler(t, projects)
+	defer stop()
+
+	lastPolls := map[string]time.Time{"project03": time.Now()}
+	if err := h.PollProjects(context.Background(), lastPolls); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	refs := map[string]string{"refs/heads/master": "sha01", "refs/heads/dev": "sha03", "refs/tags/v1": "sha02", "refs/tags/v2": "sha04"}
+	expectedSavedRefs := map[string]map[string]string{"project01": refs, "project02": refs}
+	if diff := cmp.Diff(expectedSavedRefs, tp.savedRefs); diff != "" {
+		t.Error(diff)
+	}
+	// runs are created only for the changed and new refs
+	expectedRuns := []string{
+		"/project/project01/branch/dev polling sha03",
+		"/project/project01/tag/v2 polling sha04",
+	}
+	if diff := cmp.Diff(expectedRuns, tp.getRuns()); diff != "" {
+		t.Error(diff)
+	}
+	// the removed project03 is forgotten
+	if _, ok := lastPolls["project03"]; ok {
+		t.Errorf("expected project03 last poll removed")
+	}
+
+	// the projects aren't polled again before their polling interval
+	tp.savedRefs = map[string]map[string]string{}
+	if err := h.PollProjects(context.Background(), lastPolls); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(tp.savedRefs) != 0 {
+		t.Errorf("expected no polled projects, got %v", tp.savedRefs)
+	}
+}
@@ -20,8 +20,10 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"time"
 
 	gitsource "agola.io/agola/internal/gitsources"
+	"agola.io/agola/internal/services/common"
 	csapi "agola.io/agola/internal/services/configstore/api"
 	"agola.io/agola/internal/services/types"
 	"agola.io/agola/internal/util"
@@ -56,6 +58,28 @@ type CreateProjectRequest struct {
 	RemoteSourceName    string
 	RepoPath            string
 	SkipSSHHostKeyCheck bool
+	// PollingInterval, when not zero, enables the remote repository polling
+	PollingInterval time.Duration
+	// Schedules are the cron schedules creating the project branch runs
+	Schedules []*types.ProjectSchedule
+	// ConfigDirs are the monorepo config directories patterns
+	ConfigDirs []string
+	// ConfigPath is the config file path override
+	ConfigPath string
+	// ConfigRepo, when not nil, is the repository providing the run config
+	ConfigRepo *types.ProjectConfigRepo
+	// RemoteTasksRepos are the additional repositories whose remote tasks
+	// can be used
+	RemoteTasksRepos []string
+	// TaskCommitStatuses reports a commit status per run task
+	TaskCommitStatuses bool
+	// EmailNotifications, when not nil, enables the runs email notifications
+	EmailNotifications *types.ProjectEmailNotifications
+	// NotificationChannels are the chat channels notified of the finished runs
+	NotificationChannels []*types.ProjectNotificationChannel
+	// NotificationRules define additional notifications to the notification
+	// channels
+	NotificationRules []*types.NotificationRule
 }
 
 func (h *ActionHandler) CreateProject(ctx context.Context, req *CreateProjectRequest) (*csapi.Project, error) {
@@ -93,6 +117,32 @@ func (h *ActionHandler) CreateProject(ctx context.Context, req *CreateProjectReq
 	if req.RepoPath == "" {
 		return nil, util.NewErrBadRequest(errors.Errorf("empty remote repo path"))
 	}
+	if err := validatePollingInterval(req.PollingInterval); err != nil {
+		return nil, util.NewErrBadRequest(err)
+	}
+	if err := validateSchedules(req.Schedules); err != nil {
+		return nil, util.NewErrBadRequest(err)
+	}
+	if err := validateConfigDirs(req.ConfigDirs); err != nil {
+		return nil, util.NewErrBadRequest(err)
+	}
+	if err := validateConfigPath(req.ConfigPath); err != nil {
+		return nil, util.NewErrBadRequest(err)
+	}
+	if err := validateRemoteTasksRepos(req.RemoteTasksRepos); err != nil {
+		return nil, util.NewErrBadRequest(err)
+	}
+	if req.EmailNotifications != nil {
+		if err := validateProjectEmailNotifications(req.EmailNotifications); err != nil {
+			return nil, util.NewErrBadRequest(err)
+		}
+	}
+	if err := validateNotificationChannels(req.NotificationChannels); err != nil {
+		return nil, util.NewErrBadRequest(err)
+	}
+	if err := common.ValidateNotificationRules(req.NotificationRules, req.NotificationChannels); err != nil {
+		return nil, util.NewErrBadRequest(err)
+	}
 
 	projectPath := path.Join(pg.Path, req.Name)
 	_, resp, err = h.configstoreClient.GetProject(ctx, projectPath)
@@ -128,6 +178,11 @@ func (h *ActionHandler) CreateProject(ctx context.Context, req *CreateProjectReq
 	if err != nil {
 		return nil, errors.Errorf("failed to get repository info from gitsource: %w", err)
 	}
+	if req.ConfigRepo != nil {
+		if err := checkConfigRepo(gitSource, req.ConfigRepo); err != nil {
+			return nil, err
+		}
+	}
 
 	h.log.Infof("generating ssh key pairs")
 	privateKey, _, err := util.GenSSHKeyPair(4096)
@@ -149,7 +204,29 @@ func (h *ActionHandler) CreateProject(ctx context.Context, req *CreateProjectReq
 		RepositoryPath:             req.RepoPath,
 		SkipSSHHostKeyCheck:        req.SkipSSHHostKeyCheck,
 		SSHPrivateKey:              string(privateKey),
+		Schedules:                  req.Schedules,
+		ConfigDirs:                 req.ConfigDirs,
+		ConfigPath:                 req.ConfigPath,
+		ConfigRepo:                 req.ConfigRepo,
+		RemoteTasksRepos:           req.RemoteTasksRepos,
+		TaskCommitStatuses:         req.TaskCommitStatuses,
+		EmailNotifications:         req.EmailNotifications,
+		NotificationChannels:       req.NotificationChannels,
+		NotificationRules:          req.NotificationRules,
+	}
+	if req.PollingInterval != 0 {
+		p.Polling = &types.ProjectPolling{Interval: req.PollingInterval}
+	}
+
+	// apply the settings inherited from the parent project groups
+	is, err := h.getInheritedSettings(ctx, pg.ID)
+	if err != nil {
+		return nil, err
 	}
+	if p.Visibility == "" {
+		p.Visibility = is.DefaultVisibility
+	}
+	p.RunDefaults = is.RunDefaults
 
 	h.log.Infof("creating project")
 	rp, resp, err := h.configstoreClient.CreateProject(ctx, p)
@@ -157,6 +234,7 @@ func (h *ActionHandler) CreateProject(ctx context.Context, req *CreateProjectReq
 		return nil, errors.Errorf("failed to create project: %w", ErrFromRemote(resp, err))
 	}
 	h.log.Infof("project %s created, ID: %s", rp.Name, rp.ID)
+	h.refCache.purge()
 
 	if serr := h.setupGitSourceRepo(ctx, rs, user, la, rp); serr != nil {
 		var err error
@@ -175,12 +253,51 @@ func (h *ActionHandler) CreateProject(ctx context.Context, req *CreateProjectReq
 		return nil, errors.Errorf("failed to setup git source repo: %w", serr)
 	}
 
+	h.recordProjectChange(ctx, rp.ID, &types.ProjectChange{
+		Action:     types.ProjectChangeActionCreate,
+		ObjectType: types.ConfigTypeProject,
+		ObjectID:   rp.ID,
+		ObjectName: rp.Name,
+	}, rp.Project)
+
 	return rp, nil
 }
 
 type UpdateProjectRequest struct {
 	Name       string
 	Visibility types.Visibility
+	// CoverageBaseBranch is updated only when not nil
+	CoverageBaseBranch *string
+	// CloneURL is updated only when not nil
+	CloneURL *string
+	// AnonymousAccess is updated only when not nil
+	AnonymousAccess *types.AnonymousAccess
+	// PollingInterval is updated only when not nil. Zero disables the
+	// remote repository polling
+	PollingInterval *time.Duration
+	// Schedules are updated only when not nil. Empty schedules disable the
+	// scheduled runs
+	Schedules *[]*types.ProjectSchedule
+	// ConfigDirs are updated only when not nil. Empty config dirs disable the
+	// monorepo configs
+	ConfigDirs *[]string
+	// ConfigPath is updated only when not nil. An empty config path restores
+	// the default config dir
+	ConfigPath *string
+	// ConfigRepo is updated only when not nil. An empty config repo restores
+	// the project repository config
+	ConfigRepo *types.ProjectConfigRepo
+	// RemoteTasksRepos are updated only when not nil
+	RemoteTasksRepos *[]string
+	// TaskCommitStatuses is updated only when not nil
+	TaskCommitStatuses *bool
+	// EmailNotifications are updated only when not nil. Empty email
+	// notifications disable them
+	EmailNotifications *types.ProjectEmailNotifications
+	// NotificationChannels are updated only when not nil
+	NotificationChannels *[]*types.ProjectNotificationChannel
+	// NotificationRules are updated only when not nil
+	NotificationRules *[]*types.NotificationRule
 }
 
 func (h *ActionHandler) UpdateProject(ctx context.Context, projectRef string, req *UpdateProjectRequest) (*csapi.Project, error) {
@@ -199,6 +316,102 @@ func (h *ActionHandler) UpdateProject(ctx context.Context, projectRef string, re
 
 	p.Name = req.Name
 	p.Visibility = req.Visibility
+	if req.CoverageBaseBranch != nil {
+		p.CoverageBaseBranch = *req.CoverageBaseBranch
+	}
+	if req.CloneURL != nil {
+		if err := validateCloneURL(*req.CloneURL); err != nil {
+			return nil, err
+		}
+		p.CloneURL = *req.CloneURL
+	}
+	if req.AnonymousAccess != nil {
+		p.AnonymousAccess = req.AnonymousAccess
+		if *req.AnonymousAccess == (types.AnonymousAccess{}) {
+			p.AnonymousAccess = nil
+		}
+	}
+	if req.PollingInterval != nil {
+		if err := validatePollingInterval(*req.PollingInterval); err != nil {
+			return nil, util.NewErrBadRequest(err)
+		}
+		switch {
+		case *req.PollingInterval == 0:
+			p.Polling = nil
+		case p.Polling == nil:
+			p.Polling = &types.ProjectPolling{Interval: *req.PollingInterval}
+		default:
+			p.Polling.Interval = *req.PollingInterval
+		}
+	}
+	if req.Schedules != nil {
+		if err := validateSchedules(*req.Schedules); err != nil {
+			return nil, util.NewErrBadRequest(err)
+		}
+		p.Schedules = *req.Schedules
+	}
+	if req.ConfigDirs != nil {
+		if err := validateConfigDirs(*req.ConfigDirs); err != nil {
+			return nil, util.NewErrBadRequest(err)
+		}
+		p.ConfigDirs = *req.ConfigDirs
+	}
+	if req.ConfigPath != nil {
+		if err := validateConfigPath(*req.ConfigPath); err != nil {
+			return nil, util.NewErrBadRequest(err)
+		}
+		p.ConfigPath = *req.ConfigPath
+	}
+	if req.RemoteTasksRepos != nil {
+		if err := validateRemoteTasksRepos(*req.RemoteTasksRepos); err != nil {
+			return nil, util.NewErrBadRequest(err)
+		}
+		p.RemoteTasksRepos = *req.RemoteTasksRepos
+	}
+	if req.TaskCommitStatuses != nil {
+		p.TaskCommitStatuses = *req.TaskCommitStatuses
+	}
+	if req.EmailNotifications != nil {
+		p.EmailNotifications = req.EmailNotifications
+		if len(req.EmailNotifications.Recipients) == 0 && req.EmailNotifications.Mode == "" {
+			p.EmailNotifications = nil
+		} else if err := validateProjectEmailNotifications(req.EmailNotifications); err != nil {
+			return nil, util.NewErrBadRequest(err)
+		}
+	}
+	if req.NotificationChannels != nil {
+		if err := validateNotificationChannels(*req.NotificationChannels); err != nil {
+			return nil, util.NewErrBadRequest(err)
+		}
+		p.NotificationChannels = *req.NotificationChannels
+	}
+	if req.NotificationRules != nil {
+		p.NotificationRules = *req.NotificationRules
+	}
+	if req.NotificationChannels != nil || req.NotificationRules != nil {
+		// the rules must target the updated channels
+		if err := common.ValidateNotificationRules(p.NotificationRules, p.NotificationChannels); err != nil {
+			return nil, util.NewErrBadRequest(err)
+		}
+	}
+	if req.ConfigRepo != nil {
+		p.ConfigRepo = req.ConfigRepo
+		if *req.ConfigRepo == (types.ProjectConfigRepo{}) {
+			p.ConfigRepo = nil
+		} else {
+			user, rs, la, err := h.getRemoteRepoAccessData(ctx, p.LinkedAccountID)
+			if err != nil {
+				return nil, errors.Errorf("failed to get remote repo access data: %w", err)
+			}
+			gitSource, err := h.GetGitSource(ctx, rs, user.Name, la)
+			if err != nil {
+				return nil, errors.Errorf("failed to create gitsource client: %w", err)
+			}
+			if err := checkConfigRepo(gitSource, req.ConfigRepo); err != nil {
+				return nil, err
+			}
+		}
+	}
 
 	h.log.Infof("updating project")
 	rp, resp, err := h.configstoreClient.UpdateProject(ctx, p.ID, p.Project)
@@ -206,6 +419,14 @@ func (h *ActionHandler) UpdateProject(ctx context.Context, projectRef string, re
 		return nil, errors.Errorf("failed to update project: %w", ErrFromRemote(resp, err))
 	}
 	h.log.Infof("project %s updated, ID: %s", p.Name, p.ID)
+	h.refCache.purge()
+
+	h.recordProjectChange(ctx, rp.ID, &types.ProjectChange{
+		Action:     types.ProjectChangeActionUpdate,
+		ObjectType: types.ConfigTypeProject,
+		ObjectID:   rp.ID,
+		ObjectName: rp.Name,
+	}, rp.Project)
 
 	return rp, nil
 }
@@ -266,6 +487,13 @@ func (h *ActionHandler) ProjectUpdateRepoLinkedAccount(ctx context.Context, proj
 	}
 	h.log.Infof("project %s updated, ID: %s", p.Name, p.ID)
 
+	h.recordProjectChange(ctx, rp.ID, &types.ProjectChange{
+		Action:     types.ProjectChangeActionUpdate,
+		ObjectType: types.ConfigTypeProject,
+		ObjectID:   rp.ID,
+		ObjectName: rp.Name,
+	}, rp.Project)
+
 	return rp, nil
 }
 
@@ -398,6 +626,7 @@ func (h *ActionHandler) DeleteProject(ctx context.Context, projectRef string) er
 	if err != nil {
 		return ErrFromRemote(resp, err)
 	}
+	h.refCache.purge()
 
 	// try to cleanup gitsource configs
 	// we'll log but ignore errors
@@ -411,30 +640,52 @@ func (h *ActionHandler) DeleteProject(ctx context.Context, projectRef string) er
 	return nil
 }
 
-func (h *ActionHandler) ProjectCreateRun(ctx context.Context, projectRef, branch, tag, refName, commitSHA string) error {
+func (h *ActionHandler) ProjectCreateRun(ctx context.Context, projectRef, branch, tag, refName, commitSHA string, annotations map[string]string) error {
+	for k, v := range annotations {
+		if k != AnnotationCloneURL {
+			return util.NewErrBadRequest(errors.Errorf("annotation %q cannot be provided", k))
+		}
+		if err := validateCloneURL(v); err != nil {
+			return err
+		}
+	}
+
+	req, err := h.genProjectCreateRunRequest(ctx, projectRef, branch, tag, refName, commitSHA)
+	if err != nil {
+		return err
+	}
+	req.Annotations = annotations
+
+	return h.CreateRuns(ctx, req)
+}
+
+// genProjectCreateRunRequest generates the request to manually create a
+// project run for the provided branch, tag or ref. Only the project owners can
+// create manual runs.
+func (h *ActionHandler) genProjectCreateRunRequest(ctx context.Context, projectRef, branch, tag, refName, commitSHA string) (*CreateRunRequest, error) {
 	curUserID := h.CurrentUserID(ctx)
 
 	user, resp, err := h.configstoreClient.GetUser(ctx, curUserID)
 	if err != nil {
-		return errors.Errorf("failed to get user %q: %w", curUserID, ErrFromRemote(resp, err))
+		return nil, errors.Errorf("failed to get user %q: %w", curUserID, ErrFromRemote(resp, err))
 	}
 
 	p, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
 	if err != nil {
-		return errors.Errorf("failed to get project %q: %w", projectRef, ErrFromRemote(resp, err))
+		return nil, errors.Errorf("failed to get project %q: %w", projectRef, ErrFromRemote(resp, err))
 	}
 
 	isProjectOwner, err := h.IsProjectOwner(ctx, p.OwnerType, p.OwnerID)
 	if err != nil {
-		return errors.Errorf("failed to determine ownership: %w", err)
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
 	}
 	if !isProjectOwner {
-		return util.NewErrForbidden(errors.Errorf("user not authorized"))
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
 	}
 
 	rs, resp, err := h.configstoreClient.GetRemoteSource(ctx, p.RemoteSourceID)
 	if err != nil {
-		return errors.Errorf("failed to get remote source %q: %w", p.RemoteSourceID, ErrFromRemote(resp, err))
+		return nil, errors.Errorf("failed to get remote source %q: %w", p.RemoteSourceID, ErrFromRemote(resp, err))
 	}
 	var la *types.LinkedAccount
 	for _, v := range user.LinkedAccounts {
@@ -444,18 +695,18 @@ func (h *ActionHandler) ProjectCreateRun(ctx context.Context, projectRef, branch
 		}
 	}
 	if la == nil {
-		return util.NewErrBadRequest(errors.Errorf("user doesn't have a linked account for remote source %q", rs.Name))
+		return nil, util.NewErrBadRequest(errors.Errorf("user doesn't have a linked account for remote source %q", rs.Name))
 	}
 
 	gitSource, err := h.GetGitSource(ctx, rs, user.Name, la)
 	if err != nil {
-		return errors.Errorf("failed to create gitsource client: %w", err)
+		return nil, errors.Errorf("failed to create gitsource client: %w", err)
 	}
 
 	// check user has access to the repository
 	repoInfo, err := gitSource.GetRepoInfo(p.RepositoryPath)
 	if err != nil {
-		return errors.Errorf("failed to get repository info from gitsource: %w", err)
+		return nil, errors.Errorf("failed to get repository info from gitsource: %w", err)
 	}
 
 	set := 0
@@ -469,10 +720,10 @@ func (h *ActionHandler) ProjectCreateRun(ctx context.Context, projectRef, branch
 		set++
 	}
 	if set == 0 {
-		return util.NewErrBadRequest(errors.Errorf("one of branch, tag or ref is required"))
+		return nil, util.NewErrBadRequest(errors.Errorf("one of branch, tag or ref is required"))
 	}
 	if set > 1 {
-		return util.NewErrBadRequest(errors.Errorf("only one of branch, tag or ref can be provided"))
+		return nil, util.NewErrBadRequest(errors.Errorf("only one of branch, tag or ref can be provided"))
 	}
 
 	var refType types.RunRefType
@@ -491,11 +742,11 @@ func (h *ActionHandler) ProjectCreateRun(ctx context.Context, projectRef, branch
 
 	gitRefType, name, err := gitSource.RefType(refName)
 	if err != nil {
-		return util.NewErrBadRequest(errors.Errorf("failed to get refType for ref %q: %w", refName, err))
+		return nil, util.NewErrBadRequest(errors.Errorf("failed to get refType for ref %q: %w", refName, err))
 	}
 	ref, err := gitSource.GetRef(p.RepositoryPath, refName)
 	if err != nil {
-		return errors.Errorf("failed to get ref information from git source for ref %q: %w", refName, err)
+		return nil, errors.Errorf("failed to get ref information from git source for ref %q: %w", refName, err)
 	}
 	refCommitSHA = ref.CommitSHA
 	switch gitRefType {
@@ -505,7 +756,7 @@ func (h *ActionHandler) ProjectCreateRun(ctx context.Context, projectRef, branch
 		tag = name
 		// TODO(sgotti) implement manual run creation on a pull request if really needed
 	default:
-		return errors.Errorf("unsupported ref %q for manual run creation", refName)
+		return nil, errors.Errorf("unsupported ref %q for manual run creation", refName)
 	}
 
 	// TODO(sgotti) check that the provided ref contains the provided commitSHA
@@ -517,7 +768,7 @@ func (h *ActionHandler) ProjectCreateRun(ctx context.Context, projectRef, branch
 
 	commit, err := gitSource.GetCommit(p.RepositoryPath, commitSHA)
 	if err != nil {
-		return errors.Errorf("failed to get commit information from git source for commit sha %q: %w", commitSHA, err)
+		return nil, errors.Errorf("failed to get commit information from git source for commit sha %q: %w", commitSHA, err)
 	}
 
 	// use the commit full sha since the user could have provided a short commit sha
@@ -568,7 +819,74 @@ func (h *ActionHandler) ProjectCreateRun(ctx context.Context, projectRef, branch
 		PullRequestLink: "",
 	}
 
-	return h.CreateRuns(ctx, req)
+	return req, nil
+}
+
+type ProjectCreateFileRequest struct {
+	Branch  string
+	Path    string
+	Message string
+	Content []byte
+}
+
+// ProjectCreateFile creates a new file in the project remote repository. It's
+// used for example to push an initial run config file.
+func (h *ActionHandler) ProjectCreateFile(ctx context.Context, projectRef string, req *ProjectCreateFileRequest) error {
+	curUserID := h.CurrentUserID(ctx)
+
+	user, resp, err := h.configstoreClient.GetUser(ctx, curUserID)
+	if err != nil {
+		return errors.Errorf("failed to get user %q: %w", curUserID, ErrFromRemote(resp, err))
+	}
+
+	p, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
+	if err != nil {
+		return errors.Errorf("failed to get project %q: %w", projectRef, ErrFromRemote(resp, err))
+	}
+
+	isProjectOwner, err := h.IsProjectOwner(ctx, p.OwnerType, p.OwnerID)
+	if err != nil {
+		return errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isProjectOwner {
+		return util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	if req.Branch == "" {
+		return util.NewErrBadRequest(errors.Errorf("empty branch"))
+	}
+	if req.Path == "" {
+		return util.NewErrBadRequest(errors.Errorf("empty file path"))
+	}
+	if req.Message == "" {
+		return util.NewErrBadRequest(errors.Errorf("empty commit message"))
+	}
+
+	rs, resp, err := h.configstoreClient.GetRemoteSource(ctx, p.RemoteSourceID)
+	if err != nil {
+		return errors.Errorf("failed to get remote source %q: %w", p.RemoteSourceID, ErrFromRemote(resp, err))
+	}
+	var la *types.LinkedAccount
+	for _, v := range user.LinkedAccounts {
+		if v.RemoteSourceID == rs.ID {
+			la = v
+			break
+		}
+	}
+	if la == nil {
+		return util.NewErrBadRequest(errors.Errorf("user doesn't have a linked account for remote source %q", rs.Name))
+	}
+
+	gitSource, err := h.GetGitSource(ctx, rs, user.Name, la)
+	if err != nil {
+		return errors.Errorf("failed to create gitsource client: %w", err)
+	}
+
+	if err := gitSource.CreateFile(p.RepositoryPath, req.Branch, req.Path, req.Message, req.Content); err != nil {
+		return errors.Errorf("failed to create file %q in repository %q: %w", req.Path, p.RepositoryPath, err)
+	}
+
+	return nil
 }
 
 func (h *ActionHandler) getRemoteRepoAccessData(ctx context.Context, linkedAccountID string) (*types.User, *types.RemoteSource, *types.LinkedAccount, error) {
@@ -589,3 +907,34 @@ func (h *ActionHandler) getRemoteRepoAccessData(ctx context.Context, linkedAccou
 
 	return user, rs, la, nil
 }
+
+// checkConfigRepo checks that the project config repository is valid and
+// accessible by the project linked account
+func checkConfigRepo(gitSource gitsource.GitSource, configRepo *types.ProjectConfigRepo) error {
+	if configRepo.RepositoryPath == "" {
+		return util.NewErrBadRequest(errors.Errorf("empty config repository path"))
+	}
+	if configRepo.Ref == "" {
+		return util.NewErrBadRequest(errors.Errorf("empty config repository ref"))
+	}
+	if _, err := gitSource.GetRepoInfo(configRepo.RepositoryPath); err != nil {
+		return util.NewErrBadRequest(errors.Errorf("failed to access config repository %q: %w", configRepo.RepositoryPath, err))
+	}
+	return nil
+}
+
+// validateNotificationChannels checks the project notification channels. The
+// channels names must be unique.
+func validateNotificationChannels(channels []*types.ProjectNotificationChannel) error {
+	names := map[string]struct{}{}
+	for _, c := range channels {
+		if err := common.ValidateNotificationChannel(c); err != nil {
+			return err
+		}
+		if _, ok := names[c.Name]; ok {
+			return errors.Errorf("duplicate notification channel name %q", c.Name)
+		}
+		names[c.Name] = struct{}{}
+	}
+	return nil
+}
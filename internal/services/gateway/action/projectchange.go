@@ -0,0 +1,185 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"encoding/json"
+
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+const redactedValue = "********"
+
+// redactProjectChangeData returns the json representation of the changed
+// object with its sensitive values redacted
+func redactProjectChangeData(obj interface{}) (json.RawMessage, error) {
+	redact := func(v string) string {
+		if v == "" {
+			return ""
+		}
+		return redactedValue
+	}
+
+	switch o := obj.(type) {
+	case *types.Project:
+		p := *o
+		p.Secret = redact(p.Secret)
+		p.SSHPrivateKey = redact(p.SSHPrivateKey)
+		p.WebhookSecret = redact(p.WebhookSecret)
+		return json.Marshal(&p)
+	case *types.Secret:
+		s := *o
+		if s.Data != nil {
+			s.Data = make(map[string]string, len(o.Data))
+			for k := range o.Data {
+				s.Data[k] = redactedValue
+			}
+		}
+		return json.Marshal(&s)
+	case *types.Variable:
+		return json.Marshal(o)
+	}
+	return nil, errors.Errorf("unsupported object type %T", obj)
+}
+
+// recordProjectChange records a change to the project settings, variables or
+// secrets. obj is the object after the change, nil for deletions.
+// Since the change has already been applied, errors are only logged.
+func (h *ActionHandler) recordProjectChange(ctx context.Context, projectRef string, pc *types.ProjectChange, obj interface{}) {
+	pc.ChangedBy = h.CurrentUserID(ctx)
+	if obj != nil {
+		data, err := redactProjectChangeData(obj)
+		if err != nil {
+			h.log.Errorf("failed to record project change: %+v", err)
+			return
+		}
+		pc.Data = data
+	}
+
+	if _, resp, err := h.configstoreClient.CreateProjectChange(ctx, projectRef, pc); err != nil {
+		h.log.Errorf("failed to record project change: %+v", ErrFromRemote(resp, err))
+	}
+}
+
+type ProjectChange struct {
+	*types.ProjectChange
+
+	// ChangedByName is the name of the user that made the change
+	ChangedByName string
+}
+
+func (h *ActionHandler) GetProjectChanges(ctx context.Context, projectRef string, limit int) ([]*ProjectChange, error) {
+	p, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project %q: %w", projectRef, ErrFromRemote(resp, err))
+	}
+
+	isProjectOwner, err := h.IsProjectOwner(ctx, p.OwnerType, p.OwnerID)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isProjectOwner {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	cspcs, resp, err := h.configstoreClient.GetProjectChanges(ctx, p.ID, limit)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project %q changes: %w", projectRef, ErrFromRemote(resp, err))
+	}
+
+	userNames := map[string]string{}
+	pcs := make([]*ProjectChange, len(cspcs))
+	for i, cspc := range cspcs {
+		pc := &ProjectChange{ProjectChange: cspc}
+		if cspc.ChangedBy != "" {
+			userName, ok := userNames[cspc.ChangedBy]
+			if !ok {
+				// the user could have been removed
+				if user, _, err := h.configstoreClient.GetUser(ctx, cspc.ChangedBy); err == nil {
+					userName = user.Name
+				}
+				userNames[cspc.ChangedBy] = userName
+			}
+			pc.ChangedByName = userName
+		}
+		pcs[i] = pc
+	}
+
+	return pcs, nil
+}
+
+// RollbackProjectSettings restores the project settings to the ones recorded
+// in the provided project change. Only the project settings are restored, the
+// remote repository configuration and the project secrets (like the ssh keys)
+// aren't changed.
+func (h *ActionHandler) RollbackProjectSettings(ctx context.Context, projectRef, projectChangeID string) (*csapi.Project, error) {
+	p, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project %q: %w", projectRef, ErrFromRemote(resp, err))
+	}
+
+	isProjectOwner, err := h.IsProjectOwner(ctx, p.OwnerType, p.OwnerID)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isProjectOwner {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	pc, resp, err := h.configstoreClient.GetProjectChange(ctx, p.ID, projectChangeID)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project change %q: %w", projectChangeID, ErrFromRemote(resp, err))
+	}
+	if pc.ObjectType != types.ConfigTypeProject {
+		return nil, util.NewErrBadRequest(errors.Errorf("project change %q isn't a project settings change", projectChangeID))
+	}
+	if len(pc.Data) == 0 {
+		return nil, util.NewErrBadRequest(errors.Errorf("project change %q doesn't contain project settings", projectChangeID))
+	}
+
+	var sp *types.Project
+	if err := json.Unmarshal(pc.Data, &sp); err != nil {
+		return nil, errors.Errorf("failed to unmarshal project change data: %w", err)
+	}
+
+	p.Name = sp.Name
+	p.Visibility = sp.Visibility
+	p.SkipSSHHostKeyCheck = sp.SkipSSHHostKeyCheck
+	p.QuarantinedTasks = sp.QuarantinedTasks
+	p.CoverageBaseBranch = sp.CoverageBaseBranch
+	p.CloneURL = sp.CloneURL
+
+	h.log.Infof("rolling back project settings to change %q", projectChangeID)
+	rp, resp, err := h.configstoreClient.UpdateProject(ctx, p.ID, p.Project)
+	if err != nil {
+		return nil, errors.Errorf("failed to update project: %w", ErrFromRemote(resp, err))
+	}
+	h.log.Infof("project %s updated, ID: %s", p.Name, p.ID)
+
+	h.recordProjectChange(ctx, rp.ID, &types.ProjectChange{
+		Action:       types.ProjectChangeActionRollback,
+		ObjectType:   types.ConfigTypeProject,
+		ObjectID:     rp.ID,
+		ObjectName:   rp.Name,
+		RollbackFrom: projectChangeID,
+	}, rp.Project)
+
+	return rp, nil
+}
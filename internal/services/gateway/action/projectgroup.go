@@ -85,13 +85,23 @@ func (h *ActionHandler) CreateProjectGroup(ctx context.Context, req *CreateProje
 		parentRef = path.Join("user", user.Name)
 	}
 
+	visibility := req.Visibility
+	if visibility == "" {
+		// use the default visibility inherited from the parent project groups
+		is, err := h.getInheritedSettings(ctx, pg.ID)
+		if err != nil {
+			return nil, err
+		}
+		visibility = is.DefaultVisibility
+	}
+
 	p := &types.ProjectGroup{
 		Name: req.Name,
 		Parent: types.Parent{
 			Type: types.ConfigTypeProjectGroup,
 			ID:   parentRef,
 		},
-		Visibility: req.Visibility,
+		Visibility: visibility,
 	}
 
 	h.log.Infof("creating projectGroup")
@@ -100,6 +110,7 @@ func (h *ActionHandler) CreateProjectGroup(ctx context.Context, req *CreateProje
 		return nil, errors.Errorf("failed to create projectGroup: %w", ErrFromRemote(resp, err))
 	}
 	h.log.Infof("projectGroup %s created, ID: %s", rp.Name, rp.ID)
+	h.refCache.purge()
 
 	return rp, nil
 }
@@ -132,6 +143,7 @@ func (h *ActionHandler) UpdateProjectGroup(ctx context.Context, projectGroupRef
 		return nil, errors.Errorf("failed to update project group: %w", ErrFromRemote(resp, err))
 	}
 	h.log.Infof("project group %q updated, ID: %s", pg.Name, pg.ID)
+	h.refCache.purge()
 
 	return rp, nil
 }
@@ -154,5 +166,7 @@ func (h *ActionHandler) DeleteProjectGroup(ctx context.Context, projectRef strin
 	if err != nil {
 		return ErrFromRemote(resp, err)
 	}
+	h.refCache.purge()
+
 	return nil
 }
@@ -0,0 +1,222 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"reflect"
+
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+// InheritedSettings are the project group settings inherited by a child. Every
+// setting comes from the nearest ancestor defining it, the From fields are
+// the paths of these project groups.
+type InheritedSettings struct {
+	DefaultVisibility     types.Visibility
+	DefaultVisibilityFrom string
+	RunDefaults           *types.ProjectRunDefaults
+	RunDefaultsFrom       string
+}
+
+// ProjectGroupSettings are the project group own settings and the settings
+// inherited from its ancestors
+type ProjectGroupSettings struct {
+	Settings  *types.ProjectGroupSettings
+	Inherited *InheritedSettings
+}
+
+// ProjectEffectiveSettings are the settings currently applied to a project and
+// the settings inherited from its project groups
+type ProjectEffectiveSettings struct {
+	Visibility       types.Visibility
+	GlobalVisibility types.Visibility
+	RunDefaults      *types.ProjectRunDefaults
+	Inherited        *InheritedSettings
+}
+
+// getInheritedSettings returns the settings inherited by the childs of the
+// provided project group, walking its parents until the root project group
+func (h *ActionHandler) getInheritedSettings(ctx context.Context, projectGroupRef string) (*InheritedSettings, error) {
+	is := &InheritedSettings{}
+	ref := projectGroupRef
+	for {
+		pg, resp, err := h.configstoreClient.GetProjectGroup(ctx, ref)
+		if err != nil {
+			return nil, errors.Errorf("failed to get project group %q: %w", ref, ErrFromRemote(resp, err))
+		}
+		if s := pg.Settings; s != nil {
+			if is.DefaultVisibility == "" && s.DefaultVisibility != "" {
+				is.DefaultVisibility = s.DefaultVisibility
+				is.DefaultVisibilityFrom = pg.Path
+			}
+			if is.RunDefaults == nil && s.RunDefaults != nil {
+				is.RunDefaults = s.RunDefaults
+				is.RunDefaultsFrom = pg.Path
+			}
+		}
+		if pg.Parent.Type != types.ConfigTypeProjectGroup {
+			break
+		}
+		ref = pg.Parent.ID
+	}
+
+	return is, nil
+}
+
+func (h *ActionHandler) GetProjectGroupSettings(ctx context.Context, projectGroupRef string) (*ProjectGroupSettings, error) {
+	pg, resp, err := h.configstoreClient.GetProjectGroup(ctx, projectGroupRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project group %q: %w", projectGroupRef, ErrFromRemote(resp, err))
+	}
+
+	isProjectMember, err := h.IsProjectMember(ctx, pg.OwnerType, pg.OwnerID)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if pg.GlobalVisibility != types.VisibilityPublic && !isProjectMember {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	is := &InheritedSettings{}
+	if pg.Parent.Type == types.ConfigTypeProjectGroup {
+		is, err = h.getInheritedSettings(ctx, pg.Parent.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &ProjectGroupSettings{Settings: pg.Settings, Inherited: is}, nil
+}
+
+// GetProjectEffectiveSettings returns the settings applied to the project and
+// the ones inherited from its project groups
+func (h *ActionHandler) GetProjectEffectiveSettings(ctx context.Context, projectRef string) (*ProjectEffectiveSettings, error) {
+	p, err := h.GetProject(ctx, projectRef)
+	if err != nil {
+		return nil, err
+	}
+
+	is, err := h.getInheritedSettings(ctx, p.Parent.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ProjectEffectiveSettings{
+		Visibility:       p.Visibility,
+		GlobalVisibility: p.GlobalVisibility,
+		RunDefaults:      p.RunDefaults,
+		Inherited:        is,
+	}, nil
+}
+
+// UpdateProjectGroupSettings sets the project group settings. A nil settings
+// removes them. The settings are applied to the childs created after the
+// update, when enforce is true they are also applied to the existing childs
+// not overriding them with their own settings. The enforce results are keyed
+// by the objects paths and a failure on an object doesn't stop the update of
+// the other objects.
+func (h *ActionHandler) UpdateProjectGroupSettings(ctx context.Context, projectGroupRef string, settings *types.ProjectGroupSettings, enforce bool) (*csapi.ProjectGroup, []*BulkOperationResult, error) {
+	pg, resp, err := h.configstoreClient.GetProjectGroup(ctx, projectGroupRef)
+	if err != nil {
+		return nil, nil, errors.Errorf("failed to get project group %q: %w", projectGroupRef, ErrFromRemote(resp, err))
+	}
+
+	isProjectOwner, err := h.IsProjectOwner(ctx, pg.OwnerType, pg.OwnerID)
+	if err != nil {
+		return nil, nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isProjectOwner {
+		return nil, nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	pg.Settings = settings
+
+	h.log.Infof("updating project group settings")
+	rpg, resp, err := h.configstoreClient.UpdateProjectGroup(ctx, pg.ID, pg.ProjectGroup)
+	if err != nil {
+		return nil, nil, errors.Errorf("failed to update project group: %w", ErrFromRemote(resp, err))
+	}
+	h.log.Infof("project group %q settings updated, ID: %s", pg.Name, pg.ID)
+
+	results := []*BulkOperationResult{}
+	if enforce && settings != nil {
+		if err := h.enforceProjectGroupSettings(ctx, pg.ID, settings.DefaultVisibility, settings.RunDefaults, &results); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return rpg, results, nil
+}
+
+// enforceProjectGroupSettings applies the provided visibility and run defaults
+// to the project group childs. An empty visibility or nil run defaults aren't
+// applied. The subgroups defining their own settings stop the propagation of
+// the overridden ones.
+func (h *ActionHandler) enforceProjectGroupSettings(ctx context.Context, projectGroupID string, visibility types.Visibility, runDefaults *types.ProjectRunDefaults, results *[]*BulkOperationResult) error {
+	projects, err := h.GetProjectGroupProjects(ctx, projectGroupID)
+	if err != nil {
+		return errors.Errorf("failed to get project group %q projects: %w", projectGroupID, err)
+	}
+	for _, p := range projects {
+		updateVisibility := visibility != "" && p.Visibility != visibility
+		updateRunDefaults := runDefaults != nil && !reflect.DeepEqual(p.RunDefaults, runDefaults)
+		if !updateVisibility && !updateRunDefaults {
+			continue
+		}
+		var err error
+		if updateVisibility {
+			_, err = h.UpdateProject(ctx, p.ID, &UpdateProjectRequest{Name: p.Name, Visibility: visibility})
+		}
+		if err == nil && updateRunDefaults {
+			_, err = h.UpdateProjectRunDefaults(ctx, p.ID, runDefaults)
+		}
+		*results = append(*results, &BulkOperationResult{Ref: p.Path, Err: err})
+	}
+
+	subgroups, err := h.GetProjectGroupSubgroups(ctx, projectGroupID)
+	if err != nil {
+		return errors.Errorf("failed to get project group %q subgroups: %w", projectGroupID, err)
+	}
+	for _, sg := range subgroups {
+		if visibility != "" && sg.Visibility != visibility {
+			_, err := h.UpdateProjectGroup(ctx, sg.ID, &UpdateProjectGroupRequest{Name: sg.Name, Visibility: visibility})
+			*results = append(*results, &BulkOperationResult{Ref: sg.Path, Err: err})
+		}
+
+		sgVisibility := visibility
+		sgRunDefaults := runDefaults
+		if s := sg.Settings; s != nil {
+			if s.DefaultVisibility != "" {
+				sgVisibility = ""
+			}
+			if s.RunDefaults != nil {
+				sgRunDefaults = nil
+			}
+		}
+		if sgVisibility == "" && sgRunDefaults == nil {
+			continue
+		}
+		if err := h.enforceProjectGroupSettings(ctx, sg.ID, sgVisibility, sgRunDefaults, results); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
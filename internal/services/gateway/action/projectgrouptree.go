@@ -0,0 +1,156 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"path"
+	"sort"
+
+	"agola.io/agola/internal/services/common"
+	csapi "agola.io/agola/internal/services/configstore/api"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	DefaultProjectGroupTreeLimit = 25
+	MaxProjectGroupTreeLimit     = 100
+)
+
+// ProjectGroupTreeItem is a project group or a project of a project group
+// subtree
+type ProjectGroupTreeItem struct {
+	ProjectGroup *csapi.ProjectGroup
+	Project      *csapi.Project
+	// Depth is the item depth relative to the subtree root project group
+	Depth int
+	// LastRun is the latest run of a project. It's nil if the project has no
+	// runs or the user cannot get them
+	LastRun *rstypes.Run
+}
+
+func (i *ProjectGroupTreeItem) Path() string {
+	if i.Project != nil {
+		return i.Project.Path
+	}
+	return i.ProjectGroup.Path
+}
+
+// GetProjectGroupTree returns the subgroups and projects of the project group
+// subtree ordered by path. The items are paginated by path: only the items
+// with a path greater than start are returned. The last run is fetched only
+// for the returned projects.
+func (h *ActionHandler) GetProjectGroupTree(ctx context.Context, projectGroupRef, start string, limit int) ([]*ProjectGroupTreeItem, error) {
+	if limit <= 0 {
+		limit = DefaultProjectGroupTreeLimit
+	}
+	if limit > MaxProjectGroupTreeLimit {
+		limit = MaxProjectGroupTreeLimit
+	}
+
+	pg, err := h.GetProjectGroup(ctx, projectGroupRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project group %q: %w", projectGroupRef, err)
+	}
+
+	// all the subtree items have the same owner
+	isProjectMember, err := h.IsProjectMember(ctx, pg.OwnerType, pg.OwnerID)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isProjectMember && pg.GlobalVisibility != types.VisibilityPublic {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	items := []*ProjectGroupTreeItem{}
+	if err := h.walkProjectGroupTree(ctx, pg.ID, 1, isProjectMember, &items); err != nil {
+		return nil, err
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Path() < items[j].Path() })
+
+	page := []*ProjectGroupTreeItem{}
+	for _, item := range items {
+		if len(page) >= limit {
+			break
+		}
+		if start != "" && item.Path() <= start {
+			continue
+		}
+		page = append(page, item)
+	}
+
+	for _, item := range page {
+		if item.Project == nil {
+			continue
+		}
+		group := path.Join("/", string(common.GroupTypeProject), item.Project.ID)
+		canGetRun, err := h.CanGetRun(ctx, group)
+		if err != nil {
+			return nil, errors.Errorf("failed to determine permissions: %w", err)
+		}
+		if !canGetRun {
+			continue
+		}
+		runsResp, resp, err := h.runserviceClient.GetGroupLastRun(ctx, group, nil)
+		if err != nil {
+			return nil, errors.Errorf("failed to get project %q last run: %w", item.Project.Path, ErrFromRemote(resp, err))
+		}
+		if len(runsResp.Runs) > 0 {
+			item.LastRun = runsResp.Runs[0]
+		}
+	}
+
+	return page, nil
+}
+
+// walkProjectGroupTree adds to items the subgroups and projects of the project
+// group visible to the user
+func (h *ActionHandler) walkProjectGroupTree(ctx context.Context, projectGroupID string, depth int, isProjectMember bool, items *[]*ProjectGroupTreeItem) error {
+	visible := func(v types.Visibility) bool {
+		return isProjectMember || v == types.VisibilityPublic
+	}
+
+	projects, err := h.GetProjectGroupProjects(ctx, projectGroupID)
+	if err != nil {
+		return errors.Errorf("failed to get project group %q projects: %w", projectGroupID, err)
+	}
+	for _, p := range projects {
+		if !visible(p.GlobalVisibility) {
+			continue
+		}
+		*items = append(*items, &ProjectGroupTreeItem{Project: p, Depth: depth})
+	}
+
+	subgroups, err := h.GetProjectGroupSubgroups(ctx, projectGroupID)
+	if err != nil {
+		return errors.Errorf("failed to get project group %q subgroups: %w", projectGroupID, err)
+	}
+	for _, sg := range subgroups {
+		// the childs of a not visible project group aren't visible
+		if !visible(sg.GlobalVisibility) {
+			continue
+		}
+		*items = append(*items, &ProjectGroupTreeItem{ProjectGroup: sg, Depth: depth})
+		if err := h.walkProjectGroupTree(ctx, sg.ID, depth+1, isProjectMember, items); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
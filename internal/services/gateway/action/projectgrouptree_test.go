@@ -0,0 +1,142 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"agola.io/agola/internal/util"
+
+	"github.com/google/go-cmp/cmp"
+	errors "golang.org/x/xerrors"
+)
+
+func TestGetProjectGroupTree(t *testing.T) {
+	h, _, stop := newTestProjectGroupsActionHandler(t)
+	defer stop()
+
+	allItems := []string{
+		"org/org01/pg01 1",
+		"org/org01/pg01/pg02 2",
+		"org/org01/pg01/pg02/project04 3",
+		"org/org01/pg01/project03 2 run03",
+		"org/org01/project01 1 run01",
+		"org/org01/project05 1",
+	}
+
+	tests := []struct {
+		name            string
+		ctx             context.Context
+		projectGroupRef string
+		start           string
+		limit           int
+		out             []string
+		err             error
+	}{
+		{
+			name:            "owner",
+			ctx:             userContext("user01"),
+			projectGroupRef: "org01",
+			out:             allItems,
+		},
+		{
+			name:            "member",
+			ctx:             userContext("user02"),
+			projectGroupRef: "org01",
+			out:             allItems,
+		},
+		{
+			name:            "subgroup",
+			ctx:             userContext("user02"),
+			projectGroupRef: "pg01",
+			out: []string{
+				"org/org01/pg01/pg02 1",
+				"org/org01/pg01/pg02/project04 2",
+				"org/org01/pg01/project03 1 run03",
+			},
+		},
+		{
+			name:            "first page",
+			ctx:             userContext("user01"),
+			projectGroupRef: "org01",
+			limit:           2,
+			out:             allItems[:2],
+		},
+		{
+			name:            "next page",
+			ctx:             userContext("user01"),
+			projectGroupRef: "org01",
+			start:           "org/org01/pg01/pg02",
+			limit:           2,
+			out:             allItems[2:4],
+		},
+		{
+			name:            "last page",
+			ctx:             userContext("user01"),
+			projectGroupRef: "org01",
+			start:           "org/org01/project01",
+			limit:           2,
+			out:             allItems[5:],
+		},
+		{
+			// the private project groups childs aren't visible also if public
+			name:            "anonymous",
+			ctx:             context.Background(),
+			projectGroupRef: "org01",
+			out:             []string{"org/org01/project05 1"},
+		},
+		{
+			name:            "anonymous private project group",
+			ctx:             context.Background(),
+			projectGroupRef: "org02",
+			err:             &util.ErrForbidden{},
+		},
+		{
+			name:            "not member private project group",
+			ctx:             userContext("user02"),
+			projectGroupRef: "org02",
+			err:             &util.ErrForbidden{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := h.GetProjectGroupTree(tt.ctx, tt.projectGroupRef, tt.start, tt.limit)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("expected error %v, got: %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			out := []string{}
+			for _, item := range items {
+				s := fmt.Sprintf("%s %d", item.Path(), item.Depth)
+				if item.LastRun != nil {
+					s += " " + item.LastRun.ID
+				}
+				out = append(out, s)
+			}
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Fatalf("tree items mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
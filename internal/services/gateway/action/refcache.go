@@ -0,0 +1,192 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+// refCacheMaxEntries is the max number of entries kept in the ref cache. When
+// reached the expired entries are removed and, if still full, the cache is
+// emptied.
+const refCacheMaxEntries = 10000
+
+// ResolvedRef is a project or project group path or a user name resolved to
+// the object ID and current path (or name)
+type ResolvedRef struct {
+	ID string
+	// Path is the project or project group current path or the user name
+	Path string
+	// Aliased is true when the path is an old path of the object
+	Aliased bool
+}
+
+type refCacheKey struct {
+	objectType types.ConfigType
+	ref        string
+}
+
+type refCacheEntry struct {
+	ref        *ResolvedRef
+	expiration time.Time
+}
+
+// refCache caches the resolved refs for a short time to avoid resolving them
+// in the configstore for every request using them. The gateway purges it
+// after every change that could move a path or rename a user and on the
+// configstore change events (see WatchRefChanges), the ttl limits the
+// staleness when the events aren't received. A zero ttl disables the cache.
+type refCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[refCacheKey]*refCacheEntry
+}
+
+func newRefCache(ttl time.Duration) *refCache {
+	return &refCache{
+		ttl:     ttl,
+		entries: make(map[refCacheKey]*refCacheEntry),
+	}
+}
+
+func (c *refCache) get(objectType types.ConfigType, ref string) *ResolvedRef {
+	if c.ttl <= 0 {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := refCacheKey{objectType: objectType, ref: ref}
+	e, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(e.expiration) {
+		delete(c.entries, key)
+		return nil
+	}
+	return e.ref
+}
+
+func (c *refCache) set(objectType types.ConfigType, ref string, rr *ResolvedRef) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= refCacheMaxEntries {
+		for k, e := range c.entries {
+			if now.After(e.expiration) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= refCacheMaxEntries {
+			c.entries = make(map[refCacheKey]*refCacheEntry)
+		}
+	}
+	c.entries[refCacheKey{objectType: objectType, ref: ref}] = &refCacheEntry{ref: rr, expiration: now.Add(c.ttl)}
+}
+
+// purge removes all the entries
+func (c *refCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[refCacheKey]*refCacheEntry)
+}
+
+// refCacheWatchedTypes are the data types whose changes could change the
+// resolution of a ref
+var refCacheWatchedTypes = []types.ConfigType{
+	types.ConfigTypeUser,
+	types.ConfigTypeOrg,
+	types.ConfigTypeProjectGroup,
+	types.ConfigTypeProject,
+	types.ConfigTypePathAlias,
+}
+
+// WatchRefChanges purges the ref cache when the configstore objects changes
+// could change the resolution of a cached ref, also when done by other
+// gateway instances. It returns on the first configstore error.
+func (h *ActionHandler) WatchRefChanges(ctx context.Context) error {
+	var seq string
+	for {
+		ce, resp, err := h.configstoreClient.WatchChanges(ctx, seq, refCacheWatchedTypes, 0)
+		if err != nil {
+			return errors.Errorf("failed to watch configstore changes: %w", ErrFromRemote(resp, err))
+		}
+		if ce.Seq == "" {
+			return errors.Errorf("configstore changes not available")
+		}
+		// the changes done before the first request or before a reset could
+		// have been missed
+		if seq == "" || ce.Reset || len(ce.Events) > 0 {
+			h.refCache.purge()
+		}
+		seq = ce.Seq
+	}
+}
+
+// ResolveRef resolves a project or project group path, also an old one, or a
+// user name to the object ID and current path (or name). A not found error is
+// returned when no object is referenced by the ref.
+func (h *ActionHandler) ResolveRef(ctx context.Context, objectType types.ConfigType, ref string) (*ResolvedRef, error) {
+	if rr := h.refCache.get(objectType, ref); rr != nil {
+		return rr, nil
+	}
+
+	var rr *ResolvedRef
+	switch objectType {
+	case types.ConfigTypeProject, types.ConfigTypeProjectGroup:
+		res, resp, err := h.configstoreClient.ResolvePathAlias(ctx, objectType, ref)
+		if err != nil {
+			if resp != nil && resp.StatusCode == http.StatusNotFound {
+				return nil, util.NewErrNotFound(err)
+			}
+			return nil, errors.Errorf("failed to resolve %s path %q: %w", objectType, ref, ErrFromRemote(resp, err))
+		}
+		rr = &ResolvedRef{ID: res.ID, Path: res.Path, Aliased: res.Alias != nil}
+
+	case types.ConfigTypeUser:
+		user, resp, err := h.configstoreClient.GetUser(ctx, ref)
+		if err != nil {
+			if resp != nil && resp.StatusCode == http.StatusNotFound {
+				return nil, util.NewErrNotFound(err)
+			}
+			return nil, errors.Errorf("failed to resolve user %q: %w", ref, ErrFromRemote(resp, err))
+		}
+		rr = &ResolvedRef{ID: user.ID, Path: user.Name}
+
+	default:
+		return nil, errors.Errorf("unsupported ref type %q", objectType)
+	}
+
+	h.refCache.set(objectType, ref, rr)
+
+	return rr, nil
+}
@@ -0,0 +1,173 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	slog "agola.io/agola/internal/log"
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+func TestRefCacheWatchRename(t *testing.T) {
+	var mu sync.Mutex
+	projects := map[string]string{"org/org01/project01": "project01"}
+	users := map[string]string{"user01": "userid01"}
+	resolveCalls := 0
+
+	// watchReqs receives the watch requests sequence, events is used to send
+	// the change events done by another gateway
+	watchReqs := make(chan string, 10)
+	events := make(chan *csapi.ChangeEvents)
+
+	writeJSON := func(w http.ResponseWriter, v interface{}) {
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+	}
+
+	csRouter := mux.NewRouter()
+	csRouter.HandleFunc("/api/v1alpha/pathaliases/resolve", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		resolveCalls++
+		p := r.URL.Query().Get("path")
+		id, ok := projects[p]
+		if !ok {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, &csapi.PathAliasResolution{ID: id, Path: p})
+	})
+	csRouter.HandleFunc("/api/v1alpha/users/{userref}", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		resolveCalls++
+		name := mux.Vars(r)["userref"]
+		id, ok := users[name]
+		if !ok {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, &types.User{ID: id, Name: name})
+	})
+	csRouter.HandleFunc("/api/v1alpha/watch", func(w http.ResponseWriter, r *http.Request) {
+		after := r.URL.Query().Get("after")
+		watchReqs <- after
+		if after == "" {
+			writeJSON(w, &csapi.ChangeEvents{Seq: "1"})
+			return
+		}
+		select {
+		case ce := <-events:
+			writeJSON(w, ce)
+		case <-r.Context().Done():
+		}
+	})
+	cs := httptest.NewServer(csRouter)
+	defer cs.Close()
+
+	logger := slog.New(zap.NewAtomicLevelAt(zap.FatalLevel))
+	h := NewActionHandler(logger, nil, csapi.NewClient(cs.URL), nil, "agola", "", "", nil, nil, nil, nil, nil, nil, nil, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = h.WatchRefChanges(ctx) }()
+
+	waitWatchReq := func(expectedSeq string) {
+		select {
+		case seq := <-watchReqs:
+			if seq != expectedSeq {
+				t.Fatalf("expected watch after seq %q, got %q", expectedSeq, seq)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for watch request")
+		}
+	}
+	// the first events are processed when the next watch request is done
+	waitWatchReq("")
+	waitWatchReq("1")
+
+	getResolveCalls := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return resolveCalls
+	}
+
+	for i := 0; i < 2; i++ {
+		rr, err := h.ResolveRef(ctx, types.ConfigTypeProject, "org/org01/project01")
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if rr.ID != "project01" {
+			t.Fatalf("expected project id %q, got %q", "project01", rr.ID)
+		}
+		rr, err = h.ResolveRef(ctx, types.ConfigTypeUser, "user01")
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if rr.ID != "userid01" {
+			t.Fatalf("expected user id %q, got %q", "userid01", rr.ID)
+		}
+	}
+	if n := getResolveCalls(); n != 2 {
+		t.Fatalf("expected 2 configstore resolve calls, got %d", n)
+	}
+
+	// rename the project and the user through another gateway
+	mu.Lock()
+	delete(projects, "org/org01/project01")
+	projects["org/org01/project02"] = "project01"
+	delete(users, "user01")
+	users["user02"] = "userid01"
+	mu.Unlock()
+	events <- &csapi.ChangeEvents{
+		Seq: "2",
+		Events: []*csapi.ChangeEvent{
+			{Seq: "2", DataType: types.ConfigTypeProject, ID: "project01"},
+			{Seq: "2", DataType: types.ConfigTypeUser, ID: "userid01"},
+		},
+	}
+	waitWatchReq("2")
+
+	if _, err := h.ResolveRef(ctx, types.ConfigTypeProject, "org/org01/project01"); !errors.Is(err, &util.ErrNotFound{}) {
+		t.Fatalf("expected not found error, got: %v", err)
+	}
+	if _, err := h.ResolveRef(ctx, types.ConfigTypeUser, "user01"); !errors.Is(err, &util.ErrNotFound{}) {
+		t.Fatalf("expected not found error, got: %v", err)
+	}
+	rr, err := h.ResolveRef(ctx, types.ConfigTypeUser, "user02")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if rr.ID != "userid01" {
+		t.Fatalf("expected user id %q, got %q", "userid01", rr.ID)
+	}
+	if n := getResolveCalls(); n != 5 {
+		t.Fatalf("expected 5 configstore resolve calls, got %d", n)
+	}
+}
@@ -17,6 +17,9 @@ package action
 import (
 	"context"
 
+	gitsource "agola.io/agola/internal/gitsources"
+	"agola.io/agola/internal/services/common"
+	csapi "agola.io/agola/internal/services/configstore/api"
 	"agola.io/agola/internal/services/types"
 	"agola.io/agola/internal/util"
 
@@ -57,6 +60,8 @@ type CreateRemoteSourceRequest struct {
 	SkipSSHHostKeyCheck bool
 	RegistrationEnabled *bool
 	LoginEnabled        *bool
+	UserNameStripDomain bool
+	UserNamePrefix      string
 }
 
 func (h *ActionHandler) CreateRemoteSource(ctx context.Context, req *CreateRemoteSourceRequest) (*types.RemoteSource, error) {
@@ -95,6 +100,10 @@ func (h *ActionHandler) CreateRemoteSource(ctx context.Context, req *CreateRemot
 		}
 	}
 
+	if req.UserNamePrefix != "" && !util.ValidateName(req.UserNamePrefix) {
+		return nil, util.NewErrBadRequest(errors.Errorf("invalid remotesource user name prefix %q", req.UserNamePrefix))
+	}
+
 	rs := &types.RemoteSource{
 		Name:                req.Name,
 		Type:                types.RemoteSourceType(req.Type),
@@ -108,6 +117,12 @@ func (h *ActionHandler) CreateRemoteSource(ctx context.Context, req *CreateRemot
 		RegistrationEnabled: req.RegistrationEnabled,
 		LoginEnabled:        req.LoginEnabled,
 	}
+	if req.UserNameStripDomain || req.UserNamePrefix != "" {
+		rs.UserNameMapping = &types.UserNameMapping{
+			StripDomain: req.UserNameStripDomain,
+			Prefix:      req.UserNamePrefix,
+		}
+	}
 
 	h.log.Infof("creating remotesource")
 	rs, resp, err := h.configstoreClient.CreateRemoteSource(ctx, rs)
@@ -131,6 +146,8 @@ type UpdateRemoteSourceRequest struct {
 	SkipSSHHostKeyCheck *bool
 	RegistrationEnabled *bool
 	LoginEnabled        *bool
+	UserNameStripDomain *bool
+	UserNamePrefix      *string
 }
 
 func (h *ActionHandler) UpdateRemoteSource(ctx context.Context, req *UpdateRemoteSourceRequest) (*types.RemoteSource, error) {
@@ -170,6 +187,20 @@ func (h *ActionHandler) UpdateRemoteSource(ctx context.Context, req *UpdateRemot
 	if req.LoginEnabled != nil {
 		rs.LoginEnabled = req.LoginEnabled
 	}
+	if req.UserNameStripDomain != nil || req.UserNamePrefix != nil {
+		if rs.UserNameMapping == nil {
+			rs.UserNameMapping = &types.UserNameMapping{}
+		}
+		if req.UserNameStripDomain != nil {
+			rs.UserNameMapping.StripDomain = *req.UserNameStripDomain
+		}
+		if req.UserNamePrefix != nil {
+			if *req.UserNamePrefix != "" && !util.ValidateName(*req.UserNamePrefix) {
+				return nil, util.NewErrBadRequest(errors.Errorf("invalid remotesource user name prefix %q", *req.UserNamePrefix))
+			}
+			rs.UserNameMapping.Prefix = *req.UserNamePrefix
+		}
+	}
 
 	h.log.Infof("updating remotesource")
 	rs, resp, err = h.configstoreClient.UpdateRemoteSource(ctx, req.RemoteSourceRef, rs)
@@ -192,3 +223,250 @@ func (h *ActionHandler) DeleteRemoteSource(ctx context.Context, rsRef string) er
 	}
 	return nil
 }
+
+// RemoteSourceCheckResult is the result of a remote source configuration
+// check
+type RemoteSourceCheckResult struct {
+	APIReachable bool
+	APIError     string
+	// Oauth2ClientValid is nil when the remote source doesn't use oauth2
+	// authentication
+	Oauth2ClientValid *bool
+	Oauth2ClientError string
+}
+
+func (h *ActionHandler) CheckRemoteSource(ctx context.Context, rsRef string) (*RemoteSourceCheckResult, error) {
+	if !h.IsUserAdmin(ctx) {
+		return nil, errors.Errorf("user not admin")
+	}
+
+	rs, resp, err := h.configstoreClient.GetRemoteSource(ctx, rsRef)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	return h.checkRemoteSource(rs)
+}
+
+func (h *ActionHandler) checkRemoteSource(rs *types.RemoteSource) (*RemoteSourceCheckResult, error) {
+	gitSource, err := common.GetGitSource(rs, nil)
+	if err != nil {
+		return nil, err
+	}
+	checker, ok := gitSource.(gitsource.ConfigChecker)
+	if !ok {
+		return nil, util.NewErrBadRequest(errors.Errorf("remote source %q type %q doesn't support configuration checks", rs.Name, rs.Type))
+	}
+
+	res := &RemoteSourceCheckResult{}
+	if err := checker.CheckAPI(); err != nil {
+		res.APIError = err.Error()
+	} else {
+		res.APIReachable = true
+	}
+
+	if rs.AuthType == types.RemoteSourceAuthTypeOauth2 {
+		valid := true
+		if err := checker.CheckOauth2Client(h.webExposedURL + "/oauth2/callback"); err != nil {
+			valid = false
+			res.Oauth2ClientError = err.Error()
+		}
+		res.Oauth2ClientValid = &valid
+	}
+
+	return res, nil
+}
+
+type RotateRemoteSourceSecretRequest struct {
+	RemoteSourceRef string
+
+	// Oauth2ClientID is updated only when not empty
+	Oauth2ClientID     string
+	Oauth2ClientSecret string
+	// SkipCheck saves the new credentials without checking them
+	SkipCheck bool
+}
+
+// RotateRemoteSourceSecret replaces the remote source oauth2 client secret.
+// The new credentials are checked against the authorization server before
+// saving them.
+func (h *ActionHandler) RotateRemoteSourceSecret(ctx context.Context, req *RotateRemoteSourceSecretRequest) (*types.RemoteSource, error) {
+	if !h.IsUserAdmin(ctx) {
+		return nil, errors.Errorf("user not admin")
+	}
+	if req.Oauth2ClientSecret == "" {
+		return nil, util.NewErrBadRequest(errors.Errorf("empty remote source oauth2 client secret"))
+	}
+
+	rs, resp, err := h.configstoreClient.GetRemoteSource(ctx, req.RemoteSourceRef)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+	if rs.AuthType != types.RemoteSourceAuthTypeOauth2 {
+		return nil, util.NewErrBadRequest(errors.Errorf("remote source %q doesn't use oauth2 authentication", rs.Name))
+	}
+
+	if req.Oauth2ClientID != "" {
+		rs.Oauth2ClientID = req.Oauth2ClientID
+	}
+	rs.Oauth2ClientSecret = req.Oauth2ClientSecret
+
+	if !req.SkipCheck {
+		res, err := h.checkRemoteSource(rs)
+		if err != nil {
+			return nil, err
+		}
+		if !*res.Oauth2ClientValid {
+			return nil, util.NewErrBadRequest(errors.Errorf("new oauth2 client credentials check failed: %s", res.Oauth2ClientError))
+		}
+	}
+
+	h.log.Infof("rotating remotesource %q oauth2 client secret", rs.Name)
+	rs, resp, err = h.configstoreClient.UpdateRemoteSource(ctx, req.RemoteSourceRef, rs)
+	if err != nil {
+		return nil, errors.Errorf("failed to update remotesource: %w", ErrFromRemote(resp, err))
+	}
+	h.log.Infof("remotesource %q oauth2 client secret rotated", rs.Name)
+
+	return rs, nil
+}
+
+type MigrateRemoteSourceRequest struct {
+	RemoteSourceRef string
+
+	APIURL     string
+	SkipVerify *bool
+	SSHHostKey *string
+}
+
+type LinkedAccountMigrationStatus string
+
+const (
+	LinkedAccountMigrationStatusUnchanged LinkedAccountMigrationStatus = "unchanged"
+	LinkedAccountMigrationStatusUpdated   LinkedAccountMigrationStatus = "updated"
+	LinkedAccountMigrationStatusFailed    LinkedAccountMigrationStatus = "failed"
+)
+
+// LinkedAccountMigration is the result of a linked account migration
+type LinkedAccountMigration struct {
+	UserName        string
+	LinkedAccountID string
+	Status          LinkedAccountMigrationStatus
+	Error           string
+}
+
+const migrateRemoteSourceUsersPageSize = 100
+
+// MigrateRemoteSource changes the remote source url and migrates its linked
+// accounts: the remote user of every linked account is fetched from the new
+// url with the linked account credentials and, when changed, the linked
+// account remote user id and name are updated.
+func (h *ActionHandler) MigrateRemoteSource(ctx context.Context, req *MigrateRemoteSourceRequest) ([]*LinkedAccountMigration, error) {
+	if !h.IsUserAdmin(ctx) {
+		return nil, errors.Errorf("user not admin")
+	}
+	if req.APIURL == "" {
+		return nil, util.NewErrBadRequest(errors.Errorf("empty remote source api url"))
+	}
+
+	rs, resp, err := h.configstoreClient.GetRemoteSource(ctx, req.RemoteSourceRef)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	rs.APIURL = req.APIURL
+	if req.SkipVerify != nil {
+		rs.SkipVerify = *req.SkipVerify
+	}
+	if req.SSHHostKey != nil {
+		rs.SSHHostKey = *req.SSHHostKey
+	}
+
+	res, err := h.checkRemoteSource(rs)
+	if err != nil {
+		return nil, err
+	}
+	if !res.APIReachable {
+		return nil, util.NewErrBadRequest(errors.Errorf("remote source new api url isn't reachable: %s", res.APIError))
+	}
+
+	h.log.Infof("migrating remotesource %q to %q", rs.Name, rs.APIURL)
+	rs, resp, err = h.configstoreClient.UpdateRemoteSource(ctx, req.RemoteSourceRef, rs)
+	if err != nil {
+		return nil, errors.Errorf("failed to update remotesource: %w", ErrFromRemote(resp, err))
+	}
+
+	migrations := []*LinkedAccountMigration{}
+	start := ""
+	for {
+		users, resp, err := h.configstoreClient.GetUsers(ctx, start, migrateRemoteSourceUsersPageSize, true)
+		if err != nil {
+			return nil, errors.Errorf("failed to get users: %w", ErrFromRemote(resp, err))
+		}
+		for _, user := range users {
+			for _, la := range user.LinkedAccounts {
+				if la.RemoteSourceID != rs.ID {
+					continue
+				}
+				m := &LinkedAccountMigration{
+					UserName:        user.Name,
+					LinkedAccountID: la.ID,
+				}
+				status, err := h.migrateLinkedAccount(ctx, rs, user, la)
+				if err != nil {
+					h.log.Errorf("failed to migrate user %q linked account %q: %+v", user.Name, la.ID, err)
+					status = LinkedAccountMigrationStatusFailed
+					m.Error = err.Error()
+				}
+				m.Status = status
+				migrations = append(migrations, m)
+			}
+		}
+		if len(users) < migrateRemoteSourceUsersPageSize {
+			break
+		}
+		start = users[len(users)-1].Name
+	}
+	h.log.Infof("remotesource %q migrated", rs.Name)
+
+	return migrations, nil
+}
+
+func (h *ActionHandler) migrateLinkedAccount(ctx context.Context, rs *types.RemoteSource, user *types.User, la *types.LinkedAccount) (LinkedAccountMigrationStatus, error) {
+	la, err := h.RefreshLinkedAccount(ctx, rs, user.Name, la)
+	if err != nil {
+		return "", err
+	}
+	accessToken, err := common.GetAccessToken(rs, la.UserAccessToken, la.Oauth2AccessToken)
+	if err != nil {
+		return "", err
+	}
+	userSource, err := common.GetUserSource(rs, accessToken)
+	if err != nil {
+		return "", err
+	}
+	remoteUserInfo, err := userSource.GetUserInfo()
+	if err != nil {
+		return "", errors.Errorf("failed to retrieve remote user info: %w", err)
+	}
+	if remoteUserInfo.ID == "" {
+		return "", errors.Errorf("empty remote user id")
+	}
+
+	if remoteUserInfo.ID == la.RemoteUserID && remoteUserInfo.LoginName == la.RemoteUserName {
+		return LinkedAccountMigrationStatusUnchanged, nil
+	}
+
+	creq := &csapi.UpdateUserLARequest{
+		RemoteUserID:               remoteUserInfo.ID,
+		RemoteUserName:             remoteUserInfo.LoginName,
+		UserAccessToken:            la.UserAccessToken,
+		Oauth2AccessToken:          la.Oauth2AccessToken,
+		Oauth2RefreshToken:         la.Oauth2RefreshToken,
+		Oauth2AccessTokenExpiresAt: la.Oauth2AccessTokenExpiresAt,
+	}
+	if _, resp, err := h.configstoreClient.UpdateUserLA(ctx, user.ID, la.ID, creq); err != nil {
+		return "", errors.Errorf("failed to update linked account: %w", ErrFromRemote(resp, err))
+	}
+	return LinkedAccountMigrationStatusUpdated, nil
+}
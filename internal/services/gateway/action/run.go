@@ -15,10 +15,15 @@
 package action
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"path"
+	"sort"
+	"strings"
 
 	"agola.io/agola/internal/config"
 	gitsource "agola.io/agola/internal/gitsources"
@@ -40,6 +45,11 @@ const (
 	agolaDefaultJsonConfigFile    = "config.json"
 	agolaDefaultYamlConfigFile    = "config.yml"
 
+	// maxPatchSize is the max size of a run patch. The patch is provided to the
+	// clone step as a base64 encoded environment variable so it must be kept
+	// under the max size of a single environment variable (128KiB on linux)
+	maxPatchSize = 64 * 1024
+
 	// List of runs annotations
 	AnnotationRunType   = "run_type"
 	AnnotationRefType   = "ref_type"
@@ -62,14 +72,73 @@ const (
 	AnnotationTagLink         = "tag_link"
 	AnnotationPullRequestID   = "pull_request_id"
 	AnnotationPullRequestLink = "pull_request_link"
+
+	// AnnotationPatch is set to "true" when the run applies a patch (local
+	// changes) on top of the commit
+	AnnotationPatch = "patch"
+
+	// AnnotationCloneURL is the clone url used by the run when it's different
+	// from the remote source one (a project clone url or a per run override)
+	AnnotationCloneURL = "clone_url"
+
+	// AnnotationDebug marks the debug runs created overriding the project
+	// variables or the config
+	AnnotationDebug = "debug"
+
+	// AnnotationUserRunRepoPath is the gitserver repository path of a user
+	// direct run. Its temporary branch is removed when the run completes.
+	AnnotationUserRunRepoPath = "user_run_repo_path"
+
+	// AnnotationConfigDir is the monorepo config directory of the runs
+	// generated by a project config dir
+	AnnotationConfigDir = "config_dir"
+
+	// AnnotationConfigRepo and AnnotationConfigCommitSHA are the project
+	// config repository and the commit providing the run config
+	AnnotationConfigRepo      = "config_repo"
+	AnnotationConfigCommitSHA = "config_commit_sha"
+)
+
+// automatic run labels
+const (
+	LabelEventType     = config.RunLabelReservedPrefix + "event"
+	LabelBranch        = config.RunLabelReservedPrefix + "branch"
+	LabelTag           = config.RunLabelReservedPrefix + "tag"
+	LabelPullRequestID = config.RunLabelReservedPrefix + "pull_request"
+	LabelRunName       = config.RunLabelReservedPrefix + "run_name"
 )
 
 func (h *ActionHandler) GetRun(ctx context.Context, runID string) (*rsapi.RunResponse, error) {
+	return h.getRunCheckData(ctx, runID, RunDataRuns)
+}
+
+// getRunCheckData returns the run after checking that the user can get the
+// provided run data
+func (h *ActionHandler) getRunCheckData(ctx context.Context, runID string, data RunData) (*rsapi.RunResponse, error) {
 	runResp, resp, err := h.runserviceClient.GetRun(ctx, runID, nil)
 	if err != nil {
 		return nil, ErrFromRemote(resp, err)
 	}
-	canGetRun, err := h.CanGetRun(ctx, runResp.RunConfig.Group)
+	canGetRunData, err := h.CanGetRunData(ctx, runResp.RunConfig.Group, data)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine permissions: %w", err)
+	}
+	if !canGetRunData {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	return runResp, nil
+}
+
+// GetProjectRun returns the project run with the provided run number
+func (h *ActionHandler) GetProjectRun(ctx context.Context, projectRef string, runNumber uint64) (*rsapi.RunResponse, error) {
+	p, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project %q: %w", projectRef, ErrFromRemote(resp, err))
+	}
+
+	group := path.Join("/", string(common.GroupTypeProject), p.ID)
+	canGetRun, err := h.CanGetRun(ctx, group)
 	if err != nil {
 		return nil, errors.Errorf("failed to determine permissions: %w", err)
 	}
@@ -77,6 +146,11 @@ func (h *ActionHandler) GetRun(ctx context.Context, runID string) (*rsapi.RunRes
 		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
 	}
 
+	runResp, resp, err := h.runserviceClient.GetRunByCounter(ctx, group, runNumber)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
 	return runResp, nil
 }
 
@@ -85,10 +159,16 @@ type GetRunsRequest struct {
 	ResultFilter []string
 	Group        string
 	LastRun      bool
+	Pinned       bool
 	ChangeGroups []string
 	StartRunID   string
 	Limit        int
 	Asc          bool
+
+	// Names filters the runs by their config run names
+	Names []string
+	// Labels filters the runs having all the provided labels
+	Labels map[string]string
 }
 
 func (h *ActionHandler) GetRuns(ctx context.Context, req *GetRunsRequest) (*rsapi.GetRunsResponse, error) {
@@ -101,7 +181,7 @@ func (h *ActionHandler) GetRuns(ctx context.Context, req *GetRunsRequest) (*rsap
 	}
 
 	groups := []string{req.Group}
-	runsResp, resp, err := h.runserviceClient.GetRuns(ctx, req.PhaseFilter, req.ResultFilter, groups, req.LastRun, req.ChangeGroups, req.StartRunID, req.Limit, req.Asc)
+	runsResp, resp, err := h.runserviceClient.GetRuns(ctx, req.PhaseFilter, req.ResultFilter, groups, req.Names, req.Labels, req.LastRun, req.Pinned, req.ChangeGroups, req.StartRunID, req.Limit, req.Asc)
 	if err != nil {
 		return nil, ErrFromRemote(resp, err)
 	}
@@ -109,20 +189,21 @@ func (h *ActionHandler) GetRuns(ctx context.Context, req *GetRunsRequest) (*rsap
 	return runsResp, nil
 }
 
-type GetLogsRequest struct {
-	RunID  string
-	TaskID string
-	Setup  bool
-	Step   int
-	Follow bool
+type RunsByName struct {
+	Name string
+	Runs []*rstypes.Run
 }
 
-func (h *ActionHandler) GetLogs(ctx context.Context, req *GetLogsRequest) (*http.Response, error) {
-	runResp, resp, err := h.runserviceClient.GetRun(ctx, req.RunID, nil)
+// GetProjectRunsByName returns the last runs of the project grouped by their
+// config run name
+func (h *ActionHandler) GetProjectRunsByName(ctx context.Context, projectRef string, limit int) ([]*RunsByName, error) {
+	p, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
 	if err != nil {
-		return nil, ErrFromRemote(resp, err)
+		return nil, errors.Errorf("failed to get project %q: %w", projectRef, ErrFromRemote(resp, err))
 	}
-	canGetRun, err := h.CanGetRun(ctx, runResp.RunConfig.Group)
+
+	group := path.Join("/", string(common.GroupTypeProject), p.ID)
+	canGetRun, err := h.CanGetRun(ctx, group)
 	if err != nil {
 		return nil, errors.Errorf("failed to determine permissions: %w", err)
 	}
@@ -130,7 +211,47 @@ func (h *ActionHandler) GetLogs(ctx context.Context, req *GetLogsRequest) (*http
 		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
 	}
 
-	resp, err = h.runserviceClient.GetLogs(ctx, req.RunID, req.TaskID, req.Setup, req.Step, req.Follow)
+	names, resp, err := h.runserviceClient.GetRunNames(ctx, group)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	runsByName := make([]*RunsByName, 0, len(names))
+	for _, name := range names {
+		runsResp, resp, err := h.runserviceClient.GetRuns(ctx, nil, nil, []string{group}, []string{name}, nil, false, false, nil, "", limit, false)
+		if err != nil {
+			return nil, ErrFromRemote(resp, err)
+		}
+		runsByName = append(runsByName, &RunsByName{
+			Name: name,
+			Runs: runsResp.Runs,
+		})
+	}
+
+	return runsByName, nil
+}
+
+type GetLogsRequest struct {
+	RunID  string
+	TaskID string
+	Setup  bool
+	Step   int
+	// Attempt is the previous attempt logs to return, -1 for the last attempt
+	Attempt int
+	Follow  bool
+	// Full returns the full log of a truncated log. Only admins can get it.
+	Full bool
+}
+
+func (h *ActionHandler) GetLogs(ctx context.Context, req *GetLogsRequest) (*http.Response, error) {
+	if _, err := h.getRunCheckData(ctx, req.RunID, RunDataLogs); err != nil {
+		return nil, err
+	}
+	if req.Full && !h.IsUserAdmin(ctx) {
+		return nil, util.NewErrForbidden(errors.Errorf("only admins can get the full logs"))
+	}
+
+	resp, err := h.runserviceClient.GetLogs(ctx, req.RunID, req.TaskID, req.Setup, req.Step, req.Attempt, req.Follow, req.Full)
 	if err != nil {
 		return nil, ErrFromRemote(resp, err)
 	}
@@ -144,6 +265,10 @@ const (
 	RunActionTypeRestart RunActionType = "restart"
 	RunActionTypeCancel  RunActionType = "cancel"
 	RunActionTypeStop    RunActionType = "stop"
+	RunActionTypePause   RunActionType = "pause"
+	RunActionTypeResume  RunActionType = "resume"
+	RunActionTypePin     RunActionType = "pin"
+	RunActionTypeUnpin   RunActionType = "unpin"
 )
 
 type RunActionsRequest struct {
@@ -200,6 +325,47 @@ func (h *ActionHandler) RunAction(ctx context.Context, req *RunActionsRequest) (
 			return nil, ErrFromRemote(resp, err)
 		}
 
+	case RunActionTypePause:
+		rsreq := &rsapi.RunActionsRequest{
+			ActionType: rsapi.RunActionTypePause,
+			PausedBy:   h.CurrentUserID(ctx),
+		}
+
+		resp, err = h.runserviceClient.RunActions(ctx, req.RunID, rsreq)
+		if err != nil {
+			return nil, ErrFromRemote(resp, err)
+		}
+
+	case RunActionTypeResume:
+		rsreq := &rsapi.RunActionsRequest{
+			ActionType: rsapi.RunActionTypeResume,
+		}
+
+		resp, err = h.runserviceClient.RunActions(ctx, req.RunID, rsreq)
+		if err != nil {
+			return nil, ErrFromRemote(resp, err)
+		}
+
+	case RunActionTypePin:
+		rsreq := &rsapi.RunActionsRequest{
+			ActionType: rsapi.RunActionTypePin,
+		}
+
+		resp, err = h.runserviceClient.RunActions(ctx, req.RunID, rsreq)
+		if err != nil {
+			return nil, ErrFromRemote(resp, err)
+		}
+
+	case RunActionTypeUnpin:
+		rsreq := &rsapi.RunActionsRequest{
+			ActionType: rsapi.RunActionTypeUnpin,
+		}
+
+		resp, err = h.runserviceClient.RunActions(ctx, req.RunID, rsreq)
+		if err != nil {
+			return nil, ErrFromRemote(resp, err)
+		}
+
 	default:
 		return nil, util.NewErrBadRequest(errors.Errorf("wrong run action type %q", req.ActionType))
 	}
@@ -211,6 +377,7 @@ type RunTaskActionType string
 
 const (
 	RunTaskActionTypeApprove RunTaskActionType = "approve"
+	RunTaskActionTypeCancel  RunTaskActionType = "cancel"
 )
 
 type RunTaskActionsRequest struct {
@@ -218,6 +385,10 @@ type RunTaskActionsRequest struct {
 	TaskID string
 
 	ActionType RunTaskActionType
+
+	// Cancel
+	// Dependents also cancels all the task dependents
+	Dependents bool
 }
 
 func (h *ActionHandler) RunTaskAction(ctx context.Context, req *RunTaskActionsRequest) error {
@@ -239,6 +410,11 @@ func (h *ActionHandler) RunTaskAction(ctx context.Context, req *RunTaskActionsRe
 
 	switch req.ActionType {
 	case RunTaskActionTypeApprove:
+		// approvals usually gate deployments
+		if err := h.checkTwoFactorAuth(ctx); err != nil {
+			return err
+		}
+
 		rt, ok := runResp.Run.Tasks[req.TaskID]
 		if !ok {
 			return util.NewErrBadRequest(errors.Errorf("run %q doesn't have task %q", req.RunID, req.TaskID))
@@ -281,6 +457,13 @@ func (h *ActionHandler) RunTaskAction(ctx context.Context, req *RunTaskActionsRe
 			return ErrFromRemote(resp, err)
 		}
 
+	case RunTaskActionTypeCancel:
+		resp, err := h.runserviceClient.CancelRunTask(ctx, req.RunID, req.TaskID, req.Dependents, curUserID, runResp.ChangeGroupsUpdateToken)
+		if err != nil {
+			return ErrFromRemote(resp, err)
+		}
+		h.log.Infow("run task cancelled", "run", req.RunID, "task", req.TaskID, "dependents", req.Dependents, "user", curUserID)
+
 	default:
 		return util.NewErrBadRequest(errors.Errorf("wrong run task action type %q", req.ActionType))
 	}
@@ -320,7 +503,37 @@ type CreateRunRequest struct {
 	// commit compare link
 	CompareLink string
 
+	// PullRequestAttributes are the pull request attributes used by the when
+	// conditions, nil if the run isn't for a pull request
+	PullRequestAttributes *types.PullRequestAttributes
+
 	UserRunRepoUUID string
+
+	// Patch is a git patch applied on top of the commit by the clone step
+	Patch []byte
+
+	// Annotations are additional run annotations provided by the user. The
+	// AnnotationCloneURL annotation overrides the clone url
+	Annotations map[string]string
+
+	// Debug, when not nil, creates a debug run
+	Debug *DebugRunOptions
+
+	// ChangedFiles are the paths of the files changed by the run commits,
+	// nil when they aren't known. They're used to select the project config
+	// dirs generating runs
+	ChangedFiles []string
+}
+
+// DebugRunOptions are the overrides of a debug run
+type DebugRunOptions struct {
+	// Variables override the project variables with the same name
+	Variables map[string]string
+	// ConfigData, when provided, is used instead of the repository config
+	ConfigData []byte
+	// ConfigPath is the path of the provided config, its extension defines
+	// the config format
+	ConfigPath string
 }
 
 func (h *ActionHandler) CreateRuns(ctx context.Context, req *CreateRunRequest) error {
@@ -332,6 +545,9 @@ func (h *ActionHandler) CreateRuns(ctx context.Context, req *CreateRunRequest) e
 	if req.Message == "" {
 		return util.NewErrBadRequest(errors.Errorf("empty message"))
 	}
+	if len(req.Patch) > maxPatchSize {
+		return util.NewErrBadRequest(errors.Errorf("patch size %d bytes exceeds the max allowed size of %d bytes", len(req.Patch), maxPatchSize))
+	}
 
 	var baseGroupType common.GroupType
 	var baseGroupID string
@@ -360,7 +576,17 @@ func (h *ActionHandler) CreateRuns(ctx context.Context, req *CreateRunRequest) e
 
 	runGroup := common.GenRunGroup(baseGroupType, baseGroupID, groupType, group)
 
-	gitURL, err := util.ParseGitURL(req.CloneURL)
+	// use the project clone url (i.e. an internal mirror) if defined and
+	// override it with the per run one
+	cloneURL := req.CloneURL
+	if req.Project != nil && req.Project.CloneURL != "" {
+		cloneURL = req.Project.CloneURL
+	}
+	if req.Annotations[AnnotationCloneURL] != "" {
+		cloneURL = req.Annotations[AnnotationCloneURL]
+	}
+
+	gitURL, err := util.ParseGitURL(cloneURL)
 	if err != nil {
 		return errors.Errorf("failed to parse clone url: %w", err)
 	}
@@ -374,7 +600,7 @@ func (h *ActionHandler) CreateRuns(ctx context.Context, req *CreateRunRequest) e
 	env := map[string]string{
 		"CI":                   "true",
 		"AGOLA_SSHPRIVKEY":     req.SSHPrivKey,
-		"AGOLA_REPOSITORY_URL": req.CloneURL,
+		"AGOLA_REPOSITORY_URL": cloneURL,
 		"AGOLA_GIT_HOST":       gitHost,
 		"AGOLA_GIT_PORT":       gitPort,
 		"AGOLA_GIT_BRANCH":     req.Branch,
@@ -383,20 +609,19 @@ func (h *ActionHandler) CreateRuns(ctx context.Context, req *CreateRunRequest) e
 		"AGOLA_GIT_COMMITSHA":  req.CommitSHA,
 	}
 
-	if req.SSHHostKey != "" {
+	for k, v := range runconfig.GenStandardEnvironment(req.RepoPath, req.Branch, req.Tag, req.PullRequestID, req.CommitSHA) {
+		env[k] = v
+	}
+
+	// the remote source ssh host key isn't valid for a different clone url host
+	if req.SSHHostKey != "" && cloneURL == req.CloneURL {
 		env["AGOLA_SSHHOSTKEY"] = req.SSHHostKey
 	}
 	if req.SkipSSHHostKeyCheck {
 		env["AGOLA_SKIPSSHHOSTKEYCHECK"] = "1"
 	}
-
-	variables := map[string]string{}
-	if req.RunType == types.RunTypeProject {
-		var err error
-		variables, err = h.genRunVariables(ctx, req)
-		if err != nil {
-			return err
-		}
+	if len(req.Patch) > 0 {
+		env["AGOLA_GIT_PATCH"] = base64.StdEncoding.EncodeToString(req.Patch)
 	}
 
 	annotations := map[string]string{
@@ -416,6 +641,7 @@ func (h *ActionHandler) CreateRuns(ctx context.Context, req *CreateRunRequest) e
 		annotations[AnnotationProjectID] = req.Project.ID
 	} else {
 		annotations[AnnotationUserID] = req.User.ID
+		annotations[AnnotationUserRunRepoPath] = req.RepoPath
 	}
 
 	if req.Branch != "" {
@@ -430,6 +656,16 @@ func (h *ActionHandler) CreateRuns(ctx context.Context, req *CreateRunRequest) e
 		annotations[AnnotationPullRequestID] = req.PullRequestID
 		annotations[AnnotationPullRequestLink] = req.PullRequestLink
 	}
+	if len(req.Patch) > 0 {
+		annotations[AnnotationPatch] = "true"
+	}
+	if cloneURL != req.CloneURL {
+		annotations[AnnotationCloneURL] = cloneURL
+	}
+	if req.Debug != nil {
+		annotations[AnnotationDebug] = "true"
+	}
+	setupErrorLabels := runLabels(req, rstypes.RunGenericSetupErrorName, nil)
 
 	// Since user belong to the same group (the user uuid) we needed another way to differentiate the cache. We'll use the user uuid + the user run repo uuid
 	var cacheGroup string
@@ -437,14 +673,145 @@ func (h *ActionHandler) CreateRuns(ctx context.Context, req *CreateRunRequest) e
 		cacheGroup = req.User.ID + "-" + req.UserRunRepoUUID
 	}
 
-	data, filename, err := h.fetchConfigFiles(req.GitSource, req.RepoPath, req.CommitSHA)
+	storagePartition, err := h.runStoragePartition(ctx, req)
 	if err != nil {
-		return util.NewErrInternal(errors.Errorf("failed to fetch config file: %w", err))
+		return err
+	}
+
+	params := &configRunsParams{
+		runGroup:         runGroup,
+		setupErrors:      setupErrors,
+		env:              env,
+		annotations:      annotations,
+		cacheGroup:       cacheGroup,
+		storagePartition: storagePartition,
 	}
+
+	if req.Debug != nil && len(req.Debug.ConfigData) > 0 {
+		files := []*configFile{{path: req.Debug.ConfigPath, data: req.Debug.ConfigData}}
+		return h.createConfigRuns(ctx, req, params, "", files)
+	}
+
+	// the config is fetched from the project config repository when defined
+	cs := &configSource{gitSource: req.GitSource, repoPath: req.RepoPath, commitSHA: req.CommitSHA}
+	if req.RunType == types.RunTypeProject && req.Project.ConfigRepo != nil {
+		cs, err = resolveConfigRepo(req.GitSource, req.Project.ConfigRepo)
+		if err != nil {
+			err = errors.Errorf("failed to resolve config repository: %w", err)
+			if serr := h.createSetupErrorRun(ctx, runGroup, append(setupErrors, err.Error()), env, annotations, setupErrorLabels, storagePartition); serr != nil {
+				return serr
+			}
+			return util.NewErrInternal(err)
+		}
+		// annotations are shared with params
+		annotations[AnnotationConfigRepo] = cs.repoPath
+		annotations[AnnotationConfigCommitSHA] = cs.commitSHA
+	}
+
+	if req.RunType != types.RunTypeProject || len(req.Project.ConfigDirs) == 0 {
+		files, err := h.fetchConfigFiles(cs.gitSource, cs.repoPath, cs.commitSHA, "", projectConfigPath(req.Project))
+		if err != nil {
+			err = errors.Errorf("failed to fetch config file: %w", err)
+			if serr := h.createSetupErrorRun(ctx, runGroup, append(setupErrors, err.Error()), env, annotations, setupErrorLabels, storagePartition); serr != nil {
+				return serr
+			}
+			return util.NewErrInternal(err)
+		}
+		return h.createConfigRuns(ctx, req, params, "", files)
+	}
+
+	// monorepo project: every config dir generates its own runs
+	configDirs, err := expandConfigDirs(cs.gitSource, cs.repoPath, cs.commitSHA, req.Project.ConfigDirs)
+	if err != nil {
+		err = errors.Errorf("failed to expand config dirs: %w", err)
+		if serr := h.createSetupErrorRun(ctx, runGroup, append(setupErrors, err.Error()), env, annotations, setupErrorLabels, storagePartition); serr != nil {
+			return serr
+		}
+		return util.NewErrInternal(err)
+	}
+	for _, configDir := range configDirs {
+		if !configDirChanged(configDir, req.ChangedFiles) {
+			h.log.Debugf("skipping config dir %q since no file inside it changed", configDir)
+			continue
+		}
+		// the patterns could match directories without a config
+		if !hasConfig(cs.gitSource, cs.repoPath, cs.commitSHA, configDir, req.Project.ConfigPath) {
+			h.log.Debugf("skipping config dir %q without config", configDir)
+			continue
+		}
+
+		files, err := h.fetchConfigFiles(cs.gitSource, cs.repoPath, cs.commitSHA, configDir, req.Project.ConfigPath)
+		if err != nil {
+			err = errors.Errorf("failed to fetch config file: %w", err)
+			configAnnotations := configDirAnnotations(annotations, configDir)
+			if serr := h.createSetupErrorRun(ctx, runGroup, append(setupErrors, err.Error()), env, configAnnotations, setupErrorLabels, storagePartition); serr != nil {
+				return serr
+			}
+			continue
+		}
+		if err := h.createConfigRuns(ctx, req, params, configDir, files); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// configSource is the repository commit providing the run config
+type configSource struct {
+	gitSource gitsource.GitSource
+	repoPath  string
+	commitSHA string
+}
+
+// resolveConfigRepo resolves the project config repository ref to its
+// current commit. The ref is a branch name or a full ref.
+func resolveConfigRepo(gitSource gitsource.GitSource, configRepo *types.ProjectConfigRepo) (*configSource, error) {
+	ref := configRepo.Ref
+	if !strings.HasPrefix(ref, "refs/") {
+		ref = gitSource.BranchRef(ref)
+	}
+	r, err := gitSource.GetRef(configRepo.RepositoryPath, ref)
+	if err != nil {
+		return nil, errors.Errorf("failed to get ref %q of repository %q: %w", ref, configRepo.RepositoryPath, err)
+	}
+	return &configSource{gitSource: gitSource, repoPath: configRepo.RepositoryPath, commitSHA: r.CommitSHA}, nil
+}
+
+// configRunsParams are the run creation data shared by the runs of all the
+// configs
+type configRunsParams struct {
+	runGroup         string
+	setupErrors      []string
+	env              map[string]string
+	annotations      map[string]string
+	cacheGroup       string
+	storagePartition string
+}
+
+// createConfigRuns creates the runs defined by the provided config files.
+// configDir is the monorepo config directory, empty or "." for the repository
+// root config.
+func (h *ActionHandler) createConfigRuns(ctx context.Context, req *CreateRunRequest, params *configRunsParams, configDir string, files []*configFile) error {
+	runGroup := params.runGroup
+	setupErrors := params.setupErrors
+	env := params.env
+	annotations := configDirAnnotations(params.annotations, configDir)
+	storagePartition := params.storagePartition
+	if configDir != "" && configDir != "." {
+		env = make(map[string]string, len(params.env)+1)
+		for k, v := range params.env {
+			env[k] = v
+		}
+		env["AGOLA_CONFIG_DIR"] = configDir
+	}
+	setupErrorLabels := runLabels(req, rstypes.RunGenericSetupErrorName, nil)
+
+	data := concatConfigFiles(files)
 	h.log.Debug("data: %s", data)
 
 	var configFormat config.ConfigFormat
-	switch path.Ext(filename) {
+	switch path.Ext(files[0].path) {
 	case ".jsonnet":
 		configFormat = config.ConfigFormatJsonnet
 	case ".json":
@@ -457,36 +824,85 @@ func (h *ActionHandler) CreateRuns(ctx context.Context, req *CreateRunRequest) e
 	if err != nil {
 		h.log.Errorf("failed to parse config: %+v", err)
 
+		h.commentConfigError(req, files, err)
+
 		// create a run (per config file) with a generic error since we cannot parse
 		// it and know how many runs are defined
-		setupErrors = append(setupErrors, err.Error())
-		createRunReq := &rsapi.RunCreateRequest{
-			RunConfigTasks:    nil,
-			Group:             runGroup,
-			SetupErrors:       setupErrors,
-			Name:              rstypes.RunGenericSetupErrorName,
-			StaticEnvironment: env,
-			Annotations:       annotations,
+		return h.createSetupErrorRun(ctx, runGroup, append(setupErrors, err.Error()), env, annotations, setupErrorLabels, storagePartition)
+	}
+
+	if err := h.expandRemoteTasks(req.GitSource, remoteTasksAllowedRepos(req), config); err != nil {
+		h.log.Errorf("failed to expand remote tasks: %+v", err)
+		return h.createSetupErrorRun(ctx, runGroup, append(setupErrors, err.Error()), env, annotations, setupErrorLabels, storagePartition)
+	}
+
+	if h.runConfigPolicy != nil {
+		if err := h.runConfigPolicy.Apply(config); err != nil {
+			h.log.Errorf("failed to apply run config policy: %+v", err)
+			return h.createSetupErrorRun(ctx, runGroup, append(setupErrors, err.Error()), env, annotations, setupErrorLabels, storagePartition)
 		}
+	}
 
-		if _, _, err := h.runserviceClient.CreateRun(ctx, createRunReq); err != nil {
-			h.log.Errorf("failed to create run: %+v", err)
+	variables := map[string]string{}
+	if req.RunType == types.RunTypeProject {
+		variables, err = h.genRunVariables(ctx, req)
+		if err != nil {
+			if serr := h.createSetupErrorRun(ctx, runGroup, append(setupErrors, err.Error()), env, annotations, setupErrorLabels, storagePartition); serr != nil {
+				return serr
+			}
 			return err
 		}
-		return nil
+		if req.Debug != nil {
+			for k, v := range req.Debug.Variables {
+				variables[k] = v
+			}
+		}
 	}
 
 	for _, run := range config.Runs {
-		rcts := runconfig.GenRunConfigTasks(util.DefaultUUIDGenerator{}, config, run.Name, variables, req.Branch, req.Tag, req.Ref)
+		contextVariables := runInterpolationVariables(req, run.Name)
+		exprVariables := runconfig.ExprVariables(contextVariables)
+
+		if run.When != nil && !runconfig.MatchWhen(run.When, exprVariables, req.Branch, req.Tag, req.Ref, req.PullRequestAttributes) {
+			h.log.Debugf("skipping run %q since its when conditions don't match", run.Name)
+			continue
+		}
+
+		rcts := runconfig.GenRunConfigTasks(util.DefaultUUIDGenerator{}, config, run.Name, variables, exprVariables, req.Branch, req.Tag, req.Ref, req.PullRequestAttributes)
+		quarantineTasks(rcts, req.Project)
+
+		runSetupErrors := append([]string{}, setupErrors...)
+		// only project runs have variables
+		if req.RunType == types.RunTypeProject {
+			if err := runconfig.CheckRunVariables(config, run.Name, variables, exprVariables, req.Branch, req.Tag, req.Ref, req.PullRequestAttributes); err != nil {
+				h.log.Errorf("run %q variables error: %+v", run.Name, err)
+				runSetupErrors = append(runSetupErrors, err.Error())
+			}
+		}
+		if err := runconfig.InterpolateRunConfigTasks(rcts, contextVariables); err != nil {
+			h.log.Errorf("failed to interpolate run %q config: %+v", run.Name, err)
+			runSetupErrors = append(runSetupErrors, err.Error())
+		}
+		if err := applyProjectRunDefaults(rcts, req.Project); err != nil {
+			h.log.Errorf("run %q project run defaults error: %+v", run.Name, err)
+			runSetupErrors = append(runSetupErrors, err.Error())
+		}
 
 		createRunReq := &rsapi.RunCreateRequest{
 			RunConfigTasks:    rcts,
 			Group:             runGroup,
-			SetupErrors:       setupErrors,
+			SetupErrors:       runSetupErrors,
 			Name:              run.Name,
 			StaticEnvironment: env,
 			Annotations:       annotations,
-			CacheGroup:        cacheGroup,
+			Labels:            runLabels(req, run.Name, run.Labels),
+			CacheGroup:        params.cacheGroup,
+			StoragePartition:  storagePartition,
+
+			ArtifactsRetention: projectArtifactsRetention(req.Project),
+
+			ConfigData:   string(data),
+			ConfigFormat: strings.TrimPrefix(path.Ext(files[0].path), "."),
 		}
 
 		if _, _, err := h.runserviceClient.CreateRun(ctx, createRunReq); err != nil {
@@ -498,24 +914,351 @@ func (h *ActionHandler) CreateRuns(ctx context.Context, req *CreateRunRequest) e
 	return nil
 }
 
-func (h *ActionHandler) fetchConfigFiles(gitSource gitsource.GitSource, repopath, commitSHA string) ([]byte, string, error) {
-	var data []byte
-	var filename string
+// createSetupErrorRun creates a run with a generic name reporting the setup
+// errors. It's used when the runs defined in the config cannot be known.
+func (h *ActionHandler) createSetupErrorRun(ctx context.Context, runGroup string, setupErrors []string, env, annotations, labels map[string]string, storagePartition string) error {
+	createRunReq := &rsapi.RunCreateRequest{
+		RunConfigTasks:    nil,
+		Group:             runGroup,
+		SetupErrors:       setupErrors,
+		Name:              rstypes.RunGenericSetupErrorName,
+		StaticEnvironment: env,
+		Annotations:       annotations,
+		Labels:            labels,
+		StoragePartition:  storagePartition,
+	}
+
+	if _, _, err := h.runserviceClient.CreateRun(ctx, createRunReq); err != nil {
+		h.log.Errorf("failed to create run: %+v", err)
+		return err
+	}
+	return nil
+}
+
+// commentConfigError reports the config error as a comment on the offending
+// config file line of the pull request. It's done only when the pull request
+// changes the config file to not report errors it doesn't introduce.
+func (h *ActionHandler) commentConfigError(req *CreateRunRequest, files []*configFile, err error) {
+	if req.RunType != types.RunTypeProject || req.RefType != types.RunRefTypePullRequest {
+		return
+	}
+	// the config isn't in the pull request repository
+	if req.Project.ConfigRepo != nil {
+		return
+	}
+	if req.PullRequestAttributes == nil || req.PullRequestAttributes.TargetBranch == "" {
+		return
+	}
+	var cerr *config.ConfigError
+	if !errors.As(err, &cerr) || cerr.Position == nil {
+		return
+	}
+
+	// find the config file containing the error line
+	var file *configFile
+	for _, f := range files {
+		if f.line <= cerr.Position.Line {
+			file = f
+		}
+	}
+	if file == nil {
+		return
+	}
+
+	targetData, terr := req.GitSource.GetFile(req.RepoPath, req.PullRequestAttributes.TargetBranch, file.path)
+	if terr == nil && bytes.Equal(targetData, file.data) {
+		h.log.Debugf("config file %q not changed by pull request %q, skipping error comment", file.path, req.PullRequestID)
+		return
+	}
+
+	comment := &gitsource.PullRequestComment{
+		Path: file.path,
+		Line: cerr.Position.Line - file.line + 1,
+		Body: fmt.Sprintf("agola config error: %s", cerr.Error()),
+	}
+	if err := req.GitSource.CreatePullRequestComment(req.RepoPath, req.PullRequestID, req.CommitSHA, comment); err != nil {
+		h.log.Errorf("failed to create pull request config error comment: %+v", err)
+	}
+}
+
+// validateCloneURL checks that an alternate clone url is a valid git url. An
+// empty clone url is valid and means that the remote source clone url is used.
+func validateCloneURL(cloneURL string) error {
+	if cloneURL == "" {
+		return nil
+	}
+	u, err := util.ParseGitURL(cloneURL)
+	if err != nil {
+		return util.NewErrBadRequest(errors.Errorf("invalid clone url %q: %w", cloneURL, err))
+	}
+	if u.Host == "" {
+		return util.NewErrBadRequest(errors.Errorf("invalid clone url %q: missing host", cloneURL))
+	}
+	return nil
+}
+
+// runInterpolationVariables returns the run context variables that can be
+// referenced in the config values
+func runInterpolationVariables(req *CreateRunRequest, runName string) map[string]string {
+	return map[string]string{
+		runconfig.VariableRunName:          runName,
+		runconfig.VariableGitRefType:       string(req.RefType),
+		runconfig.VariableGitBranch:        req.Branch,
+		runconfig.VariableGitTag:           req.Tag,
+		runconfig.VariableGitRef:           req.Ref,
+		runconfig.VariableGitCommitSHA:     req.CommitSHA,
+		runconfig.VariableGitPullRequestID: req.PullRequestID,
+	}
+}
+
+// runLabels returns the labels of a run: the ones defined in the config run
+// and the automatic ones derived from the run creation event
+func runLabels(req *CreateRunRequest, runName string, configLabels map[string]string) map[string]string {
+	labels := make(map[string]string, len(configLabels)+5)
+	for k, v := range configLabels {
+		labels[k] = v
+	}
+
+	labels[LabelEventType] = string(req.RefType)
+	labels[LabelRunName] = runName
+	if req.Branch != "" {
+		labels[LabelBranch] = req.Branch
+	}
+	if req.Tag != "" {
+		labels[LabelTag] = req.Tag
+	}
+	if req.PullRequestID != "" {
+		labels[LabelPullRequestID] = req.PullRequestID
+	}
+
+	return labels
+}
+
+// runStoragePartition returns the runservice storage partition configured for
+// the organization owning the project. User runs and projects owned by users
+// use the default storage.
+func (h *ActionHandler) runStoragePartition(ctx context.Context, req *CreateRunRequest) (string, error) {
+	if len(h.orgsStoragePartitions) == 0 || req.RunType != types.RunTypeProject {
+		return "", nil
+	}
+
+	p, resp, err := h.configstoreClient.GetProject(ctx, req.Project.ID)
+	if err != nil {
+		return "", errors.Errorf("failed to get project %q: %w", req.Project.ID, ErrFromRemote(resp, err))
+	}
+	if p.OwnerType != types.ConfigTypeOrg {
+		return "", nil
+	}
+	org, resp, err := h.configstoreClient.GetOrg(ctx, p.OwnerID)
+	if err != nil {
+		return "", errors.Errorf("failed to get organization %q: %w", p.OwnerID, ErrFromRemote(resp, err))
+	}
+
+	return h.orgsStoragePartitions[org.Name], nil
+}
+
+// remoteTasksAllowedRepos returns the repositories whose remote tasks can be
+// used by the run: the run repository, the project config repository and
+// the project remote tasks repositories
+func remoteTasksAllowedRepos(req *CreateRunRequest) []string {
+	repos := []string{req.RepoPath}
+	if req.RunType == types.RunTypeProject && req.Project != nil {
+		if req.Project.ConfigRepo != nil {
+			repos = append(repos, req.Project.ConfigRepo.RepositoryPath)
+		}
+		repos = append(repos, req.Project.RemoteTasksRepos...)
+	}
+	return repos
+}
+
+func validateRemoteTasksRepos(repos []string) error {
+	for _, repo := range repos {
+		parts := strings.Split(repo, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return errors.Errorf("remote tasks repository %q must be in the OWNER/REPO format", repo)
+		}
+	}
+	return nil
+}
+
+// expandRemoteTasks fetches the remote tasks definitions, at the pinned ref,
+// used by the config tasks and expands them. Only the remote tasks of the
+// allowed repositories can be fetched.
+func (h *ActionHandler) expandRemoteTasks(gitSource gitsource.GitSource, allowedRepos []string, c *config.Config) error {
+	remoteTasks := c.RemoteTasks()
+	if len(remoteTasks) == 0 {
+		return nil
+	}
+	if err := config.CheckRemoteTasksRepos(c, allowedRepos); err != nil {
+		return err
+	}
+
+	defs := map[string]*config.TaskDefinition{}
+	for _, uses := range remoteTasks {
+		u, err := config.ParseTaskUses(uses)
+		if err != nil {
+			return err
+		}
+		data, err := gitSource.GetFile(u.RepoPath, u.Ref, u.DefinitionPath())
+		if err != nil {
+			return errors.Errorf("failed to fetch remote task %q definition: %w", uses, err)
+		}
+		def, err := config.ParseTaskDefinition(data)
+		if err != nil {
+			return errors.Errorf("remote task %q: %w", uses, err)
+		}
+		defs[uses] = def
+	}
+
+	return config.ExpandRemoteTasks(c, defs)
+}
+
+// configFile is a fetched config file
+type configFile struct {
+	path string
+	data []byte
+	// line is the line of the file start in the concatenated config data
+	line int
+}
+
+// fetchConfigFiles fetches the run config files inside the config dir of the
+// provided repository directory (empty for the repository root). When
+// configPath is provided only that config file, relative to dir, is fetched.
+// Otherwise the jsonnet and json config files take precedence, then all the
+// yaml files inside the config dir are fetched in name order.
+func (h *ActionHandler) fetchConfigFiles(gitSource gitsource.GitSource, repopath, commitSHA, dir, configPath string) ([]*configFile, error) {
+	configDir := path.Join(dir, agolaDefaultConfigDir)
+	var files []*configFile
 	err := util.ExponentialBackoff(util.FetchFileBackoff, func() (bool, error) {
-		for _, filename = range []string{agolaDefaultJsonnetConfigFile, agolaDefaultJsonConfigFile, agolaDefaultYamlConfigFile} {
-			var err error
-			data, err = gitSource.GetFile(repopath, commitSHA, path.Join(agolaDefaultConfigDir, filename))
+		if configPath != "" {
+			p := path.Join(dir, configPath)
+			data, err := gitSource.GetFile(repopath, commitSHA, p)
+			if err != nil {
+				h.log.Errorf("get file err: %v", err)
+				return false, nil
+			}
+			files = []*configFile{{path: p, data: data}}
+			return true, nil
+		}
+
+		for _, filename := range []string{agolaDefaultJsonnetConfigFile, agolaDefaultJsonConfigFile} {
+			p := path.Join(configDir, filename)
+			data, err := gitSource.GetFile(repopath, commitSHA, p)
 			if err == nil {
+				files = []*configFile{{path: p, data: data}}
 				return true, nil
 			}
 			h.log.Errorf("get file err: %v", err)
 		}
+
+		var err error
+		files, err = h.fetchYamlConfigFiles(gitSource, repopath, commitSHA, configDir)
+		if err == nil {
+			return true, nil
+		}
+		h.log.Errorf("get yaml config files err: %v", err)
 		return false, nil
 	})
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
-	return data, filename, nil
+	return files, nil
+}
+
+// hasConfig reports if the repository directory contains a config: the
+// configPath file when provided or the default config dir
+func hasConfig(gitSource gitsource.GitSource, repopath, commitSHA, dir, configPath string) bool {
+	if configPath == "" {
+		_, err := gitSource.ListFiles(repopath, commitSHA, path.Join(dir, agolaDefaultConfigDir))
+		return err == nil
+	}
+
+	p := path.Join(dir, configPath)
+	names, err := gitSource.ListFiles(repopath, commitSHA, path.Dir(p))
+	if err != nil {
+		return false
+	}
+	for _, name := range names {
+		if name == path.Base(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// projectConfigPath returns the project config file path override, empty if
+// the project uses the default config dir or the run isn't a project run
+func projectConfigPath(project *types.Project) string {
+	if project == nil {
+		return ""
+	}
+	return project.ConfigPath
+}
+
+// validateConfigPath checks that a project config path is a clean relative
+// path to a file with a supported config format extension. An empty config
+// path is valid and means that the default config dir is used.
+func validateConfigPath(configPath string) error {
+	if configPath == "" {
+		return nil
+	}
+	if path.IsAbs(configPath) || path.Clean(configPath) != configPath || strings.HasPrefix(configPath, "../") {
+		return errors.Errorf("config path %q must be a clean relative path inside the repository", configPath)
+	}
+	switch path.Ext(configPath) {
+	case ".jsonnet", ".json", ".yml":
+	default:
+		return errors.Errorf("config path %q must have a .jsonnet, .json or .yml extension", configPath)
+	}
+	return nil
+}
+
+func (h *ActionHandler) fetchYamlConfigFiles(gitSource gitsource.GitSource, repopath, commitSHA, configDir string) ([]*configFile, error) {
+	names, err := gitSource.ListFiles(repopath, commitSHA, configDir)
+	if err != nil {
+		// fallback to the default yaml config file
+		h.log.Errorf("list config dir err: %v", err)
+		names = []string{agolaDefaultYamlConfigFile}
+	}
+	sort.Strings(names)
+
+	files := []*configFile{}
+	for _, name := range names {
+		if path.Ext(name) != ".yml" {
+			continue
+		}
+		p := path.Join(configDir, name)
+		data, err := gitSource.GetFile(repopath, commitSHA, p)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, &configFile{path: p, data: data})
+	}
+	if len(files) == 0 {
+		return nil, errors.Errorf("no yaml config files in %q", configDir)
+	}
+	return files, nil
+}
+
+// concatConfigFiles concatenates the config files as separate yaml documents
+// and sets their start line
+func concatConfigFiles(files []*configFile) []byte {
+	var b bytes.Buffer
+	line := 1
+	for i, f := range files {
+		if i > 0 {
+			b.WriteString("---\n")
+			line++
+		}
+		f.line = line
+		b.Write(f.data)
+		line += bytes.Count(f.data, []byte("\n"))
+		if len(f.data) > 0 && f.data[len(f.data)-1] != '\n' {
+			b.WriteString("\n")
+			line++
+		}
+	}
+	return b.Bytes()
 }
 
 func (h *ActionHandler) genRunVariables(ctx context.Context, req *CreateRunRequest) (map[string]string, error) {
@@ -539,7 +1282,7 @@ func (h *ActionHandler) genRunVariables(ctx context.Context, req *CreateRunReque
 		// find the value match
 		var varval types.VariableValue
 		for _, varval = range pvar.Values {
-			match := types.MatchWhen(varval.When, req.Branch, req.Tag, req.Ref)
+			match := types.MatchWhen(varval.When, req.Branch, req.Tag, req.Ref, req.PullRequestAttributes)
 			if !match {
 				continue
 			}
@@ -557,3 +1300,49 @@ func (h *ActionHandler) genRunVariables(ctx context.Context, req *CreateRunReque
 
 	return variables, nil
 }
+
+type DebugRunRequest struct {
+	RunID string
+	DebugRunOptions
+}
+
+// DebugRun recreates a project run, from the same commit, overriding the
+// provided variables or using the provided config. The new run is marked as
+// a debug run. Only the project owners can create debug runs.
+func (h *ActionHandler) DebugRun(ctx context.Context, req *DebugRunRequest) error {
+	runResp, err := h.GetRun(ctx, req.RunID)
+	if err != nil {
+		return err
+	}
+	rc := runResp.RunConfig
+
+	if types.RunType(rc.Annotations[AnnotationRunType]) != types.RunTypeProject {
+		return util.NewErrBadRequest(errors.Errorf("debug runs can be created only from project runs"))
+	}
+	if rc.Annotations[AnnotationPullRequestID] != "" {
+		return util.NewErrBadRequest(errors.Errorf("debug runs cannot be created from pull request runs"))
+	}
+	if len(req.ConfigData) > 0 {
+		switch path.Ext(req.ConfigPath) {
+		case ".jsonnet", ".json", ".yml":
+		default:
+			return util.NewErrBadRequest(errors.Errorf("config path %q must have a yml, json or jsonnet extension", req.ConfigPath))
+		}
+	}
+
+	// the run ref is used only when the run isn't for a branch or a tag
+	branch, tag, ref := rc.Annotations[AnnotationBranch], rc.Annotations[AnnotationTag], ""
+	if branch == "" && tag == "" {
+		ref = rc.Annotations[AnnotationRef]
+	}
+	creq, err := h.genProjectCreateRunRequest(ctx, rc.Annotations[AnnotationProjectID], branch, tag, ref, rc.Annotations[AnnotationCommitSHA])
+	if err != nil {
+		return err
+	}
+	if cloneURL, ok := rc.Annotations[AnnotationCloneURL]; ok {
+		creq.Annotations = map[string]string{AnnotationCloneURL: cloneURL}
+	}
+	creq.Debug = &req.DebugRunOptions
+
+	return h.CreateRuns(ctx, creq)
+}
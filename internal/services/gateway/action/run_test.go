@@ -0,0 +1,139 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+const testRunConfig = `
+{
+  runs: [
+    {
+      name: 'run01',
+      tasks: [
+        {
+          name: 'task01',
+          runtime: { containers: [{ image: 'busybox' }] },
+          steps: [{ type: 'clone' }],
+        },
+      ],
+    },
+  ],
+}
+`
+
+func TestCreateRunsPatch(t *testing.T) {
+	patch := []byte("diff --git a/file01 b/file01\n")
+
+	tests := []struct {
+		name  string
+		patch []byte
+		err   bool
+	}{
+		{
+			name: "no patch",
+		},
+		{
+			name:  "empty patch",
+			patch: []byte{},
+		},
+		{
+			name:  "patch",
+			patch: patch,
+		},
+		{
+			name:  "max size patch",
+			patch: bytes.Repeat([]byte("a"), maxPatchSize),
+		},
+		{
+			name:  "too big patch",
+			patch: bytes.Repeat([]byte("a"), maxPatchSize+1),
+			err:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, getRuns, stop := newTestCreateRunsActionHandler(t)
+			defer stop()
+
+			gitSource := &testGitSource{files: map[string]string{"owner/repo@sha01:.agola/config.jsonnet": testRunConfig}}
+			// the patch is provided by the user direct runs
+			req := testCreateRunRequest(nil, gitSource)
+			req.RunType = types.RunTypeUser
+			req.User = &types.User{ID: "user01"}
+			req.RunCreationTrigger = types.RunCreationTriggerTypeManual
+			req.Patch = tt.patch
+
+			err := h.CreateRuns(context.Background(), req)
+			if tt.err {
+				if !errors.Is(err, &util.ErrBadRequest{}) {
+					t.Fatalf("expected bad request error, got: %v", err)
+				}
+				if len(getRuns()) != 0 {
+					t.Fatalf("expected no runs, got %d runs", len(getRuns()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			runs := getRuns()
+			if len(runs) != 1 {
+				t.Fatalf("expected 1 run, got %d runs", len(runs))
+			}
+			run := runs[0]
+			if len(run.SetupErrors) != 0 {
+				t.Fatalf("unexpected run setup errors: %v", run.SetupErrors)
+			}
+
+			env, ok := run.StaticEnvironment["AGOLA_GIT_PATCH"]
+			annotation := run.Annotations[AnnotationPatch]
+			if len(tt.patch) == 0 {
+				if ok {
+					t.Fatalf("unexpected AGOLA_GIT_PATCH env var")
+				}
+				if annotation != "" {
+					t.Fatalf("unexpected patch annotation")
+				}
+				return
+			}
+
+			if !ok {
+				t.Fatalf("expected AGOLA_GIT_PATCH env var")
+			}
+			data, err := base64.StdEncoding.DecodeString(env)
+			if err != nil {
+				t.Fatalf("AGOLA_GIT_PATCH isn't base64 encoded: %v", err)
+			}
+			if !bytes.Equal(data, tt.patch) {
+				t.Fatalf("wrong AGOLA_GIT_PATCH content")
+			}
+			if annotation != "true" {
+				t.Fatalf("expected patch annotation %q, got %q", "true", annotation)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+
+	rstypes "agola.io/agola/internal/services/runservice/types"
+)
+
+// GetRunConfig returns the config used to create the run and the generated
+// run config. The environment values are redacted since they could contain
+// secrets and the docker registries auth are removed.
+func (h *ActionHandler) GetRunConfig(ctx context.Context, runID string) (*rstypes.RunConfig, error) {
+	runResp, err := h.getRunCheckData(ctx, runID, RunDataConfig)
+	if err != nil {
+		return nil, err
+	}
+	rc := runResp.RunConfig
+
+	tasks := make(map[string]*rstypes.RunConfigTask, len(rc.Tasks))
+	for id, rct := range rc.Tasks {
+		tasks[id] = redactRunConfigTask(rct)
+	}
+
+	return &rstypes.RunConfig{
+		ID:           rc.ID,
+		Name:         rc.Name,
+		Group:        rc.Group,
+		SetupErrors:  rc.SetupErrors,
+		Annotations:  rc.Annotations,
+		Tasks:        tasks,
+		ConfigData:   rc.ConfigData,
+		ConfigFormat: rc.ConfigFormat,
+	}, nil
+}
+
+func redactRunConfigTask(rct *rstypes.RunConfigTask) *rstypes.RunConfigTask {
+	nrct := rct.DeepCopy()
+	redactEnvironment(nrct.Environment)
+	if nrct.Runtime != nil {
+		for _, c := range nrct.Runtime.Containers {
+			redactEnvironment(c.Environment)
+		}
+	}
+	for _, s := range nrct.Steps {
+		switch s := s.(type) {
+		case *rstypes.RunStep:
+			redactEnvironment(s.Environment)
+		case *rstypes.ParallelStep:
+			for _, rs := range s.Steps {
+				redactEnvironment(rs.Environment)
+			}
+		}
+	}
+	nrct.DockerRegistriesAuth = nil
+	return nrct
+}
+
+func redactEnvironment(env map[string]string) {
+	for k := range env {
+		env[k] = redactedValue
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	csapi "agola.io/agola/internal/services/configstore/api"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+// UpdateProjectRunDefaults sets the project run defaults. A nil runDefaults
+// removes them.
+func (h *ActionHandler) UpdateProjectRunDefaults(ctx context.Context, projectRef string, runDefaults *types.ProjectRunDefaults) (*csapi.Project, error) {
+	p, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project %q: %w", projectRef, ErrFromRemote(resp, err))
+	}
+
+	isProjectOwner, err := h.IsProjectOwner(ctx, p.OwnerType, p.OwnerID)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isProjectOwner {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	p.RunDefaults = runDefaults
+
+	h.log.Infof("updating project")
+	rp, resp, err := h.configstoreClient.UpdateProject(ctx, p.ID, p.Project)
+	if err != nil {
+		return nil, errors.Errorf("failed to update project: %w", ErrFromRemote(resp, err))
+	}
+	h.log.Infof("project %s updated, ID: %s", p.Name, p.ID)
+
+	h.recordProjectChange(ctx, rp.ID, &types.ProjectChange{
+		Action:     types.ProjectChangeActionUpdate,
+		ObjectType: types.ConfigTypeProject,
+		ObjectID:   rp.ID,
+		ObjectName: rp.Name,
+	}, rp.Project)
+
+	return rp, nil
+}
+
+// applyProjectRunDefaults sets the project default task timeout on the run
+// config tasks and checks that they respect the project max tasks, allowed
+// images and allowed archs. When the allowed archs are defined the tasks must
+// explicitly define their runtime arch since tasks without it can be executed
+// by executors of any arch.
+func applyProjectRunDefaults(rcts map[string]*rstypes.RunConfigTask, project *types.Project) error {
+	if project == nil || project.RunDefaults == nil {
+		return nil
+	}
+	rd := project.RunDefaults
+
+	if rd.MaxTasks > 0 && len(rcts) > rd.MaxTasks {
+		return errors.Errorf("run has %d tasks, more than the project max tasks %d", len(rcts), rd.MaxTasks)
+	}
+
+	allowedImages := make([]*regexp.Regexp, 0, len(rd.AllowedImages))
+	for _, expr := range rd.AllowedImages {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return errors.Errorf("wrong project allowed image regular expression %q: %w", expr, err)
+		}
+		allowedImages = append(allowedImages, re)
+	}
+
+	for _, rct := range rcts {
+		if rd.TaskTimeout > 0 {
+			rct.Timeout = rd.TaskTimeout
+		}
+		if rct.Runtime == nil {
+			continue
+		}
+		if len(rd.AllowedArchs) > 0 && !archAllowed(string(rct.Runtime.Arch), rd.AllowedArchs) {
+			if rct.Runtime.Arch == "" {
+				return errors.Errorf("task %q: runtime arch must be defined since the project run defaults restrict the allowed archs", rct.Name)
+			}
+			return errors.Errorf("task %q: arch %q not allowed by the project run defaults", rct.Name, rct.Runtime.Arch)
+		}
+		for _, c := range rct.Runtime.Containers {
+			if !imageAllowed(c.Image, allowedImages) {
+				return errors.Errorf("task %q: image %q not allowed by the project run defaults", rct.Name, c.Image)
+			}
+		}
+	}
+
+	return nil
+}
+
+func imageAllowed(image string, allowedImages []*regexp.Regexp) bool {
+	for _, re := range allowedImages {
+		if re.MatchString(image) {
+			return true
+		}
+	}
+	return false
+}
+
+func archAllowed(arch string, allowedArchs []string) bool {
+	for _, a := range allowedArchs {
+		if arch == a {
+			return true
+		}
+	}
+	return false
+}
+
+// projectArtifactsRetention returns the project artifacts retention, zero
+// when not defined
+func projectArtifactsRetention(project *types.Project) time.Duration {
+	if project == nil || project.RunDefaults == nil {
+		return 0
+	}
+	return project.RunDefaults.ArtifactsRetention
+}
@@ -0,0 +1,101 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"time"
+
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/websocket"
+	errors "golang.org/x/xerrors"
+)
+
+type RunTaskExecRequest struct {
+	RunID  string
+	TaskID string
+	Cmd    []string
+	Tty    bool
+}
+
+// RunTaskExecSession is an exec session opened inside a running task
+// container
+type RunTaskExecSession struct {
+	h      *ActionHandler
+	req    *RunTaskExecRequest
+	userID string
+	conn   *websocket.Conn
+}
+
+// RunTaskExec opens an exec session inside the main container of a running
+// project run task. Only the project members, excluding the org reporters, can
+// open it.
+func (h *ActionHandler) RunTaskExec(ctx context.Context, req *RunTaskExecRequest) (*RunTaskExecSession, error) {
+	runResp, resp, err := h.runserviceClient.GetRun(ctx, req.RunID, nil)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+	rc := runResp.RunConfig
+
+	if types.RunType(rc.Annotations[AnnotationRunType]) != types.RunTypeProject {
+		return nil, util.NewErrBadRequest(errors.Errorf("exec is available only for project runs"))
+	}
+
+	curUserID := h.CurrentUserID(ctx)
+	if curUserID == "" {
+		return nil, util.NewErrBadRequest(errors.Errorf("no logged in user"))
+	}
+
+	p, resp, err := h.configstoreClient.GetProject(ctx, rc.Annotations[AnnotationProjectID])
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+	// the org reporters can't exec since they cannot read the logs
+	isLogsReader, err := h.IsProjectLogsReader(ctx, p.OwnerType, p.OwnerID)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isLogsReader {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	conn, resp, err := h.runserviceClient.ExecRunTask(ctx, req.RunID, req.TaskID, curUserID, req.Cmd, req.Tty)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	h.log.Infow("run task exec session started", "user", curUserID, "project", p.ID, "run", req.RunID, "task", req.TaskID, "cmd", req.Cmd, "tty", req.Tty)
+
+	return &RunTaskExecSession{h: h, req: req, userID: curUserID, conn: conn}, nil
+}
+
+// Proxy proxies the client connection to the exec session until one of them
+// is closed, recording every client input in the audit log
+func (s *RunTaskExecSession) Proxy(client *websocket.Conn) {
+	defer s.conn.Close()
+
+	start := time.Now()
+	util.ProxyWebsocket(client, s.conn, func(data []byte) {
+		s.h.log.Infow("run task exec session input", "user", s.userID, "run", s.req.RunID, "task", s.req.TaskID, "input", string(data))
+	})
+	s.h.log.Infow("run task exec session ended", "user", s.userID, "run", s.req.RunID, "task", s.req.TaskID, "duration", time.Since(start))
+}
+
+// Close closes the exec session without proxying it
+func (s *RunTaskExecSession) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,152 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	rsapi "agola.io/agola/internal/services/runservice/api"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+// RunLogsArchive is a run whose logs can be written as an archive
+type RunLogsArchive struct {
+	h   *ActionHandler
+	Run *rsapi.RunResponse
+}
+
+// GetRunLogsArchive checks that the user can get the run logs and returns the
+// RunLogsArchive used to write the run logs archive
+func (h *ActionHandler) GetRunLogsArchive(ctx context.Context, runID string) (*RunLogsArchive, error) {
+	runResp, err := h.getRunCheckData(ctx, runID, RunDataLogs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RunLogsArchive{h: h, Run: runResp}, nil
+}
+
+// Write writes a gzipped tar archive containing the provided run metadata, as
+// run.json, and the logs of the last attempt of all the run tasks steps, as
+// <task name>/setup.log and <task name>/step-<step number>.log. The logs are
+// read from the logs storage (or from the executor for running tasks) while
+// writing the archive.
+func (a *RunLogsArchive) Write(ctx context.Context, w io.Writer, metadata interface{}) error {
+	r := a.Run.Run
+	rc := a.Run.RunConfig
+	dir := fmt.Sprintf("run-%d-%s", r.Counter, r.ID)
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	md, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return errors.Errorf("failed to marshal run metadata: %w", err)
+	}
+	hdr := &tar.Header{
+		Name:    path.Join(dir, "run.json"),
+		Mode:    0644,
+		Size:    int64(len(md)),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := tw.Write(md); err != nil {
+		return err
+	}
+
+	// sort tasks by name to have a stable archive
+	rcts := make([]*rstypes.RunConfigTask, 0, len(rc.Tasks))
+	for _, rct := range rc.Tasks {
+		rcts = append(rcts, rct)
+	}
+	sort.Slice(rcts, func(i, j int) bool { return rcts[i].Name < rcts[j].Name })
+
+	for _, rct := range rcts {
+		rt, ok := r.Tasks[rct.ID]
+		if !ok || rt.Status == rstypes.RunTaskStatusNotStarted || rt.Status == rstypes.RunTaskStatusSkipped {
+			continue
+		}
+
+		if err := a.writeLog(ctx, tw, path.Join(dir, rct.Name, "setup.log"), rt.ID, true, 0); err != nil {
+			return err
+		}
+		for i := range rt.Steps {
+			if err := a.writeLog(ctx, tw, path.Join(dir, rct.Name, fmt.Sprintf("step-%d.log", i)), rt.ID, false, i); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// writeLog adds a task log to the archive. Missing logs (i.e. steps not yet
+// executed) are skipped.
+func (a *RunLogsArchive) writeLog(ctx context.Context, tw *tar.Writer, name, taskID string, setup bool, step int) error {
+	resp, err := a.h.runserviceClient.GetLogs(ctx, a.Run.Run.ID, taskID, setup, step, -1, false, false)
+	if err != nil {
+		if err := ErrFromRemote(resp, err); errors.Is(err, &util.ErrNotFound{}) {
+			return nil
+		}
+		return errors.Errorf("failed to get logs for %q: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	// the tar header needs the file size so save the log to a temporary file
+	f, err := ioutil.TempFile("", "agola-runlogs")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	size, err := io.Copy(f, resp.Body)
+	if err != nil {
+		return errors.Errorf("failed to get logs for %q: %w", name, err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
@@ -0,0 +1,196 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	slog "agola.io/agola/internal/log"
+	csapi "agola.io/agola/internal/services/configstore/api"
+	rsapi "agola.io/agola/internal/services/runservice/api"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+// newTestRunLogsActionHandler returns an action handler using a fake
+// configstore with the private project01 owned by org01, where user01 is a
+// member and user02 a reporter, and a fake runservice with the project01
+// run01 and its logs.
+// The run01 task "build" has a setup log and two steps, the second without a
+// log, the task "test" has one step and the task "deploy" isn't started.
+func newTestRunLogsActionHandler(t *testing.T) (*ActionHandler, func()) {
+	writeJSON := func(w http.ResponseWriter, v interface{}) {
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+	}
+
+	csRouter := mux.NewRouter()
+	csRouter.HandleFunc("/api/v1alpha/projects/{projectref}", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, &csapi.Project{
+			Project:          &types.Project{ID: "project01", Name: "project01", Visibility: types.VisibilityPrivate},
+			OwnerType:        types.ConfigTypeOrg,
+			OwnerID:          "org01",
+			GlobalVisibility: types.VisibilityPrivate,
+		})
+	})
+	csRouter.HandleFunc("/api/v1alpha/users/{userref}/orgs", func(w http.ResponseWriter, r *http.Request) {
+		org := &types.Organization{ID: "org01", Name: "org01"}
+		userOrgs := []*csapi.UserOrgsResponse{}
+		switch mux.Vars(r)["userref"] {
+		case "user01":
+			userOrgs = append(userOrgs, &csapi.UserOrgsResponse{Organization: org, Role: types.MemberRoleMember})
+		case "user02":
+			userOrgs = append(userOrgs, &csapi.UserOrgsResponse{Organization: org, Role: types.MemberRoleReporter})
+		}
+		writeJSON(w, userOrgs)
+	})
+	cs := httptest.NewServer(csRouter)
+
+	rsRouter := mux.NewRouter()
+	rsRouter.HandleFunc("/api/v1alpha/runs/{runid}", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, &rsapi.RunResponse{
+			Run: &rstypes.Run{
+				ID:      "run01",
+				Counter: 1,
+				Group:   "/project/project01",
+				Tasks: map[string]*rstypes.RunTask{
+					"task01": {ID: "task01", Status: rstypes.RunTaskStatusFailed, Steps: []*rstypes.RunTaskStep{{}, {}}},
+					"task02": {ID: "task02", Status: rstypes.RunTaskStatusSuccess, Steps: []*rstypes.RunTaskStep{{}}},
+					"task03": {ID: "task03", Status: rstypes.RunTaskStatusNotStarted, Steps: []*rstypes.RunTaskStep{{}}},
+				},
+			},
+			RunConfig: &rstypes.RunConfig{
+				ID:    "run01",
+				Group: "/project/project01",
+				Tasks: map[string]*rstypes.RunConfigTask{
+					"task01": {ID: "task01", Name: "build"},
+					"task02": {ID: "task02", Name: "test"},
+					"task03": {ID: "task03", Name: "deploy"},
+				},
+			},
+		})
+	})
+	rsRouter.HandleFunc("/api/v1alpha/logs", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		taskID := q.Get("taskid")
+		step := "setup"
+		if _, ok := q["setup"]; !ok {
+			step = "step" + q.Get("step")
+		}
+		if taskID == "task01" && step == "step1" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, "%s %s log\n", taskID, step)
+	})
+	rs := httptest.NewServer(rsRouter)
+
+	logger := slog.New(zap.NewAtomicLevelAt(zap.FatalLevel))
+	h := NewActionHandler(logger, nil, csapi.NewClient(cs.URL), rsapi.NewClient(rs.URL), "agola", "", "", nil, nil, nil, nil, nil, nil, nil, 0)
+
+	return h, func() {
+		cs.Close()
+		rs.Close()
+	}
+}
+
+func TestGetRunLogsArchive(t *testing.T) {
+	h, stop := newTestRunLogsActionHandler(t)
+	defer stop()
+
+	t.Run("reporter", func(t *testing.T) {
+		// the reporters cannot get the logs of private projects
+		_, err := h.GetRunLogsArchive(userContext("user02"), "run01")
+		if !errors.Is(err, &util.ErrForbidden{}) {
+			t.Fatalf("expected forbidden error, got: %v", err)
+		}
+	})
+
+	t.Run("member", func(t *testing.T) {
+		ctx := userContext("user01")
+		a, err := h.GetRunLogsArchive(ctx, "run01")
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		buf := &bytes.Buffer{}
+		if err := a.Write(ctx, buf, map[string]string{"id": "run01"}); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		gr, err := gzip.NewReader(buf)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		tr := tar.NewReader(gr)
+		files := map[string]string{}
+		names := []string{}
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			names = append(names, hdr.Name)
+			files[hdr.Name] = string(data)
+		}
+
+		// the tasks are ordered by name, the not started tasks and the missing
+		// logs are skipped
+		expectedNames := []string{
+			"run-1-run01/run.json",
+			"run-1-run01/build/setup.log",
+			"run-1-run01/build/step-0.log",
+			"run-1-run01/test/setup.log",
+			"run-1-run01/test/step-0.log",
+		}
+		if diff := cmp.Diff(expectedNames, names); diff != "" {
+			t.Fatalf("archive files mismatch (-want +got):\n%s", diff)
+		}
+
+		expectedFiles := map[string]string{
+			"run-1-run01/run.json":         "{\n  \"id\": \"run01\"\n}",
+			"run-1-run01/build/setup.log":  "task01 setup log\n",
+			"run-1-run01/build/step-0.log": "task01 step0 log\n",
+			"run-1-run01/test/setup.log":   "task02 setup log\n",
+			"run-1-run01/test/step-0.log":  "task02 step0 log\n",
+		}
+		if diff := cmp.Diff(expectedFiles, files); diff != "" {
+			t.Fatalf("archive files content mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
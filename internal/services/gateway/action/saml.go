@@ -0,0 +1,199 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"time"
+
+	"agola.io/agola/internal/saml"
+	"agola.io/agola/internal/services/common"
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+// SAMLConfig is the SAML single sign on configuration
+type SAMLConfig struct {
+	SP *saml.ServiceProvider
+
+	// UsernameAttribute is the assertion attribute containing the user name,
+	// when empty the subject NameID is used
+	UsernameAttribute string
+	// EmailAttribute is the assertion attribute containing the user email
+	// whose local part is used when the user name is missing
+	EmailAttribute string
+	// AutoRegister creates the users not existing yet
+	AutoRegister bool
+}
+
+func (h *ActionHandler) samlConfig() (*SAMLConfig, error) {
+	if h.saml == nil {
+		return nil, util.NewErrNotFound(errors.Errorf("saml authentication isn't enabled"))
+	}
+	return h.saml, nil
+}
+
+// SAMLMetadata returns the service provider metadata
+func (h *ActionHandler) SAMLMetadata() ([]byte, error) {
+	c, err := h.samlConfig()
+	if err != nil {
+		return nil, err
+	}
+	return c.SP.Metadata(), nil
+}
+
+// SAMLLogin is a started saml login
+type SAMLLogin struct {
+	// URL is the identity provider url where the user is redirected to log in
+	URL string
+	// Nonce must be saved in the user browser and provided with the identity
+	// provider response
+	Nonce string
+}
+
+// SAMLLogin starts a saml login. The authentication request id and the hash of
+// the returned nonce are saved in the relay state, binding the identity
+// provider response to the browser that started the login.
+func (h *ActionHandler) SAMLLogin(ctx context.Context) (*SAMLLogin, error) {
+	c, err := h.samlConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(b)
+
+	requestID := saml.NewRequestID()
+	relayState, err := common.GenerateSAMLJWTToken(h.sd, requestID, util.EncodeSha256Hex(nonce))
+	if err != nil {
+		return nil, err
+	}
+
+	loginURL, err := c.SP.AuthnRequestURL(requestID, relayState, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &SAMLLogin{URL: loginURL, Nonce: nonce}, nil
+}
+
+// SAMLCallbackURL returns the web interface url where the user is redirected,
+// with the login token, after a successful saml login
+func (h *ActionHandler) SAMLCallbackURL(token string) string {
+	return h.webExposedURL + "/saml/callback#token=" + url.QueryEscape(token)
+}
+
+// HandleSAMLResponse validates the identity provider response received by the
+// assertion consumer service and logs in the user mapped from the assertion
+// attributes. The nonce is the one saved in the browser at the login start.
+// Every assertion is accepted only once.
+func (h *ActionHandler) HandleSAMLResponse(ctx context.Context, samlResponse, relayState, nonce string) (*LoginUserResponse, error) {
+	c, err := h.samlConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := h.parseJWTToken(relayState)
+	if err != nil {
+		return nil, util.NewErrBadRequest(errors.Errorf("invalid relay state: %w", err))
+	}
+	requestID, ok := claims["saml_request_id"].(string)
+	if !ok {
+		return nil, util.NewErrBadRequest(errors.Errorf("invalid relay state"))
+	}
+	nonceHash, ok := claims["saml_nonce_hash"].(string)
+	if !ok {
+		return nil, util.NewErrBadRequest(errors.Errorf("invalid relay state"))
+	}
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(util.EncodeSha256Hex(nonce)), []byte(nonceHash)) != 1 {
+		return nil, util.NewErrBadRequest(errors.Errorf("the saml login wasn't started by this browser"))
+	}
+
+	now := time.Now()
+	a, err := c.SP.ParseResponse(samlResponse, requestID, now)
+	if err != nil {
+		return nil, util.NewErrBadRequest(errors.Errorf("invalid saml response: %w", err))
+	}
+	// every gateway instance keeps its own cache, the nonce binding prevents
+	// the replay of the responses from other browsers
+	if err := h.samlReplayCache.Use(a, now); err != nil {
+		return nil, util.NewErrBadRequest(errors.Errorf("invalid saml response: %w", err))
+	}
+
+	userName := a.NameID
+	if c.UsernameAttribute != "" {
+		userName = a.Attribute(c.UsernameAttribute)
+	}
+	if userName == "" && c.EmailAttribute != "" {
+		email := a.Attribute(c.EmailAttribute)
+		if i := strings.Index(email, "@"); i > 0 {
+			userName = email[:i]
+		}
+	}
+	if userName == "" {
+		return nil, util.NewErrBadRequest(errors.Errorf("the saml assertion doesn't contain the user name"))
+	}
+	if !util.ValidateName(userName) {
+		return nil, util.NewErrBadRequest(errors.Errorf("invalid user name %q", userName))
+	}
+
+	user, err := h.samlUser(ctx, c, userName)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := h.generateLoginToken(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginUserResponse{
+		Token: token,
+		User:  user,
+	}, nil
+}
+
+// samlUser returns the user with the provided name, creating it when auto
+// registration is enabled
+func (h *ActionHandler) samlUser(ctx context.Context, c *SAMLConfig, userName string) (*types.User, error) {
+	user, resp, err := h.configstoreClient.GetUser(ctx, userName)
+	if err == nil {
+		return user, nil
+	}
+	if err := ErrFromRemote(resp, err); !errors.Is(err, &util.ErrNotFound{}) {
+		return nil, errors.Errorf("failed to get user %q: %w", userName, err)
+	}
+	if !c.AutoRegister {
+		return nil, util.NewErrForbidden(errors.Errorf("user %q doesn't exist", userName))
+	}
+
+	h.log.Infof("creating user %q from saml login", userName)
+	user, resp, err = h.configstoreClient.CreateUser(ctx, &csapi.CreateUserRequest{UserName: userName})
+	if err != nil {
+		return nil, errors.Errorf("failed to create user: %w", ErrFromRemote(resp, err))
+	}
+	h.log.Infof("user %s created, ID: %s", user.Name, user.ID)
+
+	return user, nil
+}
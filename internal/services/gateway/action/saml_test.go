@@ -0,0 +1,78 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"agola.io/agola/internal/saml"
+	"agola.io/agola/internal/services/common"
+	"agola.io/agola/internal/util"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	errors "golang.org/x/xerrors"
+)
+
+func TestHandleSAMLResponseNonce(t *testing.T) {
+	sd := &common.TokenSigningData{Duration: time.Hour, Method: jwt.SigningMethodHS256, Key: []byte("key01")}
+	h := &ActionHandler{
+		sd:              sd,
+		saml:            &SAMLConfig{SP: &saml.ServiceProvider{}},
+		samlReplayCache: saml.NewReplayCache(),
+	}
+
+	relayState, err := common.GenerateSAMLJWTToken(sd, "_request01", util.EncodeSha256Hex("nonce01"))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		nonce string
+		err   string
+	}{
+		{
+			name: "missing nonce",
+			err:  "the saml login wasn't started by this browser",
+		},
+		{
+			name:  "wrong nonce",
+			nonce: "nonce02",
+			err:   "the saml login wasn't started by this browser",
+		},
+		{
+			// the nonce check passes and the response is parsed
+			name:  "valid nonce",
+			nonce: "nonce01",
+			err:   "invalid saml response",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := h.HandleSAMLResponse(context.Background(), "invalid", relayState, tt.nonce)
+			var uerr *util.ErrBadRequest
+			if !errors.As(err, &uerr) {
+				t.Fatalf("expected bad request error, got: %v", err)
+			}
+			if !strings.HasPrefix(err.Error(), tt.err) {
+				t.Fatalf("expected error %q, got %q", tt.err, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"agola.io/agola/internal/services/common"
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	MaxProjectSchedules = 10
+
+	DefaultSchedulesCalendarDays = 7
+	MaxSchedulesCalendarDays     = 31
+	// maxScheduleCalendarEvents limits the calendar events of every schedule
+	maxScheduleCalendarEvents = 100
+)
+
+func validateSchedules(schedules []*types.ProjectSchedule) error {
+	if len(schedules) > MaxProjectSchedules {
+		return errors.Errorf("too many schedules, max %d", MaxProjectSchedules)
+	}
+	names := map[string]struct{}{}
+	for _, s := range schedules {
+		if s == nil {
+			return errors.Errorf("empty schedule")
+		}
+		if !util.ValidateName(s.Name) {
+			return errors.Errorf("invalid schedule name %q", s.Name)
+		}
+		if _, ok := names[s.Name]; ok {
+			return errors.Errorf("duplicate schedule name %q", s.Name)
+		}
+		names[s.Name] = struct{}{}
+		if _, err := util.ParseCronSchedule(s.Cron); err != nil {
+			return errors.Errorf("schedule %q: %w", s.Name, err)
+		}
+		if s.Branch == "" {
+			return errors.Errorf("schedule %q: empty branch", s.Name)
+		}
+	}
+	return nil
+}
+
+// RunProjectSchedules creates the runs of the project schedules activated
+// since their last check saved in lastChecks. The first check of a schedule
+// only records the current time so the activations missed while the gateway
+// wasn't running aren't recovered.
+func (h *ActionHandler) RunProjectSchedules(ctx context.Context, lastChecks map[string]time.Time) error {
+	projects, resp, err := h.configstoreClient.GetProjects(ctx, false, true)
+	if err != nil {
+		return errors.Errorf("failed to get projects: %w", ErrFromRemote(resp, err))
+	}
+
+	now := time.Now()
+	scheduleKeys := map[string]struct{}{}
+	for _, p := range projects {
+		for _, s := range p.Schedules {
+			// a changed cron expression is a new schedule
+			key := p.ID + "/" + s.Name + "/" + s.Cron
+			scheduleKeys[key] = struct{}{}
+
+			lastCheck, ok := lastChecks[key]
+			lastChecks[key] = now
+			if !ok {
+				continue
+			}
+
+			cs, err := util.ParseCronSchedule(s.Cron)
+			if err != nil {
+				h.log.Errorf("project %q schedule %q: %+v", p.ID, s.Name, err)
+				continue
+			}
+			if next := cs.Next(lastCheck); next.IsZero() || next.After(now) {
+				continue
+			}
+
+			if err := h.runProjectSchedule(ctx, p.Project, s); err != nil {
+				h.log.Errorf("failed to create run for project %q schedule %q: %+v", p.ID, s.Name, err)
+			}
+		}
+	}
+
+	// forget the schedules that don't exist anymore
+	for key := range lastChecks {
+		if _, ok := scheduleKeys[key]; !ok {
+			delete(lastChecks, key)
+		}
+	}
+
+	return nil
+}
+
+// runProjectSchedule creates the runs of the schedule branch current commit
+// using the project linked account like the repository polling
+func (h *ActionHandler) runProjectSchedule(ctx context.Context, project *types.Project, s *types.ProjectSchedule) error {
+	user, resp, err := h.configstoreClient.GetUserByLinkedAccount(ctx, project.LinkedAccountID)
+	if err != nil {
+		return errors.Errorf("failed to get user by linked account %q: %w", project.LinkedAccountID, ErrFromRemote(resp, err))
+	}
+	la := user.LinkedAccounts[project.LinkedAccountID]
+	if la == nil {
+		return errors.Errorf("linked account %q in user %q doesn't exist", project.LinkedAccountID, user.Name)
+	}
+	rs, resp, err := h.configstoreClient.GetRemoteSource(ctx, la.RemoteSourceID)
+	if err != nil {
+		return errors.Errorf("failed to get remote source %q: %w", la.RemoteSourceID, ErrFromRemote(resp, err))
+	}
+
+	gitSource, err := h.GetGitSource(ctx, rs, user.Name, la)
+	if err != nil {
+		return errors.Errorf("failed to create gitsource client: %w", err)
+	}
+
+	repoInfo, err := gitSource.GetRepoInfo(project.RepositoryPath)
+	if err != nil {
+		return errors.Errorf("failed to get repository info from gitsource: %w", err)
+	}
+
+	refName := gitSource.BranchRef(s.Branch)
+	ref, err := gitSource.GetRef(project.RepositoryPath, refName)
+	if err != nil {
+		return errors.Errorf("failed to get ref information from git source for ref %q: %w", refName, err)
+	}
+	commit, err := gitSource.GetCommit(project.RepositoryPath, ref.CommitSHA)
+	if err != nil {
+		return errors.Errorf("failed to get commit information from git source for commit sha %q: %w", ref.CommitSHA, err)
+	}
+
+	// use remotesource skipSSHHostKeyCheck config and override with project config if set to true there
+	skipSSHHostKeyCheck := rs.SkipSSHHostKeyCheck
+	if project.SkipSSHHostKeyCheck {
+		skipSSHHostKeyCheck = project.SkipSSHHostKeyCheck
+	}
+
+	req := &CreateRunRequest{
+		RunType:            types.RunTypeProject,
+		RefType:            types.RunRefTypeBranch,
+		RunCreationTrigger: types.RunCreationTriggerTypeSchedule,
+
+		Project:             project,
+		RepoPath:            project.RepositoryPath,
+		GitSource:           gitSource,
+		CommitSHA:           commit.SHA,
+		Message:             commit.Message,
+		Branch:              s.Branch,
+		Ref:                 refName,
+		SSHPrivKey:          project.SSHPrivateKey,
+		SSHHostKey:          rs.SSHHostKey,
+		SkipSSHHostKeyCheck: skipSSHHostKeyCheck,
+		CloneURL:            repoInfo.SSHCloneURL,
+
+		CommitLink: gitSource.CommitLink(repoInfo, commit.SHA),
+		BranchLink: gitSource.BranchLink(repoInfo, s.Branch),
+	}
+
+	return h.CreateRuns(ctx, req)
+}
+
+// SchedulesCalendar contains the upcoming scheduled runs of a project, used
+// to generate the project schedules iCal feed
+type SchedulesCalendar struct {
+	ID     string
+	Name   string
+	URL    string
+	Events []*SchedulesCalendarEvent
+}
+
+type SchedulesCalendarEvent struct {
+	UID         string
+	Summary     string
+	Description string
+	Start       time.Time
+}
+
+// GetProjectSchedulesCalendar returns the scheduled runs of the project in the
+// next days, sorted by start time
+func (h *ActionHandler) GetProjectSchedulesCalendar(ctx context.Context, projectRef string, days int) (*SchedulesCalendar, error) {
+	if days <= 0 {
+		days = DefaultSchedulesCalendarDays
+	}
+	if days > MaxSchedulesCalendarDays {
+		days = MaxSchedulesCalendarDays
+	}
+
+	p, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project %q: %w", projectRef, ErrFromRemote(resp, err))
+	}
+
+	group := path.Join("/", string(common.GroupTypeProject), p.ID)
+	canGetRun, err := h.CanGetRun(ctx, group)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine permissions: %w", err)
+	}
+	if !canGetRun {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	now := time.Now().UTC()
+	return projectSchedulesCalendar(h.agolaID, h.webExposedURL, p, now, now.AddDate(0, 0, days)), nil
+}
+
+func projectSchedulesCalendar(agolaID, webExposedURL string, p *csapi.Project, start, end time.Time) *SchedulesCalendar {
+	cal := &SchedulesCalendar{
+		ID:   "urn:agola:" + agolaID + ":project:" + p.ID + ":schedules",
+		Name: fmt.Sprintf("%s scheduled runs", p.Path),
+		URL:  webExposedURL,
+	}
+	for _, s := range p.Schedules {
+		cs, err := util.ParseCronSchedule(s.Cron)
+		if err != nil {
+			continue
+		}
+		t := start
+		for i := 0; i < maxScheduleCalendarEvents; i++ {
+			t = cs.Next(t)
+			if t.IsZero() || t.After(end) {
+				break
+			}
+			cal.Events = append(cal.Events, &SchedulesCalendarEvent{
+				UID:         fmt.Sprintf("%s-%s-%d@%s", p.ID, s.Name, t.Unix(), agolaID),
+				Summary:     fmt.Sprintf("%s %s run", p.Path, s.Name),
+				Description: fmt.Sprintf("Scheduled run of branch %s (%s)", s.Branch, s.Cron),
+				Start:       t,
+			})
+		}
+	}
+	sort.SliceStable(cal.Events, func(i, j int) bool {
+		return cal.Events[i].Start.Before(cal.Events[j].Start)
+	})
+
+	return cal
+}
@@ -0,0 +1,148 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/types"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValidateSchedules(t *testing.T) {
+	tooMany := []*types.ProjectSchedule{}
+	for i := 0; i <= MaxProjectSchedules; i++ {
+		tooMany = append(tooMany, &types.ProjectSchedule{Name: fmt.Sprintf("schedule%02d", i), Cron: "0 0 * * *", Branch: "master"})
+	}
+
+	tests := []struct {
+		name      string
+		schedules []*types.ProjectSchedule
+		err       bool
+	}{
+		{
+			name: "test no schedules",
+		},
+		{
+			name: "test valid schedules",
+			schedules: []*types.ProjectSchedule{
+				{Name: "nightly", Cron: "0 2 * * *", Branch: "master"},
+				{Name: "weekly", Cron: "0 4 * * 0", Branch: "release"},
+			},
+		},
+		{
+			name:      "test nil schedule",
+			schedules: []*types.ProjectSchedule{nil},
+			err:       true,
+		},
+		{
+			name:      "test invalid name",
+			schedules: []*types.ProjectSchedule{{Name: "nightly run", Cron: "0 2 * * *", Branch: "master"}},
+			err:       true,
+		},
+		{
+			name: "test duplicate name",
+			schedules: []*types.ProjectSchedule{
+				{Name: "nightly", Cron: "0 2 * * *", Branch: "master"},
+				{Name: "nightly", Cron: "0 3 * * *", Branch: "release"},
+			},
+			err: true,
+		},
+		{
+			name:      "test invalid cron",
+			schedules: []*types.ProjectSchedule{{Name: "nightly", Cron: "0 25 * * *", Branch: "master"}},
+			err:       true,
+		},
+		{
+			name:      "test empty branch",
+			schedules: []*types.ProjectSchedule{{Name: "nightly", Cron: "0 2 * * *"}},
+			err:       true,
+		},
+		{
+			name:      "test too many schedules",
+			schedules: tooMany,
+			err:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSchedules(tt.schedules)
+			if tt.err && err == nil {
+				t.Fatalf("expected error")
+			}
+			if !tt.err && err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+		})
+	}
+}
+
+func TestProjectSchedulesCalendar(t *testing.T) {
+	p := &csapi.Project{
+		Project: &types.Project{
+			ID: "project01",
+			Schedules: []*types.ProjectSchedule{
+				{Name: "nightly", Cron: "0 2 * * *", Branch: "master"},
+				{Name: "weekly", Cron: "30 1 * * 0", Branch: "release"},
+				{Name: "never", Cron: "0 0 30 2 *", Branch: "master"},
+			},
+		},
+		Path: "org/org01/project01",
+	}
+
+	// a friday
+	start := time.Date(2019, 1, 11, 10, 0, 0, 0, time.UTC)
+	cal := projectSchedulesCalendar("agola", "https://agola.example.com", p, start, start.AddDate(0, 0, 3))
+
+	expected := &SchedulesCalendar{
+		ID:   "urn:agola:agola:project:project01:schedules",
+		Name: "org/org01/project01 scheduled runs",
+		URL:  "https://agola.example.com",
+		Events: []*SchedulesCalendarEvent{
+			{
+				UID:         "project01-nightly-1547258400@agola",
+				Summary:     "org/org01/project01 nightly run",
+				Description: "Scheduled run of branch master (0 2 * * *)",
+				Start:       time.Date(2019, 1, 12, 2, 0, 0, 0, time.UTC),
+			},
+			{
+				UID:         "project01-weekly-1547343000@agola",
+				Summary:     "org/org01/project01 weekly run",
+				Description: "Scheduled run of branch release (30 1 * * 0)",
+				Start:       time.Date(2019, 1, 13, 1, 30, 0, 0, time.UTC),
+			},
+			{
+				UID:         "project01-nightly-1547344800@agola",
+				Summary:     "org/org01/project01 nightly run",
+				Description: "Scheduled run of branch master (0 2 * * *)",
+				Start:       time.Date(2019, 1, 13, 2, 0, 0, 0, time.UTC),
+			},
+			{
+				UID:         "project01-nightly-1547431200@agola",
+				Summary:     "org/org01/project01 nightly run",
+				Description: "Scheduled run of branch master (0 2 * * *)",
+				Start:       time.Date(2019, 1, 14, 2, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+	if diff := cmp.Diff(expected, cal); diff != "" {
+		t.Fatalf("calendar mismatch (-want +got):\n%s", diff)
+	}
+}
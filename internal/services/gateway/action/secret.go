@@ -73,6 +73,9 @@ func (h *ActionHandler) CreateSecret(ctx context.Context, req *CreateSecretReque
 	if !isVariableOwner {
 		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
 	}
+	if err := h.checkTwoFactorAuth(ctx); err != nil {
+		return nil, err
+	}
 
 	if !util.ValidateName(req.Name) {
 		return nil, util.NewErrBadRequest(errors.Errorf("invalid secret name %q", req.Name))
@@ -99,6 +102,15 @@ func (h *ActionHandler) CreateSecret(ctx context.Context, req *CreateSecretReque
 	}
 	h.log.Infof("secret %s created, ID: %s", rs.Name, rs.ID)
 
+	if req.ParentType == types.ConfigTypeProject {
+		h.recordProjectChange(ctx, req.ParentRef, &types.ProjectChange{
+			Action:     types.ProjectChangeActionCreate,
+			ObjectType: types.ConfigTypeSecret,
+			ObjectID:   rs.ID,
+			ObjectName: rs.Name,
+		}, rs.Secret)
+	}
+
 	return rs, nil
 }
 
@@ -128,6 +140,9 @@ func (h *ActionHandler) UpdateSecret(ctx context.Context, req *UpdateSecretReque
 	if !isVariableOwner {
 		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
 	}
+	if err := h.checkTwoFactorAuth(ctx); err != nil {
+		return nil, err
+	}
 
 	if !util.ValidateName(req.Name) {
 		return nil, util.NewErrBadRequest(errors.Errorf("invalid secret name %q", req.Name))
@@ -154,6 +169,15 @@ func (h *ActionHandler) UpdateSecret(ctx context.Context, req *UpdateSecretReque
 	}
 	h.log.Infof("secret %s updated, ID: %s", rs.Name, rs.ID)
 
+	if req.ParentType == types.ConfigTypeProject {
+		h.recordProjectChange(ctx, req.ParentRef, &types.ProjectChange{
+			Action:     types.ProjectChangeActionUpdate,
+			ObjectType: types.ConfigTypeSecret,
+			ObjectID:   rs.ID,
+			ObjectName: rs.Name,
+		}, rs.Secret)
+	}
+
 	return rs, nil
 }
 
@@ -165,6 +189,9 @@ func (h *ActionHandler) DeleteSecret(ctx context.Context, parentType types.Confi
 	if !isVariableOwner {
 		return util.NewErrForbidden(errors.Errorf("user not authorized"))
 	}
+	if err := h.checkTwoFactorAuth(ctx); err != nil {
+		return err
+	}
 
 	var resp *http.Response
 	switch parentType {
@@ -178,5 +205,13 @@ func (h *ActionHandler) DeleteSecret(ctx context.Context, parentType types.Confi
 	if err != nil {
 		return errors.Errorf("failed to delete secret: %w", ErrFromRemote(resp, err))
 	}
+
+	if parentType == types.ConfigTypeProject {
+		h.recordProjectChange(ctx, parentRef, &types.ProjectChange{
+			Action:     types.ProjectChangeActionDelete,
+			ObjectType: types.ConfigTypeSecret,
+			ObjectName: name,
+		}, nil)
+	}
 	return nil
 }
@@ -0,0 +1,97 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"agola.io/agola/internal/services/common"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	DefaultRunsStatsWindow = "7d"
+)
+
+// RunsStatsWindows are the selectable runs statistics time windows
+var RunsStatsWindows = map[string]time.Duration{
+	"1d":  24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+	"90d": 90 * 24 * time.Hour,
+}
+
+type GetProjectRunsStatsRequest struct {
+	ProjectRef string
+	// Branch, when not empty, limits the statistics to the branch runs
+	Branch string
+	// Window is one of RunsStatsWindows, defaults to DefaultRunsStatsWindow
+	Window string
+	// HotspotsLimit is the max number of failure hotspots to return
+	HotspotsLimit int
+}
+
+type GetProjectRunsStatsResponse struct {
+	Since time.Time
+	Stats *rstypes.RunsStats
+}
+
+// GetProjectRunsStats returns the statistics of the project (or project
+// branch) runs finished in the requested time window
+func (h *ActionHandler) GetProjectRunsStats(ctx context.Context, req *GetProjectRunsStatsRequest) (*GetProjectRunsStatsResponse, error) {
+	window := req.Window
+	if window == "" {
+		window = DefaultRunsStatsWindow
+	}
+	windowDuration, ok := RunsStatsWindows[window]
+	if !ok {
+		return nil, util.NewErrBadRequest(errors.Errorf("unknown window %q", window))
+	}
+
+	p, resp, err := h.configstoreClient.GetProject(ctx, req.ProjectRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project %q: %w", req.ProjectRef, ErrFromRemote(resp, err))
+	}
+
+	projectGroup := path.Join("/", string(common.GroupTypeProject), p.ID)
+	canGetRun, err := h.CanGetRun(ctx, projectGroup)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine permissions: %w", err)
+	}
+	if !canGetRun {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	group := projectGroup
+	if req.Branch != "" {
+		group = common.GenRunGroup(common.GroupTypeProject, p.ID, common.GroupTypeBranch, req.Branch)
+	}
+
+	since := time.Now().Add(-windowDuration)
+	stats, resp, err := h.runserviceClient.GetRunsStats(ctx, group, since, req.HotspotsLimit)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	return &GetProjectRunsStatsResponse{
+		Since: since,
+		Stats: stats,
+	}, nil
+}
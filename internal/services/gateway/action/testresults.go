@@ -0,0 +1,110 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"path"
+	"sort"
+
+	"agola.io/agola/internal/services/common"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+type TestResults struct {
+	Summary rstypes.TestReportSummary
+	Failed  []*rstypes.TestCase
+	Slowest []*rstypes.TestCase
+}
+
+// GetRunTaskTestResults returns the test results of a run task: the summary
+// counts, the failed tests and the slowest tests
+func (h *ActionHandler) GetRunTaskTestResults(ctx context.Context, runID, taskID string, slowest int) (*TestResults, error) {
+	runResp, err := h.getRunCheckData(ctx, runID, RunDataArtifacts)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := runResp.Run.Tasks[taskID]; !ok {
+		return nil, util.NewErrNotFound(errors.Errorf("run %q task %q doesn't exist", runID, taskID))
+	}
+
+	report, resp, err := h.runserviceClient.GetRunTaskTestReport(ctx, runID, taskID)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	res := &TestResults{
+		Summary: report.Summary,
+		Failed:  []*rstypes.TestCase{},
+		Slowest: []*rstypes.TestCase{},
+	}
+	for _, tc := range report.Tests {
+		if tc.Status == rstypes.TestCaseStatusFailed {
+			res.Failed = append(res.Failed, tc)
+		}
+	}
+
+	if slowest > 0 {
+		tests := make([]*rstypes.TestCase, len(report.Tests))
+		copy(tests, report.Tests)
+		sort.SliceStable(tests, func(i, j int) bool { return tests[i].Duration > tests[j].Duration })
+		if len(tests) > slowest {
+			tests = tests[:slowest]
+		}
+		res.Slowest = tests
+	}
+
+	return res, nil
+}
+
+type GetProjectTestCaseHistoryRequest struct {
+	ProjectRef string
+	Suite      string
+	Name       string
+	// Limit is the number of last finished runs to inspect
+	Limit int
+}
+
+// GetProjectTestCaseHistory returns the results of a test case in the last
+// finished runs of the project
+func (h *ActionHandler) GetProjectTestCaseHistory(ctx context.Context, req *GetProjectTestCaseHistoryRequest) ([]*rstypes.TestCaseHistoryEntry, error) {
+	if req.Name == "" {
+		return nil, util.NewErrBadRequest(errors.Errorf("empty test case name"))
+	}
+
+	p, resp, err := h.configstoreClient.GetProject(ctx, req.ProjectRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project %q: %w", req.ProjectRef, ErrFromRemote(resp, err))
+	}
+
+	group := path.Join("/", string(common.GroupTypeProject), p.ID)
+	canGetRunData, err := h.CanGetRunData(ctx, group, RunDataArtifacts)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine permissions: %w", err)
+	}
+	if !canGetRunData {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	entries, resp, err := h.runserviceClient.GetTestCaseHistory(ctx, group, req.Suite, req.Name, req.Limit)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,193 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"time"
+
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+// TwoFactorAuthConfig configures the users TOTP two factor authentication
+type TwoFactorAuthConfig struct {
+	// Required requires the users to enable the two factor authentication to
+	// do the sensitive operations
+	Required bool
+	// Issuer is the issuer shown by the authenticator apps
+	Issuer string
+}
+
+func (h *ActionHandler) otpCode(ctx context.Context) string {
+	otpVal := ctx.Value("otp")
+	if otpVal == nil {
+		return ""
+	}
+	return otpVal.(string)
+}
+
+// checkTwoFactorAuth checks the two factor authentication code required for
+// the sensitive operations (creating api tokens, managing secrets, approving
+// run tasks) when the user has enabled the two factor authentication. When
+// the instance requires it, the users without the two factor authentication
+// can't do these operations. Requests authenticated with the admin token
+// aren't checked.
+func (h *ActionHandler) checkTwoFactorAuth(ctx context.Context) error {
+	userID := h.CurrentUserID(ctx)
+	if userID == "" {
+		return nil
+	}
+
+	user, resp, err := h.configstoreClient.GetUser(ctx, userID)
+	if err != nil {
+		return errors.Errorf("failed to get user: %w", ErrFromRemote(resp, err))
+	}
+
+	if user.TOTP == nil || !user.TOTP.Enabled {
+		if h.twoFactorAuth.Required {
+			return util.NewErrForbidden(errors.Errorf("two factor authentication must be enabled to do this operation"))
+		}
+		return nil
+	}
+
+	code := h.otpCode(ctx)
+	if code == "" {
+		return util.NewErrUnauthorized(errors.Errorf("two factor authentication code required"))
+	}
+	res, resp, err := h.configstoreClient.CheckUserTOTPCode(ctx, user.ID, &csapi.CheckUserTOTPCodeRequest{Code: code})
+	if err != nil {
+		return errors.Errorf("failed to check two factor authentication code: %w", ErrFromRemote(resp, err))
+	}
+	if !res.Valid {
+		if res.LockedUntil != nil {
+			return util.NewErrForbidden(errors.Errorf("too many invalid two factor authentication codes, retry after %s", res.LockedUntil.Format(time.RFC3339)))
+		}
+		return util.NewErrUnauthorized(errors.Errorf("invalid two factor authentication code"))
+	}
+
+	return nil
+}
+
+// totpUser returns the user with the provided ref checking that it's the
+// logged user
+func (h *ActionHandler) totpUser(ctx context.Context, userRef string) (*types.User, error) {
+	user, resp, err := h.configstoreClient.GetUser(ctx, userRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get user: %w", ErrFromRemote(resp, err))
+	}
+	if user.ID != h.CurrentUserID(ctx) {
+		return nil, util.NewErrForbidden(errors.Errorf("logged in user cannot manage the two factor authentication of another user"))
+	}
+	return user, nil
+}
+
+type UserTOTPEnrollment struct {
+	Secret string
+	// URL is the otpauth url used to add the secret to an authenticator app
+	URL string
+}
+
+// EnrollUserTOTP generates a new TOTP secret for the user. The two factor
+// authentication is enabled only after confirming it with EnableUserTOTP.
+func (h *ActionHandler) EnrollUserTOTP(ctx context.Context, userRef string) (*UserTOTPEnrollment, error) {
+	user, err := h.totpUser(ctx, userRef)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTP != nil && user.TOTP.Enabled {
+		return nil, util.NewErrBadRequest(errors.Errorf("two factor authentication already enabled"))
+	}
+
+	secret, err := util.GenerateTOTPSecret()
+	if err != nil {
+		return nil, errors.Errorf("failed to generate totp secret: %w", err)
+	}
+
+	creq := &csapi.UpdateUserRequest{
+		TOTP: &types.UserTOTP{Secret: secret},
+	}
+	if _, resp, err := h.configstoreClient.UpdateUser(ctx, user.ID, creq); err != nil {
+		return nil, errors.Errorf("failed to update user: %w", ErrFromRemote(resp, err))
+	}
+
+	return &UserTOTPEnrollment{
+		Secret: secret,
+		URL:    util.TOTPURL(h.twoFactorAuth.Issuer, user.Name, secret),
+	}, nil
+}
+
+// EnableUserTOTP enables the user two factor authentication after checking
+// the code generated with the enrolled secret
+func (h *ActionHandler) EnableUserTOTP(ctx context.Context, userRef, code string) error {
+	user, err := h.totpUser(ctx, userRef)
+	if err != nil {
+		return err
+	}
+	if user.TOTP == nil {
+		return util.NewErrBadRequest(errors.Errorf("two factor authentication enrollment not started"))
+	}
+	if user.TOTP.Enabled {
+		return util.NewErrBadRequest(errors.Errorf("two factor authentication already enabled"))
+	}
+
+	// the configstore enables the two factor authentication when the code is
+	// valid
+	res, resp, err := h.configstoreClient.CheckUserTOTPCode(ctx, user.ID, &csapi.CheckUserTOTPCodeRequest{Code: code, Enable: true})
+	if err != nil {
+		return errors.Errorf("failed to check two factor authentication code: %w", ErrFromRemote(resp, err))
+	}
+	if !res.Valid {
+		if res.LockedUntil != nil {
+			return util.NewErrForbidden(errors.Errorf("too many invalid two factor authentication codes, retry after %s", res.LockedUntil.Format(time.RFC3339)))
+		}
+		return util.NewErrBadRequest(errors.Errorf("invalid two factor authentication code"))
+	}
+	h.log.Infof("two factor authentication enabled for user %q", user.Name)
+
+	return nil
+}
+
+// DisableUserTOTP disables the user two factor authentication. The user must
+// provide a valid code while admins can disable it for any user (i.e. when
+// the user has lost its device).
+func (h *ActionHandler) DisableUserTOTP(ctx context.Context, userRef string) error {
+	user, resp, err := h.configstoreClient.GetUser(ctx, userRef)
+	if err != nil {
+		return errors.Errorf("failed to get user: %w", ErrFromRemote(resp, err))
+	}
+
+	if !h.IsUserAdmin(ctx) {
+		if user.ID != h.CurrentUserID(ctx) {
+			return util.NewErrForbidden(errors.Errorf("logged in user cannot manage the two factor authentication of another user"))
+		}
+		if err := h.checkTwoFactorAuth(ctx); err != nil {
+			return err
+		}
+	}
+
+	creq := &csapi.UpdateUserRequest{
+		TOTP: &types.UserTOTP{},
+	}
+	if _, resp, err := h.configstoreClient.UpdateUser(ctx, user.ID, creq); err != nil {
+		return errors.Errorf("failed to update user: %w", ErrFromRemote(resp, err))
+	}
+	h.log.Infof("two factor authentication disabled for user %q", user.Name)
+
+	return nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+// GetProjectGroupTrashItems returns the deleted projects and project groups
+// that were inside the project group and can still be restored. Only the
+// project group owners can list them.
+func (h *ActionHandler) GetProjectGroupTrashItems(ctx context.Context, projectGroupRef string) ([]*types.TrashItem, error) {
+	pg, resp, err := h.configstoreClient.GetProjectGroup(ctx, projectGroupRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project group %q: %w", projectGroupRef, ErrFromRemote(resp, err))
+	}
+
+	isProjectOwner, err := h.IsProjectOwner(ctx, pg.OwnerType, pg.OwnerID)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isProjectOwner {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	tis, resp, err := h.configstoreClient.GetProjectGroupTrashItems(ctx, pg.ID)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project group %q trash items: %w", projectGroupRef, ErrFromRemote(resp, err))
+	}
+
+	return tis, nil
+}
+
+// RestoreTrashItem restores a deleted project or project group with all its
+// childs, secrets and variables. The git source repositories of all the
+// restored projects are configured again since they are cleaned up on project
+// deletion and on purge.
+func (h *ActionHandler) RestoreTrashItem(ctx context.Context, trashItemID string) (*types.TrashItem, error) {
+	ti, resp, err := h.configstoreClient.GetTrashItem(ctx, trashItemID)
+	if err != nil {
+		return nil, errors.Errorf("failed to get trash item %q: %w", trashItemID, ErrFromRemote(resp, err))
+	}
+
+	isProjectOwner, err := h.IsProjectOwner(ctx, ti.OwnerType, ti.OwnerID)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isProjectOwner {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	h.log.Infof("restoring %s %q", ti.ObjectType, ti.Path)
+	ti, resp, err = h.configstoreClient.RestoreTrashItem(ctx, trashItemID)
+	if err != nil {
+		return nil, errors.Errorf("failed to restore trash item %q: %w", trashItemID, ErrFromRemote(resp, err))
+	}
+	h.refCache.purge()
+
+	// try to setup the git source repos of all the restored projects
+	// we'll log but ignore errors
+	for _, p := range ti.Projects {
+		if err := h.restoreGitSourceRepo(ctx, p); err != nil {
+			h.log.Errorf("failed to setup git source repo of project %q: %+v", p.ID, err)
+		}
+	}
+
+	return ti, nil
+}
+
+func (h *ActionHandler) restoreGitSourceRepo(ctx context.Context, p *types.Project) error {
+	if p.RemoteRepositoryConfigType != types.RemoteRepositoryConfigTypeRemoteSource {
+		return nil
+	}
+
+	user, rs, la, err := h.getRemoteRepoAccessData(ctx, p.LinkedAccountID)
+	if err != nil {
+		return errors.Errorf("failed to get remote repo access data: %w", err)
+	}
+
+	return h.setupGitSourceRepo(ctx, rs, user, la, &csapi.Project{Project: p})
+}
+
+// PurgeTrashItems permanently removes the trash items older than the
+// configstore trash retention after cleaning up the git source repositories
+// (deploy keys and webhooks) of their projects
+func (h *ActionHandler) PurgeTrashItems(ctx context.Context) error {
+	tis, resp, err := h.configstoreClient.GetExpiredTrashItems(ctx)
+	if err != nil {
+		return errors.Errorf("failed to get expired trash items: %w", ErrFromRemote(resp, err))
+	}
+
+	for _, ti := range tis {
+		// try to cleanup the git source repos
+		// we'll log but ignore errors
+		for _, p := range ti.Projects {
+			if err := h.purgeGitSourceRepo(ctx, p); err != nil {
+				h.log.Errorf("failed to cleanup git source repo of project %q: %+v", p.ID, err)
+			}
+		}
+
+		if resp, err := h.configstoreClient.PurgeTrashItem(ctx, ti.ID); err != nil {
+			return errors.Errorf("failed to purge trash item %q: %w", ti.ID, ErrFromRemote(resp, err))
+		}
+		h.log.Infof("purged trash item %q of %s %q", ti.ID, ti.ObjectType, ti.Path)
+	}
+
+	return nil
+}
+
+func (h *ActionHandler) purgeGitSourceRepo(ctx context.Context, p *types.Project) error {
+	if p.RemoteRepositoryConfigType != types.RemoteRepositoryConfigTypeRemoteSource {
+		return nil
+	}
+
+	user, rs, la, err := h.getRemoteRepoAccessData(ctx, p.LinkedAccountID)
+	if err != nil {
+		return errors.Errorf("failed to get remote repo access data: %w", err)
+	}
+
+	return h.cleanupGitSourceRepo(ctx, rs, user, la, &csapi.Project{Project: p})
+}
@@ -0,0 +1,134 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	slog "agola.io/agola/internal/log"
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/types"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// newTestTrashActionHandler returns an action handler using a fake
+// configstore serving the provided trash item. The linked accounts of the
+// projects don't exist anymore so the git source repos setup and cleanup fail
+// after getting the linked account user. The returned func returns the
+// recorded configstore calls.
+func newTestTrashActionHandler(t *testing.T, ti *types.TrashItem) (*ActionHandler, func() []string, func()) {
+	var mu sync.Mutex
+	var calls []string
+	addCall := func(call string) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, call)
+	}
+	writeJSON := func(w http.ResponseWriter, v interface{}) {
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+	}
+
+	csRouter := mux.NewRouter()
+	csRouter.HandleFunc("/api/v1alpha/expiredtrashitems", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, []*types.TrashItem{ti})
+	}).Methods("GET")
+	csRouter.HandleFunc("/api/v1alpha/trashitems/{trashitemid}", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, ti)
+	}).Methods("GET")
+	csRouter.HandleFunc("/api/v1alpha/trashitems/{trashitemid}/restore", func(w http.ResponseWriter, r *http.Request) {
+		addCall("restore " + mux.Vars(r)["trashitemid"])
+		writeJSON(w, ti)
+	}).Methods("POST")
+	csRouter.HandleFunc("/api/v1alpha/trashitems/{trashitemid}", func(w http.ResponseWriter, r *http.Request) {
+		addCall("purge " + mux.Vars(r)["trashitemid"])
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods("DELETE")
+	csRouter.HandleFunc("/api/v1alpha/users", func(w http.ResponseWriter, r *http.Request) {
+		addCall("getuser " + r.URL.Query().Get("linkedaccountid"))
+		http.Error(w, "", http.StatusNotFound)
+	}).Methods("GET")
+	cs := httptest.NewServer(csRouter)
+
+	logger := slog.New(zap.NewAtomicLevelAt(zap.FatalLevel))
+	h := NewActionHandler(logger, nil, csapi.NewClient(cs.URL), nil, "agola", "", "", nil, nil, nil, nil, nil, nil, nil, 0)
+
+	getCalls := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls
+	}
+	return h, getCalls, cs.Close
+}
+
+func testTrashItem() *types.TrashItem {
+	return &types.TrashItem{
+		ID:         "trashitem01",
+		ObjectType: types.ConfigTypeProjectGroup,
+		OwnerType:  types.ConfigTypeOrg,
+		OwnerID:    "org01",
+		ProjectGroups: []*types.ProjectGroup{
+			{ID: "projectgroup01"},
+			{ID: "subprojectgroup01"},
+		},
+		Projects: []*types.Project{
+			{ID: "project01", RemoteRepositoryConfigType: types.RemoteRepositoryConfigTypeRemoteSource, LinkedAccountID: "linkedaccount01"},
+			{ID: "project02", RemoteRepositoryConfigType: types.RemoteRepositoryConfigTypeManual},
+			{ID: "project03", RemoteRepositoryConfigType: types.RemoteRepositoryConfigTypeRemoteSource, LinkedAccountID: "linkedaccount02"},
+		},
+	}
+}
+
+func TestRestoreTrashItem(t *testing.T) {
+	h, getCalls, stop := newTestTrashActionHandler(t, testTrashItem())
+	defer stop()
+
+	ctx := context.WithValue(context.Background(), "admin", true)
+	if _, err := h.RestoreTrashItem(ctx, "trashitem01"); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// the git source repos of all the remote source projects of the restored
+	// subtree are set up again
+	expectedCalls := []string{"restore trashitem01", "getuser linkedaccount01", "getuser linkedaccount02"}
+	if diff := cmp.Diff(expectedCalls, getCalls()); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestPurgeTrashItems(t *testing.T) {
+	h, getCalls, stop := newTestTrashActionHandler(t, testTrashItem())
+	defer stop()
+
+	if err := h.PurgeTrashItems(context.Background()); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// the git source repos cleanup of the remote source projects is tried
+	// before the purge and its failure doesn't block the purge
+	expectedCalls := []string{"getuser linkedaccount01", "getuser linkedaccount02", "purge trashitem01"}
+	if diff := cmp.Diff(expectedCalls, getCalls()); diff != "" {
+		t.Error(diff)
+	}
+}
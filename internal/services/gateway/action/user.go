@@ -106,6 +106,9 @@ func (h *ActionHandler) CreateUser(ctx context.Context, req *CreateUserRequest)
 type CreateUserTokenRequest struct {
 	UserRef   string
 	TokenName string
+
+	Scopes    []types.TokenScope
+	ExpiresAt time.Time
 }
 
 func (h *ActionHandler) CreateUserToken(ctx context.Context, req *CreateUserTokenRequest) (string, error) {
@@ -134,10 +137,23 @@ func (h *ActionHandler) CreateUserToken(ctx context.Context, req *CreateUserToke
 	if _, ok := user.Tokens[req.TokenName]; ok {
 		return "", util.NewErrBadRequest(errors.Errorf("user %q already have a token with name %q", userRef, req.TokenName))
 	}
+	for _, scope := range req.Scopes {
+		if !types.IsValidTokenScope(scope) {
+			return "", util.NewErrBadRequest(errors.Errorf("invalid token scope %q", scope))
+		}
+	}
+	if !req.ExpiresAt.IsZero() && !req.ExpiresAt.After(time.Now()) {
+		return "", util.NewErrBadRequest(errors.Errorf("token expiration must be in the future"))
+	}
+	if err := h.checkTwoFactorAuth(ctx); err != nil {
+		return "", err
+	}
 
 	h.log.Infof("creating user token")
 	creq := &csapi.CreateUserTokenRequest{
 		TokenName: req.TokenName,
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
 	}
 	res, resp, err := h.configstoreClient.CreateUserToken(ctx, userRef, creq)
 	if err != nil {
@@ -148,6 +164,53 @@ func (h *ActionHandler) CreateUserToken(ctx context.Context, req *CreateUserToke
 	return res.Token, nil
 }
 
+// UserTokenInfo is the user token used to authenticate the request
+type UserTokenInfo struct {
+	User      *types.User
+	TokenName string
+	Scopes    []types.TokenScope
+	ExpiresAt time.Time
+}
+
+func (h *ActionHandler) GetCurrentUserToken(ctx context.Context) (*UserTokenInfo, error) {
+	var userID string
+	userIDVal := ctx.Value("userid")
+	if userIDVal != nil {
+		userID = userIDVal.(string)
+	}
+	var tokenName string
+	tokenNameVal := ctx.Value("tokenname")
+	if tokenNameVal != nil {
+		tokenName = tokenNameVal.(string)
+	}
+	if userID == "" || tokenName == "" {
+		return nil, util.NewErrBadRequest(errors.Errorf("request not authenticated with a user token"))
+	}
+
+	user, resp, err := h.configstoreClient.GetUser(ctx, userID)
+	if err != nil {
+		return nil, errors.Errorf("failed to get user: %w", ErrFromRemote(resp, err))
+	}
+	if _, ok := user.Tokens[tokenName]; !ok {
+		return nil, util.NewErrNotFound(errors.Errorf("token %q for user %q doesn't exist", tokenName, user.Name))
+	}
+
+	info := &UserTokenInfo{
+		User:      user,
+		TokenName: tokenName,
+		// tokens without scopes have all the scopes
+		Scopes: []types.TokenScope{types.TokenScopeAdmin},
+	}
+	if ti, ok := user.TokensInfo[tokenName]; ok {
+		if len(ti.Scopes) > 0 {
+			info.Scopes = ti.Scopes
+		}
+		info.ExpiresAt = ti.ExpiresAt
+	}
+
+	return info, nil
+}
+
 type CreateUserLARequest struct {
 	UserRef string
 
@@ -300,10 +363,7 @@ type RegisterUserRequest struct {
 }
 
 func (h *ActionHandler) RegisterUser(ctx context.Context, req *RegisterUserRequest) (*types.User, error) {
-	if req.UserName == "" {
-		return nil, util.NewErrBadRequest(errors.Errorf("user name required"))
-	}
-	if !util.ValidateName(req.UserName) {
+	if req.UserName != "" && !util.ValidateName(req.UserName) {
 		return nil, util.NewErrBadRequest(errors.Errorf("invalid user name %q", req.UserName))
 	}
 
@@ -332,8 +392,17 @@ func (h *ActionHandler) RegisterUser(ctx context.Context, req *RegisterUserReque
 		return nil, errors.Errorf("empty remote user id for remote source %q", rs.ID)
 	}
 
+	userName := req.UserName
+	if userName == "" {
+		// derive the user name from the remote login name
+		userName = common.MapUserName(rs, remoteUserInfo.LoginName)
+		if !util.ValidateName(userName) {
+			return nil, util.NewErrBadRequest(errors.Errorf("cannot map remote login name %q to a valid user name, got %q", remoteUserInfo.LoginName, userName))
+		}
+	}
+
 	creq := &csapi.CreateUserRequest{
-		UserName: req.UserName,
+		UserName: userName,
 		CreateUserLARequest: &csapi.CreateUserLARequest{
 			RemoteSourceName:           req.RemoteSourceName,
 			RemoteUserID:               remoteUserInfo.ID,
@@ -350,7 +419,7 @@ func (h *ActionHandler) RegisterUser(ctx context.Context, req *RegisterUserReque
 	if err != nil {
 		return nil, errors.Errorf("failed to create linked account: %w", ErrFromRemote(resp, err))
 	}
-	h.log.Infof("user %q created", req.UserName)
+	h.log.Infof("user %q created", userName)
 
 	return u, nil
 }
@@ -436,8 +505,14 @@ func (h *ActionHandler) LoginUser(ctx context.Context, req *LoginUserRequest) (*
 		h.log.Infof("linked account %q for user %q updated", la.ID, user.Name)
 	}
 
+	if h.orgSync != nil && h.orgSync.OnLogin {
+		if err := h.SyncUserOrgs(ctx, user); err != nil {
+			h.log.Errorf("failed to sync user %q organizations: %+v", user.Name, err)
+		}
+	}
+
 	// generate jwt token
-	token, err := common.GenerateLoginJWTToken(h.sd, user.ID)
+	token, err := h.generateLoginToken(ctx, user.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -704,8 +779,10 @@ func (h *ActionHandler) HandleRemoteSourceAuthRequest(ctx context.Context, reque
 	}
 }
 
-func (h *ActionHandler) HandleOauth2Callback(ctx context.Context, code, state string) (*RemoteSourceAuthResult, error) {
-	token, err := jwt.Parse(state, func(token *jwt.Token) (interface{}, error) {
+// parseJWTToken parses and validates a token generated by the gateway and
+// returns its claims
+func (h *ActionHandler) parseJWTToken(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if token.Method != h.sd.Method {
 			return nil, errors.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
@@ -727,7 +804,15 @@ func (h *ActionHandler) HandleOauth2Callback(ctx context.Context, code, state st
 		return nil, errors.Errorf("invalid token")
 	}
 
-	claims := token.Claims.(jwt.MapClaims)
+	return token.Claims.(jwt.MapClaims), nil
+}
+
+func (h *ActionHandler) HandleOauth2Callback(ctx context.Context, code, state string) (*RemoteSourceAuthResult, error) {
+	claims, err := h.parseJWTToken(state)
+	if err != nil {
+		return nil, err
+	}
+
 	remoteSourceName := claims["remote_source_name"].(string)
 	requestType := RemoteSourceRequestType(claims["request_type"].(string))
 	requestString := claims["request"].(string)
@@ -759,6 +844,8 @@ func (h *ActionHandler) DeleteUser(ctx context.Context, userRef string) error {
 	if err != nil {
 		return errors.Errorf("failed to delete user: %w", ErrFromRemote(resp, err))
 	}
+	h.refCache.purge()
+
 	return nil
 }
 
@@ -792,7 +879,7 @@ func (h *ActionHandler) DeleteUserToken(ctx context.Context, userRef, tokenName
 		return errors.Errorf("user not logged in")
 	}
 
-	isAdmin := !h.IsUserAdmin(ctx)
+	isAdmin := h.IsUserAdmin(ctx)
 	curUserID := h.CurrentUserID(ctx)
 
 	user, resp, err := h.configstoreClient.GetUser(ctx, userRef)
@@ -800,7 +887,7 @@ func (h *ActionHandler) DeleteUserToken(ctx context.Context, userRef, tokenName
 		return errors.Errorf("failed to get user %q: %w", userRef, ErrFromRemote(resp, err))
 	}
 
-	// only admin or the same logged user can create a token
+	// only admin or the same logged user can delete a token
 	if !isAdmin && user.ID != curUserID {
 		return util.NewErrBadRequest(errors.Errorf("logged in user cannot delete token for another user"))
 	}
@@ -818,6 +905,7 @@ type UserCreateRunRequest struct {
 	Branch    string
 	CommitSHA string
 	Message   string
+	Patch     []byte
 }
 
 func (h *ActionHandler) UserCreateRun(ctx context.Context, req *UserCreateRunRequest) error {
@@ -839,7 +927,6 @@ func (h *ActionHandler) UserCreateRun(ctx context.Context, req *UserCreateRunReq
 	if repoParts[0] != user.ID {
 		return util.NewErrUnauthorized(errors.Errorf("repo %q not owned", req.RepoPath))
 	}
-
 	gitSource := agolagit.New(h.apiExposedURL + "/repos")
 	cloneURL := fmt.Sprintf("%s/%s.git", h.apiExposedURL+"/repos", req.RepoPath)
 
@@ -866,6 +953,7 @@ func (h *ActionHandler) UserCreateRun(ctx context.Context, req *UserCreateRunReq
 		PullRequestLink: "",
 
 		UserRunRepoUUID: req.RepoUUID,
+		Patch:           req.Patch,
 	}
 
 	return h.CreateRuns(ctx, creq)
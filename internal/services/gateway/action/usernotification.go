@@ -0,0 +1,137 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"fmt"
+
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+func (h *ActionHandler) GetUserNotifications(ctx context.Context, unreadOnly bool, limit int) ([]*types.UserNotification, error) {
+	userID := h.CurrentUserID(ctx)
+	if userID == "" {
+		return nil, util.NewErrBadRequest(errors.Errorf("user not authenticated"))
+	}
+
+	uns, resp, err := h.configstoreClient.GetUserNotifications(ctx, userID, unreadOnly, limit)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+	return uns, nil
+}
+
+func (h *ActionHandler) GetUserNotificationsUnreadCount(ctx context.Context) (int, error) {
+	userID := h.CurrentUserID(ctx)
+	if userID == "" {
+		return 0, util.NewErrBadRequest(errors.Errorf("user not authenticated"))
+	}
+
+	count, resp, err := h.configstoreClient.GetUserNotificationsUnreadCount(ctx, userID)
+	if err != nil {
+		return 0, ErrFromRemote(resp, err)
+	}
+	return count, nil
+}
+
+// MarkUserNotificationsRead marks the provided current user notifications as
+// read. When no notification ids are provided all the notifications are marked
+// as read
+func (h *ActionHandler) MarkUserNotificationsRead(ctx context.Context, userNotificationIDs []string) error {
+	userID := h.CurrentUserID(ctx)
+	if userID == "" {
+		return util.NewErrBadRequest(errors.Errorf("user not authenticated"))
+	}
+
+	req := &csapi.MarkUserNotificationsReadRequest{
+		IDs: userNotificationIDs,
+	}
+	if resp, err := h.configstoreClient.MarkUserNotificationsRead(ctx, userID, req); err != nil {
+		return errors.Errorf("failed to mark user notifications as read: %w", ErrFromRemote(resp, err))
+	}
+	return nil
+}
+
+// WatchProject adds the project to the current user watched projects. The
+// project must be visible to the user.
+func (h *ActionHandler) WatchProject(ctx context.Context, projectRef string) error {
+	return h.updateWatchedProject(ctx, projectRef, true)
+}
+
+func (h *ActionHandler) UnwatchProject(ctx context.Context, projectRef string) error {
+	return h.updateWatchedProject(ctx, projectRef, false)
+}
+
+func (h *ActionHandler) updateWatchedProject(ctx context.Context, projectRef string, watch bool) error {
+	userID := h.CurrentUserID(ctx)
+	if userID == "" {
+		return util.NewErrBadRequest(errors.Errorf("user not authenticated"))
+	}
+
+	user, resp, err := h.configstoreClient.GetUser(ctx, userID)
+	if err != nil {
+		return errors.Errorf("failed to get user: %w", ErrFromRemote(resp, err))
+	}
+	project, err := h.GetProject(ctx, projectRef)
+	if err != nil {
+		return errors.Errorf("failed to get project %q: %w", projectRef, err)
+	}
+
+	if user.IsWatchingProject(project.ID) == watch {
+		return nil
+	}
+
+	watchedProjects := []string{}
+	for _, id := range user.WatchedProjects {
+		if id != project.ID {
+			watchedProjects = append(watchedProjects, id)
+		}
+	}
+	if watch {
+		watchedProjects = append(watchedProjects, project.ID)
+	}
+
+	creq := &csapi.UpdateUserRequest{
+		WatchedProjects: &watchedProjects,
+	}
+	if _, resp, err := h.configstoreClient.UpdateUser(ctx, user.ID, creq); err != nil {
+		return errors.Errorf("failed to update user: %w", ErrFromRemote(resp, err))
+	}
+
+	return nil
+}
+
+// addOrgInvitationNotification adds a notification to the inbox of a user
+// added to an organization by another user
+func (h *ActionHandler) addOrgInvitationNotification(ctx context.Context, org *types.Organization, user *types.User, role types.MemberRole) {
+	if user.ID == h.CurrentUserID(ctx) {
+		return
+	}
+
+	un := &types.UserNotification{
+		Type:    types.UserNotificationTypeOrgInvitation,
+		Title:   fmt.Sprintf("You have been added to the organization %s", org.Name),
+		Message: fmt.Sprintf("role: %s", role),
+		OrgID:   org.ID,
+	}
+	if _, resp, err := h.configstoreClient.CreateUserNotification(ctx, user.ID, un); err != nil {
+		h.log.Errorf("failed to add org invitation notification to user %q inbox: %+v", user.Name, ErrFromRemote(resp, err))
+	}
+}
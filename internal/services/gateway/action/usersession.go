@@ -0,0 +1,174 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"agola.io/agola/internal/services/common"
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+type UserSessionType string
+
+const (
+	UserSessionTypeLogin UserSessionType = "login"
+	UserSessionTypeToken UserSessionType = "token"
+)
+
+// UserSession is a user login session or api token
+type UserSession struct {
+	Type UserSessionType
+	// ID is the login session id or the token name
+	ID string
+
+	Scopes     []types.TokenScope
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastUsedAt time.Time
+	LastUsedIP string
+
+	// Current reports if the session is the one used by the request
+	Current bool
+}
+
+// generateLoginToken creates a new user session and returns the login token
+// referencing it
+func (h *ActionHandler) generateLoginToken(ctx context.Context, userID string) (string, error) {
+	creq := &csapi.CreateUserSessionRequest{
+		ExpiresAt: time.Now().Add(h.sd.Duration),
+	}
+	res, resp, err := h.configstoreClient.CreateUserSession(ctx, userID, creq)
+	if err != nil {
+		return "", errors.Errorf("failed to create user session: %w", ErrFromRemote(resp, err))
+	}
+
+	return common.GenerateLoginJWTToken(h.sd, userID, res.SessionID)
+}
+
+// getSessionsUser returns the user whose sessions are managed. Only admins or
+// the same logged user can manage the user sessions
+func (h *ActionHandler) getSessionsUser(ctx context.Context, userRef string) (*types.User, error) {
+	if !h.IsUserLoggedOrAdmin(ctx) {
+		return nil, errors.Errorf("user not logged in")
+	}
+
+	user, resp, err := h.configstoreClient.GetUser(ctx, userRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get user %q: %w", userRef, ErrFromRemote(resp, err))
+	}
+
+	if !h.IsUserAdmin(ctx) && user.ID != h.CurrentUserID(ctx) {
+		return nil, util.NewErrForbidden(errors.Errorf("logged in user cannot manage sessions of another user"))
+	}
+
+	return user, nil
+}
+
+// GetUserSessions returns the user active login sessions and api tokens
+func (h *ActionHandler) GetUserSessions(ctx context.Context, userRef string) ([]*UserSession, error) {
+	user, err := h.getSessionsUser(ctx, userRef)
+	if err != nil {
+		return nil, err
+	}
+
+	var curSessionID, curTokenName string
+	if user.ID == h.CurrentUserID(ctx) {
+		curSessionID, _ = ctx.Value("sessionid").(string)
+		curTokenName, _ = ctx.Value("tokenname").(string)
+	}
+
+	now := time.Now()
+	sessions := []*UserSession{}
+	for id, s := range user.Sessions {
+		if s.IsExpired(now) {
+			continue
+		}
+		sessions = append(sessions, &UserSession{
+			Type:       UserSessionTypeLogin,
+			ID:         id,
+			CreatedAt:  s.CreatedAt,
+			ExpiresAt:  s.ExpiresAt,
+			LastUsedAt: s.LastUsedAt,
+			LastUsedIP: s.LastUsedIP,
+			Current:    id == curSessionID,
+		})
+	}
+	for name := range user.Tokens {
+		ti := user.TokensInfo[name]
+		if ti.IsExpired(now) {
+			continue
+		}
+		s := &UserSession{
+			Type:    UserSessionTypeToken,
+			ID:      name,
+			Scopes:  []types.TokenScope{types.TokenScopeAdmin},
+			Current: name == curTokenName,
+		}
+		if ti != nil {
+			if len(ti.Scopes) > 0 {
+				s.Scopes = ti.Scopes
+			}
+			s.CreatedAt = ti.CreatedAt
+			s.ExpiresAt = ti.ExpiresAt
+			s.LastUsedAt = ti.LastUsedAt
+			s.LastUsedIP = ti.LastUsedIP
+		}
+		sessions = append(sessions, s)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].Type != sessions[j].Type {
+			return sessions[i].Type < sessions[j].Type
+		}
+		return sessions[i].ID < sessions[j].ID
+	})
+
+	return sessions, nil
+}
+
+func (h *ActionHandler) DeleteUserSession(ctx context.Context, userRef, sessionID string) error {
+	user, err := h.getSessionsUser(ctx, userRef)
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.configstoreClient.DeleteUserSession(ctx, user.ID, sessionID)
+	if err != nil {
+		return errors.Errorf("failed to delete user session: %w", ErrFromRemote(resp, err))
+	}
+	return nil
+}
+
+// DeleteUserSessions revokes all the user login sessions and api tokens
+func (h *ActionHandler) DeleteUserSessions(ctx context.Context, userRef string) error {
+	user, err := h.getSessionsUser(ctx, userRef)
+	if err != nil {
+		return err
+	}
+
+	h.log.Infof("revoking all sessions and tokens of user %q", user.Name)
+	resp, err := h.configstoreClient.DeleteUserSessions(ctx, user.ID)
+	if err != nil {
+		return errors.Errorf("failed to delete user sessions: %w", ErrFromRemote(resp, err))
+	}
+	return nil
+}
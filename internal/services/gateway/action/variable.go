@@ -138,6 +138,15 @@ func (h *ActionHandler) CreateVariable(ctx context.Context, req *CreateVariableR
 	}
 	h.log.Infof("variable %s created, ID: %s", rv.Name, rv.ID)
 
+	if req.ParentType == types.ConfigTypeProject {
+		h.recordProjectChange(ctx, req.ParentRef, &types.ProjectChange{
+			Action:     types.ProjectChangeActionCreate,
+			ObjectType: types.ConfigTypeVariable,
+			ObjectID:   rv.ID,
+			ObjectName: rv.Name,
+		}, rv.Variable)
+	}
+
 	return rv, cssecrets, nil
 }
 
@@ -211,6 +220,15 @@ func (h *ActionHandler) UpdateVariable(ctx context.Context, req *UpdateVariableR
 	}
 	h.log.Infof("variable %s created, ID: %s", rv.Name, rv.ID)
 
+	if req.ParentType == types.ConfigTypeProject {
+		h.recordProjectChange(ctx, req.ParentRef, &types.ProjectChange{
+			Action:     types.ProjectChangeActionUpdate,
+			ObjectType: types.ConfigTypeVariable,
+			ObjectID:   rv.ID,
+			ObjectName: rv.Name,
+		}, rv.Variable)
+	}
+
 	return rv, cssecrets, nil
 }
 
@@ -235,5 +253,13 @@ func (h *ActionHandler) DeleteVariable(ctx context.Context, parentType types.Con
 	if err != nil {
 		return errors.Errorf("failed to delete variable: %w", ErrFromRemote(resp, err))
 	}
+
+	if parentType == types.ConfigTypeProject {
+		h.recordProjectChange(ctx, parentRef, &types.ProjectChange{
+			Action:     types.ProjectChangeActionDelete,
+			ObjectType: types.ConfigTypeVariable,
+			ObjectName: name,
+		}, nil)
+	}
 	return nil
 }
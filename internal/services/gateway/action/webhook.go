@@ -0,0 +1,60 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+func (h *ActionHandler) GetFailedWebhooks(ctx context.Context) ([]*rstypes.FailedWebhook, error) {
+	if !h.IsUserAdmin(ctx) {
+		return nil, util.NewErrForbidden(errors.Errorf("user not admin"))
+	}
+
+	fws, resp, err := h.runserviceClient.GetFailedWebhooks(ctx)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+	return fws, nil
+}
+
+func (h *ActionHandler) GetFailedWebhook(ctx context.Context, id string) (*rstypes.FailedWebhook, error) {
+	if !h.IsUserAdmin(ctx) {
+		return nil, util.NewErrForbidden(errors.Errorf("user not admin"))
+	}
+
+	fw, resp, err := h.runserviceClient.GetFailedWebhook(ctx, id)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+	return fw, nil
+}
+
+func (h *ActionHandler) DeleteFailedWebhook(ctx context.Context, id string) error {
+	if !h.IsUserAdmin(ctx) {
+		return util.NewErrForbidden(errors.Errorf("user not admin"))
+	}
+
+	resp, err := h.runserviceClient.DeleteFailedWebhook(ctx, id)
+	if err != nil {
+		return ErrFromRemote(resp, err)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type BulkOperationResultResponse struct {
+	Ref string `json:"ref"`
+	// Error is empty when the operation on the object succeeded
+	Error string `json:"error,omitempty"`
+}
+
+type BulkOperationResponse struct {
+	Results []*BulkOperationResultResponse `json:"results"`
+	// Failed is the number of objects whose operation failed
+	Failed int `json:"failed"`
+}
+
+func createBulkOperationResponse(results []*action.BulkOperationResult) *BulkOperationResponse {
+	res := &BulkOperationResponse{
+		Results: make([]*BulkOperationResultResponse, len(results)),
+	}
+	for i, r := range results {
+		res.Results[i] = &BulkOperationResultResponse{Ref: r.Ref}
+		if r.Err != nil {
+			// use the same error message of a single object request to not
+			// leak internal errors
+			res.Results[i].Error = ErrorResponseFromError(r.Err).Message
+			res.Failed++
+		}
+	}
+	return res
+}
+
+type CancelRunsRequest struct {
+	RunIDs []string `json:"run_ids"`
+}
+
+type CancelRunsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewCancelRunsHandler(logger *zap.Logger, ah *action.ActionHandler) *CancelRunsHandler {
+	return &CancelRunsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *CancelRunsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req CancelRunsRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	results, err := h.ah.CancelRuns(ctx, req.RunIDs)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, createBulkOperationResponse(results)); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type DeleteProjectsRequest struct {
+	ProjectRefs []string `json:"project_refs"`
+}
+
+type DeleteProjectsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewDeleteProjectsHandler(logger *zap.Logger, ah *action.ActionHandler) *DeleteProjectsHandler {
+	return &DeleteProjectsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *DeleteProjectsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req DeleteProjectsRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	results, err := h.ah.DeleteProjects(ctx, req.ProjectRefs)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, createBulkOperationResponse(results)); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type UpdateProjectGroupVisibilityRequest struct {
+	Visibility types.Visibility `json:"visibility"`
+}
+
+type UpdateProjectGroupVisibilityHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewUpdateProjectGroupVisibilityHandler(logger *zap.Logger, ah *action.ActionHandler) *UpdateProjectGroupVisibilityHandler {
+	return &UpdateProjectGroupVisibilityHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *UpdateProjectGroupVisibilityHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectGroupRef, err := url.PathUnescape(vars["projectgroupref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	var req UpdateProjectGroupVisibilityRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	results, err := h.ah.UpdateProjectGroupVisibility(ctx, projectGroupRef, req.Visibility)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, createBulkOperationResponse(results)); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -27,8 +27,11 @@ import (
 	"strconv"
 	"strings"
 
+	"agola.io/agola/internal/services/gateway/handlers"
 	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
 
+	"github.com/gorilla/websocket"
 	errors "golang.org/x/xerrors"
 )
 
@@ -39,6 +42,7 @@ type Client struct {
 	url    string
 	client *http.Client
 	token  string
+	otp    string
 }
 
 // NewClient initializes and returns a API client.
@@ -50,6 +54,13 @@ func NewClient(url, token string) *Client {
 	}
 }
 
+// SetOTP sets the two factor authentication code sent with the requests,
+// required by the sensitive operations when the user has enabled the two
+// factor authentication
+func (c *Client) SetOTP(otp string) {
+	c.otp = otp
+}
+
 // SetHTTPClient replaces default http.Client with user given one.
 func (c *Client) SetHTTPClient(client *http.Client) {
 	c.client = client
@@ -69,6 +80,9 @@ func (c *Client) doRequest(ctx context.Context, method, path string, query url.V
 	}
 
 	req.Header.Set("Authorization", "token "+c.token)
+	if c.otp != "" {
+		req.Header.Set(handlers.OTPHeader, c.otp)
+	}
 	for k, v := range header {
 		req.Header[k] = v
 	}
@@ -278,6 +292,181 @@ func (c *Client) ProjectCreateRun(ctx context.Context, projectRef string, req *P
 	return c.getResponse(ctx, "POST", fmt.Sprintf("/projects/%s/createrun", url.PathEscape(projectRef)), nil, jsonContent, bytes.NewReader(reqj))
 }
 
+func (c *Client) DebugRun(ctx context.Context, runID string, req *DebugRunRequest) (*http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.getResponse(ctx, "POST", fmt.Sprintf("/runs/%s/debug", runID), nil, jsonContent, bytes.NewReader(reqj))
+}
+
+// ExecRunTask opens a websocket connection executing the provided command
+// (the task shell if empty) inside the running task main container
+func (c *Client) ExecRunTask(ctx context.Context, runID, taskID string, cmd []string, tty bool) (*websocket.Conn, *http.Response, error) {
+	q := url.Values{}
+	for _, arg := range cmd {
+		q.Add("cmd", arg)
+	}
+	if tty {
+		q.Add("tty", "")
+	}
+
+	u := fmt.Sprintf("%s/api/v1alpha/runs/%s/tasks/%s/exec?%s", util.WebsocketURL(c.url), runID, taskID, q.Encode())
+	conn, resp, err := websocket.DefaultDialer.Dial(u, http.Header{"Authorization": []string{"token " + c.token}})
+	if err != nil && resp != nil && resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		errMap := make(map[string]interface{})
+		if jerr := json.NewDecoder(resp.Body).Decode(&errMap); jerr == nil {
+			if msg, ok := errMap["message"].(string); ok {
+				return nil, resp, errors.New(msg)
+			}
+		}
+	}
+	return conn, resp, err
+}
+
+func (c *Client) ProjectCreateFile(ctx context.Context, projectRef string, req *ProjectCreateFileRequest) (*http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.getResponse(ctx, "PUT", fmt.Sprintf("/projects/%s/createfile", url.PathEscape(projectRef)), nil, jsonContent, bytes.NewReader(reqj))
+}
+
+func (c *Client) GetProjectTasksFlakiness(ctx context.Context, projectRef string, limit int, onlyFlaky bool) ([]*TaskFlakinessResponse, *http.Response, error) {
+	q := url.Values{}
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+	if onlyFlaky {
+		q.Add("flaky", "")
+	}
+
+	tfs := []*TaskFlakinessResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projects/%s/tasksflakiness", url.PathEscape(projectRef)), q, jsonContent, nil, &tfs)
+	return tfs, resp, err
+}
+
+func (c *Client) GetProjectRunsStats(ctx context.Context, projectRef, branch, window string, hotspotsLimit int) (*ProjectRunsStatsResponse, *http.Response, error) {
+	q := url.Values{}
+	if branch != "" {
+		q.Add("branch", branch)
+	}
+	if window != "" {
+		q.Add("window", window)
+	}
+	if hotspotsLimit > 0 {
+		q.Add("hotspotslimit", strconv.Itoa(hotspotsLimit))
+	}
+
+	stats := new(ProjectRunsStatsResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projects/%s/runsstats", url.PathEscape(projectRef)), q, jsonContent, nil, stats)
+	return stats, resp, err
+}
+
+func (c *Client) GetProjectTestCaseHistory(ctx context.Context, projectRef, suite, name string, limit int) ([]*TestCaseHistoryEntryResponse, *http.Response, error) {
+	q := url.Values{}
+	if suite != "" {
+		q.Add("suite", suite)
+	}
+	q.Add("name", name)
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+
+	entries := []*TestCaseHistoryEntryResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projects/%s/testcases/history", url.PathEscape(projectRef)), q, jsonContent, nil, &entries)
+	return entries, resp, err
+}
+
+func (c *Client) GetRunCoverage(ctx context.Context, runID string) (*CoverageResponse, *http.Response, error) {
+	coverage := new(CoverageResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/runs/%s/coverage", runID), nil, jsonContent, nil, coverage)
+	return coverage, resp, err
+}
+
+func (c *Client) GetRunConfig(ctx context.Context, runID string) (*RunConfigResponse, *http.Response, error) {
+	rc := new(RunConfigResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/runs/%s/config", runID), nil, jsonContent, nil, rc)
+	return rc, resp, err
+}
+
+// GetRunLogsArchive returns the response streaming the gzipped tar archive
+// with all the run logs. The caller must close the response body.
+func (c *Client) GetRunLogsArchive(ctx context.Context, runID string) (*http.Response, error) {
+	return c.getResponse(ctx, "GET", fmt.Sprintf("/runs/%s/logs.tar.gz", runID), nil, nil, nil)
+}
+
+func (c *Client) GetProjectCoverageHistory(ctx context.Context, projectRef, branch string, limit int) ([]*CoverageHistoryEntryResponse, *http.Response, error) {
+	q := url.Values{}
+	if branch != "" {
+		q.Add("branch", branch)
+	}
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+
+	entries := []*CoverageHistoryEntryResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projects/%s/coverage", url.PathEscape(projectRef)), q, jsonContent, nil, &entries)
+	return entries, resp, err
+}
+
+func (c *Client) GetRunGantt(ctx context.Context, runID string) (*RunGanttResponse, *http.Response, error) {
+	gantt := new(RunGanttResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/runs/%s/gantt", runID), nil, jsonContent, nil, gantt)
+	return gantt, resp, err
+}
+
+func (c *Client) GetRunTaskTestResults(ctx context.Context, runID, taskID string, slowest int) (*TestResultsResponse, *http.Response, error) {
+	q := url.Values{}
+	q.Add("slowest", strconv.Itoa(slowest))
+
+	tr := new(TestResultsResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/runs/%s/tasks/%s/testresults", runID, taskID), q, jsonContent, nil, tr)
+	return tr, resp, err
+}
+
+func (c *Client) UpdateProjectQuarantinedTasks(ctx context.Context, projectRef string, req *UpdateProjectQuarantinedTasksRequest) (*ProjectResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	project := new(ProjectResponse)
+	resp, err := c.getParsedResponse(ctx, "PUT", fmt.Sprintf("/projects/%s/quarantinedtasks", url.PathEscape(projectRef)), nil, jsonContent, bytes.NewReader(reqj), project)
+	return project, resp, err
+}
+
+func (c *Client) UpdateProjectRunDefaults(ctx context.Context, projectRef string, req *UpdateProjectRunDefaultsRequest) (*ProjectResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	project := new(ProjectResponse)
+	resp, err := c.getParsedResponse(ctx, "PUT", fmt.Sprintf("/projects/%s/rundefaults", url.PathEscape(projectRef)), nil, jsonContent, bytes.NewReader(reqj), project)
+	return project, resp, err
+}
+
+func (c *Client) GetProjectChanges(ctx context.Context, projectRef string, limit int) ([]*ProjectChangeResponse, *http.Response, error) {
+	q := url.Values{}
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+
+	pcs := []*ProjectChangeResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projects/%s/changes", url.PathEscape(projectRef)), q, jsonContent, nil, &pcs)
+	return pcs, resp, err
+}
+
+func (c *Client) RollbackProject(ctx context.Context, projectRef, projectChangeID string) (*ProjectResponse, *http.Response, error) {
+	project := new(ProjectResponse)
+	resp, err := c.getParsedResponse(ctx, "PUT", fmt.Sprintf("/projects/%s/changes/%s/rollback", url.PathEscape(projectRef), projectChangeID), nil, jsonContent, nil, project)
+	return project, resp, err
+}
+
 func (c *Client) ReconfigProject(ctx context.Context, projectRef string) (*http.Response, error) {
 	return c.getResponse(ctx, "PUT", fmt.Sprintf("/projects/%s/reconfig", url.PathEscape(projectRef)), nil, jsonContent, nil)
 }
@@ -288,6 +477,12 @@ func (c *Client) GetCurrentUser(ctx context.Context) (*UserResponse, *http.Respo
 	return user, resp, err
 }
 
+func (c *Client) GetCurrentUserToken(ctx context.Context) (*UserTokenInfoResponse, *http.Response, error) {
+	info := new(UserTokenInfoResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", "/user/token", nil, jsonContent, nil, info)
+	return info, resp, err
+}
+
 func (c *Client) GetUser(ctx context.Context, userRef string) (*UserResponse, *http.Response, error) {
 	user := new(UserResponse)
 	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/users/%s", userRef), nil, jsonContent, nil, user)
@@ -376,33 +571,253 @@ func (c *Client) DeleteUserToken(ctx context.Context, userRef, tokenName string)
 	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/users/%s/tokens/%s", userRef, tokenName), nil, jsonContent, nil)
 }
 
+func (c *Client) GetUserSessions(ctx context.Context, userRef string) ([]*UserSessionResponse, *http.Response, error) {
+	sessions := []*UserSessionResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/users/%s/sessions", userRef), nil, jsonContent, nil, &sessions)
+	return sessions, resp, err
+}
+
+func (c *Client) DeleteUserSession(ctx context.Context, userRef, sessionID string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/users/%s/sessions/%s", userRef, sessionID), nil, jsonContent, nil)
+}
+
+func (c *Client) DeleteUserSessions(ctx context.Context, userRef string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/users/%s/sessions", userRef), nil, jsonContent, nil)
+}
+
+func (c *Client) EnrollUserTOTP(ctx context.Context, userRef string) (*UserTOTPEnrollmentResponse, *http.Response, error) {
+	enrollment := new(UserTOTPEnrollmentResponse)
+	resp, err := c.getParsedResponse(ctx, "POST", fmt.Sprintf("/users/%s/totp", userRef), nil, jsonContent, nil, enrollment)
+	return enrollment, resp, err
+}
+
+func (c *Client) EnableUserTOTP(ctx context.Context, userRef string, req *EnableUserTOTPRequest) (*http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.getResponse(ctx, "PUT", fmt.Sprintf("/users/%s/totp", userRef), nil, jsonContent, bytes.NewReader(reqj))
+}
+
+func (c *Client) DisableUserTOTP(ctx context.Context, userRef string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/users/%s/totp", userRef), nil, jsonContent, nil)
+}
+
+func (c *Client) GetUserEmailNotifications(ctx context.Context, userRef string) (*UserEmailNotificationsResponse, *http.Response, error) {
+	emailNotifications := new(UserEmailNotificationsResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/users/%s/emailnotifications", userRef), nil, jsonContent, nil, emailNotifications)
+	return emailNotifications, resp, err
+}
+
+func (c *Client) UpdateUserEmailNotifications(ctx context.Context, userRef string, req *UserEmailNotificationsRequest) (*UserEmailNotificationsResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	emailNotifications := new(UserEmailNotificationsResponse)
+	resp, err := c.getParsedResponse(ctx, "PUT", fmt.Sprintf("/users/%s/emailnotifications", userRef), nil, jsonContent, bytes.NewReader(reqj), emailNotifications)
+	return emailNotifications, resp, err
+}
+
+func (c *Client) DeleteUserEmailNotifications(ctx context.Context, userRef string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/users/%s/emailnotifications", userRef), nil, jsonContent, nil)
+}
+
+func (c *Client) GetUserNotifications(ctx context.Context, unreadOnly bool, limit int) ([]*UserNotificationResponse, *http.Response, error) {
+	q := url.Values{}
+	if unreadOnly {
+		q.Add("unread", "")
+	}
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+
+	uns := []*UserNotificationResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", "/user/notifications", q, jsonContent, nil, &uns)
+	return uns, resp, err
+}
+
+func (c *Client) GetUserNotificationsUnreadCount(ctx context.Context) (int, *http.Response, error) {
+	res := new(UserNotificationsUnreadCountResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", "/user/notifications/unreadcount", nil, jsonContent, nil, res)
+	return res.Count, resp, err
+}
+
+func (c *Client) MarkUserNotificationsRead(ctx context.Context, req *MarkUserNotificationsReadRequest) (*http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	return c.getResponse(ctx, "PUT", "/user/notifications/read", nil, jsonContent, bytes.NewReader(reqj))
+}
+
+func (c *Client) WatchProject(ctx context.Context, projectRef string) (*http.Response, error) {
+	return c.getResponse(ctx, "PUT", fmt.Sprintf("/projects/%s/watch", url.PathEscape(projectRef)), nil, jsonContent, nil)
+}
+
+func (c *Client) UnwatchProject(ctx context.Context, projectRef string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/projects/%s/watch", url.PathEscape(projectRef)), nil, jsonContent, nil)
+}
+
+func (c *Client) CancelRuns(ctx context.Context, req *CancelRunsRequest) (*BulkOperationResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res := new(BulkOperationResponse)
+	resp, err := c.getParsedResponse(ctx, "POST", "/bulk/runs/cancel", nil, jsonContent, bytes.NewReader(reqj), res)
+	return res, resp, err
+}
+
+func (c *Client) DeleteProjects(ctx context.Context, req *DeleteProjectsRequest) (*BulkOperationResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res := new(BulkOperationResponse)
+	resp, err := c.getParsedResponse(ctx, "POST", "/bulk/projects/delete", nil, jsonContent, bytes.NewReader(reqj), res)
+	return res, resp, err
+}
+
+func (c *Client) UpdateProjectGroupVisibility(ctx context.Context, projectGroupRef string, req *UpdateProjectGroupVisibilityRequest) (*BulkOperationResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res := new(BulkOperationResponse)
+	resp, err := c.getParsedResponse(ctx, "PUT", fmt.Sprintf("/bulk/projectgroups/%s/visibility", url.PathEscape(projectGroupRef)), nil, jsonContent, bytes.NewReader(reqj), res)
+	return res, resp, err
+}
+
+// GetProjectGroupTree returns the project group subtree items with a path
+// greater than start
+func (c *Client) GetProjectGroupTree(ctx context.Context, projectGroupRef, start string, limit int) ([]*ProjectGroupTreeItemResponse, *http.Response, error) {
+	q := url.Values{}
+	if start != "" {
+		q.Add("start", start)
+	}
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+
+	items := []*ProjectGroupTreeItemResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projectgroups/%s/tree", url.PathEscape(projectGroupRef)), q, jsonContent, nil, &items)
+	return items, resp, err
+}
+
+func (c *Client) GetProjectGroupSettings(ctx context.Context, projectGroupRef string) (*ProjectGroupSettingsResponse, *http.Response, error) {
+	res := new(ProjectGroupSettingsResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projectgroups/%s/settings", url.PathEscape(projectGroupRef)), nil, jsonContent, nil, res)
+	return res, resp, err
+}
+
+func (c *Client) UpdateProjectGroupSettings(ctx context.Context, projectGroupRef string, req *UpdateProjectGroupSettingsRequest) (*UpdateProjectGroupSettingsResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res := new(UpdateProjectGroupSettingsResponse)
+	resp, err := c.getParsedResponse(ctx, "PUT", fmt.Sprintf("/projectgroups/%s/settings", url.PathEscape(projectGroupRef)), nil, jsonContent, bytes.NewReader(reqj), res)
+	return res, resp, err
+}
+
+func (c *Client) GetProjectGroupTrashItems(ctx context.Context, projectGroupRef string) ([]*TrashItemResponse, *http.Response, error) {
+	tis := []*TrashItemResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projectgroups/%s/trash", url.PathEscape(projectGroupRef)), nil, jsonContent, nil, &tis)
+	return tis, resp, err
+}
+
+func (c *Client) RestoreTrashItem(ctx context.Context, trashItemID string) (*TrashItemResponse, *http.Response, error) {
+	ti := new(TrashItemResponse)
+	resp, err := c.getParsedResponse(ctx, "POST", fmt.Sprintf("/trash/%s/restore", trashItemID), nil, jsonContent, nil, ti)
+	return ti, resp, err
+}
+
+func (c *Client) GetProjectPathAliases(ctx context.Context, projectRef string) ([]*PathAliasResponse, *http.Response, error) {
+	pas := []*PathAliasResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projects/%s/pathaliases", url.PathEscape(projectRef)), nil, jsonContent, nil, &pas)
+	return pas, resp, err
+}
+
+func (c *Client) GetProjectGroupPathAliases(ctx context.Context, projectGroupRef string) ([]*PathAliasResponse, *http.Response, error) {
+	pas := []*PathAliasResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projectgroups/%s/pathaliases", url.PathEscape(projectGroupRef)), nil, jsonContent, nil, &pas)
+	return pas, resp, err
+}
+
+func (c *Client) GetProjectEffectiveSettings(ctx context.Context, projectRef string) (*ProjectEffectiveSettingsResponse, *http.Response, error) {
+	res := new(ProjectEffectiveSettingsResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projects/%s/effectivesettings", url.PathEscape(projectRef)), nil, jsonContent, nil, res)
+	return res, resp, err
+}
+
 func (c *Client) GetRun(ctx context.Context, runID string) (*RunResponse, *http.Response, error) {
 	run := new(RunResponse)
 	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/runs/%s", runID), nil, jsonContent, nil, run)
 	return run, resp, err
 }
 
-func (c *Client) GetRuns(ctx context.Context, phaseFilter, resultFilter, groups, runGroups []string, start string, limit int, asc bool) ([]*RunsResponse, *http.Response, error) {
+func (c *Client) GetProjectRun(ctx context.Context, projectRef string, runNumber uint64) (*RunResponse, *http.Response, error) {
+	run := new(RunResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", path.Join("/projects", url.PathEscape(projectRef), "runs", strconv.FormatUint(runNumber, 10)), nil, jsonContent, nil, run)
+	return run, resp, err
+}
+
+// GetRunsOptions defines the filters, the order and the pagination of the runs
+// returned by GetRuns
+type GetRunsOptions struct {
+	PhaseFilter  []string
+	ResultFilter []string
+	// Groups are the run groups (i.e. /project/projectid). The gateway
+	// currently accepts only one group.
+	Groups    []string
+	RunGroups []string
+	// Names are the config run names
+	Names  []string
+	Labels map[string]string
+	Pinned bool
+
+	Start string
+	Limit int
+	Asc   bool
+}
+
+func (c *Client) GetRuns(ctx context.Context, opts *GetRunsOptions) ([]*RunsResponse, *http.Response, error) {
 	q := url.Values{}
-	for _, phase := range phaseFilter {
+	for _, phase := range opts.PhaseFilter {
 		q.Add("phase", phase)
 	}
-	for _, result := range resultFilter {
+	for _, result := range opts.ResultFilter {
 		q.Add("result", result)
 	}
-	for _, group := range groups {
+	for _, group := range opts.Groups {
 		q.Add("group", group)
 	}
-	for _, runGroup := range runGroups {
+	for _, runGroup := range opts.RunGroups {
 		q.Add("rungroup", runGroup)
 	}
-	if start != "" {
-		q.Add("start", start)
+	for _, name := range opts.Names {
+		q.Add("runname", name)
 	}
-	if limit > 0 {
-		q.Add("limit", strconv.Itoa(limit))
+	for k, v := range opts.Labels {
+		q.Add("label", k+"="+v)
 	}
-	if asc {
+	if opts.Pinned {
+		q.Add("pinned", "")
+	}
+	if opts.Start != "" {
+		q.Add("start", opts.Start)
+	}
+	if opts.Limit > 0 {
+		q.Add("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Asc {
 		q.Add("asc", "")
 	}
 
@@ -411,6 +826,19 @@ func (c *Client) GetRuns(ctx context.Context, phaseFilter, resultFilter, groups,
 	return getRunsResponse, resp, err
 }
 
+// GetProjectRunsByName returns the last runs of the project grouped by their
+// config run name
+func (c *Client) GetProjectRunsByName(ctx context.Context, projectRef string, limit int) ([]*RunsByNameResponse, *http.Response, error) {
+	q := url.Values{}
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+
+	runsByName := []*RunsByNameResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", path.Join("/projects", url.PathEscape(projectRef), "runsbyname"), q, jsonContent, nil, &runsByName)
+	return runsByName, resp, err
+}
+
 func (c *Client) GetRemoteSource(ctx context.Context, rsRef string) (*RemoteSourceResponse, *http.Response, error) {
 	rs := new(RemoteSourceResponse)
 	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/remotesources/%s", rsRef), nil, jsonContent, nil, rs)
@@ -460,6 +888,126 @@ func (c *Client) DeleteRemoteSource(ctx context.Context, rsRef string) (*http.Re
 	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/remotesources/%s", rsRef), nil, jsonContent, nil)
 }
 
+func (c *Client) CheckRemoteSource(ctx context.Context, rsRef string) (*RemoteSourceCheckResponse, *http.Response, error) {
+	res := new(RemoteSourceCheckResponse)
+	resp, err := c.getParsedResponse(ctx, "POST", fmt.Sprintf("/remotesources/%s/check", rsRef), nil, jsonContent, nil, res)
+	return res, resp, err
+}
+
+func (c *Client) RotateRemoteSourceSecret(ctx context.Context, rsRef string, req *RotateRemoteSourceSecretRequest) (*RemoteSourceResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rs := new(RemoteSourceResponse)
+	resp, err := c.getParsedResponse(ctx, "PUT", fmt.Sprintf("/remotesources/%s/oauth2secret", rsRef), nil, jsonContent, bytes.NewReader(reqj), rs)
+	return rs, resp, err
+}
+
+func (c *Client) MigrateRemoteSource(ctx context.Context, rsRef string, req *MigrateRemoteSourceRequest) ([]*LinkedAccountMigrationResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	migrations := []*LinkedAccountMigrationResponse{}
+	resp, err := c.getParsedResponse(ctx, "POST", fmt.Sprintf("/remotesources/%s/migrate", rsRef), nil, jsonContent, bytes.NewReader(reqj), &migrations)
+	return migrations, resp, err
+}
+
+func (c *Client) GetWals(ctx context.Context, start string, limit int) ([]*WalResponse, *http.Response, error) {
+	q := url.Values{}
+	if start != "" {
+		q.Add("start", start)
+	}
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+
+	wals := []*WalResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", "/admin/wals", q, jsonContent, nil, &wals)
+	return wals, resp, err
+}
+
+func (c *Client) GetObjectHistory(ctx context.Context, dataType, id, start string, limit int) (*ObjectHistoryResponse, *http.Response, error) {
+	q := url.Values{}
+	if start != "" {
+		q.Add("start", start)
+	}
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+
+	history := new(ObjectHistoryResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/admin/history/%s/%s", dataType, id), q, jsonContent, nil, history)
+	return history, resp, err
+}
+
+func (c *Client) RestoreObject(ctx context.Context, dataType, id string, req *RestoreObjectRequest) (*http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.getResponse(ctx, "POST", fmt.Sprintf("/admin/history/%s/%s/restore", dataType, id), nil, jsonContent, bytes.NewReader(reqj))
+}
+
+func (c *Client) GetExecutors(ctx context.Context) ([]*ExecutorResponse, *http.Response, error) {
+	executors := []*ExecutorResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", "/admin/executors", nil, jsonContent, nil, &executors)
+	return executors, resp, err
+}
+
+func (c *Client) ApproveExecutor(ctx context.Context, executorID string) (*http.Response, error) {
+	return c.getResponse(ctx, "POST", fmt.Sprintf("/admin/executors/%s/approve", executorID), nil, jsonContent, nil)
+}
+
+func (c *Client) DeleteExecutor(ctx context.Context, executorID string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/admin/executors/%s", executorID), nil, jsonContent, nil)
+}
+
+func (c *Client) GetMaintenance(ctx context.Context) (*MaintenanceResponse, *http.Response, error) {
+	maintenance := new(MaintenanceResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", "/admin/maintenance", nil, jsonContent, nil, maintenance)
+	return maintenance, resp, err
+}
+
+func (c *Client) EnableMaintenance(ctx context.Context) (*MaintenanceResponse, *http.Response, error) {
+	maintenance := new(MaintenanceResponse)
+	resp, err := c.getParsedResponse(ctx, "PUT", "/admin/maintenance", nil, jsonContent, nil, maintenance)
+	return maintenance, resp, err
+}
+
+func (c *Client) DisableMaintenance(ctx context.Context) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", "/admin/maintenance", nil, jsonContent, nil)
+}
+
+func (c *Client) GetFailedWebhooks(ctx context.Context) ([]*FailedWebhookResponse, *http.Response, error) {
+	fws := []*FailedWebhookResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", "/admin/failedwebhooks", nil, jsonContent, nil, &fws)
+	return fws, resp, err
+}
+
+func (c *Client) ReplayFailedWebhook(ctx context.Context, id string) (*http.Response, error) {
+	return c.getResponse(ctx, "POST", fmt.Sprintf("/admin/failedwebhooks/%s/replay", id), nil, jsonContent, nil)
+}
+
+func (c *Client) DeleteFailedWebhook(ctx context.Context, id string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/admin/failedwebhooks/%s", id), nil, jsonContent, nil)
+}
+
+func (c *Client) ValidateConfig(ctx context.Context, req *ValidateConfigRequest) (*ValidateConfigResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res := new(ValidateConfigResponse)
+	resp, err := c.getParsedResponse(ctx, "POST", "/config/validate", nil, jsonContent, bytes.NewReader(reqj), res)
+	return res, resp, err
+}
+
 func (c *Client) CreateOrg(ctx context.Context, req *CreateOrgRequest) (*OrgResponse, *http.Response, error) {
 	reqj, err := json.Marshal(req)
 	if err != nil {
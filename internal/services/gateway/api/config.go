@@ -0,0 +1,123 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"agola.io/agola/internal/config"
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/util"
+
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+type ValidateConfigRequest struct {
+	Config string `json:"config"`
+	// Format is the config format: yaml, json or jsonnet. Defaults to yaml
+	Format string `json:"format"`
+}
+
+type ValidateConfigResponse struct {
+	Error      *ConfigErrorResponse       `json:"error"`
+	LintIssues []*ConfigLintIssueResponse `json:"lint_issues"`
+}
+
+type ConfigErrorResponse struct {
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+}
+
+type ConfigLintIssueResponse struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+}
+
+func createValidateConfigResponse(v *action.ConfigValidation) *ValidateConfigResponse {
+	res := &ValidateConfigResponse{
+		LintIssues: make([]*ConfigLintIssueResponse, len(v.LintIssues)),
+	}
+	if v.Error != nil {
+		res.Error = &ConfigErrorResponse{Message: v.Error.Error()}
+		if v.Error.Position != nil {
+			res.Error.Line = v.Error.Position.Line
+			res.Error.Column = v.Error.Position.Column
+		}
+	}
+	for i, issue := range v.LintIssues {
+		res.LintIssues[i] = &ConfigLintIssueResponse{
+			Rule:     issue.Rule,
+			Severity: string(issue.Severity),
+			Message:  issue.Message,
+		}
+		if issue.Position != nil {
+			res.LintIssues[i].Line = issue.Position.Line
+			res.LintIssues[i].Column = issue.Position.Column
+		}
+	}
+	return res
+}
+
+type ValidateConfigHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewValidateConfigHandler(logger *zap.Logger, ah *action.ActionHandler) *ValidateConfigHandler {
+	return &ValidateConfigHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ValidateConfigHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req ValidateConfigRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	var format config.ConfigFormat
+	switch req.Format {
+	case "", "yaml", "json":
+		format = config.ConfigFormatJSON
+	case "jsonnet":
+		format = config.ConfigFormatJsonnet
+	default:
+		httpError(w, util.NewErrBadRequest(errors.Errorf("unknown config format %q", req.Format)))
+		return
+	}
+
+	creq := &action.ValidateConfigRequest{
+		Data:   []byte(req.Config),
+		Format: format,
+	}
+	v, err := h.ah.ValidateConfig(ctx, creq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createValidateConfigResponse(v)
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"agola.io/agola/internal/services/gateway/action"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+type CoverageResponse struct {
+	Format       rstypes.CoverageReportFormat `json:"format,omitempty"`
+	LinesTotal   int                          `json:"lines_total"`
+	LinesCovered int                          `json:"lines_covered"`
+	Percent      float64                      `json:"percent"`
+}
+
+func createCoverageResponse(c *rstypes.CoverageReport) *CoverageResponse {
+	return &CoverageResponse{
+		Format:       c.Format,
+		LinesTotal:   c.LinesTotal,
+		LinesCovered: c.LinesCovered,
+		Percent:      c.Percent(),
+	}
+}
+
+type RunCoverageHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewRunCoverageHandler(logger *zap.Logger, ah *action.ActionHandler) *RunCoverageHandler {
+	return &RunCoverageHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *RunCoverageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	runID := vars["runid"]
+
+	report, err := h.ah.GetRunCoverage(ctx, runID)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createCoverageResponse(report)
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type CoverageHistoryEntryResponse struct {
+	RunID      string            `json:"run_id"`
+	RunCounter uint64            `json:"run_counter"`
+	EndTime    *time.Time        `json:"end_time,omitempty"`
+	Coverage   *CoverageResponse `json:"coverage"`
+}
+
+type ProjectCoverageHistoryHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectCoverageHistoryHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectCoverageHistoryHandler {
+	return &ProjectCoverageHistoryHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectCoverageHistoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	var limit int
+	if limitS := query.Get("limit"); limitS != "" {
+		limit, err = strconv.Atoi(limitS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse limit: %w", err)))
+			return
+		}
+	}
+	if limit < 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("limit must be greater or equal than 0")))
+		return
+	}
+
+	areq := &action.GetProjectCoverageHistoryRequest{
+		ProjectRef: projectRef,
+		Branch:     query.Get("branch"),
+		Limit:      limit,
+	}
+	entries, err := h.ah.GetProjectCoverageHistory(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := make([]*CoverageHistoryEntryResponse, len(entries))
+	for i, e := range entries {
+		res[i] = &CoverageHistoryEntryResponse{
+			RunID:      e.RunID,
+			RunCounter: e.RunCounter,
+			EndTime:    e.EndTime,
+			Coverage:   createCoverageResponse(e.Coverage),
+		}
+	}
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type CoverageBadgeHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewCoverageBadgeHandler(logger *zap.Logger, ah *action.ActionHandler) *CoverageBadgeHandler {
+	return &CoverageBadgeHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *CoverageBadgeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+	branch := query.Get("branch")
+
+	badge, err := h.ah.GetCoverageBadge(ctx, projectRef, branch)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if _, err := w.Write([]byte(badge)); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
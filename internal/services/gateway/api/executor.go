@@ -0,0 +1,157 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"agola.io/agola/internal/services/gateway/action"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"go.uber.org/zap"
+
+	"github.com/gorilla/mux"
+)
+
+type ExecutorHostFactsResponse struct {
+	Hostname    string   `json:"hostname"`
+	OS          string   `json:"os"`
+	NumCPU      int      `json:"num_cpu"`
+	IPAddresses []string `json:"ip_addresses"`
+}
+
+type ExecutorResponse struct {
+	ID                   string                     `json:"id"`
+	ListenURL            string                     `json:"listen_url"`
+	Archs                []string                   `json:"archs"`
+	Labels               map[string]string          `json:"labels"`
+	ActiveTasksLimit     int                        `json:"active_tasks_limit"`
+	ActiveTasks          int                        `json:"active_tasks"`
+	Dynamic              bool                       `json:"dynamic"`
+	ExecutorGroup        string                     `json:"executor_group"`
+	LastStatusUpdateTime time.Time                  `json:"last_status_update_time"`
+	WaitingApproval      bool                       `json:"waiting_approval"`
+	RemoteAddress        string                     `json:"remote_address"`
+	HostFacts            *ExecutorHostFactsResponse `json:"host_facts"`
+}
+
+func createExecutorResponse(e *rstypes.Executor) *ExecutorResponse {
+	archs := make([]string, len(e.Archs))
+	for i, arch := range e.Archs {
+		archs[i] = string(arch)
+	}
+
+	res := &ExecutorResponse{
+		ID:                   e.ID,
+		ListenURL:            e.ListenURL,
+		Archs:                archs,
+		Labels:               e.Labels,
+		ActiveTasksLimit:     e.ActiveTasksLimit,
+		ActiveTasks:          e.ActiveTasks,
+		Dynamic:              e.Dynamic,
+		ExecutorGroup:        e.ExecutorGroup,
+		LastStatusUpdateTime: e.LastStatusUpdateTime,
+		WaitingApproval:      e.WaitingApproval,
+		RemoteAddress:        e.RemoteAddress,
+	}
+	if e.HostFacts != nil {
+		res.HostFacts = &ExecutorHostFactsResponse{
+			Hostname:    e.HostFacts.Hostname,
+			OS:          e.HostFacts.OS,
+			NumCPU:      e.HostFacts.NumCPU,
+			IPAddresses: e.HostFacts.IPAddresses,
+		}
+	}
+
+	return res
+}
+
+type ExecutorsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewExecutorsHandler(logger *zap.Logger, ah *action.ActionHandler) *ExecutorsHandler {
+	return &ExecutorsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ExecutorsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	executors, err := h.ah.GetExecutors(ctx)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := make([]*ExecutorResponse, len(executors))
+	for i, e := range executors {
+		res[i] = createExecutorResponse(e)
+	}
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type ApproveExecutorHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewApproveExecutorHandler(logger *zap.Logger, ah *action.ActionHandler) *ApproveExecutorHandler {
+	return &ApproveExecutorHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ApproveExecutorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	executorID := vars["executorid"]
+
+	err := h.ah.ApproveExecutor(ctx, executorID)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type DeleteExecutorHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewDeleteExecutorHandler(logger *zap.Logger, ah *action.ActionHandler) *DeleteExecutorHandler {
+	return &DeleteExecutorHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *DeleteExecutorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	executorID := vars["executorid"]
+
+	err := h.ah.DeleteExecutor(ctx, executorID)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
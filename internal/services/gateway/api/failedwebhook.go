@@ -0,0 +1,122 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"agola.io/agola/internal/services/gateway/action"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type FailedWebhookResponse struct {
+	ID          string              `json:"id"`
+	ProjectID   string              `json:"project_id"`
+	Header      map[string][]string `json:"header"`
+	FailureTime time.Time           `json:"failure_time"`
+	Error       string              `json:"error"`
+}
+
+func createFailedWebhookResponse(fw *rstypes.FailedWebhook) *FailedWebhookResponse {
+	return &FailedWebhookResponse{
+		ID:          fw.ID,
+		ProjectID:   fw.ProjectID,
+		Header:      fw.Header,
+		FailureTime: fw.FailureTime,
+		Error:       fw.Error,
+	}
+}
+
+type FailedWebhooksHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewFailedWebhooksHandler(logger *zap.Logger, ah *action.ActionHandler) *FailedWebhooksHandler {
+	return &FailedWebhooksHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *FailedWebhooksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	fws, err := h.ah.GetFailedWebhooks(ctx)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := make([]*FailedWebhookResponse, len(fws))
+	for i, fw := range fws {
+		res[i] = createFailedWebhookResponse(fw)
+	}
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type ReplayFailedWebhookHandler struct {
+	log *zap.SugaredLogger
+	wh  *webhooksHandler
+}
+
+func NewReplayFailedWebhookHandler(logger *zap.Logger, wh *webhooksHandler) *ReplayFailedWebhookHandler {
+	return &ReplayFailedWebhookHandler{log: logger.Sugar(), wh: wh}
+}
+
+func (h *ReplayFailedWebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	id := vars["webhookid"]
+
+	err := h.wh.ReplayFailedWebhook(ctx, id)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type DeleteFailedWebhookHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewDeleteFailedWebhookHandler(logger *zap.Logger, ah *action.ActionHandler) *DeleteFailedWebhookHandler {
+	return &DeleteFailedWebhookHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *DeleteFailedWebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	id := vars["webhookid"]
+
+	err := h.ah.DeleteFailedWebhook(ctx, id)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
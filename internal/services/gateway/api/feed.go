@@ -0,0 +1,306 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+type FeedFormat string
+
+const (
+	FeedFormatAtom FeedFormat = "atom"
+	FeedFormatRSS  FeedFormat = "rss"
+)
+
+type atomFeed struct {
+	XMLName xml.Name     `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string       `xml:"id"`
+	Title   string       `xml:"title"`
+	Updated string       `xml:"updated"`
+	Link    atomLink     `xml:"link"`
+	Entries []*atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	ID       string       `xml:"id"`
+	Title    string       `xml:"title"`
+	Updated  string       `xml:"updated"`
+	Link     atomLink     `xml:"link"`
+	Summary  string       `xml:"summary,omitempty"`
+	Category atomCategory `xml:"category"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string     `xml:"title"`
+	Link          string     `xml:"link"`
+	Description   string     `xml:"description"`
+	LastBuildDate string     `xml:"lastBuildDate"`
+	Items         []*rssItem `xml:"item"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Description string  `xml:"description,omitempty"`
+	Category    string  `xml:"category"`
+}
+
+func feedEntryCategory(e *action.RunsFeedEntry) string {
+	if e.Failed {
+		return "failed"
+	}
+	return "success"
+}
+
+func createAtomFeed(feed *action.RunsFeed) *atomFeed {
+	af := &atomFeed{
+		ID:      feed.ID,
+		Title:   feed.Title,
+		Updated: feed.Updated.UTC().Format(time.RFC3339),
+		Link:    atomLink{Href: feed.URL, Rel: "alternate"},
+	}
+	for _, e := range feed.Entries {
+		af.Entries = append(af.Entries, &atomEntry{
+			ID:       e.ID,
+			Title:    e.Title,
+			Updated:  e.Updated.UTC().Format(time.RFC3339),
+			Link:     atomLink{Href: e.URL, Rel: "alternate"},
+			Summary:  e.Summary,
+			Category: atomCategory{Term: feedEntryCategory(e)},
+		})
+	}
+	return af
+}
+
+func createRSSFeed(feed *action.RunsFeed) *rssFeed {
+	rf := &rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         feed.Title,
+			Link:          feed.URL,
+			Description:   feed.Title,
+			LastBuildDate: feed.Updated.UTC().Format(time.RFC1123Z),
+		},
+	}
+	for _, e := range feed.Entries {
+		rf.Channel.Items = append(rf.Channel.Items, &rssItem{
+			Title:       e.Title,
+			Link:        e.URL,
+			GUID:        rssGUID{Value: e.ID},
+			PubDate:     e.Updated.UTC().Format(time.RFC1123Z),
+			Description: e.Summary,
+			Category:    feedEntryCategory(e),
+		})
+	}
+	return rf
+}
+
+type ProjectRunsFeedHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectRunsFeedHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectRunsFeedHandler {
+	return &ProjectRunsFeedHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectRunsFeedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	format := FeedFormat(query.Get("format"))
+	switch format {
+	case "":
+		format = FeedFormatAtom
+	case FeedFormatAtom, FeedFormatRSS:
+	default:
+		httpError(w, util.NewErrBadRequest(errors.Errorf("unknown feed format %q", format)))
+		return
+	}
+
+	var limit int
+	if limitS := query.Get("limit"); limitS != "" {
+		limit, err = strconv.Atoi(limitS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse limit: %w", err)))
+			return
+		}
+	}
+	if limit < 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("limit must be greater or equal than 0")))
+		return
+	}
+
+	feed, err := h.ah.GetProjectRunsFeed(ctx, projectRef, limit)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	var v interface{}
+	switch format {
+	case FeedFormatAtom:
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		v = createAtomFeed(feed)
+	case FeedFormatRSS:
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		v = createRSSFeed(feed)
+	}
+
+	data, err := xml.Marshal(v)
+	if err != nil {
+		h.log.Errorf("err: %+v", err)
+		httpError(w, err)
+		return
+	}
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+	if _, err := w.Write(data); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+const icalTimeFormat = "20060102T150405Z"
+
+var icalTextEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// icalLine returns an iCal content line folded at 75 octets
+func icalLine(name, value string) string {
+	line := name + ":" + value
+	var b strings.Builder
+	n := 0
+	for _, r := range line {
+		l := len(string(r))
+		if n+l > 75 {
+			b.WriteString("\r\n ")
+			n = 1
+		}
+		b.WriteRune(r)
+		n += l
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+func createICalendar(cal *action.SchedulesCalendar, stamp time.Time) string {
+	var b strings.Builder
+	b.WriteString(icalLine("BEGIN", "VCALENDAR"))
+	b.WriteString(icalLine("VERSION", "2.0"))
+	b.WriteString(icalLine("PRODID", "-//agola//agola//EN"))
+	b.WriteString(icalLine("X-WR-CALNAME", icalTextEscaper.Replace(cal.Name)))
+	for _, e := range cal.Events {
+		b.WriteString(icalLine("BEGIN", "VEVENT"))
+		b.WriteString(icalLine("UID", e.UID))
+		b.WriteString(icalLine("DTSTAMP", stamp.UTC().Format(icalTimeFormat)))
+		b.WriteString(icalLine("DTSTART", e.Start.UTC().Format(icalTimeFormat)))
+		b.WriteString(icalLine("SUMMARY", icalTextEscaper.Replace(e.Summary)))
+		b.WriteString(icalLine("DESCRIPTION", icalTextEscaper.Replace(e.Description)))
+		if cal.URL != "" {
+			b.WriteString(icalLine("URL", cal.URL))
+		}
+		b.WriteString(icalLine("END", "VEVENT"))
+	}
+	b.WriteString(icalLine("END", "VCALENDAR"))
+	return b.String()
+}
+
+type ProjectSchedulesCalendarHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectSchedulesCalendarHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectSchedulesCalendarHandler {
+	return &ProjectSchedulesCalendarHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectSchedulesCalendarHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	var days int
+	if daysS := query.Get("days"); daysS != "" {
+		days, err = strconv.Atoi(daysS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse days: %w", err)))
+			return
+		}
+	}
+	if days < 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("days must be greater or equal than 0")))
+		return
+	}
+
+	cal, err := h.ah.GetProjectSchedulesCalendar(ctx, projectRef, days)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	if _, err := w.Write([]byte(createICalendar(cal, time.Now()))); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"agola.io/agola/internal/services/gateway/action"
+)
+
+func TestCreateFeeds(t *testing.T) {
+	updated := time.Date(2019, 1, 1, 10, 0, 0, 0, time.UTC)
+	feed := &action.RunsFeed{
+		ID:      "urn:agola:agola:project:project01:runs",
+		Title:   "org/org01/project01 runs",
+		URL:     "https://agola.example.com",
+		Updated: updated,
+		Entries: []*action.RunsFeedEntry{
+			{
+				ID:      "urn:agola:agola:run:run02",
+				Title:   "run01 #2 failed",
+				Summary: "branch master: fix & test",
+				URL:     "https://agola.example.com/run?projectref=project01&runid=run02",
+				Updated: updated,
+				Failed:  true,
+			},
+		},
+	}
+
+	tests := []struct {
+		name string
+		v    interface{}
+		out  string
+	}{
+		{
+			name: "test atom feed",
+			v:    createAtomFeed(feed),
+			out:  `<feed xmlns="http://www.w3.org/2005/Atom"><id>urn:agola:agola:project:project01:runs</id><title>org/org01/project01 runs</title><updated>2019-01-01T10:00:00Z</updated><link href="https://agola.example.com" rel="alternate"></link><entry><id>urn:agola:agola:run:run02</id><title>run01 #2 failed</title><updated>2019-01-01T10:00:00Z</updated><link href="https://agola.example.com/run?projectref=project01&amp;runid=run02" rel="alternate"></link><summary>branch master: fix &amp; test</summary><category term="failed"></category></entry></feed>`,
+		},
+		{
+			name: "test rss feed",
+			v:    createRSSFeed(feed),
+			out:  `<rss version="2.0"><channel><title>org/org01/project01 runs</title><link>https://agola.example.com</link><description>org/org01/project01 runs</description><lastBuildDate>Tue, 01 Jan 2019 10:00:00 +0000</lastBuildDate><item><title>run01 #2 failed</title><link>https://agola.example.com/run?projectref=project01&amp;runid=run02</link><guid isPermaLink="false">urn:agola:agola:run:run02</guid><pubDate>Tue, 01 Jan 2019 10:00:00 +0000</pubDate><description>branch master: fix &amp; test</description><category>failed</category></item></channel></rss>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := xml.Marshal(tt.v)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if out := strings.TrimSpace(string(data)); out != tt.out {
+				t.Fatalf("unexpected feed, got:\n%s\nwant:\n%s", out, tt.out)
+			}
+		})
+	}
+}
+
+func TestCreateICalendar(t *testing.T) {
+	stamp := time.Date(2019, 1, 11, 10, 0, 0, 0, time.UTC)
+	cal := &action.SchedulesCalendar{
+		ID:   "urn:agola:agola:project:project01:schedules",
+		Name: "org/org01/project01 scheduled runs",
+		URL:  "https://agola.example.com",
+		Events: []*action.SchedulesCalendarEvent{
+			{
+				UID:         "project01-nightly-1547258400@agola",
+				Summary:     "org/org01/project01 nightly run",
+				Description: "Scheduled run of branch master; with a long description, folded at 75 octets",
+				Start:       time.Date(2019, 1, 12, 2, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	out := "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"PRODID:-//agola//agola//EN\r\n" +
+		"X-WR-CALNAME:org/org01/project01 scheduled runs\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:project01-nightly-1547258400@agola\r\n" +
+		"DTSTAMP:20190111T100000Z\r\n" +
+		"DTSTART:20190112T020000Z\r\n" +
+		"SUMMARY:org/org01/project01 nightly run\r\n" +
+		"DESCRIPTION:Scheduled run of branch master\\; with a long description\\, fold\r\n" +
+		" ed at 75 octets\r\n" +
+		"URL:https://agola.example.com\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+
+	if got := createICalendar(cal, stamp); got != out {
+		t.Fatalf("unexpected calendar, got:\n%q\nwant:\n%q", got, out)
+	}
+}
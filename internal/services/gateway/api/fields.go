@@ -0,0 +1,196 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+// fieldSet contains the requested response fields. A nil subfield set means
+// that the whole field is requested.
+type fieldSet map[string]fieldSet
+
+// parseFields parses a comma separated list of fields. Nested fields are
+// separated by a dot (i.e. "id,tasks.name,tasks.status").
+func parseFields(s string) (fieldSet, error) {
+	fs := fieldSet{}
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		cur := fs
+		parts := strings.Split(f, ".")
+		for i, p := range parts {
+			if p == "" {
+				return nil, errors.Errorf("invalid field %q", f)
+			}
+			sub, ok := cur[p]
+			if ok && sub == nil {
+				// whole field already requested
+				break
+			}
+			if i == len(parts)-1 {
+				cur[p] = nil
+				break
+			}
+			if !ok {
+				sub = fieldSet{}
+				cur[p] = sub
+			}
+			cur = sub
+		}
+	}
+	if len(fs) == 0 {
+		return nil, errors.Errorf("empty fields")
+	}
+	return fs, nil
+}
+
+// jsonFieldName returns the json name of a struct field or an empty string if
+// the field isn't marshalled
+func jsonFieldName(sf reflect.StructField) string {
+	if sf.PkgPath != "" {
+		return ""
+	}
+	tag := sf.Tag.Get("json")
+	if tag == "-" {
+		return ""
+	}
+	name := strings.Split(tag, ",")[0]
+	if name == "" {
+		name = sf.Name
+	}
+	return name
+}
+
+// elemType returns the type of the value that will be filtered with the
+// fields, skipping pointers, slices and maps
+func elemType(t reflect.Type) reflect.Type {
+	for {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+			t = t.Elem()
+		default:
+			return t
+		}
+	}
+}
+
+// validateFields checks that the fields exist in the response type
+func validateFields(t reflect.Type, fs fieldSet, prefix string) error {
+	t = elemType(t)
+	if t.Kind() != reflect.Struct {
+		return errors.Errorf("field %q doesn't have subfields", strings.TrimSuffix(prefix, "."))
+	}
+	for name, sub := range fs {
+		found := false
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if jsonFieldName(sf) != name {
+				continue
+			}
+			found = true
+			if sub != nil {
+				if err := validateFields(sf.Type, sub, prefix+name+"."); err != nil {
+					return err
+				}
+			}
+		}
+		if !found {
+			return errors.Errorf("unknown field %q", prefix+name)
+		}
+	}
+	return nil
+}
+
+// filterFields returns a copy of v containing only the requested fields. Slices
+// and maps elements are filtered with the same fields.
+func filterFields(v reflect.Value, fs fieldSet) interface{} {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		res := make([]interface{}, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			res[i] = filterFields(v.Index(i), fs)
+		}
+		return res
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		res := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			res[iter.Key().String()] = filterFields(iter.Value(), fs)
+		}
+		return res
+	case reflect.Struct:
+		res := map[string]interface{}{}
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name := jsonFieldName(t.Field(i))
+			sub, ok := fs[name]
+			if name == "" || !ok {
+				continue
+			}
+			if sub == nil {
+				res[name] = v.Field(i).Interface()
+			} else {
+				res[name] = filterFields(v.Field(i), sub)
+			}
+		}
+		return res
+	default:
+		return v.Interface()
+	}
+}
+
+// httpFieldsResponse is like httpResponse but, when the request has a "fields"
+// query parameter, the response will contain only the requested fields
+func httpFieldsResponse(w http.ResponseWriter, r *http.Request, code int, res interface{}) error {
+	fields := r.URL.Query().Get("fields")
+	if fields == "" || res == nil {
+		return httpResponse(w, code, res)
+	}
+
+	fs, err := parseFields(fields)
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return err
+	}
+	rv := reflect.ValueOf(res)
+	if err := validateFields(rv.Type(), fs, ""); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return err
+	}
+
+	return httpResponse(w, code, filterFields(rv, fs))
+}
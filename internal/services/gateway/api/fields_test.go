@@ -0,0 +1,102 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestFilterFields(t *testing.T) {
+	type task struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	type run struct {
+		ID    string           `json:"id"`
+		Name  string           `json:"name"`
+		Tasks map[string]*task `json:"tasks"`
+	}
+
+	res := []*run{
+		{
+			ID:   "run01",
+			Name: "build",
+			Tasks: map[string]*task{
+				"task01": {ID: "task01", Status: "success"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		fields string
+		out    string
+		err    bool
+	}{
+		{
+			name:   "top level fields",
+			fields: "id,name",
+			out:    `[{"id":"run01","name":"build"}]`,
+		},
+		{
+			name:   "nested fields",
+			fields: "id,tasks.status",
+			out:    `[{"id":"run01","tasks":{"task01":{"status":"success"}}}]`,
+		},
+		{
+			name:   "whole field overrides nested fields",
+			fields: "tasks.status,tasks",
+			out:    `[{"tasks":{"task01":{"id":"task01","status":"success"}}}]`,
+		},
+		{
+			name:   "unknown field",
+			fields: "id,tasks.unknown",
+			err:    true,
+		},
+		{
+			name:   "subfields of a non struct field",
+			fields: "name.foo",
+			err:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs, err := parseFields(tt.fields)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			rv := reflect.ValueOf(res)
+			if err := validateFields(rv.Type(), fs, ""); err != nil {
+				if !tt.err {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				return
+			}
+			if tt.err {
+				t.Fatalf("expected error")
+			}
+			outj, err := json.Marshal(filterFields(rv, fs))
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if string(outj) != tt.out {
+				t.Fatalf("got %s, want %s", outj, tt.out)
+			}
+		})
+	}
+}
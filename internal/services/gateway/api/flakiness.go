@@ -0,0 +1,163 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"agola.io/agola/internal/services/gateway/action"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+type TaskFlakinessResponse struct {
+	TaskName       string `json:"task_name"`
+	Runs           int    `json:"runs"`
+	Failures       int    `json:"failures"`
+	FlakyRuns      int    `json:"flaky_runs"`
+	Flips          int    `json:"flips"`
+	Flaky          bool   `json:"flaky"`
+	Quarantined    bool   `json:"quarantined"`
+	LastFlakyRunID string `json:"last_flaky_run_id,omitempty"`
+}
+
+func createTaskFlakinessResponse(tf *rstypes.TaskFlakiness, quarantined bool) *TaskFlakinessResponse {
+	return &TaskFlakinessResponse{
+		TaskName:       tf.TaskName,
+		Runs:           tf.Runs,
+		Failures:       tf.Failures,
+		FlakyRuns:      tf.FlakyRuns,
+		Flips:          tf.Flips,
+		Flaky:          tf.Flaky(),
+		Quarantined:    quarantined,
+		LastFlakyRunID: tf.LastFlakyRunID,
+	}
+}
+
+type ProjectTasksFlakinessHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectTasksFlakinessHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectTasksFlakinessHandler {
+	return &ProjectTasksFlakinessHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectTasksFlakinessHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	var limit int
+	if limitS := query.Get("limit"); limitS != "" {
+		limit, err = strconv.Atoi(limitS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse limit: %w", err)))
+			return
+		}
+	}
+	if limit < 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("limit must be greater or equal than 0")))
+		return
+	}
+	_, onlyFlaky := query["flaky"]
+
+	project, err := h.ah.GetProject(ctx, projectRef)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	areq := &action.GetProjectTasksFlakinessRequest{
+		ProjectRef: project.ID,
+		Limit:      limit,
+	}
+	tfs, err := h.ah.GetProjectTasksFlakiness(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	quarantined := map[string]struct{}{}
+	for _, task := range project.QuarantinedTasks {
+		quarantined[task] = struct{}{}
+	}
+
+	res := []*TaskFlakinessResponse{}
+	for _, tf := range tfs {
+		if onlyFlaky && !tf.Flaky() {
+			continue
+		}
+		_, ok := quarantined[tf.TaskName]
+		res = append(res, createTaskFlakinessResponse(tf, ok))
+	}
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type UpdateProjectQuarantinedTasksRequest struct {
+	Tasks []string `json:"tasks"`
+}
+
+type UpdateProjectQuarantinedTasksHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewUpdateProjectQuarantinedTasksHandler(logger *zap.Logger, ah *action.ActionHandler) *UpdateProjectQuarantinedTasksHandler {
+	return &UpdateProjectQuarantinedTasksHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *UpdateProjectQuarantinedTasksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	var req UpdateProjectQuarantinedTasksRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	project, err := h.ah.UpdateProjectQuarantinedTasks(ctx, projectRef, req.Tasks)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createProjectResponse(project)
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
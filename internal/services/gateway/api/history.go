@@ -0,0 +1,291 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+
+	"github.com/gorilla/mux"
+)
+
+type WalActionResponse struct {
+	ActionType string `json:"action_type"`
+	DataType   string `json:"data_type"`
+	ID         string `json:"id"`
+}
+
+type WalResponse struct {
+	WalSequence string               `json:"wal_sequence"`
+	Actions     []*WalActionResponse `json:"actions"`
+}
+
+type ObjectHistoryEntryResponse struct {
+	WalSequence string          `json:"wal_sequence"`
+	ActionType  string          `json:"action_type"`
+	Data        json.RawMessage `json:"data,omitempty"`
+}
+
+type ObjectHistoryResponse struct {
+	Entries   []*ObjectHistoryEntryResponse `json:"entries"`
+	NextStart string                        `json:"next_start,omitempty"`
+}
+
+type RestoreObjectRequest struct {
+	WalSequence string `json:"wal_sequence"`
+}
+
+const (
+	DefaultWalsLimit = 10
+	MaxWalsLimit     = 100
+
+	DefaultHistoryWalsLimit = 100
+	MaxHistoryWalsLimit     = 1000
+)
+
+// createObjectHistoryData converts the object data saved in the history to the
+// same response returned by the related api so it won't contain any field
+// (secrets, tokens, sessions, credentials) that isn't already exposed.
+func createObjectHistoryData(dataType types.ConfigType, data []byte) (json.RawMessage, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var res interface{}
+	switch dataType {
+	case types.ConfigTypeUser:
+		var user *types.User
+		if err := json.Unmarshal(data, &user); err != nil {
+			return nil, errors.Errorf("failed to unmarshal user: %w", err)
+		}
+		res = createUserResponse(user)
+	case types.ConfigTypeOrg:
+		var org *types.Organization
+		if err := json.Unmarshal(data, &org); err != nil {
+			return nil, errors.Errorf("failed to unmarshal org: %w", err)
+		}
+		res = createOrgResponse(org)
+	case types.ConfigTypeOrgMember:
+		var orgMember *types.OrganizationMember
+		if err := json.Unmarshal(data, &orgMember); err != nil {
+			return nil, errors.Errorf("failed to unmarshal org member: %w", err)
+		}
+		res = createOrgMemberResponse(&types.User{ID: orgMember.UserID}, orgMember.MemberRole)
+	case types.ConfigTypeProjectGroup:
+		var projectGroup *types.ProjectGroup
+		if err := json.Unmarshal(data, &projectGroup); err != nil {
+			return nil, errors.Errorf("failed to unmarshal project group: %w", err)
+		}
+		res = createProjectGroupResponse(&csapi.ProjectGroup{ProjectGroup: projectGroup})
+	case types.ConfigTypeProject:
+		var project *types.Project
+		if err := json.Unmarshal(data, &project); err != nil {
+			return nil, errors.Errorf("failed to unmarshal project: %w", err)
+		}
+		res = createProjectResponse(&csapi.Project{Project: project})
+	case types.ConfigTypeRemoteSource:
+		var rs *types.RemoteSource
+		if err := json.Unmarshal(data, &rs); err != nil {
+			return nil, errors.Errorf("failed to unmarshal remote source: %w", err)
+		}
+		res = createRemoteSourceResponse(rs)
+	case types.ConfigTypeSecret:
+		var secret *types.Secret
+		if err := json.Unmarshal(data, &secret); err != nil {
+			return nil, errors.Errorf("failed to unmarshal secret: %w", err)
+		}
+		res = createSecretResponse(&csapi.Secret{Secret: secret})
+	case types.ConfigTypeVariable:
+		var variable *types.Variable
+		if err := json.Unmarshal(data, &variable); err != nil {
+			return nil, errors.Errorf("failed to unmarshal variable: %w", err)
+		}
+		res = createVariableResponse(&csapi.Variable{Variable: variable}, nil)
+	default:
+		// never return the data of the other types
+		return nil, nil
+	}
+
+	return json.Marshal(res)
+}
+
+type WalsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewWalsHandler(logger *zap.Logger, ah *action.ActionHandler) *WalsHandler {
+	return &WalsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *WalsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+
+	limitS := q.Get("limit")
+	limit := DefaultWalsLimit
+	if limitS != "" {
+		var err error
+		limit, err = strconv.Atoi(limitS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse limit: %w", err)))
+			return
+		}
+	}
+	if limit < 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("limit must be greater or equal than 0")))
+		return
+	}
+	if limit == 0 || limit > MaxWalsLimit {
+		limit = MaxWalsLimit
+	}
+
+	start := q.Get("start")
+
+	wals, err := h.ah.GetConfigWals(ctx, start, limit)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := make([]*WalResponse, len(wals))
+	for i, wal := range wals {
+		actions := make([]*WalActionResponse, len(wal.Actions))
+		for j, a := range wal.Actions {
+			actions[j] = &WalActionResponse{
+				ActionType: string(a.ActionType),
+				DataType:   a.DataType,
+				ID:         a.ID,
+			}
+		}
+		res[i] = &WalResponse{
+			WalSequence: wal.WalSequence,
+			Actions:     actions,
+		}
+	}
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type ObjectHistoryHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewObjectHistoryHandler(logger *zap.Logger, ah *action.ActionHandler) *ObjectHistoryHandler {
+	return &ObjectHistoryHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ObjectHistoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	q := r.URL.Query()
+	dataType := vars["datatype"]
+	id := vars["id"]
+
+	limitS := q.Get("limit")
+	limit := DefaultHistoryWalsLimit
+	if limitS != "" {
+		var err error
+		limit, err = strconv.Atoi(limitS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse limit: %w", err)))
+			return
+		}
+	}
+	if limit < 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("limit must be greater or equal than 0")))
+		return
+	}
+	if limit == 0 || limit > MaxHistoryWalsLimit {
+		limit = MaxHistoryWalsLimit
+	}
+
+	start := q.Get("start")
+
+	history, err := h.ah.GetConfigObjectHistory(ctx, dataType, id, start, limit)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := &ObjectHistoryResponse{
+		Entries:   make([]*ObjectHistoryEntryResponse, len(history.Entries)),
+		NextStart: history.NextStart,
+	}
+	for i, e := range history.Entries {
+		data, err := createObjectHistoryData(types.ConfigType(dataType), e.Data)
+		if err != nil {
+			h.log.Errorf("err: %+v", err)
+			httpError(w, err)
+			return
+		}
+		res.Entries[i] = &ObjectHistoryEntryResponse{
+			WalSequence: e.WalSequence,
+			ActionType:  string(e.ActionType),
+			Data:        data,
+		}
+	}
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type RestoreObjectHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewRestoreObjectHandler(logger *zap.Logger, ah *action.ActionHandler) *RestoreObjectHandler {
+	return &RestoreObjectHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *RestoreObjectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	var req RestoreObjectRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	areq := &action.RestoreConfigObjectRequest{
+		DataType:    vars["datatype"],
+		ID:          vars["id"],
+		WalSequence: req.WalSequence,
+	}
+	err := h.ah.RestoreConfigObject(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"agola.io/agola/internal/services/types"
+)
+
+func TestCreateObjectHistoryData(t *testing.T) {
+	tests := []struct {
+		name     string
+		dataType types.ConfigType
+		obj      interface{}
+		// secrets must not be in the returned data
+		secrets []string
+		// expected must be in the returned data
+		expected []string
+	}{
+		{
+			name:     "user",
+			dataType: types.ConfigTypeUser,
+			obj: &types.User{
+				ID:       "user01",
+				Name:     "user01name",
+				Secret:   "usersecret",
+				Password: "userpassword",
+				Tokens:   map[string]string{"token01": "usertokenvalue"},
+				LinkedAccounts: map[string]*types.LinkedAccount{
+					"la01": {
+						ID:                 "la01",
+						RemoteUserName:     "remoteuser01",
+						UserAccessToken:    "useraccesstoken",
+						Oauth2AccessToken:  "oauth2accesstoken",
+						Oauth2RefreshToken: "oauth2refreshtoken",
+					},
+				},
+				Sessions: map[string]*types.UserSession{"sessionid01": {LastUsedIP: "10.0.0.1"}},
+				TOTP:     &types.UserTOTP{Secret: "totpsecret", Enabled: true},
+			},
+			secrets:  []string{"usersecret", "userpassword", "usertokenvalue", "useraccesstoken", "oauth2accesstoken", "oauth2refreshtoken", "sessionid01", "10.0.0.1", "totpsecret"},
+			expected: []string{"user01name", "token01", "remoteuser01"},
+		},
+		{
+			name:     "remote source",
+			dataType: types.ConfigTypeRemoteSource,
+			obj: &types.RemoteSource{
+				ID:                 "rs01",
+				Name:               "rs01name",
+				Oauth2ClientID:     "clientid",
+				Oauth2ClientSecret: "clientsecret",
+			},
+			secrets:  []string{"clientsecret"},
+			expected: []string{"rs01name"},
+		},
+		{
+			name:     "project",
+			dataType: types.ConfigTypeProject,
+			obj: &types.Project{
+				ID:            "project01",
+				Name:          "project01name",
+				Secret:        "projectsecret",
+				SSHPrivateKey: "sshprivatekey",
+				WebhookSecret: "webhooksecret",
+			},
+			secrets:  []string{"projectsecret", "sshprivatekey", "webhooksecret"},
+			expected: []string{"project01name"},
+		},
+		{
+			name:     "secret",
+			dataType: types.ConfigTypeSecret,
+			obj: &types.Secret{
+				ID:   "secret01",
+				Name: "secret01name",
+				Data: map[string]string{"secretkey": "secretvalue"},
+			},
+			secrets:  []string{"secretkey", "secretvalue"},
+			expected: []string{"secret01name"},
+		},
+		{
+			name:     "unknown type",
+			dataType: types.ConfigTypeUserNotification,
+			obj: &types.UserNotification{
+				ID:    "notification01",
+				Title: "notificationtitle",
+			},
+			secrets: []string{"notification01", "notificationtitle"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.obj)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			out, err := createObjectHistoryData(tt.dataType, data)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			for _, s := range tt.secrets {
+				if strings.Contains(string(out), s) {
+					t.Fatalf("expected %q to be removed, got data: %s", s, out)
+				}
+			}
+			for _, s := range tt.expected {
+				if !strings.Contains(string(out), s) {
+					t.Fatalf("expected %q in data: %s", s, out)
+				}
+			}
+		})
+	}
+}
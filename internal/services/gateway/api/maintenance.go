@@ -0,0 +1,110 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"agola.io/agola/internal/services/gateway/action"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+
+	"go.uber.org/zap"
+)
+
+type MaintenanceResponse struct {
+	Enabled        bool       `json:"enabled"`
+	EnableTime     *time.Time `json:"enable_time"`
+	QueuedWebhooks int        `json:"queued_webhooks"`
+}
+
+func createMaintenanceResponse(m *rstypes.Maintenance, queuedWebhooks int) *MaintenanceResponse {
+	return &MaintenanceResponse{
+		Enabled:        m.Enabled,
+		EnableTime:     m.EnableTime,
+		QueuedWebhooks: queuedWebhooks,
+	}
+}
+
+type MaintenanceHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewMaintenanceHandler(logger *zap.Logger, ah *action.ActionHandler) *MaintenanceHandler {
+	return &MaintenanceHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *MaintenanceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	status, err := h.ah.GetMaintenance(ctx)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createMaintenanceResponse(status.Maintenance, status.QueuedWebhooks)
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type EnableMaintenanceHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewEnableMaintenanceHandler(logger *zap.Logger, ah *action.ActionHandler) *EnableMaintenanceHandler {
+	return &EnableMaintenanceHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *EnableMaintenanceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	maintenance, err := h.ah.EnableMaintenance(ctx)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createMaintenanceResponse(maintenance, 0)
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type DisableMaintenanceHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewDisableMaintenanceHandler(logger *zap.Logger, ah *action.ActionHandler) *DisableMaintenanceHandler {
+	return &DisableMaintenanceHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *DisableMaintenanceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	err := h.ah.DisableMaintenance(ctx)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type PathAliasResponse struct {
+	Path         string           `json:"path"`
+	ObjectType   types.ConfigType `json:"object_type"`
+	CreationTime time.Time        `json:"creation_time"`
+}
+
+func createPathAliasesResponse(pas []*types.PathAlias) []*PathAliasResponse {
+	res := make([]*PathAliasResponse, len(pas))
+	for i, pa := range pas {
+		res[i] = &PathAliasResponse{
+			Path:         pa.Path,
+			ObjectType:   pa.ObjectType,
+			CreationTime: pa.CreationTime,
+		}
+	}
+	return res
+}
+
+type ProjectPathAliasesHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectPathAliasesHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectPathAliasesHandler {
+	return &ProjectPathAliasesHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectPathAliasesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	pas, err := h.ah.GetProjectPathAliases(ctx, projectRef)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, createPathAliasesResponse(pas)); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type ProjectGroupPathAliasesHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectGroupPathAliasesHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectGroupPathAliasesHandler {
+	return &ProjectGroupPathAliasesHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectGroupPathAliasesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectGroupRef, err := url.PathUnescape(vars["projectgroupref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	pas, err := h.ah.GetProjectGroupPathAliases(ctx, projectGroupRef)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, createPathAliasesResponse(pas)); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
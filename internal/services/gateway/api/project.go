@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/url"
+	"time"
 
 	csapi "agola.io/agola/internal/services/configstore/api"
 	"agola.io/agola/internal/services/gateway/action"
@@ -35,6 +36,31 @@ type CreateProjectRequest struct {
 	RepoPath            string           `json:"repo_path,omitempty"`
 	RemoteSourceName    string           `json:"remote_source_name,omitempty"`
 	SkipSSHHostKeyCheck bool             `json:"skip_ssh_host_key_check,omitempty"`
+	// PollingInterval, when not zero, enables the remote repository polling
+	PollingInterval time.Duration `json:"polling_interval,omitempty"`
+	// Schedules are the cron schedules creating the project branch runs
+	Schedules []*types.ProjectSchedule `json:"schedules,omitempty"`
+	// ConfigDirs are the monorepo config directories patterns
+	ConfigDirs []string `json:"config_dirs,omitempty"`
+	// ConfigPath is the config file path used instead of the default config
+	// dir
+	ConfigPath string `json:"config_path,omitempty"`
+	// ConfigRepo is the repository providing the run config instead of the
+	// project repository
+	ConfigRepo *types.ProjectConfigRepo `json:"config_repo,omitempty"`
+	// RemoteTasksRepos are the additional repositories whose remote tasks
+	// can be used by the project runs
+	RemoteTasksRepos []string `json:"remote_tasks_repos,omitempty"`
+	// TaskCommitStatuses reports a commit status per run task instead of a
+	// single status for the whole run
+	TaskCommitStatuses bool `json:"task_commit_statuses,omitempty"`
+	// EmailNotifications, when provided, enables the runs email notifications
+	EmailNotifications *types.ProjectEmailNotifications `json:"email_notifications,omitempty"`
+	// NotificationChannels are the chat channels notified of the finished runs
+	NotificationChannels []*types.ProjectNotificationChannel `json:"notification_channels,omitempty"`
+	// NotificationRules define additional notifications to the notification
+	// channels
+	NotificationRules []*types.NotificationRule `json:"notification_rules,omitempty"`
 }
 
 type CreateProjectHandler struct {
@@ -63,6 +89,17 @@ func (h *CreateProjectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		RepoPath:            req.RepoPath,
 		RemoteSourceName:    req.RemoteSourceName,
 		SkipSSHHostKeyCheck: req.SkipSSHHostKeyCheck,
+		PollingInterval:     req.PollingInterval,
+		Schedules:           req.Schedules,
+		ConfigDirs:          req.ConfigDirs,
+		ConfigPath:          req.ConfigPath,
+		ConfigRepo:          req.ConfigRepo,
+		RemoteTasksRepos:    req.RemoteTasksRepos,
+		TaskCommitStatuses:  req.TaskCommitStatuses,
+		EmailNotifications:  req.EmailNotifications,
+
+		NotificationChannels: req.NotificationChannels,
+		NotificationRules:    req.NotificationRules,
 	}
 
 	project, err := h.ah.CreateProject(ctx, areq)
@@ -80,6 +117,38 @@ func (h *CreateProjectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 type UpdateProjectRequest struct {
 	Name       string           `json:"name,omitempty"`
 	Visibility types.Visibility `json:"visibility,omitempty"`
+	// CoverageBaseBranch is updated only when provided
+	CoverageBaseBranch *string `json:"coverage_base_branch,omitempty"`
+	// CloneURL is updated only when provided
+	CloneURL *string `json:"clone_url,omitempty"`
+	// AnonymousAccess is updated only when provided
+	AnonymousAccess *types.AnonymousAccess `json:"anonymous_access,omitempty"`
+	// PollingInterval is updated only when provided. Zero disables the
+	// remote repository polling
+	PollingInterval *time.Duration `json:"polling_interval,omitempty"`
+	// Schedules are updated only when provided. An empty list disables the
+	// scheduled runs
+	Schedules *[]*types.ProjectSchedule `json:"schedules,omitempty"`
+	// ConfigDirs are updated only when provided. An empty list disables the
+	// monorepo configs
+	ConfigDirs *[]string `json:"config_dirs,omitempty"`
+	// ConfigPath is updated only when provided. An empty config path
+	// restores the default config dir
+	ConfigPath *string `json:"config_path,omitempty"`
+	// ConfigRepo is updated only when provided. An empty config repo
+	// restores the project repository config
+	ConfigRepo *types.ProjectConfigRepo `json:"config_repo,omitempty"`
+	// RemoteTasksRepos are updated only when provided
+	RemoteTasksRepos *[]string `json:"remote_tasks_repos,omitempty"`
+	// TaskCommitStatuses is updated only when provided
+	TaskCommitStatuses *bool `json:"task_commit_statuses,omitempty"`
+	// EmailNotifications are updated only when provided, empty email
+	// notifications disable them
+	EmailNotifications *types.ProjectEmailNotifications `json:"email_notifications,omitempty"`
+	// NotificationChannels are updated only when provided
+	NotificationChannels *[]*types.ProjectNotificationChannel `json:"notification_channels,omitempty"`
+	// NotificationRules are updated only when provided
+	NotificationRules *[]*types.NotificationRule `json:"notification_rules,omitempty"`
 }
 
 type UpdateProjectHandler struct {
@@ -108,8 +177,22 @@ func (h *UpdateProjectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	}
 
 	areq := &action.UpdateProjectRequest{
-		Name:       req.Name,
-		Visibility: req.Visibility,
+		Name:               req.Name,
+		Visibility:         req.Visibility,
+		CoverageBaseBranch: req.CoverageBaseBranch,
+		CloneURL:           req.CloneURL,
+		AnonymousAccess:    req.AnonymousAccess,
+		PollingInterval:    req.PollingInterval,
+		Schedules:          req.Schedules,
+		ConfigDirs:         req.ConfigDirs,
+		ConfigPath:         req.ConfigPath,
+		ConfigRepo:         req.ConfigRepo,
+		RemoteTasksRepos:   req.RemoteTasksRepos,
+		TaskCommitStatuses: req.TaskCommitStatuses,
+		EmailNotifications: req.EmailNotifications,
+
+		NotificationChannels: req.NotificationChannels,
+		NotificationRules:    req.NotificationRules,
 	}
 	project, err := h.ah.UpdateProject(ctx, projectRef, areq)
 	if httpError(w, err) {
@@ -234,28 +317,79 @@ func (h *ProjectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	res := createProjectResponse(project)
-	if err := httpResponse(w, http.StatusOK, res); err != nil {
+	if err := httpFieldsResponse(w, r, http.StatusOK, res); err != nil {
 		h.log.Errorf("err: %+v", err)
 	}
 }
 
 type ProjectResponse struct {
-	ID               string           `json:"id,omitempty"`
-	Name             string           `json:"name,omitempty"`
-	Path             string           `json:"path,omitempty"`
-	ParentPath       string           `json:"parent_path,omitempty"`
-	Visibility       types.Visibility `json:"visibility,omitempty"`
-	GlobalVisibility string           `json:"global_visibility,omitempty"`
+	ID                 string           `json:"id,omitempty"`
+	Name               string           `json:"name,omitempty"`
+	Path               string           `json:"path,omitempty"`
+	ParentPath         string           `json:"parent_path,omitempty"`
+	Visibility         types.Visibility `json:"visibility,omitempty"`
+	GlobalVisibility   string           `json:"global_visibility,omitempty"`
+	QuarantinedTasks   []string         `json:"quarantined_tasks,omitempty"`
+	CoverageBaseBranch string           `json:"coverage_base_branch,omitempty"`
+	CloneURL           string           `json:"clone_url,omitempty"`
+
+	AnonymousAccess *types.AnonymousAccess `json:"anonymous_access,omitempty"`
+
+	RunDefaults *ProjectRunDefaultsResponse `json:"run_defaults,omitempty"`
+
+	// PollingInterval is the remote repository polling interval, zero when
+	// the polling is disabled
+	PollingInterval time.Duration `json:"polling_interval,omitempty"`
+
+	Schedules []*types.ProjectSchedule `json:"schedules,omitempty"`
+
+	ConfigDirs []string `json:"config_dirs,omitempty"`
+	ConfigPath string   `json:"config_path,omitempty"`
+
+	ConfigRepo *types.ProjectConfigRepo `json:"config_repo,omitempty"`
+
+	RemoteTasksRepos []string `json:"remote_tasks_repos,omitempty"`
+
+	TaskCommitStatuses bool `json:"task_commit_statuses,omitempty"`
+
+	EmailNotifications *types.ProjectEmailNotifications `json:"email_notifications,omitempty"`
+
+	NotificationChannels []*types.ProjectNotificationChannel `json:"notification_channels,omitempty"`
+	NotificationRules    []*types.NotificationRule           `json:"notification_rules,omitempty"`
 }
 
 func createProjectResponse(r *csapi.Project) *ProjectResponse {
 	res := &ProjectResponse{
-		ID:               r.ID,
-		Name:             r.Name,
-		Path:             r.Path,
-		ParentPath:       r.ParentPath,
-		Visibility:       r.Visibility,
-		GlobalVisibility: string(r.GlobalVisibility),
+		ID:                 r.ID,
+		Name:               r.Name,
+		Path:               r.Path,
+		ParentPath:         r.ParentPath,
+		Visibility:         r.Visibility,
+		GlobalVisibility:   string(r.GlobalVisibility),
+		QuarantinedTasks:   r.QuarantinedTasks,
+		CoverageBaseBranch: r.CoverageBaseBranch,
+		CloneURL:           r.CloneURL,
+
+		AnonymousAccess: r.AnonymousAccess,
+
+		RunDefaults: createProjectRunDefaultsResponse(r.RunDefaults),
+
+		Schedules: r.Schedules,
+
+		ConfigDirs: r.ConfigDirs,
+		ConfigPath: r.ConfigPath,
+		ConfigRepo: r.ConfigRepo,
+
+		RemoteTasksRepos: r.RemoteTasksRepos,
+
+		TaskCommitStatuses: r.TaskCommitStatuses,
+		EmailNotifications: r.EmailNotifications,
+
+		NotificationChannels: r.NotificationChannels,
+		NotificationRules:    r.NotificationRules,
+	}
+	if r.Polling != nil {
+		res.PollingInterval = r.Polling.Interval
 	}
 
 	return res
@@ -266,6 +400,9 @@ type ProjectCreateRunRequest struct {
 	Tag       string `json:"tag,omitempty"`
 	Ref       string `json:"ref,omitempty"`
 	CommitSHA string `json:"commit_sha,omitempty"`
+	// Annotations are additional run annotations. Only the "clone_url"
+	// annotation, overriding the run clone url, is currently accepted.
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 type ProjectCreateRunHandler struct {
@@ -293,7 +430,56 @@ func (h *ProjectCreateRunHandler) ServeHTTP(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = h.ah.ProjectCreateRun(ctx, projectRef, req.Branch, req.Tag, req.Ref, req.CommitSHA)
+	err = h.ah.ProjectCreateRun(ctx, projectRef, req.Branch, req.Tag, req.Ref, req.CommitSHA, req.Annotations)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusCreated, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type ProjectCreateFileRequest struct {
+	Branch  string `json:"branch,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message,omitempty"`
+	Content []byte `json:"content,omitempty"`
+}
+
+type ProjectCreateFileHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectCreateFileHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectCreateFileHandler {
+	return &ProjectCreateFileHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectCreateFileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	var req ProjectCreateFileRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	areq := &action.ProjectCreateFileRequest{
+		Branch:  req.Branch,
+		Path:    req.Path,
+		Message: req.Message,
+		Content: req.Content,
+	}
+	err = h.ah.ProjectCreateFile(ctx, projectRef, areq)
 	if httpError(w, err) {
 		h.log.Errorf("err: %+v", err)
 		return
@@ -0,0 +1,137 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+type ProjectChangeResponse struct {
+	ID            string          `json:"id"`
+	Action        string          `json:"action"`
+	ObjectType    string          `json:"object_type"`
+	ObjectID      string          `json:"object_id,omitempty"`
+	ObjectName    string          `json:"object_name,omitempty"`
+	ChangedBy     string          `json:"changed_by,omitempty"`
+	ChangedByName string          `json:"changed_by_name,omitempty"`
+	ChangeTime    time.Time       `json:"change_time"`
+	Data          json.RawMessage `json:"data,omitempty"`
+	RollbackFrom  string          `json:"rollback_from,omitempty"`
+}
+
+func createProjectChangeResponse(pc *action.ProjectChange) *ProjectChangeResponse {
+	return &ProjectChangeResponse{
+		ID:            pc.ID,
+		Action:        string(pc.Action),
+		ObjectType:    string(pc.ObjectType),
+		ObjectID:      pc.ObjectID,
+		ObjectName:    pc.ObjectName,
+		ChangedBy:     pc.ChangedBy,
+		ChangedByName: pc.ChangedByName,
+		ChangeTime:    pc.ChangeTime,
+		Data:          pc.Data,
+		RollbackFrom:  pc.RollbackFrom,
+	}
+}
+
+type ProjectChangesHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectChangesHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectChangesHandler {
+	return &ProjectChangesHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectChangesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	var limit int
+	if limitS := query.Get("limit"); limitS != "" {
+		limit, err = strconv.Atoi(limitS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse limit: %w", err)))
+			return
+		}
+	}
+	if limit < 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("limit must be greater or equal than 0")))
+		return
+	}
+
+	pcs, err := h.ah.GetProjectChanges(ctx, projectRef, limit)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := make([]*ProjectChangeResponse, len(pcs))
+	for i, pc := range pcs {
+		res[i] = createProjectChangeResponse(pc)
+	}
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type ProjectRollbackHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectRollbackHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectRollbackHandler {
+	return &ProjectRollbackHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectRollbackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+	projectChangeID := vars["changeid"]
+
+	project, err := h.ah.RollbackProjectSettings(ctx, projectRef, projectChangeID)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createProjectResponse(project)
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
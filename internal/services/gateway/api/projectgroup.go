@@ -180,7 +180,7 @@ func (h *ProjectGroupHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	}
 
 	res := createProjectGroupResponse(projectGroup)
-	if err := httpResponse(w, http.StatusOK, res); err != nil {
+	if err := httpFieldsResponse(w, r, http.StatusOK, res); err != nil {
 		h.log.Errorf("err: %+v", err)
 	}
 }
@@ -214,7 +214,7 @@ func (h *ProjectGroupProjectsHandler) ServeHTTP(w http.ResponseWriter, r *http.R
 		projects[i] = createProjectResponse(p)
 	}
 
-	if err := httpResponse(w, http.StatusOK, projects); err != nil {
+	if err := httpFieldsResponse(w, r, http.StatusOK, projects); err != nil {
 		h.log.Errorf("err: %+v", err)
 	}
 }
@@ -248,7 +248,7 @@ func (h *ProjectGroupSubgroupsHandler) ServeHTTP(w http.ResponseWriter, r *http.
 		subgroups[i] = createProjectGroupResponse(g)
 	}
 
-	if err := httpResponse(w, http.StatusOK, subgroups); err != nil {
+	if err := httpFieldsResponse(w, r, http.StatusOK, subgroups); err != nil {
 		h.log.Errorf("err: %+v", err)
 	}
 }
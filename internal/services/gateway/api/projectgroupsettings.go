@@ -0,0 +1,213 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type SettingsResponse struct {
+	DefaultVisibility types.Visibility            `json:"default_visibility,omitempty"`
+	RunDefaults       *ProjectRunDefaultsResponse `json:"run_defaults,omitempty"`
+}
+
+type InheritedSettingsResponse struct {
+	DefaultVisibility types.Visibility `json:"default_visibility,omitempty"`
+	// DefaultVisibilityFrom is the path of the project group defining the
+	// default visibility
+	DefaultVisibilityFrom string                      `json:"default_visibility_from,omitempty"`
+	RunDefaults           *ProjectRunDefaultsResponse `json:"run_defaults,omitempty"`
+	// RunDefaultsFrom is the path of the project group defining the run
+	// defaults
+	RunDefaultsFrom string `json:"run_defaults_from,omitempty"`
+}
+
+type ProjectGroupSettingsResponse struct {
+	Settings  *SettingsResponse          `json:"settings,omitempty"`
+	Inherited *InheritedSettingsResponse `json:"inherited"`
+}
+
+type UpdateProjectGroupSettingsResponse struct {
+	Settings *SettingsResponse `json:"settings,omitempty"`
+	// Enforce are the results of the settings application to the existing
+	// childs
+	Enforce *BulkOperationResponse `json:"enforce,omitempty"`
+}
+
+type ProjectEffectiveSettingsResponse struct {
+	Visibility       types.Visibility            `json:"visibility"`
+	GlobalVisibility types.Visibility            `json:"global_visibility"`
+	RunDefaults      *ProjectRunDefaultsResponse `json:"run_defaults,omitempty"`
+	Inherited        *InheritedSettingsResponse  `json:"inherited"`
+}
+
+func createSettingsResponse(s *types.ProjectGroupSettings) *SettingsResponse {
+	if s == nil {
+		return nil
+	}
+	return &SettingsResponse{
+		DefaultVisibility: s.DefaultVisibility,
+		RunDefaults:       createProjectRunDefaultsResponse(s.RunDefaults),
+	}
+}
+
+func createInheritedSettingsResponse(is *action.InheritedSettings) *InheritedSettingsResponse {
+	return &InheritedSettingsResponse{
+		DefaultVisibility:     is.DefaultVisibility,
+		DefaultVisibilityFrom: is.DefaultVisibilityFrom,
+		RunDefaults:           createProjectRunDefaultsResponse(is.RunDefaults),
+		RunDefaultsFrom:       is.RunDefaultsFrom,
+	}
+}
+
+// UpdateProjectGroupSettingsRequest sets the project group settings. When all
+// the settings are empty they will be removed.
+type UpdateProjectGroupSettingsRequest struct {
+	DefaultVisibility types.Visibility                 `json:"default_visibility"`
+	RunDefaults       *UpdateProjectRunDefaultsRequest `json:"run_defaults"`
+	// Enforce applies the settings also to the existing childs
+	Enforce bool `json:"enforce"`
+}
+
+type ProjectGroupSettingsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectGroupSettingsHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectGroupSettingsHandler {
+	return &ProjectGroupSettingsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectGroupSettingsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectGroupRef, err := url.PathUnescape(vars["projectgroupref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	pgs, err := h.ah.GetProjectGroupSettings(ctx, projectGroupRef)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := &ProjectGroupSettingsResponse{
+		Settings:  createSettingsResponse(pgs.Settings),
+		Inherited: createInheritedSettingsResponse(pgs.Inherited),
+	}
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type UpdateProjectGroupSettingsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewUpdateProjectGroupSettingsHandler(logger *zap.Logger, ah *action.ActionHandler) *UpdateProjectGroupSettingsHandler {
+	return &UpdateProjectGroupSettingsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *UpdateProjectGroupSettingsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectGroupRef, err := url.PathUnescape(vars["projectgroupref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	var req UpdateProjectGroupSettingsRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	var settings *types.ProjectGroupSettings
+	var runDefaults *types.ProjectRunDefaults
+	if req.RunDefaults != nil {
+		runDefaults = req.RunDefaults.toProjectRunDefaults()
+	}
+	if req.DefaultVisibility != "" || runDefaults != nil {
+		settings = &types.ProjectGroupSettings{
+			DefaultVisibility: req.DefaultVisibility,
+			RunDefaults:       runDefaults,
+		}
+	}
+
+	pg, results, err := h.ah.UpdateProjectGroupSettings(ctx, projectGroupRef, settings, req.Enforce)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := &UpdateProjectGroupSettingsResponse{
+		Settings: createSettingsResponse(pg.Settings),
+	}
+	if req.Enforce {
+		res.Enforce = createBulkOperationResponse(results)
+	}
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type ProjectEffectiveSettingsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectEffectiveSettingsHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectEffectiveSettingsHandler {
+	return &ProjectEffectiveSettingsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectEffectiveSettingsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	es, err := h.ah.GetProjectEffectiveSettings(ctx, projectRef)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := &ProjectEffectiveSettingsResponse{
+		Visibility:       es.Visibility,
+		GlobalVisibility: es.GlobalVisibility,
+		RunDefaults:      createProjectRunDefaultsResponse(es.RunDefaults),
+		Inherited:        createInheritedSettingsResponse(es.Inherited),
+	}
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+type ProjectGroupTreeItemType string
+
+const (
+	ProjectGroupTreeItemTypeProjectGroup ProjectGroupTreeItemType = "projectgroup"
+	ProjectGroupTreeItemTypeProject      ProjectGroupTreeItemType = "project"
+)
+
+type ProjectGroupTreeItemResponse struct {
+	Type  ProjectGroupTreeItemType `json:"type"`
+	Path  string                   `json:"path"`
+	Depth int                      `json:"depth"`
+
+	ProjectGroup *ProjectGroupResponse `json:"project_group,omitempty"`
+	Project      *ProjectResponse      `json:"project,omitempty"`
+	// LastRun is the project latest run
+	LastRun *RunsResponse `json:"last_run,omitempty"`
+}
+
+func createProjectGroupTreeItemResponse(item *action.ProjectGroupTreeItem) *ProjectGroupTreeItemResponse {
+	res := &ProjectGroupTreeItemResponse{
+		Path:  item.Path(),
+		Depth: item.Depth,
+	}
+	if item.Project != nil {
+		res.Type = ProjectGroupTreeItemTypeProject
+		res.Project = createProjectResponse(item.Project)
+		if item.LastRun != nil {
+			res.LastRun = createRunsResponse(item.LastRun)
+		}
+	} else {
+		res.Type = ProjectGroupTreeItemTypeProjectGroup
+		res.ProjectGroup = createProjectGroupResponse(item.ProjectGroup)
+	}
+	return res
+}
+
+type ProjectGroupTreeHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectGroupTreeHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectGroupTreeHandler {
+	return &ProjectGroupTreeHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectGroupTreeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+	vars := mux.Vars(r)
+	projectGroupRef, err := url.PathUnescape(vars["projectgroupref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	start := query.Get("start")
+
+	var limit int
+	if limitS := query.Get("limit"); limitS != "" {
+		limit, err = strconv.Atoi(limitS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse limit: %w", err)))
+			return
+		}
+	}
+	if limit < 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("limit must be greater or equal than 0")))
+		return
+	}
+
+	items, err := h.ah.GetProjectGroupTree(ctx, projectGroupRef, start, limit)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := make([]*ProjectGroupTreeItemResponse, len(items))
+	for i, item := range items {
+		res[i] = createProjectGroupTreeItemResponse(item)
+	}
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
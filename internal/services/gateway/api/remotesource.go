@@ -40,6 +40,8 @@ type CreateRemoteSourceRequest struct {
 	SkipSSHHostKeyCheck bool   `json:"skip_ssh_host_key_check"`
 	RegistrationEnabled *bool  `json:"registration_enabled"`
 	LoginEnabled        *bool  `json:"login_enabled"`
+	UserNameStripDomain bool   `json:"username_strip_domain"`
+	UserNamePrefix      string `json:"username_prefix"`
 }
 
 type CreateRemoteSourceHandler struct {
@@ -73,6 +75,8 @@ func (h *CreateRemoteSourceHandler) ServeHTTP(w http.ResponseWriter, r *http.Req
 		SkipSSHHostKeyCheck: req.SkipSSHHostKeyCheck,
 		RegistrationEnabled: req.RegistrationEnabled,
 		LoginEnabled:        req.LoginEnabled,
+		UserNameStripDomain: req.UserNameStripDomain,
+		UserNamePrefix:      req.UserNamePrefix,
 	}
 	rs, err := h.ah.CreateRemoteSource(ctx, creq)
 	if httpError(w, err) {
@@ -96,6 +100,8 @@ type UpdateRemoteSourceRequest struct {
 	SkipSSHHostKeyCheck *bool   `json:"skip_ssh_host_key_check"`
 	RegistrationEnabled *bool   `json:"registration_enabled"`
 	LoginEnabled        *bool   `json:"login_enabled"`
+	UserNameStripDomain *bool   `json:"username_strip_domain"`
+	UserNamePrefix      *string `json:"username_prefix"`
 }
 
 type UpdateRemoteSourceHandler struct {
@@ -131,6 +137,8 @@ func (h *UpdateRemoteSourceHandler) ServeHTTP(w http.ResponseWriter, r *http.Req
 		SkipSSHHostKeyCheck: req.SkipSSHHostKeyCheck,
 		RegistrationEnabled: req.RegistrationEnabled,
 		LoginEnabled:        req.LoginEnabled,
+		UserNameStripDomain: req.UserNameStripDomain,
+		UserNamePrefix:      req.UserNamePrefix,
 	}
 	rs, err := h.ah.UpdateRemoteSource(ctx, creq)
 	if httpError(w, err) {
@@ -150,6 +158,8 @@ type RemoteSourceResponse struct {
 	AuthType            string `json:"auth_type"`
 	RegistrationEnabled bool   `json:"registration_enabled"`
 	LoginEnabled        bool   `json:"login_enabled"`
+	UserNameStripDomain bool   `json:"username_strip_domain"`
+	UserNamePrefix      string `json:"username_prefix"`
 }
 
 func createRemoteSourceResponse(r *types.RemoteSource) *RemoteSourceResponse {
@@ -160,6 +170,10 @@ func createRemoteSourceResponse(r *types.RemoteSource) *RemoteSourceResponse {
 		RegistrationEnabled: *r.RegistrationEnabled,
 		LoginEnabled:        *r.LoginEnabled,
 	}
+	if r.UserNameMapping != nil {
+		rs.UserNameStripDomain = r.UserNameMapping.StripDomain
+		rs.UserNamePrefix = r.UserNameMapping.Prefix
+	}
 	return rs
 }
 
@@ -271,3 +285,146 @@ func (h *DeleteRemoteSourceHandler) ServeHTTP(w http.ResponseWriter, r *http.Req
 		h.log.Errorf("err: %+v", err)
 	}
 }
+
+type RemoteSourceCheckResponse struct {
+	APIReachable      bool   `json:"api_reachable"`
+	APIError          string `json:"api_error,omitempty"`
+	Oauth2ClientValid *bool  `json:"oauth2_client_valid,omitempty"`
+	Oauth2ClientError string `json:"oauth2_client_error,omitempty"`
+}
+
+type CheckRemoteSourceHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewCheckRemoteSourceHandler(logger *zap.Logger, ah *action.ActionHandler) *CheckRemoteSourceHandler {
+	return &CheckRemoteSourceHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *CheckRemoteSourceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	rsRef := vars["remotesourceref"]
+
+	cres, err := h.ah.CheckRemoteSource(ctx, rsRef)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := &RemoteSourceCheckResponse{
+		APIReachable:      cres.APIReachable,
+		APIError:          cres.APIError,
+		Oauth2ClientValid: cres.Oauth2ClientValid,
+		Oauth2ClientError: cres.Oauth2ClientError,
+	}
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type RotateRemoteSourceSecretRequest struct {
+	Oauth2ClientID     string `json:"oauth_2_client_id"`
+	Oauth2ClientSecret string `json:"oauth_2_client_secret"`
+	SkipCheck          bool   `json:"skip_check"`
+}
+
+type RotateRemoteSourceSecretHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewRotateRemoteSourceSecretHandler(logger *zap.Logger, ah *action.ActionHandler) *RotateRemoteSourceSecretHandler {
+	return &RotateRemoteSourceSecretHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *RotateRemoteSourceSecretHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	rsRef := vars["remotesourceref"]
+
+	var req RotateRemoteSourceSecretRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	creq := &action.RotateRemoteSourceSecretRequest{
+		RemoteSourceRef:    rsRef,
+		Oauth2ClientID:     req.Oauth2ClientID,
+		Oauth2ClientSecret: req.Oauth2ClientSecret,
+		SkipCheck:          req.SkipCheck,
+	}
+	rs, err := h.ah.RotateRemoteSourceSecret(ctx, creq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createRemoteSourceResponse(rs)
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type MigrateRemoteSourceRequest struct {
+	APIURL     string  `json:"apiurl"`
+	SkipVerify *bool   `json:"skip_verify"`
+	SSHHostKey *string `json:"ssh_host_key"`
+}
+
+type LinkedAccountMigrationResponse struct {
+	UserName        string                              `json:"username"`
+	LinkedAccountID string                              `json:"linked_account_id"`
+	Status          action.LinkedAccountMigrationStatus `json:"status"`
+	Error           string                              `json:"error,omitempty"`
+}
+
+type MigrateRemoteSourceHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewMigrateRemoteSourceHandler(logger *zap.Logger, ah *action.ActionHandler) *MigrateRemoteSourceHandler {
+	return &MigrateRemoteSourceHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *MigrateRemoteSourceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	rsRef := vars["remotesourceref"]
+
+	var req MigrateRemoteSourceRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	creq := &action.MigrateRemoteSourceRequest{
+		RemoteSourceRef: rsRef,
+		APIURL:          req.APIURL,
+		SkipVerify:      req.SkipVerify,
+		SSHHostKey:      req.SSHHostKey,
+	}
+	migrations, err := h.ah.MigrateRemoteSource(ctx, creq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := make([]*LinkedAccountMigrationResponse, len(migrations))
+	for i, m := range migrations {
+		res[i] = &LinkedAccountMigrationResponse{
+			UserName:        m.UserName,
+			LinkedAccountID: m.LinkedAccountID,
+			Status:          m.Status,
+			Error:           m.Error,
+		}
+	}
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
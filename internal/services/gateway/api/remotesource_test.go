@@ -0,0 +1,275 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	slog "agola.io/agola/internal/log"
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// testRemoteSources is a fake configstore with the gitea oauth2 remote source
+// and the user01 and user02 users linked to it, recording the remote source
+// and linked accounts updates.
+type testRemoteSources struct {
+	t  *testing.T
+	mu sync.Mutex
+
+	rs      *types.RemoteSource
+	updates []string
+}
+
+func (s *testRemoteSources) addUpdate(update string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updates = append(s.updates, update)
+}
+
+func (s *testRemoteSources) getUpdates() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.updates
+}
+
+func (s *testRemoteSources) writeJSON(w http.ResponseWriter, v interface{}) {
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.t.Errorf("unexpected err: %v", err)
+	}
+}
+
+func (s *testRemoteSources) router() *mux.Router {
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1alpha/remotesources/{rsref}", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.writeJSON(w, s.rs)
+	}).Methods("GET")
+	router.HandleFunc("/api/v1alpha/remotesources/{rsref}", func(w http.ResponseWriter, r *http.Request) {
+		var rs *types.RemoteSource
+		if err := json.NewDecoder(r.Body).Decode(&rs); err != nil {
+			s.t.Errorf("unexpected err: %v", err)
+		}
+		s.addUpdate("remotesource " + rs.APIURL + " " + rs.Oauth2ClientSecret)
+		s.writeJSON(w, rs)
+	}).Methods("PUT")
+	router.HandleFunc("/api/v1alpha/users", func(w http.ResponseWriter, r *http.Request) {
+		s.writeJSON(w, []*types.User{
+			{ID: "user01", Name: "user01", LinkedAccounts: map[string]*types.LinkedAccount{
+				"la01": {ID: "la01", RemoteSourceID: "remotesource01", RemoteUserID: "1", RemoteUserName: "oldremoteuser", Oauth2AccessToken: "token01"},
+			}},
+			{ID: "user02", Name: "user02", LinkedAccounts: map[string]*types.LinkedAccount{
+				"la02": {ID: "la02", RemoteSourceID: "remotesource01", RemoteUserID: "2", RemoteUserName: "remoteuser02", Oauth2AccessToken: "token02"},
+			}},
+			{ID: "user03", Name: "user03"},
+		})
+	}).Methods("GET")
+	router.HandleFunc("/api/v1alpha/users/{userref}/linkedaccounts/{laid}", func(w http.ResponseWriter, r *http.Request) {
+		var req csapi.UpdateUserLARequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.t.Errorf("unexpected err: %v", err)
+		}
+		vars := mux.Vars(r)
+		s.addUpdate("linkedaccount " + vars["userref"] + " " + vars["laid"] + " " + req.RemoteUserID + " " + req.RemoteUserName)
+		s.writeJSON(w, &types.LinkedAccount{})
+	}).Methods("PUT")
+	return router
+}
+
+// newTestGitea returns a fake gitea accepting the validsecret and newsecret
+// oauth2 client secrets. The remote user of the token01 and token02 tokens is
+// the user with id 2.
+func newTestGitea(t *testing.T) *httptest.Server {
+	writeJSON := func(w http.ResponseWriter, status int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/version", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"version": "1.9.0"})
+	})
+	router.HandleFunc("/api/v1/user", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"id": 2, "login": "remoteuser02"})
+	})
+	router.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		switch r.FormValue("client_secret") {
+		case "validsecret", "newsecret":
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		default:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unauthorized_client"})
+		}
+	}).Methods("POST")
+	return httptest.NewServer(router)
+}
+
+func TestRemoteSourceHandlers(t *testing.T) {
+	gitea := newTestGitea(t)
+	defer gitea.Close()
+
+	// a stopped server to test unreachable api urls
+	stopped := httptest.NewServer(http.NotFoundHandler())
+	stopped.Close()
+
+	tests := []struct {
+		name            string
+		method          string
+		path            string
+		req             interface{}
+		notAdmin        bool
+		expectedStatus  int
+		expectedRes     interface{}
+		expectedUpdates []string
+	}{
+		{
+			name:           "check",
+			method:         "POST",
+			path:           "/remotesources/gitea/check",
+			expectedStatus: http.StatusOK,
+			expectedRes:    &RemoteSourceCheckResponse{APIReachable: true, Oauth2ClientValid: util.BoolP(true)},
+		},
+		{
+			name:           "check as not admin",
+			method:         "POST",
+			path:           "/remotesources/gitea/check",
+			notAdmin:       true,
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:            "rotate secret",
+			method:          "PUT",
+			path:            "/remotesources/gitea/oauth2secret",
+			req:             &RotateRemoteSourceSecretRequest{Oauth2ClientSecret: "newsecret"},
+			expectedStatus:  http.StatusOK,
+			expectedUpdates: []string{"remotesource " + gitea.URL + " newsecret"},
+		},
+		{
+			name:           "rotate secret with rejected secret",
+			method:         "PUT",
+			path:           "/remotesources/gitea/oauth2secret",
+			req:            &RotateRemoteSourceSecretRequest{Oauth2ClientSecret: "wrongsecret"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:            "rotate secret with rejected secret skipping the check",
+			method:          "PUT",
+			path:            "/remotesources/gitea/oauth2secret",
+			req:             &RotateRemoteSourceSecretRequest{Oauth2ClientSecret: "wrongsecret", SkipCheck: true},
+			expectedStatus:  http.StatusOK,
+			expectedUpdates: []string{"remotesource " + gitea.URL + " wrongsecret"},
+		},
+		{
+			name:           "rotate empty secret",
+			method:         "PUT",
+			path:           "/remotesources/gitea/oauth2secret",
+			req:            &RotateRemoteSourceSecretRequest{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "migrate",
+			method:         "POST",
+			path:           "/remotesources/gitea/migrate",
+			req:            &MigrateRemoteSourceRequest{APIURL: gitea.URL},
+			expectedStatus: http.StatusOK,
+			expectedRes: []*LinkedAccountMigrationResponse{
+				{UserName: "user01", LinkedAccountID: "la01", Status: action.LinkedAccountMigrationStatusUpdated},
+				{UserName: "user02", LinkedAccountID: "la02", Status: action.LinkedAccountMigrationStatusUnchanged},
+			},
+			expectedUpdates: []string{"remotesource " + gitea.URL + " validsecret", "linkedaccount user01 la01 2 remoteuser02"},
+		},
+		{
+			name:           "migrate to unreachable api url",
+			method:         "POST",
+			path:           "/remotesources/gitea/migrate",
+			req:            &MigrateRemoteSourceRequest{APIURL: stopped.URL},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &testRemoteSources{
+				t: t,
+				rs: &types.RemoteSource{
+					ID:                  "remotesource01",
+					Name:                "gitea",
+					APIURL:              gitea.URL,
+					Type:                types.RemoteSourceTypeGitea,
+					AuthType:            types.RemoteSourceAuthTypeOauth2,
+					Oauth2ClientID:      "clientid",
+					Oauth2ClientSecret:  "validsecret",
+					RegistrationEnabled: util.BoolP(true),
+					LoginEnabled:        util.BoolP(true),
+				},
+			}
+			cs := httptest.NewServer(s.router())
+			defer cs.Close()
+
+			logger := slog.New(zap.NewAtomicLevelAt(zap.FatalLevel))
+			ah := action.NewActionHandler(logger, nil, csapi.NewClient(cs.URL), nil, "agola", "", "", nil, nil, nil, nil, nil, nil, nil, 0)
+
+			router := mux.NewRouter()
+			router.Handle("/remotesources/{remotesourceref}/check", NewCheckRemoteSourceHandler(logger, ah)).Methods("POST")
+			router.Handle("/remotesources/{remotesourceref}/oauth2secret", NewRotateRemoteSourceSecretHandler(logger, ah)).Methods("PUT")
+			router.Handle("/remotesources/{remotesourceref}/migrate", NewMigrateRemoteSourceHandler(logger, ah)).Methods("POST")
+
+			reqj, err := json.Marshal(tt.req)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			r := httptest.NewRequest(tt.method, tt.path, bytes.NewReader(reqj))
+			ctx := context.WithValue(r.Context(), "userid", "admin01")
+			if !tt.notAdmin {
+				ctx = context.WithValue(ctx, "admin", true)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r.WithContext(ctx))
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedRes != nil {
+				// decode the response in a value of the expected response type
+				res := reflect.New(reflect.TypeOf(tt.expectedRes))
+				if err := json.NewDecoder(w.Body).Decode(res.Interface()); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				if diff := cmp.Diff(tt.expectedRes, res.Elem().Interface()); diff != "" {
+					t.Error(diff)
+				}
+			}
+			if diff := cmp.Diff(tt.expectedUpdates, s.getUpdates()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -18,9 +18,12 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
+	"agola.io/agola/internal/runconfig"
+	"agola.io/agola/internal/services/common"
 	"agola.io/agola/internal/services/gateway/action"
 	rstypes "agola.io/agola/internal/services/runservice/types"
 	"agola.io/agola/internal/util"
@@ -37,6 +40,8 @@ type RunsResponse struct {
 	Annotations map[string]string `json:"annotations"`
 	Phase       rstypes.RunPhase  `json:"phase"`
 	Result      rstypes.RunResult `json:"result"`
+	Pinned      bool              `json:"pinned"`
+	Labels      map[string]string `json:"labels"`
 
 	TasksWaitingApproval []string `json:"tasks_waiting_approval"`
 
@@ -50,13 +55,21 @@ type RunResponse struct {
 	Counter     uint64            `json:"counter"`
 	Name        string            `json:"name"`
 	Annotations map[string]string `json:"annotations"`
+	Labels      map[string]string `json:"labels"`
 	Phase       rstypes.RunPhase  `json:"phase"`
 	Result      rstypes.RunResult `json:"result"`
 	SetupErrors []string          `json:"setup_errors"`
 	Stopping    bool              `json:"stopping"`
+	StopReason  string            `json:"stop_reason"`
+	Paused      bool              `json:"paused"`
+	Pinned      bool              `json:"pinned"`
+	// PauseWindows are the periods when the run was paused
+	PauseWindows []*RunPauseWindowResponse `json:"pause_windows"`
 
 	Tasks                map[string]*RunResponseTask `json:"tasks"`
 	TasksWaitingApproval []string                    `json:"tasks_waiting_approval"`
+	// Stages are the run tasks grouped by their stage
+	Stages []*RunResponseStage `json:"stages"`
 
 	EnqueueTime *time.Time `json:"enqueue_time"`
 	StartTime   *time.Time `json:"start_time"`
@@ -66,21 +79,48 @@ type RunResponse struct {
 	CanRestartFromFailedTasks bool `json:"can_restart_from_failed_tasks"`
 }
 
+type RunPauseWindowResponse struct {
+	Start    time.Time  `json:"start"`
+	End      *time.Time `json:"end"`
+	PausedBy string     `json:"paused_by"`
+}
+
 type RunResponseTask struct {
 	ID      string                                  `json:"id"`
 	Name    string                                  `json:"name"`
 	Status  rstypes.RunTaskStatus                   `json:"status"`
 	Level   int                                     `json:"level"`
+	Stage   string                                  `json:"stage"`
 	Depends map[string]*rstypes.RunConfigTaskDepend `json:"depends"`
 
 	WaitingApproval     bool              `json:"waiting_approval"`
 	Approved            bool              `json:"approved"`
 	ApprovalAnnotations map[string]string `json:"approval_annotations"`
+	// ApprovalExpiry is the time when the approval timeout of a task waiting
+	// approval expires
+	ApprovalExpiry *time.Time `json:"approval_expiry"`
+
+	PreviewURL string `json:"preview_url"`
+
+	// QueueWait is the time the task waited to be started by an executor
+	QueueWait time.Duration `json:"queue_wait"`
+
+	// CancelledBy is the id of the user that cancelled the task
+	CancelledBy string     `json:"cancelled_by"`
+	CancelTime  *time.Time `json:"cancel_time"`
 
 	StartTime *time.Time `json:"start_time"`
 	EndTime   *time.Time `json:"end_time"`
 }
 
+// RunResponseStage is a group of run tasks with the same stage. Tasks without
+// a stage are grouped in a stage with an empty name.
+type RunResponseStage struct {
+	Name string `json:"name"`
+	// Tasks are the ids of the stage tasks ordered by level and name
+	Tasks []string `json:"tasks"`
+}
+
 type RunTaskResponse struct {
 	ID     string                `json:"id"`
 	Name   string                `json:"name"`
@@ -93,6 +133,20 @@ type RunTaskResponse struct {
 	SetupStep *RunTaskResponseSetupStep `json:"setup_step"`
 	Steps     []*RunTaskResponseStep    `json:"steps"`
 
+	Attempts int `json:"attempts"`
+
+	PreviewURL string `json:"preview_url"`
+
+	Outputs map[string]string `json:"outputs"`
+
+	FailureReason *rstypes.TaskFailureReason `json:"failure_reason"`
+
+	QueueWait time.Duration `json:"queue_wait"`
+
+	// CancelledBy is the id of the user that cancelled the task
+	CancelledBy string     `json:"cancelled_by"`
+	CancelTime  *time.Time `json:"cancel_time"`
+
 	StartTime *time.Time `json:"start_time"`
 	EndTime   *time.Time `json:"end_time"`
 }
@@ -106,9 +160,10 @@ type RunTaskResponseSetupStep struct {
 }
 
 type RunTaskResponseStep struct {
-	Phase   rstypes.ExecutorTaskPhase `json:"phase"`
-	Name    string                    `json:"name"`
-	Command string                    `json:"command"`
+	Phase    rstypes.ExecutorTaskPhase `json:"phase"`
+	Name     string                    `json:"name"`
+	Command  string                    `json:"command"`
+	Attempts int                       `json:"attempts"`
 
 	StartTime *time.Time `json:"start_time"`
 	EndTime   *time.Time `json:"end_time"`
@@ -120,11 +175,17 @@ func createRunResponse(r *rstypes.Run, rc *rstypes.RunConfig) *RunResponse {
 		Counter:     r.Counter,
 		Name:        r.Name,
 		Annotations: r.Annotations,
+		Labels:      r.Labels,
 		Phase:       r.Phase,
 		Result:      r.Result,
 		Stopping:    r.Stop,
+		StopReason:  r.StopReason,
+		Paused:      r.Paused,
+		Pinned:      r.Pinned,
 		SetupErrors: rc.SetupErrors,
 
+		PauseWindows: []*RunPauseWindowResponse{},
+
 		Tasks:                make(map[string]*RunResponseTask),
 		TasksWaitingApproval: r.TasksWaitingApproval(),
 
@@ -133,6 +194,14 @@ func createRunResponse(r *rstypes.Run, rc *rstypes.RunConfig) *RunResponse {
 		EndTime:     r.EndTime,
 	}
 
+	for _, pw := range r.PauseWindows {
+		run.PauseWindows = append(run.PauseWindows, &RunPauseWindowResponse{
+			Start:    pw.Start,
+			End:      pw.End,
+			PausedBy: pw.PausedBy,
+		})
+	}
+
 	run.CanRestartFromScratch, _ = r.CanRestartFromScratch()
 	run.CanRestartFromFailedTasks, _ = r.CanRestartFromFailedTasks()
 
@@ -141,9 +210,29 @@ func createRunResponse(r *rstypes.Run, rc *rstypes.RunConfig) *RunResponse {
 		run.Tasks[name] = createRunResponseTask(r, rt, rct)
 	}
 
+	run.Stages = runStages(rc)
+
 	return run
 }
 
+// runStages returns the run tasks ids grouped by stage
+func runStages(rc *rstypes.RunConfig) []*RunResponseStage {
+	rcStages := runconfig.GenStages(rc.Tasks)
+	stages := make([]*RunResponseStage, len(rcStages))
+	for i, rcStage := range rcStages {
+		stage := &RunResponseStage{
+			Name:  rcStage.Name,
+			Tasks: make([]string, len(rcStage.Tasks)),
+		}
+		for j, rct := range rcStage.Tasks {
+			stage.Tasks[j] = rct.ID
+		}
+		stages[i] = stage
+	}
+
+	return stages
+}
+
 func createRunResponseTask(r *rstypes.Run, rt *rstypes.RunTask, rct *rstypes.RunConfigTask) *RunResponseTask {
 	t := &RunResponseTask{
 		ID:     rt.ID,
@@ -158,12 +247,32 @@ func createRunResponseTask(r *rstypes.Run, rt *rstypes.RunTask, rct *rstypes.Run
 		ApprovalAnnotations: rt.Annotations,
 
 		Level:   rct.Level,
+		Stage:   rct.Stage,
 		Depends: rct.Depends,
+
+		PreviewURL: previewURL(rt),
+
+		QueueWait: rt.QueueWait,
+
+		CancelledBy: rt.CancelledBy,
+		CancelTime:  rt.CancelTime,
+	}
+
+	if rt.WaitingApproval && rt.WaitingApprovalTime != nil && rct.ApprovalTimeout != nil {
+		t.ApprovalExpiry = util.TimePtr(rt.WaitingApprovalTime.Add(rct.ApprovalTimeout.Timeout))
 	}
 
 	return t
 }
 
+// previewURL returns the task preview url if it's set and not removed
+func previewURL(rt *rstypes.RunTask) string {
+	if rt.PreviewURL == nil || rt.PreviewURL.Action != rstypes.PreviewURLActionSet {
+		return ""
+	}
+	return rt.PreviewURL.URL
+}
+
 func createRunTaskResponse(rt *rstypes.RunTask, rct *rstypes.RunConfigTask) *RunTaskResponse {
 	t := &RunTaskResponse{
 		ID:     rt.ID,
@@ -176,6 +285,19 @@ func createRunTaskResponse(rt *rstypes.RunTask, rct *rstypes.RunConfigTask) *Run
 
 		Steps: make([]*RunTaskResponseStep, len(rt.Steps)),
 
+		Attempts: rt.Attempts,
+
+		PreviewURL: previewURL(rt),
+
+		Outputs: rt.Outputs,
+
+		FailureReason: rt.FailureReason,
+
+		QueueWait: rt.QueueWait,
+
+		CancelledBy: rt.CancelledBy,
+		CancelTime:  rt.CancelTime,
+
 		StartTime: rt.StartTime,
 		EndTime:   rt.EndTime,
 	}
@@ -190,22 +312,14 @@ func createRunTaskResponse(rt *rstypes.RunTask, rct *rstypes.RunConfigTask) *Run
 	for i := 0; i < len(t.Steps); i++ {
 		s := &RunTaskResponseStep{
 			Phase:     rt.Steps[i].Phase,
+			Attempts:  rt.Steps[i].Attempts,
 			StartTime: rt.Steps[i].StartTime,
 			EndTime:   rt.Steps[i].EndTime,
 		}
 		rcts := rct.Steps[i]
-		switch rcts := rcts.(type) {
-		case *rstypes.RunStep:
-			s.Name = rcts.Name
+		s.Name = runTaskStepName(rcts)
+		if rcts, ok := rcts.(*rstypes.RunStep); ok {
 			s.Command = rcts.Command
-		case *rstypes.SaveToWorkspaceStep:
-			s.Name = "save to workspace"
-		case *rstypes.RestoreWorkspaceStep:
-			s.Name = "restore workspace"
-		case *rstypes.SaveCacheStep:
-			s.Name = "save cache"
-		case *rstypes.RestoreCacheStep:
-			s.Name = "restore cache"
 		}
 
 		t.Steps[i] = s
@@ -214,6 +328,30 @@ func createRunTaskResponse(rt *rstypes.RunTask, rct *rstypes.RunConfigTask) *Run
 	return t
 }
 
+func runTaskStepName(rcts rstypes.Step) string {
+	switch rcts := rcts.(type) {
+	case *rstypes.RunStep:
+		return rcts.Name
+	case *rstypes.SaveToWorkspaceStep:
+		return "save to workspace"
+	case *rstypes.RestoreWorkspaceStep:
+		return "restore workspace"
+	case *rstypes.SaveCacheStep:
+		return "save cache"
+	case *rstypes.RestoreCacheStep:
+		return "restore cache"
+	case *rstypes.ParallelStep:
+		return rcts.Name
+	case *rstypes.SaveTestReportStep:
+		return "save test report"
+	case *rstypes.SaveCoverageReportStep:
+		return "save coverage report"
+	case *rstypes.ExportEnvStep:
+		return "export environment"
+	}
+	return ""
+}
+
 type RunHandler struct {
 	log *zap.SugaredLogger
 	ah  *action.ActionHandler
@@ -235,6 +373,105 @@ func (h *RunHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	res := createRunResponse(runResp.Run, runResp.RunConfig)
+	if err := httpFieldsResponse(w, r, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type ProjectRunHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectRunHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectRunHandler {
+	return &ProjectRunHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectRunHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+	runNumber, err := strconv.ParseUint(vars["runnumber"], 10, 64)
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse run number: %w", err)))
+		return
+	}
+
+	runResp, err := h.ah.GetProjectRun(ctx, projectRef, runNumber)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createRunResponse(runResp.Run, runResp.RunConfig)
+	if err := httpFieldsResponse(w, r, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type RunsByNameResponse struct {
+	Name string          `json:"name"`
+	Runs []*RunsResponse `json:"runs"`
+}
+
+type ProjectRunsByNameHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectRunsByNameHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectRunsByNameHandler {
+	return &ProjectRunsByNameHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectRunsByNameHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	q := r.URL.Query()
+	limitS := q.Get("limit")
+	limit := DefaultRunsLimit
+	if limitS != "" {
+		var err error
+		limit, err = strconv.Atoi(limitS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse limit: %w", err)))
+			return
+		}
+	}
+	if limit < 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("limit must be greater or equal than 0")))
+		return
+	}
+	if limit > MaxRunsLimit {
+		limit = MaxRunsLimit
+	}
+
+	runsByName, err := h.ah.GetProjectRunsByName(ctx, projectRef, limit)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := make([]*RunsByNameResponse, len(runsByName))
+	for i, rbn := range runsByName {
+		runs := make([]*RunsResponse, len(rbn.Runs))
+		for j, r := range rbn.Runs {
+			runs[j] = createRunsResponse(r)
+		}
+		res[i] = &RunsByNameResponse{
+			Name: rbn.Name,
+			Runs: runs,
+		}
+	}
 	if err := httpResponse(w, http.StatusOK, res); err != nil {
 		h.log.Errorf("err: %+v", err)
 	}
@@ -272,7 +509,7 @@ func (h *RuntaskHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	rct := rc.Tasks[rt.ID]
 
 	res := createRunTaskResponse(rt, rct)
-	if err := httpResponse(w, http.StatusOK, res); err != nil {
+	if err := httpFieldsResponse(w, r, http.StatusOK, res); err != nil {
 		h.log.Errorf("err: %+v", err)
 	}
 }
@@ -290,6 +527,8 @@ func createRunsResponse(r *rstypes.Run) *RunsResponse {
 		Annotations: r.Annotations,
 		Phase:       r.Phase,
 		Result:      r.Result,
+		Pinned:      r.Pinned,
+		Labels:      r.Labels,
 
 		TasksWaitingApproval: r.TasksWaitingApproval(),
 
@@ -326,7 +565,14 @@ func (h *RunsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	phaseFilter := q["phase"]
 	resultFilter := q["result"]
 	changeGroups := q["changegroup"]
+	names := q["runname"]
 	_, lastRun := q["lastrun"]
+	_, pinned := q["pinned"]
+	labels, err := rstypes.RunLabelsFromStringSlice(q["label"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
 
 	limitS := q.Get("limit")
 	limit := DefaultRunsLimit
@@ -357,10 +603,13 @@ func (h *RunsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		ResultFilter: resultFilter,
 		Group:        group,
 		LastRun:      lastRun,
+		Pinned:       pinned,
 		ChangeGroups: changeGroups,
 		StartRunID:   start,
 		Limit:        limit,
 		Asc:          asc,
+		Names:        names,
+		Labels:       labels,
 	}
 	runsResp, err := h.ah.GetRuns(ctx, areq)
 	if httpError(w, err) {
@@ -372,7 +621,7 @@ func (h *RunsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	for i, r := range runsResp.Runs {
 		runs[i] = createRunsResponse(r)
 	}
-	if err := httpResponse(w, http.StatusOK, runs); err != nil {
+	if err := httpFieldsResponse(w, r, http.StatusOK, runs); err != nil {
 		h.log.Errorf("err: %+v", err)
 	}
 }
@@ -423,8 +672,66 @@ func (h *RunActionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type DebugRunRequest struct {
+	// Variables override the project variables with the same name
+	Variables map[string]string `json:"variables,omitempty"`
+	// Config, when provided, is used instead of the repository config
+	Config []byte `json:"config,omitempty"`
+	// ConfigPath is the path of the provided config, its extension (yml, json
+	// or jsonnet) defines the config format. Defaults to .agola/config.yml
+	ConfigPath string `json:"config_path,omitempty"`
+}
+
+type DebugRunHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewDebugRunHandler(logger *zap.Logger, ah *action.ActionHandler) *DebugRunHandler {
+	return &DebugRunHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *DebugRunHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	runID := vars["runid"]
+
+	var req DebugRunRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	configPath := req.ConfigPath
+	if configPath == "" {
+		configPath = ".agola/config.yml"
+	}
+	areq := &action.DebugRunRequest{
+		RunID: runID,
+		DebugRunOptions: action.DebugRunOptions{
+			Variables:  req.Variables,
+			ConfigData: req.Config,
+			ConfigPath: configPath,
+		},
+	}
+
+	err := h.ah.DebugRun(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusCreated, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
 type RunTaskActionsRequest struct {
 	ActionType action.RunTaskActionType `json:"action_type"`
+
+	// Cancel
+	Dependents bool `json:"dependents"`
 }
 
 type RunTaskActionsHandler struct {
@@ -453,6 +760,7 @@ func (h *RunTaskActionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request
 		RunID:      runID,
 		TaskID:     taskID,
 		ActionType: req.ActionType,
+		Dependents: req.Dependents,
 	}
 
 	err := h.ah.RunTaskAction(ctx, areq)
@@ -508,17 +816,39 @@ func (h *LogsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	attempt := -1
+	if attemptStr := q.Get("attempt"); attemptStr != "" {
+		var err error
+		attempt, err = strconv.Atoi(attemptStr)
+		if err != nil || attempt < 0 {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("invalid attempt %q", attemptStr)))
+			return
+		}
+	}
+
 	follow := false
 	if _, ok := q["follow"]; ok {
 		follow = true
 	}
+	_, full := q["full"]
+
+	format := common.LogFormatPlain
+	if formatStr := q.Get("format"); formatStr != "" {
+		format = common.LogFormat(formatStr)
+		if !format.Valid() {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("invalid log format %q", formatStr)))
+			return
+		}
+	}
 
 	areq := &action.GetLogsRequest{
-		RunID:  runID,
-		TaskID: taskID,
-		Setup:  setup,
-		Step:   step,
-		Follow: follow,
+		RunID:   runID,
+		TaskID:  taskID,
+		Setup:   setup,
+		Step:    step,
+		Attempt: attempt,
+		Follow:  follow,
+		Full:    full,
 	}
 
 	resp, err := h.ah.GetLogs(ctx, areq)
@@ -527,11 +857,19 @@ func (h *LogsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if format == common.LogFormatHTML {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 
 	defer resp.Body.Close()
-	if err := sendLogs(w, resp.Body); err != nil {
+	fw := common.NewLogFormatWriter(w, format)
+	if err := sendLogs(fw, resp.Body); err != nil {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+	if err := fw.Close(); err != nil {
 		h.log.Errorf("err: %+v", err)
 		return
 	}
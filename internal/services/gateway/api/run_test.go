@@ -0,0 +1,153 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	slog "agola.io/agola/internal/log"
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/gateway/action"
+	rsapi "agola.io/agola/internal/services/runservice/api"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/services/types"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// newTestRunRouter returns a router serving the run, run config and logs
+// handlers. It uses a fake configstore with the private project01 owned by
+// org01, where user01 is a member and user02 a reporter, and a fake runservice
+// with the project01 run01. The returned func stops the fake services.
+func newTestRunRouter(t *testing.T) (*mux.Router, func()) {
+	writeJSON := func(w http.ResponseWriter, v interface{}) {
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+	}
+
+	csRouter := mux.NewRouter()
+	csRouter.HandleFunc("/api/v1alpha/projects/{projectref}", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["projectref"] != "project01" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, &csapi.Project{
+			Project:          &types.Project{ID: "project01", Name: "project01", Visibility: types.VisibilityPrivate},
+			OwnerType:        types.ConfigTypeOrg,
+			OwnerID:          "org01",
+			GlobalVisibility: types.VisibilityPrivate,
+		})
+	})
+	csRouter.HandleFunc("/api/v1alpha/users/{userref}/orgs", func(w http.ResponseWriter, r *http.Request) {
+		org := &types.Organization{ID: "org01", Name: "org01"}
+		userOrgs := []*csapi.UserOrgsResponse{}
+		switch mux.Vars(r)["userref"] {
+		case "user01":
+			userOrgs = append(userOrgs, &csapi.UserOrgsResponse{Organization: org, Role: types.MemberRoleMember})
+		case "user02":
+			userOrgs = append(userOrgs, &csapi.UserOrgsResponse{Organization: org, Role: types.MemberRoleReporter})
+		}
+		writeJSON(w, userOrgs)
+	})
+	cs := httptest.NewServer(csRouter)
+
+	rsRouter := mux.NewRouter()
+	rsRouter.HandleFunc("/api/v1alpha/runs/{runid}", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["runid"] != "run01" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, &rsapi.RunResponse{
+			Run: &rstypes.Run{ID: "run01", Group: "/project/project01"},
+			RunConfig: &rstypes.RunConfig{
+				ID:         "run01",
+				Group:      "/project/project01",
+				ConfigData: "runconfigdata",
+				Annotations: map[string]string{
+					action.AnnotationRunType:   string(types.RunTypeProject),
+					action.AnnotationProjectID: "project01",
+				},
+			},
+		})
+	})
+	rsRouter.HandleFunc("/api/v1alpha/logs", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("log line\n"))
+	})
+	rs := httptest.NewServer(rsRouter)
+
+	logger := slog.New(zap.NewAtomicLevelAt(zap.FatalLevel))
+	ah := action.NewActionHandler(logger, nil, csapi.NewClient(cs.URL), rsapi.NewClient(rs.URL), "agola", "", "", nil, nil, nil, nil, nil, nil, nil, 0)
+
+	router := mux.NewRouter()
+	router.Handle("/runs/{runid}", NewRunHandler(logger, ah)).Methods("GET")
+	router.Handle("/runs/{runid}/config", NewRunConfigHandler(logger, ah)).Methods("GET")
+	router.Handle("/logs", NewLogsHandler(logger, ah)).Methods("GET")
+
+	return router, func() {
+		cs.Close()
+		rs.Close()
+	}
+}
+
+func TestRunHandlersReporter(t *testing.T) {
+	router, stop := newTestRunRouter(t)
+	defer stop()
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedMember int
+		// reporters can get the runs but not their logs, artifacts and config
+		expectedReporter int
+	}{
+		{name: "run", path: "/runs/run01", expectedMember: http.StatusOK, expectedReporter: http.StatusOK},
+		{name: "run config", path: "/runs/run01/config", expectedMember: http.StatusOK, expectedReporter: http.StatusForbidden},
+		{name: "logs", path: "/logs?runID=run01&taskID=task01&step=0", expectedMember: http.StatusOK, expectedReporter: http.StatusForbidden},
+		{name: "missing run", path: "/runs/run02", expectedMember: http.StatusNotFound, expectedReporter: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for userID, expected := range map[string]int{"user01": tt.expectedMember, "user02": tt.expectedReporter} {
+				r := httptest.NewRequest("GET", tt.path, nil)
+				r = r.WithContext(context.WithValue(r.Context(), "userid", userID))
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, r)
+
+				if w.Code != expected {
+					t.Fatalf("user %s: expected status %d, got %d", userID, expected, w.Code)
+				}
+				if w.Code != http.StatusOK {
+					continue
+				}
+				body, err := ioutil.ReadAll(w.Body)
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				if len(body) == 0 {
+					t.Fatalf("user %s: expected a response body", userID)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+
+	"agola.io/agola/internal/services/gateway/action"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type RunConfigResponse struct {
+	// Config is the config used to create the run
+	Config       string `json:"config"`
+	ConfigFormat string `json:"config_format"`
+	// Tasks are the run config tasks generated from the config. The
+	// environment values are redacted.
+	Tasks map[string]*rstypes.RunConfigTask `json:"tasks"`
+}
+
+type RunConfigHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewRunConfigHandler(logger *zap.Logger, ah *action.ActionHandler) *RunConfigHandler {
+	return &RunConfigHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *RunConfigHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	runID := vars["runid"]
+
+	rc, err := h.ah.GetRunConfig(ctx, runID)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := &RunConfigResponse{
+		Config:       rc.ConfigData,
+		ConfigFormat: rc.ConfigFormat,
+		Tasks:        rc.Tasks,
+	}
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
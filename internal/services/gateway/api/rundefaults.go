@@ -0,0 +1,114 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type ProjectRunDefaultsResponse struct {
+	TaskTimeout        time.Duration `json:"task_timeout,omitempty"`
+	AllowedImages      []string      `json:"allowed_images,omitempty"`
+	AllowedArchs       []string      `json:"allowed_archs,omitempty"`
+	MaxTasks           int           `json:"max_tasks,omitempty"`
+	ArtifactsRetention time.Duration `json:"artifacts_retention,omitempty"`
+}
+
+func createProjectRunDefaultsResponse(rd *types.ProjectRunDefaults) *ProjectRunDefaultsResponse {
+	if rd == nil {
+		return nil
+	}
+	return &ProjectRunDefaultsResponse{
+		TaskTimeout:        rd.TaskTimeout,
+		AllowedImages:      rd.AllowedImages,
+		AllowedArchs:       rd.AllowedArchs,
+		MaxTasks:           rd.MaxTasks,
+		ArtifactsRetention: rd.ArtifactsRetention,
+	}
+}
+
+// UpdateProjectRunDefaultsRequest sets the project run defaults. Zero values
+// mean no limit.
+type UpdateProjectRunDefaultsRequest struct {
+	TaskTimeout        time.Duration `json:"task_timeout"`
+	AllowedImages      []string      `json:"allowed_images"`
+	AllowedArchs       []string      `json:"allowed_archs"`
+	MaxTasks           int           `json:"max_tasks"`
+	ArtifactsRetention time.Duration `json:"artifacts_retention"`
+}
+
+// toProjectRunDefaults returns the requested run defaults, nil when no limit
+// is set
+func (req *UpdateProjectRunDefaultsRequest) toProjectRunDefaults() *types.ProjectRunDefaults {
+	if req.TaskTimeout == 0 && len(req.AllowedImages) == 0 && len(req.AllowedArchs) == 0 && req.MaxTasks == 0 && req.ArtifactsRetention == 0 {
+		return nil
+	}
+	return &types.ProjectRunDefaults{
+		TaskTimeout:        req.TaskTimeout,
+		AllowedImages:      req.AllowedImages,
+		AllowedArchs:       req.AllowedArchs,
+		MaxTasks:           req.MaxTasks,
+		ArtifactsRetention: req.ArtifactsRetention,
+	}
+}
+
+type UpdateProjectRunDefaultsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewUpdateProjectRunDefaultsHandler(logger *zap.Logger, ah *action.ActionHandler) *UpdateProjectRunDefaultsHandler {
+	return &UpdateProjectRunDefaultsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *UpdateProjectRunDefaultsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	var req UpdateProjectRunDefaultsRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	runDefaults := req.toProjectRunDefaults()
+
+	project, err := h.ah.UpdateProjectRunDefaults(ctx, projectRef, runDefaults)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createProjectResponse(project)
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
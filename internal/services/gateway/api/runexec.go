@@ -0,0 +1,65 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/util"
+	"go.uber.org/zap"
+
+	"github.com/gorilla/mux"
+)
+
+type RunTaskExecHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewRunTaskExecHandler(logger *zap.Logger, ah *action.ActionHandler) *RunTaskExecHandler {
+	return &RunTaskExecHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *RunTaskExecHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	q := r.URL.Query()
+
+	_, tty := q["tty"]
+	areq := &action.RunTaskExecRequest{
+		RunID:  vars["runid"],
+		TaskID: vars["taskid"],
+		Cmd:    q["cmd"],
+		Tty:    tty,
+	}
+
+	session, err := h.ah.RunTaskExec(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	conn, err := util.WebsocketUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader already replied to the client
+		h.log.Errorf("err: %+v", err)
+		_ = session.Close()
+		return
+	}
+	defer conn.Close()
+
+	session.Proxy(conn)
+}
@@ -0,0 +1,257 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"agola.io/agola/internal/services/gateway/action"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type RunGanttSpanType string
+
+const (
+	// RunGanttSpanTypeQueued is the time from when the task could be executed
+	// (the run started and all its parents finished) to its start. It includes
+	// the time waiting for an approval or a free executor.
+	RunGanttSpanTypeQueued    RunGanttSpanType = "queued"
+	RunGanttSpanTypeSetup     RunGanttSpanType = "setup"
+	RunGanttSpanTypeStep      RunGanttSpanType = "step"
+	RunGanttSpanTypeArchiving RunGanttSpanType = "archiving"
+	// RunGanttSpanTypePaused is a period when the run was paused
+	RunGanttSpanTypePaused RunGanttSpanType = "paused"
+)
+
+type RunGanttSpan struct {
+	Type RunGanttSpanType `json:"type"`
+	Name string           `json:"name"`
+
+	StartTime time.Time `json:"start_time"`
+	// EndTime is empty when the span is still in progress
+	EndTime  *time.Time    `json:"end_time"`
+	Duration time.Duration `json:"duration"`
+}
+
+type RunGanttTask struct {
+	ID      string                `json:"id"`
+	Name    string                `json:"name"`
+	Status  rstypes.RunTaskStatus `json:"status"`
+	Level   int                   `json:"level"`
+	Depends []string              `json:"depends"`
+
+	Spans []*RunGanttSpan `json:"spans"`
+}
+
+type RunGanttResponse struct {
+	ID      string            `json:"id"`
+	Counter uint64            `json:"counter"`
+	Name    string            `json:"name"`
+	Phase   rstypes.RunPhase  `json:"phase"`
+	Result  rstypes.RunResult `json:"result"`
+
+	EnqueueTime *time.Time    `json:"enqueue_time"`
+	StartTime   *time.Time    `json:"start_time"`
+	EndTime     *time.Time    `json:"end_time"`
+	Duration    time.Duration `json:"duration"`
+
+	// Pauses are the periods when the run was paused
+	Pauses []*RunGanttSpan `json:"pauses"`
+
+	Tasks []*RunGanttTask `json:"tasks"`
+}
+
+func newRunGanttSpan(spanType RunGanttSpanType, name string, start time.Time, end *time.Time, now time.Time) *RunGanttSpan {
+	s := &RunGanttSpan{
+		Type:      spanType,
+		Name:      name,
+		StartTime: start,
+		EndTime:   end,
+	}
+	if end != nil {
+		s.Duration = end.Sub(start)
+	} else {
+		s.Duration = now.Sub(start)
+	}
+	return s
+}
+
+// runGanttTaskReadyTime returns the time when the task could be started: the
+// run start time or the end time of its last finished parent. It returns nil
+// if the task isn't ready yet.
+func runGanttTaskReadyTime(r *rstypes.Run, rct *rstypes.RunConfigTask) *time.Time {
+	if r.StartTime == nil {
+		return nil
+	}
+	readyTime := *r.StartTime
+	for depID := range rct.Depends {
+		prt, ok := r.Tasks[depID]
+		if !ok {
+			continue
+		}
+		if prt.Status == rstypes.RunTaskStatusSkipped {
+			continue
+		}
+		if prt.EndTime == nil {
+			return nil
+		}
+		if prt.EndTime.After(readyTime) {
+			readyTime = *prt.EndTime
+		}
+	}
+	return &readyTime
+}
+
+func createRunGanttTask(r *rstypes.Run, rt *rstypes.RunTask, rct *rstypes.RunConfigTask, now time.Time) *RunGanttTask {
+	t := &RunGanttTask{
+		ID:      rt.ID,
+		Name:    rct.Name,
+		Status:  rt.Status,
+		Level:   rct.Level,
+		Depends: []string{},
+		Spans:   []*RunGanttSpan{},
+	}
+	for depID := range rct.Depends {
+		if _, ok := r.Tasks[depID]; ok {
+			t.Depends = append(t.Depends, depID)
+		}
+	}
+	sort.Strings(t.Depends)
+
+	if rt.Status == rstypes.RunTaskStatusSkipped {
+		return t
+	}
+
+	// ongoing spans are reported only if the run is still running
+	running := r.Phase == rstypes.RunPhaseRunning
+
+	if readyTime := runGanttTaskReadyTime(r, rct); readyTime != nil {
+		switch {
+		case rt.StartTime != nil:
+			if rt.StartTime.After(*readyTime) {
+				t.Spans = append(t.Spans, newRunGanttSpan(RunGanttSpanTypeQueued, "queued", *readyTime, rt.StartTime, now))
+			}
+		case running && !rt.Status.IsFinished():
+			t.Spans = append(t.Spans, newRunGanttSpan(RunGanttSpanTypeQueued, "queued", *readyTime, nil, now))
+		}
+	}
+
+	lastEndTime := rt.StartTime
+	addSpan := func(spanType RunGanttSpanType, name string, start, end *time.Time) {
+		if start == nil {
+			return
+		}
+		if end == nil && !running {
+			return
+		}
+		t.Spans = append(t.Spans, newRunGanttSpan(spanType, name, *start, end, now))
+		if end != nil {
+			lastEndTime = end
+		}
+	}
+
+	addSpan(RunGanttSpanTypeSetup, "task setup", rt.SetupStep.StartTime, rt.SetupStep.EndTime)
+	for i, rts := range rt.Steps {
+		addSpan(RunGanttSpanTypeStep, runTaskStepName(rct.Steps[i]), rts.StartTime, rts.EndTime)
+	}
+
+	// the time between the end of the last step and the end of the task is
+	// spent archiving the steps logs and the workspace
+	if lastEndTime != nil && rt.EndTime != nil && rt.EndTime.After(*lastEndTime) {
+		addSpan(RunGanttSpanTypeArchiving, "archiving", lastEndTime, rt.EndTime)
+	}
+
+	return t
+}
+
+func createRunGanttResponse(r *rstypes.Run, rc *rstypes.RunConfig, now time.Time) *RunGanttResponse {
+	res := &RunGanttResponse{
+		ID:      r.ID,
+		Counter: r.Counter,
+		Name:    r.Name,
+		Phase:   r.Phase,
+		Result:  r.Result,
+
+		EnqueueTime: r.EnqueueTime,
+		StartTime:   r.StartTime,
+		EndTime:     r.EndTime,
+
+		Pauses: []*RunGanttSpan{},
+		Tasks:  []*RunGanttTask{},
+	}
+	for _, pw := range r.PauseWindows {
+		res.Pauses = append(res.Pauses, newRunGanttSpan(RunGanttSpanTypePaused, "paused", pw.Start, pw.End, now))
+	}
+	if r.StartTime != nil {
+		if r.EndTime != nil {
+			res.Duration = r.EndTime.Sub(*r.StartTime)
+		} else {
+			res.Duration = now.Sub(*r.StartTime)
+		}
+	}
+
+	for _, rt := range r.Tasks {
+		rct := rc.Tasks[rt.ID]
+		res.Tasks = append(res.Tasks, createRunGanttTask(r, rt, rct, now))
+	}
+
+	// order the tasks by level and then by their first span start time
+	sort.SliceStable(res.Tasks, func(i, j int) bool {
+		ti, tj := res.Tasks[i], res.Tasks[j]
+		if ti.Level != tj.Level {
+			return ti.Level < tj.Level
+		}
+		if len(ti.Spans) > 0 && len(tj.Spans) > 0 && !ti.Spans[0].StartTime.Equal(tj.Spans[0].StartTime) {
+			return ti.Spans[0].StartTime.Before(tj.Spans[0].StartTime)
+		}
+		if len(ti.Spans) != len(tj.Spans) && (len(ti.Spans) == 0 || len(tj.Spans) == 0) {
+			return len(tj.Spans) == 0
+		}
+		return ti.Name < tj.Name
+	})
+
+	return res
+}
+
+type RunGanttHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewRunGanttHandler(logger *zap.Logger, ah *action.ActionHandler) *RunGanttHandler {
+	return &RunGanttHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *RunGanttHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	runID := vars["runid"]
+
+	runResp, err := h.ah.GetRun(ctx, runID)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createRunGanttResponse(runResp.Run, runResp.RunConfig, time.Now())
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
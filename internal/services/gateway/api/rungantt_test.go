@@ -0,0 +1,122 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"testing"
+	"time"
+
+	rstypes "agola.io/agola/internal/services/runservice/types"
+)
+
+func TestCreateRunGanttResponse(t *testing.T) {
+	base := time.Date(2019, 1, 1, 10, 0, 0, 0, time.UTC)
+	at := func(s int) *time.Time {
+		t := base.Add(time.Duration(s) * time.Second)
+		return &t
+	}
+
+	r := &rstypes.Run{
+		ID:        "run01",
+		Phase:     rstypes.RunPhaseFinished,
+		Result:    rstypes.RunResultSuccess,
+		StartTime: at(0),
+		EndTime:   at(100),
+		PauseWindows: []*rstypes.RunPauseWindow{
+			{Start: *at(40), End: at(55), PausedBy: "user01"},
+		},
+		Tasks: map[string]*rstypes.RunTask{
+			"task01": {
+				ID:        "task01",
+				Status:    rstypes.RunTaskStatusSuccess,
+				StartTime: at(5),
+				EndTime:   at(40),
+				SetupStep: rstypes.RunTaskStep{StartTime: at(5), EndTime: at(10)},
+				Steps: []*rstypes.RunTaskStep{
+					{StartTime: at(10), EndTime: at(30)},
+				},
+			},
+			"task02": {
+				ID:        "task02",
+				Status:    rstypes.RunTaskStatusSuccess,
+				StartTime: at(60),
+				EndTime:   at(100),
+				SetupStep: rstypes.RunTaskStep{StartTime: at(60), EndTime: at(62)},
+				Steps: []*rstypes.RunTaskStep{
+					{StartTime: at(62), EndTime: at(100)},
+				},
+			},
+		},
+	}
+	rc := &rstypes.RunConfig{
+		Tasks: map[string]*rstypes.RunConfigTask{
+			"task01": {
+				ID:    "task01",
+				Name:  "build",
+				Steps: rstypes.Steps{&rstypes.RunStep{BaseStep: rstypes.BaseStep{Name: "make"}}},
+			},
+			"task02": {
+				ID:      "task02",
+				Name:    "test",
+				Level:   1,
+				Depends: map[string]*rstypes.RunConfigTaskDepend{"task01": {TaskID: "task01"}},
+				Steps:   rstypes.Steps{&rstypes.RunStep{BaseStep: rstypes.BaseStep{Name: "make test"}}},
+			},
+		},
+	}
+
+	res := createRunGanttResponse(r, rc, base.Add(time.Hour))
+
+	if res.Duration != 100*time.Second {
+		t.Fatalf("expected run duration 100s, got %s", res.Duration)
+	}
+	if len(res.Tasks) != 2 || res.Tasks[0].Name != "build" || res.Tasks[1].Name != "test" {
+		t.Fatalf("unexpected tasks order: %+v", res.Tasks)
+	}
+	if len(res.Pauses) != 1 || res.Pauses[0].Type != RunGanttSpanTypePaused || res.Pauses[0].Duration != 15*time.Second {
+		t.Fatalf("unexpected pauses: %+v", res.Pauses)
+	}
+
+	type span struct {
+		spanType RunGanttSpanType
+		name     string
+		duration time.Duration
+	}
+	expected := map[string][]span{
+		"build": {
+			{RunGanttSpanTypeQueued, "queued", 5 * time.Second},
+			{RunGanttSpanTypeSetup, "task setup", 5 * time.Second},
+			{RunGanttSpanTypeStep, "make", 20 * time.Second},
+			{RunGanttSpanTypeArchiving, "archiving", 10 * time.Second},
+		},
+		"test": {
+			{RunGanttSpanTypeQueued, "queued", 20 * time.Second},
+			{RunGanttSpanTypeSetup, "task setup", 2 * time.Second},
+			{RunGanttSpanTypeStep, "make test", 38 * time.Second},
+		},
+	}
+	for _, task := range res.Tasks {
+		spans := expected[task.Name]
+		if len(task.Spans) != len(spans) {
+			t.Fatalf("task %q: expected %d spans, got %d", task.Name, len(spans), len(task.Spans))
+		}
+		for i, s := range spans {
+			ts := task.Spans[i]
+			if ts.Type != s.spanType || ts.Name != s.name || ts.Duration != s.duration {
+				t.Errorf("task %q span %d: expected %v, got %+v", task.Name, i, s, ts)
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"agola.io/agola/internal/services/gateway/action"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type RunLogsArchiveHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewRunLogsArchiveHandler(logger *zap.Logger, ah *action.ActionHandler) *RunLogsArchiveHandler {
+	return &RunLogsArchiveHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *RunLogsArchiveHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	runID := vars["runid"]
+
+	archive, err := h.ah.GetRunLogsArchive(ctx, runID)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	run := archive.Run
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"run-%d-%s-logs.tar.gz\"", run.Run.Counter, run.Run.ID))
+
+	// the archive is streamed so errors after this point can only be logged
+	if err := archive.Write(ctx, w, createRunResponse(run.Run, run.RunConfig)); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
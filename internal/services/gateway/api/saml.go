@@ -0,0 +1,140 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/util"
+
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+type SAMLMetadataHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewSAMLMetadataHandler(logger *zap.Logger, ah *action.ActionHandler) *SAMLMetadataHandler {
+	return &SAMLMetadataHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *SAMLMetadataHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	metadata, err := h.ah.SAMLMetadata()
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	if _, err := w.Write(metadata); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+// samlNonceCookieName is the cookie saving the nonce binding the saml login to
+// the browser that started it
+const samlNonceCookieName = "agola_saml_nonce"
+
+// samlNonceCookie returns the saml nonce cookie. An empty nonce returns a
+// cookie removing it.
+func samlNonceCookie(apiExposedURL, nonce string) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     samlNonceCookieName,
+		Value:    nonce,
+		Path:     "/api/saml",
+		MaxAge:   600,
+		HttpOnly: true,
+	}
+	// the identity provider response is a cross site post, the cookie is
+	// sent with it only when SameSite=None (that requires a secure cookie)
+	if strings.HasPrefix(apiExposedURL, "https://") {
+		cookie.Secure = true
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+	if nonce == "" {
+		cookie.MaxAge = -1
+	}
+	return cookie
+}
+
+// SAMLLoginHandler redirects the user to the identity provider to log in
+type SAMLLoginHandler struct {
+	log           *zap.SugaredLogger
+	ah            *action.ActionHandler
+	apiExposedURL string
+}
+
+func NewSAMLLoginHandler(logger *zap.Logger, ah *action.ActionHandler, apiExposedURL string) *SAMLLoginHandler {
+	return &SAMLLoginHandler{log: logger.Sugar(), ah: ah, apiExposedURL: apiExposedURL}
+}
+
+func (h *SAMLLoginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	login, err := h.ah.SAMLLogin(ctx)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	http.SetCookie(w, samlNonceCookie(h.apiExposedURL, login.Nonce))
+	http.Redirect(w, r, login.URL, http.StatusFound)
+}
+
+// SAMLACSHandler is the assertion consumer service receiving the identity
+// provider responses. On successful login the user is redirected to the web
+// interface with the login token.
+type SAMLACSHandler struct {
+	log           *zap.SugaredLogger
+	ah            *action.ActionHandler
+	apiExposedURL string
+}
+
+func NewSAMLACSHandler(logger *zap.Logger, ah *action.ActionHandler, apiExposedURL string) *SAMLACSHandler {
+	return &SAMLACSHandler{log: logger.Sugar(), ah: ah, apiExposedURL: apiExposedURL}
+}
+
+func (h *SAMLACSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := r.ParseForm(); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+	samlResponse := r.PostForm.Get("SAMLResponse")
+	if samlResponse == "" {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("missing SAMLResponse")))
+		return
+	}
+	relayState := r.PostForm.Get("RelayState")
+	var nonce string
+	if cookie, err := r.Cookie(samlNonceCookieName); err == nil {
+		nonce = cookie.Value
+	}
+	// the nonce is valid only for one login
+	http.SetCookie(w, samlNonceCookie(h.apiExposedURL, ""))
+
+	res, err := h.ah.HandleSAMLResponse(ctx, samlResponse, relayState, nonce)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	http.Redirect(w, r, h.ah.SAMLCallbackURL(res.Token), http.StatusFound)
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+type ProjectRunsStatsResponse struct {
+	Since           time.Time                     `json:"since"`
+	Runs            int                           `json:"runs"`
+	Successes       int                           `json:"successes"`
+	Failures        int                           `json:"failures"`
+	SuccessRate     float64                       `json:"success_rate"`
+	MedianDuration  time.Duration                 `json:"median_duration"`
+	MedianQueueWait time.Duration                 `json:"median_queue_wait"`
+	FailureHotspots []*TaskFailureHotspotResponse `json:"failure_hotspots"`
+}
+
+type TaskFailureHotspotResponse struct {
+	TaskName string `json:"task_name"`
+	Runs     int    `json:"runs"`
+	Failures int    `json:"failures"`
+}
+
+func createProjectRunsStatsResponse(res *action.GetProjectRunsStatsResponse) *ProjectRunsStatsResponse {
+	s := res.Stats
+	hotspots := make([]*TaskFailureHotspotResponse, len(s.FailureHotspots))
+	for i, h := range s.FailureHotspots {
+		hotspots[i] = &TaskFailureHotspotResponse{
+			TaskName: h.TaskName,
+			Runs:     h.Runs,
+			Failures: h.Failures,
+		}
+	}
+
+	return &ProjectRunsStatsResponse{
+		Since:           res.Since,
+		Runs:            s.Runs,
+		Successes:       s.Successes,
+		Failures:        s.Failures,
+		SuccessRate:     s.SuccessRate,
+		MedianDuration:  s.MedianDuration,
+		MedianQueueWait: s.MedianQueueWait,
+		FailureHotspots: hotspots,
+	}
+}
+
+type ProjectRunsStatsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectRunsStatsHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectRunsStatsHandler {
+	return &ProjectRunsStatsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectRunsStatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	var hotspotsLimit int
+	if limitS := query.Get("hotspotslimit"); limitS != "" {
+		hotspotsLimit, err = strconv.Atoi(limitS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse hotspotslimit: %w", err)))
+			return
+		}
+	}
+	if hotspotsLimit < 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("hotspotslimit must be greater or equal than 0")))
+		return
+	}
+
+	areq := &action.GetProjectRunsStatsRequest{
+		ProjectRef:    projectRef,
+		Branch:        query.Get("branch"),
+		Window:        query.Get("window"),
+		HotspotsLimit: hotspotsLimit,
+	}
+	res, err := h.ah.GetProjectRunsStats(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, createProjectRunsStatsResponse(res)); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
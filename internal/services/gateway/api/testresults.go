@@ -0,0 +1,193 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"agola.io/agola/internal/services/gateway/action"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	DefaultSlowestTestsLimit = 10
+	MaxSlowestTestsLimit     = 100
+)
+
+type TestCaseResponse struct {
+	Suite    string                 `json:"suite,omitempty"`
+	Name     string                 `json:"name"`
+	Status   rstypes.TestCaseStatus `json:"status"`
+	Duration time.Duration          `json:"duration"`
+	Message  string                 `json:"message,omitempty"`
+}
+
+func createTestCaseResponse(tc *rstypes.TestCase) *TestCaseResponse {
+	return &TestCaseResponse{
+		Suite:    tc.Suite,
+		Name:     tc.Name,
+		Status:   tc.Status,
+		Duration: tc.Duration,
+		Message:  tc.Message,
+	}
+}
+
+func createTestCasesResponse(tcs []*rstypes.TestCase) []*TestCaseResponse {
+	res := make([]*TestCaseResponse, len(tcs))
+	for i, tc := range tcs {
+		res[i] = createTestCaseResponse(tc)
+	}
+	return res
+}
+
+type TestResultsResponse struct {
+	Total    int                 `json:"total"`
+	Passed   int                 `json:"passed"`
+	Failed   int                 `json:"failed"`
+	Skipped  int                 `json:"skipped"`
+	Duration time.Duration       `json:"duration"`
+	Failures []*TestCaseResponse `json:"failures"`
+	Slowest  []*TestCaseResponse `json:"slowest"`
+}
+
+type RunTaskTestResultsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewRunTaskTestResultsHandler(logger *zap.Logger, ah *action.ActionHandler) *RunTaskTestResultsHandler {
+	return &RunTaskTestResultsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *RunTaskTestResultsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+	vars := mux.Vars(r)
+	runID := vars["runid"]
+	taskID := vars["taskid"]
+
+	slowest := DefaultSlowestTestsLimit
+	if slowestS := query.Get("slowest"); slowestS != "" {
+		var err error
+		slowest, err = strconv.Atoi(slowestS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse slowest: %w", err)))
+			return
+		}
+	}
+	if slowest < 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("slowest must be greater or equal than 0")))
+		return
+	}
+	if slowest > MaxSlowestTestsLimit {
+		slowest = MaxSlowestTestsLimit
+	}
+
+	tr, err := h.ah.GetRunTaskTestResults(ctx, runID, taskID, slowest)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := &TestResultsResponse{
+		Total:    tr.Summary.Total,
+		Passed:   tr.Summary.Passed,
+		Failed:   tr.Summary.Failed,
+		Skipped:  tr.Summary.Skipped,
+		Duration: tr.Summary.Duration,
+		Failures: createTestCasesResponse(tr.Failed),
+		Slowest:  createTestCasesResponse(tr.Slowest),
+	}
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type TestCaseHistoryEntryResponse struct {
+	RunID      string            `json:"run_id"`
+	RunCounter uint64            `json:"run_counter"`
+	TaskID     string            `json:"task_id"`
+	TaskName   string            `json:"task_name"`
+	EndTime    *time.Time        `json:"end_time,omitempty"`
+	TestCase   *TestCaseResponse `json:"test_case"`
+}
+
+type ProjectTestCaseHistoryHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectTestCaseHistoryHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectTestCaseHistoryHandler {
+	return &ProjectTestCaseHistoryHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectTestCaseHistoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	var limit int
+	if limitS := query.Get("limit"); limitS != "" {
+		limit, err = strconv.Atoi(limitS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse limit: %w", err)))
+			return
+		}
+	}
+	if limit < 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("limit must be greater or equal than 0")))
+		return
+	}
+
+	areq := &action.GetProjectTestCaseHistoryRequest{
+		ProjectRef: projectRef,
+		Suite:      query.Get("suite"),
+		Name:       query.Get("name"),
+		Limit:      limit,
+	}
+	entries, err := h.ah.GetProjectTestCaseHistory(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := make([]*TestCaseHistoryEntryResponse, len(entries))
+	for i, e := range entries {
+		res[i] = &TestCaseHistoryEntryResponse{
+			RunID:      e.RunID,
+			RunCounter: e.RunCounter,
+			TaskID:     e.TaskID,
+			TaskName:   e.TaskName,
+			EndTime:    e.EndTime,
+			TestCase:   createTestCaseResponse(e.TestCase),
+		}
+	}
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type TrashItemResponse struct {
+	ID           string           `json:"id"`
+	ObjectType   types.ConfigType `json:"object_type"`
+	ObjectID     string           `json:"object_id"`
+	Path         string           `json:"path"`
+	DeletionTime time.Time        `json:"deletion_time"`
+	// ProjectGroups and Projects are the number of deleted project groups and
+	// projects, including the deleted object
+	ProjectGroups int `json:"project_groups"`
+	Projects      int `json:"projects"`
+}
+
+func createTrashItemResponse(ti *types.TrashItem) *TrashItemResponse {
+	return &TrashItemResponse{
+		ID:            ti.ID,
+		ObjectType:    ti.ObjectType,
+		ObjectID:      ti.ObjectID,
+		Path:          ti.Path,
+		DeletionTime:  ti.DeletionTime,
+		ProjectGroups: len(ti.ProjectGroups),
+		Projects:      len(ti.Projects),
+	}
+}
+
+type ProjectGroupTrashItemsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectGroupTrashItemsHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectGroupTrashItemsHandler {
+	return &ProjectGroupTrashItemsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectGroupTrashItemsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectGroupRef, err := url.PathUnescape(vars["projectgroupref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	tis, err := h.ah.GetProjectGroupTrashItems(ctx, projectGroupRef)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := make([]*TrashItemResponse, len(tis))
+	for i, ti := range tis {
+		res[i] = createTrashItemResponse(ti)
+	}
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type RestoreTrashItemHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewRestoreTrashItemHandler(logger *zap.Logger, ah *action.ActionHandler) *RestoreTrashItemHandler {
+	return &RestoreTrashItemHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *RestoreTrashItemHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	trashItemID := vars["trashitemid"]
+
+	ti, err := h.ah.RestoreTrashItem(ctx, trashItemID)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, createTrashItemResponse(ti)); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
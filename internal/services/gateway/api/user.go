@@ -20,6 +20,7 @@ import (
 	"net/http"
 	"sort"
 	"strconv"
+	"time"
 
 	gitsource "agola.io/agola/internal/gitsources"
 	"agola.io/agola/internal/services/gateway/action"
@@ -126,6 +127,46 @@ func (h *CurrentUserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type UserTokenInfoResponse struct {
+	UserID    string             `json:"user_id"`
+	UserName  string             `json:"user_name"`
+	TokenName string             `json:"token_name"`
+	Scopes    []types.TokenScope `json:"scopes"`
+	ExpiresAt *time.Time         `json:"expires_at,omitempty"`
+}
+
+type CurrentUserTokenHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewCurrentUserTokenHandler(logger *zap.Logger, ah *action.ActionHandler) *CurrentUserTokenHandler {
+	return &CurrentUserTokenHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *CurrentUserTokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	info, err := h.ah.GetCurrentUserToken(ctx)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := &UserTokenInfoResponse{
+		UserID:    info.User.ID,
+		UserName:  info.User.Name,
+		TokenName: info.TokenName,
+		Scopes:    info.Scopes,
+	}
+	if !info.ExpiresAt.IsZero() {
+		res.ExpiresAt = &info.ExpiresAt
+	}
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
 type UserHandler struct {
 	log *zap.SugaredLogger
 	ah  *action.ActionHandler
@@ -344,7 +385,9 @@ func (h *DeleteUserLAHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 }
 
 type CreateUserTokenRequest struct {
-	TokenName string `json:"token_name"`
+	TokenName string             `json:"token_name"`
+	Scopes    []types.TokenScope `json:"scopes"`
+	ExpiresAt time.Time          `json:"expires_at"`
 }
 
 type CreateUserTokenResponse struct {
@@ -375,6 +418,8 @@ func (h *CreateUserTokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Reques
 	creq := &action.CreateUserTokenRequest{
 		UserRef:   userRef,
 		TokenName: req.TokenName,
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
 	}
 	h.log.Infof("creating user %q token", userRef)
 	token, err := h.ah.CreateUserToken(ctx, creq)
@@ -419,6 +464,217 @@ func (h *DeleteUserTokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+type UserTOTPEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URL    string `json:"url"`
+}
+
+type EnrollUserTOTPHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewEnrollUserTOTPHandler(logger *zap.Logger, ah *action.ActionHandler) *EnrollUserTOTPHandler {
+	return &EnrollUserTOTPHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *EnrollUserTOTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	userRef := vars["userref"]
+
+	enrollment, err := h.ah.EnrollUserTOTP(ctx, userRef)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := &UserTOTPEnrollmentResponse{
+		Secret: enrollment.Secret,
+		URL:    enrollment.URL,
+	}
+	if err := httpResponse(w, http.StatusCreated, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type EnableUserTOTPRequest struct {
+	Code string `json:"code"`
+}
+
+type EnableUserTOTPHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewEnableUserTOTPHandler(logger *zap.Logger, ah *action.ActionHandler) *EnableUserTOTPHandler {
+	return &EnableUserTOTPHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *EnableUserTOTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	userRef := vars["userref"]
+
+	var req EnableUserTOTPRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	err := h.ah.EnableUserTOTP(ctx, userRef, req.Code)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type DisableUserTOTPHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewDisableUserTOTPHandler(logger *zap.Logger, ah *action.ActionHandler) *DisableUserTOTPHandler {
+	return &DisableUserTOTPHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *DisableUserTOTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	userRef := vars["userref"]
+
+	err := h.ah.DisableUserTOTP(ctx, userRef)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type UserEmailNotificationsRequest struct {
+	Email string                 `json:"email"`
+	Mode  types.NotificationMode `json:"mode"`
+	// Projects are the subscribed projects modes keyed by project ref. An
+	// empty mode uses the default one
+	Projects map[string]types.NotificationMode `json:"projects"`
+	Digest   bool                              `json:"digest"`
+}
+
+type UserEmailNotificationsResponse struct {
+	Email string                 `json:"email"`
+	Mode  types.NotificationMode `json:"mode"`
+	// Projects are the subscribed projects modes keyed by project id
+	Projects map[string]types.NotificationMode `json:"projects"`
+	Digest   bool                              `json:"digest"`
+}
+
+func createUserEmailNotificationsResponse(n *types.UserEmailNotifications) *UserEmailNotificationsResponse {
+	return &UserEmailNotificationsResponse{
+		Email:    n.Email,
+		Mode:     n.Mode,
+		Projects: n.Projects,
+		Digest:   n.Digest,
+	}
+}
+
+type UserEmailNotificationsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewUserEmailNotificationsHandler(logger *zap.Logger, ah *action.ActionHandler) *UserEmailNotificationsHandler {
+	return &UserEmailNotificationsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *UserEmailNotificationsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	userRef := vars["userref"]
+
+	emailNotifications, err := h.ah.GetUserEmailNotifications(ctx, userRef)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createUserEmailNotificationsResponse(emailNotifications)
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type UpdateUserEmailNotificationsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewUpdateUserEmailNotificationsHandler(logger *zap.Logger, ah *action.ActionHandler) *UpdateUserEmailNotificationsHandler {
+	return &UpdateUserEmailNotificationsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *UpdateUserEmailNotificationsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	userRef := vars["userref"]
+
+	var req UserEmailNotificationsRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	areq := &action.UpdateUserEmailNotificationsRequest{
+		Email:    req.Email,
+		Mode:     req.Mode,
+		Projects: req.Projects,
+		Digest:   req.Digest,
+	}
+	emailNotifications, err := h.ah.UpdateUserEmailNotifications(ctx, userRef, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createUserEmailNotificationsResponse(emailNotifications)
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type DeleteUserEmailNotificationsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewDeleteUserEmailNotificationsHandler(logger *zap.Logger, ah *action.ActionHandler) *DeleteUserEmailNotificationsHandler {
+	return &DeleteUserEmailNotificationsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *DeleteUserEmailNotificationsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	userRef := vars["userref"]
+
+	err := h.ah.DeleteUserEmailNotifications(ctx, userRef)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
 type RegisterUserRequest struct {
 	CreateUserRequest
 	CreateUserLARequest
@@ -610,6 +866,8 @@ type UserCreateRunRequest struct {
 	Branch    string `json:"branch,omitempty"`
 	CommitSHA string `json:"commit_sha,omitempty"`
 	Message   string `json:"message,omitempty"`
+	// Patch is a git patch (in binary format) applied on top of the commit
+	Patch []byte `json:"patch,omitempty"`
 }
 
 type UserCreateRunHandler struct {
@@ -637,6 +895,7 @@ func (h *UserCreateRunHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		Branch:    req.Branch,
 		CommitSHA: req.CommitSHA,
 		Message:   req.Message,
+		Patch:     req.Patch,
 	}
 	err := h.ah.UserCreateRun(ctx, creq)
 	if httpError(w, err) {
@@ -0,0 +1,250 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	slog "agola.io/agola/internal/log"
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/services/types"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// newTestEmailNotificationsRouter returns a router serving the user email
+// notifications handlers. It uses a fake configstore where user01, with email
+// notifications, is a member of org01 owning the private project01 and user02
+// has no email notifications. The returned func returns the email
+// notifications saved by the last user update.
+func newTestEmailNotificationsRouter(t *testing.T) (*mux.Router, func() *types.UserEmailNotifications, func()) {
+	var mu sync.Mutex
+	var saved *types.UserEmailNotifications
+	writeJSON := func(w http.ResponseWriter, v interface{}) {
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+	}
+
+	csRouter := mux.NewRouter().UseEncodedPath()
+	csRouter.HandleFunc("/api/v1alpha/users/{userref}", func(w http.ResponseWriter, r *http.Request) {
+		switch mux.Vars(r)["userref"] {
+		case "user01":
+			writeJSON(w, &types.User{ID: "user01", Name: "user01", EmailNotifications: &types.UserEmailNotifications{
+				Email: "user01@example.com",
+				Mode:  types.NotificationModeFailures,
+			}})
+		case "user02":
+			writeJSON(w, &types.User{ID: "user02", Name: "user02"})
+		default:
+			http.Error(w, "", http.StatusNotFound)
+		}
+	}).Methods("GET")
+	csRouter.HandleFunc("/api/v1alpha/users/{userref}", func(w http.ResponseWriter, r *http.Request) {
+		var req csapi.UpdateUserRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+		mu.Lock()
+		saved = req.EmailNotifications
+		mu.Unlock()
+		writeJSON(w, &types.User{ID: mux.Vars(r)["userref"]})
+	}).Methods("PUT")
+	csRouter.HandleFunc("/api/v1alpha/users/{userref}/orgs", func(w http.ResponseWriter, r *http.Request) {
+		userOrgs := []*csapi.UserOrgsResponse{}
+		if mux.Vars(r)["userref"] == "user01" {
+			userOrgs = append(userOrgs, &csapi.UserOrgsResponse{Organization: &types.Organization{ID: "org01", Name: "org01"}, Role: types.MemberRoleMember})
+		}
+		writeJSON(w, userOrgs)
+	}).Methods("GET")
+	csRouter.HandleFunc("/api/v1alpha/projects/{projectref}", func(w http.ResponseWriter, r *http.Request) {
+		projectRef, err := url.PathUnescape(mux.Vars(r)["projectref"])
+		if err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+		var p *types.Project
+		var ownerID string
+		switch projectRef {
+		case "org01/project01":
+			p = &types.Project{ID: "project01", Name: "project01", Visibility: types.VisibilityPrivate}
+			ownerID = "org01"
+		case "org02/project02":
+			p = &types.Project{ID: "project02", Name: "project02", Visibility: types.VisibilityPrivate}
+			ownerID = "org02"
+		default:
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, &csapi.Project{
+			Project:          p,
+			OwnerType:        types.ConfigTypeOrg,
+			OwnerID:          ownerID,
+			GlobalVisibility: types.VisibilityPrivate,
+		})
+	}).Methods("GET")
+	cs := httptest.NewServer(csRouter)
+
+	logger := slog.New(zap.NewAtomicLevelAt(zap.FatalLevel))
+	ah := action.NewActionHandler(logger, nil, csapi.NewClient(cs.URL), nil, "agola", "", "", nil, nil, nil, nil, nil, nil, nil, 0)
+
+	router := mux.NewRouter()
+	router.Handle("/users/{userref}/emailnotifications", NewUserEmailNotificationsHandler(logger, ah)).Methods("GET")
+	router.Handle("/users/{userref}/emailnotifications", NewUpdateUserEmailNotificationsHandler(logger, ah)).Methods("PUT")
+	router.Handle("/users/{userref}/emailnotifications", NewDeleteUserEmailNotificationsHandler(logger, ah)).Methods("DELETE")
+
+	getSaved := func() *types.UserEmailNotifications {
+		mu.Lock()
+		defer mu.Unlock()
+		return saved
+	}
+	return router, getSaved, cs.Close
+}
+
+func TestUserEmailNotificationsHandlers(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		userRef        string
+		req            *UserEmailNotificationsRequest
+		userID         string
+		admin          bool
+		expectedStatus int
+		expectedSaved  *types.UserEmailNotifications
+	}{
+		{
+			name:           "get own",
+			method:         "GET",
+			userRef:        "user01",
+			userID:         "user01",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "get another user",
+			method:         "GET",
+			userRef:        "user02",
+			userID:         "user01",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "get not configured as admin",
+			method:         "GET",
+			userRef:        "user02",
+			userID:         "admin01",
+			admin:          true,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			// the projects are saved by id
+			name:    "update",
+			method:  "PUT",
+			userRef: "user01",
+			userID:  "user01",
+			req: &UserEmailNotificationsRequest{
+				Email:    "user01@example.com",
+				Mode:     types.NotificationModeFailures,
+				Projects: map[string]types.NotificationMode{"org01/project01": types.NotificationModeAll},
+			},
+			expectedStatus: http.StatusOK,
+			expectedSaved: &types.UserEmailNotifications{
+				Email:    "user01@example.com",
+				Mode:     types.NotificationModeFailures,
+				Projects: map[string]types.NotificationMode{"project01": types.NotificationModeAll},
+			},
+		},
+		{
+			name:    "update with not visible project",
+			method:  "PUT",
+			userRef: "user01",
+			userID:  "user01",
+			req: &UserEmailNotificationsRequest{
+				Email:    "user01@example.com",
+				Mode:     types.NotificationModeFailures,
+				Projects: map[string]types.NotificationMode{"org02/project02": ""},
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "update with email display name",
+			method:         "PUT",
+			userRef:        "user01",
+			userID:         "user01",
+			req:            &UserEmailNotificationsRequest{Email: "User01 <user01@example.com>", Mode: types.NotificationModeAll},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "update with invalid mode",
+			method:         "PUT",
+			userRef:        "user01",
+			userID:         "user01",
+			req:            &UserEmailNotificationsRequest{Email: "user01@example.com", Mode: "never"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "update another user",
+			method:         "PUT",
+			userRef:        "user02",
+			userID:         "user01",
+			req:            &UserEmailNotificationsRequest{Email: "user01@example.com", Mode: types.NotificationModeAll},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			// empty email notifications remove them
+			name:           "delete",
+			method:         "DELETE",
+			userRef:        "user01",
+			userID:         "user01",
+			expectedStatus: http.StatusNoContent,
+			expectedSaved:  &types.UserEmailNotifications{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, getSaved, stop := newTestEmailNotificationsRouter(t)
+			defer stop()
+
+			var body bytes.Buffer
+			if tt.req != nil {
+				if err := json.NewEncoder(&body).Encode(tt.req); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+			}
+			r := httptest.NewRequest(tt.method, "/users/"+tt.userRef+"/emailnotifications", &body)
+			ctx := context.WithValue(r.Context(), "userid", tt.userID)
+			if tt.admin {
+				ctx = context.WithValue(ctx, "admin", true)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r.WithContext(ctx))
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if diff := cmp.Diff(tt.expectedSaved, getSaved()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+type UserNotificationResponse struct {
+	ID           string    `json:"id"`
+	Type         string    `json:"type"`
+	CreationTime time.Time `json:"creation_time"`
+	Read         bool      `json:"read"`
+	Title        string    `json:"title"`
+	Message      string    `json:"message,omitempty"`
+	URL          string    `json:"url,omitempty"`
+	ProjectID    string    `json:"project_id,omitempty"`
+	OrgID        string    `json:"org_id,omitempty"`
+	RunID        string    `json:"run_id,omitempty"`
+	TaskID       string    `json:"task_id,omitempty"`
+}
+
+func createUserNotificationResponse(un *types.UserNotification) *UserNotificationResponse {
+	return &UserNotificationResponse{
+		ID:           un.ID,
+		Type:         string(un.Type),
+		CreationTime: un.CreationTime,
+		Read:         un.Read,
+		Title:        un.Title,
+		Message:      un.Message,
+		URL:          un.URL,
+		ProjectID:    un.ProjectID,
+		OrgID:        un.OrgID,
+		RunID:        un.RunID,
+		TaskID:       un.TaskID,
+	}
+}
+
+type UserNotificationsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewUserNotificationsHandler(logger *zap.Logger, ah *action.ActionHandler) *UserNotificationsHandler {
+	return &UserNotificationsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *UserNotificationsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	_, unreadOnly := query["unread"]
+
+	var limit int
+	if limitS := query.Get("limit"); limitS != "" {
+		var err error
+		limit, err = strconv.Atoi(limitS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse limit: %w", err)))
+			return
+		}
+	}
+	if limit < 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("limit must be greater or equal than 0")))
+		return
+	}
+
+	uns, err := h.ah.GetUserNotifications(ctx, unreadOnly, limit)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := make([]*UserNotificationResponse, len(uns))
+	for i, un := range uns {
+		res[i] = createUserNotificationResponse(un)
+	}
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type UserNotificationsUnreadCountResponse struct {
+	Count int `json:"count"`
+}
+
+type UserNotificationsUnreadCountHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewUserNotificationsUnreadCountHandler(logger *zap.Logger, ah *action.ActionHandler) *UserNotificationsUnreadCountHandler {
+	return &UserNotificationsUnreadCountHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *UserNotificationsUnreadCountHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	count, err := h.ah.GetUserNotificationsUnreadCount(ctx)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, &UserNotificationsUnreadCountResponse{Count: count}); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type MarkUserNotificationsReadRequest struct {
+	// IDs are the notifications to mark as read. When empty all the
+	// notifications are marked as read
+	IDs []string `json:"ids,omitempty"`
+}
+
+type MarkUserNotificationsReadHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewMarkUserNotificationsReadHandler(logger *zap.Logger, ah *action.ActionHandler) *MarkUserNotificationsReadHandler {
+	return &MarkUserNotificationsReadHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *MarkUserNotificationsReadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req MarkUserNotificationsReadRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	err := h.ah.MarkUserNotificationsRead(ctx, req.IDs)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type WatchProjectHandler struct {
+	log   *zap.SugaredLogger
+	ah    *action.ActionHandler
+	watch bool
+}
+
+// NewWatchProjectHandler returns a handler that adds (watch == true) or
+// removes the project from the current user watched projects
+func NewWatchProjectHandler(logger *zap.Logger, ah *action.ActionHandler, watch bool) *WatchProjectHandler {
+	return &WatchProjectHandler{log: logger.Sugar(), ah: ah, watch: watch}
+}
+
+func (h *WatchProjectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	if h.watch {
+		err = h.ah.WatchProject(ctx, projectRef)
+	} else {
+		err = h.ah.UnwatchProject(ctx, projectRef)
+	}
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
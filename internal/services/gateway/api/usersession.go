@@ -0,0 +1,135 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/services/types"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type UserSessionResponse struct {
+	Type       action.UserSessionType `json:"type"`
+	ID         string                 `json:"id"`
+	Scopes     []types.TokenScope     `json:"scopes,omitempty"`
+	CreatedAt  *time.Time             `json:"created_at,omitempty"`
+	ExpiresAt  *time.Time             `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time             `json:"last_used_at,omitempty"`
+	LastUsedIP string                 `json:"last_used_ip,omitempty"`
+	Current    bool                   `json:"current"`
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func createUserSessionResponse(s *action.UserSession) *UserSessionResponse {
+	return &UserSessionResponse{
+		Type:       s.Type,
+		ID:         s.ID,
+		Scopes:     s.Scopes,
+		CreatedAt:  timeOrNil(s.CreatedAt),
+		ExpiresAt:  timeOrNil(s.ExpiresAt),
+		LastUsedAt: timeOrNil(s.LastUsedAt),
+		LastUsedIP: s.LastUsedIP,
+		Current:    s.Current,
+	}
+}
+
+type UserSessionsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewUserSessionsHandler(logger *zap.Logger, ah *action.ActionHandler) *UserSessionsHandler {
+	return &UserSessionsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *UserSessionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	userRef := vars["userref"]
+
+	sessions, err := h.ah.GetUserSessions(ctx, userRef)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := make([]*UserSessionResponse, len(sessions))
+	for i, s := range sessions {
+		res[i] = createUserSessionResponse(s)
+	}
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type DeleteUserSessionHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewDeleteUserSessionHandler(logger *zap.Logger, ah *action.ActionHandler) *DeleteUserSessionHandler {
+	return &DeleteUserSessionHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *DeleteUserSessionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	userRef := vars["userref"]
+	sessionID := vars["sessionid"]
+
+	err := h.ah.DeleteUserSession(ctx, userRef, sessionID)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type DeleteUserSessionsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewDeleteUserSessionsHandler(logger *zap.Logger, ah *action.ActionHandler) *DeleteUserSessionsHandler {
+	return &DeleteUserSessionsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *DeleteUserSessionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	userRef := vars["userref"]
+
+	err := h.ah.DeleteUserSessions(ctx, userRef)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
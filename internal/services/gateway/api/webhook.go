@@ -15,12 +15,18 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"io/ioutil"
 	"net/http"
+	"net/url"
 
+	gitsource "agola.io/agola/internal/gitsources"
 	"agola.io/agola/internal/services/common"
 	csapi "agola.io/agola/internal/services/configstore/api"
 	"agola.io/agola/internal/services/gateway/action"
 	rsapi "agola.io/agola/internal/services/runservice/api"
+	rstypes "agola.io/agola/internal/services/runservice/types"
 	"agola.io/agola/internal/services/types"
 	"agola.io/agola/internal/util"
 
@@ -47,7 +53,7 @@ func NewWebhooksHandler(logger *zap.Logger, ah *action.ActionHandler, configstor
 }
 
 func (h *webhooksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	err := h.handleWebhook(r)
+	err := h.receiveWebhook(r)
 	if httpError(w, err) {
 		h.log.Errorf("err: %+v", err)
 		return
@@ -58,6 +64,132 @@ func (h *webhooksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// receiveWebhook handles the received webhook or queues it when the
+// maintenance mode is enabled
+func (h *webhooksHandler) receiveWebhook(r *http.Request) error {
+	ctx := r.Context()
+
+	projectID := r.URL.Query().Get("projectid")
+	if projectID == "" {
+		return util.NewErrBadRequest(errors.Errorf("bad webhook url %q. Missing projectid", r.URL))
+	}
+
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return util.NewErrBadRequest(errors.Errorf("failed to read webhook body: %w", err))
+	}
+
+	maintenance, resp, err := h.runserviceClient.GetMaintenance(ctx)
+	if err != nil {
+		return action.ErrFromRemote(resp, err)
+	}
+	if maintenance.Enabled {
+		return h.queueWebhook(ctx, projectID, r.Header, body)
+	}
+
+	return h.processWebhook(ctx, projectID, r.Header, body)
+}
+
+// processWebhook handles a webhook. When the handling fails for a reason
+// different than a bad request (i.e. a remote source or configstore error)
+// the webhook is saved as a failed webhook so it can be replayed later.
+func (h *webhooksHandler) processWebhook(ctx context.Context, projectID string, header http.Header, body []byte) error {
+	u := url.URL{Path: "/webhooks", RawQuery: url.Values{"projectid": []string{projectID}}.Encode()}
+	r, err := http.NewRequest("POST", u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	r.Header = header
+
+	err = h.handleWebhook(r.WithContext(ctx))
+	if err == nil || errors.Is(err, &util.ErrBadRequest{}) {
+		return err
+	}
+
+	fw := &rstypes.FailedWebhook{
+		ProjectID: projectID,
+		Header:    header,
+		Body:      body,
+		Error:     err.Error(),
+	}
+	fw, resp, ferr := h.runserviceClient.CreateFailedWebhook(ctx, fw)
+	if ferr != nil {
+		h.log.Errorf("failed to save failed webhook: %+v", action.ErrFromRemote(resp, ferr))
+		return err
+	}
+	h.log.Infof("saved failed webhook %q for project %q", fw.ID, projectID)
+
+	return err
+}
+
+// ReplayFailedWebhook replays a failed webhook. The failed webhook is removed
+// before being handled and saved again with a new id if it fails again.
+func (h *webhooksHandler) ReplayFailedWebhook(ctx context.Context, id string) error {
+	fw, err := h.ah.GetFailedWebhook(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := h.ah.DeleteFailedWebhook(ctx, id); err != nil {
+		return err
+	}
+
+	h.log.Infof("replaying failed webhook %q for project %q", fw.ID, fw.ProjectID)
+	return h.processWebhook(ctx, fw.ProjectID, fw.Header, fw.Body)
+}
+
+// queueWebhook saves the webhook to be replayed when the maintenance mode is
+// disabled
+func (h *webhooksHandler) queueWebhook(ctx context.Context, projectID string, header http.Header, body []byte) error {
+	qw := &rstypes.QueuedWebhook{
+		ProjectID: projectID,
+		Header:    header,
+		Body:      body,
+	}
+	qw, resp, err := h.runserviceClient.QueueWebhook(ctx, qw)
+	if err != nil {
+		return action.ErrFromRemote(resp, err)
+	}
+	h.log.Infof("maintenance mode enabled, queued webhook %q for project %q", qw.ID, projectID)
+
+	return nil
+}
+
+// ReplayQueuedWebhooks handles the webhooks queued during the maintenance mode.
+// Every queued webhook is removed before being handled so it'll be handled
+// only once also with multiple gateways.
+func (h *webhooksHandler) ReplayQueuedWebhooks(ctx context.Context) error {
+	maintenance, resp, err := h.runserviceClient.GetMaintenance(ctx)
+	if err != nil {
+		return action.ErrFromRemote(resp, err)
+	}
+	if maintenance.Enabled {
+		return nil
+	}
+
+	qws, resp, err := h.runserviceClient.GetQueuedWebhooks(ctx)
+	if err != nil {
+		return action.ErrFromRemote(resp, err)
+	}
+	for _, qw := range qws {
+		resp, err := h.runserviceClient.DeleteQueuedWebhook(ctx, qw.ID)
+		if err != nil {
+			if resp != nil && resp.StatusCode == http.StatusNotFound {
+				// already replayed by another gateway
+				continue
+			}
+			return action.ErrFromRemote(resp, err)
+		}
+
+		h.log.Infof("replaying queued webhook %q for project %q", qw.ID, qw.ProjectID)
+		if err := h.processWebhook(ctx, qw.ProjectID, qw.Header, qw.Body); err != nil {
+			h.log.Errorf("failed to replay queued webhook %q: %+v", qw.ID, err)
+		}
+	}
+
+	return nil
+}
+
 func (h *webhooksHandler) handleWebhook(r *http.Request) error {
 	ctx := r.Context()
 
@@ -113,6 +245,18 @@ func (h *webhooksHandler) handleWebhook(r *http.Request) error {
 
 	cloneURL := webhookData.SSHURL
 
+	changedFiles := webhookData.ChangedFiles
+	if webhookData.Event == types.WebhookEventPullRequest && len(project.ConfigDirs) > 0 {
+		if prFilesSource, ok := gitSource.(gitsource.PullRequestFilesSource); ok {
+			changedFiles, err = prFilesSource.ListPullRequestFiles(webhookData.Repo.Path, webhookData.PullRequestID)
+			if err != nil {
+				// run all the project config dirs
+				h.log.Errorf("failed to list pull request %q files: %+v", webhookData.PullRequestID, err)
+				changedFiles = nil
+			}
+		}
+	}
+
 	req := &action.CreateRunRequest{
 		RunType:            types.RunTypeProject,
 		RefType:            common.WebHookEventToRunRefType(webhookData.Event),
@@ -138,6 +282,10 @@ func (h *webhooksHandler) handleWebhook(r *http.Request) error {
 		TagLink:         webhookData.TagLink,
 		PullRequestLink: webhookData.PullRequestLink,
 		CompareLink:     webhookData.CompareLink,
+
+		PullRequestAttributes: webhookData.PullRequestAttributes,
+
+		ChangedFiles: changedFiles,
 	}
 	if err := h.ah.CreateRuns(ctx, req); err != nil {
 		return util.NewErrInternal(errors.Errorf("failed to create run: %w", err))
@@ -18,11 +18,15 @@ import (
 	"context"
 	"crypto/tls"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"time"
 
 	scommon "agola.io/agola/internal/common"
+	rcconfig "agola.io/agola/internal/config"
 	slog "agola.io/agola/internal/log"
 	"agola.io/agola/internal/objectstorage"
+	"agola.io/agola/internal/saml"
 	"agola.io/agola/internal/services/common"
 	"agola.io/agola/internal/services/config"
 	csapi "agola.io/agola/internal/services/configstore/api"
@@ -30,6 +34,7 @@ import (
 	"agola.io/agola/internal/services/gateway/api"
 	"agola.io/agola/internal/services/gateway/handlers"
 	rsapi "agola.io/agola/internal/services/runservice/api"
+	"agola.io/agola/internal/services/types"
 	"agola.io/agola/internal/util"
 
 	jwt "github.com/dgrijalva/jwt-go"
@@ -122,9 +127,97 @@ func NewGateway(gc *config.Config) (*Gateway, error) {
 	}
 
 	configstoreClient := csapi.NewClient(c.ConfigstoreURL)
+	if c.ConfigstoreReadURL != "" {
+		configstoreClient.SetReadURL(c.ConfigstoreReadURL)
+	}
+	configstoreClient.SetInternalAPIToken(c.ConfigstoreAPIToken)
 	runserviceClient := rsapi.NewClient(c.RunserviceURL)
+	runserviceClient.SetInternalAPIToken(c.RunserviceAPIToken)
+
+	configLinter, err := newConfigLinter(&c.ConfigLint)
+	if err != nil {
+		return nil, errors.Errorf("gateway configLint configuration error: %w", err)
+	}
+
+	var runConfigPolicy *rcconfig.Policy
+	if c.RunConfigPolicyFile != "" {
+		data, err := ioutil.ReadFile(c.RunConfigPolicyFile)
+		if err != nil {
+			return nil, errors.Errorf("failed to read run config policy file: %w", err)
+		}
+		runConfigPolicy, err = rcconfig.ParsePolicy(data)
+		if err != nil {
+			return nil, errors.Errorf("gateway run config policy error: %w", err)
+		}
+	} else {
+		// always apply a policy so the options requiring an explicit allow
+		// (like the host network) are forbidden by default
+		runConfigPolicy = &rcconfig.Policy{}
+	}
+
+	anonymousAccess := &types.AnonymousAccess{
+		HideRuns:      c.AnonymousAccess.HideRuns,
+		HideLogs:      c.AnonymousAccess.HideLogs,
+		HideArtifacts: c.AnonymousAccess.HideArtifacts,
+		HideConfig:    c.AnonymousAccess.HideConfig,
+	}
+
+	var samlConfig *action.SAMLConfig
+	if c.SAML.IDPMetadataFile != "" {
+		data, err := ioutil.ReadFile(c.SAML.IDPMetadataFile)
+		if err != nil {
+			return nil, errors.Errorf("failed to read saml idp metadata file: %w", err)
+		}
+		idpMetadata, err := saml.ParseIDPMetadata(data)
+		if err != nil {
+			return nil, errors.Errorf("gateway saml configuration error: %w", err)
+		}
+		entityID := c.SAML.EntityID
+		if entityID == "" {
+			entityID = c.APIExposedURL + "/api/saml/metadata"
+		}
+		samlConfig = &action.SAMLConfig{
+			SP: &saml.ServiceProvider{
+				EntityID: entityID,
+				ACSURL:   c.APIExposedURL + "/api/saml/acs",
+				IDP:      idpMetadata,
+			},
+			UsernameAttribute: c.SAML.UsernameAttribute,
+			EmailAttribute:    c.SAML.EmailAttribute,
+			AutoRegister:      c.SAML.AutoRegister,
+		}
+	}
+
+	twoFactorAuth := &action.TwoFactorAuthConfig{
+		Required: c.TwoFactorAuth.Required,
+		Issuer:   c.TwoFactorAuth.Issuer,
+	}
+	if twoFactorAuth.Issuer == "" {
+		twoFactorAuth.Issuer = "Agola"
+	}
+
+	var orgSync *action.OrgSyncConfig
+	if len(c.OrgSync.Orgs) > 0 {
+		orgSync = &action.OrgSyncConfig{
+			OnLogin:        c.OrgSync.OnLogin,
+			Interval:       c.OrgSync.Interval,
+			ConflictPolicy: action.OrgSyncConflictPolicy(c.OrgSync.ConflictPolicy),
+		}
+		if orgSync.ConflictPolicy == "" {
+			orgSync.ConflictPolicy = action.OrgSyncConflictPolicyKeep
+		}
+		for _, o := range c.OrgSync.Orgs {
+			orgSync.Orgs = append(orgSync.Orgs, &action.OrgSyncOrg{
+				RemoteSource: o.RemoteSource,
+				RemoteOrg:    o.RemoteOrg,
+				Org:          o.Org,
+				Teams:        o.Teams,
+				OwnerTeams:   o.OwnerTeams,
+			})
+		}
+	}
 
-	ah := action.NewActionHandler(logger, sd, configstoreClient, runserviceClient, gc.ID, c.APIExposedURL, c.WebExposedURL)
+	ah := action.NewActionHandler(logger, sd, configstoreClient, runserviceClient, gc.ID, c.APIExposedURL, c.WebExposedURL, c.OrgsStoragePartitions, configLinter, runConfigPolicy, anonymousAccess, samlConfig, twoFactorAuth, orgSync, c.RefCacheTTL)
 
 	return &Gateway{
 		c:                 c,
@@ -136,6 +229,133 @@ func NewGateway(gc *config.Config) (*Gateway, error) {
 	}, nil
 }
 
+func newConfigLinter(c *config.ConfigLint) (*rcconfig.Linter, error) {
+	customRules := []rcconfig.LintRule{}
+	for _, cr := range c.CustomRules {
+		r, err := rcconfig.NewRegexpLintRule(cr.Name, cr.Message, rcconfig.LintSeverity(cr.Severity), rcconfig.LintField(cr.Field), cr.Regexp)
+		if err != nil {
+			return nil, err
+		}
+		customRules = append(customRules, r)
+	}
+	overrides := map[string]rcconfig.LintRuleOverride{}
+	for name, r := range c.Rules {
+		overrides[name] = rcconfig.LintRuleOverride{Disabled: r.Disabled, Severity: rcconfig.LintSeverity(r.Severity)}
+	}
+	return rcconfig.NewLinter(customRules, overrides)
+}
+
+// queuedWebhooksReplayerLoop periodically replays the webhooks queued during
+// the maintenance mode
+func (g *Gateway) queuedWebhooksReplayerLoop(ctx context.Context, replay func(context.Context) error) {
+	for {
+		if err := replay(ctx); err != nil {
+			log.Errorf("err: %+v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		time.Sleep(10 * time.Second)
+	}
+}
+
+// orgSyncLoop periodically syncs the users organizations membership
+func (g *Gateway) orgSyncLoop(ctx context.Context, interval time.Duration) {
+	for {
+		if err := g.ah.SyncOrgs(ctx); err != nil {
+			log.Errorf("err: %+v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// refCacheWatchLoop watches the configstore changes to purge the ref cache
+func (g *Gateway) refCacheWatchLoop(ctx context.Context) {
+	for {
+		if err := g.ah.WatchRefChanges(ctx); err != nil {
+			log.Errorf("err: %+v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(1 * time.Second):
+		}
+	}
+}
+
+// accessUsageFlushLoop periodically saves the recorded users sessions and
+// tokens usages
+func (g *Gateway) accessUsageFlushLoop(ctx context.Context, r *handlers.AccessUsageRecorder) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(handlers.AccessUsageFlushInterval):
+		}
+
+		r.Flush(ctx)
+	}
+}
+
+// trashPurgeLoop periodically purges the expired trash items
+func (g *Gateway) trashPurgeLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(10 * time.Minute):
+		}
+
+		if err := g.ah.PurgeTrashItems(ctx); err != nil {
+			log.Errorf("err: %+v", err)
+		}
+	}
+}
+
+// projectsPollingLoop periodically polls the remote repositories of the
+// projects with the polling enabled
+func (g *Gateway) projectsPollingLoop(ctx context.Context) {
+	lastPolls := map[string]time.Time{}
+	for {
+		if err := g.ah.PollProjects(ctx, lastPolls); err != nil {
+			log.Errorf("err: %+v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(30 * time.Second):
+		}
+	}
+}
+
+// projectSchedulesLoop periodically creates the runs of the activated project
+// schedules
+func (g *Gateway) projectSchedulesLoop(ctx context.Context) {
+	lastChecks := map[string]time.Time{}
+	for {
+		if err := g.ah.RunProjectSchedules(ctx, lastChecks); err != nil {
+			log.Errorf("err: %+v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(30 * time.Second):
+		}
+	}
+}
+
 func (g *Gateway) Run(ctx context.Context) error {
 	// noop coors handler
 	corsHandler := func(h http.Handler) http.Handler {
@@ -144,7 +364,7 @@ func (g *Gateway) Run(ctx context.Context) error {
 
 if len(g.c.Web.AllowedOrigins) > 0 {
 	corsAllowedMethodsOptions := ghandlers.AllowedMethods([]string{"GET", "HEAD", "POST", "PUT", "DELETE"})
-	corsAllowedHeadersOptions := ghandlers.AllowedHeaders([]string{"Accept", "Accept-Encoding", "Authorization", "Content-Length", "Content-Type", "X-CSRF-Token", "Authorization"})
+	corsAllowedHeadersOptions := ghandlers.AllowedHeaders([]string{"Accept", "Accept-Encoding", "Authorization", "Content-Length", "Content-Type", "X-CSRF-Token", "Authorization", handlers.OTPHeader})
 	corsAllowedOriginsOptions := ghandlers.AllowedOrigins(g.c.Web.AllowedOrigins)
 	corsHandler = ghandlers.CORS(corsAllowedMethodsOptions, corsAllowedHeadersOptions, corsAllowedOriginsOptions)
 }
@@ -154,6 +374,13 @@ if len(g.c.Web.AllowedOrigins) > 0 {
 	projectGroupHandler := api.NewProjectGroupHandler(logger, g.ah)
 	projectGroupSubgroupsHandler := api.NewProjectGroupSubgroupsHandler(logger, g.ah)
 	projectGroupProjectsHandler := api.NewProjectGroupProjectsHandler(logger, g.ah)
+	projectGroupTreeHandler := api.NewProjectGroupTreeHandler(logger, g.ah)
+	projectGroupSettingsHandler := api.NewProjectGroupSettingsHandler(logger, g.ah)
+	updateProjectGroupSettingsHandler := api.NewUpdateProjectGroupSettingsHandler(logger, g.ah)
+	projectGroupTrashItemsHandler := api.NewProjectGroupTrashItemsHandler(logger, g.ah)
+	restoreTrashItemHandler := api.NewRestoreTrashItemHandler(logger, g.ah)
+	projectPathAliasesHandler := api.NewProjectPathAliasesHandler(logger, g.ah)
+	projectGroupPathAliasesHandler := api.NewProjectGroupPathAliasesHandler(logger, g.ah)
 	createProjectGroupHandler := api.NewCreateProjectGroupHandler(logger, g.ah)
 	updateProjectGroupHandler := api.NewUpdateProjectGroupHandler(logger, g.ah)
 	deleteProjectGroupHandler := api.NewDeleteProjectGroupHandler(logger, g.ah)
@@ -163,8 +390,18 @@ if len(g.c.Web.AllowedOrigins) > 0 {
 	updateProjectHandler := api.NewUpdateProjectHandler(logger, g.ah)
 	deleteProjectHandler := api.NewDeleteProjectHandler(logger, g.ah)
 	projectReconfigHandler := api.NewProjectReconfigHandler(logger, g.ah)
+	projectTasksFlakinessHandler := api.NewProjectTasksFlakinessHandler(logger, g.ah)
+	projectRunsStatsHandler := api.NewProjectRunsStatsHandler(logger, g.ah)
+	projectTestCaseHistoryHandler := api.NewProjectTestCaseHistoryHandler(logger, g.ah)
+	projectCoverageHistoryHandler := api.NewProjectCoverageHistoryHandler(logger, g.ah)
+	updateProjectQuarantinedTasksHandler := api.NewUpdateProjectQuarantinedTasksHandler(logger, g.ah)
+	updateProjectRunDefaultsHandler := api.NewUpdateProjectRunDefaultsHandler(logger, g.ah)
+	projectEffectiveSettingsHandler := api.NewProjectEffectiveSettingsHandler(logger, g.ah)
+	projectChangesHandler := api.NewProjectChangesHandler(logger, g.ah)
+	projectRollbackHandler := api.NewProjectRollbackHandler(logger, g.ah)
 	projectUpdateRepoLinkedAccountHandler := api.NewProjectUpdateRepoLinkedAccountHandler(logger, g.ah)
 	projectCreateRunHandler := api.NewProjectCreateRunHandler(logger, g.ah)
+	projectCreateFileHandler := api.NewProjectCreateFileHandler(logger, g.ah)
 
 	secretHandler := api.NewSecretHandler(logger, g.ah)
 	createSecretHandler := api.NewCreateSecretHandler(logger, g.ah)
@@ -177,6 +414,7 @@ if len(g.c.Web.AllowedOrigins) > 0 {
 	deleteVariableHandler := api.NewDeleteVariableHandler(logger, g.ah)
 
 	currentUserHandler := api.NewCurrentUserHandler(logger, g.ah)
+	currentUserTokenHandler := api.NewCurrentUserTokenHandler(logger, g.ah)
 	userHandler := api.NewUserHandler(logger, g.ah)
 	usersHandler := api.NewUsersHandler(logger, g.ah)
 	createUserHandler := api.NewCreateUserHandler(logger, g.ah)
@@ -187,12 +425,47 @@ if len(g.c.Web.AllowedOrigins) > 0 {
 	deleteUserLAHandler := api.NewDeleteUserLAHandler(logger, g.ah)
 	createUserTokenHandler := api.NewCreateUserTokenHandler(logger, g.ah)
 	deleteUserTokenHandler := api.NewDeleteUserTokenHandler(logger, g.ah)
+	userSessionsHandler := api.NewUserSessionsHandler(logger, g.ah)
+	deleteUserSessionHandler := api.NewDeleteUserSessionHandler(logger, g.ah)
+	deleteUserSessionsHandler := api.NewDeleteUserSessionsHandler(logger, g.ah)
+	enrollUserTOTPHandler := api.NewEnrollUserTOTPHandler(logger, g.ah)
+	enableUserTOTPHandler := api.NewEnableUserTOTPHandler(logger, g.ah)
+	disableUserTOTPHandler := api.NewDisableUserTOTPHandler(logger, g.ah)
+	userEmailNotificationsHandler := api.NewUserEmailNotificationsHandler(logger, g.ah)
+	updateUserEmailNotificationsHandler := api.NewUpdateUserEmailNotificationsHandler(logger, g.ah)
+	deleteUserEmailNotificationsHandler := api.NewDeleteUserEmailNotificationsHandler(logger, g.ah)
+	userNotificationsHandler := api.NewUserNotificationsHandler(logger, g.ah)
+	userNotificationsUnreadCountHandler := api.NewUserNotificationsUnreadCountHandler(logger, g.ah)
+	markUserNotificationsReadHandler := api.NewMarkUserNotificationsReadHandler(logger, g.ah)
+	watchProjectHandler := api.NewWatchProjectHandler(logger, g.ah, true)
+	unwatchProjectHandler := api.NewWatchProjectHandler(logger, g.ah, false)
 
 	remoteSourceHandler := api.NewRemoteSourceHandler(logger, g.ah)
 	createRemoteSourceHandler := api.NewCreateRemoteSourceHandler(logger, g.ah)
 	updateRemoteSourceHandler := api.NewUpdateRemoteSourceHandler(logger, g.ah)
 	remoteSourcesHandler := api.NewRemoteSourcesHandler(logger, g.ah)
 	deleteRemoteSourceHandler := api.NewDeleteRemoteSourceHandler(logger, g.ah)
+	checkRemoteSourceHandler := api.NewCheckRemoteSourceHandler(logger, g.ah)
+	rotateRemoteSourceSecretHandler := api.NewRotateRemoteSourceSecretHandler(logger, g.ah)
+	migrateRemoteSourceHandler := api.NewMigrateRemoteSourceHandler(logger, g.ah)
+
+	walsHandler := api.NewWalsHandler(logger, g.ah)
+	objectHistoryHandler := api.NewObjectHistoryHandler(logger, g.ah)
+	restoreObjectHandler := api.NewRestoreObjectHandler(logger, g.ah)
+
+	executorsHandler := api.NewExecutorsHandler(logger, g.ah)
+	approveExecutorHandler := api.NewApproveExecutorHandler(logger, g.ah)
+	deleteExecutorHandler := api.NewDeleteExecutorHandler(logger, g.ah)
+
+	maintenanceHandler := api.NewMaintenanceHandler(logger, g.ah)
+	enableMaintenanceHandler := api.NewEnableMaintenanceHandler(logger, g.ah)
+	disableMaintenanceHandler := api.NewDisableMaintenanceHandler(logger, g.ah)
+
+	failedWebhooksHandler := api.NewFailedWebhooksHandler(logger, g.ah)
+	replayFailedWebhookHandler := api.NewReplayFailedWebhookHandler(logger, webhooksHandler)
+	deleteFailedWebhookHandler := api.NewDeleteFailedWebhookHandler(logger, g.ah)
+
+	validateConfigHandler := api.NewValidateConfigHandler(logger, g.ah)
 
 	orgHandler := api.NewOrgHandler(logger, g.ah)
 	orgsHandler := api.NewOrgsHandler(logger, g.ah)
@@ -204,16 +477,32 @@ if len(g.c.Web.AllowedOrigins) > 0 {
 	removeOrgMemberHandler := api.NewRemoveOrgMemberHandler(logger, g.ah)
 
 	runHandler := api.NewRunHandler(logger, g.ah)
+	projectRunHandler := api.NewProjectRunHandler(logger, g.ah)
+	projectRunsByNameHandler := api.NewProjectRunsByNameHandler(logger, g.ah)
+	projectRunsFeedHandler := api.NewProjectRunsFeedHandler(logger, g.ah)
+	projectSchedulesCalendarHandler := api.NewProjectSchedulesCalendarHandler(logger, g.ah)
+
+	cancelRunsHandler := api.NewCancelRunsHandler(logger, g.ah)
+	deleteProjectsHandler := api.NewDeleteProjectsHandler(logger, g.ah)
+	updateProjectGroupVisibilityHandler := api.NewUpdateProjectGroupVisibilityHandler(logger, g.ah)
 	runsHandler := api.NewRunsHandler(logger, g.ah)
 	runtaskHandler := api.NewRuntaskHandler(logger, g.ah)
+	runTaskTestResultsHandler := api.NewRunTaskTestResultsHandler(logger, g.ah)
+	runGanttHandler := api.NewRunGanttHandler(logger, g.ah)
+	runCoverageHandler := api.NewRunCoverageHandler(logger, g.ah)
+	runConfigHandler := api.NewRunConfigHandler(logger, g.ah)
+	runLogsArchiveHandler := api.NewRunLogsArchiveHandler(logger, g.ah)
 	runActionsHandler := api.NewRunActionsHandler(logger, g.ah)
+	debugRunHandler := api.NewDebugRunHandler(logger, g.ah)
 	runTaskActionsHandler := api.NewRunTaskActionsHandler(logger, g.ah)
+	runTaskExecHandler := api.NewRunTaskExecHandler(logger, g.ah)
 
 	logsHandler := api.NewLogsHandler(logger, g.ah)
 
 	userRemoteReposHandler := api.NewUserRemoteReposHandler(logger, g.ah, g.configstoreClient)
 
 	badgeHandler := api.NewBadgeHandler(logger, g.ah)
+	coverageBadgeHandler := api.NewCoverageBadgeHandler(logger, g.ah)
 
 	reposHandler := api.NewReposHandler(logger, g.c.GitserverURL)
 
@@ -221,14 +510,21 @@ if len(g.c.Web.AllowedOrigins) > 0 {
 	authorizeHandler := api.NewAuthorizeHandler(logger, g.ah)
 	registerHandler := api.NewRegisterUserHandler(logger, g.ah)
 	oauth2callbackHandler := api.NewOAuth2CallbackHandler(logger, g.ah)
+	samlMetadataHandler := api.NewSAMLMetadataHandler(logger, g.ah)
+	samlLoginHandler := api.NewSAMLLoginHandler(logger, g.ah, g.c.APIExposedURL)
+	samlACSHandler := api.NewSAMLACSHandler(logger, g.ah, g.c.APIExposedURL)
 
 	router := mux.NewRouter()
 	reposRouter := mux.NewRouter()
 
 	apirouter := mux.NewRouter().PathPrefix("/api/v1alpha").Subrouter().UseEncodedPath()
 
-	authForcedHandler := handlers.NewAuthHandler(logger, g.configstoreClient, g.c.AdminToken, g.sd, true)
-	authOptionalHandler := handlers.NewAuthHandler(logger, g.configstoreClient, g.c.AdminToken, g.sd, false)
+	accessUsageRecorder := handlers.NewAccessUsageRecorder(logger, g.configstoreClient)
+	authForcedHandler := handlers.NewAuthHandler(logger, g.configstoreClient, g.c.AdminToken, g.sd, accessUsageRecorder, true)
+	authOptionalHandler := handlers.NewAuthHandler(logger, g.configstoreClient, g.c.AdminToken, g.sd, accessUsageRecorder, false)
+
+	// resolve the old paths of the renamed projects and project groups
+	apirouter.Use(handlers.NewPathAliasHandler(logger, g.ah))
 
 	router.PathPrefix("/api/v1alpha").Handler(apirouter)
 
@@ -238,6 +534,13 @@ if len(g.c.Web.AllowedOrigins) > 0 {
 	apirouter.Handle("/projectgroups/{projectgroupref}", authForcedHandler(projectGroupHandler)).Methods("GET")
 	apirouter.Handle("/projectgroups/{projectgroupref}/subgroups", authForcedHandler(projectGroupSubgroupsHandler)).Methods("GET")
 	apirouter.Handle("/projectgroups/{projectgroupref}/projects", authForcedHandler(projectGroupProjectsHandler)).Methods("GET")
+	apirouter.Handle("/projectgroups/{projectgroupref}/tree", authForcedHandler(projectGroupTreeHandler)).Methods("GET")
+	apirouter.Handle("/projectgroups/{projectgroupref}/settings", authForcedHandler(projectGroupSettingsHandler)).Methods("GET")
+	apirouter.Handle("/projectgroups/{projectgroupref}/settings", authForcedHandler(updateProjectGroupSettingsHandler)).Methods("PUT")
+	apirouter.Handle("/projectgroups/{projectgroupref}/trash", authForcedHandler(projectGroupTrashItemsHandler)).Methods("GET")
+	apirouter.Handle("/trash/{trashitemid}/restore", authForcedHandler(restoreTrashItemHandler)).Methods("POST")
+	apirouter.Handle("/projects/{projectref}/pathaliases", authOptionalHandler(projectPathAliasesHandler)).Methods("GET")
+	apirouter.Handle("/projectgroups/{projectgroupref}/pathaliases", authOptionalHandler(projectGroupPathAliasesHandler)).Methods("GET")
 	apirouter.Handle("/projectgroups", authForcedHandler(createProjectGroupHandler)).Methods("POST")
 	apirouter.Handle("/projectgroups/{projectgroupref}", authForcedHandler(updateProjectGroupHandler)).Methods("PUT")
 	apirouter.Handle("/projectgroups/{projectgroupref}", authForcedHandler(deleteProjectGroupHandler)).Methods("DELETE")
@@ -247,8 +550,24 @@ if len(g.c.Web.AllowedOrigins) > 0 {
 	apirouter.Handle("/projects/{projectref}", authForcedHandler(updateProjectHandler)).Methods("PUT")
 	apirouter.Handle("/projects/{projectref}", authForcedHandler(deleteProjectHandler)).Methods("DELETE")
 	apirouter.Handle("/projects/{projectref}/reconfig", authForcedHandler(projectReconfigHandler)).Methods("PUT")
+	apirouter.Handle("/projects/{projectref}/runs/{runnumber}", authOptionalHandler(projectRunHandler)).Methods("GET")
+	apirouter.Handle("/projects/{projectref}/runsbyname", authOptionalHandler(projectRunsByNameHandler)).Methods("GET")
+	apirouter.Handle("/projects/{projectref}/runs/feed", authOptionalHandler(projectRunsFeedHandler)).Methods("GET")
+	apirouter.Handle("/projects/{projectref}/schedules/ical", authOptionalHandler(projectSchedulesCalendarHandler)).Methods("GET")
+	apirouter.Handle("/projects/{projectref}/tasksflakiness", authOptionalHandler(projectTasksFlakinessHandler)).Methods("GET")
+	apirouter.Handle("/projects/{projectref}/runsstats", authOptionalHandler(projectRunsStatsHandler)).Methods("GET")
+	apirouter.Handle("/projects/{projectref}/testcases/history", authOptionalHandler(projectTestCaseHistoryHandler)).Methods("GET")
+	apirouter.Handle("/projects/{projectref}/coverage", authOptionalHandler(projectCoverageHistoryHandler)).Methods("GET")
+	apirouter.Handle("/projects/{projectref}/quarantinedtasks", authForcedHandler(updateProjectQuarantinedTasksHandler)).Methods("PUT")
+	apirouter.Handle("/projects/{projectref}/rundefaults", authForcedHandler(updateProjectRunDefaultsHandler)).Methods("PUT")
+	apirouter.Handle("/projects/{projectref}/effectivesettings", authForcedHandler(projectEffectiveSettingsHandler)).Methods("GET")
+	apirouter.Handle("/projects/{projectref}/changes", authForcedHandler(projectChangesHandler)).Methods("GET")
+	apirouter.Handle("/projects/{projectref}/watch", authForcedHandler(watchProjectHandler)).Methods("PUT")
+	apirouter.Handle("/projects/{projectref}/watch", authForcedHandler(unwatchProjectHandler)).Methods("DELETE")
+	apirouter.Handle("/projects/{projectref}/changes/{changeid}/rollback", authForcedHandler(projectRollbackHandler)).Methods("PUT")
 	apirouter.Handle("/projects/{projectref}/updaterepolinkedaccount", authForcedHandler(projectUpdateRepoLinkedAccountHandler)).Methods("PUT")
 	apirouter.Handle("/projects/{projectref}/createrun", authForcedHandler(projectCreateRunHandler)).Methods("PUT")
+	apirouter.Handle("/projects/{projectref}/createfile", authForcedHandler(projectCreateFileHandler)).Methods("PUT")
 
 	apirouter.Handle("/projectgroups/{projectgroupref}/secrets", authForcedHandler(secretHandler)).Methods("GET")
 	apirouter.Handle("/projects/{projectref}/secrets", authForcedHandler(secretHandler)).Methods("GET")
@@ -269,6 +588,10 @@ if len(g.c.Web.AllowedOrigins) > 0 {
 	apirouter.Handle("/projects/{projectref}/variables/{variablename}", authForcedHandler(deleteVariableHandler)).Methods("DELETE")
 
 	apirouter.Handle("/user", authForcedHandler(currentUserHandler)).Methods("GET")
+	apirouter.Handle("/user/token", authForcedHandler(currentUserTokenHandler)).Methods("GET")
+	apirouter.Handle("/user/notifications", authForcedHandler(userNotificationsHandler)).Methods("GET")
+	apirouter.Handle("/user/notifications/unreadcount", authForcedHandler(userNotificationsUnreadCountHandler)).Methods("GET")
+	apirouter.Handle("/user/notifications/read", authForcedHandler(markUserNotificationsReadHandler)).Methods("PUT")
 	apirouter.Handle("/users/{userref}", authForcedHandler(userHandler)).Methods("GET")
 	apirouter.Handle("/users", authForcedHandler(usersHandler)).Methods("GET")
 	apirouter.Handle("/users", authForcedHandler(createUserHandler)).Methods("POST")
@@ -279,12 +602,42 @@ if len(g.c.Web.AllowedOrigins) > 0 {
 	apirouter.Handle("/users/{userref}/linkedaccounts/{laid}", authForcedHandler(deleteUserLAHandler)).Methods("DELETE")
 	apirouter.Handle("/users/{userref}/tokens", authForcedHandler(createUserTokenHandler)).Methods("POST")
 	apirouter.Handle("/users/{userref}/tokens/{tokenname}", authForcedHandler(deleteUserTokenHandler)).Methods("DELETE")
+	apirouter.Handle("/users/{userref}/sessions", authForcedHandler(userSessionsHandler)).Methods("GET")
+	apirouter.Handle("/users/{userref}/sessions", authForcedHandler(deleteUserSessionsHandler)).Methods("DELETE")
+	apirouter.Handle("/users/{userref}/sessions/{sessionid}", authForcedHandler(deleteUserSessionHandler)).Methods("DELETE")
+	apirouter.Handle("/users/{userref}/totp", authForcedHandler(enrollUserTOTPHandler)).Methods("POST")
+	apirouter.Handle("/users/{userref}/totp", authForcedHandler(enableUserTOTPHandler)).Methods("PUT")
+	apirouter.Handle("/users/{userref}/totp", authForcedHandler(disableUserTOTPHandler)).Methods("DELETE")
+	apirouter.Handle("/users/{userref}/emailnotifications", authForcedHandler(userEmailNotificationsHandler)).Methods("GET")
+	apirouter.Handle("/users/{userref}/emailnotifications", authForcedHandler(updateUserEmailNotificationsHandler)).Methods("PUT")
+	apirouter.Handle("/users/{userref}/emailnotifications", authForcedHandler(deleteUserEmailNotificationsHandler)).Methods("DELETE")
 
 	apirouter.Handle("/remotesources/{remotesourceref}", authForcedHandler(remoteSourceHandler)).Methods("GET")
 	apirouter.Handle("/remotesources", authForcedHandler(createRemoteSourceHandler)).Methods("POST")
 	apirouter.Handle("/remotesources/{remotesourceref}", authForcedHandler(updateRemoteSourceHandler)).Methods("PUT")
 	apirouter.Handle("/remotesources", authOptionalHandler(remoteSourcesHandler)).Methods("GET")
 	apirouter.Handle("/remotesources/{remotesourceref}", authForcedHandler(deleteRemoteSourceHandler)).Methods("DELETE")
+	apirouter.Handle("/remotesources/{remotesourceref}/check", authForcedHandler(checkRemoteSourceHandler)).Methods("POST")
+	apirouter.Handle("/remotesources/{remotesourceref}/oauth2secret", authForcedHandler(rotateRemoteSourceSecretHandler)).Methods("PUT")
+	apirouter.Handle("/remotesources/{remotesourceref}/migrate", authForcedHandler(migrateRemoteSourceHandler)).Methods("POST")
+
+	apirouter.Handle("/admin/wals", authForcedHandler(walsHandler)).Methods("GET")
+	apirouter.Handle("/admin/history/{datatype}/{id}", authForcedHandler(objectHistoryHandler)).Methods("GET")
+	apirouter.Handle("/admin/history/{datatype}/{id}/restore", authForcedHandler(restoreObjectHandler)).Methods("POST")
+
+	apirouter.Handle("/admin/executors", authForcedHandler(executorsHandler)).Methods("GET")
+	apirouter.Handle("/admin/executors/{executorid}/approve", authForcedHandler(approveExecutorHandler)).Methods("POST")
+	apirouter.Handle("/admin/executors/{executorid}", authForcedHandler(deleteExecutorHandler)).Methods("DELETE")
+
+	apirouter.Handle("/admin/maintenance", authForcedHandler(maintenanceHandler)).Methods("GET")
+	apirouter.Handle("/admin/maintenance", authForcedHandler(enableMaintenanceHandler)).Methods("PUT")
+	apirouter.Handle("/admin/maintenance", authForcedHandler(disableMaintenanceHandler)).Methods("DELETE")
+
+	apirouter.Handle("/admin/failedwebhooks", authForcedHandler(failedWebhooksHandler)).Methods("GET")
+	apirouter.Handle("/admin/failedwebhooks/{webhookid}/replay", authForcedHandler(replayFailedWebhookHandler)).Methods("POST")
+	apirouter.Handle("/admin/failedwebhooks/{webhookid}", authForcedHandler(deleteFailedWebhookHandler)).Methods("DELETE")
+
+	apirouter.Handle("/config/validate", authForcedHandler(validateConfigHandler)).Methods("POST")
 
 	apirouter.Handle("/orgs/{orgref}", authForcedHandler(orgHandler)).Methods("GET")
 	apirouter.Handle("/orgs", authForcedHandler(orgsHandler)).Methods("GET")
@@ -296,13 +649,25 @@ if len(g.c.Web.AllowedOrigins) > 0 {
 
 	apirouter.Handle("/runs/{runid}", authOptionalHandler(runHandler)).Methods("GET")
 	apirouter.Handle("/runs/{runid}/actions", authForcedHandler(runActionsHandler)).Methods("PUT")
+	apirouter.Handle("/runs/{runid}/debug", authForcedHandler(debugRunHandler)).Methods("POST")
+	apirouter.Handle("/runs/{runid}/gantt", authOptionalHandler(runGanttHandler)).Methods("GET")
+	apirouter.Handle("/runs/{runid}/coverage", authOptionalHandler(runCoverageHandler)).Methods("GET")
+	apirouter.Handle("/runs/{runid}/config", authOptionalHandler(runConfigHandler)).Methods("GET")
+	apirouter.Handle("/runs/{runid}/logs.tar.gz", authOptionalHandler(runLogsArchiveHandler)).Methods("GET")
 	apirouter.Handle("/runs/{runid}/tasks/{taskid}", authOptionalHandler(runtaskHandler)).Methods("GET")
+	apirouter.Handle("/runs/{runid}/tasks/{taskid}/testresults", authOptionalHandler(runTaskTestResultsHandler)).Methods("GET")
 	apirouter.Handle("/runs/{runid}/tasks/{taskid}/actions", authForcedHandler(runTaskActionsHandler)).Methods("PUT")
+	apirouter.Handle("/runs/{runid}/tasks/{taskid}/exec", authForcedHandler(runTaskExecHandler)).Methods("GET")
 	apirouter.Handle("/runs", authForcedHandler(runsHandler)).Methods("GET")
 
 	apirouter.Handle("/user/remoterepos/{remotesourceref}", authForcedHandler(userRemoteReposHandler)).Methods("GET")
 
+	apirouter.Handle("/bulk/runs/cancel", authForcedHandler(cancelRunsHandler)).Methods("POST")
+	apirouter.Handle("/bulk/projects/delete", authForcedHandler(deleteProjectsHandler)).Methods("POST")
+	apirouter.Handle("/bulk/projectgroups/{projectgroupref}/visibility", authForcedHandler(updateProjectGroupVisibilityHandler)).Methods("PUT")
+
 	apirouter.Handle("/badges/{projectref}", badgeHandler).Methods("GET")
+	apirouter.Handle("/badges/{projectref}/coverage", coverageBadgeHandler).Methods("GET")
 
 	// TODO(sgotti) add auth to these requests
 	reposRouter.Handle("/repos/{rest:.*}", reposHandler).Methods("GET", "POST")
@@ -311,9 +676,12 @@ if len(g.c.Web.AllowedOrigins) > 0 {
 	router.Handle("/api/authorize", authorizeHandler).Methods("POST")
 	router.Handle("/api/register", registerHandler).Methods("POST")
 	router.Handle("/api/oauth2/callback", oauth2callbackHandler).Methods("GET")
+	router.Handle("/api/saml/metadata", samlMetadataHandler).Methods("GET")
+	router.Handle("/api/saml/login", samlLoginHandler).Methods("GET")
+	router.Handle("/api/saml/acs", samlACSHandler).Methods("POST")
 
 	router.Handle("/webhooks", webhooksHandler).Methods("POST")
-	router.PathPrefix("/").HandlerFunc(handlers.NewWebBundleHandlerFunc(g.c.APIExposedURL))
+	router.PathPrefix("/").HandlerFunc(handlers.NewWebBundleHandlerFunc(logger, g.configstoreClient, g.c.APIExposedURL, g.c.PathPrefix, g.c.WebDir))
 
 	maxBytesHandler := handlers.NewMaxBytesHandler(router, maxRequestSize)
 
@@ -321,25 +689,61 @@ if len(g.c.Web.AllowedOrigins) > 0 {
 	mainrouter.PathPrefix("/repos/").Handler(corsHandler(reposRouter))
 	mainrouter.PathPrefix("/").Handler(corsHandler(maxBytesHandler))
 
+	networkPolicyHandler, err := handlers.NewNetworkPolicyHandler(logger, &g.c.NetworkPolicy, mainrouter)
+	if err != nil {
+		return err
+	}
+
+	var handler http.Handler = networkPolicyHandler
+	if g.c.PathPrefix != "" {
+		handler = handlers.NewPathPrefixHandler(handler, g.c.PathPrefix)
+	}
+
+	go g.queuedWebhooksReplayerLoop(ctx, webhooksHandler.ReplayQueuedWebhooks)
+	if len(g.c.OrgSync.Orgs) > 0 && g.c.OrgSync.Interval > 0 {
+		go g.orgSyncLoop(ctx, g.c.OrgSync.Interval)
+	}
+	go g.projectsPollingLoop(ctx)
+	go g.projectSchedulesLoop(ctx)
+	go g.trashPurgeLoop(ctx)
+	go g.accessUsageFlushLoop(ctx, accessUsageRecorder)
+	if g.c.RefCacheTTL > 0 {
+		go g.refCacheWatchLoop(ctx)
+	}
+
 	var tlsConfig *tls.Config
 	if g.c.Web.TLS {
-		var err error
-		tlsConfig, err = util.NewTLSConfig(g.c.Web.TLSCertFile, g.c.Web.TLSKeyFile, "", false)
+		tlsConfig, err = scommon.NewWebTLSConfig(ctx, logger, &g.c.Web)
 		if err != nil {
 			log.Errorf("err: %+v")
 			return err
 		}
 	}
 
+	listener, err := net.Listen("tcp", g.c.Web.ListenAddress)
+	if err != nil {
+		return err
+	}
+	if g.c.NetworkPolicy.ProxyProtocol {
+		trustedProxies, err := util.ParseCIDRs(g.c.NetworkPolicy.TrustedProxies)
+		if err != nil {
+			return err
+		}
+		listener = util.NewProxyProtocolListener(listener, trustedProxies)
+	}
+
 	httpServer := http.Server{
-		Addr:      g.c.Web.ListenAddress,
-		Handler:   mainrouter,
+		Handler:   handler,
 		TLSConfig: tlsConfig,
 	}
 
 	lerrCh := make(chan error)
 	go func() {
-		lerrCh <- httpServer.ListenAndServe()
+		if tlsConfig != nil {
+			lerrCh <- httpServer.ServeTLS(listener, "", "")
+		} else {
+			lerrCh <- httpServer.Serve(listener)
+		}
 	}()
 
 	select {
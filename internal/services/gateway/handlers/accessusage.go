@@ -0,0 +1,83 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	csapi "agola.io/agola/internal/services/configstore/api"
+
+	"go.uber.org/zap"
+)
+
+// AccessUsageRecorder collects the last used time and source address of the
+// user sessions and tokens. They are saved by Flush with a single configstore
+// update per user instead of updating the user on every request.
+type AccessUsageRecorder struct {
+	log *zap.SugaredLogger
+
+	configstoreClient *csapi.Client
+
+	mu      sync.Mutex
+	pending map[string]*csapi.UpdateUserAccessUsageRequest
+}
+
+func NewAccessUsageRecorder(logger *zap.Logger, configstoreClient *csapi.Client) *AccessUsageRecorder {
+	return &AccessUsageRecorder{
+		log:               logger.Sugar(),
+		configstoreClient: configstoreClient,
+		pending:           make(map[string]*csapi.UpdateUserAccessUsageRequest),
+	}
+}
+
+// record records the usage of a user session or token (only one of sessionID
+// or tokenName must be provided)
+func (r *AccessUsageRecorder) record(userID, sessionID, tokenName string, lastUsedAt time.Time, lastUsedIP string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	req, ok := r.pending[userID]
+	if !ok {
+		req = &csapi.UpdateUserAccessUsageRequest{
+			Sessions: map[string]*csapi.AccessUsage{},
+			Tokens:   map[string]*csapi.AccessUsage{},
+		}
+		r.pending[userID] = req
+	}
+
+	u := &csapi.AccessUsage{LastUsedAt: lastUsedAt, LastUsedIP: lastUsedIP}
+	if sessionID != "" {
+		req.Sessions[sessionID] = u
+	} else {
+		req.Tokens[tokenName] = u
+	}
+}
+
+// Flush saves the recorded usages. The usages that cannot be saved are
+// logged and discarded.
+func (r *AccessUsageRecorder) Flush(ctx context.Context) {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = make(map[string]*csapi.UpdateUserAccessUsageRequest)
+	r.mu.Unlock()
+
+	for userID, req := range pending {
+		if _, err := r.configstoreClient.UpdateUserAccessUsage(ctx, userID, req); err != nil {
+			r.log.Errorf("failed to update user %q access usage: %+v", userID, err)
+		}
+	}
+}
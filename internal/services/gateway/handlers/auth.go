@@ -18,9 +18,11 @@ import (
 	"context"
 	"net/http"
 	"strings"
+	"time"
 
 	"agola.io/agola/internal/services/common"
 	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/types"
 
 	jwt "github.com/dgrijalva/jwt-go"
 	jwtrequest "github.com/dgrijalva/jwt-go/request"
@@ -28,6 +30,18 @@ import (
 	errors "golang.org/x/xerrors"
 )
 
+// OTPHeader is the request header containing the two factor authentication
+// code required by the sensitive operations
+const OTPHeader = "X-Agola-OTP"
+
+// accessUsageUpdateInterval is the minimum interval between the updates of
+// the last used time of a user session or token
+const accessUsageUpdateInterval = 1 * time.Minute
+
+// AccessUsageFlushInterval is the interval between the saves of the recorded
+// sessions and tokens usages
+const AccessUsageFlushInterval = accessUsageUpdateInterval
+
 type AuthHandler struct {
 	log  *zap.SugaredLogger
 	next http.Handler
@@ -37,10 +51,12 @@ type AuthHandler struct {
 
 	sd *common.TokenSigningData
 
+	accessUsage *AccessUsageRecorder
+
 	required bool
 }
 
-func NewAuthHandler(logger *zap.Logger, configstoreClient *csapi.Client, adminToken string, sd *common.TokenSigningData, required bool) func(http.Handler) http.Handler {
+func NewAuthHandler(logger *zap.Logger, configstoreClient *csapi.Client, adminToken string, sd *common.TokenSigningData, accessUsage *AccessUsageRecorder, required bool) func(http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
 		return &AuthHandler{
 			log:               logger.Sugar(),
@@ -48,6 +64,7 @@ func NewAuthHandler(logger *zap.Logger, configstoreClient *csapi.Client, adminTo
 			configstoreClient: configstoreClient,
 			adminToken:        adminToken,
 			sd:                sd,
+			accessUsage:       accessUsage,
 			required:          required,
 		}
 	}
@@ -59,6 +76,10 @@ func (h *AuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	tokenString, _ := TokenExtractor.ExtractToken(r)
 	if h.adminToken != "" && tokenString != "" {
 		if tokenString == h.adminToken {
+			if !adminAllowed(ctx) {
+				http.Error(w, "", http.StatusForbidden)
+				return
+			}
 			ctx = context.WithValue(ctx, "admin", true)
 			h.next.ServeHTTP(w, r.WithContext(ctx))
 			return
@@ -73,11 +94,39 @@ func (h *AuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
+			var tokenName string
+			for name, value := range user.Tokens {
+				if value == tokenString {
+					tokenName = name
+					break
+				}
+			}
+			tokenInfo := user.TokensInfo[tokenName]
+			if tokenInfo.IsExpired(time.Now()) {
+				http.Error(w, "token expired", http.StatusUnauthorized)
+				return
+			}
+			if !tokenInfo.HasScope(requiredTokenScope(r)) {
+				http.Error(w, "token scopes don't permit this request", http.StatusForbidden)
+				return
+			}
+			var lastUsedAt time.Time
+			var lastUsedIP string
+			if tokenInfo != nil {
+				lastUsedAt = tokenInfo.LastUsedAt
+				lastUsedIP = tokenInfo.LastUsedIP
+			}
+			h.recordAccessUsage(ctx, user.ID, "", tokenName, lastUsedAt, lastUsedIP)
+
 			// pass userid to handlers via context
 			ctx = context.WithValue(ctx, "userid", user.ID)
 			ctx = context.WithValue(ctx, "username", user.Name)
+			ctx = context.WithValue(ctx, "tokenname", tokenName)
+			ctx = context.WithValue(ctx, "otp", r.Header.Get(OTPHeader))
 
-			if user.Admin {
+			// admin users outside the allowed addresses or using a token
+			// without the admin scope are handled as normal users
+			if user.Admin && adminAllowed(ctx) && tokenInfo.HasScope(types.TokenScopeAdmin) {
 				ctx = context.WithValue(ctx, "admin", true)
 			}
 
@@ -127,11 +176,26 @@ func (h *AuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		// the login token is valid only while its session exists. Login tokens
+		// generated before the introduction of the sessions don't have a
+		// session id and are accepted until they expire.
+		sessionID, _ := claims["sid"].(string)
+		if sessionID != "" {
+			session, ok := user.Sessions[sessionID]
+			if !ok || session.IsExpired(time.Now()) {
+				http.Error(w, "", http.StatusUnauthorized)
+				return
+			}
+			h.recordAccessUsage(ctx, user.ID, sessionID, "", session.LastUsedAt, session.LastUsedIP)
+		}
+
 		// pass userid and username to handlers via context
 		ctx = context.WithValue(ctx, "userid", user.ID)
 		ctx = context.WithValue(ctx, "username", user.Name)
+		ctx = context.WithValue(ctx, "sessionid", sessionID)
+		ctx = context.WithValue(ctx, "otp", r.Header.Get(OTPHeader))
 
-		if user.Admin {
+		if user.Admin && adminAllowed(ctx) {
 			ctx = context.WithValue(ctx, "admin", true)
 		}
 
@@ -147,6 +211,22 @@ func (h *AuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.next.ServeHTTP(w, r.WithContext(ctx))
 }
 
+// recordAccessUsage records the last used time and source address of a user
+// session or token. They are recorded only when the source address changes or
+// after accessUsageUpdateInterval and saved in batch by the AccessUsageRecorder.
+func (h *AuthHandler) recordAccessUsage(ctx context.Context, userID, sessionID, tokenName string, lastUsedAt time.Time, lastUsedIP string) {
+	if h.accessUsage == nil {
+		return
+	}
+	now := time.Now()
+	ip, _ := ctx.Value("clientip").(string)
+	if ip == lastUsedIP && now.Sub(lastUsedAt) < accessUsageUpdateInterval {
+		return
+	}
+
+	h.accessUsage.record(userID, sessionID, tokenName, now, ip)
+}
+
 func stripPrefixFromTokenString(prefix string) func(tok string) (string, error) {
 	return func(tok string) (string, error) {
 		pl := len(prefix)
@@ -0,0 +1,247 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	slog "agola.io/agola/internal/log"
+	"agola.io/agola/internal/services/common"
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/types"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// testConfigstore is a fake configstore serving the provided users and
+// recording the access usage updates
+type testConfigstore struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	users  map[string]*types.User
+	usages map[string][]*csapi.UpdateUserAccessUsageRequest
+}
+
+func newTestConfigstore(t *testing.T, users ...*types.User) *testConfigstore {
+	cs := &testConfigstore{
+		users:  map[string]*types.User{},
+		usages: map[string][]*csapi.UpdateUserAccessUsageRequest{},
+	}
+	for _, u := range users {
+		cs.users[u.ID] = u
+	}
+
+	writeJSON := func(w http.ResponseWriter, v interface{}) {
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1alpha/users", func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		for _, u := range cs.users {
+			for _, v := range u.Tokens {
+				if v == token {
+					writeJSON(w, []*types.User{u})
+					return
+				}
+			}
+		}
+		writeJSON(w, []*types.User{})
+	}).Methods("GET")
+	router.HandleFunc("/api/v1alpha/users/{userref}", func(w http.ResponseWriter, r *http.Request) {
+		u, ok := cs.users[mux.Vars(r)["userref"]]
+		if !ok {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, u)
+	}).Methods("GET")
+	router.HandleFunc("/api/v1alpha/users/{userref}/usage", func(w http.ResponseWriter, r *http.Request) {
+		var req *csapi.UpdateUserAccessUsageRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+		cs.mu.Lock()
+		defer cs.mu.Unlock()
+		userID := mux.Vars(r)["userref"]
+		cs.usages[userID] = append(cs.usages[userID], req)
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods("PUT")
+
+	cs.Server = httptest.NewServer(router)
+	return cs
+}
+
+func testSigningData() *common.TokenSigningData {
+	return &common.TokenSigningData{
+		Duration: 1 * time.Hour,
+		Method:   jwt.SigningMethodHS256,
+		Key:      []byte("testkey"),
+	}
+}
+
+// serveAuth serves the request with the provided auth handler returning the
+// response status code and the user id set in the request context
+func serveAuth(authHandler func(http.Handler) http.Handler, r *http.Request) (int, string) {
+	var userID string
+	h := authHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ = r.Context().Value("userid").(string)
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code, userID
+}
+
+func TestAuthHandlerLoginToken(t *testing.T) {
+	now := time.Now()
+	user := &types.User{
+		ID:   "user01",
+		Name: "user01",
+		Sessions: map[string]*types.UserSession{
+			"session01": {CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+			"session02": {CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)},
+		},
+	}
+	cs := newTestConfigstore(t, user)
+	defer cs.Close()
+
+	sd := testSigningData()
+	logger := slog.New(zap.NewAtomicLevelAt(zap.ErrorLevel))
+	authHandler := NewAuthHandler(logger, csapi.NewClient(cs.URL), "", sd, nil, true)
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		code   int
+	}{
+		{
+			name:   "valid session",
+			claims: jwt.MapClaims{"sub": "user01", "sid": "session01", "exp": now.Add(time.Hour).Unix()},
+			code:   http.StatusOK,
+		},
+		{
+			name:   "expired session",
+			claims: jwt.MapClaims{"sub": "user01", "sid": "session02", "exp": now.Add(time.Hour).Unix()},
+			code:   http.StatusUnauthorized,
+		},
+		{
+			name:   "removed session",
+			claims: jwt.MapClaims{"sub": "user01", "sid": "session03", "exp": now.Add(time.Hour).Unix()},
+			code:   http.StatusUnauthorized,
+		},
+		{
+			name:   "token without session",
+			claims: jwt.MapClaims{"sub": "user01", "exp": now.Add(time.Hour).Unix()},
+			code:   http.StatusOK,
+		},
+		{
+			name:   "expired token without session",
+			claims: jwt.MapClaims{"sub": "user01", "exp": now.Add(-time.Hour).Unix()},
+			code:   http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := common.GenerateGenericJWTToken(sd, tt.claims)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			r := httptest.NewRequest("GET", "/api/v1alpha/user", nil)
+			r.Header.Set("Authorization", "bearer "+token)
+
+			code, userID := serveAuth(authHandler, r)
+			if code != tt.code {
+				t.Fatalf("expected status code %d, got %d", tt.code, code)
+			}
+			if code == http.StatusOK && userID != "user01" {
+				t.Fatalf("expected user id %q, got %q", "user01", userID)
+			}
+		})
+	}
+}
+
+func TestAccessUsageRecorder(t *testing.T) {
+	now := time.Now()
+	user := &types.User{
+		ID:     "user01",
+		Name:   "user01",
+		Tokens: map[string]string{"token01": "tokenvalue01"},
+		Sessions: map[string]*types.UserSession{
+			"session01": {CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+		},
+	}
+	cs := newTestConfigstore(t, user)
+	defer cs.Close()
+
+	sd := testSigningData()
+	logger := slog.New(zap.NewAtomicLevelAt(zap.ErrorLevel))
+	recorder := NewAccessUsageRecorder(logger, csapi.NewClient(cs.URL))
+	authHandler := NewAuthHandler(logger, csapi.NewClient(cs.URL), "admintoken", sd, recorder, true)
+
+	loginToken, err := common.GenerateLoginJWTToken(sd, "user01", "session01")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		r := httptest.NewRequest("GET", "/api/v1alpha/user", nil)
+		r.Header.Set("Authorization", "bearer "+loginToken)
+		if code, _ := serveAuth(authHandler, r); code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, code)
+		}
+
+		r = httptest.NewRequest("GET", "/api/v1alpha/user", nil)
+		r.Header.Set("Authorization", "token tokenvalue01")
+		if code, _ := serveAuth(authHandler, r); code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, code)
+		}
+	}
+
+	if len(cs.usages) != 0 {
+		t.Fatalf("expected no access usage updates before flush, got %d", len(cs.usages))
+	}
+
+	recorder.Flush(context.Background())
+
+	usages := cs.usages["user01"]
+	if len(usages) != 1 {
+		t.Fatalf("expected 1 access usage update, got %d", len(usages))
+	}
+	if _, ok := usages[0].Sessions["session01"]; !ok {
+		t.Fatalf("expected session %q usage", "session01")
+	}
+	if _, ok := usages[0].Tokens["token01"]; !ok {
+		t.Fatalf("expected token %q usage", "token01")
+	}
+
+	// nothing to save
+	recorder.Flush(context.Background())
+	if len(cs.usages["user01"]) != 1 {
+		t.Fatalf("expected 1 access usage update, got %d", len(cs.usages["user01"]))
+	}
+}
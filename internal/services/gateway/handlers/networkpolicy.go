@@ -0,0 +1,137 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"agola.io/agola/internal/services/config"
+	"agola.io/agola/internal/util"
+
+	"go.uber.org/zap"
+)
+
+// NetworkPolicyHandler restricts the source addresses allowed to call the
+// gateway endpoints. The client address is taken from the X-Forwarded-For
+// header only when the request comes from a trusted proxy.
+type NetworkPolicyHandler struct {
+	log  *zap.SugaredLogger
+	next http.Handler
+
+	trustedProxies []*net.IPNet
+	webhooks       []*net.IPNet
+	api            []*net.IPNet
+	admin          []*net.IPNet
+}
+
+func NewNetworkPolicyHandler(logger *zap.Logger, np *config.GatewayNetworkPolicy, h http.Handler) (*NetworkPolicyHandler, error) {
+	trustedProxies, err := util.ParseCIDRs(np.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	webhooks, err := util.ParseCIDRs(np.WebhooksAllowedCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	api, err := util.ParseCIDRs(np.APIAllowedCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	admin, err := util.ParseCIDRs(np.AdminAllowedCIDRs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NetworkPolicyHandler{
+		log:            logger.Sugar(),
+		next:           h,
+		trustedProxies: trustedProxies,
+		webhooks:       webhooks,
+		api:            api,
+		admin:          admin,
+	}, nil
+}
+
+func (h *NetworkPolicyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	ip := h.clientIP(r)
+
+	var allowed []*net.IPNet
+	switch {
+	case r.URL.Path == "/webhooks":
+		allowed = h.webhooks
+	case strings.HasPrefix(r.URL.Path, "/api/"), strings.HasPrefix(r.URL.Path, "/repos/"):
+		allowed = h.api
+	}
+	if len(allowed) > 0 && (ip == nil || !util.IPInNets(ip, allowed)) {
+		h.log.Infof("request to %q from %q not allowed by the network policy", r.URL.Path, ip)
+		http.Error(w, "", http.StatusForbidden)
+		return
+	}
+
+	if ip != nil {
+		ctx = context.WithValue(ctx, "clientip", ip.String())
+	}
+
+	if len(h.admin) > 0 {
+		// the auth handler will check it when the request is authenticated
+		// as an admin
+		ctx = context.WithValue(ctx, "adminallowed", ip != nil && util.IPInNets(ip, h.admin))
+	}
+
+	h.next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// clientIP returns the request client address. When the request comes from a
+// trusted proxy the X-Forwarded-For header is walked from the right skipping
+// the trusted proxies addresses.
+func (h *NetworkPolicyHandler) clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !util.IPInNets(ip, h.trustedProxies) {
+		return ip
+	}
+
+	var addrs []string
+	for _, v := range r.Header["X-Forwarded-For"] {
+		addrs = append(addrs, strings.Split(v, ",")...)
+	}
+	for i := len(addrs) - 1; i >= 0; i-- {
+		xip := net.ParseIP(strings.TrimSpace(addrs[i]))
+		if xip == nil {
+			break
+		}
+		ip = xip
+		if !util.IPInNets(ip, h.trustedProxies) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// adminAllowed reports whether the admin requests are allowed from the request
+// source address
+func adminAllowed(ctx context.Context) bool {
+	allowed, ok := ctx.Value("adminallowed").(bool)
+	return !ok || allowed
+}
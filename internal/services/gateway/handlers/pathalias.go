@@ -0,0 +1,163 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	cscommon "agola.io/agola/internal/services/configstore/common"
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+// CanonicalPathHeader is the response header containing the current path of
+// a project or project group referenced by an old path
+const CanonicalPathHeader = "X-Agola-Canonical-Path"
+
+// pathAliasVars are the route variables containing a project, project group
+// or user ref
+var pathAliasVars = map[string]types.ConfigType{
+	"projectref":      types.ConfigTypeProject,
+	"projectgroupref": types.ConfigTypeProjectGroup,
+	"userref":         types.ConfigTypeUser,
+}
+
+// PathAliasHandler replaces the projects and project groups paths and the
+// users names refs with the object IDs, resolved using the gateway ref cache,
+// so the configstore doesn't resolve them again for every request.
+// The refs to renamed projects and project groups using their old paths are
+// also resolved. The successful responses of these requests have a
+// Deprecation header and the current path in the CanonicalPathHeader header.
+// The error responses don't have them to not disclose the current path to
+// unauthorized users.
+type PathAliasHandler struct {
+	log  *zap.SugaredLogger
+	next http.Handler
+
+	ah *action.ActionHandler
+}
+
+func NewPathAliasHandler(logger *zap.Logger, ah *action.ActionHandler) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return &PathAliasHandler{
+			log:  logger.Sugar(),
+			next: h,
+			ah:   ah,
+		}
+	}
+}
+
+func (h *PathAliasHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	vars := mux.Vars(r)
+	var newVars map[string]string
+	var canonicalPath string
+	for name, objectType := range pathAliasVars {
+		v, ok := vars[name]
+		if !ok {
+			continue
+		}
+		ref, err := url.PathUnescape(v)
+		if err != nil {
+			// the handler will report the error
+			continue
+		}
+		if isIDRef(objectType, ref) {
+			continue
+		}
+
+		rr, err := h.ah.ResolveRef(ctx, objectType, ref)
+		if err != nil {
+			// the handler will report the error
+			if !errors.Is(err, &util.ErrNotFound{}) {
+				h.log.Errorf("failed to resolve %s ref %q: %+v", objectType, ref, err)
+			}
+			continue
+		}
+
+		if newVars == nil {
+			newVars = make(map[string]string, len(vars))
+			for k, v := range vars {
+				newVars[k] = v
+			}
+		}
+		newVars[name] = rr.ID
+		if rr.Aliased {
+			canonicalPath = rr.Path
+		}
+	}
+
+	if newVars != nil {
+		r = mux.SetURLVars(r, newVars)
+	}
+	if canonicalPath != "" {
+		w = &pathAliasResponseWriter{ResponseWriter: w, canonicalPath: canonicalPath}
+	}
+
+	h.next.ServeHTTP(w, r)
+}
+
+// isIDRef reports if the ref is already an object ID. The projects and
+// project groups refs are IDs or paths while the users refs are IDs or names.
+func isIDRef(objectType types.ConfigType, ref string) bool {
+	switch objectType {
+	case types.ConfigTypeUser:
+		refType, err := cscommon.ParseNameRef(ref)
+		return err != nil || refType == cscommon.RefTypeID
+	default:
+		return !strings.Contains(ref, "/")
+	}
+}
+
+// pathAliasResponseWriter adds the path alias headers to the successful
+// responses
+type pathAliasResponseWriter struct {
+	http.ResponseWriter
+
+	canonicalPath string
+	wroteHeader   bool
+}
+
+func (w *pathAliasResponseWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if code < http.StatusBadRequest {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set(CanonicalPathHeader, w.canonicalPath)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *pathAliasResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *pathAliasResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
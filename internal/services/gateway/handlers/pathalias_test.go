@@ -0,0 +1,106 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	slog "agola.io/agola/internal/log"
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/services/types"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+func TestPathAliasHandler(t *testing.T) {
+	writeJSON := func(w http.ResponseWriter, v interface{}) {
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+	}
+
+	csRouter := mux.NewRouter()
+	csRouter.HandleFunc("/api/v1alpha/pathaliases/resolve", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("path") {
+		case "org/org01/project01":
+			writeJSON(w, &csapi.PathAliasResolution{ID: "projectid01", Path: "org/org01/project01"})
+		case "org/org01/oldproject01":
+			writeJSON(w, &csapi.PathAliasResolution{ID: "projectid01", Path: "org/org01/project01", Alias: &types.PathAlias{}})
+		default:
+			http.Error(w, "", http.StatusNotFound)
+		}
+	})
+	csRouter.HandleFunc("/api/v1alpha/users/{userref}", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["userref"] != "user01" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, &types.User{ID: "userid01", Name: "user01"})
+	})
+	cs := httptest.NewServer(csRouter)
+	defer cs.Close()
+
+	logger := slog.New(zap.NewAtomicLevelAt(zap.FatalLevel))
+	ah := action.NewActionHandler(logger, nil, csapi.NewClient(cs.URL), nil, "agola", "", "", nil, nil, nil, nil, nil, nil, nil, time.Hour)
+
+	var gotRef string
+	router := mux.NewRouter().UseEncodedPath()
+	router.Use(NewPathAliasHandler(logger, ah))
+	refHandler := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			gotRef = mux.Vars(r)[name]
+			w.WriteHeader(http.StatusOK)
+		}
+	}
+	router.Handle("/projects/{projectref}", refHandler("projectref"))
+	router.Handle("/users/{userref}", refHandler("userref"))
+
+	tests := []struct {
+		name          string
+		url           string
+		ref           string
+		canonicalPath string
+	}{
+		{name: "project path", url: "/projects/org%2Forg01%2Fproject01", ref: "projectid01"},
+		{name: "project old path", url: "/projects/org%2Forg01%2Foldproject01", ref: "projectid01", canonicalPath: "org/org01/project01"},
+		{name: "project id", url: "/projects/projectid02", ref: "projectid02"},
+		{name: "not existing project", url: "/projects/org%2Forg01%2Fproject02", ref: "org%2Forg01%2Fproject02"},
+		{name: "user name", url: "/users/user01", ref: "userid01"},
+		{name: "user id", url: "/users/7b3e9d3a-1c6e-4f4f-9b1a-3c2d5e6f7a8b", ref: "7b3e9d3a-1c6e-4f4f-9b1a-3c2d5e6f7a8b"},
+		{name: "not existing user", url: "/users/user02", ref: "user02"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotRef = ""
+			r := httptest.NewRequest("GET", tt.url, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if gotRef != tt.ref {
+				t.Fatalf("expected ref %q, got %q", tt.ref, gotRef)
+			}
+			if cp := w.Header().Get(CanonicalPathHeader); cp != tt.canonicalPath {
+				t.Fatalf("expected canonical path %q, got %q", tt.canonicalPath, cp)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// pathPrefixHandler serves the requests under a path prefix removing it from
+// the request path. The requests outside the prefix are rejected.
+type pathPrefixHandler struct {
+	h      http.Handler
+	prefix string
+}
+
+func NewPathPrefixHandler(h http.Handler, prefix string) *pathPrefixHandler {
+	return &pathPrefixHandler{
+		h:      h,
+		prefix: strings.TrimSuffix(prefix, "/"),
+	}
+}
+
+func (h *pathPrefixHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == h.prefix {
+		http.Redirect(w, r, h.prefix+"/", http.StatusMovedPermanently)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, h.prefix+"/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = strings.TrimPrefix(r.URL.Path, h.prefix)
+	// the raw path could contain the prefix escaped differently so just drop
+	// it when it doesn't start with the prefix
+	if strings.HasPrefix(r.URL.RawPath, h.prefix+"/") {
+		r2.URL.RawPath = strings.TrimPrefix(r.URL.RawPath, h.prefix)
+	} else {
+		r2.URL.RawPath = ""
+	}
+	h.h.ServeHTTP(w, r2)
+}
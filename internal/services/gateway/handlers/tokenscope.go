@@ -0,0 +1,54 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"agola.io/agola/internal/services/types"
+
+	"github.com/gorilla/mux"
+)
+
+// requiredTokenScope returns the user token scope required to serve the
+// request
+func requiredTokenScope(r *http.Request) types.TokenScope {
+	path := r.URL.Path
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			path = tmpl
+		}
+	}
+
+	switch {
+	case strings.HasSuffix(path, "/exec"):
+		// executing commands inside a task container isn't a read only request
+		return types.TokenScopeAdmin
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return types.TokenScopeReadOnly
+	case strings.HasSuffix(path, "/createrun"),
+		strings.HasSuffix(path, "/runs/{runid}/actions"),
+		strings.HasSuffix(path, "/bulk/runs/cancel"),
+		strings.HasSuffix(path, "/runs/{runid}/debug"),
+		strings.HasSuffix(path, "/tasks/{taskid}/actions"):
+		return types.TokenScopeTriggerRuns
+	case strings.HasSuffix(path, "/secrets"),
+		strings.HasSuffix(path, "/secrets/{secretname}"):
+		return types.TokenScopeManageSecrets
+	}
+
+	return types.TokenScopeAdmin
+}
@@ -16,13 +16,18 @@ package handlers
 
 import (
 	"bytes"
+	"encoding/json"
 	"net/http"
+	"os"
+	"path"
 	"strings"
 	"text/template"
 
+	csapi "agola.io/agola/internal/services/configstore/api"
 	"agola.io/agola/webbundle"
 
 	assetfs "github.com/elazarl/go-bindata-assetfs"
+	"go.uber.org/zap"
 )
 
 // TODO(sgotti) now the test web ui directly calls the run api url, but this is
@@ -32,52 +37,75 @@ const configTplText = `
 const CONFIG = {
   API_URL: '{{.ApiURL}}',
   API_BASE_PATH: '{{.ApiBasePath}}',
+  BASE_PATH: '{{.BasePath}}',
+  AUTH_PROVIDERS: {{.AuthProviders}},
 }
 
 window.CONFIG = CONFIG
 `
 
-func NewWebBundleHandlerFunc(gatewayURL string) func(w http.ResponseWriter, r *http.Request) {
-	var buf bytes.Buffer
-	configTpl, err := template.New("config").Parse(configTplText)
-	if err != nil {
-		panic(err)
-	}
+var configTpl = template.Must(template.New("config").Parse(configTplText))
 
-	configTplData := struct {
-		ApiURL      string
-		ApiBasePath string
-	}{
-		gatewayURL,
-		"/api/v1alpha",
-	}
-	if err := configTpl.Execute(&buf, configTplData); err != nil {
-		panic(err)
-	}
+// webAuthProvider is a remote source that can be used to login from the web
+// interface
+type webAuthProvider struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	AuthType string `json:"auth_type"`
+}
 
-	config := buf.Bytes()
+// NewWebBundleHandlerFunc serves the web interface. The assets are read from
+// webDir when provided, otherwise the ones embedded in the binary are used.
+// basePath is the path prefix under which the gateway is served and it's
+// provided to the webapp to generate its links. The webapp configuration
+// (config.js) is generated at every request so it always contains the
+// current auth providers.
+func NewWebBundleHandlerFunc(logger *zap.Logger, configstoreClient *csapi.Client, gatewayURL, basePath, webDir string) func(w http.ResponseWriter, r *http.Request) {
+	log := logger.Sugar()
 
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Setup serving of bundled webapp from the root path, registered after api
-		// handlers or it'll match all the requested paths
-		fileServerHandler := http.FileServer(&assetfs.AssetFS{
+	var fs http.FileSystem
+	assetExists := func(name string) bool {
+		_, err := webbundle.Asset(name)
+		return err == nil
+	}
+	if webDir != "" {
+		fs = http.Dir(webDir)
+		assetExists = func(name string) bool {
+			fi, err := os.Stat(path.Join(webDir, path.Clean("/"+name)))
+			return err == nil && !fi.IsDir()
+		}
+	} else {
+		fs = &assetfs.AssetFS{
 			Asset:     webbundle.Asset,
 			AssetDir:  webbundle.AssetDir,
 			AssetInfo: webbundle.AssetInfo,
-		})
+		}
+	}
+
+	// Setup serving of the webapp from the root path, registered after api
+	// handlers or it'll match all the requested paths
+	fileServerHandler := http.FileServer(fs)
 
+	return func(w http.ResponseWriter, r *http.Request) {
 		// config.js is the external webapp config file not provided by the
 		// asset and not needed when served from the api server
 		if r.URL.Path == "/config.js" {
-			_, err := w.Write(config)
+			config, err := webConfig(r, configstoreClient, gatewayURL, basePath)
 			if err != nil {
+				log.Errorf("err: %+v", err)
+				http.Error(w, "", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/javascript")
+			w.Header().Set("Cache-Control", "no-cache")
+			if _, err := w.Write(config); err != nil {
 				http.Error(w, "", http.StatusInternalServerError)
 			}
 			return
 		}
 
 		// check if the required file is available in the webapp asset and serve it
-		if _, err := webbundle.Asset(r.URL.Path[1:]); err == nil {
+		if assetExists(r.URL.Path[1:]) {
 			fileServerHandler.ServeHTTP(w, r)
 			return
 		}
@@ -95,3 +123,45 @@ func NewWebBundleHandlerFunc(gatewayURL string) func(w http.ResponseWriter, r *h
 		fileServerHandler.ServeHTTP(w, r)
 	}
 }
+
+func webConfig(r *http.Request, configstoreClient *csapi.Client, gatewayURL, basePath string) ([]byte, error) {
+	remoteSources, _, err := configstoreClient.GetRemoteSources(r.Context(), "", 0, true)
+	if err != nil {
+		return nil, err
+	}
+	authProviders := []*webAuthProvider{}
+	for _, rs := range remoteSources {
+		if rs.LoginEnabled == nil || !*rs.LoginEnabled {
+			continue
+		}
+		authProviders = append(authProviders, &webAuthProvider{
+			Name:     rs.Name,
+			Type:     string(rs.Type),
+			AuthType: string(rs.AuthType),
+		})
+	}
+	// json encoding escapes the html characters so it's safe to embed it in
+	// the script
+	authProvidersj, err := json.Marshal(authProviders)
+	if err != nil {
+		return nil, err
+	}
+
+	configTplData := struct {
+		ApiURL        string
+		ApiBasePath   string
+		BasePath      string
+		AuthProviders string
+	}{
+		gatewayURL,
+		"/api/v1alpha",
+		basePath,
+		string(authProvidersj),
+	}
+
+	var buf bytes.Buffer
+	if err := configTpl.Execute(&buf, configTplData); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,170 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitserver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+// listRepos returns the absolute paths of the repositories inside reposDir
+func listRepos(reposDir string) ([]string, error) {
+	repos := []string{}
+	err := filepath.Walk(reposDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && strings.HasSuffix(path, gitSuffix) {
+			repos = append(repos, path)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return repos, nil
+	}
+	return repos, err
+}
+
+func (s *Gitserver) cleanupLoop(ctx context.Context) {
+	for {
+		if err := s.cleanup(ctx); err != nil {
+			log.Errorf("err: %+v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.c.CleanupInterval):
+		}
+	}
+}
+
+// cleanup prunes the stale refs of all the repositories and updates the
+// repositories metrics
+func (s *Gitserver) cleanup(ctx context.Context) error {
+	log.Debugf("cleanup")
+
+	repos, err := listRepos(s.c.DataDir)
+	if err != nil {
+		return errors.Errorf("failed to list repositories: %w", err)
+	}
+
+	now := time.Now()
+	var count int
+	var totalSize, maxSize int64
+	for _, repo := range repos {
+		if s.c.RefsMaxAge > 0 {
+			removed, err := s.pruneRepo(ctx, repo, now)
+			if err != nil {
+				log.Errorf("failed to prune repository %q: %+v", repo, err)
+			}
+			if removed {
+				continue
+			}
+		}
+
+		size, err := repoSize(repo)
+		if err != nil {
+			log.Errorf("failed to get repository %q size: %+v", repo, err)
+			continue
+		}
+		count++
+		totalSize += size
+		if size > maxSize {
+			maxSize = size
+		}
+	}
+
+	repositoriesGauge.Set(float64(count))
+	repositoriesSizeGauge.Set(float64(totalSize))
+	repositoryMaxSizeGauge.Set(float64(maxSize))
+
+	return nil
+}
+
+// pruneRepo removes the refs older than RefsMaxAge and their unreferenced
+// objects. When no refs are left (or the repository never had refs and is
+// older than RefsMaxAge) the repository is removed and true is returned.
+func (s *Gitserver) pruneRepo(ctx context.Context, repoAbsPath string, now time.Time) (bool, error) {
+	git := &util.Git{GitDir: repoAbsPath}
+
+	lines, err := git.OutputLines(ctx, nil, "for-each-ref", "--format=%(refname) %(creatordate:unix)")
+	if err != nil {
+		return false, errors.Errorf("failed to list refs: %w", err)
+	}
+
+	pruned := 0
+	for _, line := range lines {
+		parts := strings.Fields(line)
+		if len(parts) != 2 {
+			continue
+		}
+		refName := parts[0]
+		ts, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return false, errors.Errorf("failed to parse ref %q date: %w", refName, err)
+		}
+		if now.Sub(time.Unix(ts, 0)) <= s.c.RefsMaxAge {
+			continue
+		}
+
+		log.Debugf("removing stale ref %q of repository %q", refName, repoAbsPath)
+		if _, err := git.Output(ctx, nil, "update-ref", "-d", refName); err != nil {
+			return false, errors.Errorf("failed to remove ref %q: %w", refName, err)
+		}
+		prunedRefsCounter.Inc()
+		pruned++
+	}
+
+	empty := pruned == len(lines)
+	if len(lines) == 0 {
+		// a repository created but never pushed
+		fi, err := os.Stat(repoAbsPath)
+		if err != nil {
+			return false, err
+		}
+		empty = now.Sub(fi.ModTime()) > s.c.RefsMaxAge
+	}
+
+	if empty {
+		log.Infof("removing repository %q without refs", repoAbsPath)
+		if err := os.RemoveAll(repoAbsPath); err != nil {
+			return false, errors.Errorf("failed to remove repository: %w", err)
+		}
+		removedRepositoriesCounter.Inc()
+		return true, nil
+	}
+
+	if pruned > 0 {
+		// remove the objects not referenced anymore
+		if _, err := git.Output(ctx, nil, "reflog", "expire", "--expire=now", "--all"); err != nil {
+			return false, errors.Errorf("failed to expire reflog: %w", err)
+		}
+		if _, err := git.Output(ctx, nil, "gc", "--prune=now", "--quiet"); err != nil {
+			return false, errors.Errorf("failed to gc repository: %w", err)
+		}
+	}
+
+	return false, nil
+}
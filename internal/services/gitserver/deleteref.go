@@ -0,0 +1,76 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitserver
+
+import (
+	"net/http"
+	"regexp"
+
+	handlers "agola.io/agola/internal/git-handler"
+	"agola.io/agola/internal/util"
+)
+
+// DeleteRefRegExp matches the path used to delete a repository ref. It's
+// not proxied by the gateway and is used only by the internal services.
+var DeleteRefRegExp = regexp.MustCompile(`/(.+\.git)/(refs/.+)$`)
+
+// DeleteRefHandler removes a repository ref (i.e. the temporary branch of a
+// user direct run)
+type DeleteRefHandler struct {
+	reposDir string
+}
+
+func NewDeleteRefHandler(reposDir string) *DeleteRefHandler {
+	return &DeleteRefHandler{reposDir: reposDir}
+}
+
+func (h *DeleteRefHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	matches := DeleteRefRegExp.FindStringSubmatch(r.URL.Path)
+	if len(matches) != 3 {
+		http.Error(w, "wrong request path", http.StatusBadRequest)
+		return
+	}
+	repoPath, refName := matches[1], matches[2]
+
+	repoAbsPath, exists, err := repoAbsPath(h.reposDir, repoPath)
+	if err != nil {
+		if err == handlers.ErrWrongRepoPath {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "repository doesn't exist", http.StatusNotFound)
+		return
+	}
+
+	git := &util.Git{GitDir: repoAbsPath}
+	if _, err := git.Output(ctx, nil, "check-ref-format", refName); err != nil {
+		http.Error(w, "invalid ref name", http.StatusBadRequest)
+		return
+	}
+	if _, err := git.Output(ctx, nil, "update-ref", "-d", refName); err != nil {
+		log.Errorf("failed to delete ref %q of repository %q: %+v", refName, repoPath, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Debugf("deleted ref %q of repository %q", refName, repoPath)
+
+	w.WriteHeader(http.StatusNoContent)
+}
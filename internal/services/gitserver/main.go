@@ -23,12 +23,13 @@ import (
 	"regexp"
 	"strings"
 
+	scommon "agola.io/agola/internal/common"
 	handlers "agola.io/agola/internal/git-handler"
 	slog "agola.io/agola/internal/log"
 	"agola.io/agola/internal/services/config"
-	"agola.io/agola/internal/util"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	errors "golang.org/x/xerrors"
@@ -141,10 +142,16 @@ func NewGitserver(c *config.Gitserver) (*Gitserver, error) {
 }
 
 func (s *Gitserver) Run(ctx context.Context) error {
-	gitSmartHandler := handlers.NewGitSmartHandler(logger, s.c.DataDir, true, repoAbsPath, nil)
+	go s.cleanupLoop(ctx)
+
+	var gitSmartHandler http.Handler
+	gitSmartHandler = handlers.NewGitSmartHandler(logger, s.c.DataDir, true, repoAbsPath, nil)
+	gitSmartHandler = NewQuotaHandler(s.c.DataDir, s.c.RepositoryMaxSize, gitSmartHandler)
 	fetchFileHandler := handlers.NewFetchFileHandler(logger, s.c.DataDir, repoAbsPath)
 
 	router := mux.NewRouter()
+	router.Handle("/metrics", promhttp.Handler())
+	router.MatcherFunc(Matcher(DeleteRefRegExp)).Methods("DELETE").Handler(NewDeleteRefHandler(s.c.DataDir))
 	router.MatcherFunc(Matcher(handlers.InfoRefsRegExp)).Handler(gitSmartHandler)
 	router.MatcherFunc(Matcher(handlers.UploadPackRegExp)).Handler(gitSmartHandler)
 	router.MatcherFunc(Matcher(handlers.ReceivePackRegExp)).Handler(gitSmartHandler)
@@ -153,7 +160,7 @@ func (s *Gitserver) Run(ctx context.Context) error {
 	var tlsConfig *tls.Config
 	if s.c.Web.TLS {
 		var err error
-		tlsConfig, err = util.NewTLSConfig(s.c.Web.TLSCertFile, s.c.Web.TLSKeyFile, "", false)
+		tlsConfig, err = scommon.NewWebTLSConfig(ctx, logger, &s.c.Web)
 		if err != nil {
 			log.Errorf("err: %+v")
 			return err
@@ -168,7 +175,11 @@ func (s *Gitserver) Run(ctx context.Context) error {
 
 	lerrCh := make(chan error)
 	go func() {
-		lerrCh <- httpServer.ListenAndServe()
+		if tlsConfig != nil {
+			lerrCh <- httpServer.ListenAndServeTLS("", "")
+		} else {
+			lerrCh <- httpServer.ListenAndServe()
+		}
 	}()
 
 	select {
@@ -0,0 +1,55 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitserver
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	repositoriesGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "agola_gitserver_repositories",
+		Help: "Number of repositories",
+	})
+	repositoriesSizeGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "agola_gitserver_repositories_size_bytes",
+		Help: "Total size of the repositories",
+	})
+	repositoryMaxSizeGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "agola_gitserver_repository_max_size_bytes",
+		Help: "Size of the biggest repository",
+	})
+	prunedRefsCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "agola_gitserver_pruned_refs_total",
+		Help: "Number of stale refs removed",
+	})
+	removedRepositoriesCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "agola_gitserver_removed_repositories_total",
+		Help: "Number of repositories without refs removed",
+	})
+	rejectedPushesCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "agola_gitserver_rejected_pushes_total",
+		Help: "Number of pushes rejected since the repository exceeds the max size",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(repositoriesGauge)
+	prometheus.MustRegister(repositoriesSizeGauge)
+	prometheus.MustRegister(repositoryMaxSizeGauge)
+	prometheus.MustRegister(prunedRefsCounter)
+	prometheus.MustRegister(removedRepositoriesCounter)
+	prometheus.MustRegister(rejectedPushesCounter)
+}
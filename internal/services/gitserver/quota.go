@@ -0,0 +1,96 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitserver
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	handlers "agola.io/agola/internal/git-handler"
+)
+
+// repoSize returns the size in bytes of the files of a repository
+func repoSize(repoAbsPath string) (int64, error) {
+	var size int64
+	err := filepath.Walk(repoAbsPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// QuotaHandler rejects the pushes to the repositories exceeding the max size
+type QuotaHandler struct {
+	reposDir string
+	maxSize  int64
+	next     http.Handler
+}
+
+func NewQuotaHandler(reposDir string, maxSize int64, next http.Handler) *QuotaHandler {
+	return &QuotaHandler{
+		reposDir: reposDir,
+		maxSize:  maxSize,
+		next:     next,
+	}
+}
+
+func (h *QuotaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.maxSize <= 0 {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	repoPath, reqType, err := handlers.MatchPath(r.URL.Path)
+	if err != nil {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	// also check the refs advertisement before a push to report the error
+	// before the client sends the pack
+	isPush := reqType == handlers.RequestTypeReceivePack ||
+		(reqType == handlers.RequestTypeInfoRefs && r.URL.Query().Get("service") == "git-receive-pack")
+	if !isPush {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	repoAbsPath, exists, err := repoAbsPath(h.reposDir, repoPath)
+	if err != nil || !exists {
+		// let the git handler report the error or create the repository
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	size, err := repoSize(repoAbsPath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if size >= h.maxSize {
+		log.Infof("rejecting push to repository %q: size %d exceeds the max size %d", repoPath, size, h.maxSize)
+		rejectedPushesCounter.Inc()
+		http.Error(w, fmt.Sprintf("repository size %d bytes exceeds the max allowed size of %d bytes", size, h.maxSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	h.next.ServeHTTP(w, r)
+}
@@ -0,0 +1,95 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	gitsource "agola.io/agola/internal/gitsources"
+	"agola.io/agola/internal/services/gateway/action"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+// notifyApprovalExpiry notifies the approvers, using a commit status for every
+// approval task, when a task approval is nearing expiry and when its approval
+// timeout expired
+func (n *NotificationService) notifyApprovalExpiry(ctx context.Context, ev *rstypes.RunEvent) error {
+	run, _, err := n.runserviceClient.GetRun(ctx, ev.RunID, nil)
+	if err != nil {
+		return err
+	}
+
+	rts := []*rstypes.RunTask{}
+	for _, rt := range run.Run.Tasks {
+		if rt.ApprovalExpiryNotified || rt.ApprovalTimedOut {
+			rts = append(rts, rt)
+		}
+	}
+	if len(rts) == 0 {
+		return nil
+	}
+
+	project, gitSource, err := n.runProjectGitSource(ctx, run)
+	if err != nil {
+		return err
+	}
+	// ignore user direct runs
+	if project == nil {
+		return nil
+	}
+
+	targetURL, err := webRunURL(n.c.WebExposedURL, project.ID, run.Run.ID)
+	if err != nil {
+		return errors.Errorf("failed to generate commit status target url: %w", err)
+	}
+
+	for _, rt := range rts {
+		rct, ok := run.RunConfig.Tasks[rt.ID]
+		if !ok || rct.ApprovalTimeout == nil {
+			continue
+		}
+
+		var commitStatus gitsource.CommitStatus
+		var description string
+		switch {
+		case rt.WaitingApproval:
+			commitStatus = gitsource.CommitStatusPending
+			expiry := rt.WaitingApprovalTime.Add(rct.ApprovalTimeout.Timeout)
+			description = fmt.Sprintf("The approval expires at %s", expiry.UTC().Format(time.RFC3339))
+		case rt.ApprovalTimedOut && rt.Approved:
+			commitStatus = gitsource.CommitStatusSuccess
+			description = "The approval expired, the task has been automatically approved"
+		case rt.ApprovalTimedOut:
+			commitStatus = gitsource.CommitStatusFailed
+			description = "The approval expired, the task has been automatically rejected"
+		case rt.Approved:
+			commitStatus = gitsource.CommitStatusSuccess
+			description = "The task has been approved"
+		default:
+			continue
+		}
+
+		context := fmt.Sprintf("%s/%s/%s/approval/%s", n.gc.ID, project.Name, runStatusName(run), rct.Name)
+		if err := gitSource.CreateCommitStatus(project.RepositoryPath, run.Run.Annotations[action.AnnotationCommitSHA], commitStatus, targetURL, description, context); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
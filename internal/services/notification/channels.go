@@ -0,0 +1,164 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	notificationchannel "agola.io/agola/internal/notificationchannels"
+	"agola.io/agola/internal/services/common"
+	csapi "agola.io/agola/internal/services/configstore/api"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/services/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+var (
+	etcdChannelNotifiedRunsDir = path.Join("channelnotifications", "runs")
+)
+
+// notifyRunChannels sends the finished runs notifications to the project
+// notification channels matching the run by their mode or by a project
+// notification rule. The channels credentials are read from the project
+// secrets.
+func (n *NotificationService) notifyRunChannels(ctx context.Context, ev *rstypes.RunEvent) error {
+	if !isNotifiableRunEvent(ev) {
+		return nil
+	}
+
+	notified, err := n.isRunNotified(ctx, etcdChannelNotifiedRunsDir, ev.RunID)
+	if err != nil || notified {
+		return err
+	}
+
+	run, project, err := n.runProject(ctx, ev.RunID)
+	if err != nil {
+		return err
+	}
+	// ignore user direct runs
+	if project == nil || len(project.NotificationChannels) == 0 {
+		return nil
+	}
+
+	rn, err := n.newRunNotification(run, project)
+	if err != nil {
+		return err
+	}
+	msg := channelMessage(rn)
+
+	matcher := n.newRunMatcher(run, rn.Failed)
+
+	// the channels notified by their mode or by a matching notification rule
+	notify := map[string]bool{}
+	for _, c := range project.NotificationChannels {
+		matches, err := matcher.matchesMode(ctx, c.Mode)
+		if err != nil {
+			return err
+		}
+		if matches {
+			notify[c.Name] = true
+		}
+	}
+	for _, rule := range project.NotificationRules {
+		matches, err := matcher.matchesRule(ctx, rule)
+		if err != nil {
+			return err
+		}
+		if !matches {
+			continue
+		}
+		for _, name := range rule.Channels {
+			notify[name] = true
+		}
+	}
+
+	if len(notify) > 0 {
+		if err := n.sendChannelsMessage(ctx, project, notify, msg); err != nil {
+			return err
+		}
+	}
+
+	return n.setRunNotified(ctx, etcdChannelNotifiedRunsDir, ev.RunID)
+}
+
+// sendChannelsMessage sends the message to the provided project notification
+// channels
+func (n *NotificationService) sendChannelsMessage(ctx context.Context, project *csapi.Project, notify map[string]bool, msg *notificationchannel.Message) error {
+	// secrets are returned from the project to the root project group so the
+	// first secret with the channel secret name is the nearest one
+	secrets, _, err := n.configstoreClient.GetProjectSecrets(ctx, project.ID, true)
+	if err != nil {
+		return errors.Errorf("failed to get project %s secrets: %w", project.ID, err)
+	}
+
+	for _, c := range project.NotificationChannels {
+		if !notify[c.Name] {
+			continue
+		}
+		if err := n.sendChannelMessage(ctx, c, secrets, msg); err != nil {
+			log.Errorf("failed to send message to channel %q: %+v", c.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (n *NotificationService) sendChannelMessage(ctx context.Context, c *types.ProjectNotificationChannel, secrets []*csapi.Secret, msg *notificationchannel.Message) error {
+	var secret *csapi.Secret
+	for _, s := range secrets {
+		if s.Name == c.SecretName {
+			secret = s
+			break
+		}
+	}
+	if secret == nil {
+		return errors.Errorf("secret %q doesn't exist", c.SecretName)
+	}
+	if secret.Type != types.SecretTypeInternal {
+		return errors.Errorf("secret %q isn't an internal secret", c.SecretName)
+	}
+
+	channel, err := common.GetNotificationChannel(c, secret.Data)
+	if err != nil {
+		return err
+	}
+
+	return channel.Send(ctx, msg)
+}
+
+func channelMessage(rn *runNotification) *notificationchannel.Message {
+	msg := &notificationchannel.Message{
+		Title:  rn.title(),
+		URL:    rn.URL,
+		Failed: rn.Failed,
+	}
+	if rn.Ref != "" {
+		msg.Lines = append(msg.Lines, rn.Ref)
+	}
+	if rn.Message != "" {
+		// only the commit message subject
+		msg.Lines = append(msg.Lines, strings.SplitN(rn.Message, "\n", 2)[0])
+	}
+	if len(rn.FailedTasks) > 0 {
+		msg.Lines = append(msg.Lines, "Failed tasks: "+strings.Join(rn.FailedTasks, ", "))
+	}
+	if len(rn.SetupErrors) > 0 {
+		msg.Lines = append(msg.Lines, "Setup error: "+rn.SetupErrors[0])
+	}
+	return msg
+}
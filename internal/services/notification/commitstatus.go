@@ -18,10 +18,13 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"path"
 
 	gitsource "agola.io/agola/internal/gitsources"
 	"agola.io/agola/internal/services/common"
+	csapi "agola.io/agola/internal/services/configstore/api"
 	"agola.io/agola/internal/services/gateway/action"
+	rsapi "agola.io/agola/internal/services/runservice/api"
 	rstypes "agola.io/agola/internal/services/runservice/types"
 
 	errors "golang.org/x/xerrors"
@@ -29,8 +32,10 @@ import (
 
 func (n *NotificationService) updateCommitStatus(ctx context.Context, ev *rstypes.RunEvent) error {
 	var commitStatus gitsource.CommitStatus
+	// setup errors are caused by the project config (wrong config, undefined
+	// variables) so they're reported as failures
 	if ev.Phase == rstypes.RunPhaseSetupError {
-		commitStatus = gitsource.CommitStatusError
+		commitStatus = gitsource.CommitStatusFailed
 	}
 	if ev.Phase == rstypes.RunPhaseCancelled {
 		commitStatus = gitsource.CommitStatusError
@@ -49,60 +54,147 @@ func (n *NotificationService) updateCommitStatus(ctx context.Context, ev *rstype
 		}
 	}
 
+	run, _, err := n.runserviceClient.GetRun(ctx, ev.RunID, nil)
+	if err != nil {
+		return err
+	}
+
+	project, gitSource, err := n.runProjectGitSource(ctx, run)
+	if err != nil {
+		return err
+	}
+	// ignore user direct runs
+	if project == nil {
+		return nil
+	}
+
+	// a run with setup errors doesn't have tasks so it's always reported as a
+	// whole
+	if project.TaskCommitStatuses && ev.Phase != rstypes.RunPhaseSetupError {
+		return n.updateTaskCommitStatuses(ctx, run, project.Project, gitSource)
+	}
+
 	if commitStatus == "" {
 		return nil
 	}
 
-	run, _, err := n.runserviceClient.GetRun(ctx, ev.RunID, nil)
+	targetURL, err := webRunURL(n.c.WebExposedURL, project.ID, run.Run.ID)
 	if err != nil {
+		return errors.Errorf("failed to generate commit status target url: %w", err)
+	}
+	description := statusDescription(commitStatus)
+	if ev.Phase == rstypes.RunPhaseSetupError {
+		description = setupErrorDescription(run.RunConfig.SetupErrors)
+	}
+	context := fmt.Sprintf("%s/%s/%s", n.gc.ID, project.Name, runStatusName(run))
+
+	if err := gitSource.CreateCommitStatus(project.RepositoryPath, run.Run.Annotations[action.AnnotationCommitSHA], commitStatus, targetURL, description, context); err != nil {
 		return err
 	}
-	groupType, groupID, err := common.GroupTypeIDFromRunGroup(run.RunConfig.Group)
+
+	return nil
+}
+
+// updatePreviewURLs reports the preview environments urls registered by the
+// run tasks as a commit status. Only the urls changed by the event are
+// reported, so every url is reported once when it's set or removed.
+func (n *NotificationService) updatePreviewURLs(ctx context.Context, ev *rstypes.RunEvent) error {
+	if len(ev.PreviewURLTasks) == 0 {
+		return nil
+	}
+
+	run, _, err := n.runserviceClient.GetRun(ctx, ev.RunID, nil)
 	if err != nil {
 		return err
 	}
 
+	previewURLs := []*rstypes.PreviewURL{}
+	for _, rtID := range ev.PreviewURLTasks {
+		if rt, ok := run.Run.Tasks[rtID]; ok && rt.PreviewURL != nil {
+			previewURLs = append(previewURLs, rt.PreviewURL)
+		}
+	}
+	if len(previewURLs) == 0 {
+		return nil
+	}
+
+	project, gitSource, err := n.runProjectGitSource(ctx, run)
+	if err != nil {
+		return err
+	}
 	// ignore user direct runs
-	if groupType == common.GroupTypeUser {
+	if project == nil {
 		return nil
 	}
 
+	context := fmt.Sprintf("%s/%s/preview", n.gc.ID, project.Name)
+	for _, previewURL := range previewURLs {
+		var targetURL, description string
+		switch previewURL.Action {
+		case rstypes.PreviewURLActionSet:
+			targetURL = previewURL.URL
+			description = "The preview environment is available"
+		case rstypes.PreviewURLActionRemove:
+			description = "The preview environment has been removed"
+		default:
+			continue
+		}
+
+		if err := gitSource.CreateCommitStatus(project.RepositoryPath, run.Run.Annotations[action.AnnotationCommitSHA], gitsource.CommitStatusSuccess, targetURL, description, context); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runStatusName returns the run name used in the commit statuses context. The
+// runs generated by a monorepo config dir are prefixed by the config dir to
+// keep the statuses of runs with the same name in different configs distinct.
+func runStatusName(run *rsapi.RunResponse) string {
+	if configDir := run.Run.Annotations[action.AnnotationConfigDir]; configDir != "" {
+		return path.Join(configDir, run.RunConfig.Name)
+	}
+	return run.RunConfig.Name
+}
+
+// runProjectGitSource returns the run project and its related git source. It
+// returns a nil project if the run isn't a project run (i.e. a user direct run)
+func (n *NotificationService) runProjectGitSource(ctx context.Context, run *rsapi.RunResponse) (*csapi.Project, gitsource.GitSource, error) {
+	groupType, groupID, err := common.GroupTypeIDFromRunGroup(run.RunConfig.Group)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if groupType == common.GroupTypeUser {
+		return nil, nil, nil
+	}
+
 	project, _, err := n.configstoreClient.GetProject(ctx, groupID)
 	if err != nil {
-		return errors.Errorf("failed to get project %s: %w", groupID, err)
+		return nil, nil, errors.Errorf("failed to get project %s: %w", groupID, err)
 	}
 
 	user, _, err := n.configstoreClient.GetUserByLinkedAccount(ctx, project.LinkedAccountID)
 	if err != nil {
-		return errors.Errorf("failed to get user by linked account %q: %w", project.LinkedAccountID, err)
+		return nil, nil, errors.Errorf("failed to get user by linked account %q: %w", project.LinkedAccountID, err)
 	}
 	la := user.LinkedAccounts[project.LinkedAccountID]
 	if la == nil {
-		return errors.Errorf("linked account %q in user %q doesn't exist", project.LinkedAccountID, user.Name)
+		return nil, nil, errors.Errorf("linked account %q in user %q doesn't exist", project.LinkedAccountID, user.Name)
 	}
 	rs, _, err := n.configstoreClient.GetRemoteSource(ctx, la.RemoteSourceID)
 	if err != nil {
-		return errors.Errorf("failed to get remote source %q: %w", la.RemoteSourceID, err)
+		return nil, nil, errors.Errorf("failed to get remote source %q: %w", la.RemoteSourceID, err)
 	}
 
 	// TODO(sgotti) handle refreshing oauth2 tokens
 	gitSource, err := common.GetGitSource(rs, la)
 	if err != nil {
-		return errors.Errorf("failed to create gitea client: %w", err)
-	}
-
-	targetURL, err := webRunURL(n.c.WebExposedURL, project.ID, run.Run.ID)
-	if err != nil {
-		return errors.Errorf("failed to generate commit status target url: %w", err)
+		return nil, nil, errors.Errorf("failed to create gitea client: %w", err)
 	}
-	description := statusDescription(commitStatus)
-	context := fmt.Sprintf("%s/%s/%s", n.gc.ID, project.Name, run.RunConfig.Name)
 
-	if err := gitSource.CreateCommitStatus(project.RepositoryPath, run.Run.Annotations[action.AnnotationCommitSHA], commitStatus, targetURL, description, context); err != nil {
-		return err
-	}
-
-	return nil
+	return project, gitSource, nil
 }
 
 func webRunURL(webExposedURL, projectID, runID string) (string, error) {
@@ -119,6 +211,22 @@ func webRunURL(webExposedURL, projectID, runID string) (string, error) {
 	return u.String(), nil
 }
 
+// setupErrorDescription returns a commit status description reporting the
+// first run setup error. It's truncated since the git sources limit the
+// description length (i.e. 140 chars on github).
+func setupErrorDescription(setupErrors []string) string {
+	const maxLength = 140
+
+	if len(setupErrors) == 0 {
+		return "The run has setup errors"
+	}
+	description := []rune("Setup error: " + setupErrors[0])
+	if len(description) > maxLength {
+		description = append(description[:maxLength-3], []rune("...")...)
+	}
+	return string(description)
+}
+
 func statusDescription(commitStatus gitsource.CommitStatus) string {
 	switch commitStatus {
 	case gitsource.CommitStatusPending:
@@ -0,0 +1,96 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	gitsource "agola.io/agola/internal/gitsources"
+	"agola.io/agola/internal/services/common"
+	"agola.io/agola/internal/services/gateway/action"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/services/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+// coverageBaseRuns is the number of last finished runs of the coverage base
+// branch inspected to find the baseline coverage
+const coverageBaseRuns = 10
+
+// updateCoverageStatus reports, as a commit status, the coverage of a pull
+// request run compared to the coverage of the project coverage base branch.
+// The commit status fails when the coverage drops.
+func (n *NotificationService) updateCoverageStatus(ctx context.Context, ev *rstypes.RunEvent) error {
+	if ev.Phase != rstypes.RunPhaseFinished {
+		return nil
+	}
+
+	run, _, err := n.runserviceClient.GetRun(ctx, ev.RunID, nil)
+	if err != nil {
+		return err
+	}
+	if run.Run.Annotations[action.AnnotationRefType] != string(types.RunRefTypePullRequest) {
+		return nil
+	}
+
+	coverage, _, err := n.runserviceClient.GetRunCoverage(ctx, ev.RunID)
+	if err != nil {
+		return err
+	}
+	// the run doesn't have coverage reports
+	if coverage.LinesTotal == 0 {
+		return nil
+	}
+
+	project, gitSource, err := n.runProjectGitSource(ctx, run)
+	if err != nil {
+		return err
+	}
+	// ignore user direct runs
+	if project == nil || project.CoverageBaseBranch == "" {
+		return nil
+	}
+
+	group := common.GenRunGroup(common.GroupTypeProject, project.ID, common.GroupTypeBranch, project.CoverageBaseBranch)
+	entries, _, err := n.runserviceClient.GetCoverageHistory(ctx, group, coverageBaseRuns)
+	if err != nil {
+		return err
+	}
+
+	percent := coverage.Percent()
+	commitStatus := gitsource.CommitStatusSuccess
+	var description string
+	if len(entries) == 0 {
+		description = fmt.Sprintf("Coverage %.2f%% (no coverage for branch %s)", percent, project.CoverageBaseBranch)
+	} else {
+		// round to the reported precision to not fail on negligible changes
+		delta := math.Round((percent-entries[0].Coverage.Percent())*100) / 100
+		if delta < 0 {
+			commitStatus = gitsource.CommitStatusFailed
+		}
+		description = fmt.Sprintf("Coverage %.2f%% (%+.2f%%) compared to %s", percent, delta, project.CoverageBaseBranch)
+	}
+
+	targetURL, err := webRunURL(n.c.WebExposedURL, project.ID, run.Run.ID)
+	if err != nil {
+		return errors.Errorf("failed to generate commit status target url: %w", err)
+	}
+	context := fmt.Sprintf("%s/%s/coverage", n.gc.ID, project.Name)
+
+	return gitSource.CreateCommitStatus(project.RepositoryPath, run.Run.Annotations[action.AnnotationCommitSHA], commitStatus, targetURL, description, context)
+}
@@ -0,0 +1,263 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"time"
+
+	"agola.io/agola/internal/etcd"
+	csapi "agola.io/agola/internal/services/configstore/api"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/services/types"
+
+	"go.etcd.io/etcd/clientv3/concurrency"
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	emailDigestCheckInterval = 1 * time.Minute
+)
+
+var (
+	etcdEmailDigestsLockKey = path.Join("locks", "emaildigests")
+
+	etcdEmailNotifiedRunsDir = path.Join("emailnotifications", "runs")
+	etcdEmailDigestsDir      = path.Join("emailnotifications", "digests")
+	etcdEmailLastDigestKey   = path.Join("emailnotifications", "lastdigest")
+)
+
+// emailRecipient is a recipient of the run email notifications
+type emailRecipient struct {
+	email  string
+	mode   types.NotificationMode
+	digest bool
+}
+
+// notifyRunEmails sends the finished runs email notifications to the project
+// recipients and to the users subscribed to the project. The recipients with
+// the digest mode enabled will receive the run in the next digest.
+func (n *NotificationService) notifyRunEmails(ctx context.Context, ev *rstypes.RunEvent) error {
+	if n.mailer == nil || !isNotifiableRunEvent(ev) {
+		return nil
+	}
+
+	notified, err := n.isRunNotified(ctx, etcdEmailNotifiedRunsDir, ev.RunID)
+	if err != nil || notified {
+		return err
+	}
+
+	run, project, err := n.runProject(ctx, ev.RunID)
+	if err != nil {
+		return err
+	}
+	// ignore user direct runs
+	if project == nil {
+		return nil
+	}
+
+	recipients, err := n.emailRecipients(ctx, project)
+	if err != nil {
+		return err
+	}
+
+	if len(recipients) > 0 {
+		e, err := n.newRunNotification(run, project)
+		if err != nil {
+			return err
+		}
+
+		matcher := n.newRunMatcher(run, e.Failed)
+		for _, r := range recipients {
+			notify, err := matcher.matchesMode(ctx, r.mode)
+			if err != nil {
+				return err
+			}
+			if !notify {
+				continue
+			}
+
+			if r.digest {
+				if err := n.addDigestRun(ctx, r.email, e); err != nil {
+					log.Errorf("failed to add run %s to the %s email digest: %+v", run.Run.ID, r.email, err)
+				}
+				continue
+			}
+			body, err := renderEmail(runEmailTemplate, e)
+			if err != nil {
+				return err
+			}
+			if err := n.mailer.send(r.email, e.subject(), body); err != nil {
+				log.Errorf("failed to send run %s email notification to %s: %+v", run.Run.ID, r.email, err)
+			}
+		}
+	}
+
+	return n.setRunNotified(ctx, etcdEmailNotifiedRunsDir, ev.RunID)
+}
+
+// emailRecipients returns the project email notifications recipients. When
+// the same email is both a project recipient and a subscribed user the user
+// settings are used.
+func (n *NotificationService) emailRecipients(ctx context.Context, project *csapi.Project) ([]*emailRecipient, error) {
+	recipients := map[string]*emailRecipient{}
+	if pn := project.EmailNotifications; pn != nil {
+		for _, email := range pn.Recipients {
+			recipients[email] = &emailRecipient{email: email, mode: pn.Mode, digest: pn.Digest}
+		}
+	}
+
+	users, _, err := n.configstoreClient.GetProjectEmailSubscribers(ctx, project.ID)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project %s email subscribers: %w", project.ID, err)
+	}
+	for _, user := range users {
+		un := user.EmailNotifications
+		mode := un.Projects[project.ID]
+		if mode == "" {
+			mode = un.Mode
+		}
+		recipients[un.Email] = &emailRecipient{email: un.Email, mode: mode, digest: un.Digest}
+	}
+
+	emails := make([]string, 0, len(recipients))
+	for email := range recipients {
+		emails = append(emails, email)
+	}
+	sort.Strings(emails)
+
+	res := make([]*emailRecipient, 0, len(recipients))
+	for _, email := range emails {
+		res = append(res, recipients[email])
+	}
+	return res, nil
+}
+
+func emailDigestDir(email string) string {
+	return path.Join(etcdEmailDigestsDir, url.PathEscape(email))
+}
+
+func (n *NotificationService) addDigestRun(ctx context.Context, email string, e *runNotification) error {
+	ej, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = n.e.Put(ctx, path.Join(emailDigestDir(email), e.RunID), ej, nil)
+	return err
+}
+
+func (n *NotificationService) emailDigestsLoop(ctx context.Context) {
+	for {
+		if err := n.sendEmailDigests(ctx); err != nil {
+			log.Errorf("err: %+v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		time.Sleep(emailDigestCheckInterval)
+	}
+}
+
+// sendEmailDigests sends, every email digest interval, the digests of the
+// notified runs to the recipients with the digest mode enabled
+func (n *NotificationService) sendEmailDigests(ctx context.Context) error {
+	session, err := concurrency.NewSession(n.e.Client(), concurrency.WithTTL(5), concurrency.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	m := concurrency.NewMutex(session, etcdEmailDigestsLockKey)
+	if err := m.Lock(ctx); err != nil {
+		return err
+	}
+	defer func() { _ = m.Unlock(ctx) }()
+
+	now := time.Now()
+	resp, err := n.e.Get(ctx, etcdEmailLastDigestKey, 0)
+	if err != nil && !errors.Is(err, etcd.ErrKeyNotFound) {
+		return err
+	}
+	if err == nil {
+		var lastDigest time.Time
+		if err := lastDigest.UnmarshalText(resp.Kvs[0].Value); err != nil {
+			return err
+		}
+		if now.Sub(lastDigest) < n.c.EmailDigestInterval {
+			return nil
+		}
+	}
+
+	listResp, err := n.e.List(ctx, etcdEmailDigestsDir, "", 0)
+	if err != nil {
+		return err
+	}
+
+	// group the digest runs by recipient
+	digests := map[string][]*runNotification{}
+	keys := map[string][]string{}
+	for _, kv := range listResp.Kvs {
+		key := string(kv.Key)
+		email, err := url.PathUnescape(path.Base(path.Dir(key)))
+		if err != nil {
+			return err
+		}
+		var e *runNotification
+		if err := json.Unmarshal(kv.Value, &e); err != nil {
+			return err
+		}
+		digests[email] = append(digests[email], e)
+		keys[email] = append(keys[email], key)
+	}
+
+	for email, runNotifications := range digests {
+		sort.Slice(runNotifications, func(i, j int) bool { return runNotifications[i].EndTime.Before(runNotifications[j].EndTime) })
+
+		body, err := renderEmail(digestEmailTemplate, runNotifications)
+		if err != nil {
+			return err
+		}
+		subject := fmt.Sprintf("[agola] runs digest: %d runs", len(runNotifications))
+		if err := n.mailer.send(email, subject, body); err != nil {
+			// keep the runs for the next digest
+			log.Errorf("failed to send email digest to %s: %+v", email, err)
+			continue
+		}
+		for _, key := range keys[email] {
+			if err := n.e.Delete(ctx, key); err != nil {
+				return err
+			}
+		}
+	}
+
+	lastDigest, err := now.MarshalText()
+	if err != nil {
+		return err
+	}
+	if _, err := n.e.Put(ctx, etcdEmailLastDigestKey, lastDigest, nil); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/types"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEmailRecipients(t *testing.T) {
+	cs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/api/v1alpha/users" || q.Get("query_type") != "byemailsubscription" || q.Get("projectid") != "project01" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		users := []*types.User{
+			{ID: "user01", EmailNotifications: &types.UserEmailNotifications{
+				Email:    "user01@example.com",
+				Mode:     types.NotificationModeFailures,
+				Projects: map[string]types.NotificationMode{"project01": ""},
+			}},
+			// the user settings override the project ones
+			{ID: "user02", EmailNotifications: &types.UserEmailNotifications{
+				Email:    "team@example.com",
+				Mode:     types.NotificationModeFailures,
+				Projects: map[string]types.NotificationMode{"project01": types.NotificationModeAll},
+				Digest:   true,
+			}},
+		}
+		if err := json.NewEncoder(w).Encode(users); err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+	}))
+	defer cs.Close()
+
+	n := &NotificationService{configstoreClient: csapi.NewClient(cs.URL)}
+	project := &csapi.Project{
+		Project: &types.Project{
+			ID: "project01",
+			EmailNotifications: &types.ProjectEmailNotifications{
+				Recipients: []string{"team@example.com", "ops@example.com"},
+				Mode:       types.NotificationModeFirstFailure,
+			},
+		},
+	}
+
+	recipients, err := n.emailRecipients(context.Background(), project)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	expectedRecipients := []*emailRecipient{
+		{email: "ops@example.com", mode: types.NotificationModeFirstFailure},
+		{email: "team@example.com", mode: types.NotificationModeAll, digest: true},
+		{email: "user01@example.com", mode: types.NotificationModeFailures},
+	}
+	if diff := cmp.Diff(expectedRecipients, recipients, cmp.AllowUnexported(emailRecipient{})); diff != "" {
+		t.Error(diff)
+	}
+}
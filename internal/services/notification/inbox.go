@@ -0,0 +1,163 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/gateway/action"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/services/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+var (
+	etcdInboxNotifiedRunsDir      = path.Join("inboxnotifications", "runs")
+	etcdInboxNotifiedApprovalsDir = path.Join("inboxnotifications", "approvals")
+)
+
+// notifyRunInbox adds a notification to the inbox of the users watching the
+// project of a failed run
+func (n *NotificationService) notifyRunInbox(ctx context.Context, ev *rstypes.RunEvent) error {
+	if !isNotifiableRunEvent(ev) {
+		return nil
+	}
+
+	notified, err := n.isRunNotified(ctx, etcdInboxNotifiedRunsDir, ev.RunID)
+	if err != nil || notified {
+		return err
+	}
+
+	run, project, err := n.runProject(ctx, ev.RunID)
+	if err != nil {
+		return err
+	}
+	// ignore user direct runs
+	if project == nil {
+		return nil
+	}
+
+	rn, err := n.newRunNotification(run, project)
+	if err != nil {
+		return err
+	}
+	if rn.Failed {
+		message := rn.Ref
+		switch {
+		case len(rn.SetupErrors) > 0:
+			message = fmt.Sprintf("%s: %s", rn.Ref, strings.Join(rn.SetupErrors, ", "))
+		case len(rn.FailedTasks) > 0:
+			message = fmt.Sprintf("%s: failed tasks %s", rn.Ref, strings.Join(rn.FailedTasks, ", "))
+		}
+		un := &types.UserNotification{
+			Type:      types.UserNotificationTypeRunFailed,
+			Title:     rn.title(),
+			Message:   message,
+			URL:       rn.URL,
+			ProjectID: project.ID,
+			RunID:     run.Run.ID,
+		}
+		if err := n.addProjectWatchersNotification(ctx, project, un); err != nil {
+			return err
+		}
+	}
+
+	return n.setRunNotified(ctx, etcdInboxNotifiedRunsDir, ev.RunID)
+}
+
+// notifyApprovalsInbox adds a notification to the inbox of the users watching
+// the project of a run for every task waiting for approval
+func (n *NotificationService) notifyApprovalsInbox(ctx context.Context, ev *rstypes.RunEvent) error {
+	if ev.Phase != rstypes.RunPhaseRunning {
+		return nil
+	}
+
+	run, project, err := n.runProject(ctx, ev.RunID)
+	if err != nil {
+		return err
+	}
+	// ignore user direct runs
+	if project == nil {
+		return nil
+	}
+
+	for _, rt := range run.Run.Tasks {
+		if !rt.WaitingApproval {
+			continue
+		}
+		rct, ok := run.RunConfig.Tasks[rt.ID]
+		if !ok {
+			continue
+		}
+
+		// the run task id is unique so it's used as the notified key
+		notified, err := n.isRunNotified(ctx, etcdInboxNotifiedApprovalsDir, rt.ID)
+		if err != nil {
+			return err
+		}
+		if notified {
+			continue
+		}
+
+		runURL, err := webRunURL(n.c.WebExposedURL, project.ID, run.Run.ID)
+		if err != nil {
+			return errors.Errorf("failed to generate run url: %w", err)
+		}
+		un := &types.UserNotification{
+			Type:      types.UserNotificationTypeApprovalPending,
+			Title:     fmt.Sprintf("%s: run %s #%d task %s is waiting for approval", project.Path, runStatusName(run), run.Run.Counter, rct.Name),
+			Message:   runRefDescription(run.Run.Annotations),
+			URL:       runURL,
+			ProjectID: project.ID,
+			RunID:     run.Run.ID,
+			TaskID:    rt.ID,
+		}
+		if run.Run.Annotations[action.AnnotationCommitSHA] != "" {
+			un.Message = fmt.Sprintf("%s (%s)", un.Message, run.Run.Annotations[action.AnnotationCommitSHA])
+		}
+		if err := n.addProjectWatchersNotification(ctx, project, un); err != nil {
+			return err
+		}
+
+		if err := n.setRunNotified(ctx, etcdInboxNotifiedApprovalsDir, rt.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addProjectWatchersNotification adds the notification to the inbox of every
+// user watching the project
+func (n *NotificationService) addProjectWatchersNotification(ctx context.Context, project *csapi.Project, un *types.UserNotification) error {
+	users, _, err := n.configstoreClient.GetProjectWatchers(ctx, project.ID)
+	if err != nil {
+		return errors.Errorf("failed to get project %s watchers: %w", project.ID, err)
+	}
+
+	for _, user := range users {
+		uun := *un
+		if _, _, err := n.configstoreClient.CreateUserNotification(ctx, user.ID, &uun); err != nil {
+			log.Errorf("failed to add notification to user %q inbox: %+v", user.Name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"agola.io/agola/internal/services/config"
+)
+
+func (e *runNotification) subject() string {
+	return "[agola] " + e.title()
+}
+
+var runEmailTemplate = template.Must(template.New("run").Parse(`<html>
+<body style="font-family: sans-serif;">
+<h2 style="color: {{if .Failed}}#d73a49{{else}}#28a745{{end}};">Run {{.RunName}} #{{.RunCounter}} {{.Result}}</h2>
+<table>
+<tr><td><b>Project</b></td><td>{{.ProjectPath}}</td></tr>
+{{- if .Ref}}
+<tr><td><b>Ref</b></td><td>{{.Ref}}</td></tr>
+{{- end}}
+{{- if .CommitSHA}}
+<tr><td><b>Commit</b></td><td>{{.CommitSHA}}</td></tr>
+{{- end}}
+{{- if .Message}}
+<tr><td><b>Message</b></td><td>{{.Message}}</td></tr>
+{{- end}}
+</table>
+{{- if .FailedTasks}}
+<p>Failed tasks:</p>
+<ul>
+{{- range .FailedTasks}}
+<li>{{.}}</li>
+{{- end}}
+</ul>
+{{- end}}
+{{- if .SetupErrors}}
+<p>Setup errors:</p>
+<ul>
+{{- range .SetupErrors}}
+<li>{{.}}</li>
+{{- end}}
+</ul>
+{{- end}}
+<p><a href="{{.URL}}">View the run</a></p>
+</body>
+</html>
+`))
+
+var digestEmailTemplate = template.Must(template.New("digest").Parse(`<html>
+<body style="font-family: sans-serif;">
+<h2>Agola runs digest</h2>
+<table>
+<tr><th align="left">Project</th><th align="left">Run</th><th align="left">Ref</th><th align="left">Result</th><th align="left">Finished</th></tr>
+{{- range .}}
+<tr>
+<td>{{.ProjectPath}}</td>
+<td><a href="{{.URL}}">{{.RunName}} #{{.RunCounter}}</a></td>
+<td>{{.Ref}}</td>
+<td style="color: {{if .Failed}}#d73a49{{else}}#28a745{{end}};">{{.Result}}</td>
+<td>{{.EndTime.UTC.Format "2006-01-02 15:04:05 MST"}}</td>
+</tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+func renderEmail(t *template.Template, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// mailer sends html emails using the configured smtp server
+type mailer struct {
+	c *config.SMTP
+}
+
+func (m *mailer) send(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.c.Username != "" {
+		auth = smtp.PlainAuth("", m.c.Username, m.c.Password, m.c.Host)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", m.c.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: text/html; charset=\"utf-8\"\r\n")
+	fmt.Fprintf(&msg, "\r\n")
+	msg.WriteString(body)
+
+	addr := net.JoinHostPort(m.c.Host, strconv.Itoa(m.c.Port))
+	return smtp.SendMail(addr, auth, m.c.From, []string{to}, msg.Bytes())
+}
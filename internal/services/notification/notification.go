@@ -19,6 +19,7 @@ import (
 
 	"agola.io/agola/internal/common"
 	"agola.io/agola/internal/etcd"
+	gitsource "agola.io/agola/internal/gitsources"
 	slog "agola.io/agola/internal/log"
 	"agola.io/agola/internal/services/config"
 	csapi "agola.io/agola/internal/services/configstore/api"
@@ -40,6 +41,13 @@ type NotificationService struct {
 
 	runserviceClient  *rsapi.Client
 	configstoreClient *csapi.Client
+
+	// mailer is nil when the email notifications aren't configured
+	mailer *mailer
+
+	// taskCommitStatuses are the last reported task commit statuses keyed by
+	// run id and task id. It's only accessed by the run events handler.
+	taskCommitStatuses map[string]map[string]gitsource.CommitStatus
 }
 
 func NewNotificationService(gc *config.Config) (*NotificationService, error) {
@@ -54,7 +62,14 @@ func NewNotificationService(gc *config.Config) (*NotificationService, error) {
 	}
 
 	configstoreClient := csapi.NewClient(c.ConfigstoreURL)
+	configstoreClient.SetInternalAPIToken(c.ConfigstoreAPIToken)
 	runserviceClient := rsapi.NewClient(c.RunserviceURL)
+	runserviceClient.SetInternalAPIToken(c.RunserviceAPIToken)
+
+	var m *mailer
+	if c.SMTP != nil {
+		m = &mailer{c: c.SMTP}
+	}
 
 	return &NotificationService{
 		gc:                gc,
@@ -62,11 +77,17 @@ func NewNotificationService(gc *config.Config) (*NotificationService, error) {
 		e:                 e,
 		runserviceClient:  runserviceClient,
 		configstoreClient: configstoreClient,
+		mailer:            m,
+
+		taskCommitStatuses: map[string]map[string]gitsource.CommitStatus{},
 	}, nil
 }
 
 func (n *NotificationService) Run(ctx context.Context) error {
 	go n.runEventsHandlerLoop(ctx)
+	if n.mailer != nil {
+		go n.emailDigestsLoop(ctx)
+	}
 
 	<-ctx.Done()
 	log.Infof("notification service exiting")
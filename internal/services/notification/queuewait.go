@@ -0,0 +1,88 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	gitsource "agola.io/agola/internal/gitsources"
+	"agola.io/agola/internal/services/gateway/action"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+// notifyQueueWaits reports, using a commit status for every task, the tasks
+// that waited to be started by an executor more than the runservice queue
+// wait alert threshold
+func (n *NotificationService) notifyQueueWaits(ctx context.Context, ev *rstypes.RunEvent) error {
+	run, _, err := n.runserviceClient.GetRun(ctx, ev.RunID, nil)
+	if err != nil {
+		return err
+	}
+
+	rts := []*rstypes.RunTask{}
+	for _, rt := range run.Run.Tasks {
+		if rt.QueueWaitAlerted {
+			rts = append(rts, rt)
+		}
+	}
+	if len(rts) == 0 {
+		return nil
+	}
+
+	project, gitSource, err := n.runProjectGitSource(ctx, run)
+	if err != nil {
+		return err
+	}
+	// ignore user direct runs
+	if project == nil {
+		return nil
+	}
+
+	targetURL, err := webRunURL(n.c.WebExposedURL, project.ID, run.Run.ID)
+	if err != nil {
+		return errors.Errorf("failed to generate commit status target url: %w", err)
+	}
+
+	for _, rt := range rts {
+		rct, ok := run.RunConfig.Tasks[rt.ID]
+		if !ok {
+			continue
+		}
+
+		var commitStatus gitsource.CommitStatus
+		var description string
+		switch {
+		case rt.StartTime != nil:
+			commitStatus = gitsource.CommitStatusSuccess
+			description = fmt.Sprintf("The task started after waiting %s in the queue", rt.QueueWait.Round(time.Second))
+		case rt.SchedulableTime != nil:
+			commitStatus = gitsource.CommitStatusPending
+			description = fmt.Sprintf("The task is waiting for an executor since %s", rt.SchedulableTime.UTC().Format(time.RFC3339))
+		default:
+			continue
+		}
+
+		context := fmt.Sprintf("%s/%s/%s/queue/%s", n.gc.ID, project.Name, runStatusName(run), rct.Name)
+		if err := gitSource.CreateCommitStatus(project.RepositoryPath, run.Run.Annotations[action.AnnotationCommitSHA], commitStatus, targetURL, description, context); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
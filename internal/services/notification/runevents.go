@@ -113,6 +113,33 @@ func (n *NotificationService) runEventsHandler(ctx context.Context) error {
 			if err := n.updateCommitStatus(ctx, ev); err != nil {
 				log.Infof("failed to update commit status: %v", err)
 			}
+			if err := n.updatePreviewURLs(ctx, ev); err != nil {
+				log.Infof("failed to update preview urls: %v", err)
+			}
+			if err := n.updateCoverageStatus(ctx, ev); err != nil {
+				log.Infof("failed to update coverage status: %v", err)
+			}
+			if err := n.cleanupUserRunBranch(ctx, ev); err != nil {
+				log.Infof("failed to cleanup user run branch: %v", err)
+			}
+			if err := n.notifyApprovalExpiry(ctx, ev); err != nil {
+				log.Infof("failed to notify approval expiry: %v", err)
+			}
+			if err := n.notifyQueueWaits(ctx, ev); err != nil {
+				log.Infof("failed to notify queue waits: %v", err)
+			}
+			if err := n.notifyRunEmails(ctx, ev); err != nil {
+				log.Infof("failed to send run email notifications: %v", err)
+			}
+			if err := n.notifyRunChannels(ctx, ev); err != nil {
+				log.Infof("failed to send run channels notifications: %v", err)
+			}
+			if err := n.notifyRunInbox(ctx, ev); err != nil {
+				log.Infof("failed to add run inbox notifications: %v", err)
+			}
+			if err := n.notifyApprovalsInbox(ctx, ev); err != nil {
+				log.Infof("failed to add approvals inbox notifications: %v", err)
+			}
 
 		default:
 			return errors.Errorf("wrong data")
@@ -0,0 +1,290 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"agola.io/agola/internal/etcd"
+	"agola.io/agola/internal/services/common"
+	csapi "agola.io/agola/internal/services/configstore/api"
+	"agola.io/agola/internal/services/gateway/action"
+	rsapi "agola.io/agola/internal/services/runservice/api"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/services/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	// notifiedRunTTL is how long the notified runs are remembered to avoid
+	// notifying them again on later run events
+	notifiedRunTTL = 7 * 24 * time.Hour
+)
+
+// isNotifiableRunEvent returns true if the event is about a run whose result
+// can be notified. Cancelled runs aren't notified since they were never
+// started.
+func isNotifiableRunEvent(ev *rstypes.RunEvent) bool {
+	switch ev.Phase {
+	case rstypes.RunPhaseSetupError:
+		return true
+	case rstypes.RunPhaseFinished:
+		return ev.Result.IsSet()
+	}
+	return false
+}
+
+// isRunNotified returns true if the run has already been notified. The run
+// events are received multiple times for the same finished run.
+func (n *NotificationService) isRunNotified(ctx context.Context, dir, runID string) (bool, error) {
+	_, err := n.e.Get(ctx, path.Join(dir, runID), 0)
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, etcd.ErrKeyNotFound) {
+		return false, nil
+	}
+	return false, err
+}
+
+func (n *NotificationService) setRunNotified(ctx context.Context, dir, runID string) error {
+	_, err := n.e.Put(ctx, path.Join(dir, runID), []byte{}, &etcd.WriteOptions{TTL: notifiedRunTTL})
+	return err
+}
+
+// runProject returns the run and its project. It returns a nil project if the
+// run isn't a project run (i.e. a user direct run)
+func (n *NotificationService) runProject(ctx context.Context, runID string) (*rsapi.RunResponse, *csapi.Project, error) {
+	run, _, err := n.runserviceClient.GetRun(ctx, runID, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	groupType, groupID, err := common.GroupTypeIDFromRunGroup(run.RunConfig.Group)
+	if err != nil {
+		return nil, nil, err
+	}
+	if groupType == common.GroupTypeUser {
+		return run, nil, nil
+	}
+	project, _, err := n.configstoreClient.GetProject(ctx, groupID)
+	if err != nil {
+		return nil, nil, errors.Errorf("failed to get project %s: %w", groupID, err)
+	}
+	return run, project, nil
+}
+
+// runNotification contains the data of a notified run
+type runNotification struct {
+	ProjectPath string    `json:"project_path,omitempty"`
+	RunID       string    `json:"run_id,omitempty"`
+	RunName     string    `json:"run_name,omitempty"`
+	RunCounter  uint64    `json:"run_counter,omitempty"`
+	Ref         string    `json:"ref,omitempty"`
+	CommitSHA   string    `json:"commit_sha,omitempty"`
+	Message     string    `json:"message,omitempty"`
+	Result      string    `json:"result,omitempty"`
+	Failed      bool      `json:"failed,omitempty"`
+	FailedTasks []string  `json:"failed_tasks,omitempty"`
+	SetupErrors []string  `json:"setup_errors,omitempty"`
+	URL         string    `json:"url,omitempty"`
+	EndTime     time.Time `json:"end_time,omitempty"`
+}
+
+func (e *runNotification) title() string {
+	return fmt.Sprintf("%s: run %s #%d %s", e.ProjectPath, e.RunName, e.RunCounter, e.Result)
+}
+
+// runMatcher reports if a finished run must be notified with the provided
+// notification mode or notification rule. The previous runs needed by the
+// result transitions are fetched only once.
+type runMatcher struct {
+	n      *NotificationService
+	run    *rsapi.RunResponse
+	failed bool
+
+	// previousFailed is nil until the previous run is fetched
+	previousFailed *bool
+}
+
+func (n *NotificationService) newRunMatcher(run *rsapi.RunResponse, failed bool) *runMatcher {
+	return &runMatcher{n: n, run: run, failed: failed}
+}
+
+func (m *runMatcher) isPreviousFailed(ctx context.Context) (bool, error) {
+	if m.previousFailed == nil {
+		previousFailed, err := m.n.isPreviousRunFailed(ctx, m.run)
+		if err != nil {
+			return false, err
+		}
+		m.previousFailed = &previousFailed
+	}
+	return *m.previousFailed, nil
+}
+
+func (m *runMatcher) matchesMode(ctx context.Context, mode types.NotificationMode) (bool, error) {
+	switch mode {
+	case types.NotificationModeAll:
+		return true, nil
+	case types.NotificationModeFailures:
+		return m.failed, nil
+	case types.NotificationModeFirstFailure:
+		if !m.failed {
+			return false, nil
+		}
+		previousFailed, err := m.isPreviousFailed(ctx)
+		if err != nil {
+			return false, err
+		}
+		return !previousFailed, nil
+	}
+	return false, nil
+}
+
+// ruleResults returns the run results, including the result transitions,
+// matched by the notification rules
+func (m *runMatcher) ruleResults(ctx context.Context) ([]types.NotificationRuleResult, error) {
+	run := m.run.Run
+	if run.Phase == rstypes.RunPhaseFinished && run.Result == rstypes.RunResultStopped {
+		return []types.NotificationRuleResult{types.NotificationRuleResultStopped}, nil
+	}
+
+	previousFailed, err := m.isPreviousFailed(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if m.failed {
+		results := []types.NotificationRuleResult{types.NotificationRuleResultFailed}
+		if !previousFailed {
+			results = append(results, types.NotificationRuleResultBroken)
+		}
+		return results, nil
+	}
+	results := []types.NotificationRuleResult{types.NotificationRuleResultSuccess}
+	if previousFailed {
+		results = append(results, types.NotificationRuleResultFixed)
+	}
+	return results, nil
+}
+
+// matchesRule reports if the run matches the notification rule
+func (m *runMatcher) matchesRule(ctx context.Context, rule *types.NotificationRule) (bool, error) {
+	results, err := m.ruleResults(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	annotations := m.run.Run.Annotations
+	refType := types.RunRefType(annotations[action.AnnotationRefType])
+	var refName string
+	switch refType {
+	case types.RunRefTypeBranch:
+		refName = annotations[action.AnnotationBranch]
+	case types.RunRefTypeTag:
+		refName = annotations[action.AnnotationTag]
+	}
+
+	return rule.Match(refType, refName, results), nil
+}
+
+func (n *NotificationService) newRunNotification(run *rsapi.RunResponse, project *csapi.Project) (*runNotification, error) {
+	runURL, err := webRunURL(n.c.WebExposedURL, project.ID, run.Run.ID)
+	if err != nil {
+		return nil, errors.Errorf("failed to generate run url: %w", err)
+	}
+
+	e := &runNotification{
+		ProjectPath: project.Path,
+		RunID:       run.Run.ID,
+		RunName:     runStatusName(run),
+		RunCounter:  run.Run.Counter,
+		Ref:         runRefDescription(run.Run.Annotations),
+		CommitSHA:   run.Run.Annotations[action.AnnotationCommitSHA],
+		Message:     run.Run.Annotations[action.AnnotationMessage],
+		URL:         runURL,
+		EndTime:     time.Now(),
+	}
+	if run.Run.EndTime != nil {
+		e.EndTime = *run.Run.EndTime
+	}
+
+	switch {
+	case run.Run.Phase == rstypes.RunPhaseSetupError:
+		e.Result = "has setup errors"
+		e.Failed = true
+		e.SetupErrors = run.RunConfig.SetupErrors
+	case run.Run.Result == rstypes.RunResultSuccess:
+		e.Result = "succeeded"
+	case run.Run.Result == rstypes.RunResultStopped:
+		e.Result = "stopped"
+	default:
+		e.Result = "failed"
+		e.Failed = true
+	}
+
+	for _, rt := range run.Run.Tasks {
+		if rt.Status != rstypes.RunTaskStatusFailed {
+			continue
+		}
+		if rct, ok := run.RunConfig.Tasks[rt.ID]; ok {
+			e.FailedTasks = append(e.FailedTasks, rct.Name)
+		}
+	}
+	sort.Strings(e.FailedTasks)
+
+	return e, nil
+}
+
+// runRefDescription returns a description of the run branch, tag or pull
+// request
+func runRefDescription(annotations map[string]string) string {
+	switch {
+	case annotations[action.AnnotationBranch] != "":
+		return "branch " + annotations[action.AnnotationBranch]
+	case annotations[action.AnnotationTag] != "":
+		return "tag " + annotations[action.AnnotationTag]
+	case annotations[action.AnnotationPullRequestID] != "":
+		return "pull request #" + annotations[action.AnnotationPullRequestID]
+	default:
+		return annotations[action.AnnotationRef]
+	}
+}
+
+// isPreviousRunFailed returns true if the previous finished run with the same
+// name in the same run group (branch, tag or pull request) and config dir
+// failed. It returns false if there isn't a previous run.
+func (n *NotificationService) isPreviousRunFailed(ctx context.Context, run *rsapi.RunResponse) (bool, error) {
+	const limit = 10
+
+	phases := []string{string(rstypes.RunPhaseFinished), string(rstypes.RunPhaseSetupError)}
+	runsResp, _, err := n.runserviceClient.GetRuns(ctx, phases, nil, []string{run.Run.Group}, []string{run.Run.Name}, nil, false, false, nil, run.Run.ID, limit, false)
+	if err != nil {
+		return false, errors.Errorf("failed to get runs: %w", err)
+	}
+
+	configDir := run.Run.Annotations[action.AnnotationConfigDir]
+	for _, r := range runsResp.Runs {
+		if r.Group != run.Run.Group || r.Annotations[action.AnnotationConfigDir] != configDir {
+			continue
+		}
+		return r.Phase == rstypes.RunPhaseSetupError || r.Result == rstypes.RunResultFailed, nil
+	}
+
+	return false, nil
+}
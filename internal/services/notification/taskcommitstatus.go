@@ -0,0 +1,94 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"context"
+	"fmt"
+
+	gitsource "agola.io/agola/internal/gitsources"
+	"agola.io/agola/internal/services/gateway/action"
+	rsapi "agola.io/agola/internal/services/runservice/api"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/services/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+// updateTaskCommitStatuses reports a commit status per run task. Only the
+// statuses changed since the last report are sent to the git source.
+func (n *NotificationService) updateTaskCommitStatuses(ctx context.Context, run *rsapi.RunResponse, project *types.Project, gitSource gitsource.GitSource) error {
+	targetURL, err := webRunURL(n.c.WebExposedURL, project.ID, run.Run.ID)
+	if err != nil {
+		return errors.Errorf("failed to generate commit status target url: %w", err)
+	}
+
+	reported, ok := n.taskCommitStatuses[run.Run.ID]
+	if !ok {
+		reported = map[string]gitsource.CommitStatus{}
+		n.taskCommitStatuses[run.Run.ID] = reported
+	}
+
+	for _, rt := range run.Run.Tasks {
+		rct, ok := run.RunConfig.Tasks[rt.ID]
+		if !ok {
+			continue
+		}
+		commitStatus, description := taskCommitStatus(rt.Status, run.Run.Phase.IsFinished())
+		if commitStatus == "" || reported[rt.ID] == commitStatus {
+			continue
+		}
+
+		context := fmt.Sprintf("%s/%s/%s/%s", n.gc.ID, project.Name, runStatusName(run), rct.Name)
+		if err := gitSource.CreateCommitStatus(project.RepositoryPath, run.Run.Annotations[action.AnnotationCommitSHA], commitStatus, targetURL, description, context); err != nil {
+			return err
+		}
+		reported[rt.ID] = commitStatus
+	}
+
+	// the task statuses won't change anymore
+	if run.Run.Phase.IsFinished() {
+		delete(n.taskCommitStatuses, run.Run.ID)
+	}
+
+	return nil
+}
+
+// taskCommitStatus returns the commit status and its description for the
+// task status. The not started tasks of a finished run won't be started
+// anymore.
+func taskCommitStatus(status rstypes.RunTaskStatus, runFinished bool) (gitsource.CommitStatus, string) {
+	switch status {
+	case rstypes.RunTaskStatusNotStarted:
+		if runFinished {
+			return gitsource.CommitStatusFailed, "The task hasn't been started"
+		}
+		return gitsource.CommitStatusPending, "The task is waiting to be started"
+	case rstypes.RunTaskStatusRunning:
+		return gitsource.CommitStatusPending, "The task is running"
+	case rstypes.RunTaskStatusSuccess:
+		return gitsource.CommitStatusSuccess, "The task finished successfully"
+	case rstypes.RunTaskStatusSkipped:
+		return gitsource.CommitStatusSuccess, "The task has been skipped"
+	case rstypes.RunTaskStatusFailed:
+		return gitsource.CommitStatusFailed, "The task failed"
+	case rstypes.RunTaskStatusStopped:
+		return gitsource.CommitStatusFailed, "The task has been stopped"
+	case rstypes.RunTaskStatusCancelled:
+		return gitsource.CommitStatusFailed, "The task has been cancelled"
+	default:
+		return "", ""
+	}
+}
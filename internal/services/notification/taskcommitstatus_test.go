@@ -0,0 +1,127 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	gitsource "agola.io/agola/internal/gitsources"
+	"agola.io/agola/internal/services/config"
+	"agola.io/agola/internal/services/gateway/action"
+	rsapi "agola.io/agola/internal/services/runservice/api"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/services/types"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testCommitStatusGitSource records the created commit statuses
+type testCommitStatusGitSource struct {
+	// the not implemented methods panic
+	gitsource.GitSource
+
+	statuses []string
+}
+
+func (g *testCommitStatusGitSource) CreateCommitStatus(repopath, commitSHA string, status gitsource.CommitStatus, targetURL, description, context string) error {
+	g.statuses = append(g.statuses, repopath+" "+commitSHA+" "+context+" "+string(status))
+	return nil
+}
+
+func testTaskCommitStatusesRun(phase rstypes.RunPhase, task01Status, task02Status rstypes.RunTaskStatus) *rsapi.RunResponse {
+	return &rsapi.RunResponse{
+		Run: &rstypes.Run{
+			ID:          "run01",
+			Phase:       phase,
+			Annotations: map[string]string{action.AnnotationCommitSHA: "sha01"},
+			Tasks: map[string]*rstypes.RunTask{
+				"task01": {ID: "task01", Status: task01Status},
+				"task02": {ID: "task02", Status: task02Status},
+			},
+		},
+		RunConfig: &rstypes.RunConfig{
+			Name: "run",
+			Tasks: map[string]*rstypes.RunConfigTask{
+				"task01": {ID: "task01", Name: "build"},
+				"task02": {ID: "task02", Name: "deploy"},
+			},
+		},
+	}
+}
+
+func TestUpdateTaskCommitStatuses(t *testing.T) {
+	n := &NotificationService{
+		gc:                 &config.Config{ID: "agola"},
+		c:                  &config.Notification{WebExposedURL: "https://agola.example.com"},
+		taskCommitStatuses: map[string]map[string]gitsource.CommitStatus{},
+	}
+	project := &types.Project{ID: "project01", Name: "project01", RepositoryPath: "owner/repo", TaskCommitStatuses: true}
+
+	steps := []struct {
+		name             string
+		run              *rsapi.RunResponse
+		expectedStatuses []string
+	}{
+		{
+			name: "run started",
+			run:  testTaskCommitStatusesRun(rstypes.RunPhaseRunning, rstypes.RunTaskStatusRunning, rstypes.RunTaskStatusNotStarted),
+			expectedStatuses: []string{
+				"owner/repo sha01 agola/project01/run/build pending",
+				"owner/repo sha01 agola/project01/run/deploy pending",
+			},
+		},
+		{
+			// the unchanged task statuses aren't reported again
+			name:             "run unchanged",
+			run:              testTaskCommitStatusesRun(rstypes.RunPhaseRunning, rstypes.RunTaskStatusRunning, rstypes.RunTaskStatusNotStarted),
+			expectedStatuses: []string{},
+		},
+		{
+			name: "task finished",
+			run:  testTaskCommitStatusesRun(rstypes.RunPhaseRunning, rstypes.RunTaskStatusSuccess, rstypes.RunTaskStatusNotStarted),
+			expectedStatuses: []string{
+				"owner/repo sha01 agola/project01/run/build success",
+			},
+		},
+		{
+			// the not started tasks of the finished run fail
+			name: "run finished",
+			run:  testTaskCommitStatusesRun(rstypes.RunPhaseFinished, rstypes.RunTaskStatusSuccess, rstypes.RunTaskStatusNotStarted),
+			expectedStatuses: []string{
+				"owner/repo sha01 agola/project01/run/deploy failed",
+			},
+		},
+	}
+
+	for _, s := range steps {
+		gitSource := &testCommitStatusGitSource{statuses: []string{}}
+		if err := n.updateTaskCommitStatuses(context.Background(), s.run, project, gitSource); err != nil {
+			t.Fatalf("%s: unexpected err: %v", s.name, err)
+		}
+		// the run tasks map iteration order is random
+		sortedStatuses := append([]string{}, gitSource.statuses...)
+		sort.Strings(sortedStatuses)
+		if diff := cmp.Diff(s.expectedStatuses, sortedStatuses); diff != "" {
+			t.Errorf("%s: %s", s.name, diff)
+		}
+	}
+
+	// the reported statuses of the finished run are forgotten
+	if _, ok := n.taskCommitStatuses["run01"]; ok {
+		t.Errorf("expected run01 reported statuses removed")
+	}
+}
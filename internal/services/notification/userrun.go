@@ -0,0 +1,78 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path"
+
+	"agola.io/agola/internal/services/gateway/action"
+	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/services/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+// cleanupUserRunBranch removes from the gitserver the temporary branch
+// pushed by a user direct run when the run completes.
+// A completed user direct run cannot be restarted from the start since its
+// branch doesn't exist anymore.
+func (n *NotificationService) cleanupUserRunBranch(ctx context.Context, ev *rstypes.RunEvent) error {
+	if n.c.GitserverURL == "" {
+		return nil
+	}
+	if ev.Phase != rstypes.RunPhaseFinished && ev.Phase != rstypes.RunPhaseCancelled && ev.Phase != rstypes.RunPhaseSetupError {
+		return nil
+	}
+
+	run, _, err := n.runserviceClient.GetRun(ctx, ev.RunID, nil)
+	if err != nil {
+		return err
+	}
+	annotations := run.Run.Annotations
+	if annotations[action.AnnotationRunType] != string(types.RunTypeUser) {
+		return nil
+	}
+	repoPath := annotations[action.AnnotationUserRunRepoPath]
+	branch := annotations[action.AnnotationBranch]
+	if repoPath == "" || branch == "" {
+		return nil
+	}
+
+	u, err := url.Parse(n.c.GitserverURL)
+	if err != nil {
+		return errors.Errorf("failed to parse gitserver url: %w", err)
+	}
+	u.Path = path.Join(u.Path, repoPath+".git", "refs", "heads", branch)
+
+	req, err := http.NewRequest("DELETE", u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// the branch could have been already removed
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return errors.Errorf("failed to delete branch %q of repository %q: %s", branch, repoPath, resp.Status)
+	}
+
+	return nil
+}
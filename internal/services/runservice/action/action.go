@@ -23,7 +23,6 @@ import (
 	"agola.io/agola/internal/datamanager"
 	"agola.io/agola/internal/db"
 	"agola.io/agola/internal/etcd"
-	"agola.io/agola/internal/objectstorage"
 	"agola.io/agola/internal/runconfig"
 	"agola.io/agola/internal/sequence"
 	"agola.io/agola/internal/services/runservice/common"
@@ -40,17 +39,22 @@ type ActionHandler struct {
 	log    *zap.SugaredLogger
 	e      *etcd.Store
 	readDB *readdb.ReadDB
-	ost    *objectstorage.ObjStorage
+	osts   *common.ObjectStorages
 	dm     *datamanager.DataManager
+
+	executorBootstrapToken   string
+	executorApprovalRequired bool
 }
 
-func NewActionHandler(logger *zap.Logger, e *etcd.Store, readDB *readdb.ReadDB, ost *objectstorage.ObjStorage, dm *datamanager.DataManager) *ActionHandler {
+func NewActionHandler(logger *zap.Logger, e *etcd.Store, readDB *readdb.ReadDB, osts *common.ObjectStorages, dm *datamanager.DataManager, executorBootstrapToken string, executorApprovalRequired bool) *ActionHandler {
 	return &ActionHandler{
-		log:    logger.Sugar(),
-		e:      e,
-		readDB: readDB,
-		ost:    ost,
-		dm:     dm,
+		log:                      logger.Sugar(),
+		e:                        e,
+		readDB:                   readDB,
+		osts:                     osts,
+		dm:                       dm,
+		executorBootstrapToken:   executorBootstrapToken,
+		executorApprovalRequired: executorApprovalRequired,
 	}
 }
 
@@ -124,6 +128,69 @@ func (h *ActionHandler) StopRun(ctx context.Context, req *RunStopRequest) error
 		// stop only if the result is not setted yet
 		r.Stop = true
 	}
+	// a stopped run cannot be paused
+	r.Resume(time.Now())
+
+	_, err = store.AtomicPutRun(ctx, h.e, r, nil, cgt)
+	return err
+}
+
+type RunPauseRequest struct {
+	RunID string
+	// PausedBy is the user pausing the run
+	PausedBy                string
+	ChangeGroupsUpdateToken string
+}
+
+// PauseRun pauses a running run. The scheduler won't start new run tasks
+// until the run is resumed.
+func (h *ActionHandler) PauseRun(ctx context.Context, req *RunPauseRequest) error {
+	cgt, err := types.UnmarshalChangeGroupsUpdateToken(req.ChangeGroupsUpdateToken)
+	if err != nil {
+		return err
+	}
+
+	r, _, err := store.GetRun(ctx, h.e, req.RunID)
+	if err != nil {
+		return err
+	}
+
+	if r.Phase != types.RunPhaseRunning {
+		return util.NewErrBadRequest(errors.Errorf("run %s is not running but in %q phase", r.ID, r.Phase))
+	}
+	if r.Stop {
+		return util.NewErrBadRequest(errors.Errorf("run %s is being stopped", r.ID))
+	}
+	if r.Paused {
+		return util.NewErrBadRequest(errors.Errorf("run %s is already paused", r.ID))
+	}
+	r.Pause(req.PausedBy, time.Now())
+
+	_, err = store.AtomicPutRun(ctx, h.e, r, nil, cgt)
+	return err
+}
+
+type RunResumeRequest struct {
+	RunID                   string
+	ChangeGroupsUpdateToken string
+}
+
+// ResumeRun resumes a paused run
+func (h *ActionHandler) ResumeRun(ctx context.Context, req *RunResumeRequest) error {
+	cgt, err := types.UnmarshalChangeGroupsUpdateToken(req.ChangeGroupsUpdateToken)
+	if err != nil {
+		return err
+	}
+
+	r, _, err := store.GetRun(ctx, h.e, req.RunID)
+	if err != nil {
+		return err
+	}
+
+	if !r.Paused {
+		return util.NewErrBadRequest(errors.Errorf("run %s is not paused", r.ID))
+	}
+	r.Resume(time.Now())
 
 	_, err = store.AtomicPutRun(ctx, h.e, r, nil, cgt)
 	return err
@@ -136,6 +203,12 @@ type RunCreateRequest struct {
 	SetupErrors       []string
 	StaticEnvironment map[string]string
 	CacheGroup        string
+	StoragePartition  string
+
+	ArtifactsRetention time.Duration
+
+	ConfigData   string
+	ConfigFormat string
 
 	// existing run fields
 	RunID      string
@@ -145,6 +218,7 @@ type RunCreateRequest struct {
 	// common fields
 	Environment map[string]string
 	Annotations map[string]string
+	Labels      map[string]string
 
 	ChangeGroupsUpdateToken string
 }
@@ -165,7 +239,9 @@ func (h *ActionHandler) CreateRun(ctx context.Context, req *RunCreateRequest) (*
 		return nil, err
 	}
 
-	return rb, h.saveRun(ctx, rb, runcgt)
+	// the run counter is interpolated only in new runs, the recreated runs keep
+	// the values of the run they're recreated from
+	return rb, h.saveRun(ctx, rb, runcgt, req.RunID == "")
 }
 
 func (h *ActionHandler) newRun(ctx context.Context, req *RunCreateRequest) (*types.RunBundle, error) {
@@ -181,6 +257,9 @@ func (h *ActionHandler) newRun(ctx context.Context, req *RunCreateRequest) (*typ
 	if req.RunConfigTasks == nil && len(setupErrors) == 0 {
 		return nil, util.NewErrBadRequest(errors.Errorf("empty run config tasks and setup errors"))
 	}
+	if err := h.osts.Check(req.StoragePartition); err != nil {
+		return nil, err
+	}
 
 	// generate a new run sequence that will be the same for the run and runconfig
 	seq, err := sequence.IncSequence(ctx, h.e, common.EtcdRunSequenceKey)
@@ -211,10 +290,15 @@ func (h *ActionHandler) newRun(ctx context.Context, req *RunCreateRequest) (*typ
 		StaticEnvironment: req.StaticEnvironment,
 		Environment:       req.Environment,
 		Annotations:       req.Annotations,
+		Labels:            req.Labels,
 		CacheGroup:        req.CacheGroup,
+		ConfigData:        req.ConfigData,
+		ConfigFormat:      req.ConfigFormat,
 	}
 
 	run := genRun(rc)
+	run.StoragePartition = req.StoragePartition
+	run.ArtifactsRetention = req.ArtifactsRetention
 	h.log.Debugf("created run: %s", util.Dump(run))
 
 	return &types.RunBundle{
@@ -285,6 +369,7 @@ func recreateRun(uuid util.UUIDGenerator, run *types.Run, rc *types.RunConfig, n
 	run.EnqueueTime = nil
 	run.StartTime = nil
 	run.EndTime = nil
+	run.RestartedFromFailedTasks = !req.FromStart
 
 	// TODO(sgotti) handle reset tasks
 	// currently we only restart a run resetting al failed tasks
@@ -380,7 +465,7 @@ func recreateRun(uuid util.UUIDGenerator, run *types.Run, rc *types.RunConfig, n
 	}
 }
 
-func (h *ActionHandler) saveRun(ctx context.Context, rb *types.RunBundle, runcgt *types.ChangeGroupsUpdateToken) error {
+func (h *ActionHandler) saveRun(ctx context.Context, rb *types.RunBundle, runcgt *types.ChangeGroupsUpdateToken, interpolateCounter bool) error {
 	run := rb.Run
 	rc := rb.Rc
 
@@ -392,6 +477,10 @@ func (h *ActionHandler) saveRun(ctx context.Context, rb *types.RunBundle, runcgt
 	c++
 	run.Counter = c
 
+	if interpolateCounter {
+		runconfig.InterpolateRunCounter(rc.Tasks, c)
+	}
+
 	run.EnqueueTime = util.TimePtr(time.Now())
 
 	actions := []*datamanager.Action{}
@@ -466,6 +555,7 @@ func genRun(rc *types.RunConfig) *types.Run {
 		Name:        rc.Name,
 		Group:       rc.Group,
 		Annotations: rc.Annotations,
+		Labels:      rc.Labels,
 		Phase:       types.RunPhaseQueued,
 		Result:      types.RunResultUnknown,
 		Tasks:       make(map[string]*types.RunTask),
@@ -550,6 +640,69 @@ func (h *ActionHandler) ApproveRunTask(ctx context.Context, req *RunTaskApproveR
 	return err
 }
 
+type RunTaskCancelRequest struct {
+	RunID  string
+	TaskID string
+	// Dependents also cancels all the task dependents
+	Dependents bool
+	// CancelledBy is the user cancelling the task
+	CancelledBy             string
+	ChangeGroupsUpdateToken string
+}
+
+// CancelRunTask marks a run task (and optionally its dependents) to be
+// cancelled. The scheduler will cancel it if not yet started or stop its
+// executor task.
+func (h *ActionHandler) CancelRunTask(ctx context.Context, req *RunTaskCancelRequest) error {
+	cgt, err := types.UnmarshalChangeGroupsUpdateToken(req.ChangeGroupsUpdateToken)
+	if err != nil {
+		return err
+	}
+
+	r, _, err := store.GetRun(ctx, h.e, req.RunID)
+	if err != nil {
+		return err
+	}
+	if r.Phase.IsFinished() {
+		return util.NewErrBadRequest(errors.Errorf("run %q is already finished", r.ID))
+	}
+
+	task, ok := r.Tasks[req.TaskID]
+	if !ok {
+		return util.NewErrBadRequest(errors.Errorf("run %q doesn't have task %q", r.ID, req.TaskID))
+	}
+	if task.Status.IsFinished() {
+		return util.NewErrBadRequest(errors.Errorf("run %q, task %q is already finished", r.ID, req.TaskID))
+	}
+	if task.Stop {
+		return util.NewErrBadRequest(errors.Errorf("run %q, task %q is already cancelled", r.ID, req.TaskID))
+	}
+
+	tasks := []*types.RunTask{task}
+	if req.Dependents {
+		rc, err := store.OSTGetRunConfig(h.dm, r.ID)
+		if err != nil {
+			return errors.Errorf("cannot get run config %q: %w", r.ID, err)
+		}
+		for _, rct := range runconfig.GetAllChildren(rc.Tasks, rc.Tasks[task.ID]) {
+			if rt, ok := r.Tasks[rct.ID]; ok && !rt.Status.IsFinished() && !rt.Stop {
+				tasks = append(tasks, rt)
+			}
+		}
+	}
+
+	now := time.Now()
+	for _, rt := range tasks {
+		rt.Stop = true
+		rt.CancelledBy = req.CancelledBy
+		rt.CancelTime = util.TimePtr(now)
+		rt.WaitingApproval = false
+	}
+
+	_, err = store.AtomicPutRun(ctx, h.e, r, nil, cgt)
+	return err
+}
+
 func (h *ActionHandler) DeleteExecutor(ctx context.Context, executorID string) error {
 	// mark all executor tasks as failed
 	ets, err := store.GetExecutorTasks(ctx, h.e, executorID)
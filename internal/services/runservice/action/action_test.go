@@ -192,8 +192,12 @@ func TestRecreateRun(t *testing.T) {
 			rc:    rc.DeepCopy(),
 			r:     run.DeepCopy(),
 			outrc: outrc.DeepCopy(),
-			outr:  outrun.DeepCopy(),
-			req:   &RunCreateRequest{FromStart: false},
+			outr: func() *types.Run {
+				outrun := outrun.DeepCopy()
+				outrun.RestartedFromFailedTasks = true
+				return outrun
+			}(),
+			req: &RunCreateRequest{FromStart: false},
 		},
 		{
 			name: "test recreate run from start tasks with task01 failed and child task02 successful (should recreate all tasks)",
@@ -256,6 +260,7 @@ func TestRecreateRun(t *testing.T) {
 				nrun.Tasks[inuuid("task03")].Status = types.RunTaskStatusSuccess
 				nrun.Tasks[inuuid("task04")].Status = types.RunTaskStatusSuccess
 				nrun.Tasks[inuuid("task05")].Status = types.RunTaskStatusSuccess
+				nrun.RestartedFromFailedTasks = true
 
 				return nrun
 			}(),
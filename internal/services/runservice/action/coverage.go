@@ -0,0 +1,150 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"encoding/json"
+
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/objectstorage"
+	ostypes "agola.io/agola/internal/objectstorage/types"
+	"agola.io/agola/internal/services/runservice/readdb"
+	"agola.io/agola/internal/services/runservice/store"
+	"agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+func readCoverageReport(ost *objectstorage.ObjStorage, rtID string, step int) (*types.CoverageReport, error) {
+	f, err := ost.ReadObject(store.OSTRunTaskCoverageReportPath(rtID, step))
+	if err != nil {
+		if err == ostypes.ErrNotExist {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var report *types.CoverageReport
+	if err := json.NewDecoder(f).Decode(&report); err != nil {
+		return nil, errors.Errorf("failed to decode coverage report: %w", err)
+	}
+	return report, nil
+}
+
+// runCoverage returns the run coverage summing the coverage reports saved by
+// all the run tasks. It returns nil if the run doesn't have coverage reports.
+// NOTE: the tasks reports are just summed so the files covered by more than
+// one task are counted multiple times.
+func (h *ActionHandler) runCoverage(run *types.Run, rc *types.RunConfig) (*types.CoverageReport, error) {
+	ost, err := h.osts.DataOST(run.StoragePartition)
+	if err != nil {
+		return nil, err
+	}
+
+	var res *types.CoverageReport
+	for _, rt := range run.Tasks {
+		rct, ok := rc.Tasks[rt.ID]
+		if !ok {
+			continue
+		}
+		for i, step := range rct.Steps {
+			if _, ok := step.(*types.SaveCoverageReportStep); !ok {
+				continue
+			}
+			report, err := readCoverageReport(ost, rt.ID, i)
+			if err != nil {
+				return nil, err
+			}
+			if report == nil {
+				continue
+			}
+			if res == nil {
+				res = &types.CoverageReport{Format: report.Format}
+			}
+			res.Add(report)
+		}
+	}
+
+	return res, nil
+}
+
+// GetRunCoverage returns the run coverage. An empty report is returned if the
+// run doesn't have coverage reports.
+func (h *ActionHandler) GetRunCoverage(ctx context.Context, runID string) (*types.CoverageReport, error) {
+	run, rc, err := h.getRunAndRunConfig(runID)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := h.runCoverage(run, rc)
+	if err != nil {
+		return nil, err
+	}
+	if report == nil {
+		report = &types.CoverageReport{}
+	}
+
+	return report, nil
+}
+
+// GetCoverageHistory returns the coverage of the last finished runs of a group
+// with coverage reports, from the newest to the oldest
+func (h *ActionHandler) GetCoverageHistory(ctx context.Context, group string, limit int) ([]*types.CoverageHistoryEntry, error) {
+	if group == "" {
+		return nil, util.NewErrBadRequest(errors.Errorf("empty group"))
+	}
+
+	var runs []*types.Run
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		var err error
+		runs, err = h.readDB.GetRuns(tx, &readdb.GetRunsOptions{
+			Groups:      []string{group},
+			PhaseFilter: []types.RunPhase{types.RunPhaseFinished},
+			Limit:       limit,
+			SortOrder:   types.SortOrderDesc,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []*types.CoverageHistoryEntry{}
+	for _, run := range runs {
+		rc, err := store.OSTGetRunConfig(h.dm, run.ID)
+		if err != nil {
+			h.log.Warnf("failed to get run config %q: %+v", run.ID, err)
+			continue
+		}
+		report, err := h.runCoverage(run, rc)
+		if err != nil {
+			return nil, err
+		}
+		if report == nil {
+			continue
+		}
+		entries = append(entries, &types.CoverageHistoryEntry{
+			RunID:      run.ID,
+			RunCounter: run.Counter,
+			EndTime:    run.EndTime,
+			Coverage:   report,
+		})
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+
+	"agola.io/agola/internal/etcd"
+	"agola.io/agola/internal/services/runservice/store"
+	"agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+func executorTokenHash(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+func tokenMatches(token, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+type UpdateExecutorStatusRequest struct {
+	Executor *types.Executor
+
+	BootstrapToken string
+	Token          string
+	RemoteAddress  string
+}
+
+// executorAuthEnabled reports if the executors must register and be approved
+// before receiving tasks
+func (h *ActionHandler) executorAuthEnabled() bool {
+	return h.executorBootstrapToken != "" || h.executorApprovalRequired
+}
+
+// UpdateExecutorStatus registers a new executor or updates the status of an
+// already registered executor.
+// When an executor bootstrap token is configured, new executors must provide
+// it. When an executor bootstrap token is configured or the executor approval
+// is required, new executors are registered waiting for an admin approval and
+// the executor token provided at registration must be provided in all the
+// next requests.
+func (h *ActionHandler) UpdateExecutorStatus(ctx context.Context, req *UpdateExecutorStatusRequest) (*types.Executor, error) {
+	executor := req.Executor
+	executor.RemoteAddress = req.RemoteAddress
+
+	if !h.executorAuthEnabled() {
+		executor.WaitingApproval = false
+		executor.TokenHash = ""
+		return store.PutExecutor(ctx, h.e, executor)
+	}
+
+	curExecutor, err := store.GetExecutor(ctx, h.e, executor.ID)
+	if err != nil && err != etcd.ErrKeyNotFound {
+		return nil, err
+	}
+
+	// executors registered before enabling the bootstrap token don't have a
+	// token hash and must register again
+	if curExecutor == nil || curExecutor.TokenHash == "" {
+		if h.executorBootstrapToken != "" && !tokenMatches(req.BootstrapToken, h.executorBootstrapToken) {
+			return nil, util.NewErrUnauthorized(errors.Errorf("wrong executor bootstrap token"))
+		}
+		if req.Token == "" {
+			return nil, util.NewErrBadRequest(errors.Errorf("empty executor token"))
+		}
+		executor.TokenHash = executorTokenHash(req.Token)
+		executor.WaitingApproval = true
+		if curExecutor != nil {
+			executor.Revision = curExecutor.Revision
+		}
+
+		h.log.Infof("executor %q registered from %q, waiting approval", executor.ID, executor.RemoteAddress)
+		return store.AtomicPutExecutor(ctx, h.e, executor)
+	}
+
+	if !tokenMatches(executorTokenHash(req.Token), curExecutor.TokenHash) {
+		return nil, util.NewErrUnauthorized(errors.Errorf("wrong executor token"))
+	}
+
+	executor.TokenHash = curExecutor.TokenHash
+	executor.WaitingApproval = curExecutor.WaitingApproval
+	executor.Revision = curExecutor.Revision
+
+	return store.AtomicPutExecutor(ctx, h.e, executor)
+}
+
+// CheckExecutorAuth checks that the executor is registered, its token matches
+// and it's approved. It always succeeds if no executor bootstrap token is
+// configured and the executor approval isn't required.
+func (h *ActionHandler) CheckExecutorAuth(ctx context.Context, executorID, token string) error {
+	if !h.executorAuthEnabled() {
+		return nil
+	}
+
+	executor, err := store.GetExecutor(ctx, h.e, executorID)
+	if err != nil && err != etcd.ErrKeyNotFound {
+		return err
+	}
+	if executor == nil || executor.TokenHash == "" {
+		return util.NewErrUnauthorized(errors.Errorf("executor %q not registered", executorID))
+	}
+	if !tokenMatches(executorTokenHash(token), executor.TokenHash) {
+		return util.NewErrUnauthorized(errors.Errorf("wrong executor token"))
+	}
+	if executor.WaitingApproval {
+		return util.NewErrForbidden(errors.Errorf("executor %q is waiting approval", executorID))
+	}
+
+	return nil
+}
+
+func (h *ActionHandler) GetExecutors(ctx context.Context) ([]*types.Executor, error) {
+	return store.GetExecutors(ctx, h.e)
+}
+
+func (h *ActionHandler) ApproveExecutor(ctx context.Context, executorID string) error {
+	executor, err := store.GetExecutor(ctx, h.e, executorID)
+	if err != nil && err != etcd.ErrKeyNotFound {
+		return err
+	}
+	if executor == nil {
+		return util.NewErrNotFound(errors.Errorf("executor %q doesn't exist", executorID))
+	}
+	if !executor.WaitingApproval {
+		return util.NewErrBadRequest(errors.Errorf("executor %q is already approved", executorID))
+	}
+
+	executor.WaitingApproval = false
+	_, err = store.AtomicPutExecutor(ctx, h.e, executor)
+	return err
+}
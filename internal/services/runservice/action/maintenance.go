@@ -0,0 +1,77 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"time"
+
+	"agola.io/agola/internal/etcd"
+	"agola.io/agola/internal/services/runservice/store"
+	"agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+func (h *ActionHandler) GetMaintenance(ctx context.Context) (*types.Maintenance, error) {
+	return store.GetMaintenance(ctx, h.e)
+}
+
+// EnableMaintenance enables the maintenance mode. While enabled the runs
+// aren't scheduled and the finished runs aren't archived.
+func (h *ActionHandler) EnableMaintenance(ctx context.Context) (*types.Maintenance, error) {
+	maintenance, err := store.GetMaintenance(ctx, h.e)
+	if err != nil {
+		return nil, err
+	}
+	if maintenance.Enabled {
+		return maintenance, nil
+	}
+
+	now := time.Now()
+	maintenance = &types.Maintenance{
+		Enabled:    true,
+		EnableTime: &now,
+	}
+	h.log.Infof("enabling maintenance mode")
+	return store.PutMaintenance(ctx, h.e, maintenance)
+}
+
+func (h *ActionHandler) DisableMaintenance(ctx context.Context) error {
+	h.log.Infof("disabling maintenance mode")
+	return store.DeleteMaintenance(ctx, h.e)
+}
+
+func (h *ActionHandler) QueueWebhook(ctx context.Context, qw *types.QueuedWebhook) (*types.QueuedWebhook, error) {
+	if qw.ProjectID == "" {
+		return nil, util.NewErrBadRequest(errors.Errorf("empty project id"))
+	}
+	qw.QueueTime = time.Now()
+
+	return store.QueueWebhook(ctx, h.e, qw)
+}
+
+func (h *ActionHandler) GetQueuedWebhooks(ctx context.Context) ([]*types.QueuedWebhook, error) {
+	return store.GetQueuedWebhooks(ctx, h.e)
+}
+
+func (h *ActionHandler) DeleteQueuedWebhook(ctx context.Context, id string) error {
+	err := store.DeleteQueuedWebhook(ctx, h.e, id)
+	if err == etcd.ErrKeyNotFound {
+		return util.NewErrNotFound(errors.Errorf("queued webhook %q doesn't exist", id))
+	}
+	return err
+}
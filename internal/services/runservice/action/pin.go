@@ -0,0 +1,129 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"agola.io/agola/internal/datamanager"
+	"agola.io/agola/internal/etcd"
+	"agola.io/agola/internal/objectstorage"
+	ostypes "agola.io/agola/internal/objectstorage/types"
+	"agola.io/agola/internal/services/runservice/store"
+	"agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+type RunPinRequest struct {
+	RunID                   string
+	Pinned                  bool
+	ChangeGroupsUpdateToken string
+}
+
+// PinRun pins or unpins a run. The tasks workspace archives of a pinned run
+// are exempt from the artifacts retention. When the run is unpinned the
+// retention starts again from the task end time.
+func (h *ActionHandler) PinRun(ctx context.Context, req *RunPinRequest) error {
+	cgt, err := types.UnmarshalChangeGroupsUpdateToken(req.ChangeGroupsUpdateToken)
+	if err != nil {
+		return err
+	}
+
+	r, _, err := store.GetRun(ctx, h.e, req.RunID)
+	if err != nil && err != etcd.ErrKeyNotFound {
+		return err
+	}
+	if r != nil {
+		if r.Archived {
+			return util.NewErrBadRequest(errors.Errorf("run %q is being archived, retry later", r.ID))
+		}
+		if r.Pinned == req.Pinned {
+			return nil
+		}
+		r.Pinned = req.Pinned
+		if _, err := store.AtomicPutRun(ctx, h.e, r, nil, cgt); err != nil {
+			return err
+		}
+	} else {
+		r, err = store.OSTGetRun(h.dm, req.RunID)
+		if err != nil {
+			if err == ostypes.ErrNotExist {
+				return util.NewErrNotFound(errors.Errorf("run %q doesn't exist", req.RunID))
+			}
+			return err
+		}
+		if r.Pinned == req.Pinned {
+			return nil
+		}
+		r.Pinned = req.Pinned
+		ra, err := store.OSTSaveRunAction(r)
+		if err != nil {
+			return err
+		}
+		if _, err := h.dm.WriteWal(ctx, []*datamanager.Action{ra}, nil); err != nil {
+			return err
+		}
+	}
+
+	return h.updateArchivesExpireTime(r)
+}
+
+// updateArchivesExpireTime removes the run tasks archives expiration time when
+// the run is pinned and restores it when the run is unpinned. The archives
+// of the tasks still being fetched are handled by the scheduler.
+func (h *ActionHandler) updateArchivesExpireTime(r *types.Run) error {
+	if r.ArtifactsRetention == 0 {
+		return nil
+	}
+	ost, err := h.osts.DataOST(r.StoragePartition)
+	if err != nil {
+		return err
+	}
+
+	for _, rt := range r.Tasks {
+		if len(rt.WorkspaceArchives) == 0 || !rt.ArchivesFetchFinished() {
+			continue
+		}
+		expirePath := store.OSTRunTaskArchivesExpirePath(rt.ID)
+		if r.Pinned {
+			if err := ost.DeleteObject(expirePath); err != nil && err != ostypes.ErrNotExist {
+				return err
+			}
+			continue
+		}
+		if err := writeArchivesExpireTime(ost, expirePath, archivesExpireTime(r, rt)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func archivesExpireTime(r *types.Run, rt *types.RunTask) time.Time {
+	endTime := time.Now()
+	if rt.EndTime != nil {
+		endTime = *rt.EndTime
+	}
+	return endTime.Add(r.ArtifactsRetention)
+}
+
+func writeArchivesExpireTime(ost *objectstorage.ObjStorage, expirePath string, expireTime time.Time) error {
+	data := []byte(expireTime.Format(time.RFC3339))
+	return ost.WriteObject(expirePath, bytes.NewReader(data), int64(len(data)), false)
+}
@@ -0,0 +1,207 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"encoding/json"
+
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/objectstorage"
+	ostypes "agola.io/agola/internal/objectstorage/types"
+	"agola.io/agola/internal/services/runservice/readdb"
+	"agola.io/agola/internal/services/runservice/store"
+	"agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+// readTestReport reads the test report saved by a run task step. It returns
+// nil if the step didn't save a test report (i.e. it failed or wasn't
+// executed)
+func readTestReport(ost *objectstorage.ObjStorage, rtID string, step int) (*types.TestReport, error) {
+	f, err := ost.ReadObject(store.OSTRunTaskTestReportPath(rtID, step))
+	if err != nil {
+		if err == ostypes.ErrNotExist {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var report *types.TestReport
+	if err := json.NewDecoder(f).Decode(&report); err != nil {
+		return nil, errors.Errorf("failed to decode test report: %w", err)
+	}
+	return report, nil
+}
+
+// runTaskTestReports returns the test reports saved by the save test report
+// steps of a run task
+func (h *ActionHandler) runTaskTestReports(ost *objectstorage.ObjStorage, rt *types.RunTask, rct *types.RunConfigTask) ([]*types.TestReport, error) {
+	reports := []*types.TestReport{}
+	for i, step := range rct.Steps {
+		if _, ok := step.(*types.SaveTestReportStep); !ok {
+			continue
+		}
+		report, err := readTestReport(ost, rt.ID, i)
+		if err != nil {
+			return nil, err
+		}
+		if report != nil {
+			reports = append(reports, report)
+		}
+	}
+	return reports, nil
+}
+
+func (h *ActionHandler) getRunAndRunConfig(runID string) (*types.Run, *types.RunConfig, error) {
+	var run *types.Run
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		var err error
+		run, err = h.readDB.GetRun(tx, runID)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if run == nil {
+		return nil, nil, util.NewErrNotFound(errors.Errorf("run %q doesn't exist", runID))
+	}
+
+	rc, err := store.OSTGetRunConfig(h.dm, run.ID)
+	if err != nil {
+		return nil, nil, errors.Errorf("failed to get run config %q: %w", run.ID, err)
+	}
+
+	return run, rc, nil
+}
+
+// GetRunTaskTestReport returns the test report of a run task merging the
+// reports saved by all its save test report steps
+func (h *ActionHandler) GetRunTaskTestReport(ctx context.Context, runID, taskID string) (*types.TestReport, error) {
+	run, rc, err := h.getRunAndRunConfig(runID)
+	if err != nil {
+		return nil, err
+	}
+	rt, ok := run.Tasks[taskID]
+	if !ok {
+		return nil, util.NewErrNotFound(errors.Errorf("run %q task %q doesn't exist", runID, taskID))
+	}
+	rct := rc.Tasks[taskID]
+
+	ost, err := h.osts.DataOST(run.StoragePartition)
+	if err != nil {
+		return nil, err
+	}
+	reports, err := h.runTaskTestReports(ost, rt, rct)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &types.TestReport{
+		Tests: []*types.TestCase{},
+	}
+	for _, report := range reports {
+		if res.Format == "" {
+			res.Format = report.Format
+		}
+		for _, tc := range report.Tests {
+			res.Tests = append(res.Tests, tc)
+			res.Summary.Add(tc)
+		}
+	}
+
+	return res, nil
+}
+
+type GetTestCaseHistoryRequest struct {
+	Group string
+	// Suite is optional, when empty the test cases with the same name in
+	// every suite are returned
+	Suite string
+	Name  string
+	// Limit is the number of last finished runs to inspect
+	Limit int
+}
+
+// GetTestCaseHistory returns the results of a test case in the last finished
+// runs of a group, from the newest to the oldest
+func (h *ActionHandler) GetTestCaseHistory(ctx context.Context, req *GetTestCaseHistoryRequest) ([]*types.TestCaseHistoryEntry, error) {
+	if req.Group == "" {
+		return nil, util.NewErrBadRequest(errors.Errorf("empty group"))
+	}
+	if req.Name == "" {
+		return nil, util.NewErrBadRequest(errors.Errorf("empty test case name"))
+	}
+
+	var runs []*types.Run
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		var err error
+		runs, err = h.readDB.GetRuns(tx, &readdb.GetRunsOptions{
+			Groups:      []string{req.Group},
+			PhaseFilter: []types.RunPhase{types.RunPhaseFinished},
+			Limit:       req.Limit,
+			SortOrder:   types.SortOrderDesc,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []*types.TestCaseHistoryEntry{}
+	for _, run := range runs {
+		rc, err := store.OSTGetRunConfig(h.dm, run.ID)
+		if err != nil {
+			h.log.Warnf("failed to get run config %q: %+v", run.ID, err)
+			continue
+		}
+		ost, err := h.osts.DataOST(run.StoragePartition)
+		if err != nil {
+			h.log.Warnf("failed to get run %q object storage: %+v", run.ID, err)
+			continue
+		}
+
+		for _, rt := range run.Tasks {
+			rct, ok := rc.Tasks[rt.ID]
+			if !ok {
+				continue
+			}
+			reports, err := h.runTaskTestReports(ost, rt, rct)
+			if err != nil {
+				return nil, err
+			}
+			for _, report := range reports {
+				for _, tc := range report.Tests {
+					if tc.Name != req.Name || (req.Suite != "" && tc.Suite != req.Suite) {
+						continue
+					}
+					entries = append(entries, &types.TestCaseHistoryEntry{
+						RunID:      run.ID,
+						RunCounter: run.Counter,
+						TaskID:     rt.ID,
+						TaskName:   rct.Name,
+						EndTime:    rt.EndTime,
+						TestCase:   tc,
+					})
+				}
+			}
+		}
+	}
+
+	return entries, nil
+}
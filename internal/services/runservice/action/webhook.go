@@ -0,0 +1,56 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"time"
+
+	"agola.io/agola/internal/etcd"
+	"agola.io/agola/internal/services/runservice/store"
+	"agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+func (h *ActionHandler) CreateFailedWebhook(ctx context.Context, fw *types.FailedWebhook) (*types.FailedWebhook, error) {
+	if fw.ProjectID == "" {
+		return nil, util.NewErrBadRequest(errors.Errorf("empty project id"))
+	}
+	fw.FailureTime = time.Now()
+
+	return store.CreateFailedWebhook(ctx, h.e, fw)
+}
+
+func (h *ActionHandler) GetFailedWebhook(ctx context.Context, id string) (*types.FailedWebhook, error) {
+	fw, err := store.GetFailedWebhook(ctx, h.e, id)
+	if err == etcd.ErrKeyNotFound {
+		return nil, util.NewErrNotFound(errors.Errorf("failed webhook %q doesn't exist", id))
+	}
+	return fw, err
+}
+
+func (h *ActionHandler) GetFailedWebhooks(ctx context.Context) ([]*types.FailedWebhook, error) {
+	return store.GetFailedWebhooks(ctx, h.e)
+}
+
+func (h *ActionHandler) DeleteFailedWebhook(ctx context.Context, id string) error {
+	err := store.DeleteFailedWebhook(ctx, h.e, id)
+	if err == etcd.ErrKeyNotFound {
+		return util.NewErrNotFound(errors.Errorf("failed webhook %q doesn't exist", id))
+	}
+	return err
+}
@@ -21,6 +21,7 @@ import (
 	"io"
 	"net/http"
 	"strconv"
+	"time"
 
 	"agola.io/agola/internal/datamanager"
 	"agola.io/agola/internal/db"
@@ -133,18 +134,20 @@ func httpResponse(w http.ResponseWriter, code int, res interface{}) error {
 }
 
 type LogsHandler struct {
-	log *zap.SugaredLogger
-	e   *etcd.Store
-	ost *objectstorage.ObjStorage
-	dm  *datamanager.DataManager
+	log              *zap.SugaredLogger
+	e                *etcd.Store
+	osts             *common.ObjectStorages
+	dm               *datamanager.DataManager
+	executorAPIToken string
 }
 
-func NewLogsHandler(logger *zap.Logger, e *etcd.Store, ost *objectstorage.ObjStorage, dm *datamanager.DataManager) *LogsHandler {
+func NewLogsHandler(logger *zap.Logger, e *etcd.Store, osts *common.ObjectStorages, dm *datamanager.DataManager, executorAPIToken string) *LogsHandler {
 	return &LogsHandler{
-		log: logger.Sugar(),
-		e:   e,
-		ost: ost,
-		dm:  dm,
+		log:              logger.Sugar(),
+		e:                e,
+		osts:             osts,
+		dm:               dm,
+		executorAPIToken: executorAPIToken,
 	}
 }
 
@@ -185,12 +188,25 @@ func (h *LogsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	attempt := -1
+	if attemptStr := q.Get("attempt"); attemptStr != "" {
+		var err error
+		attempt, err = strconv.Atoi(attemptStr)
+		if err != nil || attempt < 0 {
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+	}
+
 	follow := false
 	if _, ok := q["follow"]; ok {
 		follow = true
 	}
+	// full returns the full log of a truncated log, available only on the
+	// executor
+	_, full := q["full"]
 
-	if err, sendError := h.readTaskLogs(ctx, runID, taskID, setup, step, w, follow); err != nil {
+	if err, sendError := h.readTaskLogs(ctx, runID, taskID, setup, step, attempt, full, w, follow); err != nil {
 		h.log.Errorf("err: %+v", err)
 		if sendError {
 			switch err.(type) {
@@ -203,7 +219,7 @@ func (h *LogsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *LogsHandler) readTaskLogs(ctx context.Context, runID, taskID string, setup bool, step int, w http.ResponseWriter, follow bool) (error, bool) {
+func (h *LogsHandler) readTaskLogs(ctx context.Context, runID, taskID string, setup bool, step, attempt int, full bool, w http.ResponseWriter, follow bool) (error, bool) {
 	r, err := store.GetRunEtcdOrOST(ctx, h.e, h.dm, runID)
 	if err != nil {
 		return err, true
@@ -221,14 +237,23 @@ func (h *LogsHandler) readTaskLogs(ctx context.Context, runID, taskID string, se
 	}
 
 	// if the log has been already fetched use it, otherwise fetch it from the executor
-	if task.Steps[step].LogPhase == types.RunTaskFetchPhaseFinished {
+	if task.Steps[step].LogPhase == types.RunTaskFetchPhaseFinished && !full {
 		var logPath string
-		if setup {
+		switch {
+		case setup && attempt >= 0:
+			logPath = store.OSTRunTaskSetupAttemptLogPath(task.ID, attempt)
+		case setup:
 			logPath = store.OSTRunTaskSetupLogPath(task.ID)
-		} else {
+		case attempt >= 0:
+			logPath = store.OSTRunTaskStepAttemptLogPath(task.ID, step, attempt)
+		default:
 			logPath = store.OSTRunTaskStepLogPath(task.ID, step)
 		}
-		f, err := h.ost.ReadObject(logPath)
+		ost, err := h.osts.LogsOST(r.StoragePartition)
+		if err != nil {
+			return err, true
+		}
+		f, err := ost.ReadObject(logPath)
 		if err != nil {
 			if err == ostypes.ErrNotExist {
 				return common.NewErrNotExist(err), true
@@ -241,6 +266,9 @@ func (h *LogsHandler) readTaskLogs(ctx context.Context, runID, taskID string, se
 
 	et, err := store.GetExecutorTask(ctx, h.e, task.ID)
 	if err != nil {
+		if err == etcd.ErrKeyNotFound && full {
+			return common.NewErrNotExist(errors.Errorf("the full log isn't available anymore")), true
+		}
 		return err, true
 	}
 	executor, err := store.GetExecutor(ctx, h.e, et.Status.ExecutorID)
@@ -257,10 +285,21 @@ func (h *LogsHandler) readTaskLogs(ctx context.Context, runID, taskID string, se
 	} else {
 		url = fmt.Sprintf("%s/api/v1alpha/executor/logs?taskid=%s&step=%d", executor.ListenURL, taskID, step)
 	}
+	if attempt >= 0 {
+		url += fmt.Sprintf("&attempt=%d", attempt)
+	}
 	if follow {
 		url += "&follow"
 	}
-	req, err := http.Get(url)
+	if full {
+		url += "&full"
+	}
+	ereq, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err, true
+	}
+	ereq.Header = common.ExecutorAPIHeader(h.executorAPIToken)
+	req, err := http.DefaultClient.Do(ereq.WithContext(ctx))
 	if err != nil {
 		return err, true
 	}
@@ -424,6 +463,102 @@ func (h *RunHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type RunByCounterHandler struct {
+	log    *zap.SugaredLogger
+	dm     *datamanager.DataManager
+	readDB *readdb.ReadDB
+}
+
+func NewRunByCounterHandler(logger *zap.Logger, dm *datamanager.DataManager, readDB *readdb.ReadDB) *RunByCounterHandler {
+	return &RunByCounterHandler{
+		log:    logger.Sugar(),
+		dm:     dm,
+		readDB: readDB,
+	}
+}
+
+func (h *RunByCounterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	group := query.Get("group")
+	if group == "" {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("empty group")))
+		return
+	}
+	counter, err := strconv.ParseUint(query.Get("counter"), 10, 64)
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse counter: %w", err)))
+		return
+	}
+
+	var run *types.Run
+	err = h.readDB.Do(func(tx *db.Tx) error {
+		var err error
+		run, err = h.readDB.GetRunByCounter(tx, group, counter)
+		return err
+	})
+	if err != nil {
+		h.log.Errorf("err: %+v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if run == nil {
+		httpError(w, util.NewErrNotFound(errors.Errorf("run with counter %d in group %q doesn't exist", counter, group)))
+		return
+	}
+
+	rc, err := store.OSTGetRunConfig(h.dm, run.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res := &RunResponse{
+		Run:       run,
+		RunConfig: rc,
+	}
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type RunNamesHandler struct {
+	log    *zap.SugaredLogger
+	readDB *readdb.ReadDB
+}
+
+func NewRunNamesHandler(logger *zap.Logger, readDB *readdb.ReadDB) *RunNamesHandler {
+	return &RunNamesHandler{
+		log:    logger.Sugar(),
+		readDB: readDB,
+	}
+}
+
+func (h *RunNamesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	group := query.Get("group")
+	if group == "" {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("empty group")))
+		return
+	}
+
+	var names []string
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		var err error
+		names, err = h.readDB.GetRunNames(tx, group)
+		return err
+	})
+	if err != nil {
+		h.log.Errorf("err: %+v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, names); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
 const (
 	DefaultRunsLimit = 25
 	MaxRunsLimit     = 40
@@ -453,7 +588,14 @@ func (h *RunsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	changeGroups := query["changegroup"]
 	groups := query["group"]
+	names := query["name"]
 	_, lastRun := query["lastrun"]
+	_, pinned := query["pinned"]
+	labels, err := types.RunLabelsFromStringSlice(query["label"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	limitS := query.Get("limit")
 	limit := DefaultRunsLimit
@@ -482,9 +624,20 @@ func (h *RunsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	var runs []*types.Run
 	var cgt *types.ChangeGroupsUpdateToken
 
-	err := h.readDB.Do(func(tx *db.Tx) error {
+	err = h.readDB.Do(func(tx *db.Tx) error {
 		var err error
-		runs, err = h.readDB.GetRuns(tx, groups, lastRun, phaseFilter, resultFilter, start, limit, sortOrder)
+		runs, err = h.readDB.GetRuns(tx, &readdb.GetRunsOptions{
+			Groups:       groups,
+			Names:        names,
+			Labels:       labels,
+			LastRun:      lastRun,
+			PhaseFilter:  phaseFilter,
+			ResultFilter: resultFilter,
+			Pinned:       pinned,
+			StartRunID:   start,
+			Limit:        limit,
+			SortOrder:    sortOrder,
+		})
 		if err != nil {
 			h.log.Errorf("err: %+v", err)
 			return err
@@ -513,6 +666,292 @@ func (h *RunsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+const (
+	DefaultTasksFlakinessRunsLimit = 100
+	MaxTasksFlakinessRunsLimit     = 1000
+)
+
+type TasksFlakinessHandler struct {
+	log    *zap.SugaredLogger
+	readDB *readdb.ReadDB
+}
+
+func NewTasksFlakinessHandler(logger *zap.Logger, readDB *readdb.ReadDB) *TasksFlakinessHandler {
+	return &TasksFlakinessHandler{
+		log:    logger.Sugar(),
+		readDB: readDB,
+	}
+}
+
+func (h *TasksFlakinessHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	group := query.Get("group")
+	if group == "" {
+		http.Error(w, "empty group", http.StatusBadRequest)
+		return
+	}
+
+	limitS := query.Get("limit")
+	limit := DefaultTasksFlakinessRunsLimit
+	if limitS != "" {
+		var err error
+		limit, err = strconv.Atoi(limitS)
+		if err != nil {
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+	}
+	if limit < 0 {
+		http.Error(w, "limit must be greater or equal than 0", http.StatusBadRequest)
+		return
+	}
+	if limit == 0 || limit > MaxTasksFlakinessRunsLimit {
+		limit = MaxTasksFlakinessRunsLimit
+	}
+
+	var tfs []*types.TaskFlakiness
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		var err error
+		tfs, err = h.readDB.GetTasksFlakinessOST(tx, group, limit)
+		return err
+	})
+	if err != nil {
+		h.log.Errorf("err: %+v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, tfs); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+const (
+	DefaultRunsStatsHotspotsLimit = 10
+)
+
+type RunsStatsHandler struct {
+	log    *zap.SugaredLogger
+	readDB *readdb.ReadDB
+}
+
+func NewRunsStatsHandler(logger *zap.Logger, readDB *readdb.ReadDB) *RunsStatsHandler {
+	return &RunsStatsHandler{
+		log:    logger.Sugar(),
+		readDB: readDB,
+	}
+}
+
+func (h *RunsStatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	group := query.Get("group")
+	if group == "" {
+		http.Error(w, "empty group", http.StatusBadRequest)
+		return
+	}
+
+	var since time.Time
+	if sinceS := query.Get("since"); sinceS != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, sinceS)
+		if err != nil {
+			http.Error(w, "wrong since time", http.StatusBadRequest)
+			return
+		}
+	}
+
+	hotspotsLimit := DefaultRunsStatsHotspotsLimit
+	if limitS := query.Get("hotspotslimit"); limitS != "" {
+		var err error
+		hotspotsLimit, err = strconv.Atoi(limitS)
+		if err != nil || hotspotsLimit < 0 {
+			http.Error(w, "hotspotslimit must be greater or equal than 0", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var stats *types.RunsStats
+	err := h.readDB.Do(func(tx *db.Tx) error {
+		var err error
+		stats, err = h.readDB.GetRunsStatsOST(tx, group, since, hotspotsLimit)
+		return err
+	})
+	if err != nil {
+		h.log.Errorf("err: %+v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, stats); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type RunTaskTestReportHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewRunTaskTestReportHandler(logger *zap.Logger, ah *action.ActionHandler) *RunTaskTestReportHandler {
+	return &RunTaskTestReportHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *RunTaskTestReportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	runID := vars["runid"]
+	taskID := vars["taskid"]
+
+	report, err := h.ah.GetRunTaskTestReport(ctx, runID, taskID)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, report); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+const (
+	DefaultTestCaseHistoryRunsLimit = 20
+	MaxTestCaseHistoryRunsLimit     = 100
+)
+
+type TestCaseHistoryHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewTestCaseHistoryHandler(logger *zap.Logger, ah *action.ActionHandler) *TestCaseHistoryHandler {
+	return &TestCaseHistoryHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *TestCaseHistoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	limitS := query.Get("limit")
+	limit := DefaultTestCaseHistoryRunsLimit
+	if limitS != "" {
+		var err error
+		limit, err = strconv.Atoi(limitS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse limit: %w", err)))
+			return
+		}
+	}
+	if limit < 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("limit must be greater or equal than 0")))
+		return
+	}
+	if limit == 0 || limit > MaxTestCaseHistoryRunsLimit {
+		limit = MaxTestCaseHistoryRunsLimit
+	}
+
+	req := &action.GetTestCaseHistoryRequest{
+		Group: query.Get("group"),
+		Suite: query.Get("suite"),
+		Name:  query.Get("name"),
+		Limit: limit,
+	}
+	entries, err := h.ah.GetTestCaseHistory(ctx, req)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, entries); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type RunCoverageHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewRunCoverageHandler(logger *zap.Logger, ah *action.ActionHandler) *RunCoverageHandler {
+	return &RunCoverageHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *RunCoverageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	runID := vars["runid"]
+
+	report, err := h.ah.GetRunCoverage(ctx, runID)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, report); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+const (
+	DefaultCoverageHistoryRunsLimit = 20
+	MaxCoverageHistoryRunsLimit     = 100
+)
+
+type CoverageHistoryHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewCoverageHistoryHandler(logger *zap.Logger, ah *action.ActionHandler) *CoverageHistoryHandler {
+	return &CoverageHistoryHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *CoverageHistoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	limitS := query.Get("limit")
+	limit := DefaultCoverageHistoryRunsLimit
+	if limitS != "" {
+		var err error
+		limit, err = strconv.Atoi(limitS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse limit: %w", err)))
+			return
+		}
+	}
+	if limit < 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("limit must be greater or equal than 0")))
+		return
+	}
+	if limit == 0 || limit > MaxCoverageHistoryRunsLimit {
+		limit = MaxCoverageHistoryRunsLimit
+	}
+
+	entries, err := h.ah.GetCoverageHistory(ctx, query.Get("group"), limit)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, entries); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
 type RunCreateRequest struct {
 	// new run fields
 	RunConfigTasks    map[string]*types.RunConfigTask `json:"run_config_tasks"`
@@ -521,6 +960,12 @@ type RunCreateRequest struct {
 	SetupErrors       []string                        `json:"setup_errors"`
 	StaticEnvironment map[string]string               `json:"static_environment"`
 	CacheGroup        string                          `json:"cache_group"`
+	StoragePartition  string                          `json:"storage_partition"`
+
+	ArtifactsRetention time.Duration `json:"artifacts_retention"`
+
+	ConfigData   string `json:"config_data"`
+	ConfigFormat string `json:"config_format"`
 
 	// existing run fields
 	RunID      string   `json:"run_id"`
@@ -530,6 +975,7 @@ type RunCreateRequest struct {
 	// common fields
 	Environment map[string]string `json:"environment"`
 	Annotations map[string]string `json:"annotations"`
+	Labels      map[string]string `json:"labels"`
 
 	ChangeGroupsUpdateToken string `json:"changeup_update_tokens"`
 }
@@ -563,6 +1009,12 @@ func (h *RunCreateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		SetupErrors:       req.SetupErrors,
 		StaticEnvironment: req.StaticEnvironment,
 		CacheGroup:        req.CacheGroup,
+		StoragePartition:  req.StoragePartition,
+
+		ArtifactsRetention: req.ArtifactsRetention,
+
+		ConfigData:   req.ConfigData,
+		ConfigFormat: req.ConfigFormat,
 
 		RunID:      req.RunID,
 		FromStart:  req.FromStart,
@@ -570,6 +1022,7 @@ func (h *RunCreateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 		Environment:             req.Environment,
 		Annotations:             req.Annotations,
+		Labels:                  req.Labels,
 		ChangeGroupsUpdateToken: req.ChangeGroupsUpdateToken,
 	}
 	rb, err := h.ah.CreateRun(ctx, creq)
@@ -594,6 +1047,10 @@ type RunActionType string
 const (
 	RunActionTypeChangePhase RunActionType = "changephase"
 	RunActionTypeStop        RunActionType = "stop"
+	RunActionTypePause       RunActionType = "pause"
+	RunActionTypeResume      RunActionType = "resume"
+	RunActionTypePin         RunActionType = "pin"
+	RunActionTypeUnpin       RunActionType = "unpin"
 )
 
 type RunActionsRequest struct {
@@ -601,6 +1058,9 @@ type RunActionsRequest struct {
 
 	Phase                   types.RunPhase `json:"phase"`
 	ChangeGroupsUpdateToken string         `json:"change_groups_update_tokens"`
+
+	// PausedBy is the user pausing the run
+	PausedBy string `json:"paused_by,omitempty"`
 }
 
 type RunActionsHandler struct {
@@ -649,6 +1109,38 @@ func (h *RunActionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			httpError(w, err)
 			return
 		}
+	case RunActionTypePause:
+		creq := &action.RunPauseRequest{
+			RunID:                   runID,
+			PausedBy:                req.PausedBy,
+			ChangeGroupsUpdateToken: req.ChangeGroupsUpdateToken,
+		}
+		if err := h.ah.PauseRun(ctx, creq); err != nil {
+			h.log.Errorf("err: %+v", err)
+			httpError(w, err)
+			return
+		}
+	case RunActionTypeResume:
+		creq := &action.RunResumeRequest{
+			RunID:                   runID,
+			ChangeGroupsUpdateToken: req.ChangeGroupsUpdateToken,
+		}
+		if err := h.ah.ResumeRun(ctx, creq); err != nil {
+			h.log.Errorf("err: %+v", err)
+			httpError(w, err)
+			return
+		}
+	case RunActionTypePin, RunActionTypeUnpin:
+		creq := &action.RunPinRequest{
+			RunID:                   runID,
+			Pinned:                  req.ActionType == RunActionTypePin,
+			ChangeGroupsUpdateToken: req.ChangeGroupsUpdateToken,
+		}
+		if err := h.ah.PinRun(ctx, creq); err != nil {
+			h.log.Errorf("err: %+v", err)
+			httpError(w, err)
+			return
+		}
 	default:
 		http.Error(w, "", http.StatusBadRequest)
 		return
@@ -660,6 +1152,7 @@ type RunTaskActionType string
 const (
 	RunTaskActionTypeSetAnnotations RunTaskActionType = "setannotations"
 	RunTaskActionTypeApprove        RunTaskActionType = "approve"
+	RunTaskActionTypeCancel         RunTaskActionType = "cancel"
 )
 
 type RunTaskActionsRequest struct {
@@ -668,6 +1161,10 @@ type RunTaskActionsRequest struct {
 	// set Annotations fields
 	Annotations map[string]string `json:"annotations,omitempty"`
 
+	// cancel fields
+	Dependents  bool   `json:"dependents,omitempty"`
+	CancelledBy string `json:"cancelled_by,omitempty"`
+
 	// global fields
 	ChangeGroupsUpdateToken string `json:"change_groups_update_tokens"`
 }
@@ -723,6 +1220,20 @@ func (h *RunTaskActionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request
 			return
 		}
 
+	case RunTaskActionTypeCancel:
+		creq := &action.RunTaskCancelRequest{
+			RunID:                   runID,
+			TaskID:                  taskID,
+			Dependents:              req.Dependents,
+			CancelledBy:             req.CancelledBy,
+			ChangeGroupsUpdateToken: req.ChangeGroupsUpdateToken,
+		}
+		if err := h.ah.CancelRunTask(ctx, creq); err != nil {
+			h.log.Errorf("err: %+v", err)
+			httpError(w, err)
+			return
+		}
+
 	default:
 		http.Error(w, "", http.StatusBadRequest)
 		return
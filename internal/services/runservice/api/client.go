@@ -25,8 +25,13 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
+	"agola.io/agola/internal/services/runservice/common"
 	rstypes "agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/websocket"
 	errors "golang.org/x/xerrors"
 )
 
@@ -36,6 +41,9 @@ var jsonContent = http.Header{"Content-Type": []string{"application/json"}}
 type Client struct {
 	url    string
 	client *http.Client
+
+	// headers added to all the requests
+	header http.Header
 }
 
 // NewClient initializes and returns a API client.
@@ -46,6 +54,31 @@ func NewClient(url string) *Client {
 	}
 }
 
+// SetInternalAPIToken sets the token used to authenticate to the runservice
+// internal API. It's sent in all the requests.
+func (c *Client) SetInternalAPIToken(token string) {
+	if token == "" {
+		return
+	}
+	if c.header == nil {
+		c.header = http.Header{}
+	}
+	c.header.Set(util.InternalAPITokenHeader, token)
+}
+
+// SetExecutorCredentials sets the credentials that an executor will send in
+// all the requests
+func (c *Client) SetExecutorCredentials(executorID, bootstrapToken, token string) {
+	if c.header == nil {
+		c.header = http.Header{}
+	}
+	c.header.Set(common.ExecutorIDHeader, executorID)
+	if bootstrapToken != "" {
+		c.header.Set(common.ExecutorBootstrapTokenHeader, bootstrapToken)
+	}
+	c.header.Set(common.ExecutorTokenHeader, token)
+}
+
 // SetHTTPClient replaces default http.Client with user given one.
 func (c *Client) SetHTTPClient(client *http.Client) {
 	c.client = client
@@ -63,6 +96,9 @@ func (c *Client) doRequest(ctx context.Context, method, path string, query url.V
 	if err != nil {
 		return nil, err
 	}
+	for k, v := range c.header {
+		req.Header[k] = v
+	}
 	for k, v := range header {
 		req.Header[k] = v
 	}
@@ -125,6 +161,22 @@ func (c *Client) SendExecutorTaskStatus(ctx context.Context, executorID string,
 	return c.getResponse(ctx, "POST", fmt.Sprintf("/executor/%s/tasks/%s", executorID, et.ID), nil, -1, jsonContent, bytes.NewReader(etj))
 }
 
+func (c *Client) AcquireExecutorTaskLease(ctx context.Context, executorID, etID string) (*rstypes.ExecutorTaskLease, *http.Response, error) {
+	lease := new(rstypes.ExecutorTaskLease)
+	resp, err := c.getParsedResponse(ctx, "POST", fmt.Sprintf("/executor/%s/tasks/%s/lease", executorID, etID), nil, jsonContent, nil, lease)
+	return lease, resp, err
+}
+
+func (c *Client) RenewExecutorTaskLease(ctx context.Context, executorID, etID string, token int64) (*rstypes.ExecutorTaskLease, *http.Response, error) {
+	reqj, err := json.Marshal(&ExecutorTaskLeaseRenewRequest{Token: token})
+	if err != nil {
+		return nil, nil, err
+	}
+	lease := new(rstypes.ExecutorTaskLease)
+	resp, err := c.getParsedResponse(ctx, "PUT", fmt.Sprintf("/executor/%s/tasks/%s/lease", executorID, etID), nil, jsonContent, bytes.NewReader(reqj), lease)
+	return lease, resp, err
+}
+
 func (c *Client) GetExecutorTask(ctx context.Context, executorID, etID string) (*rstypes.ExecutorTask, *http.Response, error) {
 	et := new(rstypes.ExecutorTask)
 	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/executor/%s/tasks/%s", executorID, etID), nil, jsonContent, nil, et)
@@ -137,35 +189,164 @@ func (c *Client) GetExecutorTasks(ctx context.Context, executorID string) ([]*rs
 	return ets, resp, err
 }
 
-func (c *Client) GetArchive(ctx context.Context, taskID string, step int) (*http.Response, error) {
+func (c *Client) GetExecutors(ctx context.Context) ([]*rstypes.Executor, *http.Response, error) {
+	executors := []*rstypes.Executor{}
+	resp, err := c.getParsedResponse(ctx, "GET", "/executors", nil, jsonContent, nil, &executors)
+	return executors, resp, err
+}
+
+func (c *Client) ApproveExecutor(ctx context.Context, executorID string) (*http.Response, error) {
+	return c.getResponse(ctx, "POST", fmt.Sprintf("/executors/%s/approve", executorID), nil, -1, jsonContent, nil)
+}
+
+func (c *Client) DeleteExecutor(ctx context.Context, executorID string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/executor/%s", executorID), nil, -1, jsonContent, nil)
+}
+
+func (c *Client) GetMaintenance(ctx context.Context) (*rstypes.Maintenance, *http.Response, error) {
+	maintenance := new(rstypes.Maintenance)
+	resp, err := c.getParsedResponse(ctx, "GET", "/maintenance", nil, jsonContent, nil, maintenance)
+	return maintenance, resp, err
+}
+
+func (c *Client) EnableMaintenance(ctx context.Context) (*rstypes.Maintenance, *http.Response, error) {
+	maintenance := new(rstypes.Maintenance)
+	resp, err := c.getParsedResponse(ctx, "PUT", "/maintenance", nil, jsonContent, nil, maintenance)
+	return maintenance, resp, err
+}
+
+func (c *Client) DisableMaintenance(ctx context.Context) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", "/maintenance", nil, -1, jsonContent, nil)
+}
+
+func (c *Client) QueueWebhook(ctx context.Context, qw *rstypes.QueuedWebhook) (*rstypes.QueuedWebhook, *http.Response, error) {
+	qwj, err := json.Marshal(qw)
+	if err != nil {
+		return nil, nil, err
+	}
+	qw = new(rstypes.QueuedWebhook)
+	resp, err := c.getParsedResponse(ctx, "POST", "/maintenance/webhooks", nil, jsonContent, bytes.NewReader(qwj), qw)
+	return qw, resp, err
+}
+
+func (c *Client) GetQueuedWebhooks(ctx context.Context) ([]*rstypes.QueuedWebhook, *http.Response, error) {
+	qws := []*rstypes.QueuedWebhook{}
+	resp, err := c.getParsedResponse(ctx, "GET", "/maintenance/webhooks", nil, jsonContent, nil, &qws)
+	return qws, resp, err
+}
+
+func (c *Client) DeleteQueuedWebhook(ctx context.Context, id string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/maintenance/webhooks/%s", id), nil, -1, jsonContent, nil)
+}
+
+func (c *Client) CreateFailedWebhook(ctx context.Context, fw *rstypes.FailedWebhook) (*rstypes.FailedWebhook, *http.Response, error) {
+	fwj, err := json.Marshal(fw)
+	if err != nil {
+		return nil, nil, err
+	}
+	fw = new(rstypes.FailedWebhook)
+	resp, err := c.getParsedResponse(ctx, "POST", "/failedwebhooks", nil, jsonContent, bytes.NewReader(fwj), fw)
+	return fw, resp, err
+}
+
+func (c *Client) GetFailedWebhook(ctx context.Context, id string) (*rstypes.FailedWebhook, *http.Response, error) {
+	fw := new(rstypes.FailedWebhook)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/failedwebhooks/%s", id), nil, jsonContent, nil, fw)
+	return fw, resp, err
+}
+
+func (c *Client) GetFailedWebhooks(ctx context.Context) ([]*rstypes.FailedWebhook, *http.Response, error) {
+	fws := []*rstypes.FailedWebhook{}
+	resp, err := c.getParsedResponse(ctx, "GET", "/failedwebhooks", nil, jsonContent, nil, &fws)
+	return fws, resp, err
+}
+
+func (c *Client) DeleteFailedWebhook(ctx context.Context, id string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/failedwebhooks/%s", id), nil, -1, jsonContent, nil)
+}
+
+// GetArchive returns a workspace archive. The archive is returned in the
+// requested format if supported by the runservice, the format is reported in
+// the common.ArchiveFormatHeader response header.
+func (c *Client) GetArchive(ctx context.Context, storagePartition, taskID string, step int, format rstypes.ArchiveFormat) (*http.Response, error) {
 	q := url.Values{}
 	q.Add("taskid", taskID)
 	q.Add("step", strconv.Itoa(step))
+	if storagePartition != "" {
+		q.Add("storagepartition", storagePartition)
+	}
+	if format != "" {
+		q.Add("format", string(format))
+	}
 
 	return c.getResponse(ctx, "GET", "/executor/archives", q, -1, nil, nil)
 }
 
-func (c *Client) CheckCache(ctx context.Context, key string, prefix bool) (*http.Response, error) {
+func (c *Client) CheckCache(ctx context.Context, storagePartition, key string, prefix bool) (*http.Response, error) {
 	q := url.Values{}
 	if prefix {
 		q.Add("prefix", "")
 	}
+	if storagePartition != "" {
+		q.Add("storagepartition", storagePartition)
+	}
 	return c.getResponse(ctx, "HEAD", fmt.Sprintf("/executor/caches/%s", url.PathEscape(key)), q, -1, nil, nil)
 }
 
-func (c *Client) GetCache(ctx context.Context, key string, prefix bool) (*http.Response, error) {
+func (c *Client) GetCache(ctx context.Context, storagePartition, key string, prefix bool) (*http.Response, error) {
 	q := url.Values{}
 	if prefix {
 		q.Add("prefix", "")
 	}
+	if storagePartition != "" {
+		q.Add("storagepartition", storagePartition)
+	}
 	return c.getResponse(ctx, "GET", fmt.Sprintf("/executor/caches/%s", url.PathEscape(key)), q, -1, nil, nil)
 }
 
-func (c *Client) PutCache(ctx context.Context, key string, size int64, r io.Reader) (*http.Response, error) {
-	return c.getResponse(ctx, "POST", fmt.Sprintf("/executor/caches/%s", url.PathEscape(key)), nil, size, nil, r)
+func (c *Client) PutCache(ctx context.Context, storagePartition, key string, size int64, r io.Reader) (*http.Response, error) {
+	q := url.Values{}
+	if storagePartition != "" {
+		q.Add("storagepartition", storagePartition)
+	}
+	return c.getResponse(ctx, "POST", fmt.Sprintf("/executor/caches/%s", url.PathEscape(key)), q, size, nil, r)
 }
 
-func (c *Client) GetRuns(ctx context.Context, phaseFilter, resultFilter, groups []string, lastRun bool, changeGroups []string, start string, limit int, asc bool) (*GetRunsResponse, *http.Response, error) {
+func (c *Client) PutTestReport(ctx context.Context, storagePartition, taskID string, step int, format rstypes.TestReportFormat, size int64, r io.Reader) (*rstypes.TestReportSummary, *http.Response, error) {
+	q := url.Values{}
+	q.Add("format", string(format))
+	if storagePartition != "" {
+		q.Add("storagepartition", storagePartition)
+	}
+	resp, err := c.getResponse(ctx, "POST", fmt.Sprintf("/executor/testreports/%s/%d", taskID, step), q, size, nil, r)
+	if err != nil {
+		return nil, resp, err
+	}
+	defer resp.Body.Close()
+
+	summary := new(rstypes.TestReportSummary)
+	d := json.NewDecoder(resp.Body)
+	return summary, resp, d.Decode(summary)
+}
+
+func (c *Client) PutCoverageReport(ctx context.Context, storagePartition, taskID string, step int, format rstypes.CoverageReportFormat, size int64, r io.Reader) (*rstypes.CoverageReport, *http.Response, error) {
+	q := url.Values{}
+	q.Add("format", string(format))
+	if storagePartition != "" {
+		q.Add("storagepartition", storagePartition)
+	}
+	resp, err := c.getResponse(ctx, "POST", fmt.Sprintf("/executor/coveragereports/%s/%d", taskID, step), q, size, nil, r)
+	if err != nil {
+		return nil, resp, err
+	}
+	defer resp.Body.Close()
+
+	report := new(rstypes.CoverageReport)
+	d := json.NewDecoder(resp.Body)
+	return report, resp, d.Decode(report)
+}
+
+func (c *Client) GetRuns(ctx context.Context, phaseFilter, resultFilter, groups, names []string, labels map[string]string, lastRun, pinned bool, changeGroups []string, start string, limit int, asc bool) (*GetRunsResponse, *http.Response, error) {
 	q := url.Values{}
 	for _, phase := range phaseFilter {
 		q.Add("phase", phase)
@@ -176,9 +357,18 @@ func (c *Client) GetRuns(ctx context.Context, phaseFilter, resultFilter, groups
 	for _, group := range groups {
 		q.Add("group", group)
 	}
+	for _, name := range names {
+		q.Add("name", name)
+	}
+	for k, v := range labels {
+		q.Add("label", k+"="+v)
+	}
 	if lastRun {
 		q.Add("lastrun", "")
 	}
+	if pinned {
+		q.Add("pinned", "")
+	}
 	for _, changeGroup := range changeGroups {
 		q.Add("changegroup", changeGroup)
 	}
@@ -197,28 +387,95 @@ func (c *Client) GetRuns(ctx context.Context, phaseFilter, resultFilter, groups
 	return getRunsResponse, resp, err
 }
 
+func (c *Client) GetTasksFlakiness(ctx context.Context, group string, limit int) ([]*rstypes.TaskFlakiness, *http.Response, error) {
+	q := url.Values{}
+	q.Add("group", group)
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+
+	tfs := []*rstypes.TaskFlakiness{}
+	resp, err := c.getParsedResponse(ctx, "GET", "/tasksflakiness", q, jsonContent, nil, &tfs)
+	return tfs, resp, err
+}
+
+func (c *Client) GetRunsStats(ctx context.Context, group string, since time.Time, hotspotsLimit int) (*rstypes.RunsStats, *http.Response, error) {
+	q := url.Values{}
+	q.Add("group", group)
+	if !since.IsZero() {
+		q.Add("since", since.Format(time.RFC3339))
+	}
+	if hotspotsLimit > 0 {
+		q.Add("hotspotslimit", strconv.Itoa(hotspotsLimit))
+	}
+
+	stats := new(rstypes.RunsStats)
+	resp, err := c.getParsedResponse(ctx, "GET", "/runsstats", q, jsonContent, nil, stats)
+	return stats, resp, err
+}
+
+func (c *Client) GetRunTaskTestReport(ctx context.Context, runID, taskID string) (*rstypes.TestReport, *http.Response, error) {
+	report := new(rstypes.TestReport)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/runs/%s/tasks/%s/testreport", runID, taskID), nil, jsonContent, nil, report)
+	return report, resp, err
+}
+
+func (c *Client) GetTestCaseHistory(ctx context.Context, group, suite, name string, limit int) ([]*rstypes.TestCaseHistoryEntry, *http.Response, error) {
+	q := url.Values{}
+	q.Add("group", group)
+	if suite != "" {
+		q.Add("suite", suite)
+	}
+	q.Add("name", name)
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+
+	entries := []*rstypes.TestCaseHistoryEntry{}
+	resp, err := c.getParsedResponse(ctx, "GET", "/testcasehistory", q, jsonContent, nil, &entries)
+	return entries, resp, err
+}
+
+func (c *Client) GetRunCoverage(ctx context.Context, runID string) (*rstypes.CoverageReport, *http.Response, error) {
+	report := new(rstypes.CoverageReport)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/runs/%s/coverage", runID), nil, jsonContent, nil, report)
+	return report, resp, err
+}
+
+func (c *Client) GetCoverageHistory(ctx context.Context, group string, limit int) ([]*rstypes.CoverageHistoryEntry, *http.Response, error) {
+	q := url.Values{}
+	q.Add("group", group)
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+
+	entries := []*rstypes.CoverageHistoryEntry{}
+	resp, err := c.getParsedResponse(ctx, "GET", "/coveragehistory", q, jsonContent, nil, &entries)
+	return entries, resp, err
+}
+
 func (c *Client) GetQueuedRuns(ctx context.Context, start string, limit int, changeGroups []string) (*GetRunsResponse, *http.Response, error) {
-	return c.GetRuns(ctx, []string{"queued"}, nil, []string{}, false, changeGroups, start, limit, true)
+	return c.GetRuns(ctx, []string{"queued"}, nil, []string{}, nil, nil, false, false, changeGroups, start, limit, true)
 }
 
 func (c *Client) GetRunningRuns(ctx context.Context, start string, limit int, changeGroups []string) (*GetRunsResponse, *http.Response, error) {
-	return c.GetRuns(ctx, []string{"running"}, nil, []string{}, false, changeGroups, start, limit, true)
+	return c.GetRuns(ctx, []string{"running"}, nil, []string{}, nil, nil, false, false, changeGroups, start, limit, true)
 }
 
 func (c *Client) GetGroupQueuedRuns(ctx context.Context, group string, limit int, changeGroups []string) (*GetRunsResponse, *http.Response, error) {
-	return c.GetRuns(ctx, []string{"queued"}, nil, []string{group}, false, changeGroups, "", limit, false)
+	return c.GetRuns(ctx, []string{"queued"}, nil, []string{group}, nil, nil, false, false, changeGroups, "", limit, false)
 }
 
 func (c *Client) GetGroupRunningRuns(ctx context.Context, group string, limit int, changeGroups []string) (*GetRunsResponse, *http.Response, error) {
-	return c.GetRuns(ctx, []string{"running"}, nil, []string{group}, false, changeGroups, "", limit, false)
+	return c.GetRuns(ctx, []string{"running"}, nil, []string{group}, nil, nil, false, false, changeGroups, "", limit, false)
 }
 
 func (c *Client) GetGroupFirstQueuedRuns(ctx context.Context, group string, changeGroups []string) (*GetRunsResponse, *http.Response, error) {
-	return c.GetRuns(ctx, []string{"queued"}, nil, []string{group}, false, changeGroups, "", 1, true)
+	return c.GetRuns(ctx, []string{"queued"}, nil, []string{group}, nil, nil, false, false, changeGroups, "", 1, true)
 }
 
 func (c *Client) GetGroupLastRun(ctx context.Context, group string, changeGroups []string) (*GetRunsResponse, *http.Response, error) {
-	return c.GetRuns(ctx, nil, nil, []string{group}, false, changeGroups, "", 1, false)
+	return c.GetRuns(ctx, nil, nil, []string{group}, nil, nil, false, false, changeGroups, "", 1, false)
 }
 
 func (c *Client) CreateRun(ctx context.Context, req *RunCreateRequest) (*RunResponse, *http.Response, error) {
@@ -277,6 +534,17 @@ func (c *Client) ApproveRunTask(ctx context.Context, runID, taskID string, chang
 	return c.RunTaskActions(ctx, runID, taskID, req)
 }
 
+func (c *Client) CancelRunTask(ctx context.Context, runID, taskID string, dependents bool, cancelledBy, changeGroupsUpdateToken string) (*http.Response, error) {
+	req := &RunTaskActionsRequest{
+		ActionType:              RunTaskActionTypeCancel,
+		Dependents:              dependents,
+		CancelledBy:             cancelledBy,
+		ChangeGroupsUpdateToken: changeGroupsUpdateToken,
+	}
+
+	return c.RunTaskActions(ctx, runID, taskID, req)
+}
+
 func (c *Client) GetRun(ctx context.Context, runID string, changeGroups []string) (*RunResponse, *http.Response, error) {
 	q := url.Values{}
 	for _, changeGroup := range changeGroups {
@@ -288,7 +556,32 @@ func (c *Client) GetRun(ctx context.Context, runID string, changeGroups []string
 	return runResponse, resp, err
 }
 
-func (c *Client) GetLogs(ctx context.Context, runID, taskID string, setup bool, step int, follow bool) (*http.Response, error) {
+// GetRunByCounter returns the run with the provided counter of the provided
+// root group (i.e. /project/projectid)
+func (c *Client) GetRunByCounter(ctx context.Context, group string, counter uint64) (*RunResponse, *http.Response, error) {
+	q := url.Values{}
+	q.Add("group", group)
+	q.Add("counter", strconv.FormatUint(counter, 10))
+
+	runResponse := new(RunResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", "/runbycounter", q, jsonContent, nil, runResponse)
+	return runResponse, resp, err
+}
+
+// GetRunNames returns the names of the runs (the config run names) of the
+// provided root group
+func (c *Client) GetRunNames(ctx context.Context, group string) ([]string, *http.Response, error) {
+	q := url.Values{}
+	q.Add("group", group)
+
+	var names []string
+	resp, err := c.getParsedResponse(ctx, "GET", "/runnames", q, jsonContent, nil, &names)
+	return names, resp, err
+}
+
+// GetLogs returns the setup or step logs. attempt is the previous attempt
+// logs to return, if -1 the last attempt logs are returned
+func (c *Client) GetLogs(ctx context.Context, runID, taskID string, setup bool, step, attempt int, follow, full bool) (*http.Response, error) {
 	q := url.Values{}
 	q.Add("runid", runID)
 	q.Add("taskid", taskID)
@@ -297,13 +590,45 @@ func (c *Client) GetLogs(ctx context.Context, runID, taskID string, setup bool,
 	} else {
 		q.Add("step", strconv.Itoa(step))
 	}
+	if attempt >= 0 {
+		q.Add("attempt", strconv.Itoa(attempt))
+	}
 	if follow {
 		q.Add("follow", "")
 	}
+	if full {
+		q.Add("full", "")
+	}
 
 	return c.getResponse(ctx, "GET", "/logs", q, -1, nil, nil)
 }
 
+// ExecRunTask opens a websocket connection executing the provided command
+// (the task shell if empty) inside the running task main container
+func (c *Client) ExecRunTask(ctx context.Context, runID, taskID, userID string, cmd []string, tty bool) (*websocket.Conn, *http.Response, error) {
+	q := url.Values{}
+	q.Add("userid", userID)
+	for _, arg := range cmd {
+		q.Add("cmd", arg)
+	}
+	if tty {
+		q.Add("tty", "")
+	}
+
+	u := fmt.Sprintf("%s/api/v1alpha/runs/%s/tasks/%s/exec?%s", util.WebsocketURL(c.url), runID, taskID, q.Encode())
+	conn, resp, err := websocket.DefaultDialer.Dial(u, c.header)
+	if err != nil && resp != nil && resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		errMap := make(map[string]interface{})
+		if jerr := json.NewDecoder(resp.Body).Decode(&errMap); jerr == nil {
+			if msg, ok := errMap["message"].(string); ok {
+				return nil, resp, errors.New(msg)
+			}
+		}
+	}
+	return conn, resp, err
+}
+
 func (c *Client) GetRunEvents(ctx context.Context, startRunEventID string) (*http.Response, error) {
 	q := url.Values{}
 	q.Add("startruneventid", startRunEventID)
@@ -0,0 +1,149 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"agola.io/agola/internal/etcd"
+	"agola.io/agola/internal/objectstorage"
+	"agola.io/agola/internal/services/runservice/common"
+	"agola.io/agola/internal/services/runservice/store"
+	"agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+// RunTaskExecHandler proxies a websocket connection to the executor running
+// the task to execute a command inside the task main container. Every session
+// is recorded in an audit record saved in the object storage.
+type RunTaskExecHandler struct {
+	log              *zap.SugaredLogger
+	e                *etcd.Store
+	ost              *objectstorage.ObjStorage
+	executorAPIToken string
+}
+
+func NewRunTaskExecHandler(logger *zap.Logger, e *etcd.Store, ost *objectstorage.ObjStorage, executorAPIToken string) *RunTaskExecHandler {
+	return &RunTaskExecHandler{
+		log:              logger.Sugar(),
+		e:                e,
+		ost:              ost,
+		executorAPIToken: executorAPIToken,
+	}
+}
+
+func (h *RunTaskExecHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	runID := vars["runid"]
+	taskID := vars["taskid"]
+
+	run, _, err := store.GetRun(ctx, h.e, runID)
+	if err != nil {
+		if err == etcd.ErrKeyNotFound {
+			err = util.NewErrNotFound(errors.Errorf("run %q isn't active", runID))
+		}
+		httpError(w, err)
+		return
+	}
+	rt, ok := run.Tasks[taskID]
+	if !ok {
+		httpError(w, util.NewErrNotFound(errors.Errorf("no such task with ID %s in run %s", taskID, runID)))
+		return
+	}
+	if rt.Status != types.RunTaskStatusRunning {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("task %s isn't running", taskID)))
+		return
+	}
+
+	et, err := store.GetExecutorTask(ctx, h.e, taskID)
+	if err != nil {
+		if err == etcd.ErrKeyNotFound {
+			err = util.NewErrNotFound(errors.Errorf("executor task %q doesn't exist", taskID))
+		}
+		httpError(w, err)
+		return
+	}
+	executor, err := store.GetExecutor(ctx, h.e, et.Status.ExecutorID)
+	if err != nil {
+		if err == etcd.ErrKeyNotFound {
+			err = util.NewErrNotFound(errors.Errorf("executor with id %q doesn't exist", et.Status.ExecutorID))
+		}
+		httpError(w, err)
+		return
+	}
+
+	rq := r.URL.Query()
+	_, tty := rq["tty"]
+	audit := &types.RunTaskExecAudit{
+		ID:     util.DefaultUUIDGenerator{}.New("").String(),
+		RunID:  runID,
+		TaskID: taskID,
+		UserID: rq.Get("userid"),
+		Cmd:    rq["cmd"],
+		Tty:    tty,
+		Time:   time.Now(),
+	}
+	if err := h.saveAudit(audit); err != nil {
+		h.log.Errorf("err: %+v", err)
+		httpError(w, errors.Errorf("failed to save exec audit record: %w", err))
+		return
+	}
+
+	q := url.Values{}
+	q.Set("taskid", taskID)
+	for _, c := range audit.Cmd {
+		q.Add("cmd", c)
+	}
+	if tty {
+		q.Set("tty", "")
+	}
+	u := fmt.Sprintf("%s/api/v1alpha/executor/exec?%s", util.WebsocketURL(executor.ListenURL), q.Encode())
+
+	econn, _, err := websocket.DefaultDialer.Dial(u, common.ExecutorAPIHeader(h.executorAPIToken))
+	if err != nil {
+		h.log.Errorf("err: %+v", err)
+		httpError(w, errors.Errorf("failed to connect to executor %q: %w", executor.ID, err))
+		return
+	}
+	defer econn.Close()
+
+	conn, err := util.WebsocketUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+	defer conn.Close()
+
+	util.ProxyWebsocket(conn, econn, nil)
+}
+
+func (h *RunTaskExecHandler) saveAudit(audit *types.RunTaskExecAudit) error {
+	auditj, err := json.Marshal(audit)
+	if err != nil {
+		return err
+	}
+	return h.ost.WriteObject(store.OSTRunTaskExecAuditPath(audit.TaskID, audit.ID), bytes.NewReader(auditj), int64(len(auditj)), false)
+}
@@ -16,6 +16,7 @@ package api
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"io"
@@ -27,12 +28,18 @@ import (
 	"agola.io/agola/internal/objectstorage"
 	ostypes "agola.io/agola/internal/objectstorage/types"
 	"agola.io/agola/internal/services/runservice/action"
+	"agola.io/agola/internal/services/runservice/archive"
 	"agola.io/agola/internal/services/runservice/common"
+	"agola.io/agola/internal/services/runservice/coverage"
 	"agola.io/agola/internal/services/runservice/store"
+	"agola.io/agola/internal/services/runservice/testreport"
 	"agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/util"
 
 	"github.com/gorilla/mux"
+	"github.com/klauspost/compress/zstd"
 	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
 )
 
 type ExecutorStatusHandler struct {
@@ -48,7 +55,6 @@ func NewExecutorStatusHandler(logger *zap.Logger, e *etcd.Store, ah *action.Acti
 func (h *ExecutorStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	// TODO(sgotti) Check authorized call from executors
 	var executor *types.Executor
 	d := json.NewDecoder(r.Body)
 	defer r.Body.Close()
@@ -61,8 +67,20 @@ func (h *ExecutorStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request
 	// set last status update time
 	executor.LastStatusUpdateTime = time.Now()
 
-	if _, err := store.PutExecutor(ctx, h.e, executor); err != nil {
-		http.Error(w, "", http.StatusInternalServerError)
+	executor, err := h.ah.UpdateExecutorStatus(ctx, &action.UpdateExecutorStatusRequest{
+		Executor:       executor,
+		BootstrapToken: r.Header.Get(common.ExecutorBootstrapTokenHeader),
+		Token:          r.Header.Get(common.ExecutorTokenHeader),
+		RemoteAddress:  r.RemoteAddr,
+	})
+	if err != nil {
+		h.log.Errorf("err: %+v", err)
+		httpError(w, err)
+		return
+	}
+
+	// an executor waiting approval cannot remove other executors
+	if executor.WaitingApproval {
 		return
 	}
 
@@ -117,8 +135,10 @@ func NewExecutorTaskStatusHandler(e *etcd.Store, c chan<- *types.ExecutorTask) *
 
 func (h *ExecutorTaskStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	executorID := vars["executorid"]
 
-	// TODO(sgotti) Check authorized call from executors
 	var et *types.ExecutorTask
 	d := json.NewDecoder(r.Body)
 	defer r.Body.Close()
@@ -127,6 +147,32 @@ func (h *ExecutorTaskStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Req
 		http.Error(w, "", http.StatusBadRequest)
 		return
 	}
+	if et.ID != vars["taskid"] || et.Status.ExecutorID != executorID {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+
+	// executors can only update their tasks
+	curEt, err := store.GetExecutorTask(ctx, h.e, et.ID)
+	if err != nil && err != etcd.ErrKeyNotFound {
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	if curEt == nil || curEt.Status.ExecutorID != executorID {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+
+	// reject the updates of an executor that lost the task lease
+	lease, err := store.GetExecutorTaskLease(ctx, h.e, et.ID)
+	if err != nil && err != etcd.ErrKeyNotFound {
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	if lease != nil && (lease.ExecutorID != et.Status.ExecutorID || lease.Token != et.Status.LeaseToken) {
+		http.Error(w, "", http.StatusConflict)
+		return
+	}
 
 	if _, err := store.UpdateExecutorTaskStatus(ctx, h.e, et); err != nil {
 		http.Error(w, "", http.StatusBadRequest)
@@ -136,6 +182,94 @@ func (h *ExecutorTaskStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Req
 	go func() { h.c <- et }()
 }
 
+type ExecutorTaskLeaseAcquireHandler struct {
+	e             *etcd.Store
+	leaseDuration time.Duration
+}
+
+func NewExecutorTaskLeaseAcquireHandler(e *etcd.Store, leaseDuration time.Duration) *ExecutorTaskLeaseAcquireHandler {
+	return &ExecutorTaskLeaseAcquireHandler{e: e, leaseDuration: leaseDuration}
+}
+
+func (h *ExecutorTaskLeaseAcquireHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	executorID := vars["executorid"]
+	etID := vars["taskid"]
+
+	et, err := store.GetExecutorTask(ctx, h.e, etID)
+	if err != nil && err != etcd.ErrKeyNotFound {
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	// executors can only acquire the lease of their tasks
+	if et == nil || et.Status.ExecutorID != executorID {
+		http.Error(w, "", http.StatusNotFound)
+		return
+	}
+
+	lease, err := store.AcquireExecutorTaskLease(ctx, h.e, etID, executorID, h.leaseDuration)
+	if err != nil {
+		if err == store.ErrExecutorTaskLeaseConflict {
+			http.Error(w, "", http.StatusConflict)
+			return
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(lease); err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+}
+
+type ExecutorTaskLeaseRenewRequest struct {
+	Token int64
+}
+
+type ExecutorTaskLeaseRenewHandler struct {
+	e             *etcd.Store
+	leaseDuration time.Duration
+}
+
+func NewExecutorTaskLeaseRenewHandler(e *etcd.Store, leaseDuration time.Duration) *ExecutorTaskLeaseRenewHandler {
+	return &ExecutorTaskLeaseRenewHandler{e: e, leaseDuration: leaseDuration}
+}
+
+func (h *ExecutorTaskLeaseRenewHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	executorID := vars["executorid"]
+	etID := vars["taskid"]
+
+	var req *ExecutorTaskLeaseRenewRequest
+	d := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+
+	if err := d.Decode(&req); err != nil {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+
+	lease, err := store.RenewExecutorTaskLease(ctx, h.e, etID, executorID, req.Token, h.leaseDuration)
+	if err != nil {
+		if err == store.ErrExecutorTaskLeaseConflict {
+			http.Error(w, "", http.StatusConflict)
+			return
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(lease); err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+}
+
 type ExecutorTaskHandler struct {
 	e *etcd.Store
 }
@@ -148,7 +282,7 @@ func (h *ExecutorTaskHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	ctx := r.Context()
 	vars := mux.Vars(r)
 
-	// TODO(sgotti) Check authorized call from executors
+	executorID := vars["executorid"]
 	etID := vars["taskid"]
 	if etID == "" {
 		http.Error(w, "", http.StatusBadRequest)
@@ -160,7 +294,8 @@ func (h *ExecutorTaskHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "", http.StatusInternalServerError)
 		return
 	}
-	if et == nil {
+	// executors can only get their tasks
+	if et == nil || et.Status.ExecutorID != executorID {
 		http.Error(w, "", http.StatusNotFound)
 		return
 	}
@@ -183,7 +318,6 @@ func (h *ExecutorTasksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	ctx := r.Context()
 	vars := mux.Vars(r)
 
-	// TODO(sgotti) Check authorized call from executors
 	executorID := vars["executorid"]
 	if executorID == "" {
 		http.Error(w, "", http.StatusBadRequest)
@@ -203,14 +337,14 @@ func (h *ExecutorTasksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 }
 
 type ArchivesHandler struct {
-	log *zap.SugaredLogger
-	ost *objectstorage.ObjStorage
+	log  *zap.SugaredLogger
+	osts *common.ObjectStorages
 }
 
-func NewArchivesHandler(logger *zap.Logger, ost *objectstorage.ObjStorage) *ArchivesHandler {
+func NewArchivesHandler(logger *zap.Logger, osts *common.ObjectStorages) *ArchivesHandler {
 	return &ArchivesHandler{
-		log: logger.Sugar(),
-		ost: ost,
+		log:  logger.Sugar(),
+		osts: osts,
 	}
 }
 
@@ -232,10 +366,24 @@ func (h *ArchivesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "", http.StatusBadRequest)
 		return
 	}
+	ost, err := h.osts.DataOST(r.URL.Query().Get("storagepartition"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := types.ArchiveFormat(r.URL.Query().Get("format"))
+	switch format {
+	case "":
+		format = types.ArchiveFormatTar
+	case types.ArchiveFormatTar, types.ArchiveFormatTarZstd:
+	default:
+		http.Error(w, "unsupported archive format", http.StatusBadRequest)
+		return
+	}
 
 	w.Header().Set("Cache-Control", "no-cache")
 
-	if err := h.readArchive(taskID, step, w); err != nil {
+	if err := h.readArchive(ost, taskID, step, format, w); err != nil {
 		switch err.(type) {
 		case common.ErrNotExist:
 			http.Error(w, err.Error(), http.StatusNotFound)
@@ -246,32 +394,58 @@ func (h *ArchivesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *ArchivesHandler) readArchive(rtID string, step int, w io.Writer) error {
-	archivePath := store.OSTRunTaskArchivePath(rtID, step)
-	f, err := h.ost.ReadObject(archivePath)
-	if err != nil {
-		if err == ostypes.ErrNotExist {
-			return common.NewErrNotExist(err)
-		}
+func (h *ArchivesHandler) readArchive(ost *objectstorage.ObjStorage, rtID string, step int, format types.ArchiveFormat, w http.ResponseWriter) error {
+	// archives saved before the chunked format are plain tar files
+	m, err := archive.GetManifest(ost, store.OSTRunTaskArchiveManifestPath(rtID, step))
+	if err != nil && err != ostypes.ErrNotExist {
 		return err
 	}
-	defer f.Close()
+	var f io.ReadCloser
+	if m == nil {
+		f, err = ost.ReadObject(store.OSTRunTaskArchivePath(rtID, step))
+		if err != nil {
+			if err == ostypes.ErrNotExist {
+				return common.NewErrNotExist(err)
+			}
+			return err
+		}
+		defer f.Close()
+	}
 
-	br := bufio.NewReader(f)
+	w.Header().Set(common.ArchiveFormatHeader, string(format))
 
-	_, err = io.Copy(w, br)
+	var out io.Writer = w
+	var enc *zstd.Encoder
+	if format == types.ArchiveFormatTarZstd {
+		enc, err = zstd.NewWriter(w)
+		if err != nil {
+			return err
+		}
+		out = enc
+	}
+
+	if m != nil {
+		err = archive.Restore(ost, m, out)
+	} else {
+		_, err = io.Copy(out, bufio.NewReader(f))
+	}
+	if enc != nil {
+		if cerr := enc.Close(); err == nil {
+			err = cerr
+		}
+	}
 	return err
 }
 
 type CacheHandler struct {
-	log *zap.SugaredLogger
-	ost *objectstorage.ObjStorage
+	log  *zap.SugaredLogger
+	osts *common.ObjectStorages
 }
 
-func NewCacheHandler(logger *zap.Logger, ost *objectstorage.ObjStorage) *CacheHandler {
+func NewCacheHandler(logger *zap.Logger, osts *common.ObjectStorages) *CacheHandler {
 	return &CacheHandler{
-		log: logger.Sugar(),
-		ost: ost,
+		log:  logger.Sugar(),
+		osts: osts,
 	}
 }
 
@@ -292,7 +466,13 @@ func (h *CacheHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query()
 	_, prefix := query["prefix"]
 
-	matchedKey, err := matchCache(h.ost, key, prefix)
+	ost, err := h.osts.DataOST(query.Get("storagepartition"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	matchedKey, err := matchCache(ost, key, prefix)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -308,7 +488,7 @@ func (h *CacheHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Cache-Control", "no-cache")
 
-	if err := h.readCache(matchedKey, w); err != nil {
+	if err := h.readCache(ost, matchedKey, w); err != nil {
 		switch err.(type) {
 		case common.ErrNotExist:
 			http.Error(w, err.Error(), http.StatusNotFound)
@@ -355,9 +535,9 @@ func matchCache(ost *objectstorage.ObjStorage, key string, prefix bool) (string,
 	return key, nil
 }
 
-func (h *CacheHandler) readCache(key string, w io.Writer) error {
+func (h *CacheHandler) readCache(ost *objectstorage.ObjStorage, key string, w io.Writer) error {
 	cachePath := store.OSTCachePath(key)
-	f, err := h.ost.ReadObject(cachePath)
+	f, err := ost.ReadObject(cachePath)
 	if err != nil {
 		if err == ostypes.ErrNotExist {
 			return common.NewErrNotExist(err)
@@ -373,14 +553,14 @@ func (h *CacheHandler) readCache(key string, w io.Writer) error {
 }
 
 type CacheCreateHandler struct {
-	log *zap.SugaredLogger
-	ost *objectstorage.ObjStorage
+	log  *zap.SugaredLogger
+	osts *common.ObjectStorages
 }
 
-func NewCacheCreateHandler(logger *zap.Logger, ost *objectstorage.ObjStorage) *CacheCreateHandler {
+func NewCacheCreateHandler(logger *zap.Logger, osts *common.ObjectStorages) *CacheCreateHandler {
 	return &CacheCreateHandler{
-		log: logger.Sugar(),
-		ost: ost,
+		log:  logger.Sugar(),
+		osts: osts,
 	}
 }
 
@@ -399,9 +579,15 @@ func (h *CacheCreateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ost, err := h.osts.DataOST(r.URL.Query().Get("storagepartition"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	w.Header().Set("Cache-Control", "no-cache")
 
-	matchedKey, err := matchCache(h.ost, key, false)
+	matchedKey, err := matchCache(ost, key, false)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -422,12 +608,126 @@ func (h *CacheCreateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	cachePath := store.OSTCachePath(key)
-	if err := h.ost.WriteObject(cachePath, r.Body, size, false); err != nil {
+	if err := ost.WriteObject(cachePath, r.Body, size, false); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
 
+type TestReportCreateHandler struct {
+	log  *zap.SugaredLogger
+	osts *common.ObjectStorages
+}
+
+func NewTestReportCreateHandler(logger *zap.Logger, osts *common.ObjectStorages) *TestReportCreateHandler {
+	return &TestReportCreateHandler{
+		log:  logger.Sugar(),
+		osts: osts,
+	}
+}
+
+// ServeHTTP receives a tar archive with the test report files saved by an
+// executor task step, parses them and saves the resulting test report
+func (h *TestReportCreateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+
+	taskID := vars["taskid"]
+	if taskID == "" {
+		http.Error(w, "empty task id", http.StatusBadRequest)
+		return
+	}
+	step, err := strconv.Atoi(vars["step"])
+	if err != nil || step < 0 {
+		http.Error(w, "wrong step number", http.StatusBadRequest)
+		return
+	}
+
+	ost, err := h.osts.DataOST(query.Get("storagepartition"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := testreport.ParseArchive(types.TestReportFormat(query.Get("format")), r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reportj, err := json.Marshal(report)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := ost.WriteObject(store.OSTRunTaskTestReportPath(taskID, step), bytes.NewReader(reportj), int64(len(reportj)), false); err != nil {
+		h.log.Errorf("err: %+v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusCreated, report.Summary); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type CoverageReportCreateHandler struct {
+	log  *zap.SugaredLogger
+	osts *common.ObjectStorages
+}
+
+func NewCoverageReportCreateHandler(logger *zap.Logger, osts *common.ObjectStorages) *CoverageReportCreateHandler {
+	return &CoverageReportCreateHandler{
+		log:  logger.Sugar(),
+		osts: osts,
+	}
+}
+
+// ServeHTTP receives a tar archive with the coverage report files saved by an
+// executor task step, parses them and saves the resulting coverage report
+func (h *CoverageReportCreateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+
+	taskID := vars["taskid"]
+	if taskID == "" {
+		http.Error(w, "empty task id", http.StatusBadRequest)
+		return
+	}
+	step, err := strconv.Atoi(vars["step"])
+	if err != nil || step < 0 {
+		http.Error(w, "wrong step number", http.StatusBadRequest)
+		return
+	}
+
+	ost, err := h.osts.DataOST(query.Get("storagepartition"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := coverage.ParseArchive(types.CoverageReportFormat(query.Get("format")), r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reportj, err := json.Marshal(report)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := ost.WriteObject(store.OSTRunTaskCoverageReportPath(taskID, step), bytes.NewReader(reportj), int64(len(reportj)), false); err != nil {
+		h.log.Errorf("err: %+v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusCreated, report); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
 type ExecutorDeleteHandler struct {
 	log *zap.SugaredLogger
 	ah  *action.ActionHandler
@@ -456,3 +756,103 @@ func (h *ExecutorDeleteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request
 		return
 	}
 }
+
+// ExecutorAuthHandler checks that the calls to the executor dedicated api are
+// done by a registered and approved executor
+type ExecutorAuthHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+	h   http.Handler
+}
+
+func NewExecutorAuthHandler(logger *zap.Logger, ah *action.ActionHandler, h http.Handler) *ExecutorAuthHandler {
+	return &ExecutorAuthHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+		h:   h,
+	}
+}
+
+func (h *ExecutorAuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	executorID := r.Header.Get(common.ExecutorIDHeader)
+	if pathExecutorID := vars["executorid"]; pathExecutorID != "" {
+		if executorID == "" {
+			executorID = pathExecutorID
+		}
+		if executorID != pathExecutorID {
+			httpError(w, util.NewErrUnauthorized(errors.Errorf("executor id doesn't match")))
+			return
+		}
+	}
+
+	if err := h.ah.CheckExecutorAuth(ctx, executorID, r.Header.Get(common.ExecutorTokenHeader)); err != nil {
+		h.log.Errorf("err: %+v", err)
+		httpError(w, err)
+		return
+	}
+
+	h.h.ServeHTTP(w, r)
+}
+
+type ExecutorsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewExecutorsHandler(logger *zap.Logger, ah *action.ActionHandler) *ExecutorsHandler {
+	return &ExecutorsHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *ExecutorsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	executors, err := h.ah.GetExecutors(ctx)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	// don't return the executors token hash
+	for _, executor := range executors {
+		executor.TokenHash = ""
+	}
+
+	if err := httpResponse(w, http.StatusOK, executors); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type ExecutorApproveHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewExecutorApproveHandler(logger *zap.Logger, ah *action.ActionHandler) *ExecutorApproveHandler {
+	return &ExecutorApproveHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *ExecutorApproveHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	executorID := vars["executorid"]
+
+	err := h.ah.ApproveExecutor(ctx, executorID)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	slog "agola.io/agola/internal/log"
+	"agola.io/agola/internal/services/runservice/action"
+	"agola.io/agola/internal/services/runservice/common"
+	"agola.io/agola/internal/services/runservice/store"
+	"agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/testutil"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
+var logger = slog.New(level)
+
+func setupEtcd(t *testing.T, dir string) *testutil.TestEmbeddedEtcd {
+	tetcd, err := testutil.NewTestEmbeddedEtcd(t, logger, dir)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := tetcd.Start(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := tetcd.WaitUp(30 * time.Second); err != nil {
+		t.Fatalf("error waiting on etcd up: %v", err)
+	}
+	return tetcd
+}
+
+func shutdownEtcd(tetcd *testutil.TestEmbeddedEtcd) {
+	if tetcd.Etcd != nil {
+		_ = tetcd.Kill()
+	}
+}
+
+func TestExecutorTaskStatusHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tetcd := setupEtcd(t, dir)
+	defer shutdownEtcd(tetcd)
+
+	ctx := context.Background()
+	e := tetcd.TestEtcd.Store
+
+	if _, err := store.AtomicPutExecutorTask(ctx, e, &types.ExecutorTask{ID: "task01", Status: types.ExecutorTaskStatus{ExecutorID: "executor01"}}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	lease, err := store.AcquireExecutorTaskLease(ctx, e, "task01", "executor01", time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	ch := make(chan *types.ExecutorTask, 10)
+	router := mux.NewRouter()
+	router.Handle("/executor/{executorid}/tasks/{taskid}", NewExecutorTaskStatusHandler(e, ch)).Methods("POST")
+
+	tests := []struct {
+		name       string
+		executorID string
+		taskID     string
+		et         *types.ExecutorTask
+		code       int
+	}{
+		{
+			name:       "assigned executor",
+			executorID: "executor01",
+			taskID:     "task01",
+			et:         &types.ExecutorTask{ID: "task01", Status: types.ExecutorTaskStatus{ExecutorID: "executor01", Phase: types.ExecutorTaskPhaseRunning, LeaseToken: lease.Token}},
+			code:       http.StatusOK,
+		},
+		{
+			name:       "another executor",
+			executorID: "executor02",
+			taskID:     "task01",
+			et:         &types.ExecutorTask{ID: "task01", Status: types.ExecutorTaskStatus{ExecutorID: "executor02", Phase: types.ExecutorTaskPhaseFailed}},
+			code:       http.StatusNotFound,
+		},
+		{
+			name:       "executor id not matching the path",
+			executorID: "executor02",
+			taskID:     "task01",
+			et:         &types.ExecutorTask{ID: "task01", Status: types.ExecutorTaskStatus{ExecutorID: "executor01", Phase: types.ExecutorTaskPhaseFailed, LeaseToken: lease.Token}},
+			code:       http.StatusBadRequest,
+		},
+		{
+			name:       "task id not matching the path",
+			executorID: "executor01",
+			taskID:     "task02",
+			et:         &types.ExecutorTask{ID: "task01", Status: types.ExecutorTaskStatus{ExecutorID: "executor01", Phase: types.ExecutorTaskPhaseFailed, LeaseToken: lease.Token}},
+			code:       http.StatusBadRequest,
+		},
+		{
+			name:       "not existing task",
+			executorID: "executor01",
+			taskID:     "task02",
+			et:         &types.ExecutorTask{ID: "task02", Status: types.ExecutorTaskStatus{ExecutorID: "executor01", Phase: types.ExecutorTaskPhaseFailed}},
+			code:       http.StatusNotFound,
+		},
+		{
+			name:       "stale lease token",
+			executorID: "executor01",
+			taskID:     "task01",
+			et:         &types.ExecutorTask{ID: "task01", Status: types.ExecutorTaskStatus{ExecutorID: "executor01", Phase: types.ExecutorTaskPhaseFailed, LeaseToken: lease.Token - 1}},
+			code:       http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			etj, err := json.Marshal(tt.et)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			r := httptest.NewRequest("POST", "/executor/"+tt.executorID+"/tasks/"+tt.taskID, bytes.NewReader(etj))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if w.Code != tt.code {
+				t.Fatalf("expected status code %d, got %d", tt.code, w.Code)
+			}
+		})
+	}
+
+	// only the update of the assigned executor is saved
+	et, err := store.GetExecutorTask(ctx, e, "task01")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if et.Status.ExecutorID != "executor01" || et.Status.Phase != types.ExecutorTaskPhaseRunning {
+		t.Fatalf("unexpected executor task status: executor %q, phase %q", et.Status.ExecutorID, et.Status.Phase)
+	}
+}
+
+func TestExecutorRegistration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tetcd := setupEtcd(t, dir)
+	defer shutdownEtcd(tetcd)
+
+	ctx := context.Background()
+	e := tetcd.TestEtcd.Store
+
+	tests := []struct {
+		name                     string
+		executorBootstrapToken   string
+		executorApprovalRequired bool
+		bootstrapToken           string
+		token                    string
+		registerCode             int
+		// the status code of the executor api calls before the approval
+		code int
+	}{
+		{
+			name:         "open registration",
+			registerCode: http.StatusOK,
+			code:         http.StatusOK,
+		},
+		{
+			name:                   "bootstrap token",
+			executorBootstrapToken: "bootstraptoken",
+			bootstrapToken:         "bootstraptoken",
+			token:                  "token01",
+			registerCode:           http.StatusOK,
+			code:                   http.StatusForbidden,
+		},
+		{
+			name:                   "wrong bootstrap token",
+			executorBootstrapToken: "bootstraptoken",
+			bootstrapToken:         "wrongtoken",
+			token:                  "token01",
+			registerCode:           http.StatusUnauthorized,
+			code:                   http.StatusUnauthorized,
+		},
+		{
+			name:                     "approval required without bootstrap token",
+			executorApprovalRequired: true,
+			token:                    "token01",
+			registerCode:             http.StatusOK,
+			code:                     http.StatusForbidden,
+		},
+		{
+			name:                     "approval required without executor token",
+			executorApprovalRequired: true,
+			registerCode:             http.StatusBadRequest,
+			code:                     http.StatusUnauthorized,
+		},
+		{
+			name:                     "approval required with bootstrap token",
+			executorBootstrapToken:   "bootstraptoken",
+			executorApprovalRequired: true,
+			bootstrapToken:           "bootstraptoken",
+			token:                    "token01",
+			registerCode:             http.StatusOK,
+			code:                     http.StatusForbidden,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executorID := fmt.Sprintf("executor%02d", i)
+
+			ah := action.NewActionHandler(logger, e, nil, nil, nil, tt.executorBootstrapToken, tt.executorApprovalRequired)
+			router := mux.NewRouter()
+			router.Handle("/executor/{executorid}", NewExecutorStatusHandler(logger, e, ah)).Methods("POST")
+			router.Handle("/executor/{executorid}/tasks", NewExecutorAuthHandler(logger, ah, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))).Methods("GET")
+
+			do := func(method, path string, body []byte, token string) int {
+				r := httptest.NewRequest(method, path, bytes.NewReader(body))
+				r.Header.Set(common.ExecutorIDHeader, executorID)
+				r.Header.Set(common.ExecutorBootstrapTokenHeader, tt.bootstrapToken)
+				r.Header.Set(common.ExecutorTokenHeader, token)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, r)
+				return w.Code
+			}
+
+			executorj, err := json.Marshal(&types.Executor{ID: executorID})
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if code := do("POST", "/executor/"+executorID, executorj, tt.token); code != tt.registerCode {
+				t.Fatalf("expected register status code %d, got %d", tt.registerCode, code)
+			}
+			if code := do("GET", "/executor/"+executorID+"/tasks", nil, tt.token); code != tt.code {
+				t.Fatalf("expected status code %d, got %d", tt.code, code)
+			}
+
+			if tt.code != http.StatusForbidden {
+				return
+			}
+
+			// a new executor status doesn't approve the executor
+			if code := do("POST", "/executor/"+executorID, executorj, tt.token); code != http.StatusOK {
+				t.Fatalf("expected status code %d, got %d", http.StatusOK, code)
+			}
+			executor, err := store.GetExecutor(ctx, e, executorID)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if !executor.WaitingApproval {
+				t.Fatalf("expected executor waiting approval")
+			}
+
+			if err := ah.ApproveExecutor(ctx, executorID); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if code := do("GET", "/executor/"+executorID+"/tasks", nil, tt.token); code != http.StatusOK {
+				t.Fatalf("expected status code %d, got %d", http.StatusOK, code)
+			}
+			if code := do("GET", "/executor/"+executorID+"/tasks", nil, "wrongtoken"); code != http.StatusUnauthorized {
+				t.Fatalf("expected status code %d, got %d", http.StatusUnauthorized, code)
+			}
+			// an approved executor cannot register again with another token
+			if code := do("POST", "/executor/"+executorID, executorj, "wrongtoken"); code != http.StatusUnauthorized {
+				t.Fatalf("expected status code %d, got %d", http.StatusUnauthorized, code)
+			}
+		})
+	}
+}
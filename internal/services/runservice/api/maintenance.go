@@ -0,0 +1,190 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"agola.io/agola/internal/services/runservice/action"
+	"agola.io/agola/internal/services/runservice/types"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type MaintenanceHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewMaintenanceHandler(logger *zap.Logger, ah *action.ActionHandler) *MaintenanceHandler {
+	return &MaintenanceHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *MaintenanceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	maintenance, err := h.ah.GetMaintenance(ctx)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, maintenance); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type MaintenanceEnableHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewMaintenanceEnableHandler(logger *zap.Logger, ah *action.ActionHandler) *MaintenanceEnableHandler {
+	return &MaintenanceEnableHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *MaintenanceEnableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	maintenance, err := h.ah.EnableMaintenance(ctx)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, maintenance); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type MaintenanceDisableHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewMaintenanceDisableHandler(logger *zap.Logger, ah *action.ActionHandler) *MaintenanceDisableHandler {
+	return &MaintenanceDisableHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *MaintenanceDisableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	err := h.ah.DisableMaintenance(ctx)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type QueuedWebhooksHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewQueuedWebhooksHandler(logger *zap.Logger, ah *action.ActionHandler) *QueuedWebhooksHandler {
+	return &QueuedWebhooksHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *QueuedWebhooksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	qws, err := h.ah.GetQueuedWebhooks(ctx)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, qws); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type QueueWebhookHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewQueueWebhookHandler(logger *zap.Logger, ah *action.ActionHandler) *QueueWebhookHandler {
+	return &QueueWebhookHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *QueueWebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var qw *types.QueuedWebhook
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&qw); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	qw, err := h.ah.QueueWebhook(ctx, qw)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusCreated, qw); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type QueuedWebhookDeleteHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewQueuedWebhookDeleteHandler(logger *zap.Logger, ah *action.ActionHandler) *QueuedWebhookDeleteHandler {
+	return &QueuedWebhookDeleteHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *QueuedWebhookDeleteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	err := h.ah.DeleteQueuedWebhook(ctx, vars["webhookid"])
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"agola.io/agola/internal/services/runservice/action"
+	"agola.io/agola/internal/services/runservice/types"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type FailedWebhookCreateHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewFailedWebhookCreateHandler(logger *zap.Logger, ah *action.ActionHandler) *FailedWebhookCreateHandler {
+	return &FailedWebhookCreateHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *FailedWebhookCreateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var fw *types.FailedWebhook
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&fw); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fw, err := h.ah.CreateFailedWebhook(ctx, fw)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusCreated, fw); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type FailedWebhookHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewFailedWebhookHandler(logger *zap.Logger, ah *action.ActionHandler) *FailedWebhookHandler {
+	return &FailedWebhookHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *FailedWebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	fw, err := h.ah.GetFailedWebhook(ctx, vars["webhookid"])
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, fw); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type FailedWebhooksHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewFailedWebhooksHandler(logger *zap.Logger, ah *action.ActionHandler) *FailedWebhooksHandler {
+	return &FailedWebhooksHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *FailedWebhooksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	fws, err := h.ah.GetFailedWebhooks(ctx)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, fws); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type FailedWebhookDeleteHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewFailedWebhookDeleteHandler(logger *zap.Logger, ah *action.ActionHandler) *FailedWebhookDeleteHandler {
+	return &FailedWebhookDeleteHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *FailedWebhookDeleteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	err := h.ah.DeleteFailedWebhook(ctx, vars["webhookid"])
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -0,0 +1,276 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archive
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+
+	"agola.io/agola/internal/objectstorage"
+	ostypes "agola.io/agola/internal/objectstorage/types"
+	"agola.io/agola/internal/util"
+
+	"github.com/klauspost/compress/zstd"
+	errors "golang.org/x/xerrors"
+)
+
+// Archives are saved as a manifest containing the list of their content
+// defined chunks. Every chunk is saved compressed with zstd and identified by
+// the sha256 of its uncompressed data, so the chunks already saved by other
+// archives in the same namespace aren't saved again.
+//
+// The chunks not referenced by any manifest are removed by CleanChunks. Since
+// an archive being saved could reuse an unreferenced chunk before writing its
+// manifest, only the chunks not written since the grace period are removed
+// and Save rewrites the existing chunks older than half the grace period.
+
+const (
+	ManifestVersion = 1
+
+	// ChunksGracePeriod is the time after its last write that an unreferenced
+	// chunk can be removed
+	ChunksGracePeriod = 24 * time.Hour
+
+	chunksDir   = "workspacechunks"
+	manifestExt = ".manifest"
+)
+
+type Manifest struct {
+	Version   int         `json:"version"`
+	Namespace string      `json:"namespace"`
+	Size      int64       `json:"size"`
+	Chunks    []*ChunkRef `json:"chunks"`
+}
+
+type ChunkRef struct {
+	ID   string `json:"id"`
+	Size int64  `json:"size"`
+}
+
+type SaveStats struct {
+	Size   int64
+	Chunks int
+	// NewChunks is the number of chunks that weren't already saved
+	NewChunks int
+	// NewChunksSize is the compressed size of the new chunks
+	NewChunksSize int64
+}
+
+// Namespace returns the chunks namespace of a run group. The archives chunks
+// are deduplicated between the runs of the same project (or of the same user
+// for user direct runs).
+func Namespace(group string) string {
+	pl := util.PathList(group)
+	if len(pl) < 2 {
+		return "default"
+	}
+	return path.Join(pl[0], pl[1])
+}
+
+func chunkPath(namespace, id string) string {
+	return path.Join(chunksDir, namespace, id[:2], id)
+}
+
+// Save splits the archive read from r in chunks saving the chunks that don't
+// already exist in the namespace and then the manifest.
+func Save(ost *objectstorage.ObjStorage, manifestPath, namespace string, r io.Reader) (*SaveStats, error) {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, err
+	}
+	defer enc.Close()
+
+	m := &Manifest{
+		Version:   ManifestVersion,
+		Namespace: namespace,
+		Chunks:    []*ChunkRef{},
+	}
+	stats := &SaveStats{}
+
+	var cdata []byte
+	c := NewChunker(r)
+	for {
+		data, err := c.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		sum := sha256.Sum256(data)
+		id := hex.EncodeToString(sum[:])
+		p := chunkPath(namespace, id)
+
+		oi, err := ost.Stat(p)
+		if err != nil && err != ostypes.ErrNotExist {
+			return nil, err
+		}
+		if err == ostypes.ErrNotExist {
+			cdata = enc.EncodeAll(data, cdata[:0])
+			if err := ost.WriteObject(p, bytes.NewReader(cdata), int64(len(cdata)), false); err != nil {
+				return nil, errors.Errorf("failed to write chunk %q: %w", id, err)
+			}
+			stats.NewChunks++
+			stats.NewChunksSize += int64(len(cdata))
+		} else if time.Since(oi.LastModified) > ChunksGracePeriod/2 {
+			// rewrite the chunk so it won't be removed by CleanChunks before
+			// the manifest is written
+			cdata = enc.EncodeAll(data, cdata[:0])
+			if err := ost.WriteObject(p, bytes.NewReader(cdata), int64(len(cdata)), false); err != nil {
+				return nil, errors.Errorf("failed to write chunk %q: %w", id, err)
+			}
+		}
+
+		m.Chunks = append(m.Chunks, &ChunkRef{ID: id, Size: int64(len(data))})
+		m.Size += int64(len(data))
+	}
+	stats.Size = m.Size
+	stats.Chunks = len(m.Chunks)
+
+	mj, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	if err := ost.WriteObject(manifestPath, bytes.NewReader(mj), int64(len(mj)), false); err != nil {
+		return nil, errors.Errorf("failed to write manifest: %w", err)
+	}
+
+	return stats, nil
+}
+
+// GetManifest returns the archive manifest. It returns an
+// objectstorage ErrNotExist error if the manifest doesn't exist.
+func GetManifest(ost *objectstorage.ObjStorage, manifestPath string) (*Manifest, error) {
+	f, err := ost.ReadObject(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var m *Manifest
+	if err := json.NewDecoder(f).Decode(&m); err != nil {
+		return nil, errors.Errorf("failed to decode manifest: %w", err)
+	}
+	if m.Version != ManifestVersion {
+		return nil, errors.Errorf("unsupported manifest version %d", m.Version)
+	}
+
+	return m, nil
+}
+
+// Restore writes to w the archive data reassembling its chunks
+func Restore(ost *objectstorage.ObjStorage, m *Manifest, w io.Writer) error {
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		return err
+	}
+	defer dec.Close()
+
+	var data []byte
+	for _, chunk := range m.Chunks {
+		f, err := ost.ReadObject(chunkPath(m.Namespace, chunk.ID))
+		if err != nil {
+			return errors.Errorf("failed to read chunk %q: %w", chunk.ID, err)
+		}
+		cdata, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return errors.Errorf("failed to read chunk %q: %w", chunk.ID, err)
+		}
+
+		data, err = dec.DecodeAll(cdata, data[:0])
+		if err != nil {
+			return errors.Errorf("failed to decompress chunk %q: %w", chunk.ID, err)
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != chunk.ID {
+			return errors.Errorf("chunk %q is corrupted", chunk.ID)
+		}
+
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CleanChunks removes the chunks not referenced by any of the manifests saved
+// under manifestsDir and not written since gracePeriod.
+func CleanChunks(ost *objectstorage.ObjStorage, manifestsDir string, gracePeriod time.Duration) error {
+	// mark the chunks referenced by the manifests
+	referenced := map[string]struct{}{}
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+	for object := range ost.List(manifestsDir+"/", "", true, doneCh) {
+		if object.Err != nil {
+			return object.Err
+		}
+		if !strings.HasSuffix(object.Path, manifestExt) {
+			continue
+		}
+		m, err := GetManifest(ost, object.Path)
+		if err == ostypes.ErrNotExist {
+			// removed in the meantime
+			continue
+		}
+		if err != nil {
+			// don't remove anything since we cannot know the chunks referenced
+			// by this manifest
+			return errors.Errorf("failed to read manifest %q: %w", object.Path, err)
+		}
+		for _, chunk := range m.Chunks {
+			referenced[chunkPath(m.Namespace, chunk.ID)] = struct{}{}
+		}
+	}
+
+	// sweep the unreferenced chunks
+	for object := range ost.List(chunksDir+"/", "", true, doneCh) {
+		if object.Err != nil {
+			return object.Err
+		}
+		if _, ok := referenced[object.Path]; ok {
+			continue
+		}
+		if time.Since(object.LastModified) < gracePeriod {
+			continue
+		}
+		// check again the last write time since the chunk could have been
+		// rewritten by Save after being listed
+		oi, err := ost.Stat(object.Path)
+		if err == ostypes.ErrNotExist {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if time.Since(oi.LastModified) < gracePeriod {
+			continue
+		}
+		if err := ost.DeleteObject(object.Path); err != nil && err != ostypes.ErrNotExist {
+			return errors.Errorf("failed to delete chunk %q: %w", object.Path, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+
+	"agola.io/agola/internal/objectstorage"
+	"agola.io/agola/internal/objectstorage/posix"
+)
+
+func TestSaveRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := posix.New(dir)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	ost := objectstorage.NewObjStorage(s, "/")
+
+	rnd := rand.New(rand.NewSource(1))
+	data := make([]byte, 20*1024*1024)
+	if _, err := rnd.Read(data); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// same data with some bytes inserted in the middle
+	data2 := append([]byte{}, data[:10*1024*1024]...)
+	data2 = append(data2, []byte("some inserted data")...)
+	data2 = append(data2, data[10*1024*1024:]...)
+
+	stats, err := Save(ost, "archive01.manifest", "project/p01", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if stats.NewChunks != stats.Chunks {
+		t.Fatalf("expected %d new chunks, got %d", stats.Chunks, stats.NewChunks)
+	}
+
+	stats2, err := Save(ost, "archive02.manifest", "project/p01", bytes.NewReader(data2))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// only the chunks near the inserted data should be new
+	if stats2.NewChunks > 2 {
+		t.Fatalf("expected at most 2 new chunks, got %d of %d chunks", stats2.NewChunks, stats2.Chunks)
+	}
+
+	// in another namespace all the chunks are new
+	stats3, err := Save(ost, "archive03.manifest", "project/p02", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if stats3.NewChunks != stats3.Chunks {
+		t.Fatalf("expected %d new chunks, got %d", stats3.Chunks, stats3.NewChunks)
+	}
+
+	for manifestPath, expectedData := range map[string][]byte{"archive01.manifest": data, "archive02.manifest": data2} {
+		m, err := GetManifest(ost, manifestPath)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := Restore(ost, m, &buf); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if !bytes.Equal(buf.Bytes(), expectedData) {
+			t.Fatalf("%s: restored data doesn't match", manifestPath)
+		}
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	tests := []struct {
+		group string
+		out   string
+	}{
+		{group: "/project/p01/branch/master", out: "project/p01"},
+		{group: "/user/u01", out: "user/u01"},
+		{group: "/", out: "default"},
+	}
+
+	for _, tt := range tests {
+		if out := Namespace(tt.group); out != tt.out {
+			t.Errorf("group %q: expected namespace %q, got %q", tt.group, tt.out, out)
+		}
+	}
+}
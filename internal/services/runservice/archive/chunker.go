@@ -0,0 +1,99 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archive
+
+import (
+	"bufio"
+	"io"
+)
+
+// Content defined chunking parameters. Changing them (or the gear table) will
+// generate different chunks from the same data breaking the deduplication with
+// the existing chunks.
+const (
+	MinChunkSize = 256 * 1024
+	AvgChunkSize = 1024 * 1024
+	MaxChunkSize = 4 * 1024 * 1024
+
+	// use the gear hash higher bits since they depend on more input bytes
+	chunkMask = uint64(AvgChunkSize-1) << (64 - 20)
+)
+
+var gearTable [256]uint64
+
+func init() {
+	// generate a stable gear table using splitmix64 with a fixed seed
+	seed := uint64(0x61676f6c61)
+	for i := range gearTable {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gearTable[i] = z ^ (z >> 31)
+	}
+}
+
+// Chunker splits a stream of data in content defined chunks using a gear
+// rolling hash. Since the chunks boundaries depend on the content, data
+// inserted or removed in a stream only changes the nearby chunks, so the
+// same files in different archives will produce mostly the same chunks.
+type Chunker struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+func NewChunker(r io.Reader) *Chunker {
+	return &Chunker{
+		r:   bufio.NewReader(r),
+		buf: make([]byte, 0, MaxChunkSize),
+	}
+}
+
+// Next returns the next chunk. The returned data is valid only until the next
+// call. It returns io.EOF when there's no more data.
+func (c *Chunker) Next() ([]byte, error) {
+	// the gear hash only depends on the last 64 bytes so skip hashing the
+	// data before the min chunk size
+	c.buf = c.buf[:MinChunkSize-64]
+	n, err := io.ReadFull(c.r, c.buf)
+	c.buf = c.buf[:n]
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err == io.ErrUnexpectedEOF {
+		return c.buf, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var h uint64
+	for len(c.buf) < MaxChunkSize {
+		b, err := c.r.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		c.buf = append(c.buf, b)
+		h = (h << 1) + gearTable[b]
+		if len(c.buf) >= MinChunkSize && h&chunkMask == 0 {
+			break
+		}
+	}
+
+	return c.buf, nil
+}
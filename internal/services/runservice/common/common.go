@@ -15,13 +15,48 @@
 package common
 
 import (
+	"net/http"
 	"path"
+
+	"agola.io/agola/internal/util"
 )
 
 const (
 	MaxCacheKeyLength = 200
 )
 
+// headers used by the executors to authenticate to the runservice
+const (
+	ExecutorIDHeader             = "X-Agola-Executor-ID"
+	ExecutorBootstrapTokenHeader = "X-Agola-Executor-Bootstrap-Token"
+	ExecutorTokenHeader          = "X-Agola-Executor-Token"
+)
+
+// ExecutorAPIHeader returns the headers used to authenticate to the executors
+// API with the provided token. No header is set when the token is empty.
+func ExecutorAPIHeader(token string) http.Header {
+	header := http.Header{}
+	if token != "" {
+		header.Set(util.InternalAPITokenHeader, token)
+	}
+	return header
+}
+
+// ArchiveFormatHeader is the header reporting the format of a transferred
+// workspace archive. When missing the archive is a plain tar.
+const ArchiveFormatHeader = "X-Agola-Archive-Format"
+
+// ContentSizeHeader is the header reporting the full uncompressed size of a
+// log or workspace archive fetched from an executor. It's used to detect
+// interrupted transfers.
+const ContentSizeHeader = "X-Agola-Content-Size"
+
+// CompressionHeader is the header reporting the compression of a fetched log
+const CompressionHeader = "X-Agola-Compression"
+
+// CompressionZstd is the zstd compression
+const CompressionZstd = "zstd"
+
 type ErrNotExist struct {
 	err error
 }
@@ -45,19 +80,31 @@ var (
 	EtcdChangeGroupsDir           = path.Join(EtcdSchedulerBaseDir, "changegroups")
 	EtcdChangeGroupMinRevisionKey = path.Join(EtcdSchedulerBaseDir, "changegroupsminrev")
 
-	EtcdExecutorsDir = path.Join(EtcdSchedulerBaseDir, "executors")
-	EtcdTasksDir     = path.Join(EtcdSchedulerBaseDir, "tasks")
+	EtcdExecutorsDir  = path.Join(EtcdSchedulerBaseDir, "executors")
+	EtcdTasksDir      = path.Join(EtcdSchedulerBaseDir, "tasks")
+	EtcdTaskLeasesDir = path.Join(EtcdSchedulerBaseDir, "taskleases")
 
 	EtcdPingKey = path.Join(EtcdSchedulerBaseDir, "ping")
 
+	EtcdMaintenanceKey           = path.Join(EtcdSchedulerBaseDir, "maintenance")
+	EtcdQueuedWebhooksDir        = path.Join(EtcdSchedulerBaseDir, "queuedwebhooks")
+	EtcdQueuedWebhookSequenceKey = path.Join(EtcdSchedulerBaseDir, "queuedwebhooksequence")
+
+	EtcdFailedWebhooksDir        = path.Join(EtcdSchedulerBaseDir, "failedwebhooks")
+	EtcdFailedWebhookSequenceKey = path.Join(EtcdSchedulerBaseDir, "failedwebhooksequence")
+
 	EtcdCompactChangeGroupsLockKey = path.Join(EtcdSchedulerBaseDir, "compactchangegroupslock")
 	EtcdCacheCleanerLockKey        = path.Join(EtcdSchedulerBaseDir, "locks", "cachecleaner")
 	EtcdTaskUpdaterLockKey         = path.Join(EtcdSchedulerBaseDir, "locks", "taskupdater")
+	EtcdJanitorLockKey             = path.Join(EtcdSchedulerBaseDir, "locks", "janitor")
 )
 
-func EtcdRunKey(runID string) string       { return path.Join(EtcdRunsDir, runID) }
-func EtcdExecutorKey(taskID string) string { return path.Join(EtcdExecutorsDir, taskID) }
-func EtcdTaskKey(taskID string) string     { return path.Join(EtcdTasksDir, taskID) }
+func EtcdRunKey(runID string) string        { return path.Join(EtcdRunsDir, runID) }
+func EtcdExecutorKey(taskID string) string  { return path.Join(EtcdExecutorsDir, taskID) }
+func EtcdTaskKey(taskID string) string      { return path.Join(EtcdTasksDir, taskID) }
+func EtcdTaskLeaseKey(taskID string) string { return path.Join(EtcdTaskLeasesDir, taskID) }
+func EtcdQueuedWebhookKey(id string) string { return path.Join(EtcdQueuedWebhooksDir, id) }
+func EtcdFailedWebhookKey(id string) string { return path.Join(EtcdFailedWebhooksDir, id) }
 
 const (
 	EtcdChangeGroupMinRevisionRange = 100
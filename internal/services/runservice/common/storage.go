@@ -0,0 +1,102 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"sort"
+
+	"agola.io/agola/internal/objectstorage"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+type ObjectStoragePartition struct {
+	OST *objectstorage.ObjStorage
+	// Logs reports if the run logs are saved in this partition instead of the
+	// default object storage
+	Logs bool
+}
+
+// ObjectStorages routes the runs logs, archives and caches to the object
+// storage of the run storage partition. The runs without a storage partition
+// use the default object storage. The runs data managed by the datamanager is
+// always saved in the default object storage.
+type ObjectStorages struct {
+	Default    *objectstorage.ObjStorage
+	Partitions map[string]*ObjectStoragePartition
+}
+
+func (o *ObjectStorages) partition(name string) (*ObjectStoragePartition, error) {
+	p, ok := o.Partitions[name]
+	if !ok {
+		return nil, util.NewErrBadRequest(errors.Errorf("storage partition %q doesn't exist", name))
+	}
+	return p, nil
+}
+
+// Check returns an error if the storage partition doesn't exist
+func (o *ObjectStorages) Check(name string) error {
+	if name == "" {
+		return nil
+	}
+	_, err := o.partition(name)
+	return err
+}
+
+// DataOST returns the object storage where the archives and caches of the
+// storage partition are saved
+func (o *ObjectStorages) DataOST(name string) (*objectstorage.ObjStorage, error) {
+	if name == "" {
+		return o.Default, nil
+	}
+	p, err := o.partition(name)
+	if err != nil {
+		return nil, err
+	}
+	return p.OST, nil
+}
+
+// LogsOST returns the object storage where the logs of the storage partition
+// are saved
+func (o *ObjectStorages) LogsOST(name string) (*objectstorage.ObjStorage, error) {
+	if name == "" {
+		return o.Default, nil
+	}
+	p, err := o.partition(name)
+	if err != nil {
+		return nil, err
+	}
+	if !p.Logs {
+		return o.Default, nil
+	}
+	return p.OST, nil
+}
+
+// All returns the default object storage and the object storages of all the
+// partitions
+func (o *ObjectStorages) All() []*objectstorage.ObjStorage {
+	names := []string{}
+	for name := range o.Partitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	osts := []*objectstorage.ObjStorage{o.Default}
+	for _, name := range names {
+		osts = append(osts, o.Partitions[name].OST)
+	}
+	return osts
+}
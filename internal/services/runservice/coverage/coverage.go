@@ -0,0 +1,222 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package coverage
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"agola.io/agola/internal/services/runservice/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	// maxFileSize is the max size of a coverage report file
+	maxFileSize = 256 * 1024 * 1024
+)
+
+// profile keeps the coverable units (lines or statement blocks) and if they
+// are covered. Units with the same key found in multiple files are counted
+// once and they are covered if they are covered in at least one file.
+type profile struct {
+	weights map[string]int
+	covered map[string]bool
+}
+
+func newProfile() *profile {
+	return &profile{
+		weights: map[string]int{},
+		covered: map[string]bool{},
+	}
+}
+
+func (p *profile) add(key string, weight int, covered bool) {
+	p.weights[key] = weight
+	if covered {
+		p.covered[key] = true
+	}
+}
+
+func (p *profile) report(format types.CoverageReportFormat) *types.CoverageReport {
+	report := &types.CoverageReport{Format: format}
+	for key, weight := range p.weights {
+		report.LinesTotal += weight
+		if p.covered[key] {
+			report.LinesCovered += weight
+		}
+	}
+	return report
+}
+
+// ParseArchive parses all the coverage report files inside the provided tar
+// archive
+func ParseArchive(format types.CoverageReportFormat, r io.Reader) (*types.CoverageReport, error) {
+	p := newProfile()
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Errorf("failed to read archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		data, err := ioutil.ReadAll(io.LimitReader(tr, maxFileSize+1))
+		if err != nil {
+			return nil, errors.Errorf("failed to read file %q: %w", hdr.Name, err)
+		}
+		if len(data) > maxFileSize {
+			return nil, errors.Errorf("file %q is bigger than %d bytes", hdr.Name, maxFileSize)
+		}
+
+		if err := parse(p, format, data); err != nil {
+			return nil, errors.Errorf("failed to parse file %q: %w", hdr.Name, err)
+		}
+	}
+
+	return p.report(format), nil
+}
+
+// Parse parses a coverage report file
+func Parse(format types.CoverageReportFormat, data []byte) (*types.CoverageReport, error) {
+	p := newProfile()
+	if err := parse(p, format, data); err != nil {
+		return nil, err
+	}
+	return p.report(format), nil
+}
+
+func parse(p *profile, format types.CoverageReportFormat, data []byte) error {
+	switch format {
+	case types.CoverageReportFormatLcov:
+		return parseLcov(p, data)
+	case types.CoverageReportFormatCobertura:
+		return parseCobertura(p, data)
+	case types.CoverageReportFormatGoCover:
+		return parseGoCover(p, data)
+	default:
+		return errors.Errorf("unknown coverage report format %q", format)
+	}
+}
+
+// parseLcov parses an lcov tracefile using the line data (DA) records
+func parseLcov(p *profile, data []byte) error {
+	var sourceFile string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "SF:"):
+			sourceFile = strings.TrimPrefix(line, "SF:")
+		case line == "end_of_record":
+			sourceFile = ""
+		case strings.HasPrefix(line, "DA:"):
+			if sourceFile == "" {
+				return errors.Errorf("line data record %q outside a source file record", line)
+			}
+			// DA:<line number>,<execution count>[,<checksum>]
+			fields := strings.Split(strings.TrimPrefix(line, "DA:"), ",")
+			if len(fields) < 2 {
+				return errors.Errorf("wrong line data record %q", line)
+			}
+			count, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil {
+				return errors.Errorf("wrong execution count in line data record %q: %w", line, err)
+			}
+			p.add(sourceFile+":"+fields[0], 1, count > 0)
+		}
+	}
+	return scanner.Err()
+}
+
+type coberturaCoverage struct {
+	Packages []*coberturaPackage `xml:"packages>package"`
+}
+
+type coberturaPackage struct {
+	Classes []*coberturaClass `xml:"classes>class"`
+}
+
+type coberturaClass struct {
+	Filename string           `xml:"filename,attr"`
+	Lines    []*coberturaLine `xml:"lines>line"`
+}
+
+type coberturaLine struct {
+	Number string `xml:"number,attr"`
+	Hits   string `xml:"hits,attr"`
+}
+
+// parseCobertura parses a cobertura xml report using the class lines (the
+// methods lines are a subset of them)
+func parseCobertura(p *profile, data []byte) error {
+	var c coberturaCoverage
+	if err := xml.Unmarshal(data, &c); err != nil {
+		return errors.Errorf("failed to unmarshal cobertura report: %w", err)
+	}
+	for _, pkg := range c.Packages {
+		for _, class := range pkg.Classes {
+			for _, line := range class.Lines {
+				hits, err := strconv.ParseFloat(line.Hits, 64)
+				if err != nil {
+					return errors.Errorf("wrong hits %q for line %s of file %q: %w", line.Hits, line.Number, class.Filename, err)
+				}
+				p.add(class.Filename+":"+line.Number, 1, hits > 0)
+			}
+		}
+	}
+	return nil
+}
+
+// parseGoCover parses a go cover profile. The coverage is calculated on the
+// statements like go tool cover does.
+func parseGoCover(p *profile, data []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+		// name.go:line.column,line.column numberOfStatements count
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return errors.Errorf("wrong profile line %q", line)
+		}
+		stmts, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return errors.Errorf("wrong number of statements in profile line %q: %w", line, err)
+		}
+		count, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return errors.Errorf("wrong count in profile line %q: %w", line, err)
+		}
+		p.add(fields[0], stmts, count > 0)
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package coverage
+
+import (
+	"testing"
+
+	"agola.io/agola/internal/services/runservice/types"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		format types.CoverageReportFormat
+		in     string
+		out    *types.CoverageReport
+		err    bool
+	}{
+		{
+			name:   "lcov",
+			format: types.CoverageReportFormatLcov,
+			in: `TN:
+SF:src/a.js
+DA:1,1
+DA:2,0
+DA:3,5
+LF:3
+LH:2
+end_of_record
+SF:src/b.js
+DA:1,0
+end_of_record
+`,
+			out: &types.CoverageReport{Format: types.CoverageReportFormatLcov, LinesTotal: 4, LinesCovered: 2},
+		},
+		{
+			name:   "lcov line data outside source file",
+			format: types.CoverageReportFormatLcov,
+			in:     "DA:1,1\n",
+			err:    true,
+		},
+		{
+			name:   "cobertura",
+			format: types.CoverageReportFormatCobertura,
+			in: `<?xml version="1.0" ?>
+<coverage line-rate="0.5">
+  <packages>
+    <package name="pkg">
+      <classes>
+        <class name="a" filename="pkg/a.py">
+          <methods>
+            <method name="f">
+              <lines><line number="1" hits="1"/></lines>
+            </method>
+          </methods>
+          <lines>
+            <line number="1" hits="1"/>
+            <line number="2" hits="0"/>
+          </lines>
+        </class>
+      </classes>
+    </package>
+  </packages>
+</coverage>
+`,
+			out: &types.CoverageReport{Format: types.CoverageReportFormatCobertura, LinesTotal: 2, LinesCovered: 1},
+		},
+		{
+			name:   "go cover",
+			format: types.CoverageReportFormatGoCover,
+			in: `mode: set
+pkg/a.go:10.2,12.3 2 1
+pkg/a.go:14.2,16.3 3 0
+pkg/a.go:14.2,16.3 3 1
+pkg/b.go:1.2,2.3 5 0
+`,
+			out: &types.CoverageReport{Format: types.CoverageReportFormatGoCover, LinesTotal: 10, LinesCovered: 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := Parse(tt.format, []byte(tt.in))
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Fatalf("coverage report mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
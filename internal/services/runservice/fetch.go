@@ -0,0 +1,161 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runservice
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"agola.io/agola/internal/services/runservice/common"
+	"agola.io/agola/internal/services/runservice/types"
+
+	"github.com/klauspost/compress/zstd"
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	fetchMaxAttempts   = 5
+	fetchRetryInterval = 2 * time.Second
+)
+
+var errFetchNotFound = errors.New("fetched resource not found")
+
+// fetchResumable fetches a log or archive from an executor saving it to a
+// temporary file in dir. Interrupted transfers are retried and, when the
+// executor supports it, resumed from the already received data. The returned
+// file is positioned at its start and must be closed and removed by the
+// caller. errFetchNotFound is returned when the executor doesn't have the
+// resource. The header is sent with every request.
+func fetchResumable(ctx context.Context, u string, header http.Header, resumable bool, dir string, retryInterval time.Duration) (*os.File, error) {
+	if err := os.MkdirAll(dir, 0770); err != nil {
+		return nil, err
+	}
+	f, err := ioutil.TempFile(dir, "fetch-")
+	if err != nil {
+		return nil, err
+	}
+	success := false
+	defer func() {
+		if !success {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	var lastErr error
+	for attempt := 0; attempt < fetchMaxAttempts; attempt++ {
+		if attempt > 0 {
+			log.Warnf("fetch of %q interrupted, retrying: %v", u, lastErr)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(retryInterval):
+			}
+		}
+
+		offset, err := f.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, err
+		}
+		// executors not supporting resuming send everything again
+		if !resumable && offset > 0 {
+			if err := f.Truncate(0); err != nil {
+				return nil, err
+			}
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+			offset = 0
+		}
+
+		lastErr = fetchFrom(ctx, f, u, header, offset)
+		if lastErr == nil {
+			break
+		}
+		if errors.Is(lastErr, errFetchNotFound) {
+			return nil, lastErr
+		}
+	}
+	if lastErr != nil {
+		return nil, errors.Errorf("failed to fetch %q after %d attempts: %w", u, fetchMaxAttempts, lastErr)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	success = true
+	return f, nil
+}
+
+// fetchFrom appends to f the data starting from offset
+func fetchFrom(ctx context.Context, f *os.File, u string, header http.Header, offset int64) error {
+	if offset > 0 {
+		u += "&offset=" + strconv.FormatInt(offset, 10)
+	}
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	r, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode == http.StatusNotFound {
+		return errFetchNotFound
+	}
+	if r.StatusCode != http.StatusOK {
+		return errors.Errorf("received http status: %d", r.StatusCode)
+	}
+
+	size := int64(-1)
+	if sizeStr := r.Header.Get(common.ContentSizeHeader); sizeStr != "" {
+		size, err = strconv.ParseInt(sizeStr, 10, 64)
+		if err != nil {
+			return errors.Errorf("failed to parse content size %q", sizeStr)
+		}
+	}
+
+	var body io.Reader = r.Body
+	if types.ArchiveFormat(r.Header.Get(common.ArchiveFormatHeader)) == types.ArchiveFormatTarZstd || r.Header.Get(common.CompressionHeader) == common.CompressionZstd {
+		dec, err := zstd.NewReader(r.Body)
+		if err != nil {
+			return err
+		}
+		defer dec.Close()
+		body = dec
+	}
+
+	// the decompressed data written before an interruption is a valid prefix
+	// of the resource, so the transfer can be resumed from the file size
+	n, err := io.Copy(f, body)
+	if err != nil {
+		return err
+	}
+	if size >= 0 && offset+n != size {
+		return errors.Errorf("transfer interrupted, received %d of %d bytes", offset+n, size)
+	}
+
+	return nil
+}
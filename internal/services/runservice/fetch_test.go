@@ -0,0 +1,145 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runservice
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	"agola.io/agola/internal/services/runservice/common"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestFetchResumable(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+
+	tests := []struct {
+		name      string
+		resumable bool
+		compress  bool
+	}{
+		{
+			name: "test not resumable",
+		},
+		{
+			name:      "test resumable",
+			resumable: true,
+		},
+		{
+			name:      "test resumable compressed",
+			resumable: true,
+			compress:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			offsets := []int64{}
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+
+				var offset int64
+				if tt.resumable {
+					if s := r.URL.Query().Get("offset"); s != "" {
+						offset, _ = strconv.ParseInt(s, 10, 64)
+					}
+				}
+				offsets = append(offsets, offset)
+
+				d := data[offset:]
+				// interrupt the first transfer in the middle
+				if requests == 1 {
+					d = d[:len(d)/2]
+				}
+				if tt.resumable {
+					w.Header().Set(common.ContentSizeHeader, strconv.Itoa(len(data)))
+				}
+				if tt.compress {
+					w.Header().Set(common.CompressionHeader, common.CompressionZstd)
+					enc, _ := zstd.NewWriter(w)
+					_, _ = enc.Write(d)
+					_ = enc.Close()
+					return
+				}
+				if !tt.resumable {
+					// simulate a connection closed before the declared length
+					w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+				}
+				_, _ = w.Write(d)
+			}))
+			defer ts.Close()
+
+			dir, err := ioutil.TempDir("", "agola")
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			f, err := fetchResumable(context.Background(), ts.URL+"/?taskid=task01", nil, tt.resumable, dir, 0)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			defer os.Remove(f.Name())
+			defer f.Close()
+
+			got, err := ioutil.ReadAll(f)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("fetched data of size %d differs from the expected data of size %d", len(got), len(data))
+			}
+			if requests != 2 {
+				t.Fatalf("got %d requests, want 2", requests)
+			}
+			if tt.resumable && offsets[1] != int64(len(data)/2) {
+				t.Fatalf("got resume offset %d, want %d", offsets[1], len(data)/2)
+			}
+			if !tt.resumable && offsets[1] != 0 {
+				t.Fatalf("got resume offset %d, want 0", offsets[1])
+			}
+		})
+	}
+}
+
+func TestFetchResumableNotFound(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := fetchResumable(context.Background(), ts.URL+"/?taskid=task01", nil, true, dir, 0); err != errFetchNotFound {
+		t.Fatalf("got err %v, want %v", err, errFetchNotFound)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("expected temporary files to be removed")
+	}
+}
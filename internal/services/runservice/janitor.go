@@ -0,0 +1,315 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runservice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"agola.io/agola/internal/etcd"
+	"agola.io/agola/internal/services/runservice/common"
+	"agola.io/agola/internal/services/runservice/store"
+	"agola.io/agola/internal/services/runservice/types"
+
+	"go.etcd.io/etcd/clientv3/concurrency"
+	errors "golang.org/x/xerrors"
+)
+
+func (s *Runservice) janitorLoop(ctx context.Context) {
+	for {
+		log.Debugf("janitor")
+
+		if err := s.janitor(ctx); err != nil {
+			log.Errorf("err: %+v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.c.Janitor.Interval):
+		}
+	}
+}
+
+// janitor handles the runs stuck in intermediate phases: the executor tasks
+// not started by their executor are dispatched again (and failed after the
+// max dispatches), the running executor tasks exceeding their timeout are
+// stopped, the running executor tasks without recent heartbeats are handled
+// as orphaned, the tasks waiting approval for too long are rejected
+// and the runs running for too long are stopped
+func (s *Runservice) janitor(ctx context.Context) error {
+	session, err := concurrency.NewSession(s.e.Client(), concurrency.WithTTL(5), concurrency.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	m := concurrency.NewMutex(session, common.EtcdJanitorLockKey)
+
+	if err := m.Lock(ctx); err != nil {
+		return err
+	}
+	defer func() { _ = m.Unlock(ctx) }()
+
+	now := time.Now()
+
+	resp, err := s.e.List(ctx, common.EtcdTasksDir, "", 0)
+	if err != nil {
+		return err
+	}
+	for _, kv := range resp.Kvs {
+		var et *types.ExecutorTask
+		if err := json.Unmarshal(kv.Value, &et); err != nil {
+			log.Errorf("err: %+v", err)
+			continue
+		}
+		et.Revision = kv.ModRevision
+
+		if et.Stop {
+			continue
+		}
+		switch et.Status.Phase {
+		case types.ExecutorTaskPhaseNotStarted:
+			if et.SubmitTime == nil || now.Sub(*et.SubmitTime) < s.c.Janitor.TaskAckTimeout {
+				continue
+			}
+			if err := s.redispatchExecutorTask(ctx, et); err != nil {
+				log.Errorf("err: %+v", err)
+			}
+		case types.ExecutorTaskPhaseRunning:
+			if et.Timeout > 0 && et.Status.StartTime != nil && now.Sub(*et.Status.StartTime) >= et.Timeout {
+				if err := s.stopTimedOutExecutorTask(ctx, et); err != nil {
+					log.Errorf("err: %+v", err)
+				}
+				continue
+			}
+			// executors not sending heartbeats are ignored
+			if et.Status.HeartbeatTime == nil || now.Sub(*et.Status.HeartbeatTime) < s.c.Janitor.TaskHeartbeatTimeout {
+				continue
+			}
+			if err := s.handleOrphanedExecutorTask(ctx, et, now); err != nil {
+				log.Errorf("err: %+v", err)
+			}
+		}
+	}
+
+	runs, err := store.GetRuns(ctx, s.e)
+	if err != nil {
+		return err
+	}
+	for _, r := range runs {
+		if r.Phase != types.RunPhaseRunning {
+			continue
+		}
+		if err := s.cleanupStuckRun(ctx, r, now); err != nil {
+			log.Errorf("err: %+v", err)
+		}
+	}
+
+	return nil
+}
+
+// redispatchExecutorTask removes an executor task not started by its executor
+// so the scheduler will dispatch it again, choosing a new executor. After the
+// max dispatches the related run task is marked as failed.
+func (s *Runservice) redispatchExecutorTask(ctx context.Context, et *types.ExecutorTask) error {
+	r, _, err := store.GetRun(ctx, s.e, et.RunID)
+	if err != nil {
+		if err == etcd.ErrKeyNotFound {
+			// the executor tasks cleaner will remove it
+			return nil
+		}
+		return err
+	}
+	rt, ok := r.Tasks[et.ID]
+	if !ok {
+		return errors.Errorf("no such task with ID %s in run %s", et.ID, r.ID)
+	}
+	if rt.Status != types.RunTaskStatusNotStarted {
+		return nil
+	}
+
+	if rt.Dispatches+1 >= s.c.Janitor.TaskMaxDispatches {
+		log.Warnf("executor task %q not started by executor %q after %d dispatches, marking it as failed", et.ID, et.Status.ExecutorID, rt.Dispatches+1)
+		failNotStartedRunTask(rt, types.TaskFailureTypeDispatchTimeout, fmt.Sprintf("task not started by the executors after %d dispatches", rt.Dispatches+1))
+	} else {
+		log.Warnf("executor task %q not started by executor %q in %s, dispatching it again", et.ID, et.Status.ExecutorID, s.c.Janitor.TaskAckTimeout)
+		rt.Dispatches++
+	}
+
+	if _, err := store.AtomicPutRun(ctx, s.e, r, nil, nil); err != nil {
+		return err
+	}
+
+	return store.DeleteExecutorTask(ctx, s.e, et.ID)
+}
+
+// handleOrphanedExecutorTask handles a running executor task whose executor
+// stopped sending heartbeats. If the task is idempotent it's reset and
+// dispatched again to a new executor (until the max dispatches), otherwise
+// it's marked as failed.
+func (s *Runservice) handleOrphanedExecutorTask(ctx context.Context, et *types.ExecutorTask, now time.Time) error {
+	orphanedTasksCounter.Inc()
+
+	r, _, err := store.GetRun(ctx, s.e, et.RunID)
+	if err != nil {
+		if err == etcd.ErrKeyNotFound {
+			// the executor tasks cleaner will remove it
+			return nil
+		}
+		return err
+	}
+	rt, ok := r.Tasks[et.ID]
+	if !ok {
+		return errors.Errorf("no such task with ID %s in run %s", et.ID, r.ID)
+	}
+	rc, err := store.OSTGetRunConfig(s.dm, r.ID)
+	if err != nil {
+		return errors.Errorf("cannot get run config %q: %w", r.ID, err)
+	}
+	rct, ok := rc.Tasks[rt.ID]
+	if !ok {
+		return errors.Errorf("no such task with ID %s in run config %s", rt.ID, rc.ID)
+	}
+
+	if rct.Idempotent && !r.Stop && rt.Dispatches+1 < s.c.Janitor.TaskMaxDispatches {
+		log.Warnf("executor task %q orphaned by executor %q, dispatching it again", et.ID, et.Status.ExecutorID)
+		resetRunTask(rt)
+		rt.Dispatches++
+		if _, err := store.AtomicPutRun(ctx, s.e, r, nil, nil); err != nil {
+			return err
+		}
+		if err := store.DeleteExecutorTask(ctx, s.e, et.ID); err != nil {
+			return err
+		}
+		redispatchedOrphanedTasksCounter.Inc()
+		return nil
+	}
+
+	log.Warnf("executor task %q orphaned by executor %q, marking it as failed", et.ID, et.Status.ExecutorID)
+	step := 0
+	for i, ss := range et.Status.Steps {
+		if ss.Phase == types.ExecutorTaskPhaseRunning {
+			step = i
+			break
+		}
+	}
+	et.Stop = true
+	et.Status.Phase = types.ExecutorTaskPhaseFailed
+	et.Status.EndTime = &now
+	et.Status.FailureReason = &types.TaskFailureReason{
+		Type:    types.TaskFailureTypeOrphaned,
+		Step:    step,
+		Message: fmt.Sprintf("no heartbeat from executor %q in %s", et.Status.ExecutorID, s.c.Janitor.TaskHeartbeatTimeout),
+	}
+	if _, err := store.AtomicPutExecutorTask(ctx, s.e, et); err != nil {
+		return err
+	}
+	failedOrphanedTasksCounter.Inc()
+
+	return nil
+}
+
+// stopTimedOutExecutorTask stops an executor task running for more than its
+// timeout
+func (s *Runservice) stopTimedOutExecutorTask(ctx context.Context, et *types.ExecutorTask) error {
+	log.Infof("executor task %q running for more than %s, stopping it", et.ID, et.Timeout)
+	step := 0
+	for i, ss := range et.Status.Steps {
+		if ss.Phase == types.ExecutorTaskPhaseRunning {
+			step = i
+			break
+		}
+	}
+	et.Stop = true
+	et.Status.FailureReason = &types.TaskFailureReason{
+		Type:    types.TaskFailureTypeTimeout,
+		Step:    step,
+		Message: fmt.Sprintf("task exceeded the timeout of %s", et.Timeout),
+	}
+	if _, err := store.AtomicPutExecutorTask(ctx, s.e, et); err != nil {
+		return err
+	}
+	return s.sendExecutorTask(ctx, et)
+}
+
+// resetRunTask resets the run task execution status so it can be executed
+// again from the start
+func resetRunTask(rt *types.RunTask) {
+	rt.Status = types.RunTaskStatusNotStarted
+	rt.SetupStep.Phase = types.ExecutorTaskPhaseNotStarted
+	rt.SetupStep.StartTime = nil
+	rt.SetupStep.EndTime = nil
+	for _, s := range rt.Steps {
+		s.Phase = types.ExecutorTaskPhaseNotStarted
+		s.StartTime = nil
+		s.EndTime = nil
+	}
+	rt.ExportedEnvironment = nil
+	rt.Outputs = nil
+	rt.FailureReason = nil
+	rt.StartTime = nil
+	rt.EndTime = nil
+}
+
+// cleanupStuckRun rejects the run tasks waiting approval for more than the
+// approval max duration and stops the run when it exceeded the run max
+// duration
+func (s *Runservice) cleanupStuckRun(ctx context.Context, r *types.Run, now time.Time) error {
+	changed := false
+
+	approvalMaxDuration := s.c.Janitor.ApprovalMaxDuration
+	if approvalMaxDuration > 0 && len(r.TasksWaitingApproval()) > 0 {
+		rc, err := store.OSTGetRunConfig(s.dm, r.ID)
+		if err != nil {
+			return errors.Errorf("cannot get run config %q: %w", r.ID, err)
+		}
+		for _, rt := range r.Tasks {
+			if !rt.WaitingApproval || rt.WaitingApprovalTime == nil {
+				continue
+			}
+			// tasks with an approval timeout are handled by the scheduler
+			if rct, ok := rc.Tasks[rt.ID]; !ok || rct.ApprovalTimeout != nil {
+				continue
+			}
+			if now.Sub(*rt.WaitingApprovalTime) < approvalMaxDuration {
+				continue
+			}
+
+			log.Infof("run %q task %q waiting approval for more than %s, rejecting it", r.ID, rt.ID, approvalMaxDuration)
+			rt.WaitingApproval = false
+			rt.ApprovalTimedOut = true
+			failNotStartedRunTask(rt, types.TaskFailureTypeApprovalTimeout, fmt.Sprintf("task not approved in %s", approvalMaxDuration))
+			changed = true
+		}
+	}
+
+	runMaxDuration := s.c.Janitor.RunMaxDuration
+	if runMaxDuration > 0 && !r.Stop && r.StartTime != nil && now.Sub(*r.StartTime) >= runMaxDuration {
+		log.Infof("run %q running for more than %s, stopping it", r.ID, runMaxDuration)
+		r.Stop = true
+		r.StopReason = fmt.Sprintf("run exceeded the max duration of %s", runMaxDuration)
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+
+	_, err := store.AtomicPutRun(ctx, s.e, r, nil, nil)
+	return err
+}
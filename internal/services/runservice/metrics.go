@@ -0,0 +1,51 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runservice
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	orphanedTasksCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "agola_runservice_orphaned_tasks_total",
+		Help: "Number of running tasks without executor heartbeats",
+	})
+	redispatchedOrphanedTasksCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "agola_runservice_orphaned_tasks_redispatched_total",
+		Help: "Number of orphaned idempotent tasks dispatched again to a new executor",
+	})
+	failedOrphanedTasksCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "agola_runservice_orphaned_tasks_failed_total",
+		Help: "Number of orphaned tasks marked as failed",
+	})
+	taskQueueWaitHistogram = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "agola_runservice_task_queue_wait_seconds",
+		Help:    "Time the tasks waited between being schedulable and being started by an executor",
+		Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600},
+	})
+	taskQueueWaitAlertsCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "agola_runservice_task_queue_wait_alerts_total",
+		Help: "Number of tasks that waited more than the queue wait alert threshold",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(orphanedTasksCounter)
+	prometheus.MustRegister(redispatchedOrphanedTasksCounter)
+	prometheus.MustRegister(failedOrphanedTasksCounter)
+	prometheus.MustRegister(taskQueueWaitHistogram)
+	prometheus.MustRegister(taskQueueWaitAlertsCounter)
+}
@@ -18,10 +18,14 @@ var Stmts = []string{
 	// last processed etcd event revision
 	"create table revision (revision bigint, PRIMARY KEY(revision))",
 
-	"create table run (id varchar, grouppath varchar, phase varchar, result varchar, PRIMARY KEY (id, grouppath, phase))",
+	"create table run (id varchar, grouppath varchar, phase varchar, result varchar, counter bigint, name varchar, pinned boolean, PRIMARY KEY (id, grouppath, phase))",
 
 	"create table rundata (id varchar, data bytea, PRIMARY KEY (id))",
 
+	// runlabel stores the run labels used to filter the runs
+	"create table runlabel (runid varchar, key varchar, value varchar, PRIMARY KEY (runid, key))",
+	"create index runlabel_key_value on runlabel (key, value)",
+
 	"create table runevent (sequence varchar, data bytea, PRIMARY KEY (sequence))",
 
 	// changegrouprevision stores the current revision of the changegroup for optimistic locking
@@ -35,9 +39,18 @@ var Stmts = []string{
 
 	"create table changegrouprevision_ost (id varchar, revision varchar, PRIMARY KEY (id, revision))",
 
-	"create table run_ost (id varchar, grouppath varchar, phase varchar, result varchar, PRIMARY KEY (id, grouppath, phase))",
+	"create table run_ost (id varchar, grouppath varchar, phase varchar, result varchar, counter bigint, name varchar, pinned boolean, PRIMARY KEY (id, grouppath, phase))",
 
 	"create table rundata_ost (id varchar, data bytea, PRIMARY KEY (id))",
 
+	"create table runlabel_ost (runid varchar, key varchar, value varchar, PRIMARY KEY (runid, key))",
+	"create index runlabel_ost_key_value on runlabel_ost (key, value)",
+
 	"create table runcounter_ost (groupid varchar, counter bigint, PRIMARY KEY (groupid))",
+
+	// taskresult_ost stores the final status of the tasks of the finished runs, used to detect flaky tasks
+	"create table taskresult_ost (runid varchar, grouppath varchar, taskname varchar, status varchar, flaky boolean, PRIMARY KEY (runid, taskname))",
+
+	// runstat_ost stores the result and timings (in milliseconds) of the finished runs. It's updated when syncing the runs and used to compute the runs statistics without reading all the runs data
+	"create table runstat_ost (runid varchar, grouppath varchar, result varchar, endtime bigint, duration bigint, queuewait bigint, PRIMARY KEY (runid))",
 }
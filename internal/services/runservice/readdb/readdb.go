@@ -60,10 +60,12 @@ var (
 	revisionInsert = sb.Insert("revision").Columns("revision")
 
 	//runSelect = sb.Select("id", "grouppath", "phase", "result").From("run")
-	runInsert = sb.Insert("run").Columns("id", "grouppath", "phase", "result")
+	runInsert = sb.Insert("run").Columns("id", "grouppath", "phase", "result", "counter", "name", "pinned")
 
 	rundataInsert = sb.Insert("rundata").Columns("id", "data")
 
+	runlabelInsert = sb.Insert("runlabel").Columns("runid", "key", "value")
+
 	//runeventSelect = sb.Select("data").From("runevent")
 	runeventInsert = sb.Insert("runevent").Columns("sequence", "data")
 
@@ -75,10 +77,12 @@ var (
 	revisionOSTInsert = sb.Insert("revision_ost").Columns("revision")
 
 	//runOSTSelect = sb.Select("id", "grouppath", "phase", "result").From("run_ost")
-	runOSTInsert = sb.Insert("run_ost").Columns("id", "grouppath", "phase", "result")
+	runOSTInsert = sb.Insert("run_ost").Columns("id", "grouppath", "phase", "result", "counter", "name", "pinned")
 
 	rundataOSTInsert = sb.Insert("rundata_ost").Columns("id", "data")
 
+	runlabelOSTInsert = sb.Insert("runlabel_ost").Columns("runid", "key", "value")
+
 	committedwalsequenceOSTSelect = sb.Select("seq").From("committedwalsequence_ost")
 	committedwalsequenceOSTInsert = sb.Insert("committedwalsequence_ost").Columns("seq")
 
@@ -87,6 +91,12 @@ var (
 
 	runcounterOSTSelect = sb.Select("groupid", "counter").From("runcounter_ost")
 	runcounterOSTInsert = sb.Insert("runcounter_ost").Columns("groupid", "counter")
+
+	taskresultOSTSelect = sb.Select("runid", "taskname", "status", "flaky").From("taskresult_ost")
+	taskresultOSTInsert = sb.Insert("taskresult_ost").Columns("runid", "grouppath", "taskname", "status", "flaky")
+
+	runstatOSTSelect = sb.Select("result", "duration", "queuewait").From("runstat_ost")
+	runstatOSTInsert = sb.Insert("runstat_ost").Columns("runid", "grouppath", "result", "endtime", "duration", "queuewait")
 )
 
 type ReadDB struct {
@@ -339,7 +349,7 @@ func (r *ReadDB) handleEvents(ctx context.Context) error {
 		if err != nil {
 			return err
 		}
-		lastRuns, err = r.GetActiveRuns(tx, nil, true, nil, nil, "", 1, types.SortOrderDesc)
+		lastRuns, err = r.GetActiveRuns(tx, &GetRunsOptions{LastRun: true, Limit: 1, SortOrder: types.SortOrderDesc})
 		return err
 	})
 	if err != nil {
@@ -445,6 +455,9 @@ func (r *ReadDB) handleRunEvent(tx *db.Tx, ev *etcdclientv3.Event, wresp *etcdcl
 		if _, err := tx.Exec("delete from run where id = $1", runID); err != nil {
 			return errors.Errorf("failed to delete run: %w", err)
 		}
+		if _, err := tx.Exec("delete from runlabel where runid = $1", runID); err != nil {
+			return errors.Errorf("failed to delete run labels: %w", err)
+		}
 
 		// Run has been deleted from etcd, this means that it was stored in the objectstorage
 		// TODO(sgotti) this is here just to avoid a window where the run is not in
@@ -995,7 +1008,7 @@ func insertRun(tx *db.Tx, run *types.Run, data []byte) error {
 	if _, err := tx.Exec("delete from run where id = $1", run.ID); err != nil {
 		return errors.Errorf("failed to delete run: %w", err)
 	}
-	q, args, err := runInsert.Values(run.ID, groupPath, run.Phase, run.Result).ToSql()
+	q, args, err := runInsert.Values(run.ID, groupPath, run.Phase, run.Result, run.Counter, run.Name, run.Pinned).ToSql()
 	if err != nil {
 		return errors.Errorf("failed to build query: %w", err)
 	}
@@ -1015,6 +1028,20 @@ func insertRun(tx *db.Tx, run *types.Run, data []byte) error {
 		return err
 	}
 
+	// poor man insert or update that works because transaction isolation level is serializable
+	if _, err := tx.Exec("delete from runlabel where runid = $1", run.ID); err != nil {
+		return errors.Errorf("failed to delete run labels: %w", err)
+	}
+	for k, v := range run.Labels {
+		q, args, err = runlabelInsert.Values(run.ID, k, v).ToSql()
+		if err != nil {
+			return errors.Errorf("failed to build query: %w", err)
+		}
+		if _, err = tx.Exec(q, args...); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -1029,7 +1056,7 @@ func (r *ReadDB) insertRunOST(tx *db.Tx, run *types.Run, data []byte) error {
 	if _, err := tx.Exec("delete from run_ost where id = $1", run.ID); err != nil {
 		return errors.Errorf("failed to delete run objectstorage: %w", err)
 	}
-	q, args, err := runOSTInsert.Values(run.ID, groupPath, run.Phase, run.Result).ToSql()
+	q, args, err := runOSTInsert.Values(run.ID, groupPath, run.Phase, run.Result, run.Counter, run.Name, run.Pinned).ToSql()
 	if err != nil {
 		return errors.Errorf("failed to build query: %w", err)
 	}
@@ -1049,9 +1076,110 @@ func (r *ReadDB) insertRunOST(tx *db.Tx, run *types.Run, data []byte) error {
 		return err
 	}
 
+	// poor man insert or update that works because transaction isolation level is serializable
+	if _, err := tx.Exec("delete from runlabel_ost where runid = $1", run.ID); err != nil {
+		return errors.Errorf("failed to delete run labels: %w", err)
+	}
+	for k, v := range run.Labels {
+		q, args, err = runlabelOSTInsert.Values(run.ID, k, v).ToSql()
+		if err != nil {
+			return errors.Errorf("failed to build query: %w", err)
+		}
+		if _, err = tx.Exec(q, args...); err != nil {
+			return err
+		}
+	}
+
+	if err := r.insertRunStatOST(tx, run, groupPath); err != nil {
+		return err
+	}
+
+	return r.insertTaskResultsOST(tx, run, groupPath)
+}
+
+func (r *ReadDB) insertRunStatOST(tx *db.Tx, run *types.Run, groupPath string) error {
+	// poor man insert or update that works because transaction isolation level is serializable
+	if _, err := tx.Exec("delete from runstat_ost where runid = $1", run.ID); err != nil {
+		return errors.Errorf("failed to delete run stat: %w", err)
+	}
+	if run.Phase != types.RunPhaseFinished || run.EndTime == nil {
+		return nil
+	}
+
+	var duration, queueWait time.Duration
+	if run.StartTime != nil {
+		duration = run.EndTime.Sub(*run.StartTime)
+		if run.EnqueueTime != nil {
+			queueWait = run.StartTime.Sub(*run.EnqueueTime)
+		}
+	}
+
+	q, args, err := runstatOSTInsert.Values(run.ID, groupPath, run.Result, run.EndTime.Unix(), int64(duration/time.Millisecond), int64(queueWait/time.Millisecond)).ToSql()
+	if err != nil {
+		return errors.Errorf("failed to build query: %w", err)
+	}
+	if _, err = tx.Exec(q, args...); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *ReadDB) insertTaskResultsOST(tx *db.Tx, run *types.Run, groupPath string) error {
+	// poor man insert or update that works because transaction isolation level is serializable
+	if _, err := tx.Exec("delete from taskresult_ost where runid = $1", run.ID); err != nil {
+		return errors.Errorf("failed to delete task results: %w", err)
+	}
+	if run.Phase != types.RunPhaseFinished {
+		return nil
+	}
+
+	// the task names are only available in the run config
+	rc, err := store.OSTGetRunConfig(r.dm, run.ID)
+	if err != nil {
+		// don't block the readdb sync, the run will just be ignored when
+		// reporting the task results
+		r.log.Warnf("failed to get run config %q, task results won't be saved: %+v", run.ID, err)
+		return nil
+	}
+
+	for _, rt := range run.Tasks {
+		if rt.Status != types.RunTaskStatusSuccess && rt.Status != types.RunTaskStatusFailed {
+			continue
+		}
+		rct, ok := rc.Tasks[rt.ID]
+		if !ok {
+			continue
+		}
+
+		// a task is flaky when it succeeded only after being retried
+		flaky := rt.Status == types.RunTaskStatusSuccess && taskRetried(rt)
+
+		q, args, err := taskresultOSTInsert.Values(run.ID, groupPath, rct.Name, rt.Status, flaky).ToSql()
+		if err != nil {
+			return errors.Errorf("failed to build query: %w", err)
+		}
+		if _, err = tx.Exec(q, args...); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// taskRetried reports if the task (or one of its steps) has been retried
+func taskRetried(rt *types.RunTask) bool {
+	if rt.Attempts > 1 {
+		return true
+	}
+	for _, rts := range rt.Steps {
+		if rts.Attempts > 1 {
+			return true
+		}
+	}
+	return false
+}
+
 func insertChangeGroupRevision(tx *db.Tx, changegroupID string, revision int64) error {
 	// poor man insert or update that works because transaction isolation level is serializable
 	if _, err := tx.Exec("delete from changegrouprevision where id = $1", changegroupID); err != nil {
@@ -1121,22 +1249,45 @@ func (r *ReadDB) GetChangeGroupsUpdateTokens(tx *db.Tx, groups []string) (*types
 	return &types.ChangeGroupsUpdateToken{CurRevision: revision, ChangeGroupsRevisions: changeGroupsRevisions}, nil
 }
 
-func (r *ReadDB) GetActiveRuns(tx *db.Tx, groups []string, lastRun bool, phaseFilter []types.RunPhase, resultFilter []types.RunResult, startRunID string, limit int, sortOrder types.SortOrder) ([]*RunData, error) {
-	return r.getRunsFilteredActive(tx, groups, lastRun, phaseFilter, resultFilter, startRunID, limit, sortOrder)
+// GetRunsOptions defines the filters, the order and the pagination of the
+// runs returned by GetRuns and GetActiveRuns
+type GetRunsOptions struct {
+	// Groups are the groups of the returned runs
+	Groups []string
+	// Names, when not empty, are the accepted run names (the config run names)
+	Names []string
+	// Labels, when not empty, are the labels that the runs must all have
+	Labels map[string]string
+	// LastRun returns only the last run of every group
+	LastRun bool
+
+	PhaseFilter  []types.RunPhase
+	ResultFilter []types.RunResult
+	// Pinned returns only the pinned runs
+	Pinned bool
+
+	StartRunID string
+	Limit      int
+	SortOrder  types.SortOrder
+}
+
+func (r *ReadDB) GetActiveRuns(tx *db.Tx, opts *GetRunsOptions) ([]*RunData, error) {
+	return r.getRunsFilteredActive(tx, opts)
 }
 
-func (r *ReadDB) GetRuns(tx *db.Tx, groups []string, lastRun bool, phaseFilter []types.RunPhase, resultFilter []types.RunResult, startRunID string, limit int, sortOrder types.SortOrder) ([]*types.Run, error) {
+// GetRuns returns the runs matching the provided options
+func (r *ReadDB) GetRuns(tx *db.Tx, opts *GetRunsOptions) ([]*types.Run, error) {
 	useObjectStorage := false
-	for _, phase := range phaseFilter {
+	for _, phase := range opts.PhaseFilter {
 		if phase == types.RunPhaseFinished || phase == types.RunPhaseCancelled {
 			useObjectStorage = true
 		}
 	}
-	if len(phaseFilter) == 0 {
+	if len(opts.PhaseFilter) == 0 {
 		useObjectStorage = true
 	}
 
-	runDataRDB, err := r.getRunsFilteredActive(tx, groups, lastRun, phaseFilter, resultFilter, startRunID, limit, sortOrder)
+	runDataRDB, err := r.getRunsFilteredActive(tx, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -1149,15 +1300,15 @@ func (r *ReadDB) GetRuns(tx *db.Tx, groups []string, lastRun bool, phaseFilter [
 
 	if useObjectStorage {
 		// skip if the phase requested is not finished
-		runDataOST, err := r.GetRunsFilteredOST(tx, groups, lastRun, phaseFilter, resultFilter, startRunID, limit, sortOrder)
+		runDataOST, err := r.GetRunsFilteredOST(tx, opts)
 		if err != nil {
 			return nil, err
 		}
 
 		for _, rd := range runDataOST {
-			if lastRun {
+			if opts.LastRun {
 				if lr, ok := lastRunsMap[rd.GroupPath]; ok {
-					switch sortOrder {
+					switch opts.SortOrder {
 					case types.SortOrderAsc:
 						if rd.ID < lr.ID {
 							lastRunsMap[rd.GroupPath] = rd
@@ -1181,7 +1332,7 @@ func (r *ReadDB) GetRuns(tx *db.Tx, groups []string, lastRun bool, phaseFilter [
 	for k := range runsMap {
 		keys = append(keys, k)
 	}
-	switch sortOrder {
+	switch opts.SortOrder {
 	case types.SortOrderAsc:
 		sort.Sort(sort.StringSlice(keys))
 	case types.SortOrderDesc:
@@ -1192,7 +1343,7 @@ func (r *ReadDB) GetRuns(tx *db.Tx, groups []string, lastRun bool, phaseFilter [
 
 	count := 0
 	for _, runID := range keys {
-		if count >= limit {
+		if count >= opts.Limit {
 			break
 		}
 		count++
@@ -1215,57 +1366,74 @@ func (r *ReadDB) GetRuns(tx *db.Tx, groups []string, lastRun bool, phaseFilter [
 	return aruns, nil
 }
 
-func (r *ReadDB) getRunsFilteredQuery(phaseFilter []types.RunPhase, resultFilter []types.RunResult, groups []string, lastRun bool, startRunID string, limit int, sortOrder types.SortOrder, objectstorage bool) sq.SelectBuilder {
+func (r *ReadDB) getRunsFilteredQuery(opts *GetRunsOptions, objectstorage bool) sq.SelectBuilder {
 	runt := "run"
 	rundatat := "rundata"
+	runlabelt := "runlabel"
 	fields := []string{"run.id", "run.grouppath", "run.phase", "rundata.data"}
-	if len(groups) > 0 && lastRun {
+	if len(opts.Groups) > 0 && opts.LastRun {
 		fields = []string{"max(run.id)", "run.grouppath", "run.phase", "rundata.data"}
 	}
 	if objectstorage {
 		runt = "run_ost"
 		rundatat = "rundata_ost"
+		runlabelt = "runlabel_ost"
 	}
 
 	r.log.Debugf("runt: %s", runt)
 	s := sb.Select(fields...).From(runt + " as run")
-	switch sortOrder {
+	switch opts.SortOrder {
 	case types.SortOrderAsc:
 		s = s.OrderBy("run.id asc")
 	case types.SortOrderDesc:
 		s = s.OrderBy("run.id desc")
 	}
-	if len(phaseFilter) > 0 {
-		s = s.Where(sq.Eq{"phase": phaseFilter})
+	if len(opts.PhaseFilter) > 0 {
+		s = s.Where(sq.Eq{"phase": opts.PhaseFilter})
+	}
+	if len(opts.ResultFilter) > 0 {
+		s = s.Where(sq.Eq{"result": opts.ResultFilter})
+	}
+	if len(opts.Names) > 0 {
+		s = s.Where(sq.Eq{"run.name": opts.Names})
+	}
+	if opts.Pinned {
+		s = s.Where(sq.Eq{"run.pinned": true})
+	}
+	// every label must match
+	labelKeys := make([]string, 0, len(opts.Labels))
+	for k := range opts.Labels {
+		labelKeys = append(labelKeys, k)
 	}
-	if len(resultFilter) > 0 {
-		s = s.Where(sq.Eq{"result": resultFilter})
+	sort.Strings(labelKeys)
+	for _, k := range labelKeys {
+		s = s.Where(fmt.Sprintf("run.id in (select runid from %s where key = ? and value = ?)", runlabelt), k, opts.Labels[k])
 	}
-	if startRunID != "" {
-		if lastRun {
-			switch sortOrder {
+	if opts.StartRunID != "" {
+		if opts.LastRun {
+			switch opts.SortOrder {
 			case types.SortOrderAsc:
-				s = s.Having(sq.Gt{"run.id": startRunID})
+				s = s.Having(sq.Gt{"run.id": opts.StartRunID})
 			case types.SortOrderDesc:
-				s = s.Having(sq.Lt{"run.id": startRunID})
+				s = s.Having(sq.Lt{"run.id": opts.StartRunID})
 			}
 		} else {
-			switch sortOrder {
+			switch opts.SortOrder {
 			case types.SortOrderAsc:
-				s = s.Where(sq.Gt{"run.id": startRunID})
+				s = s.Where(sq.Gt{"run.id": opts.StartRunID})
 			case types.SortOrderDesc:
-				s = s.Where(sq.Lt{"run.id": startRunID})
+				s = s.Where(sq.Lt{"run.id": opts.StartRunID})
 			}
 		}
 	}
-	if limit > 0 {
-		s = s.Limit(uint64(limit))
+	if opts.Limit > 0 {
+		s = s.Limit(uint64(opts.Limit))
 	}
 
 	s = s.Join(fmt.Sprintf("%s as rundata on rundata.id = run.id", rundatat))
-	if len(groups) > 0 {
+	if len(opts.Groups) > 0 {
 		cond := sq.Or{}
-		for _, groupPath := range groups {
+		for _, groupPath := range opts.Groups {
 			// add ending slash to distinguish between final group (i.e project/projectid/branch/feature and project/projectid/branch/feature02)
 			if !strings.HasSuffix(groupPath, "/") {
 				groupPath += "/"
@@ -1274,7 +1442,7 @@ func (r *ReadDB) getRunsFilteredQuery(phaseFilter []types.RunPhase, resultFilter
 			cond = append(cond, sq.Like{"run.grouppath": groupPath + "%"})
 		}
 		s = s.Where(sq.Or{cond})
-		if lastRun {
+		if opts.LastRun {
 			s = s.GroupBy("run.grouppath")
 		}
 	}
@@ -1282,8 +1450,8 @@ func (r *ReadDB) getRunsFilteredQuery(phaseFilter []types.RunPhase, resultFilter
 	return s
 }
 
-func (r *ReadDB) getRunsFilteredActive(tx *db.Tx, groups []string, lastRun bool, phaseFilter []types.RunPhase, resultFilter []types.RunResult, startRunID string, limit int, sortOrder types.SortOrder) ([]*RunData, error) {
-	s := r.getRunsFilteredQuery(phaseFilter, resultFilter, groups, lastRun, startRunID, limit, sortOrder, false)
+func (r *ReadDB) getRunsFilteredActive(tx *db.Tx, opts *GetRunsOptions) ([]*RunData, error) {
+	s := r.getRunsFilteredQuery(opts, false)
 
 	q, args, err := s.ToSql()
 	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
@@ -1294,8 +1462,8 @@ func (r *ReadDB) getRunsFilteredActive(tx *db.Tx, groups []string, lastRun bool,
 	return fetchRuns(tx, q, args...)
 }
 
-func (r *ReadDB) GetRunsFilteredOST(tx *db.Tx, groups []string, lastRun bool, phaseFilter []types.RunPhase, resultFilter []types.RunResult, startRunID string, limit int, sortOrder types.SortOrder) ([]*RunData, error) {
-	s := r.getRunsFilteredQuery(phaseFilter, resultFilter, groups, lastRun, startRunID, limit, sortOrder, true)
+func (r *ReadDB) GetRunsFilteredOST(tx *db.Tx, opts *GetRunsOptions) ([]*RunData, error) {
+	s := r.getRunsFilteredQuery(opts, true)
 
 	q, args, err := s.ToSql()
 	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
@@ -1319,9 +1487,87 @@ func (r *ReadDB) GetRun(tx *db.Tx, runID string) (*types.Run, error) {
 	return r.getRun(tx, runID, true)
 }
 
+// GetRunNames returns the distinct names (the config run names) of the runs
+// of the provided group, sorted by name
+func (r *ReadDB) GetRunNames(tx *db.Tx, group string) ([]string, error) {
+	if !strings.HasSuffix(group, "/") {
+		group += "/"
+	}
+
+	namesMap := map[string]struct{}{}
+	for _, runt := range []string{"run", "run_ost"} {
+		q, args, err := sb.Select("distinct name").From(runt).Where(sq.Like{"grouppath": group + "%"}).ToSql()
+		r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+		if err != nil {
+			return nil, errors.Errorf("failed to build query: %w", err)
+		}
+
+		rows, err := tx.Query(q, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				rows.Close()
+				return nil, errors.Errorf("failed to scan rows: %w", err)
+			}
+			namesMap[name] = struct{}{}
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		rows.Close()
+	}
+
+	names := make([]string, 0, len(namesMap))
+	for name := range namesMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// GetRunByCounter returns the run of the provided root group (i.e.
+// /project/projectid) with the provided counter
+func (r *ReadDB) GetRunByCounter(tx *db.Tx, group string, counter uint64) (*types.Run, error) {
+	run, err := r.getRunByCounter(tx, group, counter, false)
+	if err != nil {
+		return nil, err
+	}
+	if run != nil {
+		return run, nil
+	}
+
+	// try to fetch from ost
+	return r.getRunByCounter(tx, group, counter, true)
+}
+
+func (r *ReadDB) getRunByCounter(tx *db.Tx, group string, counter uint64, ost bool) (*types.Run, error) {
+	runt := "run"
+	rundatat := "rundata"
+	if ost {
+		runt = "run_ost"
+		rundatat = "rundata_ost"
+	}
+	if !strings.HasSuffix(group, "/") {
+		group += "/"
+	}
+
+	s := sb.Select("run.id", "run.grouppath", "run.phase", "rundata.data").From(runt + " as run")
+	s = s.Where(sq.And{sq.Like{"run.grouppath": group + "%"}, sq.Eq{"run.counter": counter}})
+	s = s.Join(fmt.Sprintf("%s as rundata on rundata.id = run.id", rundatat))
+
+	return r.fetchRun(tx, s, ost)
+}
+
 func (r *ReadDB) getRun(tx *db.Tx, runID string, ost bool) (*types.Run, error) {
-	s := r.getRunQuery(runID, ost)
+	return r.fetchRun(tx, r.getRunQuery(runID, ost), ost)
+}
 
+func (r *ReadDB) fetchRun(tx *db.Tx, s sq.SelectBuilder, ost bool) (*types.Run, error) {
 	q, args, err := s.ToSql()
 	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
 	if err != nil {
@@ -1346,7 +1592,7 @@ func (r *ReadDB) getRun(tx *db.Tx, runID string, ost bool) (*types.Run, error) {
 			return nil, errors.Errorf("nil active run data. This should never happen")
 		}
 		// get run from objectstorage
-		run, err = store.OSTGetRun(r.dm, runID)
+		run, err = store.OSTGetRun(r.dm, runsData[0].ID)
 		if err != nil {
 			return nil, err
 		}
@@ -1599,6 +1845,226 @@ func (r *ReadDB) GetRunCountersOST(tx *db.Tx, start string, limit int) ([]*types
 	return fetchRunCounters(tx, q, args...)
 }
 
+// GetTasksFlakinessOST returns the flakiness of the tasks executed in the last
+// limit finished runs of the provided group
+func (r *ReadDB) GetTasksFlakinessOST(tx *db.Tx, group string, limit int) ([]*types.TaskFlakiness, error) {
+	// add ending slash to distinguish between final group (i.e project/projectid/branch/feature and project/projectid/branch/feature02)
+	if !strings.HasSuffix(group, "/") {
+		group += "/"
+	}
+
+	s := sb.Select("id").From("run_ost").Where(sq.Like{"grouppath": group + "%"}).Where(sq.Eq{"phase": types.RunPhaseFinished}).OrderBy("id desc")
+	if limit > 0 {
+		s = s.Limit(uint64(limit))
+	}
+	q, args, err := s.ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+	runIDs, err := fetchIDs(tx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(runIDs) == 0 {
+		return []*types.TaskFlakiness{}, nil
+	}
+
+	q, args, err = taskresultOSTSelect.Where(sq.Eq{"runid": runIDs}).OrderBy("runid asc").ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+	rows, err := tx.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tfs := map[string]*types.TaskFlakiness{}
+	lastStatus := map[string]types.RunTaskStatus{}
+	for rows.Next() {
+		var runID, taskName string
+		var status types.RunTaskStatus
+		var flaky bool
+		if err := rows.Scan(&runID, &taskName, &status, &flaky); err != nil {
+			return nil, errors.Errorf("failed to scan rows: %w", err)
+		}
+
+		tf, ok := tfs[taskName]
+		if !ok {
+			tf = &types.TaskFlakiness{TaskName: taskName}
+			tfs[taskName] = tf
+		}
+		tf.Runs++
+		if status == types.RunTaskStatusFailed {
+			tf.Failures++
+		}
+		if flaky {
+			tf.FlakyRuns++
+			tf.LastFlakyRunID = runID
+		}
+		if ls, ok := lastStatus[taskName]; ok && ls != status {
+			tf.Flips++
+		}
+		lastStatus[taskName] = status
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	res := make([]*types.TaskFlakiness, 0, len(tfs))
+	for _, tf := range tfs {
+		res = append(res, tf)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].TaskName < res[j].TaskName })
+
+	return res, nil
+}
+
+// GetRunsStatsOST returns the statistics of the runs of the provided group
+// finished after since. Only the first hotspotsLimit failure hotspots are
+// returned.
+// The statistics are calculated only from the runs already synced from the
+// objectstorage, so the latest finished runs not yet saved in the
+// objectstorage are missing.
+func (r *ReadDB) GetRunsStatsOST(tx *db.Tx, group string, since time.Time, hotspotsLimit int) (*types.RunsStats, error) {
+	// add ending slash to distinguish between final group (i.e project/projectid/branch/feature and project/projectid/branch/feature02)
+	if !strings.HasSuffix(group, "/") {
+		group += "/"
+	}
+
+	q, args, err := runstatOSTSelect.Where(sq.Like{"grouppath": group + "%"}).Where(sq.GtOrEq{"endtime": since.Unix()}).ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+	rows, err := tx.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := &types.RunsStats{FailureHotspots: []*types.TaskFailureHotspot{}}
+	durations := []int64{}
+	queueWaits := []int64{}
+	for rows.Next() {
+		var result types.RunResult
+		var duration, queueWait int64
+		if err := rows.Scan(&result, &duration, &queueWait); err != nil {
+			return nil, errors.Errorf("failed to scan rows: %w", err)
+		}
+
+		stats.Runs++
+		switch result {
+		case types.RunResultSuccess:
+			stats.Successes++
+		case types.RunResultFailed:
+			stats.Failures++
+		}
+		durations = append(durations, duration)
+		queueWaits = append(queueWaits, queueWait)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if stats.Runs == 0 {
+		return stats, nil
+	}
+
+	stats.SuccessRate = float64(stats.Successes) / float64(stats.Runs)
+	stats.MedianDuration = time.Duration(median(durations)) * time.Millisecond
+	stats.MedianQueueWait = time.Duration(median(queueWaits)) * time.Millisecond
+
+	q, args, err = sb.Select("taskname", "status", "count(*)").From("taskresult_ost").
+		Where(sq.Expr("runid in (select runid from runstat_ost where grouppath like ? and endtime >= ?)", group+"%", since.Unix())).
+		GroupBy("taskname", "status").ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+	trows, err := tx.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer trows.Close()
+
+	hotspots := map[string]*types.TaskFailureHotspot{}
+	for trows.Next() {
+		var taskName string
+		var status types.RunTaskStatus
+		var count int
+		if err := trows.Scan(&taskName, &status, &count); err != nil {
+			return nil, errors.Errorf("failed to scan rows: %w", err)
+		}
+
+		h, ok := hotspots[taskName]
+		if !ok {
+			h = &types.TaskFailureHotspot{TaskName: taskName}
+			hotspots[taskName] = h
+		}
+		h.Runs += count
+		if status == types.RunTaskStatusFailed {
+			h.Failures += count
+		}
+	}
+	if err := trows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, h := range hotspots {
+		if h.Failures > 0 {
+			stats.FailureHotspots = append(stats.FailureHotspots, h)
+		}
+	}
+	sort.Slice(stats.FailureHotspots, func(i, j int) bool {
+		hi, hj := stats.FailureHotspots[i], stats.FailureHotspots[j]
+		if hi.Failures != hj.Failures {
+			return hi.Failures > hj.Failures
+		}
+		return hi.TaskName < hj.TaskName
+	})
+	if hotspotsLimit > 0 && len(stats.FailureHotspots) > hotspotsLimit {
+		stats.FailureHotspots = stats.FailureHotspots[:hotspotsLimit]
+	}
+
+	return stats, nil
+}
+
+// median returns the median of the provided values, sorting them
+func median(values []int64) int64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	m := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[m-1] + values[m]) / 2
+	}
+	return values[m]
+}
+
+func fetchIDs(tx *db.Tx, q string, args ...interface{}) ([]string, error) {
+	rows, err := tx.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, errors.Errorf("failed to scan rows: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
 func fetchRunCounters(tx *db.Tx, q string, args ...interface{}) ([]*types.RunCounter, error) {
 	rows, err := tx.Query(q, args...)
 	if err != nil {
@@ -0,0 +1,532 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package readdb
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/services/runservice/types"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap"
+)
+
+func setupReadDB(t *testing.T) (*ReadDB, func()) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	r, err := NewReadDB(context.Background(), zap.NewNop(), dir, nil, nil, nil)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("unexpected err: %v", err)
+	}
+	r.SetInitialized(true)
+
+	return r, func() {
+		r.rdb.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+type testTaskResult struct {
+	name   string
+	status types.RunTaskStatus
+	flaky  bool
+}
+
+type testRun struct {
+	id          string
+	group       string
+	phase       types.RunPhase
+	result      types.RunResult
+	end         time.Time
+	duration    time.Duration
+	queueWait   time.Duration
+	taskResults []testTaskResult
+}
+
+// insertTestRuns saves the runs stats and task results like done when syncing
+// the runs from the objectstorage
+func insertTestRuns(t *testing.T, r *ReadDB, runs []testRun) {
+	err := r.rdb.Do(func(tx *db.Tx) error {
+		for _, tr := range runs {
+			groupPath := tr.group + "/"
+			enqueueTime := tr.end.Add(-tr.duration - tr.queueWait)
+			startTime := tr.end.Add(-tr.duration)
+			endTime := tr.end
+			run := &types.Run{
+				ID:          tr.id,
+				Group:       tr.group,
+				Phase:       tr.phase,
+				Result:      tr.result,
+				EnqueueTime: &enqueueTime,
+				StartTime:   &startTime,
+				EndTime:     &endTime,
+			}
+
+			q, args, err := runOSTInsert.Values(run.ID, groupPath, run.Phase, run.Result, run.Counter, run.Name, run.Pinned).ToSql()
+			if err != nil {
+				return err
+			}
+			if _, err = tx.Exec(q, args...); err != nil {
+				return err
+			}
+			if err := r.insertRunStatOST(tx, run, groupPath); err != nil {
+				return err
+			}
+			for _, ttr := range tr.taskResults {
+				q, args, err := taskresultOSTInsert.Values(run.ID, groupPath, ttr.name, ttr.status, ttr.flaky).ToSql()
+				if err != nil {
+					return err
+				}
+				if _, err = tx.Exec(q, args...); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []int64
+		out    int64
+	}{
+		{name: "empty", values: []int64{}, out: 0},
+		{name: "nil", values: nil, out: 0},
+		{name: "one value", values: []int64{5}, out: 5},
+		{name: "odd values", values: []int64{30, 10, 20}, out: 20},
+		{name: "even values", values: []int64{40, 10, 30, 20}, out: 25},
+		{name: "even values with rounding", values: []int64{4, 1, 3, 2}, out: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if out := median(tt.values); out != tt.out {
+				t.Fatalf("expected median %d, got %d", tt.out, out)
+			}
+		})
+	}
+}
+
+func TestGetRunsStatsOST(t *testing.T) {
+	r, cleanup := setupReadDB(t)
+	defer cleanup()
+
+	now := time.Now().Truncate(time.Second)
+	day := 24 * time.Hour
+
+	insertTestRuns(t, r, []testRun{
+		// outside the last week window
+		{
+			id: "run01", group: "/project/project01/branch/master",
+			phase: types.RunPhaseFinished, result: types.RunResultFailed,
+			end: now.Add(-10 * day), duration: 40 * time.Second, queueWait: 4 * time.Second,
+			taskResults: []testTaskResult{
+				{name: "taskD", status: types.RunTaskStatusFailed},
+			},
+		},
+		{
+			id: "run02", group: "/project/project01/branch/master",
+			phase: types.RunPhaseFinished, result: types.RunResultSuccess,
+			end: now.Add(-2 * day), duration: 10 * time.Second, queueWait: 1 * time.Second,
+			taskResults: []testTaskResult{
+				{name: "taskA", status: types.RunTaskStatusSuccess},
+				{name: "taskB", status: types.RunTaskStatusSuccess},
+				{name: "taskC", status: types.RunTaskStatusSuccess},
+			},
+		},
+		{
+			id: "run03", group: "/project/project01/branch/master",
+			phase: types.RunPhaseFinished, result: types.RunResultFailed,
+			end: now.Add(-1 * day), duration: 30 * time.Second, queueWait: 3 * time.Second,
+			taskResults: []testTaskResult{
+				{name: "taskA", status: types.RunTaskStatusFailed},
+				{name: "taskB", status: types.RunTaskStatusFailed},
+				{name: "taskC", status: types.RunTaskStatusSuccess},
+			},
+		},
+		{
+			id: "run04", group: "/project/project01/branch/master",
+			phase: types.RunPhaseFinished, result: types.RunResultSuccess,
+			end: now.Add(-1 * time.Hour), duration: 20 * time.Second, queueWait: 2 * time.Second,
+			taskResults: []testTaskResult{
+				// failures of tasks with ignored failures
+				{name: "taskB", status: types.RunTaskStatusFailed},
+				{name: "taskF", status: types.RunTaskStatusFailed},
+				{name: "taskC", status: types.RunTaskStatusSuccess},
+			},
+		},
+		// not finished runs aren't reported
+		{
+			id: "run05", group: "/project/project01/branch/master",
+			phase: types.RunPhaseRunning, result: types.RunResultUnknown,
+			end: now,
+		},
+		// a branch with the master branch name as prefix
+		{
+			id: "run06", group: "/project/project01/branch/master02",
+			phase: types.RunPhaseFinished, result: types.RunResultFailed,
+			end: now.Add(-1 * time.Hour), duration: 50 * time.Second, queueWait: 5 * time.Second,
+			taskResults: []testTaskResult{
+				{name: "taskE", status: types.RunTaskStatusFailed},
+			},
+		},
+		{
+			id: "run07", group: "/project/project01/branch/feature",
+			phase: types.RunPhaseFinished, result: types.RunResultSuccess,
+			end: now.Add(-1 * time.Hour), duration: 60 * time.Second, queueWait: 6 * time.Second,
+			taskResults: []testTaskResult{
+				{name: "taskA", status: types.RunTaskStatusSuccess},
+			},
+		},
+	})
+
+	tests := []struct {
+		name          string
+		group         string
+		since         time.Time
+		hotspotsLimit int
+		out           *types.RunsStats
+	}{
+		{
+			name:  "branch runs in the last week",
+			group: "/project/project01/branch/master",
+			since: now.Add(-7 * day),
+			out: &types.RunsStats{
+				Runs:            3,
+				Successes:       2,
+				Failures:        1,
+				SuccessRate:     2.0 / 3.0,
+				MedianDuration:  20 * time.Second,
+				MedianQueueWait: 2 * time.Second,
+				FailureHotspots: []*types.TaskFailureHotspot{
+					{TaskName: "taskB", Runs: 3, Failures: 2},
+					// same failures ordered by name
+					{TaskName: "taskA", Runs: 2, Failures: 1},
+					{TaskName: "taskF", Runs: 1, Failures: 1},
+				},
+			},
+		},
+		{
+			name:  "branch runs in a wider window",
+			group: "/project/project01/branch/master",
+			since: now.Add(-30 * day),
+			out: &types.RunsStats{
+				Runs:            4,
+				Successes:       2,
+				Failures:        2,
+				SuccessRate:     0.5,
+				MedianDuration:  25 * time.Second,
+				MedianQueueWait: 2500 * time.Millisecond,
+				FailureHotspots: []*types.TaskFailureHotspot{
+					{TaskName: "taskB", Runs: 3, Failures: 2},
+					{TaskName: "taskA", Runs: 2, Failures: 1},
+					{TaskName: "taskD", Runs: 1, Failures: 1},
+					{TaskName: "taskF", Runs: 1, Failures: 1},
+				},
+			},
+		},
+		{
+			name:  "branch runs in the last day",
+			group: "/project/project01/branch/master",
+			since: now.Add(-1 * day),
+			out: &types.RunsStats{
+				Runs:            2,
+				Successes:       1,
+				Failures:        1,
+				SuccessRate:     0.5,
+				MedianDuration:  25 * time.Second,
+				MedianQueueWait: 2500 * time.Millisecond,
+				FailureHotspots: []*types.TaskFailureHotspot{
+					{TaskName: "taskB", Runs: 2, Failures: 2},
+					{TaskName: "taskA", Runs: 1, Failures: 1},
+					{TaskName: "taskF", Runs: 1, Failures: 1},
+				},
+			},
+		},
+		{
+			name:  "other branch with the same prefix",
+			group: "/project/project01/branch/master02",
+			since: now.Add(-7 * day),
+			out: &types.RunsStats{
+				Runs:            1,
+				Failures:        1,
+				SuccessRate:     0,
+				MedianDuration:  50 * time.Second,
+				MedianQueueWait: 5 * time.Second,
+				FailureHotspots: []*types.TaskFailureHotspot{
+					{TaskName: "taskE", Runs: 1, Failures: 1},
+				},
+			},
+		},
+		{
+			name:  "all the project branches",
+			group: "/project/project01",
+			since: now.Add(-7 * day),
+			out: &types.RunsStats{
+				Runs:            5,
+				Successes:       3,
+				Failures:        2,
+				SuccessRate:     0.6,
+				MedianDuration:  30 * time.Second,
+				MedianQueueWait: 3 * time.Second,
+				FailureHotspots: []*types.TaskFailureHotspot{
+					{TaskName: "taskB", Runs: 3, Failures: 2},
+					{TaskName: "taskA", Runs: 3, Failures: 1},
+					{TaskName: "taskE", Runs: 1, Failures: 1},
+					{TaskName: "taskF", Runs: 1, Failures: 1},
+				},
+			},
+		},
+		{
+			name:          "hotspots limit",
+			group:         "/project/project01/branch/master",
+			since:         now.Add(-7 * day),
+			hotspotsLimit: 2,
+			out: &types.RunsStats{
+				Runs:            3,
+				Successes:       2,
+				Failures:        1,
+				SuccessRate:     2.0 / 3.0,
+				MedianDuration:  20 * time.Second,
+				MedianQueueWait: 2 * time.Second,
+				FailureHotspots: []*types.TaskFailureHotspot{
+					{TaskName: "taskB", Runs: 3, Failures: 2},
+					{TaskName: "taskA", Runs: 2, Failures: 1},
+				},
+			},
+		},
+		{
+			name:  "no runs in the window",
+			group: "/project/project01/branch/master",
+			since: now.Add(1 * time.Hour),
+			out: &types.RunsStats{
+				FailureHotspots: []*types.TaskFailureHotspot{},
+			},
+		},
+		{
+			name:  "unknown group",
+			group: "/project/project02",
+			since: now.Add(-7 * day),
+			out: &types.RunsStats{
+				FailureHotspots: []*types.TaskFailureHotspot{},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stats *types.RunsStats
+			err := r.Do(func(tx *db.Tx) error {
+				var err error
+				stats, err = r.GetRunsStatsOST(tx, tt.group, tt.since, tt.hotspotsLimit)
+				return err
+			})
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if diff := cmp.Diff(tt.out, stats); diff != "" {
+				t.Fatalf("runs stats mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTaskRetried(t *testing.T) {
+	tests := []struct {
+		name string
+		rt   *types.RunTask
+		out  bool
+	}{
+		{
+			name: "single attempt",
+			rt:   &types.RunTask{Attempts: 1, Steps: []*types.RunTaskStep{{Attempts: 1}}},
+		},
+		{
+			name: "no attempts recorded",
+			rt:   &types.RunTask{Steps: []*types.RunTaskStep{{}}},
+		},
+		{
+			name: "task retried",
+			rt:   &types.RunTask{Attempts: 2, Steps: []*types.RunTaskStep{{Attempts: 1}}},
+			out:  true,
+		},
+		{
+			name: "step retried",
+			rt:   &types.RunTask{Attempts: 1, Steps: []*types.RunTaskStep{{Attempts: 1}, {Attempts: 3}}},
+			out:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if out := taskRetried(tt.rt); out != tt.out {
+				t.Fatalf("expected retried %t, got %t", tt.out, out)
+			}
+		})
+	}
+}
+
+func TestGetTasksFlakinessOST(t *testing.T) {
+	r, cleanup := setupReadDB(t)
+	defer cleanup()
+
+	now := time.Now().Truncate(time.Second)
+
+	insertTestRuns(t, r, []testRun{
+		{
+			id: "run01", group: "/project/project01/branch/master",
+			phase: types.RunPhaseFinished, result: types.RunResultFailed, end: now,
+			taskResults: []testTaskResult{
+				{name: "taskA", status: types.RunTaskStatusSuccess},
+				{name: "taskB", status: types.RunTaskStatusFailed},
+				{name: "taskC", status: types.RunTaskStatusSuccess},
+			},
+		},
+		{
+			id: "run02", group: "/project/project01/branch/master",
+			phase: types.RunPhaseFinished, result: types.RunResultFailed, end: now,
+			taskResults: []testTaskResult{
+				{name: "taskA", status: types.RunTaskStatusFailed},
+				{name: "taskB", status: types.RunTaskStatusFailed},
+				// succeeded after being retried
+				{name: "taskC", status: types.RunTaskStatusSuccess, flaky: true},
+			},
+		},
+		{
+			id: "run03", group: "/project/project01/branch/master",
+			phase: types.RunPhaseFinished, result: types.RunResultFailed, end: now,
+			taskResults: []testTaskResult{
+				{name: "taskA", status: types.RunTaskStatusSuccess},
+				{name: "taskB", status: types.RunTaskStatusFailed},
+				{name: "taskC", status: types.RunTaskStatusSuccess},
+			},
+		},
+		{
+			id: "run04", group: "/project/project01/branch/master",
+			phase: types.RunPhaseFinished, result: types.RunResultFailed, end: now,
+			taskResults: []testTaskResult{
+				{name: "taskA", status: types.RunTaskStatusFailed},
+				{name: "taskB", status: types.RunTaskStatusFailed},
+				{name: "taskC", status: types.RunTaskStatusSuccess},
+				{name: "taskD", status: types.RunTaskStatusSuccess},
+			},
+		},
+		// not finished runs aren't considered
+		{
+			id: "run05", group: "/project/project01/branch/master",
+			phase: types.RunPhaseRunning, result: types.RunResultUnknown, end: now,
+		},
+		// a branch with the master branch name as prefix
+		{
+			id: "run06", group: "/project/project01/branch/master02",
+			phase: types.RunPhaseFinished, result: types.RunResultFailed, end: now,
+			taskResults: []testTaskResult{
+				{name: "taskA", status: types.RunTaskStatusFailed},
+				{name: "taskC", status: types.RunTaskStatusSuccess, flaky: true},
+			},
+		},
+	})
+
+	tests := []struct {
+		name  string
+		group string
+		limit int
+		out   []*types.TaskFlakiness
+		flaky []string
+	}{
+		{
+			name:  "all runs",
+			group: "/project/project01/branch/master",
+			out: []*types.TaskFlakiness{
+				{TaskName: "taskA", Runs: 4, Failures: 2, Flips: 3},
+				{TaskName: "taskB", Runs: 4, Failures: 4},
+				{TaskName: "taskC", Runs: 4, FlakyRuns: 1, LastFlakyRunID: "run02"},
+				{TaskName: "taskD", Runs: 1},
+			},
+			// taskA result keeps changing, taskC succeeded after a retry
+			// while an always failing task isn't flaky
+			flaky: []string{"taskA", "taskC"},
+		},
+		{
+			name:  "last runs",
+			group: "/project/project01/branch/master",
+			limit: 2,
+			out: []*types.TaskFlakiness{
+				{TaskName: "taskA", Runs: 2, Failures: 1, Flips: 1},
+				{TaskName: "taskB", Runs: 2, Failures: 2},
+				{TaskName: "taskC", Runs: 2},
+				{TaskName: "taskD", Runs: 1},
+			},
+			// a single result change could be a regression
+			flaky: []string{},
+		},
+		{
+			name:  "other branch with the same prefix",
+			group: "/project/project01/branch/master02",
+			out: []*types.TaskFlakiness{
+				{TaskName: "taskA", Runs: 1, Failures: 1},
+				{TaskName: "taskC", Runs: 1, FlakyRuns: 1, LastFlakyRunID: "run06"},
+			},
+			flaky: []string{"taskC"},
+		},
+		{
+			name:  "unknown group",
+			group: "/project/project02",
+			out:   []*types.TaskFlakiness{},
+			flaky: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tfs []*types.TaskFlakiness
+			err := r.Do(func(tx *db.Tx) error {
+				var err error
+				tfs, err = r.GetTasksFlakinessOST(tx, tt.group, tt.limit)
+				return err
+			})
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if diff := cmp.Diff(tt.out, tfs); diff != "" {
+				t.Fatalf("tasks flakiness mismatch (-want +got):\n%s", diff)
+			}
+
+			flaky := []string{}
+			for _, tf := range tfs {
+				if tf.Flaky() {
+					flaky = append(flaky, tf.TaskName)
+				}
+			}
+			if diff := cmp.Diff(tt.flaky, flaky); diff != "" {
+				t.Fatalf("flaky tasks mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -34,8 +34,10 @@ import (
 	"agola.io/agola/internal/util"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	etcdclientv3 "go.etcd.io/etcd/clientv3"
 	"go.uber.org/zap/zapcore"
+	errors "golang.org/x/xerrors"
 )
 
 // etcdPingerLoop periodically updates a key.
@@ -66,10 +68,25 @@ func (s *Runservice) etcdPinger(ctx context.Context) error {
 	return nil
 }
 
+// DataManagerConfig returns the runservice datamanager configuration
+func DataManagerConfig(e *etcd.Store, ost *objectstorage.ObjStorage) *datamanager.DataManagerConfig {
+	return &datamanager.DataManagerConfig{
+		BasePath: "rundata",
+		E:        e,
+		OST:      ost,
+		DataTypes: []string{
+			string(common.DataTypeRun),
+			string(common.DataTypeRunConfig),
+			string(common.DataTypeRunCounter),
+		},
+	}
+}
+
 type Runservice struct {
 	c      *config.Runservice
 	e      *etcd.Store
 	ost    *objectstorage.ObjStorage
+	osts   *common.ObjectStorages
 	dm     *datamanager.DataManager
 	readDB *readdb.ReadDB
 	ah     *action.ActionHandler
@@ -84,28 +101,34 @@ func NewRunservice(ctx context.Context, c *config.Runservice) (*Runservice, erro
 	if err != nil {
 		return nil, err
 	}
+	osts := &common.ObjectStorages{
+		Default:    ost,
+		Partitions: map[string]*common.ObjectStoragePartition{},
+	}
+	for name, p := range c.ObjectStoragePartitions {
+		pc := p
+		post, err := scommon.NewObjectStorage(&pc.ObjectStorage)
+		if err != nil {
+			return nil, errors.Errorf("failed to create object storage for storage partition %q: %w", name, err)
+		}
+		osts.Partitions[name] = &common.ObjectStoragePartition{
+			OST:  post,
+			Logs: p.Logs,
+		}
+	}
 	e, err := scommon.NewEtcd(&c.Etcd, logger, "runservice")
 	if err != nil {
 		return nil, err
 	}
 
 	s := &Runservice{
-		c:   c,
-		e:   e,
-		ost: ost,
+		c:    c,
+		e:    e,
+		ost:  ost,
+		osts: osts,
 	}
 
-	dmConf := &datamanager.DataManagerConfig{
-		BasePath: "rundata",
-		E:        e,
-		OST:      ost,
-		DataTypes: []string{
-			string(common.DataTypeRun),
-			string(common.DataTypeRunConfig),
-			string(common.DataTypeRunCounter),
-		},
-	}
-	dm, err := datamanager.NewDataManager(ctx, logger, dmConf)
+	dm, err := datamanager.NewDataManager(ctx, logger, DataManagerConfig(e, ost))
 	if err != nil {
 		return nil, err
 	}
@@ -117,7 +140,7 @@ func NewRunservice(ctx context.Context, c *config.Runservice) (*Runservice, erro
 	}
 	s.readDB = readDB
 
-	ah := action.NewActionHandler(logger, e, readDB, ost, dm)
+	ah := action.NewActionHandler(logger, e, readDB, osts, dm, c.ExecutorBootstrapToken, c.ExecutorApprovalRequired)
 	s.ah = ah
 
 	return s, nil
@@ -160,23 +183,52 @@ func (s *Runservice) Run(ctx context.Context) error {
 
 	ch := make(chan *types.ExecutorTask)
 
+	executorAuthHandler := func(h http.Handler) http.Handler { return api.NewExecutorAuthHandler(logger, s.ah, h) }
+
 	// executor dedicated api, only calls from executor should happen on these handlers
 	executorStatusHandler := api.NewExecutorStatusHandler(logger, s.e, s.ah)
-	executorTaskStatusHandler := api.NewExecutorTaskStatusHandler(s.e, ch)
-	executorTaskHandler := api.NewExecutorTaskHandler(s.e)
-	executorTasksHandler := api.NewExecutorTasksHandler(s.e)
-	archivesHandler := api.NewArchivesHandler(logger, s.ost)
-	cacheHandler := api.NewCacheHandler(logger, s.ost)
-	cacheCreateHandler := api.NewCacheCreateHandler(logger, s.ost)
+	executorTaskStatusHandler := executorAuthHandler(api.NewExecutorTaskStatusHandler(s.e, ch))
+	executorTaskHandler := executorAuthHandler(api.NewExecutorTaskHandler(s.e))
+	executorTaskLeaseAcquireHandler := executorAuthHandler(api.NewExecutorTaskLeaseAcquireHandler(s.e, s.c.TaskLeaseDuration))
+	executorTaskLeaseRenewHandler := executorAuthHandler(api.NewExecutorTaskLeaseRenewHandler(s.e, s.c.TaskLeaseDuration))
+	executorTasksHandler := executorAuthHandler(api.NewExecutorTasksHandler(s.e))
+	archivesHandler := executorAuthHandler(api.NewArchivesHandler(logger, s.osts))
+	cacheHandler := executorAuthHandler(api.NewCacheHandler(logger, s.osts))
+	cacheCreateHandler := executorAuthHandler(api.NewCacheCreateHandler(logger, s.osts))
+	testReportCreateHandler := executorAuthHandler(api.NewTestReportCreateHandler(logger, s.osts))
+	coverageReportCreateHandler := executorAuthHandler(api.NewCoverageReportCreateHandler(logger, s.osts))
 
 	// api from clients
 	executorDeleteHandler := api.NewExecutorDeleteHandler(logger, s.ah)
+	executorsHandler := api.NewExecutorsHandler(logger, s.ah)
+	executorApproveHandler := api.NewExecutorApproveHandler(logger, s.ah)
+
+	maintenanceHandler := api.NewMaintenanceHandler(logger, s.ah)
+	maintenanceEnableHandler := api.NewMaintenanceEnableHandler(logger, s.ah)
+	maintenanceDisableHandler := api.NewMaintenanceDisableHandler(logger, s.ah)
+	queuedWebhooksHandler := api.NewQueuedWebhooksHandler(logger, s.ah)
+	queueWebhookHandler := api.NewQueueWebhookHandler(logger, s.ah)
+	queuedWebhookDeleteHandler := api.NewQueuedWebhookDeleteHandler(logger, s.ah)
+
+	failedWebhookCreateHandler := api.NewFailedWebhookCreateHandler(logger, s.ah)
+	failedWebhookHandler := api.NewFailedWebhookHandler(logger, s.ah)
+	failedWebhooksHandler := api.NewFailedWebhooksHandler(logger, s.ah)
+	failedWebhookDeleteHandler := api.NewFailedWebhookDeleteHandler(logger, s.ah)
 
-	logsHandler := api.NewLogsHandler(logger, s.e, s.ost, s.dm)
+	logsHandler := api.NewLogsHandler(logger, s.e, s.osts, s.dm, s.c.ExecutorAPIToken)
 
 	runHandler := api.NewRunHandler(logger, s.e, s.dm, s.readDB)
+	runByCounterHandler := api.NewRunByCounterHandler(logger, s.dm, s.readDB)
+	runNamesHandler := api.NewRunNamesHandler(logger, s.readDB)
 	runTaskActionsHandler := api.NewRunTaskActionsHandler(logger, s.ah)
+	runTaskExecHandler := api.NewRunTaskExecHandler(logger, s.e, s.ost, s.c.ExecutorAPIToken)
 	runsHandler := api.NewRunsHandler(logger, s.readDB)
+	tasksFlakinessHandler := api.NewTasksFlakinessHandler(logger, s.readDB)
+	runsStatsHandler := api.NewRunsStatsHandler(logger, s.readDB)
+	runTaskTestReportHandler := api.NewRunTaskTestReportHandler(logger, s.ah)
+	testCaseHistoryHandler := api.NewTestCaseHistoryHandler(logger, s.ah)
+	runCoverageHandler := api.NewRunCoverageHandler(logger, s.ah)
+	coverageHistoryHandler := api.NewCoverageHistoryHandler(logger, s.ah)
 	runActionsHandler := api.NewRunActionsHandler(logger, s.ah)
 	runCreateHandler := api.NewRunCreateHandler(logger, s.ah)
 	runEventsHandler := api.NewRunEventsHandler(logger, s.e, s.ost, s.dm)
@@ -184,7 +236,11 @@ func (s *Runservice) Run(ctx context.Context) error {
 	changeGroupsUpdateTokensHandler := api.NewChangeGroupsUpdateTokensHandler(logger, s.readDB)
 
 	router := mux.NewRouter()
+	router.Handle("/metrics", promhttp.Handler())
 	apirouter := router.PathPrefix("/api/v1alpha").Subrouter()
+	apirouter.Use(func(h http.Handler) http.Handler {
+		return util.NewInternalAPIAuthHandler(s.c.InternalAPIAuth.Tokens, h)
+	})
 
 	// don't return 404 on a call to an undefined handler but 400 to distinguish between a non existent resource and a wrong method
 	apirouter.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusBadRequest) })
@@ -194,10 +250,29 @@ func (s *Runservice) Run(ctx context.Context) error {
 	apirouter.Handle("/executor/{executorid}/tasks", executorTasksHandler).Methods("GET")
 	apirouter.Handle("/executor/{executorid}/tasks/{taskid}", executorTaskHandler).Methods("GET")
 	apirouter.Handle("/executor/{executorid}/tasks/{taskid}", executorTaskStatusHandler).Methods("POST")
+	apirouter.Handle("/executor/{executorid}/tasks/{taskid}/lease", executorTaskLeaseAcquireHandler).Methods("POST")
+	apirouter.Handle("/executor/{executorid}/tasks/{taskid}/lease", executorTaskLeaseRenewHandler).Methods("PUT")
 	apirouter.Handle("/executor/archives", archivesHandler).Methods("GET")
 	apirouter.Handle("/executor/caches/{key}", cacheHandler).Methods("HEAD")
 	apirouter.Handle("/executor/caches/{key}", cacheHandler).Methods("GET")
 	apirouter.Handle("/executor/caches/{key}", cacheCreateHandler).Methods("POST")
+	apirouter.Handle("/executor/testreports/{taskid}/{step}", testReportCreateHandler).Methods("POST")
+	apirouter.Handle("/executor/coveragereports/{taskid}/{step}", coverageReportCreateHandler).Methods("POST")
+
+	apirouter.Handle("/executors", executorsHandler).Methods("GET")
+	apirouter.Handle("/executors/{executorid}/approve", executorApproveHandler).Methods("POST")
+
+	apirouter.Handle("/maintenance", maintenanceHandler).Methods("GET")
+	apirouter.Handle("/maintenance", maintenanceEnableHandler).Methods("PUT")
+	apirouter.Handle("/maintenance", maintenanceDisableHandler).Methods("DELETE")
+	apirouter.Handle("/maintenance/webhooks", queuedWebhooksHandler).Methods("GET")
+	apirouter.Handle("/maintenance/webhooks", queueWebhookHandler).Methods("POST")
+	apirouter.Handle("/maintenance/webhooks/{webhookid}", queuedWebhookDeleteHandler).Methods("DELETE")
+
+	apirouter.Handle("/failedwebhooks", failedWebhooksHandler).Methods("GET")
+	apirouter.Handle("/failedwebhooks", failedWebhookCreateHandler).Methods("POST")
+	apirouter.Handle("/failedwebhooks/{webhookid}", failedWebhookHandler).Methods("GET")
+	apirouter.Handle("/failedwebhooks/{webhookid}", failedWebhookDeleteHandler).Methods("DELETE")
 
 	apirouter.Handle("/logs", logsHandler).Methods("GET")
 
@@ -205,7 +280,16 @@ func (s *Runservice) Run(ctx context.Context) error {
 	apirouter.Handle("/runs/{runid}", runHandler).Methods("GET")
 	apirouter.Handle("/runs/{runid}/actions", runActionsHandler).Methods("PUT")
 	apirouter.Handle("/runs/{runid}/tasks/{taskid}/actions", runTaskActionsHandler).Methods("PUT")
+	apirouter.Handle("/runs/{runid}/tasks/{taskid}/exec", runTaskExecHandler).Methods("GET")
+	apirouter.Handle("/runs/{runid}/tasks/{taskid}/testreport", runTaskTestReportHandler).Methods("GET")
+	apirouter.Handle("/runs/{runid}/coverage", runCoverageHandler).Methods("GET")
 	apirouter.Handle("/runs", runsHandler).Methods("GET")
+	apirouter.Handle("/runbycounter", runByCounterHandler).Methods("GET")
+	apirouter.Handle("/runnames", runNamesHandler).Methods("GET")
+	apirouter.Handle("/tasksflakiness", tasksFlakinessHandler).Methods("GET")
+	apirouter.Handle("/runsstats", runsStatsHandler).Methods("GET")
+	apirouter.Handle("/testcasehistory", testCaseHistoryHandler).Methods("GET")
+	apirouter.Handle("/coveragehistory", coverageHistoryHandler).Methods("GET")
 	apirouter.Handle("/runs", runCreateHandler).Methods("POST")
 
 	apirouter.Handle("/changegroups", changeGroupsUpdateTokensHandler).Methods("GET")
@@ -223,6 +307,7 @@ func (s *Runservice) Run(ctx context.Context) error {
 	go s.finishedRunsArchiverLoop(ctx)
 	go s.compactChangeGroupsLoop(ctx)
 	go s.cacheCleanerLoop(ctx, s.c.RunCacheExpireInterval)
+	go s.janitorLoop(ctx)
 	go s.executorTaskUpdateHandler(ctx, ch)
 
 	go s.etcdPingerLoop(ctx)
@@ -230,7 +315,7 @@ func (s *Runservice) Run(ctx context.Context) error {
 	var tlsConfig *tls.Config
 	if s.c.Web.TLS {
 		var err error
-		tlsConfig, err = util.NewTLSConfig(s.c.Web.TLSCertFile, s.c.Web.TLSKeyFile, "", false)
+		tlsConfig, err = scommon.NewWebTLSConfig(ctx, logger, &s.c.Web)
 		if err != nil {
 			log.Errorf("err: %+v")
 			return err
@@ -245,7 +330,11 @@ func (s *Runservice) Run(ctx context.Context) error {
 
 	lerrCh := make(chan error)
 	go func() {
-		lerrCh <- httpServer.ListenAndServe()
+		if tlsConfig != nil {
+			lerrCh <- httpServer.ListenAndServeTLS("", "")
+		} else {
+			lerrCh <- httpServer.ListenAndServe()
+		}
 	}()
 
 	select {
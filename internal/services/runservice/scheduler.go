@@ -19,7 +19,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
 	"sort"
 	"strconv"
 	"time"
@@ -27,11 +33,14 @@ import (
 	"agola.io/agola/internal/datamanager"
 	"agola.io/agola/internal/etcd"
 	slog "agola.io/agola/internal/log"
+	"agola.io/agola/internal/objectstorage"
 	ostypes "agola.io/agola/internal/objectstorage/types"
 	"agola.io/agola/internal/runconfig"
+	"agola.io/agola/internal/services/runservice/archive"
 	"agola.io/agola/internal/services/runservice/common"
 	"agola.io/agola/internal/services/runservice/store"
 	"agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/toolbox"
 	"agola.io/agola/internal/util"
 
 	etcdclientv3 "go.etcd.io/etcd/clientv3"
@@ -116,6 +125,23 @@ func advanceRunTasks(ctx context.Context, curRun *types.Run, rc *types.RunConfig
 		}
 	}
 
+	// cancel the tasks cancelled by a user if not yet scheduled
+	for _, rt := range newRun.Tasks {
+		if !rt.Stop || rt.Status != types.RunTaskStatusNotStarted {
+			continue
+		}
+		isScheduled := false
+		for _, et := range activeExecutorTasks {
+			if rt.ID == et.ID {
+				isScheduled = true
+			}
+		}
+		if isScheduled {
+			continue
+		}
+		cancelNotStartedRunTask(rt)
+	}
+
 	// handle all tasks
 	for _, rt := range newRun.Tasks {
 		if rt.Skip {
@@ -190,7 +216,7 @@ func getTasksToRun(ctx context.Context, r *types.Run, rc *types.RunConfig) ([]*t
 	tasksToRun := []*types.RunTask{}
 	// get tasks that can be executed
 	for _, rt := range r.Tasks {
-		if rt.Skip {
+		if rt.Skip || rt.Stop {
 			continue
 		}
 		if rt.Status != types.RunTaskStatusNotStarted {
@@ -269,6 +295,15 @@ func (s *Runservice) chooseExecutor(ctx context.Context, rct *types.RunConfigTas
 	return chooseExecutor(executors, rct), nil
 }
 
+// executorToolboxProtocolVersion returns the toolbox protocol version of the
+// executor. Executors not reporting it use the first protocol version.
+func executorToolboxProtocolVersion(e *types.Executor) int {
+	if e.ToolboxProtocolVersion == 0 {
+		return 1
+	}
+	return e.ToolboxProtocolVersion
+}
+
 func chooseExecutor(executors []*types.Executor, rct *types.RunConfigTask) *types.Executor {
 	requiresPrivilegedContainers := false
 	for _, c := range rct.Runtime.Containers {
@@ -283,6 +318,17 @@ func chooseExecutor(executors []*types.Executor, rct *types.RunConfigTask) *type
 			continue
 		}
 
+		// skip executors not yet approved
+		if e.WaitingApproval {
+			continue
+		}
+
+		// skip executors with an older toolbox since they could not
+		// understand the task steps
+		if executorToolboxProtocolVersion(e) < toolbox.ProtocolVersion {
+			continue
+		}
+
 		// skip executor provileged containers are required but not allowed
 		if requiresPrivilegedContainers && !e.AllowPrivilegedContainers {
 			continue
@@ -332,6 +378,29 @@ func (s *Runservice) genExecutorTask(ctx context.Context, r *types.Run, rt *type
 		environment = rct.Environment
 	}
 	mergeEnv(environment, rc.StaticEnvironment)
+
+	rctAllParents := runconfig.GetAllParents(rc.Tasks, rct)
+
+	// sort parents by level and name just for reproducibility
+	sort.Sort(parentsByLevelName(rctAllParents))
+
+	// add the variables exported by the parent tasks, the ones exported by the
+	// nearest parents take precedence
+	for _, rctParent := range rctAllParents {
+		mergeEnv(environment, r.Tasks[rctParent.ID].ExportedEnvironment)
+	}
+
+	runconfig.ResolveTaskOutputs(environment, func(taskName, key string) string {
+		for _, rctParent := range rctAllParents {
+			if rctParent.Name == taskName {
+				return r.Tasks[rctParent.ID].Outputs[key]
+			}
+		}
+		return ""
+	})
+
+	environment[runconfig.EnvRunID] = r.ID
+	environment[runconfig.VariableRunNumber] = strconv.FormatUint(r.Counter, 10)
 	// run config Environment variables ovverride every other environment variable
 	mergeEnv(environment, rc.Environment)
 
@@ -344,17 +413,29 @@ func (s *Runservice) genExecutorTask(ctx context.Context, r *types.Run, rt *type
 		// The executorTask ID must be the same as the runTask ID so we can detect if
 		// there's already an executorTask scheduled for that run task and we can get
 		// at most once task execution
-		ID:          rt.ID,
-		RunID:       r.ID,
-		TaskName:    rct.Name,
-		Arch:        rct.Runtime.Arch,
-		Containers:  rct.Runtime.Containers,
-		Environment: environment,
-		WorkingDir:  rct.WorkingDir,
-		Shell:       rct.Shell,
-		User:        rct.User,
-		Steps:       rct.Steps,
-		CachePrefix: cachePrefix,
+		ID:            rt.ID,
+		RunID:         r.ID,
+		TaskName:      rct.Name,
+		Arch:          rct.Runtime.Arch,
+		Containers:    rct.Runtime.Containers,
+		ExtraHosts:    rct.Runtime.ExtraHosts,
+		DNS:           rct.Runtime.DNS,
+		HostNetwork:   rct.Runtime.HostNetwork,
+		Environment:   environment,
+		WorkingDir:    rct.WorkingDir,
+		Shell:         rct.Shell,
+		User:          rct.User,
+		Steps:         rct.Steps,
+		Retries:       rct.Retries,
+		CachePrefix:   cachePrefix,
+		Outputs:       rct.Outputs,
+		ExprVariables: rct.ExprVariables,
+		SecretFiles:   rct.SecretFiles,
+		Timeout:       rct.Timeout,
+		SubmitTime:    util.TimePtr(time.Now()),
+
+		StoragePartition: r.StoragePartition,
+
 		Status: types.ExecutorTaskStatus{
 			Phase:      types.ExecutorTaskPhaseNotStarted,
 			Steps:      make([]*types.ExecutorTaskStepStatus, len(rct.Steps)),
@@ -373,11 +454,6 @@ func (s *Runservice) genExecutorTask(ctx context.Context, r *types.Run, rt *type
 	// TODO(sgotti) right now we don't support duplicated files. So it's not currently possibile to overwrite a file in a upper layer.
 	// this simplifies the workspaces extractions since they could be extracted in any order. We make them ordered just for reproducibility
 	wsops := []types.WorkspaceOperation{}
-	rctAllParents := runconfig.GetAllParents(rc.Tasks, rct)
-
-	// sort parents by level and name just for reproducibility
-	sort.Sort(parentsByLevelName(rctAllParents))
-
 	for _, rctParent := range rctAllParents {
 		log.Debugf("rctParent: %s", util.Dump(rctParent))
 		for _, archiveStep := range r.Tasks[rctParent.ID].WorkspaceArchives {
@@ -408,10 +484,16 @@ func (s *Runservice) sendExecutorTask(ctx context.Context, et *types.ExecutorTas
 		return err
 	}
 
-	r, err := http.Post(executor.ListenURL+"/api/v1alpha/executor", "", bytes.NewReader(etj))
+	req, err := http.NewRequest("POST", executor.ListenURL+"/api/v1alpha/executor", bytes.NewReader(etj))
+	if err != nil {
+		return err
+	}
+	req.Header = common.ExecutorAPIHeader(s.c.ExecutorAPIToken)
+	r, err := http.DefaultClient.Do(req.WithContext(ctx))
 	if err != nil {
 		return err
 	}
+	defer r.Body.Close()
 	if r.StatusCode != http.StatusOK {
 		return errors.Errorf("received http status: %d", r.StatusCode)
 	}
@@ -540,18 +622,54 @@ func (s *Runservice) scheduleRun(ctx context.Context, r *types.Run, rc *types.Ru
 		}
 	}
 
+	// stop the executor tasks of the run tasks cancelled by a user
+	for _, et := range activeExecutorTasks {
+		rt, ok := r.Tasks[et.ID]
+		if !ok || !rt.Stop || et.Stop {
+			continue
+		}
+		et.Stop = true
+		if _, err := store.AtomicPutExecutorTask(ctx, s.e, et); err != nil {
+			return err
+		}
+		if err := s.sendExecutorTask(ctx, et); err != nil {
+			return err
+		}
+	}
+
 	// advance tasks
 	if r.Phase == types.RunPhaseRunning {
 		r, err := advanceRunTasks(ctx, r, rc, activeExecutorTasks)
 		if err != nil {
 			return err
 		}
-		r, err = store.AtomicPutRun(ctx, s.e, r, nil, nil)
-		if err != nil {
-			return err
+
+		now := time.Now()
+		notify := handleApprovalTimeouts(r, rc, now)
+
+		// a paused run doesn't schedule new tasks, the running ones continue
+		var tasksToRun []*types.RunTask
+		if !r.Paused || r.Stop {
+			tasksToRun, err = getTasksToRun(ctx, r, rc)
+			if err != nil {
+				return err
+			}
+			if handleQueueWaits(r, tasksToRun, s.c.QueueWaitAlertThreshold, now) {
+				notify = true
+			}
 		}
 
-		tasksToRun, err := getTasksToRun(ctx, r, rc)
+		// generate a run event to let the notification service notify the
+		// approvers and the tasks waiting too much in the queue
+		var runEvent *types.RunEvent
+		if notify {
+			runEvent, err = common.NewRunEvent(ctx, s.e, r.ID, r.Phase, r.Result)
+			if err != nil {
+				return err
+			}
+		}
+
+		r, err = store.AtomicPutRun(ctx, s.e, r, runEvent, nil)
 		if err != nil {
 			return err
 		}
@@ -562,6 +680,99 @@ func (s *Runservice) scheduleRun(ctx context.Context, r *types.Run, rc *types.Ru
 	return nil
 }
 
+// handleApprovalTimeouts records when the tasks started waiting approval and
+// executes the approval timeout action of the expired ones. It reports if the
+// approvers must be notified that a task approval is nearing expiry.
+func handleApprovalTimeouts(r *types.Run, rc *types.RunConfig, now time.Time) bool {
+	notify := false
+	for _, rt := range r.Tasks {
+		if !rt.WaitingApproval {
+			continue
+		}
+		if rt.WaitingApprovalTime == nil {
+			rt.WaitingApprovalTime = util.TimePtr(now)
+		}
+
+		at := rc.Tasks[rt.ID].ApprovalTimeout
+		if at == nil {
+			continue
+		}
+
+		expiry := rt.WaitingApprovalTime.Add(at.Timeout)
+		if !now.Before(expiry) {
+			rt.WaitingApproval = false
+			rt.ApprovalTimedOut = true
+
+			switch at.Action {
+			case types.ApprovalTimeoutActionApprove:
+				rt.Approved = true
+			default:
+				failNotStartedRunTask(rt, types.TaskFailureTypeApprovalTimeout, fmt.Sprintf("task not approved in %s", at.Timeout))
+			}
+			continue
+		}
+
+		if at.NotifyBefore > 0 && !rt.ApprovalExpiryNotified && !now.Before(expiry.Add(-at.NotifyBefore)) {
+			rt.ApprovalExpiryNotified = true
+			notify = true
+		}
+	}
+
+	return notify
+}
+
+// failNotStartedRunTask marks a run task that was never executed as failed
+// with the provided failure reason
+func failNotStartedRunTask(rt *types.RunTask, failureType types.TaskFailureType, message string) {
+	rt.Status = types.RunTaskStatusFailed
+	rt.FailureReason = &types.TaskFailureReason{
+		Type:    failureType,
+		Message: message,
+	}
+	finishNotStartedRunTaskFetches(rt)
+}
+
+// cancelNotStartedRunTask marks a run task that was never executed as
+// cancelled
+func cancelNotStartedRunTask(rt *types.RunTask) {
+	rt.Status = types.RunTaskStatusCancelled
+	rt.WaitingApproval = false
+	finishNotStartedRunTaskFetches(rt)
+}
+
+// finishNotStartedRunTaskFetches marks the logs and archives fetches of a run
+// task that was never executed as finished since there's nothing to fetch
+func finishNotStartedRunTaskFetches(rt *types.RunTask) {
+	rt.SetupStep.LogPhase = types.RunTaskFetchPhaseFinished
+	for _, s := range rt.Steps {
+		s.LogPhase = types.RunTaskFetchPhaseFinished
+	}
+	for i := range rt.WorkspaceArchivesPhase {
+		rt.WorkspaceArchivesPhase[i] = types.RunTaskFetchPhaseFinished
+	}
+}
+
+// handleQueueWaits records when the tasks to run became schedulable. It reports
+// if some tasks have been waiting to be started for more than the alert
+// threshold (when greater than 0) and must be notified.
+func handleQueueWaits(r *types.Run, tasksToRun []*types.RunTask, alertThreshold time.Duration, now time.Time) bool {
+	notify := false
+	for _, rt := range tasksToRun {
+		if rt.SchedulableTime == nil {
+			rt.SchedulableTime = util.TimePtr(now)
+		}
+
+		if alertThreshold > 0 && !rt.QueueWaitAlerted && now.Sub(*rt.SchedulableTime) >= alertThreshold {
+			log.Warnf("run %q task %q is waiting to be started since %s", r.ID, rt.ID, rt.SchedulableTime)
+			taskQueueWaitAlertsCounter.Inc()
+			rt.QueueWaitAlerted = true
+			notify = true
+		}
+	}
+
+	return notify
+}
+
 // advanceRun updates the run result and phase. It must be the unique function that
 // should update them.
 func advanceRun(ctx context.Context, r *types.Run, rc *types.RunConfig, activeExecutorTasks []*types.ExecutorTask) error {
@@ -596,6 +807,13 @@ func advanceRun(ctx context.Context, r *types.Run, rc *types.RunConfig, activeEx
 		}
 		if finished {
 			r.Result = types.RunResultSuccess
+			// a run with tasks cancelled by a user didn't complete
+			for _, rt := range r.Tasks {
+				if rt.Stop {
+					r.Result = types.RunResultStopped
+					break
+				}
+			}
 			return nil
 		}
 	}
@@ -654,10 +872,31 @@ func (s *Runservice) handleExecutorTaskUpdate(ctx context.Context, et *types.Exe
 		return errors.Errorf("cannot get run config %q: %w", r.ID, err)
 	}
 
+	var prevPreviewURL *types.PreviewURL
+	var prevStatus types.RunTaskStatus
+	if rt, ok := r.Tasks[et.ID]; ok {
+		prevPreviewURL = rt.PreviewURL
+		prevStatus = rt.Status
+	}
+
 	if err := s.updateRunTaskStatus(ctx, et, r); err != nil {
 		return err
 	}
-	r, err = store.AtomicPutRun(ctx, s.e, r, nil, nil)
+
+	var runEvent *types.RunEvent
+	// emit a run event when the task status or preview url changes so it'll
+	// be notified (i.e. the per task commit statuses)
+	if rt, ok := r.Tasks[et.ID]; ok && (prevStatus != rt.Status || !reflect.DeepEqual(prevPreviewURL, rt.PreviewURL)) {
+		runEvent, err = common.NewRunEvent(ctx, s.e, r.ID, r.Phase, r.Result)
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(prevPreviewURL, rt.PreviewURL) {
+			runEvent.PreviewURLTasks = []string{et.ID}
+		}
+	}
+
+	r, err = store.AtomicPutRun(ctx, s.e, r, runEvent, nil)
 	if err != nil {
 		return err
 	}
@@ -673,6 +912,12 @@ func (s *Runservice) updateRunTaskStatus(ctx context.Context, et *types.Executor
 		return errors.Errorf("no such run task with id %s for run %s", et.ID, r.ID)
 	}
 
+	// record the queue wait when the task is started
+	if rt.StartTime == nil && et.Status.StartTime != nil && rt.SchedulableTime != nil {
+		rt.QueueWait = et.Status.StartTime.Sub(*rt.SchedulableTime)
+		taskQueueWaitHistogram.Observe(rt.QueueWait.Seconds())
+	}
+
 	rt.StartTime = et.Status.StartTime
 	rt.EndTime = et.Status.EndTime
 
@@ -735,9 +980,18 @@ func (s *Runservice) updateRunTaskStatus(ctx context.Context, et *types.Executor
 
 	for i, s := range et.Status.Steps {
 		rt.Steps[i].Phase = s.Phase
+		rt.Steps[i].Attempts = s.Attempts
 		rt.Steps[i].StartTime = s.StartTime
 		rt.Steps[i].EndTime = s.EndTime
 	}
+	rt.Attempts = et.Status.Attempts
+
+	if et.Status.PreviewURL != nil {
+		rt.PreviewURL = et.Status.PreviewURL
+	}
+	rt.ExportedEnvironment = et.Status.ExportedEnvironment
+	rt.Outputs = et.Status.Outputs
+	rt.FailureReason = et.Status.FailureReason
 
 	return nil
 }
@@ -809,6 +1063,10 @@ func (s *Runservice) executorTaskCleaner(ctx context.Context, et *types.Executor
 					log.Errorf("err: %+v", err)
 					return err
 				}
+				if err := store.DeleteExecutorTaskLease(ctx, s.e, et.ID); err != nil {
+					log.Errorf("err: %+v", err)
+					return err
+				}
 				return nil
 			}
 			log.Errorf("err: %+v", err)
@@ -897,15 +1155,17 @@ func (s *Runservice) runTasksUpdater(ctx context.Context) error {
 	return nil
 }
 
-func (s *Runservice) OSTFileExists(path string) (bool, error) {
-	_, err := s.ost.Stat(path)
+func ostFileExists(ost *objectstorage.ObjStorage, path string) (bool, error) {
+	_, err := ost.Stat(path)
 	if err != nil && err != ostypes.ErrNotExist {
 		return false, err
 	}
 	return err == nil, nil
 }
 
-func (s *Runservice) fetchLog(ctx context.Context, rt *types.RunTask, setup bool, stepnum int) error {
+// fetchLog fetches the setup or step log from the executor. attempt is the
+// previous attempt to fetch, -1 fetches the last attempt log
+func (s *Runservice) fetchLog(ctx context.Context, ost *objectstorage.ObjStorage, rt *types.RunTask, setup bool, stepnum, attempt int) error {
 	et, err := store.GetExecutorTask(ctx, s.e, rt.ID)
 	if err != nil && err != etcd.ErrKeyNotFound {
 		return err
@@ -926,12 +1186,17 @@ func (s *Runservice) fetchLog(ctx context.Context, rt *types.RunTask, setup bool
 	}
 
 	var logPath string
-	if setup {
+	switch {
+	case setup && attempt >= 0:
+		logPath = store.OSTRunTaskSetupAttemptLogPath(rt.ID, attempt)
+	case setup:
 		logPath = store.OSTRunTaskSetupLogPath(rt.ID)
-	} else {
+	case attempt >= 0:
+		logPath = store.OSTRunTaskStepAttemptLogPath(rt.ID, stepnum, attempt)
+	default:
 		logPath = store.OSTRunTaskStepLogPath(rt.ID, stepnum)
 	}
-	ok, err := s.OSTFileExists(logPath)
+	ok, err := ostFileExists(ost, logPath)
 	if err != nil {
 		return err
 	}
@@ -945,30 +1210,35 @@ func (s *Runservice) fetchLog(ctx context.Context, rt *types.RunTask, setup bool
 	} else {
 		u = fmt.Sprintf(executor.ListenURL+"/api/v1alpha/executor/logs?taskid=%s&step=%d", rt.ID, stepnum)
 	}
-	r, err := http.Get(u)
+	if attempt >= 0 {
+		u += fmt.Sprintf("&attempt=%d", attempt)
+	}
+	if executor.ResumableFetch {
+		u += "&compression=" + common.CompressionZstd
+	}
+	f, err := fetchResumable(ctx, u, common.ExecutorAPIHeader(s.c.ExecutorAPIToken), executor.ResumableFetch, s.fetchDir(), fetchRetryInterval)
 	if err != nil {
+		// ignore if not found
+		if errors.Is(err, errFetchNotFound) {
+			return nil
+		}
 		return err
 	}
-	defer r.Body.Close()
+	defer os.Remove(f.Name())
+	defer f.Close()
 
-	// ignore if not found
-	if r.StatusCode == http.StatusNotFound {
-		return nil
-	}
-	if r.StatusCode != http.StatusOK {
-		return errors.Errorf("received http status: %d", r.StatusCode)
+	fi, err := f.Stat()
+	if err != nil {
+		return err
 	}
 
-	size := int64(-1)
-	sizeStr := r.Header.Get("Content-Length")
-	if sizeStr != "" {
-		size, err = strconv.ParseInt(sizeStr, 10, 64)
-		if err != nil {
-			return errors.Errorf("failed to parse content length %q", sizeStr)
-		}
-	}
+	return ost.WriteObject(logPath, f, fi.Size(), false)
+}
 
-	return s.ost.WriteObject(logPath, r.Body, size, false)
+// fetchDir is the directory where the fetched logs and archives are
+// temporarily saved
+func (s *Runservice) fetchDir() string {
+	return filepath.Join(s.c.DataDir, "fetch")
 }
 
 func (s *Runservice) finishSetupLogPhase(ctx context.Context, runID, runTaskID string) error {
@@ -1038,12 +1308,18 @@ func (s *Runservice) finishArchivePhase(ctx context.Context, runID, runTaskID st
 	return nil
 }
 
-func (s *Runservice) fetchTaskLogs(ctx context.Context, runID string, rt *types.RunTask) {
+func (s *Runservice) fetchTaskLogs(ctx context.Context, ost *objectstorage.ObjStorage, runID string, rt *types.RunTask) {
 	log.Debugf("fetchTaskLogs")
 
 	// fetch setup log
 	if rt.SetupStep.LogPhase == types.RunTaskFetchPhaseNotStarted {
-		if err := s.fetchLog(ctx, rt, true, 0); err != nil {
+		// fetch the previous attempts logs and then the last one
+		for attempt := 0; attempt < rt.Attempts-1; attempt++ {
+			if err := s.fetchLog(ctx, ost, rt, true, 0, attempt); err != nil {
+				log.Errorf("err: %+v", err)
+			}
+		}
+		if err := s.fetchLog(ctx, ost, rt, true, 0, -1); err != nil {
 			log.Errorf("err: %+v", err)
 		}
 		if err := s.finishSetupLogPhase(ctx, runID, rt.ID); err != nil {
@@ -1055,7 +1331,12 @@ func (s *Runservice) fetchTaskLogs(ctx context.Context, runID string, rt *types.
 	for i, rts := range rt.Steps {
 		lp := rts.LogPhase
 		if lp == types.RunTaskFetchPhaseNotStarted {
-			if err := s.fetchLog(ctx, rt, false, i); err != nil {
+			for attempt := 0; attempt < rts.Attempts-1; attempt++ {
+				if err := s.fetchLog(ctx, ost, rt, false, i, attempt); err != nil {
+					log.Errorf("err: %+v", err)
+				}
+			}
+			if err := s.fetchLog(ctx, ost, rt, false, i, -1); err != nil {
 				log.Errorf("err: %+v", err)
 				continue
 			}
@@ -1067,7 +1348,10 @@ func (s *Runservice) fetchTaskLogs(ctx context.Context, runID string, rt *types.
 	}
 }
 
-func (s *Runservice) fetchArchive(ctx context.Context, rt *types.RunTask, stepnum int) error {
+// fetchArchive fetches a workspace archive from the executor and saves it in
+// the chunked archive format deduplicating its chunks in the provided
+// namespace
+func (s *Runservice) fetchArchive(ctx context.Context, ost *objectstorage.ObjStorage, namespace string, rt *types.RunTask, stepnum int) error {
 	et, err := store.GetExecutorTask(ctx, s.e, rt.ID)
 	if err != nil && err != etcd.ErrKeyNotFound {
 		return err
@@ -1085,50 +1369,50 @@ func (s *Runservice) fetchArchive(ctx context.Context, rt *types.RunTask, stepnu
 		return nil
 	}
 
-	path := store.OSTRunTaskArchivePath(rt.ID, stepnum)
-	ok, err := s.OSTFileExists(path)
-	if err != nil {
-		return err
-	}
-	if ok {
-		return nil
+	manifestPath := store.OSTRunTaskArchiveManifestPath(rt.ID, stepnum)
+	for _, p := range []string{manifestPath, store.OSTRunTaskArchivePath(rt.ID, stepnum)} {
+		ok, err := ostFileExists(ost, p)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
 	}
 
 	u := fmt.Sprintf(executor.ListenURL+"/api/v1alpha/executor/archives?taskid=%s&step=%d", rt.ID, stepnum)
+	// reduce the transfer size if the executor supports compressed archives
+	if executor.SupportsArchiveFormat(types.ArchiveFormatTarZstd) {
+		u += "&format=" + url.QueryEscape(string(types.ArchiveFormatTarZstd))
+	}
 	log.Debugf("fetchArchive: %s", u)
-	r, err := http.Get(u)
+	f, err := fetchResumable(ctx, u, common.ExecutorAPIHeader(s.c.ExecutorAPIToken), executor.ResumableFetch, s.fetchDir(), fetchRetryInterval)
 	if err != nil {
+		// ignore if not found
+		if errors.Is(err, errFetchNotFound) {
+			return nil
+		}
 		return err
 	}
-	defer r.Body.Close()
-
-	// ignore if not found
-	if r.StatusCode == http.StatusNotFound {
-		return nil
-	}
-	if r.StatusCode != http.StatusOK {
-		return errors.Errorf("received http status: %d", r.StatusCode)
-	}
+	defer os.Remove(f.Name())
+	defer f.Close()
 
-	size := int64(-1)
-	sizeStr := r.Header.Get("Content-Length")
-	if sizeStr != "" {
-		size, err = strconv.ParseInt(sizeStr, 10, 64)
-		if err != nil {
-			return errors.Errorf("failed to parse content length %q", sizeStr)
-		}
+	stats, err := archive.Save(ost, manifestPath, namespace, f)
+	if err != nil {
+		return err
 	}
+	log.Debugf("fetchArchive: saved archive of size %d, chunks: %d, new chunks: %d, new chunks size: %d", stats.Size, stats.Chunks, stats.NewChunks, stats.NewChunksSize)
 
-	return s.ost.WriteObject(path, r.Body, size, false)
+	return nil
 }
 
-func (s *Runservice) fetchTaskArchives(ctx context.Context, runID string, rt *types.RunTask) {
+func (s *Runservice) fetchTaskArchives(ctx context.Context, ost *objectstorage.ObjStorage, namespace, runID string, rt *types.RunTask) {
 	log.Debugf("fetchTaskArchives")
 
 	for i, stepnum := range rt.WorkspaceArchives {
 		phase := rt.WorkspaceArchivesPhase[i]
 		if phase == types.RunTaskFetchPhaseNotStarted {
-			if err := s.fetchArchive(ctx, rt, stepnum); err != nil {
+			if err := s.fetchArchive(ctx, ost, namespace, rt, stepnum); err != nil {
 				log.Errorf("err: %+v", err)
 				continue
 			}
@@ -1141,6 +1425,12 @@ func (s *Runservice) fetchTaskArchives(ctx context.Context, runID string, rt *ty
 }
 
 func (s *Runservice) fetcherLoop(ctx context.Context) {
+	// remove the temporary files of the transfers interrupted by a previous
+	// instance
+	if err := os.RemoveAll(s.fetchDir()); err != nil {
+		log.Errorf("failed to cleanup fetch dir: %+v", err)
+	}
+
 	for {
 		log.Debugf("fetcher")
 
@@ -1166,41 +1456,60 @@ func (s *Runservice) fetcher(ctx context.Context) error {
 	}
 	for _, r := range runs {
 		log.Debugf("r: %s", util.Dump(r))
+		logsOST, err := s.osts.LogsOST(r.StoragePartition)
+		if err != nil {
+			log.Errorf("err: %+v", err)
+			continue
+		}
+		dataOST, err := s.osts.DataOST(r.StoragePartition)
+		if err != nil {
+			log.Errorf("err: %+v", err)
+			continue
+		}
 		for _, rt := range r.Tasks {
 			log.Debugf("rt: %s", util.Dump(rt))
 			if rt.Status.IsFinished() {
 				// write related logs runID
 				runIDPath := store.OSTRunTaskLogsRunPath(rt.ID, r.ID)
-				exists, err := s.OSTFileExists(runIDPath)
+				exists, err := ostFileExists(logsOST, runIDPath)
 				if err != nil {
 					log.Errorf("err: %+v", err)
 				} else if !exists {
-					if err := s.ost.WriteObject(runIDPath, bytes.NewReader([]byte{}), 0, false); err != nil {
+					if err := logsOST.WriteObject(runIDPath, bytes.NewReader([]byte{}), 0, false); err != nil {
 						log.Errorf("err: %+v", err)
 					}
 				}
 
 				// write related archives runID
 				runIDPath = store.OSTRunTaskArchivesRunPath(rt.ID, r.ID)
-				exists, err = s.OSTFileExists(runIDPath)
+				exists, err = ostFileExists(dataOST, runIDPath)
 				if err != nil {
 					log.Errorf("err: %+v", err)
 				} else if !exists {
-					if err := s.ost.WriteObject(runIDPath, bytes.NewReader([]byte{}), 0, false); err != nil {
+					if err := dataOST.WriteObject(runIDPath, bytes.NewReader([]byte{}), 0, false); err != nil {
 						log.Errorf("err: %+v", err)
 					}
 				}
 
-				s.fetchTaskLogs(ctx, r.ID, rt)
-				s.fetchTaskArchives(ctx, r.ID, rt)
+				s.fetchTaskLogs(ctx, logsOST, r.ID, rt)
+				s.fetchTaskArchives(ctx, dataOST, archive.Namespace(r.Group), r.ID, rt)
 
 				// if the fetching is finished we can remove the executor tasks. We cannot
 				// remove it before since it contains the reference to the executor where we
 				// should fetch the data
 				if rt.LogsFetchFinished() && rt.ArchivesFetchFinished() {
+					if r.ArtifactsRetention > 0 && !r.Pinned && len(rt.WorkspaceArchives) > 0 {
+						if err := writeArchivesExpireTime(dataOST, rt.ID, time.Now().Add(r.ArtifactsRetention)); err != nil {
+							log.Errorf("err: %+v", err)
+							continue
+						}
+					}
 					if err := store.DeleteExecutorTask(ctx, s.e, rt.ID); err != nil {
 						return err
 					}
+					if err := store.DeleteExecutorTaskLease(ctx, s.e, rt.ID); err != nil {
+						return err
+					}
 				}
 			}
 		}
@@ -1229,6 +1538,15 @@ func (s *Runservice) runsSchedulerLoop(ctx context.Context) {
 
 func (s *Runservice) runsScheduler(ctx context.Context) error {
 	log.Debugf("runsScheduler")
+	maintenance, err := store.GetMaintenance(ctx, s.e)
+	if err != nil {
+		return err
+	}
+	if maintenance.Enabled {
+		log.Debugf("maintenance mode enabled, skipping runs scheduling")
+		return nil
+	}
+
 	runs, err := store.GetRuns(ctx, s.e)
 	if err != nil {
 		return err
@@ -1272,6 +1590,15 @@ func (s *Runservice) finishedRunsArchiverLoop(ctx context.Context) {
 
 func (s *Runservice) finishedRunsArchiver(ctx context.Context) error {
 	log.Debugf("finished run archiver")
+	// don't move runs from etcd to the objectstorage during the maintenance
+	maintenance, err := store.GetMaintenance(ctx, s.e)
+	if err != nil {
+		return err
+	}
+	if maintenance.Enabled {
+		return nil
+	}
+
 	runs, err := store.GetRuns(ctx, s.e)
 	if err != nil {
 		return err
@@ -1390,14 +1717,102 @@ func (s *Runservice) cacheCleaner(ctx context.Context, cacheExpireInterval time.
 	}
 	defer func() { _ = m.Unlock(ctx) }()
 
+	for _, ost := range s.osts.All() {
+		if err := cleanOSTCaches(ost, cacheExpireInterval); err != nil {
+			return err
+		}
+		if err := cleanOSTExpiredArchives(ost); err != nil {
+			return err
+		}
+		if err := archive.CleanChunks(ost, store.OSTArchivesDir(), archive.ChunksGracePeriod); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeArchivesExpireTime saves the expiration time of the run task archives
+// removed by the cache cleaner
+func writeArchivesExpireTime(ost *objectstorage.ObjStorage, rtID string, expireTime time.Time) error {
+	expirePath := store.OSTRunTaskArchivesExpirePath(rtID)
+	exists, err := ostFileExists(ost, expirePath)
+	if err != nil || exists {
+		return err
+	}
+	data := []byte(expireTime.Format(time.RFC3339))
+	return ost.WriteObject(expirePath, bytes.NewReader(data), int64(len(data)), false)
+}
+
+// cleanOSTExpiredArchives removes the run tasks archives whose expiration time
+// is passed
+func cleanOSTExpiredArchives(ost *objectstorage.ObjStorage) error {
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+	for object := range ost.List(store.OSTArchivesDir()+"/", "", true, doneCh) {
+		if object.Err != nil {
+			return object.Err
+		}
+		if path.Base(object.Path) != "expire" {
+			continue
+		}
+		rtID := path.Base(path.Dir(object.Path))
+		f, err := ost.ReadObject(object.Path)
+		if err != nil {
+			log.Warnf("failed to read archives expire time %q: %v", object.Path, err)
+			continue
+		}
+		data, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			log.Warnf("failed to read archives expire time %q: %v", object.Path, err)
+			continue
+		}
+		expireTime, err := time.Parse(time.RFC3339, string(data))
+		if err != nil {
+			log.Warnf("wrong archives expire time %q: %v", object.Path, err)
+			continue
+		}
+		if time.Now().Before(expireTime) {
+			continue
+		}
+
+		log.Infof("removing expired archives of run task %q", rtID)
+		if err := deleteOSTDir(ost, store.OSTRunTaskArchivesDataDir(rtID)); err != nil {
+			log.Warnf("failed to delete run task %q archives: %v", rtID, err)
+			continue
+		}
+		if err := ost.DeleteObject(object.Path); err != nil && err != ostypes.ErrNotExist {
+			log.Warnf("failed to delete archives expire time %q: %v", object.Path, err)
+		}
+	}
+
+	return nil
+}
+
+func deleteOSTDir(ost *objectstorage.ObjStorage, dir string) error {
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+	for object := range ost.List(dir+"/", "", true, doneCh) {
+		if object.Err != nil {
+			return object.Err
+		}
+		if err := ost.DeleteObject(object.Path); err != nil && err != ostypes.ErrNotExist {
+			return err
+		}
+	}
+	return nil
+}
+
+func cleanOSTCaches(ost *objectstorage.ObjStorage, cacheExpireInterval time.Duration) error {
 	doneCh := make(chan struct{})
 	defer close(doneCh)
-	for object := range s.ost.List(store.OSTCacheDir()+"/", "", true, doneCh) {
+	for object := range ost.List(store.OSTCacheDir()+"/", "", true, doneCh) {
 		if object.Err != nil {
 			return object.Err
 		}
 		if object.LastModified.Add(cacheExpireInterval).Before(time.Now()) {
-			if err := s.ost.DeleteObject(object.Path); err != nil {
+			if err := ost.DeleteObject(object.Path); err != nil {
 				if err != ostypes.ErrNotExist {
 					log.Warnf("failed to delete cache object %q: %v", object.Path, err)
 				}
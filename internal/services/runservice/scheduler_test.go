@@ -15,13 +15,21 @@
 package runservice
 
 import (
+	"bytes"
 	"context"
+	"io/ioutil"
+	"os"
 	"sort"
 	"testing"
 	"time"
 
 	"agola.io/agola/internal/common"
+	"agola.io/agola/internal/objectstorage"
+	"agola.io/agola/internal/objectstorage/posix"
+	"agola.io/agola/internal/services/runservice/archive"
+	"agola.io/agola/internal/services/runservice/store"
 	"agola.io/agola/internal/services/runservice/types"
+	"agola.io/agola/internal/toolbox"
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -356,6 +364,45 @@ func TestAdvanceRunTasks(t *testing.T) {
 				return run
 			}(),
 		},
+		{
+			name: "cancel not started task cancelled by a user",
+			rc: func() *types.RunConfig {
+				rc := rc.DeepCopy()
+				return rc
+			}(),
+			r: func() *types.Run {
+				run := run.DeepCopy()
+				run.Tasks["task01"].Stop = true
+				return run
+			}(),
+			out: func() *types.Run {
+				run := run.DeepCopy()
+				run.Tasks["task01"].Stop = true
+				run.Tasks["task01"].Status = types.RunTaskStatusCancelled
+				run.Tasks["task01"].SetupStep.LogPhase = types.RunTaskFetchPhaseFinished
+				return run
+			}(),
+		},
+		{
+			name: "don't cancel task cancelled by a user when already scheduled",
+			rc: func() *types.RunConfig {
+				rc := rc.DeepCopy()
+				return rc
+			}(),
+			r: func() *types.Run {
+				run := run.DeepCopy()
+				run.Tasks["task01"].Stop = true
+				return run
+			}(),
+			activeExecutorTasks: []*types.ExecutorTask{
+				&types.ExecutorTask{ID: "task01"},
+			},
+			out: func() *types.Run {
+				run := run.DeepCopy()
+				run.Tasks["task01"].Stop = true
+				return run
+			}(),
+		},
 	}
 
 	for _, tt := range tests {
@@ -563,6 +610,13 @@ func TestChooseExecutor(t *testing.T) {
 		return e
 	}()
 
+	executorWaitingApproval := func() *types.Executor {
+		e := executorOK.DeepCopy()
+		e.ID = "executorWaitingApproval"
+		e.WaitingApproval = true
+		return e
+	}()
+
 	executorOKMultipleArchs := func() *types.Executor {
 		e := executorOK.DeepCopy()
 		e.ID = "executorOKMultipleArchs"
@@ -577,6 +631,13 @@ func TestChooseExecutor(t *testing.T) {
 		return e
 	}()
 
+	executorOKNewerToolbox := func() *types.Executor {
+		e := executorOK.DeepCopy()
+		e.ID = "executorOKNewerToolbox"
+		e.ToolboxProtocolVersion = toolbox.ProtocolVersion + 1
+		return e
+	}()
+
 	// Only primary and the required variables for this test are set
 	rct := &types.RunConfigTask{
 		ID:   "task01",
@@ -625,6 +686,12 @@ func TestChooseExecutor(t *testing.T) {
 			rct:       rct,
 			out:       nil,
 		},
+		{
+			name:      "test single executor waiting approval",
+			executors: []*types.Executor{executorWaitingApproval},
+			rct:       rct,
+			out:       nil,
+		},
 		{
 			name: "test single executor with different arch",
 			executors: func() []*types.Executor {
@@ -641,6 +708,12 @@ func TestChooseExecutor(t *testing.T) {
 			rct:       rct,
 			out:       executorOKMultipleArchs,
 		},
+		{
+			name:      "test single executor with a newer toolbox protocol version",
+			executors: []*types.Executor{executorOKNewerToolbox},
+			rct:       rct,
+			out:       executorOKNewerToolbox,
+		},
 		{
 			name:      "test single executor without allowed privileged container but privileged containers are required",
 			executors: []*types.Executor{executorOK},
@@ -673,3 +746,349 @@ func TestChooseExecutor(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleApprovalTimeouts(t *testing.T) {
+	now := time.Now()
+	start := now.Add(-50 * time.Minute)
+
+	rc := &types.RunConfig{
+		Tasks: map[string]*types.RunConfigTask{
+			"task01": &types.RunConfigTask{
+				ID:            "task01",
+				NeedsApproval: true,
+				ApprovalTimeout: &types.ApprovalTimeout{
+					Timeout:      time.Hour,
+					Action:       types.ApprovalTimeoutActionReject,
+					NotifyBefore: 15 * time.Minute,
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name            string
+		timeout         time.Duration
+		action          types.ApprovalTimeoutAction
+		notify          bool
+		waitingApproval bool
+		approved        bool
+		status          types.RunTaskStatus
+	}{
+		{
+			name:            "test approval not yet nearing expiry",
+			timeout:         2 * time.Hour,
+			action:          types.ApprovalTimeoutActionReject,
+			waitingApproval: true,
+			status:          types.RunTaskStatusNotStarted,
+		},
+		{
+			name:            "test approval nearing expiry",
+			timeout:         time.Hour,
+			action:          types.ApprovalTimeoutActionReject,
+			notify:          true,
+			waitingApproval: true,
+			status:          types.RunTaskStatusNotStarted,
+		},
+		{
+			name:    "test approval expired with reject action",
+			timeout: 30 * time.Minute,
+			action:  types.ApprovalTimeoutActionReject,
+			status:  types.RunTaskStatusFailed,
+		},
+		{
+			name:     "test approval expired with approve action",
+			timeout:  30 * time.Minute,
+			action:   types.ApprovalTimeoutActionApprove,
+			approved: true,
+			status:   types.RunTaskStatusNotStarted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc.Tasks["task01"].ApprovalTimeout.Timeout = tt.timeout
+			rc.Tasks["task01"].ApprovalTimeout.Action = tt.action
+
+			r := &types.Run{
+				Tasks: map[string]*types.RunTask{
+					"task01": &types.RunTask{
+						ID:                  "task01",
+						Status:              types.RunTaskStatusNotStarted,
+						WaitingApproval:     true,
+						WaitingApprovalTime: &start,
+					},
+				},
+			}
+
+			notify := handleApprovalTimeouts(r, rc, now)
+			if notify != tt.notify {
+				t.Fatalf("got notify %t, want %t", notify, tt.notify)
+			}
+			rt := r.Tasks["task01"]
+			if rt.WaitingApproval != tt.waitingApproval {
+				t.Fatalf("got waiting approval %t, want %t", rt.WaitingApproval, tt.waitingApproval)
+			}
+			if rt.Approved != tt.approved {
+				t.Fatalf("got approved %t, want %t", rt.Approved, tt.approved)
+			}
+			if rt.Status != tt.status {
+				t.Fatalf("got status %q, want %q", rt.Status, tt.status)
+			}
+		})
+	}
+}
+
+func TestAdvanceRunIgnoreFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		// task02 is a quarantined task or a task with ignore_failure set
+		ignoreFailure bool
+		task01Status  types.RunTaskStatus
+		task02Status  types.RunTaskStatus
+		result        types.RunResult
+	}{
+		{
+			name:         "test task failed",
+			task01Status: types.RunTaskStatusSuccess,
+			task02Status: types.RunTaskStatusFailed,
+			result:       types.RunResultFailed,
+		},
+		{
+			name:          "test ignored task failed",
+			ignoreFailure: true,
+			task01Status:  types.RunTaskStatusSuccess,
+			task02Status:  types.RunTaskStatusFailed,
+			result:        types.RunResultSuccess,
+		},
+		{
+			name:          "test ignored task failed with other task running",
+			ignoreFailure: true,
+			task01Status:  types.RunTaskStatusRunning,
+			task02Status:  types.RunTaskStatusFailed,
+			result:        types.RunResultUnknown,
+		},
+		{
+			name:          "test ignored task failed with other task failed",
+			ignoreFailure: true,
+			task01Status:  types.RunTaskStatusFailed,
+			task02Status:  types.RunTaskStatusFailed,
+			result:        types.RunResultFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := &types.RunConfig{
+				ID: "rc01",
+				Tasks: map[string]*types.RunConfigTask{
+					"task01": {ID: "task01", Name: "task01"},
+					"task02": {ID: "task02", Name: "task02", IgnoreFailure: tt.ignoreFailure},
+				},
+			}
+			r := &types.Run{
+				ID:     "run01",
+				Phase:  types.RunPhaseRunning,
+				Result: types.RunResultUnknown,
+				Tasks: map[string]*types.RunTask{
+					"task01": {ID: "task01", Status: tt.task01Status},
+					"task02": {ID: "task02", Status: tt.task02Status},
+				},
+			}
+
+			if err := advanceRun(context.Background(), r, rc, nil); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if r.Result != tt.result {
+				t.Fatalf("got run result %q, want %q", r.Result, tt.result)
+			}
+		})
+	}
+}
+
+func TestHandleQueueWaits(t *testing.T) {
+	now := time.Now()
+	schedulable := now.Add(-10 * time.Minute)
+
+	tests := []struct {
+		name            string
+		schedulableTime *time.Time
+		alerted         bool
+		threshold       time.Duration
+		notify          bool
+	}{
+		{
+			name: "test task just become schedulable",
+		},
+		{
+			name:            "test no alert threshold",
+			schedulableTime: &schedulable,
+		},
+		{
+			name:            "test queue wait below threshold",
+			schedulableTime: &schedulable,
+			threshold:       time.Hour,
+		},
+		{
+			name:            "test queue wait over threshold",
+			schedulableTime: &schedulable,
+			threshold:       5 * time.Minute,
+			notify:          true,
+		},
+		{
+			name:            "test queue wait over threshold already alerted",
+			schedulableTime: &schedulable,
+			alerted:         true,
+			threshold:       5 * time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := &types.RunTask{
+				ID:               "task01",
+				Status:           types.RunTaskStatusNotStarted,
+				SchedulableTime:  tt.schedulableTime,
+				QueueWaitAlerted: tt.alerted,
+			}
+			r := &types.Run{
+				Tasks: map[string]*types.RunTask{"task01": rt},
+			}
+
+			notify := handleQueueWaits(r, []*types.RunTask{rt}, tt.threshold, now)
+			if notify != tt.notify {
+				t.Fatalf("got notify %t, want %t", notify, tt.notify)
+			}
+			if rt.SchedulableTime == nil {
+				t.Fatalf("expected schedulable time to be set")
+			}
+			if tt.schedulableTime == nil && !rt.SchedulableTime.Equal(now) {
+				t.Fatalf("got schedulable time %s, want %s", rt.SchedulableTime, now)
+			}
+			if rt.QueueWaitAlerted != (tt.alerted || tt.notify) {
+				t.Fatalf("got queue wait alerted %t, want %t", rt.QueueWaitAlerted, tt.alerted || tt.notify)
+			}
+		})
+	}
+}
+
+func TestCleanOSTExpiredArchives(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := posix.New(dir)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	ost := objectstorage.NewObjStorage(s, "/")
+
+	now := time.Now()
+	expireTimes := map[string]time.Time{
+		"rt01": now.Add(-time.Hour),
+		"rt02": now.Add(time.Hour),
+	}
+	for rtID, expireTime := range expireTimes {
+		if err := ost.WriteObject(store.OSTRunTaskArchiveManifestPath(rtID, 0), bytes.NewReader([]byte{}), 0, false); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if err := writeArchivesExpireTime(ost, rtID, expireTime); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	if err := cleanOSTExpiredArchives(ost); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	for rtID, exists := range map[string]bool{"rt01": false, "rt02": true} {
+		for _, p := range []string{store.OSTRunTaskArchiveManifestPath(rtID, 0), store.OSTRunTaskArchivesExpirePath(rtID)} {
+			ok, err := ostFileExists(ost, p)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if ok != exists {
+				t.Errorf("expected %q exists: %t, got: %t", p, exists, ok)
+			}
+		}
+	}
+}
+
+func TestCleanOSTArchiveChunks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := posix.New(dir)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	ost := objectstorage.NewObjStorage(s, "/")
+
+	now := time.Now()
+	expireTimes := map[string]time.Time{
+		"rt01": now.Add(-time.Hour),
+		"rt02": now.Add(time.Hour),
+	}
+	// every archive has its own data and a shared part
+	shared := bytes.Repeat([]byte("shared"), 1024)
+	for rtID, expireTime := range expireTimes {
+		data := append(bytes.Repeat([]byte(rtID), 1024), shared...)
+		if _, err := archive.Save(ost, store.OSTRunTaskArchiveManifestPath(rtID, 0), "project/p01", bytes.NewReader(data)); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if err := writeArchivesExpireTime(ost, rtID, expireTime); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	chunks := func() map[string]struct{} {
+		chunks := map[string]struct{}{}
+		doneCh := make(chan struct{})
+		defer close(doneCh)
+		for object := range ost.List("workspacechunks/", "", true, doneCh) {
+			if object.Err != nil {
+				t.Fatalf("unexpected err: %v", object.Err)
+			}
+			chunks[object.Path] = struct{}{}
+		}
+		return chunks
+	}
+	initialChunks := chunks()
+
+	if err := cleanOSTExpiredArchives(ost); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// the chunks are kept during the grace period
+	if err := archive.CleanChunks(ost, store.OSTArchivesDir(), time.Hour); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if got := chunks(); len(got) != len(initialChunks) {
+		t.Fatalf("expected %d chunks, got %d", len(initialChunks), len(got))
+	}
+
+	if err := archive.CleanChunks(ost, store.OSTArchivesDir(), 0); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	m, err := archive.GetManifest(ost, store.OSTRunTaskArchiveManifestPath("rt02", 0))
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if got := chunks(); len(got) != len(m.Chunks) || len(got) >= len(initialChunks) {
+		t.Fatalf("expected only the %d chunks of the not expired archive, got %d chunks", len(m.Chunks), len(got))
+	}
+
+	// the not expired archive must be restorable
+	var buf bytes.Buffer
+	if err := archive.Restore(ost, m, &buf); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), append(bytes.Repeat([]byte("rt02"), 1024), shared...)) {
+		t.Fatalf("restored archive data mismatch")
+	}
+}
@@ -21,10 +21,12 @@ import (
 	"path"
 	"reflect"
 	"strings"
+	"time"
 
 	"agola.io/agola/internal/datamanager"
 	"agola.io/agola/internal/etcd"
 	ostypes "agola.io/agola/internal/objectstorage/types"
+	"agola.io/agola/internal/sequence"
 	"agola.io/agola/internal/services/runservice/common"
 	"agola.io/agola/internal/services/runservice/types"
 	"agola.io/agola/internal/util"
@@ -131,12 +133,24 @@ func OSTRunTaskStepLogPath(rtID string, step int) string {
 	return path.Join(OSTRunTaskLogsDataDir(rtID), "steps", fmt.Sprintf("%d.log", step))
 }
 
+// OSTRunTaskSetupAttemptLogPath is the setup log path of a previous task
+// attempt. The last attempt log is saved at OSTRunTaskSetupLogPath
+func OSTRunTaskSetupAttemptLogPath(rtID string, attempt int) string {
+	return path.Join(OSTRunTaskLogsDataDir(rtID), fmt.Sprintf("setup.%d.log", attempt))
+}
+
+// OSTRunTaskStepAttemptLogPath is the step log path of a previous step
+// attempt. The last attempt log is saved at OSTRunTaskStepLogPath
+func OSTRunTaskStepAttemptLogPath(rtID string, step, attempt int) string {
+	return path.Join(OSTRunTaskLogsDataDir(rtID), "steps", fmt.Sprintf("%d.%d.log", step, attempt))
+}
+
 func OSTRunTaskLogsRunPath(rtID, runID string) string {
 	return path.Join(OSTRunTaskLogsRunsDir(rtID), runID)
 }
 
 func OSTRunTaskArchivesBaseDir(rtID string) string {
-	return path.Join("workspacearchives", rtID)
+	return path.Join(OSTArchivesDir(), rtID)
 }
 
 func OSTRunTaskArchivesDataDir(rtID string) string {
@@ -151,10 +165,48 @@ func OSTRunTaskArchivePath(rtID string, step int) string {
 	return path.Join(OSTRunTaskArchivesDataDir(rtID), fmt.Sprintf("%d.tar", step))
 }
 
+func OSTRunTaskArchiveManifestPath(rtID string, step int) string {
+	return path.Join(OSTRunTaskArchivesDataDir(rtID), fmt.Sprintf("%d.manifest", step))
+}
+
 func OSTRunTaskArchivesRunPath(rtID, runID string) string {
 	return path.Join(OSTRunTaskArchivesRunsDir(rtID), runID)
 }
 
+// OSTRunTaskArchivesExpirePath is the path of the object containing the
+// expiration time of the run task archives
+func OSTRunTaskArchivesExpirePath(rtID string) string {
+	return path.Join(OSTRunTaskArchivesBaseDir(rtID), "expire")
+}
+
+func OSTArchivesDir() string {
+	return "workspacearchives"
+}
+
+func OSTRunTaskTestReportsDir(rtID string) string {
+	return path.Join("testreports", rtID)
+}
+
+func OSTRunTaskTestReportPath(rtID string, step int) string {
+	return path.Join(OSTRunTaskTestReportsDir(rtID), fmt.Sprintf("%d.json", step))
+}
+
+func OSTRunTaskCoverageReportsDir(rtID string) string {
+	return path.Join("coveragereports", rtID)
+}
+
+func OSTRunTaskCoverageReportPath(rtID string, step int) string {
+	return path.Join(OSTRunTaskCoverageReportsDir(rtID), fmt.Sprintf("%d.json", step))
+}
+
+func OSTRunTaskExecAuditDir(rtID string) string {
+	return path.Join("execaudit", rtID)
+}
+
+func OSTRunTaskExecAuditPath(rtID, id string) string {
+	return path.Join(OSTRunTaskExecAuditDir(rtID), fmt.Sprintf("%s.json", id))
+}
+
 func OSTCacheDir() string {
 	return "caches"
 }
@@ -281,6 +333,21 @@ func PutExecutor(ctx context.Context, e *etcd.Store, executor *types.Executor) (
 	return executor, nil
 }
 
+func AtomicPutExecutor(ctx context.Context, e *etcd.Store, executor *types.Executor) (*types.Executor, error) {
+	executorj, err := json.Marshal(executor)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := e.AtomicPut(ctx, common.EtcdExecutorKey(executor.ID), executorj, executor.Revision, nil)
+	if err != nil {
+		return nil, err
+	}
+	executor.Revision = resp.Header.Revision
+
+	return executor, nil
+}
+
 func DeleteExecutor(ctx context.Context, e *etcd.Store, executorID string) error {
 	return e.Delete(ctx, common.EtcdExecutorKey(executorID))
 }
@@ -334,6 +401,195 @@ func DeleteExecutorTask(ctx context.Context, e *etcd.Store, etID string) error {
 	return e.Delete(ctx, common.EtcdTaskKey(etID))
 }
 
+// ErrExecutorTaskLeaseConflict is returned when an executor task lease is held
+// by another executor or when the provided lease token is stale
+var ErrExecutorTaskLeaseConflict = errors.New("executor task lease conflict")
+
+func GetExecutorTaskLease(ctx context.Context, e *etcd.Store, etID string) (*types.ExecutorTaskLease, error) {
+	resp, err := e.Get(ctx, common.EtcdTaskLeaseKey(etID), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var lease *types.ExecutorTaskLease
+	kv := resp.Kvs[0]
+	if err := json.Unmarshal(kv.Value, &lease); err != nil {
+		return nil, err
+	}
+	lease.Revision = kv.ModRevision
+
+	return lease, nil
+}
+
+func atomicPutExecutorTaskLease(ctx context.Context, e *etcd.Store, lease *types.ExecutorTaskLease) (*types.ExecutorTaskLease, error) {
+	leasej, err := json.Marshal(lease)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := e.AtomicPut(ctx, common.EtcdTaskLeaseKey(lease.TaskID), leasej, lease.Revision, nil)
+	if err != nil {
+		return nil, err
+	}
+	lease.Revision = resp.Header.Revision
+
+	return lease, nil
+}
+
+// AcquireExecutorTaskLease acquires a new lease on the executor task for the
+// provided executor. It fails with ErrExecutorTaskLeaseConflict if another
+// executor holds a not expired lease. Every acquisition increases the lease
+// fencing token.
+func AcquireExecutorTaskLease(ctx context.Context, e *etcd.Store, etID, executorID string, duration time.Duration) (*types.ExecutorTaskLease, error) {
+	curLease, err := GetExecutorTaskLease(ctx, e, etID)
+	if err != nil && err != etcd.ErrKeyNotFound {
+		return nil, err
+	}
+
+	now := time.Now()
+	lease := &types.ExecutorTaskLease{
+		TaskID:     etID,
+		ExecutorID: executorID,
+		Token:      1,
+		Duration:   duration,
+		ExpireTime: now.Add(duration),
+	}
+	if curLease != nil {
+		if curLease.ExecutorID != executorID && !curLease.IsExpired(now) {
+			return nil, ErrExecutorTaskLeaseConflict
+		}
+		lease.Token = curLease.Token + 1
+		lease.Revision = curLease.Revision
+	}
+
+	lease, err = atomicPutExecutorTaskLease(ctx, e, lease)
+	if err == etcd.ErrKeyModified {
+		return nil, ErrExecutorTaskLeaseConflict
+	}
+	return lease, err
+}
+
+// RenewExecutorTaskLease extends the executor task lease held by the provided
+// executor with the provided token. It fails with ErrExecutorTaskLeaseConflict
+// if the lease has been acquired by someone else in the meantime.
+func RenewExecutorTaskLease(ctx context.Context, e *etcd.Store, etID, executorID string, token int64, duration time.Duration) (*types.ExecutorTaskLease, error) {
+	lease, err := GetExecutorTaskLease(ctx, e, etID)
+	if err != nil {
+		if err == etcd.ErrKeyNotFound {
+			return nil, ErrExecutorTaskLeaseConflict
+		}
+		return nil, err
+	}
+	if lease.ExecutorID != executorID || lease.Token != token {
+		return nil, ErrExecutorTaskLeaseConflict
+	}
+
+	lease.Duration = duration
+	lease.ExpireTime = time.Now().Add(duration)
+
+	lease, err = atomicPutExecutorTaskLease(ctx, e, lease)
+	if err == etcd.ErrKeyModified {
+		return nil, ErrExecutorTaskLeaseConflict
+	}
+	return lease, err
+}
+
+func DeleteExecutorTaskLease(ctx context.Context, e *etcd.Store, etID string) error {
+	return e.Delete(ctx, common.EtcdTaskLeaseKey(etID))
+}
+
+// GetMaintenance returns the maintenance mode status. The maintenance mode is
+// enabled when its key exists.
+func GetMaintenance(ctx context.Context, e *etcd.Store) (*types.Maintenance, error) {
+	resp, err := e.Get(ctx, common.EtcdMaintenanceKey, 0)
+	if err != nil {
+		if err == etcd.ErrKeyNotFound {
+			return &types.Maintenance{}, nil
+		}
+		return nil, err
+	}
+
+	var maintenance *types.Maintenance
+	kv := resp.Kvs[0]
+	if err := json.Unmarshal(kv.Value, &maintenance); err != nil {
+		return nil, err
+	}
+	maintenance.Revision = kv.ModRevision
+
+	return maintenance, nil
+}
+
+func PutMaintenance(ctx context.Context, e *etcd.Store, maintenance *types.Maintenance) (*types.Maintenance, error) {
+	maintenancej, err := json.Marshal(maintenance)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := e.Put(ctx, common.EtcdMaintenanceKey, maintenancej, nil)
+	if err != nil {
+		return nil, err
+	}
+	maintenance.Revision = resp.Header.Revision
+
+	return maintenance, nil
+}
+
+func DeleteMaintenance(ctx context.Context, e *etcd.Store) error {
+	return e.Delete(ctx, common.EtcdMaintenanceKey)
+}
+
+// QueueWebhook saves a webhook received during the maintenance mode. The
+// queued webhook id is a sequence so they are listed in the receive order.
+func QueueWebhook(ctx context.Context, e *etcd.Store, qw *types.QueuedWebhook) (*types.QueuedWebhook, error) {
+	seq, err := sequence.IncSequence(ctx, e, common.EtcdQueuedWebhookSequenceKey)
+	if err != nil {
+		return nil, err
+	}
+	qw.ID = seq.String()
+
+	qwj, err := json.Marshal(qw)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := e.Put(ctx, common.EtcdQueuedWebhookKey(qw.ID), qwj, nil); err != nil {
+		return nil, err
+	}
+
+	return qw, nil
+}
+
+func GetQueuedWebhooks(ctx context.Context, e *etcd.Store) ([]*types.QueuedWebhook, error) {
+	resp, err := e.List(ctx, common.EtcdQueuedWebhooksDir, "", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	qws := []*types.QueuedWebhook{}
+	for _, kv := range resp.Kvs {
+		var qw *types.QueuedWebhook
+		if err := json.Unmarshal(kv.Value, &qw); err != nil {
+			return nil, err
+		}
+		qws = append(qws, qw)
+	}
+
+	return qws, nil
+}
+
+// DeleteQueuedWebhook removes a queued webhook. It returns etcd.ErrKeyNotFound
+// if the queued webhook doesn't exist so it can be used to concurrently claim
+// a queued webhook for replay.
+func DeleteQueuedWebhook(ctx context.Context, e *etcd.Store, id string) error {
+	resp, err := e.Client().Delete(ctx, common.EtcdQueuedWebhookKey(id))
+	if err != nil {
+		return etcd.FromEtcdError(err)
+	}
+	if resp.Deleted == 0 {
+		return etcd.ErrKeyNotFound
+	}
+	return nil
+}
+
 func GetExecutorTasks(ctx context.Context, e *etcd.Store, executorID string) ([]*types.ExecutorTask, error) {
 	resp, err := e.List(ctx, common.EtcdTasksDir, "", 0)
 	if err != nil {
@@ -547,3 +803,66 @@ func GetRunEtcdOrOST(ctx context.Context, e *etcd.Store, dm *datamanager.DataMan
 
 	return r, nil
 }
+
+func CreateFailedWebhook(ctx context.Context, e *etcd.Store, fw *types.FailedWebhook) (*types.FailedWebhook, error) {
+	seq, err := sequence.IncSequence(ctx, e, common.EtcdFailedWebhookSequenceKey)
+	if err != nil {
+		return nil, err
+	}
+	fw.ID = seq.String()
+
+	fwj, err := json.Marshal(fw)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := e.Put(ctx, common.EtcdFailedWebhookKey(fw.ID), fwj, nil); err != nil {
+		return nil, err
+	}
+
+	return fw, nil
+}
+
+func GetFailedWebhook(ctx context.Context, e *etcd.Store, id string) (*types.FailedWebhook, error) {
+	resp, err := e.Get(ctx, common.EtcdFailedWebhookKey(id), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var fw *types.FailedWebhook
+	if err := json.Unmarshal(resp.Kvs[0].Value, &fw); err != nil {
+		return nil, err
+	}
+
+	return fw, nil
+}
+
+func GetFailedWebhooks(ctx context.Context, e *etcd.Store) ([]*types.FailedWebhook, error) {
+	resp, err := e.List(ctx, common.EtcdFailedWebhooksDir, "", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	fws := []*types.FailedWebhook{}
+	for _, kv := range resp.Kvs {
+		var fw *types.FailedWebhook
+		if err := json.Unmarshal(kv.Value, &fw); err != nil {
+			return nil, err
+		}
+		fws = append(fws, fw)
+	}
+
+	return fws, nil
+}
+
+// DeleteFailedWebhook removes a failed webhook. Like DeleteQueuedWebhook it
+// returns etcd.ErrKeyNotFound if the failed webhook doesn't exist.
+func DeleteFailedWebhook(ctx context.Context, e *etcd.Store, id string) error {
+	resp, err := e.Client().Delete(ctx, common.EtcdFailedWebhookKey(id))
+	if err != nil {
+		return etcd.FromEtcdError(err)
+	}
+	if resp.Deleted == 0 {
+		return etcd.ErrKeyNotFound
+	}
+	return nil
+}
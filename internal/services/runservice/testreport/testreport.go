@@ -0,0 +1,266 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testreport
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"agola.io/agola/internal/services/runservice/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	// maxFileSize is the max size of a test report file
+	maxFileSize = 64 * 1024 * 1024
+	// maxMessageLength is the max length of a test case failure message
+	maxMessageLength = 4096
+)
+
+// ParseArchive parses all the test report files inside the provided tar
+// archive
+func ParseArchive(format types.TestReportFormat, r io.Reader) (*types.TestReport, error) {
+	report := &types.TestReport{
+		Format: format,
+		Tests:  []*types.TestCase{},
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Errorf("failed to read archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		data, err := ioutil.ReadAll(io.LimitReader(tr, maxFileSize+1))
+		if err != nil {
+			return nil, errors.Errorf("failed to read file %q: %w", hdr.Name, err)
+		}
+		if len(data) > maxFileSize {
+			return nil, errors.Errorf("file %q is bigger than %d bytes", hdr.Name, maxFileSize)
+		}
+
+		tests, err := Parse(format, data)
+		if err != nil {
+			return nil, errors.Errorf("failed to parse file %q: %w", hdr.Name, err)
+		}
+		report.Tests = append(report.Tests, tests...)
+	}
+
+	for _, tc := range report.Tests {
+		report.Summary.Add(tc)
+	}
+
+	return report, nil
+}
+
+// Parse parses a test report file
+func Parse(format types.TestReportFormat, data []byte) ([]*types.TestCase, error) {
+	switch format {
+	case types.TestReportFormatJUnit:
+		return parseJUnit(data)
+	case types.TestReportFormatGoTest:
+		return parseGoTest(data)
+	default:
+		return nil, errors.Errorf("unknown test report format %q", format)
+	}
+}
+
+type junitTestSuite struct {
+	Name string `xml:"name,attr"`
+
+	// nested test suites (or the test suites of a testsuites root element)
+	Suites []*junitTestSuite `xml:"testsuite"`
+	Cases  []*junitTestCase  `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string       `xml:"name,attr"`
+	ClassName string       `xml:"classname,attr"`
+	Time      string       `xml:"time,attr"`
+	Failure   *junitResult `xml:"failure"`
+	Error     *junitResult `xml:"error"`
+	Skipped   *junitResult `xml:"skipped"`
+}
+
+type junitResult struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func (r *junitResult) message() string {
+	msg := strings.TrimSpace(r.Message)
+	text := strings.TrimSpace(r.Text)
+	if text != "" {
+		if msg != "" {
+			msg += "\n"
+		}
+		msg += text
+	}
+	return truncateMessage(msg)
+}
+
+// parseJUnit parses a junit xml file. Both the testsuites and the testsuite
+// root elements are supported.
+func parseJUnit(data []byte) ([]*types.TestCase, error) {
+	var root junitTestSuite
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, errors.Errorf("failed to decode junit xml: %w", err)
+	}
+
+	tests := []*types.TestCase{}
+	var walk func(s *junitTestSuite)
+	walk = func(s *junitTestSuite) {
+		for _, jtc := range s.Cases {
+			tc := &types.TestCase{
+				Suite:    jtc.ClassName,
+				Name:     jtc.Name,
+				Status:   types.TestCaseStatusPassed,
+				Duration: parseSeconds(jtc.Time),
+			}
+			if tc.Suite == "" {
+				tc.Suite = s.Name
+			}
+			switch {
+			case jtc.Failure != nil:
+				tc.Status = types.TestCaseStatusFailed
+				tc.Message = jtc.Failure.message()
+			case jtc.Error != nil:
+				tc.Status = types.TestCaseStatusFailed
+				tc.Message = jtc.Error.message()
+			case jtc.Skipped != nil:
+				tc.Status = types.TestCaseStatusSkipped
+				tc.Message = jtc.Skipped.message()
+			}
+			tests = append(tests, tc)
+		}
+		for _, ss := range s.Suites {
+			walk(ss)
+		}
+	}
+	walk(&root)
+
+	return tests, nil
+}
+
+// parseSeconds parses a junit time attribute (seconds with an optional
+// fractional part)
+func parseSeconds(s string) time.Duration {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", "")
+	if s == "" {
+		return 0
+	}
+	secs, err := strconv.ParseFloat(s, 64)
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs * float64(time.Second))
+}
+
+// goTestEvent is an event emitted by go test -json (see go doc test2json)
+type goTestEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+// parseGoTest parses the output of go test -json. Lines that aren't json
+// events (i.e. build errors) are ignored.
+func parseGoTest(data []byte) ([]*types.TestCase, error) {
+	tests := []*types.TestCase{}
+	testsMap := map[string]*types.TestCase{}
+	outputs := map[string]*strings.Builder{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), maxFileSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		var ev goTestEvent
+		if err := json.Unmarshal(line, &ev); err != nil {
+			continue
+		}
+		// ignore package level events
+		if ev.Test == "" {
+			continue
+		}
+
+		key := ev.Package + "\x00" + ev.Test
+		switch ev.Action {
+		case "output":
+			out, ok := outputs[key]
+			if !ok {
+				out = &strings.Builder{}
+				outputs[key] = out
+			}
+			if out.Len() < maxMessageLength {
+				out.WriteString(ev.Output)
+			}
+		case "pass", "fail", "skip":
+			tc, ok := testsMap[key]
+			if !ok {
+				tc = &types.TestCase{
+					Suite: ev.Package,
+					Name:  ev.Test,
+				}
+				testsMap[key] = tc
+				tests = append(tests, tc)
+			}
+			tc.Duration = time.Duration(ev.Elapsed * float64(time.Second))
+			switch ev.Action {
+			case "pass":
+				tc.Status = types.TestCaseStatusPassed
+			case "fail":
+				tc.Status = types.TestCaseStatusFailed
+				if out, ok := outputs[key]; ok {
+					tc.Message = truncateMessage(strings.TrimSpace(out.String()))
+				}
+			case "skip":
+				tc.Status = types.TestCaseStatusSkipped
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Errorf("failed to read go test json: %w", err)
+	}
+
+	return tests, nil
+}
+
+func truncateMessage(msg string) string {
+	if len(msg) > maxMessageLength {
+		return msg[:maxMessageLength]
+	}
+	return msg
+}
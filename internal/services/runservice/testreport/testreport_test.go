@@ -0,0 +1,109 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testreport
+
+import (
+	"testing"
+	"time"
+
+	"agola.io/agola/internal/services/runservice/types"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		format types.TestReportFormat
+		in     string
+		out    []*types.TestCase
+		err    bool
+	}{
+		{
+			name:   "junit testsuites",
+			format: types.TestReportFormatJUnit,
+			in: `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="suite01" tests="3">
+    <testcase classname="pkg.Class01" name="test01" time="1.5"/>
+    <testcase name="test02" time="0.25">
+      <failure message="expected 1">assertion failed</failure>
+    </testcase>
+    <testcase classname="pkg.Class01" name="test03">
+      <skipped/>
+    </testcase>
+  </testsuite>
+</testsuites>`,
+			out: []*types.TestCase{
+				{Suite: "pkg.Class01", Name: "test01", Status: types.TestCaseStatusPassed, Duration: 1500 * time.Millisecond},
+				{Suite: "suite01", Name: "test02", Status: types.TestCaseStatusFailed, Duration: 250 * time.Millisecond, Message: "expected 1\nassertion failed"},
+				{Suite: "pkg.Class01", Name: "test03", Status: types.TestCaseStatusSkipped},
+			},
+		},
+		{
+			name:   "junit testsuite root",
+			format: types.TestReportFormatJUnit,
+			in: `<testsuite name="suite01">
+  <testcase name="test01" time="2"><error message="panic"/></testcase>
+</testsuite>`,
+			out: []*types.TestCase{
+				{Suite: "suite01", Name: "test01", Status: types.TestCaseStatusFailed, Duration: 2 * time.Second, Message: "panic"},
+			},
+		},
+		{
+			name:   "junit invalid xml",
+			format: types.TestReportFormatJUnit,
+			in:     `<testsuite`,
+			err:    true,
+		},
+		{
+			name:   "go test json",
+			format: types.TestReportFormatGoTest,
+			in: `{"Action":"run","Package":"pkg01","Test":"TestA"}
+{"Action":"output","Package":"pkg01","Test":"TestA","Output":"=== RUN   TestA\n"}
+{"Action":"pass","Package":"pkg01","Test":"TestA","Elapsed":0.5}
+# build output that isn't json
+{"Action":"run","Package":"pkg01","Test":"TestB"}
+{"Action":"output","Package":"pkg01","Test":"TestB","Output":"    b_test.go:10: wrong value\n"}
+{"Action":"fail","Package":"pkg01","Test":"TestB","Elapsed":1}
+{"Action":"skip","Package":"pkg01","Test":"TestC","Elapsed":0}
+{"Action":"fail","Package":"pkg01","Elapsed":1.5}
+`,
+			out: []*types.TestCase{
+				{Suite: "pkg01", Name: "TestA", Status: types.TestCaseStatusPassed, Duration: 500 * time.Millisecond},
+				{Suite: "pkg01", Name: "TestB", Status: types.TestCaseStatusFailed, Duration: time.Second, Message: "b_test.go:10: wrong value"},
+				{Suite: "pkg01", Name: "TestC", Status: types.TestCaseStatusSkipped},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := Parse(tt.format, []byte(tt.in))
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Fatalf("test cases mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
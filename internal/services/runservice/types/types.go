@@ -18,11 +18,15 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"agola.io/agola/internal/common"
 	"agola.io/agola/internal/util"
 	"github.com/mitchellh/copystructure"
+
+	errors "golang.org/x/xerrors"
 )
 
 const (
@@ -89,12 +93,28 @@ func RunResultFromStringSlice(slice []string) []RunResult {
 	return rss
 }
 
+// RunLabelsFromStringSlice parses a list of labels in the key=value format
+func RunLabelsFromStringSlice(slice []string) (map[string]string, error) {
+	labels := make(map[string]string, len(slice))
+	for _, s := range slice {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, errors.Errorf("wrong label %q, must be in the key=value format", s)
+		}
+		labels[kv[0]] = kv[1]
+	}
+	return labels, nil
+}
+
 // Run is the run status of a RUN. Until the run is not finished it'll live in
 // etcd. So we should keep it smaller to avoid using too much space
 type Run struct {
 	ID   string `json:"id,omitempty"`
 	Name string `json:"name,omitempty"`
 
+	// Counter is the run number. It's a monotonically increasing number per
+	// root group (the project or the user for user direct runs) assigned at
+	// run creation
 	Counter uint64 `json:"counter,omitempty"`
 
 	// Group is the run group of the run. Every run is assigned to a specific group
@@ -106,6 +126,11 @@ type Run struct {
 	// Annotations contain custom run annotations
 	Annotations map[string]string `json:"annotations,omitempty"`
 
+	// Labels are the run labels (the automatic ones derived from the run
+	// creation event and the ones defined in the run config) used to filter
+	// the runs
+	Labels map[string]string `json:"labels,omitempty"`
+
 	// Phase represent the current run status. A run could be running but already
 	// marked as failed due to some tasks failed. The run will be marked as finished
 	// only then all the executor tasks are known to be really ended. This permits
@@ -118,6 +143,15 @@ type Run struct {
 
 	// Stop is used to signal from the scheduler when the run must be stopped
 	Stop bool `json:"stop,omitempty"`
+	// StopReason explains why the run has been stopped when it wasn't stopped
+	// by a user (i.e. by the runservice janitor)
+	StopReason string `json:"stop_reason,omitempty"`
+
+	// Paused is set when the run has been paused: no new tasks are scheduled
+	// until it's resumed
+	Paused bool `json:"paused,omitempty"`
+	// PauseWindows are the periods when the run was paused
+	PauseWindows []*RunPauseWindow `json:"pause_windows,omitempty"`
 
 	Tasks       map[string]*RunTask `json:"tasks,omitempty"`
 	EnqueueTime *time.Time          `json:"enqueue_time,omitempty"`
@@ -126,6 +160,22 @@ type Run struct {
 
 	Archived bool `json:"archived,omitempty"`
 
+	// StoragePartition is the object storage partition where the run logs,
+	// archives and caches are saved. Empty means the default object storage.
+	StoragePartition string `json:"storage_partition,omitempty"`
+
+	// ArtifactsRetention is how long the tasks workspace archives are kept
+	// after the tasks end. Zero means forever.
+	ArtifactsRetention time.Duration `json:"artifacts_retention,omitempty"`
+
+	// Pinned runs are exempt from the artifacts retention: their tasks
+	// workspace archives are kept until the run is unpinned
+	Pinned bool `json:"pinned,omitempty"`
+
+	// RestartedFromFailedTasks reports if the run has been created restarting
+	// the failed tasks of a previous run
+	RestartedFromFailedTasks bool `json:"restarted_from_failed_tasks,omitempty"`
+
 	// internal values not saved
 	Revision int64 `json:"-"`
 }
@@ -138,6 +188,14 @@ func (r *Run) DeepCopy() *Run {
 	return nr.(*Run)
 }
 
+// RunPauseWindow is a period when the run was paused. End is nil while the
+// run is still paused
+type RunPauseWindow struct {
+	Start    time.Time  `json:"start,omitempty"`
+	End      *time.Time `json:"end,omitempty"`
+	PausedBy string     `json:"paused_by,omitempty"`
+}
+
 func (r *Run) ChangePhase(phase RunPhase) {
 	r.Phase = phase
 	switch {
@@ -145,6 +203,28 @@ func (r *Run) ChangePhase(phase RunPhase) {
 		r.StartTime = util.TimePtr(time.Now())
 	case phase.IsFinished():
 		r.EndTime = util.TimePtr(time.Now())
+		// a finished run cannot be paused
+		r.Resume(*r.EndTime)
+	}
+}
+
+// Pause pauses the run opening a new pause window
+func (r *Run) Pause(pausedBy string, now time.Time) {
+	if r.Paused {
+		return
+	}
+	r.Paused = true
+	r.PauseWindows = append(r.PauseWindows, &RunPauseWindow{Start: now, PausedBy: pausedBy})
+}
+
+// Resume resumes a paused run closing its current pause window
+func (r *Run) Resume(now time.Time) {
+	if !r.Paused {
+		return
+	}
+	r.Paused = false
+	if len(r.PauseWindows) > 0 {
+		r.PauseWindows[len(r.PauseWindows)-1].End = util.TimePtr(now)
 	}
 }
 
@@ -237,13 +317,62 @@ type RunTask struct {
 	WaitingApproval bool `json:"waiting_approval,omitempty"`
 	Approved        bool `json:"approved,omitempty"`
 
+	// WaitingApprovalTime is the time when the task started waiting approval
+	WaitingApprovalTime *time.Time `json:"waiting_approval_time,omitempty"`
+	// ApprovalExpiryNotified reports that the approval is nearing expiry and
+	// the approvers have been notified
+	ApprovalExpiryNotified bool `json:"approval_expiry_notified,omitempty"`
+	// ApprovalTimedOut reports that the approval timeout expired and the
+	// timeout action has been executed
+	ApprovalTimedOut bool `json:"approval_timed_out,omitempty"`
+
 	SetupStep RunTaskStep    `json:"setup_step,omitempty"`
 	Steps     []*RunTaskStep `json:"steps,omitempty"`
 
+	// Attempts is the number of task executions (greater than one when the
+	// task has been retried)
+	Attempts int `json:"attempts,omitempty"`
+
+	// Dispatches is the number of times the task has been dispatched again
+	// since the executor didn't start it or the task was orphaned
+	Dispatches int `json:"dispatches,omitempty"`
+
+	// PreviewURL is the preview environment url registered by the task
+	PreviewURL *PreviewURL `json:"preview_url,omitempty"`
+
+	// ExportedEnvironment contains the variables exported by the task
+	// export_env steps. They are provided to all the downstream tasks.
+	ExportedEnvironment map[string]string `json:"exported_environment,omitempty"`
+
+	// Outputs are the task declared outputs values set by the task steps
+	Outputs map[string]string `json:"outputs,omitempty"`
+
+	// FailureReason explains why the task failed when it wasn't caused by the
+	// step command itself
+	FailureReason *TaskFailureReason `json:"failure_reason,omitempty"`
+
 	// steps numbers of workspace archives,
 	WorkspaceArchives      []int               `json:"workspace_archives,omitempty"`
 	WorkspaceArchivesPhase []RunTaskFetchPhase `json:"workspace_archives_phase,omitempty"`
 
+	// SchedulableTime is the time when the task became schedulable (all its
+	// parents finished and, if needed, it has been approved)
+	SchedulableTime *time.Time `json:"schedulable_time,omitempty"`
+	// QueueWait is the time the task waited between being schedulable and
+	// being started by an executor
+	QueueWait time.Duration `json:"queue_wait,omitempty"`
+	// QueueWaitAlerted reports that the task queue wait exceeded the alert
+	// threshold and it has been notified
+	QueueWaitAlerted bool `json:"queue_wait_alerted,omitempty"`
+
+	// Stop is set when the task has been cancelled by a user. A not started
+	// task will be cancelled while a running task will be stopped.
+	Stop bool `json:"stop,omitempty"`
+	// CancelledBy is the user that cancelled the task
+	CancelledBy string `json:"cancelled_by,omitempty"`
+	// CancelTime is the time when the task has been cancelled
+	CancelTime *time.Time `json:"cancel_time,omitempty"`
+
 	StartTime *time.Time `json:"start_time,omitempty"`
 	EndTime   *time.Time `json:"end_time,omitempty"`
 }
@@ -270,9 +399,126 @@ func (rt *RunTask) ArchivesFetchFinished() bool {
 	return true
 }
 
+type PreviewURLAction string
+
+const (
+	PreviewURLActionSet    PreviewURLAction = "set"
+	PreviewURLActionRemove PreviewURLAction = "remove"
+)
+
+// PreviewURL is the url of a preview environment (i.e. a deployment of a pull
+// request) registered by a task using the toolbox previewurl command. When the
+// environment is destroyed the task should register a remove action.
+type PreviewURL struct {
+	Action PreviewURLAction `json:"action,omitempty"`
+	URL    string           `json:"url,omitempty"`
+}
+
+type TaskFailureType string
+
+const (
+	TaskFailureTypeOOMKilled       TaskFailureType = "oomkilled"
+	TaskFailureTypeEvicted         TaskFailureType = "evicted"
+	TaskFailureTypeApprovalTimeout TaskFailureType = "approval_timeout"
+	TaskFailureTypeDispatchTimeout TaskFailureType = "dispatch_timeout"
+	TaskFailureTypeOrphaned        TaskFailureType = "orphaned"
+	TaskFailureTypeTimeout         TaskFailureType = "timeout"
+)
+
+// TaskFailureReason is a structured task failure reason reported by the
+// executor when a step has been killed by the oom killer or the task pod has
+// been evicted, or set by the runservice when a task approval timed out
+type TaskFailureReason struct {
+	Type TaskFailureType `json:"type,omitempty"`
+	// Step is the index of the step being executed
+	Step    int    `json:"step"`
+	Message string `json:"message,omitempty"`
+
+	// MemoryLimit is the container memory limit in bytes, 0 if unlimited
+	MemoryLimit int64 `json:"memory_limit,omitempty"`
+	// MemoryPeakUsage is the container max memory usage in bytes, 0 if unknown
+	MemoryPeakUsage int64 `json:"memory_peak_usage,omitempty"`
+	// SuggestedMemoryLimit is the suggested memory limit in bytes
+	SuggestedMemoryLimit int64 `json:"suggested_memory_limit,omitempty"`
+}
+
+// TaskFlakiness reports the results of a task in the last finished runs of a
+// group. A task is considered flaky when it succeeded only after being retried
+// or when its result keeps changing between consecutive runs.
+type TaskFlakiness struct {
+	TaskName string `json:"task_name,omitempty"`
+
+	// Runs is the number of runs where the task has been executed
+	Runs int `json:"runs"`
+	// Failures is the number of runs where the task failed
+	Failures int `json:"failures"`
+	// FlakyRuns is the number of runs where the task succeeded after being
+	// retried
+	FlakyRuns int `json:"flaky_runs"`
+	// Flips is the number of times the task result changed between
+	// consecutive runs
+	Flips int `json:"flips"`
+
+	LastFlakyRunID string `json:"last_flaky_run_id,omitempty"`
+}
+
+// RunTaskExecAudit is the audit record of an exec session opened inside a
+// running task
+type RunTaskExecAudit struct {
+	ID     string   `json:"id,omitempty"`
+	RunID  string   `json:"run_id,omitempty"`
+	TaskID string   `json:"task_id,omitempty"`
+	UserID string   `json:"user_id,omitempty"`
+	Cmd    []string `json:"cmd,omitempty"`
+	Tty    bool     `json:"tty,omitempty"`
+
+	Time time.Time `json:"time,omitempty"`
+}
+
+// Flaky reports if the task showed a flaky behavior
+func (tf *TaskFlakiness) Flaky() bool {
+	return tf.FlakyRuns > 0 || tf.Flips > 1
+}
+
+// RunsStats reports aggregated statistics of the runs of a group finished in a
+// time window
+type RunsStats struct {
+	// Runs is the number of finished runs
+	Runs int `json:"runs"`
+	// Successes is the number of successful runs
+	Successes int `json:"successes"`
+	// Failures is the number of failed runs
+	Failures int `json:"failures"`
+	// SuccessRate is the ratio of successful runs (0 when there're no runs)
+	SuccessRate float64 `json:"success_rate"`
+
+	// MedianDuration is the median duration of the runs from their start to
+	// their end
+	MedianDuration time.Duration `json:"median_duration"`
+	// MedianQueueWait is the median time the runs waited in the queue before
+	// starting
+	MedianQueueWait time.Duration `json:"median_queue_wait"`
+
+	// FailureHotspots are the tasks that failed most, ordered by number of
+	// failures
+	FailureHotspots []*TaskFailureHotspot `json:"failure_hotspots"`
+}
+
+type TaskFailureHotspot struct {
+	TaskName string `json:"task_name"`
+	// Runs is the number of runs where the task has been executed
+	Runs int `json:"runs"`
+	// Failures is the number of runs where the task failed
+	Failures int `json:"failures"`
+}
+
 type RunTaskStep struct {
 	Phase ExecutorTaskPhase `json:"phase,omitempty"`
 
+	// Attempts is the number of step executions. The logs of every attempt are
+	// kept
+	Attempts int `json:"attempts,omitempty"`
+
 	// one logphase for every task step
 	LogPhase RunTaskFetchPhase `json:"log_phase,omitempty"`
 
@@ -304,6 +550,10 @@ type RunConfig struct {
 	// easily return them without loading RunConfig from the lts
 	Annotations map[string]string `json:"annotations,omitempty"`
 
+	// Labels contain the run labels. Like Annotations they're saved in both
+	// the Run and the RunConfig
+	Labels map[string]string `json:"labels,omitempty"`
+
 	// StaticEnvironment contains all environment variables that won't change when
 	// generating a new run (like COMMIT_SHA, BRANCH, REPOSITORY_URL etc...)
 	StaticEnvironment map[string]string `json:"static_environment,omitempty"`
@@ -315,6 +565,13 @@ type RunConfig struct {
 
 	Tasks map[string]*RunConfigTask `json:"tasks,omitempty"`
 
+	// ConfigData is the config (the concatenated config files) used to
+	// generate the run config tasks, kept to show what was executed even after
+	// the repository config changed
+	ConfigData string `json:"config_data,omitempty"`
+	// ConfigFormat is the config file extension (yml, json or jsonnet)
+	ConfigFormat string `json:"config_format,omitempty"`
+
 	// CacheGroup is the cache group where the run caches belongs
 	CacheGroup string `json:"cache_group,omitempty"`
 }
@@ -338,10 +595,30 @@ type RunConfigTask struct {
 	Shell                string                          `json:"shell,omitempty"`
 	User                 string                          `json:"user,omitempty"`
 	Steps                Steps                           `json:"steps,omitempty"`
+	Retries              *Retries                        `json:"retries,omitempty"`
 	IgnoreFailure        bool                            `json:"ignore_failure,omitempty"`
 	NeedsApproval        bool                            `json:"needs_approval,omitempty"`
+	ApprovalTimeout      *ApprovalTimeout                `json:"approval_timeout,omitempty"`
 	Skip                 bool                            `json:"skip,omitempty"`
+	Stage                string                          `json:"stage,omitempty"`
+	Idempotent           bool                            `json:"idempotent,omitempty"`
+	Outputs              []string                        `json:"outputs,omitempty"`
 	DockerRegistriesAuth map[string]DockerRegistryAuth   `json:"docker_registries_auth"`
+	// Timeout is the max task execution duration, zero means no timeout
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// ExprVariables are the variables of the steps when expressions. They're
+	// defined only when a step has a when expression.
+	ExprVariables map[string]string `json:"expr_variables,omitempty"`
+	// SecretFiles are created in the task main container
+	SecretFiles []*SecretFile `json:"secret_files,omitempty"`
+}
+
+// SecretFile is a file with a secret content created in the task main
+// container
+type SecretFile struct {
+	Path    string      `json:"path,omitempty"`
+	Mode    os.FileMode `json:"mode,omitempty"`
+	Content string      `json:"content,omitempty"`
 }
 
 func (rct *RunConfigTask) DeepCopy() *RunConfigTask {
@@ -352,6 +629,22 @@ func (rct *RunConfigTask) DeepCopy() *RunConfigTask {
 	return nrct.(*RunConfigTask)
 }
 
+type ApprovalTimeoutAction string
+
+const (
+	ApprovalTimeoutActionReject  ApprovalTimeoutAction = "reject"
+	ApprovalTimeoutActionApprove ApprovalTimeoutAction = "approve"
+)
+
+// ApprovalTimeout defines the Action executed when a task waiting approval
+// isn't approved before Timeout. When NotifyBefore is set the approvers are
+// notified NotifyBefore the timeout expiry.
+type ApprovalTimeout struct {
+	Timeout      time.Duration         `json:"timeout,omitempty"`
+	Action       ApprovalTimeoutAction `json:"action,omitempty"`
+	NotifyBefore time.Duration         `json:"notify_before,omitempty"`
+}
+
 type RunConfigTaskDependCondition string
 
 const (
@@ -392,9 +685,12 @@ type DockerRegistryAuth struct {
 }
 
 type Runtime struct {
-	Type       RuntimeType  `json:"type,omitempty"`
-	Arch       common.Arch  `json:"arch,omitempty"`
-	Containers []*Container `json:"containers,omitempty"`
+	Type        RuntimeType  `json:"type,omitempty"`
+	Arch        common.Arch  `json:"arch,omitempty"`
+	Containers  []*Container `json:"containers,omitempty"`
+	ExtraHosts  []string     `json:"extra_hosts,omitempty"`
+	DNS         []string     `json:"dns,omitempty"`
+	HostNetwork bool         `json:"host_network,omitempty"`
 }
 
 type Step interface{}
@@ -404,15 +700,75 @@ type Steps []Step
 type BaseStep struct {
 	Type string `json:"type,omitempty"`
 	Name string `json:"name,omitempty"`
+	// When is the step when expression evaluated by the executor before
+	// executing the step
+	When string `json:"when,omitempty"`
 }
 
+// Base returns the base step. It's used to access the common fields of the
+// steps.
+func (s *BaseStep) Base() *BaseStep { return s }
+
 type RunStep struct {
 	BaseStep
 	Command     string            `json:"command,omitempty"`
 	Environment map[string]string `json:"environment,omitempty"`
 	WorkingDir  string            `json:"working_dir,omitempty"`
 	Shell       string            `json:"shell,omitempty"`
-	User        string            `json:"user,omitempty"`
+	// ShellOptions toggles the shell options before executing the command
+	ShellOptions *ShellOptions `json:"shell_options,omitempty"`
+	User         string        `json:"user,omitempty"`
+	Retries      *Retries      `json:"retries,omitempty"`
+}
+
+// ShellOptions are the run step shell options. Nil options keep the shell
+// default.
+type ShellOptions struct {
+	Errexit  *bool `json:"errexit,omitempty"`
+	Pipefail *bool `json:"pipefail,omitempty"`
+}
+
+type RetryCondition string
+
+const (
+	// RetryConditionFailure retries when a step exits with a non zero exit code
+	RetryConditionFailure RetryCondition = "failure"
+	// RetryConditionError retries when the task setup or a step couldn't be
+	// executed (i.e. pod or executor errors)
+	RetryConditionError RetryCondition = "error"
+)
+
+// Retries defines how many times a failed task or step will be retried
+type Retries struct {
+	Count int           `json:"count,omitempty"`
+	Delay time.Duration `json:"delay,omitempty"`
+	// On are the failure conditions that will be retried. If empty every
+	// condition will be retried
+	On []RetryCondition `json:"on,omitempty"`
+}
+
+// ShouldRetry reports if the attempt (starting from 0) failed with the
+// provided condition should be retried
+func (r *Retries) ShouldRetry(attempt int, cond RetryCondition) bool {
+	if r == nil || attempt >= r.Count {
+		return false
+	}
+	if len(r.On) == 0 {
+		return true
+	}
+	for _, c := range r.On {
+		if c == cond {
+			return true
+		}
+	}
+	return false
+}
+
+// ParallelStep is a group of run steps executed concurrently. The group fails
+// if any of its steps fails.
+type ParallelStep struct {
+	BaseStep
+	Steps []*RunStep `json:"steps,omitempty"`
 }
 
 type SaveContent struct {
@@ -443,6 +799,141 @@ type RestoreCacheStep struct {
 	DestDir string   `json:"dest_dir,omitempty"`
 }
 
+type TestReportFormat string
+
+const (
+	// TestReportFormatJUnit is the JUnit xml format
+	TestReportFormatJUnit TestReportFormat = "junit"
+	// TestReportFormatGoTest is the go test json format (go test -json)
+	TestReportFormatGoTest TestReportFormat = "gotest"
+)
+
+// SaveTestReportStep uploads the test report files matching Paths (relative
+// to the working dir) to the runservice that will parse and save them
+type SaveTestReportStep struct {
+	BaseStep
+	Format TestReportFormat `json:"format,omitempty"`
+	Paths  []string         `json:"paths,omitempty"`
+}
+
+type TestCaseStatus string
+
+const (
+	TestCaseStatusPassed  TestCaseStatus = "passed"
+	TestCaseStatusFailed  TestCaseStatus = "failed"
+	TestCaseStatusSkipped TestCaseStatus = "skipped"
+)
+
+type TestCase struct {
+	// Suite is the test suite (the junit test suite or class name, the go
+	// package)
+	Suite    string         `json:"suite,omitempty"`
+	Name     string         `json:"name,omitempty"`
+	Status   TestCaseStatus `json:"status,omitempty"`
+	Duration time.Duration  `json:"duration,omitempty"`
+	// Message is the failure message (truncated)
+	Message string `json:"message,omitempty"`
+}
+
+type TestReportSummary struct {
+	Total    int           `json:"total"`
+	Passed   int           `json:"passed"`
+	Failed   int           `json:"failed"`
+	Skipped  int           `json:"skipped"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Add adds the test case to the summary
+func (s *TestReportSummary) Add(tc *TestCase) {
+	s.Total++
+	switch tc.Status {
+	case TestCaseStatusPassed:
+		s.Passed++
+	case TestCaseStatusFailed:
+		s.Failed++
+	case TestCaseStatusSkipped:
+		s.Skipped++
+	}
+	s.Duration += tc.Duration
+}
+
+// TestReport contains the test cases parsed from the test report files saved
+// by a save test report step
+type TestReport struct {
+	Format  TestReportFormat  `json:"format,omitempty"`
+	Summary TestReportSummary `json:"summary"`
+	Tests   []*TestCase       `json:"tests,omitempty"`
+}
+
+// TestCaseHistoryEntry is the result of a test case in a run task
+type TestCaseHistoryEntry struct {
+	RunID      string     `json:"run_id,omitempty"`
+	RunCounter uint64     `json:"run_counter,omitempty"`
+	TaskID     string     `json:"task_id,omitempty"`
+	TaskName   string     `json:"task_name,omitempty"`
+	EndTime    *time.Time `json:"end_time,omitempty"`
+	TestCase   *TestCase  `json:"test_case,omitempty"`
+}
+
+type CoverageReportFormat string
+
+const (
+	// CoverageReportFormatLcov is the lcov tracefile format
+	CoverageReportFormatLcov CoverageReportFormat = "lcov"
+	// CoverageReportFormatCobertura is the cobertura xml format
+	CoverageReportFormatCobertura CoverageReportFormat = "cobertura"
+	// CoverageReportFormatGoCover is the go cover profile format (go test
+	// -coverprofile)
+	CoverageReportFormatGoCover CoverageReportFormat = "gocover"
+)
+
+// SaveCoverageReportStep uploads the coverage report files matching Paths
+// (relative to the working dir) to the runservice that will parse and save
+// them
+type SaveCoverageReportStep struct {
+	BaseStep
+	Format CoverageReportFormat `json:"format,omitempty"`
+	Paths  []string             `json:"paths,omitempty"`
+}
+
+// ExportEnvStep reads the dotenv file at Path (relative to the working dir)
+// and exports its variables to all the downstream tasks of the run
+type ExportEnvStep struct {
+	BaseStep
+	Path string `json:"path,omitempty"`
+}
+
+// CoverageReport is the total coverage parsed from the coverage report files
+// saved by a save coverage report step. For the go cover format the lines are
+// the statements.
+type CoverageReport struct {
+	Format       CoverageReportFormat `json:"format,omitempty"`
+	LinesTotal   int                  `json:"lines_total"`
+	LinesCovered int                  `json:"lines_covered"`
+}
+
+// Add adds the lines of another coverage report
+func (c *CoverageReport) Add(o *CoverageReport) {
+	c.LinesTotal += o.LinesTotal
+	c.LinesCovered += o.LinesCovered
+}
+
+// Percent returns the percentage of covered lines
+func (c *CoverageReport) Percent() float64 {
+	if c.LinesTotal == 0 {
+		return 0
+	}
+	return float64(c.LinesCovered) * 100 / float64(c.LinesTotal)
+}
+
+// CoverageHistoryEntry is the total coverage of a finished run
+type CoverageHistoryEntry struct {
+	RunID      string          `json:"run_id,omitempty"`
+	RunCounter uint64          `json:"run_counter,omitempty"`
+	EndTime    *time.Time      `json:"end_time,omitempty"`
+	Coverage   *CoverageReport `json:"coverage,omitempty"`
+}
+
 type ExecutorTaskPhase string
 
 const (
@@ -452,10 +943,13 @@ const (
 	ExecutorTaskPhaseStopped    ExecutorTaskPhase = "stopped"
 	ExecutorTaskPhaseSuccess    ExecutorTaskPhase = "success"
 	ExecutorTaskPhaseFailed     ExecutorTaskPhase = "failed"
+	// ExecutorTaskPhaseSkipped is used only by the steps not executed since
+	// their when expression doesn't match
+	ExecutorTaskPhaseSkipped ExecutorTaskPhase = "skipped"
 )
 
 func (s ExecutorTaskPhase) IsFinished() bool {
-	return s == ExecutorTaskPhaseCancelled || s == ExecutorTaskPhaseStopped || s == ExecutorTaskPhaseSuccess || s == ExecutorTaskPhaseFailed
+	return s == ExecutorTaskPhaseCancelled || s == ExecutorTaskPhaseStopped || s == ExecutorTaskPhaseSuccess || s == ExecutorTaskPhaseFailed || s == ExecutorTaskPhaseSkipped
 }
 
 type ExecutorTask struct {
@@ -471,10 +965,32 @@ type ExecutorTask struct {
 	User        string            `json:"user,omitempty"`
 	Privileged  bool              `json:"privileged"`
 
+	// ExtraHosts are additional hosts file entries in the "hostname:ip" format
+	ExtraHosts  []string `json:"extra_hosts,omitempty"`
+	DNS         []string `json:"dns,omitempty"`
+	HostNetwork bool     `json:"host_network,omitempty"`
+
 	DockerRegistriesAuth map[string]DockerRegistryAuth `json:"docker_registries_auth"`
 
 	Steps Steps `json:"steps,omitempty"`
 
+	Retries *Retries `json:"retries,omitempty"`
+
+	// Outputs are the keys of the outputs declared by the task
+	Outputs []string `json:"outputs,omitempty"`
+
+	// ExprVariables are the variables of the steps when expressions
+	ExprVariables map[string]string `json:"expr_variables,omitempty"`
+
+	SecretFiles []*SecretFile `json:"secret_files,omitempty"`
+
+	// Timeout is the max task execution duration, the runservice stops the
+	// tasks running for more
+	Timeout time.Duration `json:"timeout,omitempty"`
+
+	// SubmitTime is the time when the task has been submitted to the executor
+	SubmitTime *time.Time `json:"submit_time,omitempty"`
+
 	Status     ExecutorTaskStatus `json:"status,omitempty"`
 	SetupError string             `fail_reason:"setup_error,omitempty"`
 	FailError  string             `fail_reason:"fail_error,omitempty"`
@@ -485,6 +1001,9 @@ type ExecutorTask struct {
 	// groups (projects)
 	CachePrefix string `json:"cache_prefix,omitempty"`
 
+	// StoragePartition is the object storage partition of the run
+	StoragePartition string `json:"storage_partition,omitempty"`
+
 	// Stop is used to signal from the scheduler when the task must be stopped
 	Stop bool `json:"stop,omitempty"`
 }
@@ -496,13 +1015,88 @@ type ExecutorTaskStatus struct {
 	SetupStep ExecutorTaskStepStatus    `json:"setup_step,omitempty"`
 	Steps     []*ExecutorTaskStepStatus `json:"steps,omitempty"`
 
+	// Attempts is the number of task executions
+	Attempts int `json:"attempts,omitempty"`
+
+	PreviewURL *PreviewURL `json:"preview_url,omitempty"`
+
+	ExportedEnvironment map[string]string `json:"exported_environment,omitempty"`
+
+	Outputs map[string]string `json:"outputs,omitempty"`
+
+	FailureReason *TaskFailureReason `json:"failure_reason,omitempty"`
+
 	StartTime *time.Time `json:"start_time,omitempty"`
 	EndTime   *time.Time `json:"end_time,omitempty"`
+
+	// HeartbeatTime is the last time the executor reported the task as
+	// running
+	HeartbeatTime *time.Time `json:"heartbeat_time,omitempty"`
+
+	// LeaseToken is the token of the lease held by the executor executing the
+	// task. Status updates with a stale token are rejected.
+	LeaseToken int64 `json:"lease_token,omitempty"`
+}
+
+// ExecutorTaskLease is the lease an executor must hold to execute a task.
+// Only one executor at a time can hold a not expired lease. Token is a fencing
+// token increased at every lease acquisition so the updates of an executor that
+// lost its lease (i.e. after a network partition) can be detected and rejected.
+type ExecutorTaskLease struct {
+	Revision int64 `json:"-"`
+
+	TaskID     string        `json:"task_id,omitempty"`
+	ExecutorID string        `json:"executor_id,omitempty"`
+	Token      int64         `json:"token,omitempty"`
+	Duration   time.Duration `json:"duration,omitempty"`
+	ExpireTime time.Time     `json:"expire_time,omitempty"`
+}
+
+func (l *ExecutorTaskLease) IsExpired(now time.Time) bool {
+	return !now.Before(l.ExpireTime)
+}
+
+// Maintenance is the instance maintenance mode status. When enabled the runs
+// aren't scheduled and the received webhooks are queued to be replayed when
+// the maintenance mode is disabled.
+type Maintenance struct {
+	Revision int64 `json:"-"`
+
+	Enabled    bool       `json:"enabled,omitempty"`
+	EnableTime *time.Time `json:"enable_time,omitempty"`
+}
+
+// QueuedWebhook is a webhook received during the maintenance mode
+type QueuedWebhook struct {
+	ID string `json:"id,omitempty"`
+
+	ProjectID string              `json:"project_id,omitempty"`
+	Header    map[string][]string `json:"header,omitempty"`
+	Body      []byte              `json:"body,omitempty"`
+
+	QueueTime time.Time `json:"queue_time,omitempty"`
+}
+
+// FailedWebhook is a webhook whose handling failed. It's kept to be replayed
+// after fixing the cause of the failure.
+type FailedWebhook struct {
+	ID string `json:"id,omitempty"`
+
+	ProjectID string              `json:"project_id,omitempty"`
+	Header    map[string][]string `json:"header,omitempty"`
+	Body      []byte              `json:"body,omitempty"`
+
+	FailureTime time.Time `json:"failure_time,omitempty"`
+	Error       string    `json:"error,omitempty"`
 }
 
 type ExecutorTaskStepStatus struct {
 	Phase ExecutorTaskPhase `json:"phase,omitempty"`
 
+	// Attempts is the number of step executions, also in previous task
+	// attempts
+	Attempts int `json:"attempts,omitempty"`
+
 	StartTime *time.Time `json:"start_time,omitempty"`
 	EndTime   *time.Time `json:"end_time,omitempty"`
 
@@ -515,6 +1109,7 @@ type Container struct {
 	User        string            `json:"user,omitempty"`
 	Privileged  bool              `json:"privileged"`
 	Entrypoint  string            `json:"entrypoint"`
+	Args        []string          `json:"args,omitempty"`
 }
 
 type WorkspaceOperation struct {
@@ -568,6 +1163,30 @@ func (et *Steps) UnmarshalJSON(b []byte) error {
 				return err
 			}
 			steps[i] = &s
+		case "parallel":
+			var s ParallelStep
+			if err := json.Unmarshal(step, &s); err != nil {
+				return err
+			}
+			steps[i] = &s
+		case "save_test_report":
+			var s SaveTestReportStep
+			if err := json.Unmarshal(step, &s); err != nil {
+				return err
+			}
+			steps[i] = &s
+		case "save_coverage_report":
+			var s SaveCoverageReportStep
+			if err := json.Unmarshal(step, &s); err != nil {
+				return err
+			}
+			steps[i] = &s
+		case "export_env":
+			var s ExportEnvStep
+			if err := json.Unmarshal(step, &s); err != nil {
+				return err
+			}
+			steps[i] = &s
 		}
 	}
 
@@ -618,6 +1237,20 @@ type Executor struct {
 
 	AllowPrivilegedContainers bool `json:"allow_privileged_containers,omitempty"`
 
+	// ArchiveFormats are the workspace archive formats supported by the
+	// executor when transferring archives. Executors not reporting them only
+	// support ArchiveFormatTar.
+	ArchiveFormats []ArchiveFormat `json:"archive_formats,omitempty"`
+
+	// ResumableFetch reports that the executor supports resuming the logs and
+	// archives transfers from an offset and compressing the logs
+	ResumableFetch bool `json:"resumable_fetch,omitempty"`
+
+	// ToolboxProtocolVersion is the protocol version of the toolbox injected
+	// by the executor. Executors not reporting it use the first protocol
+	// version.
+	ToolboxProtocolVersion int `json:"toolbox_protocol_version,omitempty"`
+
 	ActiveTasksLimit int `json:"active_tasks_limit,omitempty"`
 	ActiveTasks      int `json:"active_tasks,omitempty"`
 
@@ -634,10 +1267,52 @@ type Executor struct {
 
 	LastStatusUpdateTime time.Time `json:"last_status_update_time,omitempty"`
 
+	// WaitingApproval reports that the executor has been registered using the
+	// bootstrap token and must be approved by an admin before receiving tasks
+	WaitingApproval bool `json:"waiting_approval,omitempty"`
+	// TokenHash is the sha256 hash of the executor token provided at
+	// registration
+	TokenHash string `json:"token_hash,omitempty"`
+
+	HostFacts *ExecutorHostFacts `json:"host_facts,omitempty"`
+	// RemoteAddress is the address of the last executor status request as seen
+	// by the runservice
+	RemoteAddress string `json:"remote_address,omitempty"`
+
 	// internal values not saved
 	Revision int64 `json:"-"`
 }
 
+type ArchiveFormat string
+
+const (
+	// ArchiveFormatTar is a plain tar archive
+	ArchiveFormatTar ArchiveFormat = "tar"
+	// ArchiveFormatTarZstd is a zstd compressed tar archive
+	ArchiveFormatTarZstd ArchiveFormat = "tar+zstd"
+)
+
+func (e *Executor) SupportsArchiveFormat(format ArchiveFormat) bool {
+	if format == ArchiveFormatTar {
+		return true
+	}
+	for _, f := range e.ArchiveFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// ExecutorHostFacts are informations about the executor host reported by the
+// executor to help admins approving it
+type ExecutorHostFacts struct {
+	Hostname    string   `json:"hostname,omitempty"`
+	OS          string   `json:"os,omitempty"`
+	NumCPU      int      `json:"num_cpu,omitempty"`
+	IPAddresses []string `json:"ip_addresses,omitempty"`
+}
+
 func (e *Executor) DeepCopy() *Executor {
 	ne, err := copystructure.Copy(e)
 	if err != nil {
@@ -651,4 +1326,7 @@ type RunEvent struct {
 	RunID    string
 	Phase    RunPhase
 	Result   RunResult
+
+	// PreviewURLTasks are the ids of the tasks whose preview url changed
+	PreviewURLTasks []string
 }
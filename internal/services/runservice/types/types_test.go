@@ -0,0 +1,56 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import "testing"
+
+func TestTaskFlakinessFlaky(t *testing.T) {
+	tests := []struct {
+		name string
+		tf   *TaskFlakiness
+		out  bool
+	}{
+		{
+			name: "always successful",
+			tf:   &TaskFlakiness{Runs: 10},
+		},
+		{
+			name: "always failing",
+			tf:   &TaskFlakiness{Runs: 10, Failures: 10},
+		},
+		{
+			name: "started failing",
+			tf:   &TaskFlakiness{Runs: 10, Failures: 5, Flips: 1},
+		},
+		{
+			name: "failed and fixed",
+			tf:   &TaskFlakiness{Runs: 10, Failures: 5, Flips: 2},
+			out:  true,
+		},
+		{
+			name: "succeeded after a retry",
+			tf:   &TaskFlakiness{Runs: 10, FlakyRuns: 1},
+			out:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if out := tt.tf.Flaky(); out != tt.out {
+				t.Fatalf("expected flaky %t, got %t", tt.out, out)
+			}
+		})
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"agola.io/agola/internal/services/common"
 	"agola.io/agola/internal/services/config"
 	rsapi "agola.io/agola/internal/services/runservice/api"
+	rstypes "agola.io/agola/internal/services/runservice/types"
 	"agola.io/agola/internal/util"
 
 	"go.uber.org/zap"
@@ -75,17 +76,67 @@ func (s *Scheduler) schedule(ctx context.Context) error {
 	return nil
 }
 
-func (s *Scheduler) scheduleRun(ctx context.Context, groupID string) error {
+// chooseQueuedRun returns the queued run to start. It's the first queued run
+// of the group unless there's a run restarted from failed tasks enqueued less
+// than priorityDuration ago.
+func (s *Scheduler) chooseQueuedRun(ctx context.Context, groupID string) (*rstypes.Run, error) {
 	// get first queued run
 	queuedRunsResponse, _, err := s.runserviceClient.GetGroupFirstQueuedRuns(ctx, groupID, nil)
 	if err != nil {
-		return errors.Errorf("failed to get the first project queued run: %w", err)
+		return nil, errors.Errorf("failed to get the first project queued run: %w", err)
 	}
 	if len(queuedRunsResponse.Runs) == 0 {
-		return nil
+		return nil, nil
 	}
+	firstRun := queuedRunsResponse.Runs[0]
 
-	run := queuedRunsResponse.Runs[0]
+	priorityDuration := s.c.RestartedRunsPriorityDuration
+	if priorityDuration == 0 {
+		return firstRun, nil
+	}
+
+	var lastRunID string
+	for {
+		queuedRunsResponse, _, err := s.runserviceClient.GetRuns(ctx, []string{"queued"}, nil, []string{groupID}, nil, nil, false, false, nil, lastRunID, 0, true)
+		if err != nil {
+			return nil, errors.Errorf("failed to get queued runs: %w", err)
+		}
+		if len(queuedRunsResponse.Runs) == 0 {
+			break
+		}
+
+		if run := priorityRun(queuedRunsResponse.Runs, priorityDuration, time.Now()); run != nil {
+			return run, nil
+		}
+
+		lastRunID = queuedRunsResponse.Runs[len(queuedRunsResponse.Runs)-1].ID
+	}
+
+	return firstRun, nil
+}
+
+// priorityRun returns the first run restarted from failed tasks that was
+// enqueued less than priorityDuration ago
+func priorityRun(runs []*rstypes.Run, priorityDuration time.Duration, now time.Time) *rstypes.Run {
+	for _, run := range runs {
+		if !run.RestartedFromFailedTasks || run.EnqueueTime == nil {
+			continue
+		}
+		if run.EnqueueTime.Add(priorityDuration).After(now) {
+			return run
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) scheduleRun(ctx context.Context, groupID string) error {
+	run, err := s.chooseQueuedRun(ctx, groupID)
+	if err != nil {
+		return err
+	}
+	if run == nil {
+		return nil
+	}
 
 	changegroup := util.EncodeSha256Hex(fmt.Sprintf("changegroup-%s", groupID))
 	runningRunsResponse, _, err := s.runserviceClient.GetGroupRunningRuns(ctx, groupID, 1, []string{changegroup})
@@ -93,7 +144,11 @@ func (s *Scheduler) scheduleRun(ctx context.Context, groupID string) error {
 		return errors.Errorf("failed to get running runs: %w", err)
 	}
 	if len(runningRunsResponse.Runs) == 0 {
-		log.Infof("starting run %s", run.ID)
+		if run.RestartedFromFailedTasks {
+			log.Infof("starting run %s restarted from failed tasks", run.ID)
+		} else {
+			log.Infof("starting run %s", run.ID)
+		}
 		log.Debugf("changegroups: %s", runningRunsResponse.ChangeGroupsUpdateToken)
 		if _, err := s.runserviceClient.StartRun(ctx, run.ID, runningRunsResponse.ChangeGroupsUpdateToken); err != nil {
 			log.Errorf("failed to start run %s: %v", run.ID, err)
@@ -189,9 +244,12 @@ func NewScheduler(c *config.Scheduler) (*Scheduler, error) {
 		level.SetLevel(zapcore.DebugLevel)
 	}
 
+	runserviceClient := rsapi.NewClient(c.RunserviceURL)
+	runserviceClient.SetInternalAPIToken(c.RunserviceAPIToken)
+
 	return &Scheduler{
 		c:                c,
-		runserviceClient: rsapi.NewClient(c.RunserviceURL),
+		runserviceClient: runserviceClient,
 	}, nil
 }
 
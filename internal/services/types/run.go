@@ -32,6 +32,8 @@ const (
 type RunCreationTriggerType string
 
 const (
-	RunCreationTriggerTypeWebhook RunCreationTriggerType = "webhook"
-	RunCreationTriggerTypeManual  RunCreationTriggerType = "manual"
+	RunCreationTriggerTypeWebhook  RunCreationTriggerType = "webhook"
+	RunCreationTriggerTypeManual   RunCreationTriggerType = "manual"
+	RunCreationTriggerTypePolling  RunCreationTriggerType = "polling"
+	RunCreationTriggerTypeSchedule RunCreationTriggerType = "schedule"
 )
@@ -28,14 +28,18 @@ import (
 type ConfigType string
 
 const (
-	ConfigTypeUser         ConfigType = "user"
-	ConfigTypeOrg          ConfigType = "org"
-	ConfigTypeOrgMember    ConfigType = "orgmember"
-	ConfigTypeProjectGroup ConfigType = "projectgroup"
-	ConfigTypeProject      ConfigType = "project"
-	ConfigTypeRemoteSource ConfigType = "remotesource"
-	ConfigTypeSecret       ConfigType = "secret"
-	ConfigTypeVariable     ConfigType = "variable"
+	ConfigTypeUser             ConfigType = "user"
+	ConfigTypeOrg              ConfigType = "org"
+	ConfigTypeOrgMember        ConfigType = "orgmember"
+	ConfigTypeProjectGroup     ConfigType = "projectgroup"
+	ConfigTypeProject          ConfigType = "project"
+	ConfigTypeRemoteSource     ConfigType = "remotesource"
+	ConfigTypeSecret           ConfigType = "secret"
+	ConfigTypeVariable         ConfigType = "variable"
+	ConfigTypeProjectChange    ConfigType = "projectchange"
+	ConfigTypeUserNotification ConfigType = "usernotification"
+	ConfigTypeTrashItem        ConfigType = "trashitem"
+	ConfigTypePathAlias        ConfigType = "pathalias"
 )
 
 type Visibility string
@@ -60,12 +64,41 @@ type MemberRole string
 const (
 	MemberRoleOwner  MemberRole = "owner"
 	MemberRoleMember MemberRole = "member"
+	// MemberRoleReporter can see the private projects runs but not their
+	// steps logs
+	MemberRoleReporter MemberRole = "reporter"
 )
 
 func IsValidMemberRole(r MemberRole) bool {
 	switch r {
 	case MemberRoleOwner:
 	case MemberRoleMember:
+	case MemberRoleReporter:
+	default:
+		return false
+	}
+	return true
+}
+
+// NotificationMode defines which finished runs are notified
+type NotificationMode string
+
+const (
+	// NotificationModeFailures notifies all the failed runs
+	NotificationModeFailures NotificationMode = "failures"
+	// NotificationModeFirstFailure notifies a failed run only when the
+	// previous run with the same name on the same branch, tag or pull request
+	// didn't fail
+	NotificationModeFirstFailure NotificationMode = "first_failure"
+	// NotificationModeAll notifies all the finished runs
+	NotificationModeAll NotificationMode = "all"
+)
+
+func IsValidNotificationMode(m NotificationMode) bool {
+	switch m {
+	case NotificationModeFailures:
+	case NotificationModeFirstFailure:
+	case NotificationModeAll:
 	default:
 		return false
 	}
@@ -97,8 +130,188 @@ type User struct {
 
 	Tokens map[string]string `json:"tokens,omitempty"`
 
+	// TokensInfo contains the tokens metadata (scopes, expiration) keyed by
+	// token name. Tokens without metadata have all the scopes and never expire
+	TokensInfo map[string]*UserTokenInfo `json:"tokens_info,omitempty"`
+
+	// Sessions are the user login sessions keyed by session id
+	Sessions map[string]*UserSession `json:"sessions,omitempty"`
+
 	// Admin defines if the user is a global admin
 	Admin bool `json:"admin,omitempty"`
+
+	// TOTP is the user two factor authentication
+	TOTP *UserTOTP `json:"totp,omitempty"`
+
+	// EmailNotifications are the user runs email notifications settings
+	EmailNotifications *UserEmailNotifications `json:"email_notifications,omitempty"`
+
+	// WatchedProjects are the ids of the projects watched by the user. The user
+	// inbox will receive a notification for every failed run of these projects
+	WatchedProjects []string `json:"watched_projects,omitempty"`
+}
+
+// IsWatchingProject reports if the user is watching the provided project
+func (u *User) IsWatchingProject(projectID string) bool {
+	for _, id := range u.WatchedProjects {
+		if id == projectID {
+			return true
+		}
+	}
+	return false
+}
+
+type UserNotificationType string
+
+const (
+	UserNotificationTypeRunFailed       UserNotificationType = "run_failed"
+	UserNotificationTypeApprovalPending UserNotificationType = "approval_pending"
+	UserNotificationTypeOrgInvitation   UserNotificationType = "org_invitation"
+)
+
+func IsValidUserNotificationType(t UserNotificationType) bool {
+	switch t {
+	case UserNotificationTypeRunFailed:
+	case UserNotificationTypeApprovalPending:
+	case UserNotificationTypeOrgInvitation:
+	default:
+		return false
+	}
+	return true
+}
+
+// UserNotification is a notification in the user inbox
+type UserNotification struct {
+	// The type version. Increase when a breaking change is done. Usually not
+	// needed when adding fields.
+	Version string `json:"version,omitempty"`
+
+	ID string `json:"id,omitempty"`
+
+	UserID string `json:"user_id,omitempty"`
+
+	Type UserNotificationType `json:"type,omitempty"`
+
+	CreationTime time.Time `json:"creation_time,omitempty"`
+
+	Read bool `json:"read,omitempty"`
+
+	// Title and Message are the human readable notification content
+	Title   string `json:"title,omitempty"`
+	Message string `json:"message,omitempty"`
+
+	// URL is the optional web ui url related to the notification
+	URL string `json:"url,omitempty"`
+
+	// The optional objects related to the notification
+	ProjectID string `json:"project_id,omitempty"`
+	OrgID     string `json:"org_id,omitempty"`
+	RunID     string `json:"run_id,omitempty"`
+	TaskID    string `json:"task_id,omitempty"`
+}
+
+// UserEmailNotifications are the user subscriptions to the projects runs
+// email notifications
+type UserEmailNotifications struct {
+	Email string `json:"email,omitempty"`
+	// Mode is the default mode of the subscribed projects
+	Mode NotificationMode `json:"mode,omitempty"`
+	// Projects are the subscribed projects modes keyed by project id. An empty
+	// mode uses the default one
+	Projects map[string]NotificationMode `json:"projects,omitempty"`
+	// Digest sends a periodic digest of the notified runs instead of an email
+	// for every run
+	Digest bool `json:"digest,omitempty"`
+}
+
+// UserTOTP is the user TOTP two factor authentication. The secret is saved at
+// enrollment and the two factor authentication is enabled after the user
+// confirms it with a valid code.
+type UserTOTP struct {
+	Secret  string `json:"secret,omitempty"`
+	Enabled bool   `json:"enabled,omitempty"`
+
+	// LastUsedStep is the time step of the last accepted code. The codes of
+	// the same or older steps are rejected to avoid their reuse.
+	LastUsedStep int64 `json:"last_used_step,omitempty"`
+	// FailedAttempts is the number of consecutive invalid codes
+	FailedAttempts int `json:"failed_attempts,omitempty"`
+	// LockedUntil is set after too many invalid codes. Until then all the
+	// codes are rejected.
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+}
+
+type TokenScope string
+
+const (
+	// TokenScopeReadOnly permits only read requests
+	TokenScopeReadOnly TokenScope = "read-only"
+	// TokenScopeTriggerRuns permits creating runs and executing run and task actions
+	TokenScopeTriggerRuns TokenScope = "trigger-runs"
+	// TokenScopeManageSecrets permits creating, updating and deleting secrets
+	TokenScopeManageSecrets TokenScope = "manage-secrets"
+	// TokenScopeAdmin permits all the requests
+	TokenScopeAdmin TokenScope = "admin"
+)
+
+func IsValidTokenScope(s TokenScope) bool {
+	switch s {
+	case TokenScopeReadOnly, TokenScopeTriggerRuns, TokenScopeManageSecrets, TokenScopeAdmin:
+		return true
+	}
+	return false
+}
+
+type UserTokenInfo struct {
+	// Scopes are the token scopes. An empty list means all the scopes
+	Scopes []TokenScope `json:"scopes,omitempty"`
+	// ExpiresAt is the token expiration time. A zero value means no
+	// expiration
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+
+	CreatedAt  time.Time `json:"created_at,omitempty"`
+	LastUsedAt time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string    `json:"last_used_ip,omitempty"`
+}
+
+// HasScope reports if the token permits requests requiring the provided
+// scope. Every scope permits read only requests and the admin scope permits
+// everything.
+func (t *UserTokenInfo) HasScope(scope TokenScope) bool {
+	if t == nil || len(t.Scopes) == 0 {
+		return true
+	}
+	if scope == TokenScopeReadOnly {
+		return true
+	}
+	for _, s := range t.Scopes {
+		if s == scope || s == TokenScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// IsExpired reports if the token is expired at the provided time
+func (t *UserTokenInfo) IsExpired(now time.Time) bool {
+	if t == nil || t.ExpiresAt.IsZero() {
+		return false
+	}
+	return !now.Before(t.ExpiresAt)
+}
+
+// UserSession is a user login session. The session id is saved in the login
+// token and the session is valid until it expires or it's removed
+type UserSession struct {
+	CreatedAt  time.Time `json:"created_at,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at,omitempty"`
+	LastUsedAt time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string    `json:"last_used_ip,omitempty"`
+}
+
+// IsExpired reports if the session is expired at the provided time
+func (s *UserSession) IsExpired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
 }
 
 type Organization struct {
@@ -139,6 +352,62 @@ type ProjectGroup struct {
 	Parent Parent `json:"parent,omitempty"`
 
 	Visibility Visibility `json:"visibility,omitempty"`
+
+	// Settings are inherited by the project group childs
+	Settings *ProjectGroupSettings `json:"settings,omitempty"`
+}
+
+// ProjectGroupSettings defines the settings inherited by the project group
+// childs. A child inherits every setting from its nearest ancestor defining
+// it.
+type ProjectGroupSettings struct {
+	// DefaultVisibility is the visibility of the new childs created without
+	// an explicit visibility
+	DefaultVisibility Visibility `json:"default_visibility,omitempty"`
+	// RunDefaults are the run defaults of the new projects
+	RunDefaults *ProjectRunDefaults `json:"run_defaults,omitempty"`
+}
+
+// TrashItem is a deleted project or project group kept until the trash
+// retention expires. It contains the deleted object and all its childs
+// (subgroups, projects, secrets and variables) so they can be restored.
+type TrashItem struct {
+	Version string `json:"version,omitempty"`
+
+	ID string `json:"id,omitempty"`
+
+	// ObjectType is the type of the deleted object (project or projectgroup).
+	// The deleted object is the first item of the related list
+	ObjectType ConfigType `json:"object_type,omitempty"`
+	ObjectID   string     `json:"object_id,omitempty"`
+
+	// Path is the deleted object path
+	Path string `json:"path,omitempty"`
+
+	OwnerType ConfigType `json:"owner_type,omitempty"`
+	OwnerID   string     `json:"owner_id,omitempty"`
+
+	DeletionTime time.Time `json:"deletion_time,omitempty"`
+
+	ProjectGroups []*ProjectGroup `json:"project_groups,omitempty"`
+	Projects      []*Project      `json:"projects,omitempty"`
+	Secrets       []*Secret       `json:"secrets,omitempty"`
+	Variables     []*Variable     `json:"variables,omitempty"`
+}
+
+// PathAlias is a previous path of a renamed project or project group. The
+// paths starting with it are resolved using the object current path.
+type PathAlias struct {
+	Version string `json:"version,omitempty"`
+
+	ID string `json:"id,omitempty"`
+
+	Path string `json:"path,omitempty"`
+
+	ObjectType ConfigType `json:"object_type,omitempty"`
+	ObjectID   string     `json:"object_id,omitempty"`
+
+	CreationTime time.Time `json:"creation_time,omitempty"`
 }
 
 type RemoteSourceType string
@@ -181,6 +450,18 @@ type RemoteSource struct {
 
 	RegistrationEnabled *bool `json:"registration_enabled,omitempty"`
 	LoginEnabled        *bool `json:"login_enabled,omitempty"`
+
+	// UserNameMapping defines how the remote login name is converted to an
+	// agola user name when provisioning users from this remote source
+	UserNameMapping *UserNameMapping `json:"username_mapping,omitempty"`
+}
+
+type UserNameMapping struct {
+	// StripDomain removes the domain part (everything starting from the
+	// first "@") of the remote login name
+	StripDomain bool `json:"strip_domain,omitempty"`
+	// Prefix is prepended to the user name (i.e. the remote source name)
+	Prefix string `json:"prefix,omitempty"`
 }
 
 func (rs *RemoteSource) UnmarshalJSON(b []byte) error {
@@ -307,6 +588,138 @@ type Project struct {
 	// Webhooksecret is the secret passed to git sources that support a
 	// secret/token for signing or verifying the webhook payload
 	WebhookSecret string `json:"webhook_secret,omitempty"`
+
+	// QuarantinedTasks are the names of the tasks whose failures are ignored
+	// (i.e. flaky tasks that shouldn't block the runs)
+	QuarantinedTasks []string `json:"quarantined_tasks,omitempty"`
+
+	// CoverageBaseBranch is the branch used as the coverage baseline for the
+	// pull requests. When set a commit status is reported on the pull requests
+	// with the coverage change.
+	CoverageBaseBranch string `json:"coverage_base_branch,omitempty"`
+
+	// CloneURL is an alternate clone url (i.e. an internal mirror of the
+	// remote repository) used by the clone step instead of the remote source
+	// clone url
+	CloneURL string `json:"clone_url,omitempty"`
+
+	// RunDefaults are the project run settings enforced when creating the
+	// runs, editable without changing the repository run config
+	RunDefaults *ProjectRunDefaults `json:"run_defaults,omitempty"`
+
+	// AnonymousAccess restricts the data of the public project visible to
+	// the anonymous users in addition to the instance settings
+	AnonymousAccess *AnonymousAccess `json:"anonymous_access,omitempty"`
+
+	// Polling, when not nil, enables the polling of the remote repository
+	Polling *ProjectPolling `json:"polling,omitempty"`
+
+	// Schedules are the cron schedules periodically creating the project
+	// branch runs
+	Schedules []*ProjectSchedule `json:"schedules,omitempty"`
+
+	// ConfigDirs are the repository directories (path.Match patterns matched
+	// per path element) containing their own config directory. Every config
+	// generates independent runs, created only when the run commits change
+	// the files inside its directory. "." is the repository root directory.
+	// When empty only the root config is used.
+	ConfigDirs []string `json:"config_dirs,omitempty"`
+
+	// ConfigPath, when set, is the path of the config file used instead of
+	// the default config dir. It's relative to the repository root (or to
+	// every config dir)
+	ConfigPath string `json:"config_path,omitempty"`
+
+	// ConfigRepo, when not nil, is the repository providing the run config
+	// instead of the project repository
+	ConfigRepo *ProjectConfigRepo `json:"config_repo,omitempty"`
+
+	// RemoteTasksRepos are the repositories, on the project remote source,
+	// in addition to the project (and config) repository, whose remote tasks
+	// can be used by the project runs
+	RemoteTasksRepos []string `json:"remote_tasks_repos,omitempty"`
+
+	// TaskCommitStatuses reports a commit status per run task instead of a
+	// single status for the whole run
+	TaskCommitStatuses bool `json:"task_commit_statuses,omitempty"`
+
+	// EmailNotifications are the project runs email notifications sent to
+	// fixed recipients (i.e. a team mailing list)
+	EmailNotifications *ProjectEmailNotifications `json:"email_notifications,omitempty"`
+
+	// NotificationChannels are the chat channels notified of the finished runs
+	NotificationChannels []*ProjectNotificationChannel `json:"notification_channels,omitempty"`
+
+	// NotificationRules define additional notifications of the finished runs
+	// to the project notification channels
+	NotificationRules []*NotificationRule `json:"notification_rules,omitempty"`
+}
+
+// AnonymousAccess defines the runs data of the public projects hidden to the
+// anonymous users. Everything is visible by default.
+type AnonymousAccess struct {
+	// HideRuns hides the runs lists, details and stats and so all the other
+	// runs data. The project badges are still available.
+	HideRuns bool `json:"hide_runs,omitempty"`
+	// HideLogs hides the run steps logs
+	HideLogs bool `json:"hide_logs,omitempty"`
+	// HideArtifacts hides the run tasks test results and coverage reports
+	HideArtifacts bool `json:"hide_artifacts,omitempty"`
+	// HideConfig hides the run config
+	HideConfig bool `json:"hide_config,omitempty"`
+}
+
+// ProjectRunDefaults defines the project run settings. Zero values mean no
+// limit.
+type ProjectRunDefaults struct {
+	// TaskTimeout is the max duration of a task execution, the tasks running
+	// for more are stopped
+	TaskTimeout time.Duration `json:"task_timeout,omitempty"`
+	// AllowedImages are regular expressions matching the allowed tasks
+	// containers images. When empty all the images are allowed
+	AllowedImages []string `json:"allowed_images,omitempty"`
+	// AllowedArchs are the allowed tasks runtime architectures. When empty
+	// all the architectures are allowed
+	AllowedArchs []string `json:"allowed_archs,omitempty"`
+	// MaxTasks is the max number of tasks of a run
+	MaxTasks int `json:"max_tasks,omitempty"`
+	// ArtifactsRetention is how long the tasks workspace archives are kept
+	// after the task end
+	ArtifactsRetention time.Duration `json:"artifacts_retention,omitempty"`
+}
+
+type ProjectChangeAction string
+
+const (
+	ProjectChangeActionCreate   ProjectChangeAction = "create"
+	ProjectChangeActionUpdate   ProjectChangeAction = "update"
+	ProjectChangeActionDelete   ProjectChangeAction = "delete"
+	ProjectChangeActionRollback ProjectChangeAction = "rollback"
+)
+
+// ProjectChange records a change to a project settings, variables or secrets
+type ProjectChange struct {
+	ID        string `json:"id,omitempty"`
+	ProjectID string `json:"project_id,omitempty"`
+
+	Action ProjectChangeAction `json:"action,omitempty"`
+
+	// ObjectType is the type of the changed object (project, variable or
+	// secret)
+	ObjectType ConfigType `json:"object_type,omitempty"`
+	ObjectID   string     `json:"object_id,omitempty"`
+	ObjectName string     `json:"object_name,omitempty"`
+
+	// ChangedBy is the id of the user that made the change
+	ChangedBy  string    `json:"changed_by,omitempty"`
+	ChangeTime time.Time `json:"change_time,omitempty"`
+
+	// Data is the object after the change with the sensitive values (secret
+	// data, private keys) redacted. Empty for deletions.
+	Data json.RawMessage `json:"data,omitempty"`
+
+	// RollbackFrom is the id of the change restored by a rollback
+	RollbackFrom string `json:"rollback_from,omitempty"`
 }
 
 type SecretType string
@@ -360,6 +773,196 @@ type When struct {
 	Branch *WhenConditions `json:"branch,omitempty"`
 	Tag    *WhenConditions `json:"tag,omitempty"`
 	Ref    *WhenConditions `json:"ref,omitempty"`
+
+	// PullRequest conditions must be satisfied in addition to the branch, tag
+	// and ref conditions
+	PullRequest *WhenPullRequest `json:"pull_request,omitempty"`
+
+	// Expr is a config template expression that must be satisfied in
+	// addition to the other conditions. It needs the run context variables so
+	// it isn't evaluated by MatchWhen but when generating the run config.
+	Expr string `json:"expr,omitempty"`
+}
+
+// WhenPullRequest defines conditions on the pull request attributes. When the
+// run isn't for a pull request the attributes are considered empty (not
+// draft, without labels and target branch).
+type WhenPullRequest struct {
+	// Draft, when set, matches only draft (true) or non draft (false) pull
+	// requests
+	Draft *bool `json:"draft,omitempty"`
+	// Labels matches when at least one label matches the includes (if any)
+	// and no label matches the excludes
+	Labels *WhenConditions `json:"labels,omitempty"`
+	// TargetBranch matches when the target branch matches the includes (if
+	// any) and doesn't match the excludes
+	TargetBranch *WhenConditions `json:"target_branch,omitempty"`
+}
+
+// ProjectConfigRepo is a repository, on the project remote source, providing
+// the project run config. It lets a team centrally own the pipelines of many
+// repositories.
+type ProjectConfigRepo struct {
+	RepositoryPath string `json:"repository_path,omitempty"`
+	// Ref is the config repository branch name or full ref
+	Ref string `json:"ref,omitempty"`
+}
+
+// ProjectEmailNotifications are the project runs email notifications
+// settings
+type ProjectEmailNotifications struct {
+	Recipients []string         `json:"recipients,omitempty"`
+	Mode       NotificationMode `json:"mode,omitempty"`
+	// Digest sends a periodic digest of the notified runs instead of an email
+	// for every run
+	Digest bool `json:"digest,omitempty"`
+}
+
+type NotificationChannelType string
+
+const (
+	NotificationChannelTypeMatrix   NotificationChannelType = "matrix"
+	NotificationChannelTypeTelegram NotificationChannelType = "telegram"
+	NotificationChannelTypeDiscord  NotificationChannelType = "discord"
+)
+
+func IsValidNotificationChannelType(t NotificationChannelType) bool {
+	switch t {
+	case NotificationChannelTypeMatrix:
+	case NotificationChannelTypeTelegram:
+	case NotificationChannelTypeDiscord:
+	default:
+		return false
+	}
+	return true
+}
+
+// ProjectNotificationChannel is a chat channel notified of the project
+// finished runs
+type ProjectNotificationChannel struct {
+	Name string                  `json:"name,omitempty"`
+	Type NotificationChannelType `json:"type,omitempty"`
+	// Mode defines the runs always notified to the channel. An empty mode
+	// notifies only the runs matching the project notification rules
+	Mode NotificationMode `json:"mode,omitempty"`
+	// Options are the channel type specific options (i.e. the matrix room id
+	// or the telegram chat id)
+	Options map[string]string `json:"options,omitempty"`
+	// SecretName is the name of the project secret containing the channel
+	// credentials (i.e. the bot access token or the webhook url)
+	SecretName string `json:"secret_name,omitempty"`
+}
+
+type NotificationRuleResult string
+
+const (
+	NotificationRuleResultSuccess NotificationRuleResult = "success"
+	NotificationRuleResultFailed  NotificationRuleResult = "failed"
+	NotificationRuleResultStopped NotificationRuleResult = "stopped"
+	// NotificationRuleResultFixed is a successful run after a failed one
+	NotificationRuleResultFixed NotificationRuleResult = "fixed"
+	// NotificationRuleResultBroken is a failed run after a not failed one
+	NotificationRuleResultBroken NotificationRuleResult = "broken"
+)
+
+func IsValidNotificationRuleResult(r NotificationRuleResult) bool {
+	switch r {
+	case NotificationRuleResultSuccess:
+	case NotificationRuleResultFailed:
+	case NotificationRuleResultStopped:
+	case NotificationRuleResultFixed:
+	case NotificationRuleResultBroken:
+	default:
+		return false
+	}
+	return true
+}
+
+// NotificationRule notifies the target channels of the finished runs matching
+// all the rule conditions. Empty conditions match all the runs.
+type NotificationRule struct {
+	Name string `json:"name,omitempty"`
+	// RefTypes are the matched run ref types
+	RefTypes []RunRefType `json:"ref_types,omitempty"`
+	// Branches, when defined, matches only the branch runs with a matching
+	// branch
+	Branches *WhenConditions `json:"branches,omitempty"`
+	// Tags, when defined, matches only the tag runs with a matching tag
+	Tags *WhenConditions `json:"tags,omitempty"`
+	// Results are the matched run results and result transitions
+	Results []NotificationRuleResult `json:"results,omitempty"`
+	// Channels are the names of the notified project notification channels
+	Channels []string `json:"channels,omitempty"`
+}
+
+// Match reports whether the rule matches a finished run. refName is the run
+// branch or tag and results are all the run results (i.e. failed and broken
+// for a failed run after a successful one).
+func (r *NotificationRule) Match(refType RunRefType, refName string, results []NotificationRuleResult) bool {
+	if len(r.RefTypes) > 0 {
+		found := false
+		for _, t := range r.RefTypes {
+			if t == refType {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.Branches != nil && (refType != RunRefTypeBranch || !matchConditions(r.Branches, refName)) {
+		return false
+	}
+	if r.Tags != nil && (refType != RunRefTypeTag || !matchConditions(r.Tags, refName)) {
+		return false
+	}
+	if len(r.Results) > 0 {
+		for _, rr := range r.Results {
+			for _, result := range results {
+				if rr == result {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// matchConditions reports whether s is included (all the values are included
+// when there aren't include conditions) and not excluded
+func matchConditions(conds *WhenConditions, s string) bool {
+	if len(conds.Include) > 0 && !matchCondition(conds.Include, s) {
+		return false
+	}
+	return !matchCondition(conds.Exclude, s)
+}
+
+// ProjectPolling configures the periodic polling of the remote repository
+// branches, tags and pull requests. It's used instead of the webhooks when
+// they can't reach the agola instance.
+type ProjectPolling struct {
+	Interval time.Duration `json:"interval,omitempty"`
+	// Refs are the commit sha of the refs seen by the last poll keyed by ref
+	Refs map[string]string `json:"refs,omitempty"`
+}
+
+// ProjectSchedule periodically creates a run of the current branch commit at
+// the times matching its cron expression (evaluated in UTC)
+type ProjectSchedule struct {
+	Name   string `json:"name,omitempty"`
+	Cron   string `json:"cron,omitempty"`
+	Branch string `json:"branch,omitempty"`
+}
+
+// PullRequestAttributes are the pull request attributes used by the when
+// pull request conditions
+type PullRequestAttributes struct {
+	Draft        bool     `json:"draft,omitempty"`
+	Labels       []string `json:"labels,omitempty"`
+	TargetBranch string   `json:"target_branch,omitempty"`
 }
 
 type WhenConditions struct {
@@ -379,10 +982,14 @@ type WhenCondition struct {
 	Match string            `json:"match,omitempty"`
 }
 
-func MatchWhen(when *When, branch, tag, ref string) bool {
+// MatchWhen reports whether the when conditions are satisfied. pr are the
+// pull request attributes, nil if the run isn't for a pull request.
+func MatchWhen(when *When, branch, tag, ref string, pr *PullRequestAttributes) bool {
 	include := true
 	if when != nil {
-		include = false
+		// with only pull request conditions or an expression the branch, tag
+		// and ref always match
+		include = when.Branch == nil && when.Tag == nil && when.Ref == nil && (when.PullRequest != nil || when.Expr != "")
 		// test only if branch is not empty, if empty mean that we are not in a branch
 		if when.Branch != nil && branch != "" {
 			// first check includes and override with excludes
@@ -414,10 +1021,52 @@ func MatchWhen(when *When, branch, tag, ref string) bool {
 			}
 		}
 	}
+	if when != nil && when.PullRequest != nil && !matchPullRequest(when.PullRequest, pr) {
+		include = false
+	}
 
 	return include
 }
 
+func matchPullRequest(wpr *WhenPullRequest, pr *PullRequestAttributes) bool {
+	if pr == nil {
+		pr = &PullRequestAttributes{}
+	}
+
+	if wpr.Draft != nil && *wpr.Draft != pr.Draft {
+		return false
+	}
+	if wpr.Labels != nil {
+		if len(wpr.Labels.Include) > 0 {
+			included := false
+			for _, label := range pr.Labels {
+				if matchCondition(wpr.Labels.Include, label) {
+					included = true
+					break
+				}
+			}
+			if !included {
+				return false
+			}
+		}
+		for _, label := range pr.Labels {
+			if matchCondition(wpr.Labels.Exclude, label) {
+				return false
+			}
+		}
+	}
+	if wpr.TargetBranch != nil {
+		if len(wpr.TargetBranch.Include) > 0 && !matchCondition(wpr.TargetBranch.Include, pr.TargetBranch) {
+			return false
+		}
+		if matchCondition(wpr.TargetBranch.Exclude, pr.TargetBranch) {
+			return false
+		}
+	}
+
+	return true
+}
+
 func matchCondition(conds []WhenCondition, s string) bool {
 	for _, cond := range conds {
 		switch cond.Type {
@@ -16,15 +16,19 @@ package types
 
 import (
 	"testing"
+	"time"
 )
 
 func TestMatchWhen(t *testing.T) {
+	falseValue := false
+
 	tests := []struct {
 		name   string
 		when   *When
 		branch string
 		tag    string
 		ref    string
+		pr     *PullRequestAttributes
 		out    bool
 	}{
 		{
@@ -263,14 +267,245 @@ func TestMatchWhen(t *testing.T) {
 			branch: "master",
 			out:    false,
 		},
+		{
+			name: "test pull request draft condition on a draft pull request, should not match",
+			when: &When{
+				PullRequest: &WhenPullRequest{Draft: &falseValue},
+			},
+			branch: "master",
+			pr:     &PullRequestAttributes{Draft: true},
+			out:    false,
+		},
+		{
+			name: "test pull request draft condition on a non pull request run, should match",
+			when: &When{
+				PullRequest: &WhenPullRequest{Draft: &falseValue},
+			},
+			branch: "master",
+			out:    true,
+		},
+		{
+			name: "test pull request label condition with matching label, should match",
+			when: &When{
+				Branch: &WhenConditions{
+					Include: []WhenCondition{{Type: WhenConditionTypeSimple, Match: "master"}},
+				},
+				PullRequest: &WhenPullRequest{
+					Labels: &WhenConditions{
+						Include: []WhenCondition{{Type: WhenConditionTypeSimple, Match: "e2e"}},
+					},
+				},
+			},
+			branch: "master",
+			pr:     &PullRequestAttributes{Labels: []string{"bug", "e2e"}},
+			out:    true,
+		},
+		{
+			name: "test pull request label condition without matching label, should not match",
+			when: &When{
+				PullRequest: &WhenPullRequest{
+					Labels: &WhenConditions{
+						Include: []WhenCondition{{Type: WhenConditionTypeSimple, Match: "e2e"}},
+					},
+				},
+			},
+			branch: "master",
+			pr:     &PullRequestAttributes{Labels: []string{"bug"}},
+			out:    false,
+		},
+		{
+			name: "test pull request target branch exclude condition, should not match",
+			when: &When{
+				PullRequest: &WhenPullRequest{
+					TargetBranch: &WhenConditions{
+						Exclude: []WhenCondition{{Type: WhenConditionTypeRegExp, Match: "release-.*"}},
+					},
+				},
+			},
+			branch: "release-1",
+			pr:     &PullRequestAttributes{TargetBranch: "release-1"},
+			out:    false,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			out := MatchWhen(tt.when, tt.branch, tt.tag, tt.ref)
+			out := MatchWhen(tt.when, tt.branch, tt.tag, tt.ref, tt.pr)
 			if tt.out != out {
 				t.Fatalf("expected match: %t, got: %t", tt.out, out)
 			}
 		})
 	}
 }
+
+func TestUserTokenInfo(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		info    *UserTokenInfo
+		scope   TokenScope
+		allowed bool
+		expired bool
+	}{
+		{
+			name:    "test token without info",
+			info:    nil,
+			scope:   TokenScopeAdmin,
+			allowed: true,
+		},
+		{
+			name:    "test token without scopes",
+			info:    &UserTokenInfo{},
+			scope:   TokenScopeManageSecrets,
+			allowed: true,
+		},
+		{
+			name:    "test read only token with read request",
+			info:    &UserTokenInfo{Scopes: []TokenScope{TokenScopeReadOnly}},
+			scope:   TokenScopeReadOnly,
+			allowed: true,
+		},
+		{
+			name:    "test read only token with trigger runs request",
+			info:    &UserTokenInfo{Scopes: []TokenScope{TokenScopeReadOnly}},
+			scope:   TokenScopeTriggerRuns,
+			allowed: false,
+		},
+		{
+			name:    "test trigger runs token with read request",
+			info:    &UserTokenInfo{Scopes: []TokenScope{TokenScopeTriggerRuns}},
+			scope:   TokenScopeReadOnly,
+			allowed: true,
+		},
+		{
+			name:    "test trigger runs token with manage secrets request",
+			info:    &UserTokenInfo{Scopes: []TokenScope{TokenScopeTriggerRuns}},
+			scope:   TokenScopeManageSecrets,
+			allowed: false,
+		},
+		{
+			name:    "test multiple scopes token",
+			info:    &UserTokenInfo{Scopes: []TokenScope{TokenScopeTriggerRuns, TokenScopeManageSecrets}},
+			scope:   TokenScopeManageSecrets,
+			allowed: true,
+		},
+		{
+			name:    "test admin token",
+			info:    &UserTokenInfo{Scopes: []TokenScope{TokenScopeAdmin}},
+			scope:   TokenScopeTriggerRuns,
+			allowed: true,
+		},
+		{
+			name:    "test not expired token",
+			info:    &UserTokenInfo{ExpiresAt: now.Add(time.Hour)},
+			scope:   TokenScopeReadOnly,
+			allowed: true,
+		},
+		{
+			name:    "test expired token",
+			info:    &UserTokenInfo{ExpiresAt: now.Add(-time.Hour)},
+			scope:   TokenScopeReadOnly,
+			allowed: true,
+			expired: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if allowed := tt.info.HasScope(tt.scope); allowed != tt.allowed {
+				t.Fatalf("expected allowed %t, got %t", tt.allowed, allowed)
+			}
+			if expired := tt.info.IsExpired(now); expired != tt.expired {
+				t.Fatalf("expected expired %t, got %t", tt.expired, expired)
+			}
+		})
+	}
+}
+
+func TestNotificationRuleMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    *NotificationRule
+		refType RunRefType
+		refName string
+		results []NotificationRuleResult
+		out     bool
+	}{
+		{
+			name:    "test empty rule",
+			rule:    &NotificationRule{},
+			refType: RunRefTypeBranch,
+			refName: "master",
+			results: []NotificationRuleResult{NotificationRuleResultSuccess},
+			out:     true,
+		},
+		{
+			name:    "test failed tag rule with failed tag run",
+			rule:    &NotificationRule{RefTypes: []RunRefType{RunRefTypeTag}, Results: []NotificationRuleResult{NotificationRuleResultFailed}},
+			refType: RunRefTypeTag,
+			refName: "v1.0.0",
+			results: []NotificationRuleResult{NotificationRuleResultFailed, NotificationRuleResultBroken},
+			out:     true,
+		},
+		{
+			name:    "test failed tag rule with successful tag run",
+			rule:    &NotificationRule{RefTypes: []RunRefType{RunRefTypeTag}, Results: []NotificationRuleResult{NotificationRuleResultFailed}},
+			refType: RunRefTypeTag,
+			refName: "v1.0.0",
+			results: []NotificationRuleResult{NotificationRuleResultSuccess},
+			out:     false,
+		},
+		{
+			name:    "test failed tag rule with failed branch run",
+			rule:    &NotificationRule{RefTypes: []RunRefType{RunRefTypeTag}, Results: []NotificationRuleResult{NotificationRuleResultFailed}},
+			refType: RunRefTypeBranch,
+			refName: "master",
+			results: []NotificationRuleResult{NotificationRuleResultFailed},
+			out:     false,
+		},
+		{
+			name: "test branch include",
+			rule: &NotificationRule{Branches: &WhenConditions{
+				Include: []WhenCondition{{Type: WhenConditionTypeRegExp, Match: "release/.*"}},
+			}},
+			refType: RunRefTypeBranch,
+			refName: "release/1.0",
+			out:     true,
+		},
+		{
+			name: "test branch exclude",
+			rule: &NotificationRule{Branches: &WhenConditions{
+				Exclude: []WhenCondition{{Type: WhenConditionTypeSimple, Match: "master"}},
+			}},
+			refType: RunRefTypeBranch,
+			refName: "master",
+			out:     false,
+		},
+		{
+			name: "test branch conditions with tag run",
+			rule: &NotificationRule{Branches: &WhenConditions{
+				Exclude: []WhenCondition{{Type: WhenConditionTypeSimple, Match: "master"}},
+			}},
+			refType: RunRefTypeTag,
+			refName: "v1.0.0",
+			out:     false,
+		},
+		{
+			name:    "test fixed result",
+			rule:    &NotificationRule{Results: []NotificationRuleResult{NotificationRuleResultFixed, NotificationRuleResultBroken}},
+			refType: RunRefTypePullRequest,
+			refName: "",
+			results: []NotificationRuleResult{NotificationRuleResultSuccess, NotificationRuleResultFixed},
+			out:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if out := tt.rule.Match(tt.refType, tt.refName, tt.results); out != tt.out {
+				t.Fatalf("expected match: %t, got: %t", tt.out, out)
+			}
+		})
+	}
+}
@@ -44,6 +44,12 @@ type WebhookData struct {
 	PullRequestID   string `json:"pull_request_id,omitempty"`
 	PullRequestLink string `json:"link,omitempty"` // Link to pull request
 
+	PullRequestAttributes *PullRequestAttributes `json:"pull_request_attributes,omitempty"`
+
+	// ChangedFiles are the paths of the files changed by the pushed commits,
+	// nil when they aren't known
+	ChangedFiles []string `json:"changed_files,omitempty"`
+
 	Repo WebhookDataRepo `json:"repo,omitempty"`
 }
 
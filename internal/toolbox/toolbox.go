@@ -0,0 +1,27 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package toolbox
+
+// ProtocolVersion is the version of the protocol (commands, arguments and
+// outputs) used by the executor to talk with the toolbox. It must be increased
+// on every incompatible change so executors and runservices of different
+// versions can detect it.
+const ProtocolVersion = 1
+
+// VersionInfo is the output of the toolbox version command
+type VersionInfo struct {
+	Version         string `json:"version,omitempty"`
+	ProtocolVersion int    `json:"protocol_version,omitempty"`
+}
@@ -0,0 +1,188 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	errors "golang.org/x/xerrors"
+)
+
+// CronSchedule is a standard five fields cron expression (minute, hour, day
+// of month, month and day of week) evaluated in UTC. Every field accepts
+// "*", values, ranges ("1-5") and steps ("*/15", "0-30/10") or comma
+// separated lists of them. Like cron, when both the day of month and the day
+// of week are restricted a day matches when any of them matches.
+type CronSchedule struct {
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+
+	domStar bool
+	dowStar bool
+}
+
+type cronField struct {
+	name string
+	min  int
+	max  int
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12},
+	// 7 is also sunday
+	{name: "day of week", min: 0, max: 7},
+}
+
+// cronMaxYears limits the search of the next activation time of schedules
+// that never match (i.e. the 30th of February)
+const cronMaxYears = 5
+
+func ParseCronSchedule(spec string) (*CronSchedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, errors.Errorf("cron expression %q must have %d fields", spec, len(cronFields))
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, f := range fields {
+		b, err := parseCronField(f, cronFields[i])
+		if err != nil {
+			return nil, errors.Errorf("cron expression %q: %w", spec, err)
+		}
+		bits[i] = b
+	}
+
+	s := &CronSchedule{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}
+	// sunday is both 0 and 7
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+
+	return s, nil
+}
+
+func parseCronField(f string, cf cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(f, ",") {
+		rangePart := part
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rangePart = part[:i]
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, errors.Errorf("invalid %s step in %q", cf.name, part)
+			}
+		}
+
+		var start, end int
+		switch {
+		case rangePart == "*":
+			start, end = cf.min, cf.max
+		case strings.Contains(rangePart, "-"):
+			i := strings.Index(rangePart, "-")
+			var err error
+			if start, err = parseCronValue(rangePart[:i], cf); err != nil {
+				return 0, err
+			}
+			if end, err = parseCronValue(rangePart[i+1:], cf); err != nil {
+				return 0, err
+			}
+			if start > end {
+				return 0, errors.Errorf("invalid %s range %q", cf.name, rangePart)
+			}
+		default:
+			var err error
+			if start, err = parseCronValue(rangePart, cf); err != nil {
+				return 0, err
+			}
+			end = start
+			// a value with a step starts the step from the value
+			if step > 1 {
+				end = cf.max
+			}
+		}
+
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(s string, cf cronField) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, errors.Errorf("invalid %s value %q", cf.name, s)
+	}
+	if v < cf.min || v > cf.max {
+		return 0, errors.Errorf("%s value %d out of range [%d-%d]", cf.name, v, cf.min, cf.max)
+	}
+	return v, nil
+}
+
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Next returns the first activation time after t or the zero time if the
+// schedule never matches
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(cronMaxYears, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
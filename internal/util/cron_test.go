@@ -0,0 +1,137 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronSchedule(t *testing.T) {
+	tests := []struct {
+		spec string
+		err  bool
+	}{
+		{spec: "* * * * *"},
+		{spec: "*/15 0-6,22,23 1 */2 1-5"},
+		{spec: "0 0 * * 7"},
+		{spec: "5/10 * * * *"},
+		{spec: "", err: true},
+		{spec: "* * * *", err: true},
+		{spec: "* * * * * *", err: true},
+		{spec: "60 * * * *", err: true},
+		{spec: "* 24 * * *", err: true},
+		{spec: "* * 0 * *", err: true},
+		{spec: "* * * 13 *", err: true},
+		{spec: "* * * * 8", err: true},
+		{spec: "*/0 * * * *", err: true},
+		{spec: "5-1 * * * *", err: true},
+		{spec: "a * * * *", err: true},
+		{spec: "1,,2 * * * *", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			_, err := ParseCronSchedule(tt.spec)
+			if tt.err && err == nil {
+				t.Fatalf("expected error parsing %q", tt.spec)
+			}
+			if !tt.err && err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+		})
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	// a monday
+	now := time.Date(2019, 1, 7, 10, 30, 20, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		t    time.Time
+		next time.Time
+	}{
+		{
+			spec: "* * * * *",
+			t:    now,
+			next: time.Date(2019, 1, 7, 10, 31, 0, 0, time.UTC),
+		},
+		{
+			spec: "30 10 * * *",
+			t:    time.Date(2019, 1, 7, 10, 30, 0, 0, time.UTC),
+			next: time.Date(2019, 1, 8, 10, 30, 0, 0, time.UTC),
+		},
+		{
+			spec: "*/15 * * * *",
+			t:    now,
+			next: time.Date(2019, 1, 7, 10, 45, 0, 0, time.UTC),
+		},
+		{
+			spec: "0 2 * * *",
+			t:    now,
+			next: time.Date(2019, 1, 8, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			spec: "0 0 * * 0",
+			t:    now,
+			next: time.Date(2019, 1, 13, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			spec: "0 0 * * 7",
+			t:    now,
+			next: time.Date(2019, 1, 13, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			spec: "0 0 1 * *",
+			t:    time.Date(2019, 12, 15, 0, 0, 0, 0, time.UTC),
+			next: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			// day of month or day of week
+			spec: "0 0 15 * 5",
+			t:    now,
+			next: time.Date(2019, 1, 11, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			spec: "0 0 29 2 *",
+			t:    now,
+			next: time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			spec: "0 0 30 2 *",
+			t:    now,
+			next: time.Time{},
+		},
+		{
+			// evaluated in UTC
+			spec: "0 12 * * *",
+			t:    time.Date(2019, 1, 7, 12, 30, 0, 0, time.FixedZone("CET", 3600)),
+			next: time.Date(2019, 1, 7, 12, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := ParseCronSchedule(tt.spec)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if next := s.Next(tt.t); !next.Equal(tt.next) {
+				t.Fatalf("expected next time %s, got %s", tt.next, next)
+			}
+		})
+	}
+}
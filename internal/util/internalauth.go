@@ -0,0 +1,58 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// InternalAPITokenHeader is the header containing the token used by the agola
+// services to authenticate to the internal services APIs
+const InternalAPITokenHeader = "X-Agola-Internal-Token"
+
+// InternalAPIAuthHandler rejects the requests without one of the accepted
+// internal api tokens. When there're no accepted tokens all the requests are
+// accepted.
+type InternalAPIAuthHandler struct {
+	tokens []string
+	h      http.Handler
+}
+
+func NewInternalAPIAuthHandler(tokens []string, h http.Handler) *InternalAPIAuthHandler {
+	return &InternalAPIAuthHandler{
+		tokens: tokens,
+		h:      h,
+	}
+}
+
+func (h *InternalAPIAuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if len(h.tokens) == 0 {
+		h.h.ServeHTTP(w, r)
+		return
+	}
+
+	token := r.Header.Get(InternalAPITokenHeader)
+	if token != "" {
+		for _, t := range h.tokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+				h.h.ServeHTTP(w, r)
+				return
+			}
+		}
+	}
+
+	http.Error(w, "missing or invalid internal api token", http.StatusUnauthorized)
+}
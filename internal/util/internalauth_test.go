@@ -0,0 +1,61 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestInternalAPIAuthHandler(t *testing.T) {
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		tokens []string
+		token  string
+		code   int
+	}{
+		{name: "no tokens configured", token: "", code: http.StatusOK},
+		{name: "no tokens configured with a token", token: "token01", code: http.StatusOK},
+		{name: "missing token", tokens: []string{"token01"}, token: "", code: http.StatusUnauthorized},
+		{name: "wrong token", tokens: []string{"token01"}, token: "token02", code: http.StatusUnauthorized},
+		{name: "valid token", tokens: []string{"token01"}, token: "token01", code: http.StatusOK},
+		// during a rotation both the old and new tokens are accepted
+		{name: "rotation old token", tokens: []string{"token02", "token01"}, token: "token01", code: http.StatusOK},
+		{name: "rotation new token", tokens: []string{"token02", "token01"}, token: "token02", code: http.StatusOK},
+		{name: "token prefix", tokens: []string{"token01"}, token: "token0", code: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewInternalAPIAuthHandler(tt.tokens, okHandler)
+
+			r := httptest.NewRequest("GET", "/api/v1alpha/users", nil)
+			if tt.token != "" {
+				r.Header.Set(InternalAPITokenHeader, tt.token)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.code {
+				t.Fatalf("expected status code %d, got %d", tt.code, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	proxyProtocolV1Prefix        = "PROXY "
+	proxyProtocolV1MaxHeaderSize = 107
+	proxyProtocolHeaderTimeout   = 10 * time.Second
+)
+
+// ProxyProtocolListener is a net.Listener that handles the PROXY protocol
+// (version 1) header sent by the trusted proxies. For these connections the
+// remote address is the client address reported in the header.
+type ProxyProtocolListener struct {
+	net.Listener
+	trustedProxies []*net.IPNet
+}
+
+func NewProxyProtocolListener(l net.Listener, trustedProxies []*net.IPNet) *ProxyProtocolListener {
+	return &ProxyProtocolListener{Listener: l, trustedProxies: trustedProxies}
+}
+
+func (l *ProxyProtocolListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if addr, ok := c.RemoteAddr().(*net.TCPAddr); !ok || !IPInNets(addr.IP, l.trustedProxies) {
+		return c, nil
+	}
+	return &proxyProtocolConn{Conn: c, r: bufio.NewReaderSize(c, proxyProtocolV1MaxHeaderSize)}, nil
+}
+
+// proxyProtocolConn lazily reads the PROXY protocol header on the first Read
+// or RemoteAddr call so the listener Accept isn't blocked by slow clients.
+type proxyProtocolConn struct {
+	net.Conn
+	r *bufio.Reader
+
+	once       sync.Once
+	remoteAddr net.Addr
+	err        error
+}
+
+func (c *proxyProtocolConn) readHeader() {
+	c.once.Do(func() {
+		c.remoteAddr = c.Conn.RemoteAddr()
+
+		if err := c.Conn.SetReadDeadline(time.Now().Add(proxyProtocolHeaderTimeout)); err != nil {
+			c.err = err
+			return
+		}
+		defer func() {
+			if err := c.Conn.SetReadDeadline(time.Time{}); err != nil && c.err == nil {
+				c.err = err
+			}
+		}()
+
+		addr, err := readProxyProtocolV1Header(c.r)
+		if err != nil {
+			c.err = errors.Errorf("proxy protocol error: %w", err)
+			return
+		}
+		if addr != nil {
+			c.remoteAddr = addr
+		}
+	})
+}
+
+func (c *proxyProtocolConn) Read(b []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(b)
+}
+
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.readHeader()
+	return c.remoteAddr
+}
+
+// readProxyProtocolV1Header reads a PROXY protocol version 1 header. A nil
+// address is returned for the UNKNOWN protocol.
+func readProxyProtocolV1Header(r *bufio.Reader) (net.Addr, error) {
+	prefix, err := r.Peek(len(proxyProtocolV1Prefix))
+	if err != nil {
+		return nil, err
+	}
+	if string(prefix) != proxyProtocolV1Prefix {
+		return nil, errors.Errorf("missing header")
+	}
+
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return nil, errors.Errorf("invalid header: %w", err)
+	}
+	header := strings.TrimSuffix(string(line), "\r\n")
+	if len(header) == len(line) {
+		return nil, errors.Errorf("invalid header line termination")
+	}
+
+	fields := strings.Split(header, " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 {
+		return nil, errors.Errorf("invalid header %q", header)
+	}
+	if fields[1] != "TCP4" && fields[1] != "TCP6" {
+		return nil, errors.Errorf("unsupported protocol %q", fields[1])
+	}
+	ip := net.ParseIP(fields[2])
+	if ip == nil {
+		return nil, errors.Errorf("invalid source address %q", fields[2])
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, errors.Errorf("invalid source port %q", fields[4])
+	}
+
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
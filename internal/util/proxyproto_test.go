@@ -0,0 +1,67 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestReadProxyProtocolV1Header(t *testing.T) {
+	tests := []struct {
+		in   string
+		addr string
+		rest string
+		err  bool
+	}{
+		{"PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\nGET / HTTP/1.1\r\n", "192.168.0.1:56324", "GET / HTTP/1.1\r\n", false},
+		{"PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n", "[2001:db8::1]:56324", "", false},
+		{"PROXY UNKNOWN\r\nGET / HTTP/1.1\r\n", "", "GET / HTTP/1.1\r\n", false},
+		{"GET / HTTP/1.1\r\n", "", "", true},
+		{"PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\n", "", "", true},
+		{"PROXY TCP4 192.168.0.1 192.168.0.11 56324\r\n", "", "", true},
+		{"PROXY UDP4 192.168.0.1 192.168.0.11 56324 443\r\n", "", "", true},
+		{"PROXY TCP4 invalid 192.168.0.11 56324 443\r\n", "", "", true},
+		{"PROXY TCP4 192.168.0.1 192.168.0.11 99999 443\r\n", "", "", true},
+	}
+
+	for i, tt := range tests {
+		r := bufio.NewReader(strings.NewReader(tt.in))
+		addr, err := readProxyProtocolV1Header(r)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: unexpected error: %v", i, err)
+			continue
+		}
+		var addrs string
+		if addr != nil {
+			addrs = addr.String()
+		}
+		if addrs != tt.addr {
+			t.Errorf("%d: got address %q but wanted: %q", i, addrs, tt.addr)
+		}
+		rest := make([]byte, len(tt.in))
+		n, _ := r.Read(rest)
+		if string(rest[:n]) != tt.rest {
+			t.Errorf("%d: got remaining data %q but wanted: %q", i, rest[:n], tt.rest)
+		}
+	}
+}
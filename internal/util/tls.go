@@ -15,10 +15,16 @@
 package util
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
 	"io/ioutil"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 )
 
 func NewTLSConfig(certFile, keyFile, caFile string, insecureSkipVerify bool) (*tls.Config, error) {
@@ -62,3 +68,107 @@ func NewTLSConfig(certFile, keyFile, caFile string, insecureSkipVerify bool) (*t
 
 	return &tlsConfig, nil
 }
+
+// CertReloader keeps a tls certificate loaded from a certificate and key pair
+// files and reloads it when the files change or when the process receives a
+// SIGHUP. Its GetCertificate method can be used as tls.Config GetCertificate.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	m           sync.RWMutex
+	cert        *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the certificate and key pair files
+func (r *CertReloader) Reload() error {
+	certModTime, keyModTime, err := r.modTimes()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.cert = &cert
+	r.certModTime = certModTime
+	r.keyModTime = keyModTime
+
+	return nil
+}
+
+func (r *CertReloader) modTimes() (time.Time, time.Time, error) {
+	certFi, err := os.Stat(r.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	keyFi, err := os.Stat(r.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return certFi.ModTime(), keyFi.ModTime(), nil
+}
+
+func (r *CertReloader) changed() bool {
+	certModTime, keyModTime, err := r.modTimes()
+	if err != nil {
+		return false
+	}
+
+	r.m.RLock()
+	defer r.m.RUnlock()
+	return !certModTime.Equal(r.certModTime) || !keyModTime.Equal(r.keyModTime)
+}
+
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	return r.cert, nil
+}
+
+// Run reloads the certificate on SIGHUP and, when interval is greater than 0,
+// when the certificate or key files modification time changes. On reload
+// errors the current certificate is kept.
+func (r *CertReloader) Run(ctx context.Context, interval time.Duration, errFn func(error)) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+
+	var tickCh <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tickCh = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigs:
+		case <-tickCh:
+			if !r.changed() {
+				continue
+			}
+		}
+		if err := r.Reload(); err != nil {
+			errFn(err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	errors "golang.org/x/xerrors"
+)
+
+// TOTP parameters (RFC 6238) compatible with the common authenticator apps
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	// totpSkewSteps is the number of time steps accepted before and after the
+	// current one to tolerate clock differences
+	totpSkewSteps = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a new base32 encoded TOTP secret
+func GenerateTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// TOTPCode returns the TOTP code of the secret at the provided time
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", errors.Errorf("failed to decode totp secret: %w", err)
+	}
+	return hotp(key, uint64(t.Unix()/totpPeriod)), nil
+}
+
+// ValidateTOTPCode returns true if the code is valid for the secret at the
+// provided time and the time step matching the code. The caller should save
+// the step and reject the codes of the same or older steps to avoid their
+// reuse.
+func ValidateTOTPCode(secret, code string, t time.Time) (int64, bool, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false, errors.Errorf("failed to decode totp secret: %w", err)
+	}
+	if len(code) != totpDigits {
+		return 0, false, nil
+	}
+
+	counter := t.Unix() / totpPeriod
+	for i := int64(-totpSkewSteps); i <= totpSkewSteps; i++ {
+		if subtle.ConstantTimeCompare([]byte(hotp(key, uint64(counter+i))), []byte(code)) == 1 {
+			return counter + i, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// TOTPURL returns the otpauth url, usually shown as a qr code, used to add the
+// secret to an authenticator app
+func TOTPURL(issuer, accountName, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("period", fmt.Sprintf("%d", totpPeriod))
+	v.Set("digits", fmt.Sprintf("%d", totpDigits))
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + accountName,
+		RawQuery: v.Encode(),
+	}
+	return u.String()
+}
+
+// hotp returns the RFC 4226 HOTP value of the counter
+func hotp(key []byte, counter uint64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
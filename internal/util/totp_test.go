@@ -0,0 +1,86 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 test vectors secret ("12345678901234567890") truncated to 6
+	// digits
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		t    int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		code, err := TOTPCode(secret, time.Unix(tt.t, 0))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if code != tt.code {
+			t.Errorf("time %d: got code %q, want %q", tt.t, code, tt.code)
+		}
+	}
+}
+
+func TestValidateTOTPCode(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name  string
+		t     time.Time
+		valid bool
+		step  int64
+	}{
+		{name: "current code", t: now, valid: true, step: now.Unix() / totpPeriod},
+		{name: "previous code", t: now.Add(-totpPeriod * time.Second), valid: true, step: now.Unix()/totpPeriod - 1},
+		{name: "next code", t: now.Add(totpPeriod * time.Second), valid: true, step: now.Unix()/totpPeriod + 1},
+		{name: "expired code", t: now.Add(-3 * totpPeriod * time.Second), valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := TOTPCode(secret, tt.t)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			step, valid, err := ValidateTOTPCode(secret, code, now)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if valid != tt.valid {
+				t.Errorf("got valid %t, want %t", valid, tt.valid)
+			}
+			if valid && step != tt.step {
+				t.Errorf("got step %d, want %d", step, tt.step)
+			}
+		})
+	}
+}
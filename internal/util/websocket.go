@@ -0,0 +1,111 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+var WebsocketUpgrader = websocket.Upgrader{
+	// the clients are authenticated by the api handlers
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// WebsocketURL converts an http(s) url to a ws(s) url
+func WebsocketURL(u string) string {
+	if strings.HasPrefix(u, "http") {
+		return "ws" + strings.TrimPrefix(u, "http")
+	}
+	return u
+}
+
+// WebsocketWriter is an io.Writer sending the written data as websocket
+// binary messages. It's safe for concurrent use.
+type WebsocketWriter struct {
+	m    sync.Mutex
+	conn *websocket.Conn
+}
+
+func NewWebsocketWriter(conn *websocket.Conn) *WebsocketWriter {
+	return &WebsocketWriter{conn: conn}
+}
+
+func (w *WebsocketWriter) Write(p []byte) (int, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+	if err := w.conn.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// WriteClose sends a normal closure close message with the provided text
+func (w *WebsocketWriter) WriteClose(text string) error {
+	w.m.Lock()
+	defer w.m.Unlock()
+	return w.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, text))
+}
+
+// ProxyWebsocket copies the messages between the client and the server
+// connections until one of them is closed. The close message received from
+// the server is forwarded to the client. onClientMessage, when not nil, is
+// called for every message received from the client.
+func ProxyWebsocket(client, server *websocket.Conn, onClientMessage func(data []byte)) {
+	done := make(chan struct{})
+	clientWriter := NewWebsocketWriter(client)
+
+	go func() {
+		defer close(done)
+		for {
+			mt, data, err := server.ReadMessage()
+			if err != nil {
+				text := ""
+				if cerr, ok := err.(*websocket.CloseError); ok {
+					text = cerr.Text
+				}
+				_ = clientWriter.WriteClose(text)
+				return
+			}
+			clientWriter.m.Lock()
+			err = client.WriteMessage(mt, data)
+			clientWriter.m.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			mt, data, err := client.ReadMessage()
+			if err != nil {
+				_ = server.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			}
+			if onClientMessage != nil {
+				onClientMessage(data)
+			}
+			if err := server.WriteMessage(mt, data); err != nil {
+				return
+			}
+		}
+	}()
+
+	<-done
+}
@@ -209,6 +209,13 @@ func setup(ctx context.Context, t *testing.T, dir string) (*testutil.TestEmbedde
 				Path: filepath.Join(dir, "runservice/ost"),
 			},
 			RunCacheExpireInterval: 604800000000000,
+			TaskLeaseDuration:      30 * time.Second,
+			Janitor: config.RunserviceJanitor{
+				Interval:             1 * time.Minute,
+				TaskAckTimeout:       10 * time.Minute,
+				TaskMaxDispatches:    3,
+				TaskHeartbeatTimeout: 1 * time.Minute,
+			},
 		},
 		Executor: config.Executor{
 			Debug:         false,
@@ -250,6 +257,7 @@ func setup(ctx context.Context, t *testing.T, dir string) (*testutil.TestEmbedde
 			Etcd: config.Etcd{
 				Endpoints: "",
 			},
+			CleanupInterval: 1 * time.Hour,
 		},
 	}
 
@@ -536,7 +544,7 @@ func TestRun(t *testing.T) {
 	// TODO(sgotti) add an util to wait for a run phase
 	time.Sleep(10 * time.Second)
 
-	runs, _, err := gwClient.GetRuns(ctx, nil, nil, []string{path.Join("/project", project.ID)}, nil, "", 0, false)
+	runs, _, err := gwClient.GetRuns(ctx, &gwapi.GetRunsOptions{Groups: []string{path.Join("/project", project.ID)}})
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}